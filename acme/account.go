@@ -1,21 +1,44 @@
 package acme
 
 import (
+	"context"
 	"crypto"
 	"encoding/base64"
 	"encoding/json"
 
+	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
 )
 
 // Account is a subset of the internal account type containing only those
 // attributes required for responses in the ACME protocol.
 type Account struct {
-	ID        string           `json:"-"`
-	Key       *jose.JSONWebKey `json:"-"`
-	Contact   []string         `json:"contact,omitempty"`
-	Status    Status           `json:"status"`
-	OrdersURL string           `json:"orders"`
+	ID                string                                    `json:"-"`
+	ProvisionerID     string                                    `json:"-"`
+	Key               *jose.JSONWebKey                          `json:"-"`
+	Contact           []string                                  `json:"contact,omitempty"`
+	Status            Status                                    `json:"status"`
+	OrdersURL         string                                    `json:"orders"`
+	Labels            map[string]string                         `json:"labels,omitempty"`
+	KeyAttestation    *provisioner.ACMEAccountKeyAttestation    `json:"-"`
+	ClientCertificate *provisioner.ACMEAccountClientCertificate `json:"-"`
+	// ExternalAccountKeyID is the id of the external account binding key
+	// bound to the account.
+	ExternalAccountKeyID string `json:"-"`
+}
+
+type accountKey struct{}
+
+// NewContextWithAccount creates a new context from ctx and attaches the ACME
+// account.
+func NewContextWithAccount(ctx context.Context, acc *Account) context.Context {
+	return context.WithValue(ctx, accountKey{}, acc)
+}
+
+// AccountFromContext returns the ACME account saved in ctx.
+func AccountFromContext(ctx context.Context) (*Account, bool) {
+	acc, ok := ctx.Value(accountKey{}).(*Account)
+	return acc, ok && acc != nil
 }
 
 // ToLog enables response logging.
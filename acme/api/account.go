@@ -1,20 +1,38 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/logging"
+	"go.step.sm/crypto/jose"
 )
 
+// ExternalAccountBinding is the JWS in flattened JSON serialization that
+// binds a new account to an external account key, as defined in RFC 8555,
+// section 7.3.4.
+type ExternalAccountBinding struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Sig       string `json:"signature"`
+}
+
 // NewAccountRequest represents the payload for a new account request.
 type NewAccountRequest struct {
-	Contact              []string `json:"contact"`
-	OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
-	TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+	Contact                []string                `json:"contact"`
+	OnlyReturnExisting     bool                    `json:"onlyReturnExisting"`
+	TermsOfServiceAgreed   bool                    `json:"termsOfServiceAgreed"`
+	ExternalAccountBinding *ExternalAccountBinding `json:"externalAccountBinding,omitempty"`
+	Attestation            *keyattest.Statement    `json:"attestation,omitempty"`
+	Labels                 map[string]string       `json:"labels,omitempty"`
 }
 
 func validateContacts(cs []string) error {
@@ -74,7 +92,7 @@ func (h *Handler) NewAccount(w http.ResponseWriter, r *http.Request) {
 	}
 	var nar NewAccountRequest
 	if err := json.Unmarshal(payload.value, &nar); err != nil {
-		api.WriteError(w, acme.WrapError(acme.ErrorMalformedType, err,
+		api.WriteError(w, wrapPayloadError(err,
 			"failed to unmarshal new-account request payload"))
 		return
 	}
@@ -99,21 +117,93 @@ func (h *Handler) NewAccount(w http.ResponseWriter, r *http.Request) {
 				"account does not exist"))
 			return
 		}
+		if meta := directoryMetaFromContext(ctx); meta != nil {
+			if meta.ExternalAccountRequired && nar.ExternalAccountBinding == nil {
+				api.WriteError(w, acme.NewError(acme.ErrorExternalAccountRequiredType,
+					"external account binding is required"))
+				return
+			}
+			if meta.TermsOfService != "" && !nar.TermsOfServiceAgreed {
+				w.Header().Add("Link", link(meta.TermsOfService, "terms-of-service"))
+				api.WriteError(w, acme.NewError(acme.ErrorUserActionRequiredType,
+					"terms of service must be agreed"))
+				return
+			}
+		}
+
 		jwk, err := jwkFromContext(ctx)
 		if err != nil {
 			api.WriteError(w, err)
 			return
 		}
 
+		eak, err := h.validateExternalAccountBinding(ctx, jwk, nar.ExternalAccountBinding)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		keyAttestation, err := h.verifyAccountKeyAttestation(ctx, jwk, nar.Attestation)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		if err := h.validateAccountLabels(nar.Labels); err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		prov, err := provisionerFromContext(ctx)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		var eakID string
+		if eak != nil {
+			eakID = eak.ID
+		}
+
+		// Let the account webhook veto the creation of the account.
+		if h.accountWebhook != nil {
+			req, err := newAccountWebhookRequest(prov, &acme.Account{
+				Key:                  jwk,
+				Contact:              nar.Contact,
+				Labels:               nar.Labels,
+				ExternalAccountKeyID: eakID,
+			}, h.clock.Now())
+			if err != nil {
+				api.WriteError(w, err)
+				return
+			}
+			if err := h.accountWebhook.AuthorizeCreate(ctx, req); err != nil {
+				api.WriteError(w, err)
+				return
+			}
+		}
+
 		acc = &acme.Account{
-			Key:     jwk,
-			Contact: nar.Contact,
-			Status:  acme.StatusValid,
+			ProvisionerID:  prov.GetID(),
+			Key:            jwk,
+			Contact:        nar.Contact,
+			Status:         acme.StatusValid,
+			KeyAttestation: keyAttestation,
+			Labels:         nar.Labels,
+			// Bind the account to the client certificate if required.
+			ClientCertificate:    clientCertificateFromContext(ctx),
+			ExternalAccountKeyID: eakID,
 		}
 		if err := h.db.CreateAccount(ctx, acc); err != nil {
 			api.WriteError(w, acme.WrapErrorISE(err, "error creating account"))
 			return
 		}
+		if eak != nil {
+			if err := h.bindExternalAccountKey(ctx, w, eak, acc); err != nil {
+				api.WriteError(w, err)
+				return
+			}
+		}
 	} else {
 		// Account exists //
 		httpStatus = http.StatusOK
@@ -125,6 +215,215 @@ func (h *Handler) NewAccount(w http.ResponseWriter, r *http.Request) {
 	api.JSONStatus(w, acc, httpStatus)
 }
 
+// eabRebindingProvisioner is the interface implemented by the ACME
+// provisioners that can bind an external account key to a new account when it
+// is already bound to another one.
+type eabRebindingProvisioner interface {
+	IsEABRebindingAllowed() bool
+}
+
+// validateExternalAccountBinding validates the external account binding of a
+// new account, as defined in RFC 8555, section 7.3.4, and returns the
+// external account key it references. It returns nil if the request does not
+// include a binding.
+func (h *Handler) validateExternalAccountBinding(ctx context.Context, jwk *jose.JSONWebKey, eab *ExternalAccountBinding) (*acme.ExternalAccountKey, error) {
+	if eab == nil {
+		return nil, nil
+	}
+	eakDB, ok := h.db.(acme.ExternalAccountKeyDB)
+	if !ok {
+		return nil, acme.NewError(acme.ErrorMalformedType, "external account bindings are not supported")
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outer, err := jwsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(eab)
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error marshaling externalAccountBinding")
+	}
+	eabJWS, err := jose.ParseJWS(string(b))
+	if err != nil {
+		return nil, acme.WrapError(acme.ErrorMalformedType, err, "error parsing externalAccountBinding")
+	}
+	if len(eabJWS.Signatures) != 1 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "externalAccountBinding must have exactly one signature")
+	}
+	hdr := eabJWS.Signatures[0].Protected
+	switch hdr.Algorithm {
+	case jose.HS256, jose.HS384, jose.HS512:
+	default:
+		return nil, acme.NewError(acme.ErrorBadSignatureAlgorithmType,
+			"externalAccountBinding must use a MAC algorithm, not %s", hdr.Algorithm)
+	}
+	if hdr.KeyID == "" {
+		return nil, acme.NewError(acme.ErrorMalformedType, "externalAccountBinding is missing the kid header")
+	}
+	if hdr.Nonce != "" {
+		return nil, acme.NewError(acme.ErrorMalformedType, "externalAccountBinding must not include a nonce")
+	}
+	eabURL, _ := hdr.ExtraHeaders["url"].(string)
+	if jwsURL, _ := outer.Signatures[0].Protected.ExtraHeaders["url"].(string); eabURL != jwsURL {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType,
+			"url header in externalAccountBinding (%s) does not match the url of the request (%s)", eabURL, jwsURL)
+	}
+
+	eak, err := eakDB.GetExternalAccountKey(ctx, prov.GetID(), hdr.KeyID)
+	switch {
+	case errors.Is(err, acme.ErrNotFound):
+		return nil, acme.NewError(acme.ErrorUnauthorizedType, "external account key %s does not exist", hdr.KeyID)
+	case err != nil:
+		return nil, acme.WrapErrorISE(err, "error retrieving external account key")
+	}
+	payload, err := eabJWS.Verify(eak.KeyBytes)
+	if err != nil {
+		return nil, acme.WrapError(acme.ErrorUnauthorizedType, err, "error verifying externalAccountBinding signature")
+	}
+	var boundKey jose.JSONWebKey
+	if err := json.Unmarshal(payload, &boundKey); err != nil {
+		return nil, acme.WrapError(acme.ErrorMalformedType, err, "error parsing the key in externalAccountBinding")
+	}
+	boundID, err := acme.KeyToID(&boundKey)
+	if err != nil {
+		return nil, acme.WrapError(acme.ErrorMalformedType, err, "error parsing the key in externalAccountBinding")
+	}
+	if kid, err := acme.KeyToID(jwk); err != nil || kid != boundID {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType, "the key in externalAccountBinding does not match the account key")
+	}
+
+	if eak.AlreadyBound() {
+		if p, ok := prov.(eabRebindingProvisioner); !ok || !p.IsEABRebindingAllowed() {
+			return nil, acme.NewError(acme.ErrorUnauthorizedType,
+				"external account key %s is already bound to account %s", eak.ID, eak.AccountID)
+		}
+	}
+	return eak, nil
+}
+
+// bindExternalAccountKey binds the external account key to a new account. If
+// the key was bound to another account, the old account is deactivated and the
+// new one inherits its valid authorizations. The new account is deactivated if
+// the key cannot be bound to it.
+func (h *Handler) bindExternalAccountKey(ctx context.Context, w http.ResponseWriter, eak *acme.ExternalAccountKey, acc *acme.Account) error {
+	eakDB := h.db.(acme.ExternalAccountKeyDB)
+	if _, err := eakDB.BindExternalAccountKey(ctx, eak.ProvisionerID, eak.ID, eak.AccountID, acc.ID); err != nil {
+		acc.Status = acme.StatusDeactivated
+		if uerr := h.db.UpdateAccount(ctx, acc); uerr != nil {
+			return acme.WrapErrorISE(uerr, "error deactivating account")
+		}
+		var acmeErr *acme.Error
+		if errors.As(err, &acmeErr) {
+			return acmeErr
+		}
+		return acme.WrapErrorISE(err, "error binding external account key")
+	}
+	if !eak.AlreadyBound() {
+		return nil
+	}
+
+	// The account was recovered. The binding has already moved to the new
+	// account, so the failures deactivating the old account or transferring
+	// its state are only logged.
+	fields := map[string]interface{}{
+		"recoveredAccount": eak.AccountID,
+	}
+	if err := h.recoverAccount(ctx, w, eak.AccountID, acc); err != nil {
+		fields["accountRecoveryError"] = err.Error()
+	}
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(fields)
+	}
+	return nil
+}
+
+// recoverAccount deactivates the account with the given id and transfers its
+// valid authorizations to the account that replaces it.
+func (h *Handler) recoverAccount(ctx context.Context, w http.ResponseWriter, oldID string, acc *acme.Account) error {
+	old, err := h.db.GetAccount(ctx, oldID)
+	if err != nil {
+		return acme.WrapErrorISE(err, "error retrieving account %s", oldID)
+	}
+	if old.Status != acme.StatusDeactivated {
+		old.Status = acme.StatusDeactivated
+		if err := h.db.UpdateAccount(ctx, old); err != nil {
+			return acme.WrapErrorISE(err, "error deactivating account %s", oldID)
+		}
+		h.notifyAccountDeactivated(ctx, w, old)
+	}
+	if rdb, ok := h.db.(acme.AccountRecoveryDB); ok {
+		if err := rdb.TransferValidations(ctx, old.ID, acc.ID); err != nil {
+			return acme.WrapErrorISE(err, "error transferring the validations of account %s", oldID)
+		}
+	}
+	return nil
+}
+
+// accountKeyAttestationProvisioner is the interface implemented by the ACME
+// provisioners that can require the attestation of the account keys.
+type accountKeyAttestationProvisioner interface {
+	IsAccountKeyAttestationRequired() bool
+	IsAccountKeyAttestationFormatAllowed(format string) bool
+}
+
+// verifyAccountKeyAttestation verifies the attestation of the key of a new
+// account and returns its metadata. It returns nil if no attestation was
+// presented and the provisioner does not require one.
+func (h *Handler) verifyAccountKeyAttestation(ctx context.Context, jwk *jose.JSONWebKey, stmt *keyattest.Statement) (*provisioner.ACMEAccountKeyAttestation, error) {
+	var required bool
+	p, ok := ctx.Value(provisionerContextKey).(accountKeyAttestationProvisioner)
+	if ok {
+		required = p.IsAccountKeyAttestationRequired()
+	}
+
+	switch {
+	case stmt == nil && required:
+		return nil, acme.NewError(acme.ErrorBadPublicKeyType, "account key attestation is required")
+	case stmt == nil:
+		return nil, nil
+	case ok && !p.IsAccountKeyAttestationFormatAllowed(stmt.Format):
+		return nil, acme.NewError(acme.ErrorBadPublicKeyType, "account key attestation format %q is not allowed", stmt.Format)
+	}
+
+	verifier, ok := h.ca.(acme.KeyAttestationVerifier)
+	if !ok {
+		if required {
+			return nil, acme.NewErrorISE("certificate authority cannot verify account key attestations")
+		}
+		// The attestation is optional, ignore it.
+		return nil, nil
+	}
+	res, err := verifier.VerifyKeyAttestation(stmt, jwk.Key)
+	if err != nil {
+		return nil, acme.WrapError(acme.ErrorBadPublicKeyType, err, "error verifying account key attestation")
+	}
+	return &provisioner.ACMEAccountKeyAttestation{
+		Format:       res.Format,
+		SerialNumber: res.SerialNumber,
+		VerifiedAt:   h.clock.Now(),
+	}, nil
+}
+
+// validateAccountLabels validates the labels attached to the certificates of
+// a new account.
+func (h *Handler) validateAccountLabels(labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	v, ok := h.ca.(acme.LabelsValidator)
+	if !ok {
+		return acme.NewError(acme.ErrorMalformedType, "certificate labels are not supported")
+	}
+	if err := v.ValidateCertificateLabels(labels); err != nil {
+		return acme.WrapError(acme.ErrorMalformedType, err, "invalid account labels")
+	}
+	return nil
+}
+
 // GetOrUpdateAccount is the api for updating an ACME account.
 func (h *Handler) GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -144,7 +443,7 @@ func (h *Handler) GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	if !payload.isPostAsGet {
 		var uar UpdateAccountRequest
 		if err := json.Unmarshal(payload.value, &uar); err != nil {
-			api.WriteError(w, acme.WrapError(acme.ErrorMalformedType, err,
+			api.WriteError(w, wrapPayloadError(err,
 				"failed to unmarshal new-account request payload"))
 			return
 		}
@@ -163,6 +462,9 @@ func (h *Handler) GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 				api.WriteError(w, acme.WrapErrorISE(err, "error updating account"))
 				return
 			}
+			if uar.Status == acme.StatusDeactivated {
+				h.notifyAccountDeactivated(ctx, w, acc)
+			}
 		}
 	}
 
@@ -172,6 +474,47 @@ func (h *Handler) GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	api.JSON(w, acc)
 }
 
+// newAccountWebhookRequest returns the request sent to the account webhook
+// with the given account.
+func newAccountWebhookRequest(prov acme.Provisioner, acc *acme.Account, now time.Time) (*acme.AccountWebhookRequest, error) {
+	kid, err := acme.KeyToID(acc.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &acme.AccountWebhookRequest{
+		Time:                 now,
+		AccountID:            acc.ID,
+		KeyThumbprint:        kid,
+		ProvisionerID:        prov.GetID(),
+		Provisioner:          prov.GetName(),
+		Contact:              acc.Contact,
+		Labels:               acc.Labels,
+		ExternalAccountKeyID: acc.ExternalAccountKeyID,
+	}, nil
+}
+
+// notifyAccountDeactivated sends the deactivation of an account to the account
+// webhook. The account is already deactivated, so the errors are only logged.
+func (h *Handler) notifyAccountDeactivated(ctx context.Context, w http.ResponseWriter, acc *acme.Account) {
+	if h.accountWebhook == nil {
+		return
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err == nil {
+		var req *acme.AccountWebhookRequest
+		if req, err = newAccountWebhookRequest(prov, acc, h.clock.Now()); err == nil {
+			err = h.accountWebhook.NotifyDeactivate(ctx, req)
+		}
+	}
+	if err != nil {
+		if rl, ok := w.(logging.ResponseLogger); ok {
+			rl.WithFields(map[string]interface{}{
+				"accountWebhookError": err.Error(),
+			})
+		}
+	}
+}
+
 func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		m := map[string]interface{}{
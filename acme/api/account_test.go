@@ -3,18 +3,25 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/acme/db/nosql"
+	"github.com/smallstep/certificates/authority/keyattest"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
 )
 
@@ -28,6 +35,38 @@ var (
 	}
 )
 
+type mockCA struct {
+	MockVerifyKeyAttestation      func(stmt *keyattest.Statement, pub crypto.PublicKey) (*keyattest.Result, error)
+	MockValidateCertificateLabels func(labels map[string]string) error
+	MockIsRevoked                 func(sn string) (bool, error)
+}
+
+func (m *mockCA) Sign(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return nil, nil
+}
+
+func (m *mockCA) LoadProvisionerByName(string) (provisioner.Interface, error) {
+	return nil, nil
+}
+
+func (m *mockCA) VerifyKeyAttestation(stmt *keyattest.Statement, pub crypto.PublicKey) (*keyattest.Result, error) {
+	return m.MockVerifyKeyAttestation(stmt, pub)
+}
+
+func (m *mockCA) ValidateCertificateLabels(labels map[string]string) error {
+	if m.MockValidateCertificateLabels != nil {
+		return m.MockValidateCertificateLabels(labels)
+	}
+	return nil
+}
+
+func (m *mockCA) IsRevoked(sn string) (bool, error) {
+	if m.MockIsRevoked != nil {
+		return m.MockIsRevoked(sn)
+	}
+	return false, nil
+}
+
 func newProv() acme.Provisioner {
 	// Initialize provisioners
 	p := &provisioner.ACME{
@@ -291,8 +330,24 @@ func TestHandler_NewAccount(t *testing.T) {
 	escProvName := url.PathEscape(prov.GetName())
 	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 
+	attProv := &provisioner.ACME{
+		Type:                         "ACME",
+		Name:                         "test@acme-<test>provisioner.com",
+		RequireAccountKeyAttestation: true,
+		AccountKeyAttestationFormats: []string{keyattest.FormatYubiKey},
+	}
+	assert.FatalError(t, attProv.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	newMetaProv := func(meta *provisioner.ACMEDirectoryMeta) acme.Provisioner {
+		p := &provisioner.ACME{Type: "ACME", Name: "test@acme-<test>provisioner.com", Meta: meta}
+		assert.FatalError(t, p.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+
 	type test struct {
 		db         acme.DB
+		ca         acme.CertificateAuthority
+		webhook    *acme.AccountWebhook
 		acc        *acme.Account
 		ctx        context.Context
 		statusCode int
@@ -349,6 +404,39 @@ func TestHandler_NewAccount(t *testing.T) {
 				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
 			}
 		},
+		"fail/terms-of-service-not-agreed": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"foo", "bar"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, provisionerContextKey, newMetaProv(&provisioner.ACMEDirectoryMeta{
+				TermsOfService: "https://ca.example.com/terms",
+			}))
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorUserActionRequiredType, "terms of service must be agreed"),
+			}
+		},
+		"fail/external-account-required": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact:              []string{"foo", "bar"},
+				TermsOfServiceAgreed: true,
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, provisionerContextKey, newMetaProv(&provisioner.ACMEDirectoryMeta{
+				ExternalAccountRequired: true,
+			}))
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorExternalAccountRequiredType, "external account binding is required"),
+			}
+		},
 		"fail/no-jwk": func(t *testing.T) test {
 			nar := &NewAccountRequest{
 				Contact: []string{"foo", "bar"},
@@ -386,6 +474,7 @@ func TestHandler_NewAccount(t *testing.T) {
 			assert.FatalError(t, err)
 			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
 			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = context.WithValue(ctx, provisionerContextKey, prov)
 			return test{
 				db: &acme.MockDB{
 					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
@@ -417,6 +506,143 @@ func TestHandler_NewAccount(t *testing.T) {
 						acc.ID = "accountID"
 						assert.Equals(t, acc.Contact, nar.Contact)
 						assert.Equals(t, acc.Key, jwk)
+						assert.Equals(t, acc.ProvisionerID, prov.GetID())
+						return nil
+					},
+				},
+				acc: &acme.Account{
+					ID:        "accountID",
+					Key:       jwk,
+					Status:    acme.StatusValid,
+					Contact:   []string{"foo", "bar"},
+					OrdersURL: fmt.Sprintf("%s/acme/%s/account/accountID/orders", baseURL.String(), escProvName),
+				},
+				ctx:        ctx,
+				statusCode: 201,
+			}
+		},
+		"fail/account-webhook-veto": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"foo", "bar"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			kid, err := acme.KeyToID(jwk)
+			assert.FatalError(t, err)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req acme.AccountWebhookRequest
+				assert.FatalError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equals(t, acme.AccountWebhookCreate, req.Event)
+				assert.Equals(t, kid, req.KeyThumbprint)
+				assert.Equals(t, prov.GetID(), req.ProvisionerID)
+				assert.Equals(t, nar.Contact, req.Contact)
+				w.Write([]byte(`{"allow":false,"reason":"unknown tenant"}`))
+			}))
+			t.Cleanup(srv.Close)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = context.WithValue(ctx, provisionerContextKey, prov)
+			return test{
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						t.Error("account should not be created")
+						return nil
+					},
+				},
+				webhook:    &acme.AccountWebhook{URL: srv.URL},
+				ctx:        ctx,
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "account creation rejected: unknown tenant"),
+			}
+		},
+		"fail/account-key-attestation-required": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"foo", "bar"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = context.WithValue(ctx, provisionerContextKey, attProv)
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorBadPublicKeyType, "account key attestation is required"),
+			}
+		},
+		"fail/account-key-attestation-format": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact:     []string{"foo", "bar"},
+				Attestation: &keyattest.Statement{Format: keyattest.FormatTPM},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = context.WithValue(ctx, provisionerContextKey, attProv)
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorBadPublicKeyType, "account key attestation format \"tpm\" is not allowed"),
+			}
+		},
+		"fail/account-key-attestation-verify": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact:     []string{"foo", "bar"},
+				Attestation: &keyattest.Statement{Format: keyattest.FormatYubiKey},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = context.WithValue(ctx, provisionerContextKey, attProv)
+			return test{
+				ca: &mockCA{
+					MockVerifyKeyAttestation: func(stmt *keyattest.Statement, pub crypto.PublicKey) (*keyattest.Result, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorBadPublicKeyType, "error verifying account key attestation: force"),
+			}
+		},
+		"ok/new-account-key-attestation": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact:     []string{"foo", "bar"},
+				Attestation: &keyattest.Statement{Format: keyattest.FormatYubiKey},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = context.WithValue(ctx, baseURLContextKey, baseURL)
+			ctx = context.WithValue(ctx, provisionerContextKey, attProv)
+			return test{
+				ca: &mockCA{
+					MockVerifyKeyAttestation: func(stmt *keyattest.Statement, pub crypto.PublicKey) (*keyattest.Result, error) {
+						assert.Equals(t, stmt.Format, keyattest.FormatYubiKey)
+						assert.Equals(t, pub, jwk.Key)
+						return &keyattest.Result{Format: keyattest.FormatYubiKey, SerialNumber: "12345678"}, nil
+					},
+				},
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						acc.ID = "accountID"
+						if assert.NotNil(t, acc.KeyAttestation) {
+							assert.Equals(t, acc.KeyAttestation.Format, keyattest.FormatYubiKey)
+							assert.Equals(t, acc.KeyAttestation.SerialNumber, "12345678")
+						}
 						return nil
 					},
 				},
@@ -459,7 +685,7 @@ func TestHandler_NewAccount(t *testing.T) {
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
-			h := &Handler{db: tc.db, linker: NewLinker("dns", "acme")}
+			h := &Handler{db: tc.db, ca: tc.ca, accountWebhook: tc.webhook, linker: NewLinker("dns", "acme")}
 			req := httptest.NewRequest("GET", "/foo/bar", nil)
 			req = req.WithContext(tc.ctx)
 			w := httptest.NewRecorder()
@@ -693,3 +919,197 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_validateAccountLabels(t *testing.T) {
+	labels := map[string]string{"team": "platform"}
+	ca := &mockCA{
+		MockValidateCertificateLabels: func(l map[string]string) error {
+			if l["team"] != "platform" {
+				return errors.New("label key \"owner\" is not allowed")
+			}
+			return nil
+		},
+	}
+	tests := []struct {
+		name    string
+		ca      acme.CertificateAuthority
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"ok", ca, labels, false},
+		{"ok no labels", ca, nil, false},
+		{"ok no labels not supported", struct{ acme.CertificateAuthority }{ca}, nil, false},
+		{"fail", ca, map[string]string{"owner": "alice"}, true},
+		{"fail not supported", struct{ acme.CertificateAuthority }{ca}, labels, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{ca: tt.ca}
+			err := h.validateAccountLabels(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Handler.validateAccountLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var ae *acme.Error
+				if assert.True(t, errors.As(err, &ae)) {
+					assert.Equals(t, acme.NewError(acme.ErrorMalformedType, "").Type, ae.Type)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_NewAccount_externalAccountBinding(t *testing.T) {
+	ctx := context.Background()
+	d, err := nosql.New(db.NewMemoryDB())
+	assert.FatalError(t, err)
+	prov := newProv().(*provisioner.ACME)
+	prov.Meta = &provisioner.ACMEDirectoryMeta{ExternalAccountRequired: true}
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	newAccountURL := "https://test.ca.smallstep.com/acme/new-account"
+	h := &Handler{db: d, linker: NewLinker("dns", "acme")}
+
+	eak, err := d.CreateExternalAccountKey(ctx, prov.GetID(), "tenant-1")
+	assert.FatalError(t, err)
+	other, err := d.CreateExternalAccountKey(ctx, "otherID", "")
+	assert.FatalError(t, err)
+
+	newJWK := func() *jose.JSONWebKey {
+		jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+		assert.FatalError(t, err)
+		return jwk
+	}
+	newEAB := func(keyID string, key []byte, jwk *jose.JSONWebKey, url string) *ExternalAccountBinding {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: key},
+			new(jose.SignerOptions).WithHeader("kid", keyID).WithHeader("url", url))
+		assert.FatalError(t, err)
+		pub, err := json.Marshal(jwk.Public())
+		assert.FatalError(t, err)
+		jws, err := signer.Sign(pub)
+		assert.FatalError(t, err)
+		eab := new(ExternalAccountBinding)
+		assert.FatalError(t, json.Unmarshal([]byte(jws.FullSerialize()), eab))
+		return eab
+	}
+	newAccount := func(jwk *jose.JSONWebKey, eab *ExternalAccountBinding) *httptest.ResponseRecorder {
+		b, err := json.Marshal(&NewAccountRequest{ExternalAccountBinding: eab})
+		assert.FatalError(t, err)
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(jwk.Algorithm), Key: jwk.Key},
+			new(jose.SignerOptions).WithHeader("url", newAccountURL))
+		assert.FatalError(t, err)
+		signed, err := signer.Sign(b)
+		assert.FatalError(t, err)
+		jws, err := jose.ParseJWS(signed.FullSerialize())
+		assert.FatalError(t, err)
+		rctx := context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+		rctx = context.WithValue(rctx, jwsContextKey, jws)
+		rctx = context.WithValue(rctx, jwkContextKey, jwk)
+		rctx = context.WithValue(rctx, baseURLContextKey, baseURL)
+		rctx = context.WithValue(rctx, provisionerContextKey, prov)
+		req := httptest.NewRequest("POST", newAccountURL, nil)
+		w := httptest.NewRecorder()
+		h.NewAccount(w, req.WithContext(rctx))
+		return w
+	}
+	assertError := func(t *testing.T, w *httptest.ResponseRecorder, typ acme.ProblemType) {
+		t.Helper()
+		var ae acme.Error
+		assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &ae))
+		assert.Equals(t, acme.NewError(typ, "").Type, ae.Type)
+	}
+
+	jwk1 := newJWK()
+	otherJWK := newJWK()
+	tests := []struct {
+		name string
+		eab  *ExternalAccountBinding
+		code int
+		typ  acme.ProblemType
+	}{
+		{"fail required", nil, 400, acme.ErrorExternalAccountRequiredType},
+		{"fail unknown key", newEAB("foo", eak.KeyBytes, jwk1, newAccountURL), 401, acme.ErrorUnauthorizedType},
+		{"fail other provisioner", newEAB(other.ID, other.KeyBytes, jwk1, newAccountURL), 401, acme.ErrorUnauthorizedType},
+		{"fail signature", newEAB(eak.ID, other.KeyBytes, jwk1, newAccountURL), 401, acme.ErrorUnauthorizedType},
+		{"fail url", newEAB(eak.ID, eak.KeyBytes, jwk1, "https://test.ca.smallstep.com/acme/new-order"), 401, acme.ErrorUnauthorizedType},
+		{"fail account key", newEAB(eak.ID, eak.KeyBytes, otherJWK, newAccountURL), 401, acme.ErrorUnauthorizedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newAccount(jwk1, tt.eab)
+			assert.Equals(t, tt.code, w.Code)
+			assertError(t, w, tt.typ)
+		})
+	}
+
+	// The first account is bound to the key.
+	w := newAccount(jwk1, newEAB(eak.ID, eak.KeyBytes, jwk1, newAccountURL))
+	assert.Equals(t, 201, w.Code)
+	kid, err := acme.KeyToID(jwk1)
+	assert.FatalError(t, err)
+	acc1, err := d.GetAccountByKeyID(ctx, prov.GetID(), kid)
+	assert.FatalError(t, err)
+	assert.Equals(t, eak.ID, acc1.ExternalAccountKeyID)
+	got, err := d.GetExternalAccountKey(ctx, prov.GetID(), eak.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, acc1.ID, got.AccountID)
+
+	// The account has a valid authorization.
+	ch := &acme.Challenge{AccountID: acc1.ID, Type: acme.DNS01, Status: acme.StatusValid, Value: "example.com", Token: "token"}
+	assert.FatalError(t, d.CreateChallenge(ctx, ch))
+	az := &acme.Authorization{
+		AccountID:     acc1.ID,
+		ProvisionerID: prov.GetID(),
+		Identifier:    acme.Identifier{Type: acme.DNS, Value: "example.com"},
+		Status:        acme.StatusValid,
+		Token:         "token",
+		Challenges:    []*acme.Challenge{ch},
+		ExpiresAt:     clock.Now().Add(time.Hour),
+	}
+	assert.FatalError(t, d.CreateAuthorization(ctx, az))
+	assert.FatalError(t, d.StoreValidation(ctx, &acme.CachedValidation{
+		AccountID:       acc1.ID,
+		Identifier:      az.Identifier,
+		ChallengeType:   acme.DNS01,
+		AuthorizationID: az.ID,
+		ValidatedAt:     clock.Now(),
+		ExpiresAt:       clock.Now().Add(time.Hour),
+	}))
+
+	// The key cannot be bound to another account.
+	jwk2 := newJWK()
+	w = newAccount(jwk2, newEAB(eak.ID, eak.KeyBytes, jwk2, newAccountURL))
+	assert.Equals(t, 401, w.Code)
+	assertError(t, w, acme.ErrorUnauthorizedType)
+
+	// Unless the provisioner allows the recovery of the accounts.
+	prov.AllowEABRebinding = true
+	w = newAccount(jwk2, newEAB(eak.ID, eak.KeyBytes, jwk2, newAccountURL))
+	assert.Equals(t, 201, w.Code)
+	kid, err = acme.KeyToID(jwk2)
+	assert.FatalError(t, err)
+	acc2, err := d.GetAccountByKeyID(ctx, prov.GetID(), kid)
+	assert.FatalError(t, err)
+	assert.Equals(t, acme.StatusValid, acc2.Status)
+	assert.Equals(t, eak.ID, acc2.ExternalAccountKeyID)
+	got, err = d.GetExternalAccountKey(ctx, prov.GetID(), eak.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, acc2.ID, got.AccountID)
+
+	acc1, err = d.GetAccount(ctx, acc1.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, acme.StatusDeactivated, acc1.Status)
+
+	// The new account inherits the authorizations of the old one.
+	v, err := d.GetValidation(ctx, acc2.ID, az.Identifier, acme.DNS01)
+	assert.FatalError(t, err)
+	assert.Equals(t, az.ID, v.AuthorizationID)
+	_, err = d.GetValidation(ctx, acc1.ID, az.Identifier, acme.DNS01)
+	assert.Equals(t, acme.ErrNotFound, err)
+	az, err = d.GetAuthorization(ctx, az.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, acc2.ID, az.AccountID)
+	assert.Equals(t, acc2.ID, az.Challenges[0].AccountID)
+	reused, err := (&Handler{db: d, validationReuse: time.Hour}).reusableAuthorization(ctx, acc2.ID, prov.GetID(), az.Identifier)
+	assert.FatalError(t, err)
+	assert.NotNil(t, reused)
+}
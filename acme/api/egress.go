@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/resolver"
+)
+
+// validationTimeout is the timeout used in the connections and requests made
+// to validate a challenge.
+const validationTimeout = 30 * time.Second
+
+// ValidationEgress configures the network used to validate the challenges of
+// the identifiers matching one of the domain suffixes.
+type ValidationEgress struct {
+	// Domains is the list of domain suffixes.
+	Domains []string
+	// SourceIP is the local address used in the connections and DNS queries.
+	SourceIP net.IP
+	// Proxy is the HTTP proxy used in http-01 validations.
+	Proxy *url.URL
+	// Resolver is the host:port of the DNS server used in dns-01 validations.
+	Resolver string
+}
+
+// egressValidator contains the validator functions for a ValidationEgress.
+type egressValidator struct {
+	suffix string
+	vo     *acme.ValidateChallengeOptions
+}
+
+// newValidateChallengeOptions returns the validator functions used in the
+// challenges. The functions select the egress using the identifier in the
+// url, address or TXT record name, and resolve the names with the given
+// resolver, or the system one if it is nil.
+func newValidateChallengeOptions(egress []*ValidationEgress, res *resolver.Resolver) *acme.ValidateChallengeOptions {
+	def := newEgressOptions(&ValidationEgress{}, res)
+	if len(egress) == 0 {
+		return def
+	}
+
+	var validators []egressValidator
+	for _, e := range egress {
+		vo := newEgressOptions(e, res)
+		for _, d := range e.Domains {
+			validators = append(validators, egressValidator{
+				suffix: strings.ToLower(strings.Trim(d, ".")),
+				vo:     vo,
+			})
+		}
+	}
+
+	// selectOptions returns the options of the longest suffix matching the
+	// host.
+	selectOptions := func(host string) *acme.ValidateChallengeOptions {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		vo, n := def, 0
+		for _, v := range validators {
+			if len(v.suffix) > n && (host == v.suffix || strings.HasSuffix(host, "."+v.suffix)) {
+				vo, n = v.vo, len(v.suffix)
+			}
+		}
+		return vo
+	}
+
+	return &acme.ValidateChallengeOptions{
+		HTTPGet: func(ctx context.Context, rawurl string) (*http.Response, error) {
+			var host string
+			if u, err := url.Parse(rawurl); err == nil {
+				host = u.Hostname()
+			}
+			return selectOptions(host).HTTPGet(ctx, rawurl)
+		},
+		LookupTxt: func(ctx context.Context, name string) ([]string, error) {
+			return selectOptions(strings.TrimPrefix(name, "_acme-challenge.")).LookupTxt(ctx, name)
+		},
+		TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			return selectOptions(host).TLSDial(ctx, network, addr, config)
+		},
+	}
+}
+
+// newEgressOptions returns the validator functions that use the network
+// configured in the given egress. The hosts are resolved with the given
+// resolver, and the TXT records with the DNS server of the egress if it is
+// configured.
+func newEgressOptions(e *ValidationEgress, res *resolver.Resolver) *acme.ValidateChallengeOptions {
+	dialer := &net.Dialer{
+		Timeout: validationTimeout,
+	}
+	if e.SourceIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: e.SourceIP}
+	}
+
+	dialContext := res.DialContext(dialer)
+	transport := &http.Transport{
+		DialContext: dialContext,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}
+	if e.Proxy != nil {
+		transport.Proxy = http.ProxyURL(e.Proxy)
+	}
+	client := &http.Client{
+		Timeout:   validationTimeout,
+		Transport: transport,
+	}
+
+	txtResolver := res
+	if e.SourceIP != nil || e.Resolver != "" {
+		upstream := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := &net.Dialer{Timeout: validationTimeout}
+				if e.SourceIP != nil {
+					if strings.HasPrefix(network, "udp") {
+						d.LocalAddr = &net.UDPAddr{IP: e.SourceIP}
+					} else {
+						d.LocalAddr = &net.TCPAddr{IP: e.SourceIP}
+					}
+				}
+				if e.Resolver != "" {
+					address = e.Resolver
+				}
+				return d.DialContext(ctx, network, address)
+			},
+		}
+		txtResolver = res.WithUpstream(upstream)
+	}
+
+	return &acme.ValidateChallengeOptions{
+		HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			if err != nil {
+				return nil, err
+			}
+			return client.Do(req)
+		},
+		LookupTxt: func(ctx context.Context, name string) ([]string, error) {
+			return txtResolver.LookupTXT(ctx, name)
+		},
+		TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
+			return dialTLS(ctx, dialContext, network, addr, config)
+		},
+	}
+}
+
+// dialTLS dials the address with the given dial function and runs the TLS
+// handshake, like tls.DialWithDialer, with the timeout of the validations. The
+// connection is aborted if the given context is canceled.
+func dialTLS(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), network, addr string, config *tls.Config) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+
+	rawConn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		} else {
+			config.ServerName = addr
+		}
+	}
+
+	conn := tls.Client(rawConn, config)
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Abort the handshake if the context is canceled.
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	err = conn.Handshake()
+	close(stop)
+	<-stopped
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
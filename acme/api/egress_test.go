@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/resolver"
+)
+
+func Test_newValidateChallengeOptions(t *testing.T) {
+	var requested []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.String())
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.FatalError(t, err)
+
+	vo := newValidateChallengeOptions([]*ValidationEgress{
+		{Domains: []string{"dmz.example.com"}, Proxy: proxyURL},
+		{Domains: []string{"internal.dmz.example.com"}, Proxy: &url.URL{Scheme: "http", Host: "127.0.0.1:1"}},
+	}, nil)
+
+	for _, u := range []string{
+		"http://dmz.example.com/.well-known/acme-challenge/token",
+		"http://www.DMZ.example.com./.well-known/acme-challenge/token",
+	} {
+		resp, err := vo.HTTPGet(context.Background(), u)
+		assert.FatalError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.FatalError(t, err)
+		assert.Equals(t, "proxied", string(b))
+	}
+	assert.Equals(t, []string{
+		"http://dmz.example.com/.well-known/acme-challenge/token",
+		"http://www.DMZ.example.com./.well-known/acme-challenge/token",
+	}, requested)
+
+	// The longest suffix uses a proxy that is not available.
+	_, err = vo.HTTPGet(context.Background(), "http://www.internal.dmz.example.com/.well-known/acme-challenge/token")
+	assert.NotNil(t, err)
+	assert.Equals(t, 2, len(requested))
+}
+
+func Test_newValidateChallengeOptions_resolver(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	vo := newValidateChallengeOptions(nil, resolver.New(nil, &resolver.Options{}))
+
+	resp, err := vo.HTTPGet(context.Background(), srv.URL)
+	assert.FatalError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, "ok", string(b))
+
+	conn, err := vo.TLSDial(context.Background(), "tcp", srv.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	assert.FatalError(t, err)
+	assert.True(t, conn.ConnectionState().HandshakeComplete)
+	assert.FatalError(t, conn.Close())
+}
@@ -1,35 +1,29 @@
 package api
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
-	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/dnsupdate"
+	"github.com/smallstep/certificates/logging"
+	"github.com/smallstep/certificates/resolver"
 )
 
 func link(url, typ string) string {
 	return fmt.Sprintf("<%s>;rel=\"%s\"", url, typ)
 }
 
-// Clock that returns time in UTC rounded to seconds.
-type Clock struct{}
-
-// Now returns the UTC time rounded to seconds.
-func (c *Clock) Now() time.Time {
-	return time.Now().UTC().Truncate(time.Second)
-}
-
-var clock Clock
-
 type payloadInfo struct {
 	value       []byte
 	isPostAsGet bool
@@ -43,6 +37,12 @@ type Handler struct {
 	ca                       acme.CertificateAuthority
 	linker                   Linker
 	validateChallengeOptions *acme.ValidateChallengeOptions
+	maxJWSPayloadSize        int64
+	alternateChains          [][]*x509.Certificate
+	validations              *acme.ValidationManager
+	accountWebhook           *acme.AccountWebhook
+	validationReuse          time.Duration
+	clock                    provisioner.UTCClock
 }
 
 // HandlerOptions required to create a new ACME API request handler.
@@ -60,34 +60,55 @@ type HandlerOptions struct {
 	// "acme" is the prefix from which the ACME api is accessed.
 	Prefix string
 	CA     acme.CertificateAuthority
+	// Egress selects the network used to validate the challenges of the
+	// identifiers matching a domain suffix.
+	Egress []*ValidationEgress
+	// Resolver is the DNS resolver used in the validations. If it is nil the
+	// system resolver is used.
+	Resolver *resolver.Resolver
+	// MaxJWSPayloadSize is the maximum size in bytes of the payload of the JWS
+	// in a request. Requests with larger payloads get a 413 response. A zero
+	// value does not limit the size.
+	MaxJWSPayloadSize int64
+	// AlternateChains are the chains offered with the "alternate" link
+	// relation. Each chain starts with an alternate version, e.g. a
+	// cross-signed one, of the intermediate issuing the certificates.
+	AlternateChains [][]*x509.Certificate
+	// Validations runs the challenge validations. It must be closed when the
+	// server stops to cancel the running attempts. If it is nil, a manager
+	// with the default timeout and no limit of attempts is used.
+	Validations *acme.ValidationManager
+	// AccountWebhook, if set, is called before an account is created, and it
+	// can veto the creation, and after an account is deactivated.
+	AccountWebhook *acme.AccountWebhook
+	// ValidationReuse is the period a successful validation is cached, its
+	// valid authorization is attached to the new orders of the same account
+	// for the identifier. Validations are not reused if it is 0 or if the DB
+	// does not implement acme.ValidationCache.
+	ValidationReuse time.Duration
+	// Clock is the source of the times of the ACME objects, usually the
+	// clock of the authority. If it is nil the system clock is used.
+	Clock provisioner.Clock
 }
 
 // NewHandler returns a new ACME API handler.
 func NewHandler(ops HandlerOptions) api.RouterHandler {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}
-	client := http.Client{
-		Timeout:   30 * time.Second,
-		Transport: transport,
-	}
-	dialer := &net.Dialer{
-		Timeout: 30 * time.Second,
+	validations := ops.Validations
+	if validations == nil {
+		validations = acme.NewValidationManager(0, 0)
 	}
 	return &Handler{
-		ca:       ops.CA,
-		db:       ops.DB,
-		backdate: ops.Backdate,
-		linker:   NewLinker(ops.DNS, ops.Prefix),
-		validateChallengeOptions: &acme.ValidateChallengeOptions{
-			HTTPGet:   client.Get,
-			LookupTxt: net.LookupTXT,
-			TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
-				return tls.DialWithDialer(dialer, network, addr, config)
-			},
-		},
+		ca:                       ops.CA,
+		db:                       ops.DB,
+		backdate:                 ops.Backdate,
+		linker:                   NewLinker(ops.DNS, ops.Prefix),
+		validateChallengeOptions: newValidateChallengeOptions(ops.Egress, ops.Resolver),
+		maxJWSPayloadSize:        ops.MaxJWSPayloadSize,
+		alternateChains:          ops.AlternateChains,
+		validations:              validations,
+		accountWebhook:           ops.AccountWebhook,
+		validationReuse:          ops.ValidationReuse,
+		clock:                    provisioner.UTCClock{Clock: ops.Clock},
 	}
 }
 
@@ -95,16 +116,16 @@ func NewHandler(ops HandlerOptions) api.RouterHandler {
 func (h *Handler) Route(r api.Router) {
 	getPath := h.linker.GetUnescapedPathSuffix
 	// Standard ACME API
-	r.MethodFunc("GET", getPath(NewNonceLinkType, "{provisionerID}"), h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.GetNonce)))))
-	r.MethodFunc("HEAD", getPath(NewNonceLinkType, "{provisionerID}"), h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.GetNonce)))))
-	r.MethodFunc("GET", getPath(DirectoryLinkType, "{provisionerID}"), h.baseURLFromRequest(h.lookupProvisioner(h.GetDirectory)))
-	r.MethodFunc("HEAD", getPath(DirectoryLinkType, "{provisionerID}"), h.baseURLFromRequest(h.lookupProvisioner(h.GetDirectory)))
+	r.MethodFunc("GET", getPath(NewNonceLinkType, "{provisionerID}"), h.addClock(h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.GetNonce))))))
+	r.MethodFunc("HEAD", getPath(NewNonceLinkType, "{provisionerID}"), h.addClock(h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.GetNonce))))))
+	r.MethodFunc("GET", getPath(DirectoryLinkType, "{provisionerID}"), h.addClock(h.baseURLFromRequest(h.lookupProvisioner(h.GetDirectory))))
+	r.MethodFunc("HEAD", getPath(DirectoryLinkType, "{provisionerID}"), h.addClock(h.baseURLFromRequest(h.lookupProvisioner(h.GetDirectory))))
 
 	extractPayloadByJWK := func(next nextHTTP) nextHTTP {
-		return h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.verifyContentType(h.parseJWS(h.validateJWS(h.extractJWK(h.verifyAndExtractJWSPayload(next)))))))))
+		return h.addClock(h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.verifyContentType(h.parseJWS(h.validateJWS(h.extractJWK(h.verifyClientCertificate(h.verifyAndExtractJWSPayload(next)))))))))))
 	}
 	extractPayloadByKid := func(next nextHTTP) nextHTTP {
-		return h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.verifyContentType(h.parseJWS(h.validateJWS(h.lookupJWK(h.verifyAndExtractJWSPayload(next)))))))))
+		return h.addClock(h.baseURLFromRequest(h.lookupProvisioner(h.addNonce(h.addDirLink(h.verifyContentType(h.parseJWS(h.validateJWS(h.lookupJWK(h.verifyClientCertificate(h.verifyAndExtractJWSPayload(next)))))))))))
 	}
 
 	r.MethodFunc("POST", getPath(NewAccountLinkType, "{provisionerID}"), extractPayloadByJWK(h.NewAccount))
@@ -116,7 +137,9 @@ func (h *Handler) Route(r api.Router) {
 	r.MethodFunc("POST", getPath(FinalizeLinkType, "{provisionerID}", "{ordID}"), extractPayloadByKid(h.FinalizeOrder))
 	r.MethodFunc("POST", getPath(AuthzLinkType, "{provisionerID}", "{authzID}"), extractPayloadByKid(h.isPostAsGet(h.GetAuthorization)))
 	r.MethodFunc("POST", getPath(ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}"), extractPayloadByKid(h.GetChallenge))
+	r.MethodFunc("POST", getPath(ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}")+"/diagnose", extractPayloadByKid(h.DiagnoseChallenge))
 	r.MethodFunc("POST", getPath(CertificateLinkType, "{provisionerID}", "{certID}"), extractPayloadByKid(h.isPostAsGet(h.GetCertificate)))
+	r.MethodFunc("POST", getPath(CertificateLinkType, "{provisionerID}", "{certID}")+"/{chain}", extractPayloadByKid(h.isPostAsGet(h.GetCertificate)))
 }
 
 // GetNonce just sets the right header since a Nonce is added to each response
@@ -131,11 +154,27 @@ func (h *Handler) GetNonce(w http.ResponseWriter, r *http.Request) {
 
 // Directory represents an ACME directory for configuring clients.
 type Directory struct {
-	NewNonce   string `json:"newNonce"`
-	NewAccount string `json:"newAccount"`
-	NewOrder   string `json:"newOrder"`
-	RevokeCert string `json:"revokeCert"`
-	KeyChange  string `json:"keyChange"`
+	NewNonce   string                         `json:"newNonce"`
+	NewAccount string                         `json:"newAccount"`
+	NewOrder   string                         `json:"newOrder"`
+	RevokeCert string                         `json:"revokeCert"`
+	KeyChange  string                         `json:"keyChange"`
+	Meta       *provisioner.ACMEDirectoryMeta `json:"meta,omitempty"`
+}
+
+// directoryMetaProvisioner is the interface implemented by the ACME
+// provisioners that publish metadata in the directory.
+type directoryMetaProvisioner interface {
+	GetDirectoryMeta() *provisioner.ACMEDirectoryMeta
+}
+
+// directoryMetaFromContext returns the directory metadata of the provisioner
+// in the context, or nil if it does not have one.
+func directoryMetaFromContext(ctx context.Context) *provisioner.ACMEDirectoryMeta {
+	if p, ok := ctx.Value(provisionerContextKey).(directoryMetaProvisioner); ok {
+		return p.GetDirectoryMeta()
+	}
+	return nil
 }
 
 // ToLog enables response logging for the Directory type.
@@ -157,6 +196,7 @@ func (h *Handler) GetDirectory(w http.ResponseWriter, r *http.Request) {
 		NewOrder:   h.linker.GetLink(ctx, NewOrderLinkType),
 		RevokeCert: h.linker.GetLink(ctx, RevokeCertLinkType),
 		KeyChange:  h.linker.GetLink(ctx, KeyChangeLinkType),
+		Meta:       directoryMetaFromContext(ctx),
 	})
 }
 
@@ -184,6 +224,11 @@ func (h *Handler) GetAuthorization(w http.ResponseWriter, r *http.Request) {
 			"account '%s' does not own authorization '%s'", acc.ID, az.ID))
 		return
 	}
+	if !isProvisionerResource(ctx, az.ProvisionerID) {
+		api.WriteError(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"provisioner '%s' does not own authorization '%s'", az.ProvisionerID, az.ID))
+		return
+	}
 	if err = az.UpdateStatus(ctx, h.db); err != nil {
 		api.WriteError(w, acme.WrapErrorISE(err, "error updating authorization status"))
 		return
@@ -234,10 +279,26 @@ func (h *Handler) GetChallenge(w http.ResponseWriter, r *http.Request) {
 		api.WriteError(w, err)
 		return
 	}
-	if err = ch.Validate(ctx, h.db, jwk, h.validateChallengeOptions); err != nil {
+	vo := h.validateChallengeOptions
+	if ch.Type == acme.DNS01 {
+		vo = h.dnsAssistOptions(ctx, acc.ID, ch.Value)
+	}
+	// Only the request that validates the challenge caches the validation, the
+	// next requests for a valid challenge must not extend it.
+	wasValid := ch.Status == acme.StatusValid
+	if err = h.validations.Validate(ctx, ch, h.db, jwk, vo); err != nil {
 		api.WriteError(w, acme.WrapErrorISE(err, "error validating challenge"))
 		return
 	}
+	if !wasValid && ch.Status == acme.StatusValid {
+		if err := h.cacheValidation(ctx, azID, ch); err != nil {
+			if rl, ok := w.(logging.ResponseLogger); ok {
+				rl.WithFields(map[string]interface{}{
+					"validationCacheError": err.Error(),
+				})
+			}
+		}
+	}
 
 	h.linker.LinkChallenge(ctx, ch, azID)
 
@@ -246,6 +307,75 @@ func (h *Handler) GetChallenge(w http.ResponseWriter, r *http.Request) {
 	api.JSON(w, ch)
 }
 
+// dnsAssistProvisioner is implemented by the provisioners that create the TXT
+// records of the dns-01 challenges of trusted accounts.
+type dnsAssistProvisioner interface {
+	GetDNSUpdater(accountID, domain string) dnsupdate.Updater
+}
+
+// dnsAssistOptions returns the options used to validate a dns-01 challenge.
+// If the provisioner creates the TXT records of the account, the options
+// include its DNS updater.
+func (h *Handler) dnsAssistOptions(ctx context.Context, accountID, domain string) *acme.ValidateChallengeOptions {
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		return h.validateChallengeOptions
+	}
+	p, ok := prov.(dnsAssistProvisioner)
+	if !ok {
+		return h.validateChallengeOptions
+	}
+	u := p.GetDNSUpdater(accountID, domain)
+	if u == nil {
+		return h.validateChallengeOptions
+	}
+	vo := *h.validateChallengeOptions
+	vo.DNSUpdater = u
+	return &vo
+}
+
+// DiagnoseChallenge is a non-standard ACME api that performs a validation dry
+// run of a challenge. The response contains the evidence gathered from the
+// identifier and the reason the validation failed, the challenge is not
+// modified.
+func (h *Handler) DiagnoseChallenge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	azID := chi.URLParam(r, "authzID")
+	ch, err := h.db.GetChallenge(ctx, chi.URLParam(r, "chID"), azID)
+	if err != nil {
+		api.WriteError(w, acme.WrapErrorISE(err, "error retrieving challenge"))
+		return
+	}
+	if acc.ID != ch.AccountID {
+		api.WriteError(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"account '%s' does not own challenge '%s'", acc.ID, ch.ID))
+		return
+	}
+	jwk, err := jwkFromContext(ctx)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	// The dry run uses the same options and limits of a validation.
+	vo := h.validateChallengeOptions
+	if ch.Type == acme.DNS01 {
+		vo = h.dnsAssistOptions(ctx, acc.ID, ch.Value)
+	}
+	d, err := h.validations.Diagnose(ctx, ch, jwk, vo)
+	if err != nil {
+		api.WriteError(w, acme.WrapErrorISE(err, "error diagnosing challenge"))
+		return
+	}
+
+	w.Header().Add("Link", link(h.linker.GetLink(ctx, ChallengeLinkType, azID, ch.ID), "up"))
+	api.JSON(w, d)
+}
+
 // GetCertificate ACME api for retrieving a Certificate.
 func (h *Handler) GetCertificate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -267,8 +397,39 @@ func (h *Handler) GetCertificate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The default chain is served in the certificate URL, and the alternate
+	// chains in the certificate URL followed by their 1-based index.
+	chains := h.getAlternateChains(cert)
+	index := 0
+	if s := chi.URLParam(r, "chain"); s != "" {
+		index, err = strconv.Atoi(s)
+		if err != nil || index < 1 || index > len(chains) {
+			api.WriteError(w, acme.NewError(acme.ErrorMalformedType,
+				"certificate '%s' does not have the chain '%s'", certID, s))
+			return
+		}
+	}
+	if len(chains) > 0 {
+		certURL := h.linker.GetLink(ctx, CertificateLinkType, certID)
+		for i := 0; i <= len(chains); i++ {
+			switch {
+			case i == index:
+				continue
+			case i == 0:
+				w.Header().Add("Link", link(certURL, "alternate"))
+			default:
+				w.Header().Add("Link", link(certURL+"/"+strconv.Itoa(i), "alternate"))
+			}
+		}
+	}
+
+	intermediates := cert.Intermediates
+	if index > 0 {
+		intermediates = chains[index-1]
+	}
+
 	var certBytes []byte
-	for _, c := range append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...) {
+	for _, c := range append([]*x509.Certificate{cert.Leaf}, intermediates...) {
 		certBytes = append(certBytes, pem.EncodeToMemory(&pem.Block{
 			Type:  "CERTIFICATE",
 			Bytes: c.Raw,
@@ -279,3 +440,34 @@ func (h *Handler) GetCertificate(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/pem-certificate-chain; charset=utf-8")
 	w.Write(certBytes)
 }
+
+// getAlternateChains returns the alternate chains of the given certificate,
+// the ones starting with a different certificate with the same subject and
+// key as its issuer.
+func (h *Handler) getAlternateChains(cert *acme.Certificate) [][]*x509.Certificate {
+	if len(cert.Intermediates) == 0 {
+		return nil
+	}
+	issuer := cert.Intermediates[0]
+	var chains [][]*x509.Certificate
+	for _, chain := range h.alternateChains {
+		if len(chain) > 0 && !bytes.Equal(chain[0].Raw, issuer.Raw) &&
+			bytes.Equal(chain[0].RawSubject, issuer.RawSubject) &&
+			bytes.Equal(chain[0].RawSubjectPublicKeyInfo, issuer.RawSubjectPublicKeyInfo) {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+// wrapPayloadError returns a malformed error for a payload that cannot be
+// unmarshaled. If the error is caused by a field with a value of the wrong
+// type, the detail of the error names the field. Unknown fields are not
+// rejected, clients can send extensions that are not supported.
+func wrapPayloadError(err error, msg string) *acme.Error {
+	ae := acme.WrapError(acme.ErrorMalformedType, err, msg)
+	if je := api.NewJSONError(err); je.Field != "" {
+		ae.Detail = je.Message()
+	}
+	return ae
+}
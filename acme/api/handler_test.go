@@ -18,10 +18,15 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/pemutil"
 )
 
+// clock is the clock of the handlers created in the tests, the zero value of
+// their clock field.
+var clock provisioner.UTCClock
+
 func TestHandler_GetNonce(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -112,6 +117,30 @@ func TestHandler_GetDirectory(t *testing.T) {
 	}
 }
 
+func TestHandler_GetDirectory_meta(t *testing.T) {
+	meta := &provisioner.ACMEDirectoryMeta{
+		TermsOfService:          "https://ca.example.com/terms",
+		Website:                 "https://ca.example.com",
+		CAAIdentities:           []string{"ca.example.com"},
+		ExternalAccountRequired: true,
+	}
+	prov := &provisioner.ACME{Type: "ACME", Name: "meta", Meta: meta}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	ctx := context.WithValue(context.Background(), provisionerContextKey, prov)
+	ctx = context.WithValue(ctx, baseURLContextKey, &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"})
+	h := &Handler{linker: NewLinker("ca.smallstep.com", "acme")}
+	req := httptest.NewRequest("GET", "/foo/bar", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.GetDirectory(w, req)
+	res := w.Result()
+	assert.Equals(t, res.StatusCode, 200)
+
+	var dir Directory
+	assert.FatalError(t, json.NewDecoder(res.Body).Decode(&dir))
+	assert.Equals(t, dir.Meta, meta)
+}
+
 func TestHandler_GetAuthorization(t *testing.T) {
 	expiry := time.Now().UTC().Add(6 * time.Hour)
 	az := acme.Authorization{
@@ -207,6 +236,26 @@ func TestHandler_GetAuthorization(t *testing.T) {
 				err:        acme.NewError(acme.ErrorUnauthorizedType, "account id mismatch"),
 			}
 		},
+		"fail/provisioner-id-mismatch": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			ctx = context.WithValue(ctx, provisionerContextKey, newProv())
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						assert.Equals(t, id, az.ID)
+						return &acme.Authorization{
+							AccountID:     "accID",
+							ProvisionerID: "acme/other",
+						}, nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "provisioner id mismatch"),
+			}
+		},
 		"fail/db.UpdateAuthorization-error": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
 			ctx := context.WithValue(context.Background(), accContextKey, acc)
@@ -425,6 +474,91 @@ func TestHandler_GetCertificate(t *testing.T) {
 	}
 }
 
+func TestHandler_GetCertificate_alternateChains(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	inter, err := pemutil.ReadCertificate("../../authority/testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	root, err := pemutil.ReadCertificate("../../authority/testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+
+	// A cross-signed intermediate has the same subject and key, but it's a
+	// different certificate.
+	cross := &x509.Certificate{
+		Raw:                     root.Raw,
+		RawSubject:              inter.RawSubject,
+		RawSubjectPublicKeyInfo: inter.RawSubjectPublicKeyInfo,
+	}
+	encode := func(certs ...*x509.Certificate) []byte {
+		var b []byte
+		for _, c := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+		return b
+	}
+
+	prov := newProv()
+	provName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	certURL := fmt.Sprintf("%s/acme/%s/certificate/certID", baseURL.String(), provName)
+
+	db := &acme.MockDB{
+		MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+			return &acme.Certificate{
+				ID:            id,
+				AccountID:     "accID",
+				Leaf:          leaf,
+				Intermediates: []*x509.Certificate{inter},
+			}, nil
+		},
+	}
+	h := &Handler{
+		db:              db,
+		linker:          NewLinker("dns", "acme"),
+		alternateChains: [][]*x509.Certificate{{inter}, {cross}, {leaf}},
+	}
+
+	tests := []struct {
+		name       string
+		chain      string
+		statusCode int
+		links      []string
+		body       []byte
+	}{
+		{"ok default", "", 200, []string{link(certURL+"/1", "alternate")}, encode(leaf, inter)},
+		{"ok alternate", "1", 200, []string{link(certURL, "alternate")}, encode(leaf, cross)},
+		{"fail index", "2", 400, nil, nil},
+		{"fail zero", "0", 400, nil, nil},
+		{"fail number", "foo", 400, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", "certID")
+			if tt.chain != "" {
+				chiCtx.URLParams.Add("chain", tt.chain)
+			}
+			ctx := context.WithValue(context.Background(), accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, provisionerContextKey, prov)
+			ctx = context.WithValue(ctx, baseURLContextKey, baseURL)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			req := httptest.NewRequest("GET", certURL, nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+			h.GetCertificate(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tt.statusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.statusCode == 200 {
+				assert.Equals(t, res.Header["Link"], tt.links)
+				assert.Equals(t, body, tt.body)
+			}
+		})
+	}
+}
+
 func TestHandler_GetChallenge(t *testing.T) {
 	chiCtx := chi.NewRouteContext()
 	chiCtx.URLParams.Add("chID", "chID")
@@ -588,7 +722,7 @@ func TestHandler_GetChallenge(t *testing.T) {
 					},
 				},
 				vco: &acme.ValidateChallengeOptions{
-					HTTPGet: func(string) (*http.Response, error) {
+					HTTPGet: func(context.Context, string) (*http.Response, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -639,7 +773,7 @@ func TestHandler_GetChallenge(t *testing.T) {
 					Error:           acme.NewError(acme.ErrorConnectionType, "force"),
 				},
 				vco: &acme.ValidateChallengeOptions{
-					HTTPGet: func(string) (*http.Response, error) {
+					HTTPGet: func(context.Context, string) (*http.Response, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -684,3 +818,20 @@ func TestHandler_GetChallenge(t *testing.T) {
 		})
 	}
 }
+
+func Test_wrapPayloadError(t *testing.T) {
+	var nor NewOrderRequest
+	err := json.Unmarshal([]byte(`{"identifiers":"example.com"}`), &nor)
+	ae := wrapPayloadError(err, "failed to unmarshal new-order request payload")
+	assert.Equals(t, "malformed", ae.Code)
+	assert.Equals(t, 400, ae.Status)
+	assert.Equals(t, `The field "identifiers" must be an array.`, ae.Detail)
+
+	// Syntax errors keep the default detail
+	err = json.Unmarshal([]byte(`{"identifiers"}`), &nor)
+	ae = wrapPayloadError(err, "failed to unmarshal new-order request payload")
+	assert.Equals(t, "The request message was malformed", ae.Detail)
+
+	// Unknown fields are ignored
+	assert.FatalError(t, json.Unmarshal([]byte(`{"identifiers":[],"externalAccountBinding":{}}`), &nor))
+}
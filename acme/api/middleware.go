@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -59,6 +60,14 @@ func (h *Handler) baseURLFromRequest(next nextHTTP) nextHTTP {
 	}
 }
 
+// addClock is a middleware that adds the clock of the handler to the request
+// context, so the ACME objects use the same time source as the authority.
+func (h *Handler) addClock(next nextHTTP) nextHTTP {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(acme.NewClockContext(r.Context(), h.clock.Clock)))
+	}
+}
+
 // addNonce is a middleware that adds a nonce to the response header.
 func (h *Handler) addNonce(next nextHTTP) nextHTTP {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -120,6 +129,10 @@ func (h *Handler) parseJWS(next nextHTTP) nextHTTP {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
+			if api.IsRequestTooLarge(err) {
+				api.WriteError(w, requestTooLargeError(err))
+				return
+			}
 			api.WriteError(w, acme.WrapErrorISE(err, "failed to read request body"))
 			return
 		}
@@ -128,11 +141,23 @@ func (h *Handler) parseJWS(next nextHTTP) nextHTTP {
 			api.WriteError(w, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse JWS from request body"))
 			return
 		}
+		if max := h.maxJWSPayloadSize; max > 0 && int64(len(jws.UnsafePayloadWithoutVerification())) > max {
+			api.WriteError(w, requestTooLargeError(acme.NewError(acme.ErrorMalformedType, "JWS payload is larger than %d bytes", max)))
+			return
+		}
 		ctx := context.WithValue(r.Context(), jwsContextKey, jws)
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// requestTooLargeError returns a malformed error with the 413 Request Entity
+// Too Large status.
+func requestTooLargeError(err error) *acme.Error {
+	e := acme.WrapError(acme.ErrorMalformedType, err, "request is too large")
+	e.Status = http.StatusRequestEntityTooLarge
+	return e
+}
+
 // validateJWS checks the request body for to verify that it meets ACME
 // requirements for a JWS.
 //
@@ -262,8 +287,15 @@ func (h *Handler) extractJWK(next nextHTTP) nextHTTP {
 		// Store the JWK in the context.
 		ctx = context.WithValue(ctx, jwkContextKey, jwk)
 
-		// Get Account or continue to generate a new one.
-		acc, err := h.db.GetAccountByKeyID(ctx, jwk.KeyID)
+		prov, err := provisionerFromContext(ctx)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+
+		// Get Account or continue to generate a new one. The accounts are
+		// partitioned by provisioner.
+		acc, err := h.db.GetAccountByKeyID(ctx, prov.GetID(), jwk.KeyID)
 		switch {
 		case errors.Is(err, acme.ErrNotFound):
 			// For NewAccount requests ...
@@ -339,6 +371,9 @@ func (h *Handler) lookupJWK(next nextHTTP) nextHTTP {
 		case err != nil:
 			api.WriteError(w, err)
 			return
+		case !isProvisionerResource(ctx, acc.ProvisionerID):
+			api.WriteError(w, acme.NewError(acme.ErrorAccountDoesNotExistType, "account with ID '%s' not found", accID))
+			return
 		default:
 			if !acc.IsValid() {
 				api.WriteError(w, acme.NewError(acme.ErrorUnauthorizedType, "account is not active"))
@@ -385,6 +420,53 @@ func (h *Handler) verifyAndExtractJWSPayload(next nextHTTP) nextHTTP {
 	}
 }
 
+// clientCertificateProvisioner is the interface implemented by the ACME
+// provisioners that can require a client certificate in the requests.
+type clientCertificateProvisioner interface {
+	IsClientCertificateRequired() bool
+	VerifyClientCertificate(cs *tls.ConnectionState) (*provisioner.ACMEAccountClientCertificate, error)
+}
+
+// verifyClientCertificate verifies the client certificate of the request if
+// the provisioner requires it, and stores its identity in the context. If the
+// account exists, the certificate must have the identity the account is bound
+// to.
+// Make sure to lookup the account before running this middleware.
+func (h *Handler) verifyClientCertificate(next nextHTTP) nextHTTP {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		p, ok := ctx.Value(provisionerContextKey).(clientCertificateProvisioner)
+		if !ok || !p.IsClientCertificateRequired() {
+			next(w, r)
+			return
+		}
+		cc, err := p.VerifyClientCertificate(r.TLS)
+		if err != nil {
+			api.WriteError(w, acme.WrapError(acme.ErrorUnauthorizedType, err, "error verifying client certificate"))
+			return
+		}
+		if checker, ok := h.ca.(acme.RevocationChecker); ok {
+			isRevoked, err := checker.IsRevoked(cc.SerialNumber)
+			if err != nil {
+				api.WriteError(w, acme.WrapErrorISE(err, "error checking client certificate revocation"))
+				return
+			}
+			if isRevoked {
+				api.WriteError(w, acme.NewError(acme.ErrorUnauthorizedType, "client certificate has been revoked"))
+				return
+			}
+		}
+		if acc, ok := ctx.Value(accContextKey).(*acme.Account); ok && acc != nil {
+			if acc.ClientCertificate == nil || acc.ClientCertificate.Identity != cc.Identity {
+				api.WriteError(w, acme.NewError(acme.ErrorUnauthorizedType, "client certificate does not match the account"))
+				return
+			}
+		}
+		ctx = context.WithValue(ctx, clientCertificateContextKey, cc)
+		next(w, r.WithContext(ctx))
+	}
+}
+
 // isPostAsGet asserts that the request is a PostAsGet (empty JWS payload).
 func (h *Handler) isPostAsGet(next nextHTTP) nextHTTP {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -418,6 +500,8 @@ const (
 	payloadContextKey = ContextKey("payload")
 	// provisionerContextKey provisioner key
 	provisionerContextKey = ContextKey("provisioner")
+	// clientCertificateContextKey client certificate key
+	clientCertificateContextKey = ContextKey("clientCertificate")
 )
 
 // accountFromContext searches the context for an ACME account. Returns the
@@ -471,6 +555,31 @@ func provisionerFromContext(ctx context.Context) (acme.Provisioner, error) {
 	return pval, nil
 }
 
+// isProvisionerResource returns true if an account, order or authorization
+// created by the given provisioner can be used with the provisioner in the
+// context. Resources created before the storage was partitioned by
+// provisioner do not have a provisioner id.
+func isProvisionerResource(ctx context.Context, provisionerID string) bool {
+	if provisionerID == "" {
+		return true
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return prov.GetID() == provisionerID
+}
+
+// clientCertificateFromContext returns the identity of the verified client
+// certificate if one is stored in the context.
+func clientCertificateFromContext(ctx context.Context) *provisioner.ACMEAccountClientCertificate {
+	val, ok := ctx.Value(clientCertificateContextKey).(*provisioner.ACMEAccountClientCertificate)
+	if !ok || val == nil {
+		return nil
+	}
+	return val
+}
+
 // payloadFromContext searches the context for a payload. Returns the payload
 // or an error.
 func payloadFromContext(ctx context.Context) (*payloadInfo, error) {
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -18,6 +22,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/nosql/database"
 	"go.step.sm/crypto/jose"
 )
@@ -432,10 +438,12 @@ func (errReader) Close() error {
 func TestHandler_parseJWS(t *testing.T) {
 	url := "https://ca.smallstep.com/acme/new-account"
 	type test struct {
-		next       nextHTTP
-		body       io.Reader
-		err        *acme.Error
-		statusCode int
+		next              nextHTTP
+		body              io.Reader
+		maxBodySize       int64
+		maxJWSPayloadSize int64
+		err               *acme.Error
+		statusCode        int
 	}
 	var tests = map[string]func(t *testing.T) test{
 		"fail/read-body-error": func(t *testing.T) test {
@@ -445,6 +453,34 @@ func TestHandler_parseJWS(t *testing.T) {
 				err:        acme.NewErrorISE("failed to read request body: force"),
 			}
 		},
+		"fail/body-too-large": func(t *testing.T) test {
+			return test{
+				body:        strings.NewReader("foo.bar.baz"),
+				maxBodySize: 4,
+				statusCode:  413,
+				err:         acme.NewError(acme.ErrorMalformedType, "request is too large: request body is larger than 4 bytes"),
+			}
+		},
+		"fail/payload-too-large": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			signer, err := jose.NewSigner(jose.SigningKey{
+				Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+				Key:       jwk.Key,
+			}, new(jose.SignerOptions))
+			assert.FatalError(t, err)
+			signed, err := signer.Sign([]byte("baz"))
+			assert.FatalError(t, err)
+			raw, err := signed.CompactSerialize()
+			assert.FatalError(t, err)
+
+			return test{
+				body:              strings.NewReader(raw),
+				maxJWSPayloadSize: 2,
+				statusCode:        413,
+				err:               acme.NewError(acme.ErrorMalformedType, "request is too large: JWS payload is larger than 2 bytes"),
+			}
+		},
 		"fail/parse-jws-error": func(t *testing.T) test {
 			return test{
 				body:       strings.NewReader("foo"),
@@ -482,10 +518,10 @@ func TestHandler_parseJWS(t *testing.T) {
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
-			h := &Handler{}
+			h := &Handler{maxJWSPayloadSize: tc.maxJWSPayloadSize}
 			req := httptest.NewRequest("GET", url, tc.body)
 			w := httptest.NewRecorder()
-			h.parseJWS(tc.next)(w, req)
+			api.MaxBodySize(tc.maxBodySize)(http.HandlerFunc(h.parseJWS(tc.next))).ServeHTTP(w, req)
 			res := w.Result()
 
 			assert.Equals(t, res.StatusCode, tc.statusCode)
@@ -852,6 +888,47 @@ func TestHandler_lookupJWK(t *testing.T) {
 				err:        acme.NewError(acme.ErrorUnauthorizedType, "account is not active"),
 			}
 		},
+		"fail/account-other-provisioner": func(t *testing.T) test {
+			acc := &acme.Account{Status: "valid", Key: jwk, ProvisionerID: "acme/other"}
+			ctx := context.WithValue(context.Background(), provisionerContextKey, prov)
+			ctx = context.WithValue(ctx, jwsContextKey, parsedJWS)
+			ctx = context.WithValue(ctx, baseURLContextKey, baseURL)
+			return test{
+				linker: NewLinker("dns", "acme"),
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						assert.Equals(t, id, accID)
+						return acc, nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account with ID '%s' not found", accID),
+			}
+		},
+		"ok/provisioner": func(t *testing.T) test {
+			acc := &acme.Account{Status: "valid", Key: jwk, ProvisionerID: prov.GetID()}
+			ctx := context.WithValue(context.Background(), provisionerContextKey, prov)
+			ctx = context.WithValue(ctx, jwsContextKey, parsedJWS)
+			ctx = context.WithValue(ctx, baseURLContextKey, baseURL)
+			return test{
+				linker: NewLinker("dns", "acme"),
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						assert.Equals(t, id, accID)
+						return acc, nil
+					},
+				},
+				ctx: ctx,
+				next: func(w http.ResponseWriter, r *http.Request) {
+					_acc, err := accountFromContext(r.Context())
+					assert.FatalError(t, err)
+					assert.Equals(t, _acc, acc)
+					w.Write(testBody)
+				},
+				statusCode: 200,
+			}
+		},
 		"ok": func(t *testing.T) test {
 			acc := &acme.Account{Status: "valid", Key: jwk}
 			ctx := context.WithValue(context.Background(), provisionerContextKey, prov)
@@ -1002,7 +1079,8 @@ func TestHandler_extractJWK(t *testing.T) {
 			return test{
 				ctx: ctx,
 				db: &acme.MockDB{
-					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+					MockGetAccountByKeyID: func(ctx context.Context, provisionerID, kid string) (*acme.Account, error) {
+						assert.Equals(t, provisionerID, prov.GetID())
 						assert.Equals(t, kid, pub.KeyID)
 						return nil, acme.NewErrorISE("force")
 					},
@@ -1018,7 +1096,8 @@ func TestHandler_extractJWK(t *testing.T) {
 			return test{
 				ctx: ctx,
 				db: &acme.MockDB{
-					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+					MockGetAccountByKeyID: func(ctx context.Context, provisionerID, kid string) (*acme.Account, error) {
+						assert.Equals(t, provisionerID, prov.GetID())
 						assert.Equals(t, kid, pub.KeyID)
 						return acc, nil
 					},
@@ -1034,7 +1113,8 @@ func TestHandler_extractJWK(t *testing.T) {
 			return test{
 				ctx: ctx,
 				db: &acme.MockDB{
-					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+					MockGetAccountByKeyID: func(ctx context.Context, provisionerID, kid string) (*acme.Account, error) {
+						assert.Equals(t, provisionerID, prov.GetID())
 						assert.Equals(t, kid, pub.KeyID)
 						return acc, nil
 					},
@@ -1057,7 +1137,8 @@ func TestHandler_extractJWK(t *testing.T) {
 			return test{
 				ctx: ctx,
 				db: &acme.MockDB{
-					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+					MockGetAccountByKeyID: func(ctx context.Context, provisionerID, kid string) (*acme.Account, error) {
+						assert.Equals(t, provisionerID, prov.GetID())
 						assert.Equals(t, kid, pub.KeyID)
 						return nil, acme.ErrNotFound
 					},
@@ -1473,3 +1554,149 @@ func TestHandler_validateJWS(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_verifyClientCertificate(t *testing.T) {
+	u := "https://ca.smallstep.com/acme/new-order"
+	cert := &x509.Certificate{
+		Raw:          []byte("device"),
+		Subject:      pkix.Name{CommonName: "device-1234"},
+		SerialNumber: big.NewInt(1234),
+	}
+	cs := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	prov := &provisioner.ACME{ClientCertificate: &provisioner.ACMEClientCertificateOptions{}}
+	unauthorized := acme.NewError(acme.ErrorUnauthorizedType, "client certificate does not match the account")
+
+	type test struct {
+		ctx          context.Context
+		tls          *tls.ConnectionState
+		ca           acme.CertificateAuthority
+		err          *acme.Error
+		statusCode   int
+		wantIdentity string
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"ok/not-required": func(t *testing.T) test {
+			return test{
+				ctx:        context.WithValue(context.Background(), provisionerContextKey, newProv()),
+				statusCode: 200,
+			}
+		},
+		"ok/new-account": func(t *testing.T) test {
+			return test{
+				ctx:          context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov)),
+				tls:          cs,
+				statusCode:   200,
+				wantIdentity: "device-1234",
+			}
+		},
+		"ok/bound-account": func(t *testing.T) test {
+			ctx := context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov))
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{
+				ID:                "accID",
+				ClientCertificate: &provisioner.ACMEAccountClientCertificate{Identity: "device-1234"},
+			})
+			return test{
+				ctx:          ctx,
+				tls:          cs,
+				statusCode:   200,
+				wantIdentity: "device-1234",
+			}
+		},
+		"fail/no-certificate": func(t *testing.T) test {
+			return test{
+				ctx:        context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov)),
+				statusCode: unauthorized.Status,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "error verifying client certificate"),
+			}
+		},
+		"fail/revoked": func(t *testing.T) test {
+			return test{
+				ctx: context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov)),
+				tls: cs,
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						assert.Equals(t, "1234", sn)
+						return true, nil
+					},
+				},
+				statusCode: unauthorized.Status,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "client certificate has been revoked"),
+			}
+		},
+		"fail/revocation-error": func(t *testing.T) test {
+			return test{
+				ctx: context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov)),
+				tls: cs,
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						return false, errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err:        acme.NewErrorISE("error checking client certificate revocation"),
+			}
+		},
+		"fail/unbound-account": func(t *testing.T) test {
+			ctx := context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov))
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			return test{
+				ctx:        ctx,
+				tls:        cs,
+				statusCode: unauthorized.Status,
+				err:        unauthorized,
+			}
+		},
+		"fail/other-identity": func(t *testing.T) test {
+			ctx := context.WithValue(context.Background(), provisionerContextKey, acme.Provisioner(prov))
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{
+				ID:                "accID",
+				ClientCertificate: &provisioner.ACMEAccountClientCertificate{Identity: "device-5678"},
+			})
+			return test{
+				ctx:        ctx,
+				tls:        cs,
+				statusCode: unauthorized.Status,
+				err:        unauthorized,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			h := &Handler{ca: tc.ca}
+			req := httptest.NewRequest("POST", u, nil)
+			req.TLS = tc.tls
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			var identity string
+			h.verifyClientCertificate(func(w http.ResponseWriter, r *http.Request) {
+				if cc := clientCertificateFromContext(r.Context()); cc != nil {
+					identity = cc.Identity
+				}
+				testNext(w, r)
+			})(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				assert.Equals(t, bytes.TrimSpace(body), testBody)
+				assert.Equals(t, tc.wantIdentity, identity)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/timing"
 	"go.step.sm/crypto/randutil"
 )
 
@@ -21,6 +23,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Replaces    string            `json:"replaces,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -85,7 +88,7 @@ func (h *Handler) NewOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	var nor NewOrderRequest
 	if err := json.Unmarshal(payload.value, &nor); err != nil {
-		api.WriteError(w, acme.WrapError(acme.ErrorMalformedType, err,
+		api.WriteError(w, wrapPayloadError(err,
 			"failed to unmarshal new-order request payload"))
 		return
 	}
@@ -95,7 +98,22 @@ func (h *Handler) NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	now := clock.Now()
+	// The replaced certificate must have been issued to the account for at
+	// least one of the identifiers in the order.
+	if nor.Replaces != "" {
+		replaced, err := acme.GetReplacedCertificate(ctx, h.db, acc.ID, nor.Replaces)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		if !sharesIdentifier(replaced.Leaf, nor.Identifiers) {
+			api.WriteError(w, acme.NewError(acme.ErrorMalformedType,
+				"certificate %s does not share any identifier with the order", nor.Replaces))
+			return
+		}
+	}
+
+	now := h.clock.Now()
 	// New order.
 	o := &acme.Order{
 		AccountID:        acc.ID,
@@ -106,14 +124,26 @@ func (h *Handler) NewOrder(w http.ResponseWriter, r *http.Request) {
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		Replaces:         nor.Replaces,
 	}
 
 	for i, identifier := range o.Identifiers {
+		// Reuse a recent valid authorization of the account if possible.
+		reused, err := h.reusableAuthorization(ctx, acc.ID, prov.GetID(), identifier)
+		if err != nil {
+			api.WriteError(w, err)
+			return
+		}
+		if reused != nil {
+			o.AuthorizationIDs[i] = reused.ID
+			continue
+		}
 		az := &acme.Authorization{
-			AccountID:  acc.ID,
-			Identifier: identifier,
-			ExpiresAt:  o.ExpiresAt,
-			Status:     acme.StatusPending,
+			AccountID:     acc.ID,
+			ProvisionerID: prov.GetID(),
+			Identifier:    identifier,
+			ExpiresAt:     o.ExpiresAt,
+			Status:        acme.StatusPending,
 		}
 		if err := h.newAuthorization(ctx, az); err != nil {
 			api.WriteError(w, err)
@@ -145,6 +175,97 @@ func (h *Handler) NewOrder(w http.ResponseWriter, r *http.Request) {
 	api.JSONStatus(w, o, http.StatusCreated)
 }
 
+// reusableChallengeTypes are the challenge types whose validations are looked
+// up to reuse an authorization, in order of preference.
+var reusableChallengeTypes = []acme.ChallengeType{acme.DNS01, acme.HTTP01, acme.TLSALPN01}
+
+// cacheValidation records the successful validation of a challenge, so its
+// authorization can be reused in the next orders of the account. The
+// expiration of the authorization is extended to the end of the reuse period,
+// counted from the validation of the challenge. A validation already cached
+// for the authorization is never extended.
+func (h *Handler) cacheValidation(ctx context.Context, azID string, ch *acme.Challenge) error {
+	cache, ok := h.db.(acme.ValidationCache)
+	if !ok || h.validationReuse <= 0 {
+		return nil
+	}
+	az, err := h.db.GetAuthorization(ctx, azID)
+	if err != nil {
+		return acme.WrapErrorISE(err, "error retrieving authorization")
+	}
+	if err := az.UpdateStatus(ctx, h.db); err != nil {
+		return err
+	}
+	if az.Status != acme.StatusValid {
+		return nil
+	}
+
+	identifier := az.Identifier
+	if az.Wildcard {
+		identifier.Value = "*." + identifier.Value
+	}
+	v, err := cache.GetValidation(ctx, az.AccountID, identifier, ch.Type)
+	switch {
+	case errors.Is(err, acme.ErrNotFound):
+	case err != nil:
+		return acme.WrapErrorISE(err, "error retrieving validation")
+	case v.AuthorizationID == az.ID:
+		return nil
+	}
+
+	validatedAt, err := time.Parse(time.RFC3339, ch.ValidatedAt)
+	if err != nil {
+		validatedAt = h.clock.Now()
+	}
+	expiresAt := validatedAt.Add(h.validationReuse)
+	if az.ExpiresAt.Before(expiresAt) {
+		az.ExpiresAt = expiresAt
+		if err := h.db.UpdateAuthorization(ctx, az); err != nil {
+			return acme.WrapErrorISE(err, "error updating authorization")
+		}
+	}
+
+	return cache.StoreValidation(ctx, &acme.CachedValidation{
+		AccountID:       az.AccountID,
+		Identifier:      identifier,
+		ChallengeType:   ch.Type,
+		AuthorizationID: az.ID,
+		ValidatedAt:     validatedAt,
+		ExpiresAt:       expiresAt,
+	})
+}
+
+// reusableAuthorization returns a valid authorization of the account and
+// provisioner for the identifier, or nil if there is not one that can be
+// reused.
+func (h *Handler) reusableAuthorization(ctx context.Context, accID, provID string, identifier acme.Identifier) (*acme.Authorization, error) {
+	cache, ok := h.db.(acme.ValidationCache)
+	if !ok || h.validationReuse <= 0 {
+		return nil, nil
+	}
+	now := h.clock.Now()
+	for _, typ := range reusableChallengeTypes {
+		v, err := cache.GetValidation(ctx, accID, identifier, typ)
+		switch {
+		case errors.Is(err, acme.ErrNotFound):
+			continue
+		case err != nil:
+			return nil, acme.WrapErrorISE(err, "error retrieving validation")
+		case !now.Before(v.ExpiresAt):
+			continue
+		}
+		az, err := h.db.GetAuthorization(ctx, v.AuthorizationID)
+		if err != nil {
+			continue
+		}
+		if az.Status == acme.StatusValid && az.AccountID == accID &&
+			az.ProvisionerID == provID && now.Before(az.ExpiresAt) {
+			return az, nil
+		}
+	}
+	return nil, nil
+}
+
 func (h *Handler) newAuthorization(ctx context.Context, az *acme.Authorization) error {
 	if strings.HasPrefix(az.Identifier.Value, "*.") {
 		az.Wildcard = true
@@ -222,7 +343,10 @@ func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 
 // FinalizeOrder attemptst to finalize an order and create a certificate.
 func (h *Handler) FinalizeOrder(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, tb := timing.NewContext(r.Context())
+	defer api.LogTiming(w, tb)
+
+	tb.Start(timing.Authorization)
 	acc, err := accountFromContext(ctx)
 	if err != nil {
 		api.WriteError(w, err)
@@ -240,7 +364,7 @@ func (h *Handler) FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	var fr FinalizeRequest
 	if err := json.Unmarshal(payload.value, &fr); err != nil {
-		api.WriteError(w, acme.WrapError(acme.ErrorMalformedType, err,
+		api.WriteError(w, wrapPayloadError(err,
 			"failed to unmarshal finalize-order request payload"))
 		return
 	}
@@ -264,6 +388,7 @@ func (h *Handler) FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 			"provisioner '%s' does not own order '%s'", prov.GetID(), o.ID))
 		return
 	}
+	ctx = acme.NewContextWithAccount(ctx, acc)
 	if err = o.Finalize(ctx, h.db, fr.csr, h.ca, prov); err != nil {
 		api.WriteError(w, acme.WrapErrorISE(err, "error finalizing order"))
 		return
@@ -295,3 +420,26 @@ func challengeTypes(az *acme.Authorization) []acme.ChallengeType {
 
 	return chTypes
 }
+
+// sharesIdentifier returns true if the certificate contains at least one of
+// the given identifiers.
+func sharesIdentifier(crt *x509.Certificate, identifiers []acme.Identifier) bool {
+	for _, id := range identifiers {
+		switch id.Type {
+		case acme.DNS:
+			for _, name := range crt.DNSNames {
+				if strings.EqualFold(name, id.Value) {
+					return true
+				}
+			}
+		case acme.IP:
+			ip := net.ParseIP(id.Value)
+			for _, v := range crt.IPAddresses {
+				if v.Equal(ip) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -1709,3 +1709,138 @@ func TestHandler_challengeTypes(t *testing.T) {
 		})
 	}
 }
+
+// validationCacheDB is an acme.DB that implements acme.ValidationCache.
+type validationCacheDB struct {
+	*acme.MockDB
+	validations map[string]*acme.CachedValidation
+	err         error
+}
+
+func (db *validationCacheDB) StoreValidation(ctx context.Context, v *acme.CachedValidation) error {
+	db.validations[v.AccountID+v.Identifier.Value+string(v.ChallengeType)] = v
+	return nil
+}
+
+func (db *validationCacheDB) GetValidation(ctx context.Context, accountID string, identifier acme.Identifier, typ acme.ChallengeType) (*acme.CachedValidation, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	if v, ok := db.validations[accountID+identifier.Value+string(typ)]; ok {
+		return v, nil
+	}
+	return nil, acme.ErrNotFound
+}
+
+func TestHandler_reuseValidations(t *testing.T) {
+	ctx := context.Background()
+	prov := newProv()
+	now := clock.Now()
+
+	az := &acme.Authorization{
+		ID:            "azID",
+		AccountID:     "accID",
+		ProvisionerID: prov.GetID(),
+		Identifier:    acme.Identifier{Type: acme.DNS, Value: "example.com"},
+		Status:        acme.StatusPending,
+		Wildcard:      true,
+		ExpiresAt:     now.Add(time.Hour),
+		Challenges: []*acme.Challenge{
+			{ID: "chID", Type: acme.DNS01, Status: acme.StatusValid, ValidatedAt: now.Add(-time.Hour).Format(time.RFC3339)},
+		},
+	}
+	validatedAt, err := time.Parse(time.RFC3339, az.Challenges[0].ValidatedAt)
+	assert.FatalError(t, err)
+	var updated int
+	db := &validationCacheDB{
+		MockDB: &acme.MockDB{
+			MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+				if id != "azID" {
+					return nil, acme.ErrNotFound
+				}
+				return az, nil
+			},
+			MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+				updated++
+				return nil
+			},
+		},
+		validations: make(map[string]*acme.CachedValidation),
+	}
+
+	// Validations are not cached without a reuse period
+	h := &Handler{db: db}
+	assert.FatalError(t, h.cacheValidation(ctx, "azID", az.Challenges[0]))
+	assert.Len(t, 0, db.validations)
+
+	h.validationReuse = 24 * time.Hour
+	assert.FatalError(t, h.cacheValidation(ctx, "azID", az.Challenges[0]))
+	assert.Equals(t, acme.StatusValid, az.Status)
+	assert.Equals(t, validatedAt.Add(24*time.Hour), az.ExpiresAt)
+	assert.Equals(t, 2, updated)
+	v := db.validations["accID*.example.comdns-01"]
+	if assert.NotNil(t, v) {
+		assert.Equals(t, "azID", v.AuthorizationID)
+		assert.Equals(t, acme.Identifier{Type: acme.DNS, Value: "*.example.com"}, v.Identifier)
+		assert.Equals(t, validatedAt, v.ValidatedAt)
+		assert.Equals(t, az.ExpiresAt, v.ExpiresAt)
+	}
+
+	// The cached validation is not extended
+	az.Challenges[0].ValidatedAt = now.Format(time.RFC3339)
+	assert.FatalError(t, h.cacheValidation(ctx, "azID", az.Challenges[0]))
+	assert.Equals(t, 2, updated)
+	assert.Equals(t, validatedAt.Add(24*time.Hour), az.ExpiresAt)
+	assert.Equals(t, v, db.validations["accID*.example.comdns-01"])
+	assert.Equals(t, validatedAt, v.ValidatedAt)
+
+	wildcard := acme.Identifier{Type: acme.DNS, Value: "*.example.com"}
+	got, err := h.reusableAuthorization(ctx, "accID", prov.GetID(), wildcard)
+	assert.FatalError(t, err)
+	assert.Equals(t, az, got)
+
+	// Only the account and provisioner of the authorization can reuse it
+	got, err = h.reusableAuthorization(ctx, "otherID", prov.GetID(), wildcard)
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+	got, err = h.reusableAuthorization(ctx, "accID", "otherID", wildcard)
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+	got, err = h.reusableAuthorization(ctx, "accID", prov.GetID(), az.Identifier)
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+
+	// Expired validations are not reused
+	v.ExpiresAt = now
+	got, err = h.reusableAuthorization(ctx, "accID", prov.GetID(), wildcard)
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+	v.ExpiresAt = now.Add(24 * time.Hour)
+
+	// New orders attach the valid authorization
+	nor := &NewOrderRequest{Identifiers: []acme.Identifier{wildcard}}
+	b, err := json.Marshal(nor)
+	assert.FatalError(t, err)
+	db.MockCreateChallenge = func(ctx context.Context, ch *acme.Challenge) error {
+		return errors.New("force")
+	}
+	db.MockCreateOrder = func(ctx context.Context, o *acme.Order) error {
+		o.ID = "ordID"
+		assert.Equals(t, []string{"azID"}, o.AuthorizationIDs)
+		return nil
+	}
+	rctx := context.WithValue(ctx, provisionerContextKey, prov)
+	rctx = context.WithValue(rctx, accContextKey, &acme.Account{ID: "accID"})
+	rctx = context.WithValue(rctx, payloadContextKey, &payloadInfo{value: b})
+	rctx = context.WithValue(rctx, baseURLContextKey, &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"})
+	req := httptest.NewRequest("POST", "https://test.ca.smallstep.com/acme/new-order", nil)
+	w := httptest.NewRecorder()
+	h.linker = NewLinker("dns", "acme")
+	h.NewOrder(w, req.WithContext(rctx))
+	assert.Equals(t, 201, w.Result().StatusCode)
+
+	// Errors of the cache fail the order
+	db.err = errors.New("force")
+	_, err = h.reusableAuthorization(ctx, "accID", prov.GetID(), wildcard)
+	assert.NotNil(t, err)
+}
@@ -8,15 +8,16 @@ import (
 
 // Authorization representst an ACME Authorization.
 type Authorization struct {
-	ID         string       `json:"-"`
-	AccountID  string       `json:"-"`
-	Token      string       `json:"-"`
-	Identifier Identifier   `json:"identifier"`
-	Status     Status       `json:"status"`
-	Challenges []*Challenge `json:"challenges"`
-	Wildcard   bool         `json:"wildcard"`
-	ExpiresAt  time.Time    `json:"expires"`
-	Error      *Error       `json:"error,omitempty"`
+	ID            string       `json:"-"`
+	AccountID     string       `json:"-"`
+	ProvisionerID string       `json:"-"`
+	Token         string       `json:"-"`
+	Identifier    Identifier   `json:"identifier"`
+	Status        Status       `json:"status"`
+	Challenges    []*Challenge `json:"challenges"`
+	Wildcard      bool         `json:"wildcard"`
+	ExpiresAt     time.Time    `json:"expires"`
+	Error         *Error       `json:"error,omitempty"`
 }
 
 // ToLog enables response logging.
@@ -31,7 +32,7 @@ func (az *Authorization) ToLog() (interface{}, error) {
 // UpdateStatus updates the ACME Authorization Status if necessary.
 // Changes to the Authorization are saved using the database interface.
 func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
-	now := clock.Now()
+	now := clockFromContext(ctx).Now()
 
 	switch az.Status {
 	case StatusInvalid:
@@ -67,3 +68,26 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 	}
 	return nil
 }
+
+// CachedValidation is a successful validation of an identifier by an account
+// using a challenge type. Until it expires, its valid authorization can be
+// attached to the new orders of the account for the same identifier, as RFC
+// 8555 allows. The identifier of a wildcard authorization keeps the "*."
+// prefix.
+type CachedValidation struct {
+	AccountID       string        `json:"accountID"`
+	Identifier      Identifier    `json:"identifier"`
+	ChallengeType   ChallengeType `json:"challengeType"`
+	AuthorizationID string        `json:"authorizationID"`
+	ValidatedAt     time.Time     `json:"validatedAt"`
+	ExpiresAt       time.Time     `json:"expiresAt"`
+}
+
+// ValidationCache is the interface implemented by the databases that can
+// store the successful validations to reuse their authorizations.
+// GetValidation returns ErrNotFound if there is not a validation for the
+// account, identifier and challenge type.
+type ValidationCache interface {
+	StoreValidation(ctx context.Context, v *CachedValidation) error
+	GetValidation(ctx context.Context, accountID string, identifier Identifier, typ ChallengeType) (*CachedValidation, error)
+}
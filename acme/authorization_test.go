@@ -7,8 +7,21 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
+// clock is the clock used when the context of the tests has no clock.
+var clock provisioner.UTCClock
+
+func TestClockFromContext(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 999, time.UTC)
+	ctx := NewClockContext(context.Background(), provisioner.NewFakeClock(now))
+	assert.Equals(t, clockFromContext(ctx).Now(), now.Truncate(time.Second))
+
+	got := clockFromContext(context.Background()).Now()
+	assert.True(t, time.Since(got) < time.Minute)
+}
+
 func TestAuthorization_UpdateStatus(t *testing.T) {
 	type test struct {
 		az  *Authorization
@@ -1,7 +1,12 @@
 package acme
 
 import (
+	"bytes"
+	"context"
 	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"strings"
 )
 
 // Certificate options with which to create and store a cert object.
@@ -11,4 +16,52 @@ type Certificate struct {
 	OrderID       string
 	Leaf          *x509.Certificate
 	Intermediates []*x509.Certificate
+	Replaces      string
+	ReplacedBy    string
+}
+
+// ParseCertificateID parses an ACME Renewal Information (ARI) certificate
+// identifier, the base64url-encoded authority key identifier and serial number
+// of a certificate separated by a dot.
+func ParseCertificateID(id string) (keyID []byte, serial *big.Int, err error) {
+	parts := strings.Split(id, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, nil, NewError(ErrorMalformedType, "invalid certificate identifier %s", id)
+	}
+	if keyID, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return nil, nil, WrapError(ErrorMalformedType, err, "invalid certificate identifier %s", id)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, WrapError(ErrorMalformedType, err, "invalid certificate identifier %s", id)
+	}
+	return keyID, new(big.Int).SetBytes(b), nil
+}
+
+// GetReplacedCertificate returns the certificate with the given ARI
+// certificate identifier, used in the replaces field of an order. The
+// certificate must have been issued to the given account, and must not have
+// been replaced by another one.
+func GetReplacedCertificate(ctx context.Context, db DB, accountID, id string) (*Certificate, error) {
+	keyID, serial, err := ParseCertificateID(id)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := db.GetCertificateBySerial(ctx, serial.String())
+	if err != nil {
+		if _, ok := err.(*Error); ok {
+			return nil, err
+		}
+		return nil, WrapErrorISE(err, "error retrieving certificate %s", id)
+	}
+	if !bytes.Equal(cert.Leaf.AuthorityKeyId, keyID) {
+		return nil, NewError(ErrorMalformedType, "certificate %s not found", id)
+	}
+	if cert.AccountID != accountID {
+		return nil, NewError(ErrorUnauthorizedType, "account %s does not own certificate %s", accountID, id)
+	}
+	if cert.ReplacedBy != "" {
+		return nil, NewError(ErrorAlreadyReplacedType, "certificate %s has already been replaced", id)
+	}
+	return cert, nil
 }
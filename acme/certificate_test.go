@@ -0,0 +1,83 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestParseCertificateID(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		wantKeyID  []byte
+		wantSerial *big.Int
+		wantErr    bool
+	}{
+		{"ok", "YWtp.Cg", []byte("aki"), big.NewInt(10), false},
+		{"ok/leading-zero", "YWtp.AIc", []byte("aki"), big.NewInt(135), false},
+		{"fail/no-dot", "YWtpCg", nil, nil, true},
+		{"fail/empty-serial", "YWtp.", nil, nil, true},
+		{"fail/key-id", "!!.Cg", nil, nil, true},
+		{"fail/serial", "YWtp.!!", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyID, serial, err := ParseCertificateID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCertificateID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.wantKeyID, keyID)
+			assert.Equals(t, tt.wantSerial, serial)
+		})
+	}
+}
+
+func TestGetReplacedCertificate(t *testing.T) {
+	newDB := func(cert *Certificate, err error) DB {
+		return &MockDB{
+			MockGetCertificateBySerial: func(ctx context.Context, serial string) (*Certificate, error) {
+				assert.Equals(t, "10", serial)
+				return cert, err
+			},
+		}
+	}
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(10), AuthorityKeyId: []byte("aki")}
+	tests := []struct {
+		name     string
+		db       DB
+		id       string
+		wantType ProblemType
+		wantErr  bool
+	}{
+		{"ok", newDB(&Certificate{ID: "certID", AccountID: "accID", Leaf: leaf}, nil), "YWtp.Cg", 0, false},
+		{"fail/id", newDB(nil, nil), "YWtpCg", ErrorMalformedType, true},
+		{"fail/not-found", newDB(nil, NewError(ErrorMalformedType, "not found")), "YWtp.Cg", ErrorMalformedType, true},
+		{"fail/db", newDB(nil, errors.New("force")), "YWtp.Cg", ErrorServerInternalType, true},
+		{"fail/key-id", newDB(&Certificate{ID: "certID", AccountID: "accID", Leaf: leaf}, nil), "b3RoZXI.Cg", ErrorMalformedType, true},
+		{"fail/account", newDB(&Certificate{ID: "certID", AccountID: "otherID", Leaf: leaf}, nil), "YWtp.Cg", ErrorUnauthorizedType, true},
+		{"fail/replaced", newDB(&Certificate{ID: "certID", AccountID: "accID", Leaf: leaf, ReplacedBy: "newID"}, nil), "YWtp.Cg", ErrorAlreadyReplacedType, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := GetReplacedCertificate(context.Background(), tt.db, "accID", tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetReplacedCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				ae, ok := err.(*Error)
+				if assert.True(t, ok) {
+					assert.Equals(t, NewError(tt.wantType, "").Type, ae.Type)
+				}
+				return
+			}
+			assert.Equals(t, "certID", cert.ID)
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"net/url"
@@ -20,6 +21,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/smallstep/certificates/dnsupdate"
 	"go.step.sm/crypto/jose"
 )
 
@@ -33,16 +35,17 @@ const (
 
 // Challenge represents an ACME response Challenge type.
 type Challenge struct {
-	ID              string        `json:"-"`
-	AccountID       string        `json:"-"`
-	AuthorizationID string        `json:"-"`
-	Value           string        `json:"-"`
-	Type            ChallengeType `json:"type"`
-	Status          Status        `json:"status"`
-	Token           string        `json:"token"`
-	ValidatedAt     string        `json:"validated,omitempty"`
-	URL             string        `json:"url"`
-	Error           *Error        `json:"error,omitempty"`
+	ID              string               `json:"-"`
+	AccountID       string               `json:"-"`
+	AuthorizationID string               `json:"-"`
+	Value           string               `json:"-"`
+	Type            ChallengeType        `json:"type"`
+	Status          Status               `json:"status"`
+	Token           string               `json:"token"`
+	ValidatedAt     string               `json:"validated,omitempty"`
+	URL             string               `json:"url"`
+	Error           *Error               `json:"error,omitempty"`
+	Attempts        []*ValidationAttempt `json:"-"`
 }
 
 // ToLog enables response logging.
@@ -78,7 +81,7 @@ func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey,
 func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey, vo *ValidateChallengeOptions) error {
 	url := &url.URL{Scheme: "http", Host: ch.Value, Path: fmt.Sprintf("/.well-known/acme-challenge/%s", ch.Token)}
 
-	resp, err := vo.HTTPGet(url.String())
+	resp, err := vo.HTTPGet(ctx, url.String())
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
 			"error doing http GET for url %s", url))
@@ -108,7 +111,7 @@ func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWeb
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
-	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.ValidatedAt = clockFromContext(ctx).Now().Format(time.RFC3339)
 
 	if err = db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
@@ -140,7 +143,7 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 
 	hostPort := net.JoinHostPort(ch.Value, "443")
 
-	conn, err := vo.TLSDial("tcp", hostPort, config)
+	conn, err := vo.TLSDial(ctx, "tcp", hostPort, config)
 	if err != nil {
 		// With Go 1.17+ tls.Dial fails if there's no overlap between configured
 		// client and server protocols. When this happens the connection is
@@ -217,7 +220,7 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 
 			ch.Status = StatusValid
 			ch.Error = nil
-			ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+			ch.ValidatedAt = clockFromContext(ctx).Now().Format(time.RFC3339)
 
 			if err = db.UpdateChallenge(ctx, ch); err != nil {
 				return WrapErrorISE(err, "tlsalpn01ValidateChallenge - error updating challenge")
@@ -245,19 +248,36 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	// _acme-challenge.*.example.com
 	// Instead perform txt lookup for _acme-challenge.example.com
 	domain := strings.TrimPrefix(ch.Value, "*.")
+	name := "_acme-challenge." + domain
+
+	// In the assisted mode, the CA creates the TXT record before looking it
+	// up, and removes it after the validation.
+	if vo.DNSUpdater != nil {
+		_, value, err := dns01KeyAuthorization(ch.Token, jwk)
+		if err != nil {
+			return err
+		}
+		if err := vo.DNSUpdater.AddTXT(ctx, name, value); err != nil {
+			return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
+				"error creating TXT record for domain %s", domain))
+		}
+		defer func() {
+			if err := vo.DNSUpdater.RemoveTXT(ctx, name, value); err != nil {
+				log.Printf("error removing TXT record %s: %v", name, err)
+			}
+		}()
+	}
 
-	txtRecords, err := vo.LookupTxt("_acme-challenge." + domain)
+	txtRecords, err := vo.LookupTxt(ctx, name)
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
 			"error looking up TXT records for domain %s", domain))
 	}
 
-	expectedKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+	expectedKeyAuth, expected, err := dns01KeyAuthorization(ch.Token, jwk)
 	if err != nil {
 		return err
 	}
-	h := sha256.Sum256([]byte(expectedKeyAuth))
-	expected := base64.RawURLEncoding.EncodeToString(h[:])
 	var found bool
 	for _, r := range txtRecords {
 		if r == expected {
@@ -273,7 +293,7 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
-	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.ValidatedAt = clockFromContext(ctx).Now().Format(time.RFC3339)
 
 	if err = db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
@@ -281,6 +301,17 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	return nil
 }
 
+// dns01KeyAuthorization returns the key authorization of a dns-01 challenge,
+// and its digest used as the value of the TXT record.
+func dns01KeyAuthorization(token string, jwk *jose.JSONWebKey) (string, string, error) {
+	keyAuth, err := KeyAuthorization(token, jwk)
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.Sum256([]byte(keyAuth))
+	return keyAuth, base64.RawURLEncoding.EncodeToString(h[:]), nil
+}
+
 // serverName determines the SNI HostName to set based on an acme.Challenge
 // for TLS-ALPN-01 challenges RFC8738 states that, if HostName is an IP, it
 // should be the ARPA address https://datatracker.ietf.org/doc/html/rfc8738#section-6.
@@ -363,13 +394,17 @@ func storeError(ctx context.Context, db DB, ch *Challenge, markInvalid bool, err
 	return nil
 }
 
-type httpGetter func(string) (*http.Response, error)
-type lookupTxt func(string) ([]string, error)
-type tlsDialer func(network, addr string, config *tls.Config) (*tls.Conn, error)
+type httpGetter func(ctx context.Context, url string) (*http.Response, error)
+type lookupTxt func(ctx context.Context, name string) ([]string, error)
+type tlsDialer func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error)
 
-// ValidateChallengeOptions are ACME challenge validator functions.
+// ValidateChallengeOptions are ACME challenge validator functions. The
+// functions must stop when the given context is canceled.
 type ValidateChallengeOptions struct {
 	HTTPGet   httpGetter
 	LookupTxt lookupTxt
 	TLSDial   tlsDialer
+	// DNSUpdater creates the TXT records of the dns-01 challenges in the
+	// assisted mode.
+	DNSUpdater dnsupdate.Updater
 }
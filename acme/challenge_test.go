@@ -274,7 +274,7 @@ func TestChallenge_Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -310,7 +310,7 @@ func TestChallenge_Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -345,7 +345,7 @@ func TestChallenge_Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -382,7 +382,7 @@ func TestChallenge_Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -417,7 +417,7 @@ func TestChallenge_Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -542,7 +542,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -576,7 +576,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -609,7 +609,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							StatusCode: http.StatusBadRequest,
 							Body:       errReader(0),
@@ -646,7 +646,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							StatusCode: http.StatusBadRequest,
 							Body:       errReader(0),
@@ -682,7 +682,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							Body: errReader(0),
 						}, nil
@@ -705,7 +705,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							Body: ioutil.NopCloser(bytes.NewBufferString("foo")),
 						}, nil
@@ -731,7 +731,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							Body: ioutil.NopCloser(bytes.NewBufferString("foo")),
 						}, nil
@@ -773,7 +773,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							Body: ioutil.NopCloser(bytes.NewBufferString("foo")),
 						}, nil
@@ -816,7 +816,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							Body: ioutil.NopCloser(bytes.NewBufferString(expKeyAuth)),
 						}, nil
@@ -858,7 +858,7 @@ func TestHTTP01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					HTTPGet: func(url string) (*http.Response, error) {
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
 						return &http.Response{
 							Body: ioutil.NopCloser(bytes.NewBufferString(expKeyAuth)),
 						}, nil
@@ -929,7 +929,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -964,7 +964,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -1002,7 +1002,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return []string{"foo"}, nil
 					},
 				},
@@ -1027,7 +1027,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return []string{"foo", "bar"}, nil
 					},
 				},
@@ -1069,7 +1069,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return []string{"foo", "bar"}, nil
 					},
 				},
@@ -1112,7 +1112,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return []string{"foo", expected}, nil
 					},
 				},
@@ -1157,7 +1157,7 @@ func TestDNS01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					LookupTxt: func(url string) ([]string, error) {
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
 						return []string{"foo", expected}, nil
 					},
 				},
@@ -1182,6 +1182,82 @@ func TestDNS01Validate(t *testing.T) {
 				jwk: jwk,
 			}
 		},
+		"ok/dns-assist": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  fulldomain,
+				Status: StatusPending,
+			}
+
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			assert.FatalError(t, err)
+			h := sha256.Sum256([]byte(expKeyAuth))
+			expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+			updater := &mockDNSUpdater{records: map[string][]string{}}
+			t.Cleanup(func() {
+				assert.Len(t, 0, updater.records["_acme-challenge."+domain])
+			})
+			return test{
+				ch: ch,
+				vo: &ValidateChallengeOptions{
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
+						return updater.records[url], nil
+					},
+					DNSUpdater: updater,
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equals(t, updch.ID, ch.ID)
+						assert.Equals(t, updch.Status, StatusValid)
+						assert.Equals(t, updch.Error, nil)
+						assert.Equals(t, []string{expected}, updater.records["_acme-challenge."+domain])
+						return nil
+					},
+				},
+				jwk: jwk,
+			}
+		},
+		"ok/dns-assist-add-error": func(t *testing.T) test {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  fulldomain,
+				Status: StatusPending,
+			}
+
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+
+			return test{
+				ch: ch,
+				vo: &ValidateChallengeOptions{
+					LookupTxt: func(ctx context.Context, url string) ([]string, error) {
+						return nil, errors.New("unexpected lookup")
+					},
+					DNSUpdater: &mockDNSUpdater{err: errors.New("force")},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equals(t, updch.ID, ch.ID)
+						assert.Equals(t, updch.Status, StatusPending)
+
+						err := NewError(ErrorDNSType, "error creating TXT record for domain %s: force", domain)
+
+						assert.HasPrefix(t, updch.Error.Err.Error(), err.Err.Error())
+						assert.Equals(t, updch.Error.Type, err.Type)
+						assert.Equals(t, updch.Error.Detail, err.Detail)
+						assert.Equals(t, updch.Error.Status, err.Status)
+						return nil
+					},
+				},
+				jwk: jwk,
+			}
+		},
 	}
 	for name, run := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -1206,6 +1282,34 @@ func TestDNS01Validate(t *testing.T) {
 	}
 }
 
+// mockDNSUpdater is a dnsupdate.Updater that keeps the records in memory.
+type mockDNSUpdater struct {
+	records map[string][]string
+	err     error
+}
+
+func (m *mockDNSUpdater) AddTXT(ctx context.Context, name, value string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.records[name] = append(m.records[name], value)
+	return nil
+}
+
+func (m *mockDNSUpdater) RemoveTXT(ctx context.Context, name, value string) error {
+	if m.err != nil {
+		return m.err
+	}
+	var values []string
+	for _, v := range m.records[name] {
+		if v != value {
+			values = append(values, v)
+		}
+	}
+	m.records[name] = values
+	return nil
+}
+
 func newTestTLSALPNServer(validationCert *tls.Certificate) (*httptest.Server, tlsDialer) {
 	srv := httptest.NewUnstartedServer(http.NewServeMux())
 
@@ -1234,7 +1338,7 @@ func newTestTLSALPNServer(validationCert *tls.Certificate) (*httptest.Server, tl
 	srv.Listener = tls.NewListener(srv.Listener, srv.TLS)
 	//srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // hush
 
-	return srv, func(network, addr string, config *tls.Config) (conn *tls.Conn, err error) {
+	return srv, func(ctx context.Context, network, addr string, config *tls.Config) (conn *tls.Conn, err error) {
 		return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
 	}
 }
@@ -1322,7 +1426,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -1352,7 +1456,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return nil, errors.New("force")
 					},
 				},
@@ -1414,7 +1518,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return tls.Client(&noopConn{}, config), nil
 					},
 				},
@@ -1444,7 +1548,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return tls.Client(&noopConn{}, config), nil
 					},
 				},
@@ -1480,7 +1584,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
 					},
 				},
@@ -1517,7 +1621,7 @@ func TestTLSALPN01Validate(t *testing.T) {
 			return test{
 				ch: ch,
 				vo: &ValidateChallengeOptions{
-					TLSDial: func(network, addr string, config *tls.Config) (*tls.Conn, error) {
+					TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
 						return tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", srv.Listener.Addr().String(), config)
 					},
 				},
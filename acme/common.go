@@ -2,9 +2,11 @@ package acme
 
 import (
 	"context"
+	"crypto"
 	"crypto/x509"
 	"time"
 
+	"github.com/smallstep/certificates/authority/keyattest"
 	"github.com/smallstep/certificates/authority/provisioner"
 )
 
@@ -14,15 +16,51 @@ type CertificateAuthority interface {
 	LoadProvisionerByName(string) (provisioner.Interface, error)
 }
 
-// Clock that returns time in UTC rounded to seconds.
-type Clock struct{}
+// ContextSigner is the interface implemented by a CA authority that can sign
+// a certificate with the context of the request, so the signature can be
+// interrupted by the sign timeout and timed by the request.
+type ContextSigner interface {
+	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+}
+
+// KeyAttestationVerifier is the interface implemented by a CA authority that
+// can verify the attestation of an ACME account key.
+type KeyAttestationVerifier interface {
+	VerifyKeyAttestation(stmt *keyattest.Statement, pub crypto.PublicKey) (*keyattest.Result, error)
+}
 
-// Now returns the UTC time rounded to seconds.
-func (c *Clock) Now() time.Time {
-	return time.Now().UTC().Truncate(time.Second)
+// LabelsValidator is the interface implemented by a CA authority that can
+// validate the labels an ACME account attaches to its certificates.
+type LabelsValidator interface {
+	ValidateCertificateLabels(labels map[string]string) error
 }
 
-var clock Clock
+// CertificateRevoker is the interface implemented by a CA authority that can
+// revoke the certificates replaced by a new one.
+type CertificateRevoker interface {
+	RevokeSuperseded(ctx context.Context, crt *x509.Certificate) error
+}
+
+// RevocationChecker is the interface implemented by a CA authority that can
+// check if a certificate has been revoked.
+type RevocationChecker interface {
+	IsRevoked(sn string) (bool, error)
+}
+
+type clockKey struct{}
+
+// NewClockContext returns a copy of the context with the clock used to set
+// and check the times of the orders, authorizations and challenges.
+func NewClockContext(ctx context.Context, c provisioner.Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// clockFromContext returns the clock in the context, or the system clock. The
+// times are in UTC rounded to seconds.
+func clockFromContext(ctx context.Context) provisioner.UTCClock {
+	c, _ := ctx.Value(clockKey{}).(provisioner.Clock)
+	return provisioner.UTCClock{Clock: c}
+}
 
 // Provisioner is an interface that implements a subset of the provisioner.Interface --
 // only those methods required by the ACME api/authority.
@@ -12,11 +12,23 @@ import (
 // account.
 var ErrNotFound = errors.New("not found")
 
+// ProvisionerUsage is the number of ACME resources created by a provisioner.
+type ProvisionerUsage struct {
+	ProvisionerID  string `json:"provisionerID"`
+	Accounts       int    `json:"accounts"`
+	Orders         int    `json:"orders"`
+	Authorizations int    `json:"authorizations"`
+}
+
 // DB is the DB interface expected by the step-ca ACME API.
+//
+// Accounts, orders and authorizations are partitioned by provisioner, an
+// account key registered with a provisioner is unknown to the others.
 type DB interface {
 	CreateAccount(ctx context.Context, acc *Account) error
 	GetAccount(ctx context.Context, id string) (*Account, error)
-	GetAccountByKeyID(ctx context.Context, kid string) (*Account, error)
+	GetAccountByKeyID(ctx context.Context, provisionerID, kid string) (*Account, error)
+	GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]string, error)
 	UpdateAccount(ctx context.Context, acc *Account) error
 
 	CreateNonce(ctx context.Context) (Nonce, error)
@@ -28,6 +40,8 @@ type DB interface {
 
 	CreateCertificate(ctx context.Context, cert *Certificate) error
 	GetCertificate(ctx context.Context, id string) (*Certificate, error)
+	GetCertificateBySerial(ctx context.Context, serial string) (*Certificate, error)
+	UpdateCertificate(ctx context.Context, cert *Certificate) error
 
 	CreateChallenge(ctx context.Context, ch *Challenge) error
 	GetChallenge(ctx context.Context, id, authzID string) (*Challenge, error)
@@ -37,6 +51,8 @@ type DB interface {
 	GetOrder(ctx context.Context, id string) (*Order, error)
 	GetOrdersByAccountID(ctx context.Context, accountID string) ([]string, error)
 	UpdateOrder(ctx context.Context, o *Order) error
+
+	GetProvisionerUsage(ctx context.Context, provisionerID string) (*ProvisionerUsage, error)
 }
 
 // MockDB is an implementation of the DB interface that should only be used as
@@ -44,9 +60,11 @@ type DB interface {
 type MockDB struct {
 	MockCreateAccount     func(ctx context.Context, acc *Account) error
 	MockGetAccount        func(ctx context.Context, id string) (*Account, error)
-	MockGetAccountByKeyID func(ctx context.Context, kid string) (*Account, error)
+	MockGetAccountByKeyID func(ctx context.Context, provisionerID, kid string) (*Account, error)
 	MockUpdateAccount     func(ctx context.Context, acc *Account) error
 
+	MockGetAccountsByProvisionerID func(ctx context.Context, provisionerID string) ([]string, error)
+
 	MockCreateNonce func(ctx context.Context) (Nonce, error)
 	MockDeleteNonce func(ctx context.Context, nonce Nonce) error
 
@@ -54,8 +72,10 @@ type MockDB struct {
 	MockGetAuthorization    func(ctx context.Context, id string) (*Authorization, error)
 	MockUpdateAuthorization func(ctx context.Context, az *Authorization) error
 
-	MockCreateCertificate func(ctx context.Context, cert *Certificate) error
-	MockGetCertificate    func(ctx context.Context, id string) (*Certificate, error)
+	MockCreateCertificate      func(ctx context.Context, cert *Certificate) error
+	MockGetCertificate         func(ctx context.Context, id string) (*Certificate, error)
+	MockGetCertificateBySerial func(ctx context.Context, serial string) (*Certificate, error)
+	MockUpdateCertificate      func(ctx context.Context, cert *Certificate) error
 
 	MockCreateChallenge func(ctx context.Context, ch *Challenge) error
 	MockGetChallenge    func(ctx context.Context, id, authzID string) (*Challenge, error)
@@ -66,6 +86,8 @@ type MockDB struct {
 	MockGetOrdersByAccountID func(ctx context.Context, accountID string) ([]string, error)
 	MockUpdateOrder          func(ctx context.Context, o *Order) error
 
+	MockGetProvisionerUsage func(ctx context.Context, provisionerID string) (*ProvisionerUsage, error)
+
 	MockRet1  interface{}
 	MockError error
 }
@@ -91,15 +113,25 @@ func (m *MockDB) GetAccount(ctx context.Context, id string) (*Account, error) {
 }
 
 // GetAccountByKeyID mock
-func (m *MockDB) GetAccountByKeyID(ctx context.Context, kid string) (*Account, error) {
+func (m *MockDB) GetAccountByKeyID(ctx context.Context, provisionerID, kid string) (*Account, error) {
 	if m.MockGetAccountByKeyID != nil {
-		return m.MockGetAccountByKeyID(ctx, kid)
+		return m.MockGetAccountByKeyID(ctx, provisionerID, kid)
 	} else if m.MockError != nil {
 		return nil, m.MockError
 	}
 	return m.MockRet1.(*Account), m.MockError
 }
 
+// GetAccountsByProvisionerID mock
+func (m *MockDB) GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]string, error) {
+	if m.MockGetAccountsByProvisionerID != nil {
+		return m.MockGetAccountsByProvisionerID(ctx, provisionerID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]string), m.MockError
+}
+
 // UpdateAccount mock
 func (m *MockDB) UpdateAccount(ctx context.Context, acc *Account) error {
 	if m.MockUpdateAccount != nil {
@@ -180,6 +212,26 @@ func (m *MockDB) GetCertificate(ctx context.Context, id string) (*Certificate, e
 	return m.MockRet1.(*Certificate), m.MockError
 }
 
+// GetCertificateBySerial mock
+func (m *MockDB) GetCertificateBySerial(ctx context.Context, serial string) (*Certificate, error) {
+	if m.MockGetCertificateBySerial != nil {
+		return m.MockGetCertificateBySerial(ctx, serial)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*Certificate), m.MockError
+}
+
+// UpdateCertificate mock
+func (m *MockDB) UpdateCertificate(ctx context.Context, cert *Certificate) error {
+	if m.MockUpdateCertificate != nil {
+		return m.MockUpdateCertificate(ctx, cert)
+	} else if m.MockError != nil {
+		return m.MockError
+	}
+	return m.MockError
+}
+
 // CreateChallenge mock
 func (m *MockDB) CreateChallenge(ctx context.Context, ch *Challenge) error {
 	if m.MockCreateChallenge != nil {
@@ -249,3 +301,13 @@ func (m *MockDB) GetOrdersByAccountID(ctx context.Context, accID string) ([]stri
 	}
 	return m.MockRet1.([]string), m.MockError
 }
+
+// GetProvisionerUsage mock
+func (m *MockDB) GetProvisionerUsage(ctx context.Context, provisionerID string) (*ProvisionerUsage, error) {
+	if m.MockGetProvisionerUsage != nil {
+		return m.MockGetProvisionerUsage(ctx, provisionerID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*ProvisionerUsage), m.MockError
+}
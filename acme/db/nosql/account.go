@@ -7,18 +7,24 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
 	nosqlDB "github.com/smallstep/nosql"
 	"go.step.sm/crypto/jose"
 )
 
 // dbAccount represents an ACME account.
 type dbAccount struct {
-	ID            string           `json:"id"`
-	Key           *jose.JSONWebKey `json:"key"`
-	Contact       []string         `json:"contact,omitempty"`
-	Status        acme.Status      `json:"status"`
-	CreatedAt     time.Time        `json:"createdAt"`
-	DeactivatedAt time.Time        `json:"deactivatedAt"`
+	ID                   string                                    `json:"id"`
+	ProvisionerID        string                                    `json:"provisionerID,omitempty"`
+	Key                  *jose.JSONWebKey                          `json:"key"`
+	Contact              []string                                  `json:"contact,omitempty"`
+	Status               acme.Status                               `json:"status"`
+	KeyAttestation       *provisioner.ACMEAccountKeyAttestation    `json:"keyAttestation,omitempty"`
+	ClientCertificate    *provisioner.ACMEAccountClientCertificate `json:"clientCertificate,omitempty"`
+	Labels               map[string]string                         `json:"labels,omitempty"`
+	ExternalAccountKeyID string                                    `json:"externalAccountKeyID,omitempty"`
+	CreatedAt            time.Time                                 `json:"createdAt"`
+	DeactivatedAt        time.Time                                 `json:"deactivatedAt"`
 }
 
 func (dba *dbAccount) clone() *dbAccount {
@@ -62,19 +68,68 @@ func (db *DB) GetAccount(ctx context.Context, id string) (*acme.Account, error)
 	}
 
 	return &acme.Account{
-		Status:  dbacc.Status,
-		Contact: dbacc.Contact,
-		Key:     dbacc.Key,
-		ID:      dbacc.ID,
+		Status:               dbacc.Status,
+		Contact:              dbacc.Contact,
+		Key:                  dbacc.Key,
+		ID:                   dbacc.ID,
+		ProvisionerID:        dbacc.ProvisionerID,
+		KeyAttestation:       dbacc.KeyAttestation,
+		ClientCertificate:    dbacc.ClientCertificate,
+		Labels:               dbacc.Labels,
+		ExternalAccountKeyID: dbacc.ExternalAccountKeyID,
 	}, nil
 }
 
-// GetAccountByKeyID retrieves an ACME account by KeyID (thumbprint of the Account Key -- JWK).
-func (db *DB) GetAccountByKeyID(ctx context.Context, kid string) (*acme.Account, error) {
+// GetAccountByKeyID retrieves the ACME account of a provisioner by KeyID
+// (thumbprint of the Account Key -- JWK).
+func (db *DB) GetAccountByKeyID(ctx context.Context, provisionerID, kid string) (*acme.Account, error) {
+	id, err := db.getAccountIDByKeyID(ctx, accountKeyID(provisionerID, kid))
+	switch {
+	case errors.Is(err, acme.ErrNotFound) && provisionerID != "":
+		return db.migrateAccount(ctx, provisionerID, kid)
+	case err != nil:
+		return nil, err
+	}
+	return db.GetAccount(ctx, id)
+}
+
+// migrateAccount moves an account created before the storage was partitioned
+// by provisioner to the given provisioner. The account belongs to the first
+// provisioner that uses it, the other provisioners will create a new account
+// for the same key.
+func (db *DB) migrateAccount(ctx context.Context, provisionerID, kid string) (*acme.Account, error) {
 	id, err := db.getAccountIDByKeyID(ctx, kid)
 	if err != nil {
 		return nil, err
 	}
+	old, err := db.getDBAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if old.ProvisionerID != "" {
+		return nil, acme.ErrNotFound
+	}
+
+	nu := old.clone()
+	nu.ProvisionerID = provisionerID
+	kidB := []byte(accountKeyID(provisionerID, kid))
+	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, kidB, nil, []byte(id))
+	switch {
+	case err != nil:
+		return nil, errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped:
+		return nil, errors.Errorf("key-id to account-id index already exists")
+	}
+	if err := db.save(ctx, id, nu, old, "account", accountTable); err != nil {
+		db.db.Del(accountByKeyIDTable, kidB)
+		return nil, err
+	}
+	if err := db.db.Del(accountByKeyIDTable, []byte(kid)); err != nil {
+		return nil, errors.Wrap(err, "error deleting keyID to accountID index")
+	}
+	if err := db.addProvisionerAccountID(ctx, provisionerID, id); err != nil {
+		return nil, err
+	}
 	return db.GetAccount(ctx, id)
 }
 
@@ -87,18 +142,23 @@ func (db *DB) CreateAccount(ctx context.Context, acc *acme.Account) error {
 	}
 
 	dba := &dbAccount{
-		ID:        acc.ID,
-		Key:       acc.Key,
-		Contact:   acc.Contact,
-		Status:    acc.Status,
-		CreatedAt: clock.Now(),
+		ID:                   acc.ID,
+		ProvisionerID:        acc.ProvisionerID,
+		Key:                  acc.Key,
+		Contact:              acc.Contact,
+		Status:               acc.Status,
+		KeyAttestation:       acc.KeyAttestation,
+		ClientCertificate:    acc.ClientCertificate,
+		Labels:               acc.Labels,
+		ExternalAccountKeyID: acc.ExternalAccountKeyID,
+		CreatedAt:            db.clock.Now(),
 	}
 
 	kid, err := acme.KeyToID(dba.Key)
 	if err != nil {
 		return err
 	}
-	kidB := []byte(kid)
+	kidB := []byte(accountKeyID(acc.ProvisionerID, kid))
 
 	// Set the jwkID -> acme account ID index
 	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, kidB, nil, []byte(acc.ID))
@@ -112,6 +172,9 @@ func (db *DB) CreateAccount(ctx context.Context, acc *acme.Account) error {
 			db.db.Del(accountByKeyIDTable, kidB)
 			return err
 		}
+		if acc.ProvisionerID != "" {
+			return db.addProvisionerAccountID(ctx, acc.ProvisionerID, acc.ID)
+		}
 		return nil
 	}
 }
@@ -129,7 +192,7 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 
 	// If the status has changed to 'deactivated', then set deactivatedAt timestamp.
 	if acc.Status == acme.StatusDeactivated && old.Status != acme.StatusDeactivated {
-		nu.DeactivatedAt = clock.Now()
+		nu.DeactivatedAt = db.clock.Now()
 	}
 
 	return db.save(ctx, old.ID, nu, old, "account", accountTable)
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/nosql"
 	nosqldb "github.com/smallstep/nosql/database"
@@ -246,6 +247,32 @@ func TestDB_GetAccount(t *testing.T) {
 				dbacc: dbacc,
 			}
 		},
+		"ok/key-attestation": func(t *testing.T) test {
+			now := clock.Now()
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			dbacc := &dbAccount{
+				ID:        accID,
+				Status:    acme.StatusValid,
+				CreatedAt: now,
+				Key:       jwk,
+				KeyAttestation: &provisioner.ACMEAccountKeyAttestation{
+					Format:       "yubikey",
+					SerialNumber: "12345678",
+					VerifiedAt:   now,
+				},
+			}
+			b, err := json.Marshal(dbacc)
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+				},
+				dbacc: dbacc,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -272,6 +299,7 @@ func TestDB_GetAccount(t *testing.T) {
 					assert.Equals(t, acc.Status, tc.dbacc.Status)
 					assert.Equals(t, acc.Contact, tc.dbacc.Contact)
 					assert.Equals(t, acc.Key.KeyID, tc.dbacc.Key.KeyID)
+					assert.Equals(t, acc.KeyAttestation, tc.dbacc.KeyAttestation)
 				}
 			}
 		})
@@ -282,10 +310,11 @@ func TestDB_GetAccountByKeyID(t *testing.T) {
 	accID := "accID"
 	kid := "kid"
 	type test struct {
-		db      nosql.DB
-		err     error
-		acmeErr *acme.Error
-		dbacc   *dbAccount
+		db            nosql.DB
+		provisionerID string
+		err           error
+		acmeErr       *acme.Error
+		dbacc         *dbAccount
 	}
 	var tests = map[string]func(t *testing.T) test{
 		"fail/db.getAccountIDByKeyID-error": func(t *testing.T) test {
@@ -354,12 +383,147 @@ func TestDB_GetAccountByKeyID(t *testing.T) {
 				dbacc: dbacc,
 			}
 		},
+		"ok/provisioner": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			dbacc := &dbAccount{
+				ID:            accID,
+				ProvisionerID: "provID",
+				Status:        acme.StatusValid,
+				CreatedAt:     clock.Now(),
+				Contact:       []string{"foo", "bar"},
+				Key:           jwk,
+			}
+			b, err := json.Marshal(dbacc)
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), "provID#kid")
+							return []byte(accID), nil
+						case string(accountTable):
+							assert.Equals(t, string(key), accID)
+							return b, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unrecognized bucket %s", string(bucket)))
+							return nil, errors.New("force")
+						}
+					},
+				},
+				provisionerID: "provID",
+				dbacc:         dbacc,
+			}
+		},
+		"ok/migrate": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			dbacc := &dbAccount{
+				ID:        accID,
+				Status:    acme.StatusValid,
+				CreatedAt: clock.Now(),
+				Contact:   []string{"foo", "bar"},
+				Key:       jwk,
+			}
+			b, err := json.Marshal(dbacc)
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							if string(key) == "provID#kid" {
+								return nil, nosqldb.ErrNotFound
+							}
+							assert.Equals(t, string(key), kid)
+							return []byte(accID), nil
+						case string(accountTable):
+							assert.Equals(t, string(key), accID)
+							return b, nil
+						case string(accountsByProvisionerIDTable):
+							assert.Equals(t, string(key), "provID")
+							return nil, nosqldb.ErrNotFound
+						default:
+							assert.FatalError(t, errors.Errorf("unrecognized bucket %s", string(bucket)))
+							return nil, errors.New("force")
+						}
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), "provID#kid")
+							assert.Equals(t, old, nil)
+							assert.Equals(t, string(nu), accID)
+						case string(accountTable):
+							assert.Equals(t, string(key), accID)
+							assert.Equals(t, old, b)
+							dbNew := new(dbAccount)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, dbNew.ProvisionerID, "provID")
+							b = nu
+						case string(accountsByProvisionerIDTable):
+							assert.Equals(t, string(key), "provID")
+							assert.Equals(t, old, nil)
+							assert.Equals(t, string(nu), `["accID"]`)
+						default:
+							assert.FatalError(t, errors.Errorf("unrecognized bucket %s", string(bucket)))
+						}
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, string(bucket), string(accountByKeyIDTable))
+						assert.Equals(t, string(key), kid)
+						return nil
+					},
+				},
+				provisionerID: "provID",
+				dbacc: &dbAccount{
+					ID:            accID,
+					ProvisionerID: "provID",
+					Status:        acme.StatusValid,
+					Contact:       []string{"foo", "bar"},
+					Key:           jwk,
+				},
+			}
+		},
+		"fail/migrate-other-provisioner": func(t *testing.T) test {
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			b, err := json.Marshal(&dbAccount{
+				ID:            accID,
+				ProvisionerID: "otherID",
+				Status:        acme.StatusValid,
+				Key:           jwk,
+			})
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							if string(key) == "provID#kid" {
+								return nil, nosqldb.ErrNotFound
+							}
+							return []byte(accID), nil
+						case string(accountTable):
+							return b, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unrecognized bucket %s", string(bucket)))
+							return nil, errors.New("force")
+						}
+					},
+				},
+				provisionerID: "provID",
+				err:           acme.ErrNotFound,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
 			db := DB{db: tc.db}
-			if acc, err := db.GetAccountByKeyID(context.Background(), kid); err != nil {
+			if acc, err := db.GetAccountByKeyID(context.Background(), tc.provisionerID, kid); err != nil {
 				switch k := err.(type) {
 				case *acme.Error:
 					if assert.NotNil(t, tc.acmeErr) {
@@ -377,6 +541,7 @@ func TestDB_GetAccountByKeyID(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					assert.Equals(t, acc.ID, tc.dbacc.ID)
+					assert.Equals(t, acc.ProvisionerID, tc.dbacc.ProvisionerID)
 					assert.Equals(t, acc.Status, tc.dbacc.Status)
 					assert.Equals(t, acc.Contact, tc.dbacc.Contact)
 					assert.Equals(t, acc.Key.KeyID, tc.dbacc.Key.KeyID)
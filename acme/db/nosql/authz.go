@@ -12,16 +12,17 @@ import (
 
 // dbAuthz is the base authz type that others build from.
 type dbAuthz struct {
-	ID           string          `json:"id"`
-	AccountID    string          `json:"accountID"`
-	Identifier   acme.Identifier `json:"identifier"`
-	Status       acme.Status     `json:"status"`
-	Token        string          `json:"token"`
-	ChallengeIDs []string        `json:"challengeIDs"`
-	Wildcard     bool            `json:"wildcard"`
-	CreatedAt    time.Time       `json:"createdAt"`
-	ExpiresAt    time.Time       `json:"expiresAt"`
-	Error        *acme.Error     `json:"error"`
+	ID            string          `json:"id"`
+	AccountID     string          `json:"accountID"`
+	ProvisionerID string          `json:"provisionerID,omitempty"`
+	Identifier    acme.Identifier `json:"identifier"`
+	Status        acme.Status     `json:"status"`
+	Token         string          `json:"token"`
+	ChallengeIDs  []string        `json:"challengeIDs"`
+	Wildcard      bool            `json:"wildcard"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	ExpiresAt     time.Time       `json:"expiresAt"`
+	Error         *acme.Error     `json:"error"`
 }
 
 func (ba *dbAuthz) clone() *dbAuthz {
@@ -61,15 +62,16 @@ func (db *DB) GetAuthorization(ctx context.Context, id string) (*acme.Authorizat
 		}
 	}
 	return &acme.Authorization{
-		ID:         dbaz.ID,
-		AccountID:  dbaz.AccountID,
-		Identifier: dbaz.Identifier,
-		Status:     dbaz.Status,
-		Challenges: chs,
-		Wildcard:   dbaz.Wildcard,
-		ExpiresAt:  dbaz.ExpiresAt,
-		Token:      dbaz.Token,
-		Error:      dbaz.Error,
+		ID:            dbaz.ID,
+		AccountID:     dbaz.AccountID,
+		ProvisionerID: dbaz.ProvisionerID,
+		Identifier:    dbaz.Identifier,
+		Status:        dbaz.Status,
+		Challenges:    chs,
+		Wildcard:      dbaz.Wildcard,
+		ExpiresAt:     dbaz.ExpiresAt,
+		Token:         dbaz.Token,
+		Error:         dbaz.Error,
 	}, nil
 }
 
@@ -87,20 +89,24 @@ func (db *DB) CreateAuthorization(ctx context.Context, az *acme.Authorization) e
 		chIDs[i] = ch.ID
 	}
 
-	now := clock.Now()
+	now := db.clock.Now()
 	dbaz := &dbAuthz{
-		ID:           az.ID,
-		AccountID:    az.AccountID,
-		Status:       az.Status,
-		CreatedAt:    now,
-		ExpiresAt:    az.ExpiresAt,
-		Identifier:   az.Identifier,
-		ChallengeIDs: chIDs,
-		Token:        az.Token,
-		Wildcard:     az.Wildcard,
+		ID:            az.ID,
+		AccountID:     az.AccountID,
+		ProvisionerID: az.ProvisionerID,
+		Status:        az.Status,
+		CreatedAt:     now,
+		ExpiresAt:     az.ExpiresAt,
+		Identifier:    az.Identifier,
+		ChallengeIDs:  chIDs,
+		Token:         az.Token,
+		Wildcard:      az.Wildcard,
 	}
 
-	return db.save(ctx, az.ID, dbaz, nil, "authz", authzTable)
+	if err := db.save(ctx, az.ID, dbaz, nil, "authz", authzTable); err != nil {
+		return err
+	}
+	return db.addProvisionerUsage(ctx, az.ProvisionerID, 0, 1)
 }
 
 // UpdateAuthorization saves an updated ACME Authorization to the database.
@@ -114,5 +120,9 @@ func (db *DB) UpdateAuthorization(ctx context.Context, az *acme.Authorization) e
 
 	nu.Status = az.Status
 	nu.Error = az.Error
+	// The expiration of a valid authorization is extended when it's reused.
+	if !az.ExpiresAt.IsZero() {
+		nu.ExpiresAt = az.ExpiresAt
+	}
 	return db.save(ctx, old.ID, nu, old, "authz", authzTable)
 }
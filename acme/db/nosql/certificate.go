@@ -19,6 +19,13 @@ type dbCert struct {
 	OrderID       string    `json:"orderID"`
 	Leaf          []byte    `json:"leaf"`
 	Intermediates []byte    `json:"intermediates"`
+	Replaces      string    `json:"replaces,omitempty"`
+	ReplacedBy    string    `json:"replacedBy,omitempty"`
+}
+
+func (c *dbCert) clone() *dbCert {
+	u := *c
+	return &u
 }
 
 // CreateCertificate creates and stores an ACME certificate type.
@@ -47,14 +54,25 @@ func (db *DB) CreateCertificate(ctx context.Context, cert *acme.Certificate) err
 		OrderID:       cert.OrderID,
 		Leaf:          leaf,
 		Intermediates: intermediates,
-		CreatedAt:     time.Now().UTC(),
+		Replaces:      cert.Replaces,
+		CreatedAt:     db.clock.Now(),
+	}
+	if err := db.save(ctx, cert.ID, dbch, nil, "certificate", certTable); err != nil {
+		return err
 	}
-	return db.save(ctx, cert.ID, dbch, nil, "certificate", certTable)
+
+	// Index the certificate by serial number, it is used to find the
+	// certificate replaced by an order.
+	serial := cert.Leaf.SerialNumber.String()
+	if err := db.db.Set(certBySerialTable, []byte(serial), []byte(cert.ID)); err != nil {
+		return errors.Wrapf(err, "error saving serial number index for certificate %s", cert.ID)
+	}
+	return nil
 }
 
-// GetCertificate retrieves and unmarshals an ACME certificate type from the
-// datastore.
-func (db *DB) GetCertificate(ctx context.Context, id string) (*acme.Certificate, error) {
+// getDBCertificate retrieves and unmarshals an ACME certificate type from the
+// database.
+func (db *DB) getDBCertificate(ctx context.Context, id string) (*dbCert, error) {
 	b, err := db.db.Get(certTable, []byte(id))
 	if nosql.IsErrNotFound(err) {
 		return nil, acme.NewError(acme.ErrorMalformedType, "certificate %s not found", id)
@@ -65,6 +83,16 @@ func (db *DB) GetCertificate(ctx context.Context, id string) (*acme.Certificate,
 	if err := json.Unmarshal(b, dbC); err != nil {
 		return nil, errors.Wrapf(err, "error unmarshaling certificate %s", id)
 	}
+	return dbC, nil
+}
+
+// GetCertificate retrieves and unmarshals an ACME certificate type from the
+// datastore.
+func (db *DB) GetCertificate(ctx context.Context, id string) (*acme.Certificate, error) {
+	dbC, err := db.getDBCertificate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
 	certs, err := parseBundle(append(dbC.Leaf, dbC.Intermediates...))
 	if err != nil {
@@ -77,9 +105,36 @@ func (db *DB) GetCertificate(ctx context.Context, id string) (*acme.Certificate,
 		OrderID:       dbC.OrderID,
 		Leaf:          certs[0],
 		Intermediates: certs[1:],
+		Replaces:      dbC.Replaces,
+		ReplacedBy:    dbC.ReplacedBy,
 	}, nil
 }
 
+// GetCertificateBySerial retrieves an ACME certificate using the serial number
+// of the leaf certificate, in decimal.
+func (db *DB) GetCertificateBySerial(ctx context.Context, serial string) (*acme.Certificate, error) {
+	id, err := db.db.Get(certBySerialTable, []byte(serial))
+	if nosql.IsErrNotFound(err) {
+		return nil, acme.NewError(acme.ErrorMalformedType, "certificate with serial %s not found", serial)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading certificate with serial %s", serial)
+	}
+	return db.GetCertificate(ctx, string(id))
+}
+
+// UpdateCertificate saves the certificate that replaces an ACME certificate.
+// The certificate chain cannot be updated.
+func (db *DB) UpdateCertificate(ctx context.Context, cert *acme.Certificate) error {
+	old, err := db.getDBCertificate(ctx, cert.ID)
+	if err != nil {
+		return err
+	}
+
+	nu := old.clone()
+	nu.ReplacedBy = cert.ReplacedBy
+	return db.save(ctx, old.ID, nu, old, "certificate", certTable)
+}
+
 func parseBundle(b []byte) ([]*x509.Certificate, error) {
 	var (
 		err    error
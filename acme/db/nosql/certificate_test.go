@@ -258,6 +258,116 @@ func TestDB_GetCertificate(t *testing.T) {
 	}
 }
 
+func TestDB_GetCertificateBySerial(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../../authority/testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	serial := leaf.SerialNumber.String()
+	b, err := json.Marshal(dbCert{
+		ID:         "certID",
+		AccountID:  "accountID",
+		OrderID:    "orderID",
+		Leaf:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+		ReplacedBy: "newCertID",
+		CreatedAt:  clock.Now(),
+	})
+	assert.FatalError(t, err)
+
+	type test struct {
+		db  nosql.DB
+		err string
+	}
+	var tests = map[string]test{
+		"fail/not-found": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, bucket, certBySerialTable)
+					return nil, nosqldb.ErrNotFound
+				},
+			},
+			err: "certificate with serial " + serial + " not found",
+		},
+		"fail/db.Get-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, errors.New("force")
+				},
+			},
+			err: "error loading certificate with serial " + serial + ": force",
+		},
+		"ok": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					switch string(bucket) {
+					case string(certBySerialTable):
+						assert.Equals(t, string(key), serial)
+						return []byte("certID"), nil
+					case string(certTable):
+						assert.Equals(t, string(key), "certID")
+						return b, nil
+					default:
+						return nil, errors.Errorf("unexpected bucket %s", bucket)
+					}
+				},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := DB{db: tc.db}
+			cert, err := db.GetCertificateBySerial(context.Background(), serial)
+			if err != nil {
+				if assert.NotEquals(t, "", tc.err) {
+					if ae, ok := err.(*acme.Error); ok {
+						assert.Equals(t, tc.err, ae.Err.Error())
+					} else {
+						assert.Equals(t, tc.err, err.Error())
+					}
+				}
+			} else if assert.Equals(t, "", tc.err) {
+				assert.Equals(t, "certID", cert.ID)
+				assert.Equals(t, "newCertID", cert.ReplacedBy)
+				assert.Equals(t, leaf, cert.Leaf)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateCertificate(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../../authority/testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	old := dbCert{
+		ID:        "certID",
+		AccountID: "accountID",
+		OrderID:   "orderID",
+		Leaf:      pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+		CreatedAt: clock.Now(),
+	}
+	b, err := json.Marshal(old)
+	assert.FatalError(t, err)
+
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, bucket, certTable)
+			assert.Equals(t, string(key), "certID")
+			return b, nil
+		},
+		MCmpAndSwap: func(bucket, key, oldB, nu []byte) ([]byte, bool, error) {
+			assert.Equals(t, bucket, certTable)
+			assert.Equals(t, oldB, b)
+
+			dbc := new(dbCert)
+			assert.FatalError(t, json.Unmarshal(nu, dbc))
+			assert.Equals(t, "newCertID", dbc.ReplacedBy)
+			assert.Equals(t, old.Leaf, dbc.Leaf)
+			return nu, true, nil
+		},
+	}}
+	assert.FatalError(t, d.UpdateCertificate(context.Background(), &acme.Certificate{
+		ID:         "certID",
+		ReplacedBy: "newCertID",
+	}))
+}
+
 func Test_parseBundle(t *testing.T) {
 	leaf, err := pemutil.ReadCertificate("../../../authority/testdata/certs/foo.crt")
 	assert.FatalError(t, err)
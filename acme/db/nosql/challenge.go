@@ -11,15 +11,16 @@ import (
 )
 
 type dbChallenge struct {
-	ID          string             `json:"id"`
-	AccountID   string             `json:"accountID"`
-	Type        acme.ChallengeType `json:"type"`
-	Status      acme.Status        `json:"status"`
-	Token       string             `json:"token"`
-	Value       string             `json:"value"`
-	ValidatedAt string             `json:"validatedAt"`
-	CreatedAt   time.Time          `json:"createdAt"`
-	Error       *acme.Error        `json:"error"`
+	ID          string                    `json:"id"`
+	AccountID   string                    `json:"accountID"`
+	Type        acme.ChallengeType        `json:"type"`
+	Status      acme.Status               `json:"status"`
+	Token       string                    `json:"token"`
+	Value       string                    `json:"value"`
+	ValidatedAt string                    `json:"validatedAt"`
+	CreatedAt   time.Time                 `json:"createdAt"`
+	Error       *acme.Error               `json:"error"`
+	Attempts    []*acme.ValidationAttempt `json:"attempts,omitempty"`
 }
 
 func (dbc *dbChallenge) clone() *dbChallenge {
@@ -57,7 +58,7 @@ func (db *DB) CreateChallenge(ctx context.Context, ch *acme.Challenge) error {
 		Value:     ch.Value,
 		Status:    acme.StatusPending,
 		Token:     ch.Token,
-		CreatedAt: clock.Now(),
+		CreatedAt: db.clock.Now(),
 		Type:      ch.Type,
 	}
 
@@ -81,6 +82,7 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 		Token:       dbch.Token,
 		Error:       dbch.Error,
 		ValidatedAt: dbch.ValidatedAt,
+		Attempts:    dbch.Attempts,
 	}
 	return ch, nil
 }
@@ -98,6 +100,7 @@ func (db *DB) UpdateChallenge(ctx context.Context, ch *acme.Challenge) error {
 	nu.Status = ch.Status
 	nu.Error = ch.Error
 	nu.ValidatedAt = ch.ValidatedAt
+	nu.Attempts = ch.Attempts
 
 	return db.save(ctx, old.ID, nu, old, "challenge", challengeTable)
 }
@@ -0,0 +1,188 @@
+package nosql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	nosqlDB "github.com/smallstep/nosql"
+)
+
+// externalAccountKeySize is the size in bytes of the HMAC keys used in the
+// external account bindings.
+const externalAccountKeySize = 32
+
+// dbExternalAccountKey represents an ACME external account binding key.
+type dbExternalAccountKey struct {
+	ID            string    `json:"id"`
+	ProvisionerID string    `json:"provisionerID"`
+	Reference     string    `json:"reference"`
+	AccountID     string    `json:"accountID,omitempty"`
+	KeyBytes      []byte    `json:"key"`
+	CreatedAt     time.Time `json:"createdAt"`
+	BoundAt       time.Time `json:"boundAt"`
+}
+
+func (dbeak *dbExternalAccountKey) clone() *dbExternalAccountKey {
+	u := *dbeak
+	return &u
+}
+
+func (dbeak *dbExternalAccountKey) toExternalAccountKey() *acme.ExternalAccountKey {
+	return &acme.ExternalAccountKey{
+		ID:            dbeak.ID,
+		ProvisionerID: dbeak.ProvisionerID,
+		Reference:     dbeak.Reference,
+		AccountID:     dbeak.AccountID,
+		KeyBytes:      dbeak.KeyBytes,
+		CreatedAt:     dbeak.CreatedAt,
+		BoundAt:       dbeak.BoundAt,
+	}
+}
+
+// externalAccountKeyReference returns the key used in the reference to key-id
+// index.
+func externalAccountKeyReference(provisionerID, reference string) []byte {
+	return []byte(provisionerID + "#" + reference)
+}
+
+// getDBExternalAccountKey retrieves and unmarshals an external account key of
+// the given provisioner.
+func (db *DB) getDBExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*dbExternalAccountKey, error) {
+	data, err := db.db.Get(externalAccountKeyTable, []byte(keyID))
+	switch {
+	case nosqlDB.IsErrNotFound(err):
+		return nil, acme.ErrNotFound
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading external account key %s", keyID)
+	}
+
+	dbeak := new(dbExternalAccountKey)
+	if err = json.Unmarshal(data, dbeak); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling external account key %s into dbExternalAccountKey", keyID)
+	}
+	if dbeak.ProvisionerID != provisionerID {
+		return nil, acme.ErrNotFound
+	}
+	return dbeak, nil
+}
+
+// CreateExternalAccountKey creates a new external account key of the given
+// provisioner with a random HMAC key. The reference is optional, but if it
+// is set it must be unique in the provisioner.
+// Implements the acme.ExternalAccountKeyDB interface.
+func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+	keyID, err := randID()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, externalAccountKeySize)
+	if _, err = rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "error generating external account key")
+	}
+
+	dbeak := &dbExternalAccountKey{
+		ID:            keyID,
+		ProvisionerID: provisionerID,
+		Reference:     reference,
+		KeyBytes:      key,
+		CreatedAt:     db.clock.Now(),
+	}
+
+	var refB []byte
+	if reference != "" {
+		refB = externalAccountKeyReference(provisionerID, reference)
+		_, swapped, err := db.db.CmpAndSwap(externalAccountKeyByReferenceTable, refB, nil, []byte(keyID))
+		switch {
+		case err != nil:
+			return nil, errors.Wrap(err, "error storing reference to external account key index")
+		case !swapped:
+			return nil, acme.NewError(acme.ErrorMalformedType,
+				"an external account key with reference '%s' already exists", reference)
+		}
+	}
+	if err := db.save(ctx, keyID, dbeak, nil, "external_account_key", externalAccountKeyTable); err != nil {
+		if refB != nil {
+			db.db.Del(externalAccountKeyByReferenceTable, refB)
+		}
+		return nil, err
+	}
+	return dbeak.toExternalAccountKey(), nil
+}
+
+// GetExternalAccountKey retrieves an external account key of the given
+// provisioner by its id.
+// Implements the acme.ExternalAccountKeyDB interface.
+func (db *DB) GetExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+	dbeak, err := db.getDBExternalAccountKey(ctx, provisionerID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return dbeak.toExternalAccountKey(), nil
+}
+
+// GetExternalAccountKeys retrieves the external account keys of the given
+// provisioner.
+// Implements the acme.ExternalAccountKeyDB interface.
+func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID string) ([]*acme.ExternalAccountKey, error) {
+	entries, err := db.db.List(externalAccountKeyTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing external account keys")
+	}
+	keys := []*acme.ExternalAccountKey{}
+	for _, entry := range entries {
+		dbeak := new(dbExternalAccountKey)
+		if err := json.Unmarshal(entry.Value, dbeak); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling external account key %s into dbExternalAccountKey", entry.Key)
+		}
+		if dbeak.ProvisionerID == provisionerID {
+			keys = append(keys, dbeak.toExternalAccountKey())
+		}
+	}
+	return keys, nil
+}
+
+// BindExternalAccountKey binds an external account key to an account. It
+// fails if the key is not bound to previousAccountID, or if it changes
+// while it is updated.
+// Implements the acme.ExternalAccountKeyDB interface.
+func (db *DB) BindExternalAccountKey(ctx context.Context, provisionerID, keyID, previousAccountID, accountID string) (*acme.ExternalAccountKey, error) {
+	old, err := db.getDBExternalAccountKey(ctx, provisionerID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if old.AccountID != previousAccountID {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType,
+			"external account key %s is bound to another account", keyID)
+	}
+
+	nu := old.clone()
+	nu.AccountID = accountID
+	nu.BoundAt = db.clock.Now()
+	if err := db.save(ctx, old.ID, nu, old, "external_account_key", externalAccountKeyTable); err != nil {
+		return nil, err
+	}
+	return nu.toExternalAccountKey(), nil
+}
+
+// DeleteExternalAccountKey deletes an external account key of the given
+// provisioner. The accounts bound to the key are not modified.
+// Implements the acme.ExternalAccountKeyDB interface.
+func (db *DB) DeleteExternalAccountKey(ctx context.Context, provisionerID, keyID string) error {
+	dbeak, err := db.getDBExternalAccountKey(ctx, provisionerID, keyID)
+	if err != nil {
+		return err
+	}
+	if err := db.db.Del(externalAccountKeyTable, []byte(keyID)); err != nil {
+		return errors.Wrapf(err, "error deleting external account key %s", keyID)
+	}
+	if dbeak.Reference != "" {
+		if err := db.db.Del(externalAccountKeyByReferenceTable, externalAccountKeyReference(provisionerID, dbeak.Reference)); err != nil {
+			return errors.Wrapf(err, "error deleting reference of external account key %s", keyID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package nosql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestDB_ExternalAccountKey(t *testing.T) {
+	ctx := context.Background()
+	d, err := New(db.NewMemoryDB())
+	assert.FatalError(t, err)
+
+	eak, err := d.CreateExternalAccountKey(ctx, "provID", "tenant-1")
+	assert.FatalError(t, err)
+	assert.Equals(t, "provID", eak.ProvisionerID)
+	assert.Equals(t, "tenant-1", eak.Reference)
+	assert.Len(t, externalAccountKeySize, eak.KeyBytes)
+	assert.False(t, eak.AlreadyBound())
+
+	// The references are unique in a provisioner
+	_, err = d.CreateExternalAccountKey(ctx, "provID", "tenant-1")
+	assert.Equals(t, err.(*acme.Error).Type, acme.NewError(acme.ErrorMalformedType, "").Type)
+	assert.HasPrefix(t, err.(*acme.Error).Err.Error(), "an external account key with reference 'tenant-1' already exists")
+	other, err := d.CreateExternalAccountKey(ctx, "otherID", "tenant-1")
+	assert.FatalError(t, err)
+	_, err = d.CreateExternalAccountKey(ctx, "provID", "")
+	assert.FatalError(t, err)
+
+	got, err := d.GetExternalAccountKey(ctx, "provID", eak.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, eak.KeyBytes, got.KeyBytes)
+	_, err = d.GetExternalAccountKey(ctx, "provID", other.ID)
+	assert.Equals(t, acme.ErrNotFound, err)
+	keys, err := d.GetExternalAccountKeys(ctx, "provID")
+	assert.FatalError(t, err)
+	assert.Len(t, 2, keys)
+
+	// A key is bound to an account only if it is still bound to the previous
+	// one
+	got, err = d.BindExternalAccountKey(ctx, "provID", eak.ID, "", "acc1")
+	assert.FatalError(t, err)
+	assert.Equals(t, "acc1", got.AccountID)
+	assert.False(t, got.BoundAt.IsZero())
+	_, err = d.BindExternalAccountKey(ctx, "provID", eak.ID, "", "acc2")
+	assert.Equals(t, err.(*acme.Error).Type, acme.NewError(acme.ErrorUnauthorizedType, "").Type)
+	assert.HasPrefix(t, err.(*acme.Error).Err.Error(), "external account key "+eak.ID+" is bound to another account")
+	got, err = d.BindExternalAccountKey(ctx, "provID", eak.ID, "acc1", "acc2")
+	assert.FatalError(t, err)
+	assert.Equals(t, "acc2", got.AccountID)
+
+	assert.Equals(t, acme.ErrNotFound, d.DeleteExternalAccountKey(ctx, "otherID", eak.ID))
+	assert.FatalError(t, d.DeleteExternalAccountKey(ctx, "provID", eak.ID))
+	_, err = d.GetExternalAccountKey(ctx, "provID", eak.ID)
+	assert.Equals(t, acme.ErrNotFound, err)
+	_, err = d.CreateExternalAccountKey(ctx, "provID", "tenant-1")
+	assert.FatalError(t, err)
+}
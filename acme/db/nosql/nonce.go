@@ -2,7 +2,14 @@ package nosql
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,7 +27,13 @@ type dbNonce struct {
 
 // CreateNonce creates, stores, and returns an ACME replay-nonce.
 // Implements the acme.DB interface.
+//
+// Stateless nonces, enabled with WithNonceKey, are not stored.
 func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
+	if db.nonces != nil {
+		return db.nonces.create(db.clock.Now())
+	}
+
 	_id, err := randID()
 	if err != nil {
 		return "", err
@@ -29,7 +42,7 @@ func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
 	id := base64.RawURLEncoding.EncodeToString([]byte(_id))
 	n := &dbNonce{
 		ID:        id,
-		CreatedAt: clock.Now(),
+		CreatedAt: db.clock.Now(),
 	}
 	if err = db.save(ctx, id, n, nil, "nonce", nonceTable); err != nil {
 		return "", err
@@ -39,7 +52,14 @@ func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
 
 // DeleteNonce verifies that the nonce is valid (by checking if it exists),
 // and if so, consumes the nonce resource by deleting it from the database.
+//
+// Stateless nonces are verified with the nonce key, and consumed by storing
+// them, so they cannot be used again.
 func (db *DB) DeleteNonce(ctx context.Context, nonce acme.Nonce) error {
+	if db.nonces != nil {
+		return db.consumeNonce(ctx, nonce)
+	}
+
 	err := db.db.Update(&database.Tx{
 		Operations: []*database.TxEntry{
 			{
@@ -64,3 +84,119 @@ func (db *DB) DeleteNonce(ctx context.Context, nonce acme.Nonce) error {
 		return nil
 	}
 }
+
+// consumeNonce verifies a stateless nonce and stores it, it fails if the nonce
+// has been used before.
+func (db *DB) consumeNonce(ctx context.Context, nonce acme.Nonce) error {
+	now := db.clock.Now()
+	createdAt, err := db.nonces.verify(string(nonce), now)
+	if err != nil {
+		return acme.WrapError(acme.ErrorBadNonceType, err, "nonce %s is not valid", string(nonce))
+	}
+
+	b, err := json.Marshal(&dbNonce{
+		ID:        string(nonce),
+		CreatedAt: createdAt,
+		DeletedAt: now,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling nonce %s", string(nonce))
+	}
+	_, swapped, err := db.db.CmpAndSwap(nonceTable, []byte(nonce), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error saving nonce %s", string(nonce))
+	case !swapped:
+		return acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", string(nonce))
+	}
+
+	if db.nonces.shouldPrune(now) {
+		go db.pruneNonces(now)
+	}
+	return nil
+}
+
+// pruneNonces deletes the stored nonces that have expired, the stateless
+// nonces older than the maximum age cannot be used anyway.
+func (db *DB) pruneNonces(now time.Time) {
+	entries, err := db.db.List(nonceTable)
+	if err != nil {
+		log.Printf("error listing acme nonces: %v", err)
+		return
+	}
+	expiry := now.Add(-db.nonces.maxAge)
+	for _, e := range entries {
+		n := new(dbNonce)
+		if err := json.Unmarshal(e.Value, n); err != nil || n.CreatedAt.After(expiry) {
+			continue
+		}
+		if err := db.db.Del(nonceTable, e.Key); err != nil {
+			log.Printf("error deleting acme nonce %s: %v", e.Key, err)
+		}
+	}
+}
+
+// Sizes of the parts of a stateless nonce.
+const (
+	nonceTimeSize   = 8
+	nonceRandomSize = 16
+	nonceMACSize    = 16
+	nonceSize       = nonceTimeSize + nonceRandomSize + nonceMACSize
+)
+
+// nonceSigner creates and verifies the stateless nonces. A nonce contains the
+// time it was created and a random value, authenticated with an HMAC-SHA256
+// of the key shared by the replicas of the CA.
+type nonceSigner struct {
+	key    []byte
+	maxAge time.Duration
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+// create returns a new nonce created at the given time.
+func (s *nonceSigner) create(now time.Time) (acme.Nonce, error) {
+	b := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(b, uint64(now.Unix()))
+	if _, err := rand.Read(b[nonceTimeSize : nonceTimeSize+nonceRandomSize]); err != nil {
+		return "", errors.Wrap(err, "error generating nonce")
+	}
+	copy(b[nonceTimeSize+nonceRandomSize:], s.mac(b[:nonceTimeSize+nonceRandomSize]))
+	return acme.Nonce(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+// verify checks the MAC and the age of the nonce, and returns the time it was
+// created.
+func (s *nonceSigner) verify(nonce string, now time.Time) (time.Time, error) {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != nonceSize {
+		return time.Time{}, errors.New("malformed nonce")
+	}
+	if !hmac.Equal(b[nonceTimeSize+nonceRandomSize:], s.mac(b[:nonceTimeSize+nonceRandomSize])) {
+		return time.Time{}, errors.New("invalid nonce signature")
+	}
+	createdAt := time.Unix(int64(binary.BigEndian.Uint64(b)), 0).UTC()
+	if createdAt.After(now.Add(time.Minute)) || now.Sub(createdAt) > s.maxAge {
+		return time.Time{}, errors.New("nonce has expired")
+	}
+	return createdAt, nil
+}
+
+// shouldPrune returns true on the first call, and then once every maximum
+// age, so the expired nonces are deleted in the background.
+func (s *nonceSigner) shouldPrune(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.prunedAt.IsZero() && now.Sub(s.prunedAt) < s.maxAge {
+		return false
+	}
+	s.prunedAt = now
+	return true
+}
+
+func (s *nonceSigner) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(data)
+	return h.Sum(nil)[:nonceMACSize]
+}
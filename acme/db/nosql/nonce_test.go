@@ -2,7 +2,9 @@ package nosql
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
@@ -166,3 +168,85 @@ func TestDB_DeleteNonce(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_statelessNonces(t *testing.T) {
+	var mu sync.Mutex
+	stored := make(map[string][]byte)
+	mdb := &db.MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equals(t, bucket, nonceTable)
+			assert.Equals(t, old, nil)
+			if v, ok := stored[string(key)]; ok {
+				return v, false, nil
+			}
+			stored[string(key)] = nu
+			return nu, true, nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var entries []*database.Entry
+			for k, v := range stored {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+		MDel: func(bucket, key []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(stored, string(key))
+			return nil
+		},
+	}
+	d := &DB{db: mdb}
+	WithNonceKey([]byte("secret-secret-secret-secret-secret"), time.Minute)(d)
+
+	// Nonces are not stored when they are created.
+	n1, err := d.CreateNonce(context.Background())
+	assert.FatalError(t, err)
+	n2, err := d.CreateNonce(context.Background())
+	assert.FatalError(t, err)
+	assert.NotEquals(t, n1, n2)
+	assert.Equals(t, 0, len(stored))
+
+	// Nonces can only be used once.
+	assert.FatalError(t, d.DeleteNonce(context.Background(), n1))
+	err = d.DeleteNonce(context.Background(), n1)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, err.(*acme.Error).Type, acme.NewError(acme.ErrorBadNonceType, "").Type)
+		assert.HasSuffix(t, err.(*acme.Error).Err.Error(), "has already been used")
+	}
+	assert.FatalError(t, d.DeleteNonce(context.Background(), n2))
+
+	// Nonces signed with other keys, modified or expired are not valid.
+	other := &nonceSigner{key: []byte("other-other-other-other-other-other"), maxAge: time.Minute}
+	n3, err := other.create(clock.Now())
+	assert.FatalError(t, err)
+	n4, err := d.nonces.create(clock.Now().Add(-2 * time.Minute))
+	assert.FatalError(t, err)
+	n5, err := d.nonces.create(clock.Now())
+	assert.FatalError(t, err)
+	b, err := base64.RawURLEncoding.DecodeString(string(n5))
+	assert.FatalError(t, err)
+	b[0] ^= 0xff
+	for _, n := range []acme.Nonce{"", "foo", n3, n4, acme.Nonce(base64.RawURLEncoding.EncodeToString(b))} {
+		err := d.DeleteNonce(context.Background(), n)
+		if assert.NotNil(t, err) {
+			assert.Equals(t, err.(*acme.Error).Type, acme.NewError(acme.ErrorBadNonceType, "").Type)
+		}
+	}
+
+	// The expired nonces are pruned.
+	mu.Lock()
+	stored["old"], err = json.Marshal(&dbNonce{ID: "old", CreatedAt: clock.Now().Add(-time.Hour)})
+	mu.Unlock()
+	assert.FatalError(t, err)
+	d.pruneNonces(clock.Now())
+	mu.Lock()
+	_, ok := stored["old"]
+	assert.False(t, ok)
+	assert.Equals(t, 2, len(stored))
+	mu.Unlock()
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
 	nosqlDB "github.com/smallstep/nosql"
 	"go.step.sm/crypto/randutil"
 )
@@ -19,24 +20,64 @@ var (
 	orderTable             = []byte("acme_orders")
 	ordersByAccountIDTable = []byte("acme_account_orders_index")
 	certTable              = []byte("acme_certs")
+	certBySerialTable      = []byte("acme_serial_certs_index")
+
+	accountsByProvisionerIDTable = []byte("acme_provisioner_accounts_index")
+	provisionerUsageTable        = []byte("acme_provisioner_usage")
+	validationTable              = []byte("acme_validations")
+
+	externalAccountKeyTable            = []byte("acme_external_account_keys")
+	externalAccountKeyByReferenceTable = []byte("acme_external_account_key_reference_index")
 )
 
 // DB is a struct that implements the AcmeDB interface.
 type DB struct {
-	db nosqlDB.DB
+	db     nosqlDB.DB
+	nonces *nonceSigner
+	clock  provisioner.UTCClock
+}
+
+// Option is the type of the options passed to New.
+type Option func(*DB)
+
+// WithNonceKey enables the stateless nonces. The nonces are signed with the
+// given key, instead of being stored when they are created, and they are only
+// stored when they are used, to prevent their replay. Nonces older than maxAge
+// are rejected. All the replicas of the CA must use the same key.
+func WithNonceKey(key []byte, maxAge time.Duration) Option {
+	return func(db *DB) {
+		db.nonces = &nonceSigner{
+			key:    key,
+			maxAge: maxAge,
+		}
+	}
+}
+
+// WithClock sets the clock used to set the times of the ACME objects. By
+// default the system clock is used.
+func WithClock(c provisioner.Clock) Option {
+	return func(db *DB) {
+		db.clock = provisioner.UTCClock{Clock: c}
+	}
 }
 
 // New configures and returns a new ACME DB backend implemented using a nosql DB.
-func New(db nosqlDB.DB) (*DB, error) {
+func New(db nosqlDB.DB, opts ...Option) (*DB, error) {
 	tables := [][]byte{accountTable, accountByKeyIDTable, authzTable,
-		challengeTable, nonceTable, orderTable, ordersByAccountIDTable, certTable}
+		challengeTable, nonceTable, orderTable, ordersByAccountIDTable, certTable,
+		certBySerialTable, accountsByProvisionerIDTable, provisionerUsageTable,
+		validationTable, externalAccountKeyTable, externalAccountKeyByReferenceTable}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
 			return nil, errors.Wrapf(err, "error creating table %s",
 				string(b))
 		}
 	}
-	return &DB{db}, nil
+	d := &DB{db: db}
+	for _, fn := range opts {
+		fn(d)
+	}
+	return d, nil
 }
 
 // save writes the new data to the database, overwriting the old data if it
@@ -84,13 +125,3 @@ func randID() (val string, err error) {
 	}
 	return val, nil
 }
-
-// Clock that returns time in UTC rounded to seconds.
-type Clock struct{}
-
-// Now returns the UTC time rounded to seconds.
-func (c *Clock) Now() time.Time {
-	return time.Now().UTC().Truncate(time.Second)
-}
-
-var clock = new(Clock)
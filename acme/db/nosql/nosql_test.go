@@ -3,13 +3,19 @@ package nosql
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/nosql"
 )
 
+// clock is the clock of the databases created in the tests, the zero value
+// of their clock field.
+var clock provisioner.UTCClock
+
 func TestNew(t *testing.T) {
 	type test struct {
 		db  nosql.DB
@@ -46,6 +52,17 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_withClock(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 999, time.UTC)
+	d, err := New(&db.MockNoSQLDB{
+		MCreateTable: func(bucket []byte) error {
+			return nil
+		},
+	}, WithClock(provisioner.NewFakeClock(now)))
+	assert.FatalError(t, err)
+	assert.Equals(t, d.clock.Now(), now.Truncate(time.Second))
+}
+
 type errorThrower string
 
 func (et errorThrower) MarshalJSON() ([]byte, error) {
@@ -15,18 +15,20 @@ import (
 var ordersByAccountMux sync.Mutex
 
 type dbOrder struct {
-	ID               string            `json:"id"`
-	AccountID        string            `json:"accountID"`
-	ProvisionerID    string            `json:"provisionerID"`
-	Identifiers      []acme.Identifier `json:"identifiers"`
-	AuthorizationIDs []string          `json:"authorizationIDs"`
-	Status           acme.Status       `json:"status"`
-	NotBefore        time.Time         `json:"notBefore,omitempty"`
-	NotAfter         time.Time         `json:"notAfter,omitempty"`
-	CreatedAt        time.Time         `json:"createdAt"`
-	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
-	CertificateID    string            `json:"certificate,omitempty"`
-	Error            *acme.Error       `json:"error,omitempty"`
+	ID               string                       `json:"id"`
+	AccountID        string                       `json:"accountID"`
+	ProvisionerID    string                       `json:"provisionerID"`
+	Identifiers      []acme.Identifier            `json:"identifiers"`
+	AuthorizationIDs []string                     `json:"authorizationIDs"`
+	Status           acme.Status                  `json:"status"`
+	NotBefore        time.Time                    `json:"notBefore,omitempty"`
+	NotAfter         time.Time                    `json:"notAfter,omitempty"`
+	CreatedAt        time.Time                    `json:"createdAt"`
+	ExpiresAt        time.Time                    `json:"expiresAt,omitempty"`
+	CertificateID    string                       `json:"certificate,omitempty"`
+	Replaces         string                       `json:"replaces,omitempty"`
+	Error            *acme.Error                  `json:"error,omitempty"`
+	Validations      []*acme.IdentifierValidation `json:"validations,omitempty"`
 }
 
 func (a *dbOrder) clone() *dbOrder {
@@ -67,7 +69,9 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 		NotBefore:        dbo.NotBefore,
 		NotAfter:         dbo.NotAfter,
 		AuthorizationIDs: dbo.AuthorizationIDs,
+		Replaces:         dbo.Replaces,
 		Error:            dbo.Error,
+		Validations:      dbo.Validations,
 	}
 
 	return o, nil
@@ -81,7 +85,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		return err
 	}
 
-	now := clock.Now()
+	now := db.clock.Now()
 	dbo := &dbOrder{
 		ID:               o.ID,
 		AccountID:        o.AccountID,
@@ -93,6 +97,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
 		AuthorizationIDs: o.AuthorizationIDs,
+		Replaces:         o.Replaces,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
 		return err
@@ -102,7 +107,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return db.addProvisionerUsage(ctx, o.ProvisionerID, 1, 0)
 }
 
 // UpdateOrder saves an updated ACME Order to the database.
@@ -117,6 +122,7 @@ func (db *DB) UpdateOrder(ctx context.Context, o *acme.Order) error {
 	nu.Status = o.Status
 	nu.Error = o.Error
 	nu.CertificateID = o.CertificateID
+	nu.Validations = o.Validations
 	return db.save(ctx, old.ID, nu, old, "order", orderTable)
 }
 
@@ -510,8 +510,14 @@ func TestDB_CreateOrder(t *testing.T) {
 			return test{
 				db: &db.MockNoSQLDB{
 					MGet: func(bucket, key []byte) ([]byte, error) {
-						assert.Equals(t, string(bucket), string(ordersByAccountIDTable))
-						assert.Equals(t, string(key), o.AccountID)
+						switch string(bucket) {
+						case string(ordersByAccountIDTable):
+							assert.Equals(t, string(key), o.AccountID)
+						case string(provisionerUsageTable):
+							assert.Equals(t, string(key), o.ProvisionerID)
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+						}
 						return nil, nosqldb.ErrNotFound
 					},
 					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
@@ -523,6 +529,11 @@ func TestDB_CreateOrder(t *testing.T) {
 							assert.Equals(t, old, nil)
 							assert.Equals(t, nu, b)
 							return nu, true, nil
+						case string(provisionerUsageTable):
+							assert.Equals(t, string(key), "provID")
+							assert.Equals(t, old, nil)
+							assert.Equals(t, string(nu), `{"provisionerID":"provID","orders":1,"authorizations":0}`)
+							return nu, true, nil
 						case string(orderTable):
 							*idptr = string(key)
 							assert.Equals(t, string(key), o.ID)
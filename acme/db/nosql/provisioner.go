@@ -0,0 +1,130 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+)
+
+// Mutex for locking the provisioner index and usage operations.
+var provisionerMux sync.Mutex
+
+// dbProvisionerUsage holds the counters of the orders and authorizations
+// created by a provisioner. The accounts are counted using the index of
+// accounts by provisioner.
+type dbProvisionerUsage struct {
+	ProvisionerID  string `json:"provisionerID"`
+	Orders         int    `json:"orders"`
+	Authorizations int    `json:"authorizations"`
+}
+
+// accountKeyID returns the key used in the key-id to account-id index. The
+// accounts of a provisioner are indexed by the provisioner id and the key
+// id. Accounts created without a provisioner, before the storage was
+// partitioned, are indexed only by the key id.
+func accountKeyID(provisionerID, kid string) string {
+	if provisionerID == "" {
+		return kid
+	}
+	return provisionerID + "#" + kid
+}
+
+func (db *DB) getProvisionerAccountIDs(ctx context.Context, provisionerID string) ([]string, error) {
+	b, err := db.db.Get(accountsByProvisionerIDTable, []byte(provisionerID))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return []string{}, nil
+		}
+		return nil, errors.Wrapf(err, "error loading accountIDs for provisioner %s", provisionerID)
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling accountIDs for provisioner %s", provisionerID)
+	}
+	return ids, nil
+}
+
+// addProvisionerAccountID adds the account to the index of accounts of the
+// provisioner.
+func (db *DB) addProvisionerAccountID(ctx context.Context, provisionerID, accID string) error {
+	provisionerMux.Lock()
+	defer provisionerMux.Unlock()
+
+	oldIDs, err := db.getProvisionerAccountIDs(ctx, provisionerID)
+	if err != nil {
+		return err
+	}
+	var old interface{}
+	if len(oldIDs) > 0 {
+		old = oldIDs
+	}
+	newIDs := append(append([]string{}, oldIDs...), accID)
+	return db.save(ctx, provisionerID, newIDs, old, "accountIDsByProvisionerID", accountsByProvisionerIDTable)
+}
+
+func (db *DB) getDBProvisionerUsage(ctx context.Context, provisionerID string) (*dbProvisionerUsage, bool, error) {
+	b, err := db.db.Get(provisionerUsageTable, []byte(provisionerID))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return &dbProvisionerUsage{ProvisionerID: provisionerID}, false, nil
+		}
+		return nil, false, errors.Wrapf(err, "error loading usage for provisioner %s", provisionerID)
+	}
+	u := new(dbProvisionerUsage)
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, false, errors.Wrapf(err, "error unmarshaling usage for provisioner %s", provisionerID)
+	}
+	return u, true, nil
+}
+
+// addProvisionerUsage increments the counters of orders and authorizations
+// of the provisioner.
+func (db *DB) addProvisionerUsage(ctx context.Context, provisionerID string, orders, authorizations int) error {
+	if provisionerID == "" {
+		return nil
+	}
+
+	provisionerMux.Lock()
+	defer provisionerMux.Unlock()
+
+	old, ok, err := db.getDBProvisionerUsage(ctx, provisionerID)
+	if err != nil {
+		return err
+	}
+	nu := *old
+	nu.Orders += orders
+	nu.Authorizations += authorizations
+	if ok {
+		return db.save(ctx, provisionerID, nu, old, "provisionerUsage", provisionerUsageTable)
+	}
+	return db.save(ctx, provisionerID, nu, nil, "provisionerUsage", provisionerUsageTable)
+}
+
+// GetAccountsByProvisionerID returns the list of account IDs created with the
+// given provisioner.
+func (db *DB) GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]string, error) {
+	return db.getProvisionerAccountIDs(ctx, provisionerID)
+}
+
+// GetProvisionerUsage returns the number of accounts, orders and
+// authorizations created with the given provisioner.
+func (db *DB) GetProvisionerUsage(ctx context.Context, provisionerID string) (*acme.ProvisionerUsage, error) {
+	ids, err := db.getProvisionerAccountIDs(ctx, provisionerID)
+	if err != nil {
+		return nil, err
+	}
+	u, _, err := db.getDBProvisionerUsage(ctx, provisionerID)
+	if err != nil {
+		return nil, err
+	}
+	return &acme.ProvisionerUsage{
+		ProvisionerID:  provisionerID,
+		Accounts:       len(ids),
+		Orders:         u.Orders,
+		Authorizations: u.Authorizations,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package nosql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	nosqldb "github.com/smallstep/nosql/database"
+)
+
+func Test_accountKeyID(t *testing.T) {
+	assert.Equals(t, "kid", accountKeyID("", "kid"))
+	assert.Equals(t, "acme/foo#kid", accountKeyID("acme/foo", "kid"))
+}
+
+func TestDB_addProvisionerAccountID(t *testing.T) {
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, string(bucket), string(accountsByProvisionerIDTable))
+						assert.Equals(t, string(key), "provID")
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading accountIDs for provisioner provID: force"),
+			}
+		},
+		"ok/new": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, nosqldb.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(bucket), string(accountsByProvisionerIDTable))
+						assert.Equals(t, string(key), "provID")
+						assert.Equals(t, old, nil)
+						assert.Equals(t, string(nu), `["accID"]`)
+						return nu, true, nil
+					},
+				},
+			}
+		},
+		"ok/append": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return []byte(`["foo"]`), nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(old), `["foo"]`)
+						assert.Equals(t, string(nu), `["foo","accID"]`)
+						return nu, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			db := DB{db: tc.db}
+			if err := db.addProvisionerAccountID(context.Background(), "provID", "accID"); err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
+func TestDB_addProvisionerUsage(t *testing.T) {
+	var saved []byte
+	db := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, string(bucket), string(provisionerUsageTable))
+			assert.Equals(t, string(key), "provID")
+			return []byte(`{"provisionerID":"provID","orders":1,"authorizations":2}`), nil
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			assert.Equals(t, string(old), `{"provisionerID":"provID","orders":1,"authorizations":2}`)
+			saved = nu
+			return nu, true, nil
+		},
+	}}
+	assert.FatalError(t, db.addProvisionerUsage(context.Background(), "provID", 1, 1))
+	assert.Equals(t, `{"provisionerID":"provID","orders":2,"authorizations":3}`, string(saved))
+
+	// Resources without a provisioner are not counted.
+	assert.FatalError(t, db.addProvisionerUsage(context.Background(), "", 1, 0))
+}
+
+func TestDB_GetProvisionerUsage(t *testing.T) {
+	db := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, string(key), "provID")
+			switch string(bucket) {
+			case string(accountsByProvisionerIDTable):
+				return []byte(`["foo","bar"]`), nil
+			case string(provisionerUsageTable):
+				return []byte(`{"provisionerID":"provID","orders":4,"authorizations":6}`), nil
+			default:
+				assert.FatalError(t, errors.Errorf("unrecognized bucket %s", string(bucket)))
+				return nil, errors.New("force")
+			}
+		},
+	}}
+	u, err := db.GetProvisionerUsage(context.Background(), "provID")
+	assert.FatalError(t, err)
+	assert.Equals(t, &acme.ProvisionerUsage{
+		ProvisionerID:  "provID",
+		Accounts:       2,
+		Orders:         4,
+		Authorizations: 6,
+	}, u)
+
+	ids, err := db.GetAccountsByProvisionerID(context.Background(), "provID")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"foo", "bar"}, ids)
+}
@@ -0,0 +1,108 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+)
+
+// validationKey returns the key of the validations of an identifier by an
+// account with a challenge type.
+func validationKey(accountID string, identifier acme.Identifier, typ acme.ChallengeType) []byte {
+	return []byte(accountID + "#" + string(identifier.Type) + "#" + identifier.Value + "#" + string(typ))
+}
+
+// StoreValidation stores a successful validation, replacing the previous one
+// of the same account, identifier and challenge type.
+// Implements the acme.ValidationCache interface.
+func (db *DB) StoreValidation(ctx context.Context, v *acme.CachedValidation) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling acme validation")
+	}
+	key := validationKey(v.AccountID, v.Identifier, v.ChallengeType)
+	if err := db.db.Set(validationTable, key, b); err != nil {
+		return errors.Wrapf(err, "error saving acme validation %s", key)
+	}
+	return nil
+}
+
+// GetValidation returns the last successful validation of an identifier by
+// an account with a challenge type.
+// Implements the acme.ValidationCache interface.
+func (db *DB) GetValidation(ctx context.Context, accountID string, identifier acme.Identifier, typ acme.ChallengeType) (*acme.CachedValidation, error) {
+	key := validationKey(accountID, identifier, typ)
+	b, err := db.db.Get(validationTable, key)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, acme.ErrNotFound
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading acme validation %s", key)
+	}
+	v := new(acme.CachedValidation)
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling acme validation %s", key)
+	}
+	return v, nil
+}
+
+// TransferValidations moves the validations of an account that have not
+// expired to another account, with their authorizations and challenges. The
+// expired validations are left to the old account.
+// Implements the acme.AccountRecoveryDB interface.
+func (db *DB) TransferValidations(ctx context.Context, fromAccountID, toAccountID string) error {
+	entries, err := db.db.List(validationTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing acme validations")
+	}
+	now := db.clock.Now()
+	for _, entry := range entries {
+		v := new(acme.CachedValidation)
+		if err := json.Unmarshal(entry.Value, v); err != nil {
+			return errors.Wrapf(err, "error unmarshaling acme validation %s", entry.Key)
+		}
+		if v.AccountID != fromAccountID || !now.Before(v.ExpiresAt) {
+			continue
+		}
+		if err := db.transferAuthorization(ctx, v.AuthorizationID, fromAccountID, toAccountID); err != nil {
+			return err
+		}
+		v.AccountID = toAccountID
+		if err := db.StoreValidation(ctx, v); err != nil {
+			return err
+		}
+		if err := db.db.Del(validationTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting acme validation %s", entry.Key)
+		}
+	}
+	return nil
+}
+
+// transferAuthorization moves an authorization and its challenges from one
+// account to another.
+func (db *DB) transferAuthorization(ctx context.Context, id, fromAccountID, toAccountID string) error {
+	old, err := db.getDBAuthz(ctx, id)
+	if err != nil {
+		return err
+	}
+	if old.AccountID != fromAccountID {
+		return nil
+	}
+	for _, chID := range old.ChallengeIDs {
+		oldch, err := db.getDBChallenge(ctx, chID)
+		if err != nil {
+			return err
+		}
+		nuch := oldch.clone()
+		nuch.AccountID = toAccountID
+		if err := db.save(ctx, oldch.ID, nuch, oldch, "challenge", challengeTable); err != nil {
+			return err
+		}
+	}
+	nu := old.clone()
+	nu.AccountID = toAccountID
+	return db.save(ctx, old.ID, nu, old, "authz", authzTable)
+}
@@ -0,0 +1,53 @@
+package nosql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestDB_Validation(t *testing.T) {
+	ctx := context.Background()
+	d, err := New(db.NewMemoryDB())
+	assert.FatalError(t, err)
+
+	now := clock.Now()
+	id := acme.Identifier{Type: acme.DNS, Value: "*.example.com"}
+	v := &acme.CachedValidation{
+		AccountID:       "accID",
+		Identifier:      id,
+		ChallengeType:   acme.DNS01,
+		AuthorizationID: "azID",
+		ValidatedAt:     now,
+		ExpiresAt:       now.Add(time.Hour),
+	}
+	assert.FatalError(t, d.StoreValidation(ctx, v))
+
+	got, err := d.GetValidation(ctx, "accID", id, acme.DNS01)
+	assert.FatalError(t, err)
+	assert.Equals(t, "azID", got.AuthorizationID)
+	assert.Equals(t, id, got.Identifier)
+	assert.True(t, got.ExpiresAt.Equal(v.ExpiresAt))
+
+	// Validations are kept per account, identifier and challenge type
+	_, err = d.GetValidation(ctx, "otherID", id, acme.DNS01)
+	assert.Equals(t, acme.ErrNotFound, err)
+	_, err = d.GetValidation(ctx, "accID", acme.Identifier{Type: acme.DNS, Value: "example.com"}, acme.DNS01)
+	assert.Equals(t, acme.ErrNotFound, err)
+	_, err = d.GetValidation(ctx, "accID", id, acme.HTTP01)
+	assert.Equals(t, acme.ErrNotFound, err)
+
+	d = &DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, string(bucket), string(validationTable))
+			return nil, errors.New("force")
+		},
+	}}
+	_, err = d.GetValidation(ctx, "accID", id, acme.DNS01)
+	assert.HasPrefix(t, err.Error(), "error loading acme validation")
+}
@@ -0,0 +1,287 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"go.step.sm/crypto/jose"
+)
+
+// maxEvidenceBodySize is the maximum number of bytes of an http-01 response
+// body included in a diagnosis.
+const maxEvidenceBodySize = 1024
+
+// ChallengeDiagnosis is the result of a validation dry run. It contains the
+// evidence gathered from the target identifier and the reason the validation
+// would fail, if any.
+type ChallengeDiagnosis struct {
+	Type       ChallengeType       `json:"type"`
+	Identifier string              `json:"identifier"`
+	Token      string              `json:"token"`
+	Valid      bool                `json:"valid"`
+	Error      *Error              `json:"error,omitempty"`
+	Evidence   *ValidationEvidence `json:"evidence"`
+}
+
+// ValidationEvidence contains the data received from the target identifier
+// during a validation dry run, and the values the CA expects.
+type ValidationEvidence struct {
+	ExpectedKeyAuthorization string `json:"expectedKeyAuthorization"`
+	ExpectedValue            string `json:"expectedValue,omitempty"`
+	// http-01
+	URL        string `json:"url,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Body       string `json:"body,omitempty"`
+	// dns-01
+	TXTName    string   `json:"txtName,omitempty"`
+	TXTRecords []string `json:"txtRecords,omitempty"`
+	// tls-alpn-01
+	Address            string                 `json:"address,omitempty"`
+	ServerName         string                 `json:"serverName,omitempty"`
+	TLSVersion         string                 `json:"tlsVersion,omitempty"`
+	NegotiatedProtocol string                 `json:"negotiatedProtocol,omitempty"`
+	Certificates       []*CertificateEvidence `json:"certificates,omitempty"`
+}
+
+// CertificateEvidence contains the relevant attributes of a certificate
+// presented in a tls-alpn-01 validation.
+type CertificateEvidence struct {
+	Subject     string   `json:"subject"`
+	DNSNames    []string `json:"dnsNames,omitempty"`
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+	Extensions  []string `json:"extensions,omitempty"`
+}
+
+// diagnoseDB is a DB used in validation dry runs. It only records the last
+// challenge update, the rest of the writes are ignored and the reads fail, so
+// a dry run never modifies the database.
+type diagnoseDB struct {
+	ch *Challenge
+}
+
+func errDiagnoseDB() error {
+	return NewErrorISE("the database is not available in a validation dry run")
+}
+
+func (db *diagnoseDB) CreateAccount(ctx context.Context, acc *Account) error {
+	return nil
+}
+
+func (db *diagnoseDB) GetAccount(ctx context.Context, id string) (*Account, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) GetAccountByKeyID(ctx context.Context, provisionerID, kid string) (*Account, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]string, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) UpdateAccount(ctx context.Context, acc *Account) error {
+	return nil
+}
+
+func (db *diagnoseDB) CreateNonce(ctx context.Context) (Nonce, error) {
+	return "", errDiagnoseDB()
+}
+
+func (db *diagnoseDB) DeleteNonce(ctx context.Context, nonce Nonce) error {
+	return nil
+}
+
+func (db *diagnoseDB) CreateAuthorization(ctx context.Context, az *Authorization) error {
+	return nil
+}
+
+func (db *diagnoseDB) GetAuthorization(ctx context.Context, id string) (*Authorization, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) UpdateAuthorization(ctx context.Context, az *Authorization) error {
+	return nil
+}
+
+func (db *diagnoseDB) CreateCertificate(ctx context.Context, cert *Certificate) error {
+	return nil
+}
+
+func (db *diagnoseDB) GetCertificate(ctx context.Context, id string) (*Certificate, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) GetCertificateBySerial(ctx context.Context, serial string) (*Certificate, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) UpdateCertificate(ctx context.Context, cert *Certificate) error {
+	return nil
+}
+
+func (db *diagnoseDB) CreateChallenge(ctx context.Context, ch *Challenge) error {
+	return nil
+}
+
+func (db *diagnoseDB) GetChallenge(ctx context.Context, id, authzID string) (*Challenge, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) UpdateChallenge(ctx context.Context, ch *Challenge) error {
+	db.ch = ch
+	return nil
+}
+
+func (db *diagnoseDB) CreateOrder(ctx context.Context, o *Order) error {
+	return nil
+}
+
+func (db *diagnoseDB) GetOrder(ctx context.Context, id string) (*Order, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) GetOrdersByAccountID(ctx context.Context, accountID string) ([]string, error) {
+	return nil, errDiagnoseDB()
+}
+
+func (db *diagnoseDB) UpdateOrder(ctx context.Context, o *Order) error {
+	return nil
+}
+
+func (db *diagnoseDB) GetProvisionerUsage(ctx context.Context, provisionerID string) (*ProvisionerUsage, error) {
+	return nil, errDiagnoseDB()
+}
+
+// Diagnose performs a validation dry run of the challenge. The validation is
+// done even if the challenge is no longer pending, and the result is not
+// stored, so it can be used to debug failed challenges.
+func (ch *Challenge) Diagnose(ctx context.Context, jwk *jose.JSONWebKey, vo *ValidateChallengeOptions) (*ChallengeDiagnosis, error) {
+	keyAuth, err := KeyAuthorization(ch.Token, jwk)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := &ValidationEvidence{
+		ExpectedKeyAuthorization: keyAuth,
+	}
+	h := sha256.Sum256([]byte(keyAuth))
+	switch ch.Type {
+	case HTTP01:
+		ev.ExpectedValue = keyAuth
+	case DNS01:
+		ev.ExpectedValue = base64.RawURLEncoding.EncodeToString(h[:])
+	case TLSALPN01:
+		ev.ExpectedValue = hex.EncodeToString(h[:])
+	}
+
+	// Validate a copy of the challenge so the original is not modified.
+	dch := *ch
+	dch.Status = StatusPending
+	dch.Error = nil
+	dch.ValidatedAt = ""
+
+	db := &diagnoseDB{}
+	if err := dch.Validate(ctx, db, jwk, diagnoseOptions(vo, ev)); err != nil {
+		return nil, err
+	}
+
+	d := &ChallengeDiagnosis{
+		Type:       ch.Type,
+		Identifier: ch.Value,
+		Token:      ch.Token,
+		Evidence:   ev,
+	}
+	if db.ch != nil {
+		d.Valid = db.ch.Status == StatusValid
+		d.Error = db.ch.Error
+	}
+	return d, nil
+}
+
+// diagnoseOptions wraps the given validator functions to record the evidence
+// gathered during the validation.
+func diagnoseOptions(vo *ValidateChallengeOptions, ev *ValidationEvidence) *ValidateChallengeOptions {
+	return &ValidateChallengeOptions{
+		DNSUpdater: vo.DNSUpdater,
+		HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+			ev.URL = url
+			resp, err := vo.HTTPGet(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			ev.StatusCode = resp.StatusCode
+			if len(body) > maxEvidenceBodySize {
+				ev.Body = string(body[:maxEvidenceBodySize])
+			} else {
+				ev.Body = string(body)
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		},
+		LookupTxt: func(ctx context.Context, name string) ([]string, error) {
+			ev.TXTName = name
+			records, err := vo.LookupTxt(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			ev.TXTRecords = records
+			return records, nil
+		},
+		TLSDial: func(ctx context.Context, network, addr string, config *tls.Config) (*tls.Conn, error) {
+			ev.Address = addr
+			ev.ServerName = config.ServerName
+			conn, err := vo.TLSDial(ctx, network, addr, config)
+			if err != nil {
+				return nil, err
+			}
+			cs := conn.ConnectionState()
+			ev.TLSVersion = tlsVersionName(cs.Version)
+			ev.NegotiatedProtocol = cs.NegotiatedProtocol
+			for _, crt := range cs.PeerCertificates {
+				ce := &CertificateEvidence{
+					Subject:  crt.Subject.String(),
+					DNSNames: crt.DNSNames,
+				}
+				for _, ip := range crt.IPAddresses {
+					ce.IPAddresses = append(ce.IPAddresses, ip.String())
+				}
+				for _, ext := range crt.Extensions {
+					s := ext.Id.String()
+					if ext.Critical {
+						s += " (critical)"
+					}
+					ce.Extensions = append(ce.Extensions, s)
+				}
+				ev.Certificates = append(ev.Certificates, ce)
+			}
+			return conn, nil
+		},
+	}
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04x", v)
+	}
+}
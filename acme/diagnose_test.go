@@ -0,0 +1,172 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+)
+
+func TestChallenge_Diagnose(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	assert.FatalError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+
+	type test struct {
+		ch        *Challenge
+		vo        *ValidateChallengeOptions
+		valid     bool
+		errType   ProblemType
+		checkEvid func(t *testing.T, ev *ValidationEvidence)
+	}
+	tests := map[string]func(t *testing.T) test{
+		"ok/http-01": func(t *testing.T) test {
+			return test{
+				ch: &Challenge{ID: "chID", Type: HTTP01, Token: "token", Value: "zap.internal", Status: StatusInvalid},
+				vo: &ValidateChallengeOptions{
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+						return &http.Response{
+							StatusCode: 200,
+							Body:       ioutil.NopCloser(bytes.NewBufferString(keyAuth)),
+						}, nil
+					},
+				},
+				valid: true,
+				checkEvid: func(t *testing.T, ev *ValidationEvidence) {
+					assert.Equals(t, ev.URL, "http://zap.internal/.well-known/acme-challenge/token")
+					assert.Equals(t, ev.StatusCode, 200)
+					assert.Equals(t, ev.Body, keyAuth)
+					assert.Equals(t, ev.ExpectedValue, keyAuth)
+				},
+			}
+		},
+		"ok/http-01-status-code": func(t *testing.T) test {
+			return test{
+				ch: &Challenge{ID: "chID", Type: HTTP01, Token: "token", Value: "zap.internal", Status: StatusPending},
+				vo: &ValidateChallengeOptions{
+					HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+						return &http.Response{
+							StatusCode: 404,
+							Body:       ioutil.NopCloser(bytes.NewBufferString("not found")),
+						}, nil
+					},
+				},
+				errType: ErrorConnectionType,
+				checkEvid: func(t *testing.T, ev *ValidationEvidence) {
+					assert.Equals(t, ev.StatusCode, 404)
+					assert.Equals(t, ev.Body, "not found")
+				},
+			}
+		},
+		"ok/dns-01-mismatch": func(t *testing.T) test {
+			return test{
+				ch: &Challenge{ID: "chID", Type: DNS01, Token: "token", Value: "*.zap.internal", Status: StatusPending},
+				vo: &ValidateChallengeOptions{
+					LookupTxt: func(ctx context.Context, name string) ([]string, error) {
+						return []string{"foo", "bar"}, nil
+					},
+				},
+				errType: ErrorRejectedIdentifierType,
+				checkEvid: func(t *testing.T, ev *ValidationEvidence) {
+					assert.Equals(t, ev.TXTName, "_acme-challenge.zap.internal")
+					assert.Equals(t, ev.TXTRecords, []string{"foo", "bar"})
+					assert.Equals(t, ev.ExpectedValue, base64.RawURLEncoding.EncodeToString(h[:]))
+				},
+			}
+		},
+		"ok/dns-01-lookup-error": func(t *testing.T) test {
+			return test{
+				ch: &Challenge{ID: "chID", Type: DNS01, Token: "token", Value: "zap.internal", Status: StatusPending},
+				vo: &ValidateChallengeOptions{
+					LookupTxt: func(ctx context.Context, name string) ([]string, error) {
+						return nil, errors.New("force")
+					},
+				},
+				errType: ErrorDNSType,
+				checkEvid: func(t *testing.T, ev *ValidationEvidence) {
+					assert.Equals(t, ev.TXTName, "_acme-challenge.zap.internal")
+					assert.Equals(t, len(ev.TXTRecords), 0)
+				},
+			}
+		},
+		"ok/tls-alpn-01": func(t *testing.T) test {
+			cert, err := newTLSALPNValidationCert(h[:], false, true, "zap.internal")
+			assert.FatalError(t, err)
+			srv, tlsDial := newTestTLSALPNServer(cert)
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			return test{
+				ch: &Challenge{ID: "chID", Type: TLSALPN01, Token: "token", Value: "zap.internal", Status: StatusValid},
+				vo: &ValidateChallengeOptions{
+					TLSDial: tlsDial,
+				},
+				valid: true,
+				checkEvid: func(t *testing.T, ev *ValidationEvidence) {
+					assert.Equals(t, ev.Address, "zap.internal:443")
+					assert.Equals(t, ev.ServerName, "zap.internal")
+					assert.Equals(t, ev.NegotiatedProtocol, "acme-tls/1")
+					assert.Equals(t, ev.ExpectedValue, hex.EncodeToString(h[:]))
+					assert.Equals(t, len(ev.Certificates), 1)
+					assert.Equals(t, ev.Certificates[0].DNSNames, []string{"zap.internal"})
+					var found bool
+					for _, ext := range ev.Certificates[0].Extensions {
+						if ext == "1.3.6.1.5.5.7.1.31 (critical)" {
+							found = true
+						}
+					}
+					assert.True(t, found)
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := run(t)
+			status := tc.ch.Status
+			d, err := tc.ch.Diagnose(context.Background(), jwk, tc.vo)
+			assert.FatalError(t, err)
+
+			// The challenge must not be modified.
+			assert.Equals(t, tc.ch.Status, status)
+			assert.Nil(t, tc.ch.Error)
+
+			assert.Equals(t, d.Type, tc.ch.Type)
+			assert.Equals(t, d.Identifier, tc.ch.Value)
+			assert.Equals(t, d.Valid, tc.valid)
+			if tc.valid {
+				assert.Nil(t, d.Error)
+			} else if assert.NotNil(t, d.Error) {
+				assert.Equals(t, d.Error.Type, NewError(tc.errType, "").Type)
+			}
+			assert.Equals(t, d.Evidence.ExpectedKeyAuthorization, keyAuth)
+			tc.checkEvid(t, d.Evidence)
+		})
+	}
+}
+
+func TestDiagnoseDB(t *testing.T) {
+	// The writes are ignored, except the challenge updates, and the reads fail.
+	var db DB = &diagnoseDB{}
+	ctx := context.Background()
+	assert.FatalError(t, db.UpdateOrder(ctx, &Order{ID: "orderID"}))
+	assert.FatalError(t, db.UpdateAuthorization(ctx, &Authorization{ID: "azID"}))
+	_, err := db.GetChallenge(ctx, "chID", "azID")
+	assert.NotNil(t, err)
+	_, err = db.GetOrder(ctx, "orderID")
+	assert.NotNil(t, err)
+
+	ch := &Challenge{ID: "chID", Status: StatusValid}
+	assert.FatalError(t, db.UpdateChallenge(ctx, ch))
+	assert.Equals(t, ch, db.(*diagnoseDB).ch)
+}
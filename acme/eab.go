@@ -0,0 +1,52 @@
+package acme
+
+import (
+	"context"
+	"time"
+)
+
+// ExternalAccountKey is an external account binding (EAB) key of an ACME
+// provisioner. The key is bound to the first account created with it, and it
+// can be bound again to a new account if the provisioner allows the recovery
+// of the accounts.
+type ExternalAccountKey struct {
+	ID            string    `json:"id"`
+	ProvisionerID string    `json:"provisionerID"`
+	Reference     string    `json:"reference,omitempty"`
+	AccountID     string    `json:"accountID,omitempty"`
+	KeyBytes      []byte    `json:"-"`
+	CreatedAt     time.Time `json:"createdAt"`
+	BoundAt       time.Time `json:"boundAt"`
+}
+
+// AlreadyBound returns true if the key is bound to an account.
+func (eak *ExternalAccountKey) AlreadyBound() bool {
+	return eak.AccountID != ""
+}
+
+// ExternalAccountKeyDB is the interface implemented by the databases that can
+// store the external account binding keys. The keys are partitioned by
+// provisioner, and the reference of a key is unique in its provisioner.
+// GetExternalAccountKey returns ErrNotFound if the key does not exist.
+//
+// BindExternalAccountKey binds the key to an account if it is still bound to
+// previousAccountID, an empty previousAccountID requires a key that is not
+// bound, so two accounts cannot be bound to the key at the same time.
+type ExternalAccountKeyDB interface {
+	CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
+	GetExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
+	GetExternalAccountKeys(ctx context.Context, provisionerID string) ([]*ExternalAccountKey, error)
+	BindExternalAccountKey(ctx context.Context, provisionerID, keyID, previousAccountID, accountID string) (*ExternalAccountKey, error)
+	DeleteExternalAccountKey(ctx context.Context, provisionerID, keyID string) error
+}
+
+// AccountRecoveryDB is the interface implemented by the databases that can
+// move the state of an account to another one. It is used when a client that
+// lost its account key binds a new account to the same external account
+// binding key.
+type AccountRecoveryDB interface {
+	// TransferValidations moves the cached validations that have not expired,
+	// and their authorizations, from one account to another, so the new
+	// account reuses them instead of validating the identifiers again.
+	TransferValidations(ctx context.Context, fromAccountID, toAccountID string) error
+}
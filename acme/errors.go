@@ -66,6 +66,8 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorAlreadyReplacedType request specified a certificate to be replaced that has already been replaced
+	ErrorAlreadyReplacedType
 )
 
 // String returns the string representation of the acme problem type,
@@ -120,6 +122,8 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorAlreadyReplacedType:
+		return "alreadyReplaced"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -260,18 +264,25 @@ var (
 			details: "Visit the “instance” URL and take actions specified there",
 			status:  400,
 		},
+		ErrorAlreadyReplacedType: {
+			typ:     officialACMEPrefix + ErrorAlreadyReplacedType.String(),
+			details: "The request specified a certificate to be replaced that has already been replaced",
+			status:  409,
+		},
 		ErrorServerInternalType: errorServerInternalMetadata,
 	}
 )
 
 // Error represents an ACME
 type Error struct {
-	Type        string        `json:"type"`
-	Detail      string        `json:"detail"`
-	Subproblems []interface{} `json:"subproblems,omitempty"`
-	Identifier  interface{}   `json:"identifier,omitempty"`
-	Err         error         `json:"-"`
-	Status      int           `json:"-"`
+	Type             string        `json:"type"`
+	Detail           string        `json:"detail"`
+	Subproblems      []interface{} `json:"subproblems,omitempty"`
+	Identifier       interface{}   `json:"identifier,omitempty"`
+	Code             string        `json:"code,omitempty"`
+	DocumentationURL string        `json:"documentationURL,omitempty"`
+	Err              error         `json:"-"`
+	Status           int           `json:"-"`
 }
 
 // NewError creates a new Error type.
@@ -283,19 +294,25 @@ func newError(pt ProblemType, err error) *Error {
 	meta, ok := errorMap[pt]
 	if !ok {
 		meta = errorServerInternalMetadata
+		code := ErrorServerInternalType.String()
 		return &Error{
-			Type:   meta.typ,
-			Detail: meta.details,
-			Status: meta.status,
-			Err:    err,
+			Type:             meta.typ,
+			Detail:           meta.details,
+			Code:             code,
+			DocumentationURL: errs.DocumentationURL(code),
+			Status:           meta.status,
+			Err:              err,
 		}
 	}
 
+	code := pt.String()
 	return &Error{
-		Type:   meta.typ,
-		Detail: meta.details,
-		Status: meta.status,
-		Err:    err,
+		Type:             meta.typ,
+		Detail:           meta.details,
+		Code:             code,
+		DocumentationURL: errs.DocumentationURL(code),
+		Status:           meta.status,
+		Err:              err,
 	}
 }
 
@@ -358,6 +375,11 @@ func WriteError(w http.ResponseWriter, err *Error) {
 	w.Header().Set("Content-Type", "application/problem+json")
 	w.WriteHeader(err.StatusCode())
 
+	// Use the message configured by the operator if any
+	if msg, ok := errs.Localize(w, err.Code); ok {
+		err.Detail = msg
+	}
+
 	// Write errors in the response writer
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		rl.WithFields(map[string]interface{}{
@@ -5,12 +5,16 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"log"
 	"net"
+	"net/http"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/x509util"
 )
 
@@ -29,20 +33,48 @@ type Identifier struct {
 
 // Order contains order metadata for the ACME protocol order type.
 type Order struct {
-	ID                string       `json:"id"`
-	AccountID         string       `json:"-"`
-	ProvisionerID     string       `json:"-"`
-	Status            Status       `json:"status"`
-	ExpiresAt         time.Time    `json:"expires"`
-	Identifiers       []Identifier `json:"identifiers"`
-	NotBefore         time.Time    `json:"notBefore"`
-	NotAfter          time.Time    `json:"notAfter"`
-	Error             *Error       `json:"error,omitempty"`
-	AuthorizationIDs  []string     `json:"-"`
-	AuthorizationURLs []string     `json:"authorizations"`
-	FinalizeURL       string       `json:"finalize"`
-	CertificateID     string       `json:"-"`
-	CertificateURL    string       `json:"certificate,omitempty"`
+	ID                string                  `json:"id"`
+	AccountID         string                  `json:"-"`
+	ProvisionerID     string                  `json:"-"`
+	Status            Status                  `json:"status"`
+	ExpiresAt         time.Time               `json:"expires"`
+	Identifiers       []Identifier            `json:"identifiers"`
+	NotBefore         time.Time               `json:"notBefore"`
+	NotAfter          time.Time               `json:"notAfter"`
+	Error             *Error                  `json:"error,omitempty"`
+	AuthorizationIDs  []string                `json:"-"`
+	AuthorizationURLs []string                `json:"authorizations"`
+	FinalizeURL       string                  `json:"finalize"`
+	CertificateID     string                  `json:"-"`
+	CertificateURL    string                  `json:"certificate,omitempty"`
+	Replaces          string                  `json:"replaces,omitempty"`
+	Validations       []*IdentifierValidation `json:"-"`
+}
+
+// IdentifierValidation is the challenge used to validate an identifier of an
+// order. It's recorded when the order becomes ready, and it's available in the
+// certificate templates on finalization. The identifier of a wildcard
+// authorization keeps the "*." prefix.
+type IdentifierValidation struct {
+	Identifier    Identifier    `json:"identifier"`
+	ChallengeType ChallengeType `json:"challengeType"`
+	ValidatedAt   string        `json:"validatedAt,omitempty"`
+}
+
+// newIdentifierValidation returns the validation of a valid authorization.
+func newIdentifierValidation(az *Authorization) *IdentifierValidation {
+	v := &IdentifierValidation{Identifier: az.Identifier}
+	if az.Wildcard {
+		v.Identifier.Value = "*." + v.Identifier.Value
+	}
+	for _, ch := range az.Challenges {
+		if ch.Status == StatusValid {
+			v.ChallengeType = ch.Type
+			v.ValidatedAt = ch.ValidatedAt
+			break
+		}
+	}
+	return v
 }
 
 // ToLog enables response logging.
@@ -57,7 +89,7 @@ func (o *Order) ToLog() (interface{}, error) {
 // UpdateStatus updates the ACME Order Status if necessary.
 // Changes to the order are saved using the database interface.
 func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
-	now := clock.Now()
+	now := clockFromContext(ctx).Now()
 
 	switch o.Status {
 	case StatusInvalid:
@@ -85,6 +117,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 			StatusInvalid: 0,
 			StatusPending: 0,
 		}
+		var validations []*IdentifierValidation
 		for _, azID := range o.AuthorizationIDs {
 			az, err := db.GetAuthorization(ctx, azID)
 			if err != nil {
@@ -95,6 +128,9 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 			}
 			st := az.Status
 			count[st]++
+			if st == StatusValid {
+				validations = append(validations, newIdentifierValidation(az))
+			}
 		}
 		switch {
 		case count[StatusInvalid] > 0:
@@ -107,6 +143,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 
 		case count[StatusValid] == len(o.AuthorizationIDs):
 			o.Status = StatusReady
+			o.Validations = validations
 
 		default:
 			return NewErrorISE("unexpected authz status")
@@ -149,30 +186,71 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		return err
 	}
 
-	// Get authorizations from the ACME provisioner.
+	// Get authorizations from the ACME provisioner. The order is sent in the
+	// context, so the provisioner creates the template, identity and
+	// validators like the provisioners used in the sign endpoint.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	order := o.provisionerOrder(csr, sans)
+	var labels map[string]string
+	if acc, ok := AccountFromContext(ctx); ok && acc.ID == o.AccountID {
+		order.AccountKeyAttestation = acc.KeyAttestation
+		order.Account = &provisioner.ACMEAccount{
+			ID:                   acc.ID,
+			Contact:              acc.Contact,
+			Labels:               acc.Labels,
+			ClientCertificate:    acc.ClientCertificate,
+			ExternalAccountKeyID: acc.ExternalAccountKeyID,
+		}
+		labels = acc.Labels
+	}
+	ctx = provisioner.NewContextWithACMEOrder(ctx, order)
 	signOps, err := p.AuthorizeSign(ctx, "")
 	if err != nil {
 		return WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
 	}
-
-	// Template data
-	data := x509util.NewTemplateData()
-	data.SetCommonName(csr.Subject.CommonName)
-	data.Set(x509util.SANsKey, sans)
-
-	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
-	if err != nil {
-		return WrapErrorISE(err, "error creating template options from ACME provisioner")
+	signOps = append(signOps, provisioner.AccountOption(o.AccountID))
+
+	// Renewals of a certificate issued to the account are exempt from the
+	// issuance quotas.
+	var replaced *Certificate
+	if o.Replaces != "" {
+		if replaced, err = GetReplacedCertificate(ctx, db, o.AccountID, o.Replaces); err != nil {
+			return err
+		}
+		signOps = append(signOps, provisioner.ReplacesOption(replaced.Leaf.SerialNumber.String()))
 	}
-	signOps = append(signOps, templateOptions)
 
 	// Sign a new certificate.
-	certChain, err := auth.Sign(csr, provisioner.SignOptions{
+	opts := provisioner.SignOptions{
 		NotBefore: provisioner.NewTimeDuration(o.NotBefore),
 		NotAfter:  provisioner.NewTimeDuration(o.NotAfter),
-	}, signOps...)
+		Labels:    labels,
+	}
+	var certChain []*x509.Certificate
+	if cs, ok := auth.(ContextSigner); ok {
+		certChain, err = cs.SignWithContext(ctx, csr, opts, signOps...)
+	} else {
+		certChain, err = auth.Sign(csr, opts, signOps...)
+	}
 	if err != nil {
+		// Report keys rejected by the provisioner key policy as bad CSRs.
+		if kpe, ok := errors.Cause(err).(*provisioner.KeyPolicyError); ok {
+			ae := WrapError(ErrorBadCSRType, err, "error signing certificate for order %s", o.ID)
+			ae.Detail = kpe.Error()
+			return ae
+		}
+		// Report exceeded issuance quotas as rate limits.
+		if sc, ok := err.(interface{ StatusCode() int }); ok && sc.StatusCode() == http.StatusTooManyRequests {
+			ae := WrapError(ErrorRateLimitedType, err, "error signing certificate for order %s", o.ID)
+			ae.Detail = err.Error()
+			return ae
+		}
+		// Report new certificates outside the change windows as unauthorized.
+		if ec, ok := err.(interface{ ErrorCode() string }); ok && ec.ErrorCode() == errs.CodeOutsideChangeWindow {
+			ae := WrapError(ErrorUnauthorizedType, err, "error signing certificate for order %s", o.ID)
+			ae.Detail = err.Error()
+			return ae
+		}
 		return WrapErrorISE(err, "error signing certificate for order %s", o.ID)
 	}
 
@@ -182,18 +260,73 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		Leaf:          certChain[0],
 		Intermediates: certChain[1:],
 	}
+	if replaced != nil {
+		cert.Replaces = replaced.ID
+	}
 	if err := db.CreateCertificate(ctx, cert); err != nil {
 		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
 	}
+	if replaced != nil {
+		replaced.ReplacedBy = cert.ID
+		if err := db.UpdateCertificate(ctx, replaced); err != nil {
+			return WrapErrorISE(err, "error updating certificate %s replaced by order %s", replaced.ID, o.ID)
+		}
+	}
 
 	o.CertificateID = cert.ID
 	o.Status = StatusValid
 	if err = db.UpdateOrder(ctx, o); err != nil {
 		return WrapErrorISE(err, "error updating order %s", o.ID)
 	}
+
+	// The new certificate is already issued, an error revoking the replaced
+	// certificate is only logged.
+	if replaced != nil && shouldRevokeReplaced(p) {
+		if r, ok := auth.(CertificateRevoker); ok {
+			if err := r.RevokeSuperseded(ctx, replaced.Leaf); err != nil {
+				log.Printf("error revoking certificate %s replaced by order %s: %v", replaced.Leaf.SerialNumber, o.ID, err)
+			}
+		}
+	}
 	return nil
 }
 
+// revokeReplacedProvisioner is implemented by the provisioners that can revoke
+// the certificates replaced by an order.
+type revokeReplacedProvisioner interface {
+	ShouldRevokeReplacedCertificates() bool
+}
+
+func shouldRevokeReplaced(p Provisioner) bool {
+	if rp, ok := p.(revokeReplacedProvisioner); ok {
+		return rp.ShouldRevokeReplacedCertificates()
+	}
+	return false
+}
+
+// provisionerOrder returns the order sent to the ACME provisioner with the
+// common name and the validated SANs of the certificate request.
+func (o *Order) provisionerOrder(csr *x509.CertificateRequest, sans []x509util.SubjectAlternativeName) *provisioner.ACMEOrder {
+	identifiers := make([]provisioner.ACMEIdentifier, len(o.Identifiers))
+	for i, id := range o.Identifiers {
+		identifiers[i] = provisioner.ACMEIdentifier{Type: string(id.Type), Value: id.Value}
+		for _, v := range o.Validations {
+			if v.Identifier == id {
+				identifiers[i].ValidationMethod = string(v.ChallengeType)
+				identifiers[i].ValidatedAt = v.ValidatedAt
+				break
+			}
+		}
+	}
+	return &provisioner.ACMEOrder{
+		ID:          o.ID,
+		AccountID:   o.AccountID,
+		Identifiers: identifiers,
+		CommonName:  csr.Subject.CommonName,
+		SANs:        sans,
+	}
+}
+
 func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativeName, error) {
 
 	var sans []x509util.SubjectAlternativeName
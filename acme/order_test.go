@@ -4,7 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/json"
+	"math/big"
 	"net"
 	"reflect"
 	"testing"
@@ -206,12 +206,22 @@ func TestOrder_UpdateStatus(t *testing.T) {
 				AuthorizationIDs: []string{"a", "b"},
 			}
 			az1 := &Authorization{
-				ID:     "a",
-				Status: StatusValid,
+				ID:         "a",
+				Status:     StatusValid,
+				Identifier: Identifier{Type: DNS, Value: "foo.internal"},
+				Challenges: []*Challenge{
+					{Type: DNS01, Status: StatusPending},
+					{Type: HTTP01, Status: StatusValid, ValidatedAt: "2021-06-01T10:00:00Z"},
+				},
 			}
 			az2 := &Authorization{
-				ID:     "b",
-				Status: StatusValid,
+				ID:         "b",
+				Status:     StatusValid,
+				Identifier: Identifier{Type: DNS, Value: "bar.internal"},
+				Wildcard:   true,
+				Challenges: []*Challenge{
+					{Type: DNS01, Status: StatusValid, ValidatedAt: "2021-06-01T10:01:00Z"},
+				},
 			}
 
 			return test{
@@ -222,6 +232,10 @@ func TestOrder_UpdateStatus(t *testing.T) {
 						assert.Equals(t, updo.AccountID, o.AccountID)
 						assert.Equals(t, updo.Status, StatusReady)
 						assert.Equals(t, updo.ExpiresAt, o.ExpiresAt)
+						assert.Equals(t, updo.Validations, []*IdentifierValidation{
+							{Identifier: Identifier{Type: DNS, Value: "foo.internal"}, ChallengeType: HTTP01, ValidatedAt: "2021-06-01T10:00:00Z"},
+							{Identifier: Identifier{Type: DNS, Value: "*.bar.internal"}, ChallengeType: DNS01, ValidatedAt: "2021-06-01T10:01:00Z"},
+						})
 						return nil
 					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
@@ -286,6 +300,24 @@ func (m *mockSignAuth) LoadProvisionerByName(name string) (provisioner.Interface
 	return m.ret1.(provisioner.Interface), m.err
 }
 
+type mockRevokeAuth struct {
+	*mockSignAuth
+	revoked *x509.Certificate
+}
+
+func (m *mockRevokeAuth) RevokeSuperseded(ctx context.Context, crt *x509.Certificate) error {
+	m.revoked = crt
+	return nil
+}
+
+type mockRevokeReplacedProvisioner struct {
+	*MockProvisioner
+}
+
+func (m *mockRevokeReplacedProvisioner) ShouldRevokeReplacedCertificates() bool {
+	return true
+}
+
 func TestOrder_Finalize(t *testing.T) {
 	type test struct {
 		o    *Order
@@ -294,6 +326,7 @@ func TestOrder_Finalize(t *testing.T) {
 		ca   CertificateAuthority
 		csr  *x509.CertificateRequest
 		prov Provisioner
+		ctx  context.Context
 	}
 	tests := map[string]func(t *testing.T) test{
 		"fail/invalid": func(t *testing.T) test {
@@ -399,7 +432,7 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewErrorISE("error retrieving authorization options from ACME provisioner: force"),
 			}
 		},
-		"fail/error-template-options": func(t *testing.T) test {
+		"fail/error-provisioner-order": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
 				ID:               "oID",
@@ -425,17 +458,25 @@ func TestOrder_Finalize(t *testing.T) {
 				prov: &MockProvisioner{
 					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
 						assert.Equals(t, token, "")
-						return nil, nil
-					},
-					MgetOptions: func() *provisioner.Options {
-						return &provisioner.Options{
-							X509: &provisioner.X509Options{
-								TemplateData: json.RawMessage([]byte("fo{o")),
+						order, ok := provisioner.ACMEOrderFromContext(ctx)
+						assert.Fatal(t, ok, "context does not contain the ACME order")
+						assert.Equals(t, &provisioner.ACMEOrder{
+							ID:        "oID",
+							AccountID: "accID",
+							Identifiers: []provisioner.ACMEIdentifier{
+								{Type: "dns", Value: "foo.internal"},
+								{Type: "dns", Value: "bar.internal"},
 							},
-						}
+							CommonName: "foo.internal",
+							SANs: []x509util.SubjectAlternativeName{
+								{Type: "dns", Value: "bar.internal"},
+								{Type: "dns", Value: "foo.internal"},
+							},
+						}, order)
+						return nil, errors.New("force")
 					},
 				},
-				err: NewErrorISE("error creating template options from ACME provisioner: error unmarshaling template data: invalid character 'o' in literal false (expecting 'a')"),
+				err: NewErrorISE("error retrieving authorization options from ACME provisioner: force"),
 			}
 		},
 		"fail/error-ca-sign": func(t *testing.T) test {
@@ -787,11 +828,180 @@ func TestOrder_Finalize(t *testing.T) {
 				},
 			}
 		},
+		"ok/account-key-attestation": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+			acc := &Account{
+				ID: "accID",
+				KeyAttestation: &provisioner.ACMEAccountKeyAttestation{
+					Format:       "yubikey",
+					SerialNumber: "12345678",
+					VerifiedAt:   now,
+				},
+			}
+
+			foo := &x509.Certificate{Subject: pkix.Name{CommonName: "foo"}}
+
+			return test{
+				o:   o,
+				csr: csr,
+				ctx: NewContextWithAccount(context.Background(), acc),
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						order, ok := provisioner.ACMEOrderFromContext(ctx)
+						if assert.True(t, ok) {
+							assert.Equals(t, order.AccountKeyAttestation, acc.KeyAttestation)
+						}
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					sign: func(_csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						return []*x509.Certificate{foo}, nil
+					},
+				},
+				db: &MockDB{
+					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+						cert.ID = "certID"
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.CertificateID, "certID")
+						return nil
+					},
+				},
+			}
+		},
+		"fail/replaces-already-replaced": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+				Replaces: "YWtp.Cg",
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						return nil, nil
+					},
+				},
+				db: &MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*Certificate, error) {
+						assert.Equals(t, "10", serial)
+						return &Certificate{
+							ID:         "oldCertID",
+							AccountID:  "accID",
+							Leaf:       &x509.Certificate{SerialNumber: big.NewInt(10), AuthorityKeyId: []byte("aki")},
+							ReplacedBy: "otherCertID",
+						}, nil
+					},
+				},
+				err: NewError(ErrorAlreadyReplacedType, "certificate YWtp.Cg has already been replaced"),
+			}
+		},
+		"ok/replaces": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+				Replaces: "YWtp.Cg",
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+			old := &x509.Certificate{SerialNumber: big.NewInt(10), AuthorityKeyId: []byte("aki")}
+			foo := &x509.Certificate{Subject: pkix.Name{CommonName: "foo"}}
+			ca := &mockRevokeAuth{
+				mockSignAuth: &mockSignAuth{
+					sign: func(_csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						assert.Equals(t, provisioner.ReplacesOption("10"), extraOpts[len(extraOpts)-1])
+						return []*x509.Certificate{foo}, nil
+					},
+				},
+			}
+			t.Cleanup(func() {
+				assert.Equals(t, old, ca.revoked)
+			})
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &mockRevokeReplacedProvisioner{
+					MockProvisioner: &MockProvisioner{
+						MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+							return nil, nil
+						},
+					},
+				},
+				ca: ca,
+				db: &MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*Certificate, error) {
+						assert.Equals(t, "10", serial)
+						return &Certificate{ID: "oldCertID", AccountID: "accID", Leaf: old}, nil
+					},
+					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+						assert.Equals(t, "oldCertID", cert.Replaces)
+						cert.ID = "certID"
+						return nil
+					},
+					MockUpdateCertificate: func(ctx context.Context, cert *Certificate) error {
+						assert.Equals(t, "oldCertID", cert.ID)
+						assert.Equals(t, "certID", cert.ReplacedBy)
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.CertificateID, "certID")
+						return nil
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := run(t)
-			if err := tc.o.Finalize(context.Background(), tc.db, tc.csr, tc.ca, tc.prov); err != nil {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if err := tc.o.Finalize(ctx, tc.db, tc.csr, tc.ca, tc.prov); err != nil {
 				if assert.NotNil(t, tc.err) {
 					switch k := err.(type) {
 					case *Error:
@@ -1399,3 +1609,29 @@ func TestOrder_sans(t *testing.T) {
 		})
 	}
 }
+
+func TestOrder_provisionerOrder(t *testing.T) {
+	o := &Order{
+		ID:        "oID",
+		AccountID: "accID",
+		Identifiers: []Identifier{
+			{Type: DNS, Value: "foo.internal"},
+			{Type: DNS, Value: "*.bar.internal"},
+			{Type: IP, Value: "10.0.0.1"},
+		},
+		Validations: []*IdentifierValidation{
+			{Identifier: Identifier{Type: DNS, Value: "*.bar.internal"}, ChallengeType: DNS01, ValidatedAt: "2021-06-01T10:01:00Z"},
+			{Identifier: Identifier{Type: DNS, Value: "foo.internal"}, ChallengeType: HTTP01, ValidatedAt: "2021-06-01T10:00:00Z"},
+		},
+	}
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo.internal"}}
+	order := o.provisionerOrder(csr, nil)
+	assert.Equals(t, "oID", order.ID)
+	assert.Equals(t, "accID", order.AccountID)
+	assert.Equals(t, "foo.internal", order.CommonName)
+	assert.Equals(t, []provisioner.ACMEIdentifier{
+		{Type: "dns", Value: "foo.internal", ValidationMethod: "http-01", ValidatedAt: "2021-06-01T10:00:00Z"},
+		{Type: "dns", Value: "*.bar.internal", ValidationMethod: "dns-01", ValidatedAt: "2021-06-01T10:01:00Z"},
+		{Type: "ip", Value: "10.0.0.1"},
+	}, order.Identifiers)
+}
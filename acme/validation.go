@@ -0,0 +1,161 @@
+package acme
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+)
+
+// DefaultValidationTimeout is the default maximum duration of a validation
+// attempt.
+var DefaultValidationTimeout = time.Minute
+
+// ValidationAttempt is the record of an attempt to validate a challenge.
+type ValidationAttempt struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Status     Status    `json:"status"`
+	Error      *Error    `json:"error,omitempty"`
+	Canceled   bool      `json:"canceled,omitempty"`
+}
+
+// ValidationManager runs the validations of the challenges. Each attempt is
+// tied to the request that started it and to the lifecycle of the server, so
+// it is canceled when the client disconnects, when it exceeds the timeout or
+// when the manager is closed. Only one attempt of a challenge runs at a time,
+// the attempts are recorded in the challenge, and a challenge that exceeds the
+// maximum number of attempts is marked as invalid.
+type ValidationManager struct {
+	timeout     time.Duration
+	maxAttempts int
+	mu          sync.Mutex
+	running     map[string]struct{}
+	closed      bool
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewValidationManager creates a new validation manager with the given timeout
+// of each attempt and the maximum number of attempts of a challenge. A zero
+// timeout uses DefaultValidationTimeout, and zero attempts does not limit
+// them.
+func NewValidationManager(timeout time.Duration, maxAttempts int) *ValidationManager {
+	if timeout <= 0 {
+		timeout = DefaultValidationTimeout
+	}
+	return &ValidationManager{
+		timeout:     timeout,
+		maxAttempts: maxAttempts,
+		running:     make(map[string]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Validate runs a validation attempt of the challenge and stores the result
+// and the record of the attempt using the DB interface. If an attempt of the
+// same challenge is already running, or the manager is closed, it returns
+// without starting a new one and the challenge remains pending. A nil manager
+// runs the validation without limits.
+func (m *ValidationManager) Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey, vo *ValidateChallengeOptions) error {
+	if m == nil {
+		return ch.Validate(ctx, db, jwk, vo)
+	}
+	if ch.Status != StatusPending || !m.start(ch.ID) {
+		return nil
+	}
+	defer m.finish(ch.ID)
+
+	if m.maxAttempts > 0 && len(ch.Attempts) >= m.maxAttempts {
+		return storeError(ctx, db, ch, true, NewError(ErrorRateLimitedType,
+			"challenge exceeded the maximum number of validation attempts (%d)", m.maxAttempts))
+	}
+
+	actx, cancel := m.attemptContext(ctx)
+	defer cancel()
+
+	attempt := &ValidationAttempt{StartedAt: clockFromContext(ctx).Now()}
+	ch.Attempts = append(ch.Attempts, attempt)
+	if err := ch.Validate(actx, db, jwk, vo); err != nil {
+		return err
+	}
+
+	attempt.FinishedAt = clockFromContext(ctx).Now()
+	attempt.Status = ch.Status
+	attempt.Error = ch.Error
+	attempt.Canceled = ch.Status == StatusPending && actx.Err() == context.Canceled
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
+
+// Diagnose runs a validation dry run of the challenge with the same limits of
+// a validation attempt. It fails if an attempt of the same challenge is
+// already running, or if the challenge has used all its attempts. A nil
+// manager runs the dry run without limits.
+func (m *ValidationManager) Diagnose(ctx context.Context, ch *Challenge, jwk *jose.JSONWebKey, vo *ValidateChallengeOptions) (*ChallengeDiagnosis, error) {
+	if m == nil {
+		return ch.Diagnose(ctx, jwk, vo)
+	}
+	if m.maxAttempts > 0 && len(ch.Attempts) >= m.maxAttempts {
+		return nil, NewError(ErrorRateLimitedType,
+			"challenge exceeded the maximum number of validation attempts (%d)", m.maxAttempts)
+	}
+	if !m.start(ch.ID) {
+		return nil, NewError(ErrorRateLimitedType,
+			"a validation of challenge '%s' is already running", ch.ID)
+	}
+	defer m.finish(ch.ID)
+
+	actx, cancel := m.attemptContext(ctx)
+	defer cancel()
+	return ch.Diagnose(actx, jwk, vo)
+}
+
+// attemptContext returns the context of an attempt, it is canceled after the
+// validation timeout or when the manager is closed.
+func (m *ValidationManager) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	actx, cancel := context.WithTimeout(ctx, m.timeout)
+	go func() {
+		select {
+		case <-m.done:
+			cancel()
+		case <-actx.Done():
+		}
+	}()
+	return actx, cancel
+}
+
+// Close cancels the running attempts and waits for them to finish. New
+// attempts are not started after the manager is closed.
+func (m *ValidationManager) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (m *ValidationManager) start(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.running[id]; ok || m.closed {
+		return false
+	}
+	m.running[id] = struct{}{}
+	m.wg.Add(1)
+	return true
+}
+
+func (m *ValidationManager) finish(id string) {
+	m.mu.Lock()
+	delete(m.running, id)
+	m.mu.Unlock()
+	m.wg.Done()
+}
@@ -0,0 +1,204 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+)
+
+func TestValidationManager_Validate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	assert.FatalError(t, err)
+
+	newChallenge := func() *Challenge {
+		return &Challenge{ID: "chID", Type: HTTP01, Status: StatusPending, Token: "token", Value: "example.com"}
+	}
+	var mu sync.Mutex
+	var updates int
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			mu.Lock()
+			updates++
+			mu.Unlock()
+			return nil
+		},
+	}
+	ok := &ValidateChallengeOptions{
+		HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(keyAuth)),
+			}, nil
+		},
+	}
+	started := make(chan struct{}, 1)
+	blocking := &ValidateChallengeOptions{
+		HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		m := NewValidationManager(0, 0)
+		ch := newChallenge()
+		assert.FatalError(t, m.Validate(context.Background(), ch, db, jwk, ok))
+		assert.Equals(t, StatusValid, ch.Status)
+		if assert.Len(t, 1, ch.Attempts) {
+			assert.Equals(t, StatusValid, ch.Attempts[0].Status)
+			assert.False(t, ch.Attempts[0].Canceled)
+		}
+	})
+
+	t.Run("ok nil manager", func(t *testing.T) {
+		var m *ValidationManager
+		ch := newChallenge()
+		assert.FatalError(t, m.Validate(context.Background(), ch, db, jwk, ok))
+		assert.Equals(t, StatusValid, ch.Status)
+		assert.Len(t, 0, ch.Attempts)
+	})
+
+	t.Run("ok canceled", func(t *testing.T) {
+		m := NewValidationManager(0, 0)
+		ch := newChallenge()
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		assert.FatalError(t, m.Validate(ctx, ch, db, jwk, blocking))
+		assert.Equals(t, StatusPending, ch.Status)
+		if assert.Len(t, 1, ch.Attempts) {
+			assert.True(t, ch.Attempts[0].Canceled)
+		}
+	})
+
+	t.Run("ok timeout", func(t *testing.T) {
+		m := NewValidationManager(10*time.Millisecond, 0)
+		ch := newChallenge()
+		go func() { <-started }()
+		assert.FatalError(t, m.Validate(context.Background(), ch, db, jwk, blocking))
+		assert.Equals(t, StatusPending, ch.Status)
+		if assert.Len(t, 1, ch.Attempts) {
+			assert.False(t, ch.Attempts[0].Canceled)
+			assert.NotNil(t, ch.Attempts[0].Error)
+		}
+	})
+
+	t.Run("ok closed", func(t *testing.T) {
+		m := NewValidationManager(0, 0)
+		ch := newChallenge()
+		done := make(chan error)
+		go func() {
+			done <- m.Validate(context.Background(), ch, db, jwk, blocking)
+		}()
+		<-started
+
+		// Concurrent attempts of the same challenge are not started.
+		other := newChallenge()
+		assert.FatalError(t, m.Validate(context.Background(), other, db, jwk, ok))
+		assert.Equals(t, StatusPending, other.Status)
+		assert.Len(t, 0, other.Attempts)
+
+		m.Close()
+		assert.FatalError(t, <-done)
+		if assert.Len(t, 1, ch.Attempts) {
+			assert.True(t, ch.Attempts[0].Canceled)
+		}
+
+		// New attempts are not started after closing the manager.
+		ch = newChallenge()
+		assert.FatalError(t, m.Validate(context.Background(), ch, db, jwk, ok))
+		assert.Len(t, 0, ch.Attempts)
+	})
+
+	t.Run("fail max attempts", func(t *testing.T) {
+		m := NewValidationManager(0, 1)
+		ch := newChallenge()
+		ch.Attempts = []*ValidationAttempt{{Status: StatusPending}}
+		assert.FatalError(t, m.Validate(context.Background(), ch, db, jwk, ok))
+		assert.Equals(t, StatusInvalid, ch.Status)
+		if assert.NotNil(t, ch.Error) {
+			assert.Equals(t, NewError(ErrorRateLimitedType, "").Type, ch.Error.Type)
+		}
+		assert.Len(t, 1, ch.Attempts)
+	})
+}
+
+func TestValidationManager_Diagnose(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	assert.FatalError(t, err)
+
+	newChallenge := func() *Challenge {
+		return &Challenge{ID: "chID", Type: HTTP01, Status: StatusInvalid, Token: "token", Value: "example.com"}
+	}
+	ok := &ValidateChallengeOptions{
+		HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(keyAuth)),
+			}, nil
+		},
+	}
+	started := make(chan struct{}, 1)
+	blocking := &ValidateChallengeOptions{
+		HTTPGet: func(ctx context.Context, url string) (*http.Response, error) {
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		m := NewValidationManager(0, 0)
+		d, err := m.Diagnose(context.Background(), newChallenge(), jwk, ok)
+		assert.FatalError(t, err)
+		assert.True(t, d.Valid)
+	})
+
+	t.Run("ok timeout", func(t *testing.T) {
+		m := NewValidationManager(10*time.Millisecond, 0)
+		go func() { <-started }()
+		d, err := m.Diagnose(context.Background(), newChallenge(), jwk, blocking)
+		assert.FatalError(t, err)
+		assert.False(t, d.Valid)
+	})
+
+	t.Run("fail running", func(t *testing.T) {
+		m := NewValidationManager(0, 0)
+		done := make(chan error)
+		go func() {
+			_, err := m.Diagnose(context.Background(), newChallenge(), jwk, blocking)
+			done <- err
+		}()
+		<-started
+		_, err := m.Diagnose(context.Background(), newChallenge(), jwk, ok)
+		if assert.NotNil(t, err) {
+			assert.Equals(t, NewError(ErrorRateLimitedType, "").Type, err.(*Error).Type)
+		}
+		m.Close()
+		assert.FatalError(t, <-done)
+	})
+
+	t.Run("fail max attempts", func(t *testing.T) {
+		m := NewValidationManager(0, 1)
+		ch := newChallenge()
+		ch.Attempts = []*ValidationAttempt{{Status: StatusInvalid}}
+		_, err := m.Diagnose(context.Background(), ch, jwk, ok)
+		if assert.NotNil(t, err) {
+			assert.Equals(t, NewError(ErrorRateLimitedType, "").Type, err.(*Error).Type)
+		}
+	})
+}
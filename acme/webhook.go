@@ -0,0 +1,165 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+)
+
+// DefaultAccountWebhookTimeout is the default timeout of the requests to the
+// account webhook.
+const DefaultAccountWebhookTimeout = 5 * time.Second
+
+// maxAccountWebhookResponseSize is the maximum size of a response of the
+// account webhook.
+const maxAccountWebhookResponseSize = 64 * 1024
+
+// AccountWebhookEvent is the event sent to the account webhook.
+type AccountWebhookEvent string
+
+// Account webhook events.
+const (
+	AccountWebhookCreate     AccountWebhookEvent = "account.create"
+	AccountWebhookDeactivate AccountWebhookEvent = "account.deactivate"
+)
+
+// AccountWebhookRequest is the body of the requests sent to the account
+// webhook. The account id is not known before the account is created, the key
+// thumbprint identifies the account in both events. The external account key
+// id is set if the account is bound to an external account binding key.
+type AccountWebhookRequest struct {
+	Event                AccountWebhookEvent `json:"event"`
+	Time                 time.Time           `json:"time"`
+	AccountID            string              `json:"accountID,omitempty"`
+	KeyThumbprint        string              `json:"keyThumbprint"`
+	ProvisionerID        string              `json:"provisionerID"`
+	Provisioner          string              `json:"provisioner"`
+	Contact              []string            `json:"contact,omitempty"`
+	Labels               map[string]string   `json:"labels,omitempty"`
+	ExternalAccountKeyID string              `json:"externalAccountKeyID,omitempty"`
+}
+
+// AccountWebhookResponse is the body of the responses of the account webhook.
+// It's only used in the account.create event, to allow or veto the creation
+// of the account.
+type AccountWebhookResponse struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AccountWebhook sends the creation and deactivation of the ACME accounts to
+// an external system, e.g. a tenant management system, which can veto the
+// creation of an account. The requests are sent as JSON with a POST, and the
+// webhook must respond with a 200 OK and an AccountWebhookResponse.
+//
+// If a Breaker is set, the requests fail right away while it is open.
+type AccountWebhook struct {
+	URL      string
+	Token    string
+	Timeout  time.Duration
+	FailOpen bool
+	Client   *http.Client
+	Breaker  *breaker.Breaker
+}
+
+// Send sends the request to the webhook and returns its response.
+func (w *AccountWebhook) Send(ctx context.Context, req *AccountWebhookRequest) (*AccountWebhookResponse, error) {
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultAccountWebhookTimeout
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling account webhook request")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body []byte
+	err = w.Breaker.Do(func() (err error) {
+		body, err = w.send(ctx, client, b)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := new(AccountWebhookResponse)
+	if err := json.Unmarshal(body, res); err != nil {
+		return nil, errors.Wrapf(err, "error parsing response from %s", w.URL)
+	}
+	return res, nil
+}
+
+func (w *AccountWebhook) send(ctx context.Context, client *http.Client, b []byte) ([]byte, error) {
+	r, err := http.NewRequest("POST", w.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to %s", w.URL)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	if w.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error sending request to %s", w.URL)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAccountWebhookResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading response from %s", w.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error sending request to %s: status code %d: %s", w.URL, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// AuthorizeCreate sends the account.create event and returns an error if the
+// webhook vetoes the creation of the account. If the webhook cannot be reached
+// the account is only created if FailOpen is set.
+func (w *AccountWebhook) AuthorizeCreate(ctx context.Context, req *AccountWebhookRequest) error {
+	if w == nil {
+		return nil
+	}
+	req.Event = AccountWebhookCreate
+	res, err := w.Send(ctx, req)
+	switch {
+	case err != nil && w.FailOpen:
+		return nil
+	case err != nil:
+		return WrapErrorISE(err, "error sending account webhook")
+	case !res.Allow && res.Reason != "":
+		return NewError(ErrorUnauthorizedType, "account creation rejected: %s", res.Reason)
+	case !res.Allow:
+		return NewError(ErrorUnauthorizedType, "account creation rejected")
+	default:
+		return nil
+	}
+}
+
+// NotifyDeactivate sends the account.deactivate event. The response of the
+// webhook is ignored.
+func (w *AccountWebhook) NotifyDeactivate(ctx context.Context, req *AccountWebhookRequest) error {
+	if w == nil {
+		return nil
+	}
+	req.Event = AccountWebhookDeactivate
+	_, err := w.Send(ctx, req)
+	return err
+}
@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestAccountWebhook_AuthorizeCreate(t *testing.T) {
+	var response string
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equals(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req AccountWebhookRequest
+		assert.FatalError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equals(t, "thumbprint", req.KeyThumbprint)
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		response string
+		status   int
+		failOpen bool
+		wantErr  bool
+	}{
+		{"ok", `{"allow":true}`, http.StatusOK, false, false},
+		{"ok fail open", "", http.StatusInternalServerError, true, false},
+		{"fail veto", `{"allow":false,"reason":"unknown tenant"}`, http.StatusOK, false, true},
+		{"fail status", "", http.StatusInternalServerError, false, true},
+		{"fail response", "not json", http.StatusOK, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, status = tt.response, tt.status
+			w := &AccountWebhook{URL: srv.URL, Token: "secret", FailOpen: tt.failOpen}
+			req := &AccountWebhookRequest{KeyThumbprint: "thumbprint"}
+			err := w.AuthorizeCreate(context.Background(), req)
+			assert.Equals(t, AccountWebhookCreate, req.Event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AccountWebhook.AuthorizeCreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A nil webhook allows everything
+	var w *AccountWebhook
+	assert.FatalError(t, w.AuthorizeCreate(context.Background(), &AccountWebhookRequest{}))
+	assert.FatalError(t, w.NotifyDeactivate(context.Background(), &AccountWebhookRequest{}))
+}
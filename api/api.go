@@ -7,22 +7,29 @@ import (
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/keyattest"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/authority/timing"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 )
@@ -36,16 +43,31 @@ type Authority interface {
 	GetTLSOptions() *config.TLSOptions
 	Root(shasum string) (*x509.Certificate, error)
 	Sign(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	Renew(peer *x509.Certificate) ([]*x509.Certificate, error)
+	RenewWithContext(ctx context.Context, peer *x509.Certificate) ([]*x509.Certificate, error)
+	RenewWithCSR(ctx context.Context, peer *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error)
+	AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error)
 	Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	RekeyWithContext(ctx context.Context, peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	SignOnDemand(client *x509.Certificate, domain string) ([]*x509.Certificate, crypto.Signer, error)
+	SignTOFU(client *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error)
+	EnrollPIV(ctx context.Context, cr *x509.CertificateRequest, stmt *keyattest.Statement, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error)
 	LoadProvisionerByName(string) (provisioner.Interface, error)
 	GetProvisioners(cursor string, limit int) (provisioner.List, string, error)
+	FindProvisioners(cursor string, limit int, filter *provisioner.Filter) (provisioner.List, string, error)
+	EvaluateClaims(name string, req *provisioner.ClaimsEvaluationRequest) (*provisioner.ClaimsEvaluation, error)
 	Revoke(context.Context, *authority.RevokeOptions) error
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() (federation []*x509.Certificate, err error)
 	GetFederation() ([]*x509.Certificate, error)
+	GetFederatedAuthorities() ([]*authority.FederatedAuthority, error)
+	GetIntermediates() ([]*x509.Certificate, error)
+	GetRootsManifest() (string, error)
+	GetCertificateRevocationList() ([]byte, error)
 	Version() authority.Version
+	Ready() error
 }
 
 // TimeDuration is an alias of provisioner.TimeDuration
@@ -88,28 +110,106 @@ func (c Certificate) MarshalJSON() ([]byte, error) {
 	if c.Certificate == nil {
 		return []byte("null"), nil
 	}
-	block := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: c.Raw,
-	})
-	return json.Marshal(string(block))
+	// The issuer chain is the same in all the responses, so the encoding of
+	// the CA certificates is only done once.
+	if c.IsCA {
+		if b, ok := caEncodings.Load(c.Certificate); ok {
+			return b.([]byte), nil
+		}
+	}
+	b := encodeCertificateJSON(c.Raw)
+	if c.IsCA && atomic.AddInt32(&caEncodingsLen, 1) <= maxCAEncodings {
+		caEncodings.Store(c.Certificate, b)
+	}
+	return b, nil
+}
+
+// maxCAEncodings is the maximum number of CA certificates with a cached
+// encoding. The cache is keyed by the certificate pointer, the limit prevents
+// it from growing if a CAS returns new certificates on every request.
+const maxCAEncodings = 64
+
+var (
+	caEncodings    sync.Map
+	caEncodingsLen int32
+)
+
+// encodeCertificateJSON returns the JSON string with the PEM encoding of the
+// given certificate.
+func encodeCertificateJSON(raw []byte) []byte {
+	return appendCertificateJSON(make([]byte, 0, certificateJSONLen(raw)), raw)
+}
+
+const (
+	pemCertificateHeader = "-----BEGIN CERTIFICATE-----\\n"
+	pemCertificateFooter = "-----END CERTIFICATE-----\\n"
+	pemLineLength        = 64
+)
+
+// certificateJSONLen returns the length of the JSON string with the PEM
+// encoding of the given certificate.
+func certificateJSONLen(raw []byte) int {
+	n := base64.StdEncoding.EncodedLen(len(raw))
+	lines := (n + pemLineLength - 1) / pemLineLength
+	return len(pemCertificateHeader) + n + 2*lines + len(pemCertificateFooter) + 2
+}
+
+// appendCertificateJSON appends to b the JSON string with the PEM encoding of
+// the given certificate. The output is the same as json.Marshal on the PEM
+// string, the only characters of the PEM encoding that need to be escaped are
+// the new lines. The base64 encoding is written directly in b, so there are no
+// allocations if b has enough capacity.
+func appendCertificateJSON(b []byte, raw []byte) []byte {
+	n := certificateJSONLen(raw)
+	if cap(b)-len(b) < n {
+		nb := make([]byte, len(b), len(b)+n)
+		copy(nb, b)
+		b = nb
+	}
+	b = append(b, '"')
+	b = append(b, pemCertificateHeader...)
+
+	// Encode the certificate in the space left at the end of the buffer and
+	// move each line to its position.
+	enc := base64.StdEncoding.EncodedLen(len(raw))
+	start := len(b)
+	end := start + n - len(pemCertificateHeader) - len(pemCertificateFooter) - 2
+	tmp := b[end-enc : end]
+	base64.StdEncoding.Encode(tmp, raw)
+	for i := 0; i < enc; i += pemLineLength {
+		j := i + pemLineLength
+		if j > enc {
+			j = enc
+		}
+		b = append(b, tmp[i:j]...)
+		b = append(b, '\\', 'n')
+	}
+
+	b = append(b, pemCertificateFooter...)
+	return append(b, '"')
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface. The certificate is
 // expected to be a quoted string using the PEM encoding.
 func (c *Certificate) UnmarshalJSON(data []byte) error {
-	var s string
-	if err := json.Unmarshal(data, &s); err != nil {
-		return errors.Wrap(err, "error decoding certificate")
+	// Strings with only escaped new lines, the ones written by the CA, are
+	// decoded without json.Unmarshal.
+	pemBytes, ok := unquotePEM(data)
+	if !ok {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return errors.Wrap(err, "error decoding certificate")
+		}
+		pemBytes = []byte(s)
 	}
 
 	// Make sure the inner x509.Certificate is nil
-	if s == "null" || s == "" {
+	if len(pemBytes) == 0 || string(pemBytes) == "null" {
 		c.reset()
 		return nil
 	}
 
-	block, _ := pem.Decode([]byte(s))
+	block, _ := pem.Decode(pemBytes)
 	if block == nil {
 		return errors.New("error decoding certificate")
 	}
@@ -121,6 +221,32 @@ func (c *Certificate) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// unquotePEM returns the content of a JSON string if the only escaped
+// characters are new lines. It returns false otherwise, and the string must
+// be decoded with json.Unmarshal.
+func unquotePEM(data []byte) ([]byte, bool) {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return nil, false
+	}
+	data = data[1 : len(data)-1]
+	b := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\\':
+			if i+1 == len(data) || data[i+1] != 'n' {
+				return nil, false
+			}
+			b = append(b, '\n')
+			i++
+		case c == '"' || c < 0x20 || c >= 0x80:
+			return nil, false
+		default:
+			b = append(b, c)
+		}
+	}
+	return b, true
+}
+
 // CertificateRequest wraps a *x509.CertificateRequest and adds the
 // json.Unmarshaler interface.
 type CertificateRequest struct {
@@ -231,18 +357,37 @@ type RootsResponse struct {
 
 // FederationResponse is the response object of the federation request.
 type FederationResponse struct {
-	Certificates []Certificate `json:"crts"`
+	Certificates []Certificate        `json:"crts"`
+	Authorities  []FederatedAuthority `json:"authorities,omitempty"`
+}
+
+// FederatedAuthority is the metadata of an authority in the federation.
+type FederatedAuthority struct {
+	Name   string          `json:"name"`
+	Source string          `json:"source"`
+	Roots  []FederatedRoot `json:"roots"`
+}
+
+// FederatedRoot is the metadata of a root certificate in the federation.
+type FederatedRoot struct {
+	Subject     string    `json:"subject"`
+	Fingerprint string    `json:"fingerprint"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	Expired     bool      `json:"expired"`
 }
 
 // caHandler is the type used to implement the different CA HTTP endpoints.
 type caHandler struct {
 	Authority Authority
+	sessions  *signSessions
 }
 
 // New creates a new RouterHandler with the CA endpoints.
 func New(authority Authority) RouterHandler {
 	return &caHandler{
 		Authority: authority,
+		sessions:  newSignSessions(),
 	}
 }
 
@@ -251,13 +396,24 @@ func (h *caHandler) Route(r Router) {
 	r.MethodFunc("GET", "/health", h.Health)
 	r.MethodFunc("GET", "/root/{sha}", h.Root)
 	r.MethodFunc("POST", "/sign", h.Sign)
+	r.MethodFunc("POST", "/sign/batch", h.SignBatch)
+	r.MethodFunc("POST", "/sign/sessions", h.NewSignSession)
+	r.MethodFunc("GET", "/sign/sessions/{id}/events", h.SignSessionEvents)
+	r.MethodFunc("POST", "/sign/sessions/{id}/authorize", h.AuthorizeSignSession)
 	r.MethodFunc("POST", "/renew", h.Renew)
 	r.MethodFunc("POST", "/rekey", h.Rekey)
 	r.MethodFunc("POST", "/revoke", h.Revoke)
+	r.MethodFunc("POST", "/on-demand", h.OnDemand)
+	r.MethodFunc("POST", "/tofu", h.TOFU)
+	r.MethodFunc("POST", "/piv/enroll", h.PIVEnroll)
 	r.MethodFunc("GET", "/provisioners", h.Provisioners)
 	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", h.ProvisionerKey)
+	r.MethodFunc("POST", "/claims/evaluate", h.EvaluateClaims)
 	r.MethodFunc("GET", "/roots", h.Roots)
+	r.MethodFunc("GET", "/roots/manifest", h.RootsManifest)
 	r.MethodFunc("GET", "/federation", h.Federation)
+	r.MethodFunc("GET", "/bundle", h.Bundle)
+	r.MethodFunc("GET", "/crl", h.CRL)
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", h.SSHSign)
 	r.MethodFunc("POST", "/ssh/renew", h.SSHRenew)
@@ -286,8 +442,13 @@ func (h *caHandler) Version(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Health is an HTTP handler that returns the status of the server.
+// Health is an HTTP handler that returns the status of the server. It fails
+// with a 503 Service Unavailable error while the authority is starting.
 func (h *caHandler) Health(w http.ResponseWriter, r *http.Request) {
+	if err := h.Authority.Ready(); err != nil {
+		WriteError(w, err)
+		return
+	}
 	JSON(w, HealthResponse{Status: "ok"})
 }
 
@@ -315,6 +476,10 @@ func certChainToPEM(certChain []*x509.Certificate) []Certificate {
 }
 
 // Provisioners returns the list of provisioners configured in the authority.
+// The provisioners can be filtered by type and name using the type and name
+// query parameters, and the fields and exclude parameters select the fields
+// of the provisioners in the response, e.g. exclude=encryptedKey. Provisioners
+// with the hidden option are never listed.
 func (h *caHandler) Provisioners(w http.ResponseWriter, r *http.Request) {
 	cursor, limit, err := ParseCursor(r)
 	if err != nil {
@@ -322,17 +487,95 @@ func (h *caHandler) Provisioners(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, next, err := h.Authority.GetProvisioners(cursor, limit)
+	q := r.URL.Query()
+	filter := &provisioner.Filter{
+		Types:  queryList(q, "type"),
+		Names:  queryList(q, "name"),
+		Public: true,
+	}
+
+	p, next, err := h.Authority.FindProvisioners(cursor, limit, filter)
 	if err != nil {
 		WriteError(w, errs.InternalServerErr(err))
 		return
 	}
-	JSON(w, &ProvisionersResponse{
-		Provisioners: p,
+
+	fields, exclude := queryList(q, "fields"), queryList(q, "exclude")
+	if len(fields) == 0 && len(exclude) == 0 {
+		JSON(w, &ProvisionersResponse{
+			Provisioners: p,
+			NextCursor:   next,
+		})
+		return
+	}
+
+	selected, err := selectProvisionerFields(p, fields, exclude)
+	if err != nil {
+		WriteError(w, errs.InternalServerErr(err))
+		return
+	}
+	JSON(w, &provisionersFieldsResponse{
+		Provisioners: selected,
 		NextCursor:   next,
 	})
 }
 
+// provisionersFieldsResponse is the ProvisionersResponse with the selected
+// fields of the provisioners.
+type provisionersFieldsResponse struct {
+	Provisioners []map[string]json.RawMessage `json:"provisioners"`
+	NextCursor   string                       `json:"nextCursor"`
+}
+
+// selectProvisionerFields returns the JSON objects of the provisioners with
+// the given fields, or all the fields if none is given, without the excluded
+// ones. The type is always included, clients need it to decode the list.
+func selectProvisionerFields(list provisioner.List, fields, exclude []string) ([]map[string]json.RawMessage, error) {
+	selected := make([]map[string]json.RawMessage, 0, len(list))
+	for _, p := range list {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling provisioner %s", p.GetName())
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling provisioner %s", p.GetName())
+		}
+		if len(fields) > 0 {
+			keep := map[string]bool{"type": true}
+			for _, f := range fields {
+				keep[f] = true
+			}
+			for k := range m {
+				if !keep[k] {
+					delete(m, k)
+				}
+			}
+		}
+		for _, f := range exclude {
+			if f != "type" {
+				delete(m, f)
+			}
+		}
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// queryList returns the values of a query parameter that can be repeated or
+// contain a comma-separated list of values.
+func queryList(q url.Values, key string) []string {
+	var values []string
+	for _, v := range q[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
 // ProvisionerKey returns the encrypted key of a provisioner by it's key id.
 func (h *caHandler) ProvisionerKey(w http.ResponseWriter, r *http.Request) {
 	kid := chi.URLParam(r, "kid")
@@ -370,13 +613,41 @@ func (h *caHandler) Federation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	authorities, err := h.Authority.GetFederatedAuthorities()
+	if err != nil {
+		WriteError(w, errs.ForbiddenErr(err))
+		return
+	}
+
 	certs := make([]Certificate, len(federated))
 	for i := range federated {
 		certs[i] = Certificate{federated[i]}
 	}
 
+	now := time.Now()
+	metadata := make([]FederatedAuthority, len(authorities))
+	for i, fa := range authorities {
+		roots := make([]FederatedRoot, len(fa.Certificates()))
+		for j, crt := range fa.Certificates() {
+			sum := sha256.Sum256(crt.Raw)
+			roots[j] = FederatedRoot{
+				Subject:     crt.Subject.String(),
+				Fingerprint: hex.EncodeToString(sum[:]),
+				NotBefore:   crt.NotBefore,
+				NotAfter:    crt.NotAfter,
+				Expired:     now.After(crt.NotAfter),
+			}
+		}
+		metadata[i] = FederatedAuthority{
+			Name:   fa.Name,
+			Source: fa.Source,
+			Roots:  roots,
+		}
+	}
+
 	JSONStatus(w, &FederationResponse{
 		Certificates: certs,
+		Authorities:  metadata,
 	}, http.StatusCreated)
 }
 
@@ -427,6 +698,15 @@ func LogCertificate(w http.ResponseWriter, cert *x509.Certificate) {
 	}
 }
 
+// LogTiming adds the timing breakdown of a sign request to the response log.
+func LogTiming(w http.ResponseWriter, b *timing.Breakdown) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		if fields := b.Fields(); fields != nil {
+			rl.WithFields(fields)
+		}
+	}
+}
+
 // ParseCursor parses the cursor and limit from the request query params.
 func ParseCursor(r *http.Request) (cursor string, limit int, err error) {
 	q := r.URL.Query()
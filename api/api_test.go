@@ -16,11 +16,13 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -29,6 +31,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/keyattest"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
@@ -207,6 +211,103 @@ func TestCertificate_MarshalJSON(t *testing.T) {
 	}
 }
 
+func TestCertificate_MarshalJSON_cache(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	want, err := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})))
+	assert.FatalError(t, err)
+	for i := 0; i < 2; i++ {
+		got, err := Certificate{root}.MarshalJSON()
+		assert.FatalError(t, err)
+		assert.Equals(t, want, got)
+	}
+	if _, ok := caEncodings.Load(root); !ok {
+		t.Error("Certificate.MarshalJSON() did not cache the CA certificate")
+	}
+
+	leaf := parseCertificate(certPEM)
+	if _, err := (Certificate{leaf}).MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := caEncodings.Load(leaf); ok {
+		t.Error("Certificate.MarshalJSON() cached a leaf certificate")
+	}
+}
+
+func Test_appendCertificateJSON(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 47, 48, 49, 95, 96, 97, 1000} {
+		raw := make([]byte, n)
+		for i := range raw {
+			raw[i] = byte(i * 7)
+		}
+		want, err := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw})))
+		assert.FatalError(t, err)
+		assert.Equals(t, want, encodeCertificateJSON(raw))
+		assert.Equals(t, append([]byte("prefix"), want...), appendCertificateJSON([]byte("prefix"), raw))
+	}
+}
+
+func Test_writeSignResponse(t *testing.T) {
+	leaf, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	tests := []struct {
+		name string
+		resp *SignResponse
+	}{
+		{"ok", &SignResponse{
+			ServerPEM:    Certificate{leaf},
+			CaPEM:        Certificate{root},
+			CertChainPEM: []Certificate{{leaf}, {root}},
+		}},
+		{"ok/tlsOptions", &SignResponse{
+			ServerPEM:    Certificate{leaf},
+			CaPEM:        Certificate{root},
+			CertChainPEM: []Certificate{{leaf}, {root}},
+			TLSOptions:   &config.DefaultTLSOptions,
+		}},
+		{"ok/no-ca", &SignResponse{
+			ServerPEM:    Certificate{leaf},
+			CertChainPEM: []Certificate{{leaf}},
+		}},
+		{"ok/empty", &SignResponse{}},
+		{"ok/empty-chain", &SignResponse{
+			ServerPEM:    Certificate{leaf},
+			CertChainPEM: []Certificate{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want, got bytes.Buffer
+			assert.FatalError(t, json.NewEncoder(&want).Encode(tt.resp))
+			assert.FatalError(t, writeSignResponse(&got, tt.resp))
+			assert.Equals(t, want.String(), got.String())
+		})
+	}
+}
+
+func BenchmarkSignResponse_MarshalJSON(b *testing.B) {
+	leaf, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	resp := &SignResponse{
+		ServerPEM:    Certificate{leaf},
+		CaPEM:        Certificate{root},
+		CertChainPEM: []Certificate{{leaf}, {root}},
+	}
+	b.Run("json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := json.NewEncoder(ioutil.Discard).Encode(resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("writeSignResponse", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := writeSignResponse(ioutil.Discard, resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func TestCertificate_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -224,6 +325,7 @@ func TestCertificate_UnmarshalJSON(t *testing.T) {
 		{"json null", []byte(`null`), false, false},
 		{"valid root", []byte(`"` + strings.Replace(rootPEM, "\n", `\n`, -1) + `"`), true, false},
 		{"valid cert", []byte(`"` + strings.Replace(certPEM, "\n", `\n`, -1) + `"`), true, false},
+		{"valid escaped cert", []byte(`"` + strings.Replace(strings.Replace(certPEM, "\n", `\n`, -1), "-", `\u002d`, -1) + `"`), true, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -559,14 +661,25 @@ type mockAuthority struct {
 	root                         func(shasum string) (*x509.Certificate, error)
 	sign                         func(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	renew                        func(cert *x509.Certificate) ([]*x509.Certificate, error)
+	renewWithCSR                 func(cert *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error)
+	authorizeRenewToken          func(ctx context.Context, ott string) (*x509.Certificate, error)
 	rekey                        func(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	signOnDemand                 func(client *x509.Certificate, domain string) ([]*x509.Certificate, crypto.Signer, error)
+	signTOFU                     func(client *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error)
+	enrollPIV                    func(ctx context.Context, cr *x509.CertificateRequest, stmt *keyattest.Statement, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	loadProvisionerByCertificate func(cert *x509.Certificate) (provisioner.Interface, error)
 	loadProvisionerByName        func(name string) (provisioner.Interface, error)
 	getProvisioners              func(nextCursor string, limit int) (provisioner.List, string, error)
+	findProvisioners             func(nextCursor string, limit int, filter *provisioner.Filter) (provisioner.List, string, error)
+	evaluateClaims               func(name string, req *provisioner.ClaimsEvaluationRequest) (*provisioner.ClaimsEvaluation, error)
 	revoke                       func(context.Context, *authority.RevokeOptions) error
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
 	getFederation                func() ([]*x509.Certificate, error)
+	getIntermediates             func() ([]*x509.Certificate, error)
+	getFederatedAuthorities      func() ([]*authority.FederatedAuthority, error)
+	getRootsManifest             func() (string, error)
+	getCertificateRevocationList func() ([]byte, error)
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -578,6 +691,7 @@ type mockAuthority struct {
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
 	version                      func() authority.Version
+	ready                        func() error
 }
 
 // TODO: remove once Authorize is deprecated.
@@ -613,6 +727,10 @@ func (m *mockAuthority) Sign(cr *x509.CertificateRequest, opts provisioner.SignO
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return m.Sign(cr, opts, signOpts...)
+}
+
 func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, error) {
 	if m.renew != nil {
 		return m.renew(cert)
@@ -620,6 +738,24 @@ func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, erro
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
+	if m.authorizeRenewToken != nil {
+		return m.authorizeRenewToken(ctx, ott)
+	}
+	return m.ret1.(*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) RenewWithContext(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	return m.Renew(cert)
+}
+
+func (m *mockAuthority) RenewWithCSR(ctx context.Context, cert *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	if m.renewWithCSR != nil {
+		return m.renewWithCSR(cert, csr)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+}
+
 func (m *mockAuthority) Rekey(oldcert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
 	if m.rekey != nil {
 		return m.rekey(oldcert, pk)
@@ -627,6 +763,31 @@ func (m *mockAuthority) Rekey(oldcert *x509.Certificate, pk crypto.PublicKey) ([
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) RekeyWithContext(ctx context.Context, oldcert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	return m.Rekey(oldcert, pk)
+}
+
+func (m *mockAuthority) SignOnDemand(client *x509.Certificate, domain string) ([]*x509.Certificate, crypto.Signer, error) {
+	if m.signOnDemand != nil {
+		return m.signOnDemand(client, domain)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, nil, m.err
+}
+
+func (m *mockAuthority) SignTOFU(client *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	if m.signTOFU != nil {
+		return m.signTOFU(client, csr)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+}
+
+func (m *mockAuthority) EnrollPIV(ctx context.Context, cr *x509.CertificateRequest, stmt *keyattest.Statement, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if m.enrollPIV != nil {
+		return m.enrollPIV(ctx, cr, stmt, opts, signOpts...)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+}
+
 func (m *mockAuthority) GetProvisioners(nextCursor string, limit int) (provisioner.List, string, error) {
 	if m.getProvisioners != nil {
 		return m.getProvisioners(nextCursor, limit)
@@ -634,6 +795,13 @@ func (m *mockAuthority) GetProvisioners(nextCursor string, limit int) (provision
 	return m.ret1.(provisioner.List), m.ret2.(string), m.err
 }
 
+func (m *mockAuthority) FindProvisioners(nextCursor string, limit int, filter *provisioner.Filter) (provisioner.List, string, error) {
+	if m.findProvisioners != nil {
+		return m.findProvisioners(nextCursor, limit, filter)
+	}
+	return m.ret1.(provisioner.List), m.ret2.(string), m.err
+}
+
 func (m *mockAuthority) LoadProvisionerByCertificate(cert *x509.Certificate) (provisioner.Interface, error) {
 	if m.loadProvisionerByCertificate != nil {
 		return m.loadProvisionerByCertificate(cert)
@@ -676,6 +844,34 @@ func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetFederatedAuthorities() ([]*authority.FederatedAuthority, error) {
+	if m.getFederatedAuthorities != nil {
+		return m.getFederatedAuthorities()
+	}
+	return nil, m.err
+}
+
+func (m *mockAuthority) GetRootsManifest() (string, error) {
+	if m.getRootsManifest != nil {
+		return m.getRootsManifest()
+	}
+	return m.ret1.(string), m.err
+}
+
+func (m *mockAuthority) GetCertificateRevocationList() ([]byte, error) {
+	if m.getCertificateRevocationList != nil {
+		return m.getCertificateRevocationList()
+	}
+	return m.ret1.([]byte), m.err
+}
+
+func (m *mockAuthority) GetIntermediates() ([]*x509.Certificate, error) {
+	if m.getIntermediates != nil {
+		return m.getIntermediates()
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
 func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSH != nil {
 		return m.signSSH(ctx, key, opts, signOpts...)
@@ -746,6 +942,13 @@ func (m *mockAuthority) GetSSHBastion(ctx context.Context, user string, hostname
 	return m.ret1.(*authority.Bastion), m.err
 }
 
+func (m *mockAuthority) EvaluateClaims(name string, req *provisioner.ClaimsEvaluationRequest) (*provisioner.ClaimsEvaluation, error) {
+	if m.evaluateClaims != nil {
+		return m.evaluateClaims(name, req)
+	}
+	return m.ret1.(*provisioner.ClaimsEvaluation), m.err
+}
+
 func (m *mockAuthority) Version() authority.Version {
 	if m.version != nil {
 		return m.version()
@@ -753,6 +956,13 @@ func (m *mockAuthority) Version() authority.Version {
 	return m.ret1.(authority.Version)
 }
 
+func (m *mockAuthority) Ready() error {
+	if m.ready != nil {
+		return m.ready()
+	}
+	return nil
+}
+
 func Test_caHandler_Route(t *testing.T) {
 	type fields struct {
 		Authority Authority
@@ -797,6 +1007,22 @@ func Test_caHandler_Health(t *testing.T) {
 	if !bytes.Equal(body, expected) {
 		t.Errorf("caHandler.Health Body = %s, wants %s", body, expected)
 	}
+
+	// The authority is starting.
+	w = httptest.NewRecorder()
+	h = New(&mockAuthority{
+		ready: func() error {
+			return errs.NewErr(http.StatusServiceUnavailable, fmt.Errorf("starting"), errs.WithRetryAfter(time.Second))
+		},
+	}).(*caHandler)
+	h.Health(w, req)
+	res = w.Result()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("caHandler.Health StatusCode = %d, wants %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+	if got := res.Header.Get("Retry-After"); got != "1" {
+		t.Errorf("caHandler.Health Retry-After = %s, wants 1", got)
+	}
 }
 
 func Test_caHandler_Root(t *testing.T) {
@@ -916,6 +1142,83 @@ func Test_caHandler_Sign(t *testing.T) {
 	}
 }
 
+func Test_caHandler_SignBatch(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	valid, err := json.Marshal(BatchSignRequest{
+		Requests: []SignRequest{
+			{CsrPEM: CertificateRequest{csr}, OTT: "foobarzar"},
+			{CsrPEM: CertificateRequest{csr}, OTT: "unauthorized"},
+			{CsrPEM: CertificateRequest{csr}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooMany, err := json.Marshal(BatchSignRequest{
+		Requests: make([]SignRequest, MaxBatchSignRequests+1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		input        string
+		statusCode   int
+		wantStatuses []int
+	}{
+		{"ok", string(valid), http.StatusOK, []int{http.StatusCreated, http.StatusUnauthorized, http.StatusBadRequest}},
+		{"json read error", "{", http.StatusBadRequest, nil},
+		{"empty", `{"requests":[]}`, http.StatusBadRequest, nil},
+		{"too many", string(tooMany), http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				ret1: parseCertificate(certPEM), ret2: parseCertificate(rootPEM),
+				authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+					if ott == "unauthorized" {
+						return nil, fmt.Errorf("an error")
+					}
+					return nil, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/sign/batch", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			h.SignBatch(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.SignBatch StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp BatchSignResponse
+			if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+				t.Fatalf("caHandler.SignBatch unexpected error = %v", err)
+			}
+			res.Body.Close()
+			if len(resp.Results) != len(tt.wantStatuses) {
+				t.Fatalf("caHandler.SignBatch len(Results) = %d, wants %d", len(resp.Results), len(tt.wantStatuses))
+			}
+			for i, r := range resp.Results {
+				if r.Status != tt.wantStatuses[i] {
+					t.Errorf("caHandler.SignBatch Results[%d].Status = %d, wants %d", i, r.Status, tt.wantStatuses[i])
+				}
+				if (r.Response != nil) != (r.Status == http.StatusCreated) {
+					t.Errorf("caHandler.SignBatch Results[%d].Response = %v, status %d", i, r.Response, r.Status)
+				}
+			}
+		})
+	}
+}
+
 func Test_caHandler_Renew(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -968,6 +1271,189 @@ func Test_caHandler_Renew(t *testing.T) {
 	}
 }
 
+func Test_caHandler_OnDemand(t *testing.T) {
+	cert := parseCertificate(certPEM)
+	root := parseCertificate(rootPEM)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	verified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert, root}},
+	}
+	tests := []struct {
+		name       string
+		tls        *tls.ConnectionState
+		input      string
+		err        error
+		statusCode int
+	}{
+		{"ok", verified, `{"domain":"foo.internal"}`, nil, http.StatusCreated},
+		{"fail no tls", nil, `{"domain":"foo.internal"}`, nil, http.StatusUnauthorized},
+		{"fail no peer certificates", &tls.ConnectionState{}, `{"domain":"foo.internal"}`, nil, http.StatusUnauthorized},
+		{"fail not verified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, `{"domain":"foo.internal"}`, nil, http.StatusUnauthorized},
+		{"fail empty domain", verified, `{"domain":""}`, nil, http.StatusBadRequest},
+		{"fail sign", verified, `{"domain":"foo.internal"}`, errs.Forbidden("an error"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				signOnDemand: func(client *x509.Certificate, domain string) ([]*x509.Certificate, crypto.Signer, error) {
+					if client != cert {
+						t.Error("caHandler.OnDemand client does not match the verified certificate")
+					}
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return []*x509.Certificate{cert, root}, key, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/on-demand", strings.NewReader(tt.input))
+			req.TLS = tt.tls
+			w := httptest.NewRecorder()
+			h.OnDemand(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.OnDemand StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
+
+func Test_caHandler_Renew_token(t *testing.T) {
+	cert := parseCertificate(certPEM)
+	root := parseCertificate(rootPEM)
+	tests := []struct {
+		name       string
+		input      string
+		err        error
+		statusCode int
+	}{
+		{"ok", `{"token":"the-token"}`, nil, http.StatusCreated},
+		{"fail empty token", `{"token":""}`, nil, http.StatusBadRequest},
+		{"fail json", `{`, nil, http.StatusBadRequest},
+		{"fail authorize", `{"token":"the-token"}`, errs.Unauthorized("an error"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				authorizeRenewToken: func(ctx context.Context, ott string) (*x509.Certificate, error) {
+					if ott != "the-token" {
+						t.Errorf("caHandler.Renew token = %s, wants the-token", ott)
+					}
+					return cert, tt.err
+				},
+				renew: func(c *x509.Certificate) ([]*x509.Certificate, error) {
+					if c != cert {
+						t.Error("caHandler.Renew certificate does not match the token certificate")
+					}
+					return []*x509.Certificate{cert, root}, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/renew", strings.NewReader(tt.input))
+			req.TLS = nil
+			w := httptest.NewRecorder()
+			h.Renew(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Renew StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
+
+func Test_caHandler_Renew_csr(t *testing.T) {
+	cert := parseCertificate(certPEM)
+	root := parseCertificate(rootPEM)
+	csr := parseCertificateRequest(csrPEM)
+	cs := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+	}
+	valid, err := json.Marshal(RenewRequest{
+		CSR: CertificateRequest{csr},
+	})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		input      string
+		err        error
+		statusCode int
+	}{
+		{"ok", string(valid), nil, http.StatusCreated},
+		{"fail csr", `{"csr":"foo"}`, nil, http.StatusBadRequest},
+		{"fail policy", string(valid), errs.Forbidden("an error"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				renew: func(c *x509.Certificate) ([]*x509.Certificate, error) {
+					t.Error("caHandler.Renew did not use the csr")
+					return nil, nil
+				},
+				renewWithCSR: func(c *x509.Certificate, cr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+					if c != cert {
+						t.Error("caHandler.Renew certificate does not match the peer certificate")
+					}
+					if !bytes.Equal(cr.Raw, csr.Raw) {
+						t.Error("caHandler.Renew csr does not match the request csr")
+					}
+					return []*x509.Certificate{cert, root}, tt.err
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/renew", strings.NewReader(tt.input))
+			req.TLS = cs
+			w := httptest.NewRecorder()
+			h.Renew(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Renew StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
+
+func Test_readRenewRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          io.Reader
+		contentLength int64
+		want          *RenewRequest
+		wantErr       bool
+	}{
+		{"ok no body", nil, 0, nil, false},
+		{"ok empty", strings.NewReader(""), 0, nil, false},
+		{"ok empty chunked", strings.NewReader(""), -1, nil, false},
+		{"ok chunked", strings.NewReader(`{"token":"the-token"}`), -1, &RenewRequest{Token: "the-token"}, false},
+		{"ok", strings.NewReader(`{"token":"the-token"}`), 21, &RenewRequest{Token: "the-token"}, false},
+		{"fail json", strings.NewReader(`{`), -1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/renew", tt.body)
+			req.ContentLength = tt.contentLength
+			got, err := readRenewRequest(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRenewRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readRenewRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_caHandler_Rekey(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -1133,6 +1619,79 @@ func Test_caHandler_Provisioners(t *testing.T) {
 	}
 }
 
+func Test_caHandler_Provisioners_filter(t *testing.T) {
+	var key jose.JSONWebKey
+	if err := json.Unmarshal([]byte(pubKey), &key); err != nil {
+		t.Fatal(err)
+	}
+	p := provisioner.List{
+		&provisioner.JWK{
+			Type:         "JWK",
+			Name:         "max",
+			EncryptedKey: "abc",
+			Key:          &key,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter *provisioner.Filter
+		wantKeys   []string
+	}{
+		{"ok", "", &provisioner.Filter{Public: true}, []string{"type", "name", "key", "encryptedKey"}},
+		{"ok type", "type=jwk,oidc", &provisioner.Filter{Types: []string{"jwk", "oidc"}, Public: true}, []string{"type", "name", "key", "encryptedKey"}},
+		{"ok name", "name=max&name=mariano", &provisioner.Filter{Names: []string{"max", "mariano"}, Public: true}, []string{"type", "name", "key", "encryptedKey"}},
+		{"ok exclude", "exclude=encryptedKey", &provisioner.Filter{Public: true}, []string{"type", "name", "key"}},
+		{"ok fields", "fields=name", &provisioner.Filter{Public: true}, []string{"type", "name"}},
+		{"ok fields and exclude", "fields=name,encryptedKey&exclude=encryptedKey,type", &provisioner.Filter{Public: true}, []string{"type", "name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &caHandler{
+				Authority: &mockAuthority{
+					findProvisioners: func(nextCursor string, limit int, filter *provisioner.Filter) (provisioner.List, string, error) {
+						if !reflect.DeepEqual(filter, tt.wantFilter) {
+							t.Errorf("caHandler.Provisioners filter = %v, wants %v", filter, tt.wantFilter)
+						}
+						return p, "next", nil
+					},
+				},
+			}
+			req := httptest.NewRequest("GET", "http://example.com/provisioners?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Provisioners(w, req)
+
+			res := w.Result()
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("caHandler.Provisioners StatusCode = %d, wants %d", res.StatusCode, http.StatusOK)
+			}
+			var body struct {
+				Provisioners []map[string]json.RawMessage `json:"provisioners"`
+				NextCursor   string                       `json:"nextCursor"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.NextCursor != "next" {
+				t.Errorf("caHandler.Provisioners NextCursor = %s, wants next", body.NextCursor)
+			}
+			if len(body.Provisioners) != 1 {
+				t.Fatalf("caHandler.Provisioners len = %d, wants 1", len(body.Provisioners))
+			}
+			var keys []string
+			for k := range body.Provisioners[0] {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			sort.Strings(tt.wantKeys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("caHandler.Provisioners fields = %v, wants %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
 func Test_caHandler_ProvisionerKey(t *testing.T) {
 	type fields struct {
 		Authority Authority
@@ -1285,6 +1844,148 @@ func Test_caHandler_Federation(t *testing.T) {
 	}
 }
 
+func Test_caHandler_RootsManifest(t *testing.T) {
+	tests := []struct {
+		name       string
+		manifest   string
+		err        error
+		statusCode int
+	}{
+		{"ok", "header.payload.signature", nil, http.StatusOK},
+		{"fail", "", errs.NotFound("root rollover is not configured"), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{ret1: tt.manifest, err: tt.err}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/roots/manifest", nil)
+			w := httptest.NewRecorder()
+			h.RootsManifest(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.RootsManifest StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.RootsManifest unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				expected := []byte(`{"manifest":"` + tt.manifest + `"}`)
+				if !bytes.Equal(bytes.TrimSpace(body), expected) {
+					t.Errorf("caHandler.RootsManifest Body = %s, wants %s", body, expected)
+				}
+			}
+		})
+	}
+}
+
+func Test_caHandler_CRL(t *testing.T) {
+	crl := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	tests := []struct {
+		name            string
+		query           string
+		err             error
+		statusCode      int
+		wantContentType string
+		wantBody        []byte
+	}{
+		{"ok", "", nil, http.StatusOK, "application/pkix-crl", crl},
+		{"ok pem", "?format=pem", nil, http.StatusOK, "application/x-pem-file", pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})},
+		{"fail", "", errs.NotImplemented("crl is not configured"), http.StatusNotImplemented, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{ret1: crl, err: tt.err}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/crl"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.CRL(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.CRL StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.CRL unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if ct := res.Header.Get("Content-Type"); ct != tt.wantContentType {
+					t.Errorf("caHandler.CRL Content-Type = %s, wants %s", ct, tt.wantContentType)
+				}
+				if !bytes.Equal(body, tt.wantBody) {
+					t.Errorf("caHandler.CRL Body = %x, wants %x", body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func Test_caHandler_Federation_authorities(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	fa := &authority.FederatedAuthority{Name: "partner", Source: authority.FederationSourceAdmin, Roots: []string{rootPEM}}
+	if err := fa.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		auth       *mockAuthority
+		want       []FederatedAuthority
+		statusCode int
+	}{
+		{"ok", &mockAuthority{
+			ret1: []*x509.Certificate{root},
+			getFederatedAuthorities: func() ([]*authority.FederatedAuthority, error) {
+				return []*authority.FederatedAuthority{fa}, nil
+			},
+		}, []FederatedAuthority{{
+			Name:   "partner",
+			Source: "admin",
+			Roots: []FederatedRoot{{
+				Subject:     "CN=Google Internet Authority G2,O=Google Inc,C=US",
+				Fingerprint: "a047a37fa2d2e118a4f5095fe074d6cfe0e352425a7632bf8659c03919a6c81d",
+				NotBefore:   root.NotBefore,
+				NotAfter:    root.NotAfter,
+				Expired:     true,
+			}},
+		}}, http.StatusCreated},
+		{"fail", &mockAuthority{
+			ret1: []*x509.Certificate{root},
+			getFederatedAuthorities: func() ([]*authority.FederatedAuthority, error) {
+				return nil, fmt.Errorf("an error")
+			},
+		}, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(tt.auth).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/federation", nil)
+			w := httptest.NewRecorder()
+			h.Federation(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Federation StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				var resp FederationResponse
+				if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(resp.Authorities, tt.want) {
+					t.Errorf("caHandler.Federation Authorities = %v, wants %v", resp.Authorities, tt.want)
+				}
+			}
+		})
+	}
+}
+
 func Test_fmtPublicKey(t *testing.T) {
 	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
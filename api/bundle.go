@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/truststore"
+	"go.mozilla.org/pkcs7"
+	"go.step.sm/crypto/jose"
+)
+
+// Formats supported by the bundle endpoint.
+const (
+	BundleFormatPEM    = "pem"
+	BundleFormatDER    = "der"
+	BundleFormatPKCS7  = "p7b"
+	BundleFormatJKS    = "jks"
+	BundleFormatPKCS12 = "p12"
+	BundleFormatSPIFFE = "spiffe"
+)
+
+// Certificate types supported by the bundle endpoint.
+const (
+	BundleTypeAll           = "all"
+	BundleTypeRoots         = "roots"
+	BundleTypeIntermediates = "intermediates"
+)
+
+// spiffeBundle is the SPIFFE trust bundle representation of a set of roots.
+type spiffeBundle struct {
+	Keys []jose.JSONWebKey `json:"keys"`
+}
+
+// Bundle is an HTTP handler that returns the trust bundle of the CA in the
+// format given in the "format" query parameter: pem (default), der, p7b, jks,
+// p12 or spiffe. The "type" parameter selects the certificates in the bundle:
+// roots, intermediates, or all of them, the default except for SPIFFE bundles
+// that only contain roots. The "password" parameter sets the integrity
+// password of JKS and PKCS #12 truststores, it defaults to "changeit".
+//
+// The response contains an ETag, and a request with a matching If-None-Match
+// header returns a 304 Not Modified.
+func (h *caHandler) Bundle(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = BundleFormatPEM
+	}
+	typ := q.Get("type")
+	if typ == "" {
+		if format == BundleFormatSPIFFE {
+			typ = BundleTypeRoots
+		} else {
+			typ = BundleTypeAll
+		}
+	}
+	password := q.Get("password")
+	if password == "" {
+		password = truststore.DefaultPassword
+	}
+
+	entries, err := h.bundleEntries(typ)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	// The ETag is based on the request and the certificates because PKCS #12
+	// files use a random salt.
+	etag := bundleETag(format, typ, password, entries)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, contentType, err := encodeBundle(format, entries, password)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(body); err != nil {
+		LogError(w, errors.Wrap(err, "error writing bundle"))
+	}
+}
+
+// bundleEntries returns the certificates of the given type with the alias
+// used in truststores.
+func (h *caHandler) bundleEntries(typ string) ([]truststore.Entry, error) {
+	var roots, intermediates []*x509.Certificate
+	var err error
+	switch typ {
+	case BundleTypeAll, BundleTypeRoots, BundleTypeIntermediates:
+	default:
+		return nil, errs.BadRequest("unsupported bundle type %s", typ)
+	}
+	if typ != BundleTypeIntermediates {
+		if roots, err = h.Authority.GetRoots(); err != nil {
+			return nil, errs.ForbiddenErr(err)
+		}
+	}
+	if typ != BundleTypeRoots {
+		if intermediates, err = h.Authority.GetIntermediates(); err != nil {
+			return nil, errs.ForbiddenErr(err)
+		}
+	}
+
+	entries := make([]truststore.Entry, 0, len(roots)+len(intermediates))
+	entries = appendBundleEntries(entries, "root-ca", roots)
+	entries = appendBundleEntries(entries, "intermediate-ca", intermediates)
+	if len(entries) == 0 {
+		return nil, errs.NotFound("bundle does not contain any certificate")
+	}
+	return entries, nil
+}
+
+// appendBundleEntries appends the given certificates to the entries using the
+// alias prefix, e.g. root-ca, root-ca-2, root-ca-3.
+func appendBundleEntries(entries []truststore.Entry, prefix string, certs []*x509.Certificate) []truststore.Entry {
+	for i, crt := range certs {
+		alias := prefix
+		if i > 0 {
+			alias = fmt.Sprintf("%s-%d", prefix, i+1)
+		}
+		entries = append(entries, truststore.Entry{Alias: alias, Certificate: crt})
+	}
+	return entries
+}
+
+// encodeBundle returns the bundle in the given format and its content type.
+func encodeBundle(format string, entries []truststore.Entry, password string) ([]byte, string, error) {
+	switch format {
+	case BundleFormatPEM:
+		var buf bytes.Buffer
+		for _, e := range entries {
+			if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: e.Certificate.Raw}); err != nil {
+				return nil, "", errs.Wrap(http.StatusInternalServerError, err, "error encoding bundle")
+			}
+		}
+		return buf.Bytes(), "application/x-pem-file", nil
+	case BundleFormatDER:
+		if len(entries) != 1 {
+			return nil, "", errs.BadRequest("der bundles require a single certificate, but the bundle has %d", len(entries))
+		}
+		return entries[0].Certificate.Raw, "application/pkix-cert", nil
+	case BundleFormatPKCS7:
+		var raw []byte
+		for _, e := range entries {
+			raw = append(raw, e.Certificate.Raw...)
+		}
+		b, err := pkcs7.DegenerateCertificate(raw)
+		if err != nil {
+			return nil, "", errs.Wrap(http.StatusInternalServerError, err, "error encoding bundle")
+		}
+		return b, "application/pkcs7-mime", nil
+	case BundleFormatJKS:
+		b, err := truststore.EncodeJKS(entries, password)
+		if err != nil {
+			return nil, "", errs.Wrap(http.StatusInternalServerError, err, "error encoding bundle")
+		}
+		return b, "application/x-java-keystore", nil
+	case BundleFormatPKCS12:
+		b, err := truststore.EncodePKCS12(entries, password)
+		if err != nil {
+			return nil, "", errs.Wrap(http.StatusInternalServerError, err, "error encoding bundle")
+		}
+		return b, "application/x-pkcs12", nil
+	case BundleFormatSPIFFE:
+		bundle := spiffeBundle{Keys: make([]jose.JSONWebKey, len(entries))}
+		for i, e := range entries {
+			bundle.Keys[i] = jose.JSONWebKey{
+				Key:          e.Certificate.PublicKey,
+				Use:          "x509-svid",
+				Certificates: []*x509.Certificate{e.Certificate},
+			}
+		}
+		b, err := json.Marshal(bundle)
+		if err != nil {
+			return nil, "", errs.Wrap(http.StatusInternalServerError, err, "error encoding bundle")
+		}
+		return b, "application/json", nil
+	default:
+		return nil, "", errs.BadRequest("unsupported bundle format %s", format)
+	}
+}
+
+// bundleETag returns the strong ETag of a bundle.
+func bundleETag(format, typ, password string, entries []truststore.Entry) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", format, typ, password)
+	for _, e := range entries {
+		h.Write([]byte(e.Alias))
+		h.Write(e.Certificate.Raw)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// etagMatch returns if the value of an If-None-Match header matches the given
+// ETag. The comparison is weak as defined in RFC 7232.
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.mozilla.org/pkcs7"
+)
+
+func Test_caHandler_Bundle(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	intermediate := parseCertificate(certPEM)
+	auth := &mockAuthority{
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+		getIntermediates: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{intermediate}, nil
+		},
+	}
+
+	pemBundle := []byte(rootPEM + "\n" + certPEM + "\n")
+	tests := []struct {
+		name        string
+		auth        Authority
+		query       string
+		statusCode  int
+		contentType string
+		check       func(t *testing.T, body []byte)
+	}{
+		{"ok", auth, "", http.StatusOK, "application/x-pem-file", func(t *testing.T, body []byte) {
+			if !bytes.Equal(body, pemBundle) {
+				t.Errorf("caHandler.Bundle Body = %s, wants %s", body, pemBundle)
+			}
+		}},
+		{"ok roots", auth, "?format=pem&type=roots", http.StatusOK, "application/x-pem-file", func(t *testing.T, body []byte) {
+			if !bytes.Equal(body, []byte(rootPEM+"\n")) {
+				t.Errorf("caHandler.Bundle Body = %s, wants %s", body, rootPEM)
+			}
+		}},
+		{"ok der", auth, "?format=der&type=intermediates", http.StatusOK, "application/pkix-cert", func(t *testing.T, body []byte) {
+			if !bytes.Equal(body, intermediate.Raw) {
+				t.Errorf("caHandler.Bundle Body = %x, wants %x", body, intermediate.Raw)
+			}
+		}},
+		{"ok p7b", auth, "?format=p7b", http.StatusOK, "application/pkcs7-mime", func(t *testing.T, body []byte) {
+			p7, err := pkcs7.Parse(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p7.Certificates, []*x509.Certificate{root, intermediate}) {
+				t.Errorf("caHandler.Bundle Certificates = %v, wants %v", p7.Certificates, []*x509.Certificate{root, intermediate})
+			}
+		}},
+		{"ok jks", auth, "?format=jks&password=secret", http.StatusOK, "application/x-java-keystore", func(t *testing.T, body []byte) {
+			if !bytes.HasPrefix(body, []byte{0xFE, 0xED, 0xFE, 0xED}) {
+				t.Errorf("caHandler.Bundle Body = %x is not a JKS", body)
+			}
+		}},
+		{"ok p12", auth, "?format=p12", http.StatusOK, "application/x-pkcs12", func(t *testing.T, body []byte) {
+			if len(body) == 0 || body[0] != 0x30 {
+				t.Errorf("caHandler.Bundle Body = %x is not a PKCS #12", body)
+			}
+		}},
+		{"ok spiffe", auth, "?format=spiffe", http.StatusOK, "application/json", func(t *testing.T, body []byte) {
+			var bundle struct {
+				Keys []struct {
+					Use string   `json:"use"`
+					X5c []string `json:"x5c"`
+				} `json:"keys"`
+			}
+			if err := json.Unmarshal(body, &bundle); err != nil {
+				t.Fatal(err)
+			}
+			if len(bundle.Keys) != 1 || bundle.Keys[0].Use != "x509-svid" || len(bundle.Keys[0].X5c) != 1 {
+				t.Errorf("caHandler.Bundle Body = %s, wants a SPIFFE bundle with the root", body)
+			}
+		}},
+		{"fail der", auth, "?format=der", http.StatusBadRequest, "application/json", nil},
+		{"fail format", auth, "?format=crt", http.StatusBadRequest, "application/json", nil},
+		{"fail type", auth, "?type=leaf", http.StatusBadRequest, "application/json", nil},
+		{"fail empty", &mockAuthority{ret1: []*x509.Certificate{}}, "?type=intermediates", http.StatusNotFound, "application/json", nil},
+		{"fail roots", &mockAuthority{ret1: []*x509.Certificate{}, err: fmt.Errorf("an error")}, "", http.StatusForbidden, "application/json", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(tt.auth).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/bundle"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Bundle(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Bundle StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+			if v := res.Header.Get("Content-Type"); v != tt.contentType {
+				t.Errorf("caHandler.Bundle Content-Type = %s, wants %s", v, tt.contentType)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Bundle unexpected error = %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, body)
+			}
+		})
+	}
+}
+
+func Test_caHandler_Bundle_etag(t *testing.T) {
+	h := New(&mockAuthority{ret1: []*x509.Certificate{parseCertificate(rootPEM)}}).(*caHandler)
+	do := func(query, ifNoneMatch string) *http.Response {
+		req := httptest.NewRequest("GET", "http://example.com/bundle"+query, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.Bundle(w, req)
+		return w.Result()
+	}
+
+	res := do("?format=p12", "")
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("caHandler.Bundle StatusCode = %d, ETag = %s", res.StatusCode, etag)
+	}
+	if res := do("?format=p12", etag); res.Header.Get("ETag") != etag {
+		t.Errorf("caHandler.Bundle ETag = %s, wants %s", res.Header.Get("ETag"), etag)
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		ifNoneMatch string
+		statusCode  int
+	}{
+		{"not modified", "?format=p12", etag, http.StatusNotModified},
+		{"not modified weak", "?format=p12", `"foo", W/` + etag, http.StatusNotModified},
+		{"not modified any", "?format=p12", "*", http.StatusNotModified},
+		{"modified", "?format=p12", `"foo"`, http.StatusOK},
+		{"modified format", "?format=jks", etag, http.StatusOK},
+		{"modified password", "?format=p12&password=secret", etag, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := do(tt.query, tt.ifNoneMatch)
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.Bundle StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+		})
+	}
+}
+
+func Test_appendBundleEntries(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	entries := appendBundleEntries(nil, "root-ca", []*x509.Certificate{root, root, root})
+	var aliases []string
+	for _, e := range entries {
+		aliases = append(aliases, e.Alias)
+	}
+	if want := []string{"root-ca", "root-ca-2", "root-ca-3"}; !reflect.DeepEqual(aliases, want) {
+		t.Errorf("appendBundleEntries() aliases = %v, want %v", aliases, want)
+	}
+}
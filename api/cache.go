@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaxResponseCacheEntries is the maximum number of responses kept by a
+// ResponseCache. The responses are cached by host, so the limit prevents a
+// client from filling the memory sending requests with random hosts.
+var MaxResponseCacheEntries = 1024
+
+// ResponseCache is a middleware that caches in memory the successful responses
+// of the GET requests to the given paths. Cached responses are sent with an
+// ETag and a Cache-Control header, and requests with a matching If-None-Match
+// header get a 304 Not Modified response.
+type ResponseCache struct {
+	maxAge    time.Duration
+	cacheable func(path string) bool
+	mu        sync.RWMutex
+	entries   map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	header  http.Header
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// NewResponseCache creates a new response cache that caches the responses of
+// the paths for which cacheable returns true for the given time.
+func NewResponseCache(maxAge time.Duration, cacheable func(path string) bool) *ResponseCache {
+	return &ResponseCache{
+		maxAge:    maxAge,
+		cacheable: cacheable,
+		entries:   make(map[string]*cacheEntry),
+	}
+}
+
+// Middleware serves the cached responses and caches the ones of the next
+// handler.
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !c.cacheable(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := cacheKey(r)
+		now := time.Now()
+		if e := c.get(key, now); e != nil {
+			e.write(w, r, now)
+			return
+		}
+
+		rec := newResponseRecorder()
+		next.ServeHTTP(rec, r)
+		if rec.status != http.StatusOK {
+			rec.writeTo(w)
+			return
+		}
+
+		sum := sha256.Sum256(rec.body.Bytes())
+		e := &cacheEntry{
+			header:  rec.header,
+			body:    rec.body.Bytes(),
+			etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+			expires: now.Add(c.maxAge),
+		}
+		c.set(key, e, now)
+		e.write(w, r, now)
+	})
+}
+
+func (c *ResponseCache) get(key string, now time.Time) *cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		return e
+	}
+	return nil
+}
+
+func (c *ResponseCache) set(key string, e *cacheEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= MaxResponseCacheEntries {
+		for k, v := range c.entries {
+			if !now.Before(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= MaxResponseCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// cacheKey returns the key of a request. The responses of the ACME directory
+// contain links with the host of the request, so the host is part of the key.
+func cacheKey(r *http.Request) string {
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// write writes the cached response or, if the request has a matching
+// If-None-Match header, a 304 Not Modified response.
+func (e *cacheEntry) write(w http.ResponseWriter, r *http.Request, now time.Time) {
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = append([]string(nil), v...)
+	}
+	maxAge := int64(e.expires.Sub(now).Seconds())
+	h.Set("ETag", e.etag)
+	h.Set("Cache-Control", "public, max-age="+strconv.FormatInt(maxAge, 10))
+	if etagMatch(r.Header.Get("If-None-Match"), e.etag) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// responseRecorder is the http.ResponseWriter used to read the response of
+// the next handler.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+// writeTo writes the recorded response to the given http.ResponseWriter.
+func (r *responseRecorder) writeTo(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range r.header {
+		h[k] = v
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResponseCache_Middleware(t *testing.T) {
+	var calls int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"crts":[]}`))
+	})
+	cache := NewResponseCache(time.Minute, func(path string) bool {
+		return path != "/sign"
+	})
+	h := cache.Middleware(next)
+
+	do := func(method, target, ifNoneMatch string) *http.Response {
+		req := httptest.NewRequest(method, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := do("GET", "https://ca.example.com/roots", "")
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("first response status = %d, etag = %q", res.StatusCode, etag)
+	}
+	if got := res.Header.Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q, want %q", got, "public, max-age=60")
+	}
+	if got := res.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", got, "application/json")
+	}
+
+	res = do("GET", "https://ca.example.com/roots", "")
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") != etag || calls != 1 {
+		t.Errorf("cached response status = %d, etag = %q, calls = %d", res.StatusCode, res.Header.Get("ETag"), calls)
+	}
+
+	res = do("GET", "https://ca.example.com/roots", `"foo", W/`+etag)
+	if res.StatusCode != http.StatusNotModified || calls != 1 {
+		t.Errorf("conditional response status = %d, calls = %d", res.StatusCode, calls)
+	}
+
+	// Other hosts, non cacheable paths, errors and other methods are not
+	// served from the cache.
+	do("GET", "https://other.example.com/roots", "")
+	do("GET", "https://ca.example.com/sign", "")
+	do("POST", "https://ca.example.com/roots", "")
+	if res := do("GET", "https://ca.example.com/fail", ""); res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("error response status = %d, want %d", res.StatusCode, http.StatusInternalServerError)
+	}
+	do("GET", "https://ca.example.com/fail", "")
+	if calls != 6 {
+		t.Errorf("calls = %d, want 6", calls)
+	}
+}
+
+func Test_etagMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"foo", "abc"`, true},
+		{"*", true},
+		{`"foo"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatch(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("etagMatch(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
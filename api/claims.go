@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// EvaluateClaimsRequest is the request body to evaluate a hypothetical
+// certificate request against the claims of a provisioner.
+type EvaluateClaimsRequest struct {
+	Provisioner string `json:"provisioner"`
+	provisioner.ClaimsEvaluationRequest
+}
+
+// Validate checks the fields of the EvaluateClaimsRequest.
+func (s *EvaluateClaimsRequest) Validate() error {
+	if s.Provisioner == "" {
+		return errs.BadRequest("missing provisioner")
+	}
+	return nil
+}
+
+// EvaluateClaims is an HTTP handler that returns the effective claims of a
+// provisioner and whether they would allow the given request, and if not, the
+// reasons why it would be rejected.
+func (h *caHandler) EvaluateClaims(w http.ResponseWriter, r *http.Request) {
+	var body EvaluateClaimsRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	e, err := h.Authority.EvaluateClaims(body.Provisioner, &body.ClaimsEvaluationRequest)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	JSON(w, e)
+}
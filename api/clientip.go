@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// ClientIP is a middleware that adds the IP address of the client to the
+// context of the request, so tokens bound to an IP address can be validated.
+// Only the address of the connection is used, forwarding headers are not
+// trusted.
+func ClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := parseClientIP(r.RemoteAddr); ip != nil {
+			r = r.WithContext(provisioner.NewContextWithClientIP(r.Context(), ip))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseClientIP returns the IP address in the given host:port address.
+func parseClientIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       net.IP
+	}{
+		{"ipv4", "10.1.2.3:1234", net.ParseIP("10.1.2.3")},
+		{"ipv6", "[2001:db8::1]:1234", net.ParseIP("2001:db8::1")},
+		{"no port", "10.1.2.3", net.ParseIP("10.1.2.3")},
+		{"invalid", "pipe", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got net.IP
+			h := ClientIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = provisioner.ClientIPFromContext(r.Context())
+			}))
+			req := httptest.NewRequest("POST", "/sign", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "192.168.1.1")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if !got.Equal(tt.want) {
+				t.Errorf("ClientIP() ip = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// CRL is an HTTP handler that returns the certificate revocation list of the
+// intermediate in DER, or in PEM if the "format" query parameter is "pem".
+func (h *caHandler) CRL(w http.ResponseWriter, r *http.Request) {
+	crl, err := h.Authority.GetCertificateRevocationList()
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "pem" {
+		crl = pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+		w.Header().Set("Content-Type", "application/x-pem-file")
+	} else {
+		w.Header().Set("Content-Type", "application/pkix-crl")
+	}
+	if _, err := w.Write(crl); err != nil {
+		LogError(w, errors.Wrap(err, "error writing crl"))
+	}
+}
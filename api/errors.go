@@ -3,8 +3,10 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/acme"
@@ -29,6 +31,18 @@ func WriteError(w http.ResponseWriter, err error) {
 		w.Header().Set("Content-Type", "application/json")
 	}
 
+	// Use the message configured by the operator if any
+	if e, ok := err.(*errs.Error); ok {
+		if msg, ok := errs.Localize(w, e.ErrorCode()); ok {
+			e.Msg = msg
+		}
+	}
+
+	// Tell the client when it can retry the request
+	if e, ok := err.(*errs.Error); ok && e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(e.RetryAfter.Seconds())), 10))
+	}
+
 	cause := errors.Cause(err)
 	if sc, ok := err.(errs.StatusCoder); ok {
 		w.WriteHeader(sc.StatusCode())
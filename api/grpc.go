@@ -0,0 +1,469 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api/pb"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServiceName is the name of the gRPC service of the CA. The service and
+// its messages are defined in api/pb/ca.proto.
+const GRPCServiceName = "step.ca.v1.CA"
+
+// CAServer is the interface implemented by the gRPC service of the CA.
+type CAServer interface {
+	Sign(ctx context.Context, req *pb.SignRequest) (*pb.SignResponse, error)
+	Renew(ctx context.Context, req *pb.RenewRequest) (*pb.SignResponse, error)
+	Revoke(ctx context.Context, req *pb.RevokeRequest) (*pb.RevokeResponse, error)
+	SSHSign(ctx context.Context, req *pb.SSHSignRequest) (*pb.SSHSignResponse, error)
+	SubscribeRenewal(req *pb.RenewRequest, stream RenewalStream) error
+}
+
+// RenewalStream is the server side of a renewal subscription.
+type RenewalStream interface {
+	Send(*pb.SignResponse) error
+	Context() context.Context
+	SetTrailer(metadata.MD)
+}
+
+// RegisterCAServer registers the gRPC service of the CA in the given server.
+func RegisterCAServer(s *grpc.Server, srv CAServer) {
+	s.RegisterService(&grpcServiceDesc, srv)
+}
+
+// NewCAServer returns the implementation of the gRPC service of the CA using
+// the given authority.
+func NewCAServer(authority Authority) CAServer {
+	return &grpcHandler{
+		h: &caHandler{Authority: authority},
+	}
+}
+
+// grpcHandler implements the CAServer interface using the same methods as the
+// HTTP handlers.
+type grpcHandler struct {
+	h *caHandler
+}
+
+// Sign signs a certificate request.
+func (g *grpcHandler) Sign(ctx context.Context, req *pb.SignRequest) (*pb.SignResponse, error) {
+	ctx = withPeerIP(ctx)
+	body, err := signRequestFromProto(req)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	resp, err := g.h.sign(ctx, body)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return signResponseToProto(resp), nil
+}
+
+// Renew renews the peer certificate of the connection or, if there is none,
+// the certificate in the renewal token of the request.
+func (g *grpcHandler) Renew(ctx context.Context, req *pb.RenewRequest) (*pb.SignResponse, error) {
+	cert, err := g.renewCertificate(ctx, req)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	csr, err := parseProtoCSR(req.GetCsr())
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	resp, err := g.h.renew(ctx, cert, csr)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return signResponseToProto(resp), nil
+}
+
+// Revoke revokes a certificate using the token of the request or the peer
+// certificate of the connection.
+func (g *grpcHandler) Revoke(ctx context.Context, req *pb.RevokeRequest) (*pb.RevokeResponse, error) {
+	ctx = withPeerIP(ctx)
+	body := &RevokeRequest{
+		Serial:     req.GetSerial(),
+		OTT:        req.GetOtt(),
+		ReasonCode: int(req.GetReasonCode()),
+		Reason:     req.GetReason(),
+		Passive:    req.GetPassive(),
+	}
+	if _, err := g.h.revoke(ctx, body, peerCertificate(ctx)); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &pb.RevokeResponse{Status: "ok"}, nil
+}
+
+// SSHSign signs an SSH certificate.
+func (g *grpcHandler) SSHSign(ctx context.Context, req *pb.SSHSignRequest) (*pb.SSHSignResponse, error) {
+	ctx = withPeerIP(ctx)
+	body, err := sshSignRequestFromProto(req)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	resp, err := g.h.sshSign(ctx, body)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return sshSignResponseToProto(resp), nil
+}
+
+// SubscribeRenewal renews the peer certificate of the connection, or the
+// certificate in the renewal token of the request, each time two thirds of its
+// lifetime have elapsed, and sends the renewed certificate to the stream. The
+// subscription ends when the client cancels it or when a renewal fails. The
+// CSR of the request is ignored, the renewals keep the names of the
+// certificate.
+func (g *grpcHandler) SubscribeRenewal(req *pb.RenewRequest, stream RenewalStream) error {
+	ctx := stream.Context()
+	cert, err := g.renewCertificate(ctx, req)
+	if err != nil {
+		return grpcStreamError(stream, err)
+	}
+
+	timer := time.NewTimer(renewIn(cert))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		resp, err := g.h.renew(ctx, cert, nil)
+		if err != nil {
+			// Retry if the renewal window has not started yet
+			if e, ok := err.(*errs.Error); ok && e.RetryAfter > 0 {
+				timer.Reset(e.RetryAfter)
+				continue
+			}
+			return grpcStreamError(stream, err)
+		}
+		if err := stream.Send(signResponseToProto(resp)); err != nil {
+			return err
+		}
+		cert = resp.ServerPEM.Certificate
+		timer.Reset(renewIn(cert))
+	}
+}
+
+// renewCertificate returns the peer certificate of the connection or, if there
+// is none, the certificate in the renewal token of the request.
+func (g *grpcHandler) renewCertificate(ctx context.Context, req *pb.RenewRequest) (*x509.Certificate, error) {
+	if cert := peerCertificate(ctx); cert != nil {
+		return cert, nil
+	}
+	if req.GetToken() == "" {
+		return nil, errs.BadRequest("missing peer certificate")
+	}
+	cert, err := g.h.Authority.AuthorizeRenewToken(ctx, req.GetToken())
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "grpc.Renew")
+	}
+	return cert, nil
+}
+
+// signRequestFromProto converts a gRPC sign request to the request of the HTTP
+// API.
+func signRequestFromProto(req *pb.SignRequest) (*SignRequest, error) {
+	csr, err := parseProtoCSR(req.GetCsr())
+	if err != nil {
+		return nil, err
+	}
+	body := &SignRequest{
+		CsrPEM:       CertificateRequest{csr},
+		OTT:          req.GetOtt(),
+		TemplateData: json.RawMessage(req.GetTemplateData()),
+		Labels:       req.GetLabels(),
+	}
+	if body.NotAfter, err = ParseTimeDuration(req.GetNotAfter()); err != nil {
+		return nil, errs.BadRequestErr(errors.Wrap(err, "error parsing notAfter"))
+	}
+	if body.NotBefore, err = ParseTimeDuration(req.GetNotBefore()); err != nil {
+		return nil, errs.BadRequestErr(errors.Wrap(err, "error parsing notBefore"))
+	}
+	if b := req.GetAttestation(); len(b) > 0 {
+		body.Attestation = new(keyattest.Statement)
+		if err := json.Unmarshal(b, body.Attestation); err != nil {
+			return nil, errs.BadRequestErr(errors.Wrap(err, "error decoding attestation"))
+		}
+	}
+	return body, nil
+}
+
+// signResponseToProto converts a sign response of the HTTP API to the gRPC
+// response.
+func signResponseToProto(resp *SignResponse) *pb.SignResponse {
+	r := &pb.SignResponse{
+		Crt: resp.ServerPEM.Raw,
+	}
+	if resp.CaPEM.Certificate != nil {
+		r.Ca = resp.CaPEM.Raw
+	}
+	for _, c := range resp.CertChainPEM {
+		r.CertChain = append(r.CertChain, c.Raw)
+	}
+	return r
+}
+
+// sshSignRequestFromProto converts a gRPC SSH sign request to the request of
+// the HTTP API.
+func sshSignRequestFromProto(req *pb.SSHSignRequest) (*SSHSignRequest, error) {
+	csr, err := parseProtoCSR(req.GetIdentityCsr())
+	if err != nil {
+		return nil, err
+	}
+	body := &SSHSignRequest{
+		PublicKey:        req.GetPublicKey(),
+		OTT:              req.GetOtt(),
+		CertType:         req.GetCertType(),
+		KeyID:            req.GetKeyId(),
+		Principals:       req.GetPrincipals(),
+		AddUserPublicKey: req.GetAddUserPublicKey(),
+		IdentityCSR:      CertificateRequest{csr},
+		TemplateData:     json.RawMessage(req.GetTemplateData()),
+	}
+	if body.ValidAfter, err = ParseTimeDuration(req.GetValidAfter()); err != nil {
+		return nil, errs.BadRequestErr(errors.Wrap(err, "error parsing validAfter"))
+	}
+	if body.ValidBefore, err = ParseTimeDuration(req.GetValidBefore()); err != nil {
+		return nil, errs.BadRequestErr(errors.Wrap(err, "error parsing validBefore"))
+	}
+	return body, nil
+}
+
+// sshSignResponseToProto converts an SSH sign response of the HTTP API to the
+// gRPC response.
+func sshSignResponseToProto(resp *SSHSignResponse) *pb.SSHSignResponse {
+	r := &pb.SSHSignResponse{
+		KeyId:                  resp.KeyID,
+		Serial:                 resp.Serial,
+		KeyFingerprint:         resp.KeyFingerprint,
+		CertificateFingerprint: resp.CertificateFingerprint,
+	}
+	if resp.Certificate.Certificate != nil {
+		r.Crt = resp.Certificate.Marshal()
+	}
+	if resp.AddUserCertificate != nil && resp.AddUserCertificate.Certificate != nil {
+		r.AddUserCrt = resp.AddUserCertificate.Marshal()
+	}
+	for _, c := range resp.IdentityCertificate {
+		r.IdentityCrt = append(r.IdentityCrt, c.Raw)
+	}
+	return r
+}
+
+// parseProtoCSR parses an optional DER encoded certificate request.
+func parseProtoCSR(der []byte) (*x509.CertificateRequest, error) {
+	if len(der) == 0 {
+		return nil, nil
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errs.BadRequestErr(errors.Wrap(err, "error parsing csr"))
+	}
+	return csr, nil
+}
+
+// peerCertificate returns the verified client certificate of the connection.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			return info.State.PeerCertificates[0]
+		}
+	}
+	return nil
+}
+
+// withPeerIP adds the IP address of the peer of the connection to the context,
+// so tokens bound to an IP address can be validated.
+func withPeerIP(ctx context.Context) context.Context {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if ip := parseClientIP(p.Addr.String()); ip != nil {
+			return provisioner.NewContextWithClientIP(ctx, ip)
+		}
+	}
+	return ctx
+}
+
+// renewIn returns the time to wait before renewing a certificate, after two
+// thirds of its lifetime.
+func renewIn(cert *x509.Certificate) time.Duration {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return time.Until(cert.NotAfter.Add(-lifetime / 3))
+}
+
+// grpcError converts an error to a gRPC status error. As in the HTTP API, only
+// the public message of the error is sent to the client.
+func grpcError(ctx context.Context, err error) error {
+	st, md := grpcStatus(err)
+	if md != nil {
+		grpc.SetTrailer(ctx, md)
+	}
+	return st.Err()
+}
+
+// grpcStreamError is the stream version of grpcError.
+func grpcStreamError(stream RenewalStream, err error) error {
+	st, md := grpcStatus(err)
+	if md != nil {
+		stream.SetTrailer(md)
+	}
+	return st.Err()
+}
+
+// GRPCStatusError converts an error to a gRPC status error in the same way as
+// the gRPC service of the CA. It is used by other gRPC services served by the
+// CA.
+func GRPCStatusError(err error) error {
+	st, _ := grpcStatus(err)
+	return st.Err()
+}
+
+// grpcStatus returns the gRPC status of the given error and, if the request
+// can be retried, a retry-after trailer with the number of seconds to wait.
+func grpcStatus(err error) (*status.Status, metadata.MD) {
+	e, ok := err.(*errs.Error)
+	if !ok {
+		e = errs.InternalServerErr(err).(*errs.Error)
+	}
+	var md metadata.MD
+	if e.RetryAfter > 0 {
+		md = metadata.Pairs("retry-after", strconv.FormatInt(int64(math.Ceil(e.RetryAfter.Seconds())), 10))
+	}
+	var msg string
+	if len(e.Msg) > 0 {
+		msg = e.Msg
+	} else {
+		msg = http.StatusText(e.Status)
+	}
+	return status.New(grpcCode(e.StatusCode()), msg), md
+}
+
+// grpcCode returns the gRPC code that corresponds to an HTTP status code.
+func grpcCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: GRPCServiceName,
+	HandlerType: (*CAServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Sign", Handler: grpcSignHandler},
+		{MethodName: "Renew", Handler: grpcRenewHandler},
+		{MethodName: "Revoke", Handler: grpcRevokeHandler},
+		{MethodName: "SSHSign", Handler: grpcSSHSignHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "SubscribeRenewal", Handler: grpcSubscribeRenewalHandler, ServerStreams: true},
+	},
+	Metadata: "api/pb/ca.proto",
+}
+
+func grpcSignHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.SignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CAServer).Sign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GRPCServiceName + "/Sign"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CAServer).Sign(ctx, req.(*pb.SignRequest))
+	})
+}
+
+func grpcRenewHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.RenewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CAServer).Renew(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GRPCServiceName + "/Renew"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CAServer).Renew(ctx, req.(*pb.RenewRequest))
+	})
+}
+
+func grpcRevokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.RevokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CAServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GRPCServiceName + "/Revoke"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CAServer).Revoke(ctx, req.(*pb.RevokeRequest))
+	})
+}
+
+func grpcSSHSignHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.SSHSignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CAServer).SSHSign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GRPCServiceName + "/SSHSign"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CAServer).SSHSign(ctx, req.(*pb.SSHSignRequest))
+	})
+}
+
+func grpcSubscribeRenewalHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(pb.RenewRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(CAServer).SubscribeRenewal(in, &renewalStream{stream})
+}
+
+// renewalStream implements the RenewalStream interface.
+type renewalStream struct {
+	grpc.ServerStream
+}
+
+func (s *renewalStream) Send(resp *pb.SignResponse) error {
+	return s.ServerStream.SendMsg(resp)
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/api/pb"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newGRPCTestConn(t *testing.T, auth Authority) *grpc.ClientConn {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterCAServer(srv, NewCAServer(auth))
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.Dial()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestCAServer_Sign(t *testing.T) {
+	conn := newGRPCTestConn(t, &mockAuthority{
+		ret1: parseCertificate(certPEM), ret2: parseCertificate(rootPEM),
+		authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+			if ott != "foobarzar" {
+				return nil, fmt.Errorf("an error")
+			}
+			return nil, nil
+		},
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+	})
+
+	csr := parseCertificateRequest(csrPEM)
+	tests := []struct {
+		name     string
+		req      *pb.SignRequest
+		wantCode codes.Code
+	}{
+		{"ok", &pb.SignRequest{Csr: csr.Raw, Ott: "foobarzar", NotAfter: "24h", Labels: map[string]string{"env": "test"}}, codes.OK},
+		{"fail validate", &pb.SignRequest{Csr: csr.Raw}, codes.InvalidArgument},
+		{"fail csr", &pb.SignRequest{Csr: []byte("csr"), Ott: "foobarzar"}, codes.InvalidArgument},
+		{"fail notAfter", &pb.SignRequest{Csr: csr.Raw, Ott: "foobarzar", NotAfter: "tomorrow"}, codes.InvalidArgument},
+		{"fail attestation", &pb.SignRequest{Csr: csr.Raw, Ott: "foobarzar", Attestation: []byte("{")}, codes.InvalidArgument},
+		{"fail authorize", &pb.SignRequest{Csr: csr.Raw, Ott: "bad"}, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := new(pb.SignResponse)
+			err := conn.Invoke(context.Background(), "/"+GRPCServiceName+"/Sign", tt.req, resp)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("CAServer.Sign() code = %v, want %v", code, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			crt, err := x509.ParseCertificate(resp.Crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crt.SerialNumber.Cmp(parseCertificate(certPEM).SerialNumber) != 0 {
+				t.Errorf("CAServer.Sign() serial = %s, want %s", crt.SerialNumber, parseCertificate(certPEM).SerialNumber)
+			}
+			if !bytes.Equal(resp.Ca, parseCertificate(rootPEM).Raw) || len(resp.CertChain) != 2 {
+				t.Errorf("CAServer.Sign() ca = %x, chain = %d, want the root and a chain of 2", resp.Ca, len(resp.CertChain))
+			}
+		})
+	}
+}
+
+func TestCAServer_Renew(t *testing.T) {
+	conn := newGRPCTestConn(t, &mockAuthority{
+		ret1: parseCertificate(certPEM), ret2: parseCertificate(rootPEM),
+		authorizeRenewToken: func(ctx context.Context, ott string) (*x509.Certificate, error) {
+			if ott != "token" {
+				return nil, errs.Unauthorized("an error")
+			}
+			return parseCertificate(certPEM), nil
+		},
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+	})
+
+	tests := []struct {
+		name     string
+		req      *pb.RenewRequest
+		wantCode codes.Code
+	}{
+		{"ok", &pb.RenewRequest{Token: "token"}, codes.OK},
+		{"fail missing", &pb.RenewRequest{}, codes.InvalidArgument},
+		{"fail token", &pb.RenewRequest{Token: "bad"}, codes.Unauthenticated},
+		{"fail csr", &pb.RenewRequest{Token: "token", Csr: []byte("csr")}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := new(pb.SignResponse)
+			err := conn.Invoke(context.Background(), "/"+GRPCServiceName+"/Renew", tt.req, resp)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("CAServer.Renew() code = %v, want %v", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCAServer_SubscribeRenewal(t *testing.T) {
+	now := time.Now()
+	cert := parseCertificate(certPEM)
+	// Renew immediately, two thirds of the lifetime have already elapsed.
+	expiring := *cert
+	expiring.NotBefore = now.Add(-2 * time.Hour)
+	expiring.NotAfter = now.Add(time.Hour / 2)
+
+	var renewals int
+	conn := newGRPCTestConn(t, &mockAuthority{
+		authorizeRenewToken: func(ctx context.Context, ott string) (*x509.Certificate, error) {
+			return &expiring, nil
+		},
+		renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+			renewals++
+			if renewals > 1 {
+				return nil, errs.NewErr(http.StatusTooManyRequests, fmt.Errorf("too early"),
+					errs.WithRetryAfter(time.Hour))
+			}
+			return []*x509.Certificate{&expiring, parseCertificate(rootPEM)}, nil
+		},
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{StreamName: "SubscribeRenewal", ServerStreams: true}, "/"+GRPCServiceName+"/SubscribeRenewal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&pb.RenewRequest{Token: "token"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := new(pb.SignResponse)
+	if err := stream.RecvMsg(resp); err != nil {
+		t.Fatalf("SubscribeRenewal() error = %v", err)
+	}
+	if !bytes.Equal(resp.Crt, cert.Raw) {
+		t.Errorf("SubscribeRenewal() certificate = %x, want %x", resp.Crt, cert.Raw)
+	}
+}
+
+func Test_grpcStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantCode       codes.Code
+		wantMessage    string
+		wantRetryAfter []string
+	}{
+		{"unauthorized", errs.Unauthorized("an error"), codes.Unauthenticated, errs.UnauthorizedDefaultMsg, nil},
+		{"forbidden", errs.Forbidden("an error"), codes.PermissionDenied, errs.ForbiddenDefaultMsg, nil},
+		{"internal", fmt.Errorf("an error"), codes.Internal, errs.InternalServerErrorDefaultMsg, nil},
+		{"retry", errs.NewErr(http.StatusTooManyRequests, fmt.Errorf("an error"), errs.WithRetryAfter(1500*time.Millisecond)), codes.ResourceExhausted, http.StatusText(http.StatusTooManyRequests), []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, md := grpcStatus(tt.err)
+			if st.Code() != tt.wantCode {
+				t.Errorf("grpcStatus() code = %v, want %v", st.Code(), tt.wantCode)
+			}
+			if st.Message() != tt.wantMessage {
+				t.Errorf("grpcStatus() message = %q, want %q", st.Message(), tt.wantMessage)
+			}
+			var got []string
+			if md != nil {
+				got = md.Get("retry-after")
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantRetryAfter) {
+				t.Errorf("grpcStatus() retry-after = %v, want %v", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+)
+
+// MaxBodySize returns a middleware that limits the size of the request bodies
+// to the given number of bytes. Reading more than the limit from the body
+// returns an error with the 413 Request Entity Too Large status, so every
+// handler reports it in its own format. If the Content-Length is over the limit
+// the error is returned without reading the body. A limit of 0 disables the
+// middleware.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil && r.Body != http.NoBody {
+				body := &maxBytesReader{w: w, r: r.Body, n: limit, limit: limit}
+				if r.ContentLength > limit {
+					body.tooLarge()
+				}
+				r.Body = body
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsRequestTooLarge returns true if the error was returned reading a request
+// body larger than the limit.
+func IsRequestTooLarge(err error) bool {
+	e, ok := err.(*errs.Error)
+	return ok && e.StatusCode() == http.StatusRequestEntityTooLarge
+}
+
+func requestTooLargeError(limit int64) error {
+	return errs.NewErr(http.StatusRequestEntityTooLarge,
+		errors.Errorf("request body is larger than %d bytes", limit),
+		errs.WithMessage("The request body is too large."))
+}
+
+// maxBytesReader is like the reader returned by http.MaxBytesReader, but it
+// returns an error that is written as a 413 response.
+type maxBytesReader struct {
+	w     http.ResponseWriter
+	r     io.ReadCloser
+	n     int64
+	limit int64
+	err   error
+}
+
+func (l *maxBytesReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read one byte more than the remaining bytes to know if the body is
+	// larger than the limit.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) <= l.n {
+		l.n -= int64(n)
+		l.err = err
+		return n, err
+	}
+
+	n = int(l.n)
+	l.n = 0
+	l.tooLarge()
+	return n, l.err
+}
+
+// tooLarge makes the reader fail with the 413 error.
+func (l *maxBytesReader) tooLarge() {
+	// The connection cannot be reused because the rest of the body is not
+	// read.
+	l.w.Header().Set("Connection", "close")
+	l.err = requestTooLargeError(l.limit)
+}
+
+func (l *maxBytesReader) Close() error {
+	return l.r.Close()
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	type request struct {
+		Name string `json:"name"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := ReadJSON(r.Body, &req); err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Write([]byte(req.Name))
+	}
+
+	tests := []struct {
+		name          string
+		limit         int64
+		body          string
+		contentLength int64
+		statusCode    int
+		wantBody      string
+	}{
+		{"ok", 64, `{"name":"foo"}`, 14, 200, "foo"},
+		{"ok/disabled", 0, `{"name":"foo"}`, 14, 200, "foo"},
+		{"ok/exact", 14, `{"name":"foo"}`, 14, 200, "foo"},
+		{"fail/content-length", 8, `{"name":"foo"}`, 14, 413, ""},
+		{"fail/unknown-length", 8, `{"name":"foo"}`, -1, 413, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/sign", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			MaxBodySize(tt.limit)(http.HandlerFunc(handler)).ServeHTTP(w, req)
+			res := w.Result()
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("MaxBodySize() status = %d, want %d", res.StatusCode, tt.statusCode)
+			}
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.statusCode == 413 {
+				if got := res.Header.Get("Connection"); got != "close" {
+					t.Errorf("MaxBodySize() Connection = %q, want close", got)
+				}
+				return
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("MaxBodySize() body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestIsRequestTooLarge(t *testing.T) {
+	if !IsRequestTooLarge(requestTooLargeError(10)) {
+		t.Error("IsRequestTooLarge() = false, want true")
+	}
+	if IsRequestTooLarge(http.ErrBodyNotAllowed) {
+		t.Error("IsRequestTooLarge() = true, want false")
+	}
+}
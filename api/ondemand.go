@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/pemutil"
+)
+
+// OnDemandRequest is the request body for an on-demand certificate request.
+type OnDemandRequest struct {
+	Domain string `json:"domain"`
+}
+
+// Validate checks the fields of the OnDemandRequest.
+func (s *OnDemandRequest) Validate() error {
+	if s.Domain == "" {
+		return errs.BadRequest("missing domain")
+	}
+	return nil
+}
+
+// OnDemandResponse is the response object of the on-demand certificate request.
+type OnDemandResponse struct {
+	SignResponse
+	KeyPEM string `json:"key"`
+}
+
+// OnDemand is an HTTP handler that creates a new private key and certificate
+// for the domain in the request body. The request is authenticated using the
+// client certificate in the TLS connection, that must have been verified by
+// the TLS handshake.
+func (h *caHandler) OnDemand(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		WriteError(w, errs.Unauthorized("missing peer certificate"))
+		return
+	}
+	if len(r.TLS.VerifiedChains) == 0 {
+		WriteError(w, errs.Unauthorized("peer certificate has not been verified"))
+		return
+	}
+
+	var body OnDemandRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	certChain, signer, err := h.Authority.SignOnDemand(r.TLS.VerifiedChains[0][0], body.Domain)
+	if err != nil {
+		WriteError(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.OnDemand"))
+		return
+	}
+	block, err := pemutil.Serialize(signer)
+	if err != nil {
+		WriteError(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.OnDemand"))
+		return
+	}
+
+	certChainPEM := certChainToPEM(certChain)
+	var caPEM Certificate
+	if len(certChainPEM) > 1 {
+		caPEM = certChainPEM[1]
+	}
+
+	LogCertificate(w, certChain[0])
+	JSONStatus(w, &OnDemandResponse{
+		SignResponse: SignResponse{
+			ServerPEM:    certChainPEM[0],
+			CaPEM:        caPEM,
+			CertChainPEM: certChainPEM,
+			TLSOptions:   h.Authority.GetTLSOptions(),
+		},
+		KeyPEM: string(pem.EncodeToMemory(block)),
+	}, http.StatusCreated)
+}
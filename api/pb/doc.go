@@ -0,0 +1,5 @@
+// Package pb contains the protocol buffer messages of the gRPC service of the
+// CA, defined in ca.proto.
+package pb
+
+//go:generate protoc --proto_path=../.. --go_out=../.. --go_opt=paths=source_relative api/pb/ca.proto
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/authority/timing"
+	"github.com/smallstep/certificates/errs"
+)
+
+// PIVEnrollRequest is the request body for the enrollment of a key generated
+// in a YubiKey.
+type PIVEnrollRequest struct {
+	CsrPEM      CertificateRequest   `json:"csr"`
+	OTT         string               `json:"ott"`
+	Attestation *keyattest.Statement `json:"attestation"`
+	NotAfter    TimeDuration         `json:"notAfter,omitempty"`
+	NotBefore   TimeDuration         `json:"notBefore,omitempty"`
+}
+
+// Validate checks the fields of the PIVEnrollRequest.
+func (s *PIVEnrollRequest) Validate() error {
+	if s.CsrPEM.CertificateRequest == nil {
+		return errs.BadRequest("missing csr")
+	}
+	if err := s.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+		return errs.Wrap(http.StatusBadRequest, err, "invalid csr")
+	}
+	if s.OTT == "" {
+		return errs.BadRequest("missing ott")
+	}
+	if s.Attestation == nil {
+		return errs.BadRequest("missing attestation")
+	}
+	return nil
+}
+
+// PIVEnroll is an HTTP handler that signs a certificate for a key generated
+// in a YubiKey. The request must include the PIV attestation of the key, and
+// the certificate is marked as hardware-bound.
+func (h *caHandler) PIVEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx, tb := timing.NewContext(r.Context())
+	defer LogTiming(w, tb)
+
+	var body PIVEnrollRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	opts := provisioner.SignOptions{
+		NotBefore: body.NotBefore,
+		NotAfter:  body.NotAfter,
+	}
+
+	tb.Start(timing.Authorization)
+	signOpts, err := h.Authority.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), body.OTT)
+	if err != nil {
+		WriteError(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	certChain, err := h.Authority.EnrollPIV(ctx, body.CsrPEM.CertificateRequest, body.Attestation, opts, signOpts...)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	certChainPEM := certChainToPEM(certChain)
+	var caPEM Certificate
+	if len(certChainPEM) > 1 {
+		caPEM = certChainPEM[1]
+	}
+
+	LogCertificate(w, certChain[0])
+	JSONStatus(w, &SignResponse{
+		ServerPEM:    certChainPEM[0],
+		CaPEM:        caPEM,
+		CertChainPEM: certChainPEM,
+		TLSOptions:   h.Authority.GetTLSOptions(),
+	}, http.StatusCreated)
+}
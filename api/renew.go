@@ -1,35 +1,127 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"io"
 	"net/http"
 
 	"github.com/smallstep/certificates/errs"
 )
 
+// RenewRequest is the request body of a renewal. The token is required
+// without mTLS.
+type RenewRequest struct {
+	// Token is a JWT signed with the key of the certificate to renew, which is
+	// included with its chain in the x5c header.
+	Token string `json:"token"`
+	// CSR optionally requests other subject alternative names than the ones
+	// of the certificate, e.g. a subset of them. It must be signed by the key
+	// of the certificate, and the renewal policy of the authority must allow
+	// the requested names.
+	CSR CertificateRequest `json:"csr,omitempty"`
+}
+
+// Validate checks the fields of the RenewRequest and returns nil if they are
+// ok or an error if something is wrong.
+func (s *RenewRequest) Validate() error {
+	if s.Token == "" {
+		return errs.BadRequest("missing token")
+	}
+	return nil
+}
+
 // Renew uses the information of certificate in the TLS connection to create a
-// new one.
+// new one. Clients that cannot use mTLS can send a renewal token in the
+// request body instead. A CSR in the request body can request a subset or
+// superset of the subject alternative names of the certificate.
 func (h *caHandler) Renew(w http.ResponseWriter, r *http.Request) {
-	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
-		WriteError(w, errs.BadRequest("missing peer certificate"))
+	body, err := readRenewRequest(r)
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
 
-	certChain, err := h.Authority.Renew(r.TLS.PeerCertificates[0])
+	cert, err := h.getRenewCertificate(r, body)
 	if err != nil {
-		WriteError(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Renew"))
+		WriteError(w, err)
 		return
 	}
+
+	var csr *x509.CertificateRequest
+	if body != nil {
+		csr = body.CSR.CertificateRequest
+	}
+	resp, err := h.renew(r.Context(), cert, csr)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	LogCertificate(w, resp.ServerPEM.Certificate)
+	JSONStatus(w, resp, http.StatusCreated)
+}
+
+// renew renews the given certificate. If the CSR is not nil, the new
+// certificate has the subject alternative names of the CSR.
+func (h *caHandler) renew(ctx context.Context, cert *x509.Certificate, csr *x509.CertificateRequest) (*SignResponse, error) {
+	var certChain []*x509.Certificate
+	var err error
+	if csr != nil {
+		certChain, err = h.Authority.RenewWithCSR(ctx, cert, csr)
+	} else {
+		certChain, err = h.Authority.RenewWithContext(ctx, cert)
+	}
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Renew")
+	}
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
 		caPEM = certChainPEM[1]
 	}
-
-	LogCertificate(w, certChain[0])
-	JSONStatus(w, &SignResponse{
+	return &SignResponse{
 		ServerPEM:    certChainPEM[0],
 		CaPEM:        caPEM,
 		CertChainPEM: certChainPEM,
 		TLSOptions:   h.Authority.GetTLSOptions(),
-	}, http.StatusCreated)
+	}, nil
+}
+
+// readRenewRequest reads the optional body of a renewal request. It returns
+// nil if the request does not have a body. The body is read to detect empty
+// ones, because the content length is unknown in chunked requests.
+func readRenewRequest(r *http.Request) (*RenewRequest, error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil, nil
+	}
+	br := bufio.NewReader(r.Body)
+	if _, err := br.Peek(1); err == io.EOF {
+		return nil, nil
+	}
+	var body RenewRequest
+	if err := ReadJSON(br, &body); err != nil {
+		return nil, errs.Wrap(http.StatusBadRequest, err, "error reading request body")
+	}
+	return &body, nil
+}
+
+// getRenewCertificate returns the peer certificate of the TLS connection or, if
+// there is none, the certificate in the renewal token of the request body.
+func (h *caHandler) getRenewCertificate(r *http.Request, body *RenewRequest) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], nil
+	}
+	if body == nil {
+		return nil, errs.BadRequest("missing peer certificate")
+	}
+	if err := body.Validate(); err != nil {
+		return nil, err
+	}
+	cert, err := h.Authority.AuthorizeRenewToken(r.Context(), body.Token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "cahandler.Renew")
+	}
+	return cert, nil
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
 
 	"github.com/smallstep/certificates/authority"
@@ -53,10 +54,35 @@ func (h *caHandler) Revoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := body.Validate(); err != nil {
+	if len(body.OTT) > 0 {
+		logOtt(w, body.OTT)
+	}
+
+	var peer *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		peer = r.TLS.PeerCertificates[0]
+	}
+
+	opts, err := h.revoke(r.Context(), &body, peer)
+	if err != nil {
 		WriteError(w, err)
 		return
 	}
+	if opts.MTLS {
+		LogCertificate(w, opts.Crt)
+	}
+
+	logRevoke(w, opts)
+	JSON(w, &RevokeResponse{Status: "ok"})
+}
+
+// revoke validates the given revocation request and revokes the certificate.
+// The request is authorized with its token or, if it does not have one, with
+// the given peer certificate, that must be the certificate to revoke.
+func (h *caHandler) revoke(ctx context.Context, body *RevokeRequest, peer *x509.Certificate) (*authority.RevokeOptions, error) {
+	if err := body.Validate(); err != nil {
+		return nil, err
+	}
 
 	opts := &authority.RevokeOptions{
 		Serial:      body.Serial,
@@ -65,43 +91,35 @@ func (h *caHandler) Revoke(w http.ResponseWriter, r *http.Request) {
 		PassiveOnly: body.Passive,
 	}
 
-	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.RevokeMethod)
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
 	// A token indicates that we are using the api via a provisioner token,
 	// otherwise it is assumed that the certificate is revoking itself over mTLS.
 	if len(body.OTT) > 0 {
-		logOtt(w, body.OTT)
 		if _, err := h.Authority.Authorize(ctx, body.OTT); err != nil {
-			WriteError(w, errs.UnauthorizedErr(err))
-			return
+			return nil, errs.UnauthorizedErr(err)
 		}
 		opts.OTT = body.OTT
 	} else {
 		// If no token is present, then the request must be made over mTLS and
 		// the client certificate Serial Number must match the serial number
 		// being revoked.
-		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
-			WriteError(w, errs.BadRequest("missing ott or peer certificate"))
-			return
+		if peer == nil {
+			return nil, errs.BadRequest("missing ott or peer certificate")
 		}
-		opts.Crt = r.TLS.PeerCertificates[0]
+		opts.Crt = peer
 		if opts.Crt.SerialNumber.String() != opts.Serial {
-			WriteError(w, errs.BadRequest("revoke: serial number in mtls certificate different than body"))
-			return
+			return nil, errs.BadRequest("revoke: serial number in mtls certificate different than body")
 		}
 		// TODO: should probably be checking if the certificate was revoked here.
 		// Will need to thread that request down to the authority, so will need
 		// to add API for that.
-		LogCertificate(w, opts.Crt)
 		opts.MTLS = true
 	}
 
 	if err := h.Authority.Revoke(ctx, opts); err != nil {
-		WriteError(w, errs.ForbiddenErr(err))
-		return
+		return nil, errs.ForbiddenErr(err)
 	}
-
-	logRevoke(w, opts)
-	JSON(w, &RevokeResponse{Status: "ok"})
+	return opts, nil
 }
 
 func logRevoke(w http.ResponseWriter, ri *authority.RevokeOptions) {
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+)
+
+// RootsManifestResponse is the response object of the roots manifest request.
+type RootsManifestResponse struct {
+	Manifest string `json:"manifest"`
+}
+
+// RootsManifest is an HTTP handler that returns the manifest with the current
+// and next roots of the CA. The manifest is a JWT signed by a current root,
+// clients verify it with the roots they trust, and add the next roots to
+// their trust stores before the CA starts using them.
+func (h *caHandler) RootsManifest(w http.ResponseWriter, r *http.Request) {
+	manifest, err := h.Authority.GetRootsManifest()
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	JSON(w, &RootsManifestResponse{
+		Manifest: manifest,
+	})
+}
@@ -1,22 +1,30 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"io"
 	"net/http"
+	"sync"
 
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/keyattest"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/authority/timing"
 	"github.com/smallstep/certificates/errs"
 )
 
 // SignRequest is the request body for a certificate signature request.
 type SignRequest struct {
-	CsrPEM       CertificateRequest `json:"csr"`
-	OTT          string             `json:"ott"`
-	NotAfter     TimeDuration       `json:"notAfter,omitempty"`
-	NotBefore    TimeDuration       `json:"notBefore,omitempty"`
-	TemplateData json.RawMessage    `json:"templateData,omitempty"`
+	CsrPEM       CertificateRequest   `json:"csr"`
+	OTT          string               `json:"ott"`
+	NotAfter     TimeDuration         `json:"notAfter,omitempty"`
+	NotBefore    TimeDuration         `json:"notBefore,omitempty"`
+	TemplateData json.RawMessage      `json:"templateData,omitempty"`
+	Attestation  *keyattest.Statement `json:"attestation,omitempty"`
+	Labels       map[string]string    `json:"labels,omitempty"`
 }
 
 // Validate checks the fields of the SignRequest and returns nil if they are ok
@@ -44,10 +52,98 @@ type SignResponse struct {
 	TLS          *tls.ConnectionState `json:"-"`
 }
 
+// signResponsePool is the pool of buffers used to write the sign responses.
+var signResponsePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 8192)
+		return &b
+	},
+}
+
+// maxPooledSignResponse is the maximum size of the buffers kept in the pool.
+const maxPooledSignResponse = 64 << 10
+
+// writeSignResponse writes the JSON encoding of the response followed by a
+// new line, the same output as a json.Encoder. The response is written in a
+// pooled buffer, the encoding of the leaf certificate is done once, and the
+// ones of the CA certificates are cached.
+func writeSignResponse(w io.Writer, s *SignResponse) error {
+	bp := signResponsePool.Get().(*[]byte)
+	b, err := appendSignResponse((*bp)[:0], s)
+	if err == nil {
+		_, err = w.Write(b)
+	}
+	if cap(b) <= maxPooledSignResponse {
+		*bp = b[:0]
+		signResponsePool.Put(bp)
+	}
+	return err
+}
+
+// appendSignResponse appends the JSON encoding of the response and a new line
+// to b.
+func appendSignResponse(b []byte, s *SignResponse) ([]byte, error) {
+	var err error
+	b = append(b, `{"crt":`...)
+	start := len(b)
+	if b, err = appendResponseCertificate(b, s.ServerPEM, nil, nil); err != nil {
+		return b, err
+	}
+	leaf := b[start:len(b):len(b)]
+
+	b = append(b, `,"ca":`...)
+	if b, err = appendResponseCertificate(b, s.CaPEM, s.ServerPEM.Certificate, leaf); err != nil {
+		return b, err
+	}
+	b = append(b, `,"certChain":`...)
+	if s.CertChainPEM == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, c := range s.CertChainPEM {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = appendResponseCertificate(b, c, s.ServerPEM.Certificate, leaf); err != nil {
+				return b, err
+			}
+		}
+		b = append(b, ']')
+	}
+	if s.TLSOptions != nil {
+		opts, err := json.Marshal(s.TLSOptions)
+		if err != nil {
+			return b, err
+		}
+		b = append(b, `,"tlsOptions":`...)
+		b = append(b, opts...)
+	}
+	return append(b, '}', '\n'), nil
+}
+
+// appendResponseCertificate appends the JSON encoding of c to b. If c is the
+// leaf certificate, its encoding is already in leafJSON.
+func appendResponseCertificate(b []byte, c Certificate, leaf *x509.Certificate, leafJSON []byte) ([]byte, error) {
+	switch {
+	case c.Certificate == nil:
+		return append(b, "null"...), nil
+	case c.Certificate == leaf:
+		return append(b, leafJSON...), nil
+	case c.IsCA:
+		ca, err := c.MarshalJSON()
+		return append(b, ca...), err
+	default:
+		return appendCertificateJSON(b, c.Raw), nil
+	}
+}
+
 // Sign is an HTTP handler that reads a certificate request and an
 // one-time-token (ott) from the body and creates a new certificate with the
 // information in the certificate request.
 func (h *caHandler) Sign(w http.ResponseWriter, r *http.Request) {
+	ctx, tb := timing.NewContext(r.Context())
+	defer LogTiming(w, tb)
+
 	var body SignRequest
 	if err := ReadJSON(r.Body, &body); err != nil {
 		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
@@ -55,38 +151,49 @@ func (h *caHandler) Sign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logOtt(w, body.OTT)
-	if err := body.Validate(); err != nil {
+	resp, err := h.sign(ctx, &body)
+	if err != nil {
 		WriteError(w, err)
 		return
 	}
+	LogCertificate(w, resp.ServerPEM.Certificate)
+	JSONStatus(w, resp, http.StatusCreated)
+}
+
+// sign validates the given sign request, authorizes its token and signs the
+// certificate request.
+func (h *caHandler) sign(ctx context.Context, body *SignRequest) (*SignResponse, error) {
+	if err := body.Validate(); err != nil {
+		return nil, err
+	}
 
 	opts := provisioner.SignOptions{
 		NotBefore:    body.NotBefore,
 		NotAfter:     body.NotAfter,
 		TemplateData: body.TemplateData,
+		Attestation:  body.Attestation,
+		Labels:       body.Labels,
 	}
 
-	signOpts, err := h.Authority.AuthorizeSign(body.OTT)
+	timing.FromContext(ctx).Start(timing.Authorization)
+	signOpts, err := h.Authority.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), body.OTT)
 	if err != nil {
-		WriteError(w, errs.UnauthorizedErr(err))
-		return
+		return nil, errs.UnauthorizedErr(err)
 	}
 
-	certChain, err := h.Authority.Sign(body.CsrPEM.CertificateRequest, opts, signOpts...)
+	certChain, err := h.Authority.SignWithContext(ctx, body.CsrPEM.CertificateRequest, opts, signOpts...)
 	if err != nil {
-		WriteError(w, errs.ForbiddenErr(err))
-		return
+		return nil, errs.ForbiddenErr(err)
 	}
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
 		caPEM = certChainPEM[1]
 	}
-	LogCertificate(w, certChain[0])
-	JSONStatus(w, &SignResponse{
+	return &SignResponse{
 		ServerPEM:    certChainPEM[0],
 		CaPEM:        caPEM,
 		CertChainPEM: certChainPEM,
 		TLSOptions:   h.Authority.GetTLSOptions(),
-	}, http.StatusCreated)
+	}, nil
 }
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+// MaxBatchSignRequests is the maximum number of sign requests that can be sent
+// in a batch.
+var MaxBatchSignRequests = 1000
+
+// BatchSignWorkers is the maximum number of sign requests of a batch that are
+// signed in parallel.
+var BatchSignWorkers = runtime.NumCPU()
+
+// BatchSignRequest is the request body of a batched certificate signature
+// request.
+type BatchSignRequest struct {
+	Requests []SignRequest `json:"requests"`
+}
+
+// Validate checks the fields of the BatchSignRequest and returns nil if they
+// are ok or an error if something is wrong. The sign requests are validated
+// individually when they are signed.
+func (s *BatchSignRequest) Validate() error {
+	switch {
+	case len(s.Requests) == 0:
+		return errs.BadRequest("missing requests")
+	case len(s.Requests) > MaxBatchSignRequests:
+		return errs.BadRequest("too many requests: the maximum number of requests in a batch is %d", MaxBatchSignRequests)
+	default:
+		return nil
+	}
+}
+
+// BatchSignResult is the result of one of the sign requests of a batch. It
+// contains the response if the certificate was signed or the error otherwise.
+type BatchSignResult struct {
+	Status   int           `json:"status"`
+	Response *SignResponse `json:"response,omitempty"`
+	Error    *errs.Error   `json:"error,omitempty"`
+}
+
+// BatchSignResponse is the response object of the batched certificate
+// signature request. The results are in the same order as the requests.
+type BatchSignResponse struct {
+	Results []BatchSignResult `json:"results"`
+}
+
+// SignBatch is an HTTP handler that reads a list of certificate requests and
+// one-time-tokens from the body and signs them in parallel. A failure of one
+// request does not fail the batch, the status of each request is reported in
+// its result.
+func (h *caHandler) SignBatch(w http.ResponseWriter, r *http.Request) {
+	var body BatchSignRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	workers := BatchSignWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(body.Requests) {
+		workers = len(body.Requests)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]BatchSignResult, len(body.Requests))
+	jobs := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = h.batchSign(r.Context(), &body.Requests[j])
+			}
+		}()
+	}
+	for i := range body.Requests {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	logBatchSign(w, results)
+	JSONStatus(w, &BatchSignResponse{
+		Results: results,
+	}, http.StatusOK)
+}
+
+// batchSign signs one of the requests of a batch and returns its result.
+func (h *caHandler) batchSign(ctx context.Context, body *SignRequest) BatchSignResult {
+	resp, err := h.sign(ctx, body)
+	if err != nil {
+		e, ok := err.(*errs.Error)
+		if !ok {
+			e = errs.InternalServerErr(err).(*errs.Error)
+		}
+		return BatchSignResult{
+			Status: e.StatusCode(),
+			Error:  e,
+		}
+	}
+	return BatchSignResult{
+		Status:   http.StatusCreated,
+		Response: resp,
+	}
+}
+
+// logBatchSign adds the size of the batch, the serial numbers of the signed
+// certificates and the errors of the failed requests to the log message.
+func logBatchSign(w http.ResponseWriter, results []BatchSignResult) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		var serials, failures []string
+		for _, res := range results {
+			if res.Error != nil {
+				failures = append(failures, res.Error.Error())
+			} else {
+				serials = append(serials, res.Response.ServerPEM.SerialNumber.String())
+			}
+		}
+		m := map[string]interface{}{
+			"batch-size":    len(results),
+			"batch-signed":  len(serials),
+			"batch-serials": serials,
+		}
+		if len(failures) > 0 {
+			m["batch-errors"] = failures
+		}
+		rl.WithFields(m)
+	}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+)
+
+// SignSessionTimeout is the time a sign session waits for its authorization.
+var SignSessionTimeout = 10 * time.Minute
+
+// SignSessionKeepAlive is the interval between the keep-alive comments sent in
+// the event stream of a sign session.
+var SignSessionKeepAlive = 5 * time.Second
+
+// SignSessionStreamDuration is the maximum duration of the event stream of a
+// sign session. It must be lower than the write timeout of the server, after
+// it the stream is closed and clients reconnect to it.
+var SignSessionStreamDuration = 12 * time.Second
+
+// MaxSignSessions is the maximum number of pending sign sessions.
+var MaxSignSessions = 1024
+
+// SignSessionRequest is the request body to create a sign session. It is a
+// sign request without the token, the token is sent to the authorize endpoint
+// of the session once the interactive flow completes.
+type SignSessionRequest struct {
+	CsrPEM       CertificateRequest `json:"csr"`
+	NotAfter     TimeDuration       `json:"notAfter,omitempty"`
+	NotBefore    TimeDuration       `json:"notBefore,omitempty"`
+	TemplateData json.RawMessage    `json:"templateData,omitempty"`
+}
+
+// Validate checks the fields of the SignSessionRequest and returns nil if they
+// are ok or an error if something is wrong.
+func (s *SignSessionRequest) Validate() error {
+	if s.CsrPEM.CertificateRequest == nil {
+		return errs.BadRequest("missing csr")
+	}
+	if err := s.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+		return errs.Wrap(http.StatusBadRequest, err, "invalid csr")
+	}
+	return nil
+}
+
+// SignSessionResponse is the response object of the sign session request.
+type SignSessionResponse struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SignSessionAuthorizeRequest is the request body to authorize a sign session.
+type SignSessionAuthorizeRequest struct {
+	OTT string `json:"ott"`
+}
+
+// Validate checks the fields of the SignSessionAuthorizeRequest and returns
+// nil if they are ok or an error if something is wrong.
+func (s *SignSessionAuthorizeRequest) Validate() error {
+	if s.OTT == "" {
+		return errs.BadRequest("missing ott")
+	}
+	return nil
+}
+
+// SignSessionAuthorizeResponse is the response object of the authorize sign
+// session request.
+type SignSessionAuthorizeResponse struct {
+	Status string `json:"status"`
+}
+
+// NewSignSession is an HTTP handler that creates a sign session with the
+// certificate request in the body. The client waits for the certificate in the
+// event stream of the session while the user completes an interactive flow,
+// like an OIDC or device code flow, that ends authorizing the session.
+func (h *caHandler) NewSignSession(w http.ResponseWriter, r *http.Request) {
+	var body SignSessionRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	id, s, err := h.sessions.create(&body, time.Now())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	JSONStatus(w, &SignSessionResponse{
+		ID:        id,
+		ExpiresAt: s.expiresAt,
+	}, http.StatusCreated)
+}
+
+// AuthorizeSignSession is an HTTP handler that signs the certificate request
+// of a sign session using the one-time-token in the body. The certificate, or
+// the error, is sent to the event stream of the session. A session can only be
+// authorized once.
+func (h *caHandler) AuthorizeSignSession(w http.ResponseWriter, r *http.Request) {
+	var body SignSessionAuthorizeRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	s, err := h.sessions.start(chi.URLParam(r, "id"), time.Now())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	logOtt(w, body.OTT)
+	resp, err := h.sign(r.Context(), &SignRequest{
+		CsrPEM:       s.req.CsrPEM,
+		OTT:          body.OTT,
+		NotAfter:     s.req.NotAfter,
+		NotBefore:    s.req.NotBefore,
+		TemplateData: s.req.TemplateData,
+	})
+	s.complete(resp, err)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	LogCertificate(w, resp.ServerPEM.Certificate)
+	JSON(w, &SignSessionAuthorizeResponse{Status: "ok"})
+}
+
+// SignSessionEvents is an HTTP handler that streams the events of a sign
+// session using server-sent events. Once the session is authorized, it sends a
+// certificate event with the SignResponse, or an error event with the error,
+// and the session is removed. Until then, it sends keep-alive comments.
+func (h *caHandler) SignSessionEvents(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	s, ok := h.sessions.get(id, time.Now())
+	if !ok {
+		WriteError(w, errs.NotFound("sign session %s not found", id))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, errs.InternalServer("streaming is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", SignSessionKeepAlive.Milliseconds())
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(SignSessionKeepAlive)
+	defer keepAlive.Stop()
+	closeStream := time.NewTimer(SignSessionStreamDuration)
+	defer closeStream.Stop()
+	expire := time.NewTimer(time.Until(s.expiresAt))
+	defer expire.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closeStream.C:
+			return
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-expire.C:
+			h.sessions.delete(id)
+			writeSignSessionEvent(w, "error", errs.NotFound("sign session %s expired", id))
+			flusher.Flush()
+			return
+		case <-s.done:
+			h.sessions.delete(id)
+			if s.err != nil {
+				writeSignSessionEvent(w, "error", s.err)
+			} else {
+				writeSignSessionEvent(w, "certificate", s.resp)
+			}
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// writeSignSessionEvent writes a server-sent event with the JSON
+// representation of the given value. Errors are written as in WriteError.
+func writeSignSessionEvent(w http.ResponseWriter, event string, v interface{}) {
+	if err, ok := v.(error); ok {
+		e, ok := err.(*errs.Error)
+		if !ok {
+			e = errs.InternalServerErr(err).(*errs.Error)
+		}
+		v = e
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		LogError(w, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
+
+// signSession is a certificate request waiting for its authorization.
+type signSession struct {
+	req        SignSessionRequest
+	expiresAt  time.Time
+	authorized bool
+	done       chan struct{}
+	resp       *SignResponse
+	err        error
+}
+
+// complete sets the result of the session and notifies the event streams.
+func (s *signSession) complete(resp *SignResponse, err error) {
+	s.resp, s.err = resp, err
+	close(s.done)
+}
+
+// signSessions is the in-memory store of the pending sign sessions.
+type signSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*signSession
+}
+
+func newSignSessions() *signSessions {
+	return &signSessions{
+		sessions: make(map[string]*signSession),
+	}
+}
+
+// create adds a new session with the given request and returns its id.
+func (ss *signSessions) create(req *SignSessionRequest, now time.Time) (string, *signSession, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, errs.InternalServerErr(errors.Wrap(err, "error generating sign session id"))
+	}
+	id := hex.EncodeToString(b)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.sessions) >= MaxSignSessions {
+		for k, s := range ss.sessions {
+			if !now.Before(s.expiresAt) {
+				delete(ss.sessions, k)
+			}
+		}
+		if len(ss.sessions) >= MaxSignSessions {
+			return "", nil, errs.NewErr(http.StatusServiceUnavailable,
+				errors.New("too many pending sign sessions"),
+				errs.WithRetryAfter(SignSessionKeepAlive))
+		}
+	}
+	s := &signSession{
+		req:       *req,
+		expiresAt: now.Add(SignSessionTimeout),
+		done:      make(chan struct{}),
+	}
+	ss.sessions[id] = s
+	return id, s, nil
+}
+
+// get returns the session with the given id if it has not expired.
+func (ss *signSessions) get(id string, now time.Time) (*signSession, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, ok := ss.sessions[id]
+	if !ok || !now.Before(s.expiresAt) {
+		return nil, false
+	}
+	return s, true
+}
+
+// start marks the session with the given id as authorized and returns it. It
+// fails if the session does not exist or it was already authorized.
+func (ss *signSessions) start(id string, now time.Time) (*signSession, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, ok := ss.sessions[id]
+	if !ok || !now.Before(s.expiresAt) {
+		return nil, errs.NotFound("sign session %s not found", id)
+	}
+	if s.authorized {
+		return nil, errs.NewErr(http.StatusConflict,
+			errors.Errorf("sign session %s already authorized", id),
+			errs.WithMessage("The sign session has already been authorized."))
+	}
+	s.authorized = true
+	return s, nil
+}
+
+// delete removes the session with the given id.
+func (ss *signSessions) delete(id string) {
+	ss.mu.Lock()
+	delete(ss.sessions, id)
+	ss.mu.Unlock()
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+func newSignSessionTestServer(t *testing.T, middlewares ...func(http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+	r := chi.NewRouter()
+	New(&mockAuthority{
+		ret1: parseCertificate(certPEM), ret2: parseCertificate(rootPEM),
+		authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+			if ott != "foobarzar" {
+				return nil, fmt.Errorf("an error")
+			}
+			return nil, nil
+		},
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+	}).Route(r)
+	var h http.Handler = r
+	for _, m := range middlewares {
+		h = m(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signSessionPost(t *testing.T, u string, v interface{}) (int, []byte) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(u, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func signSessionEvents(t *testing.T, u string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func newSignSession(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	code, body := signSessionPost(t, srv.URL+"/sign/sessions", &SignSessionRequest{
+		CsrPEM: CertificateRequest{parseCertificateRequest(csrPEM)},
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("NewSignSession StatusCode = %d, wants %d", code, http.StatusCreated)
+	}
+	var session SignSessionResponse
+	if err := json.Unmarshal(body, &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.ID == "" || session.ExpiresAt.IsZero() {
+		t.Fatalf("NewSignSession response = %s", body)
+	}
+	return session.ID
+}
+
+func Test_caHandler_SignSession(t *testing.T) {
+	srv := newSignSessionTestServer(t)
+	id := newSignSession(t, srv)
+
+	code, _ := signSessionPost(t, srv.URL+"/sign/sessions/"+id+"/authorize", &SignSessionAuthorizeRequest{OTT: "foobarzar"})
+	if code != http.StatusOK {
+		t.Fatalf("AuthorizeSignSession StatusCode = %d, wants %d", code, http.StatusOK)
+	}
+	code, _ = signSessionPost(t, srv.URL+"/sign/sessions/"+id+"/authorize", &SignSessionAuthorizeRequest{OTT: "foobarzar"})
+	if code != http.StatusConflict {
+		t.Errorf("AuthorizeSignSession StatusCode = %d, wants %d", code, http.StatusConflict)
+	}
+
+	code, body := signSessionEvents(t, srv.URL+"/sign/sessions/"+id+"/events")
+	if code != http.StatusOK {
+		t.Fatalf("SignSessionEvents StatusCode = %d, wants %d", code, http.StatusOK)
+	}
+	if !strings.Contains(body, "event: certificate\ndata: ") {
+		t.Fatalf("SignSessionEvents body = %s, wants certificate event", body)
+	}
+	data := body[strings.Index(body, "data: ")+6:]
+	var resp SignResponse
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ServerPEM.SerialNumber.Cmp(parseCertificate(certPEM).SerialNumber) != 0 {
+		t.Errorf("SignSessionEvents serial = %s, wants %s", resp.ServerPEM.SerialNumber, parseCertificate(certPEM).SerialNumber)
+	}
+
+	// The certificate is only sent once.
+	code, _ = signSessionEvents(t, srv.URL+"/sign/sessions/"+id+"/events")
+	if code != http.StatusNotFound {
+		t.Errorf("SignSessionEvents StatusCode = %d, wants %d", code, http.StatusNotFound)
+	}
+}
+
+func Test_caHandler_SignSession_messages(t *testing.T) {
+	// The streaming endpoint must work with the same middlewares used by the
+	// CA when the message catalog and the logger are configured.
+	catalog := errs.NewMessageCatalog("en", map[string]map[string]string{
+		errs.CodeForbidden: {"en": "Contact the help desk."},
+	})
+	srv := newSignSessionTestServer(t, catalog.Middleware, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(logging.NewResponseLogger(w), r)
+		})
+	})
+	id := newSignSession(t, srv)
+
+	code, _ := signSessionPost(t, srv.URL+"/sign/sessions/"+id+"/authorize", &SignSessionAuthorizeRequest{OTT: "foobarzar"})
+	if code != http.StatusOK {
+		t.Fatalf("AuthorizeSignSession StatusCode = %d, wants %d", code, http.StatusOK)
+	}
+	code, body := signSessionEvents(t, srv.URL+"/sign/sessions/"+id+"/events")
+	if code != http.StatusOK {
+		t.Fatalf("SignSessionEvents StatusCode = %d, wants %d", code, http.StatusOK)
+	}
+	if !strings.Contains(body, "event: certificate\ndata: ") {
+		t.Errorf("SignSessionEvents body = %s, wants certificate event", body)
+	}
+}
+
+func Test_caHandler_SignSession_fail(t *testing.T) {
+	srv := newSignSessionTestServer(t)
+
+	code, _ := signSessionPost(t, srv.URL+"/sign/sessions", &SignSessionRequest{})
+	if code != http.StatusBadRequest {
+		t.Errorf("NewSignSession StatusCode = %d, wants %d", code, http.StatusBadRequest)
+	}
+	code, _ = signSessionPost(t, srv.URL+"/sign/sessions/foo/authorize", &SignSessionAuthorizeRequest{OTT: "foobarzar"})
+	if code != http.StatusNotFound {
+		t.Errorf("AuthorizeSignSession StatusCode = %d, wants %d", code, http.StatusNotFound)
+	}
+	code, _ = signSessionEvents(t, srv.URL+"/sign/sessions/foo/events")
+	if code != http.StatusNotFound {
+		t.Errorf("SignSessionEvents StatusCode = %d, wants %d", code, http.StatusNotFound)
+	}
+
+	id := newSignSession(t, srv)
+	code, _ = signSessionPost(t, srv.URL+"/sign/sessions/"+id+"/authorize", &SignSessionAuthorizeRequest{})
+	if code != http.StatusBadRequest {
+		t.Errorf("AuthorizeSignSession StatusCode = %d, wants %d", code, http.StatusBadRequest)
+	}
+	code, _ = signSessionPost(t, srv.URL+"/sign/sessions/"+id+"/authorize", &SignSessionAuthorizeRequest{OTT: "bad"})
+	if code != http.StatusUnauthorized {
+		t.Errorf("AuthorizeSignSession StatusCode = %d, wants %d", code, http.StatusUnauthorized)
+	}
+	code, body := signSessionEvents(t, srv.URL+"/sign/sessions/"+id+"/events")
+	if code != http.StatusOK {
+		t.Fatalf("SignSessionEvents StatusCode = %d, wants %d", code, http.StatusOK)
+	}
+	if !strings.Contains(body, "event: error\ndata: {\"status\":401") {
+		t.Errorf("SignSessionEvents body = %s, wants error event", body)
+	}
+}
+
+func Test_caHandler_SignSession_keepAlive(t *testing.T) {
+	keepAlive, duration := SignSessionKeepAlive, SignSessionStreamDuration
+	SignSessionKeepAlive, SignSessionStreamDuration = 10*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() {
+		SignSessionKeepAlive, SignSessionStreamDuration = keepAlive, duration
+	})
+
+	srv := newSignSessionTestServer(t)
+	id := newSignSession(t, srv)
+
+	code, body := signSessionEvents(t, srv.URL+"/sign/sessions/"+id+"/events")
+	if code != http.StatusOK {
+		t.Fatalf("SignSessionEvents StatusCode = %d, wants %d", code, http.StatusOK)
+	}
+	if !strings.HasPrefix(body, "retry: 10\n\n") || !strings.Contains(body, ": keep-alive\n\n") {
+		t.Errorf("SignSessionEvents body = %q, wants retry and keep-alive", body)
+	}
+	if strings.Contains(body, "event:") {
+		t.Errorf("SignSessionEvents body = %q, wants no events", body)
+	}
+}
+
+func Test_signSessions_create(t *testing.T) {
+	max := MaxSignSessions
+	MaxSignSessions = 2
+	t.Cleanup(func() {
+		MaxSignSessions = max
+	})
+
+	now := time.Now()
+	ss := newSignSessions()
+	for i := 0; i < 2; i++ {
+		if _, _, err := ss.create(&SignSessionRequest{}, now); err != nil {
+			t.Fatalf("signSessions.create() error = %v", err)
+		}
+	}
+	if _, _, err := ss.create(&SignSessionRequest{}, now); err == nil {
+		t.Fatal("signSessions.create() error = nil, wants error")
+	}
+	// Expired sessions are removed to make room for new ones.
+	if _, _, err := ss.create(&SignSessionRequest{}, now.Add(SignSessionTimeout)); err != nil {
+		t.Errorf("signSessions.create() error = %v", err)
+	}
+	if len(ss.sessions) != 1 {
+		t.Errorf("signSessions len = %d, wants 1", len(ss.sessions))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -66,10 +67,27 @@ func (s *SSHSignRequest) Validate() error {
 }
 
 // SSHSignResponse is the response object that returns the SSH certificate.
+// The key id, serial and SHA256 fingerprints of the certificate allow to join
+// the logs of the SSH servers with the issuance of the certificate.
 type SSHSignResponse struct {
-	Certificate         SSHCertificate  `json:"crt"`
-	AddUserCertificate  *SSHCertificate `json:"addUserCrt,omitempty"`
-	IdentityCertificate []Certificate   `json:"identityCrt,omitempty"`
+	Certificate            SSHCertificate  `json:"crt"`
+	AddUserCertificate     *SSHCertificate `json:"addUserCrt,omitempty"`
+	IdentityCertificate    []Certificate   `json:"identityCrt,omitempty"`
+	KeyID                  string          `json:"keyID,omitempty"`
+	Serial                 string          `json:"serial,omitempty"`
+	KeyFingerprint         string          `json:"keyFingerprint,omitempty"`
+	CertificateFingerprint string          `json:"certificateFingerprint,omitempty"`
+}
+
+// newSSHSignResponse returns the response for the given certificate.
+func newSSHSignResponse(cert *ssh.Certificate) *SSHSignResponse {
+	return &SSHSignResponse{
+		Certificate:            SSHCertificate{cert},
+		KeyID:                  cert.KeyId,
+		Serial:                 strconv.FormatUint(cert.Serial, 10),
+		KeyFingerprint:         ssh.FingerprintSHA256(cert.Key),
+		CertificateFingerprint: ssh.FingerprintSHA256(cert),
+	}
 }
 
 // SSHRootsResponse represents the response object that returns the SSH user and
@@ -255,23 +273,32 @@ func (h *caHandler) SSHSign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logOtt(w, body.OTT)
-	if err := body.Validate(); err != nil {
-		WriteError(w, errs.BadRequestErr(err))
+	resp, err := h.sshSign(r.Context(), &body)
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
+	JSONStatus(w, resp, http.StatusCreated)
+}
+
+// sshSign validates the given SSH sign request, authorizes its token and signs
+// the SSH certificate, and the add-user and identity certificates if they are
+// requested.
+func (h *caHandler) sshSign(ctx context.Context, body *SSHSignRequest) (*SSHSignResponse, error) {
+	if err := body.Validate(); err != nil {
+		return nil, errs.BadRequestErr(err)
+	}
 
 	publicKey, err := ssh.ParsePublicKey(body.PublicKey)
 	if err != nil {
-		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error parsing publicKey"))
-		return
+		return nil, errs.Wrap(http.StatusBadRequest, err, "error parsing publicKey")
 	}
 
 	var addUserPublicKey ssh.PublicKey
 	if body.AddUserPublicKey != nil {
 		addUserPublicKey, err = ssh.ParsePublicKey(body.AddUserPublicKey)
 		if err != nil {
-			WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error parsing addUserPublicKey"))
-			return
+			return nil, errs.Wrap(http.StatusBadRequest, err, "error parsing addUserPublicKey")
 		}
 	}
 
@@ -284,25 +311,22 @@ func (h *caHandler) SSHSign(w http.ResponseWriter, r *http.Request) {
 		TemplateData: body.TemplateData,
 	}
 
-	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHSignMethod)
-	signOpts, err := h.Authority.Authorize(ctx, body.OTT)
+	signCtx := provisioner.NewContextWithMethod(ctx, provisioner.SSHSignMethod)
+	signOpts, err := h.Authority.Authorize(signCtx, body.OTT)
 	if err != nil {
-		WriteError(w, errs.UnauthorizedErr(err))
-		return
+		return nil, errs.UnauthorizedErr(err)
 	}
 
-	cert, err := h.Authority.SignSSH(ctx, publicKey, opts, signOpts...)
+	cert, err := h.Authority.SignSSH(signCtx, publicKey, opts, signOpts...)
 	if err != nil {
-		WriteError(w, errs.ForbiddenErr(err))
-		return
+		return nil, errs.ForbiddenErr(err)
 	}
 
 	var addUserCertificate *SSHCertificate
 	if addUserPublicKey != nil && authority.IsValidForAddUser(cert) == nil {
-		addUserCert, err := h.Authority.SignSSHAddUser(ctx, addUserPublicKey, cert)
+		addUserCert, err := h.Authority.SignSSHAddUser(signCtx, addUserPublicKey, cert)
 		if err != nil {
-			WriteError(w, errs.ForbiddenErr(err))
-			return
+			return nil, errs.ForbiddenErr(err)
 		}
 		addUserCertificate = &SSHCertificate{addUserCert}
 	}
@@ -310,12 +334,11 @@ func (h *caHandler) SSHSign(w http.ResponseWriter, r *http.Request) {
 	// Sign identity certificate if available.
 	var identityCertificate []Certificate
 	if cr := body.IdentityCSR.CertificateRequest; cr != nil {
-		ctx := authority.NewContextWithSkipTokenReuse(r.Context())
+		ctx := authority.NewContextWithSkipTokenReuse(ctx)
 		ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 		signOpts, err := h.Authority.Authorize(ctx, body.OTT)
 		if err != nil {
-			WriteError(w, errs.UnauthorizedErr(err))
-			return
+			return nil, errs.UnauthorizedErr(err)
 		}
 
 		// Enforce the same duration as ssh certificate.
@@ -324,19 +347,17 @@ func (h *caHandler) SSHSign(w http.ResponseWriter, r *http.Request) {
 			NotAfter:  time.Unix(int64(cert.ValidBefore), 0),
 		})
 
-		certChain, err := h.Authority.Sign(cr, provisioner.SignOptions{}, signOpts...)
+		certChain, err := h.Authority.SignWithContext(ctx, cr, provisioner.SignOptions{}, signOpts...)
 		if err != nil {
-			WriteError(w, errs.ForbiddenErr(err))
-			return
+			return nil, errs.ForbiddenErr(err)
 		}
 		identityCertificate = certChainToPEM(certChain)
 	}
 
-	JSONStatus(w, &SSHSignResponse{
-		Certificate:         SSHCertificate{cert},
-		AddUserCertificate:  addUserCertificate,
-		IdentityCertificate: identityCertificate,
-	}, http.StatusCreated)
+	resp := newSSHSignResponse(cert)
+	resp.AddUserCertificate = addUserCertificate
+	resp.IdentityCertificate = identityCertificate
+	return resp, nil
 }
 
 // SSHRoots is an HTTP handler that returns the SSH public keys for user and host
@@ -74,10 +74,9 @@ func (h *caHandler) SSHRenew(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	JSONStatus(w, &SSHSignResponse{
-		Certificate:         SSHCertificate{newCert},
-		IdentityCertificate: identity,
-	}, http.StatusCreated)
+	resp := newSSHSignResponse(newCert)
+	resp.IdentityCertificate = identity
+	JSONStatus(w, resp, http.StatusCreated)
 }
 
 // renewIdentityCertificate request the client TLS certificate if present. If notBefore and notAfter are passed the
@@ -101,7 +100,7 @@ func (h *caHandler) renewIdentityCertificate(r *http.Request, notBefore, notAfte
 		cert.NotAfter = notAfter
 	}
 
-	certChain, err := h.Authority.Renew(cert)
+	certChain, err := h.Authority.RenewWithContext(r.Context(), cert)
 	if err != nil {
 		return nil, err
 	}
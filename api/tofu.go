@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// TOFURequest is the request body for a trust on first use certificate
+// request.
+type TOFURequest struct {
+	CsrPEM CertificateRequest `json:"csr"`
+}
+
+// Validate checks the fields of the TOFURequest.
+func (s *TOFURequest) Validate() error {
+	if s.CsrPEM.CertificateRequest == nil {
+		return errs.BadRequest("missing csr")
+	}
+	if err := s.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+		return errs.Wrap(http.StatusBadRequest, err, "invalid csr")
+	}
+	if s.CsrPEM.CertificateRequest.Subject.CommonName == "" {
+		return errs.BadRequest("missing csr common name")
+	}
+	return nil
+}
+
+// TOFU is an HTTP handler that signs a certificate using trust on first use.
+// The first request for an identifier is not authenticated, the following
+// ones are authenticated using the client certificate in the TLS connection.
+func (h *caHandler) TOFU(w http.ResponseWriter, r *http.Request) {
+	var body TOFURequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, errs.Wrap(http.StatusBadRequest, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	var client *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		client = r.TLS.PeerCertificates[0]
+	}
+
+	certChain, err := h.Authority.SignTOFU(client, body.CsrPEM.CertificateRequest)
+	if err != nil {
+		WriteError(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.TOFU"))
+		return
+	}
+
+	certChainPEM := certChainToPEM(certChain)
+	var caPEM Certificate
+	if len(certChainPEM) > 1 {
+		caPEM = certChainPEM[1]
+	}
+
+	LogCertificate(w, certChain[0])
+	JSONStatus(w, &SignResponse{
+		ServerPEM:    certChainPEM[0],
+		CaPEM:        caPEM,
+		CertChainPEM: certChainPEM,
+		TLSOptions:   h.Authority.GetTLSOptions(),
+	}, http.StatusCreated)
+}
@@ -2,11 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -60,7 +65,16 @@ func JSON(w http.ResponseWriter, v interface{}) {
 func JSONStatus(w http.ResponseWriter, v interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
+
+	var err error
+	switch v := v.(type) {
+	case *SignResponse:
+		// Sign and renew responses are written without reflection.
+		err = writeSignResponse(w, v)
+	default:
+		err = json.NewEncoder(w).Encode(v)
+	}
+	if err != nil {
 		LogError(w, err)
 		return
 	}
@@ -91,14 +105,127 @@ func ProtoJSONStatus(w http.ResponseWriter, m proto.Message, status int) {
 }
 
 // ReadJSON reads JSON from the request body and stores it in the value
-// pointed by v.
+// pointed by v. Unknown fields and values of the wrong type are rejected,
+// and the message of the error names the offending field. It must be used
+// only with the request types defined by the CA.
 func ReadJSON(r io.Reader, v interface{}) error {
-	if err := json.NewDecoder(r).Decode(v); err != nil {
-		return errs.Wrap(http.StatusBadRequest, err, "error decoding json")
+	return readJSON(r, v, true)
+}
+
+// ReadLenientJSON is like ReadJSON but it ignores unknown fields. It is used
+// with the payloads whose schema is defined by a third party, like the
+// WebAuthn credentials created by browsers or the Envoy discovery requests,
+// that can get new fields at any time.
+func ReadLenientJSON(r io.Reader, v interface{}) error {
+	return readJSON(r, v, false)
+}
+
+func readJSON(r io.Reader, v interface{}, strict bool) error {
+	dec := json.NewDecoder(r)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		if IsRequestTooLarge(err) {
+			return err
+		}
+		e := NewJSONError(err)
+		return errs.BadRequestErr(errors.Wrap(e, "error decoding json"),
+			errs.WithCode(errs.CodeMalformedRequest), errs.WithMessage("%s", e.Message()))
 	}
 	return nil
 }
 
+// JSONError describes an error decoding a request body in a message that is
+// safe to return to the client.
+type JSONError struct {
+	Err   error
+	Field string
+	msg   string
+}
+
+// NewJSONError returns a JSONError for an error returned by json.Unmarshal
+// or json.Decoder. Unknown fields and values of the wrong type are named in
+// the message.
+func NewJSONError(err error) *JSONError {
+	e := &JSONError{Err: err}
+	switch t := err.(type) {
+	case *json.SyntaxError:
+		e.msg = "The request body is not valid JSON."
+	case *json.UnmarshalTypeError:
+		e.Field = t.Field
+		if e.Field == "" {
+			e.msg = fmt.Sprintf("The request body must be %s.", jsonTypeName(t.Type))
+		} else {
+			e.msg = fmt.Sprintf("The field %q must be %s.", e.Field, jsonTypeName(t.Type))
+		}
+	default:
+		switch {
+		case err == io.EOF:
+			e.msg = "The request body is empty."
+		case err == io.ErrUnexpectedEOF:
+			e.msg = "The request body is not valid JSON."
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			e.Field = strings.TrimPrefix(err.Error(), "json: unknown field ")
+			if s, err := strconv.Unquote(e.Field); err == nil {
+				e.Field = s
+			}
+			e.msg = fmt.Sprintf("The field %q is not supported.", e.Field)
+		default:
+			e.msg = errs.BadRequestDefaultMsg
+		}
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e *JSONError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause implements the errors.Causer interface and returns the original error.
+func (e *JSONError) Cause() error {
+	return e.Err
+}
+
+// Message implements the errs.Messenger interface and returns the message
+// for the client.
+func (e *JSONError) Message() string {
+	return e.msg
+}
+
+// jsonTypeName returns the JSON type of a Go type preceded by an article.
+func jsonTypeName(t reflect.Type) string {
+	if t == nil {
+		return "a valid value"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "a base64 string"
+		}
+		return "an array"
+	case reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a valid value"
+	}
+}
+
 // ReadProtoJSON reads JSON from the request body and stores it in the value
 // pointed by v.
 func ReadProtoJSON(r io.Reader, m proto.Message) error {
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/webauthn"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 )
@@ -123,3 +124,104 @@ func TestReadJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestReadJSON_malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantMsg string
+	}{
+		{"unknown field", `{"serial":"1","resonCode":1}`, `The field "resonCode" is not supported.`},
+		{"wrong type", `{"serial":"1","reasonCode":"1"}`, `The field "reasonCode" must be an integer.`},
+		{"wrong type passive", `{"serial":"1","passive":"yes"}`, `The field "passive" must be a boolean.`},
+		{"wrong type body", `["1"]`, "The request body must be an object."},
+		{"syntax", `{"serial"}`, "The request body is not valid JSON."},
+		{"truncated", `{"serial":`, "The request body is not valid JSON."},
+		{"empty", ``, "The request body is empty."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body RevokeRequest
+			err := ReadJSON(strings.NewReader(tt.body), &body)
+			e, ok := err.(*errs.Error)
+			if !ok {
+				t.Fatalf("error type = %T, wants *Error", err)
+			}
+			if code := e.StatusCode(); code != 400 {
+				t.Errorf("error.StatusCode() = %v, wants 400", code)
+			}
+			if code := e.ErrorCode(); code != errs.CodeMalformedRequest {
+				t.Errorf("error.ErrorCode() = %v, wants %v", code, errs.CodeMalformedRequest)
+			}
+			if msg := e.Message(); msg != tt.wantMsg {
+				t.Errorf("error.Message() = %v, wants %v", msg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+// browserCredential is a PublicKeyCredential as serialized by the
+// toJSON() method of the browsers, with the fields that the CA ignores.
+const browserCredential = `{
+  "id": "Pr8u-rS5APxWUdcwIuPA2czt0YqlyGlWSHUq64eH3is",
+  "rawId": "Pr8u-rS5APxWUdcwIuPA2czt0YqlyGlWSHUq64eH3is",
+  "type": "public-key",
+  "authenticatorAttachment": "cross-platform",
+  "clientExtensionResults": {"credProps": {"rk": false}},
+  "response": {
+    "clientDataJSON": "eyJ0eXBlIjoid2ViYXV0aG4uY3JlYXRlIiwiY2hhbGxlbmdlIjoiM3NHYkdQR0N5cDAtcFhESFZLZGNWdyIsIm9yaWdpbiI6Imh0dHBzOi8vY2EuZXhhbXBsZS5jb20iLCJjcm9zc09yaWdpbiI6ZmFsc2V9",
+    "attestationObject": "o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YUA",
+    "authenticatorData": "o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YUA",
+    "transports": ["nfc", "usb"],
+    "publicKeyAlgorithm": -7,
+    "publicKey": "MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE"
+  }
+}`
+
+// browserAssertion is the PublicKeyCredential of an authentication.
+const browserAssertion = `{
+  "id": "Pr8u-rS5APxWUdcwIuPA2czt0YqlyGlWSHUq64eH3is",
+  "rawId": "Pr8u-rS5APxWUdcwIuPA2czt0YqlyGlWSHUq64eH3is",
+  "type": "public-key",
+  "authenticatorAttachment": "cross-platform",
+  "clientExtensionResults": {},
+  "response": {
+    "clientDataJSON": "eyJ0eXBlIjoid2ViYXV0aG4uZ2V0IiwiY2hhbGxlbmdlIjoiM3NHYkdQR0N5cDAtcFhESFZLZGNWdyIsIm9yaWdpbiI6Imh0dHBzOi8vY2EuZXhhbXBsZS5jb20iLCJjcm9zc09yaWdpbiI6ZmFsc2V9",
+    "authenticatorData": "o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YUA",
+    "signature": "MEUCIQ",
+    "userHandle": null
+  }
+}`
+
+func TestReadLenientJSON(t *testing.T) {
+	t.Run("registration", func(t *testing.T) {
+		var v webauthn.CredentialCreationResponse
+		if err := ReadLenientJSON(strings.NewReader(browserCredential), &v); err != nil {
+			t.Fatalf("ReadLenientJSON() error = %v", err)
+		}
+		if v.Type != "public-key" || len(v.RawID) != 32 || len(v.Response.ClientDataJSON) == 0 || len(v.Response.AttestationObject) == 0 {
+			t.Errorf("ReadLenientJSON() = %+v, want the browser credential", v)
+		}
+		// The credential is not a request type of the CA.
+		if err := ReadJSON(strings.NewReader(browserCredential), new(webauthn.CredentialCreationResponse)); err == nil {
+			t.Error("ReadJSON() error = nil, want unknown field error")
+		}
+	})
+
+	t.Run("assertion", func(t *testing.T) {
+		var v webauthn.CredentialAssertionResponse
+		if err := ReadLenientJSON(strings.NewReader(browserAssertion), &v); err != nil {
+			t.Fatalf("ReadLenientJSON() error = %v", err)
+		}
+		if len(v.RawID) != 32 || len(v.Response.Signature) == 0 || len(v.Response.AuthenticatorData) == 0 {
+			t.Errorf("ReadLenientJSON() = %+v, want the browser assertion", v)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		err := ReadLenientJSON(strings.NewReader(`{"rawId":1}`), new(webauthn.CredentialAssertionResponse))
+		if e, ok := err.(*errs.Error); !ok || e.StatusCode() != 400 {
+			t.Errorf("ReadLenientJSON() error = %v, wants a 400 error", err)
+		}
+	})
+}
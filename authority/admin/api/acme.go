@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// CreateExternalAccountKeyRequest is the type for POST
+// /admin/provisioners/{name}/acme/eab requests.
+type CreateExternalAccountKeyRequest struct {
+	Reference string `json:"reference,omitempty"`
+}
+
+// CreateExternalAccountKeyResponse is the type for POST
+// /admin/provisioners/{name}/acme/eab responses. The HMAC key is only
+// returned when the key is created.
+type CreateExternalAccountKeyResponse struct {
+	*acme.ExternalAccountKey
+	HmacKey []byte `json:"hmacKey"`
+}
+
+// GetExternalAccountKeysResponse is the type for GET
+// /admin/provisioners/{name}/acme/eab responses.
+type GetExternalAccountKeysResponse struct {
+	Keys []*acme.ExternalAccountKey `json:"keys"`
+}
+
+// loadACMEProvisioner returns the ACME provisioner with the name in the
+// request path.
+func (h *Handler) loadACMEProvisioner(r *http.Request) (provisioner.Interface, error) {
+	name := chi.URLParam(r, "name")
+	p, err := h.auth.LoadProvisionerByName(name)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading provisioner %s", name)
+	}
+	if _, ok := p.(*provisioner.ACME); !ok {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not an ACME provisioner", name)
+	}
+	return p, nil
+}
+
+// externalAccountKeyDB returns the ACME database if it can store the external
+// account binding keys.
+func (h *Handler) externalAccountKeyDB() (acme.ExternalAccountKeyDB, error) {
+	if h.acmeDB == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "acme database not configured")
+	}
+	db, ok := h.acmeDB.(acme.ExternalAccountKeyDB)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "acme database does not support external account bindings")
+	}
+	return db, nil
+}
+
+// GetACMEUsage returns the number of ACME accounts, orders and authorizations
+// created with the requested ACME provisioner.
+func (h *Handler) GetACMEUsage(w http.ResponseWriter, r *http.Request) {
+	if h.acmeDB == nil {
+		api.WriteError(w, admin.NewError(admin.ErrorNotImplementedType, "acme database not configured"))
+		return
+	}
+
+	p, err := h.loadACMEProvisioner(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	usage, err := h.acmeDB.GetProvisionerUsage(r.Context(), p.GetID())
+	if err != nil {
+		api.WriteError(w, admin.WrapErrorISE(err, "error loading ACME usage of provisioner %s", p.GetName()))
+		return
+	}
+	api.JSON(w, usage)
+}
+
+// GetExternalAccountKeys returns the external account binding keys of the
+// requested ACME provisioner, without their HMAC keys.
+func (h *Handler) GetExternalAccountKeys(w http.ResponseWriter, r *http.Request) {
+	db, err := h.externalAccountKeyDB()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	p, err := h.loadACMEProvisioner(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	keys, err := db.GetExternalAccountKeys(r.Context(), p.GetID())
+	if err != nil {
+		api.WriteError(w, admin.WrapErrorISE(err, "error loading external account keys of provisioner %s", p.GetName()))
+		return
+	}
+	api.JSON(w, &GetExternalAccountKeysResponse{
+		Keys: keys,
+	})
+}
+
+// CreateExternalAccountKey creates a new external account binding key for the
+// requested ACME provisioner.
+func (h *Handler) CreateExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	db, err := h.externalAccountKeyDB()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	p, err := h.loadACMEProvisioner(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	var body CreateExternalAccountKeyRequest
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	eak, err := db.CreateExternalAccountKey(r.Context(), p.GetID(), body.Reference)
+	if err != nil {
+		var acmeErr *acme.Error
+		if errors.As(err, &acmeErr) {
+			api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error creating external account key"))
+			return
+		}
+		api.WriteError(w, admin.WrapErrorISE(err, "error creating external account key"))
+		return
+	}
+	api.JSONStatus(w, &CreateExternalAccountKeyResponse{
+		ExternalAccountKey: eak,
+		HmacKey:            eak.KeyBytes,
+	}, http.StatusCreated)
+}
+
+// DeleteExternalAccountKey deletes an external account binding key of the
+// requested ACME provisioner. The accounts already bound to the key are not
+// modified, but no new accounts can be bound to it.
+func (h *Handler) DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	db, err := h.externalAccountKeyDB()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	p, err := h.loadACMEProvisioner(r)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	switch err := db.DeleteExternalAccountKey(r.Context(), p.GetID(), id); {
+	case errors.Is(err, acme.ErrNotFound):
+		api.WriteError(w, admin.NewError(admin.ErrorNotFoundType, "external account key %s not found", id))
+		return
+	case err != nil:
+		api.WriteError(w, admin.WrapErrorISE(err, "error deleting external account key %s", id))
+		return
+	}
+	api.JSON(w, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+)
+
+// GetSignApprovalRequestsResponse is the type for GET /admin/approvals
+// responses.
+type GetSignApprovalRequestsResponse struct {
+	Requests []*authority.SignApprovalRequest `json:"requests"`
+}
+
+// GetSignApprovalRequests returns the sign requests held for approval.
+func (h *Handler) GetSignApprovalRequests(w http.ResponseWriter, r *http.Request) {
+	requests, err := h.auth.GetSignApprovalRequests()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetSignApprovalRequestsResponse{
+		Requests: requests,
+	})
+}
+
+// ApproveSignRequest approves a sign request, the certificate will be issued
+// the next time the client sends the request.
+func (h *Handler) ApproveSignRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	sr, err := h.auth.ApproveSignRequest(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, sr)
+}
+
+// DenySignRequest denies a sign request.
+func (h *Handler) DenySignRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	sr, err := h.auth.DenySignRequest(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, sr)
+}
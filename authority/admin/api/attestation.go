@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetAttestationPolicy returns the policy used to validate device
+// attestations.
+func (h *Handler) GetAttestationPolicy(w http.ResponseWriter, r *http.Request) {
+	api.JSON(w, h.auth.GetAttestationPolicy())
+}
+
+// UpdateAttestationPolicy replaces the policy used to validate device
+// attestations.
+func (h *Handler) UpdateAttestationPolicy(w http.ResponseWriter, r *http.Request) {
+	var body authority.AttestationPolicy
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := h.auth.UpdateAttestationPolicy(&body); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &body)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetAuditExportsResponse is the type for GET /admin/audit/exports responses.
+type GetAuditExportsResponse struct {
+	Exports []*authority.AuditExport `json:"exports"`
+}
+
+// CreateAuditExport starts a job that exports the audit evidence of a period.
+func (h *Handler) CreateAuditExport(w http.ResponseWriter, r *http.Request) {
+	var body authority.AuditExportOptions
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	exp, err := h.auth.CreateAuditExport(&body)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSONStatus(w, exp, http.StatusAccepted)
+}
+
+// GetAuditExports returns all the audit exports.
+func (h *Handler) GetAuditExports(w http.ResponseWriter, r *http.Request) {
+	exports, err := h.auth.GetAuditExports()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetAuditExportsResponse{
+		Exports: exports,
+	})
+}
+
+// GetAuditExport returns the status of an audit export.
+func (h *Handler) GetAuditExport(w http.ResponseWriter, r *http.Request) {
+	exp, err := h.auth.GetAuditExport(chi.URLParam(r, "id"))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, exp)
+}
+
+// GetAuditExportBundle returns the zip file of a completed audit export.
+func (h *Handler) GetAuditExportBundle(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	b, err := h.auth.GetAuditExportBundle(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-export-`+id+`.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if _, err := w.Write(b); err != nil {
+		api.LogError(w, errors.Wrap(err, "error writing audit export"))
+	}
+}
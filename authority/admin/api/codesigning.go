@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+)
+
+// GetCodeSigningRequestsResponse is the type for GET
+// /admin/codesigning/requests responses.
+type GetCodeSigningRequestsResponse struct {
+	Requests []*authority.CodeSigningRequest `json:"requests"`
+}
+
+// GetCodeSigningRequests returns the code signing requests.
+func (h *Handler) GetCodeSigningRequests(w http.ResponseWriter, r *http.Request) {
+	requests, err := h.auth.GetCodeSigningRequests()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetCodeSigningRequestsResponse{
+		Requests: requests,
+	})
+}
+
+// ApproveCodeSigningRequest approves a code signing request, the certificate
+// will be issued the next time the client requests it.
+func (h *Handler) ApproveCodeSigningRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	cr, err := h.auth.ApproveCodeSigningRequest(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, cr)
+}
+
+// RejectCodeSigningRequest rejects a code signing request.
+func (h *Handler) RejectCodeSigningRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	cr, err := h.auth.RejectCodeSigningRequest(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, cr)
+}
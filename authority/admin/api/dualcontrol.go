@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+	"go.step.sm/linkedca"
+)
+
+// GetDualControlOperationsResponse is the type for GET /admin/dualcontrol
+// responses.
+type GetDualControlOperationsResponse struct {
+	Operations []*authority.DualControlOperation `json:"operations"`
+}
+
+// RequestDualControlOperationRequest is the type for POST /admin/dualcontrol
+// requests.
+type RequestDualControlOperationRequest struct {
+	Type       string            `json:"type"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// adminFromContext returns the administrator that signed the token of the
+// request.
+func adminFromContext(r *http.Request) *linkedca.Admin {
+	adm, _ := r.Context().Value(adminContextKey).(*linkedca.Admin)
+	return adm
+}
+
+// GetDualControlOperations returns the operations under dual control.
+func (h *Handler) GetDualControlOperations(w http.ResponseWriter, r *http.Request) {
+	operations, err := h.auth.GetDualControlOperations()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetDualControlOperationsResponse{
+		Operations: operations,
+	})
+}
+
+// RequestDualControlOperation creates an operation that must be confirmed by
+// a second administrator.
+func (h *Handler) RequestDualControlOperation(w http.ResponseWriter, r *http.Request) {
+	var body RequestDualControlOperationRequest
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	h.requestDualControl(w, r, body.Type, body.Parameters)
+}
+
+// ConfirmDualControlOperation confirms an operation under dual control. The
+// admin token of the request is kept as the signed confirmation.
+func (h *Handler) ConfirmDualControlOperation(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	o, err := h.auth.ConfirmDualControlOperation(id, adminFromContext(r), r.Header.Get("Authorization"))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, o)
+}
+
+// requestDualControl creates an operation under dual control and writes it
+// with a 202 Accepted status.
+func (h *Handler) requestDualControl(w http.ResponseWriter, r *http.Request, op string, params map[string]string) {
+	o, err := h.auth.RequestDualControlOperation(adminFromContext(r), r.Header.Get("Authorization"), op, params)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSONStatus(w, o, http.StatusAccepted)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+// GetFederatedAuthoritiesResponse is the type for GET /admin/federation
+// responses.
+type GetFederatedAuthoritiesResponse struct {
+	Authorities []*authority.FederatedAuthority `json:"authorities"`
+}
+
+// GetFederatedAuthorities returns the authorities in the federation.
+func (h *Handler) GetFederatedAuthorities(w http.ResponseWriter, r *http.Request) {
+	authorities, err := h.auth.GetFederatedAuthorities()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetFederatedAuthoritiesResponse{
+		Authorities: authorities,
+	})
+}
+
+// AddFederatedAuthority adds an authority to the federation. Its roots are
+// returned by the federation endpoint right away. If federation changes are
+// under dual control, the change is executed once a second administrator
+// confirms it.
+func (h *Handler) AddFederatedAuthority(w http.ResponseWriter, r *http.Request) {
+	var body authority.FederatedAuthority
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if h.auth.IsDualControlRequired(config.DualControlFederationChange) {
+		h.requestDualControl(w, r, config.DualControlFederationChange, map[string]string{
+			"action": authority.DualControlFederationAdd,
+			"name":   body.Name,
+			"roots":  strings.Join(body.Roots, "\n"),
+		})
+		return
+	}
+	if err := h.auth.AddFederatedAuthority(&body); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSONStatus(w, &body, http.StatusCreated)
+}
+
+// RemoveFederatedAuthority removes an authority added with the admin API from
+// the federation. If federation changes are under dual control, the change is
+// executed once a second administrator confirms it.
+func (h *Handler) RemoveFederatedAuthority(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing name"))
+		return
+	}
+	if h.auth.IsDualControlRequired(config.DualControlFederationChange) {
+		h.requestDualControl(w, r, config.DualControlFederationChange, map[string]string{
+			"action": authority.DualControlFederationRemove,
+			"name":   name,
+		})
+		return
+	}
+	if err := h.auth.RemoveFederatedAuthority(name); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &DeleteResponse{Status: "ok"})
+}
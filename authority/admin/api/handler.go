@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
@@ -8,13 +9,16 @@ import (
 
 // Handler is the ACME API request handler.
 type Handler struct {
-	db   admin.DB
-	auth *authority.Authority
+	db     admin.DB
+	acmeDB acme.DB
+	auth   *authority.Authority
 }
 
-// NewHandler returns a new Authority Config Handler.
-func NewHandler(auth *authority.Authority) api.RouterHandler {
-	h := &Handler{db: auth.GetAdminDatabase(), auth: auth}
+// NewHandler returns a new Authority Config Handler. The ACME database is
+// optional, and it is used to report the usage of the ACME provisioners and
+// to manage their external account binding keys.
+func NewHandler(auth *authority.Authority, acmeDB acme.DB) api.RouterHandler {
+	h := &Handler{db: auth.GetAdminDatabase(), acmeDB: acmeDB, auth: auth}
 
 	return h
 }
@@ -22,6 +26,11 @@ func NewHandler(auth *authority.Authority) api.RouterHandler {
 // Route traffic and implement the Router interface.
 func (h *Handler) Route(r api.Router) {
 	authnz := func(next nextHTTP) nextHTTP {
+		return h.extractAuthorizeTokenAdmin(h.requireAPIEnabled(h.requireWebAuthnSession(next)))
+	}
+	// The WebAuthn ceremonies do not require a step-up session, they are
+	// used to create it.
+	authn := func(next nextHTTP) nextHTTP {
 		return h.extractAuthorizeTokenAdmin(h.requireAPIEnabled(next))
 	}
 
@@ -31,6 +40,12 @@ func (h *Handler) Route(r api.Router) {
 	r.MethodFunc("POST", "/provisioners", authnz(h.CreateProvisioner))
 	r.MethodFunc("PUT", "/provisioners/{name}", authnz(h.UpdateProvisioner))
 	r.MethodFunc("DELETE", "/provisioners/{name}", authnz(h.DeleteProvisioner))
+	r.MethodFunc("GET", "/provisioners/{name}/acme/usage", authnz(h.GetACMEUsage))
+	r.MethodFunc("GET", "/provisioners/{name}/acme/eab", authnz(h.GetExternalAccountKeys))
+	r.MethodFunc("POST", "/provisioners/{name}/acme/eab", authnz(h.CreateExternalAccountKey))
+	r.MethodFunc("DELETE", "/provisioners/{name}/acme/eab/{id}", authnz(h.DeleteExternalAccountKey))
+	r.MethodFunc("GET", "/provisioners/{name}/usage", authnz(h.GetProvisionerUsage))
+	r.MethodFunc("GET", "/usage/provisioners", authnz(h.GetProvisionersUsage))
 
 	// Admins
 	r.MethodFunc("GET", "/admins/{id}", authnz(h.GetAdmin))
@@ -38,4 +53,68 @@ func (h *Handler) Route(r api.Router) {
 	r.MethodFunc("POST", "/admins", authnz(h.CreateAdmin))
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(h.UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(h.DeleteAdmin))
+
+	// SCEP approval queue
+	r.MethodFunc("GET", "/scep/requests", authnz(h.GetSCEPPendingRequests))
+	r.MethodFunc("POST", "/scep/requests/{id}/approve", authnz(h.ApproveSCEPPendingRequest))
+	r.MethodFunc("POST", "/scep/requests/{id}/reject", authnz(h.RejectSCEPPendingRequest))
+
+	// Device attestation policy
+	r.MethodFunc("GET", "/attestation/policy", authnz(h.GetAttestationPolicy))
+	r.MethodFunc("PUT", "/attestation/policy", authnz(h.UpdateAttestationPolicy))
+
+	// Trust on first use enrollments
+	r.MethodFunc("DELETE", "/tofu/{identifier}", authnz(h.DeleteTOFUIdentity))
+
+	// Issuance quotas
+	r.MethodFunc("GET", "/quotas/overrides", authnz(h.GetQuotaOverrides))
+	r.MethodFunc("PUT", "/quotas/overrides", authnz(h.SetQuotaOverride))
+	r.MethodFunc("DELETE", "/quotas/overrides/{subject}", authnz(h.DeleteQuotaOverride))
+
+	// Code signing approval queue
+	r.MethodFunc("GET", "/codesigning/requests", authnz(h.GetCodeSigningRequests))
+	r.MethodFunc("POST", "/codesigning/requests/{id}/approve", authnz(h.ApproveCodeSigningRequest))
+	r.MethodFunc("POST", "/codesigning/requests/{id}/reject", authnz(h.RejectCodeSigningRequest))
+
+	// Sign requests held for approval
+	r.MethodFunc("GET", "/approvals", authnz(h.GetSignApprovalRequests))
+	r.MethodFunc("POST", "/approvals/{id}/approve", authnz(h.ApproveSignRequest))
+	r.MethodFunc("POST", "/approvals/{id}/deny", authnz(h.DenySignRequest))
+
+	// Federated authorities
+	r.MethodFunc("GET", "/federation", authnz(h.GetFederatedAuthorities))
+	r.MethodFunc("POST", "/federation", authnz(h.AddFederatedAuthority))
+	r.MethodFunc("DELETE", "/federation/{name}", authnz(h.RemoveFederatedAuthority))
+
+	// Operations that require the confirmation of two administrators
+	r.MethodFunc("GET", "/dualcontrol", authnz(h.GetDualControlOperations))
+	r.MethodFunc("POST", "/dualcontrol", authnz(h.RequestDualControlOperation))
+	r.MethodFunc("POST", "/dualcontrol/{id}/confirm", authnz(h.ConfirmDualControlOperation))
+
+	// Revocation of all the certificates of a provisioner
+	r.MethodFunc("GET", "/revocations", authnz(h.GetRevocationJobs))
+	r.MethodFunc("GET", "/revocations/{id}", authnz(h.GetRevocationJob))
+	r.MethodFunc("POST", "/revocations", authnz(h.RevokeProvisioner))
+
+	// Signed exports of the audit evidence
+	r.MethodFunc("GET", "/audit/exports", authnz(h.GetAuditExports))
+	r.MethodFunc("GET", "/audit/exports/{id}", authnz(h.GetAuditExport))
+	r.MethodFunc("GET", "/audit/exports/{id}/bundle", authnz(h.GetAuditExportBundle))
+	r.MethodFunc("POST", "/audit/exports", authnz(h.CreateAuditExport))
+
+	// Inventory of the labeled certificates
+	r.MethodFunc("GET", "/certificates", authnz(h.GetCertificates))
+	r.MethodFunc("GET", "/certificates/{serial}", authnz(h.GetCertificate))
+
+	// SSH certificates by fingerprint
+	r.MethodFunc("GET", "/ssh/certificates", authnz(h.GetSSHCertificate))
+
+	// WebAuthn security keys and step-up sessions
+	r.MethodFunc("POST", "/webauthn/registrations/begin", authn(h.BeginWebAuthnRegistration))
+	r.MethodFunc("POST", "/webauthn/registrations/finish", authn(h.FinishWebAuthnRegistration))
+	r.MethodFunc("POST", "/webauthn/assertions/begin", authn(h.BeginWebAuthnAssertion))
+	r.MethodFunc("POST", "/webauthn/assertions/finish", authn(h.FinishWebAuthnAssertion))
+	r.MethodFunc("POST", "/webauthn/enrollments", authnz(h.CreateWebAuthnEnrollment))
+	r.MethodFunc("GET", "/webauthn/credentials", authnz(h.GetWebAuthnCredentials))
+	r.MethodFunc("DELETE", "/webauthn/credentials/{id}", authnz(h.DeleteWebAuthnCredential))
 }
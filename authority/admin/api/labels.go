@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetCertificatesResponse is the type for GET /admin/certificates responses.
+type GetCertificatesResponse struct {
+	Certificates []*authority.CertificateLabels `json:"certificates"`
+}
+
+// parseLabelSelector parses the label query parameters, "key=value" to match
+// a value or "key" to match any value.
+func parseLabelSelector(values []string) (map[string]string, error) {
+	selector := make(map[string]string, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if parts[0] == "" {
+			return nil, admin.NewError(admin.ErrorBadRequestType, "label %q is not valid", v)
+		}
+		if len(parts) == 2 {
+			selector[parts[0]] = parts[1]
+		} else {
+			selector[parts[0]] = ""
+		}
+	}
+	return selector, nil
+}
+
+// GetCertificates returns the labeled certificates, filtered by the label
+// query parameters, e.g. ?label=team=platform&label=env. Expired certificates
+// are included with ?expired=true.
+func (h *Handler) GetCertificates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selector, err := parseLabelSelector(query["label"])
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	certs, err := h.auth.ListCertificateLabels(selector, query.Get("expired") == "true")
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetCertificatesResponse{
+		Certificates: certs,
+	})
+}
+
+// GetCertificate returns the labels of a certificate.
+func (h *Handler) GetCertificate(w http.ResponseWriter, r *http.Request) {
+	c, err := h.auth.GetCertificateLabels(chi.URLParam(r, "serial"))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, c)
+}
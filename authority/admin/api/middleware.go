@@ -44,6 +44,23 @@ func (h *Handler) extractAuthorizeTokenAdmin(next nextHTTP) nextHTTP {
 	}
 }
 
+// requireWebAuthnSession is a middleware that requires a WebAuthn step-up
+// session for the mutating requests if WebAuthn is configured. It must run
+// after extractAuthorizeTokenAdmin.
+func (h *Handler) requireWebAuthnSession(next nextHTTP) nextHTTP {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		default:
+			if err := h.auth.AuthorizeWebAuthnSession(adminFromContext(r), r.Header.Get(webAuthnSessionHeader)); err != nil {
+				api.WriteError(w, err)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
 // ContextKey is the key type for storing and searching for ACME request
 // essentials in the context of a request.
 type ContextKey string
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetQuotaOverridesResponse is the type for GET /admin/quotas/overrides
+// responses.
+type GetQuotaOverridesResponse struct {
+	Overrides []*authority.QuotaOverride `json:"overrides"`
+}
+
+// GetQuotaOverrides returns the quota limits set by the administrators.
+func (h *Handler) GetQuotaOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.auth.GetQuotaOverrides()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetQuotaOverridesResponse{
+		Overrides: overrides,
+	})
+}
+
+// SetQuotaOverride sets the limit of active certificates of a quota subject.
+func (h *Handler) SetQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	var body authority.QuotaOverride
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := h.auth.SetQuotaOverride(&body); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &body)
+}
+
+// DeleteQuotaOverride removes the override of a quota subject.
+func (h *Handler) DeleteQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	subject, err := url.PathUnescape(chi.URLParam(r, "subject"))
+	if err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing subject"))
+		return
+	}
+	if err := h.auth.DeleteQuotaOverride(subject); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &DeleteResponse{Status: "ok"})
+}
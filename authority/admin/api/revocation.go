@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetRevocationJobsResponse is the type for GET /admin/revocations responses.
+type GetRevocationJobsResponse struct {
+	Jobs []*authority.RevocationJob `json:"jobs"`
+}
+
+// RevokeProvisioner starts a job that revokes all the active certificates
+// issued by a provisioner.
+func (h *Handler) RevokeProvisioner(w http.ResponseWriter, r *http.Request) {
+	var body authority.RevokeProvisionerOptions
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	job, err := h.auth.RevokeProvisioner(&body)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSONStatus(w, job, http.StatusAccepted)
+}
+
+// GetRevocationJobs returns all the revocation jobs.
+func (h *Handler) GetRevocationJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.auth.GetRevocationJobs()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetRevocationJobsResponse{
+		Jobs: jobs,
+	})
+}
+
+// GetRevocationJob returns the progress of a revocation job.
+func (h *Handler) GetRevocationJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.auth.GetRevocationJob(chi.URLParam(r, "id"))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, job)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/scep"
+)
+
+// GetSCEPPendingRequestsResponse is the type for GET /admin/scep/requests
+// responses.
+type GetSCEPPendingRequestsResponse struct {
+	Requests []*scep.PendingRequest `json:"requests"`
+}
+
+// GetSCEPPendingRequests returns the SCEP enrollments waiting for approval.
+func (h *Handler) GetSCEPPendingRequests(w http.ResponseWriter, r *http.Request) {
+	prs, err := h.auth.GetSCEPPendingRequests()
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetSCEPPendingRequestsResponse{
+		Requests: prs,
+	})
+}
+
+// ApproveSCEPPendingRequest approves a SCEP enrollment, the certificate will
+// be issued the next time the client polls for it.
+func (h *Handler) ApproveSCEPPendingRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	pr, err := h.auth.ApproveSCEPPendingRequest(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, pr)
+}
+
+// RejectSCEPPendingRequest rejects a SCEP enrollment.
+func (h *Handler) RejectSCEPPendingRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	pr, err := h.auth.RejectSCEPPendingRequest(id)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, pr)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetSSHCertificate returns the record of the SSH certificate with the
+// fingerprint in the query, e.g. ?fingerprint=SHA256:base64. It accepts the
+// fingerprint of the certificate or the fingerprint of the signed key, as
+// logged by the SSH servers.
+func (h *Handler) GetSSHCertificate(w http.ResponseWriter, r *http.Request) {
+	fingerprint := r.URL.Query().Get("fingerprint")
+	if fingerprint == "" {
+		api.WriteError(w, admin.NewError(admin.ErrorBadRequestType, "fingerprint cannot be empty"))
+		return
+	}
+	info, err := h.auth.GetSSHCertificateInfo(fingerprint)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, info)
+}
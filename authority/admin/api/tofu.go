@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+)
+
+// DeleteTOFUIdentity removes the record of an identifier enrolled using trust
+// on first use, allowing a replaced device to enroll again.
+func (h *Handler) DeleteTOFUIdentity(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "identifier")
+
+	if err := h.auth.DeleteTOFUIdentity(id); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetProvisionersUsageResponse is the type for GET /admin/usage/provisioners
+// responses.
+type GetProvisionersUsageResponse struct {
+	Provisioners []*authority.ProvisionerUsage `json:"provisioners"`
+	NextCursor   string                        `json:"nextCursor"`
+}
+
+// GetProvisionerUsage returns the last use and the issuance counts of the
+// requested provisioner.
+func (h *Handler) GetProvisionerUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.auth.GetProvisionerUsage(chi.URLParam(r, "name"))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, usage)
+}
+
+// GetProvisionersUsage returns the usage of a page of provisioners. With the
+// query parameter stale=true, only the stale provisioners are returned.
+func (h *Handler) GetProvisionersUsage(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor & limit query params"))
+		return
+	}
+
+	staleOnly := r.URL.Query().Get("stale") == "true"
+	usage, next, err := h.auth.GetProvisionersUsage(cursor, limit, staleOnly)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetProvisionersUsageResponse{
+		Provisioners: usage,
+		NextCursor:   next,
+	})
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/webauthn"
+)
+
+// webAuthnSessionHeader is the header with the step-up session token of the
+// mutating requests.
+const webAuthnSessionHeader = "X-WebAuthn-Session"
+
+// webAuthnEnrollmentHeader is the header with the enrollment code of the
+// registration of the first security key.
+const webAuthnEnrollmentHeader = "X-WebAuthn-Enrollment"
+
+// CreateWebAuthnEnrollmentRequest is the type for POST
+// /admin/webauthn/enrollments requests.
+type CreateWebAuthnEnrollmentRequest struct {
+	AdminID string `json:"adminID"`
+}
+
+// FinishWebAuthnRegistrationRequest is the type for POST
+// /admin/webauthn/registrations/finish requests.
+type FinishWebAuthnRegistrationRequest struct {
+	Name       string                               `json:"name"`
+	Credential *webauthn.CredentialCreationResponse `json:"credential"`
+}
+
+// GetWebAuthnCredentialsResponse is the type for GET
+// /admin/webauthn/credentials responses.
+type GetWebAuthnCredentialsResponse struct {
+	Credentials []*authority.WebAuthnCredential `json:"credentials"`
+}
+
+// BeginWebAuthnRegistration returns the options to register a new security
+// key.
+func (h *Handler) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	opts, err := h.auth.BeginWebAuthnRegistration(adminFromContext(r), r.Header.Get(webAuthnSessionHeader), r.Header.Get(webAuthnEnrollmentHeader))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, opts)
+}
+
+// FinishWebAuthnRegistration verifies and stores a new security key.
+func (h *Handler) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	// The credential is created by the browser.
+	var body FinishWebAuthnRegistrationRequest
+	if err := api.ReadLenientJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if body.Credential == nil {
+		api.WriteError(w, admin.NewError(admin.ErrorBadRequestType, "credential cannot be empty"))
+		return
+	}
+
+	cred, err := h.auth.FinishWebAuthnRegistration(adminFromContext(r), r.Header.Get(webAuthnSessionHeader),
+		r.Header.Get(webAuthnEnrollmentHeader), body.Name, body.Credential)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSONStatus(w, cred, http.StatusCreated)
+}
+
+// BeginWebAuthnAssertion returns the options to authenticate with one of the
+// security keys of the administrator.
+func (h *Handler) BeginWebAuthnAssertion(w http.ResponseWriter, r *http.Request) {
+	opts, err := h.auth.BeginWebAuthnAssertion(adminFromContext(r))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, opts)
+}
+
+// FinishWebAuthnAssertion verifies the assertion of a security key and
+// returns a step-up session.
+func (h *Handler) FinishWebAuthnAssertion(w http.ResponseWriter, r *http.Request) {
+	var body webauthn.CredentialAssertionResponse
+	if err := api.ReadLenientJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	session, err := h.auth.FinishWebAuthnAssertion(adminFromContext(r), &body)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, session)
+}
+
+// CreateWebAuthnEnrollment creates the enrollment code of the first security
+// key of an administrator.
+func (h *Handler) CreateWebAuthnEnrollment(w http.ResponseWriter, r *http.Request) {
+	var body CreateWebAuthnEnrollmentRequest
+	if err := api.ReadJSON(r.Body, &body); err != nil {
+		api.WriteError(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if body.AdminID == "" {
+		api.WriteError(w, admin.NewError(admin.ErrorBadRequestType, "adminID cannot be empty"))
+		return
+	}
+
+	e, err := h.auth.CreateWebAuthnEnrollment(adminFromContext(r), body.AdminID)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSONStatus(w, e, http.StatusCreated)
+}
+
+// GetWebAuthnCredentials returns the security keys of the administrator.
+func (h *Handler) GetWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	credentials, err := h.auth.GetWebAuthnCredentials(adminFromContext(r))
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &GetWebAuthnCredentialsResponse{
+		Credentials: credentials,
+	})
+}
+
+// DeleteWebAuthnCredential removes a security key.
+func (h *Handler) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.auth.DeleteWebAuthnCredential(adminFromContext(r), id); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	api.JSON(w, &DeleteResponse{Status: "ok"})
+}
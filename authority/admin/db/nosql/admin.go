@@ -145,7 +145,7 @@ func (db *DB) CreateAdmin(ctx context.Context, adm *linkedca.Admin) error {
 		ProvisionerID: adm.ProvisionerId,
 		Subject:       adm.Subject,
 		Type:          adm.Type,
-		CreatedAt:     clock.Now(),
+		CreatedAt:     db.clock.Now(),
 	}
 
 	return db.save(ctx, dba.ID, dba, nil, "admin", adminsTable)
@@ -172,7 +172,7 @@ func (db *DB) DeleteAdmin(ctx context.Context, id string) error {
 	}
 
 	nu := old.clone()
-	nu.DeletedAt = clock.Now()
+	nu.DeletedAt = db.clock.Now()
 
 	return db.save(ctx, old.ID, nu, old, "admin", adminsTable)
 }
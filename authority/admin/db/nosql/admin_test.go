@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/nosql"
 	"github.com/smallstep/nosql/database"
@@ -17,6 +18,10 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// clock is the clock of the databases created in the tests, the zero value
+// of their clock field.
+var clock provisioner.UTCClock
+
 func TestDB_getDBAdminBytes(t *testing.T) {
 	adminID := "adminID"
 	type test struct {
@@ -3,9 +3,9 @@ package nosql
 import (
 	"context"
 	"encoding/json"
-	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
 	nosqlDB "github.com/smallstep/nosql/database"
 	"go.step.sm/crypto/randutil"
 )
@@ -19,10 +19,22 @@ var (
 type DB struct {
 	db          nosqlDB.DB
 	authorityID string
+	clock       provisioner.UTCClock
+}
+
+// Option is the type of the options passed to New.
+type Option func(*DB)
+
+// WithClock sets the source of the creation and deletion times of the admins
+// and provisioners. If not set the system clock is used.
+func WithClock(c provisioner.Clock) Option {
+	return func(db *DB) {
+		db.clock = provisioner.UTCClock{Clock: c}
+	}
 }
 
 // New configures and returns a new Authority DB backend implemented using a nosql DB.
-func New(db nosqlDB.DB, authorityID string) (*DB, error) {
+func New(db nosqlDB.DB, authorityID string, opts ...Option) (*DB, error) {
 	tables := [][]byte{adminsTable, provisionersTable}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -30,7 +42,11 @@ func New(db nosqlDB.DB, authorityID string) (*DB, error) {
 				string(b))
 		}
 	}
-	return &DB{db, authorityID}, nil
+	d := &DB{db: db, authorityID: authorityID}
+	for _, fn := range opts {
+		fn(d)
+	}
+	return d, nil
 }
 
 // save writes the new data to the database, overwriting the old data if it
@@ -76,13 +92,3 @@ func randID() (val string, err error) {
 	}
 	return val, nil
 }
-
-// Clock that returns time in UTC rounded to seconds.
-type Clock struct{}
-
-// Now returns the UTC time rounded to seconds.
-func (c *Clock) Now() time.Time {
-	return time.Now().UTC().Truncate(time.Second)
-}
-
-var clock = new(Clock)
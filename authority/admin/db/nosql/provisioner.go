@@ -163,7 +163,7 @@ func (db *DB) CreateProvisioner(ctx context.Context, prov *linkedca.Provisioner)
 		Details:      details,
 		X509Template: prov.X509Template,
 		SSHTemplate:  prov.SshTemplate,
-		CreatedAt:    clock.Now(),
+		CreatedAt:    db.clock.Now(),
 	}
 
 	if err := db.save(ctx, prov.Id, dbp, nil, "provisioner", provisionersTable); err != nil {
@@ -205,7 +205,7 @@ func (db *DB) DeleteProvisioner(ctx context.Context, id string) error {
 	}
 
 	nu := old.clone()
-	nu.DeletedAt = clock.Now()
+	nu.DeletedAt = db.clock.Now()
 
 	return db.save(ctx, old.ID, nu, old, "provisioner", provisionersTable)
 }
@@ -106,11 +106,13 @@ var (
 
 // Error represents an Admin
 type Error struct {
-	Type    string `json:"type"`
-	Detail  string `json:"detail"`
-	Message string `json:"message"`
-	Err     error  `json:"-"`
-	Status  int    `json:"-"`
+	Type             string `json:"type"`
+	Detail           string `json:"detail"`
+	Message          string `json:"message"`
+	Code             string `json:"code"`
+	DocumentationURL string `json:"documentationURL"`
+	Err              error  `json:"-"`
+	Status           int    `json:"-"`
 }
 
 // IsType returns true if the error type matches the input type.
@@ -127,19 +129,25 @@ func newError(pt ProblemType, err error) *Error {
 	meta, ok := errorMap[pt]
 	if !ok {
 		meta = errorServerInternalMetadata
+		code := ErrorServerInternalType.String()
 		return &Error{
-			Type:   meta.typ,
-			Detail: meta.details,
-			Status: meta.status,
-			Err:    err,
+			Type:             meta.typ,
+			Detail:           meta.details,
+			Code:             code,
+			DocumentationURL: errs.DocumentationURL(code),
+			Status:           meta.status,
+			Err:              err,
 		}
 	}
 
+	code := pt.String()
 	return &Error{
-		Type:   meta.typ,
-		Detail: meta.details,
-		Status: meta.status,
-		Err:    err,
+		Type:             meta.typ,
+		Detail:           meta.details,
+		Code:             code,
+		DocumentationURL: errs.DocumentationURL(code),
+		Status:           meta.status,
+		Err:              err,
 	}
 }
 
@@ -203,6 +211,11 @@ func WriteError(w http.ResponseWriter, err *Error) {
 	w.WriteHeader(err.StatusCode())
 
 	err.Message = err.Err.Error()
+	// Use the message configured by the operator if any
+	if msg, ok := errs.Localize(w, err.Code); ok {
+		err.Detail = msg
+		err.Message = msg
+	}
 	// Write errors in the response writer
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		rl.WithFields(map[string]interface{}{
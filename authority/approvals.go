@@ -0,0 +1,321 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+var signApprovalsTable = []byte("sign_approvals")
+
+// SignApprovalStatus is the status of a sign request held for approval.
+type SignApprovalStatus string
+
+const (
+	// SignApprovalPending is the status of requests waiting for a decision.
+	SignApprovalPending SignApprovalStatus = "pending"
+	// SignApprovalApproved is the status of requests that can be issued.
+	SignApprovalApproved SignApprovalStatus = "approved"
+	// SignApprovalDenied is the status of requests that will not be issued.
+	SignApprovalDenied SignApprovalStatus = "denied"
+)
+
+// SignApprovalRequest is a sign request held until an administrator approves
+// it. The request is identified by the provisioner, the public key and the
+// names of the certificate, and an approval is valid for one certificate.
+// Pending and approved requests expire after the expiry configured in the
+// provisioner.
+type SignApprovalRequest struct {
+	ID          string             `json:"id"`
+	Provisioner string             `json:"provisioner"`
+	Subject     string             `json:"subject"`
+	Names       []string           `json:"names"`
+	Status      SignApprovalStatus `json:"status"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	ExpiresAt   time.Time          `json:"expiresAt"`
+}
+
+// isExpired returns true if a pending or approved request has expired. Denied
+// requests do not expire, so the same request is not created again.
+func (r *SignApprovalRequest) isExpired(now time.Time) bool {
+	return r.Status != SignApprovalDenied && !now.Before(r.ExpiresAt)
+}
+
+// signApprovalStore keeps the sign requests held for approval in the
+// database.
+type signApprovalStore struct {
+	db nosql.DB
+}
+
+func newSignApprovalStore(db nosql.DB) (*signApprovalStore, error) {
+	if err := db.CreateTable(signApprovalsTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(signApprovalsTable))
+	}
+	return &signApprovalStore{db: db}, nil
+}
+
+func (s *signApprovalStore) get(id string) (*SignApprovalRequest, error) {
+	b, err := s.db.Get(signApprovalsTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading sign request %s", id)
+	}
+	r := new(SignApprovalRequest)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling sign request %s", id)
+	}
+	return r, nil
+}
+
+func (s *signApprovalStore) list() ([]*SignApprovalRequest, error) {
+	entries, err := s.db.List(signApprovalsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading sign requests")
+	}
+	requests := []*SignApprovalRequest{}
+	for _, e := range entries {
+		r := new(SignApprovalRequest)
+		if err := json.Unmarshal(e.Value, r); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling sign request %s", string(e.Key))
+		}
+		requests = append(requests, r)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
+
+func (s *signApprovalStore) set(r *SignApprovalRequest) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling sign request %s", r.ID)
+	}
+	return errors.Wrapf(s.db.Set(signApprovalsTable, []byte(r.ID), b), "error storing sign request %s", r.ID)
+}
+
+func (s *signApprovalStore) delete(id string) error {
+	return errors.Wrapf(s.db.Del(signApprovalsTable, []byte(id)), "error deleting sign request %s", id)
+}
+
+// getSignApprovalStore returns the store of the sign requests held for
+// approval, it's created the first time it's used. It must be called with the
+// signApprovalMutex held.
+func (a *Authority) getSignApprovalStore() (*signApprovalStore, error) {
+	if a.signApprovals == nil {
+		store, err := newSignApprovalStore(a.getStateDB())
+		if err != nil {
+			return nil, err
+		}
+		a.signApprovals = store
+	}
+	return a.signApprovals, nil
+}
+
+// certificateNames returns the common name and the SANs of the given
+// certificate, without duplicates.
+func certificateNames(crt *x509.Certificate) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	add(crt.Subject.CommonName)
+	for _, name := range crt.DNSNames {
+		add(name)
+	}
+	for _, ip := range crt.IPAddresses {
+		add(ip.String())
+	}
+	for _, email := range crt.EmailAddresses {
+		add(email)
+	}
+	for _, u := range crt.URIs {
+		add(u.String())
+	}
+	return names
+}
+
+// signApprovalRequestID returns the id of the sign request for the given
+// provisioner, public key and names.
+func signApprovalRequestID(provisionerName string, csr *x509.CertificateRequest, names []string) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling public key")
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	h.Write([]byte(provisionerName))
+	h.Write([]byte{0})
+	h.Write(der)
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(sorted, "\x00")))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkSignApproval holds the sign requests of the provisioners with the
+// approval options until they are approved. The first request creates a
+// pending request. It returns the id of the approved request, or an empty
+// string if the provisioner does not require an approval or the request was
+// approved automatically.
+func (a *Authority) checkSignApproval(p provisioner.Interface, csr *x509.CertificateRequest, leaf *x509.Certificate) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	o := getProvisionerOptions(p).GetApproval()
+	if o == nil {
+		return "", nil
+	}
+	names := certificateNames(leaf)
+	if o.IsAutoApproved(names) {
+		return "", nil
+	}
+	id, err := signApprovalRequestID(p.GetName(), csr, names)
+	if err != nil {
+		return "", errs.Wrap(http.StatusInternalServerError, err, "authority.checkSignApproval")
+	}
+
+	a.signApprovalMutex.Lock()
+	defer a.signApprovalMutex.Unlock()
+	store, err := a.getSignApprovalStore()
+	if err != nil {
+		return "", errs.Wrap(http.StatusInternalServerError, err, "authority.checkSignApproval")
+	}
+	r, err := store.get(id)
+	if err != nil {
+		return "", errs.Wrap(http.StatusInternalServerError, err, "authority.checkSignApproval")
+	}
+
+	now := a.now().UTC().Truncate(time.Second)
+	if r != nil && r.isExpired(now) {
+		r = nil
+	}
+
+	switch {
+	case r == nil:
+		r = &SignApprovalRequest{
+			ID:          id,
+			Provisioner: p.GetName(),
+			Subject:     leaf.Subject.CommonName,
+			Names:       names,
+			Status:      SignApprovalPending,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			ExpiresAt:   now.Add(o.GetExpiry()),
+		}
+		if err := store.set(r); err != nil {
+			return "", errs.Wrap(http.StatusInternalServerError, err, "authority.checkSignApproval")
+		}
+		fallthrough
+	case r.Status == SignApprovalPending:
+		return "", errs.Forbidden("authority.checkSignApproval; sign request %s is pending", id,
+			errs.WithMessage("The sign request %s is waiting for approval.", id),
+			errs.WithCode(errs.CodeApprovalRequired))
+	case r.Status == SignApprovalDenied:
+		return "", errs.Forbidden("authority.checkSignApproval; sign request %s has been denied", id,
+			errs.WithMessage("The sign request %s has been denied.", id))
+	default:
+		return id, nil
+	}
+}
+
+// consumeSignApproval removes the approval used to issue a certificate.
+func (a *Authority) consumeSignApproval(id string) error {
+	if id == "" {
+		return nil
+	}
+	a.signApprovalMutex.Lock()
+	defer a.signApprovalMutex.Unlock()
+	store, err := a.getSignApprovalStore()
+	if err != nil {
+		return err
+	}
+	return store.delete(id)
+}
+
+// GetSignApprovalRequests returns the sign requests held for approval. The
+// expired requests are removed.
+func (a *Authority) GetSignApprovalRequests() ([]*SignApprovalRequest, error) {
+	a.signApprovalMutex.Lock()
+	defer a.signApprovalMutex.Unlock()
+	store, err := a.getSignApprovalStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading sign requests")
+	}
+	requests, err := store.list()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading sign requests")
+	}
+
+	now := a.now().UTC()
+	active := requests[:0]
+	for _, r := range requests {
+		if r.isExpired(now) {
+			if err := store.delete(r.ID); err != nil {
+				return nil, admin.WrapErrorISE(err, "error deleting expired sign request")
+			}
+			continue
+		}
+		active = append(active, r)
+	}
+	return active, nil
+}
+
+// ApproveSignRequest approves the sign request with the given id, the
+// certificate will be issued the next time the client sends the request.
+func (a *Authority) ApproveSignRequest(id string) (*SignApprovalRequest, error) {
+	return a.updateSignApprovalRequest(id, SignApprovalApproved)
+}
+
+// DenySignRequest denies the sign request with the given id.
+func (a *Authority) DenySignRequest(id string) (*SignApprovalRequest, error) {
+	return a.updateSignApprovalRequest(id, SignApprovalDenied)
+}
+
+func (a *Authority) updateSignApprovalRequest(id string, status SignApprovalStatus) (*SignApprovalRequest, error) {
+	a.signApprovalMutex.Lock()
+	defer a.signApprovalMutex.Unlock()
+	store, err := a.getSignApprovalStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading sign request")
+	}
+	r, err := store.get(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading sign request")
+	}
+	now := a.now().UTC().Truncate(time.Second)
+	if r == nil || r.isExpired(now) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "sign request %s not found", id)
+	}
+	if r.Status != SignApprovalPending {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "sign request %s is already %s", id, r.Status)
+	}
+	// The approval can be used for the same time the request waited for a
+	// decision.
+	r.ExpiresAt = now.Add(r.ExpiresAt.Sub(r.CreatedAt))
+	r.Status = status
+	r.UpdatedAt = now
+	if err := store.set(r); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing sign request")
+	}
+	return r, nil
+}
@@ -0,0 +1,148 @@
+package authority
+
+import (
+	"crypto/x509"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_checkSignApproval(t *testing.T) {
+	csr := newCodeSigningCSR(t)
+	leaf := &x509.Certificate{
+		Subject:     csr.Subject,
+		DNSNames:    []string{"foo.internal", "release signing"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}
+	p := &provisioner.JWK{Name: "approvals", Options: &provisioner.Options{
+		Approval: &provisioner.ApprovalOptions{
+			AutoApprove: []string{"*.internal"},
+		},
+	}}
+	names := certificateNames(leaf)
+	assert.Equals(t, []string{"release signing", "foo.internal", "10.0.0.1"}, names)
+	id, err := signApprovalRequestID("approvals", csr, names)
+	assert.FatalError(t, err)
+
+	a := &Authority{}
+
+	// Requests not held
+	approvalID, err := a.checkSignApproval(nil, csr, leaf)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", approvalID)
+	approvalID, err = a.checkSignApproval(&provisioner.JWK{Name: "jwk"}, csr, leaf)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", approvalID)
+	approvalID, err = a.checkSignApproval(p, csr, &x509.Certificate{DNSNames: []string{"foo.internal"}})
+	assert.FatalError(t, err)
+	assert.Equals(t, "", approvalID)
+
+	// First request creates a pending request
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeApprovalRequired)
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeApprovalRequired)
+	requests, err := a.GetSignApprovalRequests()
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, len(requests))
+	assert.Equals(t, id, requests[0].ID)
+	assert.Equals(t, "approvals", requests[0].Provisioner)
+	assert.Equals(t, "release signing", requests[0].Subject)
+	assert.Equals(t, names, requests[0].Names)
+	assert.Equals(t, SignApprovalPending, requests[0].Status)
+	assert.Equals(t, provisioner.DefaultApprovalExpiry, requests[0].ExpiresAt.Sub(requests[0].CreatedAt))
+
+	// Approval is valid for one certificate
+	r, err := a.ApproveSignRequest(id)
+	assert.FatalError(t, err)
+	assert.Equals(t, SignApprovalApproved, r.Status)
+	_, err = a.ApproveSignRequest(id)
+	assert.NotNil(t, err)
+	approvalID, err = a.checkSignApproval(p, csr, leaf)
+	assert.FatalError(t, err)
+	assert.Equals(t, id, approvalID)
+	assert.FatalError(t, a.consumeSignApproval(approvalID))
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeApprovalRequired)
+
+	// Denied requests
+	r, err = a.DenySignRequest(id)
+	assert.FatalError(t, err)
+	assert.Equals(t, SignApprovalDenied, r.Status)
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeForbidden)
+
+	// Expired requests
+	assert.FatalError(t, a.consumeSignApproval(id))
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeApprovalRequired)
+	r, err = a.signApprovals.get(id)
+	assert.FatalError(t, err)
+	r.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.FatalError(t, a.signApprovals.set(r))
+	_, err = a.ApproveSignRequest(id)
+	assert.NotNil(t, err)
+	requests, err = a.GetSignApprovalRequests()
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, len(requests))
+
+	// Unknown requests
+	_, err = a.ApproveSignRequest("foo")
+	assert.NotNil(t, err)
+	_, err = a.DenySignRequest("foo")
+	assert.NotNil(t, err)
+}
+
+func TestAuthority_checkSignApproval_expiry(t *testing.T) {
+	clock := provisioner.NewFakeClock(time.Date(2021, 6, 4, 18, 30, 0, 0, time.UTC))
+
+	csr := newCodeSigningCSR(t)
+	leaf := &x509.Certificate{
+		Subject:  csr.Subject,
+		DNSNames: []string{"release signing"},
+	}
+	p := &provisioner.JWK{Name: "approvals", Options: &provisioner.Options{
+		Approval: &provisioner.ApprovalOptions{},
+	}}
+	id, err := signApprovalRequestID("approvals", csr, certificateNames(leaf))
+	assert.FatalError(t, err)
+
+	a := &Authority{clock: clock}
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeApprovalRequired)
+	requests, err := a.GetSignApprovalRequests()
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, len(requests))
+	assert.Equals(t, clock.Now(), requests[0].CreatedAt)
+	assert.Equals(t, clock.Now().Add(provisioner.DefaultApprovalExpiry), requests[0].ExpiresAt)
+
+	// The approval is valid for the time the request waited.
+	clock.Add(time.Hour)
+	r, err := a.ApproveSignRequest(id)
+	assert.FatalError(t, err)
+	assert.Equals(t, clock.Now(), r.UpdatedAt)
+	assert.Equals(t, clock.Now().Add(provisioner.DefaultApprovalExpiry), r.ExpiresAt)
+	approvalID, err := a.checkSignApproval(p, csr, leaf)
+	assert.FatalError(t, err)
+	assert.Equals(t, id, approvalID)
+
+	// Expired approvals are removed and the request is held again.
+	clock.Add(provisioner.DefaultApprovalExpiry)
+	requests, err = a.GetSignApprovalRequests()
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, len(requests))
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeApprovalRequired)
+
+	// Denied requests do not expire.
+	_, err = a.DenySignRequest(id)
+	assert.FatalError(t, err)
+	clock.Add(2 * provisioner.DefaultApprovalExpiry)
+	_, err = a.checkSignApproval(p, csr, leaf)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeForbidden)
+}
@@ -0,0 +1,203 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/nosql"
+)
+
+var (
+	attestationTable     = []byte("attestation_policy")
+	attestationPolicyKey = []byte("policy")
+)
+
+// AttestationPolicy contains the trust anchors and lists used to validate
+// device attestations. The policy is managed using the admin API, and it's
+// kept in the database if the authority has one.
+type AttestationPolicy struct {
+	// Roots is the list of PEM encoded root certificates trusted to sign
+	// attestation certificates.
+	Roots []string `json:"roots"`
+	// EKManufacturers is the list of permitted TPM manufacturer ids, e.g.
+	// "id:53544D20". If empty, any manufacturer is allowed.
+	EKManufacturers []string `json:"ekManufacturers"`
+	// AllowedSerialNumbers is the list of device serial numbers allowed. If
+	// empty, any serial number not denied is allowed.
+	AllowedSerialNumbers []string `json:"allowedSerialNumbers"`
+	// DeniedSerialNumbers is the list of device serial numbers that are
+	// always rejected.
+	DeniedSerialNumbers []string `json:"deniedSerialNumbers"`
+	rootPool            *x509.CertPool
+}
+
+// Init validates and initializes the attestation policy.
+func (p *AttestationPolicy) Init() error {
+	p.rootPool = x509.NewCertPool()
+	for i, s := range p.Roots {
+		block, rest := pem.Decode([]byte(s))
+		if block == nil || block.Type != "CERTIFICATE" || len(strings.TrimSpace(string(rest))) > 0 {
+			return errors.Errorf("roots[%d] is not a PEM encoded certificate", i)
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing roots[%d]", i)
+		}
+		p.rootPool.AddCert(crt)
+	}
+	for i, id := range p.EKManufacturers {
+		if strings.TrimSpace(id) == "" {
+			return errors.Errorf("ekManufacturers[%d] cannot be empty", i)
+		}
+	}
+	if p.Roots == nil {
+		p.Roots = []string{}
+	}
+	if p.EKManufacturers == nil {
+		p.EKManufacturers = []string{}
+	}
+	if p.AllowedSerialNumbers == nil {
+		p.AllowedSerialNumbers = []string{}
+	}
+	if p.DeniedSerialNumbers == nil {
+		p.DeniedSerialNumbers = []string{}
+	}
+	return nil
+}
+
+// VerifyChain verifies that the given attestation certificate chain, leaf
+// first, was signed by one of the trusted roots.
+func (p *AttestationPolicy) VerifyChain(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("attestation certificate chain cannot be empty")
+	}
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         p.rootPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying attestation certificate")
+	}
+	return nil
+}
+
+// IsEKManufacturerAllowed returns true if the given TPM manufacturer id is
+// permitted.
+func (p *AttestationPolicy) IsEKManufacturerAllowed(id string) bool {
+	if len(p.EKManufacturers) == 0 {
+		return true
+	}
+	for _, m := range p.EKManufacturers {
+		if strings.EqualFold(m, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSerialNumberAllowed returns true if the given device serial number is
+// allowed. Denied serial numbers take precedence over the allowed ones.
+func (p *AttestationPolicy) IsSerialNumberAllowed(sn string) bool {
+	for _, s := range p.DeniedSerialNumbers {
+		if s == sn {
+			return false
+		}
+	}
+	if len(p.AllowedSerialNumbers) == 0 {
+		return true
+	}
+	for _, s := range p.AllowedSerialNumbers {
+		if s == sn {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAttestationPolicy returns the policy used to validate device
+// attestations.
+func (a *Authority) GetAttestationPolicy() *AttestationPolicy {
+	a.attestationMutex.RLock()
+	defer a.attestationMutex.RUnlock()
+	if a.attestationPolicy == nil {
+		p := new(AttestationPolicy)
+		_ = p.Init()
+		return p
+	}
+	return a.attestationPolicy
+}
+
+// VerifyKeyAttestation verifies the attestation of the given public key using
+// the attestation policy. It's used to verify the attestation of ACME account
+// keys.
+func (a *Authority) VerifyKeyAttestation(stmt *keyattest.Statement, pub crypto.PublicKey) (*keyattest.Result, error) {
+	policy := a.GetAttestationPolicy()
+	res, err := keyattest.Verify(stmt, pub, keyattest.VerifyOptions{
+		VerifyChain: policy.VerifyChain,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.SerialNumber != "" && !policy.IsSerialNumberAllowed(res.SerialNumber) {
+		return nil, errors.Errorf("device %s is not allowed", res.SerialNumber)
+	}
+	return res, nil
+}
+
+// UpdateAttestationPolicy validates and replaces the policy used to validate
+// device attestations.
+func (a *Authority) UpdateAttestationPolicy(p *AttestationPolicy) error {
+	if err := p.Init(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error validating attestation policy")
+	}
+
+	a.attestationMutex.Lock()
+	defer a.attestationMutex.Unlock()
+	b, err := json.Marshal(p)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error marshaling attestation policy")
+	}
+	if err := a.getStateDB().Set(attestationTable, attestationPolicyKey, b); err != nil {
+		return admin.WrapErrorISE(err, "error storing attestation policy")
+	}
+	a.attestationPolicy = p
+	return nil
+}
+
+// initAttestationPolicy loads the attestation policy from the database. An
+// empty policy, that trusts no roots, is used if there's none.
+func (a *Authority) initAttestationPolicy() error {
+	p := new(AttestationPolicy)
+	db := a.getStateDB()
+	if err := db.CreateTable(attestationTable); err != nil {
+		return errors.Wrapf(err, "error creating table %s", string(attestationTable))
+	}
+	b, err := db.Get(attestationTable, attestationPolicyKey)
+	switch {
+	case nosql.IsErrNotFound(err):
+	case err != nil:
+		return errors.Wrap(err, "error loading attestation policy")
+	default:
+		if err := json.Unmarshal(b, p); err != nil {
+			return errors.Wrap(err, "error unmarshaling attestation policy")
+		}
+	}
+	if err := p.Init(); err != nil {
+		return errors.Wrap(err, "error initializing attestation policy")
+	}
+
+	a.attestationMutex.Lock()
+	a.attestationPolicy = p
+	a.attestationMutex.Unlock()
+	return nil
+}
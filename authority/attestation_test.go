@@ -0,0 +1,120 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func newAttestationCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt, key
+}
+
+func TestAttestationPolicy(t *testing.T) {
+	root, rootKey := newAttestationCert(t, "Attestation Root", true, nil, nil)
+	intermediate, intermediateKey := newAttestationCert(t, "Attestation Intermediate", true, root, rootKey)
+	leaf, _ := newAttestationCert(t, "device", false, intermediate, intermediateKey)
+	otherRoot, otherKey := newAttestationCert(t, "Other Root", true, nil, nil)
+	otherLeaf, _ := newAttestationCert(t, "device", false, otherRoot, otherKey)
+
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+
+	// Init
+	assert.NotNil(t, (&AttestationPolicy{Roots: []string{"foo"}}).Init())
+	assert.NotNil(t, (&AttestationPolicy{Roots: []string{rootPEM + rootPEM}}).Init())
+	assert.NotNil(t, (&AttestationPolicy{EKManufacturers: []string{" "}}).Init())
+
+	p := &AttestationPolicy{
+		Roots:                []string{rootPEM},
+		EKManufacturers:      []string{"id:53544D20"},
+		AllowedSerialNumbers: []string{"1234", "5678"},
+		DeniedSerialNumbers:  []string{"5678"},
+	}
+	assert.FatalError(t, p.Init())
+
+	// VerifyChain
+	assert.NoError(t, p.VerifyChain([]*x509.Certificate{leaf, intermediate}))
+	assert.NotNil(t, p.VerifyChain([]*x509.Certificate{leaf}))
+	assert.NotNil(t, p.VerifyChain([]*x509.Certificate{otherLeaf}))
+	assert.NotNil(t, p.VerifyChain(nil))
+
+	// IsEKManufacturerAllowed
+	assert.True(t, p.IsEKManufacturerAllowed("id:53544d20"))
+	assert.False(t, p.IsEKManufacturerAllowed("id:4E544300"))
+
+	// IsSerialNumberAllowed
+	assert.True(t, p.IsSerialNumberAllowed("1234"))
+	assert.False(t, p.IsSerialNumberAllowed("5678"))
+	assert.False(t, p.IsSerialNumberAllowed("9999"))
+
+	// Empty policy
+	empty := new(AttestationPolicy)
+	assert.FatalError(t, empty.Init())
+	assert.NotNil(t, empty.VerifyChain([]*x509.Certificate{leaf, intermediate}))
+	assert.True(t, empty.IsEKManufacturerAllowed("id:4E544300"))
+	assert.True(t, empty.IsSerialNumberAllowed("9999"))
+	assert.Equals(t, []string{}, empty.Roots)
+}
+
+func TestAuthority_UpdateAttestationPolicy(t *testing.T) {
+	a := testAuthority(t)
+	assert.Equals(t, []string{}, a.GetAttestationPolicy().Roots)
+
+	err := a.UpdateAttestationPolicy(&AttestationPolicy{Roots: []string{"foo"}})
+	assert.NotNil(t, err)
+
+	p := &AttestationPolicy{DeniedSerialNumbers: []string{"1234"}}
+	assert.FatalError(t, a.UpdateAttestationPolicy(p))
+	assert.Equals(t, p, a.GetAttestationPolicy())
+	assert.False(t, a.GetAttestationPolicy().IsSerialNumberAllowed("1234"))
+}
+
+func TestAuthority_VerifyKeyAttestation(t *testing.T) {
+	root, rootKey := newAttestationCert(t, "Attestation Root", true, nil, nil)
+	device, deviceKey := newAttestationCert(t, "Yubico PIV Attestation", false, root, rootKey)
+	policy := &AttestationPolicy{
+		Roots:               []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))},
+		DeniedSerialNumbers: []string{"666"},
+	}
+	assert.FatalError(t, policy.Init())
+
+	csr := newCodeSigningCSR(t)
+	a := &Authority{attestationPolicy: policy}
+
+	res, err := a.VerifyKeyAttestation(newYubiKeyAttestation(t, device, deviceKey, csr, 1234), csr.PublicKey)
+	assert.FatalError(t, err)
+	assert.Equals(t, "1234", res.SerialNumber)
+
+	_, err = a.VerifyKeyAttestation(newYubiKeyAttestation(t, device, deviceKey, csr, 666), csr.PublicKey)
+	assert.Error(t, err)
+	_, err = a.VerifyKeyAttestation(newYubiKeyAttestation(t, device, deviceKey, newCodeSigningCSR(t), 1234), csr.PublicKey)
+	assert.Error(t, err)
+	_, err = (&Authority{}).VerifyKeyAttestation(newYubiKeyAttestation(t, device, deviceKey, csr, 1234), csr.PublicKey)
+	assert.Error(t, err)
+}
@@ -0,0 +1,728 @@
+package authority
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	kmsapi "github.com/smallstep/certificates/kms/apiv1"
+	"github.com/smallstep/certificates/tsa"
+	"github.com/smallstep/nosql"
+	"go.mozilla.org/pkcs7"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/randutil"
+)
+
+var (
+	auditExportsTable  = []byte("audit_exports")
+	auditBundlesTable  = []byte("audit_export_bundles")
+	configChangesTable = []byte("config_changes")
+)
+
+var (
+	// oidAttributeSigningCertificateV2 is the id-aa-signingCertificateV2
+	// attribute defined in RFC 5035, required by CAdES-BES.
+	oidAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	// oidAttributeSignatureTimeStampToken is the id-aa-signatureTimeStampToken
+	// attribute defined in RFC 3161, used by CAdES-T.
+	oidAttributeSignatureTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+)
+
+// Names of the files in an audit export bundle.
+const (
+	auditCertificatesFile  = "certificates.csv"
+	auditRevocationsFile   = "revocations.csv"
+	auditConfigChangesFile = "config-changes.csv"
+	auditManifestFile      = "manifest.json"
+	auditSignatureFile     = "manifest.json.p7s"
+)
+
+// AuditExportStatus is the status of an audit export.
+type AuditExportStatus string
+
+// Audit export statuses.
+const (
+	AuditExportRunning   AuditExportStatus = "running"
+	AuditExportCompleted AuditExportStatus = "completed"
+	AuditExportFailed    AuditExportStatus = "failed"
+)
+
+// AuditExportOptions are the options used to export the audit evidence of a
+// period. The period includes From and excludes To.
+type AuditExportOptions struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Validate validates the audit export options.
+func (o *AuditExportOptions) Validate() error {
+	switch {
+	case o.From.IsZero():
+		return admin.NewError(admin.ErrorBadRequestType, "from cannot be empty")
+	case o.To.IsZero():
+		return admin.NewError(admin.ErrorBadRequestType, "to cannot be empty")
+	case !o.From.Before(o.To):
+		return admin.NewError(admin.ErrorBadRequestType, "from must be before to")
+	default:
+		return nil
+	}
+}
+
+// AuditExport is a background job that creates a signed bundle with the
+// certificates issued, the certificates revoked and the provisioner changes
+// made in a period.
+type AuditExport struct {
+	ID string `json:"id"`
+	AuditExportOptions
+	Status        AuditExportStatus `json:"status"`
+	Certificates  int               `json:"certificates"`
+	Revocations   int               `json:"revocations"`
+	ConfigChanges int               `json:"configChanges"`
+	Error         string            `json:"error,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+// ConfigChange is a change of a provisioner made with the admin API.
+type ConfigChange struct {
+	Time          time.Time `json:"time"`
+	ProvisionerID string    `json:"provisionerID"`
+	Provisioner   string    `json:"provisioner"`
+	Type          string    `json:"type"`
+	Action        string    `json:"action"`
+}
+
+// auditManifest is the manifest of an audit export bundle, it contains the
+// SHA-256 hashes of the other files.
+type auditManifest struct {
+	Version     int                   `json:"version"`
+	ID          string                `json:"id"`
+	AuthorityID string                `json:"authorityId,omitempty"`
+	From        time.Time             `json:"from"`
+	To          time.Time             `json:"to"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+	Files       []*auditManifestEntry `json:"files"`
+}
+
+type auditManifestEntry struct {
+	Name    string `json:"name"`
+	SHA256  string `json:"sha256"`
+	Size    int    `json:"size"`
+	Records int    `json:"records"`
+}
+
+// essCertIDv2 is defined in RFC 5035, the hash algorithm is omitted as it
+// defaults to SHA-256.
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+// signingCertificateV2 is defined in RFC 5035.
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// auditStore keeps the audit exports, their bundles and the config changes in
+// the database.
+type auditStore struct {
+	db nosql.DB
+}
+
+func newAuditStore(db nosql.DB) (*auditStore, error) {
+	for _, table := range [][]byte{auditExportsTable, auditBundlesTable, configChangesTable} {
+		if err := db.CreateTable(table); err != nil {
+			return nil, errors.Wrapf(err, "error creating table %s", string(table))
+		}
+	}
+	return &auditStore{db: db}, nil
+}
+
+func (s *auditStore) get(id string) (*AuditExport, bool, error) {
+	b, err := s.db.Get(auditExportsTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, errors.Wrapf(err, "error loading audit export %s", id)
+	}
+	exp := new(AuditExport)
+	if err := json.Unmarshal(b, exp); err != nil {
+		return nil, false, errors.Wrapf(err, "error unmarshaling audit export %s", id)
+	}
+	return exp, true, nil
+}
+
+func (s *auditStore) list() ([]*AuditExport, error) {
+	entries, err := s.db.List(auditExportsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading audit exports")
+	}
+	exports := []*AuditExport{}
+	for _, e := range entries {
+		exp := new(AuditExport)
+		if err := json.Unmarshal(e.Value, exp); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling audit export %s", string(e.Key))
+		}
+		exports = append(exports, exp)
+	}
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].CreatedAt.Before(exports[j].CreatedAt)
+	})
+	return exports, nil
+}
+
+func (s *auditStore) save(exp *AuditExport) error {
+	b, err := json.Marshal(exp)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling audit export %s", exp.ID)
+	}
+	return errors.Wrapf(s.db.Set(auditExportsTable, []byte(exp.ID), b), "error storing audit export %s", exp.ID)
+}
+
+func (s *auditStore) getBundle(id string) ([]byte, bool, error) {
+	b, err := s.db.Get(auditBundlesTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, errors.Wrapf(err, "error loading audit export bundle %s", id)
+	}
+	return b, true, nil
+}
+
+func (s *auditStore) saveBundle(id string, b []byte) error {
+	return errors.Wrapf(s.db.Set(auditBundlesTable, []byte(id), b), "error storing audit export bundle %s", id)
+}
+
+func (s *auditStore) addChange(c *ConfigChange) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling config change")
+	}
+	// Keys sort by time, the provisioner id makes them unique.
+	key := fmt.Sprintf("%020d-%s", c.Time.UnixNano(), c.ProvisionerID)
+	return errors.Wrap(s.db.Set(configChangesTable, []byte(key), b), "error storing config change")
+}
+
+// listChanges returns the config changes made in the given period, sorted by
+// time.
+func (s *auditStore) listChanges(from, to time.Time) ([]*ConfigChange, error) {
+	entries, err := s.db.List(configChangesTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading config changes")
+	}
+	var changes []*ConfigChange
+	for _, e := range entries {
+		c := new(ConfigChange)
+		if err := json.Unmarshal(e.Value, c); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling config change %s", string(e.Key))
+		}
+		if inPeriod(c.Time, from, to) {
+			changes = append(changes, c)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+	return changes, nil
+}
+
+// auditExporter records the config changes and runs the pending audit exports
+// in the background.
+type auditExporter struct {
+	store       *auditStore
+	authorityID string
+	chain       []*x509.Certificate
+	signer      crypto.Signer
+	tsa         *tsa.Service
+	list        func() ([]*x509.Certificate, error)
+	listRevoked func() ([]*db.RevokedCertificateInfo, error)
+	now         func() time.Time
+	lease       *leaderLease
+	unsubscribe func()
+	refresh     chan struct{}
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// initAuditExport initializes the audit exports if they are configured. The
+// config changes are recorded from the moment the exports are enabled.
+func (a *Authority) initAuditExport() error {
+	c := a.config.AuditExport
+	if c == nil || a.auditExporter != nil {
+		return nil
+	}
+	l, ok := a.db.(certificatesLister)
+	if !ok {
+		return errors.New("auditExport requires a database that can list the issued certificates")
+	}
+	rl, ok := a.db.(revokedCertificatesLister)
+	if !ok {
+		return errors.New("auditExport requires a database that can list the revoked certificates")
+	}
+
+	chain, err := pemutil.ReadCertificateBundle(c.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading audit export certificate")
+	}
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: c.Key,
+		Password:   []byte(a.config.Password),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating audit export signer")
+	}
+	store, err := newAuditStore(a.getStateDB())
+	if err != nil {
+		return err
+	}
+
+	e := &auditExporter{
+		store:       store,
+		authorityID: a.config.AuthorityConfig.AuthorityID,
+		chain:       chain,
+		signer:      signer,
+		tsa:         a.tsaService,
+		list:        l.GetCertificates,
+		listRevoked: rl.GetRevokedCertificates,
+		now:         a.now,
+		refresh:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	// Every replica records the changes made through it.
+	e.unsubscribe = a.events.Subscribe(func(ev events.Event) {
+		if p, ok := ev.(*events.ProvisionerUpdated); ok {
+			c := &ConfigChange{
+				Time:          p.Time.UTC(),
+				ProvisionerID: p.ID,
+				Provisioner:   p.Name,
+				Type:          p.Type,
+				Action:        string(p.Action),
+			}
+			if err := a.writeOrSpool(spoolConfigChange, c, func() error { return e.store.addChange(c) }); err != nil {
+				log.Printf("error recording config change: %v", err)
+			}
+		}
+	}, events.ProvisionerUpdatedType)
+	// The config changes spooled are written by the write-behind.
+	if a.writeBehind != nil {
+		a.writeBehind.handle(spoolConfigChange, func(data json.RawMessage) error {
+			c := new(ConfigChange)
+			if err := json.Unmarshal(data, c); err != nil {
+				return errors.Wrap(err, "error unmarshaling config change")
+			}
+			return e.store.addChange(c)
+		})
+	}
+	// With multiple replicas, only the one holding the lease runs the exports.
+	e.lease = a.leaderElector.newLease("audit-export")
+	go e.run()
+	a.auditExporter = e
+	return nil
+}
+
+func (e *auditExporter) run() {
+	defer close(e.stopped)
+	// Run the exports interrupted by a restart.
+	e.runPending()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-e.refresh:
+		case <-e.lease.Elected():
+		}
+		e.runPending()
+	}
+}
+
+// Stop stops recording the config changes and running the exports, the export
+// running is started again the next time the authority starts.
+func (e *auditExporter) Stop() {
+	e.unsubscribe()
+	close(e.done)
+	<-e.stopped
+	e.lease.Stop()
+}
+
+// signal wakes up the goroutine running the exports.
+func (e *auditExporter) signal() {
+	select {
+	case e.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *auditExporter) runPending() {
+	if !e.lease.IsLeader() {
+		return
+	}
+	exports, err := e.store.list()
+	if err != nil {
+		log.Printf("error loading audit exports: %v", err)
+		return
+	}
+	for _, exp := range exports {
+		select {
+		case <-e.done:
+			return
+		default:
+		}
+		if exp.Status != AuditExportRunning {
+			continue
+		}
+		if err := e.runExport(exp); err != nil {
+			log.Printf("error running audit export %s: %v", exp.ID, err)
+		}
+	}
+}
+
+// runExport creates and stores the bundle of an audit export.
+func (e *auditExporter) runExport(exp *AuditExport) error {
+	b, err := e.createBundle(exp, e.now().UTC())
+	if err == nil {
+		err = e.store.saveBundle(exp.ID, b)
+	}
+	if err != nil {
+		exp.Status = AuditExportFailed
+		exp.Error = err.Error()
+	} else {
+		exp.Status = AuditExportCompleted
+	}
+	exp.UpdatedAt = e.now().UTC()
+	return e.store.save(exp)
+}
+
+// createBundle returns a zip file with the CSV files of the export period, the
+// manifest and its CAdES signature. It also sets the number of records of the
+// export.
+func (e *auditExporter) createBundle(exp *AuditExport, now time.Time) ([]byte, error) {
+	certs, err := e.list()
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := e.listRevoked()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := e.store.listChanges(exp.From, exp.To)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &auditManifest{
+		Version:     1,
+		ID:          exp.ID,
+		AuthorityID: e.authorityID,
+		From:        exp.From,
+		To:          exp.To,
+		GeneratedAt: now,
+	}
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	addFile := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: now,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error adding %s to the audit export", name)
+		}
+		_, err = w.Write(data)
+		return errors.Wrapf(err, "error adding %s to the audit export", name)
+	}
+	addCSV := func(name string, records [][]string) error {
+		b := new(bytes.Buffer)
+		w := csv.NewWriter(b)
+		if err := w.WriteAll(records); err != nil {
+			return errors.Wrapf(err, "error writing %s", name)
+		}
+		sum := sha256.Sum256(b.Bytes())
+		manifest.Files = append(manifest.Files, &auditManifestEntry{
+			Name:    name,
+			SHA256:  hex.EncodeToString(sum[:]),
+			Size:    b.Len(),
+			Records: len(records) - 1,
+		})
+		return addFile(name, b.Bytes())
+	}
+
+	certRecords := auditCertificateRecords(certs, exp.From, exp.To)
+	revocationRecords := auditRevocationRecords(revoked, exp.From, exp.To)
+	changeRecords := auditConfigChangeRecords(changes)
+	if err := addCSV(auditCertificatesFile, certRecords); err != nil {
+		return nil, err
+	}
+	if err := addCSV(auditRevocationsFile, revocationRecords); err != nil {
+		return nil, err
+	}
+	if err := addCSV(auditConfigChangesFile, changeRecords); err != nil {
+		return nil, err
+	}
+
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling audit export manifest")
+	}
+	signature, err := e.sign(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := addFile(auditManifestFile, m); err != nil {
+		return nil, err
+	}
+	if err := addFile(auditSignatureFile, signature); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "error closing audit export")
+	}
+
+	exp.Certificates = len(certRecords) - 1
+	exp.Revocations = len(revocationRecords) - 1
+	exp.ConfigChanges = len(changeRecords) - 1
+	return buf.Bytes(), nil
+}
+
+// sign returns a CAdES-BES detached signature of the given data. If the
+// time-stamp authority is configured, the signature is time-stamped, making
+// it a CAdES-T signature.
+func (e *auditExporter) sign(data []byte) ([]byte, error) {
+	sd, err := pkcs7.NewSignedData(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating audit export signature")
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	certHash := sha256.Sum256(e.chain[0].Raw)
+	if err := sd.AddSignerChain(e.chain[0], e.signer, e.chain[1:], pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{{
+			Type: oidAttributeSigningCertificateV2,
+			Value: signingCertificateV2{
+				Certs: []essCertIDv2{{CertHash: certHash[:]}},
+			},
+		}},
+	}); err != nil {
+		return nil, errors.Wrap(err, "error signing audit export")
+	}
+
+	if e.tsa != nil {
+		si := &sd.GetSignedData().SignerInfos[0]
+		sum := sha256.Sum256(si.EncryptedDigest)
+		token, err := e.tsa.Timestamp(&tsa.Request{
+			Version: 1,
+			MessageImprint: tsa.MessageImprint{
+				HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: pkcs7.OIDDigestAlgorithmSHA256},
+				HashedMessage: sum[:],
+			},
+			CertReq: true,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error time-stamping audit export signature")
+		}
+		if err := si.SetUnauthenticatedAttributes([]pkcs7.Attribute{{
+			Type:  oidAttributeSignatureTimeStampToken,
+			Value: asn1.RawValue{FullBytes: token},
+		}}); err != nil {
+			return nil, errors.Wrap(err, "error adding time-stamp to audit export signature")
+		}
+	}
+
+	sd.Detach()
+	b, err := sd.Finish()
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing audit export")
+	}
+	return b, nil
+}
+
+func inPeriod(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+func formatAuditTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// auditCertificateRecords returns the CSV records of the certificates issued
+// in the given period, using the notBefore of the certificates.
+func auditCertificateRecords(certs []*x509.Certificate, from, to time.Time) [][]string {
+	var issued []*x509.Certificate
+	for _, crt := range certs {
+		if inPeriod(crt.NotBefore, from, to) {
+			issued = append(issued, crt)
+		}
+	}
+	sort.SliceStable(issued, func(i, j int) bool {
+		return issued[i].NotBefore.Before(issued[j].NotBefore)
+	})
+
+	records := [][]string{{
+		"serialNumber", "subject", "dnsNames", "ipAddresses", "emailAddresses", "uris",
+		"provisioner", "notBefore", "notAfter", "sha256Fingerprint",
+	}}
+	for _, crt := range issued {
+		ips := make([]string, len(crt.IPAddresses))
+		for i, ip := range crt.IPAddresses {
+			ips[i] = ip.String()
+		}
+		uris := make([]string, len(crt.URIs))
+		for i, u := range crt.URIs {
+			uris[i] = u.String()
+		}
+		name, _ := provisioner.GetProvisionerName(crt.Extensions)
+		sum := sha256.Sum256(crt.Raw)
+		records = append(records, []string{
+			crt.SerialNumber.String(),
+			crt.Subject.String(),
+			strings.Join(crt.DNSNames, " "),
+			strings.Join(ips, " "),
+			strings.Join(crt.EmailAddresses, " "),
+			strings.Join(uris, " "),
+			name,
+			formatAuditTime(crt.NotBefore),
+			formatAuditTime(crt.NotAfter),
+			hex.EncodeToString(sum[:]),
+		})
+	}
+	return records
+}
+
+// auditRevocationRecords returns the CSV records of the certificates revoked
+// in the given period.
+func auditRevocationRecords(revoked []*db.RevokedCertificateInfo, from, to time.Time) [][]string {
+	var rcis []*db.RevokedCertificateInfo
+	for _, rci := range revoked {
+		if inPeriod(rci.RevokedAt, from, to) {
+			rcis = append(rcis, rci)
+		}
+	}
+	sort.SliceStable(rcis, func(i, j int) bool {
+		return rcis[i].RevokedAt.Before(rcis[j].RevokedAt)
+	})
+
+	records := [][]string{{
+		"serialNumber", "revokedAt", "reasonCode", "reason", "provisionerID", "mtls",
+	}}
+	for _, rci := range rcis {
+		records = append(records, []string{
+			rci.Serial,
+			formatAuditTime(rci.RevokedAt),
+			strconv.Itoa(rci.ReasonCode),
+			rci.Reason,
+			rci.ProvisionerID,
+			strconv.FormatBool(rci.MTLS),
+		})
+	}
+	return records
+}
+
+// auditConfigChangeRecords returns the CSV records of the given config
+// changes.
+func auditConfigChangeRecords(changes []*ConfigChange) [][]string {
+	records := [][]string{{
+		"time", "provisionerID", "provisioner", "type", "action",
+	}}
+	for _, c := range changes {
+		records = append(records, []string{
+			formatAuditTime(c.Time), c.ProvisionerID, c.Provisioner, c.Type, c.Action,
+		})
+	}
+	return records
+}
+
+// CreateAuditExport starts a background job that exports the audit evidence
+// of the given period.
+func (a *Authority) CreateAuditExport(opts *AuditExportOptions) (*AuditExport, error) {
+	if a.auditExporter == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "audit exports are not configured")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	id, err := randutil.Hex(16)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating audit export id")
+	}
+	now := a.now().UTC()
+	exp := &AuditExport{
+		ID: id,
+		AuditExportOptions: AuditExportOptions{
+			From: opts.From.UTC(),
+			To:   opts.To.UTC(),
+		},
+		Status:    AuditExportRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := a.auditExporter.store.save(exp); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing audit export")
+	}
+	a.auditExporter.signal()
+	return exp, nil
+}
+
+// GetAuditExport returns the audit export with the given id.
+func (a *Authority) GetAuditExport(id string) (*AuditExport, error) {
+	if a.auditExporter == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "audit exports are not configured")
+	}
+	exp, ok, err := a.auditExporter.store.get(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading audit export")
+	}
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "audit export %s not found", id)
+	}
+	return exp, nil
+}
+
+// GetAuditExports returns all the audit exports.
+func (a *Authority) GetAuditExports() ([]*AuditExport, error) {
+	if a.auditExporter == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "audit exports are not configured")
+	}
+	exports, err := a.auditExporter.store.list()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading audit exports")
+	}
+	return exports, nil
+}
+
+// GetAuditExportBundle returns the zip file of a completed audit export.
+func (a *Authority) GetAuditExportBundle(id string) ([]byte, error) {
+	exp, err := a.GetAuditExport(id)
+	if err != nil {
+		return nil, err
+	}
+	if exp.Status != AuditExportCompleted {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "audit export %s is %s", id, exp.Status)
+	}
+	b, ok, err := a.auditExporter.store.getBundle(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading audit export bundle")
+	}
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "audit export bundle %s not found", id)
+	}
+	return b, nil
+}
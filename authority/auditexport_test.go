@@ -0,0 +1,145 @@
+package authority
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/db"
+	"go.mozilla.org/pkcs7"
+)
+
+func TestAuditExportOptions_Validate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		opts    *AuditExportOptions
+		wantErr bool
+	}{
+		{"ok", &AuditExportOptions{From: now.Add(-time.Hour), To: now}, false},
+		{"fail from", &AuditExportOptions{To: now}, true},
+		{"fail to", &AuditExportOptions{From: now}, true},
+		{"fail period", &AuditExportOptions{From: now, To: now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("AuditExportOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuditExporter_runExport(t *testing.T) {
+	root, signer := generateRootCertificate(t)
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	newCert := func(serial int64, notBefore time.Time) *x509.Certificate {
+		return generateCertificate(t, "test", []string{"test.smallstep.com"},
+			withValidity(serial, notBefore.Add(48*time.Hour)),
+			withProvisionerOID("foo", "kid"),
+			withSigner(root, signer))
+	}
+	certs := []*x509.Certificate{
+		newCert(1, from.Add(-time.Hour)),
+		newCert(2, from.Add(time.Hour)),
+		newCert(3, to.Add(-time.Hour)),
+		newCert(4, to),
+	}
+	revoked := []*db.RevokedCertificateInfo{
+		{Serial: "1", RevokedAt: from.Add(time.Minute), ReasonCode: 1, Reason: "key compromise", ProvisionerID: "foo-id"},
+		{Serial: "2", RevokedAt: to.Add(time.Minute)},
+	}
+
+	store, err := newAuditStore(db.NewMemoryDB())
+	assert.FatalError(t, err)
+	assert.FatalError(t, store.addChange(&ConfigChange{Time: from.Add(-time.Minute), ProvisionerID: "bar-id", Provisioner: "bar", Type: "JWK", Action: "created"}))
+	assert.FatalError(t, store.addChange(&ConfigChange{Time: from.Add(time.Minute), ProvisionerID: "foo-id", Provisioner: "foo", Type: "JWK", Action: "updated"}))
+
+	e := &auditExporter{
+		store:       store,
+		authorityID: "authority-id",
+		chain:       []*x509.Certificate{root},
+		signer:      signer,
+		list: func() ([]*x509.Certificate, error) {
+			return certs, nil
+		},
+		listRevoked: func() ([]*db.RevokedCertificateInfo, error) {
+			return revoked, nil
+		},
+		now:  time.Now,
+		done: make(chan struct{}),
+	}
+
+	exp := &AuditExport{ID: "1", AuditExportOptions: AuditExportOptions{From: from, To: to}, Status: AuditExportRunning}
+	assert.FatalError(t, e.store.save(exp))
+	e.runPending()
+	got, ok, err := e.store.get("1")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	assert.Equals(t, AuditExportCompleted, got.Status)
+	assert.Equals(t, 2, got.Certificates)
+	assert.Equals(t, 1, got.Revocations)
+	assert.Equals(t, 1, got.ConfigChanges)
+
+	b, ok, err := e.store.getBundle("1")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	assert.FatalError(t, err)
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.FatalError(t, err)
+		files[f.Name], err = ioutil.ReadAll(rc)
+		assert.FatalError(t, err)
+		rc.Close()
+	}
+	assert.Len(t, 5, files)
+
+	// CSV files
+	records, err := csv.NewReader(bytes.NewReader(files[auditCertificatesFile])).ReadAll()
+	assert.FatalError(t, err)
+	assert.Len(t, 3, records)
+	assert.Equals(t, []string{"2", "3"}, []string{records[1][0], records[2][0]})
+	assert.Equals(t, "test.smallstep.com", records[1][2])
+	assert.Equals(t, "foo", records[1][6])
+	records, err = csv.NewReader(bytes.NewReader(files[auditRevocationsFile])).ReadAll()
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]string{
+		{"serialNumber", "revokedAt", "reasonCode", "reason", "provisionerID", "mtls"},
+		{"1", "2021-01-01T00:01:00Z", "1", "key compromise", "foo-id", "false"},
+	}, records)
+	records, err = csv.NewReader(bytes.NewReader(files[auditConfigChangesFile])).ReadAll()
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]string{
+		{"time", "provisionerID", "provisioner", "type", "action"},
+		{"2021-01-01T00:01:00Z", "foo-id", "foo", "JWK", "updated"},
+	}, records)
+
+	// Manifest
+	var manifest auditManifest
+	assert.FatalError(t, json.Unmarshal(files[auditManifestFile], &manifest))
+	assert.Equals(t, "authority-id", manifest.AuthorityID)
+	assert.Len(t, 3, manifest.Files)
+	for _, f := range manifest.Files {
+		sum := sha256.Sum256(files[f.Name])
+		assert.Equals(t, hex.EncodeToString(sum[:]), f.SHA256)
+	}
+
+	// Detached signature
+	p7, err := pkcs7.Parse(files[auditSignatureFile])
+	assert.FatalError(t, err)
+	assert.Len(t, 0, p7.Content)
+	p7.Content = files[auditManifestFile]
+	assert.FatalError(t, p7.Verify())
+	assert.Equals(t, root.Raw, p7.GetOnlySigner().Raw)
+}
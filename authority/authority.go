@@ -16,6 +16,8 @@ import (
 	adminDBNosql "github.com/smallstep/certificates/authority/admin/db/nosql"
 	"github.com/smallstep/certificates/authority/administrator"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/authority/hooks"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
@@ -23,8 +25,11 @@ import (
 	"github.com/smallstep/certificates/kms"
 	kmsapi "github.com/smallstep/certificates/kms/apiv1"
 	"github.com/smallstep/certificates/kms/sshagentkms"
+	"github.com/smallstep/certificates/logging"
+	"github.com/smallstep/certificates/resolver"
 	"github.com/smallstep/certificates/scep"
 	"github.com/smallstep/certificates/templates"
+	"github.com/smallstep/certificates/tsa"
 	"github.com/smallstep/nosql"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/linkedca"
@@ -41,17 +46,22 @@ type Authority struct {
 	adminDB       admin.DB
 	templates     *templates.Templates
 	linkedCAToken string
+	clock         provisioner.Clock
 
 	// X509 CA
-	x509CAService      cas.CertificateAuthorityService
-	rootX509Certs      []*x509.Certificate
-	rootX509CertPool   *x509.CertPool
-	federatedX509Certs []*x509.Certificate
-	certificates       *sync.Map
+	x509CAService         cas.CertificateAuthorityService
+	rootX509Certs         []*x509.Certificate
+	rootX509CertPool      *x509.CertPool
+	federatedX509Certs    []*x509.Certificate
+	intermediateX509Certs []*x509.Certificate
+	certificates          *sync.Map
 
 	// SCEP CA
 	scepService *scep.Service
 
+	// Time-stamp authority
+	tsaService *tsa.Service
+
 	// SSH CA
 	sshCAUserCertSignKey    ssh.Signer
 	sshCAHostCertSignKey    ssh.Signer
@@ -69,8 +79,101 @@ type Authority struct {
 	sshCheckHostFunc func(ctx context.Context, principal string, tok string, roots []*x509.Certificate) (bool, error)
 	sshGetHostsFunc  func(ctx context.Context, cert *x509.Certificate) ([]config.Host, error)
 	getIdentityFunc  provisioner.GetIdentityFunc
+	identityResolver provisioner.IdentityResolver
 
 	adminMutex sync.RWMutex
+
+	// Device attestation policy
+	attestationPolicy *AttestationPolicy
+	attestationMutex  sync.RWMutex
+
+	// Issuance quotas
+	quotas     *quotaStore
+	quotaMutex sync.Mutex
+
+	// Last certificates issued, used to detect duplicates
+	duplicates *duplicateStore
+
+	// Labels of the issued certificates
+	labels *labelsStore
+
+	// Compromised keys
+	keyBlocklist *keyBlocklist
+
+	// Code signing requests waiting for approval
+	codeSigningRequests *codeSigningStore
+	codeSigningMutex    sync.Mutex
+
+	// Sign requests held for approval
+	signApprovals     *signApprovalStore
+	signApprovalMutex sync.Mutex
+
+	// Operations that require the confirmation of two administrators
+	dualControl      *dualControlStore
+	dualControlMutex sync.Mutex
+
+	// Security keys and step-up sessions of the administrators
+	webAuthn      *webAuthnStore
+	webAuthnMutex sync.Mutex
+
+	// Lifecycle events
+	events *events.Bus
+
+	// Last use and issuance counts of the provisioners
+	provisionerUsage *usageTracker
+
+	// Federated authorities added with the admin API
+	federatedAuthorities map[string]*FederatedAuthority
+	federationMutex      sync.RWMutex
+
+	// Signed manifest with the current and next roots
+	rootsManifest string
+
+	// CA certificates and CRL exported for RADIUS servers
+	radiusExporter *radiusExporter
+
+	// CRL, CA certificates and OCSP responses uploaded to object storage
+	revocationPublisher *revocationPublisher
+
+	// CRL of the intermediate served in /crl
+	crlGenerator *crlGenerator
+
+	// Background jobs revoking the certificates of a provisioner
+	revocationJobs *revocationJobRunner
+
+	// Signed exports of the audit evidence
+	auditExporter *auditExporter
+
+	// Custom issuance policies
+	policyHooks []hooks.Hook
+
+	// Database and key manager calls running at the same time
+	pendingCalls chan struct{}
+
+	// Sign operations running at the same time
+	signQueue *signQueue
+
+	// Availability of the database and renewals waiting to be stored
+	degraded *degradedMode
+
+	// Database used for the state of the authority if it does not have one
+	memoryDB     nosql.DB
+	memoryDBOnce sync.Once
+
+	// Durable spool of the records written to the database in the background
+	writeBehind *writeBehind
+
+	// Keys loaded in the background after the authority starts
+	lazySigners []*asyncSigner
+
+	// Election of the replica that runs each background job
+	leaderElector *leaderElector
+
+	// DNS resolver used in the ACME validations and the policy hooks
+	resolver *resolver.Resolver
+
+	// Logger of the background jobs, nil uses the standard logger
+	logger *logging.Logger
 }
 
 // New creates and initiates a new Authority type.
@@ -83,6 +186,7 @@ func New(config *config.Config, opts ...Option) (*Authority, error) {
 	var a = &Authority{
 		config:       config,
 		certificates: new(sync.Map),
+		events:       events.NewBus(),
 	}
 
 	// Apply options.
@@ -106,6 +210,7 @@ func NewEmbedded(opts ...Option) (*Authority, error) {
 	a := &Authority{
 		config:       &config.Config{},
 		certificates: new(sync.Map),
+		events:       events.NewBus(),
 	}
 
 	// Apply options.
@@ -170,13 +275,16 @@ func (a *Authority) reloadAdminResources(ctx context.Context) error {
 	// Create provisioner collection.
 	provClxn := provisioner.NewCollection(provisionerConfig.Audiences)
 	for _, p := range provList {
-		if err := p.Init(*provisionerConfig); err != nil {
+		if err := resolveProvisionerSecrets(ctx, p); err != nil {
 			return err
 		}
-		if err := provClxn.Store(p); err != nil {
+		if err := p.Init(*provisionerConfig); err != nil {
 			return err
 		}
 	}
+	if err := provClxn.Store(provList...); err != nil {
+		return err
+	}
 	// Create admin collection.
 	adminClxn := administrator.NewCollection(provClxn)
 	for _, adm := range adminList {
@@ -205,29 +313,116 @@ func (a *Authority) init() error {
 	}
 
 	var err error
+	times := newStartupTimes()
 
 	// Automatically enable admin for all linked cas.
 	if a.linkedCAToken != "" {
 		a.config.AuthorityConfig.EnableAdmin = true
 	}
 
-	// Initialize step-ca Database if it's not already initialized with WithDB.
-	// If a.config.DB is nil then a simple, barebones in memory DB will be used.
+	// Initialize step-ca Database if it's not already initialized with WithDB,
+	// and the key manager if it has not been set in the options. Both are
+	// initialized at the same time. If a.config.DB is nil then a simple,
+	// barebones in memory DB will be used.
+	inits := make(map[string]func() error)
 	if a.db == nil {
-		if a.db, err = db.New(a.config.DB); err != nil {
-			return err
+		inits["db"] = func() (err error) {
+			a.db, err = db.New(a.config.DB)
+			return
 		}
 	}
-
-	// Initialize key manager if it has not been set in the options.
 	if a.keyManager == nil {
-		var options kmsapi.Options
-		if a.config.KMS != nil {
-			options = *a.config.KMS
+		inits["kms"] = func() (err error) {
+			var options kmsapi.Options
+			if a.config.KMS != nil {
+				options = *a.config.KMS
+			}
+			a.keyManager, err = kms.New(context.Background(), options)
+			return
 		}
-		a.keyManager, err = kms.New(context.Background(), options)
-		if err != nil {
-			return err
+	}
+	if err := times.parallel(inits); err != nil {
+		return err
+	}
+
+	// Load the policy used to validate device attestations.
+	if err := a.initAttestationPolicy(); err != nil {
+		return err
+	}
+
+	// Initialize the store used to enforce the issuance quotas.
+	if err := a.initQuotas(); err != nil {
+		return err
+	}
+
+	// Create the enrollment code of the first WebAuthn security key.
+	if err := a.initWebAuthn(); err != nil {
+		return err
+	}
+
+	// Initialize the store used to detect duplicate certificates.
+	if err := a.initDuplicates(); err != nil {
+		return err
+	}
+
+	// Initialize the store used to keep the certificate labels.
+	if err := a.initLabels(); err != nil {
+		return err
+	}
+
+	// Load the list of compromised keys.
+	if err := a.initBlockedKeys(); err != nil {
+		return err
+	}
+
+	// Initialize the DNS resolver, it is used by the policy hooks.
+	a.resolver = resolver.New(nil, a.config.DNSCache.GetOptions())
+
+	// Initialize the policy hooks.
+	if err := a.initPolicyHooks(); err != nil {
+		return err
+	}
+
+	// Limit the pending database and key manager calls.
+	a.initTimeouts()
+
+	// Limit the sign operations running at the same time.
+	a.signQueue = newSignQueue(a.config.SignQueue)
+
+	// Keep renewing certificates while the database is unavailable if
+	// configured.
+	a.initDegradedMode()
+
+	// Open the write-behind spool if configured.
+	if err := a.initWriteBehind(); err != nil {
+		return err
+	}
+
+	// Log the errors of the background jobs with the CA logger if configured.
+	if err := a.initLogger(); err != nil {
+		return err
+	}
+
+	// Elect the replica that runs each background job if configured.
+	if err := a.initLeaderElection(); err != nil {
+		return err
+	}
+
+	// Start loading the SSH keys, they are loaded at the same time as the
+	// X.509 intermediate key.
+	var sshHostSigner, sshUserSigner *asyncSigner
+	if a.config.SSH != nil {
+		if a.config.SSH.HostKey != "" {
+			sshHostSigner = newAsyncSigner(a.keyManager, "ssh host key", &kmsapi.CreateSignerRequest{
+				SigningKey: a.config.SSH.HostKey,
+				Password:   []byte(a.config.Password),
+			}, times)
+		}
+		if a.config.SSH.UserKey != "" {
+			sshUserSigner = newAsyncSigner(a.keyManager, "ssh user key", &kmsapi.CreateSignerRequest{
+				SigningKey: a.config.SSH.UserKey,
+				Password:   []byte(a.config.Password),
+			}, times)
 		}
 	}
 
@@ -244,15 +439,23 @@ func (a *Authority) init() error {
 			if err != nil {
 				return err
 			}
-			options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			a.intermediateX509Certs = options.CertificateChain
+			signer := newAsyncSigner(a.keyManager, "x509 intermediate key", &kmsapi.CreateSignerRequest{
 				SigningKey: a.config.IntermediateKey,
 				Password:   []byte(a.config.Password),
-			})
-			if err != nil {
+			}, times)
+			// With lazy keys, the authority starts without waiting for the
+			// key, and it is not ready until the key is loaded.
+			if a.config.Startup.IsLazyKeys() {
+				a.lazySigners = append(a.lazySigners, signer)
+				options.Signer = signer
+				signer.logWhenReady()
+			} else if options.Signer, err = signer.get(); err != nil {
 				return err
 			}
 		}
 
+		start := time.Now()
 		a.x509CAService, err = cas.New(context.Background(), options)
 		if err != nil {
 			return err
@@ -270,6 +473,10 @@ func (a *Authority) init() error {
 			sum := sha256.Sum256(resp.RootCertificate.Raw)
 			log.Printf("Using root fingerprint '%s'", hex.EncodeToString(sum[:]))
 		}
+		times.add("cas", time.Since(start))
+
+		// Fail fast if the upstream CA or the key manager is unavailable.
+		a.x509CAService = newBreakerCAS(a.x509CAService, options.Type, a.config.CircuitBreaker.GetSettings())
 	}
 
 	// Read root certificates and store them in the certificates map.
@@ -293,6 +500,14 @@ func (a *Authority) init() error {
 		a.rootX509CertPool.AddCert(cert)
 	}
 
+	// Fail fast if the intermediate cannot issue certificates trusted by the
+	// roots. Only the intermediates read from the configuration are checked.
+	if a.config.Startup.IsVerifyIntermediate() && len(a.intermediateX509Certs) > 0 {
+		if err := times.run("intermediate", a.verifyIntermediate); err != nil {
+			return err
+		}
+	}
+
 	// Read federated certificates and store them in the certificates map.
 	if len(a.federatedX509Certs) == 0 {
 		a.federatedX509Certs = make([]*x509.Certificate, len(a.config.FederatedRoots))
@@ -309,14 +524,16 @@ func (a *Authority) init() error {
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
 	}
 
+	// Load the federated authorities added with the admin API.
+	if err := a.initFederation(); err != nil {
+		return err
+	}
+
 	// Decrypt and load SSH keys
 	var tmplVars templates.Step
 	if a.config.SSH != nil {
-		if a.config.SSH.HostKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.HostKey,
-				Password:   []byte(a.config.Password),
-			})
+		if sshHostSigner != nil {
+			signer, err := sshHostSigner.get()
 			if err != nil {
 				return err
 			}
@@ -338,11 +555,8 @@ func (a *Authority) init() error {
 			a.sshCAHostCerts = append(a.sshCAHostCerts, a.sshCAHostCertSignKey.PublicKey())
 			a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, a.sshCAHostCertSignKey.PublicKey())
 		}
-		if a.config.SSH.UserKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.UserKey,
-				Password:   []byte(a.config.Password),
-			})
+		if sshUserSigner != nil {
+			signer, err := sshUserSigner.get()
 			if err != nil {
 				return err
 			}
@@ -418,24 +632,42 @@ func (a *Authority) init() error {
 		if err != nil {
 			return err
 		}
-		options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-			SigningKey: a.config.IntermediateKey,
-			Password:   []byte(a.config.Password),
-		})
-		if err != nil {
-			return err
-		}
 
-		if km, ok := a.keyManager.(kmsapi.Decrypter); ok {
-			options.Decrypter, err = km.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
-				DecryptionKey: a.config.IntermediateKey,
-				Password:      []byte(a.config.Password),
+		// Use a registration authority certificate if configured, otherwise
+		// use the intermediate key to sign and decrypt SCEP messages.
+		if ra := a.config.AuthorityConfig.SCEP.GetRA(); ra != nil {
+			if options.RA, err = a.scepRAOptions(ra); err != nil {
+				return err
+			}
+		} else {
+			options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+				SigningKey: a.config.IntermediateKey,
+				Password:   []byte(a.config.Password),
 			})
 			if err != nil {
 				return err
 			}
+
+			if km, ok := a.keyManager.(kmsapi.Decrypter); ok {
+				options.Decrypter, err = km.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
+					DecryptionKey: a.config.IntermediateKey,
+					Password:      []byte(a.config.Password),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Keep the enrollments waiting for approval in the database if
+		// possible.
+		if nosqlDB, ok := a.getNoSQLDB(); ok {
+			if options.PendingStore, err = scep.NewPendingStore(nosqlDB); err != nil {
+				return err
+			}
 		}
 
+		options.Clock = a.clock
 		a.scepService, err = scep.NewService(context.Background(), options)
 		if err != nil {
 			return err
@@ -444,13 +676,48 @@ func (a *Authority) init() error {
 		// TODO: mimick the x509CAService GetCertificateAuthority here too?
 	}
 
+	// Initialize the time-stamp authority if configured.
+	if err := a.initTSA(); err != nil {
+		return err
+	}
+
+	// Export the CA certificates and the CRL for RADIUS servers if configured.
+	if err := a.initRADIUSExport(); err != nil {
+		return err
+	}
+
+	// Upload the revocation data to object storage if configured.
+	if err := a.initRevocationPublisher(); err != nil {
+		return err
+	}
+
+	// Sign the CRL served by the CA if configured.
+	if err := a.initCRL(); err != nil {
+		return err
+	}
+
+	// Resume the jobs revoking the certificates of a provisioner.
+	if err := a.initRevocationJobs(); err != nil {
+		return err
+	}
+
+	// Record the config changes and run the audit exports if configured.
+	if err := a.initAuditExport(); err != nil {
+		return err
+	}
+
+	// Sign the manifest with the current and next roots if configured.
+	if err := a.initRootRollover(); err != nil {
+		return err
+	}
+
 	if a.config.AuthorityConfig.EnableAdmin {
 		// Initialize step-ca Admin Database if it's not already initialized using
 		// WithAdminDB.
 		if a.adminDB == nil {
 			if a.linkedCAToken == "" {
 				// Check if AuthConfig already exists
-				a.adminDB, err = adminDBNosql.New(a.db.(nosql.DB), admin.DefaultAuthorityID)
+				a.adminDB, err = adminDBNosql.New(a.db.(nosql.DB), admin.DefaultAuthorityID, adminDBNosql.WithClock(a.clock))
 				if err != nil {
 					return err
 				}
@@ -492,7 +759,14 @@ func (a *Authority) init() error {
 	}
 
 	// Load Provisioners and Admins
-	if err := a.reloadAdminResources(context.Background()); err != nil {
+	if err := times.run("provisioners", func() error {
+		return a.reloadAdminResources(context.Background())
+	}); err != nil {
+		return err
+	}
+
+	// Track the use of the provisioners if configured.
+	if err := a.initProvisionerUsage(); err != nil {
 		return err
 	}
 
@@ -508,8 +782,15 @@ func (a *Authority) init() error {
 		a.templates.Data["Step"] = tmplVars
 	}
 
+	// Write the spooled records, including the ones left by a previous run.
+	if a.writeBehind != nil {
+		a.writeBehind.start()
+	}
+
+	log.Printf("Authority initialized in %s", times)
+
 	// JWT numeric dates are seconds.
-	a.startTime = time.Now().Truncate(time.Second)
+	a.startTime = a.now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
 	// not be repeated.
 	a.initOnce = true
@@ -517,12 +798,58 @@ func (a *Authority) init() error {
 	return nil
 }
 
+// GetClock returns the source of the current time of the authority, the
+// system clock if none was set with WithClock. The ACME and SDS handlers use
+// the same clock.
+func (a *Authority) GetClock() provisioner.Clock {
+	if a.clock == nil {
+		return provisioner.SystemClock{}
+	}
+	return a.clock
+}
+
+// now returns the current time of the clock of the authority.
+func (a *Authority) now() time.Time {
+	return a.GetClock().Now()
+}
+
 // GetDatabase returns the authority database. If the configuration does not
 // define a database, GetDatabase will return a db.SimpleDB instance.
 func (a *Authority) GetDatabase() db.AuthDB {
 	return a.db
 }
 
+// getNoSQLDB returns the authority database as a nosql.DB. It returns false if
+// the configuration does not define a database, the db.SimpleDB used in that
+// case implements the interface, but all its methods fail.
+func (a *Authority) getNoSQLDB() (nosql.DB, bool) {
+	if _, ok := a.db.(*db.SimpleDB); ok {
+		return nil, false
+	}
+	d, ok := a.db.(nosql.DB)
+	return d, ok
+}
+
+// getStateDB returns the database where the authority keeps the state of its
+// features, like the sign approvals or the quotas. If the configuration does
+// not define a database, the state is kept in an in-memory database, and it is
+// lost when the authority stops.
+func (a *Authority) getStateDB() nosql.DB {
+	if d, ok := a.getNoSQLDB(); ok {
+		return d
+	}
+	a.memoryDBOnce.Do(func() {
+		a.memoryDB = db.NewMemoryDB()
+	})
+	return a.memoryDB
+}
+
+// Events returns the bus where the authority publishes the lifecycle events of
+// certificates and provisioners.
+func (a *Authority) Events() *events.Bus {
+	return a.events
+}
+
 // GetAdminDatabase returns the admin database, if one exists.
 func (a *Authority) GetAdminDatabase() admin.DB {
 	return a.adminDB
@@ -539,6 +866,38 @@ func (a *Authority) Shutdown() error {
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	if a.provisioners != nil {
+		if err := a.provisioners.Close(); err != nil {
+			log.Printf("error closing the provisioners: %v", err)
+		}
+	}
+	if a.radiusExporter != nil {
+		a.radiusExporter.Stop()
+	}
+	if a.revocationPublisher != nil {
+		a.revocationPublisher.Stop()
+	}
+	if a.crlGenerator != nil {
+		a.crlGenerator.Stop()
+	}
+	if a.revocationJobs != nil {
+		a.revocationJobs.Stop()
+	}
+	if a.auditExporter != nil {
+		a.auditExporter.Stop()
+	}
+	if a.degraded != nil {
+		a.degraded.Stop()
+	}
+	if a.duplicates != nil {
+		a.duplicates.Stop()
+	}
+	if a.writeBehind != nil {
+		a.writeBehind.Stop()
+	}
+	if a.provisionerUsage != nil {
+		a.provisionerUsage.Stop()
+	}
 	return a.db.Shutdown()
 }
 
@@ -547,6 +906,38 @@ func (a *Authority) CloseForReload() {
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	if a.provisioners != nil {
+		if err := a.provisioners.Close(); err != nil {
+			log.Printf("error closing the provisioners: %v", err)
+		}
+	}
+	if a.radiusExporter != nil {
+		a.radiusExporter.Stop()
+	}
+	if a.revocationPublisher != nil {
+		a.revocationPublisher.Stop()
+	}
+	if a.crlGenerator != nil {
+		a.crlGenerator.Stop()
+	}
+	if a.revocationJobs != nil {
+		a.revocationJobs.Stop()
+	}
+	if a.auditExporter != nil {
+		a.auditExporter.Stop()
+	}
+	if a.degraded != nil {
+		a.degraded.Stop()
+	}
+	if a.duplicates != nil {
+		a.duplicates.Stop()
+	}
+	if a.writeBehind != nil {
+		a.writeBehind.Stop()
+	}
+	if a.provisionerUsage != nil {
+		a.provisionerUsage.Stop()
+	}
 	if client, ok := a.adminDB.(*linkedCaClient); ok {
 		client.Stop()
 	}
@@ -555,9 +946,9 @@ func (a *Authority) CloseForReload() {
 // requiresDecrypter returns whether the Authority
 // requires a KMS that provides a crypto.Decrypter
 // Currently this is only required when SCEP is
-// enabled.
+// enabled without a registration authority.
 func (a *Authority) requiresDecrypter() bool {
-	return a.requiresSCEPService()
+	return a.requiresSCEPService() && a.config.AuthorityConfig.SCEP.GetRA() == nil
 }
 
 // requiresSCEPService iterates over the configured provisioners
@@ -571,6 +962,72 @@ func (a *Authority) requiresSCEPService() bool {
 	return false
 }
 
+// scepRAOptions returns the options of the SCEP registration authority. The
+// configured certificate and key are used if present, otherwise the RA keys
+// are generated and persisted in the database, so they survive restarts and
+// are shared by all the instances of the CA.
+func (a *Authority) scepRAOptions(ra *config.SCEPRAConfig) (*scep.RAOptions, error) {
+	opts := &scep.RAOptions{
+		CommonName: ra.GetCommonName(),
+		Duration:   ra.GetDuration(),
+		Issue:      a.issueSCEPRACertificate,
+	}
+
+	if ra.Certificate == "" {
+		if nosqlDB, ok := a.getNoSQLDB(); ok {
+			store, err := scep.NewRAStore(nosqlDB, []byte(a.config.Password))
+			if err != nil {
+				return nil, err
+			}
+			opts.Store = store
+		}
+		return opts, nil
+	}
+
+	var err error
+	if opts.Certificate, err = pemutil.ReadCertificate(ra.Certificate); err != nil {
+		return nil, errors.Wrap(err, "error reading SCEP RA certificate")
+	}
+	opts.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: ra.Key,
+		Password:   []byte(a.config.Password),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating SCEP RA signer")
+	}
+	km, ok := a.keyManager.(kmsapi.Decrypter)
+	if !ok {
+		return nil, errors.New("keymanager doesn't provide crypto.Decrypter")
+	}
+	opts.Decrypter, err = km.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
+		DecryptionKey: ra.Key,
+		Password:      []byte(a.config.Password),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating SCEP RA decrypter")
+	}
+	return opts, nil
+}
+
+// issueSCEPRACertificate issues a SCEP registration authority certificate with
+// the given template and lifetime.
+func (a *Authority) issueSCEPRACertificate(template *x509.Certificate, lifetime time.Duration) ([]*x509.Certificate, error) {
+	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: template,
+		Lifetime: lifetime,
+		Backdate: a.config.AuthorityConfig.Backdate.Duration,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating SCEP RA certificate")
+	}
+
+	fullchain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
+	if err := a.storeCertificate(fullchain); err != nil && err != db.ErrNotImplemented {
+		return nil, errors.Wrap(err, "error storing SCEP RA certificate")
+	}
+	return fullchain, nil
+}
+
 // GetSCEPService returns the configured SCEP Service
 // TODO: this function is intended to exist temporarily
 // in order to make SCEP work more easily. It can be
@@ -579,3 +1036,9 @@ func (a *Authority) requiresSCEPService() bool {
 func (a *Authority) GetSCEPService() *scep.Service {
 	return a.scepService
 }
+
+// GetResolver returns the DNS resolver used in the ACME validations and the
+// policy hooks.
+func (a *Authority) GetResolver() *resolver.Resolver {
+	return a.resolver
+}
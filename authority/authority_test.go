@@ -3,6 +3,7 @@ package authority
 import (
 	"crypto"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
@@ -311,6 +312,17 @@ func TestNewEmbedded_GetTLSCertificate(t *testing.T) {
 	assert.Equals(t, []string{"localhost"}, cert.Leaf.DNSNames)
 	assert.True(t, cert.Leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
 	assert.True(t, cert.Leaf.IPAddresses[1].Equal(net.ParseIP("::1")))
+
+	// GetServerCertificate
+	cert, err = a.GetServerCertificate([]string{"ca.example.com", "10.0.0.1"}, "RSA")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"ca.example.com"}, cert.Leaf.DNSNames)
+	assert.True(t, cert.Leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")))
+	_, ok := cert.Leaf.PublicKey.(*rsa.PublicKey)
+	assert.True(t, ok)
+
+	_, err = a.GetServerCertificate([]string{"ca.example.com"}, "OKP")
+	assert.NotNil(t, err)
 }
 
 func TestAuthority_CloseForReload(t *testing.T) {
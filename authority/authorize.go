@@ -21,9 +21,13 @@ import (
 // Claims extends jose.Claims with step attributes.
 type Claims struct {
 	jose.Claims
-	SANs  []string `json:"sans,omitempty"`
-	Email string   `json:"email,omitempty"`
-	Nonce string   `json:"nonce,omitempty"`
+	SANs            []string `json:"sans,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	Nonce           string   `json:"nonce,omitempty"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	TenantID        string   `json:"tid,omitempty"`
+
+	Confirmation *provisioner.Confirmation `json:"cnf,omitempty"`
 }
 
 type skipTokenReuseKey struct{}
@@ -68,12 +72,23 @@ func (a *Authority) authorizeToken(ctx context.Context, token string) (provision
 	}
 
 	// This method will also validate the audiences for JWK provisioners.
-	p, ok := a.provisioners.LoadByToken(tok, &claims.Claims)
+	p, ok := a.provisioners.LoadByTokenClaims(tok, &provisioner.TokenClaims{
+		Claims:          claims.Claims,
+		Email:           claims.Email,
+		AuthorizedParty: claims.AuthorizedParty,
+		TenantID:        claims.TenantID,
+	})
 	if !ok {
 		return nil, errs.Unauthorized("authority.authorizeToken: provisioner "+
 			"not found or invalid audience (%s)", strings.Join(claims.Audience, ", "))
 	}
 
+	// Reject tokens bound to other clients before marking them as used, so a
+	// stolen token does not invalidate the legitimate one.
+	if err := claims.Confirmation.ValidateClientIP(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeToken")
+	}
+
 	// Store the token to protect against reuse unless it's skipped.
 	// If we cannot get a token id from the provisioner, just hash the token.
 	if !SkipTokenReuseFromContext(ctx) {
@@ -82,6 +97,8 @@ func (a *Authority) authorizeToken(ctx context.Context, token string) (provision
 		}
 	}
 
+	a.recordProvisionerUse(p, 0)
+
 	return p, nil
 }
 
@@ -130,7 +147,7 @@ func (a *Authority) AuthorizeAdminToken(r *http.Request, token string) (*linkedc
 	// more than a few minutes.
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: prov.GetName(),
-		Time:   time.Now().UTC(),
+		Time:   a.now().UTC(),
 	}, time.Minute); err != nil {
 		return nil, admin.WrapError(admin.ErrorUnauthorizedType, err, "x5c.authorizeToken; invalid x5c claims")
 	}
@@ -195,6 +212,20 @@ func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
 	return nil
 }
 
+// tokenConfirmation returns the confirmation claim (cnf) of a token already
+// validated by its provisioner, or nil if it does not have one.
+func tokenConfirmation(token string) *provisioner.Confirmation {
+	tok, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil
+	}
+	var claims Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil
+	}
+	return claims.Confirmation
+}
+
 // Authorize grabs the method from the context and authorizes the request by
 // validating the one-time-token.
 func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.SignOption, error) {
@@ -242,6 +273,16 @@ func (a *Authority) authorizeSign(ctx context.Context, token string) ([]provisio
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
+	if len(a.policyHooks) > 0 {
+		signOpts = append(signOpts, &policyHookOption{ctx: ctx, provisioner: p, token: token})
+	}
+	signOpts = append(signOpts, tokenConfirmation(token).SignOptions()...)
+	if o := newCodeSigningOption(p); o != nil {
+		signOpts = append(signOpts, o)
+	}
+	if o := newMatterOption(p); o != nil {
+		signOpts = append(signOpts, o)
+	}
 	return signOpts, nil
 }
 
@@ -274,19 +315,10 @@ func (a *Authority) authorizeRevoke(ctx context.Context, token string) error {
 //
 // TODO(mariano): should we authorize by default?
 func (a *Authority) authorizeRenew(cert *x509.Certificate) error {
-	var err error
-	var isRevoked bool
 	var opts = []interface{}{errs.WithKeyVal("serialNumber", cert.SerialNumber.String())}
 
 	// Check the passive revocation table.
-	serial := cert.SerialNumber.String()
-	if lca, ok := a.adminDB.(interface {
-		IsRevoked(string) (bool, error)
-	}); ok {
-		isRevoked, err = lca.IsRevoked(serial)
-	} else {
-		isRevoked, err = a.db.IsRevoked(serial)
-	}
+	isRevoked, err := a.isRevokedForRenewal(cert.SerialNumber.String())
 	if err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
@@ -298,12 +330,98 @@ func (a *Authority) authorizeRenew(cert *x509.Certificate) error {
 	if !ok {
 		return errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
 	}
+	if !a.config.AuthorityConfig.Renewal.IsAllowedProvisioner(p.GetName()) {
+		return errs.Unauthorized("authority.authorizeRenew: certificates of provisioner %s cannot be renewed", append([]interface{}{p.GetName()}, opts...)...)
+	}
+	if err := checkProvisionerActive(p, a.now()); err != nil {
+		return errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeRenew", opts...)
+	}
 	if err := p.AuthorizeRenew(context.Background(), cert); err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
 	return nil
 }
 
+// AuthorizeRenewToken validates a renewal token and returns the certificate to
+// renew. The token is a JWT signed with the key of the certificate, included
+// with its chain in the x5c header, and it's used by clients that cannot use
+// mTLS, e.g. behind a TLS-terminating load balancer.
+func (a *Authority) AuthorizeRenewToken(ctx context.Context, token string) (*x509.Certificate, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.AuthorizeRenewToken: error parsing token")
+	}
+
+	verifiedChains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
+		Roots:     a.rootX509CertPool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.AuthorizeRenewToken: error verifying x5c certificate chain in token")
+	}
+	leaf := verifiedChains[0][0]
+	opts := []interface{}{errs.WithKeyVal("serialNumber", leaf.SerialNumber.String())}
+
+	if leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, errs.Unauthorized("authority.AuthorizeRenewToken: certificate used to sign the token cannot be used for digital signature", opts...)
+	}
+
+	// Using the leaf key asserts that the token has been signed by the owner
+	// of the certificate.
+	var claims jose.Claims
+	if err = jwt.Claims(leaf.PublicKey, &claims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.AuthorizeRenewToken: error parsing claims", opts...)
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("authority.AuthorizeRenewToken: token must have an expiration", opts...)
+	}
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Time: a.now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.AuthorizeRenewToken: invalid claims", opts...)
+	}
+	if !containsAny(a.config.GetAudiences().Renew, claims.Audience) {
+		return nil, errs.Unauthorized("authority.AuthorizeRenewToken: invalid audience (%s)", append([]interface{}{strings.Join(claims.Audience, ", ")}, opts...)...)
+	}
+
+	// Store the token to protect against reuse unless it's skipped.
+	if !SkipTokenReuseFromContext(ctx) {
+		sum := sha256.Sum256([]byte(token))
+		ok, err := a.db.UseToken(hex.EncodeToString(sum[:]), token)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.AuthorizeRenewToken: failed when attempting to store token", opts...)
+		}
+		if !ok {
+			return nil, errs.Unauthorized("authority.AuthorizeRenewToken: token already used", opts...)
+		}
+	}
+
+	return leaf, nil
+}
+
+// containsAny returns true if any of the values is in the list.
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		for _, s := range list {
+			if s == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsRevoked returns whether or not a certificate with the given serial number
+// has been revoked.
+func (a *Authority) IsRevoked(sn string) (bool, error) {
+	if lca, ok := a.adminDB.(interface {
+		IsRevoked(string) (bool, error)
+	}); ok {
+		return lca.IsRevoked(sn)
+	}
+	return a.db.IsRevoked(sn)
+}
+
 // authorizeSSHCertificate returns an error if the given certificate is revoked.
 func (a *Authority) authorizeSSHCertificate(ctx context.Context, cert *ssh.Certificate) error {
 	var err error
@@ -334,10 +452,23 @@ func (a *Authority) authorizeSSHSign(ctx context.Context, token string) ([]provi
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
+	if err := checkProvisionerActive(p, a.now()); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
+	}
+	if err := checkProvisionerSchedule(p, a.now()); err != nil {
+		return nil, errs.Wrap(http.StatusForbidden, err, "authority.authorizeSSHSign")
+	}
 	signOpts, err := p.AuthorizeSSHSign(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
+	signOpts = append(signOpts, tokenConfirmation(token).SSHSignOptions()...)
+	if len(a.policyHooks) > 0 {
+		signOpts = append(signOpts, &policyHookOption{ctx: ctx, provisioner: p, token: token})
+	}
+	// The SSH events do not carry the provisioner, the certificates are
+	// counted when the request is authorized.
+	a.recordProvisionerUse(p, 1)
 	return signOpts, nil
 }
 
@@ -3,10 +3,14 @@ package authority
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"fmt"
+	"math/big"
 	"net/http"
 	"strconv"
 	"testing"
@@ -14,12 +18,14 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/randutil"
+	"go.step.sm/crypto/x509util"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -483,7 +489,7 @@ func TestAuthority_authorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 7, got)
+					assert.Len(t, 8, got)
 				}
 			}
 		})
@@ -826,6 +832,23 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 				code: http.StatusUnauthorized,
 			}
 		},
+		"fail/provisioner-not-allowed": func(t *testing.T) *authorizeTest {
+			a := testAuthority(t)
+			a.db = &db.MockAuthDB{
+				MIsRevoked: func(key string) (bool, error) {
+					return false, nil
+				},
+			}
+			a.config.AuthorityConfig.Renewal = &config.RenewalConfig{
+				AllowedProvisioners: []string{"renew_disabled"},
+			}
+			return &authorizeTest{
+				auth: a,
+				cert: fooCrt,
+				err:  errors.New("authority.authorizeRenew: certificates of provisioner step-cli cannot be renewed"),
+				code: http.StatusUnauthorized,
+			}
+		},
 		"ok": func(t *testing.T) *authorizeTest {
 			a := testAuthority(t)
 			a.db = &db.MockAuthDB{
@@ -838,6 +861,21 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 				cert: fooCrt,
 			}
 		},
+		"ok/provisioner-allowed": func(t *testing.T) *authorizeTest {
+			a := testAuthority(t)
+			a.db = &db.MockAuthDB{
+				MIsRevoked: func(key string) (bool, error) {
+					return false, nil
+				},
+			}
+			a.config.AuthorityConfig.Renewal = &config.RenewalConfig{
+				AllowedProvisioners: []string{"renew_disabled", "step-cli"},
+			}
+			return &authorizeTest{
+				auth: a,
+				cert: fooCrt,
+			}
+		},
 	}
 
 	for name, genTestCase := range tests {
@@ -863,6 +901,92 @@ func TestAuthority_authorizeRenew(t *testing.T) {
 	}
 }
 
+func TestAuthority_AuthorizeRenewToken(t *testing.T) {
+	a := testAuthority(t)
+	issuer := getDefaultIssuer(a)
+	signer := getDefaultSigner(a)
+
+	newLeaf := func(t *testing.T, keyUsage x509.KeyUsage) (*x509.Certificate, crypto.Signer) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		crt, err := x509util.CreateCertificate(&x509.Certificate{
+			Subject:      pkix.Name{CommonName: "renew.example.com"},
+			DNSNames:     []string{"renew.example.com"},
+			SerialNumber: big.NewInt(1234),
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     keyUsage,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, issuer, key.Public(), signer)
+		assert.FatalError(t, err)
+		return crt, key
+	}
+	newToken := func(t *testing.T, chain []*x509.Certificate, key crypto.Signer, aud string, exp time.Time) string {
+		x5c := make([]string, len(chain))
+		for i, crt := range chain {
+			x5c[i] = base64.StdEncoding.EncodeToString(crt.Raw)
+		}
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			new(jose.SignerOptions).WithType("JWT").WithHeader("x5c", x5c))
+		assert.FatalError(t, err)
+		now := time.Now()
+		claims := jose.Claims{
+			Subject:  chain[0].Subject.CommonName,
+			Audience: []string{aud},
+			IssuedAt: jose.NewNumericDate(now),
+		}
+		if !exp.IsZero() {
+			claims.NotBefore = jose.NewNumericDate(now)
+			claims.Expiry = jose.NewNumericDate(exp)
+		}
+		tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	leaf, key := newLeaf(t, x509.KeyUsageDigitalSignature)
+	noSignLeaf, noSignKey := newLeaf(t, x509.KeyUsageKeyEncipherment)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	aud := "https://example.com/1.0/renew"
+	exp := time.Now().Add(5 * time.Minute)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"ok", newToken(t, []*x509.Certificate{leaf, issuer}, key, aud, exp), ""},
+		{"fail parse", "foo", "authority.AuthorizeRenewToken: error parsing token"},
+		{"fail chain", newToken(t, []*x509.Certificate{leaf}, key, aud, exp), "authority.AuthorizeRenewToken: error verifying x5c certificate chain in token"},
+		{"fail key usage", newToken(t, []*x509.Certificate{noSignLeaf, issuer}, noSignKey, aud, exp), "authority.AuthorizeRenewToken: certificate used to sign the token cannot be used for digital signature"},
+		{"fail signature", newToken(t, []*x509.Certificate{leaf, issuer}, otherKey, aud, exp), "authority.AuthorizeRenewToken: error parsing claims"},
+		{"fail expiry", newToken(t, []*x509.Certificate{leaf, issuer}, key, aud, time.Time{}), "authority.AuthorizeRenewToken: token must have an expiration"},
+		{"fail expired", newToken(t, []*x509.Certificate{leaf, issuer}, key, aud, time.Now().Add(-5*time.Minute)), "authority.AuthorizeRenewToken: invalid claims"},
+		{"fail audience", newToken(t, []*x509.Certificate{leaf, issuer}, key, "https://example.com/1.0/sign", exp), "authority.AuthorizeRenewToken: invalid audience (https://example.com/1.0/sign)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crt, err := a.AuthorizeRenewToken(context.Background(), tt.token)
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.wantErr)
+					sc, ok := err.(errs.StatusCoder)
+					assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, leaf.Raw, crt.Raw)
+
+			// Tokens cannot be reused
+			_, err = a.AuthorizeRenewToken(context.Background(), tt.token)
+			assert.HasPrefix(t, err.Error(), "authority.AuthorizeRenewToken: token already used")
+		})
+	}
+}
+
 func generateSimpleSSHUserToken(iss, aud string, jwk *jose.JSONWebKey) (string, error) {
 	return generateSSHToken("subject@localhost", iss, aud, time.Now(), &provisioner.SignSSHOptions{
 		CertType:   "user",
@@ -995,7 +1119,7 @@ func TestAuthority_authorizeSSHSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 7, got)
+					assert.Len(t, 8, got)
 				}
 			}
 		})
@@ -0,0 +1,269 @@
+package authority
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
+)
+
+const (
+	// pwnedkeysCacheTTL is the time a key not found in pwnedkeys.com is
+	// cached. Keys found are cached until the cache is full, as a compromised
+	// key does not stop being compromised.
+	pwnedkeysCacheTTL = time.Hour
+	// maxPwnedkeysCacheSize is the maximum number of keys in the cache.
+	maxPwnedkeysCacheSize = 10000
+	// maxPwnedkeysResponseSize is the maximum size of a pwnedkeys.com
+	// response.
+	maxPwnedkeysResponseSize = 64 << 10
+)
+
+// keyBlocklist checks public keys against a list of compromised keys and,
+// optionally, against pwnedkeys.com.
+//
+// The pwnedkeys.com lookup runs synchronously in the sign, renew and rekey
+// requests, so the results are cached by fingerprint, and the lookups go
+// through a circuit breaker if they are enabled.
+type keyBlocklist struct {
+	fingerprints map[string]struct{}
+	pwnedkeysURL string
+	client       *http.Client
+	breaker      *breaker.Breaker
+	failOpen     bool
+	logError     func(error, string)
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]pwnedkeysResult
+}
+
+// pwnedkeysResult is a cached pwnedkeys.com result.
+type pwnedkeysResult struct {
+	blocked   bool
+	expiresAt time.Time
+}
+
+func newKeyBlocklist(c *config.BlockedKeysConfig, s *breaker.Settings) (*keyBlocklist, error) {
+	b := &keyBlocklist{
+		fingerprints: make(map[string]struct{}),
+		cache:        make(map[string]pwnedkeysResult),
+		logError: func(err error, msg string) {
+			log.Printf("%s: %v", msg, err)
+		},
+		now: time.Now,
+	}
+	for _, fp := range c.Fingerprints {
+		b.fingerprints[strings.ToLower(fp)] = struct{}{}
+	}
+	for _, fn := range c.Files {
+		if err := b.readFile(fn); err != nil {
+			return nil, err
+		}
+	}
+	if c.Pwnedkeys {
+		b.pwnedkeysURL = c.GetPwnedkeysURL()
+		b.client = &http.Client{Timeout: 10 * time.Second}
+		b.breaker = breaker.New("pwnedkeys", s)
+		b.failOpen = c.PwnedkeysFailOpen
+	}
+	return b, nil
+}
+
+// readFile adds the fingerprints in the given file, one per line.
+func (b *keyBlocklist) readFile(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s", fn)
+	}
+	defer f.Close()
+
+	var n int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !config.IsValidKeyFingerprint(line) {
+			return errors.Errorf("error reading %s: line %d is not a valid fingerprint", fn, n)
+		}
+		b.fingerprints[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "error reading %s", fn)
+	}
+	return nil
+}
+
+// IsBlocked returns true if the given public key is in the list of blocked
+// keys or in pwnedkeys.com. If pwnedkeys.com cannot be queried, the key is
+// allowed with pwnedkeysFailOpen, and it returns an error otherwise.
+func (b *keyBlocklist) IsBlocked(pub crypto.PublicKey) (bool, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return false, errors.Wrap(err, "error marshaling public key")
+	}
+	sum := sha256.Sum256(der)
+	fp := hex.EncodeToString(sum[:])
+	if _, ok := b.fingerprints[fp]; ok {
+		return true, nil
+	}
+
+	// Debian openssl-blacklist fingerprint.
+	if k, ok := pub.(*rsa.PublicKey); ok {
+		sum := sha1.Sum([]byte(fmt.Sprintf("Modulus=%X\n", k.N)))
+		if _, ok := b.fingerprints[hex.EncodeToString(sum[:])[20:]]; ok {
+			return true, nil
+		}
+	}
+
+	if b.pwnedkeysURL == "" {
+		return false, nil
+	}
+	if blocked, ok := b.cached(fp); ok {
+		return blocked, nil
+	}
+	var blocked bool
+	err = b.breaker.Do(func() (err error) {
+		blocked, err = b.lookup(pub, fp)
+		return
+	})
+	switch {
+	case err != nil && b.failOpen:
+		b.logError(err, "error checking key in pwnedkeys, the key is allowed")
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	b.store(fp, blocked)
+	return blocked, nil
+}
+
+// lookup checks the key with the given fingerprint in pwnedkeys.com. A key is
+// only considered compromised if the response is a JWS signed by the key
+// itself, with the fingerprint as key id.
+func (b *keyBlocklist) lookup(pub crypto.PublicKey, fp string) (bool, error) {
+	resp, err := b.client.Get(b.pwnedkeysURL + "/" + fp)
+	if err != nil {
+		return false, errors.Wrap(err, "error checking key in pwnedkeys")
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.Errorf("error checking key in pwnedkeys: status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPwnedkeysResponseSize))
+	if err != nil {
+		return false, errors.Wrap(err, "error reading pwnedkeys response")
+	}
+	jws, err := jose.ParseJWS(string(body))
+	if err != nil {
+		return false, errors.Wrap(err, "error parsing pwnedkeys response")
+	}
+	if len(jws.Signatures) != 1 || jws.Signatures[0].Protected.KeyID != fp {
+		return false, errors.New("error validating pwnedkeys response: key id does not match the key fingerprint")
+	}
+	if _, err := jws.Verify(pub); err != nil {
+		return false, errors.Wrap(err, "error validating pwnedkeys response")
+	}
+	return true, nil
+}
+
+// cached returns the cached pwnedkeys.com result of the given fingerprint.
+func (b *keyBlocklist) cached(fp string) (blocked, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, ok := b.cache[fp]
+	if !ok {
+		return false, false
+	}
+	if !r.blocked && !b.now().Before(r.expiresAt) {
+		delete(b.cache, fp)
+		return false, false
+	}
+	return r.blocked, true
+}
+
+// store caches the pwnedkeys.com result of the given fingerprint. If the
+// cache is full, the expired entries are removed, and if it is still full,
+// the cache is cleared.
+func (b *keyBlocklist) store(fp string, blocked bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if len(b.cache) >= maxPwnedkeysCacheSize {
+		for k, r := range b.cache {
+			if !r.blocked && !now.Before(r.expiresAt) {
+				delete(b.cache, k)
+			}
+		}
+		if len(b.cache) >= maxPwnedkeysCacheSize {
+			b.cache = make(map[string]pwnedkeysResult)
+		}
+	}
+	b.cache[fp] = pwnedkeysResult{
+		blocked:   blocked,
+		expiresAt: now.Add(pwnedkeysCacheTTL),
+	}
+}
+
+// initBlockedKeys loads the list of compromised public keys.
+func (a *Authority) initBlockedKeys() error {
+	c := a.config.AuthorityConfig.BlockedKeys
+	if c == nil {
+		return nil
+	}
+	b, err := newKeyBlocklist(c, a.config.CircuitBreaker.GetSettings())
+	if err != nil {
+		return err
+	}
+	b.logError = a.logError
+	b.now = a.now
+	a.keyBlocklist = b
+	return nil
+}
+
+// checkBlockedKey returns an error if the given public key is known to be
+// compromised.
+func (a *Authority) checkBlockedKey(pub crypto.PublicKey) error {
+	if a.keyBlocklist == nil {
+		return nil
+	}
+	blocked, err := a.keyBlocklist.IsBlocked(pub)
+	switch {
+	case breaker.IsOpen(err):
+		return breakerError(err)
+	case err != nil:
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.checkBlockedKey")
+	}
+	if blocked {
+		return errs.Forbidden("authority.checkBlockedKey; public key is known to be compromised",
+			errs.WithMessage("The public key is known to be compromised and cannot be used."),
+			errs.WithCode(errs.CodeBlockedKey))
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"go.step.sm/crypto/jose"
+)
+
+func spkiFingerprint(t *testing.T, pub interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	assert.FatalError(t, err)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// pwnedkeysResponse returns a pwnedkeys.com response, a JWS signed by the
+// given key with the given key id.
+func pwnedkeysResponse(t *testing.T, key interface{}, kid string) []byte {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		new(jose.SignerOptions).WithHeader("kid", kid))
+	assert.FatalError(t, err)
+	jws, err := signer.Sign([]byte("This key is pwned!"))
+	assert.FatalError(t, err)
+	return []byte(jws.FullSerialize())
+}
+
+func TestKeyBlocklist_IsBlocked(t *testing.T) {
+	blocked, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pwned, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	forged, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	unsigned, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	good, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.FatalError(t, err)
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("Modulus=%X\n", weak.N)))
+	debianFingerprint := hex.EncodeToString(sum[:])[20:]
+
+	f, err := ioutil.TempFile("", "blocklist")
+	assert.FatalError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# openssl-blacklist\n\n" + strings.ToUpper(debianFingerprint) + "\n")
+	assert.FatalError(t, err)
+	assert.FatalError(t, f.Close())
+
+	pwnedFingerprint := spkiFingerprint(t, pwned.Public())
+	forgedFingerprint := spkiFingerprint(t, forged.Public())
+	unsignedFingerprint := spkiFingerprint(t, unsigned.Public())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/"+pwnedFingerprint:
+			w.Write(pwnedkeysResponse(t, pwned, pwnedFingerprint))
+		case r.URL.Path == "/"+forgedFingerprint:
+			w.Write(pwnedkeysResponse(t, blocked, forgedFingerprint))
+		case r.URL.Path == "/"+unsignedFingerprint:
+			w.Write([]byte("{}"))
+		case strings.HasPrefix(r.URL.Path, "/error/"):
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	b, err := newKeyBlocklist(&config.BlockedKeysConfig{
+		Fingerprints: []string{spkiFingerprint(t, blocked.Public())},
+		Files:        []string{f.Name()},
+		Pwnedkeys:    true,
+		PwnedkeysURL: srv.URL,
+	}, nil)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		pub     interface{}
+		want    bool
+		wantErr bool
+	}{
+		{"blocked", blocked.Public(), true, false},
+		{"debian", weak.Public(), true, false},
+		{"pwned", pwned.Public(), true, false},
+		{"good", good.Public(), false, false},
+		{"fail forged", forged.Public(), false, true},
+		{"fail unsigned", unsigned.Public(), false, true},
+		{"fail key", "not a key", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.IsBlocked(tt.pub)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keyBlocklist.IsBlocked() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("keyBlocklist.IsBlocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// pwnedkeys errors
+	b.pwnedkeysURL = srv.URL + "/error"
+	_, err = b.IsBlocked(unsigned.Public())
+	assert.NotNil(t, err)
+
+	// invalid files
+	_, err = newKeyBlocklist(&config.BlockedKeysConfig{Files: []string{"testdata/missing"}}, nil)
+	assert.NotNil(t, err)
+	f, err = ioutil.TempFile("", "blocklist")
+	assert.FatalError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("foo\n")
+	assert.FatalError(t, err)
+	assert.FatalError(t, f.Close())
+	_, err = newKeyBlocklist(&config.BlockedKeysConfig{Files: []string{f.Name()}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestKeyBlocklist_IsBlocked_pwnedkeys(t *testing.T) {
+	pwned, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	good, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pwnedFingerprint := spkiFingerprint(t, pwned.Public())
+
+	var requests int32
+	var failing int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch {
+		case atomic.LoadInt32(&failing) == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/"+pwnedFingerprint:
+			w.Write(pwnedkeysResponse(t, pwned, pwnedFingerprint))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	clock := provisioner.NewFakeClock(time.Now())
+	newBlocklist := func(failOpen bool) *keyBlocklist {
+		b, err := newKeyBlocklist(&config.BlockedKeysConfig{
+			Pwnedkeys:         true,
+			PwnedkeysURL:      srv.URL,
+			PwnedkeysFailOpen: failOpen,
+		}, &breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Minute})
+		assert.FatalError(t, err)
+		b.now = clock.Now
+		return b
+	}
+	// Results are cached, the keys not found only until the ttl expires.
+	atomic.StoreInt32(&requests, 0)
+	b := newBlocklist(false)
+	for i := 0; i < 3; i++ {
+		blocked, err := b.IsBlocked(pwned.Public())
+		assert.FatalError(t, err)
+		assert.True(t, blocked)
+		blocked, err = b.IsBlocked(good.Public())
+		assert.FatalError(t, err)
+		assert.False(t, blocked)
+	}
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+	clock.Add(pwnedkeysCacheTTL)
+	_, err = b.IsBlocked(pwned.Public())
+	assert.FatalError(t, err)
+	_, err = b.IsBlocked(good.Public())
+	assert.FatalError(t, err)
+	assert.Equals(t, int32(3), atomic.LoadInt32(&requests))
+
+	// Fail closed, the breaker opens after two failures.
+	atomic.StoreInt32(&failing, 1)
+	atomic.StoreInt32(&requests, 0)
+	b = newBlocklist(false)
+	for i := 0; i < 3; i++ {
+		_, err = b.IsBlocked(good.Public())
+		assert.NotNil(t, err)
+	}
+	assert.True(t, breaker.IsOpen(err))
+	assert.Equals(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Fail open, errors are not cached.
+	b = newBlocklist(true)
+	blocked, err := b.IsBlocked(good.Public())
+	assert.FatalError(t, err)
+	assert.False(t, blocked)
+	atomic.StoreInt32(&failing, 0)
+	blocked, err = b.IsBlocked(pwned.Public())
+	assert.FatalError(t, err)
+	assert.True(t, blocked)
+}
+
+func TestAuthority_checkBlockedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	newAuthority := func(failOpen bool, s *breaker.Settings) *Authority {
+		b, err := newKeyBlocklist(&config.BlockedKeysConfig{
+			Pwnedkeys:         true,
+			PwnedkeysURL:      srv.URL,
+			PwnedkeysFailOpen: failOpen,
+		}, s)
+		assert.FatalError(t, err)
+		return &Authority{keyBlocklist: b}
+	}
+
+	assert.Nil(t, newAuthority(true, nil).checkBlockedKey(key.Public()))
+
+	err = newAuthority(false, nil).checkBlockedKey(key.Public())
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusInternalServerError, err.(interface{ StatusCode() int }).StatusCode())
+	}
+
+	a := newAuthority(false, &breaker.Settings{FailureThreshold: 1})
+	assert.NotNil(t, a.checkBlockedKey(key.Public()))
+	err = a.checkBlockedKey(key.Public())
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusServiceUnavailable, err.(interface{ StatusCode() int }).StatusCode())
+	}
+}
@@ -0,0 +1,202 @@
+// Package breaker implements the circuit breakers used in the calls to the
+// external dependencies of the CA, like identity providers, policy servers,
+// key managers and upstream CAs. After a number of consecutive failures the
+// breaker opens, and the calls fail right away, so a slow or unavailable
+// dependency does not stall every request. Once the open timeout passes, a
+// single call is allowed to probe the dependency, and the breaker closes if it
+// succeeds.
+package breaker
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default values of the settings.
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// States of a breaker.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// Settings are the settings of the breakers.
+type Settings struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. It defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is the time the breaker stays open before a call is allowed
+	// to probe the dependency. It defaults to 30s.
+	OpenTimeout time.Duration
+}
+
+// OpenError is the error returned by the calls rejected by an open breaker.
+type OpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s is open", e.Name)
+}
+
+// StatusCode implements the errs.StatusCoder interface, the calls rejected by
+// a breaker return a 503 Service Unavailable.
+func (e *OpenError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// IsOpen returns true if the error, or any of its causes, is an OpenError.
+func IsOpen(err error) bool {
+	var e *OpenError
+	return errors.As(err, &e)
+}
+
+// Breaker is a circuit breaker. A nil breaker allows all the calls.
+type Breaker struct {
+	name      string
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+// New creates a breaker with the given name and settings. It returns nil,
+// a breaker that allows all the calls, if the settings are nil.
+func New(name string, s *Settings) *Breaker {
+	if s == nil {
+		return nil
+	}
+	b := &Breaker{
+		name:      name,
+		threshold: s.FailureThreshold,
+		timeout:   s.OpenTimeout,
+		now:       time.Now,
+	}
+	if b.threshold <= 0 {
+		b.threshold = DefaultFailureThreshold
+	}
+	if b.timeout <= 0 {
+		b.timeout = DefaultOpenTimeout
+	}
+	return b
+}
+
+// Name returns the name of the breaker.
+func (b *Breaker) Name() string {
+	if b == nil {
+		return ""
+	}
+	return b.name
+}
+
+// State returns the state of the breaker.
+func (b *Breaker) State() string {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !b.open:
+		return StateClosed
+	case b.probing || !b.now().Before(b.openedAt.Add(b.timeout)):
+		return StateHalfOpen
+	default:
+		return StateOpen
+	}
+}
+
+// Do calls fn if the breaker allows it, and records its result. It returns an
+// OpenError without calling fn if the breaker is open.
+//
+// Errors with a status code lower than 500, like the ones returned by an
+// upstream CA that rejects a request, and 501 Not Implemented errors are not
+// failures, as the dependency is available.
+func (b *Breaker) Do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.done(isFailure(err))
+	return err
+}
+
+// allow returns an OpenError if the call is not allowed. Once the open timeout
+// passes, only one call at a time is allowed until one of them succeeds.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	retryAt := b.openedAt.Add(b.timeout)
+	if now := b.now(); now.Before(retryAt) || b.probing {
+		retryAfter := retryAt.Sub(now)
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		return &OpenError{Name: b.name, RetryAfter: retryAfter}
+	}
+	b.probing = true
+	return nil
+}
+
+// done records the result of an allowed call.
+func (b *Breaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		if b.open {
+			log.Printf("circuit breaker %s is closed", b.name)
+		}
+		b.failures = 0
+		b.open = false
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.probing || (!b.open && b.failures >= b.threshold) {
+		if !b.open {
+			log.Printf("circuit breaker %s is open after %d failures", b.name, b.failures)
+		}
+		b.open = true
+		b.probing = false
+		b.openedAt = b.now()
+	}
+}
+
+// isFailure returns true if the error is a failure of the dependency.
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var sc interface {
+		StatusCode() int
+	}
+	if errors.As(err, &sc) {
+		code := sc.StatusCode()
+		return code >= 500 && code != http.StatusNotImplemented
+	}
+	return true
+}
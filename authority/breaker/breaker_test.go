@@ -0,0 +1,122 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type statusError struct {
+	error
+	status int
+}
+
+func (e statusError) StatusCode() int {
+	return e.status
+}
+
+func TestNew(t *testing.T) {
+	if b := New("test", nil); b != nil {
+		t.Errorf("New() = %v, want nil", b)
+	}
+	b := New("test", &Settings{})
+	if b.threshold != DefaultFailureThreshold || b.timeout != DefaultOpenTimeout {
+		t.Errorf("New() = %+v, want default settings", b)
+	}
+	b = New("test", &Settings{FailureThreshold: 2, OpenTimeout: time.Second})
+	if b.Name() != "test" || b.threshold != 2 || b.timeout != time.Second {
+		t.Errorf("New() = %+v, want custom settings", b)
+	}
+}
+
+func TestBreaker_nil(t *testing.T) {
+	var b *Breaker
+	fail := errors.New("force")
+	for i := 0; i < 10; i++ {
+		if err := b.Do(func() error { return fail }); err != fail {
+			t.Fatalf("Breaker.Do() error = %v, want %v", err, fail)
+		}
+	}
+	if b.State() != StateClosed {
+		t.Errorf("Breaker.State() = %s, want %s", b.State(), StateClosed)
+	}
+}
+
+func TestBreaker_Do(t *testing.T) {
+	now := time.Now()
+	b := New("test", &Settings{FailureThreshold: 3, OpenTimeout: time.Minute})
+	b.now = func() time.Time { return now }
+
+	var calls int
+	fail := errors.New("force")
+	do := func(err error) error {
+		return b.Do(func() error {
+			calls++
+			return err
+		})
+	}
+
+	// Client errors and successes reset the failures.
+	do(fail)
+	do(fail)
+	do(statusError{fail, http.StatusBadRequest})
+	do(statusError{fail, http.StatusNotImplemented})
+	do(fail)
+	do(fail)
+	if err := do(nil); err != nil {
+		t.Fatalf("Breaker.Do() error = %v", err)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("Breaker.State() = %s, want %s", b.State(), StateClosed)
+	}
+
+	// The breaker opens after 3 consecutive failures.
+	for i := 0; i < 3; i++ {
+		if err := do(statusError{fail, http.StatusInternalServerError}); IsOpen(err) {
+			t.Fatalf("Breaker.Do() error = %v, want %v", err, fail)
+		}
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("Breaker.State() = %s, want %s", b.State(), StateOpen)
+	}
+	calls = 0
+	err := do(nil)
+	if !IsOpen(err) || calls != 0 {
+		t.Fatalf("Breaker.Do() error = %v, calls = %d, want open error", err, calls)
+	}
+	if e := err.(*OpenError); e.Name != "test" || e.RetryAfter != time.Minute || e.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("OpenError = %+v", e)
+	}
+
+	// A failed probe opens the breaker again.
+	now = now.Add(time.Minute)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Breaker.State() = %s, want %s", b.State(), StateHalfOpen)
+	}
+	if err := do(fail); err != fail || calls != 1 {
+		t.Fatalf("Breaker.Do() error = %v, calls = %d, want %v", err, calls, fail)
+	}
+	if err := do(nil); !IsOpen(err) {
+		t.Fatalf("Breaker.Do() error = %v, want open error", err)
+	}
+
+	// Only one probe runs at a time, and the breaker closes if it succeeds.
+	now = now.Add(time.Minute)
+	err = b.Do(func() error {
+		if err := do(nil); !IsOpen(err) {
+			t.Errorf("Breaker.Do() error = %v, want open error", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Breaker.Do() error = %v", err)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("Breaker.State() = %s, want %s", b.State(), StateClosed)
+	}
+	calls = 0
+	if err := do(nil); err != nil || calls != 1 {
+		t.Fatalf("Breaker.Do() error = %v, calls = %d", err, calls)
+	}
+}
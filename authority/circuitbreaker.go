@@ -0,0 +1,72 @@
+package authority
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+)
+
+// breakerCAS is a CertificateAuthorityService that calls the wrapped service
+// through a circuit breaker. With the SoftCAS the breaker protects the calls to
+// the key manager of the intermediate key, and with other services the calls
+// to the upstream CA.
+type breakerCAS struct {
+	casapi.CertificateAuthorityService
+	breaker *breaker.Breaker
+}
+
+// newBreakerCAS returns the given service wrapped in a circuit breaker, or the
+// service itself if the breakers are not enabled.
+func newBreakerCAS(srv casapi.CertificateAuthorityService, typ string, s *breaker.Settings) casapi.CertificateAuthorityService {
+	if s == nil {
+		return srv
+	}
+	name := casapi.Type(typ).String()
+	if name == casapi.SoftCAS {
+		name = "kms"
+	}
+	return &breakerCAS{
+		CertificateAuthorityService: srv,
+		breaker:                     breaker.New(name, s),
+	}
+}
+
+func (c *breakerCAS) CreateCertificate(req *casapi.CreateCertificateRequest) (resp *casapi.CreateCertificateResponse, err error) {
+	err = c.breaker.Do(func() (err error) {
+		resp, err = c.CertificateAuthorityService.CreateCertificate(req)
+		return
+	})
+	return resp, breakerError(err)
+}
+
+func (c *breakerCAS) RenewCertificate(req *casapi.RenewCertificateRequest) (resp *casapi.RenewCertificateResponse, err error) {
+	err = c.breaker.Do(func() (err error) {
+		resp, err = c.CertificateAuthorityService.RenewCertificate(req)
+		return
+	})
+	return resp, breakerError(err)
+}
+
+func (c *breakerCAS) RevokeCertificate(req *casapi.RevokeCertificateRequest) (resp *casapi.RevokeCertificateResponse, err error) {
+	err = c.breaker.Do(func() (err error) {
+		resp, err = c.CertificateAuthorityService.RevokeCertificate(req)
+		return
+	})
+	return resp, breakerError(err)
+}
+
+// breakerError converts the error of a call rejected by an open circuit
+// breaker into a 503 Service Unavailable error with a Retry-After header.
+// Other errors are returned as they are.
+func breakerError(err error) error {
+	var e *breaker.OpenError
+	if !errors.As(err, &e) {
+		return err
+	}
+	return errs.NewErr(http.StatusServiceUnavailable, err,
+		errs.WithMessage("The certificate authority cannot reach one of its dependencies. Please try again later."),
+		errs.WithRetryAfter(e.RetryAfter))
+}
@@ -0,0 +1,108 @@
+package authority
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+)
+
+type mockCAS struct {
+	err   error
+	calls int
+}
+
+func (m *mockCAS) CreateCertificate(req *casapi.CreateCertificateRequest) (*casapi.CreateCertificateResponse, error) {
+	m.calls++
+	return &casapi.CreateCertificateResponse{}, m.err
+}
+
+func (m *mockCAS) RenewCertificate(req *casapi.RenewCertificateRequest) (*casapi.RenewCertificateResponse, error) {
+	m.calls++
+	return &casapi.RenewCertificateResponse{}, m.err
+}
+
+func (m *mockCAS) RevokeCertificate(req *casapi.RevokeCertificateRequest) (*casapi.RevokeCertificateResponse, error) {
+	m.calls++
+	return &casapi.RevokeCertificateResponse{}, m.err
+}
+
+func Test_newBreakerCAS(t *testing.T) {
+	srv := &mockCAS{}
+	if got := newBreakerCAS(srv, "", nil); got != srv {
+		t.Errorf("newBreakerCAS() = %v, want %v", got, srv)
+	}
+	tests := []struct {
+		typ  string
+		want string
+	}{
+		{"", "kms"},
+		{"SoftCAS", "kms"},
+		{"CloudCAS", "cloudcas"},
+		{"stepcas", "stepcas"},
+	}
+	for _, tt := range tests {
+		got, ok := newBreakerCAS(srv, tt.typ, &breaker.Settings{}).(*breakerCAS)
+		if !ok {
+			t.Fatalf("newBreakerCAS() = %T, want *breakerCAS", got)
+		}
+		if got.breaker.Name() != tt.want {
+			t.Errorf("newBreakerCAS() breaker = %s, want %s", got.breaker.Name(), tt.want)
+		}
+	}
+}
+
+func Test_breakerCAS(t *testing.T) {
+	srv := &mockCAS{err: errors.New("upstream is down")}
+	c := newBreakerCAS(srv, "stepcas", &breaker.Settings{FailureThreshold: 3, OpenTimeout: time.Minute})
+
+	// Client errors do not open the breaker.
+	srv.err = errs.BadRequest("bad request")
+	for i := 0; i < 3; i++ {
+		if _, err := c.RevokeCertificate(&casapi.RevokeCertificateRequest{}); err != srv.err {
+			t.Fatalf("breakerCAS.RevokeCertificate() error = %v, want %v", err, srv.err)
+		}
+	}
+
+	srv.err = errors.New("upstream is down")
+	if _, err := c.CreateCertificate(&casapi.CreateCertificateRequest{}); err != srv.err {
+		t.Fatalf("breakerCAS.CreateCertificate() error = %v, want %v", err, srv.err)
+	}
+	if _, err := c.RenewCertificate(&casapi.RenewCertificateRequest{}); err != srv.err {
+		t.Fatalf("breakerCAS.RenewCertificate() error = %v, want %v", err, srv.err)
+	}
+	if _, err := c.RevokeCertificate(&casapi.RevokeCertificateRequest{}); err != srv.err {
+		t.Fatalf("breakerCAS.RevokeCertificate() error = %v, want %v", err, srv.err)
+	}
+
+	// The open breaker returns a 503 without calling the service.
+	srv.calls = 0
+	_, err := c.CreateCertificate(&casapi.CreateCertificateRequest{})
+	e, ok := err.(*errs.Error)
+	if !ok {
+		t.Fatalf("breakerCAS.CreateCertificate() error = %T, want *errs.Error", err)
+	}
+	if e.StatusCode() != http.StatusServiceUnavailable || e.RetryAfter <= 0 || srv.calls != 0 {
+		t.Errorf("breakerCAS.CreateCertificate() error = %+v, calls = %d", e, srv.calls)
+	}
+
+	// The status is kept when the error is wrapped.
+	err = errs.Wrap(http.StatusInternalServerError, err, "authority.Sign")
+	if sc, ok := err.(errs.StatusCoder); !ok || sc.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("errs.Wrap() = %v, want 503 status", err)
+	}
+}
+
+func Test_breakerError(t *testing.T) {
+	err := errors.New("force")
+	if got := breakerError(err); got != err {
+		t.Errorf("breakerError() = %v, want %v", got, err)
+	}
+	if got := breakerError(nil); got != nil {
+		t.Errorf("breakerError() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,304 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+var codeSigningRequestsTable = []byte("codesigning_requests")
+
+// CodeSigningStatus is the status of a code signing request.
+type CodeSigningStatus string
+
+const (
+	// CodeSigningPending is the status of requests waiting for a decision.
+	CodeSigningPending CodeSigningStatus = "pending"
+	// CodeSigningApproved is the status of requests that can be issued.
+	CodeSigningApproved CodeSigningStatus = "approved"
+	// CodeSigningRejected is the status of requests that will not be issued.
+	CodeSigningRejected CodeSigningStatus = "rejected"
+)
+
+// CodeSigningRequest is a code signing certificate request held until an
+// administrator approves it. The request is identified by the SHA-256
+// fingerprint of the attested public key, and an approval is valid for one
+// certificate.
+type CodeSigningRequest struct {
+	ID                string            `json:"id"`
+	Provisioner       string            `json:"provisioner"`
+	Subject           string            `json:"subject"`
+	AttestationFormat string            `json:"attestationFormat"`
+	SerialNumber      string            `json:"serialNumber,omitempty"`
+	Status            CodeSigningStatus `json:"status"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
+}
+
+// codeSigningOption is the sign option added to the requests of provisioners
+// with the code signing profile enabled.
+type codeSigningOption struct {
+	provisioner provisioner.Interface
+	options     *provisioner.CodeSigningOptions
+}
+
+// newCodeSigningOption returns the code signing option if the code signing
+// profile is enabled in the given provisioner.
+func newCodeSigningOption(p provisioner.Interface) *codeSigningOption {
+	if o := getProvisionerOptions(p).GetCodeSigning(); o != nil {
+		return &codeSigningOption{provisioner: p, options: o}
+	}
+	return nil
+}
+
+// codeSigningStore keeps the code signing requests in the database.
+type codeSigningStore struct {
+	db nosql.DB
+}
+
+func newCodeSigningStore(db nosql.DB) (*codeSigningStore, error) {
+	if err := db.CreateTable(codeSigningRequestsTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(codeSigningRequestsTable))
+	}
+	return &codeSigningStore{db: db}, nil
+}
+
+func (s *codeSigningStore) get(id string) (*CodeSigningRequest, error) {
+	b, err := s.db.Get(codeSigningRequestsTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading code signing request %s", id)
+	}
+	r := new(CodeSigningRequest)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling code signing request %s", id)
+	}
+	return r, nil
+}
+
+func (s *codeSigningStore) list() ([]*CodeSigningRequest, error) {
+	entries, err := s.db.List(codeSigningRequestsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading code signing requests")
+	}
+	requests := []*CodeSigningRequest{}
+	for _, e := range entries {
+		r := new(CodeSigningRequest)
+		if err := json.Unmarshal(e.Value, r); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling code signing request %s", string(e.Key))
+		}
+		requests = append(requests, r)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
+
+func (s *codeSigningStore) set(r *CodeSigningRequest) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling code signing request %s", r.ID)
+	}
+	return errors.Wrapf(s.db.Set(codeSigningRequestsTable, []byte(r.ID), b), "error storing code signing request %s", r.ID)
+}
+
+func (s *codeSigningStore) delete(id string) error {
+	return errors.Wrapf(s.db.Del(codeSigningRequestsTable, []byte(id)), "error deleting code signing request %s", id)
+}
+
+// getCodeSigningStore returns the store of the code signing requests, it's
+// created the first time it's used. It must be called with the
+// codeSigningMutex held.
+func (a *Authority) getCodeSigningStore() (*codeSigningStore, error) {
+	if a.codeSigningRequests == nil {
+		store, err := newCodeSigningStore(a.getStateDB())
+		if err != nil {
+			return nil, err
+		}
+		a.codeSigningRequests = store
+	}
+	return a.codeSigningRequests, nil
+}
+
+// codeSigningRequestID returns the id of the code signing requests for the
+// given public key.
+func codeSigningRequestID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling public key")
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkCodeSigning enforces the code signing profile. The certificate must
+// only be valid for code signing, the key must have a valid hardware
+// attestation and, if required, an administrator must have approved it.
+func (a *Authority) checkCodeSigning(o *codeSigningOption, csr *x509.CertificateRequest, leaf *x509.Certificate, att *keyattest.Statement) error {
+	if o == nil {
+		return nil
+	}
+	if leaf.IsCA || len(leaf.UnknownExtKeyUsage) > 0 ||
+		len(leaf.ExtKeyUsage) != 1 || leaf.ExtKeyUsage[0] != x509.ExtKeyUsageCodeSigning {
+		return errs.Forbidden("authority.checkCodeSigning; certificate must only have the codeSigning extended key usage",
+			errs.WithMessage("Code signing certificates can only have the codeSigning extended key usage."))
+	}
+
+	if att == nil || !o.options.IsFormatAllowed(att.Format) {
+		return errs.Forbidden("authority.checkCodeSigning; missing or unsupported key attestation",
+			errs.WithMessage("Code signing certificates require a hardware key attestation in one of the allowed formats."),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	policy := a.GetAttestationPolicy()
+	res, err := keyattest.Verify(att, csr.PublicKey, keyattest.VerifyOptions{
+		VerifyChain: policy.VerifyChain,
+	})
+	if err != nil {
+		return errs.NewErr(http.StatusForbidden, errors.Wrap(err, "authority.checkCodeSigning"),
+			errs.WithMessage("The hardware key attestation is not valid."),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	if res.SerialNumber != "" && !policy.IsSerialNumberAllowed(res.SerialNumber) {
+		return errs.Forbidden("authority.checkCodeSigning; device %s is not allowed", res.SerialNumber,
+			errs.WithMessage("The device %s is not allowed to request code signing certificates.", res.SerialNumber),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+
+	if !o.options.RequireApproval {
+		return nil
+	}
+	return a.checkCodeSigningApproval(o, csr, leaf, res)
+}
+
+// checkCodeSigningApproval returns an error unless the attested key has been
+// approved. The first request for a key creates a pending request.
+func (a *Authority) checkCodeSigningApproval(o *codeSigningOption, csr *x509.CertificateRequest, leaf *x509.Certificate, res *keyattest.Result) error {
+	id, err := codeSigningRequestID(csr.PublicKey)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.checkCodeSigningApproval")
+	}
+
+	a.codeSigningMutex.Lock()
+	defer a.codeSigningMutex.Unlock()
+	store, err := a.getCodeSigningStore()
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.checkCodeSigningApproval")
+	}
+	r, err := store.get(id)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.checkCodeSigningApproval")
+	}
+
+	switch {
+	case r == nil:
+		now := a.now().UTC().Truncate(time.Second)
+		r = &CodeSigningRequest{
+			ID:                id,
+			Provisioner:       o.provisioner.GetName(),
+			Subject:           leaf.Subject.CommonName,
+			AttestationFormat: res.Format,
+			SerialNumber:      res.SerialNumber,
+			Status:            CodeSigningPending,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		if err := store.set(r); err != nil {
+			return errs.Wrap(http.StatusInternalServerError, err, "authority.checkCodeSigningApproval")
+		}
+		fallthrough
+	case r.Status == CodeSigningPending:
+		return errs.Forbidden("authority.checkCodeSigningApproval; code signing request %s is pending", id,
+			errs.WithMessage("The code signing request %s is waiting for approval.", id),
+			errs.WithCode(errs.CodeApprovalRequired))
+	case r.Status == CodeSigningRejected:
+		return errs.Forbidden("authority.checkCodeSigningApproval; code signing request %s has been rejected", id,
+			errs.WithMessage("The code signing request %s has been rejected.", id))
+	default:
+		return nil
+	}
+}
+
+// consumeCodeSigningApproval removes the approval used to issue a code
+// signing certificate.
+func (a *Authority) consumeCodeSigningApproval(o *codeSigningOption, csr *x509.CertificateRequest) error {
+	if o == nil || !o.options.RequireApproval {
+		return nil
+	}
+	id, err := codeSigningRequestID(csr.PublicKey)
+	if err != nil {
+		return err
+	}
+	a.codeSigningMutex.Lock()
+	defer a.codeSigningMutex.Unlock()
+	store, err := a.getCodeSigningStore()
+	if err != nil {
+		return err
+	}
+	return store.delete(id)
+}
+
+// GetCodeSigningRequests returns the code signing requests.
+func (a *Authority) GetCodeSigningRequests() ([]*CodeSigningRequest, error) {
+	a.codeSigningMutex.Lock()
+	defer a.codeSigningMutex.Unlock()
+	store, err := a.getCodeSigningStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading code signing requests")
+	}
+	requests, err := store.list()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading code signing requests")
+	}
+	return requests, nil
+}
+
+// ApproveCodeSigningRequest approves the code signing request with the given
+// id, the certificate will be issued the next time the client requests it.
+func (a *Authority) ApproveCodeSigningRequest(id string) (*CodeSigningRequest, error) {
+	return a.updateCodeSigningRequest(id, CodeSigningApproved)
+}
+
+// RejectCodeSigningRequest rejects the code signing request with the given id.
+func (a *Authority) RejectCodeSigningRequest(id string) (*CodeSigningRequest, error) {
+	return a.updateCodeSigningRequest(id, CodeSigningRejected)
+}
+
+func (a *Authority) updateCodeSigningRequest(id string, status CodeSigningStatus) (*CodeSigningRequest, error) {
+	a.codeSigningMutex.Lock()
+	defer a.codeSigningMutex.Unlock()
+	store, err := a.getCodeSigningStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading code signing request")
+	}
+	r, err := store.get(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading code signing request")
+	}
+	if r == nil {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "code signing request %s not found", id)
+	}
+	if r.Status != CodeSigningPending {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "code signing request %s is already %s", id, r.Status)
+	}
+	r.Status = status
+	r.UpdatedAt = a.now().UTC().Truncate(time.Second)
+	if err := store.set(r); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing code signing request")
+	}
+	return r, nil
+}
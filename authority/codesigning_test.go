@@ -0,0 +1,165 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func newYubiKeyAttestation(t *testing.T, device *x509.Certificate, deviceKey *ecdsa.PrivateKey, csr *x509.CertificateRequest, serial int, extensions ...pkix.Extension) *keyattest.Statement {
+	b, err := asn1.Marshal(serial)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "YubiKey PIV Attestation 9c"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: append([]pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 7}, Value: b},
+		}, extensions...),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, device, csr.PublicKey, deviceKey)
+	assert.FatalError(t, err)
+	return &keyattest.Statement{
+		Format: keyattest.FormatYubiKey,
+		X5C:    [][]byte{der, device.Raw},
+	}
+}
+
+func newCodeSigningCSR(t *testing.T) *x509.CertificateRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "release signing"},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func assertCodeSigningError(t *testing.T, err error, status int, code string) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("error is nil")
+	}
+	sc, ok := err.(*errs.Error)
+	assert.Fatal(t, ok, "error is not an *errs.Error")
+	assert.Equals(t, status, sc.StatusCode())
+	assert.Equals(t, code, sc.ErrorCode())
+}
+
+func TestAuthority_checkCodeSigning(t *testing.T) {
+	root, rootKey := newAttestationCert(t, "Attestation Root", true, nil, nil)
+	device, deviceKey := newAttestationCert(t, "Yubico PIV Attestation", false, root, rootKey)
+	policy := &AttestationPolicy{
+		Roots:               []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))},
+		DeniedSerialNumbers: []string{"666"},
+	}
+	assert.FatalError(t, policy.Init())
+
+	csr := newCodeSigningCSR(t)
+	leaf := &x509.Certificate{
+		Subject:     csr.Subject,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	serverLeaf := &x509.Certificate{
+		Subject:     csr.Subject,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageServerAuth},
+	}
+	att := newYubiKeyAttestation(t, device, deviceKey, csr, 1234)
+	otherAtt := newYubiKeyAttestation(t, device, deviceKey, newCodeSigningCSR(t), 1234)
+	deniedAtt := newYubiKeyAttestation(t, device, deviceKey, csr, 666)
+
+	p := &provisioner.JWK{Name: "codesigning"}
+	opt := &codeSigningOption{provisioner: p, options: &provisioner.CodeSigningOptions{}}
+	tpmOnly := &codeSigningOption{provisioner: p, options: &provisioner.CodeSigningOptions{
+		AttestationFormats: []string{keyattest.FormatTPM},
+	}}
+
+	a := &Authority{attestationPolicy: policy}
+	assert.FatalError(t, a.checkCodeSigning(nil, csr, serverLeaf, nil))
+	assert.FatalError(t, a.checkCodeSigning(opt, csr, leaf, att))
+
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, serverLeaf, att), http.StatusForbidden, errs.CodeForbidden)
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, &x509.Certificate{IsCA: true, ExtKeyUsage: leaf.ExtKeyUsage}, att), http.StatusForbidden, errs.CodeForbidden)
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, nil), http.StatusForbidden, errs.CodeKeyAttestationRequired)
+	assertCodeSigningError(t, a.checkCodeSigning(tpmOnly, csr, leaf, att), http.StatusForbidden, errs.CodeKeyAttestationRequired)
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, otherAtt), http.StatusForbidden, errs.CodeKeyAttestationRequired)
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, deniedAtt), http.StatusForbidden, errs.CodeKeyAttestationRequired)
+
+	// Without trusted roots
+	assertCodeSigningError(t, (&Authority{}).checkCodeSigning(opt, csr, leaf, att), http.StatusForbidden, errs.CodeKeyAttestationRequired)
+}
+
+func TestAuthority_checkCodeSigningApproval(t *testing.T) {
+	root, rootKey := newAttestationCert(t, "Attestation Root", true, nil, nil)
+	device, deviceKey := newAttestationCert(t, "Yubico PIV Attestation", false, root, rootKey)
+	policy := &AttestationPolicy{
+		Roots: []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))},
+	}
+	assert.FatalError(t, policy.Init())
+
+	csr := newCodeSigningCSR(t)
+	leaf := &x509.Certificate{
+		Subject:     csr.Subject,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	att := newYubiKeyAttestation(t, device, deviceKey, csr, 1234)
+	opt := &codeSigningOption{
+		provisioner: &provisioner.JWK{Name: "codesigning"},
+		options:     &provisioner.CodeSigningOptions{RequireApproval: true},
+	}
+	id, err := codeSigningRequestID(csr.PublicKey)
+	assert.FatalError(t, err)
+
+	a := &Authority{attestationPolicy: policy}
+
+	// First request creates a pending request
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, att), http.StatusForbidden, errs.CodeApprovalRequired)
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, att), http.StatusForbidden, errs.CodeApprovalRequired)
+	requests, err := a.GetCodeSigningRequests()
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, len(requests))
+	assert.Equals(t, id, requests[0].ID)
+	assert.Equals(t, "codesigning", requests[0].Provisioner)
+	assert.Equals(t, "release signing", requests[0].Subject)
+	assert.Equals(t, keyattest.FormatYubiKey, requests[0].AttestationFormat)
+	assert.Equals(t, "1234", requests[0].SerialNumber)
+	assert.Equals(t, CodeSigningPending, requests[0].Status)
+
+	// Approval is valid for one certificate
+	r, err := a.ApproveCodeSigningRequest(id)
+	assert.FatalError(t, err)
+	assert.Equals(t, CodeSigningApproved, r.Status)
+	_, err = a.ApproveCodeSigningRequest(id)
+	assert.NotNil(t, err)
+	assert.FatalError(t, a.checkCodeSigning(opt, csr, leaf, att))
+	assert.FatalError(t, a.consumeCodeSigningApproval(opt, csr))
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, att), http.StatusForbidden, errs.CodeApprovalRequired)
+
+	// Rejected requests
+	r, err = a.RejectCodeSigningRequest(id)
+	assert.FatalError(t, err)
+	assert.Equals(t, CodeSigningRejected, r.Status)
+	assertCodeSigningError(t, a.checkCodeSigning(opt, csr, leaf, att), http.StatusForbidden, errs.CodeForbidden)
+
+	// Unknown requests
+	_, err = a.ApproveCodeSigningRequest("foo")
+	assert.NotNil(t, err)
+	_, err = a.RejectCodeSigningRequest("foo")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"go.step.sm/crypto/pemutil"
+)
+
+// DefaultACMENonceMaxAge is the default maximum age of the stateless ACME
+// nonces.
+var DefaultACMENonceMaxAge = 15 * time.Minute
+
+// ACMEConfig contains the global options of the ACME provisioners.
+type ACMEConfig struct {
+	// Validation configures how the ACME challenges are validated.
+	Validation *ACMEValidationConfig `json:"validation,omitempty"`
+	// Nonces enables the stateless nonces.
+	Nonces *ACMENonceConfig `json:"nonces,omitempty"`
+	// AlternateChains is a list of PEM files with alternate chains offered to
+	// the clients, e.g. using cross-signed intermediates. Each file starts
+	// with the alternate version of the issuer of the certificates, followed
+	// by the rest of the chain. A chain is offered if its first certificate
+	// has the same subject and key as the issuing intermediate.
+	AlternateChains []string `json:"alternateChains,omitempty"`
+	// AccountWebhook sends the creation and deactivation of the accounts to an
+	// external system, which can veto the creation of an account.
+	AccountWebhook *ACMEAccountWebhookConfig `json:"accountWebhook,omitempty"`
+}
+
+// ACMEAccountWebhookConfig configures the webhook called before an ACME
+// account is created and after it's deactivated, e.g. to keep a tenant
+// management system as the source of truth of the accounts.
+type ACMEAccountWebhookConfig struct {
+	// URL is the URL of the webhook, the events are sent with a POST.
+	URL string `json:"url"`
+	// Token is the bearer token used to authenticate with the webhook.
+	Token string `json:"token,omitempty"`
+	// Timeout is the maximum duration of a request, defaults to 5s.
+	Timeout *provisioner.Duration `json:"timeout,omitempty"`
+	// FailOpen allows the creation of the accounts if the webhook cannot be
+	// reached.
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// ACMENonceConfig enables the stateless ACME nonces. The nonces are signed
+// with a key instead of being stored in the database when they are created,
+// and they are only stored when they are used, to prevent their replay.
+type ACMENonceConfig struct {
+	// Key is the base64 encoded key, of at least 32 bytes, used to sign the
+	// nonces. All the replicas of the CA must use the same key. If it is not
+	// set, a random key is generated on startup, and the nonces are only valid
+	// in the replica that creates them.
+	Key string `json:"key,omitempty"`
+	// MaxAge is the maximum age of a nonce. It defaults to 15m.
+	MaxAge *provisioner.Duration `json:"maxAge,omitempty"`
+}
+
+// ACMEValidationConfig contains the options used to validate ACME challenges.
+type ACMEValidationConfig struct {
+	// Egress selects the network used to validate the identifiers matching a
+	// domain suffix. If an identifier matches multiple entries, the longest
+	// suffix is used; if it matches none, the default network is used.
+	Egress []*ACMEEgressConfig `json:"egress,omitempty"`
+	// Timeout is the maximum duration of a validation attempt. It defaults to
+	// 1m.
+	Timeout *provisioner.Duration `json:"timeout,omitempty"`
+	// MaxAttempts is the maximum number of validation attempts of a
+	// challenge, after them the challenge is marked as invalid. The number of
+	// attempts is not limited if it is 0.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// ReuseValidFor is the period a successful validation of an identifier is
+	// cached. During it, the valid authorization is attached to the new orders
+	// of the same account for the identifier, so the client does not need to
+	// solve the challenge again. Validations are not reused if it is not set.
+	ReuseValidFor *provisioner.Duration `json:"reuseValidFor,omitempty"`
+}
+
+// ACMEEgressConfig contains the network options used to validate the
+// challenges of the identifiers matching one of the domain suffixes.
+type ACMEEgressConfig struct {
+	// Domains is the list of domain suffixes, e.g. "dmz.example.com" matches
+	// "dmz.example.com" and any subdomain of it.
+	Domains []string `json:"domains"`
+	// SourceIP is the local address used in the connections and DNS queries.
+	SourceIP string `json:"sourceIP,omitempty"`
+	// Proxy is the URL of the HTTP proxy used in http-01 validations.
+	Proxy string `json:"proxy,omitempty"`
+	// Resolver is the address, host:port, of the DNS server used in dns-01
+	// validations.
+	Resolver string `json:"resolver,omitempty"`
+}
+
+// Validate validates the ACME configuration.
+func (c *ACMEConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Nonces.Validate(); err != nil {
+		return err
+	}
+	if v := c.Validation; v != nil {
+		if v.Timeout != nil && v.Timeout.Duration <= 0 {
+			return errors.New("acme.validation.timeout must be greater than 0")
+		}
+		if v.MaxAttempts < 0 {
+			return errors.New("acme.validation.maxAttempts cannot be negative")
+		}
+		if v.ReuseValidFor != nil && v.ReuseValidFor.Duration <= 0 {
+			return errors.New("acme.validation.reuseValidFor must be greater than 0")
+		}
+	}
+	for _, e := range c.GetEgress() {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, fn := range c.AlternateChains {
+		if fn == "" {
+			return errors.New("acme.alternateChains cannot contain empty values")
+		}
+	}
+	if w := c.AccountWebhook; w != nil {
+		u, err := url.Parse(w.URL)
+		switch {
+		case w.URL == "":
+			return errors.New("acme.accountWebhook.url cannot be empty")
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			return errors.Errorf("acme.accountWebhook.url %s is not valid", w.URL)
+		case w.Timeout != nil && w.Timeout.Duration <= 0:
+			return errors.New("acme.accountWebhook.timeout must be greater than 0")
+		}
+	}
+	return nil
+}
+
+// GetAccountWebhook returns the account webhook configuration, or nil if it
+// is not set.
+func (c *ACMEConfig) GetAccountWebhook() *ACMEAccountWebhookConfig {
+	if c == nil {
+		return nil
+	}
+	return c.AccountWebhook
+}
+
+// GetAlternateChains reads and returns the alternate chains.
+func (c *ACMEConfig) GetAlternateChains() ([][]*x509.Certificate, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var chains [][]*x509.Certificate
+	for _, fn := range c.AlternateChains {
+		chain, err := pemutil.ReadCertificateBundle(fn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading acme.alternateChains %s", fn)
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// GetNonces returns the stateless nonces configuration, or nil if it is not
+// set.
+func (c *ACMEConfig) GetNonces() *ACMENonceConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Nonces
+}
+
+// Validate validates the stateless nonces configuration.
+func (c *ACMENonceConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Key != "" {
+		key, err := base64.StdEncoding.DecodeString(c.Key)
+		if err != nil {
+			return errors.New("acme.nonces.key must be base64 encoded")
+		}
+		if len(key) < 32 {
+			return errors.New("acme.nonces.key must be at least 32 bytes")
+		}
+	}
+	if c.MaxAge != nil && c.MaxAge.Duration <= 0 {
+		return errors.New("acme.nonces.maxAge must be greater than 0")
+	}
+	return nil
+}
+
+// GetKey returns the key used to sign the nonces, or a random key if it is not
+// set.
+func (c *ACMENonceConfig) GetKey() ([]byte, error) {
+	if c.Key != "" {
+		return base64.StdEncoding.DecodeString(c.Key)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "error generating acme nonce key")
+	}
+	return key, nil
+}
+
+// GetMaxAge returns the maximum age of a nonce.
+func (c *ACMENonceConfig) GetMaxAge() time.Duration {
+	if c.MaxAge == nil {
+		return DefaultACMENonceMaxAge
+	}
+	return c.MaxAge.Duration
+}
+
+// GetEgress returns the egress configuration, or nil if it is not set.
+func (c *ACMEConfig) GetEgress() []*ACMEEgressConfig {
+	if c == nil || c.Validation == nil {
+		return nil
+	}
+	return c.Validation.Egress
+}
+
+// GetValidationTimeout returns the maximum duration of a validation attempt,
+// or 0 if it is not set.
+func (c *ACMEConfig) GetValidationTimeout() time.Duration {
+	if c == nil || c.Validation == nil {
+		return 0
+	}
+	return c.Validation.Timeout.Value()
+}
+
+// GetMaxValidationAttempts returns the maximum number of validation attempts
+// of a challenge, or 0 if they are not limited.
+func (c *ACMEConfig) GetMaxValidationAttempts() int {
+	if c == nil || c.Validation == nil {
+		return 0
+	}
+	return c.Validation.MaxAttempts
+}
+
+// GetValidationReuse returns the period a successful validation is reused in
+// new orders, or 0 if validations are not reused.
+func (c *ACMEConfig) GetValidationReuse() time.Duration {
+	if c == nil || c.Validation == nil {
+		return 0
+	}
+	return c.Validation.ReuseValidFor.Value()
+}
+
+// Validate validates the egress configuration.
+func (e *ACMEEgressConfig) Validate() error {
+	switch {
+	case e == nil:
+		return errors.New("acme.validation.egress cannot contain empty values")
+	case len(e.Domains) == 0:
+		return errors.New("acme.validation.egress.domains cannot be empty")
+	case e.SourceIP == "" && e.Proxy == "" && e.Resolver == "":
+		return errors.New("acme.validation.egress requires a sourceIP, proxy or resolver")
+	case e.SourceIP != "" && net.ParseIP(e.SourceIP) == nil:
+		return errors.Errorf("acme.validation.egress.sourceIP '%s' is not a valid IP address", e.SourceIP)
+	}
+	for _, d := range e.Domains {
+		if d = strings.TrimPrefix(d, "."); d == "" || strings.Contains(d, "*") {
+			return errors.Errorf("acme.validation.egress.domains contains an invalid domain '%s'", d)
+		}
+	}
+	if e.Proxy != "" {
+		u, err := url.Parse(e.Proxy)
+		if err != nil || u.Host == "" {
+			return errors.Errorf("acme.validation.egress.proxy '%s' is not a valid URL", e.Proxy)
+		}
+	}
+	if e.Resolver != "" {
+		if _, _, err := net.SplitHostPort(e.Resolver); err != nil {
+			return errors.Errorf("acme.validation.egress.resolver '%s' must be in the form host:port", e.Resolver)
+		}
+	}
+	return nil
+}
+
+// GetSourceIP returns the parsed source IP, or nil if it is not set.
+func (e *ACMEEgressConfig) GetSourceIP() net.IP {
+	return net.ParseIP(e.SourceIP)
+}
+
+// GetProxy returns the parsed proxy URL, or nil if it is not set.
+func (e *ACMEEgressConfig) GetProxy() *url.URL {
+	if e.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(e.Proxy)
+	if err != nil {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestACMEConfig_Validate(t *testing.T) {
+	egress := func(e *ACMEEgressConfig) *ACMEConfig {
+		return &ACMEConfig{Validation: &ACMEValidationConfig{
+			Egress: []*ACMEEgressConfig{e},
+		}}
+	}
+	tests := []struct {
+		name    string
+		config  *ACMEConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &ACMEConfig{}, false},
+		{"ok source ip", egress(&ACMEEgressConfig{Domains: []string{"dmz.example.com"}, SourceIP: "10.0.0.1"}), false},
+		{"ok proxy", egress(&ACMEEgressConfig{Domains: []string{".dmz.example.com"}, Proxy: "http://proxy:3128"}), false},
+		{"ok resolver", egress(&ACMEEgressConfig{Domains: []string{"dmz.example.com"}, Resolver: "10.0.0.53:53"}), false},
+		{"fail nil", egress(nil), true},
+		{"fail domains", egress(&ACMEEgressConfig{SourceIP: "10.0.0.1"}), true},
+		{"fail wildcard", egress(&ACMEEgressConfig{Domains: []string{"*.dmz.example.com"}, SourceIP: "10.0.0.1"}), true},
+		{"fail options", egress(&ACMEEgressConfig{Domains: []string{"dmz.example.com"}}), true},
+		{"fail source ip", egress(&ACMEEgressConfig{Domains: []string{"dmz.example.com"}, SourceIP: "10.0.0"}), true},
+		{"fail proxy", egress(&ACMEEgressConfig{Domains: []string{"dmz.example.com"}, Proxy: "proxy"}), true},
+		{"fail resolver", egress(&ACMEEgressConfig{Domains: []string{"dmz.example.com"}, Resolver: "10.0.0.53"}), true},
+		{"ok nonces", &ACMEConfig{Nonces: &ACMENonceConfig{}}, false},
+		{"ok nonces key", &ACMEConfig{Nonces: &ACMENonceConfig{Key: "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA==", MaxAge: &provisioner.Duration{Duration: time.Minute}}}, false},
+		{"fail nonces key", &ACMEConfig{Nonces: &ACMENonceConfig{Key: "not-base64"}}, true},
+		{"fail nonces key size", &ACMEConfig{Nonces: &ACMENonceConfig{Key: "c2VjcmV0"}}, true},
+		{"fail nonces maxAge", &ACMEConfig{Nonces: &ACMENonceConfig{MaxAge: &provisioner.Duration{}}}, true},
+		{"ok validation", &ACMEConfig{Validation: &ACMEValidationConfig{Timeout: &provisioner.Duration{Duration: time.Minute}, MaxAttempts: 5}}, false},
+		{"fail validation timeout", &ACMEConfig{Validation: &ACMEValidationConfig{Timeout: &provisioner.Duration{}}}, true},
+		{"fail validation maxAttempts", &ACMEConfig{Validation: &ACMEValidationConfig{MaxAttempts: -1}}, true},
+		{"ok validation reuseValidFor", &ACMEConfig{Validation: &ACMEValidationConfig{ReuseValidFor: &provisioner.Duration{Duration: time.Hour}}}, false},
+		{"fail validation reuseValidFor", &ACMEConfig{Validation: &ACMEValidationConfig{ReuseValidFor: &provisioner.Duration{}}}, true},
+		{"ok account webhook", &ACMEConfig{AccountWebhook: &ACMEAccountWebhookConfig{URL: "https://tenants.example.com/acme", Timeout: &provisioner.Duration{Duration: time.Second}}}, false},
+		{"fail account webhook url", &ACMEConfig{AccountWebhook: &ACMEAccountWebhookConfig{}}, true},
+		{"fail account webhook scheme", &ACMEConfig{AccountWebhook: &ACMEAccountWebhookConfig{URL: "tenants.example.com"}}, true},
+		{"fail account webhook timeout", &ACMEConfig{AccountWebhook: &ACMEAccountWebhookConfig{URL: "https://tenants.example.com/acme", Timeout: &provisioner.Duration{}}}, true},
+		{"ok alternateChains", &ACMEConfig{AlternateChains: []string{"cross-signed.crt"}}, false},
+		{"fail alternateChains", &ACMEConfig{AlternateChains: []string{""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ACMEConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACMEConfig_GetAlternateChains(t *testing.T) {
+	chains, err := (*ACMEConfig)(nil).GetAlternateChains()
+	if err != nil || chains != nil {
+		t.Errorf("ACMEConfig.GetAlternateChains() = %v, %v, want nil", chains, err)
+	}
+	c := &ACMEConfig{AlternateChains: []string{"../testdata/certs/intermediate_ca.crt"}}
+	chains, err = c.GetAlternateChains()
+	if err != nil || len(chains) != 1 || len(chains[0]) != 1 {
+		t.Errorf("ACMEConfig.GetAlternateChains() = %v, %v", chains, err)
+	}
+	c = &ACMEConfig{AlternateChains: []string{"../testdata/certs/missing.crt"}}
+	if _, err := c.GetAlternateChains(); err == nil {
+		t.Error("ACMEConfig.GetAlternateChains() error = nil, want an error")
+	}
+}
+
+func TestACMENonceConfig(t *testing.T) {
+	c := &ACMENonceConfig{}
+	k1, err := c.GetKey()
+	if err != nil || len(k1) != 32 {
+		t.Fatalf("ACMENonceConfig.GetKey() = %x, %v", k1, err)
+	}
+	if k2, err := c.GetKey(); err != nil || bytes.Equal(k1, k2) {
+		t.Errorf("ACMENonceConfig.GetKey() = %x, %v, want a random key", k2, err)
+	}
+	if got := c.GetMaxAge(); got != DefaultACMENonceMaxAge {
+		t.Errorf("ACMENonceConfig.GetMaxAge() = %s, want %s", got, DefaultACMENonceMaxAge)
+	}
+
+	c = &ACMENonceConfig{
+		Key:    "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA==",
+		MaxAge: &provisioner.Duration{Duration: time.Minute},
+	}
+	if k, err := c.GetKey(); err != nil || string(k) != "secret-secret-secret-secret-secret" {
+		t.Errorf("ACMENonceConfig.GetKey() = %s, %v", k, err)
+	}
+	if got := c.GetMaxAge(); got != time.Minute {
+		t.Errorf("ACMENonceConfig.GetMaxAge() = %s, want %s", got, time.Minute)
+	}
+}
+
+func TestACMEConfig_GetValidationReuse(t *testing.T) {
+	if got := (*ACMEConfig)(nil).GetValidationReuse(); got != 0 {
+		t.Errorf("ACMEConfig.GetValidationReuse() = %s, want 0", got)
+	}
+	if got := (&ACMEConfig{Validation: &ACMEValidationConfig{}}).GetValidationReuse(); got != 0 {
+		t.Errorf("ACMEConfig.GetValidationReuse() = %s, want 0", got)
+	}
+	c := &ACMEConfig{Validation: &ACMEValidationConfig{ReuseValidFor: &provisioner.Duration{Duration: time.Hour}}}
+	if got := c.GetValidationReuse(); got != time.Hour {
+		t.Errorf("ACMEConfig.GetValidationReuse() = %s, want %s", got, time.Hour)
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// AuditExportConfig enables the audit export jobs of the admin API. An export
+// is a bundle with the certificates issued, the certificates revoked and the
+// provisioner changes made in a period, in CSV format, and a manifest with the
+// hashes of the files. The manifest is signed with a CAdES detached signature
+// using the configured certificate, and the signature is time-stamped if the
+// time-stamp authority is configured.
+type AuditExportConfig struct {
+	// Certificate is the path to the signing certificate, optionally followed
+	// by its intermediates.
+	Certificate string `json:"crt"`
+	// Key is the path or the KMS uri of the key of the certificate.
+	Key string `json:"key"`
+}
+
+// Validate validates the audit export configuration.
+func (c *AuditExportConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Certificate == "":
+		return errors.New("auditExport.crt cannot be empty")
+	case c.Key == "":
+		return errors.New("auditExport.key cannot be empty")
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestAuditExportConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *AuditExportConfig
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &AuditExportConfig{Certificate: "audit.crt", Key: "audit.key"}, false},
+		{"ok kms", &AuditExportConfig{Certificate: "audit.crt", Key: "pkcs11:id=7331"}, false},
+		{"fail crt", &AuditExportConfig{Key: "audit.key"}, true},
+		{"fail key", &AuditExportConfig{Certificate: "audit.crt"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("AuditExportConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPwnedkeysURL is the default url of the pwnedkeys.com API.
+const DefaultPwnedkeysURL = "https://v1.pwnedkeys.com"
+
+// BlockedKeysConfig contains the list of compromised public keys that cannot
+// be used in a certificate.
+//
+// Keys are identified by the hex encoded SHA-256 fingerprint of the subject
+// public key info, or, for RSA keys, by the fingerprints used in the Debian
+// openssl-blacklist files: the last 20 hex characters of the SHA-1 of the
+// "Modulus=<HEX>\n" line.
+type BlockedKeysConfig struct {
+	// Fingerprints is a list of blocked key fingerprints.
+	Fingerprints []string `json:"fingerprints,omitempty"`
+	// Files is a list of files with one fingerprint per line, empty lines and
+	// lines starting with # are ignored.
+	Files []string `json:"files,omitempty"`
+	// Pwnedkeys enables the lookup of the keys in pwnedkeys.com.
+	Pwnedkeys bool `json:"pwnedkeys,omitempty"`
+	// PwnedkeysURL allows to use a mirror of the pwnedkeys.com API.
+	PwnedkeysURL string `json:"pwnedkeysURL,omitempty"`
+	// PwnedkeysFailOpen allows the keys if pwnedkeys.com cannot be queried or
+	// returns an invalid response. By default these requests fail.
+	PwnedkeysFailOpen bool `json:"pwnedkeysFailOpen,omitempty"`
+}
+
+// Validate validates the blocked keys configuration.
+func (c *BlockedKeysConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, fp := range c.Fingerprints {
+		if !IsValidKeyFingerprint(fp) {
+			return errors.Errorf("blockedKeys.fingerprints contains an invalid fingerprint '%s'", fp)
+		}
+	}
+	for _, fn := range c.Files {
+		if fn == "" {
+			return errors.New("blockedKeys.files cannot contain empty values")
+		}
+	}
+	if !c.Pwnedkeys && (c.PwnedkeysURL != "" || c.PwnedkeysFailOpen) {
+		return errors.New("blockedKeys.pwnedkeysURL and blockedKeys.pwnedkeysFailOpen require blockedKeys.pwnedkeys")
+	}
+	if c.PwnedkeysURL != "" {
+		if u, err := url.Parse(c.PwnedkeysURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("blockedKeys.pwnedkeysURL '%s' is not a valid URL", c.PwnedkeysURL)
+		}
+	}
+	return nil
+}
+
+// GetPwnedkeysURL returns the url of the pwnedkeys.com API.
+func (c *BlockedKeysConfig) GetPwnedkeysURL() string {
+	if c.PwnedkeysURL == "" {
+		return DefaultPwnedkeysURL
+	}
+	return strings.TrimSuffix(c.PwnedkeysURL, "/")
+}
+
+// IsValidKeyFingerprint returns true if the given value is a hex encoded
+// SHA-256 fingerprint or a Debian openssl-blacklist fingerprint.
+func IsValidKeyFingerprint(fp string) bool {
+	if len(fp) != 64 && len(fp) != 20 {
+		return false
+	}
+	_, err := hex.DecodeString(fp)
+	return err == nil
+}
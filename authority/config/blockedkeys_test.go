@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlockedKeysConfig_Validate(t *testing.T) {
+	sha256Fingerprint := strings.Repeat("ab", 32)
+	debianFingerprint := strings.Repeat("0f", 10)
+	tests := []struct {
+		name    string
+		config  *BlockedKeysConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &BlockedKeysConfig{}, false},
+		{"ok", &BlockedKeysConfig{Fingerprints: []string{sha256Fingerprint, debianFingerprint}, Files: []string{"blocklist"}}, false},
+		{"ok pwnedkeys", &BlockedKeysConfig{Pwnedkeys: true, PwnedkeysURL: "https://pwnedkeys.internal"}, false},
+		{"fail fingerprint", &BlockedKeysConfig{Fingerprints: []string{"abcd"}}, true},
+		{"fail fingerprint hex", &BlockedKeysConfig{Fingerprints: []string{strings.Repeat("zz", 32)}}, true},
+		{"fail files", &BlockedKeysConfig{Files: []string{""}}, true},
+		{"ok pwnedkeys fail open", &BlockedKeysConfig{Pwnedkeys: true, PwnedkeysFailOpen: true}, false},
+		{"fail pwnedkeys url", &BlockedKeysConfig{Pwnedkeys: true, PwnedkeysURL: "pwnedkeys"}, true},
+		{"fail pwnedkeys url disabled", &BlockedKeysConfig{PwnedkeysURL: "https://pwnedkeys.internal"}, true},
+		{"fail pwnedkeys fail open disabled", &BlockedKeysConfig{PwnedkeysFailOpen: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("BlockedKeysConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
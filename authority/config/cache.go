@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultResponseCacheMaxAge is the default time the responses are cached.
+var DefaultResponseCacheMaxAge = 5 * time.Minute
+
+// ResponseCacheConfig configures the in-memory cache of the responses of the
+// endpoints that rarely change: the roots, the federated roots and the ACME
+// directories. Cached responses include an ETag, and clients sending it in the
+// If-None-Match header get a 304 Not Modified response.
+type ResponseCacheConfig struct {
+	// MaxAge is the time a response is cached and the max-age sent in the
+	// Cache-Control header. It defaults to 5 minutes.
+	MaxAge *provisioner.Duration `json:"maxAge,omitempty"`
+}
+
+// Validate validates the response cache configuration.
+func (c *ResponseCacheConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxAge != nil && c.MaxAge.Duration <= 0:
+		return errors.New("responseCache.maxAge must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// GetMaxAge returns the time a response is cached.
+func (c *ResponseCacheConfig) GetMaxAge() time.Duration {
+	if c == nil || c.MaxAge == nil {
+		return DefaultResponseCacheMaxAge
+	}
+	return c.MaxAge.Duration
+}
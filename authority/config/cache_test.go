@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestResponseCacheConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *ResponseCacheConfig
+		wantMaxAge time.Duration
+		wantErr    bool
+	}{
+		{"nil", nil, DefaultResponseCacheMaxAge, false},
+		{"default", &ResponseCacheConfig{}, DefaultResponseCacheMaxAge, false},
+		{"ok", &ResponseCacheConfig{MaxAge: &provisioner.Duration{Duration: time.Hour}}, time.Hour, false},
+		{"fail zero", &ResponseCacheConfig{MaxAge: &provisioner.Duration{}}, 0, true},
+		{"fail negative", &ResponseCacheConfig{MaxAge: &provisioner.Duration{Duration: -time.Minute}}, -time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ResponseCacheConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tt.config.GetMaxAge(); got != tt.wantMaxAge {
+				t.Errorf("ResponseCacheConfig.GetMaxAge() = %v, want %v", got, tt.wantMaxAge)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// CircuitBreakerConfig enables the circuit breakers in the calls to the
+// external dependencies of the CA: the OIDC, Azure and GCP identity providers,
+// the OPA policy server, the ACME account webhook, and the upstream CA or the
+// key manager of the intermediate key. After a number of consecutive failures
+// of a dependency its breaker opens, and the calls to it fail right away until
+// the open timeout passes, so a slow dependency does not stall every request.
+// While a breaker is open, the provisioners use the cached keys of the
+// identity provider, the OPA policy and the account webhook allow or deny the
+// requests depending on their failOpen attribute, and the sign requests get a
+// 503 Service Unavailable response.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens a
+	// breaker. It defaults to 5.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenTimeout is the time a breaker stays open before a call is allowed to
+	// probe the dependency. It defaults to 30s.
+	OpenTimeout *provisioner.Duration `json:"openTimeout,omitempty"`
+}
+
+// Validate validates the circuit breaker configuration.
+func (c *CircuitBreakerConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.FailureThreshold < 0:
+		return errors.New("circuitBreaker.failureThreshold cannot be negative")
+	case c.OpenTimeout != nil && c.OpenTimeout.Duration <= 0:
+		return errors.New("circuitBreaker.openTimeout must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// GetSettings returns the settings of the breakers, or nil if they are not
+// enabled.
+func (c *CircuitBreakerConfig) GetSettings() *breaker.Settings {
+	if c == nil {
+		return nil
+	}
+	s := &breaker.Settings{
+		FailureThreshold: c.FailureThreshold,
+	}
+	if c.OpenTimeout != nil {
+		s.OpenTimeout = c.OpenTimeout.Duration
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestCircuitBreakerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *CircuitBreakerConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &CircuitBreakerConfig{}, false},
+		{"ok", &CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: &provisioner.Duration{Duration: time.Minute}}, false},
+		{"fail failureThreshold", &CircuitBreakerConfig{FailureThreshold: -1}, true},
+		{"fail openTimeout", &CircuitBreakerConfig{OpenTimeout: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CircuitBreakerConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerConfig_GetSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *CircuitBreakerConfig
+		want   *breaker.Settings
+	}{
+		{"nil", nil, nil},
+		{"empty", &CircuitBreakerConfig{}, &breaker.Settings{}},
+		{"ok", &CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: &provisioner.Duration{Duration: time.Minute}}, &breaker.Settings{FailureThreshold: 3, OpenTimeout: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetSettings(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CircuitBreakerConfig.GetSettings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
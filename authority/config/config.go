@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"time"
@@ -48,22 +49,45 @@ var (
 
 // Config represents the CA configuration and it's mapped to a JSON object.
 type Config struct {
-	Root             multiString          `json:"root"`
-	FederatedRoots   []string             `json:"federatedRoots"`
-	IntermediateCert string               `json:"crt"`
-	IntermediateKey  string               `json:"key"`
-	Address          string               `json:"address"`
-	InsecureAddress  string               `json:"insecureAddress"`
-	DNSNames         []string             `json:"dnsNames"`
-	KMS              *kms.Options         `json:"kms,omitempty"`
-	SSH              *SSHConfig           `json:"ssh,omitempty"`
-	Logger           json.RawMessage      `json:"logger,omitempty"`
-	DB               *db.Config           `json:"db,omitempty"`
-	Monitoring       json.RawMessage      `json:"monitoring,omitempty"`
-	AuthorityConfig  *AuthConfig          `json:"authority,omitempty"`
-	TLS              *TLSOptions          `json:"tls,omitempty"`
-	Password         string               `json:"password,omitempty"`
-	Templates        *templates.Templates `json:"templates,omitempty"`
+	Version            int                        `json:"version,omitempty"`
+	Root               multiString                `json:"root"`
+	FederatedRoots     []string                   `json:"federatedRoots"`
+	IntermediateCert   string                     `json:"crt"`
+	IntermediateKey    string                     `json:"key"`
+	Address            string                     `json:"address"`
+	InsecureAddress    string                     `json:"insecureAddress"`
+	DNSNames           []string                   `json:"dnsNames"`
+	KMS                *kms.Options               `json:"kms,omitempty"`
+	SSH                *SSHConfig                 `json:"ssh,omitempty"`
+	Logger             json.RawMessage            `json:"logger,omitempty"`
+	DB                 *db.Config                 `json:"db,omitempty"`
+	Monitoring         json.RawMessage            `json:"monitoring,omitempty"`
+	AuthorityConfig    *AuthConfig                `json:"authority,omitempty"`
+	TLS                *TLSOptions                `json:"tls,omitempty"`
+	Password           string                     `json:"password,omitempty"`
+	Templates          *templates.Templates       `json:"templates,omitempty"`
+	SDS                *SDSConfig                 `json:"sds,omitempty"`
+	Messages           *MessagesConfig            `json:"messages,omitempty"`
+	TSA                *TSAConfig                 `json:"tsa,omitempty"`
+	RADIUS             *RADIUSConfig              `json:"radius,omitempty"`
+	Publisher          *PublisherConfig           `json:"publisher,omitempty"`
+	CRL                *CRLConfig                 `json:"crl,omitempty"`
+	RootRollover       *RootRolloverConfig        `json:"rootRollover,omitempty"`
+	Headers            *HeadersConfig             `json:"headers,omitempty"`
+	Listeners          []*ListenerConfig          `json:"listeners,omitempty"`
+	GRPC               *GRPCConfig                `json:"grpc,omitempty"`
+	ResponseCache      *ResponseCacheConfig       `json:"responseCache,omitempty"`
+	Timeouts           *TimeoutsConfig            `json:"timeouts,omitempty"`
+	SignQueue          *SignQueueConfig           `json:"signQueue,omitempty"`
+	Startup            *StartupConfig             `json:"startup,omitempty"`
+	RequestLimits      *RequestLimitsConfig       `json:"requestLimits,omitempty"`
+	LeaderElection     *LeaderElectionConfig      `json:"leaderElection,omitempty"`
+	CircuitBreaker     *CircuitBreakerConfig      `json:"circuitBreaker,omitempty"`
+	DegradedMode       *DegradedModeConfig        `json:"degradedMode,omitempty"`
+	WriteBehind        *WriteBehindConfig         `json:"writeBehind,omitempty"`
+	DNSCache           *DNSCacheConfig            `json:"dnsCache,omitempty"`
+	ServerCertificates []*ServerCertificateConfig `json:"serverCertificates,omitempty"`
+	AuditExport        *AuditExportConfig         `json:"auditExport,omitempty"`
 }
 
 // ASN1DN contains ASN1.DN attributes that are used in Subject and Issuer
@@ -84,15 +108,30 @@ type ASN1DN struct {
 // cas.Options.
 type AuthConfig struct {
 	*cas.Options
-	AuthorityID          string                `json:"authorityId,omitempty"`
-	DeploymentType       string                `json:"deploymentType,omitempty"`
-	Provisioners         provisioner.List      `json:"provisioners,omitempty"`
-	Admins               []*linkedca.Admin     `json:"-"`
-	Template             *ASN1DN               `json:"template,omitempty"`
-	Claims               *provisioner.Claims   `json:"claims,omitempty"`
-	DisableIssuedAtCheck bool                  `json:"disableIssuedAtCheck,omitempty"`
-	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
-	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
+	AuthorityID          string                  `json:"authorityId,omitempty"`
+	DeploymentType       string                  `json:"deploymentType,omitempty"`
+	Provisioners         provisioner.List        `json:"provisioners,omitempty"`
+	Admins               []*linkedca.Admin       `json:"-"`
+	Template             *ASN1DN                 `json:"template,omitempty"`
+	Claims               *provisioner.Claims     `json:"claims,omitempty"`
+	DisableIssuedAtCheck bool                    `json:"disableIssuedAtCheck,omitempty"`
+	Backdate             *provisioner.Duration   `json:"backdate,omitempty"`
+	EnableAdmin          bool                    `json:"enableAdmin,omitempty"`
+	OnDemand             *OnDemandConfig         `json:"onDemand,omitempty"`
+	SCEP                 *SCEPConfig             `json:"scep,omitempty"`
+	ACME                 *ACMEConfig             `json:"acme,omitempty"`
+	TOFU                 *TOFUConfig             `json:"tofu,omitempty"`
+	PIV                  *PIVConfig              `json:"piv,omitempty"`
+	Quotas               *QuotaConfig            `json:"quotas,omitempty"`
+	Duplicates           *DuplicatesConfig       `json:"duplicates,omitempty"`
+	BlockedKeys          *BlockedKeysConfig      `json:"blockedKeys,omitempty"`
+	WASMPolicy           *WASMPolicyConfig       `json:"wasmPolicy,omitempty"`
+	OPAPolicy            *OPAPolicyConfig        `json:"opaPolicy,omitempty"`
+	Renewal              *RenewalConfig          `json:"renewal,omitempty"`
+	DualControl          *DualControlConfig      `json:"dualControl,omitempty"`
+	WebAuthn             *WebAuthnConfig         `json:"webauthn,omitempty"`
+	Labels               *LabelsConfig           `json:"labels,omitempty"`
+	ProvisionerUsage     *ProvisionerUsageConfig `json:"provisionerUsage,omitempty"`
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -135,26 +174,107 @@ func (c *AuthConfig) Validate(audiences provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	// Validate on-demand options, nil is ok.
+	if err := c.OnDemand.Validate(); err != nil {
+		return err
+	}
+
+	// Validate SCEP options, nil is ok.
+	if err := c.SCEP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ACME options, nil is ok.
+	if err := c.ACME.Validate(); err != nil {
+		return err
+	}
+
+	// Validate trust on first use options, nil is ok.
+	if err := c.TOFU.Validate(); err != nil {
+		return err
+	}
+
+	// Validate PIV enrollment options, nil is ok.
+	if err := c.PIV.Validate(); err != nil {
+		return err
+	}
+
+	// Validate quotas, nil is ok.
+	if err := c.Quotas.Validate(); err != nil {
+		return err
+	}
+
+	// Validate duplicate detection, nil is ok.
+	if err := c.Duplicates.Validate(); err != nil {
+		return err
+	}
+
+	// Validate certificate labels, nil is ok.
+	if err := c.Labels.Validate(); err != nil {
+		return err
+	}
+
+	// Validate blocked keys, nil is ok.
+	if err := c.BlockedKeys.Validate(); err != nil {
+		return err
+	}
+
+	// Validate WebAssembly policy, nil is ok.
+	if err := c.WASMPolicy.Validate(); err != nil {
+		return err
+	}
+
+	// Validate Open Policy Agent policy, nil is ok.
+	if err := c.OPAPolicy.Validate(); err != nil {
+		return err
+	}
+
+	// Validate renewal policy, nil is ok.
+	if err := c.Renewal.Validate(); err != nil {
+		return err
+	}
+
+	// Validate dual control, nil is ok.
+	if err := c.DualControl.Validate(); err != nil {
+		return err
+	}
+
+	// Validate WebAuthn step-up, nil is ok.
+	if err := c.WebAuthn.Validate(); err != nil {
+		return err
+	}
+
+	// Validate provisioner usage tracking, nil is ok.
+	if err := c.ProvisionerUsage.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // LoadConfiguration parses the given filename in JSON format and returns the
-// configuration struct.
-func LoadConfiguration(filename string) (*Config, error) {
-	f, err := os.Open(filename)
+// configuration struct. Configurations without a version use the original
+// format, configurations with version 2 or later are parsed strictly and
+// unknown fields or provisioner types are rejected. The given overrides are
+// applied in order to the contents of the file before parsing it.
+func LoadConfiguration(filename string, overrides ...*Override) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error opening %s", filename)
 	}
-	defer f.Close()
 
-	var c Config
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
+	if b, err = ApplyOverrides(b, overrides); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+
+	c, err := parseConfiguration(b)
+	if err != nil {
 		return nil, errors.Wrapf(err, "error parsing %s", filename)
 	}
 
 	c.Init()
 
-	return &c, nil
+	return c, nil
 }
 
 // Init initializes the minimal configuration required to create an authority. This
@@ -233,6 +353,11 @@ func (c *Config) Validate() error {
 		c.TLS.Renegotiation = c.TLS.Renegotiation || DefaultTLSOptions.Renegotiation
 	}
 
+	// Validate the version and the deprecated fields.
+	if err := c.validateVersion(); err != nil {
+		return err
+	}
+
 	// Validate KMS options, nil is ok.
 	if err := c.KMS.Validate(); err != nil {
 		return err
@@ -253,6 +378,120 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate sds: nil is ok
+	if err := c.SDS.Validate(); err != nil {
+		return err
+	}
+
+	// Validate messages: nil is ok
+	if err := c.Messages.Validate(); err != nil {
+		return err
+	}
+
+	// Validate tsa: nil is ok
+	if err := c.TSA.Validate(); err != nil {
+		return err
+	}
+
+	// Validate audit export: nil is ok
+	if err := c.AuditExport.Validate(); err != nil {
+		return err
+	}
+
+	// Validate radius: nil is ok
+	if err := c.RADIUS.Validate(); err != nil {
+		return err
+	}
+
+	// Validate publisher: nil is ok
+	if err := c.Publisher.Validate(); err != nil {
+		return err
+	}
+
+	// Validate crl: nil is ok
+	if err := c.CRL.Validate(); err != nil {
+		return err
+	}
+
+	// Validate root rollover: nil is ok
+	if err := c.RootRollover.Validate(); err != nil {
+		return err
+	}
+
+	// Validate headers: nil is ok
+	if err := c.Headers.Validate(); err != nil {
+		return err
+	}
+
+	// Validate timeouts: nil is ok
+	if err := c.Timeouts.Validate(); err != nil {
+		return err
+	}
+
+	// Validate sign queue: nil is ok
+	if err := c.SignQueue.Validate(); err != nil {
+		return err
+	}
+
+	// Validate request limits: nil is ok
+	if err := c.RequestLimits.Validate(); err != nil {
+		return err
+	}
+
+	// Validate leader election: nil is ok
+	if err := c.LeaderElection.Validate(); err != nil {
+		return err
+	}
+
+	// Validate circuit breakers: nil is ok
+	if err := c.CircuitBreaker.Validate(); err != nil {
+		return err
+	}
+
+	// Validate degraded mode: nil is ok
+	if err := c.DegradedMode.Validate(); err != nil {
+		return err
+	}
+
+	// Validate write-behind spool: nil is ok
+	if err := c.WriteBehind.Validate(); err != nil {
+		return err
+	}
+
+	// Validate DNS cache: nil is ok
+	if err := c.DNSCache.Validate(); err != nil {
+		return err
+	}
+
+	// Validate response cache: nil is ok
+	if err := c.ResponseCache.Validate(); err != nil {
+		return err
+	}
+
+	// Validate grpc: nil is ok
+	if err := c.GRPC.Validate(); err != nil {
+		return err
+	}
+	if c.GRPC != nil && (c.GRPC.Address == c.Address || c.GRPC.Address == c.InsecureAddress) {
+		return errors.Errorf("grpc.address '%s' is already in use", c.GRPC.Address)
+	}
+
+	// Validate listeners: empty is ok
+	addresses := []string{c.Address, c.InsecureAddress}
+	if c.GRPC != nil {
+		addresses = append(addresses, c.GRPC.Address)
+	}
+	if err := validateListeners(c.Listeners, addresses...); err != nil {
+		return err
+	}
+
+	// Validate server certificates: empty is ok
+	for _, sc := range c.ServerCertificates {
+		if err := sc.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
@@ -263,6 +502,7 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 	audiences := provisioner.Audiences{
 		Sign:      []string{legacyAuthority},
 		Revoke:    []string{legacyAuthority},
+		Renew:     []string{},
 		SSHSign:   []string{},
 		SSHRevoke: []string{},
 		SSHRenew:  []string{},
@@ -277,6 +517,9 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 		audiences.Revoke = append(audiences.Revoke,
 			fmt.Sprintf("https://%s/1.0/revoke", name),
 			fmt.Sprintf("https://%s/revoke", name))
+		audiences.Renew = append(audiences.Renew,
+			fmt.Sprintf("https://%s/1.0/renew", name),
+			fmt.Sprintf("https://%s/renew", name))
 		audiences.SSHSign = append(audiences.SSHSign,
 			fmt.Sprintf("https://%s/1.0/ssh/sign", name),
 			fmt.Sprintf("https://%s/ssh/sign", name),
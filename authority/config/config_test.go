@@ -197,6 +197,41 @@ func TestConfigValidate(t *testing.T) {
 				err: errors.New("tls minVersion cannot exceed tls maxVersion"),
 			}
 		},
+		"unsupported-version": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Version:          3,
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("version 3 is not supported"),
+			}
+		},
+		"deprecated-tls-values": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Version:          ConfigVersion2,
+					Address:          "127.0.0.1:443",
+					Root:             []string{"../testdata/secrets/root_ca.crt"},
+					IntermediateCert: "../testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "../testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+					TLS: &TLSOptions{
+						CipherSuites: CipherSuites{
+							"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+						},
+					},
+				},
+				err: errors.New("tls cipher suite TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305 is not supported in version 2, use TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 instead"),
+			}
+		},
 	}
 
 	for name, get := range tests {
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// DefaultCRLSignInterval is the default time between the signatures of
+	// the CRL served by the CA.
+	DefaultCRLSignInterval = time.Hour
+	// DefaultCRLExpiry is the default time until the next update of the CRL
+	// served by the CA.
+	DefaultCRLExpiry = 24 * time.Hour
+)
+
+// CRLConfig configures the certificate revocation list (CRL) of the
+// intermediate served in /crl. The CRL is signed with the revoked
+// certificates in the database periodically and when a certificate is
+// revoked.
+type CRLConfig struct {
+	// SignInterval is the time between the signatures of the CRL, it
+	// defaults to one hour.
+	SignInterval *provisioner.Duration `json:"signInterval,omitempty"`
+	// Expiry is the time until the next update of the CRL, it defaults to 24
+	// hours, and it must be greater than the sign interval.
+	Expiry *provisioner.Duration `json:"expiry,omitempty"`
+	// CDPURL is the CRL distribution point added to the certificates issued
+	// without one, e.g. https://ca.example.com/crl.
+	CDPURL string `json:"cdpURL,omitempty"`
+}
+
+// Validate validates the CRL configuration.
+func (c *CRLConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.SignInterval != nil && c.SignInterval.Duration < time.Minute:
+		return errors.New("crl.signInterval must be at least one minute")
+	case c.Expiry != nil && c.Expiry.Duration < time.Minute:
+		return errors.New("crl.expiry must be at least one minute")
+	case c.GetExpiry() <= c.GetSignInterval():
+		return errors.New("crl.expiry must be greater than crl.signInterval")
+	}
+	if c.CDPURL != "" {
+		u, err := url.Parse(c.CDPURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("crl.cdpURL %s is not a valid http or https URL", c.CDPURL)
+		}
+	}
+	return nil
+}
+
+// GetSignInterval returns the time between the signatures of the CRL.
+func (c *CRLConfig) GetSignInterval() time.Duration {
+	if c == nil || c.SignInterval == nil {
+		return DefaultCRLSignInterval
+	}
+	return c.SignInterval.Duration
+}
+
+// GetExpiry returns the time until the next update of the CRL.
+func (c *CRLConfig) GetExpiry() time.Duration {
+	if c == nil || c.Expiry == nil {
+		return DefaultCRLExpiry
+	}
+	return c.Expiry.Duration
+}
+
+// GetCDPURL returns the CRL distribution point added to the certificates, or
+// an empty string if it is not configured.
+func (c *CRLConfig) GetCDPURL() string {
+	if c == nil {
+		return ""
+	}
+	return c.CDPURL
+}
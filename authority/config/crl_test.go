@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestCRLConfig_Validate(t *testing.T) {
+	duration := func(d time.Duration) *provisioner.Duration {
+		return &provisioner.Duration{Duration: d}
+	}
+	tests := []struct {
+		name    string
+		config  *CRLConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &CRLConfig{}, false},
+		{"ok", &CRLConfig{SignInterval: duration(10 * time.Minute), Expiry: duration(time.Hour), CDPURL: "https://ca.example.com/crl"}, false},
+		{"ok http", &CRLConfig{CDPURL: "http://crl.example.com/intermediate_ca.crl"}, false},
+		{"fail sign interval", &CRLConfig{SignInterval: duration(time.Second)}, true},
+		{"fail expiry", &CRLConfig{Expiry: duration(time.Second)}, true},
+		{"fail expiry before interval", &CRLConfig{SignInterval: duration(2 * time.Hour), Expiry: duration(time.Hour)}, true},
+		{"fail expiry default interval", &CRLConfig{Expiry: duration(time.Hour)}, true},
+		{"fail cdp scheme", &CRLConfig{CDPURL: "ldap://ca.example.com/crl"}, true},
+		{"fail cdp relative", &CRLConfig{CDPURL: "/crl"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CRLConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCRLConfig_getters(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           *CRLConfig
+		wantSignInterval time.Duration
+		wantExpiry       time.Duration
+		wantCDPURL       string
+	}{
+		{"nil", nil, DefaultCRLSignInterval, DefaultCRLExpiry, ""},
+		{"default", &CRLConfig{}, DefaultCRLSignInterval, DefaultCRLExpiry, ""},
+		{"ok", &CRLConfig{
+			SignInterval: &provisioner.Duration{Duration: time.Minute},
+			Expiry:       &provisioner.Duration{Duration: time.Hour},
+			CDPURL:       "https://ca.example.com/crl",
+		}, time.Minute, time.Hour, "https://ca.example.com/crl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetSignInterval(); got != tt.wantSignInterval {
+				t.Errorf("CRLConfig.GetSignInterval() = %v, want %v", got, tt.wantSignInterval)
+			}
+			if got := tt.config.GetExpiry(); got != tt.wantExpiry {
+				t.Errorf("CRLConfig.GetExpiry() = %v, want %v", got, tt.wantExpiry)
+			}
+			if got := tt.config.GetCDPURL(); got != tt.wantCDPURL {
+				t.Errorf("CRLConfig.GetCDPURL() = %v, want %v", got, tt.wantCDPURL)
+			}
+		})
+	}
+}
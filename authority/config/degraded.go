@@ -0,0 +1,103 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultDegradedRetryInterval is the default interval between the attempts
+// to write the queued renewals to the database.
+var DefaultDegradedRetryInterval = 30 * time.Second
+
+// DefaultRevocationSnapshotInterval is the default interval between the
+// snapshots of the revoked serials used while the database is unavailable.
+var DefaultRevocationSnapshotInterval = 5 * time.Minute
+
+// DefaultMaxQueuedRenewals is the default maximum number of renewed
+// certificates queued while the database is unavailable.
+var DefaultMaxQueuedRenewals = 10000
+
+// DegradedModeConfig enables a degraded mode while the database is
+// unavailable. After a number of consecutive failures of the database, the
+// renewals using mTLS still succeed, checking the revocation against a
+// snapshot of the revoked serials and queuing the renewed certificates until they can be written to the database,
+// while the sign requests of new certificates get a 503 Service Unavailable
+// response. Without a snapshot, the renewals get a 503 Service Unavailable
+// response too. This way a database outage does not take down every service whose
+// certificate expires during it.
+type DegradedModeConfig struct {
+	// FailureThreshold is the number of consecutive failures of the database
+	// that starts the degraded mode. It defaults to 5.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// RetryInterval is the interval between the attempts to write the queued
+	// renewals, and the time before a new certificate can be issued again. It
+	// defaults to 30s.
+	RetryInterval *provisioner.Duration `json:"retryInterval,omitempty"`
+	// MaxQueuedRenewals is the maximum number of renewed certificates queued
+	// in memory. Once it's reached, the renewals fail too. It defaults to
+	// 10000.
+	MaxQueuedRenewals int `json:"maxQueuedRenewals,omitempty"`
+	// RevocationSnapshotInterval is the interval between the snapshots of the
+	// revoked serials checked by the renewals while the database is
+	// unavailable. It defaults to 5m.
+	RevocationSnapshotInterval *provisioner.Duration `json:"revocationSnapshotInterval,omitempty"`
+}
+
+// Validate validates the degraded mode configuration.
+func (c *DegradedModeConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.FailureThreshold < 0:
+		return errors.New("degradedMode.failureThreshold cannot be negative")
+	case c.RetryInterval != nil && c.RetryInterval.Duration <= 0:
+		return errors.New("degradedMode.retryInterval must be greater than 0")
+	case c.MaxQueuedRenewals < 0:
+		return errors.New("degradedMode.maxQueuedRenewals cannot be negative")
+	case c.RevocationSnapshotInterval != nil && c.RevocationSnapshotInterval.Duration <= 0:
+		return errors.New("degradedMode.revocationSnapshotInterval must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// GetRetryInterval returns the interval between the attempts to write the
+// queued renewals.
+func (c *DegradedModeConfig) GetRetryInterval() time.Duration {
+	if c == nil || c.RetryInterval == nil {
+		return DefaultDegradedRetryInterval
+	}
+	return c.RetryInterval.Duration
+}
+
+// GetRevocationSnapshotInterval returns the interval between the snapshots of
+// the revoked serials.
+func (c *DegradedModeConfig) GetRevocationSnapshotInterval() time.Duration {
+	if c == nil || c.RevocationSnapshotInterval == nil {
+		return DefaultRevocationSnapshotInterval
+	}
+	return c.RevocationSnapshotInterval.Duration
+}
+
+// GetMaxQueuedRenewals returns the maximum number of queued renewals.
+func (c *DegradedModeConfig) GetMaxQueuedRenewals() int {
+	if c == nil || c.MaxQueuedRenewals == 0 {
+		return DefaultMaxQueuedRenewals
+	}
+	return c.MaxQueuedRenewals
+}
+
+// GetSettings returns the settings of the breaker that tracks the
+// availability of the database, or nil if the degraded mode is not enabled.
+func (c *DegradedModeConfig) GetSettings() *breaker.Settings {
+	if c == nil {
+		return nil
+	}
+	return &breaker.Settings{
+		FailureThreshold: c.FailureThreshold,
+		OpenTimeout:      c.GetRetryInterval(),
+	}
+}
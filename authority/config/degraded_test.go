@@ -0,0 +1,56 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestDegradedModeConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DegradedModeConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &DegradedModeConfig{}, false},
+		{"ok", &DegradedModeConfig{FailureThreshold: 3, RetryInterval: &provisioner.Duration{Duration: time.Minute}, MaxQueuedRenewals: 100}, false},
+		{"fail failureThreshold", &DegradedModeConfig{FailureThreshold: -1}, true},
+		{"fail retryInterval", &DegradedModeConfig{RetryInterval: &provisioner.Duration{}}, true},
+		{"fail maxQueuedRenewals", &DegradedModeConfig{MaxQueuedRenewals: -1}, true},
+		{"fail revocationSnapshotInterval", &DegradedModeConfig{RevocationSnapshotInterval: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("DegradedModeConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDegradedModeConfig_GetSettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *DegradedModeConfig
+		want          *breaker.Settings
+		wantMaxQueued int
+	}{
+		{"nil", nil, nil, DefaultMaxQueuedRenewals},
+		{"empty", &DegradedModeConfig{}, &breaker.Settings{OpenTimeout: DefaultDegradedRetryInterval}, DefaultMaxQueuedRenewals},
+		{"ok", &DegradedModeConfig{FailureThreshold: 3, RetryInterval: &provisioner.Duration{Duration: time.Minute}, MaxQueuedRenewals: 100}, &breaker.Settings{FailureThreshold: 3, OpenTimeout: time.Minute}, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetSettings(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DegradedModeConfig.GetSettings() = %v, want %v", got, tt.want)
+			}
+			if got := tt.config.GetMaxQueuedRenewals(); got != tt.wantMaxQueued {
+				t.Errorf("DegradedModeConfig.GetMaxQueuedRenewals() = %v, want %v", got, tt.wantMaxQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/resolver"
+)
+
+// DNSCacheConfig enables the caching resolver used in the ACME validations and
+// in the calls to the OPA policy server. Each lookup has a timeout, concurrent
+// lookups of the same name are done once, and the addresses are cached, so a
+// slow or failing DNS server does not delay every request. If a lookup fails,
+// the last known addresses are used for up to maxStale. The TXT records used
+// in dns-01 validations are never cached.
+type DNSCacheConfig struct {
+	// Timeout is the timeout of a lookup. It defaults to 5s.
+	Timeout *provisioner.Duration `json:"timeout,omitempty"`
+	// TTL is the time the results are cached. It defaults to 30s.
+	TTL *provisioner.Duration `json:"ttl,omitempty"`
+	// NegativeTTL is the time the names that do not exist are cached. It
+	// defaults to 5s.
+	NegativeTTL *provisioner.Duration `json:"negativeTTL,omitempty"`
+	// MaxStale is the maximum time an expired result is used if the lookup
+	// fails. It defaults to 5m.
+	MaxStale *provisioner.Duration `json:"maxStale,omitempty"`
+	// MaxEntries is the maximum number of cached names. It defaults to 10000.
+	MaxEntries int `json:"maxEntries,omitempty"`
+}
+
+// Validate validates the DNS cache configuration.
+func (c *DNSCacheConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Timeout != nil && c.Timeout.Duration <= 0:
+		return errors.New("dnsCache.timeout must be greater than 0")
+	case c.TTL != nil && c.TTL.Duration <= 0:
+		return errors.New("dnsCache.ttl must be greater than 0")
+	case c.NegativeTTL != nil && c.NegativeTTL.Duration <= 0:
+		return errors.New("dnsCache.negativeTTL must be greater than 0")
+	case c.MaxStale != nil && c.MaxStale.Duration < 0:
+		return errors.New("dnsCache.maxStale cannot be negative")
+	case c.MaxEntries < 0:
+		return errors.New("dnsCache.maxEntries cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetOptions returns the options of the resolver, or nil if the cache is not
+// enabled.
+func (c *DNSCacheConfig) GetOptions() *resolver.Options {
+	if c == nil {
+		return nil
+	}
+	o := &resolver.Options{
+		MaxEntries: c.MaxEntries,
+	}
+	if c.Timeout != nil {
+		o.Timeout = c.Timeout.Duration
+	}
+	if c.TTL != nil {
+		o.TTL = c.TTL.Duration
+	}
+	if c.NegativeTTL != nil {
+		o.NegativeTTL = c.NegativeTTL.Duration
+	}
+	if c.MaxStale != nil {
+		// A zero maxStale disables the use of expired results.
+		o.MaxStale = c.MaxStale.Duration
+		if o.MaxStale == 0 {
+			o.MaxStale = -1
+		}
+	}
+	return o
+}
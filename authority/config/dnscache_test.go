@@ -0,0 +1,66 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/resolver"
+)
+
+func TestDNSCacheConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DNSCacheConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &DNSCacheConfig{}, false},
+		{"ok", &DNSCacheConfig{
+			Timeout:     &provisioner.Duration{Duration: time.Second},
+			TTL:         &provisioner.Duration{Duration: time.Minute},
+			NegativeTTL: &provisioner.Duration{Duration: time.Second},
+			MaxStale:    &provisioner.Duration{},
+			MaxEntries:  100,
+		}, false},
+		{"fail timeout", &DNSCacheConfig{Timeout: &provisioner.Duration{}}, true},
+		{"fail ttl", &DNSCacheConfig{TTL: &provisioner.Duration{}}, true},
+		{"fail negativeTTL", &DNSCacheConfig{NegativeTTL: &provisioner.Duration{}}, true},
+		{"fail maxStale", &DNSCacheConfig{MaxStale: &provisioner.Duration{Duration: -time.Second}}, true},
+		{"fail maxEntries", &DNSCacheConfig{MaxEntries: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("DNSCacheConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDNSCacheConfig_GetOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *DNSCacheConfig
+		want   *resolver.Options
+	}{
+		{"nil", nil, nil},
+		{"empty", &DNSCacheConfig{}, &resolver.Options{}},
+		{"ok", &DNSCacheConfig{
+			Timeout:     &provisioner.Duration{Duration: time.Second},
+			TTL:         &provisioner.Duration{Duration: time.Minute},
+			NegativeTTL: &provisioner.Duration{Duration: 2 * time.Second},
+			MaxStale:    &provisioner.Duration{Duration: time.Hour},
+			MaxEntries:  100,
+		}, &resolver.Options{Timeout: time.Second, TTL: time.Minute, NegativeTTL: 2 * time.Second, MaxStale: time.Hour, MaxEntries: 100}},
+		{"no maxStale", &DNSCacheConfig{MaxStale: &provisioner.Duration{}}, &resolver.Options{MaxStale: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetOptions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DNSCacheConfig.GetOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Operations that can require the confirmation of two administrators.
+const (
+	// DualControlRootRegeneration is the generation of a new root with the
+	// pki package.
+	DualControlRootRegeneration = "rootRegeneration"
+	// DualControlIntermediateResign is the signing of a new intermediate with
+	// the pki package.
+	DualControlIntermediateResign = "intermediateResign"
+	// DualControlFederationChange is the addition or removal of a federated
+	// authority with the admin API.
+	DualControlFederationChange = "federationChange"
+)
+
+// DefaultDualControlExpiry is the default time an operation waits for the
+// confirmations, and a confirmed operation can be executed.
+var DefaultDualControlExpiry = 24 * time.Hour
+
+// DualControlConfig requires the confirmation of two distinct administrators
+// before executing the operations that touch the roots of the authority.
+type DualControlConfig struct {
+	// Operations is the list of operations that require two confirmations.
+	// If it's empty, all of them do.
+	Operations []string `json:"operations,omitempty"`
+	// Expiry is the time an operation waits for the confirmations, and a
+	// confirmed operation can be executed. Defaults to 24h.
+	Expiry *provisioner.Duration `json:"expiry,omitempty"`
+}
+
+// Validate validates the dual control configuration.
+func (c *DualControlConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, op := range c.Operations {
+		switch op {
+		case DualControlRootRegeneration, DualControlIntermediateResign, DualControlFederationChange:
+		default:
+			return errors.Errorf("unsupported dualControl.operations %s", op)
+		}
+	}
+	if c.Expiry != nil && c.Expiry.Duration <= 0 {
+		return errors.New("dualControl.expiry must be greater than 0")
+	}
+	return nil
+}
+
+// IsRequired returns true if the given operation requires the confirmation
+// of two administrators.
+func (c *DualControlConfig) IsRequired(op string) bool {
+	if c == nil {
+		return false
+	}
+	if len(c.Operations) == 0 {
+		return true
+	}
+	for _, s := range c.Operations {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+// GetExpiry returns the time an operation waits for the confirmations.
+func (c *DualControlConfig) GetExpiry() time.Duration {
+	if c == nil || c.Expiry == nil {
+		return DefaultDualControlExpiry
+	}
+	return c.Expiry.Duration
+}
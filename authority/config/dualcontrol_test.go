@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestDualControlConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DualControlConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &DualControlConfig{}, false},
+		{"operations", &DualControlConfig{Operations: []string{DualControlRootRegeneration, DualControlIntermediateResign, DualControlFederationChange}}, false},
+		{"expiry", &DualControlConfig{Expiry: &provisioner.Duration{Duration: time.Hour}}, false},
+		{"fail operation", &DualControlConfig{Operations: []string{"revoke"}}, true},
+		{"fail expiry", &DualControlConfig{Expiry: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("DualControlConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDualControlConfig_IsRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *DualControlConfig
+		op     string
+		want   bool
+	}{
+		{"nil", nil, DualControlRootRegeneration, false},
+		{"empty", &DualControlConfig{}, DualControlFederationChange, true},
+		{"listed", &DualControlConfig{Operations: []string{DualControlRootRegeneration}}, DualControlRootRegeneration, true},
+		{"not listed", &DualControlConfig{Operations: []string{DualControlRootRegeneration}}, DualControlFederationChange, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsRequired(tt.op); got != tt.want {
+				t.Errorf("DualControlConfig.IsRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDualControlConfig_GetExpiry(t *testing.T) {
+	var c *DualControlConfig
+	if got := c.GetExpiry(); got != DefaultDualControlExpiry {
+		t.Errorf("DualControlConfig.GetExpiry() = %v, want %v", got, DefaultDualControlExpiry)
+	}
+	c = &DualControlConfig{Expiry: &provisioner.Duration{Duration: time.Hour}}
+	if got := c.GetExpiry(); got != time.Hour {
+		t.Errorf("DualControlConfig.GetExpiry() = %v, want %v", got, time.Hour)
+	}
+}
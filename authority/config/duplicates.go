@@ -0,0 +1,67 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Duplicate issuance modes.
+const (
+	// DuplicatesDetect logs the requests of duplicate certificates.
+	DuplicatesDetect = "detect"
+	// DuplicatesBlock returns the existing certificate instead of issuing a
+	// duplicate.
+	DuplicatesBlock = "block"
+)
+
+// DefaultDuplicatesWindow is the default time after the issuance of a
+// certificate during which the same request is a duplicate.
+var DefaultDuplicatesWindow = 10 * time.Minute
+
+// DuplicatesConfig configures the detection of duplicate certificates. A
+// certificate is a duplicate of a previous one if it is requested using the
+// same provisioner, for the same subject alternative names and public key,
+// within the window after the issuance of the previous one, and the previous
+// one has not expired or been revoked.
+type DuplicatesConfig struct {
+	// Mode is "detect" to log the duplicates, or "block" to return the
+	// existing certificate instead of issuing a new one. Defaults to detect.
+	Mode string `json:"mode,omitempty"`
+	// Window is the time after the issuance of a certificate during which
+	// the same request is a duplicate. After it, a new certificate is issued,
+	// so clients renewing with the same key are not blocked until the
+	// previous certificate expires. Defaults to 10m.
+	Window *provisioner.Duration `json:"window,omitempty"`
+}
+
+// Validate validates the duplicates configuration.
+func (c *DuplicatesConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Window != nil && c.Window.Duration <= 0 {
+		return errors.New("duplicates.window must be greater than 0")
+	}
+	switch c.Mode {
+	case "", DuplicatesDetect, DuplicatesBlock:
+		return nil
+	default:
+		return errors.Errorf("unsupported duplicates.mode %s", c.Mode)
+	}
+}
+
+// GetWindow returns the time after the issuance of a certificate during which
+// the same request is a duplicate.
+func (c *DuplicatesConfig) GetWindow() time.Duration {
+	if c == nil || c.Window == nil {
+		return DefaultDuplicatesWindow
+	}
+	return c.Window.Duration
+}
+
+// IsBlock returns true if the duplicate certificates are not issued.
+func (c *DuplicatesConfig) IsBlock() bool {
+	return c != nil && c.Mode == DuplicatesBlock
+}
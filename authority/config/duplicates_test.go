@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestDuplicatesConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DuplicatesConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &DuplicatesConfig{}, false},
+		{"detect", &DuplicatesConfig{Mode: DuplicatesDetect}, false},
+		{"block", &DuplicatesConfig{Mode: DuplicatesBlock}, false},
+		{"window", &DuplicatesConfig{Window: &provisioner.Duration{Duration: time.Hour}}, false},
+		{"fail mode", &DuplicatesConfig{Mode: "reject"}, true},
+		{"fail window", &DuplicatesConfig{Window: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("DuplicatesConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDuplicatesConfig_IsBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *DuplicatesConfig
+		want   bool
+	}{
+		{"nil", nil, false},
+		{"empty", &DuplicatesConfig{}, false},
+		{"detect", &DuplicatesConfig{Mode: DuplicatesDetect}, false},
+		{"block", &DuplicatesConfig{Mode: DuplicatesBlock}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsBlock(); got != tt.want {
+				t.Errorf("DuplicatesConfig.IsBlock() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuplicatesConfig_GetWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *DuplicatesConfig
+		want   time.Duration
+	}{
+		{"nil", nil, DefaultDuplicatesWindow},
+		{"empty", &DuplicatesConfig{}, DefaultDuplicatesWindow},
+		{"window", &DuplicatesConfig{Window: &provisioner.Duration{Duration: time.Hour}}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetWindow(); got != tt.want {
+				t.Errorf("DuplicatesConfig.GetWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// GRPCConfig configures the gRPC service of the CA. The service exposes the
+// sign, renew, revoke and SSH sign operations, and a stream of renewed
+// certificates, using the same TLS configuration as the main address.
+type GRPCConfig struct {
+	// Address is the address of the gRPC server, e.g. :9000.
+	Address string `json:"address"`
+}
+
+// Validate validates the gRPC configuration.
+func (c *GRPCConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Address == "":
+		return errors.New("grpc.address cannot be empty")
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return errors.Errorf("grpc.address '%s' is not a valid address", c.Address)
+	}
+	return nil
+}
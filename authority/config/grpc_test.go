@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestGRPCConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *GRPCConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &GRPCConfig{Address: ":9000"}, false},
+		{"ok host", &GRPCConfig{Address: "10.0.0.1:9000"}, false},
+		{"fail empty", &GRPCConfig{}, true},
+		{"fail address", &GRPCConfig{Address: "10.0.0.1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("GRPCConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+var (
+	// DefaultCORSAllowedMethods are the methods allowed in CORS requests if
+	// none are configured.
+	DefaultCORSAllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	// DefaultCORSAllowedHeaders are the request headers allowed in CORS
+	// requests if none are configured.
+	DefaultCORSAllowedHeaders = []string{"Authorization", "Content-Type"}
+	// DefaultCORSExposedHeaders are the response headers exposed to browsers
+	// if none are configured. ACME clients require the nonce and the links.
+	DefaultCORSExposedHeaders = []string{"Location", "Link", "Replay-Nonce", "Retry-After"}
+	// DefaultHSTSMaxAge is the max-age of the Strict-Transport-Security header
+	// if none is configured.
+	DefaultHSTSMaxAge = 365 * 24 * time.Hour
+)
+
+// HeadersConfig configures the headers added to the responses of the CA,
+// ACME and admin endpoints.
+type HeadersConfig struct {
+	// CORS enables cross-origin requests from browsers.
+	CORS *CORSConfig `json:"cors,omitempty"`
+	// HSTS adds the Strict-Transport-Security header to HTTPS responses.
+	HSTS *HSTSConfig `json:"hsts,omitempty"`
+	// Custom are headers added to all responses, e.g.
+	// {"X-Content-Type-Options": "nosniff"}.
+	Custom map[string]string `json:"custom,omitempty"`
+}
+
+// CORSConfig configures the Cross-Origin Resource Sharing headers.
+type CORSConfig struct {
+	// AllowedOrigins is the list of origins allowed, e.g.
+	// https://admin.example.com, or "*" to allow any origin.
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// AllowedMethods is the list of methods allowed in preflight requests.
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	// AllowedHeaders is the list of request headers allowed in preflight
+	// requests.
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	// ExposedHeaders is the list of response headers browsers can read.
+	ExposedHeaders []string `json:"exposedHeaders,omitempty"`
+	// AllowCredentials allows requests with cookies or TLS client
+	// certificates. It cannot be used with the "*" origin.
+	AllowCredentials bool `json:"allowCredentials,omitempty"`
+	// MaxAge is the time browsers can cache a preflight response.
+	MaxAge *provisioner.Duration `json:"maxAge,omitempty"`
+}
+
+// HSTSConfig configures the HTTP Strict Transport Security header.
+type HSTSConfig struct {
+	// MaxAge is the time browsers must only use HTTPS, it defaults to one
+	// year.
+	MaxAge *provisioner.Duration `json:"maxAge,omitempty"`
+	// IncludeSubdomains applies the policy to the subdomains of the CA.
+	IncludeSubdomains bool `json:"includeSubdomains,omitempty"`
+	// Preload adds the preload directive, it requires includeSubdomains.
+	Preload bool `json:"preload,omitempty"`
+}
+
+// Validate validates the headers configuration.
+func (c *HeadersConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.CORS.Validate(); err != nil {
+		return err
+	}
+	if err := c.HSTS.Validate(); err != nil {
+		return err
+	}
+	for k, v := range c.Custom {
+		switch {
+		case !isHeaderName(k):
+			return errors.Errorf("headers.custom contains an invalid header name '%s'", k)
+		case strings.ContainsAny(v, "\r\n"):
+			return errors.Errorf("headers.custom.%s contains an invalid value", k)
+		}
+	}
+	return nil
+}
+
+// Validate validates the CORS configuration.
+func (c *CORSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("headers.cors.allowedOrigins cannot be empty")
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			if c.AllowCredentials {
+				return errors.New("headers.cors.allowedOrigins cannot contain '*' if allowCredentials is set")
+			}
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return errors.Errorf("headers.cors.allowedOrigins contains an invalid origin '%s'", o)
+		}
+	}
+	for _, h := range append(append([]string{}, c.AllowedHeaders...), c.ExposedHeaders...) {
+		if !isHeaderName(h) {
+			return errors.Errorf("headers.cors contains an invalid header name '%s'", h)
+		}
+	}
+	for _, m := range c.AllowedMethods {
+		if !isHeaderName(m) {
+			return errors.Errorf("headers.cors.allowedMethods contains an invalid method '%s'", m)
+		}
+	}
+	if c.MaxAge != nil && c.MaxAge.Duration < 0 {
+		return errors.New("headers.cors.maxAge cannot be negative")
+	}
+	return nil
+}
+
+// Validate validates the HSTS configuration.
+func (c *HSTSConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxAge != nil && c.MaxAge.Duration < 0:
+		return errors.New("headers.hsts.maxAge cannot be negative")
+	case c.Preload && !c.IncludeSubdomains:
+		return errors.New("headers.hsts.preload requires includeSubdomains")
+	}
+	return nil
+}
+
+// Middleware is an HTTP middleware that adds the configured headers to the
+// responses and answers the CORS preflight requests of allowed origins.
+func (c *HeadersConfig) Middleware(next http.Handler) http.Handler {
+	hsts := c.HSTS.value()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for k, v := range c.Custom {
+			h.Set(k, v)
+		}
+		// Browsers ignore the header in HTTP responses.
+		if hsts != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if c.CORS != nil {
+			h.Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && c.CORS.allowed(origin) {
+				if c.CORS.preflight(w, r, origin) {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowed returns if the origin is one of the allowed origins.
+func (c *CORSConfig) allowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// preflight writes the CORS headers for the given allowed origin and returns
+// true if the request is a preflight request.
+func (c *CORSConfig) preflight(w http.ResponseWriter, r *http.Request, origin string) bool {
+	h := w.Header()
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+	} else if len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*" {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		h.Set("Access-Control-Expose-Headers", strings.Join(withDefault(c.ExposedHeaders, DefaultCORSExposedHeaders), ", "))
+		return false
+	}
+
+	h.Set("Access-Control-Allow-Methods", strings.Join(withDefault(c.AllowedMethods, DefaultCORSAllowedMethods), ", "))
+	h.Set("Access-Control-Allow-Headers", strings.Join(withDefault(c.AllowedHeaders, DefaultCORSAllowedHeaders), ", "))
+	if c.MaxAge != nil {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(c.MaxAge.Seconds()), 10))
+	}
+	return true
+}
+
+// value returns the value of the Strict-Transport-Security header.
+func (c *HSTSConfig) value() string {
+	if c == nil {
+		return ""
+	}
+	maxAge := DefaultHSTSMaxAge
+	if c.MaxAge != nil {
+		maxAge = c.MaxAge.Duration
+	}
+	s := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if c.IncludeSubdomains {
+		s += "; includeSubDomains"
+	}
+	if c.Preload {
+		s += "; preload"
+	}
+	return s
+}
+
+func withDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+// isHeaderName returns true if the given value is a valid HTTP token as
+// defined in RFC 7230.
+func isHeaderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestHeadersConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *HeadersConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &HeadersConfig{}, false},
+		{"ok", &HeadersConfig{
+			CORS: &CORSConfig{
+				AllowedOrigins:   []string{"https://admin.example.com", "http://localhost:3000/"},
+				AllowedHeaders:   []string{"Content-Type"},
+				AllowCredentials: true,
+				MaxAge:           &provisioner.Duration{Duration: time.Hour},
+			},
+			HSTS:   &HSTSConfig{IncludeSubdomains: true, Preload: true},
+			Custom: map[string]string{"X-Content-Type-Options": "nosniff"},
+		}, false},
+		{"ok any origin", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"*"}}}, false},
+		{"fail allowedOrigins", &HeadersConfig{CORS: &CORSConfig{}}, true},
+		{"fail origin", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"https://example.com/path"}}}, true},
+		{"fail origin scheme", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"example.com"}}}, true},
+		{"fail credentials", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}}, true},
+		{"fail header", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"Replay Nonce"}}}, true},
+		{"fail method", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{""}}}, true},
+		{"fail cors maxAge", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: &provisioner.Duration{Duration: -time.Second}}}, true},
+		{"fail hsts maxAge", &HeadersConfig{HSTS: &HSTSConfig{MaxAge: &provisioner.Duration{Duration: -time.Second}}}, true},
+		{"fail preload", &HeadersConfig{HSTS: &HSTSConfig{Preload: true}}, true},
+		{"fail custom name", &HeadersConfig{Custom: map[string]string{"X:Foo": "bar"}}, true},
+		{"fail custom value", &HeadersConfig{Custom: map[string]string{"X-Foo": "bar\r\nX-Bar: foo"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("HeadersConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeadersConfig_Middleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	config := &HeadersConfig{
+		CORS: &CORSConfig{
+			AllowedOrigins: []string{"https://admin.example.com"},
+			MaxAge:         &provisioner.Duration{Duration: 10 * time.Minute},
+		},
+		HSTS:   &HSTSConfig{IncludeSubdomains: true},
+		Custom: map[string]string{"X-Frame-Options": "DENY"},
+	}
+
+	tests := []struct {
+		name       string
+		config     *HeadersConfig
+		method     string
+		tls        bool
+		header     map[string]string
+		statusCode int
+		want       map[string]string
+	}{
+		{"ok", config, "GET", true, nil, http.StatusTeapot, map[string]string{
+			"Strict-Transport-Security":   "max-age=31536000; includeSubDomains",
+			"X-Frame-Options":             "DENY",
+			"Vary":                        "Origin",
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"ok http", config, "GET", false, nil, http.StatusTeapot, map[string]string{
+			"Strict-Transport-Security": "",
+			"X-Frame-Options":           "DENY",
+		}},
+		{"ok cors", config, "POST", true, map[string]string{"Origin": "https://admin.example.com"}, http.StatusTeapot, map[string]string{
+			"Access-Control-Allow-Origin":   "https://admin.example.com",
+			"Access-Control-Expose-Headers": "Location, Link, Replay-Nonce, Retry-After",
+			"Access-Control-Allow-Methods":  "",
+		}},
+		{"ok preflight", config, "OPTIONS", true, map[string]string{"Origin": "https://admin.example.com", "Access-Control-Request-Method": "POST"}, http.StatusNoContent, map[string]string{
+			"Access-Control-Allow-Origin":  "https://admin.example.com",
+			"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+			"Access-Control-Allow-Headers": "Authorization, Content-Type",
+			"Access-Control-Max-Age":       "600",
+		}},
+		{"ok any origin", &HeadersConfig{CORS: &CORSConfig{AllowedOrigins: []string{"*"}}}, "GET", true, map[string]string{"Origin": "https://foo.example.com"}, http.StatusTeapot, map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		}},
+		{"fail origin", config, "GET", true, map[string]string{"Origin": "https://evil.example.com"}, http.StatusTeapot, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		{"fail preflight origin", config, "OPTIONS", true, map[string]string{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST"}, http.StatusTeapot, map[string]string{
+			"Access-Control-Allow-Origin":  "",
+			"Access-Control-Allow-Methods": "",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "https://ca.example.com/acme/acme/directory", nil)
+			if !tt.tls {
+				req.TLS = nil
+			} else if req.TLS == nil {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			tt.config.Middleware(next).ServeHTTP(w, req)
+			res := w.Result()
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("HeadersConfig.Middleware() StatusCode = %d, want %d", res.StatusCode, tt.statusCode)
+			}
+			for k, v := range tt.want {
+				if got := res.Header.Get(k); got != v {
+					t.Errorf("HeadersConfig.Middleware() %s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
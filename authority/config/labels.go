@@ -0,0 +1,92 @@
+package config
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxLabels is the default maximum number of labels of a certificate.
+const DefaultMaxLabels = 16
+
+// maxLabelValueLength is the maximum length of a label value.
+const maxLabelValueLength = 256
+
+// labelKeyRegexp matches the valid label keys, e.g. "team", "service" or
+// "example.com/environment".
+var labelKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]{0,61}[a-zA-Z0-9])?$`)
+
+// LabelsConfig enables the labels, key-value pairs like the team, service or
+// environment, that sign requests and ACME accounts can attach to the issued
+// certificates. The labels are stored with the certificate and can be used to
+// filter the certificates in the admin API.
+type LabelsConfig struct {
+	// Keys are the allowed label keys. Any valid key is allowed if empty.
+	Keys []string `json:"keys,omitempty"`
+	// MaxLabels is the maximum number of labels of a certificate, 16 by
+	// default.
+	MaxLabels int `json:"maxLabels,omitempty"`
+	// Extension adds the labels to the certificates in a non-critical
+	// extension with the OID 1.3.6.1.4.1.37476.9000.64.3.
+	Extension bool `json:"extension,omitempty"`
+}
+
+// Validate validates the labels configuration.
+func (c *LabelsConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.MaxLabels < 0 {
+		return errors.New("labels.maxLabels cannot be negative")
+	}
+	for _, k := range c.Keys {
+		if !labelKeyRegexp.MatchString(k) {
+			return errors.Errorf("labels.keys contains an invalid key %q", k)
+		}
+	}
+	return nil
+}
+
+// GetMaxLabels returns the maximum number of labels of a certificate.
+func (c *LabelsConfig) GetMaxLabels() int {
+	if c == nil || c.MaxLabels == 0 {
+		return DefaultMaxLabels
+	}
+	return c.MaxLabels
+}
+
+// ValidateLabels validates the labels of a certificate.
+func (c *LabelsConfig) ValidateLabels(labels map[string]string) error {
+	if len(labels) > c.GetMaxLabels() {
+		return errors.Errorf("too many labels, the maximum is %d", c.GetMaxLabels())
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch {
+		case !labelKeyRegexp.MatchString(k):
+			return errors.Errorf("label key %q is not valid", k)
+		case !c.isKeyAllowed(k):
+			return errors.Errorf("label key %q is not allowed", k)
+		case len(labels[k]) > maxLabelValueLength:
+			return errors.Errorf("label %q is too long, the maximum is %d characters", k, maxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+func (c *LabelsConfig) isKeyAllowed(key string) bool {
+	if c == nil || len(c.Keys) == 0 {
+		return true
+	}
+	for _, k := range c.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
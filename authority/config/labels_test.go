@@ -0,0 +1,53 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelsConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *LabelsConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &LabelsConfig{}, false},
+		{"ok", &LabelsConfig{Keys: []string{"team", "service", "example.com/environment"}, MaxLabels: 4, Extension: true}, false},
+		{"fail max labels", &LabelsConfig{MaxLabels: -1}, true},
+		{"fail key", &LabelsConfig{Keys: []string{"team", "-service"}}, true},
+		{"fail empty key", &LabelsConfig{Keys: []string{""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("LabelsConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLabelsConfig_ValidateLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *LabelsConfig
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"ok nil", &LabelsConfig{}, nil, false},
+		{"ok", &LabelsConfig{}, map[string]string{"team": "platform", "env": "prod"}, false},
+		{"ok allowed", &LabelsConfig{Keys: []string{"team", "env"}}, map[string]string{"team": "platform"}, false},
+		{"ok empty value", &LabelsConfig{}, map[string]string{"team": ""}, false},
+		{"fail too many", &LabelsConfig{MaxLabels: 1}, map[string]string{"team": "platform", "env": "prod"}, true},
+		{"fail key", &LabelsConfig{}, map[string]string{"team name": "platform"}, true},
+		{"fail not allowed", &LabelsConfig{Keys: []string{"team"}}, map[string]string{"env": "prod"}, true},
+		{"fail value", &LabelsConfig{}, map[string]string{"team": strings.Repeat("a", 257)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.ValidateLabels(tt.labels); (err != nil) != tt.wantErr {
+				t.Errorf("LabelsConfig.ValidateLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
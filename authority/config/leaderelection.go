@@ -0,0 +1,136 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Types of leader election.
+const (
+	// LeaderElectionDB uses leases stored in the database of the CA.
+	LeaderElectionDB = "db"
+	// LeaderElectionKubernetes uses Kubernetes Lease objects.
+	LeaderElectionKubernetes = "kubernetes"
+)
+
+var (
+	// DefaultLeaseDuration is the default time a replica holds the lease of a
+	// background job without renewing it.
+	DefaultLeaseDuration = 15 * time.Second
+	// DefaultLeaseRenewPeriod is the default time between the renewals of a
+	// lease.
+	DefaultLeaseRenewPeriod = 5 * time.Second
+	// DefaultKubernetesNamespaceFile is the file with the namespace of the pod,
+	// used if the namespace of the leases is not configured.
+	DefaultKubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// LeaderElectionConfig configures the election of the replica that runs each
+// background job, like the RADIUS export, when multiple replicas of the CA
+// share the same database. Each job has its own lease, and only the replica
+// holding it runs the job. Without this configuration every replica runs all
+// the jobs.
+type LeaderElectionConfig struct {
+	// Type is the type of the leases, "db" to store them in the database of
+	// the CA, or "kubernetes" to use Lease objects. It defaults to "db".
+	Type string `json:"type,omitempty"`
+	// Identity is the name of the replica in the leases. It defaults to the
+	// hostname, the name of the pod in Kubernetes.
+	Identity string `json:"identity,omitempty"`
+	// LeaseDuration is the time a replica holds a lease without renewing it.
+	// Another replica can take a lease once it expires. It defaults to 15s.
+	LeaseDuration *provisioner.Duration `json:"leaseDuration,omitempty"`
+	// RenewPeriod is the time between the renewals of a lease, it must be
+	// shorter than the lease duration. It defaults to 5s.
+	RenewPeriod *provisioner.Duration `json:"renewPeriod,omitempty"`
+	// Namespace is the Kubernetes namespace of the Lease objects. It defaults
+	// to the namespace of the pod.
+	Namespace string `json:"namespace,omitempty"`
+	// LeasePrefix is the prefix of the names of the leases. It defaults to
+	// "step-ca-".
+	LeasePrefix string `json:"leasePrefix,omitempty"`
+}
+
+// Validate validates the leader election configuration.
+func (c *LeaderElectionConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	switch strings.ToLower(c.Type) {
+	case "", LeaderElectionDB, LeaderElectionKubernetes:
+	default:
+		return errors.Errorf("unsupported leaderElection.type '%s'", c.Type)
+	}
+	switch {
+	case c.LeaseDuration != nil && c.LeaseDuration.Duration <= 0:
+		return errors.New("leaderElection.leaseDuration must be greater than 0")
+	case c.RenewPeriod != nil && c.RenewPeriod.Duration <= 0:
+		return errors.New("leaderElection.renewPeriod must be greater than 0")
+	case c.GetRenewPeriod() >= c.GetLeaseDuration():
+		return errors.New("leaderElection.renewPeriod must be shorter than leaderElection.leaseDuration")
+	default:
+		return nil
+	}
+}
+
+// GetType returns the type of the leases.
+func (c *LeaderElectionConfig) GetType() string {
+	if c == nil || c.Type == "" {
+		return LeaderElectionDB
+	}
+	return strings.ToLower(c.Type)
+}
+
+// GetIdentity returns the name of the replica in the leases.
+func (c *LeaderElectionConfig) GetIdentity() (string, error) {
+	if c != nil && c.Identity != "" {
+		return c.Identity, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "error getting the hostname, leaderElection.identity is required")
+	}
+	return hostname, nil
+}
+
+// GetLeaseDuration returns the time a replica holds a lease without renewing
+// it.
+func (c *LeaderElectionConfig) GetLeaseDuration() time.Duration {
+	if c == nil || c.LeaseDuration == nil {
+		return DefaultLeaseDuration
+	}
+	return c.LeaseDuration.Duration
+}
+
+// GetRenewPeriod returns the time between the renewals of a lease.
+func (c *LeaderElectionConfig) GetRenewPeriod() time.Duration {
+	if c == nil || c.RenewPeriod == nil {
+		return DefaultLeaseRenewPeriod
+	}
+	return c.RenewPeriod.Duration
+}
+
+// GetNamespace returns the Kubernetes namespace of the Lease objects.
+func (c *LeaderElectionConfig) GetNamespace() (string, error) {
+	if c != nil && c.Namespace != "" {
+		return c.Namespace, nil
+	}
+	b, err := ioutil.ReadFile(DefaultKubernetesNamespaceFile)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading the namespace of the pod, leaderElection.namespace is required")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// GetLeasePrefix returns the prefix of the names of the leases.
+func (c *LeaderElectionConfig) GetLeasePrefix() string {
+	if c == nil || c.LeasePrefix == "" {
+		return "step-ca-"
+	}
+	return c.LeasePrefix
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestLeaderElectionConfig_Validate(t *testing.T) {
+	second := &provisioner.Duration{Duration: time.Second}
+	minute := &provisioner.Duration{Duration: time.Minute}
+	tests := []struct {
+		name    string
+		config  *LeaderElectionConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &LeaderElectionConfig{}, false},
+		{"ok db", &LeaderElectionConfig{Type: "db", LeaseDuration: minute, RenewPeriod: second}, false},
+		{"ok kubernetes", &LeaderElectionConfig{Type: "Kubernetes", Namespace: "step"}, false},
+		{"fail type", &LeaderElectionConfig{Type: "etcd"}, true},
+		{"fail leaseDuration", &LeaderElectionConfig{LeaseDuration: &provisioner.Duration{}}, true},
+		{"fail renewPeriod", &LeaderElectionConfig{RenewPeriod: &provisioner.Duration{Duration: -time.Second}}, true},
+		{"fail renewPeriod >= leaseDuration", &LeaderElectionConfig{LeaseDuration: second, RenewPeriod: second}, true},
+		{"fail default leaseDuration", &LeaderElectionConfig{RenewPeriod: minute}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("LeaderElectionConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLeaderElectionConfig_Get(t *testing.T) {
+	var nilConfig *LeaderElectionConfig
+	if got := nilConfig.GetType(); got != LeaderElectionDB {
+		t.Errorf("LeaderElectionConfig.GetType() = %s, want %s", got, LeaderElectionDB)
+	}
+	if got := nilConfig.GetLeaseDuration(); got != DefaultLeaseDuration {
+		t.Errorf("LeaderElectionConfig.GetLeaseDuration() = %v, want %v", got, DefaultLeaseDuration)
+	}
+	if got := nilConfig.GetRenewPeriod(); got != DefaultLeaseRenewPeriod {
+		t.Errorf("LeaderElectionConfig.GetRenewPeriod() = %v, want %v", got, DefaultLeaseRenewPeriod)
+	}
+	if got := nilConfig.GetLeasePrefix(); got != "step-ca-" {
+		t.Errorf("LeaderElectionConfig.GetLeasePrefix() = %s, want step-ca-", got)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := nilConfig.GetIdentity(); err != nil || got != hostname {
+		t.Errorf("LeaderElectionConfig.GetIdentity() = %s, %v, want %s", got, err, hostname)
+	}
+
+	c := &LeaderElectionConfig{
+		Type:          "Kubernetes",
+		Identity:      "ca-0",
+		LeaseDuration: &provisioner.Duration{Duration: time.Minute},
+		RenewPeriod:   &provisioner.Duration{Duration: time.Second},
+		Namespace:     "step",
+		LeasePrefix:   "ca-",
+	}
+	if got := c.GetType(); got != LeaderElectionKubernetes {
+		t.Errorf("LeaderElectionConfig.GetType() = %s, want %s", got, LeaderElectionKubernetes)
+	}
+	if got, err := c.GetIdentity(); err != nil || got != "ca-0" {
+		t.Errorf("LeaderElectionConfig.GetIdentity() = %s, %v, want ca-0", got, err)
+	}
+	if got := c.GetLeaseDuration(); got != time.Minute {
+		t.Errorf("LeaderElectionConfig.GetLeaseDuration() = %v, want %v", got, time.Minute)
+	}
+	if got := c.GetRenewPeriod(); got != time.Second {
+		t.Errorf("LeaderElectionConfig.GetRenewPeriod() = %v, want %v", got, time.Second)
+	}
+	if got, err := c.GetNamespace(); err != nil || got != "step" {
+		t.Errorf("LeaderElectionConfig.GetNamespace() = %s, %v, want step", got, err)
+	}
+	if got := c.GetLeasePrefix(); got != "ca-" {
+		t.Errorf("LeaderElectionConfig.GetLeasePrefix() = %s, want ca-", got)
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// Endpoints that can be served by a dedicated listener.
+const (
+	// ListenerEndpointAPI is the core API, e.g. /sign, /renew or /roots.
+	ListenerEndpointAPI = "api"
+	// ListenerEndpointACME is the ACME API.
+	ListenerEndpointACME = "acme"
+	// ListenerEndpointAdmin is the admin API.
+	ListenerEndpointAdmin = "admin"
+)
+
+// Client authentication policies of a listener.
+const (
+	// ListenerClientAuthNone does not request a client certificate.
+	ListenerClientAuthNone = "none"
+	// ListenerClientAuthVerifyIfGiven verifies the client certificate if one
+	// is sent. It's the policy of the main address and the default.
+	ListenerClientAuthVerifyIfGiven = "verifyIfGiven"
+	// ListenerClientAuthRequire requires a client certificate signed by the
+	// roots of the CA.
+	ListenerClientAuthRequire = "require"
+)
+
+// ListenerConfig configures an additional HTTPS listener that serves some of
+// the endpoints of the CA. The endpoints served by a listener are no longer
+// served on the main address.
+type ListenerConfig struct {
+	// Address is the address of the listener, e.g. 10.0.0.1:9443.
+	Address string `json:"address"`
+	// Endpoints is the list of endpoints served by the listener: api, acme or
+	// admin.
+	Endpoints []string `json:"endpoints"`
+	// ClientAuth is the client authentication policy of the listener: none,
+	// verifyIfGiven or require. It defaults to verifyIfGiven.
+	ClientAuth string `json:"clientAuth,omitempty"`
+}
+
+// Validate validates the listener configuration.
+func (c *ListenerConfig) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("listeners cannot contain an empty listener")
+	case c.Address == "":
+		return errors.New("listeners.address cannot be empty")
+	case len(c.Endpoints) == 0:
+		return errors.Errorf("listeners.endpoints of %s cannot be empty", c.Address)
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return errors.Errorf("listeners.address '%s' is not a valid address", c.Address)
+	}
+	for _, e := range c.Endpoints {
+		switch e {
+		case ListenerEndpointAPI, ListenerEndpointACME, ListenerEndpointAdmin:
+		default:
+			return errors.Errorf("listeners.endpoints of %s contains an unsupported endpoint '%s'", c.Address, e)
+		}
+	}
+	switch c.ClientAuth {
+	case "", ListenerClientAuthNone, ListenerClientAuthVerifyIfGiven, ListenerClientAuthRequire:
+	default:
+		return errors.Errorf("listeners.clientAuth of %s '%s' is not supported", c.Address, c.ClientAuth)
+	}
+	return nil
+}
+
+// Serves returns true if the listener serves the given endpoint.
+func (c *ListenerConfig) Serves(endpoint string) bool {
+	for _, e := range c.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientAuthType returns the tls.ClientAuthType of the listener.
+func (c *ListenerConfig) ClientAuthType() tls.ClientAuthType {
+	switch c.ClientAuth {
+	case ListenerClientAuthNone:
+		return tls.NoClientCert
+	case ListenerClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.VerifyClientCertIfGiven
+	}
+}
+
+// validateListeners validates the listeners and checks that their addresses
+// and endpoints are not repeated.
+func validateListeners(listeners []*ListenerConfig, addresses ...string) error {
+	seenAddresses := make(map[string]bool)
+	for _, a := range addresses {
+		if a != "" {
+			seenAddresses[a] = true
+		}
+	}
+	seenEndpoints := make(map[string]bool)
+	for _, l := range listeners {
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		if seenAddresses[l.Address] {
+			return errors.Errorf("listeners.address '%s' is already in use", l.Address)
+		}
+		seenAddresses[l.Address] = true
+		for _, e := range l.Endpoints {
+			if seenEndpoints[e] {
+				return errors.Errorf("listeners.endpoints '%s' is served by more than one listener", e)
+			}
+			seenEndpoints[e] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestListenerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *ListenerConfig
+		wantErr bool
+	}{
+		{"ok", &ListenerConfig{Address: ":9443", Endpoints: []string{"admin"}, ClientAuth: "require"}, false},
+		{"ok default", &ListenerConfig{Address: "10.0.0.1:443", Endpoints: []string{"api", "acme"}}, false},
+		{"fail nil", nil, true},
+		{"fail address", &ListenerConfig{Endpoints: []string{"admin"}}, true},
+		{"fail address port", &ListenerConfig{Address: "10.0.0.1", Endpoints: []string{"admin"}}, true},
+		{"fail endpoints", &ListenerConfig{Address: ":9443"}, true},
+		{"fail endpoint", &ListenerConfig{Address: ":9443", Endpoints: []string{"scep"}}, true},
+		{"fail clientAuth", &ListenerConfig{Address: ":9443", Endpoints: []string{"admin"}, ClientAuth: "optional"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ListenerConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListenerConfig_ClientAuthType(t *testing.T) {
+	tests := []struct {
+		clientAuth string
+		want       tls.ClientAuthType
+	}{
+		{"", tls.VerifyClientCertIfGiven},
+		{"verifyIfGiven", tls.VerifyClientCertIfGiven},
+		{"none", tls.NoClientCert},
+		{"require", tls.RequireAndVerifyClientCert},
+	}
+	for _, tt := range tests {
+		c := &ListenerConfig{ClientAuth: tt.clientAuth}
+		if got := c.ClientAuthType(); got != tt.want {
+			t.Errorf("ListenerConfig.ClientAuthType() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func Test_validateListeners(t *testing.T) {
+	admin := &ListenerConfig{Address: ":9443", Endpoints: []string{"admin"}}
+	acme := &ListenerConfig{Address: ":8443", Endpoints: []string{"acme"}}
+	tests := []struct {
+		name      string
+		listeners []*ListenerConfig
+		wantErr   bool
+	}{
+		{"ok empty", nil, false},
+		{"ok", []*ListenerConfig{admin, acme}, false},
+		{"fail main address", []*ListenerConfig{{Address: ":443", Endpoints: []string{"admin"}}}, true},
+		{"fail insecure address", []*ListenerConfig{{Address: ":80", Endpoints: []string{"admin"}}}, true},
+		{"fail address", []*ListenerConfig{admin, {Address: ":9443", Endpoints: []string{"acme"}}}, true},
+		{"fail endpoint", []*ListenerConfig{admin, {Address: ":8443", Endpoints: []string{"admin"}}}, true},
+		{"fail listener", []*ListenerConfig{admin, {Address: ":8443"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateListeners(tt.listeners, ":443", ":80"); (err != nil) != tt.wantErr {
+				t.Errorf("validateListeners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+)
+
+// MessagesConfig contains the user-facing messages that replace the default
+// details of the API errors. The message is selected using the Accept-Language
+// header of the request.
+type MessagesConfig struct {
+	// DefaultLanguage is the language used if none of the languages requested
+	// is available. If it's not set, the default details will be used.
+	DefaultLanguage string `json:"defaultLanguage,omitempty"`
+	// Messages maps an error code, e.g. "badCSR", to the messages indexed by
+	// language tag, e.g. {"en": "Please contact help desk ext. 1234"}.
+	Messages map[string]map[string]string `json:"messages"`
+}
+
+// Validate validates the messages configuration.
+func (c *MessagesConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.DefaultLanguage != "" && !isLanguageTag(c.DefaultLanguage) {
+		return errors.Errorf("messages.defaultLanguage '%s' is not a valid language tag", c.DefaultLanguage)
+	}
+	for code, m := range c.Messages {
+		if code == "" {
+			return errors.New("messages cannot contain an empty error code")
+		}
+		for lang, msg := range m {
+			switch {
+			case !isLanguageTag(lang):
+				return errors.Errorf("messages.%s contains an invalid language tag '%s'", code, lang)
+			case strings.TrimSpace(msg) == "":
+				return errors.Errorf("messages.%s.%s cannot be empty", code, lang)
+			}
+		}
+	}
+	return nil
+}
+
+// Catalog returns the message catalog used by the API to write the errors.
+func (c *MessagesConfig) Catalog() *errs.MessageCatalog {
+	if c == nil || len(c.Messages) == 0 {
+		return nil
+	}
+	return errs.NewMessageCatalog(c.DefaultLanguage, c.Messages)
+}
+
+// isLanguageTag returns true if the given value looks like a BCP 47 language
+// tag, e.g. "en" or "pt-BR".
+func isLanguageTag(s string) bool {
+	for i, part := range strings.Split(s, "-") {
+		if part == "" || len(part) > 8 || (i == 0 && len(part) < 2) {
+			return false
+		}
+		for _, r := range part {
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || i > 0 && '0' <= r && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
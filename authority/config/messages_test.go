@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestMessagesConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *MessagesConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &MessagesConfig{}, false},
+		{"ok", &MessagesConfig{DefaultLanguage: "en", Messages: map[string]map[string]string{
+			"badCSR": {"en": "Contact the help desk.", "pt-BR": "Entre em contato com o suporte.", "es-419": "Contacte con soporte."},
+		}}, false},
+		{"fail defaultLanguage", &MessagesConfig{DefaultLanguage: "e"}, true},
+		{"fail code", &MessagesConfig{Messages: map[string]map[string]string{
+			"": {"en": "Contact the help desk."},
+		}}, true},
+		{"fail language", &MessagesConfig{Messages: map[string]map[string]string{
+			"badCSR": {"en_US": "Contact the help desk."},
+		}}, true},
+		{"fail message", &MessagesConfig{Messages: map[string]map[string]string{
+			"badCSR": {"en": " "},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("MessagesConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
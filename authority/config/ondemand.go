@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// OnDemandConfig contains the configuration of the on-demand certificate
+// endpoint. This endpoint allows reverse proxies authenticated with a client
+// certificate to get a new key and certificate for an internal name.
+type OnDemandConfig struct {
+	// AllowedClients is the list of names (common name or SANs) of the client
+	// certificates allowed to request on-demand certificates. It's required,
+	// a client certificate issued by the CA is not enough to get one.
+	AllowedClients []string `json:"allowedClients"`
+	// AllowedDomains is the list of domains that can be requested. A domain
+	// starting with "*." will match any subdomain of it.
+	AllowedDomains []string `json:"allowedDomains"`
+	// Duration is the validity of the on-demand certificates, if not set the
+	// default TLS certificate duration will be used.
+	Duration *provisioner.Duration `json:"duration,omitempty"`
+}
+
+// Validate validates the on-demand configuration.
+func (c *OnDemandConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case len(c.AllowedClients) == 0:
+		return errors.New("onDemand.allowedClients cannot be empty")
+	case len(c.AllowedDomains) == 0:
+		return errors.New("onDemand.allowedDomains cannot be empty")
+	case c.Duration != nil && c.Duration.Duration <= 0:
+		return errors.New("onDemand.duration must be greater than 0")
+	}
+	for _, name := range c.AllowedClients {
+		if name == "" {
+			return errors.New("onDemand.allowedClients cannot contain an empty name")
+		}
+	}
+	for _, d := range c.AllowedDomains {
+		if d == "" || d == "*." || strings.Contains(strings.TrimPrefix(d, "*."), "*") {
+			return errors.Errorf("onDemand.allowedDomains contains an invalid domain '%s'", d)
+		}
+	}
+	return nil
+}
+
+// IsAllowedDomain returns true if the given domain matches one of the
+// configured allowed domains.
+func (c *OnDemandConfig) IsAllowedDomain(domain string) bool {
+	if c == nil {
+		return false
+	}
+	return matchDomain(c.AllowedDomains, domain)
+}
+
+// matchDomain returns true if the domain matches one of the given domains. A
+// domain starting with "*." matches any subdomain of it.
+func matchDomain(domains []string, domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" {
+		return false
+	}
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if strings.HasPrefix(d, "*.") {
+			if strings.HasSuffix(domain, d[1:]) && len(domain) > len(d)-1 {
+				return true
+			}
+		} else if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowedClient returns true if one of the given names is in the list of
+// allowed clients. An empty list does not allow any client.
+func (c *OnDemandConfig) IsAllowedClient(names ...string) bool {
+	if c == nil {
+		return false
+	}
+	for _, name := range names {
+		for _, allowed := range c.AllowedClients {
+			if strings.EqualFold(name, allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestOnDemandConfig_Validate(t *testing.T) {
+	clients := []string{"proxy.internal"}
+	tests := []struct {
+		name    string
+		config  *OnDemandConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &OnDemandConfig{AllowedClients: clients, AllowedDomains: []string{"*.internal", "foo.example.com"}}, false},
+		{"ok duration", &OnDemandConfig{AllowedClients: clients, AllowedDomains: []string{"*.internal"}, Duration: &provisioner.Duration{Duration: time.Hour}}, false},
+		{"fail no clients", &OnDemandConfig{AllowedDomains: []string{"*.internal"}}, true},
+		{"fail empty client", &OnDemandConfig{AllowedClients: []string{""}, AllowedDomains: []string{"*.internal"}}, true},
+		{"fail no domains", &OnDemandConfig{AllowedClients: clients}, true},
+		{"fail empty domain", &OnDemandConfig{AllowedClients: clients, AllowedDomains: []string{""}}, true},
+		{"fail wildcard", &OnDemandConfig{AllowedClients: clients, AllowedDomains: []string{"*."}}, true},
+		{"fail inner wildcard", &OnDemandConfig{AllowedClients: clients, AllowedDomains: []string{"foo.*.internal"}}, true},
+		{"fail duration", &OnDemandConfig{AllowedClients: clients, AllowedDomains: []string{"*.internal"}, Duration: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("OnDemandConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOnDemandConfig_IsAllowedDomain(t *testing.T) {
+	c := &OnDemandConfig{AllowedDomains: []string{"*.internal", "Foo.Example.com"}}
+	tests := []struct {
+		name   string
+		config *OnDemandConfig
+		domain string
+		want   bool
+	}{
+		{"nil", nil, "foo.internal", false},
+		{"empty", c, "", false},
+		{"wildcard", c, "foo.internal", true},
+		{"wildcard subdomain", c, "bar.foo.internal", true},
+		{"wildcard trailing dot", c, "foo.internal.", true},
+		{"exact", c, "foo.example.com", true},
+		{"fail wildcard root", c, "internal", false},
+		{"fail suffix", c, "foointernal", false},
+		{"fail exact subdomain", c, "bar.foo.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsAllowedDomain(tt.domain); got != tt.want {
+				t.Errorf("OnDemandConfig.IsAllowedDomain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnDemandConfig_IsAllowedClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *OnDemandConfig
+		names  []string
+		want   bool
+	}{
+		{"nil", nil, []string{"proxy"}, false},
+		{"empty", &OnDemandConfig{}, []string{"proxy"}, false},
+		{"ok", &OnDemandConfig{AllowedClients: []string{"proxy.internal"}}, []string{"proxy", "Proxy.Internal"}, true},
+		{"fail", &OnDemandConfig{AllowedClients: []string{"proxy.internal"}}, []string{"proxy"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsAllowedClient(tt.names...); got != tt.want {
+				t.Errorf("OnDemandConfig.IsAllowedClient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultOPAPath is the default path of the document used as the decision of
+// the Open Policy Agent policies.
+const DefaultOPAPath = "step/ca/decision"
+
+// OPAPolicyConfig configures an Open Policy Agent server, usually running as
+// a sidecar, that takes the authorization and name policy decisions on the
+// issuance of certificates. The sign request is sent as the input of the
+// query, and the document at the given path must be a boolean or a decision
+// with the allow, deny or mutate action.
+type OPAPolicyConfig struct {
+	// URL is the base URL of the OPA server, e.g. http://127.0.0.1:8181.
+	URL string `json:"url"`
+	// Path is the path of the decision document, defaults to step/ca/decision.
+	Path string `json:"path,omitempty"`
+	// Token is the bearer token used to authenticate with the OPA server.
+	Token string `json:"token,omitempty"`
+	// Timeout is the maximum duration of a query, defaults to 5s.
+	Timeout *provisioner.Duration `json:"timeout,omitempty"`
+	// FailOpen allows the requests if the OPA server cannot be queried.
+	FailOpen bool `json:"failOpen,omitempty"`
+	// DecisionLogs enables the logging of every decision.
+	DecisionLogs bool `json:"decisionLogs,omitempty"`
+}
+
+// Validate validates the Open Policy Agent configuration.
+func (c *OPAPolicyConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.URL == "":
+		return errors.New("opaPolicy.url cannot be empty")
+	case c.Timeout != nil && c.Timeout.Duration < 0:
+		return errors.New("opaPolicy.timeout cannot be negative")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing opaPolicy.url")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("opaPolicy.url '%s' is not a valid http or https url", c.URL)
+	}
+	return nil
+}
+
+// GetPath returns the path of the decision document.
+func (c *OPAPolicyConfig) GetPath() string {
+	if p := strings.Trim(c.Path, "/"); p != "" {
+		return p
+	}
+	return DefaultOPAPath
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestOPAPolicyConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *OPAPolicyConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &OPAPolicyConfig{URL: "http://127.0.0.1:8181"}, false},
+		{"ok full", &OPAPolicyConfig{URL: "https://opa.internal", Path: "ca/decision", Token: "token", Timeout: &provisioner.Duration{Duration: time.Second}, FailOpen: true, DecisionLogs: true}, false},
+		{"fail url", &OPAPolicyConfig{}, true},
+		{"fail parse url", &OPAPolicyConfig{URL: "http://127.0.0.1:port"}, true},
+		{"fail scheme", &OPAPolicyConfig{URL: "unix:///var/run/opa.sock"}, true},
+		{"fail host", &OPAPolicyConfig{URL: "127.0.0.1:8181"}, true},
+		{"fail timeout", &OPAPolicyConfig{URL: "http://127.0.0.1:8181", Timeout: &provisioner.Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("OPAPolicyConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOPAPolicyConfig_GetPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"default", "", DefaultOPAPath},
+		{"default slash", "/", DefaultOPAPath},
+		{"ok", "ca/decision", "ca/decision"},
+		{"ok slashes", "/ca/decision/", "ca/decision"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&OPAPolicyConfig{Path: tt.path}).GetPath(); got != tt.want {
+				t.Errorf("OPAPolicyConfig.GetPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EnvOverridePrefix is the prefix of the environment variables that override
+// the values of the configuration. The rest of the name is the path of the
+// value, using double underscores to separate its elements, for example
+// STEP_CA_CONFIG_AUTHORITY__CLAIMS__MAXTLSCERTDURATION.
+const EnvOverridePrefix = "STEP_CA_CONFIG_"
+
+// Override is a value that replaces the one in the configuration file. The
+// path is the list of object keys and array indexes that identifies the value
+// in the JSON document, keys are matched case-insensitively if there is not an
+// exact match. The value is used as JSON if it is valid JSON, and as a string
+// otherwise.
+type Override struct {
+	Path  []string
+	Value string
+}
+
+// String returns the override using the format used by ParseOverride.
+func (o *Override) String() string {
+	return strings.Join(o.Path, ".") + "=" + o.Value
+}
+
+// ParseOverride parses an override with the format path=value, where the
+// elements of the path are separated by dots, for example
+// authority.claims.maxTLSCertDuration=48h.
+func ParseOverride(s string) (*Override, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return nil, errors.Errorf("override %q is not valid, it must be path=value", s)
+	}
+	return newOverride(strings.Split(s[:i], "."), s[i+1:], s)
+}
+
+// EnvOverrides returns the overrides defined in the given environment, with the
+// format returned by os.Environ, sorted by the name of the variable. The
+// variables use the prefix EnvOverridePrefix.
+func EnvOverrides(environ []string) ([]*Override, error) {
+	var names []string
+	values := make(map[string]string)
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv[:i], EnvOverridePrefix) {
+			continue
+		}
+		names = append(names, kv[:i])
+		values[kv[:i]] = kv[i+1:]
+	}
+	sort.Strings(names)
+
+	overrides := make([]*Override, 0, len(names))
+	for _, name := range names {
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(name, EnvOverridePrefix)), "__")
+		o, err := newOverride(path, values[name], name)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+func newOverride(path []string, value, source string) (*Override, error) {
+	for _, p := range path {
+		if p == "" {
+			return nil, errors.Errorf("override %q is not valid, the path cannot have empty elements", source)
+		}
+	}
+	return &Override{Path: path, Value: value}, nil
+}
+
+// ApplyOverrides replaces the values of the given configuration in JSON format
+// with the given overrides, in order.
+func ApplyOverrides(data []byte, overrides []*Override) ([]byte, error) {
+	if len(overrides) == 0 {
+		return data, nil
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	for _, o := range overrides {
+		v, err := setOverride(doc, o.Path, o.value())
+		if err != nil {
+			return nil, errors.Wrapf(err, "error overriding %s", strings.Join(o.Path, "."))
+		}
+		doc = v
+	}
+	return json.Marshal(doc)
+}
+
+// value returns the value of the override as a JSON value.
+func (o *Override) value() interface{} {
+	if json.Valid([]byte(o.Value)) {
+		var v interface{}
+		dec := json.NewDecoder(strings.NewReader(o.Value))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err == nil {
+			return v
+		}
+	}
+	return o.Value
+}
+
+// setOverride sets the value in the given path of the JSON value and returns
+// the updated JSON value. The objects in the path are created if they don't
+// exist.
+func setOverride(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch v := doc.(type) {
+	case nil:
+		child, err := setOverride(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{path[0]: child}, nil
+	case map[string]interface{}:
+		key := path[0]
+		if _, ok := v[key]; !ok {
+			for k := range v {
+				if strings.EqualFold(k, key) {
+					key = k
+					break
+				}
+			}
+		}
+		child, err := setOverride(v[key], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[key] = child
+		return v, nil
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > len(v) {
+			return nil, errors.Errorf("%s is not a valid index of an array of length %d", path[0], len(v))
+		}
+		if i == len(v) {
+			v = append(v, nil)
+		}
+		child, err := setOverride(v[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	default:
+		return nil, errors.Errorf("%s cannot be set in a value that is not an object or an array", path[0])
+	}
+}
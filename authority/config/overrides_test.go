@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    *Override
+		wantErr bool
+	}{
+		{"ok", "address=:443", &Override{Path: []string{"address"}, Value: ":443"}, false},
+		{"ok nested", "authority.claims.maxTLSCertDuration=48h", &Override{Path: []string{"authority", "claims", "maxTLSCertDuration"}, Value: "48h"}, false},
+		{"ok equals", "password=a=b", &Override{Path: []string{"password"}, Value: "a=b"}, false},
+		{"ok empty value", "password=", &Override{Path: []string{"password"}, Value: ""}, false},
+		{"fail no value", "address", nil, true},
+		{"fail no path", "=:443", nil, true},
+		{"fail empty element", "authority..claims=null", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOverride(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOverride() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOverride() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	got, err := EnvOverrides([]string{
+		"HOME=/root",
+		"STEP_CA_CONFIG_TLS__MINVERSION=1.3",
+		"STEP_CA_CONFIG_ADDRESS=:443",
+		"STEP_CA_TOKEN=token",
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, []*Override{
+		{Path: []string{"address"}, Value: ":443"},
+		{Path: []string{"tls", "minversion"}, Value: "1.3"},
+	}, got)
+
+	_, err = EnvOverrides([]string{"STEP_CA_CONFIG_TLS____MINVERSION=1.3"})
+	assert.NotNil(t, err)
+}
+
+func TestApplyOverrides(t *testing.T) {
+	data := []byte(`{"address":":443","dnsNames":["ca.smallstep.com"],"authority":{"provisioners":[{"type":"ACME","name":"acme"}],"claims":{"maxTLSCertDuration":"24h"}}}`)
+	tests := []struct {
+		name      string
+		overrides []*Override
+		want      string
+		wantErr   bool
+	}{
+		{"ok none", nil, string(data), false},
+		{"ok string", []*Override{{Path: []string{"address"}, Value: ":8443"}},
+			`{"address":":8443","authority":{"claims":{"maxTLSCertDuration":"24h"},"provisioners":[{"name":"acme","type":"ACME"}]},"dnsNames":["ca.smallstep.com"]}`, false},
+		{"ok json", []*Override{{Path: []string{"dnsNames"}, Value: `["ca.example.com","10.0.0.1"]`}, {Path: []string{"tls", "minVersion"}, Value: "1.3"}},
+			`{"address":":443","authority":{"claims":{"maxTLSCertDuration":"24h"},"provisioners":[{"name":"acme","type":"ACME"}]},"dnsNames":["ca.example.com","10.0.0.1"],"tls":{"minVersion":1.3}}`, false},
+		{"ok case-insensitive", []*Override{{Path: []string{"authority", "claims", "maxtlscertduration"}, Value: "48h"}},
+			`{"address":":443","authority":{"claims":{"maxTLSCertDuration":"48h"},"provisioners":[{"name":"acme","type":"ACME"}]},"dnsNames":["ca.smallstep.com"]}`, false},
+		{"ok array", []*Override{{Path: []string{"authority", "provisioners", "0", "name"}, Value: "acme-prod"}, {Path: []string{"dnsNames", "1"}, Value: "10.0.0.1"}},
+			`{"address":":443","authority":{"claims":{"maxTLSCertDuration":"24h"},"provisioners":[{"name":"acme-prod","type":"ACME"}]},"dnsNames":["ca.smallstep.com","10.0.0.1"]}`, false},
+		{"ok order", []*Override{{Path: []string{"address"}, Value: ":8443"}, {Path: []string{"address"}, Value: ":9443"}},
+			`{"address":":9443","authority":{"claims":{"maxTLSCertDuration":"24h"},"provisioners":[{"name":"acme","type":"ACME"}]},"dnsNames":["ca.smallstep.com"]}`, false},
+		{"fail index", []*Override{{Path: []string{"dnsNames", "2"}, Value: "10.0.0.1"}}, "", true},
+		{"fail not index", []*Override{{Path: []string{"dnsNames", "foo"}, Value: "10.0.0.1"}}, "", true},
+		{"fail scalar", []*Override{{Path: []string{"address", "port"}, Value: "443"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyOverrides(data, tt.overrides)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ApplyOverrides() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfiguration_overrides(t *testing.T) {
+	filename := writeConfiguration(t, `{"version":2,"address":":443","authority":{"claims":{"maxTLSCertDuration":"24h"}}}`)
+	defer os.Remove(filename)
+
+	c, err := LoadConfiguration(filename,
+		&Override{Path: []string{"authority", "claims", "maxtlscertduration"}, Value: "48h"},
+		&Override{Path: []string{"address"}, Value: ":8443"})
+	assert.FatalError(t, err)
+	assert.Equals(t, ":8443", c.Address)
+	assert.Equals(t, 48*time.Hour, c.AuthorityConfig.Claims.MaxTLSDur.Duration)
+
+	// Overrides are subject to the same rules as the configuration file.
+	_, err = LoadConfiguration(filename, &Override{Path: []string{"foo"}, Value: "bar"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/keyattest"
+)
+
+var (
+	// DefaultPIVPINPolicies are the PIN policies allowed by default in the PIV
+	// enrollment.
+	DefaultPIVPINPolicies = []string{keyattest.PolicyOnce, keyattest.PolicyAlways}
+	// DefaultPIVTouchPolicies are the touch policies allowed by default in the
+	// PIV enrollment.
+	DefaultPIVTouchPolicies = []string{keyattest.PolicyAlways, keyattest.PolicyCached}
+)
+
+// PIVConfig enables the enrollment of hardware-bound credentials, like the
+// certificates of the operators, with keys generated in a YubiKey. The
+// enrollment requires a PIV attestation of the key, signed by one of the
+// attestation roots, and a PIN and touch policy in the allowed lists.
+type PIVConfig struct {
+	// Provisioners is the list of provisioners that can authorize the
+	// enrollment. All the provisioners can if empty.
+	Provisioners []string `json:"provisioners,omitempty"`
+	// PINPolicies is the list of allowed PIN policies, "never", "once" or
+	// "always". Defaults to "once" and "always".
+	PINPolicies []string `json:"pinPolicies,omitempty"`
+	// TouchPolicies is the list of allowed touch policies, "never", "always"
+	// or "cached". Defaults to "always" and "cached".
+	TouchPolicies []string `json:"touchPolicies,omitempty"`
+}
+
+// Validate validates the PIV enrollment configuration.
+func (c *PIVConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, p := range c.Provisioners {
+		if p == "" {
+			return errors.New("piv.provisioners cannot contain an empty name")
+		}
+	}
+	for _, p := range c.PINPolicies {
+		switch p {
+		case keyattest.PolicyNever, keyattest.PolicyOnce, keyattest.PolicyAlways:
+		default:
+			return errors.Errorf("piv.pinPolicies contains an invalid policy '%s'", p)
+		}
+	}
+	for _, p := range c.TouchPolicies {
+		switch p {
+		case keyattest.PolicyNever, keyattest.PolicyAlways, keyattest.PolicyCached:
+		default:
+			return errors.Errorf("piv.touchPolicies contains an invalid policy '%s'", p)
+		}
+	}
+	return nil
+}
+
+// IsProvisionerAllowed returns true if the provisioner with the given name
+// can authorize the enrollment.
+func (c *PIVConfig) IsProvisionerAllowed(name string) bool {
+	if c == nil {
+		return false
+	}
+	if len(c.Provisioners) == 0 {
+		return true
+	}
+	return containsString(c.Provisioners, name)
+}
+
+// IsPINPolicyAllowed returns true if the given PIN policy is allowed.
+func (c *PIVConfig) IsPINPolicyAllowed(policy string) bool {
+	if c == nil || len(c.PINPolicies) == 0 {
+		return containsString(DefaultPIVPINPolicies, policy)
+	}
+	return containsString(c.PINPolicies, policy)
+}
+
+// IsTouchPolicyAllowed returns true if the given touch policy is allowed.
+func (c *PIVConfig) IsTouchPolicyAllowed(policy string) bool {
+	if c == nil || len(c.TouchPolicies) == 0 {
+		return containsString(DefaultPIVTouchPolicies, policy)
+	}
+	return containsString(c.TouchPolicies, policy)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
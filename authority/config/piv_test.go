@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestPIVConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *PIVConfig
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &PIVConfig{}, false},
+		{"ok", &PIVConfig{Provisioners: []string{"operators"}, PINPolicies: []string{"always"}, TouchPolicies: []string{"always", "cached"}}, false},
+		{"fail provisioner", &PIVConfig{Provisioners: []string{""}}, true},
+		{"fail pin", &PIVConfig{PINPolicies: []string{"cached"}}, true},
+		{"fail touch", &PIVConfig{TouchPolicies: []string{"once"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("PIVConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPIVConfig_IsAllowed(t *testing.T) {
+	var nilConfig *PIVConfig
+	assert.False(t, nilConfig.IsProvisionerAllowed("operators"))
+	assert.True(t, nilConfig.IsPINPolicyAllowed("once"))
+	assert.False(t, nilConfig.IsPINPolicyAllowed("never"))
+	assert.True(t, nilConfig.IsTouchPolicyAllowed("cached"))
+	assert.False(t, nilConfig.IsTouchPolicyAllowed("never"))
+
+	c := &PIVConfig{}
+	assert.True(t, c.IsProvisionerAllowed("operators"))
+	assert.True(t, c.IsPINPolicyAllowed("always"))
+	assert.False(t, c.IsPINPolicyAllowed(""))
+	assert.True(t, c.IsTouchPolicyAllowed("always"))
+	assert.False(t, c.IsTouchPolicyAllowed(""))
+
+	c = &PIVConfig{Provisioners: []string{"operators"}, PINPolicies: []string{"always"}, TouchPolicies: []string{"always"}}
+	assert.True(t, c.IsProvisionerAllowed("operators"))
+	assert.False(t, c.IsProvisionerAllowed("jwk"))
+	assert.True(t, c.IsPINPolicyAllowed("always"))
+	assert.False(t, c.IsPINPolicyAllowed("once"))
+	assert.True(t, c.IsTouchPolicyAllowed("always"))
+	assert.False(t, c.IsTouchPolicyAllowed("cached"))
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/publisher"
+)
+
+// DefaultPublisherCRLValidity is the default time until the next update of the
+// CRLs and OCSP responses uploaded by the publisher.
+const DefaultPublisherCRLValidity = 24 * time.Hour
+
+// PublisherConfig configures the upload of the CRL of the intermediate, the CA
+// certificates and, optionally, pre-signed OCSP responses to cloud object
+// storage, so the revocation data can be served from a CDN without exposing
+// the CA. The objects are uploaded when a certificate is revoked and before
+// the CRL expires.
+type PublisherConfig struct {
+	publisher.Options
+	// CRLValidity is the time until the next update of the CRL and the OCSP
+	// responses, it defaults to 24 hours. They are regenerated after half of
+	// this time.
+	CRLValidity *provisioner.Duration `json:"crlValidity,omitempty"`
+	// OCSP enables the upload of a pre-signed OCSP response for each valid or
+	// revoked certificate issued by the intermediate.
+	OCSP bool `json:"ocsp,omitempty"`
+}
+
+// Validate validates the publisher configuration.
+func (c *PublisherConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.CRLValidity != nil && c.CRLValidity.Duration < time.Minute:
+		return errors.New("publisher.crlValidity must be at least one minute")
+	default:
+		return c.Options.Validate()
+	}
+}
+
+// GetCRLValidity returns the time until the next update of the uploaded CRLs
+// and OCSP responses.
+func (c *PublisherConfig) GetCRLValidity() time.Duration {
+	if c == nil || c.CRLValidity == nil {
+		return DefaultPublisherCRLValidity
+	}
+	return c.CRLValidity.Duration
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/publisher"
+)
+
+func TestPublisherConfig_Validate(t *testing.T) {
+	s3 := publisher.Options{Type: publisher.AmazonS3, Bucket: "crl"}
+	tests := []struct {
+		name    string
+		config  *PublisherConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &PublisherConfig{Options: s3}, false},
+		{"ok validity", &PublisherConfig{Options: s3, CRLValidity: &provisioner.Duration{Duration: time.Hour}, OCSP: true}, false},
+		{"fail options", &PublisherConfig{Options: publisher.Options{Type: publisher.AmazonS3}}, true},
+		{"fail validity", &PublisherConfig{Options: s3, CRLValidity: &provisioner.Duration{Duration: time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("PublisherConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublisherConfig_GetCRLValidity(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *PublisherConfig
+		want   time.Duration
+	}{
+		{"nil", nil, DefaultPublisherCRLValidity},
+		{"default", &PublisherConfig{}, DefaultPublisherCRLValidity},
+		{"ok", &PublisherConfig{CRLValidity: &provisioner.Duration{Duration: time.Hour}}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetCRLValidity(); got != tt.want {
+				t.Errorf("PublisherConfig.GetCRLValidity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+// QuotaConfig contains the maximum number of active certificates, not expired
+// or revoked, that can be issued for the same identity. A zero value disables
+// the quota. Administrators can override the limit of a specific identity
+// using the admin API.
+type QuotaConfig struct {
+	// MaxActivePerSAN is the maximum number of active certificates for a
+	// subject alternative name.
+	MaxActivePerSAN int `json:"maxActivePerSAN,omitempty"`
+	// MaxActivePerAccount is the maximum number of active certificates
+	// requested by an account, e.g. an ACME account.
+	MaxActivePerAccount int `json:"maxActivePerAccount,omitempty"`
+	// MaxActivePerProvisioner is the maximum number of active certificates
+	// issued by a provisioner.
+	MaxActivePerProvisioner int `json:"maxActivePerProvisioner,omitempty"`
+}
+
+// Validate validates the quota configuration.
+func (c *QuotaConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxActivePerSAN < 0:
+		return errors.New("quotas.maxActivePerSAN cannot be negative")
+	case c.MaxActivePerAccount < 0:
+		return errors.New("quotas.maxActivePerAccount cannot be negative")
+	case c.MaxActivePerProvisioner < 0:
+		return errors.New("quotas.maxActivePerProvisioner cannot be negative")
+	default:
+		return nil
+	}
+}
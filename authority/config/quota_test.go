@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestQuotaConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *QuotaConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &QuotaConfig{}, false},
+		{"ok", &QuotaConfig{MaxActivePerSAN: 5, MaxActivePerAccount: 100, MaxActivePerProvisioner: 1000}, false},
+		{"fail san", &QuotaConfig{MaxActivePerSAN: -1}, true},
+		{"fail account", &QuotaConfig{MaxActivePerAccount: -1}, true},
+		{"fail provisioner", &QuotaConfig{MaxActivePerProvisioner: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("QuotaConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultRADIUSCRLValidity is the default time until the next update of the
+// CRLs exported for RADIUS servers.
+const DefaultRADIUSCRLValidity = 24 * time.Hour
+
+// RADIUSConfig configures the export of the CA certificates and the
+// certificate revocation list (CRL) of the intermediate in the formats used by
+// RADIUS servers in EAP-TLS deployments. The files are written in PEM for
+// FreeRADIUS and in DER for Microsoft NPS, and they are updated when a
+// certificate is revoked and before the CRL expires.
+type RADIUSConfig struct {
+	// Directory is the directory where the files are written. With leader
+	// election, only one replica writes the files, and the directory should be
+	// shared by all of them.
+	Directory string `json:"directory"`
+	// CRLValidity is the time until the next update of the CRL, it defaults to
+	// 24 hours. The CRL is regenerated after half of this time.
+	CRLValidity *provisioner.Duration `json:"crlValidity,omitempty"`
+}
+
+// Validate validates the RADIUS export configuration.
+func (c *RADIUSConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Directory == "":
+		return errors.New("radius.directory cannot be empty")
+	case c.CRLValidity != nil && c.CRLValidity.Duration < time.Minute:
+		return errors.New("radius.crlValidity must be at least one minute")
+	default:
+		return nil
+	}
+}
+
+// GetCRLValidity returns the time until the next update of the exported CRLs.
+func (c *RADIUSConfig) GetCRLValidity() time.Duration {
+	if c == nil || c.CRLValidity == nil {
+		return DefaultRADIUSCRLValidity
+	}
+	return c.CRLValidity.Duration
+}
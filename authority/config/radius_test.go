@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestRADIUSConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RADIUSConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &RADIUSConfig{Directory: "/etc/freeradius/certs"}, false},
+		{"ok validity", &RADIUSConfig{Directory: "/etc/freeradius/certs", CRLValidity: &provisioner.Duration{Duration: time.Hour}}, false},
+		{"fail directory", &RADIUSConfig{CRLValidity: &provisioner.Duration{Duration: time.Hour}}, true},
+		{"fail validity", &RADIUSConfig{Directory: "/etc/freeradius/certs", CRLValidity: &provisioner.Duration{Duration: time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RADIUSConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRADIUSConfig_GetCRLValidity(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RADIUSConfig
+		want   time.Duration
+	}{
+		{"nil", nil, DefaultRADIUSCRLValidity},
+		{"default", &RADIUSConfig{Directory: "certs"}, DefaultRADIUSCRLValidity},
+		{"ok", &RADIUSConfig{Directory: "certs", CRLValidity: &provisioner.Duration{Duration: time.Hour}}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetCRLValidity(); got != tt.want {
+				t.Errorf("RADIUSConfig.GetCRLValidity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RenewalConfig contains the policy applied to the renewal and rekey of
+// certificates using mTLS.
+type RenewalConfig struct {
+	// AllowedProvisioners is the list of names of the provisioners whose
+	// certificates can be renewed. If it's empty, the certificates of any
+	// provisioner can be renewed.
+	AllowedProvisioners []string `json:"allowedProvisioners,omitempty"`
+	// RequireSANMatch rejects a renewed certificate if its subject alternative
+	// names are not exactly the ones of the presented certificate.
+	RequireSANMatch bool `json:"requireSANMatch,omitempty"`
+	// AllowSANSubset allows a renewal with a CSR that requests a subset of the
+	// subject alternative names of the presented certificate, e.g. to drop
+	// decommissioned names.
+	AllowSANSubset bool `json:"allowSANSubset,omitempty"`
+	// AllowSANSuperset allows a renewal with a CSR that requests new subject
+	// alternative names in addition to the ones of the presented certificate.
+	// The new names are not authorized by a provisioner token, so they must
+	// match one of the AllowedAddedSANs. They also go through the approval
+	// options of the provisioner, the policy hooks and the issuance quotas.
+	AllowSANSuperset bool `json:"allowSANSuperset,omitempty"`
+	// AllowedAddedSANs is the list of names that a renewal can add, it's
+	// required if AllowSANSuperset is enabled. DNS names can start with a
+	// wildcard, "*.example.com" matches any subdomain of example.com, IP
+	// addresses can be CIDR ranges, and emails can be a domain,
+	// "@example.com" matches any address in example.com. URIs must match
+	// exactly.
+	AllowedAddedSANs []string `json:"allowedAddedSANs,omitempty"`
+}
+
+// Validate validates the renewal configuration.
+func (c *RenewalConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, name := range c.AllowedProvisioners {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("renewal.allowedProvisioners cannot contain an empty name")
+		}
+	}
+	if c.AllowSANSuperset && len(c.AllowedAddedSANs) == 0 {
+		return errors.New("renewal.allowedAddedSANs cannot be empty if renewal.allowSANSuperset is enabled")
+	}
+	for i, name := range c.AllowedAddedSANs {
+		switch {
+		case strings.TrimSpace(name) == "":
+			return errors.Errorf("renewal.allowedAddedSANs[%d] cannot be empty", i)
+		case strings.Contains(name, "://"), strings.Contains(name, "@"):
+		case strings.Contains(name, "/"):
+			if _, _, err := net.ParseCIDR(name); err != nil {
+				return errors.Errorf("renewal.allowedAddedSANs[%d] %q is not a valid CIDR", i, name)
+			}
+		case strings.Contains(strings.TrimPrefix(name, "*."), "*"):
+			return errors.Errorf("renewal.allowedAddedSANs[%d] %q is not valid, wildcards are only allowed as the first label", i, name)
+		}
+	}
+	return nil
+}
+
+// IsAllowedProvisioner returns true if the certificates of the provisioner with
+// the given name can be renewed.
+func (c *RenewalConfig) IsAllowedProvisioner(name string) bool {
+	if c == nil || len(c.AllowedProvisioners) == 0 {
+		return true
+	}
+	for _, s := range c.AllowedProvisioners {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSANSubsetAllowed returns true if a renewal can drop some of the subject
+// alternative names of a certificate.
+func (c *RenewalConfig) IsSANSubsetAllowed() bool {
+	return c != nil && c.AllowSANSubset
+}
+
+// IsSANSupersetAllowed returns true if a renewal can add new subject
+// alternative names to a certificate.
+func (c *RenewalConfig) IsSANSupersetAllowed() bool {
+	return c != nil && c.AllowSANSuperset && len(c.AllowedAddedSANs) > 0
+}
+
+// CheckAddedSANs returns an error if any of the subject alternative names of
+// the given certificate cannot be added in a renewal.
+func (c *RenewalConfig) CheckAddedSANs(added *x509.Certificate) error {
+	if !c.IsSANSupersetAllowed() {
+		return errors.New("renewal cannot add subject alternative names")
+	}
+	for _, name := range added.DNSNames {
+		if !c.isAllowedAddedSAN(func(pattern string) bool {
+			name, pattern = strings.ToLower(name), strings.ToLower(pattern)
+			if strings.HasPrefix(pattern, "*.") {
+				return strings.HasSuffix(name, pattern[1:]) && len(name) > len(pattern)-1
+			}
+			return name == pattern
+		}) {
+			return errors.Errorf("renewal cannot add the DNS name %s", name)
+		}
+	}
+	for _, email := range added.EmailAddresses {
+		if !c.isAllowedAddedSAN(func(pattern string) bool {
+			email, pattern = strings.ToLower(email), strings.ToLower(pattern)
+			if strings.HasPrefix(pattern, "@") {
+				return strings.HasSuffix(email, pattern) && len(email) > len(pattern)
+			}
+			return email == pattern
+		}) {
+			return errors.Errorf("renewal cannot add the email %s", email)
+		}
+	}
+	for _, ip := range added.IPAddresses {
+		if !c.isAllowedAddedSAN(func(pattern string) bool {
+			if _, ipNet, err := net.ParseCIDR(pattern); err == nil {
+				return ipNet.Contains(ip)
+			}
+			allowed := net.ParseIP(pattern)
+			return allowed != nil && allowed.Equal(ip)
+		}) {
+			return errors.Errorf("renewal cannot add the IP address %s", ip)
+		}
+	}
+	for _, u := range added.URIs {
+		if !c.isAllowedAddedSAN(func(pattern string) bool {
+			return u.String() == pattern
+		}) {
+			return errors.Errorf("renewal cannot add the URI %s", u)
+		}
+	}
+	return nil
+}
+
+func (c *RenewalConfig) isAllowedAddedSAN(match func(pattern string) bool) bool {
+	for _, pattern := range c.AllowedAddedSANs {
+		if match(pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestRenewalConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RenewalConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &RenewalConfig{}, false},
+		{"ok", &RenewalConfig{AllowedProvisioners: []string{"acme", "jane@example.com"}, RequireSANMatch: true}, false},
+		{"ok san policy", &RenewalConfig{AllowSANSubset: true, AllowSANSuperset: true, AllowedAddedSANs: []string{"*.example.com", "10.0.0.0/8", "@example.com", "spiffe://example.com/foo"}}, false},
+		{"fail empty name", &RenewalConfig{AllowedProvisioners: []string{"acme", " "}}, true},
+		{"fail superset without allowlist", &RenewalConfig{AllowSANSuperset: true}, true},
+		{"fail empty added san", &RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{""}}, true},
+		{"fail added san wildcard", &RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{"foo.*.example.com"}}, true},
+		{"fail added san cidr", &RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{"10.0.0.0/33"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RenewalConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenewalConfig_IsAllowedProvisioner(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RenewalConfig
+		want   bool
+	}{
+		{"nil", nil, true},
+		{"empty", &RenewalConfig{RequireSANMatch: true}, true},
+		{"allowed", &RenewalConfig{AllowedProvisioners: []string{"jane@example.com", "acme"}}, true},
+		{"not allowed", &RenewalConfig{AllowedProvisioners: []string{"jane@example.com"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsAllowedProvisioner("acme"); got != tt.want {
+				t.Errorf("RenewalConfig.IsAllowedProvisioner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenewalConfig_SANPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *RenewalConfig
+		wantSubset   bool
+		wantSuperset bool
+	}{
+		{"nil", nil, false, false},
+		{"empty", &RenewalConfig{}, false, false},
+		{"subset", &RenewalConfig{AllowSANSubset: true}, true, false},
+		{"superset", &RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{"example.com"}}, false, true},
+		{"superset without allowlist", &RenewalConfig{AllowSANSuperset: true}, false, false},
+		{"both", &RenewalConfig{AllowSANSubset: true, AllowSANSuperset: true, AllowedAddedSANs: []string{"example.com"}}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsSANSubsetAllowed(); got != tt.wantSubset {
+				t.Errorf("RenewalConfig.IsSANSubsetAllowed() = %v, want %v", got, tt.wantSubset)
+			}
+			if got := tt.config.IsSANSupersetAllowed(); got != tt.wantSuperset {
+				t.Errorf("RenewalConfig.IsSANSupersetAllowed() = %v, want %v", got, tt.wantSuperset)
+			}
+		})
+	}
+}
+
+func TestRenewalConfig_CheckAddedSANs(t *testing.T) {
+	mustURL := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	c := &RenewalConfig{
+		AllowSANSuperset: true,
+		AllowedAddedSANs: []string{"*.example.com", "example.org", "10.0.0.0/8", "192.168.1.1", "@example.com", "jane@example.org", "spiffe://example.com/foo"},
+	}
+	tests := []struct {
+		name    string
+		config  *RenewalConfig
+		added   *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", c, &x509.Certificate{
+			DNSNames:       []string{"foo.example.com", "Example.ORG"},
+			IPAddresses:    []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("192.168.1.1")},
+			EmailAddresses: []string{"joe@example.com", "jane@example.org"},
+			URIs:           []*url.URL{mustURL("spiffe://example.com/foo")},
+		}, false},
+		{"ok empty", c, &x509.Certificate{}, false},
+		{"fail nil", nil, &x509.Certificate{DNSNames: []string{"foo.example.com"}}, true},
+		{"fail superset", &RenewalConfig{AllowedAddedSANs: c.AllowedAddedSANs}, &x509.Certificate{DNSNames: []string{"foo.example.com"}}, true},
+		{"fail dns", c, &x509.Certificate{DNSNames: []string{"example.com"}}, true},
+		{"fail dns suffix", c, &x509.Certificate{DNSNames: []string{"fooexample.com"}}, true},
+		{"fail ip", c, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("192.168.1.2")}}, true},
+		{"fail email", c, &x509.Certificate{EmailAddresses: []string{"joe@example.org"}}, true},
+		{"fail uri", c, &x509.Certificate{URIs: []*url.URL{mustURL("spiffe://example.com/bar")}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.CheckAddedSANs(tt.added); (err != nil) != tt.wantErr {
+				t.Errorf("RenewalConfig.CheckAddedSANs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultMaxRequestBodySize is the default maximum size in bytes of the
+	// body of a request.
+	DefaultMaxRequestBodySize int64 = 1 << 20
+	// DefaultMaxJWSPayloadSize is the default maximum size in bytes of the
+	// payload of the JWS in an ACME request.
+	DefaultMaxJWSPayloadSize int64 = 64 << 10
+)
+
+// RequestLimitsConfig limits the size of the requests, so a client cannot make
+// the CA buffer huge bodies in memory. Requests over the limits get a 413
+// Request Entity Too Large response.
+type RequestLimitsConfig struct {
+	// MaxBodySize is the maximum size in bytes of the body of a request. It
+	// defaults to 1MiB.
+	MaxBodySize int64 `json:"maxBodySize,omitempty"`
+	// MaxJWSPayloadSize is the maximum size in bytes of the decoded payload of
+	// the JWS in an ACME request. It defaults to 64KiB.
+	MaxJWSPayloadSize int64 `json:"maxJWSPayloadSize,omitempty"`
+}
+
+// Validate validates the request limits configuration.
+func (c *RequestLimitsConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxBodySize < 0:
+		return errors.New("requestLimits.maxBodySize cannot be negative")
+	case c.MaxJWSPayloadSize < 0:
+		return errors.New("requestLimits.maxJWSPayloadSize cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetMaxBodySize returns the maximum size in bytes of the body of a request.
+func (c *RequestLimitsConfig) GetMaxBodySize() int64 {
+	if c == nil || c.MaxBodySize == 0 {
+		return DefaultMaxRequestBodySize
+	}
+	return c.MaxBodySize
+}
+
+// GetMaxJWSPayloadSize returns the maximum size in bytes of the payload of the
+// JWS in an ACME request.
+func (c *RequestLimitsConfig) GetMaxJWSPayloadSize() int64 {
+	if c == nil || c.MaxJWSPayloadSize == 0 {
+		return DefaultMaxJWSPayloadSize
+	}
+	return c.MaxJWSPayloadSize
+}
@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestRequestLimitsConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *RequestLimitsConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &RequestLimitsConfig{}, false},
+		{"ok", &RequestLimitsConfig{MaxBodySize: 1024, MaxJWSPayloadSize: 512}, false},
+		{"fail maxBodySize", &RequestLimitsConfig{MaxBodySize: -1}, true},
+		{"fail maxJWSPayloadSize", &RequestLimitsConfig{MaxJWSPayloadSize: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RequestLimitsConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestLimitsConfig_Get(t *testing.T) {
+	var nilConfig *RequestLimitsConfig
+	if got := nilConfig.GetMaxBodySize(); got != DefaultMaxRequestBodySize {
+		t.Errorf("RequestLimitsConfig.GetMaxBodySize() = %d, want %d", got, DefaultMaxRequestBodySize)
+	}
+	if got := nilConfig.GetMaxJWSPayloadSize(); got != DefaultMaxJWSPayloadSize {
+		t.Errorf("RequestLimitsConfig.GetMaxJWSPayloadSize() = %d, want %d", got, DefaultMaxJWSPayloadSize)
+	}
+
+	c := &RequestLimitsConfig{MaxBodySize: 1024, MaxJWSPayloadSize: 512}
+	if got := c.GetMaxBodySize(); got != 1024 {
+		t.Errorf("RequestLimitsConfig.GetMaxBodySize() = %d, want 1024", got)
+	}
+	if got := c.GetMaxJWSPayloadSize(); got != 512 {
+		t.Errorf("RequestLimitsConfig.GetMaxJWSPayloadSize() = %d, want 512", got)
+	}
+}
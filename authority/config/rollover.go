@@ -0,0 +1,48 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RootRolloverConfig configures the distribution of the roots that will
+// replace the current roots of the authority. The authority publishes a
+// manifest with the current and next roots, signed by the current root, so
+// clients can trust the next roots before they are used.
+type RootRolloverConfig struct {
+	// RootKey is the key of the current root used to sign the manifest, it
+	// is decrypted with the password of the authority.
+	RootKey string `json:"rootKey"`
+	// NextRoots is the list of roots that will replace the current roots.
+	NextRoots []NextRoot `json:"nextRoots"`
+}
+
+// NextRoot is a root that will replace the current roots at the given time.
+type NextRoot struct {
+	// Root is the path to the root certificate.
+	Root string `json:"root"`
+	// ActivatesAt is the time the authority starts using the root.
+	ActivatesAt time.Time `json:"activatesAt"`
+}
+
+// Validate validates the root rollover configuration.
+func (c *RootRolloverConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.RootKey == "":
+		return errors.New("rootRollover.rootKey cannot be empty")
+	case len(c.NextRoots) == 0:
+		return errors.New("rootRollover.nextRoots cannot be empty")
+	}
+	for i, r := range c.NextRoots {
+		switch {
+		case r.Root == "":
+			return errors.Errorf("rootRollover.nextRoots[%d].root cannot be empty", i)
+		case r.ActivatesAt.IsZero():
+			return errors.Errorf("rootRollover.nextRoots[%d].activatesAt cannot be empty", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRootRolloverConfig_Validate(t *testing.T) {
+	activatesAt := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		config  *RootRolloverConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &RootRolloverConfig{RootKey: "secrets/root_ca_key", NextRoots: []NextRoot{{Root: "certs/root_ca_2.crt", ActivatesAt: activatesAt}}}, false},
+		{"fail root key", &RootRolloverConfig{NextRoots: []NextRoot{{Root: "certs/root_ca_2.crt", ActivatesAt: activatesAt}}}, true},
+		{"fail next roots", &RootRolloverConfig{RootKey: "secrets/root_ca_key"}, true},
+		{"fail root", &RootRolloverConfig{RootKey: "secrets/root_ca_key", NextRoots: []NextRoot{{ActivatesAt: activatesAt}}}, true},
+		{"fail activatesAt", &RootRolloverConfig{RootKey: "secrets/root_ca_key", NextRoots: []NextRoot{{Root: "certs/root_ca_2.crt"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RootRolloverConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
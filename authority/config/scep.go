@@ -0,0 +1,79 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// DefaultSCEPRACommonName is the default common name of the SCEP
+	// registration authority certificates.
+	DefaultSCEPRACommonName = "Step SCEP RA"
+	// DefaultSCEPRADuration is the default validity of the SCEP registration
+	// authority certificates.
+	DefaultSCEPRADuration = 7 * 24 * time.Hour
+)
+
+// SCEPConfig contains the global options of the SCEP provisioners.
+type SCEPConfig struct {
+	// RA enables a registration authority certificate, issued by the
+	// intermediate, that will be used to sign and decrypt SCEP messages
+	// instead of the intermediate key.
+	RA *SCEPRAConfig `json:"ra,omitempty"`
+}
+
+// SCEPRAConfig contains the options of the SCEP registration authority
+// certificate. If a certificate and key are configured they will be used
+// as they are. Otherwise, the key is generated by the CA, stored in the
+// database, and the certificate is rotated after two thirds of its lifetime.
+type SCEPRAConfig struct {
+	CommonName  string                `json:"commonName,omitempty"`
+	Duration    *provisioner.Duration `json:"duration,omitempty"`
+	Certificate string                `json:"crt,omitempty"`
+	Key         string                `json:"key,omitempty"`
+}
+
+// Validate validates the SCEP configuration.
+func (c *SCEPConfig) Validate() error {
+	switch {
+	case c == nil || c.RA == nil:
+		return nil
+	case c.RA.Duration != nil && c.RA.Duration.Duration < 5*time.Minute:
+		return errors.New("scep.ra.duration must be at least 5m")
+	case c.RA.Certificate == "" && c.RA.Key != "":
+		return errors.New("scep.ra.crt cannot be empty if scep.ra.key is set")
+	case c.RA.Certificate != "" && c.RA.Key == "":
+		return errors.New("scep.ra.key cannot be empty if scep.ra.crt is set")
+	default:
+		return nil
+	}
+}
+
+// GetRA returns the registration authority configuration, or nil if it's not
+// enabled.
+func (c *SCEPConfig) GetRA() *SCEPRAConfig {
+	if c == nil {
+		return nil
+	}
+	return c.RA
+}
+
+// GetCommonName returns the common name of the registration authority
+// certificate.
+func (c *SCEPRAConfig) GetCommonName() string {
+	if c.CommonName == "" {
+		return DefaultSCEPRACommonName
+	}
+	return c.CommonName
+}
+
+// GetDuration returns the validity of the registration authority
+// certificate.
+func (c *SCEPRAConfig) GetDuration() time.Duration {
+	if c.Duration == nil {
+		return DefaultSCEPRADuration
+	}
+	return c.Duration.Duration
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestSCEPConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *SCEPConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &SCEPConfig{}, false},
+		{"ok ra", &SCEPConfig{RA: &SCEPRAConfig{}}, false},
+		{"ok ra duration", &SCEPConfig{RA: &SCEPRAConfig{Duration: &provisioner.Duration{Duration: time.Hour}}}, false},
+		{"ok ra key", &SCEPConfig{RA: &SCEPRAConfig{Certificate: "ra.crt", Key: "ra.key"}}, false},
+		{"fail ra duration", &SCEPConfig{RA: &SCEPRAConfig{Duration: &provisioner.Duration{Duration: time.Minute}}}, true},
+		{"fail ra crt", &SCEPConfig{RA: &SCEPRAConfig{Key: "ra.key"}}, true},
+		{"fail ra key", &SCEPConfig{RA: &SCEPRAConfig{Certificate: "ra.crt"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SCEPConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSCEPConfig_GetRA(t *testing.T) {
+	var c *SCEPConfig
+	if ra := c.GetRA(); ra != nil {
+		t.Errorf("SCEPConfig.GetRA() = %v, want nil", ra)
+	}
+
+	c = &SCEPConfig{RA: &SCEPRAConfig{}}
+	ra := c.GetRA()
+	if got := ra.GetCommonName(); got != DefaultSCEPRACommonName {
+		t.Errorf("SCEPRAConfig.GetCommonName() = %s, want %s", got, DefaultSCEPRACommonName)
+	}
+	if got := ra.GetDuration(); got != DefaultSCEPRADuration {
+		t.Errorf("SCEPRAConfig.GetDuration() = %v, want %v", got, DefaultSCEPRADuration)
+	}
+
+	c = &SCEPConfig{RA: &SCEPRAConfig{CommonName: "SCEP RA", Duration: &provisioner.Duration{Duration: time.Hour}}}
+	ra = c.GetRA()
+	if got := ra.GetCommonName(); got != "SCEP RA" {
+		t.Errorf("SCEPRAConfig.GetCommonName() = %s, want SCEP RA", got)
+	}
+	if got := ra.GetDuration(); got != time.Hour {
+		t.Errorf("SCEPRAConfig.GetDuration() = %v, want %v", got, time.Hour)
+	}
+}
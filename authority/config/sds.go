@@ -0,0 +1,54 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSDSWorkloadSecretName is the default name of the secret used to
+	// serve the workload certificate and key.
+	DefaultSDSWorkloadSecretName = "default"
+	// DefaultSDSRootsSecretName is the default name of the secret used to serve
+	// the trust bundle.
+	DefaultSDSRootsSecretName = "ROOTCA"
+)
+
+// SDSConfig contains the configuration of the secret discovery service (SDS)
+// used by Envoy and Istio sidecars to get workload certificates and the trust
+// bundle. SDS is served using the REST-JSON transport in the main address
+// and, if the gRPC address is configured, using the gRPC streaming API.
+type SDSConfig struct {
+	// WorkloadSecretName is the name of the secret with the workload
+	// certificate. It defaults to "default".
+	WorkloadSecretName string `json:"workloadSecretName,omitempty"`
+	// RootsSecretName is the name of the secret with the trust bundle. It
+	// defaults to "ROOTCA".
+	RootsSecretName string `json:"rootsSecretName,omitempty"`
+	// IncludeFederatedRoots adds the federated roots to the trust bundle.
+	IncludeFederatedRoots bool `json:"includeFederatedRoots,omitempty"`
+}
+
+// Init sets the default names if they are not set.
+func (c *SDSConfig) Init() {
+	if c == nil {
+		return
+	}
+	if c.WorkloadSecretName == "" {
+		c.WorkloadSecretName = DefaultSDSWorkloadSecretName
+	}
+	if c.RootsSecretName == "" {
+		c.RootsSecretName = DefaultSDSRootsSecretName
+	}
+}
+
+// Validate validates the SDS configuration.
+func (c *SDSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	c.Init()
+	if c.WorkloadSecretName == c.RootsSecretName {
+		return errors.New("sds.workloadSecretName and sds.rootsSecretName cannot be the same")
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ServerCertificateConfig configures a certificate presented by the CA server
+// to the clients that request one of its server names using SNI. The
+// certificate is issued and renewed by the authority, or it is loaded from
+// files if Certificate and Key are set. Multiple certificates with the same
+// server names can be configured, e.g. with EC and RSA keys, and the first one
+// supported by the client is presented.
+type ServerCertificateConfig struct {
+	// ServerNames are the names requested by the clients. A name can start
+	// with a wildcard label, e.g. *.example.com.
+	ServerNames []string `json:"serverNames"`
+	// DNSNames are the SANs of the certificate issued by the authority. They
+	// default to the server names.
+	DNSNames []string `json:"dnsNames,omitempty"`
+	// KeyType is the type of the key of the certificate issued by the
+	// authority, EC or RSA. It defaults to EC.
+	KeyType string `json:"keyType,omitempty"`
+	// Certificate is the file with the certificate chain of a certificate not
+	// issued by the authority, e.g. a certificate issued by a public CA. The
+	// files are read again when the CA is reloaded.
+	Certificate string `json:"crt,omitempty"`
+	// Key is the file with the private key of Certificate.
+	Key string `json:"key,omitempty"`
+}
+
+// Validate validates the server certificate configuration.
+func (c *ServerCertificateConfig) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("serverCertificates cannot contain an empty certificate")
+	case len(c.ServerNames) == 0:
+		return errors.New("serverCertificates.serverNames cannot be empty")
+	case (c.Certificate == "") != (c.Key == ""):
+		return errors.New("serverCertificates.crt and serverCertificates.key must be set together")
+	case c.Certificate != "" && (len(c.DNSNames) > 0 || c.KeyType != ""):
+		return errors.New("serverCertificates.dnsNames and serverCertificates.keyType cannot be used with serverCertificates.crt")
+	}
+	for _, name := range c.ServerNames {
+		if name == "" || strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return errors.Errorf("serverCertificates.serverNames '%s' is not valid", name)
+		}
+	}
+	for _, name := range c.DNSNames {
+		if name == "" {
+			return errors.New("serverCertificates.dnsNames cannot contain empty names")
+		}
+	}
+	switch strings.ToUpper(c.KeyType) {
+	case "", "EC", "RSA":
+	default:
+		return errors.Errorf("serverCertificates.keyType '%s' is not supported", c.KeyType)
+	}
+	return nil
+}
+
+// GetDNSNames returns the SANs of the certificate issued by the authority.
+func (c *ServerCertificateConfig) GetDNSNames() []string {
+	if len(c.DNSNames) > 0 {
+		return c.DNSNames
+	}
+	return c.ServerNames
+}
+
+// MatchServerName returns true if the given server name, sent by a client
+// using SNI, matches one of the server names.
+func (c *ServerCertificateConfig) MatchServerName(serverName string) bool {
+	serverName = strings.TrimSuffix(serverName, ".")
+	for _, name := range c.ServerNames {
+		if strings.EqualFold(name, serverName) {
+			return true
+		}
+		if strings.HasPrefix(name, "*.") {
+			i := strings.Index(serverName, ".")
+			if i > 0 && strings.EqualFold(name[1:], serverName[i:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
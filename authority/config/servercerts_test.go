@@ -0,0 +1,69 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServerCertificateConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *ServerCertificateConfig
+		wantErr bool
+	}{
+		{"ok", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}}, false},
+		{"ok rsa", &ServerCertificateConfig{ServerNames: []string{"ca.example.com", "*.ca.example.com"}, DNSNames: []string{"ca.example.com", "*.ca.example.com", "10.0.0.1"}, KeyType: "RSA"}, false},
+		{"ok files", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}, Certificate: "public.crt", Key: "public.key"}, false},
+		{"fail nil", nil, true},
+		{"fail serverNames", &ServerCertificateConfig{}, true},
+		{"fail empty serverName", &ServerCertificateConfig{ServerNames: []string{""}}, true},
+		{"fail wildcard", &ServerCertificateConfig{ServerNames: []string{"ca.*.example.com"}}, true},
+		{"fail empty dnsName", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}, DNSNames: []string{""}}, true},
+		{"fail keyType", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}, KeyType: "OKP"}, true},
+		{"fail crt", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}, Certificate: "public.crt"}, true},
+		{"fail key", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}, Key: "public.key"}, true},
+		{"fail files keyType", &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}, Certificate: "public.crt", Key: "public.key", KeyType: "RSA"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ServerCertificateConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerCertificateConfig_GetDNSNames(t *testing.T) {
+	c := &ServerCertificateConfig{ServerNames: []string{"ca.example.com"}}
+	if got := c.GetDNSNames(); !reflect.DeepEqual(got, []string{"ca.example.com"}) {
+		t.Errorf("ServerCertificateConfig.GetDNSNames() = %v", got)
+	}
+	c.DNSNames = []string{"ca.example.com", "10.0.0.1"}
+	if got := c.GetDNSNames(); !reflect.DeepEqual(got, []string{"ca.example.com", "10.0.0.1"}) {
+		t.Errorf("ServerCertificateConfig.GetDNSNames() = %v", got)
+	}
+}
+
+func TestServerCertificateConfig_MatchServerName(t *testing.T) {
+	c := &ServerCertificateConfig{ServerNames: []string{"ca.example.com", "*.ca.internal"}}
+	tests := []struct {
+		serverName string
+		want       bool
+	}{
+		{"ca.example.com", true},
+		{"CA.Example.COM", true},
+		{"ca.example.com.", true},
+		{"foo.ca.internal", true},
+		{"ca.internal", false},
+		{"foo.bar.ca.internal", false},
+		{"example.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			if got := c.MatchServerName(tt.serverName); got != tt.want {
+				t.Errorf("ServerCertificateConfig.MatchServerName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+var (
+	// DefaultSignQueueSize is the default maximum number of sign requests
+	// waiting for a worker.
+	DefaultSignQueueSize = 256
+	// DefaultSignQueueMaxWait is the default maximum time a sign request waits
+	// for a worker.
+	DefaultSignQueueMaxWait = 5 * time.Second
+	// DefaultSignQueueRetryAfter is the default time clients are asked to wait
+	// before retrying a rejected sign request.
+	DefaultSignQueueRetryAfter = time.Second
+)
+
+// SignQueueConfig limits the number of sign, renew and rekey operations
+// running at the same time. Requests that cannot run right away wait in a
+// bounded queue, and once the queue is full, or a request waits longer than
+// the maximum time, they get a 503 Service Unavailable response with a
+// Retry-After header. The queue is disabled by default.
+type SignQueueConfig struct {
+	// Workers is the maximum number of operations running at the same time.
+	// It defaults to the number of CPUs.
+	Workers int `json:"workers,omitempty"`
+	// QueueSize is the maximum number of requests waiting for a worker. It
+	// defaults to 256.
+	QueueSize int `json:"queueSize,omitempty"`
+	// MaxWait is the maximum time a request waits for a worker. It defaults to
+	// 5s.
+	MaxWait *provisioner.Duration `json:"maxWait,omitempty"`
+	// RetryAfter is the time sent in the Retry-After header of the rejected
+	// requests. It defaults to 1s.
+	RetryAfter *provisioner.Duration `json:"retryAfter,omitempty"`
+}
+
+// Validate validates the sign queue configuration.
+func (c *SignQueueConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Workers < 0:
+		return errors.New("signQueue.workers cannot be negative")
+	case c.QueueSize < 0:
+		return errors.New("signQueue.queueSize cannot be negative")
+	case c.MaxWait != nil && c.MaxWait.Duration <= 0:
+		return errors.New("signQueue.maxWait must be greater than 0")
+	case c.RetryAfter != nil && c.RetryAfter.Duration <= 0:
+		return errors.New("signQueue.retryAfter must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// GetWorkers returns the maximum number of operations running at the same
+// time.
+func (c *SignQueueConfig) GetWorkers() int {
+	if c == nil || c.Workers == 0 {
+		return runtime.NumCPU()
+	}
+	return c.Workers
+}
+
+// GetQueueSize returns the maximum number of requests waiting for a worker.
+func (c *SignQueueConfig) GetQueueSize() int {
+	if c == nil || c.QueueSize == 0 {
+		return DefaultSignQueueSize
+	}
+	return c.QueueSize
+}
+
+// GetMaxWait returns the maximum time a request waits for a worker.
+func (c *SignQueueConfig) GetMaxWait() time.Duration {
+	if c == nil || c.MaxWait == nil {
+		return DefaultSignQueueMaxWait
+	}
+	return c.MaxWait.Duration
+}
+
+// GetRetryAfter returns the time sent in the Retry-After header of the
+// rejected requests.
+func (c *SignQueueConfig) GetRetryAfter() time.Duration {
+	if c == nil || c.RetryAfter == nil {
+		return DefaultSignQueueRetryAfter
+	}
+	return c.RetryAfter.Duration
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestSignQueueConfig_Validate(t *testing.T) {
+	second := &provisioner.Duration{Duration: time.Second}
+	tests := []struct {
+		name    string
+		config  *SignQueueConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &SignQueueConfig{}, false},
+		{"ok", &SignQueueConfig{Workers: 4, QueueSize: 10, MaxWait: second, RetryAfter: second}, false},
+		{"fail workers", &SignQueueConfig{Workers: -1}, true},
+		{"fail queueSize", &SignQueueConfig{QueueSize: -1}, true},
+		{"fail maxWait", &SignQueueConfig{MaxWait: &provisioner.Duration{}}, true},
+		{"fail retryAfter", &SignQueueConfig{RetryAfter: &provisioner.Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SignQueueConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignQueueConfig_Get(t *testing.T) {
+	var nilConfig *SignQueueConfig
+	if got := nilConfig.GetWorkers(); got != runtime.NumCPU() {
+		t.Errorf("SignQueueConfig.GetWorkers() = %d, want %d", got, runtime.NumCPU())
+	}
+	if got := nilConfig.GetQueueSize(); got != DefaultSignQueueSize {
+		t.Errorf("SignQueueConfig.GetQueueSize() = %d, want %d", got, DefaultSignQueueSize)
+	}
+	if got := nilConfig.GetMaxWait(); got != DefaultSignQueueMaxWait {
+		t.Errorf("SignQueueConfig.GetMaxWait() = %v, want %v", got, DefaultSignQueueMaxWait)
+	}
+	if got := nilConfig.GetRetryAfter(); got != DefaultSignQueueRetryAfter {
+		t.Errorf("SignQueueConfig.GetRetryAfter() = %v, want %v", got, DefaultSignQueueRetryAfter)
+	}
+
+	c := &SignQueueConfig{
+		Workers:    2,
+		QueueSize:  10,
+		MaxWait:    &provisioner.Duration{Duration: 3 * time.Second},
+		RetryAfter: &provisioner.Duration{Duration: 4 * time.Second},
+	}
+	if got := c.GetWorkers(); got != 2 {
+		t.Errorf("SignQueueConfig.GetWorkers() = %d, want 2", got)
+	}
+	if got := c.GetQueueSize(); got != 10 {
+		t.Errorf("SignQueueConfig.GetQueueSize() = %d, want 10", got)
+	}
+	if got := c.GetMaxWait(); got != 3*time.Second {
+		t.Errorf("SignQueueConfig.GetMaxWait() = %v, want %v", got, 3*time.Second)
+	}
+	if got := c.GetRetryAfter(); got != 4*time.Second {
+		t.Errorf("SignQueueConfig.GetRetryAfter() = %v, want %v", got, 4*time.Second)
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+// StartupConfig configures the initialization of the authority.
+type StartupConfig struct {
+	// LazyKeys starts the authority without waiting for the X.509
+	// intermediate key to be loaded from the key manager. Until the key is
+	// loaded, the health endpoint and the sign, renew and rekey requests fail
+	// with a 503 Service Unavailable error.
+	LazyKeys bool `json:"lazyKeys,omitempty"`
+	// VerifyIntermediate fails the startup and the reloads of the authority
+	// if the X.509 intermediate does not chain to the roots, is not a CA
+	// with the certSign key usage, or is not currently valid.
+	VerifyIntermediate bool `json:"verifyIntermediate,omitempty"`
+	// CheckIntermediateRevocation verifies the intermediate and also checks
+	// that it is not revoked using its OCSP servers or CRL distribution
+	// points.
+	CheckIntermediateRevocation bool `json:"checkIntermediateRevocation,omitempty"`
+}
+
+// IsLazyKeys returns true if the X.509 intermediate key is loaded after the
+// authority starts.
+func (c *StartupConfig) IsLazyKeys() bool {
+	return c != nil && c.LazyKeys
+}
+
+// IsVerifyIntermediate returns true if the X.509 intermediate must be verified
+// when the authority starts.
+func (c *StartupConfig) IsVerifyIntermediate() bool {
+	return c != nil && (c.VerifyIntermediate || c.CheckIntermediateRevocation)
+}
+
+// IsCheckIntermediateRevocation returns true if the revocation status of the
+// X.509 intermediate must be checked when the authority starts.
+func (c *StartupConfig) IsCheckIntermediateRevocation() bool {
+	return c != nil && c.CheckIntermediateRevocation
+}
@@ -0,0 +1,46 @@
+package config
+
+import "testing"
+
+func TestStartupConfig_IsLazyKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *StartupConfig
+		want   bool
+	}{
+		{"nil", nil, false},
+		{"empty", &StartupConfig{}, false},
+		{"lazy", &StartupConfig{LazyKeys: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsLazyKeys(); got != tt.want {
+				t.Errorf("StartupConfig.IsLazyKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartupConfig_IsVerifyIntermediate(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *StartupConfig
+		wantVerify     bool
+		wantRevocation bool
+	}{
+		{"nil", nil, false, false},
+		{"empty", &StartupConfig{}, false, false},
+		{"verify", &StartupConfig{VerifyIntermediate: true}, true, false},
+		{"revocation", &StartupConfig{CheckIntermediateRevocation: true}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsVerifyIntermediate(); got != tt.wantVerify {
+				t.Errorf("StartupConfig.IsVerifyIntermediate() = %v, want %v", got, tt.wantVerify)
+			}
+			if got := tt.config.IsCheckIntermediateRevocation(); got != tt.wantRevocation {
+				t.Errorf("StartupConfig.IsCheckIntermediateRevocation() = %v, want %v", got, tt.wantRevocation)
+			}
+		})
+	}
+}
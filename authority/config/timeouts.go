@@ -0,0 +1,83 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultMaxPendingCalls is the default maximum number of database and key
+// manager calls running at the same time.
+var DefaultMaxPendingCalls = 1024
+
+// TimeoutsConfig configures the time the sign, renew and revoke operations wait
+// for the database and the key manager, so a hung call, like one to an HSM,
+// fails the request instead of blocking it forever. Calls that time out keep
+// running in the background, and new calls fail once the maximum number of
+// pending calls is reached.
+type TimeoutsConfig struct {
+	// Sign is the timeout of the sign operations. No timeout is used by
+	// default.
+	Sign *provisioner.Duration `json:"sign,omitempty"`
+	// Renew is the timeout of the renew and rekey operations. No timeout is
+	// used by default.
+	Renew *provisioner.Duration `json:"renew,omitempty"`
+	// Revoke is the timeout of the revoke operations. No timeout is used by
+	// default.
+	Revoke *provisioner.Duration `json:"revoke,omitempty"`
+	// MaxPendingCalls is the maximum number of calls running at the same
+	// time. It defaults to 1024.
+	MaxPendingCalls int `json:"maxPendingCalls,omitempty"`
+}
+
+// Validate validates the timeouts configuration.
+func (c *TimeoutsConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Sign != nil && c.Sign.Duration <= 0:
+		return errors.New("timeouts.sign must be greater than 0")
+	case c.Renew != nil && c.Renew.Duration <= 0:
+		return errors.New("timeouts.renew must be greater than 0")
+	case c.Revoke != nil && c.Revoke.Duration <= 0:
+		return errors.New("timeouts.revoke must be greater than 0")
+	case c.MaxPendingCalls < 0:
+		return errors.New("timeouts.maxPendingCalls cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetSign returns the timeout of the sign operations, 0 if there is none.
+func (c *TimeoutsConfig) GetSign() time.Duration {
+	if c == nil || c.Sign == nil {
+		return 0
+	}
+	return c.Sign.Duration
+}
+
+// GetRenew returns the timeout of the renew operations, 0 if there is none.
+func (c *TimeoutsConfig) GetRenew() time.Duration {
+	if c == nil || c.Renew == nil {
+		return 0
+	}
+	return c.Renew.Duration
+}
+
+// GetRevoke returns the timeout of the revoke operations, 0 if there is none.
+func (c *TimeoutsConfig) GetRevoke() time.Duration {
+	if c == nil || c.Revoke == nil {
+		return 0
+	}
+	return c.Revoke.Duration
+}
+
+// GetMaxPendingCalls returns the maximum number of calls running at the same
+// time.
+func (c *TimeoutsConfig) GetMaxPendingCalls() int {
+	if c == nil || c.MaxPendingCalls == 0 {
+		return DefaultMaxPendingCalls
+	}
+	return c.MaxPendingCalls
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestTimeoutsConfig_Validate(t *testing.T) {
+	minute := &provisioner.Duration{Duration: time.Minute}
+	tests := []struct {
+		name    string
+		config  *TimeoutsConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &TimeoutsConfig{}, false},
+		{"ok", &TimeoutsConfig{Sign: minute, Renew: minute, Revoke: minute, MaxPendingCalls: 10}, false},
+		{"fail sign", &TimeoutsConfig{Sign: &provisioner.Duration{}}, true},
+		{"fail renew", &TimeoutsConfig{Renew: &provisioner.Duration{Duration: -time.Second}}, true},
+		{"fail revoke", &TimeoutsConfig{Revoke: &provisioner.Duration{}}, true},
+		{"fail maxPendingCalls", &TimeoutsConfig{MaxPendingCalls: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TimeoutsConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimeoutsConfig_Get(t *testing.T) {
+	var nilConfig *TimeoutsConfig
+	if nilConfig.GetSign() != 0 || nilConfig.GetRenew() != 0 || nilConfig.GetRevoke() != 0 {
+		t.Error("TimeoutsConfig timeouts of nil config are not 0")
+	}
+	if got := nilConfig.GetMaxPendingCalls(); got != DefaultMaxPendingCalls {
+		t.Errorf("TimeoutsConfig.GetMaxPendingCalls() = %d, want %d", got, DefaultMaxPendingCalls)
+	}
+
+	c := &TimeoutsConfig{
+		Sign:            &provisioner.Duration{Duration: time.Second},
+		Renew:           &provisioner.Duration{Duration: 2 * time.Second},
+		Revoke:          &provisioner.Duration{Duration: 3 * time.Second},
+		MaxPendingCalls: 10,
+	}
+	if got := c.GetSign(); got != time.Second {
+		t.Errorf("TimeoutsConfig.GetSign() = %v, want %v", got, time.Second)
+	}
+	if got := c.GetRenew(); got != 2*time.Second {
+		t.Errorf("TimeoutsConfig.GetRenew() = %v, want %v", got, 2*time.Second)
+	}
+	if got := c.GetRevoke(); got != 3*time.Second {
+		t.Errorf("TimeoutsConfig.GetRevoke() = %v, want %v", got, 3*time.Second)
+	}
+	if got := c.GetMaxPendingCalls(); got != 10 {
+		t.Errorf("TimeoutsConfig.GetMaxPendingCalls() = %d, want 10", got)
+	}
+}
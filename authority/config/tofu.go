@@ -0,0 +1,48 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// TOFUConfig contains the configuration of the trust on first use enrollment
+// endpoint. The first certificate for an identifier not seen before is issued
+// without any other authentication, and the following requests for the same
+// identifier must be authenticated with the last certificate issued for it.
+type TOFUConfig struct {
+	// AllowedIdentifiers is the list of identifiers that can be enrolled. An
+	// identifier starting with "*." will match any subdomain of it.
+	AllowedIdentifiers []string `json:"allowedIdentifiers"`
+	// Duration is the validity of the certificates, if not set the default
+	// TLS certificate duration will be used.
+	Duration *provisioner.Duration `json:"duration,omitempty"`
+}
+
+// Validate validates the trust on first use configuration.
+func (c *TOFUConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case len(c.AllowedIdentifiers) == 0:
+		return errors.New("tofu.allowedIdentifiers cannot be empty")
+	case c.Duration != nil && c.Duration.Duration <= 0:
+		return errors.New("tofu.duration must be greater than 0")
+	}
+	for _, id := range c.AllowedIdentifiers {
+		if id == "" || id == "*." || strings.Contains(strings.TrimPrefix(id, "*."), "*") {
+			return errors.Errorf("tofu.allowedIdentifiers contains an invalid identifier '%s'", id)
+		}
+	}
+	return nil
+}
+
+// IsAllowedIdentifier returns true if the given identifier matches one of the
+// configured allowed identifiers.
+func (c *TOFUConfig) IsAllowedIdentifier(id string) bool {
+	if c == nil {
+		return false
+	}
+	return matchDomain(c.AllowedIdentifiers, id)
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestTOFUConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *TOFUConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &TOFUConfig{AllowedIdentifiers: []string{"*.devices.internal", "sensor.example.com"}}, false},
+		{"ok duration", &TOFUConfig{AllowedIdentifiers: []string{"*.devices.internal"}, Duration: &provisioner.Duration{Duration: time.Hour}}, false},
+		{"fail no identifiers", &TOFUConfig{}, true},
+		{"fail empty identifier", &TOFUConfig{AllowedIdentifiers: []string{""}}, true},
+		{"fail wildcard", &TOFUConfig{AllowedIdentifiers: []string{"*."}}, true},
+		{"fail inner wildcard", &TOFUConfig{AllowedIdentifiers: []string{"foo.*.internal"}}, true},
+		{"fail duration", &TOFUConfig{AllowedIdentifiers: []string{"*.devices.internal"}, Duration: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TOFUConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTOFUConfig_IsAllowedIdentifier(t *testing.T) {
+	c := &TOFUConfig{AllowedIdentifiers: []string{"*.devices.internal", "Sensor.Example.com"}}
+	tests := []struct {
+		name   string
+		config *TOFUConfig
+		id     string
+		want   bool
+	}{
+		{"nil", nil, "foo.devices.internal", false},
+		{"ok wildcard", c, "foo.devices.internal", true},
+		{"ok exact", c, "sensor.example.com", true},
+		{"fail wildcard", c, "devices.internal", false},
+		{"fail exact", c, "foo.sensor.example.com", false},
+		{"fail empty", c, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.IsAllowedIdentifier(tt.id); got != tt.want {
+				t.Errorf("TOFUConfig.IsAllowedIdentifier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
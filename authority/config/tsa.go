@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/asn1"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// TSAConfig configures the RFC 3161 time-stamp authority (TSA). Time-stamp
+// tokens are signed with a dedicated certificate that must contain only the
+// critical timeStamping extended key usage.
+type TSAConfig struct {
+	// Certificate is the path to the time-stamping certificate, optionally
+	// followed by its intermediates.
+	Certificate string `json:"crt"`
+	// Key is the path or the KMS uri of the key of the certificate.
+	Key string `json:"key"`
+	// Policy is the TSA policy OID included in the time-stamp tokens, e.g.
+	// 1.3.6.1.4.1.99999.1.
+	Policy string `json:"policy"`
+	// Accuracy is the accuracy of the time in the tokens, if not set it is
+	// omitted.
+	Accuracy *provisioner.Duration `json:"accuracy,omitempty"`
+}
+
+// Validate validates the time-stamp authority configuration.
+func (c *TSAConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Certificate == "":
+		return errors.New("tsa.crt cannot be empty")
+	case c.Key == "":
+		return errors.New("tsa.key cannot be empty")
+	case c.Accuracy != nil && c.Accuracy.Duration < 0:
+		return errors.New("tsa.accuracy cannot be negative")
+	}
+	if _, err := c.GetPolicy(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetPolicy returns the parsed TSA policy OID.
+func (c *TSAConfig) GetPolicy() (asn1.ObjectIdentifier, error) {
+	if c.Policy == "" {
+		return nil, errors.New("tsa.policy cannot be empty")
+	}
+	parts := strings.Split(c.Policy, ".")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("tsa.policy '%s' is not a valid object identifier", c.Policy)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, s := range parts {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("tsa.policy '%s' is not a valid object identifier", c.Policy)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/asn1"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestTSAConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *TSAConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &TSAConfig{Certificate: "tsa.crt", Key: "tsa.key", Policy: "1.3.6.1.4.1.99999.1"}, false},
+		{"ok accuracy", &TSAConfig{Certificate: "tsa.crt", Key: "tsa.key", Policy: "1.3.6.1.4.1.99999.1", Accuracy: &provisioner.Duration{Duration: time.Second}}, false},
+		{"fail crt", &TSAConfig{Key: "tsa.key", Policy: "1.3.6.1.4.1.99999.1"}, true},
+		{"fail key", &TSAConfig{Certificate: "tsa.crt", Policy: "1.3.6.1.4.1.99999.1"}, true},
+		{"fail policy", &TSAConfig{Certificate: "tsa.crt", Key: "tsa.key"}, true},
+		{"fail policy format", &TSAConfig{Certificate: "tsa.crt", Key: "tsa.key", Policy: "1.3.foo"}, true},
+		{"fail accuracy", &TSAConfig{Certificate: "tsa.crt", Key: "tsa.key", Policy: "1.3.6.1.4.1.99999.1", Accuracy: &provisioner.Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TSAConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTSAConfig_GetPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		want    asn1.ObjectIdentifier
+		wantErr bool
+	}{
+		{"ok", "1.3.6.1.4.1.99999.1", asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, false},
+		{"fail empty", "", nil, true},
+		{"fail short", "1", nil, true},
+		{"fail negative", "1.-3", nil, true},
+		{"fail empty arc", "1..3", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&TSAConfig{Policy: tt.policy}).GetPolicy()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TSAConfig.GetPolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TSAConfig.GetPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultUsageWindowDays is the default number of days of the rolling
+	// issuance counts of the provisioners.
+	DefaultUsageWindowDays = 30
+	// DefaultUsageStaleAfterDays is the default number of days without use
+	// after which a provisioner is flagged as stale.
+	DefaultUsageStaleAfterDays = 90
+)
+
+// ProvisionerUsageConfig configures the tracking of the use of the
+// provisioners. The authority records the last time each provisioner was
+// used and the number of certificates it issued per day, and flags the
+// provisioners that have not been used for a number of days.
+type ProvisionerUsageConfig struct {
+	// WindowDays is the number of days of the rolling issuance counts.
+	// Defaults to 30.
+	WindowDays int `json:"windowDays,omitempty"`
+	// StaleAfterDays is the number of days without use after which a
+	// provisioner is flagged as stale. Defaults to 90.
+	StaleAfterDays int `json:"staleAfterDays,omitempty"`
+}
+
+// Validate validates the provisioner usage configuration.
+func (c *ProvisionerUsageConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.WindowDays < 0:
+		return errors.New("provisionerUsage.windowDays cannot be negative")
+	case c.StaleAfterDays < 0:
+		return errors.New("provisionerUsage.staleAfterDays cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetWindowDays returns the number of days of the rolling issuance counts.
+func (c *ProvisionerUsageConfig) GetWindowDays() int {
+	if c == nil || c.WindowDays == 0 {
+		return DefaultUsageWindowDays
+	}
+	return c.WindowDays
+}
+
+// GetStaleAfterDays returns the number of days without use after which a
+// provisioner is stale.
+func (c *ProvisionerUsageConfig) GetStaleAfterDays() int {
+	if c == nil || c.StaleAfterDays == 0 {
+		return DefaultUsageStaleAfterDays
+	}
+	return c.StaleAfterDays
+}
@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestProvisionerUsageConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *ProvisionerUsageConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &ProvisionerUsageConfig{}, false},
+		{"ok", &ProvisionerUsageConfig{WindowDays: 7, StaleAfterDays: 30}, false},
+		{"fail window", &ProvisionerUsageConfig{WindowDays: -1}, true},
+		{"fail stale", &ProvisionerUsageConfig{StaleAfterDays: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ProvisionerUsageConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvisionerUsageConfig_Getters(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *ProvisionerUsageConfig
+		wantWindow     int
+		wantStaleAfter int
+	}{
+		{"nil", nil, DefaultUsageWindowDays, DefaultUsageStaleAfterDays},
+		{"empty", &ProvisionerUsageConfig{}, DefaultUsageWindowDays, DefaultUsageStaleAfterDays},
+		{"ok", &ProvisionerUsageConfig{WindowDays: 7, StaleAfterDays: 30}, 7, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetWindowDays(); got != tt.wantWindow {
+				t.Errorf("ProvisionerUsageConfig.GetWindowDays() = %v, want %v", got, tt.wantWindow)
+			}
+			if got := tt.config.GetStaleAfterDays(); got != tt.wantStaleAfter {
+				t.Errorf("ProvisionerUsageConfig.GetStaleAfterDays() = %v, want %v", got, tt.wantStaleAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	kms "github.com/smallstep/certificates/kms/apiv1"
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+const (
+	// ConfigVersion1 is the original format of the configuration, used when
+	// the version is not set. Unknown fields are ignored and the deprecated
+	// fields are supported.
+	ConfigVersion1 = 1
+	// ConfigVersion2 is the format of the configuration that rejects unknown
+	// fields, unknown provisioner types, and deprecated fields.
+	ConfigVersion2 = 2
+	// LatestConfigVersion is the latest version of the configuration format.
+	LatestConfigVersion = ConfigVersion2
+)
+
+// legacyCipherSuites maps the legacy names of the cipher suites to the
+// current ones.
+var legacyCipherSuites = map[string]string{
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":   "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305": "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+// deprecatedKMSField is a deprecated field of the KMS options and the URI
+// attribute that replaces it.
+type deprecatedKMSField struct {
+	name  string
+	attr  string
+	value *string
+}
+
+// deprecatedKMSFields returns the deprecated fields of the KMS options, and
+// the URI attributes that replace them in the given KMS type.
+func deprecatedKMSFields(o *kms.Options) []deprecatedKMSField {
+	attrs := map[string]map[string]string{
+		string(kms.CloudKMS):  {"credentialsFile": "credentials-file"},
+		string(kms.AmazonKMS): {"credentialsFile": "credentials-file", "region": "region", "profile": "profile"},
+		string(kms.PKCS11):    {"pin": "pin-value"},
+		string(kms.YubiKey):   {"pin": "pin-value", "managementKey": "management-key"},
+	}[strings.ToLower(o.Type)]
+	fields := []deprecatedKMSField{
+		{name: "credentialsFile", value: &o.CredentialsFile},
+		{name: "pin", value: &o.Pin},
+		{name: "managementKey", value: &o.ManagementKey},
+		{name: "region", value: &o.Region},
+		{name: "profile", value: &o.Profile},
+	}
+	for i := range fields {
+		fields[i].attr = attrs[fields[i].name]
+	}
+	return fields
+}
+
+// parseConfiguration parses the given configuration using the format of its
+// version.
+func parseConfiguration(data []byte) (*Config, error) {
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	switch v.Version {
+	case 0, ConfigVersion1:
+		var c Config
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	case ConfigVersion2:
+		return parseStrictConfiguration(data)
+	default:
+		return nil, errors.Errorf("version %d is not supported", v.Version)
+	}
+}
+
+// parseStrictConfiguration parses the given configuration returning an error
+// if it contains unknown fields or unknown provisioner types.
+func parseStrictConfiguration(data []byte) (*Config, error) {
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	// provisioner.List skips unknown fields and types, so the provisioners
+	// are decoded again.
+	var raw struct {
+		Authority struct {
+			Provisioners json.RawMessage `json:"provisioners"`
+		} `json:"authority"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Authority.Provisioners) > 0 && c.AuthorityConfig != nil {
+		ps, err := provisioner.UnmarshalListStrict(raw.Authority.Provisioners)
+		if err != nil {
+			return nil, err
+		}
+		c.AuthorityConfig.Provisioners = ps
+	}
+
+	return &c, nil
+}
+
+// validateVersion checks that the version of the configuration is supported
+// and, starting with version 2, that the deprecated fields are not used.
+func (c *Config) validateVersion() error {
+	switch {
+	case c.Version < 0 || c.Version > LatestConfigVersion:
+		return errors.Errorf("version %d is not supported", c.Version)
+	case c.Version < ConfigVersion2:
+		return nil
+	}
+
+	if c.KMS != nil {
+		for _, f := range deprecatedKMSFields(c.KMS) {
+			if *f.value != "" {
+				return errors.Errorf("kms.%s is not supported in version %d, use kms.uri instead", f.name, c.Version)
+			}
+		}
+	}
+	if c.TLS != nil {
+		for _, s := range c.TLS.CipherSuites {
+			if name, ok := legacyCipherSuites[s]; ok {
+				return errors.Errorf("tls cipher suite %s is not supported in version %d, use %s instead", s, c.Version, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Migrate converts the configuration to the latest version of the format,
+// replacing the deprecated fields. It returns a description of the changes
+// made.
+func (c *Config) Migrate() ([]string, error) {
+	if c.Version < 0 || c.Version > LatestConfigVersion {
+		return nil, errors.Errorf("version %d is not supported", c.Version)
+	}
+
+	var changes []string
+	if c.KMS != nil {
+		kmsChanges, err := migrateKMS(c.KMS)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, kmsChanges...)
+	}
+	if c.TLS != nil && len(c.TLS.CipherSuites) > 0 {
+		// Copy the options, they might point to DefaultTLSOptions.
+		tls := *c.TLS
+		tls.CipherSuites = make(CipherSuites, len(c.TLS.CipherSuites))
+		for i, s := range c.TLS.CipherSuites {
+			if name, ok := legacyCipherSuites[s]; ok {
+				changes = append(changes, fmt.Sprintf("renamed tls cipher suite %s to %s", s, name))
+				s = name
+			}
+			tls.CipherSuites[i] = s
+		}
+		c.TLS = &tls
+	}
+	if c.Version != LatestConfigVersion {
+		changes = append(changes, fmt.Sprintf("set version to %d", LatestConfigVersion))
+		c.Version = LatestConfigVersion
+	}
+	return changes, nil
+}
+
+// migrateKMS moves the deprecated fields of the KMS options to the URI.
+func migrateKMS(o *kms.Options) ([]string, error) {
+	var u *uri.URI
+	var changes []string
+	for _, f := range deprecatedKMSFields(o) {
+		if *f.value == "" {
+			continue
+		}
+		if f.attr == "" {
+			changes = append(changes, fmt.Sprintf("removed kms.%s, it is not used by the kms type %q", f.name, o.Type))
+			*f.value = ""
+			continue
+		}
+		if u == nil {
+			var err error
+			scheme := strings.ToLower(o.Type)
+			if o.URI == "" {
+				u = uri.New(scheme, url.Values{})
+			} else if u, err = uri.ParseWithScheme(scheme, o.URI); err != nil {
+				return nil, errors.Wrap(err, "error migrating kms")
+			}
+		}
+		if v := u.Get(f.attr); v != "" && v != *f.value {
+			return nil, errors.Errorf("error migrating kms: kms.%s and the attribute %s in kms.uri have different values", f.name, f.attr)
+		}
+		u.Values.Set(f.attr, *f.value)
+		changes = append(changes, fmt.Sprintf("moved kms.%s to the attribute %s of kms.uri", f.name, f.attr))
+		*f.value = ""
+	}
+	if u != nil {
+		nu := uri.New(u.Scheme, u.Values)
+		nu.RawQuery = u.RawQuery
+		o.URI = nu.String()
+	}
+	return changes, nil
+}
+
+// MigrateConfiguration reads the configuration in the given filename and
+// converts it to the latest version of the format. Unlike LoadConfiguration,
+// the returned configuration is not initialized with the default values. It
+// also returns a description of the changes made, including the fields that
+// were ignored by the original format and are removed.
+func MigrateConfiguration(filename string) (*Config, []string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error opening %s", filename)
+	}
+	c, err := parseConfiguration(b)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+
+	var changes []string
+	if c.Version < ConfigVersion2 {
+		if _, err := parseStrictConfiguration(b); err != nil {
+			changes = append(changes, fmt.Sprintf("removed ignored fields or provisioners: %v", err))
+		}
+	}
+	migrated, err := c.Migrate()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error migrating %s", filename)
+	}
+	return c, append(changes, migrated...), nil
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/assert"
+	kms "github.com/smallstep/certificates/kms/apiv1"
+)
+
+func writeConfiguration(t *testing.T, data string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "ca.json")
+	assert.FatalError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(data)
+	assert.FatalError(t, err)
+	return f.Name()
+}
+
+func TestLoadConfiguration_version(t *testing.T) {
+	tests := []struct {
+		name             string
+		data             string
+		wantVersion      int
+		wantProvisioners int
+		wantErr          bool
+	}{
+		{"ok v1", `{"address":":443","foo":"bar","authority":{"provisioners":[{"type":"ACME","name":"acme","bar":1},{"type":"foo"}]}}`, 0, 1, false},
+		{"ok v1 explicit", `{"version":1,"address":":443","foo":"bar"}`, 1, 0, false},
+		{"ok v2", `{"version":2,"address":":443","authority":{"provisioners":[{"type":"ACME","name":"acme"}]}}`, 2, 1, false},
+		{"fail v2 field", `{"version":2,"address":":443","foo":"bar"}`, 0, 0, true},
+		{"fail v2 nested field", `{"version":2,"address":":443","authority":{"foo":"bar"}}`, 0, 0, true},
+		{"fail v2 provisioner field", `{"version":2,"address":":443","authority":{"provisioners":[{"type":"ACME","name":"acme","bar":1}]}}`, 0, 0, true},
+		{"fail v2 provisioner type", `{"version":2,"address":":443","authority":{"provisioners":[{"type":"foo","name":"foo"}]}}`, 0, 0, true},
+		{"fail version", `{"version":3,"address":":443"}`, 0, 0, true},
+		{"fail json", `{"version":"2"}`, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeConfiguration(t, tt.data)
+			defer os.Remove(filename)
+
+			got, err := LoadConfiguration(filename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Version != tt.wantVersion {
+				t.Errorf("LoadConfiguration() Version = %d, want %d", got.Version, tt.wantVersion)
+			}
+			if len(got.AuthorityConfig.Provisioners) != tt.wantProvisioners {
+				t.Errorf("LoadConfiguration() Provisioners = %v, want %d provisioners", got.AuthorityConfig.Provisioners, tt.wantProvisioners)
+			}
+		})
+	}
+}
+
+func TestConfig_Migrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		want        *Config
+		wantChanges []string
+		wantErr     bool
+	}{
+		{"ok empty", &Config{}, &Config{Version: 2}, []string{"set version to 2"}, false},
+		{"ok v2", &Config{Version: 2}, &Config{Version: 2}, nil, false},
+		{"ok tls", &Config{
+			TLS: &TLSOptions{CipherSuites: CipherSuites{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305", "TLS_AES_128_GCM_SHA256"}},
+		}, &Config{
+			Version: 2,
+			TLS:     &TLSOptions{CipherSuites: CipherSuites{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256", "TLS_AES_128_GCM_SHA256"}},
+		}, []string{
+			"renamed tls cipher suite TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305 to TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+			"set version to 2",
+		}, false},
+		{"ok awskms", &Config{
+			KMS: &kms.Options{Type: "awskms", CredentialsFile: "/path/credentials", Region: "us-east-1"},
+		}, &Config{
+			Version: 2,
+			KMS:     &kms.Options{Type: "awskms", URI: "awskms:credentials-file=%2Fpath%2Fcredentials;region=us-east-1"},
+		}, []string{
+			"moved kms.credentialsFile to the attribute credentials-file of kms.uri",
+			"moved kms.region to the attribute region of kms.uri",
+			"set version to 2",
+		}, false},
+		{"ok pkcs11", &Config{
+			KMS: &kms.Options{Type: "pkcs11", URI: "pkcs11:module-path=/lib/softhsm.so;token=pkcs11", Pin: "password"},
+		}, &Config{
+			Version: 2,
+			KMS:     &kms.Options{Type: "pkcs11", URI: "pkcs11:module-path=%2Flib%2Fsofthsm.so;pin-value=password;token=pkcs11"},
+		}, []string{
+			"moved kms.pin to the attribute pin-value of kms.uri",
+			"set version to 2",
+		}, false},
+		{"ok softkms", &Config{
+			KMS: &kms.Options{Type: "softkms", Pin: "password"},
+		}, &Config{
+			Version: 2,
+			KMS:     &kms.Options{Type: "softkms"},
+		}, []string{
+			`removed kms.pin, it is not used by the kms type "softkms"`,
+			"set version to 2",
+		}, false},
+		{"fail kms conflict", &Config{
+			KMS: &kms.Options{Type: "yubikey", URI: "yubikey:pin-value=123456", Pin: "654321"},
+		}, nil, nil, true},
+		{"fail kms uri", &Config{
+			KMS: &kms.Options{Type: "cloudkms", URI: "awskms:region=us-east-1", CredentialsFile: "/path/credentials"},
+		}, nil, nil, true},
+		{"fail version", &Config{Version: 3}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Migrate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config.Migrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantChanges) {
+				t.Errorf("Config.Migrate() = %v, want %v", got, tt.wantChanges)
+			}
+			if !reflect.DeepEqual(tt.config, tt.want) {
+				t.Errorf("Config.Migrate() config = %+v, want %+v", tt.config, tt.want)
+			}
+			if err := tt.config.validateVersion(); err != nil {
+				t.Errorf("Config.validateVersion() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateConfiguration(t *testing.T) {
+	filename := writeConfiguration(t, `{"address":":443","foo":"bar","tls":{"cipherSuites":["TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305"]}}`)
+	defer os.Remove(filename)
+
+	c, changes, err := MigrateConfiguration(filename)
+	assert.FatalError(t, err)
+	assert.Equals(t, LatestConfigVersion, c.Version)
+	assert.Nil(t, c.AuthorityConfig)
+	assert.Equals(t, CipherSuites{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"}, c.TLS.CipherSuites)
+	if assert.Len(t, 3, changes) {
+		assert.HasPrefix(t, changes[0], "removed ignored fields or provisioners: ")
+	}
+
+	// The migrated configuration can be loaded with the strict format.
+	assert.FatalError(t, c.Save(filename))
+	_, err = LoadConfiguration(filename)
+	assert.FatalError(t, err)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultWASMRuntime is the default runtime used to execute the WebAssembly
+// policy modules.
+const DefaultWASMRuntime = "wasmtime"
+
+// WASMPolicyConfig configures a WebAssembly module that takes custom decisions
+// on the issuance of certificates. The module is executed as a WASI command by
+// the given runtime, it receives the sign request as JSON in the standard
+// input and it must write the decision as JSON in the standard output.
+//
+// The module runs in the sandbox of the runtime without access to the file
+// system or the network, unless they are granted in the runtime arguments.
+// Memory or fuel limits can also be set using the runtime arguments.
+type WASMPolicyConfig struct {
+	// Module is the path of the WebAssembly module.
+	Module string `json:"module"`
+	// Runtime is the command used to run the module, defaults to wasmtime.
+	Runtime string `json:"runtime,omitempty"`
+	// RuntimeArgs are the arguments passed to the runtime before the module.
+	RuntimeArgs []string `json:"runtimeArgs,omitempty"`
+	// Timeout is the maximum time the module can run, defaults to 5s.
+	Timeout *provisioner.Duration `json:"timeout,omitempty"`
+	// MaxOutputSize is the maximum size of the decision, defaults to 64KiB.
+	MaxOutputSize int `json:"maxOutputSize,omitempty"`
+	// FailOpen allows the requests if the module cannot be executed.
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// Validate validates the WebAssembly policy configuration.
+func (c *WASMPolicyConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Module == "":
+		return errors.New("wasmPolicy.module cannot be empty")
+	case c.Timeout != nil && c.Timeout.Duration < 0:
+		return errors.New("wasmPolicy.timeout cannot be negative")
+	case c.MaxOutputSize < 0:
+		return errors.New("wasmPolicy.maxOutputSize cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetRuntime returns the command used to run the module.
+func (c *WASMPolicyConfig) GetRuntime() string {
+	if c.Runtime == "" {
+		return DefaultWASMRuntime
+	}
+	return c.Runtime
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestWASMPolicyConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *WASMPolicyConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &WASMPolicyConfig{Module: "policy.wasm"}, false},
+		{"ok full", &WASMPolicyConfig{Module: "policy.wasm", Runtime: "wasmer", RuntimeArgs: []string{"run"}, Timeout: &provisioner.Duration{Duration: time.Second}, MaxOutputSize: 1024, FailOpen: true}, false},
+		{"fail module", &WASMPolicyConfig{}, true},
+		{"fail timeout", &WASMPolicyConfig{Module: "policy.wasm", Timeout: &provisioner.Duration{Duration: -time.Second}}, true},
+		{"fail maxOutputSize", &WASMPolicyConfig{Module: "policy.wasm", MaxOutputSize: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("WASMPolicyConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWASMPolicyConfig_GetRuntime(t *testing.T) {
+	if got := (&WASMPolicyConfig{}).GetRuntime(); got != DefaultWASMRuntime {
+		t.Errorf("WASMPolicyConfig.GetRuntime() = %v, want %v", got, DefaultWASMRuntime)
+	}
+	if got := (&WASMPolicyConfig{Runtime: "wasmer"}).GetRuntime(); got != "wasmer" {
+		t.Errorf("WASMPolicyConfig.GetRuntime() = %v, want %v", got, "wasmer")
+	}
+}
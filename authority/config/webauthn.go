@@ -0,0 +1,92 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// DefaultWebAuthnSessionExpiry is the default time a step-up session can be
+// used for mutating admin API requests.
+var DefaultWebAuthnSessionExpiry = 5 * time.Minute
+
+// WebAuthnCeremonyTimeout is the time the client has to complete a
+// registration or an authentication ceremony.
+const WebAuthnCeremonyTimeout = 2 * time.Minute
+
+// WebAuthnEnrollmentTimeout is the time an enrollment code can be used to
+// register the first security key of an administrator.
+const WebAuthnEnrollmentTimeout = 24 * time.Hour
+
+// WebAuthnConfig requires the administrators to authenticate with a
+// registered security key before sending mutating admin API requests.
+type WebAuthnConfig struct {
+	// RPID is the relying party id, the domain of the clients used to
+	// register the security keys.
+	RPID string `json:"rpID"`
+	// RPName is the name of the relying party displayed by the browsers.
+	// Defaults to the relying party id.
+	RPName string `json:"rpName,omitempty"`
+	// Origins is the list of allowed origins of the ceremonies. Defaults to
+	// https://<rpID>.
+	Origins []string `json:"origins,omitempty"`
+	// UserVerification requires the authenticator to verify the
+	// administrator with a PIN or a biometric, not only a touch.
+	UserVerification bool `json:"userVerification,omitempty"`
+	// SessionExpiry is the time a step-up session can be used. Defaults to
+	// 5m.
+	SessionExpiry *provisioner.Duration `json:"sessionExpiry,omitempty"`
+}
+
+// Validate validates the WebAuthn configuration.
+func (c *WebAuthnConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.RPID == "" {
+		return errors.New("webauthn.rpID cannot be empty")
+	}
+	if strings.Contains(c.RPID, "/") || strings.Contains(c.RPID, ":") {
+		return errors.Errorf("webauthn.rpID %s must be a domain", c.RPID)
+	}
+	for _, o := range c.Origins {
+		u, err := url.Parse(o)
+		if err != nil || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return errors.Errorf("webauthn.origins %s is not a valid origin", o)
+		}
+		if u.Scheme != "https" && !(u.Scheme == "http" && u.Hostname() == "localhost") {
+			return errors.Errorf("webauthn.origins %s must use https", o)
+		}
+	}
+	if c.SessionExpiry != nil && c.SessionExpiry.Duration <= 0 {
+		return errors.New("webauthn.sessionExpiry must be greater than 0")
+	}
+	return nil
+}
+
+// GetRPName returns the name of the relying party.
+func (c *WebAuthnConfig) GetRPName() string {
+	if c.RPName == "" {
+		return c.RPID
+	}
+	return c.RPName
+}
+
+// GetOrigins returns the allowed origins of the ceremonies.
+func (c *WebAuthnConfig) GetOrigins() []string {
+	if len(c.Origins) == 0 {
+		return []string{"https://" + c.RPID}
+	}
+	return c.Origins
+}
+
+// GetSessionExpiry returns the time a step-up session can be used.
+func (c *WebAuthnConfig) GetSessionExpiry() time.Duration {
+	if c == nil || c.SessionExpiry == nil {
+		return DefaultWebAuthnSessionExpiry
+	}
+	return c.SessionExpiry.Duration
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestWebAuthnConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *WebAuthnConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &WebAuthnConfig{RPID: "ca.example.com"}, false},
+		{"ok origins", &WebAuthnConfig{RPID: "example.com", Origins: []string{"https://ca.example.com", "https://ca.example.com:8443", "http://localhost:3000"}}, false},
+		{"ok expiry", &WebAuthnConfig{RPID: "ca.example.com", SessionExpiry: &provisioner.Duration{Duration: time.Minute}}, false},
+		{"fail rpID", &WebAuthnConfig{}, true},
+		{"fail rpID url", &WebAuthnConfig{RPID: "https://ca.example.com"}, true},
+		{"fail origin http", &WebAuthnConfig{RPID: "ca.example.com", Origins: []string{"http://ca.example.com"}}, true},
+		{"fail origin path", &WebAuthnConfig{RPID: "ca.example.com", Origins: []string{"https://ca.example.com/admin"}}, true},
+		{"fail origin host", &WebAuthnConfig{RPID: "ca.example.com", Origins: []string{"ca.example.com"}}, true},
+		{"fail expiry", &WebAuthnConfig{RPID: "ca.example.com", SessionExpiry: &provisioner.Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("WebAuthnConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebAuthnConfig_defaults(t *testing.T) {
+	c := &WebAuthnConfig{RPID: "ca.example.com"}
+	if got := c.GetRPName(); got != "ca.example.com" {
+		t.Errorf("WebAuthnConfig.GetRPName() = %v, want ca.example.com", got)
+	}
+	if got := c.GetOrigins(); !reflect.DeepEqual(got, []string{"https://ca.example.com"}) {
+		t.Errorf("WebAuthnConfig.GetOrigins() = %v, want [https://ca.example.com]", got)
+	}
+	if got := c.GetSessionExpiry(); got != DefaultWebAuthnSessionExpiry {
+		t.Errorf("WebAuthnConfig.GetSessionExpiry() = %v, want %v", got, DefaultWebAuthnSessionExpiry)
+	}
+
+	c = &WebAuthnConfig{
+		RPID:          "ca.example.com",
+		RPName:        "Smallstep CA",
+		Origins:       []string{"https://admin.ca.example.com"},
+		SessionExpiry: &provisioner.Duration{Duration: time.Minute},
+	}
+	if got := c.GetRPName(); got != "Smallstep CA" {
+		t.Errorf("WebAuthnConfig.GetRPName() = %v, want Smallstep CA", got)
+	}
+	if got := c.GetOrigins(); !reflect.DeepEqual(got, c.Origins) {
+		t.Errorf("WebAuthnConfig.GetOrigins() = %v, want %v", got, c.Origins)
+	}
+	if got := c.GetSessionExpiry(); got != time.Minute {
+		t.Errorf("WebAuthnConfig.GetSessionExpiry() = %v, want %v", got, time.Minute)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Default values of the write-behind spool.
+var (
+	DefaultWriteBehindFlushInterval = time.Second
+	DefaultWriteBehindSyncThreshold = 1000
+	DefaultWriteBehindMaxPending    = 100000
+)
+
+// WriteBehindConfig enables a durable local spool for the records of the
+// issued and renewed certificates and the config changes recorded for the
+// audit exports. The records are written to the spool, and to the database in
+// the background, so a slow database does not add latency to the issuance.
+type WriteBehindConfig struct {
+	// Directory is the local directory of the spool.
+	Directory string `json:"directory"`
+	// FlushInterval is the interval between the writes of the spooled records
+	// to the database. It defaults to 1s.
+	FlushInterval *provisioner.Duration `json:"flushInterval,omitempty"`
+	// SyncThreshold is the number of records in the spool that makes the
+	// requests wait for the records to be written to the database. It
+	// defaults to 1000.
+	SyncThreshold int `json:"syncThreshold,omitempty"`
+	// MaxPending is the number of records in the spool that makes the
+	// requests fail with a 503 Service Unavailable response. It defaults to
+	// 100000.
+	MaxPending int `json:"maxPending,omitempty"`
+}
+
+// Validate validates the write-behind configuration.
+func (c *WriteBehindConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Directory == "":
+		return errors.New("writeBehind.directory cannot be empty")
+	case c.FlushInterval != nil && c.FlushInterval.Duration <= 0:
+		return errors.New("writeBehind.flushInterval must be greater than 0")
+	case c.SyncThreshold < 0:
+		return errors.New("writeBehind.syncThreshold cannot be negative")
+	case c.MaxPending < 0:
+		return errors.New("writeBehind.maxPending cannot be negative")
+	case c.GetSyncThreshold() > c.GetMaxPending():
+		return errors.New("writeBehind.syncThreshold cannot be greater than writeBehind.maxPending")
+	default:
+		return nil
+	}
+}
+
+// GetFlushInterval returns the interval between the writes of the spooled
+// records.
+func (c *WriteBehindConfig) GetFlushInterval() time.Duration {
+	if c == nil || c.FlushInterval == nil {
+		return DefaultWriteBehindFlushInterval
+	}
+	return c.FlushInterval.Duration
+}
+
+// GetSyncThreshold returns the number of spooled records that makes the
+// requests wait for the database.
+func (c *WriteBehindConfig) GetSyncThreshold() int {
+	if c == nil || c.SyncThreshold == 0 {
+		return DefaultWriteBehindSyncThreshold
+	}
+	return c.SyncThreshold
+}
+
+// GetMaxPending returns the number of spooled records that makes the requests
+// fail.
+func (c *WriteBehindConfig) GetMaxPending() int {
+	if c == nil || c.MaxPending == 0 {
+		return DefaultWriteBehindMaxPending
+	}
+	return c.MaxPending
+}
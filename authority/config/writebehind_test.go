@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestWriteBehindConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *WriteBehindConfig
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &WriteBehindConfig{Directory: "/var/lib/step-ca/spool"}, false},
+		{"ok thresholds", &WriteBehindConfig{Directory: "spool", FlushInterval: &provisioner.Duration{Duration: time.Minute}, SyncThreshold: 10, MaxPending: 10}, false},
+		{"fail directory", &WriteBehindConfig{}, true},
+		{"fail flushInterval", &WriteBehindConfig{Directory: "spool", FlushInterval: &provisioner.Duration{}}, true},
+		{"fail syncThreshold", &WriteBehindConfig{Directory: "spool", SyncThreshold: -1}, true},
+		{"fail maxPending", &WriteBehindConfig{Directory: "spool", MaxPending: -1}, true},
+		{"fail syncThreshold greater", &WriteBehindConfig{Directory: "spool", MaxPending: 100}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("WriteBehindConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteBehindConfig_Getters(t *testing.T) {
+	var c *WriteBehindConfig
+	if c.GetFlushInterval() != DefaultWriteBehindFlushInterval || c.GetSyncThreshold() != DefaultWriteBehindSyncThreshold || c.GetMaxPending() != DefaultWriteBehindMaxPending {
+		t.Error("WriteBehindConfig getters do not return the defaults")
+	}
+	c = &WriteBehindConfig{FlushInterval: &provisioner.Duration{Duration: time.Minute}, SyncThreshold: 1, MaxPending: 2}
+	if c.GetFlushInterval() != time.Minute || c.GetSyncThreshold() != 1 || c.GetMaxPending() != 2 {
+		t.Error("WriteBehindConfig getters do not return the configured values")
+	}
+}
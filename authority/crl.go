@@ -0,0 +1,377 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+var (
+	crlTable = []byte("crl")
+	crlKey   = []byte("intermediate")
+)
+
+// crlReloadInterval is how often the replicas that do not hold the lease load
+// the CRL signed by the one holding it.
+const crlReloadInterval = time.Minute
+
+// maxCRLSignAttempts is the number of times a CRL is signed if another
+// replica stores one with the same number at the same time.
+const maxCRLSignAttempts = 3
+
+var (
+	oidExtensionAuthorityKeyID = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionCRLNumber      = asn1.ObjectIdentifier{2, 5, 29, 20}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// storedCRL is the last CRL signed. It is kept in the database, so the
+// replicas that do not hold the lease serve the same CRL, and the CRL number
+// keeps increasing across restarts.
+type storedCRL struct {
+	Number int64  `json:"number"`
+	CRL    []byte `json:"crl"`
+}
+
+// crlGenerator signs the CRL of the intermediate served by the CA. With a
+// database, only the replica holding the lease signs it, and the rest serve
+// the one stored in the database.
+type crlGenerator struct {
+	interval    time.Duration
+	expiry      time.Duration
+	issuer      *x509.Certificate
+	signer      crypto.Signer
+	list        func() ([]*db.RevokedCertificateInfo, error)
+	db          nosql.DB
+	lease       *leaderLease
+	logError    func(error, string)
+	now         func() time.Time
+	mu          sync.RWMutex
+	crl         []byte
+	number      int64
+	refresh     chan struct{}
+	done        chan struct{}
+	stopped     chan struct{}
+	unsubscribe func()
+}
+
+// initCRL signs the CRL if it is configured, and starts a goroutine that
+// signs a new one periodically and when a certificate is revoked.
+func (a *Authority) initCRL() error {
+	c := a.config.CRL
+	if c == nil || a.crlGenerator != nil {
+		return nil
+	}
+
+	chain, signer, err := a.intermediateSigner("crl signer")
+	if err != nil {
+		return err
+	}
+
+	g := &crlGenerator{
+		interval: c.GetSignInterval(),
+		expiry:   c.GetExpiry(),
+		issuer:   chain[0],
+		signer:   signer,
+		logError: a.logError,
+		now:      a.now,
+	}
+	// Without a database the certificates cannot be revoked, and the CRL is
+	// always empty.
+	if l, ok := a.db.(revokedCertificatesLister); ok {
+		g.list = l.GetRevokedCertificates
+	}
+	// With a database, the CRL is shared by all the replicas, and only the one
+	// holding the lease signs it.
+	if d, ok := a.getNoSQLDB(); ok {
+		if err := d.CreateTable(crlTable); err != nil {
+			return errors.Wrapf(err, "error creating table %s", string(crlTable))
+		}
+		g.db = d
+		g.lease = a.leaderElector.newLease("crl")
+	}
+
+	// With lazy keys, the first CRL is signed in the background.
+	lazy := a.config.Startup.IsLazyKeys()
+	if !lazy {
+		if err := g.update(); err != nil {
+			g.lease.Stop()
+			return err
+		}
+	}
+
+	g.start(a.events)
+	if lazy {
+		g.refresh <- struct{}{}
+	}
+	a.crlGenerator = g
+	return nil
+}
+
+// start starts the goroutine that signs the CRL.
+func (g *crlGenerator) start(bus *events.Bus) {
+	g.refresh = make(chan struct{}, 1)
+	g.done = make(chan struct{})
+	g.stopped = make(chan struct{})
+	g.unsubscribe = bus.Subscribe(func(events.Event) {
+		select {
+		case g.refresh <- struct{}{}:
+		default:
+		}
+	}, events.CertificateRevokedType)
+	go g.run()
+}
+
+func (g *crlGenerator) run() {
+	defer close(g.stopped)
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	reload := time.NewTicker(crlReloadInterval)
+	defer reload.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+		case <-g.refresh:
+		case <-g.lease.Elected():
+		case <-reload.C:
+			if g.lease.IsLeader() {
+				continue
+			}
+		}
+		// On errors, the previous CRL is served until it expires.
+		if err := g.update(); err != nil {
+			g.logError(err, "error updating crl")
+		}
+	}
+}
+
+// Stop stops the signatures of the CRL.
+func (g *crlGenerator) Stop() {
+	g.unsubscribe()
+	close(g.done)
+	<-g.stopped
+	g.lease.Stop()
+}
+
+// update signs a new CRL if the replica holds the lease, or loads the one
+// signed by the replica holding it.
+func (g *crlGenerator) update() error {
+	if g.lease.IsLeader() {
+		return g.sign(g.now())
+	}
+	return g.reload()
+}
+
+// sign signs a new CRL valid from the given time with the next CRL number.
+func (g *crlGenerator) sign(now time.Time) error {
+	if g.db == nil {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		// Without a database, the number is at least the current time, so it
+		// keeps increasing across restarts.
+		number := g.number + 1
+		if n := now.Unix(); n > number {
+			number = n
+		}
+		crl, err := createCRL(g.issuer, g.signer, g.list, now, g.expiry, big.NewInt(number))
+		if err != nil {
+			return err
+		}
+		g.crl, g.number = crl, number
+		return nil
+	}
+
+	for i := 0; i < maxCRLSignAttempts; i++ {
+		old, s, err := g.load()
+		if err != nil {
+			return err
+		}
+		number := s.Number + 1
+		crl, err := createCRL(g.issuer, g.signer, g.list, now, g.expiry, big.NewInt(number))
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(&storedCRL{Number: number, CRL: crl})
+		if err != nil {
+			return errors.Wrap(err, "error marshaling crl")
+		}
+		_, swapped, err := g.db.CmpAndSwap(crlTable, crlKey, old, b)
+		if err != nil {
+			return errors.Wrap(err, "error storing crl")
+		}
+		if swapped {
+			g.set(crl, number)
+			return nil
+		}
+	}
+	return errors.New("error storing crl: too many concurrent updates")
+}
+
+// reload loads the CRL signed by the replica holding the lease.
+func (g *crlGenerator) reload() error {
+	_, s, err := g.load()
+	if err != nil {
+		return err
+	}
+	if s.CRL != nil {
+		g.set(s.CRL, s.Number)
+	}
+	return nil
+}
+
+// load returns the stored CRL, and its raw value, used to store the next one.
+func (g *crlGenerator) load() ([]byte, *storedCRL, error) {
+	b, err := g.db.Get(crlTable, crlKey)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, &storedCRL{}, nil
+	case err != nil:
+		return nil, nil, errors.Wrap(err, "error loading crl")
+	}
+	s := new(storedCRL)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, nil, errors.Wrap(err, "error unmarshaling crl")
+	}
+	return b, s, nil
+}
+
+func (g *crlGenerator) set(crl []byte, number int64) {
+	g.mu.Lock()
+	g.crl, g.number = crl, number
+	g.mu.Unlock()
+}
+
+// CRL returns the last CRL signed.
+func (g *crlGenerator) CRL() []byte {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.crl
+}
+
+// GetCertificateRevocationList returns the DER encoded CRL of the
+// intermediate.
+func (a *Authority) GetCertificateRevocationList() ([]byte, error) {
+	if a.crlGenerator == nil {
+		return nil, errs.NotImplemented("authority.GetCertificateRevocationList; crl is not configured")
+	}
+	crl := a.crlGenerator.CRL()
+	if crl == nil {
+		return nil, errs.NewErr(http.StatusServiceUnavailable, errors.New("authority.GetCertificateRevocationList; crl is not available yet"),
+			errs.WithMessage("The CRL is not available yet."),
+			errs.WithRetryAfter(startupRetryAfter))
+	}
+	return crl, nil
+}
+
+// addCRLDistributionPoint adds the configured CRL distribution point to a
+// certificate without one.
+func (a *Authority) addCRLDistributionPoint(crt *x509.Certificate) {
+	if u := a.config.CRL.GetCDPURL(); u != "" && len(crt.CRLDistributionPoints) == 0 {
+		crt.CRLDistributionPoints = []string{u}
+	}
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// signCRL returns a DER encoded v2 CRL with the authority key identifier and
+// CRL number extensions, x509.Certificate.CreateCRL does not support them.
+func signCRL(issuer *x509.Certificate, signer crypto.Signer, revoked []pkix.RevokedCertificate, thisUpdate, nextUpdate time.Time, number *big.Int) ([]byte, error) {
+	sigAlg, hash, err := crlSignatureAlgorithm(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	var extensions []pkix.Extension
+	if len(issuer.SubjectKeyId) > 0 {
+		b, err := asn1.Marshal(authorityKeyID{ID: issuer.SubjectKeyId})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling authority key identifier")
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: b})
+	}
+	b, err := asn1.Marshal(number)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling crl number")
+	}
+	extensions = append(extensions, pkix.Extension{Id: oidExtensionCRLNumber, Value: b})
+
+	tbs := pkix.TBSCertificateList{
+		Version:             1,
+		Signature:           sigAlg,
+		Issuer:              issuer.Subject.ToRDNSequence(),
+		ThisUpdate:          thisUpdate.UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+		RevokedCertificates: revoked,
+		Extensions:          extensions,
+	}
+	tbsBytes, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling crl")
+	}
+	digest := tbsBytes
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbsBytes)
+		digest = h.Sum(nil)
+	}
+	signature, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing crl")
+	}
+	crl, err := asn1.Marshal(pkix.CertificateList{
+		TBSCertList:        tbs,
+		SignatureAlgorithm: sigAlg,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling crl")
+	}
+	return crl, nil
+}
+
+// crlSignatureAlgorithm returns the signature algorithm and hash used to sign
+// a CRL with the given key, the same ones used by x509.CreateCRL.
+func crlSignatureAlgorithm(pub crypto.PublicKey) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA256WithRSA, Parameters: asn1.NullRawValue}, crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, crypto.SHA256, nil
+		case elliptic.P384():
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, crypto.SHA384, nil
+		case elliptic.P521():
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}, crypto.SHA512, nil
+		}
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}, crypto.Hash(0), nil
+	}
+	return pkix.AlgorithmIdentifier{}, 0, errors.Errorf("unsupported crl signer key %T", pub)
+}
@@ -0,0 +1,174 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/db"
+)
+
+func newCRLGenerator(t *testing.T, list func() ([]*db.RevokedCertificateInfo, error)) *crlGenerator {
+	e := newRADIUSExporter(t, "", nil)
+	return &crlGenerator{
+		interval: time.Hour,
+		expiry:   2 * time.Hour,
+		issuer:   e.chain[0],
+		signer:   e.signer,
+		list:     list,
+		logError: func(err error, msg string) { t.Logf("%s: %v", msg, err) },
+		now:      time.Now,
+	}
+}
+
+func crlNumber(t *testing.T, crl *pkix.CertificateList) int64 {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(oidExtensionCRLNumber) {
+			n := new(big.Int)
+			_, err := asn1.Unmarshal(ext.Value, &n)
+			assert.FatalError(t, err)
+			return n.Int64()
+		}
+	}
+	t.Fatal("crl number extension not found")
+	return 0
+}
+
+func parseGeneratedCRL(t *testing.T, g *crlGenerator) *pkix.CertificateList {
+	crl, err := x509.ParseCRL(g.CRL())
+	assert.FatalError(t, err)
+	assert.FatalError(t, g.issuer.CheckCRLSignature(crl))
+	return crl
+}
+
+func TestCRLGenerator_sign(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	g := newCRLGenerator(t, func() ([]*db.RevokedCertificateInfo, error) {
+		return []*db.RevokedCertificateInfo{{Serial: "1234", RevokedAt: now.Add(-time.Minute)}}, nil
+	})
+	assert.FatalError(t, g.sign(now))
+
+	crl := parseGeneratedCRL(t, g)
+	assert.Equals(t, now.Unix(), crl.TBSCertList.ThisUpdate.Unix())
+	assert.Equals(t, now.Add(2*time.Hour).Unix(), crl.TBSCertList.NextUpdate.Unix())
+	assert.Len(t, 1, crl.TBSCertList.RevokedCertificates)
+	assert.Equals(t, "1234", crl.TBSCertList.RevokedCertificates[0].SerialNumber.String())
+	assert.Equals(t, 1, crl.TBSCertList.Version)
+	assert.Equals(t, now.Unix(), crlNumber(t, crl))
+
+	// Without a database the CRL is empty, and the number keeps increasing
+	g.list = nil
+	assert.FatalError(t, g.sign(now))
+	crl = parseGeneratedCRL(t, g)
+	assert.Len(t, 0, crl.TBSCertList.RevokedCertificates)
+	assert.Equals(t, now.Unix()+1, crlNumber(t, crl))
+}
+
+func TestCRLGenerator_db(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	store := &memoryLeaseStore{leases: make(map[string]memoryLease)}
+	newElector := func(identity string) *leaderElector {
+		return &leaderElector{
+			store:       store,
+			identity:    identity,
+			duration:    time.Minute,
+			renewPeriod: time.Second,
+		}
+	}
+	memDB := db.NewMemoryDB()
+	assert.FatalError(t, memDB.CreateTable(crlTable))
+
+	leader := newCRLGenerator(t, nil)
+	leader.db = memDB
+	leader.lease = newElector("ca-0").newLease("crl")
+	defer leader.lease.Stop()
+	follower := newCRLGenerator(t, nil)
+	follower.db = memDB
+	follower.lease = newElector("ca-1").newLease("crl")
+	defer follower.lease.Stop()
+
+	// The follower serves the CRL signed by the leader
+	assert.FatalError(t, follower.update())
+	assert.Nil(t, follower.CRL())
+	assert.FatalError(t, leader.update())
+	assert.Equals(t, int64(1), crlNumber(t, parseGeneratedCRL(t, leader)))
+	assert.FatalError(t, follower.update())
+	assert.Equals(t, leader.CRL(), follower.CRL())
+
+	// The number is stored, and keeps increasing after a restart
+	assert.FatalError(t, leader.sign(now))
+	restarted := newCRLGenerator(t, nil)
+	restarted.db = memDB
+	assert.FatalError(t, restarted.sign(now))
+	assert.Equals(t, int64(3), crlNumber(t, parseGeneratedCRL(t, restarted)))
+	assert.FatalError(t, leader.sign(now))
+	assert.Equals(t, int64(4), crlNumber(t, parseGeneratedCRL(t, leader)))
+}
+
+func TestCRLGenerator_revoked(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		rcis []*db.RevokedCertificateInfo
+	)
+	g := newCRLGenerator(t, func() ([]*db.RevokedCertificateInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return rcis, nil
+	})
+	assert.FatalError(t, g.sign(time.Now()))
+	assert.Len(t, 0, parseGeneratedCRL(t, g).TBSCertList.RevokedCertificates)
+
+	bus := events.NewBus()
+	g.start(bus)
+	defer g.Stop()
+
+	mu.Lock()
+	rcis = []*db.RevokedCertificateInfo{{Serial: "1234", RevokedAt: time.Now()}}
+	mu.Unlock()
+	bus.Publish(&events.CertificateRevoked{Time: time.Now(), SerialNumber: "1234"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(parseGeneratedCRL(t, g).TBSCertList.RevokedCertificates) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("crl has not been signed after a revocation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAuthority_GetCertificateRevocationList(t *testing.T) {
+	a := testAuthority(t)
+	_, err := a.GetCertificateRevocationList()
+	assert.NotNil(t, err)
+
+	a.crlGenerator = newCRLGenerator(t, nil)
+	_, err = a.GetCertificateRevocationList()
+	assert.NotNil(t, err)
+	assert.FatalError(t, a.crlGenerator.sign(time.Now()))
+	crl, err := a.GetCertificateRevocationList()
+	assert.FatalError(t, err)
+	assert.Equals(t, a.crlGenerator.CRL(), crl)
+}
+
+func TestAuthority_addCRLDistributionPoint(t *testing.T) {
+	a := testAuthority(t)
+	crt := &x509.Certificate{}
+	a.addCRLDistributionPoint(crt)
+	assert.Len(t, 0, crt.CRLDistributionPoints)
+
+	a.config.CRL = &config.CRLConfig{CDPURL: "https://ca.example.com/crl"}
+	a.addCRLDistributionPoint(crt)
+	assert.Equals(t, []string{"https://ca.example.com/crl"}, crt.CRLDistributionPoints)
+
+	// Certificates with a distribution point are not modified
+	crt = &x509.Certificate{CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"}}
+	a.addCRLDistributionPoint(crt)
+	assert.Equals(t, []string{"http://crl.example.com/ca.crl"}, crt.CRLDistributionPoints)
+}
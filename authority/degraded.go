@@ -0,0 +1,286 @@
+package authority
+
+import (
+	"crypto/x509"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// degradedMode tracks the availability of the database with a circuit
+// breaker. While the breaker is open, new certificates are not issued, and
+// the renewed certificates are queued in memory and written to the database
+// in the background once it's back. The revocation check of the renewals uses
+// a snapshot of the revoked serials taken while the database was available.
+type degradedMode struct {
+	breaker          *breaker.Breaker
+	interval         time.Duration
+	maxQueue         int
+	store            func(oldCert *x509.Certificate, fullchain []*x509.Certificate) error
+	listRevoked      func() ([]*db.RevokedCertificateInfo, error)
+	now              func() time.Time
+	snapshotInterval time.Duration
+	mu               sync.Mutex
+	queue            []*queuedRenewal
+	revoked          map[string]struct{}
+	revokedAt        time.Time
+	unsubscribe      func()
+	done             chan struct{}
+	stopped          chan struct{}
+}
+
+// queuedRenewal is a renewed certificate not written to the database yet.
+type queuedRenewal struct {
+	oldCert   *x509.Certificate
+	fullchain []*x509.Certificate
+}
+
+// initDegradedMode starts the goroutine that writes the queued renewals if
+// the degraded mode is configured.
+func (a *Authority) initDegradedMode() {
+	c := a.config.DegradedMode
+	if c == nil || a.degraded != nil {
+		return
+	}
+	d := &degradedMode{
+		breaker:          breaker.New("db", c.GetSettings()),
+		interval:         c.GetRetryInterval(),
+		maxQueue:         c.GetMaxQueuedRenewals(),
+		store:            a.storeRenewedCertificate,
+		listRevoked:      a.listRevokedForSnapshot,
+		now:              a.now,
+		snapshotInterval: c.GetRevocationSnapshotInterval(),
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+	d.unsubscribe = a.events.Subscribe(func(ev events.Event) {
+		if e, ok := ev.(*events.CertificateRevoked); ok && !e.SSH {
+			d.addRevoked(e.SerialNumber)
+		}
+	}, events.CertificateRevokedType)
+	go d.run()
+	a.degraded = d
+}
+
+// listRevokedForSnapshot returns the revoked certificates used in the
+// snapshot. With a linked CA, the revocations are not in the local database,
+// and there is no snapshot.
+func (a *Authority) listRevokedForSnapshot() ([]*db.RevokedCertificateInfo, error) {
+	if _, ok := a.adminDB.(interface {
+		IsRevoked(string) (bool, error)
+	}); ok {
+		return nil, db.ErrNotImplemented
+	}
+	if l, ok := a.db.(revokedCertificatesLister); ok {
+		return l.GetRevokedCertificates()
+	}
+	return nil, db.ErrNotImplemented
+}
+
+// do calls fn, a call to the database, through the breaker. Databases that do
+// not implement the call are not failures.
+func (d *degradedMode) do(fn func() error) error {
+	if d == nil {
+		return fn()
+	}
+	return d.breaker.Do(func() error {
+		if err := fn(); err != db.ErrNotImplemented {
+			return err
+		}
+		return nil
+	})
+}
+
+// enqueue adds a renewed certificate to the queue. It fails if the queue is
+// full.
+func (d *degradedMode) enqueue(oldCert *x509.Certificate, fullchain []*x509.Certificate) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queue) >= d.maxQueue {
+		return errs.NewErr(http.StatusServiceUnavailable, errors.New("degraded mode queue is full"),
+			errs.WithMessage("The certificate authority cannot reach its database. Please try again later."),
+			errs.WithRetryAfter(d.interval))
+	}
+	d.queue = append(d.queue, &queuedRenewal{
+		oldCert:   oldCert,
+		fullchain: fullchain,
+	})
+	return nil
+}
+
+// size returns the number of queued renewals.
+func (d *degradedMode) size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queue)
+}
+
+// flush writes the queued renewals in order. It stops at the first failure,
+// and the renewals not written are kept in the queue.
+func (d *degradedMode) flush() error {
+	d.mu.Lock()
+	queue := d.queue
+	d.queue = nil
+	d.mu.Unlock()
+
+	for i, q := range queue {
+		if err := d.do(func() error { return d.store(q.oldCert, q.fullchain) }); err != nil {
+			d.mu.Lock()
+			d.queue = append(queue[i:], d.queue...)
+			d.mu.Unlock()
+			return err
+		}
+	}
+	if len(queue) > 0 {
+		log.Printf("degraded mode: %d renewed certificates written to the database", len(queue))
+	}
+	return nil
+}
+
+// refreshRevoked replaces the snapshot of the revoked serials. The snapshot
+// is kept if the database is unavailable.
+func (d *degradedMode) refreshRevoked() error {
+	var list []*db.RevokedCertificateInfo
+	var listErr error
+	if err := d.do(func() error {
+		list, listErr = d.listRevoked()
+		return listErr
+	}); err != nil {
+		return err
+	}
+	// The databases that cannot list the revoked certificates do not have a
+	// snapshot.
+	if listErr != nil {
+		return listErr
+	}
+	revoked := make(map[string]struct{}, len(list))
+	for _, rci := range list {
+		revoked[rci.Serial] = struct{}{}
+	}
+	d.mu.Lock()
+	d.revoked = revoked
+	d.revokedAt = d.now()
+	d.mu.Unlock()
+	return nil
+}
+
+// addRevoked adds a serial revoked by this authority to the snapshot.
+func (d *degradedMode) addRevoked(sn string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.revoked != nil {
+		d.revoked[sn] = struct{}{}
+	}
+}
+
+// isRevoked checks a serial against the snapshot of the revoked serials. It
+// fails if there is no snapshot, a certificate is never renewed without a
+// revocation check.
+func (d *degradedMode) isRevoked(sn string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.revoked == nil {
+		return false, errs.NewErr(http.StatusServiceUnavailable, errors.New("database is unavailable and there is no snapshot of the revoked certificates"),
+			errs.WithMessage("The certificate authority cannot reach its database. Please try again later."),
+			errs.WithRetryAfter(d.interval))
+	}
+	_, ok := d.revoked[sn]
+	log.Printf("degraded mode: checking the revocation of certificate %s with a snapshot from %s", sn, d.revokedAt.Format(time.RFC3339))
+	return ok, nil
+}
+
+func (d *degradedMode) run() {
+	defer close(d.stopped)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	snapshotTicker := time.NewTicker(d.snapshotInterval)
+	defer snapshotTicker.Stop()
+	if err := d.refreshRevoked(); err != nil && err != db.ErrNotImplemented {
+		log.Printf("degraded mode: error taking a snapshot of the revoked certificates: %v", err)
+	}
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if err := d.flush(); err != nil && !breaker.IsOpen(err) {
+				log.Printf("degraded mode: error writing queued renewals: %v", err)
+			}
+		case <-snapshotTicker.C:
+			if err := d.refreshRevoked(); err != nil && err != db.ErrNotImplemented && !breaker.IsOpen(err) {
+				log.Printf("degraded mode: error taking a snapshot of the revoked certificates: %v", err)
+			}
+		}
+	}
+}
+
+// Stop stops the background writes, and makes a last attempt to write the
+// queued renewals. The renewals that cannot be written are lost.
+func (d *degradedMode) Stop() {
+	if d.unsubscribe != nil {
+		d.unsubscribe()
+	}
+	close(d.done)
+	<-d.stopped
+	if err := d.flush(); err != nil {
+		log.Printf("degraded mode: %d renewed certificates not written to the database: %v", d.size(), err)
+	}
+}
+
+// checkDegradedMode returns a 503 Service Unavailable error if the database
+// is unavailable and new certificates cannot be issued.
+func (a *Authority) checkDegradedMode() error {
+	if a.degraded == nil || a.degraded.breaker.State() != breaker.StateOpen {
+		return nil
+	}
+	return errs.NewErr(http.StatusServiceUnavailable, errors.New("database is unavailable"),
+		errs.WithMessage("The certificate authority cannot reach its database. New certificates cannot be issued, please try again later."),
+		errs.WithRetryAfter(a.degraded.interval))
+}
+
+// isRevokedForRenewal checks the passive revocation table before a renewal.
+// In degraded mode, the snapshot of the revoked serials is checked while the
+// database is unavailable.
+func (a *Authority) isRevokedForRenewal(sn string) (bool, error) {
+	if a.degraded == nil {
+		return a.IsRevoked(sn)
+	}
+	var isRevoked bool
+	err := a.degraded.do(func() (err error) {
+		isRevoked, err = a.IsRevoked(sn)
+		return
+	})
+	if breaker.IsOpen(err) {
+		return a.degraded.isRevoked(sn)
+	}
+	return isRevoked, err
+}
+
+// storeRenewedCertificateOrQueue stores a renewed certificate. In degraded
+// mode, the certificate is queued if the database is unavailable. If the
+// write-behind spool is enabled, it takes the place of the queue.
+func (a *Authority) storeRenewedCertificateOrQueue(oldCert *x509.Certificate, fullchain []*x509.Certificate) error {
+	if a.writeBehind != nil {
+		return a.writeOrSpool(spoolRenewedCertificate, newSpooledCertificate(oldCert, fullchain), func() error {
+			return a.degraded.do(func() error { return a.storeRenewedCertificate(oldCert, fullchain) })
+		})
+	}
+	if a.degraded == nil {
+		return a.storeRenewedCertificate(oldCert, fullchain)
+	}
+	err := a.degraded.do(func() error { return a.storeRenewedCertificate(oldCert, fullchain) })
+	if err != nil {
+		if !breaker.IsOpen(err) {
+			log.Printf("degraded mode: error storing certificate %s, queuing it: %v", fullchain[0].SerialNumber, err)
+		}
+		return a.degraded.enqueue(oldCert, fullchain)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package authority
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_degradedMode(t *testing.T) {
+	a := testAuthority(t)
+
+	var mu sync.Mutex
+	var down bool
+	var stored []string
+	a.db = &db.MockAuthDB{
+		MIsRevoked: func(string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if down {
+				return false, errors.New("connection refused")
+			}
+			return false, nil
+		},
+		MStoreCertificate: func(crt *x509.Certificate) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if down {
+				return errors.New("connection refused")
+			}
+			stored = append(stored, crt.SerialNumber.String())
+			return nil
+		},
+	}
+	setDown := func(v bool) {
+		mu.Lock()
+		down = v
+		mu.Unlock()
+	}
+	a.degraded = &degradedMode{
+		breaker:  breaker.New("db", &breaker.Settings{FailureThreshold: 1, OpenTimeout: 500 * time.Millisecond}),
+		interval: time.Minute,
+		maxQueue: 1,
+		store:    a.storeRenewedCertificate,
+		listRevoked: func() ([]*db.RevokedCertificateInfo, error) {
+			return nil, nil
+		},
+		now: time.Now,
+	}
+	assert.FatalError(t, a.degraded.refreshRevoked())
+
+	now := time.Now().UTC()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-7*time.Minute), now),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	assertStatus := func(t *testing.T, err error, code int) {
+		t.Helper()
+		sc, ok := err.(errs.StatusCoder)
+		assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+		assert.Equals(t, code, sc.StatusCode())
+	}
+
+	// The database is available
+	_, err := a.Renew(cert)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, stored)
+	assert.FatalError(t, a.checkDegradedMode())
+
+	// The failure opens the breaker
+	setDown(true)
+	_, err = a.Renew(cert)
+	assertStatus(t, err, http.StatusInternalServerError)
+
+	// New certificates are not issued, but renewals are queued
+	assertStatus(t, a.checkDegradedMode(), http.StatusServiceUnavailable)
+	certChain, err := a.Renew(cert)
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, a.degraded.size())
+
+	// Revoked certificates are not renewed
+	a.degraded.addRevoked(cert.SerialNumber.String())
+	_, err = a.Renew(cert)
+	assertStatus(t, err, http.StatusUnauthorized)
+	a.degraded.mu.Lock()
+	a.degraded.revoked = nil
+	a.degraded.mu.Unlock()
+
+	// The queue is full
+	_, err = a.Renew(cert)
+	assertStatus(t, err, http.StatusServiceUnavailable)
+
+	// Without a snapshot of the revoked serials, the renewals are refused
+	a.degraded.mu.Lock()
+	a.degraded.queue = nil
+	a.degraded.mu.Unlock()
+	_, err = a.Renew(cert)
+	assertStatus(t, err, http.StatusServiceUnavailable)
+	a.degraded.enqueue(cert, certChain)
+
+	// The database is back
+	setDown(false)
+	assert.True(t, breaker.IsOpen(a.degraded.flush()))
+	time.Sleep(500 * time.Millisecond)
+	assert.FatalError(t, a.degraded.flush())
+	assert.Equals(t, 0, a.degraded.size())
+	assert.Equals(t, []string{stored[0], certChain[0].SerialNumber.String()}, stored)
+	assert.FatalError(t, a.checkDegradedMode())
+}
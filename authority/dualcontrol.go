@@ -0,0 +1,390 @@
+package authority
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/randutil"
+	"go.step.sm/linkedca"
+)
+
+var dualControlTable = []byte("dual_control_operations")
+
+// dualControlQuorum is the number of distinct administrators that must
+// confirm an operation.
+const dualControlQuorum = 2
+
+// Actions of the federationChange operations.
+const (
+	// DualControlFederationAdd adds a federated authority, the parameters are
+	// the "name" and the PEM encoded "roots" of the authority.
+	DualControlFederationAdd = "add"
+	// DualControlFederationRemove removes the federated authority with the
+	// given "name".
+	DualControlFederationRemove = "remove"
+)
+
+// DualControlStatus is the status of an operation under dual control.
+type DualControlStatus string
+
+const (
+	// DualControlPending is the status of operations waiting for
+	// confirmations.
+	DualControlPending DualControlStatus = "pending"
+	// DualControlConfirmed is the status of operations confirmed by two
+	// administrators that have not been executed yet.
+	DualControlConfirmed DualControlStatus = "confirmed"
+	// DualControlExecuted is the status of operations that have been
+	// executed.
+	DualControlExecuted DualControlStatus = "executed"
+)
+
+// DualControlConfirmation is the confirmation of an operation by an
+// administrator. The token is the admin token used to confirm the operation,
+// signed by the administrator and bound to the request path.
+type DualControlConfirmation struct {
+	AdminID       string    `json:"adminID"`
+	Subject       string    `json:"subject"`
+	ProvisionerID string    `json:"provisionerID"`
+	Token         string    `json:"token"`
+	ConfirmedAt   time.Time `json:"confirmedAt"`
+}
+
+// DualControlOperation is an operation that touches the roots of the
+// authority and requires the confirmation of two distinct administrators.
+// The administrator that requests the operation is the first confirmation.
+// Operations are kept in the database with their confirmations after being
+// executed.
+type DualControlOperation struct {
+	ID            string                     `json:"id"`
+	Type          string                     `json:"type"`
+	Parameters    map[string]string          `json:"parameters"`
+	Status        DualControlStatus          `json:"status"`
+	Confirmations []*DualControlConfirmation `json:"confirmations"`
+	CreatedAt     time.Time                  `json:"createdAt"`
+	UpdatedAt     time.Time                  `json:"updatedAt"`
+	ExpiresAt     time.Time                  `json:"expiresAt"`
+}
+
+// isExpired returns true if a pending or confirmed operation has expired.
+// Executed operations do not expire.
+func (o *DualControlOperation) isExpired(now time.Time) bool {
+	return o.Status != DualControlExecuted && !now.Before(o.ExpiresAt)
+}
+
+// isConfirmedBy returns true if the given administrator, or an administrator
+// with the same subject, has already confirmed the operation.
+func (o *DualControlOperation) isConfirmedBy(adm *linkedca.Admin) bool {
+	for _, c := range o.Confirmations {
+		if c.AdminID == adm.Id || strings.EqualFold(c.Subject, adm.Subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasParameters returns true if the operation has exactly the given
+// parameters.
+func (o *DualControlOperation) hasParameters(params map[string]string) bool {
+	if len(o.Parameters) != len(params) {
+		return false
+	}
+	for k, v := range params {
+		if s, ok := o.Parameters[k]; !ok || s != v {
+			return false
+		}
+	}
+	return true
+}
+
+// dualControlStore keeps the operations under dual control in the database.
+type dualControlStore struct {
+	db nosql.DB
+}
+
+func newDualControlStore(db nosql.DB) (*dualControlStore, error) {
+	if err := db.CreateTable(dualControlTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(dualControlTable))
+	}
+	return &dualControlStore{db: db}, nil
+}
+
+func (s *dualControlStore) get(id string) (*DualControlOperation, error) {
+	b, err := s.db.Get(dualControlTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading operation %s", id)
+	}
+	o := new(DualControlOperation)
+	if err := json.Unmarshal(b, o); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling operation %s", id)
+	}
+	return o, nil
+}
+
+func (s *dualControlStore) list() ([]*DualControlOperation, error) {
+	entries, err := s.db.List(dualControlTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading operations")
+	}
+	operations := []*DualControlOperation{}
+	for _, e := range entries {
+		o := new(DualControlOperation)
+		if err := json.Unmarshal(e.Value, o); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling operation %s", string(e.Key))
+		}
+		operations = append(operations, o)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].CreatedAt.Before(operations[j].CreatedAt)
+	})
+	return operations, nil
+}
+
+func (s *dualControlStore) set(o *DualControlOperation) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling operation %s", o.ID)
+	}
+	return errors.Wrapf(s.db.Set(dualControlTable, []byte(o.ID), b), "error storing operation %s", o.ID)
+}
+
+func (s *dualControlStore) delete(id string) error {
+	return errors.Wrapf(s.db.Del(dualControlTable, []byte(id)), "error deleting operation %s", id)
+}
+
+// getDualControlStore returns the store of the operations under dual
+// control, it's created the first time it's used. It must be called with the
+// dualControlMutex held.
+func (a *Authority) getDualControlStore() (*dualControlStore, error) {
+	if a.dualControl == nil {
+		store, err := newDualControlStore(a.getStateDB())
+		if err != nil {
+			return nil, err
+		}
+		a.dualControl = store
+	}
+	return a.dualControl, nil
+}
+
+// IsDualControlRequired returns true if the given operation must be confirmed
+// by two distinct administrators.
+func (a *Authority) IsDualControlRequired(op string) bool {
+	return a.config.AuthorityConfig.DualControl.IsRequired(op)
+}
+
+// validateDualControlParameters validates the parameters of an operation.
+func validateDualControlParameters(op string, params map[string]string) error {
+	switch op {
+	case config.DualControlRootRegeneration, config.DualControlIntermediateResign:
+		if params["name"] == "" {
+			return errors.New("parameter name cannot be empty")
+		}
+		return nil
+	case config.DualControlFederationChange:
+		switch params["action"] {
+		case DualControlFederationAdd:
+			f := &FederatedAuthority{
+				Name:  params["name"],
+				Roots: []string{params["roots"]},
+			}
+			return f.Init()
+		case DualControlFederationRemove:
+			if params["name"] == "" {
+				return errors.New("parameter name cannot be empty")
+			}
+			return nil
+		default:
+			return errors.Errorf("unsupported federation action '%s'", params["action"])
+		}
+	default:
+		return errors.Errorf("unsupported operation '%s'", op)
+	}
+}
+
+// newDualControlConfirmation returns the confirmation of the given
+// administrator.
+func newDualControlConfirmation(adm *linkedca.Admin, token string, now time.Time) *DualControlConfirmation {
+	return &DualControlConfirmation{
+		AdminID:       adm.Id,
+		Subject:       adm.Subject,
+		ProvisionerID: adm.ProvisionerId,
+		Token:         token,
+		ConfirmedAt:   now,
+	}
+}
+
+// RequestDualControlOperation creates an operation that must be confirmed by
+// a second administrator before being executed. The request is the first
+// confirmation of the operation.
+func (a *Authority) RequestDualControlOperation(adm *linkedca.Admin, token, op string, params map[string]string) (*DualControlOperation, error) {
+	if adm == nil {
+		return nil, admin.NewError(admin.ErrorUnauthorizedType, "operation %s requires an administrator", op)
+	}
+	if !a.IsDualControlRequired(op) {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "operation %s does not require dual control", op)
+	}
+	if err := validateDualControlParameters(op, params); err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error validating operation %s", op)
+	}
+	id, err := randutil.Hex(16)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating operation id")
+	}
+
+	now := a.now().UTC().Truncate(time.Second)
+	o := &DualControlOperation{
+		ID:            id,
+		Type:          op,
+		Parameters:    params,
+		Status:        DualControlPending,
+		Confirmations: []*DualControlConfirmation{newDualControlConfirmation(adm, token, now)},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ExpiresAt:     now.Add(a.config.AuthorityConfig.DualControl.GetExpiry()),
+	}
+
+	a.dualControlMutex.Lock()
+	defer a.dualControlMutex.Unlock()
+	store, err := a.getDualControlStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading operations")
+	}
+	if err := store.set(o); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing operation")
+	}
+	return o, nil
+}
+
+// ConfirmDualControlOperation adds the confirmation of an administrator to the
+// operation with the given id. The administrator must be distinct from the
+// ones that have already confirmed it. Once confirmed, federation changes are
+// executed immediately, and the pki operations can be executed until the
+// operation expires.
+func (a *Authority) ConfirmDualControlOperation(id string, adm *linkedca.Admin, token string) (*DualControlOperation, error) {
+	if adm == nil {
+		return nil, admin.NewError(admin.ErrorUnauthorizedType, "operation %s requires an administrator", id)
+	}
+
+	a.dualControlMutex.Lock()
+	defer a.dualControlMutex.Unlock()
+	store, err := a.getDualControlStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading operation")
+	}
+	o, err := store.get(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading operation")
+	}
+	now := a.now().UTC().Truncate(time.Second)
+	if o == nil || o.isExpired(now) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "operation %s not found", id)
+	}
+	if o.Status != DualControlPending {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "operation %s is already %s", id, o.Status)
+	}
+	if o.isConfirmedBy(adm) {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "operation %s has already been confirmed by %s", id, adm.Subject)
+	}
+
+	o.Confirmations = append(o.Confirmations, newDualControlConfirmation(adm, token, now))
+	o.UpdatedAt = now
+	if len(o.Confirmations) >= dualControlQuorum {
+		o.Status = DualControlConfirmed
+		o.ExpiresAt = now.Add(a.config.AuthorityConfig.DualControl.GetExpiry())
+		if o.Type == config.DualControlFederationChange {
+			if err := a.executeFederationChange(o.Parameters); err != nil {
+				return nil, err
+			}
+			o.Status = DualControlExecuted
+		}
+	}
+	if err := store.set(o); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing operation")
+	}
+	return o, nil
+}
+
+// executeFederationChange adds or removes the federated authority in the
+// parameters of a confirmed operation.
+func (a *Authority) executeFederationChange(params map[string]string) error {
+	switch params["action"] {
+	case DualControlFederationAdd:
+		return a.AddFederatedAuthority(&FederatedAuthority{
+			Name:  params["name"],
+			Roots: []string{params["roots"]},
+		})
+	case DualControlFederationRemove:
+		return a.RemoveFederatedAuthority(params["name"])
+	default:
+		return admin.NewError(admin.ErrorBadRequestType, "unsupported federation action '%s'", params["action"])
+	}
+}
+
+// ExecuteDualControlOperation marks as executed the confirmed operation with
+// the given type and parameters. It returns an error if the operation requires
+// dual control and it has not been confirmed by two administrators. It is
+// used by the pki package before regenerating the root or signing a new
+// intermediate.
+func (a *Authority) ExecuteDualControlOperation(op string, params map[string]string) error {
+	if !a.IsDualControlRequired(op) {
+		return nil
+	}
+
+	a.dualControlMutex.Lock()
+	defer a.dualControlMutex.Unlock()
+	store, err := a.getDualControlStore()
+	if err != nil {
+		return err
+	}
+	operations, err := store.list()
+	if err != nil {
+		return err
+	}
+	now := a.now().UTC().Truncate(time.Second)
+	for _, o := range operations {
+		if o.Type == op && o.Status == DualControlConfirmed && !o.isExpired(now) && o.hasParameters(params) {
+			o.Status = DualControlExecuted
+			o.UpdatedAt = now
+			return store.set(o)
+		}
+	}
+	return errors.Errorf("operation %s has not been confirmed by %d administrators", op, dualControlQuorum)
+}
+
+// GetDualControlOperations returns the operations under dual control. The
+// expired operations are removed, executed ones are kept with their
+// confirmations.
+func (a *Authority) GetDualControlOperations() ([]*DualControlOperation, error) {
+	a.dualControlMutex.Lock()
+	defer a.dualControlMutex.Unlock()
+	store, err := a.getDualControlStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading operations")
+	}
+	operations, err := store.list()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading operations")
+	}
+
+	now := a.now().UTC()
+	active := operations[:0]
+	for _, o := range operations {
+		if o.isExpired(now) {
+			if err := store.delete(o.ID); err != nil {
+				return nil, admin.WrapErrorISE(err, "error deleting expired operation")
+			}
+			continue
+		}
+		active = append(active, o)
+	}
+	return active, nil
+}
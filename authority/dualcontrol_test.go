@@ -0,0 +1,109 @@
+package authority
+
+import (
+	"encoding/pem"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"go.step.sm/linkedca"
+)
+
+func TestAuthority_DualControl(t *testing.T) {
+	alice := &linkedca.Admin{Id: "alice-id", Subject: "alice@example.com", ProvisionerId: "prov-id"}
+	alice2 := &linkedca.Admin{Id: "alice-id-2", Subject: "ALICE@example.com", ProvisionerId: "prov-id-2"}
+	bob := &linkedca.Admin{Id: "bob-id", Subject: "bob@example.com", ProvisionerId: "prov-id"}
+	params := map[string]string{"name": "Smallstep", "org": "Smallstep", "resource": "smallstep"}
+
+	a := testAuthority(t)
+
+	// Dual control disabled
+	assert.False(t, a.IsDualControlRequired(config.DualControlRootRegeneration))
+	assert.FatalError(t, a.ExecuteDualControlOperation(config.DualControlRootRegeneration, params))
+	_, err := a.RequestDualControlOperation(alice, "alice-token", config.DualControlRootRegeneration, params)
+	assert.NotNil(t, err)
+
+	a.config.AuthorityConfig.DualControl = &config.DualControlConfig{
+		Operations: []string{config.DualControlRootRegeneration, config.DualControlFederationChange},
+	}
+	assert.True(t, a.IsDualControlRequired(config.DualControlRootRegeneration))
+	assert.False(t, a.IsDualControlRequired(config.DualControlIntermediateResign))
+	assert.FatalError(t, a.ExecuteDualControlOperation(config.DualControlIntermediateResign, params))
+
+	// Invalid requests
+	_, err = a.RequestDualControlOperation(nil, "", config.DualControlRootRegeneration, params)
+	assert.NotNil(t, err)
+	_, err = a.RequestDualControlOperation(alice, "alice-token", config.DualControlRootRegeneration, nil)
+	assert.NotNil(t, err)
+	_, err = a.RequestDualControlOperation(alice, "alice-token", config.DualControlFederationChange, map[string]string{"action": "update"})
+	assert.NotNil(t, err)
+
+	// Operation requires a second distinct administrator
+	o, err := a.RequestDualControlOperation(alice, "alice-token", config.DualControlRootRegeneration, params)
+	assert.FatalError(t, err)
+	assert.Equals(t, DualControlPending, o.Status)
+	assert.Len(t, 1, o.Confirmations)
+	assert.Equals(t, "alice-id", o.Confirmations[0].AdminID)
+	assert.Equals(t, "alice-token", o.Confirmations[0].Token)
+	assert.Equals(t, config.DefaultDualControlExpiry, o.ExpiresAt.Sub(o.CreatedAt))
+	assert.NotNil(t, a.ExecuteDualControlOperation(config.DualControlRootRegeneration, params))
+
+	_, err = a.ConfirmDualControlOperation(o.ID, alice, "alice-token-2")
+	assert.NotNil(t, err)
+	_, err = a.ConfirmDualControlOperation(o.ID, alice2, "alice2-token")
+	assert.NotNil(t, err)
+	_, err = a.ConfirmDualControlOperation("missing", bob, "bob-token")
+	assert.NotNil(t, err)
+
+	o, err = a.ConfirmDualControlOperation(o.ID, bob, "bob-token")
+	assert.FatalError(t, err)
+	assert.Equals(t, DualControlConfirmed, o.Status)
+	assert.Len(t, 2, o.Confirmations)
+	assert.Equals(t, "bob-id", o.Confirmations[1].AdminID)
+	assert.Equals(t, "bob-token", o.Confirmations[1].Token)
+	_, err = a.ConfirmDualControlOperation(o.ID, bob, "bob-token-2")
+	assert.NotNil(t, err)
+
+	// Confirmed operations are executed once with the same parameters
+	assert.NotNil(t, a.ExecuteDualControlOperation(config.DualControlRootRegeneration, map[string]string{"name": "Other"}))
+	assert.FatalError(t, a.ExecuteDualControlOperation(config.DualControlRootRegeneration, params))
+	assert.NotNil(t, a.ExecuteDualControlOperation(config.DualControlRootRegeneration, params))
+
+	operations, err := a.GetDualControlOperations()
+	assert.FatalError(t, err)
+	assert.Len(t, 1, operations)
+	assert.Equals(t, DualControlExecuted, operations[0].Status)
+
+	// Federation changes are executed on confirmation
+	root, _ := newAttestationCert(t, "Partner Root CA", true, nil, nil)
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+	o, err = a.RequestDualControlOperation(bob, "bob-token", config.DualControlFederationChange, map[string]string{
+		"action": DualControlFederationAdd,
+		"name":   "partner",
+		"roots":  rootPEM,
+	})
+	assert.FatalError(t, err)
+	_, err = a.Root(fingerprint(root))
+	assert.NotNil(t, err)
+	o, err = a.ConfirmDualControlOperation(o.ID, alice, "alice-token")
+	assert.FatalError(t, err)
+	assert.Equals(t, DualControlExecuted, o.Status)
+	crt, err := a.Root(fingerprint(root))
+	assert.FatalError(t, err)
+	assert.Equals(t, root, crt)
+
+	o, err = a.RequestDualControlOperation(alice, "alice-token", config.DualControlFederationChange, map[string]string{
+		"action": DualControlFederationRemove,
+		"name":   "partner",
+	})
+	assert.FatalError(t, err)
+	o, err = a.ConfirmDualControlOperation(o.ID, bob, "bob-token")
+	assert.FatalError(t, err)
+	assert.Equals(t, DualControlExecuted, o.Status)
+	_, err = a.Root(fingerprint(root))
+	assert.NotNil(t, err)
+
+	operations, err = a.GetDualControlOperations()
+	assert.FatalError(t, err)
+	assert.Len(t, 3, operations)
+}
@@ -0,0 +1,236 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/nosql"
+)
+
+var duplicatesTable = []byte("x509_certs_duplicates")
+
+// duplicatesPruneInterval is the interval between the removals of the
+// certificates that cannot be duplicated anymore.
+const duplicatesPruneInterval = time.Hour
+
+// duplicateCertificate is the last certificate issued for a provisioner, set
+// of subject alternative names and public key.
+type duplicateCertificate struct {
+	SerialNumber string    `json:"serialNumber"`
+	IssuedAt     time.Time `json:"issuedAt"`
+	NotAfter     time.Time `json:"notAfter"`
+	Chain        [][]byte  `json:"chain"`
+}
+
+// isDuplicateWindow returns true if a request at the given time is a
+// duplicate of the certificate: the certificate was issued less than window
+// ago and it has not expired. The certificates stored before the window was
+// introduced do not have an issuance time, and they are never duplicated.
+func (c *duplicateCertificate) isDuplicateWindow(now time.Time, window time.Duration) bool {
+	return now.Before(c.IssuedAt.Add(window)) && now.Before(c.NotAfter)
+}
+
+// duplicateStore keeps the last certificate issued for each key in the
+// database. The certificates are removed periodically once they cannot be
+// duplicated anymore.
+type duplicateStore struct {
+	db      nosql.DB
+	window  time.Duration
+	now     func() time.Time
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newDuplicateStore(db nosql.DB, window time.Duration) (*duplicateStore, error) {
+	if err := db.CreateTable(duplicatesTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(duplicatesTable))
+	}
+	return &duplicateStore{
+		db:      db,
+		window:  window,
+		now:     time.Now,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+func (s *duplicateStore) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(duplicatesPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.prune(s.now()); err != nil {
+				log.Printf("error removing issued certificates: %v", err)
+			}
+		}
+	}
+}
+
+// Stop stops the removal of the certificates.
+func (s *duplicateStore) Stop() {
+	close(s.done)
+	<-s.stopped
+}
+
+// prune removes the certificates that cannot be duplicated anymore.
+func (s *duplicateStore) prune(now time.Time) error {
+	entries, err := s.db.List(duplicatesTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing issued certificates")
+	}
+	for _, entry := range entries {
+		c := new(duplicateCertificate)
+		if err := json.Unmarshal(entry.Value, c); err != nil {
+			return errors.Wrapf(err, "error unmarshaling issued certificate %s", entry.Key)
+		}
+		if !c.isDuplicateWindow(now, s.window) {
+			if err := s.db.Del(duplicatesTable, entry.Key); err != nil {
+				return errors.Wrapf(err, "error deleting issued certificate %s", entry.Key)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *duplicateStore) get(key string) (*duplicateCertificate, error) {
+	b, err := s.db.Get(duplicatesTable, []byte(key))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading issued certificate %s", key)
+	}
+	c := new(duplicateCertificate)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling issued certificate %s", key)
+	}
+	return c, nil
+}
+
+func (s *duplicateStore) set(key string, c *duplicateCertificate) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling issued certificate %s", key)
+	}
+	return errors.Wrapf(s.db.Set(duplicatesTable, []byte(key), b), "error storing issued certificate %s", key)
+}
+
+// initDuplicates initializes the store used to detect duplicate certificates
+// and starts the removal of the old ones.
+func (a *Authority) initDuplicates() error {
+	if a.duplicates != nil {
+		a.duplicates.Stop()
+		a.duplicates = nil
+	}
+	if a.config.AuthorityConfig.Duplicates == nil {
+		return nil
+	}
+	store, err := newDuplicateStore(a.getStateDB(), a.config.AuthorityConfig.Duplicates.GetWindow())
+	if err != nil {
+		return err
+	}
+	store.now = a.now
+	a.duplicates = store
+	go store.run()
+	return nil
+}
+
+// duplicateKey returns the key identifying the duplicates of the given
+// certificate template: the SHA-256 of the provisioner name, the sorted
+// subject alternative names and the public key. It returns false if the
+// template does not have a provisioner.
+func duplicateKey(crt *x509.Certificate, csr *x509.CertificateRequest) (string, []string, bool) {
+	name, ok := provisioner.GetProvisionerName(crt.ExtraExtensions)
+	if !ok {
+		return "", nil, false
+	}
+	var sans []string
+	for _, s := range crt.DNSNames {
+		sans = append(sans, "dns:"+strings.ToLower(s))
+	}
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, "ip:"+ip.String())
+	}
+	for _, s := range crt.EmailAddresses {
+		sans = append(sans, "email:"+strings.ToLower(s))
+	}
+	for _, u := range crt.URIs {
+		sans = append(sans, "uri:"+u.String())
+	}
+	sort.Strings(sans)
+
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(sans, ",")))
+	h.Write([]byte{0})
+	h.Write(csr.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(h.Sum(nil)), append([]string{name}, sans...), true
+}
+
+// checkDuplicates returns the key of the given certificate template and, if
+// the mode is block, the chain of a previous certificate with the same key
+// issued within the duplicates window that has not expired or been revoked.
+// Duplicate requests are always logged.
+func (a *Authority) checkDuplicates(crt *x509.Certificate, csr *x509.CertificateRequest) (string, []*x509.Certificate, error) {
+	if a.duplicates == nil {
+		return "", nil, nil
+	}
+	key, identity, ok := duplicateKey(crt, csr)
+	if !ok {
+		return "", nil, nil
+	}
+	c, err := a.duplicates.get(key)
+	if err != nil || c == nil || !c.isDuplicateWindow(a.now(), a.duplicates.window) {
+		return key, nil, err
+	}
+	isRevoked, err := a.IsRevoked(c.SerialNumber)
+	if err != nil || isRevoked {
+		return key, nil, err
+	}
+
+	block := a.config.AuthorityConfig.Duplicates.IsBlock()
+	log.Printf("duplicate certificate request: provisioner %s and SANs %s match certificate %s (blocked: %t)",
+		identity[0], strings.Join(identity[1:], ", "), c.SerialNumber, block)
+	if !block {
+		return key, nil, nil
+	}
+
+	chain := make([]*x509.Certificate, len(c.Chain))
+	for i, der := range c.Chain {
+		if chain[i], err = x509.ParseCertificate(der); err != nil {
+			return "", nil, errors.Wrapf(err, "error parsing issued certificate %s", c.SerialNumber)
+		}
+	}
+	return key, chain, nil
+}
+
+// recordDuplicates stores the given certificate chain as the last one issued
+// for the key.
+func (a *Authority) recordDuplicates(key string, fullchain []*x509.Certificate) error {
+	if a.duplicates == nil || key == "" {
+		return nil
+	}
+	chain := make([][]byte, len(fullchain))
+	for i, crt := range fullchain {
+		chain[i] = crt.Raw
+	}
+	return a.duplicates.set(key, &duplicateCertificate{
+		SerialNumber: fullchain[0].SerialNumber.String(),
+		IssuedAt:     a.now(),
+		NotAfter:     fullchain[0].NotAfter,
+		Chain:        chain,
+	})
+}
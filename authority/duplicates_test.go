@@ -0,0 +1,145 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestAuthority_checkDuplicates(t *testing.T) {
+	a := testAuthority(t)
+
+	newCSR := func() *x509.CertificateRequest {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "foo.example.com"},
+		}, key)
+		assert.FatalError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		assert.FatalError(t, err)
+		return csr
+	}
+	newTemplate := func(name string, sans ...string) *x509.Certificate {
+		crt := &x509.Certificate{DNSNames: sans}
+		assert.FatalError(t, withProvisionerOID(name, "kid").Modify(crt, provisioner.SignOptions{}))
+		return crt
+	}
+	root, rootSigner := generateRootCertificate(t)
+	intermediate, intSigner := generateIntermidiateCertificate(t, root, rootSigner)
+	newChain := func(notAfter time.Time) []*x509.Certificate {
+		leaf := generateCertificate(t, "foo.example.com", []string{"foo.example.com"},
+			withNotBeforeNotAfter(notAfter.Add(-time.Hour), notAfter),
+			withSigner(intermediate, intSigner))
+		return []*x509.Certificate{leaf, intermediate}
+	}
+
+	csr := newCSR()
+	template := newTemplate("Max", "foo.example.com", "bar.example.com")
+
+	// Detection is not enabled
+	key, chain, err := a.checkDuplicates(template, csr)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", key)
+	assert.Nil(t, chain)
+
+	a.config.AuthorityConfig.Duplicates = &config.DuplicatesConfig{}
+	assert.FatalError(t, a.initDuplicates())
+
+	key, chain, err = a.checkDuplicates(template, csr)
+	assert.FatalError(t, err)
+	assert.NotEquals(t, "", key)
+	assert.Nil(t, chain)
+	issued := newChain(time.Now().Add(time.Hour))
+	assert.FatalError(t, a.recordDuplicates(key, issued))
+
+	// Duplicates are only logged in detect mode
+	sameKey, chain, err := a.checkDuplicates(newTemplate("Max", "BAR.example.com", "foo.example.com"), csr)
+	assert.FatalError(t, err)
+	assert.Equals(t, key, sameKey)
+	assert.Nil(t, chain)
+
+	// Block mode returns the previous chain, the order of the SANs does not
+	// matter
+	a.config.AuthorityConfig.Duplicates.Mode = config.DuplicatesBlock
+	_, chain, err = a.checkDuplicates(newTemplate("Max", "bar.example.com", "foo.example.com"), csr)
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, chain) {
+		assert.Equals(t, issued[0].Raw, chain[0].Raw)
+		assert.Equals(t, intermediate.Raw, chain[1].Raw)
+	}
+
+	// Other provisioners, SANs or keys are not duplicates
+	for _, tc := range []struct {
+		template *x509.Certificate
+		csr      *x509.CertificateRequest
+	}{
+		{newTemplate("dev", "foo.example.com", "bar.example.com"), csr},
+		{newTemplate("Max", "foo.example.com"), csr},
+		{template, newCSR()},
+	} {
+		otherKey, chain, err := a.checkDuplicates(tc.template, tc.csr)
+		assert.FatalError(t, err)
+		assert.NotEquals(t, key, otherKey)
+		assert.Nil(t, chain)
+	}
+
+	// Templates without a provisioner are not checked
+	otherKey, chain, err := a.checkDuplicates(&x509.Certificate{DNSNames: []string{"foo.example.com"}}, csr)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", otherKey)
+	assert.Nil(t, chain)
+
+	// Certificates issued before the window are not duplicates
+	assert.FatalError(t, a.duplicates.set(key, &duplicateCertificate{
+		SerialNumber: issued[0].SerialNumber.String(),
+		IssuedAt:     time.Now().Add(-config.DefaultDuplicatesWindow),
+		NotAfter:     issued[0].NotAfter,
+		Chain:        [][]byte{issued[0].Raw, intermediate.Raw},
+	}))
+	_, chain, err = a.checkDuplicates(template, csr)
+	assert.FatalError(t, err)
+	assert.Nil(t, chain)
+
+	// Expired certificates are not duplicates
+	assert.FatalError(t, a.recordDuplicates(key, newChain(time.Now().Add(-time.Minute))))
+	_, chain, err = a.checkDuplicates(template, csr)
+	assert.FatalError(t, err)
+	assert.Nil(t, chain)
+
+	a.duplicates.Stop()
+}
+
+func TestDuplicateStore_prune(t *testing.T) {
+	a := testAuthority(t)
+	a.config.AuthorityConfig.Duplicates = &config.DuplicatesConfig{}
+	assert.FatalError(t, a.initDuplicates())
+	defer a.duplicates.Stop()
+
+	now := time.Now()
+	for key, c := range map[string]*duplicateCertificate{
+		"active":  {IssuedAt: now, NotAfter: now.Add(time.Hour)},
+		"window":  {IssuedAt: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)},
+		"expired": {IssuedAt: now, NotAfter: now.Add(-time.Second)},
+		"legacy":  {NotAfter: now.Add(time.Hour)},
+	} {
+		assert.FatalError(t, a.duplicates.set(key, c))
+	}
+
+	assert.FatalError(t, a.duplicates.prune(now))
+	for key, want := range map[string]bool{
+		"active": true, "window": false, "expired": false, "legacy": false,
+	} {
+		c, err := a.duplicates.get(key)
+		assert.FatalError(t, err)
+		assert.Equals(t, want, c != nil, key)
+	}
+}
@@ -0,0 +1,222 @@
+// Package events implements the in-process event bus used by the authority to
+// notify the lifecycle of certificates and provisioners.
+package events
+
+import (
+	"crypto/x509"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Type is the type of an event.
+type Type string
+
+// Event types.
+const (
+	CertificateIssuedType    Type = "certificateIssued"
+	CertificateRenewedType   Type = "certificateRenewed"
+	CertificateRevokedType   Type = "certificateRevoked"
+	SSHCertificateIssuedType Type = "sshCertificateIssued"
+	ProvisionerUpdatedType   Type = "provisionerUpdated"
+)
+
+// Event is the interface implemented by all the events.
+type Event interface {
+	EventType() Type
+	EventTime() time.Time
+}
+
+// CertificateIssued is emitted when a new X.509 certificate is signed.
+type CertificateIssued struct {
+	Time        time.Time
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	Provisioner string
+	AccountID   string
+}
+
+// EventType implements the Event interface.
+func (e *CertificateIssued) EventType() Type { return CertificateIssuedType }
+
+// EventTime implements the Event interface.
+func (e *CertificateIssued) EventTime() time.Time { return e.Time }
+
+// CertificateRenewed is emitted when an X.509 certificate is renewed or
+// rekeyed.
+type CertificateRenewed struct {
+	Time        time.Time
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	Previous    *x509.Certificate
+	Rekey       bool
+}
+
+// EventType implements the Event interface.
+func (e *CertificateRenewed) EventType() Type { return CertificateRenewedType }
+
+// EventTime implements the Event interface.
+func (e *CertificateRenewed) EventTime() time.Time { return e.Time }
+
+// CertificateRevoked is emitted when an X.509 or SSH certificate is revoked.
+// The certificate is only available if it was provided in the request or
+// stored in the database.
+type CertificateRevoked struct {
+	Time          time.Time
+	SerialNumber  string
+	ReasonCode    int
+	Reason        string
+	ProvisionerID string
+	MTLS          bool
+	SSH           bool
+	Certificate   *x509.Certificate
+}
+
+// EventType implements the Event interface.
+func (e *CertificateRevoked) EventType() Type { return CertificateRevokedType }
+
+// EventTime implements the Event interface.
+func (e *CertificateRevoked) EventTime() time.Time { return e.Time }
+
+// SSHCertificateIssued is emitted when an SSH certificate is signed, renewed
+// or rekeyed.
+type SSHCertificateIssued struct {
+	Time        time.Time
+	Certificate *ssh.Certificate
+	Renewal     bool
+}
+
+// EventType implements the Event interface.
+func (e *SSHCertificateIssued) EventType() Type { return SSHCertificateIssuedType }
+
+// EventTime implements the Event interface.
+func (e *SSHCertificateIssued) EventTime() time.Time { return e.Time }
+
+// ProvisionerAction is the change done to a provisioner.
+type ProvisionerAction string
+
+// Provisioner actions.
+const (
+	ProvisionerActionCreated ProvisionerAction = "created"
+	ProvisionerActionUpdated ProvisionerAction = "updated"
+	ProvisionerActionRemoved ProvisionerAction = "removed"
+)
+
+// ProvisionerUpdated is emitted when a provisioner is created, updated or
+// removed.
+type ProvisionerUpdated struct {
+	Time   time.Time
+	ID     string
+	Name   string
+	Type   string
+	Action ProvisionerAction
+}
+
+// EventType implements the Event interface.
+func (e *ProvisionerUpdated) EventType() Type { return ProvisionerUpdatedType }
+
+// EventTime implements the Event interface.
+func (e *ProvisionerUpdated) EventTime() time.Time { return e.Time }
+
+// Handler is the function called with the events a subscriber receives.
+type Handler func(Event)
+
+// DefaultBufferSize is the number of events queued for each subscriber. If a
+// subscriber cannot keep up, new events for it are dropped.
+const DefaultBufferSize = 1024
+
+type subscriber struct {
+	events  chan Event
+	types   map[Type]bool
+	handler Handler
+	done    chan struct{}
+}
+
+func (s *subscriber) run() {
+	defer close(s.done)
+	for e := range s.events {
+		s.handle(e)
+	}
+}
+
+func (s *subscriber) handle(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("error handling event %s: %v", e.EventType(), r)
+		}
+	}()
+	s.handler(e)
+}
+
+// Bus delivers the published events to the subscribers. Each subscriber
+// receives the events in order in its own goroutine, so a slow subscriber
+// does not block the authority or the other subscribers.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+	bufferSize  int
+}
+
+// NewBus creates a new event bus.
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*subscriber]struct{}),
+		bufferSize:  DefaultBufferSize,
+	}
+}
+
+// Subscribe registers a handler for the given event types, or for all of them
+// if none is given. It returns a function that removes the subscription and
+// waits until the queued events are handled.
+func (b *Bus) Subscribe(h Handler, types ...Type) (unsubscribe func()) {
+	s := &subscriber{
+		events:  make(chan Event, b.bufferSize),
+		handler: h,
+		done:    make(chan struct{}),
+	}
+	if len(types) > 0 {
+		s.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	go s.run()
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, s)
+			close(s.events)
+			b.mu.Unlock()
+			<-s.done
+		})
+	}
+}
+
+// Publish sends the event to the subscribers. It never blocks, if the queue
+// of a subscriber is full the event is dropped for it. Publishing in a nil bus
+// is a noop.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subscribers {
+		if s.types != nil && !s.types[e.EventType()] {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			log.Printf("event %s dropped, subscriber queue is full", e.EventType())
+		}
+	}
+}
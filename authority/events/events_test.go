@@ -0,0 +1,103 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	var all, revoked []Event
+	unsubscribeAll := bus.Subscribe(func(e Event) {
+		mu.Lock()
+		all = append(all, e)
+		mu.Unlock()
+	})
+	unsubscribeRevoked := bus.Subscribe(func(e Event) {
+		mu.Lock()
+		revoked = append(revoked, e)
+		mu.Unlock()
+	}, CertificateRevokedType)
+
+	issued := &CertificateIssued{Time: time.Now(), Provisioner: "foo"}
+	revokedEvent := &CertificateRevoked{Time: time.Now(), SerialNumber: "1234"}
+	updated := &ProvisionerUpdated{Time: time.Now(), Name: "foo", Action: ProvisionerActionCreated}
+	bus.Publish(issued)
+	bus.Publish(revokedEvent)
+	bus.Publish(updated)
+
+	unsubscribeAll()
+	unsubscribeRevoked()
+	assert.Equals(t, []Event{issued, revokedEvent, updated}, all)
+	assert.Equals(t, []Event{revokedEvent}, revoked)
+
+	// Events are not delivered after unsubscribe.
+	bus.Publish(issued)
+	assert.Equals(t, []Event{issued, revokedEvent, updated}, all)
+
+	// Unsubscribe can be called multiple times.
+	unsubscribeAll()
+}
+
+func TestBus_Publish(t *testing.T) {
+	// Publishing in a nil bus is a noop.
+	var nilBus *Bus
+	nilBus.Publish(&CertificateIssued{})
+
+	// A panic in a handler does not stop the subscription.
+	bus := NewBus()
+	var got []Type
+	unsubscribe := bus.Subscribe(func(e Event) {
+		if e.EventType() == CertificateIssuedType {
+			panic("foo")
+		}
+		got = append(got, e.EventType())
+	})
+	bus.Publish(&CertificateIssued{})
+	bus.Publish(&SSHCertificateIssued{})
+	unsubscribe()
+	assert.Equals(t, []Type{SSHCertificateIssuedType}, got)
+
+	// Events are dropped if the queue is full.
+	bus = &Bus{subscribers: make(map[*subscriber]struct{}), bufferSize: 1}
+	block := make(chan struct{})
+	var count int
+	unsubscribe = bus.Subscribe(func(e Event) {
+		<-block
+		count++
+	})
+	for i := 0; i < 10; i++ {
+		bus.Publish(&CertificateRenewed{})
+	}
+	close(block)
+	unsubscribe()
+	if count < 1 || count > 2 {
+		t.Errorf("Bus.Publish() delivered %d events, want 1 or 2", count)
+	}
+}
+
+func TestEvent_EventTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		event    Event
+		wantType Type
+	}{
+		{"CertificateIssued", &CertificateIssued{Time: now}, CertificateIssuedType},
+		{"CertificateRenewed", &CertificateRenewed{Time: now}, CertificateRenewedType},
+		{"CertificateRevoked", &CertificateRevoked{Time: now}, CertificateRevokedType},
+		{"SSHCertificateIssued", &SSHCertificateIssued{Time: now}, SSHCertificateIssuedType},
+		{"ProvisionerUpdated", &ProvisionerUpdated{Time: now}, ProvisionerUpdatedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.wantType, tt.event.EventType())
+			assert.Equals(t, now, tt.event.EventTime())
+		})
+	}
+}
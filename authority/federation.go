@@ -0,0 +1,222 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/nosql"
+)
+
+var federationTable = []byte("federated_authorities")
+
+// Sources of the authorities in the federation.
+const (
+	// FederationSourceRoot is the source of the roots of this authority.
+	FederationSourceRoot = "root"
+	// FederationSourceConfig is the source of the federated roots in the
+	// configuration.
+	FederationSourceConfig = "config"
+	// FederationSourceAdmin is the source of the federated authorities added
+	// with the admin API.
+	FederationSourceAdmin = "admin"
+)
+
+// FederatedAuthority is a certificate authority in the federation. The roots
+// of this authority and the federated roots in the configuration are listed
+// with the name in the subject of each root. Federated authorities added with
+// the admin API are kept in the database if the authority has one.
+type FederatedAuthority struct {
+	// Name is the unique name of the authority.
+	Name string `json:"name"`
+	// Source is where the authority is defined, root, config or admin.
+	Source string `json:"source"`
+	// Roots is the list of PEM encoded root certificates of the authority.
+	Roots        []string `json:"roots"`
+	certificates []*x509.Certificate
+}
+
+// Init validates and initializes the federated authority.
+func (f *FederatedAuthority) Init() error {
+	if strings.TrimSpace(f.Name) == "" {
+		return errors.New("name cannot be empty")
+	}
+	if len(f.Roots) == 0 {
+		return errors.New("roots cannot be empty")
+	}
+	f.certificates = make([]*x509.Certificate, 0, len(f.Roots))
+	for i, s := range f.Roots {
+		rest := []byte(s)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				return errors.Errorf("roots[%d] is not a PEM encoded certificate", i)
+			}
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.Wrapf(err, "error parsing roots[%d]", i)
+			}
+			if !crt.BasicConstraintsValid || !crt.IsCA {
+				return errors.Errorf("roots[%d] is not a CA certificate", i)
+			}
+			f.certificates = append(f.certificates, crt)
+		}
+		if len(strings.TrimSpace(string(rest))) > 0 {
+			return errors.Errorf("roots[%d] is not a PEM encoded certificate", i)
+		}
+	}
+	if len(f.certificates) == 0 {
+		return errors.New("roots cannot be empty")
+	}
+	return nil
+}
+
+// Certificates returns the root certificates of the federated authority.
+func (f *FederatedAuthority) Certificates() []*x509.Certificate {
+	return f.certificates
+}
+
+// newFederatedAuthority returns the federated authority of a root of this
+// authority or a federated root in the configuration.
+func newFederatedAuthority(source string, crt *x509.Certificate) *FederatedAuthority {
+	name := crt.Subject.CommonName
+	if name == "" {
+		name = crt.Subject.String()
+	}
+	return &FederatedAuthority{
+		Name:   name,
+		Source: source,
+		Roots: []string{string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		}))},
+		certificates: []*x509.Certificate{crt},
+	}
+}
+
+// fingerprint returns the SHA-256 fingerprint used as the key of the
+// certificates map.
+func fingerprint(crt *x509.Certificate) string {
+	sum := sha256.Sum256(crt.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetFederatedAuthorities returns the authorities in the federation, starting
+// with the roots of this authority, followed by the federated roots in the
+// configuration and the federated authorities added with the admin API.
+func (a *Authority) GetFederatedAuthorities() ([]*FederatedAuthority, error) {
+	list := make([]*FederatedAuthority, 0, len(a.rootX509Certs)+len(a.federatedX509Certs))
+	for _, crt := range a.rootX509Certs {
+		list = append(list, newFederatedAuthority(FederationSourceRoot, crt))
+	}
+	for _, crt := range a.federatedX509Certs {
+		list = append(list, newFederatedAuthority(FederationSourceConfig, crt))
+	}
+
+	a.federationMutex.RLock()
+	defer a.federationMutex.RUnlock()
+	names := make([]string, 0, len(a.federatedAuthorities))
+	for name := range a.federatedAuthorities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, a.federatedAuthorities[name])
+	}
+	return list, nil
+}
+
+// AddFederatedAuthority validates and adds a federated authority. Its roots
+// are immediately part of the federation.
+func (a *Authority) AddFederatedAuthority(f *FederatedAuthority) error {
+	f.Source = FederationSourceAdmin
+	if err := f.Init(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error validating federated authority")
+	}
+
+	a.federationMutex.Lock()
+	defer a.federationMutex.Unlock()
+	if _, ok := a.federatedAuthorities[f.Name]; ok {
+		return admin.NewError(admin.ErrorBadRequestType, "federated authority %s already exists", f.Name)
+	}
+	for _, crt := range f.certificates {
+		if _, ok := a.certificates.Load(fingerprint(crt)); ok {
+			return admin.NewError(admin.ErrorBadRequestType, "root %s is already in the federation", fingerprint(crt))
+		}
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error marshaling federated authority")
+	}
+	if err := a.getStateDB().Set(federationTable, []byte(f.Name), b); err != nil {
+		return admin.WrapErrorISE(err, "error storing federated authority")
+	}
+	for _, crt := range f.certificates {
+		a.certificates.Store(fingerprint(crt), crt)
+	}
+	a.federatedAuthorities[f.Name] = f
+	return nil
+}
+
+// RemoveFederatedAuthority removes a federated authority added with the admin
+// API. Its roots are immediately removed from the federation.
+func (a *Authority) RemoveFederatedAuthority(name string) error {
+	a.federationMutex.Lock()
+	defer a.federationMutex.Unlock()
+	f, ok := a.federatedAuthorities[name]
+	if !ok {
+		return admin.NewError(admin.ErrorNotFoundType, "federated authority %s not found", name)
+	}
+	if err := a.getStateDB().Del(federationTable, []byte(name)); err != nil {
+		return admin.WrapErrorISE(err, "error deleting federated authority")
+	}
+	for _, crt := range f.certificates {
+		a.certificates.Delete(fingerprint(crt))
+	}
+	delete(a.federatedAuthorities, name)
+	return nil
+}
+
+// initFederation loads the federated authorities added with the admin API and
+// stores their roots in the certificates map.
+func (a *Authority) initFederation() error {
+	authorities := make(map[string]*FederatedAuthority)
+	db := a.getStateDB()
+	if err := db.CreateTable(federationTable); err != nil {
+		return errors.Wrapf(err, "error creating table %s", string(federationTable))
+	}
+	entries, err := db.List(federationTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return errors.Wrap(err, "error loading federated authorities")
+	}
+	for _, e := range entries {
+		f := new(FederatedAuthority)
+		if err := json.Unmarshal(e.Value, f); err != nil {
+			return errors.Wrapf(err, "error unmarshaling federated authority %s", string(e.Key))
+		}
+		if err := f.Init(); err != nil {
+			return errors.Wrapf(err, "error initializing federated authority %s", string(e.Key))
+		}
+		authorities[f.Name] = f
+	}
+
+	a.federationMutex.Lock()
+	defer a.federationMutex.Unlock()
+	for _, f := range authorities {
+		for _, crt := range f.certificates {
+			a.certificates.Store(fingerprint(crt), crt)
+		}
+	}
+	a.federatedAuthorities = authorities
+	return nil
+}
@@ -0,0 +1,91 @@
+package authority
+
+import (
+	"encoding/pem"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestFederatedAuthority_Init(t *testing.T) {
+	root, _ := newAttestationCert(t, "Partner Root CA", true, nil, nil)
+	root2, _ := newAttestationCert(t, "Partner Root CA 2", true, nil, nil)
+	leaf, _ := newAttestationCert(t, "leaf", false, nil, nil)
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+	root2PEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root2.Raw}))
+	leafPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}))
+
+	tests := []struct {
+		name      string
+		authority *FederatedAuthority
+		wantCerts int
+		wantErr   bool
+	}{
+		{"ok", &FederatedAuthority{Name: "partner", Roots: []string{rootPEM}}, 1, false},
+		{"ok multiple", &FederatedAuthority{Name: "partner", Roots: []string{rootPEM, root2PEM}}, 2, false},
+		{"ok bundle", &FederatedAuthority{Name: "partner", Roots: []string{rootPEM + root2PEM}}, 2, false},
+		{"fail name", &FederatedAuthority{Name: " ", Roots: []string{rootPEM}}, 0, true},
+		{"fail no roots", &FederatedAuthority{Name: "partner"}, 0, true},
+		{"fail empty root", &FederatedAuthority{Name: "partner", Roots: []string{""}}, 0, true},
+		{"fail garbage", &FederatedAuthority{Name: "partner", Roots: []string{rootPEM + "foo"}}, 0, true},
+		{"fail type", &FederatedAuthority{Name: "partner", Roots: []string{string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: root.Raw}))}}, 0, true},
+		{"fail parse", &FederatedAuthority{Name: "partner", Roots: []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("foo")}))}}, 0, true},
+		{"fail leaf", &FederatedAuthority{Name: "partner", Roots: []string{leafPEM}}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.authority.Init()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FederatedAuthority.Init() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equals(t, tt.wantCerts, len(tt.authority.Certificates()))
+			}
+		})
+	}
+}
+
+func TestAuthority_AddFederatedAuthority(t *testing.T) {
+	a := testAuthority(t)
+	root, _ := newAttestationCert(t, "Partner Root CA", true, nil, nil)
+	rootPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+
+	federation, err := a.GetFederation()
+	assert.FatalError(t, err)
+	assert.Len(t, 1, federation)
+	authorities, err := a.GetFederatedAuthorities()
+	assert.FatalError(t, err)
+	assert.Len(t, 1, authorities)
+	assert.Equals(t, "smallstep Root CA", authorities[0].Name)
+	assert.Equals(t, FederationSourceRoot, authorities[0].Source)
+
+	// Invalid or duplicated authorities
+	assert.NotNil(t, a.AddFederatedAuthority(&FederatedAuthority{Name: "partner"}))
+	assert.NotNil(t, a.AddFederatedAuthority(&FederatedAuthority{Name: "self", Roots: authorities[0].Roots}))
+
+	f := &FederatedAuthority{Name: "partner", Roots: []string{rootPEM}}
+	assert.FatalError(t, a.AddFederatedAuthority(f))
+	assert.Equals(t, FederationSourceAdmin, f.Source)
+	assert.NotNil(t, a.AddFederatedAuthority(&FederatedAuthority{Name: "partner", Roots: []string{rootPEM}}))
+
+	federation, err = a.GetFederation()
+	assert.FatalError(t, err)
+	assert.Len(t, 2, federation)
+	crt, err := a.Root(fingerprint(root))
+	assert.FatalError(t, err)
+	assert.Equals(t, root, crt)
+	authorities, err = a.GetFederatedAuthorities()
+	assert.FatalError(t, err)
+	assert.Len(t, 2, authorities)
+	assert.Equals(t, f, authorities[1])
+
+	assert.FatalError(t, a.RemoveFederatedAuthority("partner"))
+	assert.NotNil(t, a.RemoveFederatedAuthority("partner"))
+	assert.NotNil(t, a.RemoveFederatedAuthority("smallstep Root CA"))
+	federation, err = a.GetFederation()
+	assert.FatalError(t, err)
+	assert.Len(t, 1, federation)
+	_, err = a.Root(fingerprint(root))
+	assert.NotNil(t, err)
+}
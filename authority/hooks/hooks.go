@@ -0,0 +1,135 @@
+// Package hooks defines the policy hooks used to take custom decisions on the
+// issuance of certificates. A hook receives the resolved sign request and
+// returns if the request is allowed, denied, or allowed with some changes.
+package hooks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Request types.
+const (
+	X509Request = "x509"
+	SSHRequest  = "ssh"
+)
+
+// Actions returned in a Decision.
+const (
+	ActionAllow  = "allow"
+	ActionDeny   = "deny"
+	ActionMutate = "mutate"
+)
+
+// Provisioner identifies the provisioner that authorized a request.
+type Provisioner struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Identity is the normalized identity of the principal authenticated by the
+// provisioner.
+type Identity struct {
+	Provisioner string                 `json:"provisioner"`
+	Type        string                 `json:"type"`
+	Subject     string                 `json:"subject"`
+	Email       string                 `json:"email,omitempty"`
+	Groups      []string               `json:"groups,omitempty"`
+	Names       []string               `json:"names,omitempty"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// X509Certificate contains the attributes of an X.509 certificate request.
+type X509Certificate struct {
+	CommonName     string    `json:"commonName"`
+	DNSNames       []string  `json:"dnsNames,omitempty"`
+	EmailAddresses []string  `json:"emailAddresses,omitempty"`
+	IPAddresses    []string  `json:"ipAddresses,omitempty"`
+	URIs           []string  `json:"uris,omitempty"`
+	NotBefore      time.Time `json:"notBefore"`
+	NotAfter       time.Time `json:"notAfter"`
+}
+
+// SSHCertificate contains the attributes of an SSH certificate request.
+type SSHCertificate struct {
+	CertType    string    `json:"certType"`
+	KeyID       string    `json:"keyID"`
+	Principals  []string  `json:"principals,omitempty"`
+	ValidAfter  time.Time `json:"validAfter"`
+	ValidBefore time.Time `json:"validBefore"`
+}
+
+// Request is the resolved sign request sent to a hook. Token contains the
+// claims of the token used to authorize the request, and Identity the identity
+// document resolved by the provisioner, if any.
+type Request struct {
+	Type        string                 `json:"type"`
+	Provisioner *Provisioner           `json:"provisioner"`
+	Token       map[string]interface{} `json:"token,omitempty"`
+	Identity    *Identity              `json:"identity,omitempty"`
+	X509        *X509Certificate       `json:"x509,omitempty"`
+	SSH         *SSHCertificate        `json:"ssh,omitempty"`
+}
+
+// Mutations are the changes requested by a hook. Only the attributes present
+// in the decision are changed, an empty list removes all the values.
+type Mutations struct {
+	CommonName     *string  `json:"commonName,omitempty"`
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	KeyID          *string  `json:"keyID,omitempty"`
+	Principals     []string `json:"principals,omitempty"`
+}
+
+// Decision is the response of a hook.
+type Decision struct {
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason,omitempty"`
+	Mutations *Mutations `json:"mutations,omitempty"`
+}
+
+// Validate validates the decision returned by a hook.
+func (d *Decision) Validate() error {
+	switch {
+	case d == nil:
+		return errors.New("decision cannot be empty")
+	case d.Action == ActionAllow, d.Action == ActionDeny:
+		return nil
+	case d.Action == ActionMutate:
+		if d.Mutations == nil {
+			return errors.New("decision with action mutate must contain the mutations")
+		}
+		return nil
+	default:
+		return errors.Errorf("decision action '%s' is not valid", d.Action)
+	}
+}
+
+// Hook is the interface implemented by the policy hooks.
+type Hook interface {
+	Evaluate(ctx context.Context, req *Request) (*Decision, error)
+}
+
+type failOpenHook struct {
+	Hook
+}
+
+// FailOpen returns a hook that allows the request if the given hook fails.
+func FailOpen(h Hook) Hook {
+	return &failOpenHook{Hook: h}
+}
+
+func (h *failOpenHook) Evaluate(ctx context.Context, req *Request) (*Decision, error) {
+	d, err := h.Hook.Evaluate(ctx, req)
+	if err != nil {
+		log.Printf("error evaluating policy hook, the request is allowed: %v", err)
+		return &Decision{Action: ActionAllow}, nil
+	}
+	return d, nil
+}
@@ -0,0 +1,65 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type hookFunc func(ctx context.Context, req *Request) (*Decision, error)
+
+func (fn hookFunc) Evaluate(ctx context.Context, req *Request) (*Decision, error) {
+	return fn(ctx, req)
+}
+
+func TestDecision_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision *Decision
+		wantErr  bool
+	}{
+		{"ok allow", &Decision{Action: ActionAllow}, false},
+		{"ok deny", &Decision{Action: ActionDeny, Reason: "not allowed"}, false},
+		{"ok mutate", &Decision{Action: ActionMutate, Mutations: &Mutations{DNSNames: []string{"foo"}}}, false},
+		{"fail nil", nil, true},
+		{"fail empty", &Decision{}, true},
+		{"fail action", &Decision{Action: "foo"}, true},
+		{"fail mutate", &Decision{Action: ActionMutate}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.decision.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Decision.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailOpen(t *testing.T) {
+	deny := &Decision{Action: ActionDeny}
+	tests := []struct {
+		name string
+		hook Hook
+		want *Decision
+	}{
+		{"ok", hookFunc(func(ctx context.Context, req *Request) (*Decision, error) {
+			return deny, nil
+		}), deny},
+		{"ok error", hookFunc(func(ctx context.Context, req *Request) (*Decision, error) {
+			return nil, errors.New("an error")
+		}), &Decision{Action: ActionAllow}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FailOpen(tt.hook).Evaluate(context.Background(), &Request{Type: X509Request})
+			if err != nil {
+				t.Errorf("failOpenHook.Evaluate() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failOpenHook.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
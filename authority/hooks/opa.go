@@ -0,0 +1,159 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+)
+
+// DefaultOPATimeout is the default timeout of the queries to the Open Policy
+// Agent server.
+const DefaultOPATimeout = 5 * time.Second
+
+// maxOPAResponseSize is the maximum size of a response of the Open Policy
+// Agent server.
+const maxOPAResponseSize = 1024 * 1024
+
+// OPA is a hook that delegates the decision to an Open Policy Agent server
+// using the Data API. The request is sent as the input of the query, and the
+// document at the given path must be a boolean, where true allows and false
+// denies the request, or a Decision.
+//
+// If a Breaker is set, the queries fail right away while it is open.
+type OPA struct {
+	URL          string
+	Path         string
+	Token        string
+	Timeout      time.Duration
+	DecisionLogs bool
+	Client       *http.Client
+	Breaker      *breaker.Breaker
+}
+
+type opaRequest struct {
+	Input *Request `json:"input"`
+}
+
+type opaResponse struct {
+	DecisionID string          `json:"decision_id,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+}
+
+// Evaluate queries the Open Policy Agent server with the given request.
+func (o *OPA) Evaluate(ctx context.Context, req *Request) (*Decision, error) {
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = DefaultOPATimeout
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	b, err := json.Marshal(opaRequest{Input: req})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling policy request")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	path := strings.Trim(o.Path, "/")
+	u := strings.TrimRight(o.URL, "/") + "/v1/data/" + path
+	var body []byte
+	err = o.Breaker.Do(func() (err error) {
+		body, err = o.query(ctx, client, u, b)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res opaResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, errors.Wrapf(err, "error parsing response from %s", u)
+	}
+	d, err := parseOPAResult(res.Result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing decision from %s", u)
+	}
+	if o.DecisionLogs {
+		logOPADecision(path, res.DecisionID, req, d)
+	}
+	return d, nil
+}
+
+// query sends the request to the Data API and returns the body of the
+// response.
+func (o *OPA) query(ctx context.Context, client *http.Client, u string, b []byte) ([]byte, error) {
+	r, err := http.NewRequest("POST", u, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to %s", u)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	if o.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+o.Token)
+	}
+
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying %s", u)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOPAResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading response from %s", u)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error querying %s: status code %d: %s", u, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// parseOPAResult converts the document returned by the server into a
+// Decision.
+func parseOPAResult(result json.RawMessage) (*Decision, error) {
+	if len(result) == 0 || string(result) == "null" {
+		return nil, errors.New("decision is undefined")
+	}
+	var allow bool
+	if err := json.Unmarshal(result, &allow); err == nil {
+		if allow {
+			return &Decision{Action: ActionAllow}, nil
+		}
+		return &Decision{Action: ActionDeny}, nil
+	}
+	var d Decision
+	if err := json.Unmarshal(result, &d); err != nil {
+		return nil, err
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func logOPADecision(path, id string, req *Request, d *Decision) {
+	var provisioner, subject string
+	if req.Provisioner != nil {
+		provisioner = req.Provisioner.Name
+	}
+	switch {
+	case req.X509 != nil:
+		subject = req.X509.CommonName
+	case req.SSH != nil:
+		subject = req.SSH.KeyID
+	}
+	log.Printf("opa decision: path=%s decision_id=%s type=%s provisioner=%s subject=%s action=%s reason=%q",
+		path, id, req.Type, provisioner, subject, d.Action, d.Reason)
+}
@@ -0,0 +1,136 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/breaker"
+)
+
+func TestOPA_Evaluate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Input *Request `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Input == nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/data/step/allow":
+			fmt.Fprint(w, `{"decision_id":"1","result":true}`)
+		case "/v1/data/step/deny":
+			fmt.Fprint(w, `{"decision_id":"2","result":false}`)
+		case "/v1/data/step/decision":
+			fmt.Fprintf(w, `{"decision_id":"3","result":{"action":"deny","reason":"%s is not allowed"}}`, body.Input.X509.CommonName)
+		case "/v1/data/step/mutate":
+			fmt.Fprint(w, `{"result":{"action":"mutate","mutations":{"dnsNames":["foo.internal"]}}}`)
+		case "/v1/data/step/undefined":
+			fmt.Fprint(w, `{}`)
+		case "/v1/data/step/null":
+			fmt.Fprint(w, `{"result":null}`)
+		case "/v1/data/step/invalid":
+			fmt.Fprint(w, `{"result":{"action":"foo"}}`)
+		case "/v1/data/step/string":
+			fmt.Fprint(w, `{"result":"allow"}`)
+		case "/v1/data/step/sleep":
+			time.Sleep(time.Second)
+			fmt.Fprint(w, `{"result":true}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	newOPA := func(path string) *OPA {
+		return &OPA{
+			URL:          srv.URL + "/",
+			Path:         path,
+			Token:        "token",
+			Timeout:      100 * time.Millisecond,
+			DecisionLogs: true,
+		}
+	}
+	req := &Request{
+		Type:        X509Request,
+		Provisioner: &Provisioner{ID: "id", Name: "name", Type: "JWK"},
+		X509:        &X509Certificate{CommonName: "foo", DNSNames: []string{"foo"}},
+	}
+
+	tests := []struct {
+		name    string
+		opa     *OPA
+		want    *Decision
+		wantErr bool
+	}{
+		{"ok allow", newOPA("step/allow"), &Decision{Action: ActionAllow}, false},
+		{"ok deny", newOPA("/step/deny"), &Decision{Action: ActionDeny}, false},
+		{"ok decision", newOPA("step/decision"), &Decision{Action: ActionDeny, Reason: "foo is not allowed"}, false},
+		{"ok mutate", newOPA("step/mutate"), &Decision{Action: ActionMutate, Mutations: &Mutations{DNSNames: []string{"foo.internal"}}}, false},
+		{"fail undefined", newOPA("step/undefined"), nil, true},
+		{"fail null", newOPA("step/null"), nil, true},
+		{"fail invalid", newOPA("step/invalid"), nil, true},
+		{"fail string", newOPA("step/string"), nil, true},
+		{"fail timeout", newOPA("step/sleep"), nil, true},
+		{"fail not found", newOPA("step/missing"), nil, true},
+		{"fail unauthorized", &OPA{URL: srv.URL, Path: "step/allow"}, nil, true},
+		{"fail url", &OPA{URL: "http://127.0.0.1:0", Path: "step/allow"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opa.Evaluate(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OPA.Evaluate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OPA.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOPA_Evaluate_breaker(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b := breaker.New("opa", &breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Hour})
+	o := &OPA{URL: srv.URL, Path: "step/allow", Breaker: b}
+	req := &Request{Type: X509Request, X509: &X509Certificate{CommonName: "foo"}}
+
+	// The breaker opens after two failures, and the server is not queried
+	// while it is open.
+	for i := 0; i < 4; i++ {
+		_, err := o.Evaluate(context.Background(), req)
+		if err == nil {
+			t.Fatal("OPA.Evaluate() error = nil, want error")
+		}
+		if wantOpen := i >= 2; breaker.IsOpen(err) != wantOpen {
+			t.Errorf("OPA.Evaluate() error = %v, want open %v", err, wantOpen)
+		}
+	}
+	if hits != 2 {
+		t.Errorf("OPA server hits = %d, want 2", hits)
+	}
+
+	// A fail open hook allows the requests.
+	d, err := FailOpen(o).Evaluate(context.Background(), req)
+	if err != nil || d.Action != ActionAllow {
+		t.Errorf("FailOpen.Evaluate() = %v, %v, want allow", d, err)
+	}
+}
@@ -0,0 +1,103 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default limits of the WebAssembly hooks.
+const (
+	DefaultWASMTimeout       = 5 * time.Second
+	DefaultWASMMaxOutputSize = 64 * 1024
+)
+
+// WASM is a hook that executes a WebAssembly module as a WASI command. The
+// request is written in the standard input of the module and the decision is
+// read from the standard output. A module that exits with a non-zero status
+// or that exceeds the limits fails the evaluation.
+type WASM struct {
+	Module        string
+	Runtime       string
+	RuntimeArgs   []string
+	Timeout       time.Duration
+	MaxOutputSize int
+}
+
+// Evaluate runs the module with the given request.
+func (w *WASM) Evaluate(ctx context.Context, req *Request) (*Decision, error) {
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWASMTimeout
+	}
+	maxOutputSize := w.MaxOutputSize
+	if maxOutputSize <= 0 {
+		maxOutputSize = DefaultWASMMaxOutputSize
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling policy request")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := append(append([]string{}, w.RuntimeArgs...), w.Module)
+	stdout := &limitedBuffer{max: maxOutputSize}
+	stderr := &limitedBuffer{max: 4096, truncate: true}
+	cmd := exec.CommandContext(ctx, w.Runtime, args...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		switch {
+		case stdout.exceeded:
+			return nil, errors.Errorf("error running policy module %s: output exceeds %d bytes", w.Module, maxOutputSize)
+		case ctx.Err() == context.DeadlineExceeded:
+			return nil, errors.Errorf("error running policy module %s: timeout after %s", w.Module, timeout)
+		case stderr.Len() > 0:
+			return nil, errors.Wrapf(err, "error running policy module %s: %s", w.Module, strings.TrimSpace(stderr.String()))
+		default:
+			return nil, errors.Wrapf(err, "error running policy module %s", w.Module)
+		}
+	}
+	if stdout.exceeded {
+		return nil, errors.Errorf("error running policy module %s: output exceeds %d bytes", w.Module, maxOutputSize)
+	}
+
+	var d Decision
+	if err := json.Unmarshal(stdout.Bytes(), &d); err != nil {
+		return nil, errors.Wrapf(err, "error parsing decision of policy module %s", w.Module)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "error validating decision of policy module %s", w.Module)
+	}
+	return &d, nil
+}
+
+// limitedBuffer is a buffer that stores up to max bytes. Once the limit is
+// reached, writes fail, or are discarded if truncate is set.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	truncate bool
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		b.exceeded = true
+		if b.truncate {
+			b.Buffer.Write(p[:b.max-b.Len()])
+			return len(p), nil
+		}
+		return 0, errors.New("output limit exceeded")
+	}
+	return b.Buffer.Write(p)
+}
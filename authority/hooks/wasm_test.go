@@ -0,0 +1,92 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWASMHelperProcess is not a real test, it is used as the runtime of the
+// WASM tests. The last argument is the module, and it defines the behavior of
+// the process.
+func TestWASMHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_WASM_HELPER_PROCESS") != "1" {
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	switch os.Args[len(os.Args)-1] {
+	case "allow.wasm":
+		fmt.Print(`{"action":"allow"}`)
+	case "deny.wasm":
+		fmt.Printf(`{"action":"deny","reason":"%s is not allowed"}`, req.X509.CommonName)
+	case "mutate.wasm":
+		fmt.Print(`{"action":"mutate","mutations":{"dnsNames":["foo.internal"]}}`)
+	case "invalid.wasm":
+		fmt.Print(`{"action":"foo"}`)
+	case "large.wasm":
+		fmt.Print(strings.Repeat("a", 1024))
+	case "sleep.wasm":
+		time.Sleep(10 * time.Second)
+	default:
+		fmt.Fprintln(os.Stderr, "trap: unreachable")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestWASM_Evaluate(t *testing.T) {
+	os.Setenv("GO_WANT_WASM_HELPER_PROCESS", "1")
+	defer os.Unsetenv("GO_WANT_WASM_HELPER_PROCESS")
+
+	newWASM := func(module string) *WASM {
+		return &WASM{
+			Module:        module,
+			Runtime:       os.Args[0],
+			RuntimeArgs:   []string{"-test.run=TestWASMHelperProcess", "--"},
+			Timeout:       time.Second,
+			MaxOutputSize: 512,
+		}
+	}
+	req := &Request{
+		Type:        X509Request,
+		Provisioner: &Provisioner{ID: "id", Name: "name", Type: "JWK"},
+		X509:        &X509Certificate{CommonName: "foo", DNSNames: []string{"foo"}},
+	}
+
+	tests := []struct {
+		name    string
+		wasm    *WASM
+		want    *Decision
+		wantErr bool
+	}{
+		{"ok allow", newWASM("allow.wasm"), &Decision{Action: ActionAllow}, false},
+		{"ok deny", newWASM("deny.wasm"), &Decision{Action: ActionDeny, Reason: "foo is not allowed"}, false},
+		{"ok mutate", newWASM("mutate.wasm"), &Decision{Action: ActionMutate, Mutations: &Mutations{DNSNames: []string{"foo.internal"}}}, false},
+		{"fail invalid", newWASM("invalid.wasm"), nil, true},
+		{"fail output size", newWASM("large.wasm"), nil, true},
+		{"fail timeout", newWASM("sleep.wasm"), nil, true},
+		{"fail trap", newWASM("trap.wasm"), nil, true},
+		{"fail runtime", &WASM{Module: "allow.wasm", Runtime: "/does/not/exist"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.wasm.Evaluate(context.Background(), req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WASM.Evaluate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WASM.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	kmsapi "github.com/smallstep/certificates/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// maxRevocationResponseSize is the maximum size of the OCSP responses and
+	// CRLs downloaded to check the revocation status of the intermediate.
+	maxRevocationResponseSize = 10 << 20
+	// revocationCheckTimeout is the time allowed to check the revocation
+	// status of the intermediate.
+	revocationCheckTimeout = 30 * time.Second
+)
+
+// intermediateSigner returns the certificate chain of the intermediate and a
+// signer with its key, used by the background jobs that sign CRLs and OCSP
+// responses. With lazy keys, the key is loaded in the background and the
+// signer blocks until it is available.
+func (a *Authority) intermediateSigner(name string) ([]*x509.Certificate, crypto.Signer, error) {
+	chain, err := pemutil.ReadCertificateBundle(a.config.IntermediateCert)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reading intermediate certificate")
+	}
+	signer := newAsyncSigner(a.keyManager, name, &kmsapi.CreateSignerRequest{
+		SigningKey: a.config.IntermediateKey,
+		Password:   []byte(a.config.Password),
+	}, nil)
+	if a.config.Startup.IsLazyKeys() {
+		signer.logWhenReady()
+		return chain, signer, nil
+	}
+	if _, err := signer.get(); err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating %s", name)
+	}
+	return chain, signer, nil
+}
+
+// verifyIntermediate fails if the configured intermediate cannot issue
+// certificates trusted by the configured roots, and if enabled, if it has
+// been revoked.
+func (a *Authority) verifyIntermediate() error {
+	now := a.now()
+	chain, err := verifyIntermediateChain(a.intermediateX509Certs, a.rootX509CertPool, now)
+	if err != nil {
+		return err
+	}
+	if !a.config.Startup.IsCheckIntermediateRevocation() || len(chain) < 2 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), revocationCheckTimeout)
+	defer cancel()
+	client := &http.Client{Timeout: 10 * time.Second}
+	return checkIntermediateRevocation(ctx, client, chain[0], chain[1], now)
+}
+
+// verifyIntermediateChain checks that the first certificate of the bundle is
+// a currently valid CA with the certSign key usage that chains to the given
+// roots, using the rest of the bundle as intermediates. It returns the
+// verified chain, from the intermediate to the root.
+func verifyIntermediateChain(bundle []*x509.Certificate, roots *x509.CertPool, now time.Time) ([]*x509.Certificate, error) {
+	if len(bundle) == 0 {
+		return nil, errors.New("intermediate certificate is missing")
+	}
+
+	crt := bundle[0]
+	subject := crt.Subject.String()
+	if !crt.BasicConstraintsValid || !crt.IsCA {
+		return nil, errors.Errorf("intermediate certificate %q is not a CA: the basic constraints extension must have CA:TRUE", subject)
+	}
+	if crt.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.Errorf("intermediate certificate %q cannot sign certificates: the key usage extension must include certSign", subject)
+	}
+	if now.Before(crt.NotBefore) {
+		return nil, errors.Errorf("intermediate certificate %q is not valid until %s", subject, crt.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(crt.NotAfter) {
+		return nil, errors.Errorf("intermediate certificate %q expired on %s", subject, crt.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range bundle[1:] {
+		intermediates.AddCert(c)
+	}
+	chains, err := crt.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "intermediate certificate %q does not chain to the configured roots", subject)
+	}
+	return chains[0], nil
+}
+
+// checkIntermediateRevocation checks the revocation status of the given
+// certificate using its OCSP servers, and if none of them answers, its CRL
+// distribution points. Certificates without OCSP servers or CRL distribution
+// points are not checked, but it fails if none of them can be reached.
+func checkIntermediateRevocation(ctx context.Context, client *http.Client, crt, issuer *x509.Certificate, now time.Time) error {
+	if len(crt.OCSPServer) == 0 && len(crt.CRLDistributionPoints) == 0 {
+		return nil
+	}
+
+	subject := crt.Subject.String()
+	var lastErr error
+	for _, server := range crt.OCSPServer {
+		resp, err := queryOCSP(ctx, client, server, crt, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch resp.Status {
+		case ocsp.Good:
+			return nil
+		case ocsp.Revoked:
+			return errors.Errorf("intermediate certificate %q was revoked on %s according to %s",
+				subject, resp.RevokedAt.UTC().Format(time.RFC3339), server)
+		default:
+			lastErr = errors.Errorf("%s does not know the status of the certificate", server)
+		}
+	}
+
+	for _, dp := range crt.CRLDistributionPoints {
+		entry, err := findCRLEntry(ctx, client, dp, crt, issuer, now)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if entry != nil {
+			return errors.Errorf("intermediate certificate %q was revoked on %s according to %s",
+				subject, entry.RevocationTime.UTC().Format(time.RFC3339), dp)
+		}
+		return nil
+	}
+
+	return errors.Wrapf(lastErr, "error checking the revocation status of the intermediate certificate %q", subject)
+}
+
+// queryOCSP sends an OCSP request for the given certificate to the given
+// server.
+func queryOCSP(ctx context.Context, client *http.Client, server string, crt, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(crt, issuer, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating OCSP request")
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to %s", server)
+	}
+	r.Header.Set("Content-Type", "application/ocsp-request")
+	r.Header.Set("Accept", "application/ocsp-response")
+	b, err := fetchRevocationResponse(client, r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(b, crt, issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing OCSP response from %s", server)
+	}
+	return resp, nil
+}
+
+// findCRLEntry downloads the CRL in the given distribution point and returns
+// the entry of the given certificate, or nil if it is not revoked. The CRL
+// must be signed by the issuer and must not be expired.
+func findCRLEntry(ctx context.Context, client *http.Client, dp string, crt, issuer *x509.Certificate, now time.Time) (*pkix.RevokedCertificate, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, dp, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to %s", dp)
+	}
+	b, err := fetchRevocationResponse(client, r)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing CRL from %s", dp)
+	}
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		return nil, errors.Wrapf(err, "error verifying CRL from %s", dp)
+	}
+	if crl.HasExpired(now) {
+		return nil, errors.Errorf("CRL from %s expired on %s", dp, crl.TBSCertList.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	for i, rc := range crl.TBSCertList.RevokedCertificates {
+		if rc.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+			return &crl.TBSCertList.RevokedCertificates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// fetchRevocationResponse sends the given request and returns the body of a
+// successful response.
+func fetchRevocationResponse(client *http.Client, r *http.Request) ([]byte, error) {
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error requesting %s", r.URL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error requesting %s: status code %d", r.URL, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading response from %s", r.URL)
+	}
+	return b, nil
+}
@@ -0,0 +1,223 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"golang.org/x/crypto/ocsp"
+)
+
+func newIntermediateCheckCert(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	if tmpl.SerialNumber == nil {
+		tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt, key
+}
+
+func newIntermediateCheckCA(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+}
+
+func Test_verifyIntermediateChain(t *testing.T) {
+	now := time.Now()
+	root, rootKey := newIntermediateCheckCert(t, newIntermediateCheckCA("Root"), nil, nil)
+	other, _ := newIntermediateCheckCert(t, newIntermediateCheckCA("Other Root"), nil, nil)
+	issuing, issuingKey := newIntermediateCheckCert(t, newIntermediateCheckCA("Issuing"), root, rootKey)
+	intermediate, _ := newIntermediateCheckCert(t, newIntermediateCheckCA("Intermediate"), root, rootKey)
+	linked, _ := newIntermediateCheckCert(t, newIntermediateCheckCA("Linked"), issuing, issuingKey)
+
+	notCA := newIntermediateCheckCA("Not CA")
+	notCA.IsCA = false
+	notCA.BasicConstraintsValid = false
+	notCACert, _ := newIntermediateCheckCert(t, notCA, root, rootKey)
+
+	noCertSign := newIntermediateCheckCA("No CertSign")
+	noCertSign.KeyUsage = x509.KeyUsageDigitalSignature
+	noCertSignCert, _ := newIntermediateCheckCert(t, noCertSign, root, rootKey)
+
+	expired := newIntermediateCheckCA("Expired")
+	expired.NotBefore = now.Add(-2 * time.Hour)
+	expired.NotAfter = now.Add(-time.Hour)
+	expiredCert, _ := newIntermediateCheckCert(t, expired, root, rootKey)
+
+	notYetValid := newIntermediateCheckCA("Not Yet Valid")
+	notYetValid.NotBefore = now.Add(time.Hour)
+	notYetValid.NotAfter = now.Add(2 * time.Hour)
+	notYetValidCert, _ := newIntermediateCheckCert(t, notYetValid, root, rootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	tests := []struct {
+		name      string
+		bundle    []*x509.Certificate
+		want      []*x509.Certificate
+		wantError string
+	}{
+		{"ok", []*x509.Certificate{intermediate}, []*x509.Certificate{intermediate, root}, ""},
+		{"ok bundle", []*x509.Certificate{linked, issuing}, []*x509.Certificate{linked, issuing, root}, ""},
+		{"fail missing", nil, nil, "intermediate certificate is missing"},
+		{"fail not ca", []*x509.Certificate{notCACert}, nil, "is not a CA"},
+		{"fail no certSign", []*x509.Certificate{noCertSignCert}, nil, "must include certSign"},
+		{"fail expired", []*x509.Certificate{expiredCert}, nil, "expired on"},
+		{"fail not yet valid", []*x509.Certificate{notYetValidCert}, nil, "is not valid until"},
+		{"fail other root", []*x509.Certificate{other}, nil, "does not chain to the configured roots"},
+		{"fail missing link", []*x509.Certificate{linked}, nil, "does not chain to the configured roots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyIntermediateChain(tt.bundle, roots, now)
+			if tt.wantError != "" {
+				if assert.NotNil(t, err) {
+					assert.True(t, strings.Contains(err.Error(), tt.wantError), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_checkIntermediateRevocation(t *testing.T) {
+	now := time.Now()
+	root, rootKey := newIntermediateCheckCert(t, newIntermediateCheckCA("Root"), nil, nil)
+	_, otherKey := newIntermediateCheckCert(t, newIntermediateCheckCA("Other Root"), nil, nil)
+	revokedAt := now.Add(-time.Minute).Truncate(time.Second)
+
+	ocspHandler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			b, err := ioutil.ReadAll(r.Body)
+			assert.FatalError(t, err)
+			req, err := ocsp.ParseRequest(b)
+			assert.FatalError(t, err)
+			resp, err := ocsp.CreateResponse(root, root, ocsp.Response{
+				Status:       status,
+				SerialNumber: req.SerialNumber,
+				ThisUpdate:   now.Add(-time.Minute),
+				NextUpdate:   now.Add(time.Hour),
+				RevokedAt:    revokedAt,
+			}, rootKey)
+			assert.FatalError(t, err)
+			w.Write(resp)
+		}
+	}
+	crlHandler := func(key *ecdsa.PrivateKey, nextUpdate time.Time, serials ...*big.Int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var revoked []pkix.RevokedCertificate
+			for _, sn := range serials {
+				revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: sn, RevocationTime: revokedAt})
+			}
+			crl, err := root.CreateCRL(rand.Reader, key, revoked, now.Add(-2*time.Hour), nextUpdate)
+			assert.FatalError(t, err)
+			w.Write(crl)
+		}
+	}
+
+	serial := big.NewInt(1234)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ocsp/good", ocspHandler(ocsp.Good))
+	mux.HandleFunc("/ocsp/revoked", ocspHandler(ocsp.Revoked))
+	mux.HandleFunc("/ocsp/unknown", ocspHandler(ocsp.Unknown))
+	mux.HandleFunc("/crl/good", crlHandler(rootKey, now.Add(time.Hour), big.NewInt(1)))
+	mux.HandleFunc("/crl/revoked", crlHandler(rootKey, now.Add(time.Hour), big.NewInt(1), serial))
+	mux.HandleFunc("/crl/expired", crlHandler(rootKey, now.Add(-time.Hour)))
+	mux.HandleFunc("/crl/badsig", crlHandler(otherKey, now.Add(time.Hour)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newIntermediate := func(ocspServers, crlDPs []string) *x509.Certificate {
+		tmpl := newIntermediateCheckCA("Intermediate")
+		tmpl.SerialNumber = serial
+		for _, s := range ocspServers {
+			tmpl.OCSPServer = append(tmpl.OCSPServer, srv.URL+s)
+		}
+		for _, s := range crlDPs {
+			tmpl.CRLDistributionPoints = append(tmpl.CRLDistributionPoints, srv.URL+s)
+		}
+		crt, _ := newIntermediateCheckCert(t, tmpl, root, rootKey)
+		return crt
+	}
+
+	tests := []struct {
+		name      string
+		crt       *x509.Certificate
+		wantError string
+	}{
+		{"ok no endpoints", newIntermediate(nil, nil), ""},
+		{"ok ocsp", newIntermediate([]string{"/ocsp/good"}, []string{"/crl/revoked"}), ""},
+		{"ok ocsp fallback", newIntermediate([]string{"/missing", "/ocsp/good"}, nil), ""},
+		{"ok crl", newIntermediate(nil, []string{"/crl/good"}), ""},
+		{"ok crl fallback", newIntermediate([]string{"/ocsp/unknown"}, []string{"/crl/badsig", "/crl/good"}), ""},
+		{"fail ocsp revoked", newIntermediate([]string{"/ocsp/revoked"}, []string{"/crl/good"}), "was revoked on " + revokedAt.UTC().Format(time.RFC3339)},
+		{"fail crl revoked", newIntermediate([]string{"/missing"}, []string{"/crl/revoked"}), "was revoked on " + revokedAt.UTC().Format(time.RFC3339)},
+		{"fail crl expired", newIntermediate(nil, []string{"/crl/expired"}), "expired on"},
+		{"fail crl signature", newIntermediate(nil, []string{"/crl/badsig"}), "error verifying CRL"},
+		{"fail unreachable", newIntermediate([]string{"/missing"}, []string{"/missing"}), "status code 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIntermediateRevocation(context.Background(), srv.Client(), tt.crt, root, now)
+			if tt.wantError != "" {
+				if assert.NotNil(t, err) {
+					assert.True(t, strings.Contains(err.Error(), tt.wantError), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func TestAuthority_verifyIntermediate(t *testing.T) {
+	newConfig := func(root string) *Config {
+		return &Config{
+			Root:             []string{root},
+			IntermediateCert: "testdata/certs/intermediate_ca.crt",
+			IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+			Password:         "pass",
+			AuthorityConfig:  &AuthConfig{},
+			Startup:          &config.StartupConfig{VerifyIntermediate: true},
+		}
+	}
+
+	_, err := NewEmbedded(WithConfig(newConfig("testdata/certs/root_ca.crt")))
+	assert.FatalError(t, err)
+
+	_, err = NewEmbedded(WithConfig(newConfig("testdata/scep/root.crt")))
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "does not chain to the configured roots"), err.Error())
+	}
+}
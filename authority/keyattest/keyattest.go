@@ -0,0 +1,191 @@
+// Package keyattest verifies the attestation statements that prove that a
+// private key has been generated in, and cannot be exported from, a hardware
+// device. The supported formats are the YubiKey PIV attestation and the TPM
+// 2.0 key certification.
+package keyattest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Attestation formats.
+const (
+	// FormatYubiKey is the format of the YubiKey PIV attestations.
+	FormatYubiKey = "yubikey"
+	// FormatTPM is the format of the TPM 2.0 key certifications.
+	FormatTPM = "tpm"
+)
+
+// PIN and touch policies of the YubiKey PIV keys.
+const (
+	// PolicyNever is the policy of keys that never require the PIN or touch.
+	PolicyNever = "never"
+	// PolicyOnce is the policy of keys that require the PIN once per session.
+	PolicyOnce = "once"
+	// PolicyAlways is the policy of keys that require the PIN or touch for
+	// every operation.
+	PolicyAlways = "always"
+	// PolicyCached is the policy of keys that require touch, but the touch is
+	// cached for 15 seconds.
+	PolicyCached = "cached"
+)
+
+var (
+	// oidYubicoSerialNumber is the extension with the serial number of the
+	// YubiKey in the PIV attestation certificates.
+	oidYubicoSerialNumber = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 7}
+	// oidYubicoPolicy is the extension with the PIN and touch policies of the
+	// attested key, encoded as two bytes.
+	oidYubicoPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 8}
+)
+
+// yubicoPINPolicies and yubicoTouchPolicies map the values of the policy
+// extension to the policy names.
+var (
+	yubicoPINPolicies   = map[byte]string{1: PolicyNever, 2: PolicyOnce, 3: PolicyAlways}
+	yubicoTouchPolicies = map[byte]string{1: PolicyNever, 2: PolicyAlways, 3: PolicyCached}
+)
+
+// Statement is a key attestation statement. Its fields follow the WebAuthn
+// attestation statements:
+//
+//   - For the "yubikey" format, x5c contains the attestation certificate of
+//     the slot followed by the attestation certificate of the device and,
+//     optionally, its intermediates.
+//   - For the "tpm" format, x5c contains the certificate of the attestation
+//     key (AK) followed by its intermediates, certInfo is the TPMS_ATTEST
+//     structure returned by TPM2_Certify, sig is its TPMT_SIGNATURE and
+//     pubArea is the TPMT_PUBLIC area of the certified key.
+type Statement struct {
+	Format   string   `json:"fmt"`
+	X5C      [][]byte `json:"x5c"`
+	CertInfo []byte   `json:"certInfo,omitempty"`
+	Sig      []byte   `json:"sig,omitempty"`
+	PubArea  []byte   `json:"pubArea,omitempty"`
+}
+
+// VerifyOptions contains the options used to verify a statement.
+type VerifyOptions struct {
+	// VerifyChain verifies that the given attestation certificate chain, leaf
+	// first, is signed by a trusted root.
+	VerifyChain func(chain []*x509.Certificate) error
+}
+
+// Result contains the attributes of a verified statement.
+type Result struct {
+	// Format is the format of the statement.
+	Format string
+	// SerialNumber is the serial number of the device, if it's present in the
+	// statement.
+	SerialNumber string
+	// PINPolicy and TouchPolicy are the policies of the key, if they are
+	// present in the statement.
+	PINPolicy   string
+	TouchPolicy string
+	// Chain is the attestation certificate chain, leaf first.
+	Chain []*x509.Certificate
+}
+
+// Verify verifies that the statement attests the given public key.
+func Verify(stmt *Statement, pub crypto.PublicKey, opts VerifyOptions) (*Result, error) {
+	if stmt == nil {
+		return nil, errors.New("key attestation is required")
+	}
+	if opts.VerifyChain == nil {
+		return nil, errors.New("key attestation roots are not configured")
+	}
+	chain, err := parseChain(stmt.X5C)
+	if err != nil {
+		return nil, err
+	}
+	switch stmt.Format {
+	case FormatYubiKey:
+		return verifyYubiKey(chain, pub, opts)
+	case FormatTPM:
+		return verifyTPM(stmt, chain, pub, opts)
+	default:
+		return nil, errors.Errorf("unsupported key attestation format %q", stmt.Format)
+	}
+}
+
+func parseChain(x5c [][]byte) ([]*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, errors.New("key attestation certificates cannot be empty")
+	}
+	chain := make([]*x509.Certificate, len(x5c))
+	for i, der := range x5c {
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing x5c[%d]", i)
+		}
+		chain[i] = crt
+	}
+	return chain, nil
+}
+
+// verifyYubiKey verifies a YubiKey PIV attestation. The slot certificate is
+// signed by the device attestation certificate, but the latter is not a CA,
+// so the signature is checked before verifying the rest of the chain.
+func verifyYubiKey(chain []*x509.Certificate, pub crypto.PublicKey, opts VerifyOptions) (*Result, error) {
+	if len(chain) < 2 {
+		return nil, errors.New("yubikey attestation requires the slot and device certificates")
+	}
+	slot, device := chain[0], chain[1]
+	if err := device.CheckSignature(slot.SignatureAlgorithm, slot.RawTBSCertificate, slot.Signature); err != nil {
+		return nil, errors.Wrap(err, "error verifying yubikey slot certificate")
+	}
+	if err := opts.VerifyChain(chain[1:]); err != nil {
+		return nil, err
+	}
+	if err := equalPublicKeys(slot.PublicKey, pub); err != nil {
+		return nil, err
+	}
+
+	res := &Result{
+		Format: FormatYubiKey,
+		Chain:  chain,
+	}
+	for _, ext := range slot.Extensions {
+		switch {
+		case ext.Id.Equal(oidYubicoSerialNumber):
+			var n int64
+			if _, err := asn1.Unmarshal(ext.Value, &n); err != nil {
+				return nil, errors.Wrap(err, "error parsing yubikey serial number")
+			}
+			res.SerialNumber = strconv.FormatInt(n, 10)
+		case ext.Id.Equal(oidYubicoPolicy):
+			if len(ext.Value) != 2 {
+				return nil, errors.New("error parsing yubikey policy: invalid length")
+			}
+			res.PINPolicy = yubicoPINPolicies[ext.Value[0]]
+			res.TouchPolicy = yubicoTouchPolicies[ext.Value[1]]
+		}
+	}
+	if res.SerialNumber == "" {
+		return nil, errors.New("yubikey attestation does not contain a serial number")
+	}
+	return res, nil
+}
+
+// equalPublicKeys returns an error if the attested key is not the key in the
+// certificate request.
+func equalPublicKeys(attested, pub crypto.PublicKey) error {
+	a, err := x509.MarshalPKIXPublicKey(attested)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling attested public key")
+	}
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling public key")
+	}
+	if !bytes.Equal(a, b) {
+		return errors.New("attested public key does not match the certificate request key")
+	}
+	return nil
+}
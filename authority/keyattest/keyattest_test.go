@@ -0,0 +1,307 @@
+package keyattest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustCertificate(t *testing.T, tmpl, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Minute)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+type testRoot struct {
+	key  *ecdsa.PrivateKey
+	crt  *x509.Certificate
+	pool *x509.CertPool
+}
+
+func newTestRoot(t *testing.T) *testRoot {
+	t.Helper()
+	key := mustKey(t)
+	crt := mustCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Attestation Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, key.Public(), key)
+	pool := x509.NewCertPool()
+	pool.AddCert(crt)
+	return &testRoot{key: key, crt: crt, pool: pool}
+}
+
+func (r *testRoot) verifyChain(chain []*x509.Certificate) error {
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         r.pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+func newYubiKeyStatement(t *testing.T, root *testRoot, pub crypto.PublicKey, serial int, extensions ...pkix.Extension) *Statement {
+	t.Helper()
+	deviceKey := mustKey(t)
+	device := mustCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "Yubico PIV Attestation"},
+	}, root.crt, deviceKey.Public(), root.key)
+
+	if serial > 0 {
+		b, err := asn1.Marshal(serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidYubicoSerialNumber, Value: b})
+	}
+	slot := mustCertificate(t, &x509.Certificate{
+		Subject:         pkix.Name{CommonName: "YubiKey PIV Attestation 9c"},
+		ExtraExtensions: extensions,
+	}, device, pub, deviceKey)
+
+	return &Statement{
+		Format: FormatYubiKey,
+		X5C:    [][]byte{slot.Raw, device.Raw},
+	}
+}
+
+func putSized(b, v []byte) []byte {
+	b = append(b, byte(len(v)>>8), byte(len(v)))
+	return append(b, v...)
+}
+
+func putUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func putUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func padBytes(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func tpmECCPublic(key *ecdsa.PublicKey, attributes uint32) []byte {
+	var b []byte
+	b = putUint16(b, tpmAlgECC)
+	b = putUint16(b, tpmAlgSHA256)
+	b = putUint32(b, attributes)
+	b = putSized(b, nil)             // authPolicy
+	b = putUint16(b, tpmAlgNull)     // symmetric
+	b = putUint16(b, tpmAlgECDSA)    // scheme
+	b = putUint16(b, tpmAlgSHA256)   // scheme hash
+	b = putUint16(b, tpmECCNistP256) // curveID
+	b = putUint16(b, tpmAlgNull)     // kdf
+	b = putSized(b, padBytes(key.X, 32))
+	return putSized(b, padBytes(key.Y, 32))
+}
+
+func tpmCertInfo(pubArea []byte, magic uint32) []byte {
+	sum := sha256.Sum256(pubArea)
+	name := putUint16(nil, tpmAlgSHA256)
+	name = append(name, sum[:]...)
+
+	var b []byte
+	b = putUint32(b, magic)
+	b = putUint16(b, tpmSTAttestCertify)
+	b = putSized(b, []byte("signer"))
+	b = putSized(b, []byte("extra"))
+	b = append(b, make([]byte, 17+8)...) // clockInfo and firmwareVersion
+	b = putSized(b, name)
+	return putSized(b, name)
+}
+
+func tpmECDSASignature(t *testing.T, key *ecdsa.PrivateKey, message []byte) []byte {
+	t.Helper()
+	sum := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	b = putUint16(b, tpmAlgECDSA)
+	b = putUint16(b, tpmAlgSHA256)
+	b = putSized(b, r.Bytes())
+	return putSized(b, s.Bytes())
+}
+
+func newTPMStatement(t *testing.T, root *testRoot, pub *ecdsa.PublicKey, attributes uint32) *Statement {
+	t.Helper()
+	akKey := mustKey(t)
+	ak := mustCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "TPM AK"},
+	}, root.crt, akKey.Public(), root.key)
+
+	pubArea := tpmECCPublic(pub, attributes)
+	certInfo := tpmCertInfo(pubArea, tpmGeneratedValue)
+	return &Statement{
+		Format:   FormatTPM,
+		X5C:      [][]byte{ak.Raw},
+		CertInfo: certInfo,
+		Sig:      tpmECDSASignature(t, akKey, certInfo),
+		PubArea:  pubArea,
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := newTestRoot(t)
+	otherRoot := newTestRoot(t)
+	key := mustKey(t)
+	otherKey := mustKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := uint32(tpmaObjectFixedTPM | tpmaObjectSensitiveDataOrigin)
+
+	badMagic := newTPMStatement(t, root, &key.PublicKey, attributes)
+	badMagic.CertInfo = tpmCertInfo(badMagic.PubArea, 0xdeadbeef)
+	badName := newTPMStatement(t, root, &key.PublicKey, attributes)
+	badName.PubArea = tpmECCPublic(&otherKey.PublicKey, attributes)
+	badSig := newTPMStatement(t, root, &key.PublicKey, attributes)
+	badSig.Sig = tpmECDSASignature(t, otherKey, badSig.CertInfo)
+
+	verifyOpts := VerifyOptions{VerifyChain: root.verifyChain}
+	tests := []struct {
+		name    string
+		stmt    *Statement
+		pub     crypto.PublicKey
+		opts    VerifyOptions
+		wantSN  string
+		wantErr bool
+	}{
+		{"ok yubikey", newYubiKeyStatement(t, root, key.Public(), 12345678), key.Public(), verifyOpts, "12345678", false},
+		{"ok yubikey rsa", newYubiKeyStatement(t, root, rsaKey.Public(), 42), rsaKey.Public(), verifyOpts, "42", false},
+		{"ok tpm", newTPMStatement(t, root, &key.PublicKey, attributes), key.Public(), verifyOpts, "", false},
+		{"fail nil", nil, key.Public(), verifyOpts, "", true},
+		{"fail no roots", newYubiKeyStatement(t, root, key.Public(), 1), key.Public(), VerifyOptions{}, "", true},
+		{"fail format", &Statement{Format: "packed", X5C: newYubiKeyStatement(t, root, key.Public(), 1).X5C}, key.Public(), verifyOpts, "", true},
+		{"fail x5c", &Statement{Format: FormatYubiKey, X5C: [][]byte{[]byte("foo")}}, key.Public(), verifyOpts, "", true},
+		{"fail yubikey chain", newYubiKeyStatement(t, otherRoot, key.Public(), 1), key.Public(), verifyOpts, "", true},
+		{"fail yubikey key", newYubiKeyStatement(t, root, otherKey.Public(), 1), key.Public(), verifyOpts, "", true},
+		{"fail yubikey serial", newYubiKeyStatement(t, root, key.Public(), 0), key.Public(), verifyOpts, "", true},
+		{"fail yubikey device", &Statement{Format: FormatYubiKey, X5C: newYubiKeyStatement(t, root, key.Public(), 1).X5C[:1]}, key.Public(), verifyOpts, "", true},
+		{"fail tpm chain", newTPMStatement(t, otherRoot, &key.PublicKey, attributes), key.Public(), verifyOpts, "", true},
+		{"fail tpm key", newTPMStatement(t, root, &otherKey.PublicKey, attributes), key.Public(), verifyOpts, "", true},
+		{"fail tpm attributes", newTPMStatement(t, root, &key.PublicKey, tpmaObjectFixedTPM), key.Public(), verifyOpts, "", true},
+		{"fail tpm magic", badMagic, key.Public(), verifyOpts, "", true},
+		{"fail tpm name", badName, otherKey.Public(), verifyOpts, "", true},
+		{"fail tpm signature", badSig, key.Public(), verifyOpts, "", true},
+		{"fail tpm truncated", &Statement{Format: FormatTPM, X5C: badSig.X5C, CertInfo: badSig.CertInfo[:10], Sig: badSig.Sig, PubArea: badSig.PubArea}, key.Public(), verifyOpts, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.stmt, tt.pub, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Format != tt.stmt.Format {
+				t.Errorf("Verify() Format = %s, want %s", got.Format, tt.stmt.Format)
+			}
+			if got.SerialNumber != tt.wantSN {
+				t.Errorf("Verify() SerialNumber = %s, want %s", got.SerialNumber, tt.wantSN)
+			}
+			if len(got.Chain) != len(tt.stmt.X5C) {
+				t.Errorf("Verify() Chain = %d certificates, want %d", len(got.Chain), len(tt.stmt.X5C))
+			}
+		})
+	}
+}
+
+func TestVerify_chainError(t *testing.T) {
+	key := mustKey(t)
+	stmt := newYubiKeyStatement(t, newTestRoot(t), key.Public(), 1)
+	want := errors.New("chain error")
+	_, err := Verify(stmt, key.Public(), VerifyOptions{
+		VerifyChain: func([]*x509.Certificate) error { return want },
+	})
+	if err != want {
+		t.Errorf("Verify() error = %v, want %v", err, want)
+	}
+}
+
+func TestVerify_yubiKeyPolicy(t *testing.T) {
+	root := newTestRoot(t)
+	key := mustKey(t)
+	opts := VerifyOptions{VerifyChain: root.verifyChain}
+	policy := func(pin, touch byte) pkix.Extension {
+		return pkix.Extension{Id: oidYubicoPolicy, Value: []byte{pin, touch}}
+	}
+
+	tests := []struct {
+		name      string
+		stmt      *Statement
+		wantPIN   string
+		wantTouch string
+		wantErr   bool
+	}{
+		{"ok no policy", newYubiKeyStatement(t, root, key.Public(), 1), "", "", false},
+		{"ok never", newYubiKeyStatement(t, root, key.Public(), 1, policy(1, 1)), PolicyNever, PolicyNever, false},
+		{"ok once always", newYubiKeyStatement(t, root, key.Public(), 1, policy(2, 2)), PolicyOnce, PolicyAlways, false},
+		{"ok always cached", newYubiKeyStatement(t, root, key.Public(), 1, policy(3, 3)), PolicyAlways, PolicyCached, false},
+		{"ok unknown", newYubiKeyStatement(t, root, key.Public(), 1, policy(0, 9)), "", "", false},
+		{"fail length", newYubiKeyStatement(t, root, key.Public(), 1, pkix.Extension{Id: oidYubicoPolicy, Value: []byte{1}}), "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.stmt, key.Public(), opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.PINPolicy != tt.wantPIN {
+				t.Errorf("Verify() PINPolicy = %s, want %s", got.PINPolicy, tt.wantPIN)
+			}
+			if got.TouchPolicy != tt.wantTouch {
+				t.Errorf("Verify() TouchPolicy = %s, want %s", got.TouchPolicy, tt.wantTouch)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package keyattest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// TPM 2.0 constants used in the key certifications, see TPM 2.0 Library,
+// Part 2: Structures.
+const (
+	tpmGeneratedValue  = 0xff544347
+	tpmSTAttestCertify = 0x8017
+
+	tpmAlgRSA    = 0x0001
+	tpmAlgSHA1   = 0x0004
+	tpmAlgSHA256 = 0x000b
+	tpmAlgSHA384 = 0x000c
+	tpmAlgSHA512 = 0x000d
+	tpmAlgNull   = 0x0010
+	tpmAlgRSASSA = 0x0014
+	tpmAlgRSAPSS = 0x0016
+	tpmAlgECDSA  = 0x0018
+	tpmAlgECC    = 0x0023
+
+	tpmECCNistP256 = 0x0003
+	tpmECCNistP384 = 0x0004
+	tpmECCNistP521 = 0x0005
+
+	tpmaObjectFixedTPM            = 0x00000002
+	tpmaObjectSensitiveDataOrigin = 0x00000020
+)
+
+// verifyTPM verifies a TPM 2.0 key certification. The certInfo structure must
+// be signed by the attestation key, and it must certify the name of the key
+// described in pubArea. The key must be generated in and bound to the TPM.
+func verifyTPM(stmt *Statement, chain []*x509.Certificate, pub crypto.PublicKey, opts VerifyOptions) (*Result, error) {
+	if err := opts.VerifyChain(chain); err != nil {
+		return nil, err
+	}
+	if err := verifyTPMSignature(chain[0].PublicKey, stmt.CertInfo, stmt.Sig); err != nil {
+		return nil, err
+	}
+	name, err := parseTPMCertifiedName(stmt.CertInfo)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseTPMPublic(stmt.PubArea, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := equalPublicKeys(key, pub); err != nil {
+		return nil, err
+	}
+	return &Result{
+		Format: FormatTPM,
+		Chain:  chain,
+	}, nil
+}
+
+// tpmReader reads the big-endian TPM structures.
+type tpmReader struct {
+	b   []byte
+	err error
+}
+
+func (r *tpmReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = errors.New("unexpected end of tpm structure")
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *tpmReader) uint16() uint16 {
+	if b := r.read(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *tpmReader) uint32() uint32 {
+	if b := r.read(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// sized reads a TPM2B structure.
+func (r *tpmReader) sized() []byte {
+	return r.read(int(r.uint16()))
+}
+
+func tpmHash(alg uint16) (crypto.Hash, error) {
+	switch alg {
+	case tpmAlgSHA1:
+		return crypto.SHA1, nil
+	case tpmAlgSHA256:
+		return crypto.SHA256, nil
+	case tpmAlgSHA384:
+		return crypto.SHA384, nil
+	case tpmAlgSHA512:
+		return crypto.SHA512, nil
+	default:
+		return 0, errors.Errorf("unsupported tpm hash algorithm 0x%04x", alg)
+	}
+}
+
+// verifyTPMSignature verifies the TPMT_SIGNATURE sig of the message using the
+// key of the attestation key certificate.
+func verifyTPMSignature(key crypto.PublicKey, message, sig []byte) error {
+	r := &tpmReader{b: sig}
+	sigAlg := r.uint16()
+	h, err := tpmHash(r.uint16())
+	if err != nil {
+		return err
+	}
+	if !h.Available() {
+		return errors.Errorf("tpm hash algorithm %s is not available", h)
+	}
+	hh := h.New()
+	hh.Write(message)
+	digest := hh.Sum(nil)
+
+	switch sigAlg {
+	case tpmAlgRSASSA, tpmAlgRSAPSS:
+		s := r.sized()
+		if r.err != nil {
+			return errors.Wrap(r.err, "error parsing tpm signature")
+		}
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("tpm signature algorithm does not match the attestation key")
+		}
+		if sigAlg == tpmAlgRSASSA {
+			err = rsa.VerifyPKCS1v15(pub, h, digest, s)
+		} else {
+			err = rsa.VerifyPSS(pub, h, digest, s, nil)
+		}
+		return errors.Wrap(err, "error verifying tpm signature")
+	case tpmAlgECDSA:
+		sr, ss := r.sized(), r.sized()
+		if r.err != nil {
+			return errors.Wrap(r.err, "error parsing tpm signature")
+		}
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("tpm signature algorithm does not match the attestation key")
+		}
+		if !ecdsa.Verify(pub, digest, new(big.Int).SetBytes(sr), new(big.Int).SetBytes(ss)) {
+			return errors.New("error verifying tpm signature")
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported tpm signature algorithm 0x%04x", sigAlg)
+	}
+}
+
+// parseTPMCertifiedName parses a TPMS_ATTEST structure generated by
+// TPM2_Certify and returns the name of the certified object.
+func parseTPMCertifiedName(certInfo []byte) ([]byte, error) {
+	r := &tpmReader{b: certInfo}
+	magic := r.uint32()
+	typ := r.uint16()
+	r.sized()  // qualifiedSigner
+	r.sized()  // extraData
+	r.read(17) // clockInfo
+	r.read(8)  // firmwareVersion
+	name := r.sized()
+	r.sized() // qualifiedName
+	switch {
+	case r.err != nil:
+		return nil, errors.Wrap(r.err, "error parsing tpm certInfo")
+	case magic != tpmGeneratedValue:
+		return nil, errors.New("tpm certInfo was not generated by a tpm")
+	case typ != tpmSTAttestCertify:
+		return nil, errors.Errorf("unsupported tpm certInfo type 0x%04x", typ)
+	default:
+		return name, nil
+	}
+}
+
+// parseTPMPublic parses a TPMT_PUBLIC area, verifies that its name is the
+// certified name, and returns the public key.
+func parseTPMPublic(pubArea, name []byte) (crypto.PublicKey, error) {
+	r := &tpmReader{b: pubArea}
+	typ := r.uint16()
+	nameAlg := r.uint16()
+	attributes := r.uint32()
+	r.sized() // authPolicy
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "error parsing tpm pubArea")
+	}
+
+	h, err := tpmHash(nameAlg)
+	if err != nil {
+		return nil, err
+	}
+	if !h.Available() {
+		return nil, errors.Errorf("tpm hash algorithm %s is not available", h)
+	}
+	hh := h.New()
+	hh.Write(pubArea)
+	expected := make([]byte, 2, 2+h.Size())
+	binary.BigEndian.PutUint16(expected, nameAlg)
+	expected = append(expected, hh.Sum(nil)...)
+	if !bytes.Equal(name, expected) {
+		return nil, errors.New("tpm pubArea does not match the certified name")
+	}
+	if attributes&tpmaObjectFixedTPM == 0 || attributes&tpmaObjectSensitiveDataOrigin == 0 {
+		return nil, errors.New("tpm key was not generated in the tpm or it can be duplicated")
+	}
+
+	// Skip the symmetric algorithm and scheme parameters.
+	skipScheme := func() {
+		if r.uint16() != tpmAlgNull {
+			r.uint16()
+		}
+	}
+	if r.uint16() != tpmAlgNull {
+		r.read(4) // keyBits and mode
+	}
+	skipScheme()
+
+	switch typ {
+	case tpmAlgRSA:
+		r.uint16() // keyBits
+		exponent := int(r.uint32())
+		modulus := r.sized()
+		if r.err != nil {
+			return nil, errors.Wrap(r.err, "error parsing tpm pubArea")
+		}
+		if exponent == 0 {
+			exponent = 65537
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: exponent,
+		}, nil
+	case tpmAlgECC:
+		curveID := r.uint16()
+		skipScheme() // kdf
+		x, y := r.sized(), r.sized()
+		if r.err != nil {
+			return nil, errors.Wrap(r.err, "error parsing tpm pubArea")
+		}
+		var curve elliptic.Curve
+		switch curveID {
+		case tpmECCNistP256:
+			curve = elliptic.P256()
+		case tpmECCNistP384:
+			curve = elliptic.P384()
+		case tpmECCNistP521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported tpm curve 0x%04x", curveID)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, errors.Errorf("unsupported tpm key type 0x%04x", typ)
+	}
+}
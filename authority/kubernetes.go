@@ -0,0 +1,234 @@
+package authority
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Files of the service account mounted in the pods.
+const (
+	kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubernetesCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// kubernetesMicroTime is the format of the times in the Lease objects.
+const kubernetesMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// kubernetesLeaseStore stores the leases of the background jobs in Kubernetes
+// Lease objects, using the service account of the pod. The updates use the
+// resource version of the objects, so only one replica can take a lease.
+type kubernetesLeaseStore struct {
+	client    *http.Client
+	baseURL   string
+	tokenFile string
+	namespace string
+}
+
+// kubernetesLease is a coordination.k8s.io/v1 Lease.
+type kubernetesLease struct {
+	APIVersion string                  `json:"apiVersion"`
+	Kind       string                  `json:"kind"`
+	Metadata   kubernetesLeaseMetadata `json:"metadata"`
+	Spec       kubernetesLeaseSpec     `json:"spec"`
+}
+
+type kubernetesLeaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type kubernetesLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int32  `json:"leaseTransitions,omitempty"`
+}
+
+// expiresAt returns the time the lease expires.
+func (s *kubernetesLeaseSpec) expiresAt() time.Time {
+	renewTime, err := time.Parse(time.RFC3339Nano, s.RenewTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return renewTime.Add(time.Duration(s.LeaseDurationSeconds) * time.Second)
+}
+
+// newKubernetesLeaseStore creates the store of the leases in the given
+// namespace using the in-cluster configuration.
+func newKubernetesLeaseStore(namespace string) (*kubernetesLeaseStore, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("error creating the kubernetes client: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(kubernetesCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the kubernetes CA")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("error parsing %s: no certificates found", kubernetesCAFile)
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	return &kubernetesLeaseStore{
+		client:    &http.Client{Transport: tr, Timeout: 10 * time.Second},
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		tokenFile: kubernetesTokenFile,
+		namespace: namespace,
+	}, nil
+}
+
+// AcquireLease implements the leaseStore interface.
+func (s *kubernetesLeaseStore) AcquireLease(name, holder string, now time.Time, d time.Duration) (bool, error) {
+	renewTime := now.UTC().Format(kubernetesMicroTime)
+	seconds := int32(math.Ceil(d.Seconds()))
+
+	lease, err := s.get(name)
+	if err != nil {
+		return false, err
+	}
+	if lease == nil {
+		return s.write(http.MethodPost, &kubernetesLease{
+			Metadata: kubernetesLeaseMetadata{
+				Name:      name,
+				Namespace: s.namespace,
+			},
+			Spec: kubernetesLeaseSpec{
+				HolderIdentity:       holder,
+				LeaseDurationSeconds: seconds,
+				AcquireTime:          renewTime,
+				RenewTime:            renewTime,
+			},
+		})
+	}
+
+	spec := &lease.Spec
+	if spec.HolderIdentity != holder {
+		if spec.HolderIdentity != "" && now.Before(spec.expiresAt()) {
+			return false, nil
+		}
+		spec.HolderIdentity = holder
+		spec.AcquireTime = renewTime
+		spec.LeaseTransitions++
+	}
+	spec.LeaseDurationSeconds = seconds
+	spec.RenewTime = renewTime
+	return s.write(http.MethodPut, lease)
+}
+
+// ReleaseLease implements the leaseStore interface.
+func (s *kubernetesLeaseStore) ReleaseLease(name, holder string) error {
+	lease, err := s.get(name)
+	if err != nil || lease == nil || lease.Spec.HolderIdentity != holder {
+		return err
+	}
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	_, err = s.write(http.MethodPut, lease)
+	return err
+}
+
+func (s *kubernetesLeaseStore) url(name string) string {
+	u := s.baseURL + "/apis/coordination.k8s.io/v1/namespaces/" + s.namespace + "/leases"
+	if name != "" {
+		u += "/" + name
+	}
+	return u
+}
+
+// get returns the lease with the given name, or nil if it does not exist.
+func (s *kubernetesLeaseStore) get(name string) (*kubernetesLease, error) {
+	resp, err := s.do(http.MethodGet, s.url(name), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting lease %s", name)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var lease kubernetesLease
+		if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+			return nil, errors.Wrapf(err, "error decoding lease %s", name)
+		}
+		return &lease, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, kubernetesError(resp, "error getting lease %s", name)
+	}
+}
+
+// write creates or updates the lease. It returns false if another replica
+// changed the lease first.
+func (s *kubernetesLeaseStore) write(method string, lease *kubernetesLease) (bool, error) {
+	lease.APIVersion = "coordination.k8s.io/v1"
+	lease.Kind = "Lease"
+	b, err := json.Marshal(lease)
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling lease %s", lease.Metadata.Name)
+	}
+
+	u := s.url("")
+	if method == http.MethodPut {
+		u = s.url(lease.Metadata.Name)
+	}
+	resp, err := s.do(method, u, b)
+	if err != nil {
+		return false, errors.Wrapf(err, "error writing lease %s", lease.Metadata.Name)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		return false, kubernetesError(resp, "error writing lease %s", lease.Metadata.Name)
+	}
+}
+
+func (s *kubernetesLeaseStore) do(method, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// The token is read on every request because it is rotated.
+	token, err := ioutil.ReadFile(s.tokenFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the service account token")
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.client.Do(req)
+}
+
+// kubernetesError returns an error with the status and the message of a
+// failed Kubernetes API response.
+func kubernetesError(resp *http.Response, format string, args ...interface{}) error {
+	var status struct {
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&status)
+	if status.Message == "" {
+		status.Message = http.StatusText(resp.StatusCode)
+	}
+	return errors.Wrapf(errors.Errorf("%s (%d)", status.Message, resp.StatusCode), format, args...)
+}
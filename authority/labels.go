@@ -0,0 +1,211 @@
+package authority
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+var labelsTable = []byte("x509_certs_labels")
+
+// CertificateLabels contains the labels attached to a certificate when it was
+// issued, and the attributes used to identify the certificate in the admin
+// API.
+type CertificateLabels struct {
+	SerialNumber string            `json:"serialNumber"`
+	CommonName   string            `json:"commonName,omitempty"`
+	Provisioner  string            `json:"provisioner,omitempty"`
+	NotBefore    time.Time         `json:"notBefore"`
+	NotAfter     time.Time         `json:"notAfter"`
+	Labels       map[string]string `json:"labels"`
+}
+
+// Matches returns true if the certificate has all the given labels. A label
+// with an empty value in the selector matches any value.
+func (c *CertificateLabels) Matches(selector map[string]string) bool {
+	for k, v := range selector {
+		value, ok := c.Labels[k]
+		if !ok || (v != "" && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelsStore keeps the labels of the certificates in the database.
+type labelsStore struct {
+	db nosql.DB
+}
+
+func newLabelsStore(db nosql.DB) (*labelsStore, error) {
+	if err := db.CreateTable(labelsTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(labelsTable))
+	}
+	return &labelsStore{db: db}, nil
+}
+
+func (s *labelsStore) get(serialNumber string) (*CertificateLabels, error) {
+	b, err := s.db.Get(labelsTable, []byte(serialNumber))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading labels of certificate %s", serialNumber)
+	}
+	c := new(CertificateLabels)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling labels of certificate %s", serialNumber)
+	}
+	return c, nil
+}
+
+func (s *labelsStore) list() ([]*CertificateLabels, error) {
+	entries, err := s.db.List(labelsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading certificate labels")
+	}
+	var certs []*CertificateLabels
+	for _, e := range entries {
+		c := new(CertificateLabels)
+		if err := json.Unmarshal(e.Value, c); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling labels of certificate %s", string(e.Key))
+		}
+		certs = append(certs, c)
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].NotBefore.Before(certs[j].NotBefore)
+	})
+	return certs, nil
+}
+
+func (s *labelsStore) set(c *CertificateLabels) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling labels of certificate %s", c.SerialNumber)
+	}
+	return errors.Wrapf(s.db.Set(labelsTable, []byte(c.SerialNumber), b), "error storing labels of certificate %s", c.SerialNumber)
+}
+
+// initLabels initializes the store used to keep the certificate labels.
+func (a *Authority) initLabels() error {
+	if a.config.AuthorityConfig.Labels == nil {
+		return nil
+	}
+	store, err := newLabelsStore(a.getStateDB())
+	if err != nil {
+		return err
+	}
+	a.labels = store
+	return nil
+}
+
+// checkLabels validates the labels of a sign request.
+func (a *Authority) checkLabels(labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	if a.labels == nil {
+		return errs.BadRequestErr(errors.New("certificate labels are not enabled"),
+			errs.WithMessage("Certificate labels are not enabled."))
+	}
+	if err := a.config.AuthorityConfig.Labels.ValidateLabels(labels); err != nil {
+		return errs.BadRequestErr(err, errs.WithMessage("%s.", err.Error()))
+	}
+	return nil
+}
+
+// ValidateCertificateLabels validates the labels that will be attached to the
+// certificates, e.g. the labels of an ACME account. It implements the
+// acme.LabelsValidator interface.
+func (a *Authority) ValidateCertificateLabels(labels map[string]string) error {
+	return a.checkLabels(labels)
+}
+
+// addLabelsExtension adds the labels extension to the certificate template if
+// it is enabled.
+func (a *Authority) addLabelsExtension(crt *x509.Certificate, labels map[string]string) error {
+	if len(labels) == 0 || a.labels == nil || !a.config.AuthorityConfig.Labels.Extension {
+		return nil
+	}
+	ext, err := provisioner.CreateLabelsExtension(labels)
+	if err != nil {
+		return err
+	}
+	crt.ExtraExtensions = append(crt.ExtraExtensions, ext)
+	return nil
+}
+
+// recordLabels stores the labels of the given certificate.
+func (a *Authority) recordLabels(crt *x509.Certificate, labels map[string]string) error {
+	if len(labels) == 0 || a.labels == nil {
+		return nil
+	}
+	name, _ := provisioner.GetProvisionerName(crt.Extensions)
+	return a.labels.set(&CertificateLabels{
+		SerialNumber: crt.SerialNumber.String(),
+		CommonName:   crt.Subject.CommonName,
+		Provisioner:  name,
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		Labels:       labels,
+	})
+}
+
+// recordRenewedLabels copies the labels of a certificate to its renewal.
+func (a *Authority) recordRenewedLabels(oldCert, newCert *x509.Certificate) error {
+	if a.labels == nil {
+		return nil
+	}
+	c, err := a.labels.get(oldCert.SerialNumber.String())
+	if err != nil || c == nil {
+		return err
+	}
+	return a.recordLabels(newCert, c.Labels)
+}
+
+// GetCertificateLabels returns the labels of the certificate with the given
+// serial number.
+func (a *Authority) GetCertificateLabels(serialNumber string) (*CertificateLabels, error) {
+	if a.labels == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "certificate labels are not enabled")
+	}
+	c, err := a.labels.get(serialNumber)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading certificate labels")
+	}
+	if c == nil {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "certificate %s does not have labels", serialNumber)
+	}
+	return c, nil
+}
+
+// ListCertificateLabels returns the labeled certificates matching the given
+// selector, sorted by issuance time. Expired certificates are only returned
+// if includeExpired is true.
+func (a *Authority) ListCertificateLabels(selector map[string]string, includeExpired bool) ([]*CertificateLabels, error) {
+	if a.labels == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "certificate labels are not enabled")
+	}
+	certs, err := a.labels.list()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading certificate labels")
+	}
+	now := a.now()
+	res := []*CertificateLabels{}
+	for _, c := range certs {
+		if !includeExpired && now.After(c.NotAfter) {
+			continue
+		}
+		if c.Matches(selector) {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
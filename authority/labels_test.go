@@ -0,0 +1,103 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_labels(t *testing.T) {
+	a := testAuthority(t)
+	labels := map[string]string{"team": "platform", "env": "prod"}
+
+	// Labels are not enabled
+	err := a.checkLabels(labels)
+	if assert.NotNil(t, err) {
+		sc, ok := err.(errs.StatusCoder)
+		assert.Fatal(t, ok)
+		assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+	}
+	assert.FatalError(t, a.checkLabels(nil))
+	_, err = a.ListCertificateLabels(nil, false)
+	assert.NotNil(t, err)
+
+	a.config.AuthorityConfig.Labels = &config.LabelsConfig{
+		Keys:      []string{"team", "env"},
+		Extension: true,
+	}
+	assert.FatalError(t, a.initLabels())
+
+	assert.FatalError(t, a.checkLabels(labels))
+	assert.NotNil(t, a.checkLabels(map[string]string{"owner": "alice"}))
+
+	// Extension
+	template := &x509.Certificate{}
+	assert.FatalError(t, a.addLabelsExtension(template, labels))
+	got, ok := provisioner.GetLabels(template.ExtraExtensions)
+	assert.True(t, ok)
+	assert.Equals(t, labels, got)
+
+	// Records
+	newCert := func(serial int64, cn string, notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    notAfter.Add(-2 * time.Hour),
+			NotAfter:     notAfter,
+		}
+	}
+	now := time.Now()
+	assert.FatalError(t, a.recordLabels(newCert(1, "expired", now.Add(-time.Hour)), labels))
+	assert.FatalError(t, a.recordLabels(newCert(2, "prod", now.Add(time.Hour)), labels))
+	assert.FatalError(t, a.recordLabels(newCert(3, "dev", now.Add(2*time.Hour)), map[string]string{"team": "platform", "env": "dev"}))
+	assert.FatalError(t, a.recordLabels(newCert(4, "none", now.Add(time.Hour)), nil))
+
+	// Renewals keep the labels
+	assert.FatalError(t, a.recordRenewedLabels(newCert(2, "prod", now.Add(time.Hour)), newCert(5, "prod", now.Add(3*time.Hour))))
+	assert.FatalError(t, a.recordRenewedLabels(newCert(4, "none", now.Add(time.Hour)), newCert(6, "none", now.Add(3*time.Hour))))
+
+	c, err := a.GetCertificateLabels("5")
+	assert.FatalError(t, err)
+	assert.Equals(t, labels, c.Labels)
+	assert.Equals(t, "prod", c.CommonName)
+	_, err = a.GetCertificateLabels("4")
+	assert.NotNil(t, err)
+	_, err = a.GetCertificateLabels("6")
+	assert.NotNil(t, err)
+
+	serials := func(certs []*CertificateLabels) []string {
+		var s []string
+		for _, c := range certs {
+			s = append(s, c.SerialNumber)
+		}
+		return s
+	}
+
+	certs, err := a.ListCertificateLabels(nil, false)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2", "3", "5"}, serials(certs))
+
+	certs, err = a.ListCertificateLabels(map[string]string{"env": "prod"}, false)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2", "5"}, serials(certs))
+
+	certs, err = a.ListCertificateLabels(map[string]string{"env": "prod"}, true)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1", "2", "5"}, serials(certs))
+
+	certs, err = a.ListCertificateLabels(map[string]string{"team": ""}, false)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2", "3", "5"}, serials(certs))
+
+	certs, err = a.ListCertificateLabels(map[string]string{"owner": ""}, false)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs)
+}
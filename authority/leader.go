@@ -0,0 +1,175 @@
+package authority
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+// leaseStore is implemented by the stores of the leases used to elect the
+// replica that runs each background job.
+type leaseStore interface {
+	AcquireLease(name, holder string, now time.Time, d time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+}
+
+// leaderElector creates the leases of the background jobs.
+type leaderElector struct {
+	store       leaseStore
+	identity    string
+	prefix      string
+	duration    time.Duration
+	renewPeriod time.Duration
+}
+
+// initLeaderElection initializes the leader election if it is configured.
+// Without it every replica runs all the background jobs.
+func (a *Authority) initLeaderElection() error {
+	c := a.config.LeaderElection
+	if c == nil {
+		return nil
+	}
+
+	identity, err := c.GetIdentity()
+	if err != nil {
+		return err
+	}
+
+	var store leaseStore
+	switch c.GetType() {
+	case config.LeaderElectionKubernetes:
+		namespace, err := c.GetNamespace()
+		if err != nil {
+			return err
+		}
+		if store, err = newKubernetesLeaseStore(namespace); err != nil {
+			return err
+		}
+	default:
+		s, ok := a.db.(leaseStore)
+		if !ok {
+			return errors.New("leader election requires a database that supports leases")
+		}
+		store = s
+	}
+
+	a.leaderElector = &leaderElector{
+		store:       store,
+		identity:    identity,
+		prefix:      c.GetLeasePrefix(),
+		duration:    c.GetLeaseDuration(),
+		renewPeriod: c.GetRenewPeriod(),
+	}
+	return nil
+}
+
+// newLease starts the election of the replica that runs the given job, and
+// returns its lease. A nil elector returns a nil lease, which is always held.
+func (e *leaderElector) newLease(job string) *leaderLease {
+	if e == nil {
+		return nil
+	}
+	l := &leaderLease{
+		name:    e.prefix + job,
+		elector: e,
+		elected: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	// The first attempt is done right away, so a single replica runs the job
+	// when it starts.
+	l.renew()
+	go l.run()
+	return l
+}
+
+// leaderLease is the lease of a background job. Only the replica holding it
+// runs the job.
+type leaderLease struct {
+	name       string
+	elector    *leaderElector
+	validUntil int64
+	elected    chan struct{}
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+// IsLeader returns true if the replica holds the lease. The lease is lost if
+// it cannot be renewed before it expires.
+func (l *leaderLease) IsLeader() bool {
+	if l == nil {
+		return true
+	}
+	return time.Now().UnixNano() < atomic.LoadInt64(&l.validUntil)
+}
+
+// Elected returns a channel that receives a value when the replica acquires
+// the lease. The job should run right away, as the previous holder might have
+// stopped before running it.
+func (l *leaderLease) Elected() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.elected
+}
+
+// Stop stops renewing the lease and releases it, so another replica can take
+// it without waiting for it to expire.
+func (l *leaderLease) Stop() {
+	if l == nil {
+		return
+	}
+	close(l.done)
+	<-l.stopped
+	if l.IsLeader() {
+		atomic.StoreInt64(&l.validUntil, 0)
+		if err := l.elector.store.ReleaseLease(l.name, l.elector.identity); err != nil {
+			log.Printf("error releasing lease %s: %v", l.name, err)
+		}
+	}
+}
+
+func (l *leaderLease) run() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.elector.renewPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+// renew acquires or renews the lease. If the store fails, the replica keeps
+// the lease until it expires.
+func (l *leaderLease) renew() {
+	e := l.elector
+	start := time.Now()
+	ok, err := e.store.AcquireLease(l.name, e.identity, start, e.duration)
+	if err != nil {
+		log.Printf("error renewing lease %s: %v", l.name, err)
+		return
+	}
+	if !ok {
+		if atomic.SwapInt64(&l.validUntil, 0) > start.UnixNano() {
+			log.Printf("Lost lease %s", l.name)
+		}
+		return
+	}
+
+	wasLeader := l.IsLeader()
+	atomic.StoreInt64(&l.validUntil, start.Add(e.duration).UnixNano())
+	if !wasLeader {
+		log.Printf("Acquired lease %s as %s", l.name, e.identity)
+		select {
+		case l.elected <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package authority
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLeaseStore is a leaseStore that keeps the leases in memory.
+type memoryLeaseStore struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+	err    error
+}
+
+type memoryLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+func (s *memoryLeaseStore) AcquireLease(name, holder string, now time.Time, d time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	if l, ok := s.leases[name]; ok && l.holder != holder && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	s.leases[name] = memoryLease{holder: holder, expiresAt: now.Add(d)}
+	return true, nil
+}
+
+func (s *memoryLeaseStore) ReleaseLease(name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[name]; ok && l.holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+func (s *memoryLeaseStore) setError(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func TestLeaderLease(t *testing.T) {
+	// A nil elector always runs the jobs.
+	var nilElector *leaderElector
+	nilLease := nilElector.newLease("radius")
+	if !nilLease.IsLeader() {
+		t.Error("leaderLease.IsLeader() = false, want true")
+	}
+	if nilLease.Elected() != nil {
+		t.Error("leaderLease.Elected() is not nil")
+	}
+	nilLease.Stop()
+
+	store := &memoryLeaseStore{leases: make(map[string]memoryLease)}
+	newElector := func(identity string) *leaderElector {
+		return &leaderElector{
+			store:       store,
+			identity:    identity,
+			prefix:      "step-ca-",
+			duration:    100 * time.Millisecond,
+			renewPeriod: 10 * time.Millisecond,
+		}
+	}
+
+	l0 := newElector("ca-0").newLease("radius")
+	l1 := newElector("ca-1").newLease("radius")
+	defer l1.Stop()
+	if !l0.IsLeader() {
+		t.Error("leaderLease.IsLeader() = false, want true")
+	}
+	if l1.IsLeader() {
+		t.Error("leaderLease.IsLeader() = true, want false")
+	}
+	select {
+	case <-l0.Elected():
+	default:
+		t.Error("leaderLease.Elected() did not receive a value")
+	}
+
+	// The other replica takes the lease once it is released.
+	l0.Stop()
+	if l0.IsLeader() {
+		t.Error("leaderLease.IsLeader() = true after Stop, want false")
+	}
+	select {
+	case <-l1.Elected():
+	case <-time.After(time.Second):
+		t.Fatal("leaderLease.Elected() timed out")
+	}
+	if !l1.IsLeader() {
+		t.Error("leaderLease.IsLeader() = false, want true")
+	}
+
+	// The lease is lost if it cannot be renewed before it expires.
+	store.setError(errors.New("database is down"))
+	deadline := time.Now().Add(time.Second)
+	for l1.IsLeader() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l1.IsLeader() {
+		t.Error("leaderLease.IsLeader() = true, want false")
+	}
+}
+
+// kubernetesLeaseServer is a fake Kubernetes API server with the Lease
+// objects.
+type kubernetesLeaseServer struct {
+	mu      sync.Mutex
+	version int
+	leases  map[string]*kubernetesLease
+}
+
+func (s *kubernetesLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const prefix = "/apis/coordination.k8s.io/v1/namespaces/step/leases"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		lease, ok := s.leases[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(lease)
+		return
+	case http.MethodPost, http.MethodPut:
+		var lease kubernetesLease
+		if err := json.NewDecoder(r.Body).Decode(&lease); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		old, ok := s.leases[lease.Metadata.Name]
+		switch {
+		case r.Method == http.MethodPost && ok:
+			w.WriteHeader(http.StatusConflict)
+			return
+		case r.Method == http.MethodPut && (!ok || name != lease.Metadata.Name):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case r.Method == http.MethodPut && old.Metadata.ResourceVersion != lease.Metadata.ResourceVersion:
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"message": "the object has been modified"})
+			return
+		}
+		s.version++
+		lease.Metadata.ResourceVersion = strconv.Itoa(s.version)
+		s.leases[lease.Metadata.Name] = &lease
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(lease)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestKubernetesLeaseStore(t *testing.T) {
+	srv := httptest.NewTLSServer(&kubernetesLeaseServer{
+		leases: make(map[string]*kubernetesLease),
+	})
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &kubernetesLeaseStore{
+		client:    srv.Client(),
+		baseURL:   srv.URL,
+		tokenFile: tokenFile,
+		namespace: "step",
+	}
+
+	now := time.Now()
+	acquire := func(holder string, now time.Time, want bool) {
+		t.Helper()
+		got, err := s.AcquireLease("step-ca-radius", holder, now, 15*time.Second)
+		if err != nil {
+			t.Fatalf("kubernetesLeaseStore.AcquireLease() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("kubernetesLeaseStore.AcquireLease(%s) = %v, want %v", holder, got, want)
+		}
+	}
+
+	acquire("ca-0", now, true)
+	acquire("ca-1", now.Add(time.Second), false)
+	acquire("ca-0", now.Add(5*time.Second), true)
+	acquire("ca-1", now.Add(21*time.Second), true)
+	acquire("ca-0", now.Add(22*time.Second), false)
+
+	lease, err := s.get("step-ca-radius")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity != "ca-1" || lease.Spec.LeaseTransitions != 1 || lease.Spec.LeaseDurationSeconds != 15 {
+		t.Errorf("kubernetesLeaseStore lease = %+v", lease.Spec)
+	}
+
+	// The released lease can be acquired right away.
+	if err := s.ReleaseLease("step-ca-radius", "ca-0"); err != nil {
+		t.Fatalf("kubernetesLeaseStore.ReleaseLease() error = %v", err)
+	}
+	acquire("ca-0", now.Add(23*time.Second), false)
+	if err := s.ReleaseLease("step-ca-radius", "ca-1"); err != nil {
+		t.Fatalf("kubernetesLeaseStore.ReleaseLease() error = %v", err)
+	}
+	acquire("ca-0", now.Add(24*time.Second), true)
+
+	// A conflicting update does not get the lease.
+	lease, err = s.get("step-ca-radius")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease.Metadata.ResourceVersion = "0"
+	if ok, err := s.write(http.MethodPut, lease); err != nil || ok {
+		t.Errorf("kubernetesLeaseStore.write() = %v, %v, want false, nil", ok, err)
+	}
+
+	// Requests without a token fail.
+	s.tokenFile = filepath.Join(dir, "missing")
+	if _, err := s.AcquireLease("step-ca-radius", "ca-0", now, time.Second); err == nil {
+		t.Error("kubernetesLeaseStore.AcquireLease() error = nil, want error")
+	}
+}
@@ -0,0 +1,36 @@
+package authority
+
+import (
+	"log"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smallstep/certificates/logging"
+)
+
+// initLogger creates the logger of the background jobs with the logger
+// configuration of the CA, so their errors are written in the same format as
+// the requests. Without it, the standard logger is used.
+func (a *Authority) initLogger() error {
+	if len(a.config.Logger) == 0 || a.logger != nil {
+		return nil
+	}
+	l, err := logging.New("ca", a.config.Logger)
+	if err != nil {
+		return err
+	}
+	// The common log format only writes the fields of the requests.
+	if _, ok := l.Formatter.(*logging.CommonLogFormat); ok {
+		l.Formatter = new(logrus.TextFormatter)
+	}
+	a.logger = l
+	return nil
+}
+
+// logError logs an error of a background job.
+func (a *Authority) logError(err error, msg string) {
+	if a.logger == nil {
+		log.Printf("%s: %v", msg, err)
+		return
+	}
+	a.logger.WithError(err).Error(msg)
+}
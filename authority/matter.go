@@ -0,0 +1,61 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// matterOption is the sign option added to the requests of provisioners with
+// the Matter profile enabled.
+type matterOption struct {
+	options *provisioner.MatterOptions
+}
+
+// newMatterOption returns the Matter option if the Matter profile is enabled
+// in the given provisioner.
+func newMatterOption(p provisioner.Interface) *matterOption {
+	if o := getProvisionerOptions(p).GetMatter(); o != nil {
+		return &matterOption{options: o}
+	}
+	return nil
+}
+
+// enforceMatterDAC adds the requested vendor and product ids to the subject
+// of a Device Attestation Certificate and verifies that the certificate has
+// the structure required by the Matter specification.
+func (a *Authority) enforceMatterDAC(o *matterOption, leaf *x509.Certificate, so provisioner.SignOptions) error {
+	if o == nil {
+		return nil
+	}
+	ids, err := o.options.GetMatterIDs(so)
+	if err != nil {
+		return errs.BadRequestErr(err, errs.WithMessage("%s.", err.Error()))
+	}
+
+	// Replace any vendor or product id set by the template.
+	names := make([]pkix.AttributeTypeAndValue, 0, len(leaf.Subject.ExtraNames)+2)
+	for _, atv := range leaf.Subject.ExtraNames {
+		if !atv.Type.Equal(provisioner.OIDMatterVendorID) && !atv.Type.Equal(provisioner.OIDMatterProductID) {
+			names = append(names, atv)
+		}
+	}
+	leaf.Subject.ExtraNames = append(names,
+		provisioner.MatterAttribute(provisioner.OIDMatterVendorID, ids.VendorID),
+		provisioner.MatterAttribute(provisioner.OIDMatterProductID, ids.ProductID),
+	)
+
+	if key, ok := leaf.PublicKey.(*ecdsa.PublicKey); !ok || key.Curve != elliptic.P256() {
+		return errs.Forbidden("authority.enforceMatterDAC; public key must be an ECDSA P-256 key",
+			errs.WithMessage("Matter device attestation certificates require an ECDSA P-256 key."))
+	}
+	if leaf.IsCA || leaf.KeyUsage != x509.KeyUsageDigitalSignature {
+		return errs.Forbidden("authority.enforceMatterDAC; certificate must be an end-entity certificate with only the digitalSignature key usage",
+			errs.WithMessage("Matter device attestation certificates must be end-entity certificates with only the digitalSignature key usage."))
+	}
+	return nil
+}
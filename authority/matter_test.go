@@ -0,0 +1,85 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_enforceMatterDAC(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+
+	opt := &matterOption{options: &provisioner.MatterOptions{VendorID: "FFF1", ProductIDs: []string{"8000"}}}
+	so := provisioner.SignOptions{TemplateData: []byte(`{"productID":"8000"}`)}
+	newLeaf := func() *x509.Certificate {
+		return &x509.Certificate{
+			PublicKey:             p256.Public(),
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+		}
+	}
+
+	type test struct {
+		opt        *matterOption
+		leaf       *x509.Certificate
+		so         provisioner.SignOptions
+		wantStatus int
+	}
+	tests := map[string]func() test{
+		"ok nil": func() test {
+			return test{opt: nil, leaf: &x509.Certificate{}, so: provisioner.SignOptions{}}
+		},
+		"ok": func() test {
+			return test{opt: opt, leaf: newLeaf(), so: so}
+		},
+		"fail productID": func() test {
+			return test{opt: opt, leaf: newLeaf(), so: provisioner.SignOptions{TemplateData: []byte(`{"productID":"8001"}`)}, wantStatus: http.StatusBadRequest}
+		},
+		"fail key": func() test {
+			leaf := newLeaf()
+			leaf.PublicKey = p384.Public()
+			return test{opt: opt, leaf: leaf, so: so, wantStatus: http.StatusForbidden}
+		},
+		"fail ca": func() test {
+			leaf := newLeaf()
+			leaf.IsCA = true
+			return test{opt: opt, leaf: leaf, so: so, wantStatus: http.StatusForbidden}
+		},
+		"fail keyUsage": func() test {
+			leaf := newLeaf()
+			leaf.KeyUsage |= x509.KeyUsageKeyEncipherment
+			return test{opt: opt, leaf: leaf, so: so, wantStatus: http.StatusForbidden}
+		},
+	}
+	for name, fn := range tests {
+		tc := fn()
+		t.Run(name, func(t *testing.T) {
+			a := &Authority{}
+			err := a.enforceMatterDAC(tc.opt, tc.leaf, tc.so)
+			if tc.wantStatus != 0 {
+				if assert.NotNil(t, err) {
+					sc, ok := err.(errs.StatusCoder)
+					assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+					assert.Equals(t, tc.wantStatus, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			if tc.opt != nil {
+				assert.Equals(t, "FFF1", provisioner.GetMatterID(tc.leaf.Subject, provisioner.OIDMatterVendorID))
+				assert.Equals(t, "8000", provisioner.GetMatterID(tc.leaf.Subject, provisioner.OIDMatterProductID))
+				assert.Equals(t, 2, len(tc.leaf.Subject.ExtraNames))
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+)
+
+// SignOnDemand creates a new private key and a certificate for the given
+// domain. The request is authenticated by the client certificate, that must be
+// already verified by the TLS handshake, and authorized by the on-demand
+// configuration.
+//
+// On-demand certificates do not contain a provisioner extension, so they cannot
+// be renewed using the renew endpoint, clients are expected to request a new
+// one before the expiration.
+func (a *Authority) SignOnDemand(client *x509.Certificate, domain string) ([]*x509.Certificate, crypto.Signer, error) {
+	opts := []interface{}{errs.WithKeyVal("domain", domain)}
+
+	c := a.config.AuthorityConfig.OnDemand
+	if c == nil {
+		return nil, nil, errs.NotImplemented("authority.SignOnDemand; on-demand certificates are not enabled", opts...)
+	}
+	if client == nil {
+		return nil, nil, errs.Unauthorized("authority.SignOnDemand; missing client certificate", opts...)
+	}
+	opts = append(opts, errs.WithKeyVal("client", client.Subject.CommonName))
+
+	// Verify the client certificate.
+	if isRevoked, err := a.IsRevoked(client.SerialNumber.String()); err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignOnDemand", opts...)
+	} else if isRevoked {
+		return nil, nil, errs.Unauthorized("authority.SignOnDemand; client certificate has been revoked", opts...)
+	}
+	names := append([]string{client.Subject.CommonName}, client.DNSNames...)
+	names = append(names, client.EmailAddresses...)
+	if !c.IsAllowedClient(names...) {
+		return nil, nil, errs.Forbidden("authority.SignOnDemand; client %s is not allowed", append([]interface{}{client.Subject.CommonName}, opts...)...)
+	}
+	if !c.IsAllowedDomain(domain) {
+		return nil, nil, errs.Forbidden("authority.SignOnDemand; domain %s is not allowed", append([]interface{}{domain}, opts...)...)
+	}
+
+	// Create the key and the certificate request.
+	priv, err := keyutil.GenerateDefaultKey()
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignOnDemand", opts...)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, errs.InternalServer("authority.SignOnDemand; private key is not a crypto.Signer", opts...)
+	}
+	csr, err := x509util.CreateCertificateRequest(domain, []string{domain}, signer)
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignOnDemand", opts...)
+	}
+
+	duration, err := a.onDemandDuration(c)
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignOnDemand", opts...)
+	}
+	templateOptions, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData(domain, []string{domain}))
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignOnDemand", opts...)
+	}
+
+	certChain, err := a.Sign(csr, provisioner.SignOptions{}, templateOptions,
+		provisioner.CertificateModifierFunc(func(crt *x509.Certificate, so provisioner.SignOptions) error {
+			now := a.now()
+			crt.NotBefore = now.Add(-1 * so.Backdate)
+			crt.NotAfter = now.Add(duration)
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certChain, signer, nil
+}
+
+// onDemandDuration returns the validity of the on-demand certificates.
+func (a *Authority) onDemandDuration(c *config.OnDemandConfig) (time.Duration, error) {
+	if c.Duration != nil {
+		return c.Duration.Duration, nil
+	}
+	claimer, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
+	if err != nil {
+		return 0, err
+	}
+	return claimer.DefaultTLSCertDuration(), nil
+}
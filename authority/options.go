@@ -9,6 +9,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/authority/hooks"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
@@ -56,6 +58,16 @@ func WithGetIdentityFunc(fn func(ctx context.Context, p provisioner.Interface, e
 	}
 }
 
+// WithIdentityResolver sets the resolver used to convert the identity documents
+// created by the provisioners before using them in the templates and the
+// policy hooks.
+func WithIdentityResolver(r provisioner.IdentityResolver) Option {
+	return func(a *Authority) error {
+		a.identityResolver = r
+		return nil
+	}
+}
+
 // WithSSHBastionFunc sets a custom function to get the bastion for a
 // given user-host pair.
 func WithSSHBastionFunc(fn func(ctx context.Context, user, host string) (*config.Bastion, error)) Option {
@@ -205,6 +217,37 @@ func WithLinkedCAToken(token string) Option {
 	}
 }
 
+// WithEventBus is an option to set the bus where the authority publishes the
+// lifecycle events. It allows to subscribe to the events before the authority
+// is initialized.
+func WithEventBus(bus *events.Bus) Option {
+	return func(a *Authority) error {
+		a.events = bus
+		return nil
+	}
+}
+
+// WithPolicyHooks is an option to add hooks that take custom decisions on the
+// issuance of certificates. These hooks are evaluated before the ones in the
+// configuration.
+func WithPolicyHooks(h ...hooks.Hook) Option {
+	return func(a *Authority) error {
+		a.policyHooks = append(a.policyHooks, h...)
+		return nil
+	}
+}
+
+// WithClock is an option to set the source of the current time used by the
+// authority and its provisioners to validate the tokens and to set and
+// validate the validity of the certificates. It allows to write
+// deterministic tests of the issuance and the expiration of certificates.
+func WithClock(c provisioner.Clock) Option {
+	return func(a *Authority) error {
+		a.clock = c
+		return nil
+	}
+}
+
 func readCertificateBundle(pemCerts []byte) ([]*x509.Certificate, error) {
 	var block *pem.Block
 	var certs []*x509.Certificate
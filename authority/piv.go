@@ -0,0 +1,87 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// EnrollPIV signs a certificate for a key generated in a YubiKey. The key
+// must have a PIV attestation signed by one of the attestation roots, and its
+// PIN and touch policies must be allowed by the PIV configuration. The
+// certificate is marked as hardware-bound with an extension containing the
+// serial number of the device and the policies of the key.
+func (a *Authority) EnrollPIV(ctx context.Context, csr *x509.CertificateRequest, stmt *keyattest.Statement, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	c := a.config.AuthorityConfig.PIV
+	if c == nil {
+		return nil, errs.NotImplemented("authority.EnrollPIV; piv enrollment is not enabled")
+	}
+	res, err := a.checkPIVAttestation(c, csr, stmt)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := provisioner.CreateHardwareBoundExtension(res)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.EnrollPIV")
+	}
+
+	extraOpts = append(extraOpts, provisioner.CertificateEnforcerFunc(func(crt *x509.Certificate) error {
+		name, _ := provisioner.GetProvisionerName(crt.ExtraExtensions)
+		if !c.IsProvisionerAllowed(name) {
+			return errors.Errorf("provisioner %s is not allowed to enroll piv credentials", name)
+		}
+		// Replace any hardware-bound extension added by the template.
+		extensions := []pkix.Extension{}
+		for _, e := range crt.ExtraExtensions {
+			if !e.Id.Equal(ext.Id) {
+				extensions = append(extensions, e)
+			}
+		}
+		crt.ExtraExtensions = append(extensions, ext)
+		return nil
+	}))
+	signOpts.Attestation = stmt
+	return a.SignWithContext(ctx, csr, signOpts, extraOpts...)
+}
+
+// checkPIVAttestation verifies the YubiKey PIV attestation of the key in the
+// certificate request and returns its attributes.
+func (a *Authority) checkPIVAttestation(c *config.PIVConfig, csr *x509.CertificateRequest, stmt *keyattest.Statement) (*keyattest.Result, error) {
+	if stmt == nil || stmt.Format != keyattest.FormatYubiKey {
+		return nil, errs.Forbidden("authority.checkPIVAttestation; missing or unsupported key attestation",
+			errs.WithMessage("PIV enrollment requires a YubiKey PIV attestation."),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	policy := a.GetAttestationPolicy()
+	res, err := keyattest.Verify(stmt, csr.PublicKey, keyattest.VerifyOptions{
+		VerifyChain: policy.VerifyChain,
+	})
+	if err != nil {
+		return nil, errs.NewErr(http.StatusForbidden, errors.Wrap(err, "authority.checkPIVAttestation"),
+			errs.WithMessage("The PIV attestation is not valid."),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	if !policy.IsSerialNumberAllowed(res.SerialNumber) {
+		return nil, errs.Forbidden("authority.checkPIVAttestation; device %s is not allowed", res.SerialNumber,
+			errs.WithMessage("The device %s is not allowed to enroll PIV credentials.", res.SerialNumber),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	if !c.IsPINPolicyAllowed(res.PINPolicy) {
+		return nil, errs.Forbidden("authority.checkPIVAttestation; pin policy '%s' is not allowed", res.PINPolicy,
+			errs.WithMessage("The PIN policy of the key is not allowed."),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	if !c.IsTouchPolicyAllowed(res.TouchPolicy) {
+		return nil, errs.Forbidden("authority.checkPIVAttestation; touch policy '%s' is not allowed", res.TouchPolicy,
+			errs.WithMessage("The touch policy of the key is not allowed."),
+			errs.WithCode(errs.CodeKeyAttestationRequired))
+	}
+	return res, nil
+}
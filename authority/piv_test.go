@@ -0,0 +1,117 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
+)
+
+func yubiKeyPolicyExtension(pin, touch byte) pkix.Extension {
+	return pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 41482, 3, 8}, Value: []byte{pin, touch}}
+}
+
+func TestAuthority_checkPIVAttestation(t *testing.T) {
+	root, rootKey := newAttestationCert(t, "Attestation Root", true, nil, nil)
+	device, deviceKey := newAttestationCert(t, "Yubico PIV Attestation", false, root, rootKey)
+	policy := &AttestationPolicy{
+		Roots:               []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))},
+		DeniedSerialNumbers: []string{"666"},
+	}
+	assert.FatalError(t, policy.Init())
+	a := &Authority{attestationPolicy: policy}
+
+	csr := newCodeSigningCSR(t)
+	att := newYubiKeyAttestation(t, device, deviceKey, csr, 1234, yubiKeyPolicyExtension(2, 2))
+
+	res, err := a.checkPIVAttestation(&config.PIVConfig{}, csr, att)
+	assert.FatalError(t, err)
+	assert.Equals(t, "1234", res.SerialNumber)
+	assert.Equals(t, keyattest.PolicyOnce, res.PINPolicy)
+	assert.Equals(t, keyattest.PolicyAlways, res.TouchPolicy)
+
+	tests := []struct {
+		name   string
+		config *config.PIVConfig
+		stmt   *keyattest.Statement
+	}{
+		{"fail nil", &config.PIVConfig{}, nil},
+		{"fail format", &config.PIVConfig{}, &keyattest.Statement{Format: keyattest.FormatTPM, X5C: att.X5C}},
+		{"fail key", &config.PIVConfig{}, newYubiKeyAttestation(t, device, deviceKey, newCodeSigningCSR(t), 1234, yubiKeyPolicyExtension(2, 2))},
+		{"fail denied", &config.PIVConfig{}, newYubiKeyAttestation(t, device, deviceKey, csr, 666, yubiKeyPolicyExtension(2, 2))},
+		{"fail no policy", &config.PIVConfig{}, newYubiKeyAttestation(t, device, deviceKey, csr, 1234)},
+		{"fail pin policy", &config.PIVConfig{}, newYubiKeyAttestation(t, device, deviceKey, csr, 1234, yubiKeyPolicyExtension(1, 2))},
+		{"fail touch policy", &config.PIVConfig{}, newYubiKeyAttestation(t, device, deviceKey, csr, 1234, yubiKeyPolicyExtension(2, 1))},
+		{"fail configured pin policy", &config.PIVConfig{PINPolicies: []string{"always"}}, att},
+		{"fail configured touch policy", &config.PIVConfig{TouchPolicies: []string{"cached"}}, att},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.checkPIVAttestation(tt.config, csr, tt.stmt)
+			assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeKeyAttestationRequired)
+		})
+	}
+
+	// Without trusted roots
+	_, err = (&Authority{}).checkPIVAttestation(&config.PIVConfig{}, csr, att)
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeKeyAttestationRequired)
+}
+
+func TestAuthority_EnrollPIV(t *testing.T) {
+	root, rootKey := newAttestationCert(t, "Attestation Root", true, nil, nil)
+	device, deviceKey := newAttestationCert(t, "Yubico PIV Attestation", false, root, rootKey)
+	policy := &AttestationPolicy{
+		Roots: []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))},
+	}
+	assert.FatalError(t, policy.Init())
+
+	a := testAuthority(t)
+	a.attestationPolicy = policy
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	csr := getCSR(t, priv)
+	att := newYubiKeyAttestation(t, device, deviceKey, csr, 1234, yubiKeyPolicyExtension(3, 3))
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	assert.FatalError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+
+	// PIV enrollment disabled
+	_, err = a.EnrollPIV(context.Background(), csr, att, provisioner.SignOptions{}, extraOpts...)
+	assertCodeSigningError(t, err, http.StatusNotImplemented, errs.CodeNotImplemented)
+
+	// Provisioner not allowed
+	a.config.AuthorityConfig.PIV = &config.PIVConfig{Provisioners: []string{"operators"}}
+	_, err = a.EnrollPIV(context.Background(), csr, att, provisioner.SignOptions{}, extraOpts...)
+	assert.NotNil(t, err)
+
+	a.config.AuthorityConfig.PIV = &config.PIVConfig{Provisioners: []string{"step-cli"}}
+	certs, err := a.EnrollPIV(context.Background(), csr, att, provisioner.SignOptions{}, extraOpts...)
+	assert.FatalError(t, err)
+	hb, ok := provisioner.GetHardwareBound(certs[0].Extensions)
+	assert.True(t, ok)
+	assert.Equals(t, &provisioner.HardwareBound{
+		Format:       keyattest.FormatYubiKey,
+		SerialNumber: "1234",
+		PINPolicy:    keyattest.PolicyAlways,
+		TouchPolicy:  keyattest.PolicyCached,
+	}, hb)
+}
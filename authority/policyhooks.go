@@ -0,0 +1,256 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/hooks"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
+	"golang.org/x/crypto/ssh"
+)
+
+// initPolicyHooks initializes the hooks configured in the authority, the
+// hooks set with WithPolicyHooks are evaluated first.
+func (a *Authority) initPolicyHooks() error {
+	if c := a.config.AuthorityConfig.WASMPolicy; c != nil {
+		var h hooks.Hook = &hooks.WASM{
+			Module:        c.Module,
+			Runtime:       c.GetRuntime(),
+			RuntimeArgs:   c.RuntimeArgs,
+			Timeout:       c.Timeout.Value(),
+			MaxOutputSize: c.MaxOutputSize,
+		}
+		if c.FailOpen {
+			h = hooks.FailOpen(h)
+		}
+		a.policyHooks = append(a.policyHooks, h)
+	}
+	if c := a.config.AuthorityConfig.OPAPolicy; c != nil {
+		var h hooks.Hook = &hooks.OPA{
+			URL:          c.URL,
+			Path:         c.GetPath(),
+			Token:        c.Token,
+			Timeout:      c.Timeout.Value(),
+			DecisionLogs: c.DecisionLogs,
+			Breaker:      breaker.New("opa", a.config.CircuitBreaker.GetSettings()),
+			Client:       a.newResolverClient(),
+		}
+		if c.FailOpen {
+			h = hooks.FailOpen(h)
+		}
+		a.policyHooks = append(a.policyHooks, h)
+	}
+	return nil
+}
+
+// newResolverClient returns an HTTP client that resolves the hosts with the
+// DNS resolver of the authority, or nil, the default client, if the DNS cache
+// is not enabled.
+func (a *Authority) newResolverClient() *http.Client {
+	if a.config.DNSCache == nil {
+		return nil
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = a.resolver.DialContext(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	return &http.Client{Transport: tr}
+}
+
+// policyHookOption is the sign option that contains the provisioner and token
+// sent to the policy hooks. It is only added if policy hooks are configured.
+type policyHookOption struct {
+	ctx         context.Context
+	provisioner provisioner.Interface
+	token       string
+	identity    *provisioner.IdentityDocument
+}
+
+// withIdentity sets the identity document returned by the provisioner in the
+// option. If the option is nil, e.g. in ACME, it returns a new one with the
+// identity.
+func (o *policyHookOption) withIdentity(identity *provisioner.IdentityDocument) *policyHookOption {
+	if identity == nil {
+		return o
+	}
+	if o == nil {
+		o = &policyHookOption{ctx: context.Background()}
+	}
+	o.identity = identity
+	return o
+}
+
+// newPolicyHookRequest creates the base request sent to the policy hooks.
+func newPolicyHookRequest(typ string, o *policyHookOption) *hooks.Request {
+	req := &hooks.Request{
+		Type: typ,
+	}
+	if p := o.provisioner; p != nil {
+		req.Provisioner = &hooks.Provisioner{
+			ID:   p.GetID(),
+			Name: p.GetName(),
+			Type: p.GetType().String(),
+		}
+	}
+	if jwt, err := jose.ParseSigned(o.token); err == nil {
+		claims := make(map[string]interface{})
+		if err := jwt.UnsafeClaimsWithoutVerification(&claims); err == nil {
+			req.Token = claims
+		}
+	}
+	if id := o.identity; id != nil {
+		req.Identity = &hooks.Identity{
+			Provisioner: id.Provisioner,
+			Type:        id.Type,
+			Subject:     id.Subject,
+			Email:       id.Email,
+			Groups:      id.Groups,
+			Names:       id.Names,
+			Attributes:  id.Attributes,
+		}
+	}
+	return req
+}
+
+// evaluatePolicyHooks sends the request to all the hooks. Mutations are
+// applied after each hook so the next one receives the updated request.
+func (a *Authority) evaluatePolicyHooks(ctx context.Context, req *hooks.Request, apply func(*hooks.Mutations) error) error {
+	for _, h := range a.policyHooks {
+		d, err := h.Evaluate(ctx, req)
+		if err != nil {
+			return errs.Wrap(http.StatusInternalServerError, breakerError(err), "authority.evaluatePolicyHooks")
+		}
+		switch d.Action {
+		case hooks.ActionDeny:
+			msg := "The request was denied by the issuance policy."
+			if d.Reason != "" {
+				msg = "The request was denied by the issuance policy: " + d.Reason
+			}
+			return errs.Forbidden("authority.evaluatePolicyHooks; request denied by policy hook: %s", d.Reason,
+				errs.WithMessage(msg), errs.WithCode(errs.CodePolicyDenied))
+		case hooks.ActionMutate:
+			if err := apply(d.Mutations); err != nil {
+				return errs.Wrap(http.StatusInternalServerError, err, "authority.evaluatePolicyHooks")
+			}
+		}
+	}
+	return nil
+}
+
+// evaluateX509PolicyHooks evaluates the policy hooks with the final X.509
+// certificate template. The provisioner is loaded from the certificate if the
+// sign request was not authorized with a token, e.g. in ACME or SCEP.
+func (a *Authority) evaluateX509PolicyHooks(o *policyHookOption, cert *x509.Certificate) error {
+	if len(a.policyHooks) == 0 {
+		return nil
+	}
+	if o == nil {
+		o = &policyHookOption{ctx: context.Background()}
+	}
+	if o.provisioner == nil {
+		if p, err := a.LoadProvisionerByCertificate(cert); err == nil {
+			o.provisioner = p
+		}
+	}
+
+	req := newPolicyHookRequest(hooks.X509Request, o)
+	req.X509 = &hooks.X509Certificate{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+	}
+	for _, ip := range cert.IPAddresses {
+		req.X509.IPAddresses = append(req.X509.IPAddresses, ip.String())
+	}
+	for _, u := range cert.URIs {
+		req.X509.URIs = append(req.X509.URIs, u.String())
+	}
+
+	return a.evaluatePolicyHooks(o.ctx, req, func(m *hooks.Mutations) error {
+		if m.CommonName != nil {
+			cert.Subject.CommonName = *m.CommonName
+			req.X509.CommonName = *m.CommonName
+		}
+		if m.DNSNames != nil {
+			cert.DNSNames = m.DNSNames
+			req.X509.DNSNames = m.DNSNames
+		}
+		if m.EmailAddresses != nil {
+			cert.EmailAddresses = m.EmailAddresses
+			req.X509.EmailAddresses = m.EmailAddresses
+		}
+		if m.IPAddresses != nil {
+			ips := make([]net.IP, len(m.IPAddresses))
+			for i, s := range m.IPAddresses {
+				if ips[i] = net.ParseIP(s); ips[i] == nil {
+					return errors.Errorf("policy hook returned an invalid ip address '%s'", s)
+				}
+			}
+			cert.IPAddresses = ips
+			req.X509.IPAddresses = m.IPAddresses
+		}
+		if m.URIs != nil {
+			uris := make([]*url.URL, len(m.URIs))
+			for i, s := range m.URIs {
+				u, err := url.Parse(s)
+				if err != nil {
+					return errors.Wrapf(err, "policy hook returned an invalid uri '%s'", s)
+				}
+				uris[i] = u
+			}
+			cert.URIs = uris
+			req.X509.URIs = m.URIs
+		}
+		return nil
+	})
+}
+
+// evaluateSSHPolicyHooks evaluates the policy hooks with the SSH certificate
+// template.
+func (a *Authority) evaluateSSHPolicyHooks(o *policyHookOption, cert *ssh.Certificate) error {
+	if len(a.policyHooks) == 0 {
+		return nil
+	}
+	if o == nil {
+		o = &policyHookOption{ctx: context.Background()}
+	}
+
+	req := newPolicyHookRequest(hooks.SSHRequest, o)
+	req.SSH = &hooks.SSHCertificate{
+		CertType:   provisioner.SSHUserCert,
+		KeyID:      cert.KeyId,
+		Principals: cert.ValidPrincipals,
+	}
+	if cert.CertType == ssh.HostCert {
+		req.SSH.CertType = provisioner.SSHHostCert
+	}
+	if cert.ValidAfter != 0 {
+		req.SSH.ValidAfter = time.Unix(int64(cert.ValidAfter), 0).UTC()
+	}
+	if cert.ValidBefore != 0 && cert.ValidBefore != ssh.CertTimeInfinity {
+		req.SSH.ValidBefore = time.Unix(int64(cert.ValidBefore), 0).UTC()
+	}
+
+	return a.evaluatePolicyHooks(o.ctx, req, func(m *hooks.Mutations) error {
+		if m.KeyID != nil {
+			cert.KeyId = *m.KeyID
+			req.SSH.KeyID = *m.KeyID
+		}
+		if m.Principals != nil {
+			cert.ValidPrincipals = m.Principals
+			req.SSH.Principals = m.Principals
+		}
+		return nil
+	})
+}
@@ -0,0 +1,180 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/breaker"
+	"github.com/smallstep/certificates/authority/hooks"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"golang.org/x/crypto/ssh"
+)
+
+type mockHook struct {
+	evaluate func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error)
+}
+
+func (m *mockHook) Evaluate(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+	return m.evaluate(ctx, req)
+}
+
+func TestAuthority_evaluateX509PolicyHooks(t *testing.T) {
+	p := &provisioner.JWK{ID: "jwk-id", Name: "jwk", Type: "JWK"}
+	opt := &policyHookOption{ctx: context.Background(), provisioner: p}
+	newCert := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "foo"},
+			DNSNames: []string{"foo", "foo.internal"},
+		}
+	}
+
+	// No hooks
+	a := &Authority{}
+	assert.FatalError(t, a.evaluateX509PolicyHooks(opt, newCert()))
+
+	// Allow
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			assert.Equals(t, hooks.X509Request, req.Type)
+			assert.Equals(t, &hooks.Provisioner{ID: "jwk-id", Name: "jwk", Type: "JWK"}, req.Provisioner)
+			assert.Equals(t, "foo", req.X509.CommonName)
+			assert.Equals(t, []string{"foo", "foo.internal"}, req.X509.DNSNames)
+			return &hooks.Decision{Action: hooks.ActionAllow}, nil
+		},
+	}}
+	assert.FatalError(t, a.evaluateX509PolicyHooks(opt, newCert()))
+
+	// Identity
+	identity := &provisioner.IdentityDocument{Provisioner: "jwk", Type: "JWK", Subject: "foo", Groups: []string{"admins"}}
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			assert.Equals(t, &hooks.Identity{Provisioner: "jwk", Type: "JWK", Subject: "foo", Groups: []string{"admins"}}, req.Identity)
+			return &hooks.Decision{Action: hooks.ActionAllow}, nil
+		},
+	}}
+	idOpt := &policyHookOption{ctx: context.Background(), provisioner: p}
+	assert.FatalError(t, a.evaluateX509PolicyHooks(idOpt.withIdentity(identity), newCert()))
+
+	// Deny
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			return &hooks.Decision{Action: hooks.ActionDeny, Reason: "foo.internal is reserved"}, nil
+		},
+	}}
+	err := a.evaluateX509PolicyHooks(opt, newCert())
+	if assert.NotNil(t, err) {
+		e, ok := err.(*errs.Error)
+		assert.Fatal(t, ok)
+		assert.Equals(t, http.StatusForbidden, e.StatusCode())
+		assert.Equals(t, errs.CodePolicyDenied, e.ErrorCode())
+		assert.Equals(t, "The request was denied by the issuance policy: foo.internal is reserved", e.Message())
+	}
+
+	// Mutate, the second hook receives the mutated request
+	cn := "bar"
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			return &hooks.Decision{Action: hooks.ActionMutate, Mutations: &hooks.Mutations{
+				CommonName:  &cn,
+				DNSNames:    []string{"bar"},
+				IPAddresses: []string{"10.0.0.1"},
+			}}, nil
+		},
+	}, &mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			assert.Equals(t, "bar", req.X509.CommonName)
+			assert.Equals(t, []string{"bar"}, req.X509.DNSNames)
+			assert.Equals(t, []string{"10.0.0.1"}, req.X509.IPAddresses)
+			return &hooks.Decision{Action: hooks.ActionAllow}, nil
+		},
+	}}
+	cert := newCert()
+	assert.FatalError(t, a.evaluateX509PolicyHooks(opt, cert))
+	assert.Equals(t, "bar", cert.Subject.CommonName)
+	assert.Equals(t, []string{"bar"}, cert.DNSNames)
+	assert.Equals(t, []net.IP{net.ParseIP("10.0.0.1")}, cert.IPAddresses)
+
+	// Mutate with an invalid ip
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			return &hooks.Decision{Action: hooks.ActionMutate, Mutations: &hooks.Mutations{
+				IPAddresses: []string{"foo"},
+			}}, nil
+		},
+	}}
+	assert.NotNil(t, a.evaluateX509PolicyHooks(opt, newCert()))
+
+	// Hook error
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			return nil, errors.New("force")
+		},
+	}}
+	err = a.evaluateX509PolicyHooks(opt, newCert())
+	if assert.NotNil(t, err) {
+		sc, ok := err.(errs.StatusCoder)
+		assert.Fatal(t, ok)
+		assert.Equals(t, http.StatusInternalServerError, sc.StatusCode())
+	}
+
+	// Hook with an open circuit breaker
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			return nil, errors.Wrap(&breaker.OpenError{Name: "opa", RetryAfter: time.Minute}, "error querying opa")
+		},
+	}}
+	err = a.evaluateX509PolicyHooks(opt, newCert())
+	if assert.NotNil(t, err) {
+		e, ok := err.(*errs.Error)
+		assert.Fatal(t, ok)
+		assert.Equals(t, http.StatusServiceUnavailable, e.StatusCode())
+		assert.Equals(t, time.Minute, e.RetryAfter)
+	}
+}
+
+func TestAuthority_evaluateSSHPolicyHooks(t *testing.T) {
+	newCert := func() *ssh.Certificate {
+		return &ssh.Certificate{
+			CertType:        ssh.HostCert,
+			KeyId:           "foo.internal",
+			ValidPrincipals: []string{"foo.internal"},
+		}
+	}
+
+	a := &Authority{policyHooks: []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			assert.Equals(t, hooks.SSHRequest, req.Type)
+			assert.Equals(t, provisioner.SSHHostCert, req.SSH.CertType)
+			keyID := "bar.internal"
+			return &hooks.Decision{Action: hooks.ActionMutate, Mutations: &hooks.Mutations{
+				KeyID:      &keyID,
+				Principals: []string{"bar.internal", "bar"},
+			}}, nil
+		},
+	}}}
+	cert := newCert()
+	assert.FatalError(t, a.evaluateSSHPolicyHooks(nil, cert))
+	assert.Equals(t, "bar.internal", cert.KeyId)
+	assert.Equals(t, []string{"bar.internal", "bar"}, cert.ValidPrincipals)
+
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			return &hooks.Decision{Action: hooks.ActionDeny}, nil
+		},
+	}}
+	err := a.evaluateSSHPolicyHooks(nil, newCert())
+	if assert.NotNil(t, err) {
+		e, ok := err.(*errs.Error)
+		assert.Fatal(t, ok)
+		assert.Equals(t, http.StatusForbidden, e.StatusCode())
+		assert.Equals(t, "The request was denied by the issuance policy.", e.Message())
+	}
+}
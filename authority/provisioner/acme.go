@@ -2,24 +2,244 @@ package provisioner
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/keyattest"
+	"github.com/smallstep/certificates/dnsupdate"
 	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/x509util"
 )
 
+// ACMEOrderDataKey is the key used in the X.509 template data to expose the
+// ACME order being finalized.
+const ACMEOrderDataKey = "Order"
+
+// ACMEIdentifier is an identifier of an ACME order.
+type ACMEIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// ValidationMethod is the type of the challenge used to validate the
+	// identifier, e.g. "dns-01", and ValidatedAt the time of the validation
+	// in RFC 3339 format.
+	ValidationMethod string `json:"validationMethod,omitempty"`
+	ValidatedAt      string `json:"validatedAt,omitempty"`
+}
+
+// ACMEAccountKeyAttestation contains the metadata of the attestation of an
+// ACME account key, verified when the account was created.
+type ACMEAccountKeyAttestation struct {
+	Format       string    `json:"format"`
+	SerialNumber string    `json:"serialNumber,omitempty"`
+	VerifiedAt   time.Time `json:"verifiedAt"`
+}
+
+// ACMEAccountClientCertificate contains the identity of the client certificate
+// bound to an ACME account, verified when the account was created.
+type ACMEAccountClientCertificate struct {
+	Identity     string    `json:"identity"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serialNumber"`
+	Fingerprint  string    `json:"fingerprint"`
+	BoundAt      time.Time `json:"boundAt"`
+}
+
+// ACMEOrder contains the attributes of the ACME order being finalized. The
+// common name and the SANs are the ones in the certificate request, already
+// validated against the identifiers of the order.
+type ACMEOrder struct {
+	ID                    string                            `json:"id"`
+	AccountID             string                            `json:"accountID"`
+	Identifiers           []ACMEIdentifier                  `json:"identifiers"`
+	CommonName            string                            `json:"commonName"`
+	SANs                  []x509util.SubjectAlternativeName `json:"sans"`
+	AccountKeyAttestation *ACMEAccountKeyAttestation        `json:"accountKeyAttestation,omitempty"`
+	Account               *ACMEAccount                      `json:"account,omitempty"`
+}
+
+// ACMEAccount contains the metadata of the ACME account finalizing an order.
+type ACMEAccount struct {
+	ID                   string                        `json:"id"`
+	Contact              []string                      `json:"contact,omitempty"`
+	Labels               map[string]string             `json:"labels,omitempty"`
+	ClientCertificate    *ACMEAccountClientCertificate `json:"clientCertificate,omitempty"`
+	ExternalAccountKeyID string                        `json:"externalAccountKeyID,omitempty"`
+}
+
+// ACMEDNSAssistOptions configures the assisted dns-01 mode of an ACME
+// provisioner. In this mode the CA creates the TXT records of the dns-01
+// challenges of trusted accounts, using the configured DNS backend, so
+// clients that cannot update the DNS can validate names in internal zones.
+type ACMEDNSAssistOptions struct {
+	dnsupdate.Options
+	// Accounts are the ids of the trusted ACME accounts.
+	Accounts []string `json:"accounts"`
+	// Zones are the zones where the CA can create records.
+	Zones []string `json:"zones"`
+}
+
+// Validate validates the assisted dns-01 options.
+func (o *ACMEDNSAssistOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.Accounts) == 0 {
+		return errors.New("dnsAssist requires at least one account")
+	}
+	if len(o.Zones) == 0 {
+		return errors.New("dnsAssist requires at least one zone")
+	}
+	return o.Options.Validate()
+}
+
+// isTrusted returns true if the CA can create the TXT records of the given
+// account and domain.
+func (o *ACMEDNSAssistOptions) isTrusted(accountID, domain string) bool {
+	var trusted bool
+	for _, id := range o.Accounts {
+		if id == accountID {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return false
+	}
+	domain = strings.TrimPrefix(domain, "*.")
+	for _, zone := range o.Zones {
+		if dnsupdate.InZone(domain, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// ACMEClientCertificateOptions configures an ACME provisioner that requires
+// a client certificate, issued by the CA, in the ACME requests. The accounts
+// are bound to the identity of the certificate used to create them, so only
+// devices already enrolled can create accounts and order certificates.
+type ACMEClientCertificateOptions struct {
+	// Provisioners are the names of the provisioners that must have issued
+	// the client certificates. Any certificate issued by the CA is accepted if
+	// empty.
+	Provisioners []string `json:"provisioners,omitempty"`
+}
+
+// isProvisionerAllowed returns true if a client certificate issued by the
+// given provisioner is accepted.
+func (o *ACMEClientCertificateOptions) isProvisionerAllowed(name string) bool {
+	if len(o.Provisioners) == 0 {
+		return true
+	}
+	for _, p := range o.Provisioners {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCertificateIdentity returns the identity an ACME account is bound to,
+// the common name or the first SAN of the certificate.
+func clientCertificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.IPAddresses) > 0:
+		return cert.IPAddresses[0].String()
+	default:
+		return ""
+	}
+}
+
+// ACMEDirectoryMeta contains the metadata published in the directory of an
+// ACME provisioner.
+type ACMEDirectoryMeta struct {
+	// TermsOfService is the URL of the terms of service. If set, new accounts
+	// must agree to them.
+	TermsOfService string `json:"termsOfService,omitempty"`
+	// Website is the URL of a website with information about the CA.
+	Website string `json:"website,omitempty"`
+	// CAAIdentities are the domains recognized by the CA in CAA records.
+	CAAIdentities []string `json:"caaIdentities,omitempty"`
+	// ExternalAccountRequired indicates that new accounts require an external
+	// account binding with one of the keys of the provisioner.
+	ExternalAccountRequired bool `json:"externalAccountRequired,omitempty"`
+}
+
+// Validate validates the directory metadata.
+func (m *ACMEDirectoryMeta) Validate() error {
+	if m == nil {
+		return nil
+	}
+	for name, value := range map[string]string{
+		"termsOfService": m.TermsOfService,
+		"website":        m.Website,
+	} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || !u.IsAbs() || u.Host == "" {
+			return errors.Errorf("meta.%s '%s' is not a valid URL", name, value)
+		}
+	}
+	for _, id := range m.CAAIdentities {
+		if id == "" || strings.ContainsAny(id, " /:") {
+			return errors.Errorf("meta.caaIdentities contains an invalid domain '%s'", id)
+		}
+	}
+	return nil
+}
+
+type acmeOrderKey struct{}
+
+// NewContextWithACMEOrder creates a new context from ctx and attaches the ACME
+// order being finalized.
+func NewContextWithACMEOrder(ctx context.Context, o *ACMEOrder) context.Context {
+	return context.WithValue(ctx, acmeOrderKey{}, o)
+}
+
+// ACMEOrderFromContext returns the ACME order saved in ctx.
+func ACMEOrderFromContext(ctx context.Context) (*ACMEOrder, bool) {
+	o, ok := ctx.Value(acmeOrderKey{}).(*ACMEOrder)
+	return o, ok && o != nil
+}
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
 	*base
-	ID      string   `json:"-"`
-	Type    string   `json:"type"`
-	Name    string   `json:"name"`
-	ForceCN bool     `json:"forceCN,omitempty"`
-	Claims  *Claims  `json:"claims,omitempty"`
-	Options *Options `json:"options,omitempty"`
-	claimer *Claimer
+	ID                           string                        `json:"-"`
+	Type                         string                        `json:"type"`
+	Name                         string                        `json:"name"`
+	ForceCN                      bool                          `json:"forceCN,omitempty"`
+	RequireAccountKeyAttestation bool                          `json:"requireAccountKeyAttestation,omitempty"`
+	AccountKeyAttestationFormats []string                      `json:"accountKeyAttestationFormats,omitempty"`
+	RevokeReplacedCertificates   bool                          `json:"revokeReplacedCertificates,omitempty"`
+	AllowEABRebinding            bool                          `json:"allowEABRebinding,omitempty"`
+	DNSAssist                    *ACMEDNSAssistOptions         `json:"dnsAssist,omitempty"`
+	ClientCertificate            *ACMEClientCertificateOptions `json:"clientCertificate,omitempty"`
+	Meta                         *ACMEDirectoryMeta            `json:"meta,omitempty"`
+	Claims                       *Claims                       `json:"claims,omitempty"`
+	Options                      *Options                      `json:"options,omitempty"`
+	claimer                      *Claimer
+	clock                        Clock
+	identityResolver             IdentityResolver
+	dnsUpdater                   dnsupdate.Updater
+	isRevoked                    IsRevokedFunc
 }
 
 // GetID returns the provisioner unique identifier.
@@ -67,6 +287,108 @@ func (p *ACME) DefaultTLSCertDuration() time.Duration {
 	return p.claimer.DefaultTLSCertDuration()
 }
 
+// ShouldRevokeReplacedCertificates returns true if the certificate in the
+// replaces field of an order must be revoked once the new one is issued.
+func (p *ACME) ShouldRevokeReplacedCertificates() bool {
+	return p.RevokeReplacedCertificates
+}
+
+// GetDNSUpdater returns the updater used to create the TXT record of the
+// dns-01 challenge of the given account and domain. It returns nil if the
+// assisted dns-01 mode is not enabled for them.
+func (p *ACME) GetDNSUpdater(accountID, domain string) dnsupdate.Updater {
+	if p.dnsUpdater == nil || !p.DNSAssist.isTrusted(accountID, domain) {
+		return nil
+	}
+	return p.dnsUpdater
+}
+
+// IsEABRebindingAllowed returns true if a new account can be bound to an
+// external account binding key already bound to another account. The new
+// account replaces the old one, which is deactivated, and it inherits its
+// valid authorizations. This allows a client that lost its account key to
+// recover its account.
+func (p *ACME) IsEABRebindingAllowed() bool {
+	return p.AllowEABRebinding
+}
+
+// IsAccountKeyAttestationRequired returns true if new accounts must present
+// an attestation of the account key.
+func (p *ACME) IsAccountKeyAttestationRequired() bool {
+	return p.RequireAccountKeyAttestation
+}
+
+// IsAccountKeyAttestationFormatAllowed returns true if the given account key
+// attestation format is accepted. All the supported formats are accepted if
+// none is configured.
+func (p *ACME) IsAccountKeyAttestationFormatAllowed(format string) bool {
+	if len(p.AccountKeyAttestationFormats) == 0 {
+		return format == keyattest.FormatYubiKey || format == keyattest.FormatTPM
+	}
+	for _, f := range p.AccountKeyAttestationFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDirectoryMeta returns the metadata published in the ACME directory, or
+// nil if it is not configured.
+func (p *ACME) GetDirectoryMeta() *ACMEDirectoryMeta {
+	return p.Meta
+}
+
+// IsClientCertificateRequired returns true if the ACME requests must present a
+// client certificate issued by the CA.
+func (p *ACME) IsClientCertificateRequired() bool {
+	return p.ClientCertificate != nil
+}
+
+// VerifyClientCertificate verifies the client certificate presented in the
+// given TLS connection and returns the identity an ACME account is bound to.
+// The certificate chain must have been verified with the roots of the CA in
+// the TLS handshake, and the certificate must not have been revoked.
+func (p *ACME) VerifyClientCertificate(cs *tls.ConnectionState) (*ACMEAccountClientCertificate, error) {
+	switch {
+	case cs == nil || len(cs.PeerCertificates) == 0:
+		return nil, errors.New("client certificate is required")
+	case len(cs.VerifiedChains) == 0:
+		return nil, errors.New("client certificate is not trusted")
+	}
+
+	cert := cs.PeerCertificates[0]
+	if p.isRevoked != nil {
+		isRevoked, err := p.isRevoked(cert.SerialNumber.String())
+		switch {
+		case err != nil:
+			return nil, errors.Wrap(err, "error checking client certificate revocation")
+		case isRevoked:
+			return nil, errors.New("client certificate has been revoked")
+		}
+	}
+	if p.ClientCertificate != nil {
+		name, _ := GetProvisionerName(cert.Extensions)
+		if !p.ClientCertificate.isProvisionerAllowed(name) {
+			return nil, errors.New("client certificate was not issued by an allowed provisioner")
+		}
+	}
+
+	identity := clientCertificateIdentity(cert)
+	if identity == "" {
+		return nil, errors.New("client certificate does not have a subject or SANs")
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	return &ACMEAccountClientCertificate{
+		Identity:     identity,
+		Subject:      cert.Subject.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		Fingerprint:  hex.EncodeToString(sum[:]),
+		BoundAt:      clockNow(p.clock),
+	}, nil
+}
+
 // Init initializes and validates the fields of a JWK type.
 func (p *ACME) Init(config Config) (err error) {
 	switch {
@@ -76,10 +398,40 @@ func (p *ACME) Init(config Config) (err error) {
 		return errors.New("provisioner name cannot be empty")
 	}
 
+	for _, f := range p.AccountKeyAttestationFormats {
+		switch f {
+		case keyattest.FormatYubiKey, keyattest.FormatTPM:
+		default:
+			return errors.Errorf("unsupported account key attestation format %q", f)
+		}
+	}
+
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.Meta.Validate(); err != nil {
+		return err
+	}
+
+	// Create the DNS updater used in the assisted dns-01 mode
+	if p.DNSAssist != nil {
+		if err := p.DNSAssist.Validate(); err != nil {
+			return err
+		}
+		if p.dnsUpdater, err = dnsupdate.New(context.Background(), p.DNSAssist.Options); err != nil {
+			return err
+		}
+	}
+
+	p.clock = config.Clock
 	// Update claims with global ones
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
+	p.isRevoked = config.IsRevokedFunc
 
 	return err
 }
@@ -87,16 +439,73 @@ func (p *ACME) Init(config Config) (err error) {
 // AuthorizeSign does not do any validation, because all validation is handled
 // in the ACME protocol. This method returns a list of modifiers / constraints
 // on the resulting certificate.
+//
+// If the context contains the ACME order being finalized, it also returns the
+// template options, the identity document and the SANs validator, like the
+// provisioners authorizing tokens.
 func (p *ACME) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	return []SignOption{
+	signOptions := []SignOption{
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeACME, p.Name, ""),
 		newForceCNOption(p.ForceCN),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
-	}, nil
+	}
+
+	order, ok := ACMEOrderFromContext(ctx)
+	if !ok {
+		return signOptions, nil
+	}
+
+	sans := make([]string, len(order.SANs))
+	for i, san := range order.SANs {
+		sans[i] = san.Value
+	}
+
+	// Certificate templates
+	data := x509util.NewTemplateData()
+	data.SetCommonName(order.CommonName)
+	data.Set(x509util.SANsKey, order.SANs)
+	data.Set(ACMEOrderDataKey, order)
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newACMEIdentityDocument(order, sans), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "acme.AuthorizeSign")
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "acme.AuthorizeSign")
+	}
+
+	return append([]SignOption{templateOptions, identity},
+		append(signOptions, defaultSANsValidator(sans))...), nil
+}
+
+// newACMEIdentityDocument returns the identity document of the account that
+// requested the given order.
+func newACMEIdentityDocument(order *ACMEOrder, sans []string) *IdentityDocument {
+	identifiers := make([]string, len(order.Identifiers))
+	for i, id := range order.Identifiers {
+		identifiers[i] = id.Type + ":" + id.Value
+	}
+	doc := &IdentityDocument{
+		Subject: order.AccountID,
+		Names:   sans,
+		Attributes: map[string]interface{}{
+			"accountID":   order.AccountID,
+			"orderID":     order.ID,
+			"identifiers": identifiers,
+		},
+	}
+	if order.AccountKeyAttestation != nil {
+		doc.Attributes["accountKeyAttestation"] = order.AccountKeyAttestation
+	}
+	if order.Account != nil && order.Account.ExternalAccountKeyID != "" {
+		doc.Attributes["externalAccountKeyID"] = order.Account.ExternalAccountKeyID
+	}
+	return doc
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -107,5 +516,5 @@ func (p *ACME) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("acme.AuthorizeRenew; renew is disabled for acme provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
@@ -2,14 +2,19 @@ package provisioner
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"net/http"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/dnsupdate"
 	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/x509util"
 )
 
 func TestACME_Getters(t *testing.T) {
@@ -64,11 +69,71 @@ func TestACME_Init(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail-bad-account-key-attestation-format": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", AccountKeyAttestationFormats: []string{"packed"}},
+				err: errors.New("unsupported account key attestation format \"packed\""),
+			}
+		},
+		"fail-dns-assist-accounts": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", DNSAssist: &ACMEDNSAssistOptions{Zones: []string{"internal"}}},
+				err: errors.New("dnsAssist requires at least one account"),
+			}
+		},
+		"fail-dns-assist-zones": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", DNSAssist: &ACMEDNSAssistOptions{Accounts: []string{"accID"}}},
+				err: errors.New("dnsAssist requires at least one zone"),
+			}
+		},
+		"fail-dns-assist-options": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", DNSAssist: &ACMEDNSAssistOptions{
+					Options:  dnsupdate.Options{Type: dnsupdate.RFC2136},
+					Accounts: []string{"accID"},
+					Zones:    []string{"internal"},
+				}},
+				err: errors.New("dns updater rfc2136 requires a server and a zone"),
+			}
+		},
+		"fail-meta-terms-of-service": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", Meta: &ACMEDirectoryMeta{TermsOfService: "terms.html"}},
+				err: errors.New("meta.termsOfService 'terms.html' is not a valid URL"),
+			}
+		},
+		"fail-meta-website": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", Meta: &ACMEDirectoryMeta{Website: "https://"}},
+				err: errors.New("meta.website 'https://' is not a valid URL"),
+			}
+		},
+		"fail-meta-caa-identities": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", Meta: &ACMEDirectoryMeta{CAAIdentities: []string{""}}},
+				err: errors.New("meta.caaIdentities contains an invalid domain ''"),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &ACME{Name: "foo", Type: "bar"},
 			}
 		},
+		"ok/meta": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", Meta: &ACMEDirectoryMeta{
+					TermsOfService: "https://ca.example.com/terms",
+					Website:        "https://ca.example.com",
+					CAAIdentities:  []string{"ca.example.com"},
+				}},
+			}
+		},
+		"ok/account-key-attestation": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", RequireAccountKeyAttestation: true, AccountKeyAttestationFormats: []string{"tpm"}},
+			}
+		},
 	}
 
 	config := Config{
@@ -140,26 +205,63 @@ func TestACME_AuthorizeRenew(t *testing.T) {
 }
 
 func TestACME_AuthorizeSign(t *testing.T) {
+	order := &ACMEOrder{
+		ID:        "orderID",
+		AccountID: "accountID",
+		Identifiers: []ACMEIdentifier{
+			{Type: "dns", Value: "foo.internal"},
+			{Type: "ip", Value: "10.0.0.1"},
+		},
+		CommonName: "foo.internal",
+		SANs: []x509util.SubjectAlternativeName{
+			{Type: x509util.DNSType, Value: "foo.internal"},
+			{Type: x509util.IPType, Value: "10.0.0.1"},
+		},
+	}
 	type test struct {
-		p     *ACME
-		token string
-		code  int
-		err   error
+		p       *ACME
+		ctx     context.Context
+		token   string
+		wantLen int
+		code    int
+		err     error
 	}
 	tests := map[string]func(*testing.T) test{
 		"ok": func(t *testing.T) test {
 			p, err := generateACME()
 			assert.FatalError(t, err)
 			return test{
-				p:     p,
-				token: "foo",
+				p:       p,
+				ctx:     context.Background(),
+				token:   "foo",
+				wantLen: 5,
+			}
+		},
+		"ok/order": func(t *testing.T) test {
+			p, err := generateACME()
+			assert.FatalError(t, err)
+			return test{
+				p:       p,
+				ctx:     NewContextWithACMEOrder(context.Background(), order),
+				wantLen: 8,
+			}
+		},
+		"fail/template": func(t *testing.T) test {
+			p, err := generateACME()
+			assert.FatalError(t, err)
+			p.Options = &Options{X509: &X509Options{TemplateData: []byte("fo{o")}}
+			return test{
+				p:    p,
+				ctx:  NewContextWithACMEOrder(context.Background(), order),
+				code: http.StatusInternalServerError,
+				err:  errors.New("acme.AuthorizeSign: error unmarshaling template data"),
 			}
 		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := tt(t)
-			if opts, err := tc.p.AuthorizeSign(context.Background(), tc.token); err != nil {
+			if opts, err := tc.p.AuthorizeSign(tc.ctx, tc.token); err != nil {
 				if assert.NotNil(t, tc.err) {
 					sc, ok := err.(errs.StatusCoder)
 					assert.Fatal(t, ok, "error does not implement StatusCoder interface")
@@ -168,9 +270,15 @@ func TestACME_AuthorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) && assert.NotNil(t, opts) {
-					assert.Len(t, 5, opts)
+					assert.Len(t, tc.wantLen, opts)
 					for _, o := range opts {
 						switch v := o.(type) {
+						case certificateOptionsFunc:
+						case *IdentityDocument:
+							assert.Equals(t, v.Provisioner, tc.p.GetName())
+							assert.Equals(t, v.Subject, "accountID")
+							assert.Equals(t, v.Names, []string{"foo.internal", "10.0.0.1"})
+							assert.Equals(t, v.Attributes["orderID"], "orderID")
 						case *provisionerExtensionOption:
 							assert.Equals(t, v.Type, int(TypeACME))
 							assert.Equals(t, v.Name, tc.p.GetName())
@@ -184,6 +292,8 @@ func TestACME_AuthorizeSign(t *testing.T) {
 						case *validityValidator:
 							assert.Equals(t, v.min, tc.p.claimer.MinTLSCertDuration())
 							assert.Equals(t, v.max, tc.p.claimer.MaxTLSCertDuration())
+						case defaultSANsValidator:
+							assert.Equals(t, []string(v), []string{"foo.internal", "10.0.0.1"})
 						default:
 							assert.FatalError(t, errors.Errorf("unexpected sign option of type %T", v))
 						}
@@ -193,3 +303,145 @@ func TestACME_AuthorizeSign(t *testing.T) {
 		})
 	}
 }
+
+func TestACME_IsAccountKeyAttestationFormatAllowed(t *testing.T) {
+	p := &ACME{}
+	assert.True(t, p.IsAccountKeyAttestationFormatAllowed("yubikey"))
+	assert.True(t, p.IsAccountKeyAttestationFormatAllowed("tpm"))
+	assert.False(t, p.IsAccountKeyAttestationFormatAllowed("packed"))
+
+	p.AccountKeyAttestationFormats = []string{"tpm"}
+	assert.False(t, p.IsAccountKeyAttestationFormatAllowed("yubikey"))
+	assert.True(t, p.IsAccountKeyAttestationFormatAllowed("tpm"))
+}
+
+type mockDNSUpdater struct{}
+
+func (m *mockDNSUpdater) AddTXT(ctx context.Context, name, value string) error    { return nil }
+func (m *mockDNSUpdater) RemoveTXT(ctx context.Context, name, value string) error { return nil }
+
+func TestACME_GetDNSUpdater(t *testing.T) {
+	updater := &mockDNSUpdater{}
+	p := &ACME{
+		DNSAssist: &ACMEDNSAssistOptions{
+			Accounts: []string{"accID"},
+			Zones:    []string{"corp.internal."},
+		},
+		dnsUpdater: updater,
+	}
+	tests := []struct {
+		name      string
+		accountID string
+		domain    string
+		want      dnsupdate.Updater
+	}{
+		{"ok", "accID", "www.corp.internal", updater},
+		{"ok wildcard", "accID", "*.corp.internal", updater},
+		{"fail account", "otherID", "www.corp.internal", nil},
+		{"fail zone", "accID", "www.example.com", nil},
+		{"fail suffix", "accID", "www.evilcorp.internal", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, p.GetDNSUpdater(tt.accountID, tt.domain))
+		})
+	}
+
+	assert.Nil(t, (&ACME{}).GetDNSUpdater("accID", "www.corp.internal"))
+}
+
+func Test_newACMEIdentityDocument(t *testing.T) {
+	order := &ACMEOrder{
+		ID:          "orderID",
+		AccountID:   "accountID",
+		Identifiers: []ACMEIdentifier{{Type: "dns", Value: "foo.internal"}},
+	}
+	doc := newACMEIdentityDocument(order, []string{"foo.internal"})
+	assert.Equals(t, "accountID", doc.Subject)
+	assert.Equals(t, []string{"dns:foo.internal"}, doc.Attributes["identifiers"])
+	_, ok := doc.Attributes["accountKeyAttestation"]
+	assert.False(t, ok)
+
+	order.AccountKeyAttestation = &ACMEAccountKeyAttestation{
+		Format:       "yubikey",
+		SerialNumber: "12345678",
+		VerifiedAt:   time.Now(),
+	}
+	doc = newACMEIdentityDocument(order, []string{"foo.internal"})
+	assert.Equals(t, order.AccountKeyAttestation, doc.Attributes["accountKeyAttestation"])
+}
+
+func TestACME_VerifyClientCertificate(t *testing.T) {
+	ext, err := createProvisionerExtension(int(TypeJWK), "devices", "kid")
+	assert.FatalError(t, err)
+	deviceCert := &x509.Certificate{
+		Raw:          []byte("device"),
+		Subject:      pkix.Name{CommonName: "device-1234"},
+		SerialNumber: big.NewInt(1234),
+		Extensions:   []pkix.Extension{ext},
+	}
+	sanCert := &x509.Certificate{
+		Raw:          []byte("san"),
+		SerialNumber: big.NewInt(5678),
+		DNSNames:     []string{"device.internal"},
+		Extensions:   []pkix.Extension{ext},
+	}
+	emptyCert := &x509.Certificate{
+		Raw:          []byte("empty"),
+		SerialNumber: big.NewInt(1),
+	}
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		opts         *ACMEClientCertificateOptions
+		cs           *tls.ConnectionState
+		wantIdentity string
+		wantErr      bool
+	}{
+		{"ok", &ACMEClientCertificateOptions{}, verified(deviceCert), "device-1234", false},
+		{"ok provisioner", &ACMEClientCertificateOptions{Provisioners: []string{"devices"}}, verified(deviceCert), "device-1234", false},
+		{"ok san", &ACMEClientCertificateOptions{}, verified(sanCert), "device.internal", false},
+		{"fail no tls", &ACMEClientCertificateOptions{}, nil, "", true},
+		{"fail no certificate", &ACMEClientCertificateOptions{}, &tls.ConnectionState{}, "", true},
+		{"fail not verified", &ACMEClientCertificateOptions{}, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{deviceCert}}, "", true},
+		{"fail provisioner", &ACMEClientCertificateOptions{Provisioners: []string{"other"}}, verified(deviceCert), "", true},
+		{"fail no identity", &ACMEClientCertificateOptions{}, verified(emptyCert), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{ClientCertificate: tt.opts}
+			assert.True(t, p.IsClientCertificateRequired())
+			got, err := p.VerifyClientCertificate(tt.cs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ACME.VerifyClientCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Equals(t, tt.wantIdentity, got.Identity)
+				assert.Equals(t, tt.cs.PeerCertificates[0].SerialNumber.String(), got.SerialNumber)
+				assert.Len(t, 64, got.Fingerprint)
+			}
+		})
+	}
+
+	// Revoked certificates are not accepted
+	p := &ACME{ClientCertificate: &ACMEClientCertificateOptions{}, isRevoked: func(sn string) (bool, error) {
+		assert.Equals(t, "1234", sn)
+		return true, nil
+	}}
+	_, err = p.VerifyClientCertificate(verified(deviceCert))
+	assert.Equals(t, "client certificate has been revoked", err.Error())
+	p.isRevoked = func(sn string) (bool, error) {
+		return false, errors.New("force")
+	}
+	_, err = p.VerifyClientCertificate(verified(deviceCert))
+	assert.Equals(t, "error checking client certificate revocation: force", err.Error())
+
+	assert.False(t, (&ACME{}).IsClientCertificateRequired())
+}
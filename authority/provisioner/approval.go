@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultApprovalExpiry is the time a sign request waits for a decision, and
+// the time an approval can be used, if the approval options do not set one.
+const DefaultApprovalExpiry = 24 * time.Hour
+
+// ApprovalOptions holds the sign requests of a provisioner until they are
+// approved using the admin API, like the approval of the cert-manager
+// CertificateRequests. The first request creates a pending request, and the
+// certificate is issued when the client retries the request after the
+// approval.
+type ApprovalOptions struct {
+	// Expiry is the time a pending request waits for a decision, and the time
+	// an approval can be used. It defaults to 24h.
+	Expiry *Duration `json:"expiry,omitempty"`
+	// AutoApprove is the list of names approved without the intervention of
+	// an administrator. A request is approved if the common name and all the
+	// SANs match one of the names, "*.example.com" matches any subdomain of
+	// example.com.
+	AutoApprove []string `json:"autoApprove,omitempty"`
+}
+
+// GetApproval returns the approval options.
+func (o *Options) GetApproval() *ApprovalOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Approval
+}
+
+// Validate validates the approval options. Nil options are valid.
+func (o *ApprovalOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Expiry != nil && o.Expiry.Value() <= 0 {
+		return errors.New("approval.expiry must be greater than 0")
+	}
+	for i, name := range o.AutoApprove {
+		switch {
+		case name == "":
+			return errors.Errorf("approval.autoApprove[%d] cannot be empty", i)
+		case strings.Contains(strings.TrimPrefix(name, "*."), "*"):
+			return errors.Errorf("approval.autoApprove[%d] %q is not valid, wildcards are only allowed as the first label", i, name)
+		}
+	}
+	return nil
+}
+
+// GetExpiry returns the time a request waits for a decision.
+func (o *ApprovalOptions) GetExpiry() time.Duration {
+	if d := o.Expiry.Value(); d > 0 {
+		return d
+	}
+	return DefaultApprovalExpiry
+}
+
+// IsAutoApproved returns true if all the given names match the names
+// approved automatically.
+func (o *ApprovalOptions) IsAutoApproved(names []string) bool {
+	if len(o.AutoApprove) == 0 || len(names) == 0 {
+		return false
+	}
+	for _, name := range names {
+		if !o.isAutoApprovedName(strings.ToLower(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *ApprovalOptions) isAutoApprovedName(name string) bool {
+	for _, pattern := range o.AutoApprove {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(name, pattern[1:]) && len(name) > len(pattern)-1 {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
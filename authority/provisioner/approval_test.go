@@ -0,0 +1,63 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApprovalOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *ApprovalOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &ApprovalOptions{}, false},
+		{"ok", &ApprovalOptions{Expiry: &Duration{Duration: time.Hour}, AutoApprove: []string{"*.internal", "example.com"}}, false},
+		{"fail expiry", &ApprovalOptions{Expiry: &Duration{Duration: -time.Hour}}, true},
+		{"fail empty name", &ApprovalOptions{AutoApprove: []string{""}}, true},
+		{"fail wildcard", &ApprovalOptions{AutoApprove: []string{"foo.*.internal"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ApprovalOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApprovalOptions_GetExpiry(t *testing.T) {
+	if got := (&ApprovalOptions{}).GetExpiry(); got != DefaultApprovalExpiry {
+		t.Errorf("ApprovalOptions.GetExpiry() = %v, want %v", got, DefaultApprovalExpiry)
+	}
+	if got := (&ApprovalOptions{Expiry: &Duration{Duration: time.Hour}}).GetExpiry(); got != time.Hour {
+		t.Errorf("ApprovalOptions.GetExpiry() = %v, want %v", got, time.Hour)
+	}
+}
+
+func TestApprovalOptions_IsAutoApproved(t *testing.T) {
+	options := &ApprovalOptions{AutoApprove: []string{"*.internal", "Example.com"}}
+	tests := []struct {
+		name    string
+		options *ApprovalOptions
+		names   []string
+		want    bool
+	}{
+		{"ok", options, []string{"foo.internal", "example.com"}, true},
+		{"ok subdomain", options, []string{"foo.bar.internal"}, true},
+		{"ok case", options, []string{"FOO.internal"}, true},
+		{"fail empty options", &ApprovalOptions{}, []string{"foo.internal"}, false},
+		{"fail no names", options, nil, false},
+		{"fail one name", options, []string{"foo.internal", "foo.example.com"}, false},
+		{"fail wildcard domain", options, []string{"internal"}, false},
+		{"fail empty label", options, []string{".internal"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.IsAutoApproved(tt.names); got != tt.want {
+				t.Errorf("ApprovalOptions.IsAutoApproved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
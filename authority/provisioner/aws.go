@@ -245,6 +245,10 @@ type awsInstanceIdentityDocument struct {
 // If InstanceAge is set, only the instances with a pendingTime within the given
 // period will be accepted.
 //
+// If StrictSSHPrincipals is true, the principals of the SSH host certificates,
+// including the ones set by templates, must be owned by the instance, see
+// InstancePrincipals.
+//
 // IIDRoots can be used to specify a path to the certificates used to verify the
 // identity certificate signature.
 //
@@ -258,12 +262,15 @@ type AWS struct {
 	Accounts               []string `json:"accounts"`
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	StrictSSHPrincipals    bool     `json:"strictSSHPrincipals,omitempty"`
 	IMDSVersions           []string `json:"imdsVersions"`
 	InstanceAge            Duration `json:"instanceAge,omitempty"`
 	IIDRoots               string   `json:"iidRoots,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	claimer                *Claimer
+	clock                  Clock
+	identityResolver       IdentityResolver
 	config                 *awsConfig
 	audiences              Audiences
 }
@@ -316,6 +323,11 @@ func (p *AWS) GetEncryptedKey() (kid string, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *AWS) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityToken retrieves the identity document and it's signature and
 // generates a token with them.
 func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
@@ -364,7 +376,7 @@ func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
 		return "", errors.Wrap(err, "error creating signer")
 	}
 
-	now := time.Now()
+	now := clockNow(p.clock)
 	payload := awsPayload{
 		Claims: jose.Claims{
 			Issuer:    awsIssuer,
@@ -399,10 +411,17 @@ func (p *AWS) Init(config Config) (err error) {
 	case p.InstanceAge.Value() < 0:
 		return errors.New("provisioner instanceAge cannot be negative")
 	}
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+	p.clock = config.Clock
+
 	// Update claims with global ones
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
 	// Add default config
 	if p.config, err = newAWSConfig(p.IIDRoots); err != nil {
 		return err
@@ -443,6 +462,10 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newAWSIdentityDocument(&doc), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
 
 	// Enforce known CN and default DNS and IP if configured.
 	// By default we'll accept the CN and SANs in the CSR.
@@ -468,16 +491,37 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 
 	return append(so,
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeAWS, p.Name, doc.AccountID, "InstanceID", doc.InstanceID),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		commonNameValidator(payload.Claims.Subject),
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
 	), nil
 }
 
+// newAWSIdentityDocument returns the identity document of the instance in the
+// given instance identity document.
+func newAWSIdentityDocument(doc *awsInstanceIdentityDocument) *IdentityDocument {
+	return &IdentityDocument{
+		Subject: doc.InstanceID,
+		Names: []string{
+			fmt.Sprintf("ip-%s.%s.compute.internal", strings.Replace(doc.PrivateIP, ".", "-", -1), doc.Region),
+			doc.PrivateIP,
+		},
+		Attributes: map[string]interface{}{
+			"accountID":        doc.AccountID,
+			"region":           doc.Region,
+			"availabilityZone": doc.AvailabilityZone,
+			"instanceType":     doc.InstanceType,
+			"imageID":          doc.ImageID,
+			"privateIP":        doc.PrivateIP,
+		},
+	}
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 // NOTE: This method does not actually validate the certificate or check it's
 // revocation status. Just confirms that the provisioner that created the
@@ -486,7 +530,7 @@ func (p *AWS) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("aws.AuthorizeRenew; renew is disabled for aws provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
 
 // assertConfig initializes the config if it has not been initialized
@@ -652,7 +696,7 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
 	// more than a few minutes.
-	now := time.Now().UTC()
+	now := clockNow(p.clock).UTC()
 	if err = payload.ValidateWithLeeway(jose.Expected{
 		Issuer: awsIssuer,
 		Time:   now,
@@ -722,6 +766,7 @@ func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		doc.PrivateIP,
 		fmt.Sprintf("ip-%s.%s.compute.internal", strings.Replace(doc.PrivateIP, ".", "-", -1), doc.Region),
 	}
+	instance := newAWSInstancePrincipals(&doc)
 
 	// Only enforce known principals if disable custom sans is true.
 	if p.DisableCustomSANs {
@@ -735,15 +780,25 @@ func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 
 	// Certificate templates.
 	data := sshutil.CreateTemplateData(sshutil.HostCert, doc.InstanceID, principals)
+	data.Set(InstancePrincipalsKey, instance)
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newAWSIdentityDocument(&doc), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
+	}
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
 	}
-	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, templateOptions, identity)
+
+	// Only allow the principals owned by the instance.
+	if p.StrictSSHPrincipals {
+		signOptions = append(signOptions, &sshInstancePrincipalsValidator{instance})
+	}
 
 	return append(signOptions,
 		// Validate user SignSSHOptions.
@@ -751,7 +806,7 @@ func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
 	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/sshutil"
@@ -79,6 +80,10 @@ type azurePayload struct {
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
 //
+// If StrictSSHPrincipals is true, the principals of the SSH host certificates,
+// including the ones set by templates, must be owned by the instance, see
+// InstancePrincipals.
+//
 // Microsoft Azure identity docs are available at
 // https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
 // and https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
@@ -92,9 +97,12 @@ type Azure struct {
 	Audience               string   `json:"audience,omitempty"`
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	StrictSSHPrincipals    bool     `json:"strictSSHPrincipals,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	claimer                *Claimer
+	clock                  Clock
+	identityResolver       IdentityResolver
 	config                 *azureConfig
 	oidcConfig             openIDConfiguration
 	keyStore               *keyStore
@@ -156,6 +164,11 @@ func (p *Azure) GetEncryptedKey() (kid string, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *Azure) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityToken retrieves from the metadata service the identity token and
 // returns it.
 func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
@@ -204,20 +217,35 @@ func (p *Azure) Init(config Config) (err error) {
 	// Initialize config
 	p.assertConfig()
 
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+
+	p.clock = config.Clock
 	// Update claims with global ones
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
 
 	// Decode and validate openid-configuration endpoint
-	if err := getAndDecode(p.config.oidcDiscoveryURL, &p.oidcConfig); err != nil {
+	b := breaker.New("azure "+p.Name, config.CircuitBreaker)
+	if err := b.Do(func() error {
+		return getAndDecode(p.config.oidcDiscoveryURL, &p.oidcConfig)
+	}); err != nil {
 		return err
 	}
 	if err := p.oidcConfig.Validate(); err != nil {
 		return errors.Wrapf(err, "error parsing %s", p.config.oidcDiscoveryURL)
 	}
-	// Get JWK key set
-	if p.keyStore, err = newKeyStore(p.oidcConfig.JWKSetURI); err != nil {
+	// Get JWK key set, the configuration and the keys are refreshed in the
+	// background.
+	if p.keyStore, err = startKeyStore(&keyStore{
+		uri:       p.oidcConfig.JWKSetURI,
+		configURI: p.config.oidcDiscoveryURL,
+		breaker:   b,
+	}); err != nil {
 		return err
 	}
 
@@ -250,7 +278,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, err
 	if err := claims.ValidateWithLeeway(jose.Expected{
 		Audience: []string{p.Audience},
 		Issuer:   p.oidcConfig.Issuer,
-		Time:     time.Now(),
+		Time:     clockNow(p.clock).UTC(),
 	}, 1*time.Minute); err != nil {
 		return nil, "", "", errs.Wrap(http.StatusUnauthorized, err, "azure.authorizeToken; failed to validate azure token payload")
 	}
@@ -271,7 +299,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, err
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	_, name, group, err := p.authorizeToken(token)
+	claims, name, group, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
 	}
@@ -296,6 +324,10 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newAzureIdentityDocument(claims), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
+	}
 
 	// Enforce known common name and default DNS if configured.
 	// By default we'll accept the CN and SANs in the CSR.
@@ -320,15 +352,33 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 
 	return append(so,
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeAzure, p.Name, p.TenantID),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
 	), nil
 }
 
+// newAzureIdentityDocument returns the identity document of the virtual
+// machine in the given token. The xms_mirid claim must have been validated.
+func newAzureIdentityDocument(claims *azurePayload) *IdentityDocument {
+	re := azureXMSMirIDRegExp.FindStringSubmatch(claims.XMSMirID)
+	return &IdentityDocument{
+		Subject: claims.XMSMirID,
+		Names:   []string{re[3]},
+		Attributes: map[string]interface{}{
+			"tenantID":       claims.TenantID,
+			"subscriptionID": re[1],
+			"resourceGroup":  re[2],
+			"virtualMachine": re[3],
+			"objectID":       claims.ObjectID,
+		},
+	}
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 // NOTE: This method does not actually validate the certificate or check it's
 // revocation status. Just confirms that the provisioner that created the
@@ -337,7 +387,7 @@ func (p *Azure) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("azure.AuthorizeRenew; renew is disabled for azure provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
@@ -346,7 +396,7 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
 	}
 
-	_, name, _, err := p.authorizeToken(token)
+	claims, name, _, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
@@ -360,6 +410,7 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 
 	// Validated principals.
 	principals := []string{name}
+	instance := newAzureInstancePrincipals(name)
 
 	// Only enforce known principals if disable custom sans is true.
 	if p.DisableCustomSANs {
@@ -373,15 +424,25 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 
 	// Certificate templates.
 	data := sshutil.CreateTemplateData(sshutil.HostCert, name, principals)
+	data.Set(InstancePrincipalsKey, instance)
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newAzureIdentityDocument(claims), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
+	}
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
-	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, templateOptions, identity)
+
+	// Only allow the principals owned by the instance.
+	if p.StrictSSHPrincipals {
+		signOptions = append(signOptions, &sshInstancePrincipalsValidator{instance})
+	}
 
 	return append(signOptions,
 		// Validate user SignSSHOptions.
@@ -389,7 +450,7 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
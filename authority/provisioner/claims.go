@@ -1,19 +1,23 @@
 package provisioner
 
 import (
+	"crypto/x509"
+	"net/http"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
 	"golang.org/x/crypto/ssh"
 )
 
 // Claims so that individual provisioners can override global claims.
 type Claims struct {
 	// TLS CA properties
-	MinTLSDur      *Duration `json:"minTLSCertDuration,omitempty"`
-	MaxTLSDur      *Duration `json:"maxTLSCertDuration,omitempty"`
-	DefaultTLSDur  *Duration `json:"defaultTLSCertDuration,omitempty"`
-	DisableRenewal *bool     `json:"disableRenewal,omitempty"`
+	MinTLSDur          *Duration `json:"minTLSCertDuration,omitempty"`
+	MaxTLSDur          *Duration `json:"maxTLSCertDuration,omitempty"`
+	DefaultTLSDur      *Duration `json:"defaultTLSCertDuration,omitempty"`
+	DisableRenewal     *bool     `json:"disableRenewal,omitempty"`
+	MinRenewalFraction *float64  `json:"minRenewalFraction,omitempty"`
 	// SSH CA properties
 	MinUserSSHDur     *Duration `json:"minUserSSHCertDuration,omitempty"`
 	MaxUserSSHDur     *Duration `json:"maxUserSSHCertDuration,omitempty"`
@@ -40,19 +44,21 @@ func NewClaimer(claims *Claims, global Claims) (*Claimer, error) {
 // Claims returns the merge of the inner and global claims.
 func (c *Claimer) Claims() Claims {
 	disableRenewal := c.IsDisableRenewal()
+	minRenewalFraction := c.MinRenewalFraction()
 	enableSSHCA := c.IsSSHCAEnabled()
 	return Claims{
-		MinTLSDur:         &Duration{c.MinTLSCertDuration()},
-		MaxTLSDur:         &Duration{c.MaxTLSCertDuration()},
-		DefaultTLSDur:     &Duration{c.DefaultTLSCertDuration()},
-		DisableRenewal:    &disableRenewal,
-		MinUserSSHDur:     &Duration{c.MinUserSSHCertDuration()},
-		MaxUserSSHDur:     &Duration{c.MaxUserSSHCertDuration()},
-		DefaultUserSSHDur: &Duration{c.DefaultUserSSHCertDuration()},
-		MinHostSSHDur:     &Duration{c.MinHostSSHCertDuration()},
-		MaxHostSSHDur:     &Duration{c.MaxHostSSHCertDuration()},
-		DefaultHostSSHDur: &Duration{c.DefaultHostSSHCertDuration()},
-		EnableSSHCA:       &enableSSHCA,
+		MinTLSDur:          &Duration{c.MinTLSCertDuration()},
+		MaxTLSDur:          &Duration{c.MaxTLSCertDuration()},
+		DefaultTLSDur:      &Duration{c.DefaultTLSCertDuration()},
+		DisableRenewal:     &disableRenewal,
+		MinRenewalFraction: &minRenewalFraction,
+		MinUserSSHDur:      &Duration{c.MinUserSSHCertDuration()},
+		MaxUserSSHDur:      &Duration{c.MaxUserSSHCertDuration()},
+		DefaultUserSSHDur:  &Duration{c.DefaultUserSSHCertDuration()},
+		MinHostSSHDur:      &Duration{c.MinHostSSHCertDuration()},
+		MaxHostSSHDur:      &Duration{c.MaxHostSSHCertDuration()},
+		DefaultHostSSHDur:  &Duration{c.DefaultHostSSHCertDuration()},
+		EnableSSHCA:        &enableSSHCA,
 	}
 }
 
@@ -102,6 +108,40 @@ func (c *Claimer) IsDisableRenewal() bool {
 	return *c.claims.DisableRenewal
 }
 
+// MinRenewalFraction returns the fraction of the lifetime of a certificate
+// that must elapse before it can be renewed. If the property is not set within
+// the provisioner, then the global value from the authority configuration will
+// be used, and if it's not set either, certificates can be renewed at any time.
+func (c *Claimer) MinRenewalFraction() float64 {
+	if c.claims == nil || c.claims.MinRenewalFraction == nil {
+		if c.global.MinRenewalFraction == nil {
+			return 0
+		}
+		return *c.global.MinRenewalFraction
+	}
+	return *c.claims.MinRenewalFraction
+}
+
+// authorizeRenewalWindow returns an error if the minimum fraction of the
+// lifetime of the certificate has not elapsed yet. The error tells the client
+// when it can renew the certificate.
+func (c *Claimer) authorizeRenewalWindow(cert *x509.Certificate, now time.Time) error {
+	fraction := c.MinRenewalFraction()
+	if fraction <= 0 {
+		return nil
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	renewAfter := cert.NotBefore.Add(time.Duration(float64(lifetime) * fraction))
+	if now.Before(renewAfter) {
+		return errs.NewErr(http.StatusTooManyRequests,
+			errors.Errorf("certificate cannot be renewed before %s", renewAfter.UTC().Format(time.RFC3339)),
+			errs.WithMessage("The certificate cannot be renewed yet, it can be renewed after %s.", renewAfter.UTC().Format(time.RFC3339)),
+			errs.WithCode(errs.CodeRenewalTooEarly),
+			errs.WithRetryAfter(renewAfter.Sub(now)))
+	}
+	return nil
+}
+
 // DefaultSSHCertDuration returns the default SSH certificate duration for the
 // given certificate type.
 func (c *Claimer) DefaultSSHCertDuration(certType uint32) (time.Duration, error) {
@@ -205,6 +245,7 @@ func (c *Claimer) Validate() error {
 		min = c.MinTLSCertDuration()
 		max = c.MaxTLSCertDuration()
 		def = c.DefaultTLSCertDuration()
+		frc = c.MinRenewalFraction()
 	)
 	switch {
 	case min <= 0:
@@ -220,6 +261,8 @@ func (c *Claimer) Validate() error {
 		return errors.Errorf("claims: DefaultCertDuration cannot be less than MinCertDuration: DefaultCertDuration - %v, MinCertDuration - %v", def, min)
 	case max < def:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", max, def)
+	case frc < 0 || frc >= 1:
+		return errors.Errorf("claims: MinRenewalFraction must be greater than or equal to 0 and less than 1: MinRenewalFraction - %v", frc)
 	default:
 		return nil
 	}
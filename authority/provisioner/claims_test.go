@@ -1,9 +1,12 @@
 package provisioner
 
 import (
+	"crypto/x509"
+	"net/http"
 	"testing"
 	"time"
 
+	"github.com/smallstep/certificates/errs"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -49,3 +52,59 @@ func TestClaimer_DefaultSSHCertDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestClaimer_authorizeRenewalWindow(t *testing.T) {
+	now := time.Now()
+	half := 0.5
+	cert := &x509.Certificate{
+		NotBefore: now.Add(-1 * time.Hour),
+		NotAfter:  now.Add(3 * time.Hour),
+	}
+	tests := []struct {
+		name           string
+		claims         *Claims
+		cert           *x509.Certificate
+		wantErr        bool
+		wantRetryAfter time.Duration
+	}{
+		{"ok disabled", nil, cert, false, 0},
+		{"ok elapsed", &Claims{MinRenewalFraction: &half}, &x509.Certificate{
+			NotBefore: now.Add(-3 * time.Hour),
+			NotAfter:  now.Add(1 * time.Hour),
+		}, false, 0},
+		{"fail too early", &Claims{MinRenewalFraction: &half}, cert, true, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClaimer(tt.claims, globalProvisionerClaims)
+			if err != nil {
+				t.Fatalf("NewClaimer() error = %v", err)
+			}
+			err = c.authorizeRenewalWindow(tt.cert, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Claimer.authorizeRenewalWindow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				e, ok := err.(*errs.Error)
+				if !ok {
+					t.Fatalf("Claimer.authorizeRenewalWindow() error type = %T, want *errs.Error", err)
+				}
+				if e.StatusCode() != http.StatusTooManyRequests {
+					t.Errorf("Claimer.authorizeRenewalWindow() status = %d, want %d", e.StatusCode(), http.StatusTooManyRequests)
+				}
+				if e.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("Claimer.authorizeRenewalWindow() retryAfter = %v, want %v", e.RetryAfter, tt.wantRetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestNewClaimer_minRenewalFraction(t *testing.T) {
+	for _, f := range []float64{-0.1, 1, 1.5} {
+		fraction := f
+		if _, err := NewClaimer(&Claims{MinRenewalFraction: &fraction}, globalProvisionerClaims); err == nil {
+			t.Errorf("NewClaimer() with MinRenewalFraction %v error = nil, want error", f)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time used to validate tokens and to
+// set the validity of certificates. The authority passes its clock to the
+// provisioners in the Config, so integration tests can control the issuance
+// and expiration of certificates.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock that returns the current local time.
+type SystemClock struct{}
+
+// Now returns the current local time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// UTCClock is a Clock that returns the time of another clock in UTC rounded
+// to seconds, the precision of the times stored by the ACME and admin
+// databases. The zero value uses the system clock.
+type UTCClock struct {
+	Clock Clock
+}
+
+// Now returns the UTC time rounded to seconds.
+func (c UTCClock) Now() time.Time {
+	return clockNow(c.Clock).UTC().Truncate(time.Second)
+}
+
+// clockNow returns the current time of the given clock, or the current local
+// time if it is nil.
+func clockNow(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// FakeClock is a Clock that returns a fixed time that only changes with Set
+// and Add. It is safe for concurrent use.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+// Now returns the time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Set sets the time of the clock.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.t = t
+	c.mu.Unlock()
+}
+
+// Add moves the clock forward by the given duration, and returns the new
+// time.
+func (c *FakeClock) Add(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	return c.t
+}
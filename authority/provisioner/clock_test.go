@@ -0,0 +1,48 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewFakeClock(t0)
+
+	if got := clk.Now(); !got.Equal(t0) {
+		t.Errorf("FakeClock.Now() = %v, want %v", got, t0)
+	}
+	if got := clk.Add(time.Hour); !got.Equal(t0.Add(time.Hour)) {
+		t.Errorf("FakeClock.Add() = %v, want %v", got, t0.Add(time.Hour))
+	}
+	if got := clk.Now(); !got.Equal(t0.Add(time.Hour)) {
+		t.Errorf("FakeClock.Now() = %v, want %v", got, t0.Add(time.Hour))
+	}
+	clk.Set(t0)
+	if got := clk.Now(); !got.Equal(t0) {
+		t.Errorf("FakeClock.Now() = %v, want %v", got, t0)
+	}
+}
+
+func TestUTCClock(t *testing.T) {
+	loc := time.FixedZone("UTC-8", -8*60*60)
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 999, loc)
+	if got := (UTCClock{Clock: NewFakeClock(t0)}).Now(); got != time.Date(2021, 1, 1, 8, 0, 0, 0, time.UTC) {
+		t.Errorf("UTCClock.Now() = %v, want %v", got, t0.UTC().Truncate(time.Second))
+	}
+
+	// The zero value is the system clock
+	if got := (UTCClock{}).Now(); time.Since(got) > time.Minute || got.Location() != time.UTC {
+		t.Errorf("UTCClock.Now() = %v, want the current time", got)
+	}
+}
+
+func TestSignOptions_now(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := (SignOptions{Clock: NewFakeClock(t0)}).now(); !got.Equal(t0) {
+		t.Errorf("SignOptions.now() = %v, want %v", got, t0)
+	}
+	if got := (SignOptions{}).now(); time.Since(got) > time.Minute {
+		t.Errorf("SignOptions.now() = %v, want the current time", got)
+	}
+}
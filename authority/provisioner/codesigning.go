@@ -0,0 +1,64 @@
+package provisioner
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/keyattest"
+)
+
+// CodeSigningTemplate is the default template used by provisioners with the
+// code signing profile enabled.
+const CodeSigningTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["codeSigning"]
+}`
+
+// CodeSigningOptions enables the code signing profile in a provisioner. With
+// the profile enabled, certificates are issued only for keys generated in a
+// hardware device and, optionally, after an administrator approves the key.
+type CodeSigningOptions struct {
+	// AttestationFormats is the list of key attestation formats accepted, the
+	// supported values are "yubikey" and "tpm". If empty, all of them are
+	// accepted.
+	AttestationFormats []string `json:"attestationFormats,omitempty"`
+	// RequireApproval holds the requests until an administrator approves the
+	// attested key.
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// GetCodeSigning returns the code signing options.
+func (o *Options) GetCodeSigning() *CodeSigningOptions {
+	if o == nil {
+		return nil
+	}
+	return o.CodeSigning
+}
+
+// Validate validates the code signing options. Nil options are valid.
+func (o *CodeSigningOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, f := range o.AttestationFormats {
+		switch f {
+		case keyattest.FormatYubiKey, keyattest.FormatTPM:
+		default:
+			return errors.Errorf("unsupported attestation format %q", f)
+		}
+	}
+	return nil
+}
+
+// IsFormatAllowed returns true if the given key attestation format is
+// accepted.
+func (o *CodeSigningOptions) IsFormatAllowed(format string) bool {
+	if len(o.AttestationFormats) == 0 {
+		return format == keyattest.FormatYubiKey || format == keyattest.FormatTPM
+	}
+	for _, f := range o.AttestationFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package provisioner
+
+import (
+	"testing"
+)
+
+func TestCodeSigningOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *CodeSigningOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &CodeSigningOptions{}, false},
+		{"ok", &CodeSigningOptions{AttestationFormats: []string{"yubikey", "tpm"}, RequireApproval: true}, false},
+		{"fail attestationFormats", &CodeSigningOptions{AttestationFormats: []string{"packed"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CodeSigningOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCodeSigningOptions_IsFormatAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *CodeSigningOptions
+		format  string
+		want    bool
+	}{
+		{"ok yubikey", &CodeSigningOptions{}, "yubikey", true},
+		{"ok tpm", &CodeSigningOptions{}, "tpm", true},
+		{"ok allowed", &CodeSigningOptions{AttestationFormats: []string{"tpm"}}, "tpm", true},
+		{"fail unknown", &CodeSigningOptions{}, "packed", false},
+		{"fail not allowed", &CodeSigningOptions{AttestationFormats: []string{"tpm"}}, "yubikey", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.IsFormatAllowed(tt.format); got != tt.want {
+				t.Errorf("CodeSigningOptions.IsFormatAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_GetCodeSigning(t *testing.T) {
+	var o *Options
+	if o.GetCodeSigning() != nil {
+		t.Error("Options.GetCodeSigning() = not nil, want nil")
+	}
+	cs := &CodeSigningOptions{RequireApproval: true}
+	o = &Options{CodeSigning: cs}
+	if got := o.GetCodeSigning(); got != cs {
+		t.Errorf("Options.GetCodeSigning() = %v, want %v", got, cs)
+	}
+	if err := (&Options{CodeSigning: &CodeSigningOptions{AttestationFormats: []string{"foo"}}}).Validate(); err == nil {
+		t.Error("Options.Validate() error = nil, want error")
+	}
+}
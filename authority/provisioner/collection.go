@@ -7,10 +7,12 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net/url"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/smallstep/certificates/authority/admin"
 	"go.step.sm/crypto/jose"
@@ -25,6 +27,7 @@ const DefaultProvisionersMax = 100
 type uidProvisioner struct {
 	provisioner Interface
 	uid         string
+	index       uint32
 }
 
 type provisionerSlice []uidProvisioner
@@ -33,67 +36,121 @@ func (p provisionerSlice) Len() int           { return len(p) }
 func (p provisionerSlice) Less(i, j int) bool { return p[i].uid < p[j].uid }
 func (p provisionerSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-// loadByTokenPayload is a payload used to extract the id used to load the
-// provisioner.
-type loadByTokenPayload struct {
+// TokenClaims are the claims used to load the provisioner of a token.
+type TokenClaims struct {
 	jose.Claims
 	Email           string `json:"email"` // OIDC email
 	AuthorizedParty string `json:"azp"`   // OIDC client id
 	TenantID        string `json:"tid"`   // Microsoft Azure tenant id
 }
 
-// Collection is a memory map of provisioners.
+// Collection is a memory map of provisioners. Lookups use an immutable index
+// that is rebuilt every time the provisioners change, so they never block.
 type Collection struct {
-	byID      *sync.Map
-	byKey     *sync.Map
-	byName    *sync.Map
-	byTokenID *sync.Map
+	mu        sync.Mutex
+	index     atomic.Value
+	nextIndex uint32
+	// audienceIndex contains the audiences of the collection without the
+	// port. The value is true if the audience is not a valid URL, those
+	// audiences match the tokens with any fragment.
+	audienceIndex map[string]bool
+}
+
+// collectionIndex is an immutable snapshot of the provisioners in a
+// collection.
+type collectionIndex struct {
+	byID      map[string]Interface
+	byKey     map[string]Interface
+	byName    map[string]Interface
+	byTokenID map[string]Interface
 	sorted    provisionerSlice
-	audiences Audiences
 }
 
 // NewCollection initializes a collection of provisioners. The given list of
 // audiences are the audiences used by the JWT provisioner.
 func NewCollection(audiences Audiences) *Collection {
-	return &Collection{
-		byID:      new(sync.Map),
-		byKey:     new(sync.Map),
-		byName:    new(sync.Map),
-		byTokenID: new(sync.Map),
-		audiences: audiences,
+	all := audiences.All()
+	audienceIndex := make(map[string]bool, len(all))
+	for _, aud := range all {
+		key, _, ok := audienceKey(aud)
+		audienceIndex[key] = !ok
 	}
+	c := &Collection{
+		audienceIndex: audienceIndex,
+	}
+	c.index.Store(new(collectionIndex))
+	return c
+}
+
+// getIndex returns the current snapshot of the provisioners.
+func (c *Collection) getIndex() *collectionIndex {
+	if idx, ok := c.index.Load().(*collectionIndex); ok {
+		return idx
+	}
+	return new(collectionIndex)
+}
+
+// update applies fn to a copy of the current index and replaces the index if
+// fn succeeds. Updates are serialized, and lookups keep using the previous
+// index until the new one is ready. Every update copies the index, so bulk
+// changes must be applied in a single update.
+func (c *Collection) update(fn func(idx *collectionIndex) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx := c.getIndex().clone()
+	if err := fn(idx); err != nil {
+		return err
+	}
+	c.index.Store(idx)
+	return nil
 }
 
 // Load a provisioner by the ID.
 func (c *Collection) Load(id string) (Interface, bool) {
-	return loadProvisioner(c.byID, id)
+	p, ok := c.getIndex().byID[id]
+	return p, ok
 }
 
 // LoadByName a provisioner by name.
 func (c *Collection) LoadByName(name string) (Interface, bool) {
-	return loadProvisioner(c.byName, name)
+	p, ok := c.getIndex().byName[name]
+	return p, ok
 }
 
 // LoadByTokenID a provisioner by identifier found in token.
 // For different provisioner types this identifier may be found in in different
 // attributes of the token.
 func (c *Collection) LoadByTokenID(tokenProvisionerID string) (Interface, bool) {
-	return loadProvisioner(c.byTokenID, tokenProvisionerID)
+	p, ok := c.getIndex().byTokenID[tokenProvisionerID]
+	return p, ok
 }
 
 // LoadByToken parses the token claims and loads the provisioner associated.
 func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims) (Interface, bool) {
-	var audiences []string
-	// Get all audiences with the given fragment
+	return c.loadByToken(token, claims, func() (*TokenClaims, bool) {
+		var payload TokenClaims
+		if err := token.UnsafeClaimsWithoutVerification(&payload); err != nil {
+			return nil, false
+		}
+		return &payload, true
+	})
+}
+
+// LoadByTokenClaims loads the provisioner associated with the token using the
+// given claims, so callers that have already parsed the token payload do not
+// parse it again.
+func (c *Collection) LoadByTokenClaims(token *jose.JSONWebToken, claims *TokenClaims) (Interface, bool) {
+	return c.loadByToken(token, &claims.Claims, func() (*TokenClaims, bool) {
+		return claims, true
+	})
+}
+
+func (c *Collection) loadByToken(token *jose.JSONWebToken, claims *jose.Claims, getPayload func() (*TokenClaims, bool)) (Interface, bool) {
+	// Get the fragment of the audiences
 	fragment := extractFragment(claims.Audience)
-	if fragment == "" {
-		audiences = c.audiences.All()
-	} else {
-		audiences = c.audiences.WithFragment(fragment).All()
-	}
 
 	// match with server audiences
-	if matchesAudience(claims.Audience, audiences) {
+	if c.matchesServerAudience(claims.Audience, fragment) {
 		// Use fragment to get provisioner name (GCP, AWS, SSHPOP)
 		if fragment != "" {
 			return c.LoadByTokenID(fragment)
@@ -105,8 +162,8 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 	}
 
 	// The ID will be just the clientID stored in azp, aud or tid.
-	var payload loadByTokenPayload
-	if err := token.UnsafeClaimsWithoutVerification(&payload); err != nil {
+	payload, ok := getPayload()
+	if !ok {
 		return nil, false
 	}
 
@@ -148,6 +205,20 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 	return c.LoadByTokenID(payload.Audience[0])
 }
 
+// matchesServerAudience returns true if one of the token audiences is one of
+// the collection audiences with the given fragment. It is equivalent to
+// matching the audiences returned by Audiences.WithFragment, without
+// building them on every request.
+func (c *Collection) matchesServerAudience(audiences []string, fragment string) bool {
+	for _, aud := range audiences {
+		key, f, _ := audienceKey(aud)
+		if anyFragment, ok := c.audienceIndex[key]; ok && (anyFragment || f == fragment) {
+			return true
+		}
+	}
+	return false
+}
+
 // LoadByCertificate looks for the provisioner extension and extracts the
 // proper id to load the provisioner.
 func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool) {
@@ -167,120 +238,199 @@ func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool)
 }
 
 // LoadEncryptedKey returns an encrypted key by indexed by KeyID. At this moment
-// only JWK encrypted keys are indexed by KeyID.
+// only JWK encrypted keys are indexed by KeyID. The keys of hidden
+// provisioners are not returned, as they are only available to clients that
+// already have them.
 func (c *Collection) LoadEncryptedKey(keyID string) (string, bool) {
-	p, ok := loadProvisioner(c.byKey, keyID)
-	if !ok {
+	p, ok := c.getIndex().byKey[keyID]
+	if !ok || isHidden(p) {
 		return "", false
 	}
 	_, key, ok := p.GetEncryptedKey()
 	return key, ok
 }
 
-// Store adds a provisioner to the collection and enforces the uniqueness of
-// provisioner IDs.
-func (c *Collection) Store(p Interface) error {
+// Store adds the given provisioners to the collection and enforces the
+// uniqueness of provisioner IDs. All the provisioners are added to a single
+// copy of the index, so the initial list of provisioners should be stored in
+// one call. If one of the provisioners cannot be added, none of them is.
+func (c *Collection) Store(ps ...Interface) error {
+	return c.update(func(idx *collectionIndex) error {
+		next := c.nextIndex
+		for _, p := range ps {
+			if err := idx.store(p, next); err != nil {
+				return err
+			}
+			next++
+		}
+		c.nextIndex = next
+		return nil
+	})
+}
+
+// Remove deletes an provisioner from all associated collections and lists.
+func (c *Collection) Remove(id string) error {
+	return c.update(func(idx *collectionIndex) error {
+		_, err := idx.remove(id)
+		return err
+	})
+}
+
+// Update updates the given provisioner in all related lists and collections.
+func (c *Collection) Update(nu Interface) error {
+	return c.update(func(idx *collectionIndex) error {
+		old, ok := idx.byID[nu.GetID()]
+		if !ok {
+			return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", nu.GetID())
+		}
+
+		if old.GetName() != nu.GetName() {
+			if _, ok := idx.byName[nu.GetName()]; ok {
+				return admin.NewError(admin.ErrorBadRequestType,
+					"provisioner with name %s already exists", nu.GetName())
+			}
+		}
+		if old.GetIDForToken() != nu.GetIDForToken() {
+			if _, ok := idx.byTokenID[nu.GetIDForToken()]; ok {
+				return admin.NewError(admin.ErrorBadRequestType,
+					"provisioner with Token ID %s already exists", nu.GetIDForToken())
+			}
+		}
+
+		// Keep the position of the provisioner in the sorted list.
+		index, err := idx.remove(old.GetID())
+		if err != nil {
+			return err
+		}
+		return idx.store(nu, index)
+	})
+}
+
+// Close closes the provisioners holding external resources, like the process of
+// a plugin provisioner.
+func (c *Collection) Close() error {
+	var err error
+	for _, elem := range c.getIndex().sorted {
+		if closer, ok := elem.provisioner.(io.Closer); ok {
+			if e := closer.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// clone returns a copy of the index that can be modified.
+func (idx *collectionIndex) clone() *collectionIndex {
+	return &collectionIndex{
+		byID:      cloneProvisionerMap(idx.byID),
+		byKey:     cloneProvisionerMap(idx.byKey),
+		byName:    cloneProvisionerMap(idx.byName),
+		byTokenID: cloneProvisionerMap(idx.byTokenID),
+		sorted:    append(make(provisionerSlice, 0, len(idx.sorted)+1), idx.sorted...),
+	}
+}
+
+// store adds a provisioner to the index in the given position of the sorted
+// list.
+func (idx *collectionIndex) store(p Interface, index uint32) error {
 	// Store provisioner always in byID. ID must be unique.
-	if _, loaded := c.byID.LoadOrStore(p.GetID(), p); loaded {
+	if _, ok := idx.byID[p.GetID()]; ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same id")
 	}
 	// Store provisioner always by name.
-	if _, loaded := c.byName.LoadOrStore(p.GetName(), p); loaded {
-		c.byID.Delete(p.GetID())
+	if _, ok := idx.byName[p.GetName()]; ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same name")
 	}
 	// Store provisioner always by ID presented in token.
-	if _, loaded := c.byTokenID.LoadOrStore(p.GetIDForToken(), p); loaded {
-		c.byID.Delete(p.GetID())
-		c.byName.Delete(p.GetName())
+	if _, ok := idx.byTokenID[p.GetIDForToken()]; ok {
 		return admin.NewError(admin.ErrorBadRequestType,
 			"cannot add multiple provisioners with the same token identifier")
 	}
+	idx.byID[p.GetID()] = p
+	idx.byName[p.GetName()] = p
+	idx.byTokenID[p.GetIDForToken()] = p
 
 	// Store provisioner in byKey if EncryptedKey is defined.
 	if kid, _, ok := p.GetEncryptedKey(); ok {
-		c.byKey.Store(kid, p)
+		idx.byKey[kid] = p
 	}
 
 	// Store sorted provisioners.
 	// Use the first 4 bytes (32bit) of the sum to insert the order
 	// Using big endian format to get the strings sorted:
 	// 0x00000000, 0x00000001, 0x00000002, ...
+	// The index is never reused, so the cursors of the pages are stable when
+	// provisioners are added or removed. New provisioners have the highest
+	// index, so they are appended without moving the rest of the list.
 	bi := make([]byte, 4)
 	sum := provisionerSum(p)
-	binary.BigEndian.PutUint32(bi, uint32(c.sorted.Len()))
+	binary.BigEndian.PutUint32(bi, index)
 	sum[0], sum[1], sum[2], sum[3] = bi[0], bi[1], bi[2], bi[3]
-	c.sorted = append(c.sorted, uidProvisioner{
+	elem := uidProvisioner{
 		provisioner: p,
 		uid:         hex.EncodeToString(sum),
-	})
-	sort.Sort(c.sorted)
+		index:       index,
+	}
+	i := sort.Search(len(idx.sorted), func(i int) bool { return idx.sorted[i].uid >= elem.uid })
+	idx.sorted = append(idx.sorted, uidProvisioner{})
+	copy(idx.sorted[i+1:], idx.sorted[i:])
+	idx.sorted[i] = elem
 	return nil
 }
 
-// Remove deletes an provisioner from all associated collections and lists.
-func (c *Collection) Remove(id string) error {
-	prov, ok := c.Load(id)
+// remove deletes a provisioner from the index and returns its position in the
+// sorted list.
+func (idx *collectionIndex) remove(id string) (uint32, error) {
+	prov, ok := idx.byID[id]
 	if !ok {
-		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", id)
+		return 0, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", id)
 	}
 
-	var found bool
-	for i, elem := range c.sorted {
+	var (
+		index uint32
+		found bool
+	)
+	for i, elem := range idx.sorted {
 		if elem.provisioner.GetID() == id {
-			// Remove index in sorted list
-			copy(c.sorted[i:], c.sorted[i+1:])           // Shift a[i+1:] left one index.
-			c.sorted[len(c.sorted)-1] = uidProvisioner{} // Erase last element (write zero value).
-			c.sorted = c.sorted[:len(c.sorted)-1]        // Truncate slice.
+			index = elem.index
+			idx.sorted = append(idx.sorted[:i], idx.sorted[i+1:]...)
 			found = true
 			break
 		}
 	}
 	if !found {
-		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found in sorted list", prov.GetName())
+		return 0, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found in sorted list", prov.GetName())
 	}
 
-	c.byID.Delete(id)
-	c.byName.Delete(prov.GetName())
-	c.byTokenID.Delete(prov.GetIDForToken())
+	delete(idx.byID, id)
+	delete(idx.byName, prov.GetName())
+	delete(idx.byTokenID, prov.GetIDForToken())
 	if kid, _, ok := prov.GetEncryptedKey(); ok {
-		c.byKey.Delete(kid)
+		delete(idx.byKey, kid)
 	}
-
-	return nil
+	return index, nil
 }
 
-// Update updates the given provisioner in all related lists and collections.
-func (c *Collection) Update(nu Interface) error {
-	old, ok := c.Load(nu.GetID())
-	if !ok {
-		return admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", nu.GetID())
+func cloneProvisionerMap(m map[string]Interface) map[string]Interface {
+	ret := make(map[string]Interface, len(m)+1)
+	for k, v := range m {
+		ret[k] = v
 	}
-
-	if old.GetName() != nu.GetName() {
-		if _, ok := c.LoadByName(nu.GetName()); ok {
-			return admin.NewError(admin.ErrorBadRequestType,
-				"provisioner with name %s already exists", nu.GetName())
-		}
-	}
-	if old.GetIDForToken() != nu.GetIDForToken() {
-		if _, ok := c.LoadByTokenID(nu.GetIDForToken()); ok {
-			return admin.NewError(admin.ErrorBadRequestType,
-				"provisioner with Token ID %s already exists", nu.GetIDForToken())
-		}
-	}
-
-	if err := c.Remove(old.GetID()); err != nil {
-		return err
-	}
-
-	return c.Store(nu)
+	return ret
 }
 
 // Find implements pagination on a list of sorted provisioners.
 func (c *Collection) Find(cursor string, limit int) (List, string) {
+	return c.FindWithFilter(cursor, limit, nil)
+}
+
+// FindWithFilter implements pagination on the list of sorted provisioners
+// that match the given filter. The cursor returned is the one of the next
+// provisioner that matches the filter. A nil filter matches all provisioners.
+func (c *Collection) FindWithFilter(cursor string, limit int, filter *Filter) (List, string) {
 	switch {
 	case limit <= 0:
 		limit = DefaultProvisionersLimit
@@ -288,31 +438,66 @@ func (c *Collection) Find(cursor string, limit int) (List, string) {
 		limit = DefaultProvisionersMax
 	}
 
-	n := c.sorted.Len()
+	sorted := c.getIndex().sorted
+	n := sorted.Len()
 	cursor = fmt.Sprintf("%040s", cursor)
-	i := sort.Search(n, func(i int) bool { return c.sorted[i].uid >= cursor })
+	i := sort.Search(n, func(i int) bool { return sorted[i].uid >= cursor })
 
 	slice := List{}
 	for ; i < n && len(slice) < limit; i++ {
-		slice = append(slice, c.sorted[i].provisioner)
+		if filter.Match(sorted[i].provisioner) {
+			slice = append(slice, sorted[i].provisioner)
+		}
 	}
 
-	if i < n {
-		return slice, strings.TrimLeft(c.sorted[i].uid, "0")
+	// Skip the provisioners that do not match to return the cursor of the
+	// next page.
+	for ; i < n; i++ {
+		if filter.Match(sorted[i].provisioner) {
+			return slice, strings.TrimLeft(sorted[i].uid, "0")
+		}
 	}
 	return slice, ""
 }
 
-func loadProvisioner(m *sync.Map, key string) (Interface, bool) {
-	i, ok := m.Load(key)
-	if !ok {
-		return nil, false
+// Filter selects the provisioners returned by FindWithFilter. The types and
+// names are case insensitive, and an empty list matches any value. If Public
+// is set, the provisioners with the hidden option are excluded.
+type Filter struct {
+	Types  []string
+	Names  []string
+	Public bool
+}
+
+// Match returns true if the provisioner matches the filter.
+func (f *Filter) Match(p Interface) bool {
+	if f == nil {
+		return true
 	}
-	p, ok := i.(Interface)
-	if !ok {
-		return nil, false
+	if f.Public && isHidden(p) {
+		return false
 	}
-	return p, true
+	return matchesAny(p.GetType().String(), f.Types) && matchesAny(p.GetName(), f.Names)
+}
+
+// isHidden returns true if the provisioner options have the hidden flag.
+func isHidden(p Interface) bool {
+	if op, ok := p.(interface{ GetOptions() *Options }); ok {
+		return op.GetOptions().IsHidden()
+	}
+	return false
+}
+
+func matchesAny(s string, values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
 }
 
 // provisionerSum returns the SHA1 of the provisioners ID. From this we will
@@ -349,6 +534,20 @@ func stripPort(rawurl string) string {
 	return u.String()
 }
 
+// audienceKey returns the given audience without the port and the fragment,
+// and the fragment. If the audience is not a valid URL, it returns the audience
+// as it is and false.
+func audienceKey(audience string) (string, string, bool) {
+	u, err := url.Parse(audience)
+	if err != nil {
+		return audience, "", false
+	}
+	fragment := u.Fragment
+	u.Host = u.Hostname()
+	u.Fragment = ""
+	return u.String(), fragment, true
+}
+
 // extractFragment extracts the first fragment of an audience url.
 func extractFragment(audience []string) string {
 	for _, s := range audience {
@@ -12,35 +12,34 @@ import (
 	"go.step.sm/crypto/jose"
 )
 
+func newTestCollection(t *testing.T, audiences Audiences, ps ...Interface) *Collection {
+	t.Helper()
+	c := NewCollection(audiences)
+	for _, p := range ps {
+		assert.FatalError(t, c.Store(p))
+	}
+	return c
+}
+
 func TestCollection_Load(t *testing.T) {
 	p, err := generateJWK()
 	assert.FatalError(t, err)
-	byID := new(sync.Map)
-	byID.Store(p.GetID(), p)
-	byID.Store("string", "a-string")
+	c := newTestCollection(t, testAudiences, p)
 
-	type fields struct {
-		byID *sync.Map
-	}
 	type args struct {
 		id string
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   Interface
-		want1  bool
+		name  string
+		args  args
+		want  Interface
+		want1 bool
 	}{
-		{"ok", fields{byID}, args{p.GetID()}, p, true},
-		{"fail", fields{byID}, args{"fail"}, nil, false},
-		{"invalid", fields{byID}, args{"string"}, nil, false},
+		{"ok", args{p.GetID()}, p, true},
+		{"fail", args{"fail"}, nil, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collection{
-				byID: tt.fields.byID,
-			}
 			got, got1 := c.Load(tt.args.id)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Collection.Load() got = %v, want %v", got, tt.want)
@@ -62,17 +61,9 @@ func TestCollection_LoadByToken(t *testing.T) {
 	p4, err := generateK8sSA(nil)
 	assert.FatalError(t, err)
 
-	byID := new(sync.Map)
-	byID.Store(p1.GetID(), p1)
-	byID.Store(p2.GetID(), p2)
-	byID.Store(p3.GetID(), p3)
-	byID.Store(p4.GetID(), p4)
-	byID.Store("string", "a-string")
-
-	byID2 := new(sync.Map)
-	byID2.Store(p1.GetID(), p1)
-	byID2.Store(p2.GetID(), p2)
-	byID2.Store(p3.GetID(), p3)
+	c1234 := newTestCollection(t, testAudiences, p1, p2, p3, p4)
+	c123 := newTestCollection(t, testAudiences, p1, p2, p3)
+	cFoo := newTestCollection(t, Audiences{Sign: []string{"https://foo"}}, p1, p2, p3, p4)
 
 	jwk, err := decryptJSONWebKey(p1.EncryptedKey)
 	assert.FatalError(t, err)
@@ -105,43 +96,87 @@ func TestCollection_LoadByToken(t *testing.T) {
 	t5, c5, err := parseToken(token)
 	assert.FatalError(t, err)
 
-	type fields struct {
-		byID      *sync.Map
-		audiences Audiences
-	}
 	type args struct {
 		token  *jose.JSONWebToken
 		claims *jose.Claims
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   Interface
-		want1  bool
+		name       string
+		collection *Collection
+		args       args
+		want       Interface
+		want1      bool
 	}{
-		{"ok1", fields{byID, testAudiences}, args{t1, c1}, p1, true},
-		{"ok2", fields{byID, testAudiences}, args{t2, c2}, p2, true},
-		{"ok3", fields{byID, testAudiences}, args{t3, c3}, p3, true},
-		{"ok4", fields{byID, testAudiences}, args{t5, c5}, p4, true},
-		{"bad", fields{byID, testAudiences}, args{t4, c4}, nil, false},
-		{"fail", fields{byID, Audiences{Sign: []string{"https://foo"}}}, args{t1, c1}, nil, false},
-		{"fail-no-k8sSa-provisioner", fields{byID2, testAudiences}, args{t5, c5}, nil, false},
+		{"ok1", c1234, args{t1, c1}, p1, true},
+		{"ok2", c1234, args{t2, c2}, p2, true},
+		{"ok3", c1234, args{t3, c3}, p3, true},
+		{"ok4", c1234, args{t5, c5}, p4, true},
+		{"bad", c1234, args{t4, c4}, nil, false},
+		{"fail", cFoo, args{t1, c1}, nil, false},
+		{"fail-no-k8sSa-provisioner", c123, args{t5, c5}, nil, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collection{
-				byID:      tt.fields.byID,
-				byTokenID: tt.fields.byID,
-				audiences: tt.fields.audiences,
-			}
-			got, got1 := c.LoadByToken(tt.args.token, tt.args.claims)
+			got, got1 := tt.collection.LoadByToken(tt.args.token, tt.args.claims)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Collection.LoadByToken() got = %v, want %v", got, tt.want)
 			}
 			if got1 != tt.want1 {
 				t.Errorf("Collection.LoadByToken() got1 = %v, want %v", got1, tt.want1)
 			}
+
+			// The parsed claims must load the same provisioner.
+			var claims TokenClaims
+			assert.FatalError(t, tt.args.token.UnsafeClaimsWithoutVerification(&claims))
+			got, got1 = tt.collection.LoadByTokenClaims(tt.args.token, &claims)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Collection.LoadByTokenClaims() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("Collection.LoadByTokenClaims() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestCollection_matchesServerAudience(t *testing.T) {
+	audiences := Audiences{
+		Sign:   []string{"https://ca.smallstep.com:9000/1.0/sign", "https://ca.smallstep.com/sign"},
+		Revoke: []string{"%invalid"},
+	}
+	c := NewCollection(audiences)
+	tests := []struct {
+		name      string
+		audiences []string
+		fragment  string
+		want      bool
+	}{
+		{"ok", []string{"https://ca.smallstep.com/1.0/sign"}, "", true},
+		{"ok port", []string{"https://ca.smallstep.com:443/sign"}, "", true},
+		{"ok fragment", []string{"foo", "https://ca.smallstep.com/1.0/sign#aws/foo"}, "aws/foo", true},
+		{"ok invalid", []string{"%invalid"}, "", true},
+		{"ok invalid fragment", []string{"%invalid", "https://ca.smallstep.com/sign#gcp/foo"}, "gcp/foo", true},
+		{"fail", []string{"https://ca.smallstep.com/1.0/renew"}, "", false},
+		{"fail fragment", []string{"https://ca.smallstep.com/1.0/sign#aws/foo"}, "", false},
+		{"fail missing fragment", []string{"https://ca.smallstep.com/1.0/sign"}, "aws/foo", false},
+		{"fail empty", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.matchesServerAudience(tt.audiences, tt.fragment); got != tt.want {
+				t.Errorf("Collection.matchesServerAudience() = %v, want %v", got, tt.want)
+			}
+			// It must be equivalent to matching the audiences with the
+			// fragment.
+			var all []string
+			if tt.fragment == "" {
+				all = audiences.All()
+			} else {
+				all = audiences.WithFragment(tt.fragment).All()
+			}
+			if got := matchesAudience(tt.audiences, all); got != tt.want {
+				t.Errorf("matchesAudience() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -154,10 +189,7 @@ func TestCollection_LoadByCertificate(t *testing.T) {
 	p3, err := generateACME()
 	assert.FatalError(t, err)
 
-	byName := new(sync.Map)
-	byName.Store(p1.GetName(), p1)
-	byName.Store(p2.GetName(), p2)
-	byName.Store(p3.GetName(), p3)
+	c := newTestCollection(t, testAudiences, p1, p2, p3)
 
 	ok1Ext, err := createProvisionerExtension(1, p1.Name, p1.Key.KeyID)
 	assert.FatalError(t, err)
@@ -186,33 +218,24 @@ func TestCollection_LoadByCertificate(t *testing.T) {
 		},
 	}
 
-	type fields struct {
-		byName    *sync.Map
-		audiences Audiences
-	}
 	type args struct {
 		cert *x509.Certificate
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   Interface
-		want1  bool
+		name  string
+		args  args
+		want  Interface
+		want1 bool
 	}{
-		{"ok1", fields{byName, testAudiences}, args{ok1Cert}, p1, true},
-		{"ok2", fields{byName, testAudiences}, args{ok2Cert}, p2, true},
-		{"ok3", fields{byName, testAudiences}, args{ok3Cert}, p3, true},
-		{"noExtension", fields{byName, testAudiences}, args{&x509.Certificate{}}, &noop{}, true},
-		{"notFound", fields{byName, testAudiences}, args{notFoundCert}, nil, false},
-		{"badCert", fields{byName, testAudiences}, args{badCert}, nil, false},
+		{"ok1", args{ok1Cert}, p1, true},
+		{"ok2", args{ok2Cert}, p2, true},
+		{"ok3", args{ok3Cert}, p3, true},
+		{"noExtension", args{&x509.Certificate{}}, &noop{}, true},
+		{"notFound", args{notFoundCert}, nil, false},
+		{"badCert", args{badCert}, nil, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := &Collection{
-				byName:    tt.fields.byName,
-				audiences: tt.fields.audiences,
-			}
 			got, got1 := c.LoadByCertificate(tt.args.cert)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Collection.LoadByCertificate() got = %v, want %v", got, tt.want)
@@ -236,7 +259,13 @@ func TestCollection_LoadEncryptedKey(t *testing.T) {
 	// Add oidc in byKey.
 	// It should not happen.
 	p2KeyID := p2.keyStore.keySet.Keys[0].KeyID
-	c.byKey.Store(p2KeyID, p2)
+	c.getIndex().byKey[p2KeyID] = p2
+
+	// Hidden provisioners do not return the encrypted key.
+	p3, err := generateJWK()
+	assert.FatalError(t, err)
+	p3.Options = &Options{Hidden: true}
+	assert.FatalError(t, c.Store(p3))
 
 	type args struct {
 		keyID string
@@ -249,6 +278,7 @@ func TestCollection_LoadEncryptedKey(t *testing.T) {
 	}{
 		{"ok", args{p1.Key.KeyID}, p1.EncryptedKey, true},
 		{"oidc", args{p2KeyID}, "", false},
+		{"hidden", args{p3.Key.KeyID}, "", false},
 		{"notFound", args{"not-found"}, "", false},
 	}
 	for _, tt := range tests {
@@ -270,32 +300,48 @@ func TestCollection_Store(t *testing.T) {
 	assert.FatalError(t, err)
 	p2, err := generateOIDC()
 	assert.FatalError(t, err)
+	p3, err := generateJWK()
+	assert.FatalError(t, err)
+	p4, err := generateJWK()
+	assert.FatalError(t, err)
 
 	type args struct {
-		p Interface
+		ps []Interface
 	}
 	tests := []struct {
 		name    string
 		args    args
 		wantErr bool
 	}{
-		{"ok1", args{p1}, false},
-		{"ok2", args{p2}, false},
-		{"fail1", args{p1}, true},
-		{"fail2", args{p2}, true},
+		{"ok1", args{[]Interface{p1}}, false},
+		{"ok2", args{[]Interface{p2}}, false},
+		{"ok-many", args{[]Interface{p3, p4}}, false},
+		{"fail1", args{[]Interface{p1}}, true},
+		{"fail2", args{[]Interface{p2}}, true},
+		{"fail-many", args{[]Interface{p4}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := c.Store(tt.args.p); (err != nil) != tt.wantErr {
+			if err := c.Store(tt.args.ps...); (err != nil) != tt.wantErr {
 				t.Errorf("Collection.Store() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
+	list, _ := c.Find("", 0)
+	assert.Equals(t, List{p1, p2, p3, p4}, list)
+
+	// A failed bulk store does not add any provisioner
+	p5, err := generateJWK()
+	assert.FatalError(t, err)
+	assert.Error(t, c.Store(p5, p5))
+	_, ok := c.Load(p5.GetID())
+	assert.False(t, ok)
 }
 
 func TestCollection_Find(t *testing.T) {
 	c, err := generateCollection(10, 10)
 	assert.FatalError(t, err)
+	sorted := c.getIndex().sorted
 
 	trim := func(s string) string {
 		return strings.TrimLeft(s, "0")
@@ -318,14 +364,14 @@ func TestCollection_Find(t *testing.T) {
 		want  List
 		want1 string
 	}{
-		{"all", args{"", DefaultProvisionersMax}, toList(c.sorted[0:20]), ""},
-		{"0 to 19", args{"", 20}, toList(c.sorted[0:20]), ""},
-		{"0 to 9", args{"", 10}, toList(c.sorted[0:10]), trim(c.sorted[10].uid)},
-		{"9 to 19", args{trim(c.sorted[10].uid), 10}, toList(c.sorted[10:20]), ""},
-		{"1", args{trim(c.sorted[1].uid), 1}, toList(c.sorted[1:2]), trim(c.sorted[2].uid)},
-		{"1 to 5", args{trim(c.sorted[1].uid), 4}, toList(c.sorted[1:5]), trim(c.sorted[5].uid)},
-		{"defaultLimit", args{"", 0}, toList(c.sorted[0:20]), ""},
-		{"overTheLimit", args{"", DefaultProvisionersMax + 1}, toList(c.sorted[0:20]), ""},
+		{"all", args{"", DefaultProvisionersMax}, toList(sorted[0:20]), ""},
+		{"0 to 19", args{"", 20}, toList(sorted[0:20]), ""},
+		{"0 to 9", args{"", 10}, toList(sorted[0:10]), trim(sorted[10].uid)},
+		{"9 to 19", args{trim(sorted[10].uid), 10}, toList(sorted[10:20]), ""},
+		{"1", args{trim(sorted[1].uid), 1}, toList(sorted[1:2]), trim(sorted[2].uid)},
+		{"1 to 5", args{trim(sorted[1].uid), 4}, toList(sorted[1:5]), trim(sorted[5].uid)},
+		{"defaultLimit", args{"", 0}, toList(sorted[0:20]), ""},
+		{"overTheLimit", args{"", DefaultProvisionersMax + 1}, toList(sorted[0:20]), ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -340,6 +386,158 @@ func TestCollection_Find(t *testing.T) {
 	}
 }
 
+func TestCollection_FindWithFilter(t *testing.T) {
+	c, err := generateCollection(10, 10)
+	assert.FatalError(t, err)
+	sorted := c.getIndex().sorted
+
+	trim := func(s string) string {
+		return strings.TrimLeft(s, "0")
+	}
+	toList := func(ps provisionerSlice) List {
+		l := List{}
+		for _, p := range ps {
+			l = append(l, p.provisioner)
+		}
+		return l
+	}
+
+	type args struct {
+		cursor string
+		limit  int
+		filter *Filter
+	}
+	tests := []struct {
+		name  string
+		args  args
+		want  List
+		want1 string
+	}{
+		{"nil", args{"", 5, nil}, toList(sorted[0:5]), trim(sorted[5].uid)},
+		{"empty", args{"", 5, &Filter{}}, toList(sorted[0:5]), trim(sorted[5].uid)},
+		{"jwk 0 to 4", args{"", 5, &Filter{Types: []string{"jwk"}}}, toList(sorted[0:5]), trim(sorted[5].uid)},
+		{"jwk 5 to 9", args{trim(sorted[5].uid), 10, &Filter{Types: []string{"JWK"}}}, toList(sorted[5:10]), ""},
+		{"jwk all", args{"", 10, &Filter{Types: []string{"JWK"}}}, toList(sorted[0:10]), ""},
+		{"oidc", args{"", 5, &Filter{Types: []string{"OIDC"}}}, toList(sorted[10:15]), trim(sorted[15].uid)},
+		{"jwk and oidc", args{"", 20, &Filter{Types: []string{"JWK", "OIDC"}}}, toList(sorted[0:20]), ""},
+		{"name", args{"", 20, &Filter{Names: []string{sorted[3].provisioner.GetName()}}}, toList(sorted[3:4]), ""},
+		{"name and type", args{"", 20, &Filter{Types: []string{"OIDC"}, Names: []string{sorted[3].provisioner.GetName()}}}, List{}, ""},
+		{"none", args{"", 20, &Filter{Types: []string{"ACME"}}}, List{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := c.FindWithFilter(tt.args.cursor, tt.args.limit, tt.args.filter)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Collection.FindWithFilter() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("Collection.FindWithFilter() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+	p2.Options = &Options{Hidden: true}
+	p3, err := generateOIDC()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name   string
+		filter *Filter
+		p      Interface
+		want   bool
+	}{
+		{"nil", nil, p2, true},
+		{"empty", &Filter{}, p2, true},
+		{"public", &Filter{Public: true}, p1, true},
+		{"public oidc", &Filter{Public: true}, p3, true},
+		{"public hidden", &Filter{Public: true}, p2, false},
+		{"public type", &Filter{Types: []string{"oidc"}, Public: true}, p1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.p); got != tt.want {
+				t.Errorf("Filter.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollection_Find_stableCursor(t *testing.T) {
+	c, err := generateCollection(10, 0)
+	assert.FatalError(t, err)
+
+	_, cursor := c.Find("", 5)
+	want, _ := c.Find(cursor, 5)
+
+	// Removing a previous provisioner and adding a new one must not change
+	// the next page.
+	assert.FatalError(t, c.Remove(c.getIndex().sorted[2].provisioner.GetID()))
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	assert.FatalError(t, c.Store(p))
+
+	got, next := c.Find(cursor, 5)
+	assert.Equals(t, want, got)
+	sorted := c.getIndex().sorted
+	assert.Equals(t, strings.TrimLeft(sorted[9].uid, "0"), next)
+	assert.Equals(t, p, sorted[9].provisioner)
+
+	// Updating a provisioner keeps its position.
+	u := *want[0].(*JWK)
+	u.ID = u.GetID()
+	u.Name = "updated"
+	assert.FatalError(t, c.Update(&u))
+	got, _ = c.Find(cursor, 5)
+	assert.Equals(t, Interface(&u), got[0])
+}
+
+func TestCollection_concurrentUpdates(t *testing.T) {
+	c, err := generateCollection(10, 0)
+	assert.FatalError(t, err)
+	list, _ := c.Find("", 10)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Lookups always see a complete index.
+				for _, p := range list {
+					if _, ok := c.LoadByName(p.GetName()); !ok {
+						t.Errorf("Collection.LoadByName(%s) not found", p.GetName())
+						return
+					}
+				}
+				c.Find("", 20)
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		u := *list[i%len(list)].(*JWK)
+		assert.FatalError(t, c.Update(&u))
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		assert.FatalError(t, c.Store(p))
+		assert.FatalError(t, c.Remove(p.GetID()))
+	}
+	close(done)
+	wg.Wait()
+}
+
 func Test_matchesAudience(t *testing.T) {
 	type matchesTest struct {
 		a, b []string
@@ -0,0 +1,134 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
+	"golang.org/x/crypto/ssh"
+)
+
+type clientIPKey struct{}
+
+// NewContextWithClientIP creates a new context from ctx and attaches the IP
+// address of the client that sent the request.
+func NewContextWithClientIP(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the IP address of the client saved in ctx, or
+// nil if there is none.
+func ClientIPFromContext(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	return ip
+}
+
+// Confirmation is the confirmation claim (cnf) of a token. It binds the token
+// to the public key of the certificate request, and optionally to the IP
+// addresses of the clients allowed to use it, so a stolen token cannot be used
+// with a different key or from a different host.
+type Confirmation struct {
+	// KeyThumbprint is the base64url encoded SHA-256 JWK thumbprint (RFC 7638)
+	// of the public key in the certificate request.
+	KeyThumbprint string `json:"jkt,omitempty"`
+	// IPs is the list of IP addresses or CIDR ranges of the clients that can
+	// use the token.
+	IPs []string `json:"ips,omitempty"`
+}
+
+// ValidateClientIP returns an error if the confirmation restricts the client
+// IPs and the IP of the client in ctx is not one of them.
+func (c *Confirmation) ValidateClientIP(ctx context.Context) error {
+	if c == nil || len(c.IPs) == 0 {
+		return nil
+	}
+	ip := ClientIPFromContext(ctx)
+	if ip == nil {
+		return errs.Unauthorized("token confirmation requires the client IP address")
+	}
+	for _, s := range c.IPs {
+		if strings.Contains(s, "/") {
+			_, ipNet, err := net.ParseCIDR(s)
+			if err != nil {
+				return errs.Unauthorized("token confirmation has an invalid CIDR %s", s)
+			}
+			if ipNet.Contains(ip) {
+				return nil
+			}
+			continue
+		}
+		allowed := net.ParseIP(s)
+		if allowed == nil {
+			return errs.Unauthorized("token confirmation has an invalid IP %s", s)
+		}
+		if allowed.Equal(ip) {
+			return nil
+		}
+	}
+	return errs.Unauthorized("token cannot be used from IP %s", ip)
+}
+
+// SignOptions returns the options that validate that the public key of the
+// certificate request matches the key thumbprint.
+func (c *Confirmation) SignOptions() []SignOption {
+	if c == nil || c.KeyThumbprint == "" {
+		return nil
+	}
+	return []SignOption{confirmationKeyValidator(c.KeyThumbprint)}
+}
+
+// SSHSignOptions returns the options that validate that the public key of the
+// SSH certificate matches the key thumbprint.
+func (c *Confirmation) SSHSignOptions() []SignOption {
+	if c == nil || c.KeyThumbprint == "" {
+		return nil
+	}
+	return []SignOption{sshConfirmationKeyValidator(c.KeyThumbprint)}
+}
+
+// confirmationKeyValidator validates that the public key of the certificate
+// request has the given JWK thumbprint.
+type confirmationKeyValidator string
+
+// Valid implements the CertificateRequestValidator interface.
+func (v confirmationKeyValidator) Valid(req *x509.CertificateRequest) error {
+	return validateKeyThumbprint(req.PublicKey, string(v))
+}
+
+// sshConfirmationKeyValidator validates that the public key of the SSH
+// certificate has the given JWK thumbprint.
+type sshConfirmationKeyValidator string
+
+// Valid implements the SSHCertValidator interface.
+func (v sshConfirmationKeyValidator) Valid(cert *ssh.Certificate, o SignSSHOptions) error {
+	if cert.Key == nil {
+		return errs.Forbidden("ssh certificate key cannot be empty")
+	}
+	pub, ok := cert.Key.(ssh.CryptoPublicKey)
+	if !ok {
+		return errs.Forbidden("ssh certificate key type %s is not supported", cert.Key.Type())
+	}
+	return validateKeyThumbprint(pub.CryptoPublicKey(), string(v))
+}
+
+func validateKeyThumbprint(pub crypto.PublicKey, thumbprint string) error {
+	want, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(thumbprint, "="))
+	if err != nil {
+		return errs.Forbidden("token confirmation has an invalid key thumbprint")
+	}
+	got, err := (&jose.JSONWebKey{Key: pub}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return errs.Wrap(http.StatusForbidden, err, "error generating key thumbprint")
+	}
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return errs.Forbidden("certificate request public key does not match the token confirmation")
+	}
+	return nil
+}
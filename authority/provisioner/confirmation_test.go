@@ -0,0 +1,105 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"go.step.sm/crypto/jose"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConfirmation_ValidateClientIP(t *testing.T) {
+	ctx := NewContextWithClientIP(context.Background(), net.ParseIP("10.1.2.3"))
+	tests := []struct {
+		name    string
+		cnf     *Confirmation
+		ctx     context.Context
+		wantErr bool
+	}{
+		{"ok nil", nil, context.Background(), false},
+		{"ok empty", &Confirmation{KeyThumbprint: "foo"}, context.Background(), false},
+		{"ok ip", &Confirmation{IPs: []string{"192.168.1.1", "10.1.2.3"}}, ctx, false},
+		{"ok cidr", &Confirmation{IPs: []string{"10.0.0.0/8"}}, ctx, false},
+		{"fail ip", &Confirmation{IPs: []string{"10.1.2.4"}}, ctx, true},
+		{"fail cidr", &Confirmation{IPs: []string{"10.1.3.0/24"}}, ctx, true},
+		{"fail no client ip", &Confirmation{IPs: []string{"10.1.2.3"}}, context.Background(), true},
+		{"fail bad ip", &Confirmation{IPs: []string{"foo"}}, ctx, true},
+		{"fail bad cidr", &Confirmation{IPs: []string{"10.0.0.0/33"}}, ctx, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cnf.ValidateClientIP(tt.ctx); (err != nil) != tt.wantErr {
+				t.Errorf("Confirmation.ValidateClientIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfirmation_SignOptions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := (&jose.JSONWebKey{Key: key.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnf := &Confirmation{KeyThumbprint: base64.RawURLEncoding.EncodeToString(sum)}
+
+	if opts := (&Confirmation{IPs: []string{"10.0.0.0/8"}}).SignOptions(); opts != nil {
+		t.Errorf("Confirmation.SignOptions() = %v, want nil", opts)
+	}
+	if opts := (&Confirmation{IPs: []string{"10.0.0.0/8"}}).SSHSignOptions(); opts != nil {
+		t.Errorf("Confirmation.SSHSignOptions() = %v, want nil", opts)
+	}
+
+	opts := cnf.SignOptions()
+	if len(opts) != 1 {
+		t.Fatalf("Confirmation.SignOptions() = %v, want 1 option", opts)
+	}
+	v := opts[0].(CertificateRequestValidator)
+	if err := v.Valid(&x509.CertificateRequest{PublicKey: key.Public()}); err != nil {
+		t.Errorf("CertificateRequestValidator.Valid() error = %v", err)
+	}
+	if err := v.Valid(&x509.CertificateRequest{PublicKey: other.Public()}); err == nil {
+		t.Error("CertificateRequestValidator.Valid() error = nil, want error")
+	}
+	bad := (&Confirmation{KeyThumbprint: "%%%"}).SignOptions()[0].(CertificateRequestValidator)
+	if err := bad.Valid(&x509.CertificateRequest{PublicKey: key.Public()}); err == nil {
+		t.Error("CertificateRequestValidator.Valid() error = nil, want error")
+	}
+
+	opts = cnf.SSHSignOptions()
+	if len(opts) != 1 {
+		t.Fatalf("Confirmation.SSHSignOptions() = %v, want 1 option", opts)
+	}
+	sv := opts[0].(SSHCertValidator)
+	sshKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ssh.NewPublicKey(other.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Valid(&ssh.Certificate{Key: sshKey}, SignSSHOptions{}); err != nil {
+		t.Errorf("SSHCertValidator.Valid() error = %v", err)
+	}
+	if err := sv.Valid(&ssh.Certificate{Key: otherKey}, SignSSHOptions{}); err == nil {
+		t.Error("SSHCertValidator.Valid() error = nil, want error")
+	}
+	if err := sv.Valid(&ssh.Certificate{}, SignSSHOptions{}); err == nil {
+		t.Error("SSHCertValidator.Valid() error = nil, want error")
+	}
+}
@@ -0,0 +1,282 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// CSRPassthroughKey is the key used in the template data to expose the
+// decision taken by the CSR passthrough policy.
+const CSRPassthroughKey = "CSRPassthrough"
+
+var (
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionNameConstraints  = asn1.ObjectIdentifier{2, 5, 29, 30}
+	oidAttributeExtensionRequest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+)
+
+// csrExtensionNames maps the names accepted in a CSRPassthroughPolicy to the
+// extension ids.
+var csrExtensionNames = map[string]string{
+	"keyUsage":             "2.5.29.15",
+	"extKeyUsage":          "2.5.29.37",
+	"subjectKeyIdentifier": "2.5.29.14",
+	"certificatePolicies":  "2.5.29.32",
+}
+
+// csrAttributeNames maps the names accepted in a CSRPassthroughPolicy to the
+// attribute ids.
+var csrAttributeNames = map[string]string{
+	"challengePassword": "1.2.840.113549.1.9.7",
+	"unstructuredName":  "1.2.840.113549.1.9.2",
+}
+
+// CSRPassthroughPolicy defines the extensions and attributes requested in a
+// CSR that are honored. Honored extensions are added to the certificate unless
+// the template already defines them, and honored attributes are only exposed
+// to the templates. Everything else is stripped. The subject alternative names
+// are not affected by this policy.
+//
+// Extensions and attributes can be referenced by their object identifier or by
+// their name, e.g. "extKeyUsage" or "challengePassword".
+type CSRPassthroughPolicy struct {
+	AllowedExtensions []string `json:"allowedExtensions,omitempty"`
+	AllowedAttributes []string `json:"allowedAttributes,omitempty"`
+}
+
+// CSRExtension is an extension requested in a CSR. It uses the same JSON
+// representation as the extensions in a template.
+type CSRExtension struct {
+	ID       string `json:"id"`
+	Critical bool   `json:"critical"`
+	Value    []byte `json:"value"`
+}
+
+// CSRAttribute is an attribute requested in a CSR. String values are decoded,
+// other values are base64 encoded.
+type CSRAttribute struct {
+	ID     string   `json:"id"`
+	Values []string `json:"values"`
+}
+
+// CSRPassthroughDecision contains the extensions and attributes honored and the
+// ids of the ones stripped from a CSR.
+type CSRPassthroughDecision struct {
+	Extensions []CSRExtension `json:"extensions"`
+	Attributes []CSRAttribute `json:"attributes"`
+	Stripped   []string       `json:"stripped"`
+}
+
+// Validate validates the CSR passthrough policy. A nil policy is valid.
+func (p *CSRPassthroughPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, s := range p.AllowedExtensions {
+		id, err := parseCSRPassthroughID(s, csrExtensionNames)
+		if err != nil {
+			return errors.Wrap(err, "csrPassthrough.allowedExtensions")
+		}
+		switch id {
+		case oidExtensionSubjectAltName.String():
+			return errors.New("csrPassthrough.allowedExtensions cannot contain the subjectAltName extension")
+		case oidExtensionBasicConstraints.String(), oidExtensionNameConstraints.String():
+			return errors.Errorf("csrPassthrough.allowedExtensions cannot contain the CA extension %s", s)
+		}
+	}
+	for _, s := range p.AllowedAttributes {
+		id, err := parseCSRPassthroughID(s, csrAttributeNames)
+		if err != nil {
+			return errors.Wrap(err, "csrPassthrough.allowedAttributes")
+		}
+		if id == oidAttributeExtensionRequest.String() {
+			return errors.New("csrPassthrough.allowedAttributes cannot contain the extensionRequest attribute")
+		}
+	}
+	return nil
+}
+
+func parseCSRPassthroughID(s string, names map[string]string) (string, error) {
+	if id, ok := names[s]; ok {
+		return id, nil
+	}
+	for _, v := range strings.Split(s, ".") {
+		if v == "" || strings.Trim(v, "0123456789") != "" {
+			return "", errors.Errorf("'%s' is not a supported name or object identifier", s)
+		}
+	}
+	return s, nil
+}
+
+func (p *CSRPassthroughPolicy) allows(list []string, names map[string]string, id string) bool {
+	for _, s := range list {
+		if v, _ := parseCSRPassthroughID(s, names); v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the extensions and attributes in the given CSR that are
+// honored by the policy. A nil policy strips everything.
+func (p *CSRPassthroughPolicy) Evaluate(csr *x509.CertificateRequest) (*CSRPassthroughDecision, error) {
+	d := &CSRPassthroughDecision{
+		Extensions: []CSRExtension{},
+		Attributes: []CSRAttribute{},
+		Stripped:   []string{},
+	}
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		id := ext.Id.String()
+		if p != nil && p.allows(p.AllowedExtensions, csrExtensionNames, id) {
+			d.Extensions = append(d.Extensions, CSRExtension{
+				ID:       id,
+				Critical: ext.Critical,
+				Value:    ext.Value,
+			})
+		} else {
+			d.Stripped = append(d.Stripped, id)
+		}
+	}
+
+	attrs, err := parseCSRAttributes(csr)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		if p != nil && p.allows(p.AllowedAttributes, csrAttributeNames, attr.ID) {
+			d.Attributes = append(d.Attributes, attr)
+		} else {
+			d.Stripped = append(d.Stripped, attr.ID)
+		}
+	}
+	return d, nil
+}
+
+// parseCSRAttributes returns the attributes in the CSR, except the extension
+// request. The standard library only parses the attributes with a list of
+// attribute type and values, so the raw attributes are parsed here.
+func parseCSRAttributes(csr *x509.CertificateRequest) ([]CSRAttribute, error) {
+	var tbs struct {
+		Raw           asn1.RawContent
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+
+	var attrs []CSRAttribute
+	for _, raw := range tbs.RawAttributes {
+		var attr struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		}
+		if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate request attribute")
+		}
+		if attr.Type.Equal(oidAttributeExtensionRequest) {
+			continue
+		}
+		a := CSRAttribute{
+			ID:     attr.Type.String(),
+			Values: make([]string, 0, len(attr.Values)),
+		}
+		for _, v := range attr.Values {
+			var s string
+			if _, err := asn1.Unmarshal(v.FullBytes, &s); err == nil {
+				a.Values = append(a.Values, s)
+			} else {
+				a.Values = append(a.Values, base64.StdEncoding.EncodeToString(v.FullBytes))
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs, nil
+}
+
+// withCSRPassthrough wraps the given template options, exposing the decision of
+// the CSR passthrough policy in the template data and adding the honored
+// extensions to the rendered template.
+func withCSRPassthrough(p *CSRPassthroughPolicy, data x509util.TemplateData, fns []x509util.Option) []x509util.Option {
+	wrapped := make([]x509util.Option, len(fns))
+	for i, fn := range fns {
+		fn := fn
+		wrapped[i] = func(cr *x509.CertificateRequest, o *x509util.Options) error {
+			d, err := p.Evaluate(cr)
+			if err != nil {
+				return err
+			}
+			data.Set(CSRPassthroughKey, d)
+			if len(d.Extensions) > 0 || len(d.Attributes) > 0 || len(d.Stripped) > 0 {
+				honored := make([]string, 0, len(d.Extensions)+len(d.Attributes))
+				for _, e := range d.Extensions {
+					honored = append(honored, e.ID)
+				}
+				for _, a := range d.Attributes {
+					honored = append(honored, a.ID)
+				}
+				log.Printf("CSR passthrough for '%s': honored [%s], stripped [%s]", cr.Subject.CommonName,
+					strings.Join(honored, ", "), strings.Join(d.Stripped, ", "))
+			}
+			if err := fn(cr, o); err != nil {
+				return err
+			}
+			return addCSRExtensions(o, d.Extensions)
+		}
+	}
+	return wrapped
+}
+
+// addCSRExtensions adds the given extensions to the rendered template if the
+// template does not define them.
+func addCSRExtensions(o *x509util.Options, exts []CSRExtension) error {
+	if len(exts) == 0 || o.CertBuffer == nil {
+		return nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(o.CertBuffer.Bytes(), &m); err != nil {
+		return errors.Wrap(err, "error unmarshaling certificate template")
+	}
+	var current []CSRExtension
+	if raw, ok := m["extensions"]; ok {
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return errors.Wrap(err, "error unmarshaling certificate template extensions")
+		}
+	}
+	for _, ext := range exts {
+		found := false
+		for _, e := range current {
+			if e.ID == ext.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			current = append(current, ext)
+		}
+	}
+	b, err := json.Marshal(current)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling certificate template extensions")
+	}
+	m["extensions"] = b
+	if b, err = json.Marshal(m); err != nil {
+		return errors.Wrap(err, "error marshaling certificate template")
+	}
+	o.CertBuffer = bytes.NewBuffer(b)
+	return nil
+}
@@ -0,0 +1,187 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/x509util"
+)
+
+func newPassthroughCSR(t *testing.T) *x509.CertificateRequest {
+	t.Helper()
+	attr := func(oid asn1.ObjectIdentifier, values ...string) asn1.RawValue {
+		b, err := asn1.Marshal(struct {
+			Type   asn1.ObjectIdentifier
+			Values []string `asn1:"set"`
+		}{oid, values})
+		assert.FatalError(t, err)
+		return asn1.RawValue{FullBytes: b}
+	}
+	tbs, err := asn1.Marshal(struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}{
+		Subject:   asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true},
+		PublicKey: asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true},
+		RawAttributes: []asn1.RawValue{
+			attr(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}, "secret"),
+			attr(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 2}, "device"),
+		},
+	})
+	assert.FatalError(t, err)
+	return &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo"},
+		DNSNames: []string{"foo"},
+		Extensions: []pkix.Extension{
+			{Id: oidExtensionSubjectAltName, Value: []byte{0x30, 0x05, 0x82, 0x03, 'f', 'o', 'o'}},
+			{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Value: []byte{0x30, 0x0a, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x07, 0x03, 0x03}},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Critical: true, Value: []byte{0x05, 0x00}},
+		},
+		RawTBSCertificateRequest: tbs,
+	}
+}
+
+func TestCSRPassthroughPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *CSRPassthroughPolicy
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &CSRPassthroughPolicy{}, false},
+		{"ok", &CSRPassthroughPolicy{AllowedExtensions: []string{"extKeyUsage", "1.2.3.4"}, AllowedAttributes: []string{"challengePassword", "1.2.840.113549.1.9.2"}}, false},
+		{"fail extension", &CSRPassthroughPolicy{AllowedExtensions: []string{"foo"}}, true},
+		{"fail extension oid", &CSRPassthroughPolicy{AllowedExtensions: []string{"1..2"}}, true},
+		{"fail subjectAltName", &CSRPassthroughPolicy{AllowedExtensions: []string{"2.5.29.17"}}, true},
+		{"fail basicConstraints", &CSRPassthroughPolicy{AllowedExtensions: []string{"2.5.29.19"}}, true},
+		{"fail attribute", &CSRPassthroughPolicy{AllowedAttributes: []string{"extKeyUsage"}}, true},
+		{"fail extensionRequest", &CSRPassthroughPolicy{AllowedAttributes: []string{"1.2.840.113549.1.9.14"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CSRPassthroughPolicy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCSRPassthroughPolicy_Evaluate(t *testing.T) {
+	csr := newPassthroughCSR(t)
+	eku := CSRExtension{ID: "2.5.29.37", Value: csr.Extensions[1].Value}
+	tests := []struct {
+		name    string
+		policy  *CSRPassthroughPolicy
+		want    *CSRPassthroughDecision
+		wantErr bool
+	}{
+		{"ok nil", nil, &CSRPassthroughDecision{
+			Extensions: []CSRExtension{},
+			Attributes: []CSRAttribute{},
+			Stripped:   []string{"2.5.29.37", "1.2.3.4", "1.2.840.113549.1.9.7", "1.2.840.113549.1.9.2"},
+		}, false},
+		{"ok", &CSRPassthroughPolicy{AllowedExtensions: []string{"extKeyUsage"}, AllowedAttributes: []string{"challengePassword"}}, &CSRPassthroughDecision{
+			Extensions: []CSRExtension{eku},
+			Attributes: []CSRAttribute{{ID: "1.2.840.113549.1.9.7", Values: []string{"secret"}}},
+			Stripped:   []string{"1.2.3.4", "1.2.840.113549.1.9.2"},
+		}, false},
+		{"ok oid", &CSRPassthroughPolicy{AllowedExtensions: []string{"1.2.3.4"}, AllowedAttributes: []string{"1.2.840.113549.1.9.2"}}, &CSRPassthroughDecision{
+			Extensions: []CSRExtension{{ID: "1.2.3.4", Critical: true, Value: []byte{0x05, 0x00}}},
+			Attributes: []CSRAttribute{{ID: "1.2.840.113549.1.9.2", Values: []string{"device"}}},
+			Stripped:   []string{"2.5.29.37", "1.2.840.113549.1.9.7"},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Evaluate(csr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CSRPassthroughPolicy.Evaluate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CSRPassthroughPolicy.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Invalid raw certificate request
+	_, err := (&CSRPassthroughPolicy{}).Evaluate(&x509.CertificateRequest{RawTBSCertificateRequest: []byte("foo")})
+	assert.NotNil(t, err)
+}
+
+func Test_addCSRExtensions(t *testing.T) {
+	exts := []CSRExtension{
+		{ID: "2.5.29.37", Value: []byte("foo")},
+		{ID: "1.2.3.4", Critical: true, Value: []byte("bar")},
+	}
+	tests := []struct {
+		name     string
+		template string
+		want     []CSRExtension
+		wantErr  bool
+	}{
+		{"ok", `{"subject": {"commonName": "foo"}}`, exts, false},
+		{"ok template extension", `{"extensions": [{"id": "1.2.3.4", "critical": false, "value": "Zm9v"}]}`, []CSRExtension{
+			{ID: "1.2.3.4", Value: []byte("foo")},
+			{ID: "2.5.29.37", Value: []byte("foo")},
+		}, false},
+		{"fail template", `{"subject": `, nil, true},
+		{"fail extensions", `{"extensions": "foo"}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &x509util.Options{CertBuffer: bytes.NewBufferString(tt.template)}
+			if err := addCSRExtensions(o, exts); (err != nil) != tt.wantErr {
+				t.Errorf("addCSRExtensions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			var got struct {
+				Extensions []CSRExtension `json:"extensions"`
+			}
+			assert.FatalError(t, json.Unmarshal(o.CertBuffer.Bytes(), &got))
+			if !reflect.DeepEqual(got.Extensions, tt.want) {
+				t.Errorf("addCSRExtensions() = %v, want %v", got.Extensions, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateOptions_csrPassthrough(t *testing.T) {
+	csr := newPassthroughCSR(t)
+	data := x509util.NewTemplateData()
+	data.SetCommonName("foo")
+	cof, err := TemplateOptions(&Options{
+		X509: &X509Options{
+			Template: `{"subject": {"commonName": {{ toJson .Subject.CommonName }}}, "extensions": []}`,
+			CSRPassthrough: &CSRPassthroughPolicy{
+				AllowedExtensions: []string{"extKeyUsage"},
+			},
+		},
+	}, data)
+	assert.FatalError(t, err)
+
+	var opts x509util.Options
+	for _, fn := range cof.Options(SignOptions{}) {
+		assert.FatalError(t, fn(csr, &opts))
+	}
+	var got struct {
+		Extensions []CSRExtension `json:"extensions"`
+	}
+	assert.FatalError(t, json.Unmarshal(opts.CertBuffer.Bytes(), &got))
+	assert.Equals(t, []CSRExtension{{ID: "2.5.29.37", Value: csr.Extensions[1].Value}}, got.Extensions)
+
+	d, ok := data[CSRPassthroughKey].(*CSRPassthroughDecision)
+	assert.Fatal(t, ok)
+	assert.Equals(t, []string{"1.2.3.4", "1.2.840.113549.1.9.7", "1.2.840.113549.1.9.2"}, d.Stripped)
+}
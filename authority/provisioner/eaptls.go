@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EAPTLSTemplate is the default template used by provisioners with the EAP-TLS
+// profile enabled. The certificates are client certificates accepted by RADIUS
+// servers like FreeRADIUS or Microsoft NPS.
+const EAPTLSTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["clientAuth"]
+}`
+
+// EAPTLSOptions enables the EAP-TLS profile in a provisioner. With the profile
+// enabled, the provisioner issues client certificates for 802.1X network
+// authentication and, optionally, restricts the SANs of a device to the
+// attributes sent by an MDM.
+type EAPTLSOptions struct {
+	// DeviceSANs is the list of attributes in the MDM data, e.g.
+	// "Device.serialNumber" or "Device.udid", whose values are the only SANs
+	// allowed in the certificate of a device. If empty, the SANs are not
+	// restricted.
+	DeviceSANs []string `json:"deviceSANs,omitempty"`
+}
+
+// GetEAPTLS returns the EAP-TLS options.
+func (o *Options) GetEAPTLS() *EAPTLSOptions {
+	if o == nil {
+		return nil
+	}
+	return o.EAPTLS
+}
+
+// Validate validates the EAP-TLS options. Nil options are valid.
+func (o *EAPTLSOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, attr := range o.DeviceSANs {
+		if attr == "" || strings.HasPrefix(attr, ".") || strings.HasSuffix(attr, ".") || strings.Contains(attr, "..") {
+			return errors.Errorf("eapTLS deviceSANs attribute %q is not valid", attr)
+		}
+	}
+	return nil
+}
+
+// DeviceSANsValidator returns a validator that only allows the SANs present in
+// the given MDM data, or nil if the SANs are not restricted.
+func (o *EAPTLSOptions) DeviceSANsValidator(mdm map[string]interface{}) CertificateValidator {
+	if o == nil || len(o.DeviceSANs) == 0 {
+		return nil
+	}
+	return &deviceSANsValidator{
+		attributes: o.DeviceSANs,
+		data:       mdm,
+	}
+}
+
+// deviceSANsValidator validates the SANs of a certificate using the values of
+// the device attributes sent by an MDM.
+type deviceSANsValidator struct {
+	attributes []string
+	data       map[string]interface{}
+}
+
+// Valid checks that all the SANs of the certificate are values of the device
+// attributes.
+func (v *deviceSANsValidator) Valid(cert *x509.Certificate, _ SignOptions) error {
+	if v.data == nil {
+		return errors.New("certificate request does not contain device attributes")
+	}
+
+	allowed := make(map[string]bool)
+	for _, attr := range v.attributes {
+		if value := lookupDeviceAttribute(v.data, attr); value != "" {
+			allowed[strings.ToLower(value)] = true
+		}
+	}
+
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	if len(sans) == 0 {
+		return errors.New("certificate does not contain any SAN")
+	}
+	for _, san := range sans {
+		if !allowed[strings.ToLower(san)] {
+			return errors.Errorf("certificate SAN %s does not match the device attributes", san)
+		}
+	}
+	return nil
+}
+
+// lookupDeviceAttribute returns the value of the attribute with the given
+// dot-separated path, or an empty string if it's not present.
+func lookupDeviceAttribute(data map[string]interface{}, path string) string {
+	var value interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = m[key]; !ok {
+			return ""
+		}
+	}
+	switch v := value.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,85 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestEAPTLSOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *EAPTLSOptions
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &EAPTLSOptions{}, false},
+		{"ok", &EAPTLSOptions{DeviceSANs: []string{"Device.serialNumber", "Device.udid"}}, false},
+		{"fail empty", &EAPTLSOptions{DeviceSANs: []string{""}}, true},
+		{"fail prefix", &EAPTLSOptions{DeviceSANs: []string{".udid"}}, true},
+		{"fail suffix", &EAPTLSOptions{DeviceSANs: []string{"Device."}}, true},
+		{"fail double dot", &EAPTLSOptions{DeviceSANs: []string{"Device..udid"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("EAPTLSOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEAPTLSOptions_DeviceSANsValidator(t *testing.T) {
+	mdm := map[string]interface{}{
+		"Provider": "jamf",
+		"Device": map[string]interface{}{
+			"udid":       "55D3F4C0-6E1B-4F8B-9C4E-5A0B7F0E1D2C",
+			"name":       "Laptop.example.com",
+			"ipAddress":  "10.0.0.1",
+			"deviceId":   float64(42),
+			"attributes": map[string]interface{}{"foo": "bar"},
+		},
+	}
+	options := &EAPTLSOptions{DeviceSANs: []string{"Device.udid", "Device.name", "Device.ipAddress", "Device.deviceId", "Device.attributes", "Device.missing"}}
+	uri, err := url.Parse("urn:uuid:55d3f4c0-6e1b-4f8b-9c4e-5a0b7f0e1d2c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := (*EAPTLSOptions)(nil).DeviceSANsValidator(mdm); v != nil {
+		t.Errorf("EAPTLSOptions.DeviceSANsValidator() = %v, want nil", v)
+	}
+	if v := (&EAPTLSOptions{}).DeviceSANsValidator(mdm); v != nil {
+		t.Errorf("EAPTLSOptions.DeviceSANsValidator() = %v, want nil", v)
+	}
+
+	tests := []struct {
+		name    string
+		mdm     map[string]interface{}
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok dns", mdm, &x509.Certificate{DNSNames: []string{"laptop.example.com"}}, false},
+		{"ok ip", mdm, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}, false},
+		{"ok number", mdm, &x509.Certificate{DNSNames: []string{"42"}}, false},
+		{"ok multiple", mdm, &x509.Certificate{
+			DNSNames:    []string{"laptop.example.com"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		}, false},
+		{"fail uri", mdm, &x509.Certificate{URIs: []*url.URL{uri}}, true},
+		{"fail other", mdm, &x509.Certificate{DNSNames: []string{"laptop.example.com", "other.example.com"}}, true},
+		{"fail email", mdm, &x509.Certificate{EmailAddresses: []string{"jane@example.com"}}, true},
+		{"fail object", mdm, &x509.Certificate{DNSNames: []string{"map[foo:bar]"}}, true},
+		{"fail no sans", mdm, &x509.Certificate{}, true},
+		{"fail no mdm", nil, &x509.Certificate{DNSNames: []string{"laptop.example.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := options.DeviceSANsValidator(tt.mdm)
+			if err := v.Valid(tt.cert, SignOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("deviceSANsValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package provisioner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// X509Cert is the certificate type used to evaluate the claims of X.509
+// certificates.
+const X509Cert = "x509"
+
+// ClaimsEvaluationRequest is a hypothetical certificate request evaluated
+// against the claims of a provisioner.
+type ClaimsEvaluationRequest struct {
+	// CertType is the type of the certificate, "x509", "user" or "host". It
+	// defaults to "x509".
+	CertType string `json:"certType,omitempty"`
+	// Duration is the requested validity. The default duration of the
+	// provisioner is used if it is not set.
+	Duration *Duration `json:"duration,omitempty"`
+	// SANs are the requested SANs, or the principals of SSH certificates.
+	SANs []string `json:"sans,omitempty"`
+	// Renewal evaluates the renewal of the certificate instead of its
+	// issuance.
+	Renewal bool `json:"renewal,omitempty"`
+}
+
+// ClaimsEvaluation is the result of the evaluation of a request against the
+// claims of a provisioner. Reasons contains the reasons why the request would
+// be rejected.
+type ClaimsEvaluation struct {
+	Provisioner string    `json:"provisioner"`
+	Type        string    `json:"type"`
+	CertType    string    `json:"certType"`
+	Claims      Claims    `json:"claims"`
+	Duration    *Duration `json:"duration"`
+	Allowed     bool      `json:"allowed"`
+	Reasons     []string  `json:"reasons,omitempty"`
+}
+
+// EvaluateClaims resolves the effective claims of the given provisioner,
+// merging its claims with the global ones, and checks whether the given
+// request would be allowed by them. The evaluation does not include the
+// checks that depend on the token or on the certificate request, like the
+// SANs authorized by a token, the policy hooks or the quotas. The schedule of
+// the provisioner is evaluated at the given time.
+func EvaluateClaims(p Interface, global Claims, req *ClaimsEvaluationRequest, now time.Time) (*ClaimsEvaluation, error) {
+	claimer, err := NewClaimer(getClaims(p), global)
+	if err != nil {
+		return nil, err
+	}
+
+	certType := req.CertType
+	if certType == "" {
+		certType = X509Cert
+	}
+
+	var min, max, def time.Duration
+	switch certType {
+	case X509Cert:
+		min, max, def = claimer.MinTLSCertDuration(), claimer.MaxTLSCertDuration(), claimer.DefaultTLSCertDuration()
+	case SSHUserCert:
+		min, max, def = claimer.MinUserSSHCertDuration(), claimer.MaxUserSSHCertDuration(), claimer.DefaultUserSSHCertDuration()
+	case SSHHostCert:
+		min, max, def = claimer.MinHostSSHCertDuration(), claimer.MaxHostSSHCertDuration(), claimer.DefaultHostSSHCertDuration()
+	default:
+		return nil, errors.Errorf("certType '%s' is not valid, it must be x509, user or host", certType)
+	}
+
+	e := &ClaimsEvaluation{
+		Provisioner: p.GetName(),
+		Type:        p.GetType().String(),
+		CertType:    certType,
+		Claims:      claimer.Claims(),
+		Duration:    &Duration{Duration: def},
+	}
+	reject := func(format string, args ...interface{}) {
+		e.Reasons = append(e.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if req.Duration != nil {
+		e.Duration = req.Duration
+	}
+	if o, ok := p.(interface{ GetOptions() *Options }); ok && !o.GetOptions().IsActive(now) {
+		reject("provisioner %s is not active", p.GetName())
+	}
+	if d := e.Duration.Duration; d < min || d > max {
+		reject("duration %s is not between %s and %s", d, min, max)
+	}
+
+	if certType == X509Cert {
+		if req.Renewal && claimer.IsDisableRenewal() {
+			reject("renew is disabled for provisioner %s", p.GetName())
+		}
+		if p.GetType() == TypeACME {
+			_, _, emails, uris := x509util.SplitSANs(req.SANs)
+			if len(emails) > 0 || len(uris) > 0 {
+				reject("provisioner %s only supports dns and ip identifiers", p.GetName())
+			}
+		}
+	} else {
+		switch p.GetType() {
+		case TypeACME, TypeSCEP, TypeSSHPOP:
+			reject("provisioner %s cannot sign ssh certificates", p.GetName())
+		default:
+			if !claimer.IsSSHCAEnabled() {
+				reject("ssh ca is disabled for provisioner %s", p.GetName())
+			}
+		}
+	}
+
+	e.Allowed = len(e.Reasons) == 0
+	return e, nil
+}
+
+// getClaims returns the claims of the given provisioner.
+func getClaims(p Interface) *Claims {
+	switch p := p.(type) {
+	case *JWK:
+		return p.Claims
+	case *OIDC:
+		return p.Claims
+	case *GCP:
+		return p.Claims
+	case *AWS:
+		return p.Claims
+	case *Azure:
+		return p.Claims
+	case *ACME:
+		return p.Claims
+	case *X5C:
+		return p.Claims
+	case *K8sSA:
+		return p.Claims
+	case *SSHPOP:
+		return p.Claims
+	case *SCEP:
+		return p.Claims
+	case *Plugin:
+		return p.Claims
+	default:
+		return nil
+	}
+}
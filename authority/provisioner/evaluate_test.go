@@ -0,0 +1,75 @@
+package provisioner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluateClaims(t *testing.T) {
+	disabled := true
+	past := time.Now().Add(-time.Hour)
+	jwk := &JWK{Name: "jwk", Type: "JWK"}
+	short := &JWK{Name: "short", Type: "JWK", Claims: &Claims{
+		MaxTLSDur:      &Duration{Duration: time.Hour},
+		DefaultTLSDur:  &Duration{Duration: time.Hour},
+		DisableRenewal: &disabled,
+		EnableSSHCA:    new(bool),
+	}}
+	expired := &JWK{Name: "expired", Type: "JWK", Options: &Options{NotAfter: &past}}
+	acme := &ACME{Name: "acme", Type: "ACME"}
+
+	tests := []struct {
+		name        string
+		p           Interface
+		req         *ClaimsEvaluationRequest
+		wantAllowed bool
+		wantDur     time.Duration
+		wantReasons []string
+		wantErr     bool
+	}{
+		{"ok default", jwk, &ClaimsEvaluationRequest{}, true, 24 * time.Hour, nil, false},
+		{"ok duration", jwk, &ClaimsEvaluationRequest{Duration: &Duration{Duration: time.Hour}}, true, time.Hour, nil, false},
+		{"ok renewal", jwk, &ClaimsEvaluationRequest{Renewal: true}, true, 24 * time.Hour, nil, false},
+		{"ok user", jwk, &ClaimsEvaluationRequest{CertType: "user"}, true, 16 * time.Hour, nil, false},
+		{"ok host", jwk, &ClaimsEvaluationRequest{CertType: "host"}, true, 30 * 24 * time.Hour, nil, false},
+		{"ok acme", acme, &ClaimsEvaluationRequest{SANs: []string{"example.com", "10.0.0.1"}}, true, 24 * time.Hour, nil, false},
+		{"ok provisioner claims", short, &ClaimsEvaluationRequest{}, true, time.Hour, nil, false},
+		{"fail duration", short, &ClaimsEvaluationRequest{Duration: &Duration{Duration: 2 * time.Hour}}, false, 2 * time.Hour,
+			[]string{"duration 2h0m0s is not between 5m0s and 1h0m0s"}, false},
+		{"fail renewal", short, &ClaimsEvaluationRequest{Renewal: true}, false, time.Hour,
+			[]string{"renew is disabled for provisioner short"}, false},
+		{"fail ssh disabled", short, &ClaimsEvaluationRequest{CertType: "user"}, false, 16 * time.Hour,
+			[]string{"ssh ca is disabled for provisioner short"}, false},
+		{"fail expired", expired, &ClaimsEvaluationRequest{}, false, 24 * time.Hour,
+			[]string{"provisioner expired is not active"}, false},
+		{"fail acme sans", acme, &ClaimsEvaluationRequest{SANs: []string{"jane@example.com"}}, false, 24 * time.Hour,
+			[]string{"provisioner acme only supports dns and ip identifiers"}, false},
+		{"fail acme ssh", acme, &ClaimsEvaluationRequest{CertType: "host"}, false, 30 * 24 * time.Hour,
+			[]string{"provisioner acme cannot sign ssh certificates"}, false},
+		{"fail cert type", jwk, &ClaimsEvaluationRequest{CertType: "foo"}, false, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvaluateClaims(tt.p, globalProvisionerClaims, tt.req, time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvaluateClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Allowed != tt.wantAllowed {
+				t.Errorf("EvaluateClaims() Allowed = %v, want %v", got.Allowed, tt.wantAllowed)
+			}
+			if got.Duration.Duration != tt.wantDur {
+				t.Errorf("EvaluateClaims() Duration = %s, want %s", got.Duration, tt.wantDur)
+			}
+			if !reflect.DeepEqual(got.Reasons, tt.wantReasons) {
+				t.Errorf("EvaluateClaims() Reasons = %v, want %v", got.Reasons, tt.wantReasons)
+			}
+			if got.Provisioner != tt.p.GetName() {
+				t.Errorf("EvaluateClaims() Provisioner = %s, want %s", got.Provisioner, tt.p.GetName())
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
 	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/sshutil"
@@ -74,6 +75,10 @@ func newGCPConfig() *gcpConfig {
 // If InstanceAge is set, only the instances with an instance_creation_timestamp
 // within the given period will be accepted.
 //
+// If StrictSSHPrincipals is true, the principals of the SSH host certificates,
+// including the ones set by templates, must be owned by the instance, see
+// InstancePrincipals.
+//
 // Google Identity docs are available at
 // https://cloud.google.com/compute/docs/instances/verifying-instance-identity
 type GCP struct {
@@ -85,10 +90,13 @@ type GCP struct {
 	ProjectIDs             []string `json:"projectIDs"`
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	StrictSSHPrincipals    bool     `json:"strictSSHPrincipals,omitempty"`
 	InstanceAge            Duration `json:"instanceAge,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	claimer                *Claimer
+	clock                  Clock
+	identityResolver       IdentityResolver
 	config                 *gcpConfig
 	keyStore               *keyStore
 	audiences              Audiences
@@ -154,6 +162,11 @@ func (p *GCP) GetEncryptedKey() (kid string, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *GCP) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityURL returns the url that generates the GCP token.
 func (p *GCP) GetIdentityURL(audience string) string {
 	// Initialize config if required
@@ -206,12 +219,19 @@ func (p *GCP) Init(config Config) error {
 	}
 	// Initialize config
 	p.assertConfig()
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+	p.clock = config.Clock
+
 	// Update claims with global ones
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
 	// Initialize key store
-	p.keyStore, err = newKeyStore(p.config.CertsURL)
+	p.keyStore, err = newKeyStore(p.config.CertsURL, breaker.New("gcp "+p.Name, config.CircuitBreaker))
 	if err != nil {
 		return err
 	}
@@ -236,6 +256,10 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newGCPIdentityDocument(claims), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
 
 	// Enforce known common name and default DNS if configured.
 	// By default we we'll accept the CN and SANs in the CSR.
@@ -265,21 +289,43 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 
 	return append(so,
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeGCP, p.Name, claims.Subject, "InstanceID", ce.InstanceID, "InstanceName", ce.InstanceName),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
 	), nil
 }
 
+// newGCPIdentityDocument returns the identity document of the instance in the
+// given token.
+func newGCPIdentityDocument(claims *gcpPayload) *IdentityDocument {
+	ce := claims.Google.ComputeEngine
+	return &IdentityDocument{
+		Subject: ce.InstanceID,
+		Names: []string{
+			ce.InstanceName,
+			fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
+			fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID),
+		},
+		Attributes: map[string]interface{}{
+			"serviceAccount": claims.Email,
+			"instanceName":   ce.InstanceName,
+			"projectID":      ce.ProjectID,
+			"projectNumber":  ce.ProjectNumber,
+			"zone":           ce.Zone,
+		},
+	}
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 func (p *GCP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("gcp.AuthorizeRenew; renew is disabled for gcp provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
 
 // assertConfig initializes the config if it has not been initialized.
@@ -317,7 +363,7 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no
 	// more than a few minutes.
-	now := time.Now().UTC()
+	now := clockNow(p.clock).UTC()
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: "https://accounts.google.com",
 		Time:   now,
@@ -402,6 +448,7 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
 		fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID),
 	}
+	instance := newGCPInstancePrincipals(&ce)
 
 	// Only enforce known principals if disable custom sans is true.
 	if p.DisableCustomSANs {
@@ -415,15 +462,25 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 
 	// Certificate templates.
 	data := sshutil.CreateTemplateData(sshutil.HostCert, ce.InstanceName, principals)
+	data.Set(InstancePrincipalsKey, instance)
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newGCPIdentityDocument(claims), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
+	}
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
-	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, templateOptions, identity)
+
+	// Only allow the principals owned by the instance.
+	if p.StrictSSHPrincipals {
+		signOptions = append(signOptions, &sshInstancePrincipalsValidator{instance})
+	}
 
 	return append(signOptions,
 		// Validate user SignSSHOptions.
@@ -431,7 +488,7 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
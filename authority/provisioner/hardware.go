@@ -0,0 +1,57 @@
+package provisioner
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/keyattest"
+)
+
+// stepOIDHardwareBound is the OID of the extension that marks the
+// certificates of keys attested by a hardware device.
+var stepOIDHardwareBound = append(asn1.ObjectIdentifier(nil), append(stepOIDRoot, 4)...)
+
+// HardwareBound contains the attributes of the device that generated the key
+// of a certificate.
+type HardwareBound struct {
+	Format       string
+	SerialNumber string `asn1:"optional,omitempty,utf8"`
+	PINPolicy    string `asn1:"optional,omitempty,tag:0,utf8"`
+	TouchPolicy  string `asn1:"optional,omitempty,tag:1,utf8"`
+}
+
+// CreateHardwareBoundExtension returns a non-critical X.509 extension that
+// marks a certificate as hardware-bound using the result of a verified key
+// attestation.
+func CreateHardwareBoundExtension(res *keyattest.Result) (pkix.Extension, error) {
+	b, err := asn1.Marshal(HardwareBound{
+		Format:       res.Format,
+		SerialNumber: res.SerialNumber,
+		PINPolicy:    res.PINPolicy,
+		TouchPolicy:  res.TouchPolicy,
+	})
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling hardware-bound extension")
+	}
+	return pkix.Extension{
+		Id:       stepOIDHardwareBound,
+		Critical: false,
+		Value:    b,
+	}, nil
+}
+
+// GetHardwareBound returns the attributes in the first hardware-bound
+// extension in the given list.
+func GetHardwareBound(extensions []pkix.Extension) (*HardwareBound, bool) {
+	for _, e := range extensions {
+		if e.Id.Equal(stepOIDHardwareBound) {
+			hb := new(HardwareBound)
+			if rest, err := asn1.Unmarshal(e.Value, hb); err != nil || len(rest) > 0 {
+				return nil, false
+			}
+			return hb, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,45 @@
+package provisioner
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/keyattest"
+)
+
+func TestCreateHardwareBoundExtension(t *testing.T) {
+	ext, err := CreateHardwareBoundExtension(&keyattest.Result{
+		Format:       keyattest.FormatYubiKey,
+		SerialNumber: "12345678",
+		PINPolicy:    keyattest.PolicyOnce,
+		TouchPolicy:  keyattest.PolicyAlways,
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, stepOIDHardwareBound, ext.Id)
+	assert.False(t, ext.Critical)
+
+	got, ok := GetHardwareBound([]pkix.Extension{{Id: stepOIDProvisioner}, ext})
+	assert.True(t, ok)
+	assert.Equals(t, &HardwareBound{
+		Format:       "yubikey",
+		SerialNumber: "12345678",
+		PINPolicy:    "once",
+		TouchPolicy:  "always",
+	}, got)
+
+	// Optional fields
+	ext, err = CreateHardwareBoundExtension(&keyattest.Result{
+		Format:      keyattest.FormatYubiKey,
+		TouchPolicy: keyattest.PolicyCached,
+	})
+	assert.FatalError(t, err)
+	got, ok = GetHardwareBound([]pkix.Extension{ext})
+	assert.True(t, ok)
+	assert.Equals(t, &HardwareBound{Format: "yubikey", TouchPolicy: "cached"}, got)
+
+	_, ok = GetHardwareBound([]pkix.Extension{{Id: stepOIDProvisioner}})
+	assert.False(t, ok)
+	_, ok = GetHardwareBound([]pkix.Extension{{Id: stepOIDHardwareBound, Value: []byte("foo")}})
+	assert.False(t, ok)
+}
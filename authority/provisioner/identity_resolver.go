@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// IdentityDataKey is the key used in the X.509 and SSH template data to expose
+// the identity document of the principal authenticated by the provisioner.
+const IdentityDataKey = "Identity"
+
+// IdentityDocument is the normalized identity of the principal authenticated
+// by a provisioner, e.g. the subject of an OIDC token, an AWS instance or a
+// Kubernetes service account. It is available in the X.509 and SSH templates
+// as {{ .Identity }}, and it is sent to the policy hooks.
+//
+// The provisioners also return the document in the list of sign options.
+type IdentityDocument struct {
+	// Provisioner is the name of the provisioner.
+	Provisioner string `json:"provisioner"`
+	// Type is the type of the provisioner.
+	Type string `json:"type"`
+	// Subject is the principal authenticated by the provisioner, e.g. the
+	// subject of a token, an instance id or a service account name.
+	Subject string `json:"subject"`
+	// Email is the email of the principal, if any.
+	Email string `json:"email,omitempty"`
+	// Groups are the groups the principal belongs to, if any.
+	Groups []string `json:"groups,omitempty"`
+	// Names are the names the principal is authorized to use, e.g. the SANs
+	// of an X.509 certificate or the principals of an SSH certificate.
+	Names []string `json:"names,omitempty"`
+	// Attributes are other attributes of the principal that depend on the
+	// type of provisioner, e.g. the AWS account or the Kubernetes namespace.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// IdentityResolver converts the identity document created by a provisioner
+// into the one used in the templates and the policy hooks, e.g. mapping
+// subjects to users of a directory. It is configured with the
+// IdentityResolver in the provisioner Config.
+type IdentityResolver interface {
+	ResolveIdentity(ctx context.Context, p Interface, doc *IdentityDocument) (*IdentityDocument, error)
+}
+
+// IdentityResolverFunc is an adapter to use a function as an
+// IdentityResolver.
+type IdentityResolverFunc func(ctx context.Context, p Interface, doc *IdentityDocument) (*IdentityDocument, error)
+
+// ResolveIdentity implements the IdentityResolver interface.
+func (fn IdentityResolverFunc) ResolveIdentity(ctx context.Context, p Interface, doc *IdentityDocument) (*IdentityDocument, error) {
+	return fn(ctx, p, doc)
+}
+
+// templateDataSetter is implemented by the X.509 and SSH template data.
+type templateDataSetter interface {
+	Set(key string, v interface{})
+}
+
+// resolveIdentity sets the provisioner in the given document, resolves it
+// using the resolver, if any, and adds the result to the template data.
+func resolveIdentity(ctx context.Context, r IdentityResolver, p Interface, doc *IdentityDocument, data templateDataSetter) (*IdentityDocument, error) {
+	doc.Provisioner = p.GetName()
+	doc.Type = p.GetType().String()
+	if r != nil {
+		resolved, err := r.ResolveIdentity(ctx, p, doc)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "error resolving identity")
+		}
+		if resolved != nil {
+			doc = resolved
+		}
+	}
+	data.Set(IdentityDataKey, doc)
+	return doc, nil
+}
@@ -0,0 +1,76 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/x509util"
+)
+
+func Test_resolveIdentity(t *testing.T) {
+	p, err := generateJWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := &IdentityDocument{Subject: "jane", Email: "jane@example.com", Groups: []string{"admins"}}
+	resolver := IdentityResolverFunc(func(ctx context.Context, p Interface, doc *IdentityDocument) (*IdentityDocument, error) {
+		switch doc.Subject {
+		case "fail":
+			return nil, errors.New("force")
+		case "keep":
+			doc.Groups = []string{"users"}
+			return nil, nil
+		}
+		return resolved, nil
+	})
+
+	type args struct {
+		r   IdentityResolver
+		doc *IdentityDocument
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *IdentityDocument
+		wantErr bool
+	}{
+		{"ok no resolver", args{nil, &IdentityDocument{Subject: "foo", Names: []string{"foo"}}}, &IdentityDocument{
+			Provisioner: p.GetName(), Type: "JWK", Subject: "foo", Names: []string{"foo"},
+		}, false},
+		{"ok resolved", args{resolver, &IdentityDocument{Subject: "foo"}}, resolved, false},
+		{"ok keep", args{resolver, &IdentityDocument{Subject: "keep"}}, &IdentityDocument{
+			Provisioner: p.GetName(), Type: "JWK", Subject: "keep", Groups: []string{"users"},
+		}, false},
+		{"fail", args{resolver, &IdentityDocument{Subject: "fail"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := x509util.NewTemplateData()
+			got, err := resolveIdentity(context.Background(), tt.args.r, p, tt.args.doc, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveIdentity() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if sc, ok := err.(errs.StatusCoder); !ok || sc.StatusCode() != http.StatusUnauthorized {
+					t.Errorf("resolveIdentity() error = %v, want status code 401", err)
+				}
+				if _, ok := data[IdentityDataKey]; ok {
+					t.Errorf("resolveIdentity() data = %v, want no identity", data)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveIdentity() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(data[IdentityDataKey], tt.want) {
+				t.Errorf("resolveIdentity() data = %v, want %v", data[IdentityDataKey], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// InstancePrincipalsKey is the key used in the template data of SSH host
+// certificates for the principals derived from the instance identity.
+const InstancePrincipalsKey = "InstancePrincipals"
+
+// InstancePrincipals are the SSH host principals that a cloud instance owns
+// according to its validated instance identity. They are available in the
+// templates of the SSH host certificates as .InstancePrincipals.
+type InstancePrincipals struct {
+	InstanceID string   `json:"instanceID,omitempty"`
+	DNSNames   []string `json:"dnsNames,omitempty"`
+	IPs        []string `json:"ips,omitempty"`
+}
+
+// List returns all the principals: the DNS names, the IPs, and the instance
+// id.
+func (p *InstancePrincipals) List() []string {
+	principals := make([]string, 0, len(p.DNSNames)+len(p.IPs)+1)
+	principals = append(principals, p.DNSNames...)
+	principals = append(principals, p.IPs...)
+	if p.InstanceID != "" {
+		principals = append(principals, p.InstanceID)
+	}
+	return principals
+}
+
+// Contains returns true if the given principal is owned by the instance. DNS
+// names are compared case-insensitively.
+func (p *InstancePrincipals) Contains(principal string) bool {
+	for _, s := range p.DNSNames {
+		if strings.EqualFold(s, principal) {
+			return true
+		}
+	}
+	for _, s := range p.IPs {
+		if s == principal {
+			return true
+		}
+	}
+	return p.InstanceID != "" && p.InstanceID == principal
+}
+
+// newAWSInstancePrincipals returns the principals of an AWS instance. The
+// private DNS name of the instances in us-east-1 uses the ec2.internal domain,
+// and the compute.internal domain in the rest of regions.
+func newAWSInstancePrincipals(doc *awsInstanceIdentityDocument) *InstancePrincipals {
+	host := "ip-" + strings.Replace(doc.PrivateIP, ".", "-", -1)
+	dnsNames := []string{fmt.Sprintf("%s.%s.compute.internal", host, doc.Region)}
+	if doc.Region == "us-east-1" {
+		dnsNames = append(dnsNames, host+".ec2.internal")
+	}
+	return &InstancePrincipals{
+		InstanceID: doc.InstanceID,
+		DNSNames:   dnsNames,
+		IPs:        []string{doc.PrivateIP},
+	}
+}
+
+// newGCPInstancePrincipals returns the principals of a GCP instance, its
+// global and zonal internal DNS names.
+func newGCPInstancePrincipals(ce *gcpComputeEnginePayload) *InstancePrincipals {
+	return &InstancePrincipals{
+		InstanceID: ce.InstanceID,
+		DNSNames: []string{
+			fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
+			fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID),
+		},
+	}
+}
+
+// newAzureInstancePrincipals returns the principals of an Azure virtual
+// machine. Azure tokens do not include the IPs or the id of the virtual
+// machine, so only its name is used.
+func newAzureInstancePrincipals(name string) *InstancePrincipals {
+	return &InstancePrincipals{
+		DNSNames: []string{name},
+	}
+}
+
+// sshInstancePrincipalsValidator is an SSHCertValidator that checks that the
+// principals of a host certificate are owned by the instance.
+type sshInstancePrincipalsValidator struct {
+	principals *InstancePrincipals
+}
+
+// Valid returns an error if the certificate has a principal not owned by the
+// instance.
+func (v *sshInstancePrincipalsValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	for _, p := range cert.ValidPrincipals {
+		if !v.principals.Contains(p) {
+			return errors.Errorf("ssh certificate principal %s is not owned by the instance", p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package provisioner
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestInstancePrincipals(t *testing.T) {
+	aws := newAWSInstancePrincipals(&awsInstanceIdentityDocument{
+		InstanceID: "i-1234567890abcdef0",
+		PrivateIP:  "10.0.0.1",
+		Region:     "us-east-1",
+	})
+	gcp := newGCPInstancePrincipals(&gcpComputeEnginePayload{
+		InstanceID:   "1234567890",
+		InstanceName: "instance",
+		ProjectID:    "project",
+		Zone:         "us-central1-a",
+	})
+	azure := newAzureInstancePrincipals("virtualMachine")
+
+	tests := []struct {
+		name       string
+		principals *InstancePrincipals
+		want       []string
+	}{
+		{"aws", aws, []string{"ip-10-0-0-1.us-east-1.compute.internal", "ip-10-0-0-1.ec2.internal", "10.0.0.1", "i-1234567890abcdef0"}},
+		{"gcp", gcp, []string{"instance.c.project.internal", "instance.us-central1-a.c.project.internal", "1234567890"}},
+		{"azure", azure, []string{"virtualMachine"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.principals.List()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InstancePrincipals.List() = %v, want %v", got, tt.want)
+			}
+			for _, p := range got {
+				if !tt.principals.Contains(p) {
+					t.Errorf("InstancePrincipals.Contains(%s) = false, want true", p)
+				}
+			}
+			if tt.principals.Contains("foo.local") {
+				t.Error("InstancePrincipals.Contains(foo.local) = true, want false")
+			}
+		})
+	}
+}
+
+func Test_sshInstancePrincipalsValidator_Valid(t *testing.T) {
+	v := &sshInstancePrincipalsValidator{&InstancePrincipals{
+		InstanceID: "i-1234567890abcdef0",
+		DNSNames:   []string{"ip-10-0-0-1.us-west-1.compute.internal"},
+		IPs:        []string{"10.0.0.1"},
+	}}
+	tests := []struct {
+		name       string
+		principals []string
+		wantErr    bool
+	}{
+		{"ok", []string{"10.0.0.1", "IP-10-0-0-1.us-west-1.compute.internal", "i-1234567890abcdef0"}, false},
+		{"ok empty", nil, false},
+		{"fail", []string{"10.0.0.1", "foo.local"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Valid(&ssh.Certificate{ValidPrincipals: tt.principals}, SignSSHOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sshInstancePrincipalsValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
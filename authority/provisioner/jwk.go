@@ -28,15 +28,17 @@ type stepPayload struct {
 // signature requests.
 type JWK struct {
 	*base
-	ID           string           `json:"-"`
-	Type         string           `json:"type"`
-	Name         string           `json:"name"`
-	Key          *jose.JSONWebKey `json:"key"`
-	EncryptedKey string           `json:"encryptedKey,omitempty"`
-	Claims       *Claims          `json:"claims,omitempty"`
-	Options      *Options         `json:"options,omitempty"`
-	claimer      *Claimer
-	audiences    Audiences
+	ID               string           `json:"-"`
+	Type             string           `json:"type"`
+	Name             string           `json:"name"`
+	Key              *jose.JSONWebKey `json:"key"`
+	EncryptedKey     string           `json:"encryptedKey,omitempty"`
+	Claims           *Claims          `json:"claims,omitempty"`
+	Options          *Options         `json:"options,omitempty"`
+	claimer          *Claimer
+	clock            Clock
+	identityResolver IdentityResolver
+	audiences        Audiences
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -87,6 +89,11 @@ func (p *JWK) GetEncryptedKey() (string, string, bool) {
 	return p.Key.KeyID, p.EncryptedKey, len(p.EncryptedKey) > 0
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *JWK) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a JWK type.
 func (p *JWK) Init(config Config) (err error) {
 	switch {
@@ -98,10 +105,17 @@ func (p *JWK) Init(config Config) (err error) {
 		return errors.New("provisioner key cannot be empty")
 	}
 
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+
+	p.clock = config.Clock
 	// Update claims with global ones
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
 
 	p.audiences = config.Audiences
 	return err
@@ -125,7 +139,7 @@ func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, err
 	// more than a few minutes.
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: p.Name,
-		Time:   time.Now().UTC(),
+		Time:   clockNow(p.clock).UTC(),
 	}, time.Minute); err != nil {
 		return nil, errs.Wrapf(http.StatusUnauthorized, err, "jwk.authorizeToken; invalid jwk claims")
 	}
@@ -169,6 +183,13 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, &IdentityDocument{
+		Subject: claims.Subject,
+		Names:   claims.SANs,
+	}, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
+	}
 
 	templateOptions, err := TemplateOptions(p.Options, data)
 	if err != nil {
@@ -177,12 +198,13 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 
 	return []SignOption{
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeJWK, p.Name, p.Key.KeyID),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
 		commonNameValidator(claims.Subject),
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		defaultSANsValidator(claims.SANs),
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
 	}, nil
@@ -196,7 +218,7 @@ func (p *JWK) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("jwk.AuthorizeRenew; renew is disabled for jwk provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
@@ -243,12 +265,19 @@ func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, &IdentityDocument{
+		Subject: claims.Subject,
+		Names:   principals,
+	}, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSSHSign")
+	}
 
 	templateOptions, err := TemplateSSHOptions(p.Options, data)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
 	}
-	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, templateOptions, identity)
 
 	// Add modifiers from custom claims
 	t := now()
@@ -263,7 +292,7 @@ func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.claimer},
 		// Require and validate all the default fields in the SSH certificate.
@@ -295,10 +295,13 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 				}
 			} else {
 				if assert.NotNil(t, got) {
-					assert.Len(t, 7, got)
+					assert.Len(t, 8, got)
 					for _, o := range got {
 						switch v := o.(type) {
 						case certificateOptionsFunc:
+						case *IdentityDocument:
+							assert.Equals(t, v.Provisioner, tt.prov.GetName())
+							assert.Equals(t, v.Subject, "subject")
 						case *provisionerExtensionOption:
 							assert.Equals(t, v.Type, int(TypeJWK))
 							assert.Equals(t, v.Name, tt.prov.GetName())
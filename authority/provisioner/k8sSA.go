@@ -42,14 +42,16 @@ type k8sSAPayload struct {
 // entity trusted to make signature requests.
 type K8sSA struct {
 	*base
-	ID        string   `json:"-"`
-	Type      string   `json:"type"`
-	Name      string   `json:"name"`
-	PubKeys   []byte   `json:"publicKeys,omitempty"`
-	Claims    *Claims  `json:"claims,omitempty"`
-	Options   *Options `json:"options,omitempty"`
-	claimer   *Claimer
-	audiences Audiences
+	ID               string   `json:"-"`
+	Type             string   `json:"type"`
+	Name             string   `json:"name"`
+	PubKeys          []byte   `json:"publicKeys,omitempty"`
+	Claims           *Claims  `json:"claims,omitempty"`
+	Options          *Options `json:"options,omitempty"`
+	claimer          *Claimer
+	clock            Clock
+	identityResolver IdentityResolver
+	audiences        Audiences
 	//kauthn    kauthn.AuthenticationV1Interface
 	pubKeys []interface{}
 }
@@ -90,6 +92,11 @@ func (p *K8sSA) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *K8sSA) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a K8sSA type.
 func (p *K8sSA) Init(config Config) (err error) {
 	switch {
@@ -138,10 +145,17 @@ func (p *K8sSA) Init(config Config) (err error) {
 		p.kauthn = k8s.AuthenticationV1()
 	*/
 
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+
+	p.clock = config.Clock
 	// Update claims with global ones
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
 
 	p.audiences = config.Audiences
 	return err
@@ -228,6 +242,10 @@ func (p *K8sSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newK8sSAIdentityDocument(claims), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSign")
+	}
 
 	// Certificate templates: on K8sSA the default template is the certificate
 	// request.
@@ -238,21 +256,36 @@ func (p *K8sSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 
 	return []SignOption{
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeK8sSA, p.Name, ""),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
 	}, nil
 }
 
+// newK8sSAIdentityDocument returns the identity document of the service
+// account in the given token.
+func newK8sSAIdentityDocument(claims *k8sSAPayload) *IdentityDocument {
+	return &IdentityDocument{
+		Subject: claims.ServiceAccountName,
+		Names:   []string{claims.ServiceAccountName},
+		Attributes: map[string]interface{}{
+			"namespace":          claims.Namespace,
+			"serviceAccountUID":  claims.ServiceAccountUID,
+			"serviceAccountName": claims.ServiceAccountName,
+		},
+	}
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 func (p *K8sSA) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("k8ssa.AuthorizeRenew; renew is disabled for k8sSA provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
 
 // AuthorizeSSHSign validates an request for an SSH certificate.
@@ -271,12 +304,16 @@ func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, newK8sSAIdentityDocument(claims), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSSHSign")
+	}
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.CertificateRequestTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSSHSign")
 	}
-	signOptions := []SignOption{templateOptions}
+	signOptions := []SignOption{templateOptions, identity}
 
 	return append(signOptions,
 		// Require type, key-id and principals in the SignSSHOptions.
@@ -284,7 +321,7 @@ func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.claimer},
 		// Require and validate all the default fields in the SSH certificate.
@@ -275,6 +275,8 @@ func TestK8sSA_AuthorizeSign(t *testing.T) {
 						for _, o := range opts {
 							switch v := o.(type) {
 							case certificateOptionsFunc:
+							case *IdentityDocument:
+								assert.Equals(t, v.Provisioner, tc.p.GetName())
 							case *provisionerExtensionOption:
 								assert.Equals(t, v.Type, int(TypeK8sSA))
 								assert.Equals(t, v.Name, tc.p.GetName())
@@ -291,7 +293,7 @@ func TestK8sSA_AuthorizeSign(t *testing.T) {
 							}
 							tot++
 						}
-						assert.Equals(t, tot, 5)
+						assert.Equals(t, tot, 6)
 					}
 				}
 			}
@@ -362,6 +364,8 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 						for _, o := range opts {
 							switch v := o.(type) {
 							case sshCertificateOptionsFunc:
+							case *IdentityDocument:
+								assert.Equals(t, v.Provisioner, tc.p.GetName())
 							case *sshCertOptionsRequireValidator:
 								assert.Equals(t, v, &sshCertOptionsRequireValidator{CertType: true, KeyID: true, Principals: true})
 							case *sshCertValidityValidator:
@@ -375,7 +379,7 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 							}
 							tot++
 						}
-						assert.Equals(t, tot, 6)
+						assert.Equals(t, tot, 7)
 					}
 				}
 			}
@@ -0,0 +1,155 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
+	"golang.org/x/crypto/ssh"
+)
+
+// Curve names supported in a KeyPolicy.
+const (
+	CurveP256    = "P-256"
+	CurveP384    = "P-384"
+	CurveP521    = "P-521"
+	CurveEd25519 = "Ed25519"
+)
+
+// KeyPolicy restricts the public keys that can be used in the certificates
+// signed by a provisioner. The policy is applied to X.509 certificate requests
+// and SSH public keys, on top of the default validations.
+type KeyPolicy struct {
+	// MinRSAKeySize is the minimum size in bits of the RSA keys. It cannot be
+	// smaller than the default of 2048 bits.
+	MinRSAKeySize int `json:"minRSAKeySize,omitempty"`
+	// AllowedCurves is the list of elliptic curves allowed, the supported
+	// values are P-256, P-384, P-521 and Ed25519. If empty, all of them are
+	// allowed.
+	AllowedCurves []string `json:"allowedCurves,omitempty"`
+	// DisableRSA forbids the use of RSA keys.
+	DisableRSA bool `json:"disableRSA,omitempty"`
+	// RequireEd25519ForSSH only allows Ed25519 keys in SSH certificates.
+	RequireEd25519ForSSH bool `json:"requireEd25519ForSSH,omitempty"`
+}
+
+// KeyPolicyError is the error returned when a public key does not satisfy the
+// key policy of a provisioner.
+type KeyPolicyError struct {
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *KeyPolicyError) Error() string {
+	return "public key does not satisfy the key policy: " + e.Reason
+}
+
+func newKeyPolicyError(format string, args ...interface{}) *KeyPolicyError {
+	return &KeyPolicyError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Validate validates the key policy. A nil policy is valid.
+func (p *KeyPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.MinRSAKeySize != 0 && p.MinRSAKeySize < 8*keyutil.MinRSAKeyBytes {
+		return errors.Errorf("keyPolicy.minRSAKeySize cannot be smaller than %d", 8*keyutil.MinRSAKeyBytes)
+	}
+	for _, c := range p.AllowedCurves {
+		switch c {
+		case CurveP256, CurveP384, CurveP521, CurveEd25519:
+		default:
+			return errors.Errorf("keyPolicy.allowedCurves contains an unsupported curve '%s'", c)
+		}
+	}
+	return nil
+}
+
+func (p *KeyPolicy) isCurveAllowed(name string) bool {
+	if len(p.AllowedCurves) == 0 {
+		return true
+	}
+	for _, c := range p.AllowedCurves {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *KeyPolicy) validateRSA(bits int) error {
+	switch {
+	case p.DisableRSA:
+		return newKeyPolicyError("RSA keys are not allowed")
+	case bits < p.MinRSAKeySize:
+		return newKeyPolicyError("RSA keys must be at least %d bits", p.MinRSAKeySize)
+	default:
+		return nil
+	}
+}
+
+func (p *KeyPolicy) validateCurve(name string) error {
+	if !p.isCurveAllowed(name) {
+		return newKeyPolicyError("curve %s is not allowed, allowed curves are %s", name, strings.Join(p.AllowedCurves, ", "))
+	}
+	return nil
+}
+
+// ValidateKey validates the given public key against the policy. It returns
+// a *KeyPolicyError if the key is not allowed. A nil policy allows any key.
+func (p *KeyPolicy) ValidateKey(pub crypto.PublicKey) error {
+	if p == nil {
+		return nil
+	}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return p.validateRSA(8 * k.Size())
+	case *ecdsa.PublicKey:
+		return p.validateCurve(k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return p.validateCurve(CurveEd25519)
+	default:
+		return errors.Errorf("unrecognized public key of type '%T'", k)
+	}
+}
+
+// ValidateSSHKey validates the given SSH public key against the policy. It
+// returns a *KeyPolicyError if the key is not allowed. A nil policy allows any
+// key.
+func (p *KeyPolicy) ValidateSSHKey(key ssh.PublicKey) error {
+	if p == nil {
+		return nil
+	}
+	typ := key.Type()
+	if p.RequireEd25519ForSSH && typ != ssh.KeyAlgoED25519 && typ != ssh.KeyAlgoSKED25519 {
+		return newKeyPolicyError("SSH certificates require Ed25519 keys")
+	}
+	switch typ {
+	case ssh.KeyAlgoRSA:
+		_, in, ok := sshParseString(key.Marshal())
+		if !ok {
+			return errors.New("ssh public key is invalid")
+		}
+		k, err := sshParseRSAPublicKey(in)
+		if err != nil {
+			return err
+		}
+		return p.validateRSA(8 * k.Size())
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoSKECDSA256:
+		return p.validateCurve(CurveP256)
+	case ssh.KeyAlgoECDSA384:
+		return p.validateCurve(CurveP384)
+	case ssh.KeyAlgoECDSA521:
+		return p.validateCurve(CurveP521)
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519:
+		return p.validateCurve(CurveEd25519)
+	default:
+		return newKeyPolicyError("SSH key type %s is not allowed", typ)
+	}
+}
@@ -0,0 +1,115 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKeyPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *KeyPolicy
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &KeyPolicy{}, false},
+		{"ok", &KeyPolicy{MinRSAKeySize: 3072, AllowedCurves: []string{CurveP256, CurveP384, CurveP521, CurveEd25519}, RequireEd25519ForSSH: true}, false},
+		{"fail minRSAKeySize", &KeyPolicy{MinRSAKeySize: 1024}, true},
+		{"fail allowedCurves", &KeyPolicy{AllowedCurves: []string{"P-224"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("KeyPolicy.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_ValidateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name          string
+		policy        *KeyPolicy
+		key           crypto.PublicKey
+		wantErr       bool
+		wantPolicyErr bool
+	}{
+		{"ok nil", nil, rsaKey.Public(), false, false},
+		{"ok rsa", &KeyPolicy{MinRSAKeySize: 2048}, rsaKey.Public(), false, false},
+		{"ok ecdsa", &KeyPolicy{AllowedCurves: []string{CurveP256}}, p256Key.Public(), false, false},
+		{"ok ed25519", &KeyPolicy{AllowedCurves: []string{CurveEd25519}}, edKey, false, false},
+		{"ok ecdsa no curves", &KeyPolicy{DisableRSA: true}, p384Key.Public(), false, false},
+		{"fail rsa size", &KeyPolicy{MinRSAKeySize: 3072}, rsaKey.Public(), true, true},
+		{"fail rsa disabled", &KeyPolicy{DisableRSA: true}, rsaKey.Public(), true, true},
+		{"fail ecdsa curve", &KeyPolicy{AllowedCurves: []string{CurveP256}}, p384Key.Public(), true, true},
+		{"fail ed25519", &KeyPolicy{AllowedCurves: []string{CurveP256}}, edKey, true, true},
+		{"fail key type", &KeyPolicy{}, "foo", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.ValidateKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("KeyPolicy.ValidateKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, ok := err.(*KeyPolicyError); ok != tt.wantPolicyErr {
+				t.Errorf("KeyPolicy.ValidateKey() error = %T, wantPolicyErr %v", err, tt.wantPolicyErr)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_ValidateSSHKey(t *testing.T) {
+	mustSSHKey := func(pub crypto.PublicKey) ssh.PublicKey {
+		key, err := ssh.NewPublicKey(pub)
+		assert.FatalError(t, err)
+		return key
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		policy  *KeyPolicy
+		key     ssh.PublicKey
+		wantErr bool
+	}{
+		{"ok nil", nil, mustSSHKey(rsaKey.Public()), false},
+		{"ok rsa", &KeyPolicy{MinRSAKeySize: 2048}, mustSSHKey(rsaKey.Public()), false},
+		{"ok ecdsa", &KeyPolicy{AllowedCurves: []string{CurveP256}}, mustSSHKey(p256Key.Public()), false},
+		{"ok ed25519", &KeyPolicy{RequireEd25519ForSSH: true}, mustSSHKey(edKey), false},
+		{"fail rsa size", &KeyPolicy{MinRSAKeySize: 4096}, mustSSHKey(rsaKey.Public()), true},
+		{"fail rsa disabled", &KeyPolicy{DisableRSA: true}, mustSSHKey(rsaKey.Public()), true},
+		{"fail ecdsa curve", &KeyPolicy{AllowedCurves: []string{CurveEd25519}}, mustSSHKey(p256Key.Public()), true},
+		{"fail require ed25519", &KeyPolicy{RequireEd25519ForSSH: true}, mustSSHKey(p256Key.Public()), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.ValidateSSHKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("KeyPolicy.ValidateSSHKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"encoding/json"
+	"log"
 	"math/rand"
 	"net/http"
 	"regexp"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
 	"go.step.sm/crypto/jose"
 )
 
@@ -20,70 +22,199 @@ const (
 
 var maxAgeRegex = regexp.MustCompile("max-age=([0-9]+)")
 
+// keyStoreClient is the client used to get the keys and the OpenID
+// configuration of the identity providers. The timeout prevents a slow
+// identity provider from blocking the requests that reload the keys.
+var keyStoreClient = &http.Client{Timeout: 30 * time.Second}
+
+// keyStoreMinRefresh is the minimum time between the refreshes started by
+// Get, so tokens with unknown key ids cannot flood the identity provider.
+var keyStoreMinRefresh = 10 * time.Second
+
+// KeyCache configures the cache of the OpenID configuration and the keys of an
+// identity provider. The cached values are refreshed in the background before
+// they expire, and expired values are still used, while they are refreshed,
+// so a slow or unavailable identity provider does not block the requests.
+type KeyCache struct {
+	// TTL is the time the configuration and the keys are cached. It defaults
+	// to the max-age in the Cache-Control header of the keys, or 12h.
+	TTL *Duration `json:"ttl,omitempty"`
+	// MaxStale is the maximum time the keys are used after they expire if
+	// they cannot be refreshed. By default expired keys are used until they
+	// are refreshed.
+	MaxStale *Duration `json:"maxStale,omitempty"`
+}
+
+// Validate validates the cache options.
+func (c *KeyCache) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.TTL != nil && c.TTL.Duration <= 0:
+		return errors.New("keyCache.ttl must be greater than 0")
+	case c.MaxStale != nil && c.MaxStale.Duration < 0:
+		return errors.New("keyCache.maxStale cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// keyStore caches the keys of an identity provider. The keys are refreshed in
+// the background, and if they cannot be refreshed, or the circuit breaker of
+// the provider is open, the cached keys are used.
+//
+// If configURI is set, the OpenID configuration is refreshed with the keys,
+// and the keys are loaded from its jwks_uri.
 type keyStore struct {
 	sync.RWMutex
-	uri    string
-	keySet jose.JSONWebKeySet
-	timer  *time.Timer
-	expiry time.Time
-	jitter time.Duration
+	uri         string
+	configURI   string
+	keySet      jose.JSONWebKeySet
+	timer       *time.Timer
+	expiry      time.Time
+	jitter      time.Duration
+	ttl         time.Duration
+	maxStale    time.Duration
+	breaker     *breaker.Breaker
+	refreshing  bool
+	lastRefresh time.Time
+	closed      bool
 }
 
-func newKeyStore(uri string) (*keyStore, error) {
-	keys, age, err := getKeysFromJWKsURI(uri)
+// newKeyStore creates a key store with the keys in the given uri.
+func newKeyStore(uri string, b *breaker.Breaker) (*keyStore, error) {
+	return startKeyStore(&keyStore{uri: uri, breaker: b})
+}
+
+// startKeyStore loads the keys of the given key store and starts refreshing
+// them in the background.
+func startKeyStore(ks *keyStore) (*keyStore, error) {
+	var keys jose.JSONWebKeySet
+	var age time.Duration
+	err := ks.breaker.Do(func() (err error) {
+		keys, age, err = getKeysFromJWKsURI(ks.uri)
+		return
+	})
 	if err != nil {
 		return nil, err
 	}
-	ks := &keyStore{
-		uri:    uri,
-		keySet: keys,
-		expiry: getExpirationTime(age),
-		jitter: getCacheJitter(age),
+	if ks.ttl > 0 {
+		age = ks.ttl
 	}
+	ks.keySet = keys
+	ks.expiry = getExpirationTime(age)
+	ks.jitter = getCacheJitter(age)
+	ks.lastRefresh = time.Now()
 	next := ks.nextReloadDuration(age)
-	ks.timer = time.AfterFunc(next, ks.reload)
+	ks.timer = time.AfterFunc(next, func() {
+		if ks.startRefresh(time.Now(), false) {
+			ks.reload()
+		}
+	})
 	return ks, nil
 }
 
 func (ks *keyStore) Close() {
-	ks.timer.Stop()
+	ks.Lock()
+	ks.closed = true
+	if ks.timer != nil {
+		ks.timer.Stop()
+	}
+	ks.Unlock()
 }
 
+// Get returns the keys with the given key id. The keys are never loaded in
+// the request: if they have expired, or the key id is not found, they are
+// refreshed in the background, and the cached keys are returned. Keys that
+// expired more than maxStale ago are not returned.
 func (ks *keyStore) Get(kid string) (keys []jose.JSONWebKey) {
+	now := time.Now()
 	ks.RLock()
-	// Force reload if expiration has passed
-	if time.Now().After(ks.expiry) {
-		ks.RUnlock()
-		ks.reload()
-		ks.RLock()
-	}
 	keys = ks.keySet.Key(kid)
+	expired := now.After(ks.expiry)
+	tooStale := expired && ks.maxStale > 0 && now.After(ks.expiry.Add(ks.maxStale))
 	ks.RUnlock()
-	return
+
+	if expired || len(keys) == 0 {
+		if ks.startRefresh(now, true) {
+			go ks.reload()
+		}
+	}
+	if tooStale {
+		return nil
+	}
+	return keys
+}
+
+// startRefresh returns true if the caller must reload the keys, and false if
+// they are being reloaded, or the key store has not been started or it is
+// closed. The reloads requested by Get are throttled.
+func (ks *keyStore) startRefresh(now time.Time, throttle bool) bool {
+	ks.Lock()
+	defer ks.Unlock()
+	switch {
+	case ks.timer == nil, ks.refreshing, ks.closed:
+		return false
+	case throttle && now.Before(ks.lastRefresh.Add(keyStoreMinRefresh)):
+		return false
+	}
+	ks.refreshing = true
+	ks.lastRefresh = now
+	return true
 }
 
 func (ks *keyStore) reload() {
-	var next time.Duration
-	keys, age, err := getKeysFromJWKsURI(ks.uri)
+	var keys jose.JSONWebKeySet
+	var age time.Duration
+	var uri string
+	err := ks.breaker.Do(func() (err error) {
+		keys, age, uri, err = ks.fetch()
+		return
+	})
+
+	ks.Lock()
+	defer ks.Unlock()
+	ks.refreshing = false
 	if err != nil {
-		next = ks.nextReloadDuration(ks.jitter / 2)
+		log.Printf("error refreshing the keys from %s: %v", ks.uri, err)
+		age = ks.jitter / 2
 	} else {
-		ks.Lock()
+		if ks.ttl > 0 {
+			age = ks.ttl
+		}
+		ks.uri = uri
 		ks.keySet = keys
 		ks.expiry = getExpirationTime(age)
 		ks.jitter = getCacheJitter(age)
-		next = ks.nextReloadDuration(age)
-		ks.Unlock()
 	}
+	if !ks.closed {
+		ks.timer.Reset(ks.nextReloadDuration(age))
+	}
+}
 
-	ks.Lock()
-	ks.timer.Reset(next)
-	ks.Unlock()
+// fetch loads the keys, and the OpenID configuration if configured. It returns
+// the keys, their age and their uri.
+func (ks *keyStore) fetch() (jose.JSONWebKeySet, time.Duration, string, error) {
+	ks.RLock()
+	uri := ks.uri
+	ks.RUnlock()
+	if ks.configURI != "" {
+		var c openIDConfiguration
+		if err := getAndDecode(ks.configURI, &c); err != nil {
+			return jose.JSONWebKeySet{}, 0, "", err
+		}
+		if err := c.Validate(); err != nil {
+			return jose.JSONWebKeySet{}, 0, "", errors.Wrapf(err, "error parsing %s", ks.configURI)
+		}
+		uri = c.JWKSetURI
+	}
+	keys, age, err := getKeysFromJWKsURI(uri)
+	return keys, age, uri, err
 }
 
 // nextReloadDuration would return the duration for the next rotation. If age is
 // 0 it will randomly rotate between 0-12 hours, but every time we call to Get
-// it will automatically rotate.
+// it will be refreshed in the background.
 func (ks *keyStore) nextReloadDuration(age time.Duration) time.Duration {
 	n := rand.Int63n(int64(ks.jitter))
 	age -= time.Duration(n)
@@ -92,7 +223,7 @@ func (ks *keyStore) nextReloadDuration(age time.Duration) time.Duration {
 
 func getKeysFromJWKsURI(uri string) (jose.JSONWebKeySet, time.Duration, error) {
 	var keys jose.JSONWebKeySet
-	resp, err := http.Get(uri)
+	resp, err := keyStoreClient.Get(uri)
 	if err != nil {
 		return keys, 0, errors.Wrapf(err, "failed to connect to %s", uri)
 	}
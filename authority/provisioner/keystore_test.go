@@ -3,18 +3,22 @@ package provisioner
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/breaker"
 	"go.step.sm/crypto/jose"
 )
 
 func Test_newKeyStore(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
-	ks, err := newKeyStore(srv.URL)
+	ks, err := newKeyStore(srv.URL, nil)
 	assert.FatalError(t, err)
 	defer ks.Close()
 
@@ -32,7 +36,7 @@ func Test_newKeyStore(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newKeyStore(tt.args.uri)
+			got, err := newKeyStore(tt.args.uri, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("newKeyStore() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -51,7 +55,7 @@ func Test_keyStore(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
 
-	ks, err := newKeyStore(srv.URL + "/random")
+	ks, err := newKeyStore(srv.URL+"/random", nil)
 	assert.FatalError(t, err)
 	defer ks.Close()
 	ks.RLock()
@@ -92,21 +96,23 @@ func Test_keyStore(t *testing.T) {
 }
 
 func Test_keyStore_noCache(t *testing.T) {
+	defer func(d time.Duration) { keyStoreMinRefresh = d }(keyStoreMinRefresh)
+	keyStoreMinRefresh = 0
+
 	srv := generateJWKServer(2)
 	defer srv.Close()
 
-	ks, err := newKeyStore(srv.URL + "/no-cache")
+	ks, err := newKeyStore(srv.URL+"/no-cache", nil)
 	assert.FatalError(t, err)
 	defer ks.Close()
 	ks.RLock()
 	keySet1 := ks.keySet
 	ks.RUnlock()
-	// The keys will rotate on Get.
-	// So we won't be able to find the cached ones
+	// The keys expire right away, Get returns the cached ones and refreshes
+	// them in the background.
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 0, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(keySet1.Keys[0].KeyID))
+	waitKeyStoreRefresh(t, ks)
 
 	ks.RLock()
 	keySet2 := ks.keySet
@@ -115,12 +121,12 @@ func Test_keyStore_noCache(t *testing.T) {
 		t.Error("keyStore did not rotated")
 	}
 
-	// The keys will rotate on Get.
-	// So we won't be able to find the cached ones
+	// The old keys are not in the new key set.
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 0, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(keySet1.Keys[0].KeyID))
+	waitKeyStoreRefresh(t, ks)
 	assert.Len(t, 0, ks.Get("foobar"))
+	waitKeyStoreRefresh(t, ks)
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -131,13 +137,90 @@ func Test_keyStore_noCache(t *testing.T) {
 	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&hits)
 	assert.FatalError(t, err)
-	assert.True(t, hits.Hits > 1, fmt.Sprintf("invalid number of hits: %d is not greater than 1", hits.Hits))
+	assert.True(t, hits.Hits > 3, fmt.Sprintf("invalid number of hits: %d is not greater than 3", hits.Hits))
+}
+
+// waitKeyStoreRefresh waits until the background refresh of the keys ends.
+func waitKeyStoreRefresh(t *testing.T, ks *keyStore) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ks.RLock()
+		refreshing := ks.refreshing
+		ks.RUnlock()
+		if !refreshing {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for the keys to be refreshed")
+}
+
+func Test_keyStore_KeyCache(t *testing.T) {
+	defer func(d time.Duration) { keyStoreMinRefresh = d }(keyStoreMinRefresh)
+	keyStoreMinRefresh = 0
+
+	keySet1 := must(generateJSONWebKeySet(1))[0].(jose.JSONWebKeySet)
+	keySet2 := must(generateJSONWebKeySet(1))[0].(jose.JSONWebKeySet)
+	var jwksURI atomic.Value
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Cache-Control", "max-age=86400")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(openIDConfiguration{Issuer: "the-issuer", JWKSetURI: srv.URL + jwksURI.Load().(string)})
+		case "/keys1":
+			json.NewEncoder(w).Encode(keySet1)
+		case "/keys2":
+			json.NewEncoder(w).Encode(keySet2)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// The TTL replaces the max-age of the keys.
+	jwksURI.Store("/keys1")
+	ks, err := startKeyStore(&keyStore{
+		uri:       srv.URL + "/keys1",
+		configURI: srv.URL + "/.well-known/openid-configuration",
+		ttl:       time.Minute,
+		maxStale:  time.Hour,
+	})
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.RLock()
+	expiry := ks.expiry
+	ks.RUnlock()
+	assert.True(t, expiry.Before(time.Now().Add(time.Minute)), "the ttl was not used")
+
+	// The configuration is refreshed with the keys.
+	jwksURI.Store("/keys2")
+	kid1, kid2 := keySet1.Keys[0].KeyID, keySet2.Keys[0].KeyID
+	assert.Len(t, 0, ks.Get(kid2))
+	waitKeyStoreRefresh(t, ks)
+	assert.Len(t, 1, ks.Get(kid2))
+	assert.Len(t, 0, ks.Get(kid1))
+	waitKeyStoreRefresh(t, ks)
+
+	// Stale keys are used for maxStale.
+	srv.Close()
+	ks.Lock()
+	ks.expiry = time.Now().Add(-time.Minute)
+	ks.Unlock()
+	assert.Len(t, 1, ks.Get(kid2))
+	waitKeyStoreRefresh(t, ks)
+	ks.Lock()
+	ks.expiry = time.Now().Add(-2 * time.Hour)
+	ks.Unlock()
+	assert.Len(t, 0, ks.Get(kid2))
+	waitKeyStoreRefresh(t, ks)
 }
 
 func Test_keyStore_Get(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
-	ks, err := newKeyStore(srv.URL)
+	ks, err := newKeyStore(srv.URL, nil)
 	assert.FatalError(t, err)
 	defer ks.Close()
 
@@ -163,6 +246,43 @@ func Test_keyStore_Get(t *testing.T) {
 	}
 }
 
+func Test_keyStore_breaker(t *testing.T) {
+	defer func(d time.Duration) { keyStoreMinRefresh = d }(keyStoreMinRefresh)
+	keyStoreMinRefresh = 0
+
+	keySet := must(generateJSONWebKeySet(2))[0].(jose.JSONWebKeySet)
+	var fail, hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Cache-Control", "max-age=0")
+		json.NewEncoder(w).Encode(keySet)
+	}))
+	defer srv.Close()
+
+	b := breaker.New("oidc", &breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Hour})
+	ks, err := newKeyStore(srv.URL, b)
+	assert.FatalError(t, err)
+	defer ks.Close()
+
+	// The cached keys are used if the keys cannot be reloaded, and the
+	// breaker stops the reloads once it opens.
+	atomic.StoreInt32(&fail, 1)
+	kid := keySet.Keys[0].KeyID
+	want := ks.keySet.Key(kid)
+	assert.Len(t, 1, want)
+	assert.Equals(t, want, ks.Get(kid))
+	waitKeyStoreRefresh(t, ks)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&hits))
+	assert.Equals(t, breaker.StateOpen, b.State())
+	assert.Equals(t, want, ks.Get(kid))
+	waitKeyStoreRefresh(t, ks)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&hits))
+}
+
 func Test_abs(t *testing.T) {
 	maxInt64 := time.Duration(1<<63 - 1)
 	minInt64 := time.Duration(-1 << 63)
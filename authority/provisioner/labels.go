@@ -0,0 +1,55 @@
+package provisioner
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stepOIDLabels is the OID of the extension with the labels of a certificate.
+var stepOIDLabels = append(asn1.ObjectIdentifier(nil), append(stepOIDRoot, 3)...)
+
+// CreateLabelsExtension returns a non-critical X.509 extension with the given
+// labels, encoded as a sequence of "key=value" strings sorted by key.
+func CreateLabelsExtension(labels map[string]string) (pkix.Extension, error) {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	b, err := asn1.Marshal(pairs)
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling labels extension")
+	}
+	return pkix.Extension{
+		Id:       stepOIDLabels,
+		Critical: false,
+		Value:    b,
+	}, nil
+}
+
+// GetLabels returns the labels in the first labels extension in the given
+// list.
+func GetLabels(extensions []pkix.Extension) (map[string]string, bool) {
+	for _, e := range extensions {
+		if e.Id.Equal(stepOIDLabels) {
+			var pairs []string
+			if _, err := asn1.Unmarshal(e.Value, &pairs); err != nil {
+				return nil, false
+			}
+			labels := make(map[string]string, len(pairs))
+			for _, p := range pairs {
+				parts := strings.SplitN(p, "=", 2)
+				if len(parts) != 2 {
+					return nil, false
+				}
+				labels[parts[0]] = parts[1]
+			}
+			return labels, true
+		}
+	}
+	return nil, false
+}
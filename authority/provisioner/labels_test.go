@@ -0,0 +1,50 @@
+package provisioner
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestCreateLabelsExtension(t *testing.T) {
+	labels := map[string]string{"team": "platform", "env": "prod", "empty": ""}
+	ext, err := CreateLabelsExtension(labels)
+	assert.FatalError(t, err)
+	assert.Equals(t, stepOIDLabels, ext.Id)
+	assert.False(t, ext.Critical)
+
+	var pairs []string
+	_, err = asn1.Unmarshal(ext.Value, &pairs)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"empty=", "env=prod", "team=platform"}, pairs)
+
+	got, ok := GetLabels([]pkix.Extension{{Id: stepOIDProvisioner}, ext})
+	assert.True(t, ok)
+	assert.Equals(t, labels, got)
+}
+
+func TestGetLabels(t *testing.T) {
+	bad, err := asn1.Marshal([]string{"team"})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		extensions []pkix.Extension
+		want       map[string]string
+		wantOK     bool
+	}{
+		{"none", nil, nil, false},
+		{"other", []pkix.Extension{{Id: stepOIDProvisioner}}, nil, false},
+		{"fail asn1", []pkix.Extension{{Id: stepOIDLabels, Value: []byte("foo")}}, nil, false},
+		{"fail pair", []pkix.Extension{{Id: stepOIDLabels, Value: bad}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GetLabels(tt.extensions)
+			assert.Equals(t, tt.wantOK, ok)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
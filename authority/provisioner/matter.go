@@ -0,0 +1,140 @@
+package provisioner
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// OIDs of the Matter distinguished name attributes.
+var (
+	OIDMatterVendorID  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37244, 2, 1}
+	OIDMatterProductID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37244, 2, 2}
+)
+
+// MatterDACTemplate is the default template used by provisioners with the
+// Matter profile enabled. The vendor and product ids are added to the subject
+// after rendering the template.
+const MatterDACTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"keyUsage": ["digitalSignature"],
+	"basicConstraints": {"isCA": false}
+}`
+
+// matterIDRegexp matches the Matter vendor and product ids, encoded as four
+// uppercase hexadecimal digits.
+var matterIDRegexp = regexp.MustCompile(`^[0-9A-F]{4}$`)
+
+// MatterOptions enables the Matter profile in a provisioner. With the profile
+// enabled, the provisioner issues Device Attestation Certificates (DAC) and
+// the authority intermediate acts as the Product Attestation Intermediate
+// (PAI).
+type MatterOptions struct {
+	// VendorID is the vendor id of the PAI, e.g. "FFF1". All the DACs are
+	// issued with this vendor id.
+	VendorID string `json:"vendorID"`
+	// ProductIDs is the list of product ids that can be requested. If empty,
+	// any product id is allowed.
+	ProductIDs []string `json:"productIDs,omitempty"`
+}
+
+// GetMatter returns the Matter options.
+func (o *Options) GetMatter() *MatterOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Matter
+}
+
+// Validate validates the Matter options. Nil options are valid.
+func (o *MatterOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if !matterIDRegexp.MatchString(o.VendorID) {
+		return errors.Errorf("matter vendorID %q must be four uppercase hexadecimal digits", o.VendorID)
+	}
+	for _, pid := range o.ProductIDs {
+		if !matterIDRegexp.MatchString(pid) {
+			return errors.Errorf("matter productID %q must be four uppercase hexadecimal digits", pid)
+		}
+	}
+	return nil
+}
+
+// MatterIDs are the vendor and product ids of a Matter device. They are sent
+// in the template data of a sign request, e.g. {"vendorID": "FFF1",
+// "productID": "8000"}.
+type MatterIDs struct {
+	VendorID  string `json:"vendorID"`
+	ProductID string `json:"productID"`
+}
+
+// GetMatterIDs returns the vendor and product ids requested in the given sign
+// options. The vendor id defaults to the one in the Matter options, and the
+// ids are validated against them.
+func (o *MatterOptions) GetMatterIDs(so SignOptions) (*MatterIDs, error) {
+	ids := new(MatterIDs)
+	if len(so.TemplateData) > 0 {
+		if err := json.Unmarshal(so.TemplateData, ids); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling template data")
+		}
+	}
+	if ids.VendorID == "" {
+		ids.VendorID = o.VendorID
+	}
+	switch {
+	case ids.VendorID != o.VendorID:
+		return nil, errors.Errorf("matter vendorID %q is not allowed", ids.VendorID)
+	case ids.ProductID == "":
+		return nil, errors.New("matter productID cannot be empty")
+	case !matterIDRegexp.MatchString(ids.ProductID):
+		return nil, errors.Errorf("matter productID %q must be four uppercase hexadecimal digits", ids.ProductID)
+	case len(o.ProductIDs) == 0:
+		return ids, nil
+	}
+	for _, pid := range o.ProductIDs {
+		if pid == ids.ProductID {
+			return ids, nil
+		}
+	}
+	return nil, errors.Errorf("matter productID %q is not allowed", ids.ProductID)
+}
+
+// MatterAttribute returns the distinguished name attribute with the given
+// Matter id. The value is encoded as a UTF8String.
+func MatterAttribute(oid asn1.ObjectIdentifier, id string) pkix.AttributeTypeAndValue {
+	return pkix.AttributeTypeAndValue{
+		Type: oid,
+		Value: asn1.RawValue{
+			Tag:   asn1.TagUTF8String,
+			Bytes: []byte(id),
+		},
+	}
+}
+
+// GetMatterID returns the value of the Matter attribute with the given OID in
+// a distinguished name, or an empty string if it's not present.
+func GetMatterID(name pkix.Name, oid asn1.ObjectIdentifier) string {
+	for _, atv := range name.Names {
+		if atv.Type.Equal(oid) {
+			if s, ok := atv.Value.(string); ok {
+				return s
+			}
+		}
+	}
+	for _, atv := range name.ExtraNames {
+		if atv.Type.Equal(oid) {
+			switch v := atv.Value.(type) {
+			case string:
+				return v
+			case asn1.RawValue:
+				return string(v.Bytes)
+			}
+		}
+	}
+	return ""
+}
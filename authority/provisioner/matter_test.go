@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestMatterOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *MatterOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &MatterOptions{VendorID: "FFF1"}, false},
+		{"ok productIDs", &MatterOptions{VendorID: "FFF1", ProductIDs: []string{"8000", "8001"}}, false},
+		{"fail empty", &MatterOptions{}, true},
+		{"fail vendorID", &MatterOptions{VendorID: "fff1"}, true},
+		{"fail productIDs", &MatterOptions{VendorID: "FFF1", ProductIDs: []string{"80000"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("MatterOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatterOptions_GetMatterIDs(t *testing.T) {
+	o := &MatterOptions{VendorID: "FFF1"}
+	restricted := &MatterOptions{VendorID: "FFF1", ProductIDs: []string{"8000"}}
+	tests := []struct {
+		name    string
+		options *MatterOptions
+		so      SignOptions
+		want    *MatterIDs
+		wantErr bool
+	}{
+		{"ok", o, SignOptions{TemplateData: []byte(`{"productID":"8001"}`)}, &MatterIDs{VendorID: "FFF1", ProductID: "8001"}, false},
+		{"ok vendorID", o, SignOptions{TemplateData: []byte(`{"vendorID":"FFF1","productID":"8001"}`)}, &MatterIDs{VendorID: "FFF1", ProductID: "8001"}, false},
+		{"ok restricted", restricted, SignOptions{TemplateData: []byte(`{"productID":"8000"}`)}, &MatterIDs{VendorID: "FFF1", ProductID: "8000"}, false},
+		{"fail json", o, SignOptions{TemplateData: []byte(`{"productID"`)}, nil, true},
+		{"fail empty", o, SignOptions{}, nil, true},
+		{"fail vendorID", o, SignOptions{TemplateData: []byte(`{"vendorID":"FFF2","productID":"8001"}`)}, nil, true},
+		{"fail productID", o, SignOptions{TemplateData: []byte(`{"productID":"80"}`)}, nil, true},
+		{"fail restricted", restricted, SignOptions{TemplateData: []byte(`{"productID":"8001"}`)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.GetMatterIDs(tt.so)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MatterOptions.GetMatterIDs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatterOptions.GetMatterIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatterAttribute(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "Matter DAC",
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				MatterAttribute(OIDMatterVendorID, "FFF1"),
+				MatterAttribute(OIDMatterProductID, "8000"),
+			},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+	assert.Equals(t, "FFF1", GetMatterID(tmpl.Subject, OIDMatterVendorID))
+	assert.Equals(t, "", GetMatterID(pkix.Name{}, OIDMatterVendorID))
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	assert.Equals(t, "FFF1", GetMatterID(crt.Subject, OIDMatterVendorID))
+	assert.Equals(t, "8000", GetMatterID(crt.Subject, OIDMatterProductID))
+
+	// The ids must be encoded as UTF8String.
+	assert.True(t, bytes.Contains(crt.RawSubject, []byte("\x0c\x04FFF1")))
+	assert.True(t, bytes.Contains(crt.RawSubject, []byte("\x0c\x048000")))
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
 	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/sshutil"
@@ -54,22 +55,25 @@ type openIDPayload struct {
 // ClientSecret is mandatory, but it can be an empty string.
 type OIDC struct {
 	*base
-	ID                    string   `json:"-"`
-	Type                  string   `json:"type"`
-	Name                  string   `json:"name"`
-	ClientID              string   `json:"clientID"`
-	ClientSecret          string   `json:"clientSecret"`
-	ConfigurationEndpoint string   `json:"configurationEndpoint"`
-	TenantID              string   `json:"tenantID,omitempty"`
-	Admins                []string `json:"admins,omitempty"`
-	Domains               []string `json:"domains,omitempty"`
-	Groups                []string `json:"groups,omitempty"`
-	ListenAddress         string   `json:"listenAddress,omitempty"`
-	Claims                *Claims  `json:"claims,omitempty"`
-	Options               *Options `json:"options,omitempty"`
+	ID                    string    `json:"-"`
+	Type                  string    `json:"type"`
+	Name                  string    `json:"name"`
+	ClientID              string    `json:"clientID"`
+	ClientSecret          string    `json:"clientSecret"`
+	ConfigurationEndpoint string    `json:"configurationEndpoint"`
+	TenantID              string    `json:"tenantID,omitempty"`
+	Admins                []string  `json:"admins,omitempty"`
+	Domains               []string  `json:"domains,omitempty"`
+	Groups                []string  `json:"groups,omitempty"`
+	ListenAddress         string    `json:"listenAddress,omitempty"`
+	Claims                *Claims   `json:"claims,omitempty"`
+	Options               *Options  `json:"options,omitempty"`
+	KeyCache              *KeyCache `json:"keyCache,omitempty"`
 	configuration         openIDConfiguration
 	keyStore              *keyStore
 	claimer               *Claimer
+	clock                 Clock
+	identityResolver      IdentityResolver
 	getIdentityFunc       GetIdentityFunc
 }
 
@@ -158,6 +162,11 @@ func (o *OIDC) GetEncryptedKey() (kid string, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (o *OIDC) GetOptions() *Options {
+	return o.Options
+}
+
 // Init validates and initializes the OIDC provider.
 func (o *OIDC) Init(config Config) (err error) {
 	switch {
@@ -178,10 +187,22 @@ func (o *OIDC) Init(config Config) (err error) {
 		}
 	}
 
+	// Validate the provisioner options
+	if err := o.Options.Validate(); err != nil {
+		return err
+	}
+
+	// Validate the cache of the identity provider
+	if err := o.KeyCache.Validate(); err != nil {
+		return err
+	}
+
+	o.clock = config.Clock
 	// Update claims with global ones
 	if o.claimer, err = NewClaimer(o.Claims, config.Claims); err != nil {
 		return err
 	}
+	o.identityResolver = config.IdentityResolver
 
 	// Decode and validate openid-configuration endpoint
 	u, err := url.Parse(o.ConfigurationEndpoint)
@@ -191,7 +212,10 @@ func (o *OIDC) Init(config Config) (err error) {
 	if !strings.Contains(u.Path, "/.well-known/openid-configuration") {
 		u.Path = path.Join(u.Path, "/.well-known/openid-configuration")
 	}
-	if err := getAndDecode(u.String(), &o.configuration); err != nil {
+	b := breaker.New("oidc "+o.Name, config.CircuitBreaker)
+	if err := b.Do(func() error {
+		return getAndDecode(u.String(), &o.configuration)
+	}); err != nil {
 		return err
 	}
 	if err := o.configuration.Validate(); err != nil {
@@ -201,9 +225,18 @@ func (o *OIDC) Init(config Config) (err error) {
 	if o.TenantID != "" {
 		o.configuration.Issuer = strings.Replace(o.configuration.Issuer, "{tenantid}", o.TenantID, -1)
 	}
-	// Get JWK key set
-	o.keyStore, err = newKeyStore(o.configuration.JWKSetURI)
-	if err != nil {
+	// Get JWK key set, the configuration and the keys are refreshed in the
+	// background. The issuer is only set here.
+	ks := &keyStore{
+		uri:       o.configuration.JWKSetURI,
+		configURI: u.String(),
+		breaker:   b,
+	}
+	if o.KeyCache != nil {
+		ks.ttl = o.KeyCache.TTL.Value()
+		ks.maxStale = o.KeyCache.MaxStale.Value()
+	}
+	if o.keyStore, err = startKeyStore(ks); err != nil {
 		return err
 	}
 
@@ -216,6 +249,27 @@ func (o *OIDC) Init(config Config) (err error) {
 	return nil
 }
 
+// newOIDCIdentityDocument returns the identity document of the user in the
+// given token.
+func newOIDCIdentityDocument(claims *openIDPayload, names []string) *IdentityDocument {
+	attrs := map[string]interface{}{
+		"issuer": claims.Issuer,
+	}
+	if claims.AuthorizedParty != "" {
+		attrs["authorizedParty"] = claims.AuthorizedParty
+	}
+	if claims.Hd != "" {
+		attrs["hostedDomain"] = claims.Hd
+	}
+	return &IdentityDocument{
+		Subject:    claims.Subject,
+		Email:      claims.Email,
+		Groups:     claims.Groups,
+		Names:      names,
+		Attributes: attrs,
+	}
+}
+
 // ValidatePayload validates the given token payload.
 func (o *OIDC) ValidatePayload(p openIDPayload) error {
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no more
@@ -223,7 +277,7 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 	if err := p.ValidateWithLeeway(jose.Expected{
 		Issuer:   o.configuration.Issuer,
 		Audience: jose.Audience{o.ClientID},
-		Time:     time.Now().UTC(),
+		Time:     clockNow(o.clock).UTC(),
 	}, time.Minute); err != nil {
 		return errs.Wrap(http.StatusUnauthorized, err, "validatePayload: failed to validate oidc token payload")
 	}
@@ -347,6 +401,10 @@ func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, o.identityResolver, o, newOIDCIdentityDocument(claims, sans), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
+	}
 
 	// Use the default template unless no-templates are configured and email is
 	// an admin, in that case we will use the CR template.
@@ -360,15 +418,31 @@ func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
 	}
 
-	return []SignOption{
+	signOptions := []SignOption{
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeOIDC, o.Name, o.ClientID),
 		profileDefaultDuration(o.claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: o.Options.GetKeyPolicy()},
 		newValidityValidator(o.claimer.MinTLSCertDuration(), o.claimer.MaxTLSCertDuration()),
-	}, nil
+	}
+
+	// Map the user in the token to the smart card logon extensions.
+	if sc := o.Options.GetSmartCardLogon(); sc != nil {
+		v, err := unsafeParseSigned(token)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "oidc.AuthorizeSign")
+		}
+		enforcer, err := newSmartCardLogonEnforcer(sc, v)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "oidc.AuthorizeSign")
+		}
+		signOptions = append(signOptions, enforcer)
+	}
+
+	return signOptions, nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -379,7 +453,7 @@ func (o *OIDC) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 	if o.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("oidc.AuthorizeRenew; renew is disabled for oidc provisioner '%s'", o.GetName())
 	}
-	return nil
+	return o.claimer.authorizeRenewalWindow(cert, clockNow(o.clock).UTC())
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
@@ -409,6 +483,10 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, o.identityResolver, o, newOIDCIdentityDocument(claims, iden.Usernames), data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHSign")
+	}
 	// Add custom extensions added in the identity function.
 	for k, v := range iden.Permissions.Extensions {
 		data.AddExtension(k, v)
@@ -433,7 +511,7 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
 	}
-	signOptions := []SignOption{templateOptions}
+	signOptions := []SignOption{templateOptions, identity}
 
 	// Admin users can use any principal, and can sign user and host certificates.
 	// Non-admin users can only use principals returned by the identityFunc, and
@@ -455,7 +533,7 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{o.claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: o.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{o.claimer},
 		// Require all the fields in the SSH certificate
@@ -478,7 +556,7 @@ func (o *OIDC) AuthorizeSSHRevoke(ctx context.Context, token string) error {
 }
 
 func getAndDecode(uri string, v interface{}) error {
-	resp, err := http.Get(uri)
+	resp, err := keyStoreClient.Get(uri)
 	if err != nil {
 		return errors.Wrapf(err, "failed to connect to %s", uri)
 	}
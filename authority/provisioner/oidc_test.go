@@ -138,6 +138,43 @@ func TestOIDC_Init(t *testing.T) {
 	}
 }
 
+func TestOIDC_Init_keyCache(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		keyCache *KeyCache
+		wantErr  bool
+	}{
+		{"ok", &KeyCache{TTL: &Duration{time.Hour}, MaxStale: &Duration{24 * time.Hour}}, false},
+		{"ok empty", &KeyCache{}, false},
+		{"fail ttl", &KeyCache{TTL: &Duration{0}}, true},
+		{"fail maxStale", &KeyCache{MaxStale: &Duration{-time.Hour}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				KeyCache:              tt.keyCache,
+			}
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				defer p.keyStore.Close()
+				assert.Equals(t, srv.URL+"/.well-known/openid-configuration", p.keyStore.configURI)
+				assert.Equals(t, tt.keyCache.TTL.Value(), p.keyStore.ttl)
+				assert.Equals(t, tt.keyCache.MaxStale.Value(), p.keyStore.maxStale)
+			}
+		})
+	}
+}
+
 func TestOIDC_authorizeToken(t *testing.T) {
 	srv := generateJWKServer(3)
 	defer srv.Close()
@@ -275,15 +312,21 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 	// Admin + Domains
 	p3.Admins = []string{"name@smallstep.com", "root@example.com"}
 	p3.Domains = []string{"smallstep.com"}
+	// Smart card logon
+	p4, err := generateOIDC()
+	assert.FatalError(t, err)
+	p4.Options = &Options{SmartCardLogon: &SmartCardLogonOptions{UPNClaim: "email"}}
 
 	// Update configuration endpoints and initialize
 	config := Config{Claims: globalProvisionerClaims}
 	p1.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	p2.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	p3.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p4.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
 	assert.FatalError(t, p1.Init(config))
 	assert.FatalError(t, p2.Init(config))
 	assert.FatalError(t, p3.Init(config))
+	assert.FatalError(t, p4.Init(config))
 
 	t1, err := generateSimpleToken("the-issuer", p1.ClientID, &keys.Keys[0])
 	assert.FatalError(t, err)
@@ -293,6 +336,11 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 	// No email
 	noEmail, err := generateToken("subject", "the-issuer", p3.ClientID, "", []string{}, time.Now(), &keys.Keys[0])
 	assert.FatalError(t, err)
+	// Email as user principal name
+	okSmartCard, err := generateSimpleToken("the-issuer", p4.ClientID, &keys.Keys[0])
+	assert.FatalError(t, err)
+	noUPN, err := generateToken("subject", "the-issuer", p4.ClientID, "", []string{}, time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
 
 	type args struct {
 		token string
@@ -301,13 +349,16 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 		name    string
 		prov    *OIDC
 		args    args
+		email   string
 		code    int
 		wantErr bool
 	}{
-		{"ok1", p1, args{t1}, http.StatusOK, false},
-		{"admin", p3, args{okAdmin}, http.StatusOK, false},
-		{"no-email", p3, args{noEmail}, http.StatusOK, false},
-		{"bad-token", p3, args{"foobar"}, http.StatusUnauthorized, true},
+		{"ok1", p1, args{t1}, "name@smallstep.com", http.StatusOK, false},
+		{"admin", p3, args{okAdmin}, "root@example.com", http.StatusOK, false},
+		{"no-email", p3, args{noEmail}, "", http.StatusOK, false},
+		{"smart-card-logon", p4, args{okSmartCard}, "name@smallstep.com", http.StatusOK, false},
+		{"fail-smart-card-logon", p4, args{noUPN}, "", http.StatusUnauthorized, true},
+		{"bad-token", p3, args{"foobar"}, "", http.StatusUnauthorized, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -323,14 +374,17 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 				assert.Nil(t, got)
 			} else {
 				if assert.NotNil(t, got) {
-					if tt.name == "admin" {
-						assert.Len(t, 5, got)
+					if tt.name == "smart-card-logon" {
+						assert.Len(t, 7, got)
 					} else {
-						assert.Len(t, 5, got)
+						assert.Len(t, 6, got)
 					}
 					for _, o := range got {
 						switch v := o.(type) {
 						case certificateOptionsFunc:
+						case *IdentityDocument:
+							assert.Equals(t, v.Provisioner, tt.prov.GetName())
+							assert.Equals(t, v.Email, tt.email)
 						case *provisionerExtensionOption:
 							assert.Equals(t, v.Type, int(TypeOIDC))
 							assert.Equals(t, v.Name, tt.prov.GetName())
@@ -344,6 +398,8 @@ func TestOIDC_AuthorizeSign(t *testing.T) {
 							assert.Equals(t, v.max, tt.prov.claimer.MaxTLSCertDuration())
 						case emailOnlyIdentity:
 							assert.Equals(t, string(v), "name@smallstep.com")
+						case *smartCardLogonEnforcer:
+							assert.Equals(t, "name@smallstep.com", v.upn)
 						default:
 							assert.FatalError(t, errors.Errorf("unexpected sign option of type %T", v))
 						}
@@ -3,6 +3,7 @@ package provisioner
 import (
 	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.step.sm/crypto/jose"
@@ -24,8 +25,26 @@ func (fn certificateOptionsFunc) Options(so SignOptions) []x509util.Option {
 // Options are a collection of custom options that can be added to
 // each provisioner.
 type Options struct {
-	X509 *X509Options `json:"x509,omitempty"`
-	SSH  *SSHOptions  `json:"ssh,omitempty"`
+	X509           *X509Options           `json:"x509,omitempty"`
+	SSH            *SSHOptions            `json:"ssh,omitempty"`
+	KeyPolicy      *KeyPolicy             `json:"keyPolicy,omitempty"`
+	CodeSigning    *CodeSigningOptions    `json:"codeSigning,omitempty"`
+	Matter         *MatterOptions         `json:"matter,omitempty"`
+	EAPTLS         *EAPTLSOptions         `json:"eapTLS,omitempty"`
+	SmartCardLogon *SmartCardLogonOptions `json:"smartCardLogon,omitempty"`
+	Approval       *ApprovalOptions       `json:"approval,omitempty"`
+	Schedule       *ScheduleOptions       `json:"schedule,omitempty"`
+
+	// Hidden omits the provisioner from the public list of provisioners. A
+	// hidden provisioner can still be used by clients that know it.
+	Hidden bool `json:"hidden,omitempty"`
+
+	// NotBefore and NotAfter limit the period in which the provisioner
+	// authorizes new certificates, e.g. for a temporary provisioner used
+	// during a migration. The certificates already issued can still be
+	// revoked after the provisioner expires.
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
 }
 
 // GetX509Options returns the X.509 options.
@@ -44,6 +63,71 @@ func (o *Options) GetSSHOptions() *SSHOptions {
 	return o.SSH
 }
 
+// IsHidden returns true if the provisioner must not be listed publicly.
+func (o *Options) IsHidden() bool {
+	return o != nil && o.Hidden
+}
+
+// IsActive returns true if the provisioner can authorize new certificates at
+// the given time.
+func (o *Options) IsActive(now time.Time) bool {
+	switch {
+	case o == nil:
+		return true
+	case o.NotBefore != nil && now.Before(*o.NotBefore):
+		return false
+	case o.NotAfter != nil && !now.Before(*o.NotAfter):
+		return false
+	default:
+		return true
+	}
+}
+
+// Validate validates the options. Nil options are valid.
+func (o *Options) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.NotBefore != nil && o.NotAfter != nil && !o.NotBefore.Before(*o.NotAfter) {
+		return errors.New("options.notAfter must be after options.notBefore")
+	}
+	if err := o.KeyPolicy.Validate(); err != nil {
+		return err
+	}
+	if err := o.CodeSigning.Validate(); err != nil {
+		return err
+	}
+	if err := o.Matter.Validate(); err != nil {
+		return err
+	}
+	if err := o.EAPTLS.Validate(); err != nil {
+		return err
+	}
+	if err := o.SmartCardLogon.Validate(); err != nil {
+		return err
+	}
+	if err := o.Approval.Validate(); err != nil {
+		return err
+	}
+	if err := o.Schedule.Validate(); err != nil {
+		return err
+	}
+	if alg := o.X509.GetSignatureAlgorithm(); alg != "" {
+		if _, err := ParseSignatureAlgorithm(alg); err != nil {
+			return errors.Wrap(err, "options.x509.signatureAlgorithm is not valid")
+		}
+	}
+	return o.X509.GetCSRPassthrough().Validate()
+}
+
+// GetKeyPolicy returns the key policy.
+func (o *Options) GetKeyPolicy() *KeyPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.KeyPolicy
+}
+
 // X509Options contains specific options for X.509 certificates.
 type X509Options struct {
 	// Template contains a X.509 certificate template. It can be a JSON template
@@ -56,6 +140,31 @@ type X509Options struct {
 	// TemplateData is a JSON object with variables that can be used in custom
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
+
+	// CSRPassthrough defines the extensions and attributes requested in the
+	// CSR that are honored.
+	CSRPassthrough *CSRPassthroughPolicy `json:"csrPassthrough,omitempty"`
+
+	// SignatureAlgorithm is the algorithm used to sign the certificates, e.g.
+	// ECDSA-SHA384. It must match the type of the intermediate key, and it is
+	// ignored if the template sets the signatureAlgorithm.
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+}
+
+// GetSignatureAlgorithm returns the name of the signature algorithm.
+func (o *X509Options) GetSignatureAlgorithm() string {
+	if o == nil {
+		return ""
+	}
+	return o.SignatureAlgorithm
+}
+
+// GetCSRPassthrough returns the CSR passthrough policy.
+func (o *X509Options) GetCSRPassthrough() *CSRPassthroughPolicy {
+	if o == nil {
+		return nil
+	}
+	return o.CSRPassthrough
 }
 
 // HasTemplate returns true if a template is defined in the provisioner options.
@@ -74,9 +183,21 @@ func TemplateOptions(o *Options, data x509util.TemplateData) (CertificateOptions
 // CustomTemplateOptions generates a CertificateOptions with the template, data
 // defined in the ProvisionerOptions, the provisioner generated data and the
 // user data provided in the request. If no template has been provided in the
-// ProvisionerOptions, the given template will be used.
+// ProvisionerOptions, the given template will be used, or the template of the
+// code signing, Matter, EAP-TLS or smart card logon profiles if they are
+// enabled.
 func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTemplate string) (CertificateOptions, error) {
 	opts := o.GetX509Options()
+	switch {
+	case o.GetCodeSigning() != nil:
+		defaultTemplate = CodeSigningTemplate
+	case o.GetMatter() != nil:
+		defaultTemplate = MatterDACTemplate
+	case o.GetEAPTLS() != nil:
+		defaultTemplate = EAPTLSTemplate
+	case o.GetSmartCardLogon() != nil:
+		defaultTemplate = SmartCardLogonTemplate
+	}
 	if data == nil {
 		data = x509util.NewTemplateData()
 	}
@@ -91,43 +212,50 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 	}
 
 	return certificateOptionsFunc(func(so SignOptions) []x509util.Option {
-		// We're not provided user data without custom templates.
-		if !opts.HasTemplate() {
-			return []x509util.Option{
-				x509util.WithTemplate(defaultTemplate, data),
-			}
-		}
+		fns := withSignatureAlgorithm(opts.GetSignatureAlgorithm(), templateOptions(opts, data, defaultTemplate, so))
+		return withCSRPassthrough(opts.GetCSRPassthrough(), data, fns)
+	}), nil
+}
 
-		// Add user provided data.
-		if len(so.TemplateData) > 0 {
-			userObject := make(map[string]interface{})
-			if err := json.Unmarshal(so.TemplateData, &userObject); err != nil {
-				data.SetUserData(map[string]interface{}{})
-			} else {
-				data.SetUserData(userObject)
-			}
+// templateOptions returns the options that render the template for the given
+// sign options.
+func templateOptions(opts *X509Options, data x509util.TemplateData, defaultTemplate string, so SignOptions) []x509util.Option {
+	// We're not provided user data without custom templates.
+	if !opts.HasTemplate() {
+		return []x509util.Option{
+			withTemplate(defaultTemplate, data),
 		}
+	}
 
-		// Load a template from a file if Template is not defined.
-		if opts.Template == "" && opts.TemplateFile != "" {
-			return []x509util.Option{
-				x509util.WithTemplateFile(opts.TemplateFile, data),
-			}
+	// Add user provided data.
+	if len(so.TemplateData) > 0 {
+		userObject := make(map[string]interface{})
+		if err := json.Unmarshal(so.TemplateData, &userObject); err != nil {
+			data.SetUserData(map[string]interface{}{})
+		} else {
+			data.SetUserData(userObject)
 		}
+	}
 
-		// Load a template from the Template fields
-		// 1. As a JSON in a string.
-		template := strings.TrimSpace(opts.Template)
-		if strings.HasPrefix(template, "{") {
-			return []x509util.Option{
-				x509util.WithTemplate(template, data),
-			}
+	// Load a template from a file if Template is not defined.
+	if opts.Template == "" && opts.TemplateFile != "" {
+		return []x509util.Option{
+			withTemplateFile(opts.TemplateFile, data),
 		}
-		// 2. As a base64 encoded JSON.
+	}
+
+	// Load a template from the Template fields
+	// 1. As a JSON in a string.
+	template := strings.TrimSpace(opts.Template)
+	if strings.HasPrefix(template, "{") {
 		return []x509util.Option{
-			x509util.WithTemplateBase64(template, data),
+			withTemplate(template, data),
 		}
-	}), nil
+	}
+	// 2. As a base64 encoded JSON.
+	return []x509util.Option{
+		withTemplateBase64(template, data),
+	}
 }
 
 // unsafeParseSigned parses the given token and returns all the claims without
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
@@ -68,6 +69,56 @@ func TestOptions_GetSSHOptions(t *testing.T) {
 	}
 }
 
+func TestOptions_IsActive(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+	tests := []struct {
+		name string
+		o    *Options
+		want bool
+	}{
+		{"nilOptions", nil, true},
+		{"empty", &Options{}, true},
+		{"ok", &Options{NotBefore: &before, NotAfter: &after}, true},
+		{"notBefore", &Options{NotBefore: &after}, false},
+		{"notAfter", &Options{NotAfter: &before}, false},
+		{"notAfterNow", &Options{NotAfter: &now}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.o.IsActive(now); got != tt.want {
+				t.Errorf("Options.IsActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	now := time.Now()
+	after := now.Add(time.Hour)
+	tests := []struct {
+		name    string
+		o       *Options
+		wantErr bool
+	}{
+		{"nilOptions", nil, false},
+		{"ok", &Options{NotBefore: &now, NotAfter: &after}, false},
+		{"okNotAfter", &Options{NotAfter: &now}, false},
+		{"fail", &Options{NotBefore: &after, NotAfter: &now}, true},
+		{"failEqual", &Options{NotBefore: &now, NotAfter: &now}, true},
+		{"okSignatureAlgorithm", &Options{X509: &X509Options{SignatureAlgorithm: "ECDSA-SHA384"}}, false},
+		{"failSignatureAlgorithm", &Options{X509: &X509Options{SignatureAlgorithm: "SHA1-RSA"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.o.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestProvisionerX509Options_HasTemplate(t *testing.T) {
 	type fields struct {
 		Template     string
@@ -200,6 +251,31 @@ func TestCustomTemplateOptions(t *testing.T) {
 	"sans": null,
 	"keyUsage": ["digitalSignature"],
 	"extKeyUsage": ["serverAuth", "clientAuth"]
+}`)}, false},
+		{"okCodeSigning", args{&Options{CodeSigning: &CodeSigningOptions{}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{
+	"subject": {"commonName":"foobar"},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["codeSigning"]
+}`)}, false},
+		{"okMatter", args{&Options{Matter: &MatterOptions{VendorID: "FFF1"}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{
+	"subject": {"commonName":"foobar"},
+	"keyUsage": ["digitalSignature"],
+	"basicConstraints": {"isCA": false}
+}`)}, false},
+		{"okEAPTLS", args{&Options{EAPTLS: &EAPTLSOptions{}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{
+	"subject": {"commonName":"foobar"},
+	"sans": [{"type":"dns","value":"foo.com"}],
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["clientAuth"]
+}`)}, false},
+		{"okSmartCardLogon", args{&Options{SmartCardLogon: &SmartCardLogonOptions{}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{
+	"subject": {"commonName":"foobar"},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["clientAuth"]
 }`)}, false},
 		{"okTemplateData", args{&Options{X509: &X509Options{TemplateData: []byte(`{"foo":"bar"}`)}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
 			CertBuffer: bytes.NewBufferString(`{
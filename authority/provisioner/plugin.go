@@ -0,0 +1,312 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner/plugin"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+)
+
+// PluginDataKey is the key used in the template data to expose the data
+// returned by a plugin.
+const PluginDataKey = "Plugin"
+
+// Plugin is a provisioner that delegates the authorization of the tokens to an
+// external process. The plugin is started by the CA with the given command and
+// arguments, and it receives the provisioner config on start. See the plugin
+// package for the details of the protocol.
+//
+// The tokens must be JWTs with the audience of the CA endpoint and the
+// fragment "plugin/<name>", e.g. "https://ca.smallstep.com/1.0/sign#plugin/sso".
+type Plugin struct {
+	*base
+	ID               string          `json:"-"`
+	Type             string          `json:"type"`
+	Name             string          `json:"name"`
+	Command          string          `json:"command"`
+	Args             []string        `json:"args,omitempty"`
+	Config           json.RawMessage `json:"config,omitempty"`
+	Timeout          *Duration       `json:"timeout,omitempty"`
+	Claims           *Claims         `json:"claims,omitempty"`
+	Options          *Options        `json:"options,omitempty"`
+	claimer          *Claimer
+	clock            Clock
+	identityResolver IdentityResolver
+	audiences        Audiences
+	client           *plugin.Client
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *Plugin) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *Plugin) GetIDForToken() string {
+	return "plugin/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *Plugin) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *Plugin) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *Plugin) GetType() Type {
+	return TypePlugin
+}
+
+// GetEncryptedKey is not available in a plugin provisioner.
+func (p *Plugin) GetEncryptedKey() (kid string, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *Plugin) GetOptions() *Options {
+	return p.Options
+}
+
+// Init initializes and validates the fields of a Plugin type and starts the
+// plugin process.
+func (p *Plugin) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.Command == "":
+		return errors.New("provisioner command cannot be empty")
+	}
+
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+
+	p.clock = config.Clock
+	// Update claims with global ones
+	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
+		return err
+	}
+	p.identityResolver = config.IdentityResolver
+	p.audiences = config.Audiences.WithFragment(p.GetIDForToken())
+
+	if p.client != nil {
+		p.client.Close()
+	}
+	p.client = plugin.NewClient(p.Command, p.Args, &plugin.InitRequest{
+		Name:   p.Name,
+		Config: p.Config,
+	}, p.Timeout.Value())
+	return p.client.Start()
+}
+
+// Close stops the plugin process.
+func (p *Plugin) Close() error {
+	if p.client == nil {
+		return nil
+	}
+	return p.client.Close()
+}
+
+// authorizeToken validates the audience and validity of the token and sends
+// it to the plugin. The plugin is responsible of verifying the rest of the
+// token.
+func (p *Plugin) authorizeToken(ctx context.Context, method, token string, audiences []string) (*plugin.AuthorizeResponse, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "plugin.authorizeToken; error parsing plugin token")
+	}
+	var claims jose.Claims
+	if err = jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "plugin.authorizeToken; error parsing plugin claims")
+	}
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Time: clockNow(p.clock).UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "plugin.authorizeToken; invalid plugin claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("plugin.authorizeToken; invalid plugin token audience claim (aud); want %s, but got %s",
+			audiences, claims.Audience)
+	}
+
+	resp, err := p.client.Authorize(ctx, &plugin.AuthorizeRequest{
+		Method:    method,
+		Token:     token,
+		Audiences: audiences,
+	})
+	if err != nil {
+		if plugin.IsUnauthorized(err) {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "plugin.authorizeToken; token rejected by plugin")
+		}
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.authorizeToken; error authorizing token")
+	}
+	return resp, nil
+}
+
+// AuthorizeSign validates the given token using the plugin.
+func (p *Plugin) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	resp, err := p.authorizeToken(ctx, plugin.MethodSign, token, p.audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSign")
+	}
+	if resp.Subject == "" {
+		return nil, errs.Unauthorized("plugin.AuthorizeSign; plugin did not return a subject")
+	}
+	if len(resp.SANs) == 0 {
+		resp.SANs = []string{resp.Subject}
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(resp.Subject, resp.SANs)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	if resp.Data != nil {
+		data.Set(PluginDataKey, resp.Data)
+	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, &IdentityDocument{
+		Subject:    resp.Subject,
+		Names:      resp.SANs,
+		Attributes: resp.Data,
+	}, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSign")
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSign")
+	}
+
+	return []SignOption{
+		templateOptions,
+		identity,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypePlugin, p.Name, ""),
+		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
+		// validators
+		commonNameValidator(resp.Subject),
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
+		defaultSANsValidator(resp.SANs),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+	}, nil
+}
+
+// AuthorizeRevoke returns an error if the plugin does not authorize the
+// revocation.
+func (p *Plugin) AuthorizeRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, plugin.MethodRevoke, token, p.audiences.Revoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeRevoke")
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *Plugin) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	if p.claimer.IsDisableRenewal() {
+		return errs.Unauthorized("plugin.AuthorizeRenew; renew is disabled for plugin provisioner '%s'", p.GetName())
+	}
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
+func (p *Plugin) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if !p.claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("plugin.AuthorizeSSHSign; sshCA is disabled for plugin provisioner '%s'", p.GetName())
+	}
+	resp, err := p.authorizeToken(ctx, plugin.MethodSSHSign, token, p.audiences.SSHSign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHSign")
+	}
+	if len(resp.Principals) == 0 {
+		return nil, errs.Unauthorized("plugin.AuthorizeSSHSign; plugin did not return any principal")
+	}
+
+	certType, certTypeName := sshutil.UserCert, SSHUserCert
+	if resp.CertType != "" {
+		if certType, err = sshutil.CertTypeFromString(resp.CertType); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHSign")
+		}
+		if certType == sshutil.HostCert {
+			certTypeName = SSHHostCert
+		}
+	}
+	keyID := resp.KeyID
+	if keyID == "" {
+		keyID = resp.Principals[0]
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(certType, keyID, resp.Principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	if resp.Data != nil {
+		data.Set(PluginDataKey, resp.Data)
+	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, &IdentityDocument{
+		Subject:    keyID,
+		Names:      resp.Principals,
+		Attributes: resp.Data,
+	}, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHSign")
+	}
+
+	templateOptions, err := TemplateSSHOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHSign")
+	}
+
+	return []SignOption{
+		templateOptions,
+		identity,
+		// Validate the requested options with the identity returned by the
+		// plugin.
+		sshCertOptionsValidator(SignSSHOptions{
+			CertType:   certTypeName,
+			KeyID:      keyID,
+			Principals: resp.Principals,
+		}),
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.claimer},
+		// Require and validate all the default fields in the SSH certificate.
+		&sshCertDefaultValidator{},
+	}, nil
+}
+
+// AuthorizeSSHRevoke returns an error if the plugin does not authorize the
+// revocation.
+func (p *Plugin) AuthorizeSSHRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, plugin.MethodSSHRevoke, token, p.audiences.SSHRevoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHRevoke")
+}
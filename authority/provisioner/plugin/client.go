@@ -0,0 +1,210 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// DefaultTimeout is the default time to wait for a plugin to start or to
+// respond a request.
+const DefaultTimeout = 10 * time.Second
+
+// Client starts a plugin and sends the requests to it. If the plugin process
+// exits, it will be started again on the next request.
+type Client struct {
+	command string
+	args    []string
+	init    *InitRequest
+	timeout time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	conn   *grpc.ClientConn
+	exited chan struct{}
+}
+
+// NewClient creates a new client for the plugin with the given command and
+// arguments. The init request is sent each time the plugin is started. If the
+// timeout is 0, DefaultTimeout will be used.
+func NewClient(command string, args []string, init *InitRequest, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{
+		command: command,
+		args:    args,
+		init:    init,
+		timeout: timeout,
+	}
+}
+
+// Start starts the plugin if it is not running.
+func (c *Client) Start() error {
+	_, err := c.connection()
+	return err
+}
+
+// Authorize sends an authorize request to the plugin.
+func (c *Client) Authorize(ctx context.Context, req *AuthorizeRequest) (*AuthorizeResponse, error) {
+	conn, err := c.connection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp := new(AuthorizeResponse)
+	if err := conn.Invoke(ctx, "/"+serviceName+"/Authorize", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Close stops the plugin.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stop()
+}
+
+func (c *Client) running() bool {
+	if c.cmd == nil {
+		return false
+	}
+	select {
+	case <-c.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// connection returns the connection with the plugin, starting it if
+// necessary.
+func (c *Client) connection() (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running() {
+		return c.conn, nil
+	}
+	c.stop()
+	if err := c.start(); err != nil {
+		c.stop()
+		return nil, err
+	}
+	return c.conn, nil
+}
+
+func (c *Client) start() error {
+	cmd := exec.Command(c.command, c.args...)
+	cmd.Env = append(os.Environ(), MagicCookieKey+"="+MagicCookieValue)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrapf(err, "error starting plugin %s", c.command)
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "error starting plugin %s", c.command)
+	}
+	exited := make(chan struct{})
+	c.cmd, c.exited = cmd, exited
+
+	// Read the handshake line, the rest of the output is discarded.
+	lines := make(chan string, 1)
+	go func() {
+		r := bufio.NewReader(stdout)
+		line, _ := r.ReadString('\n')
+		lines <- line
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				break
+			}
+		}
+		cmd.Wait()
+		close(exited)
+	}()
+
+	var line string
+	select {
+	case line = <-lines:
+	case <-time.After(c.timeout):
+		return errors.Errorf("error starting plugin %s: timeout waiting for handshake", c.command)
+	}
+	network, addr, err := parseHandshake(line)
+	if err != nil {
+		return errors.Wrapf(err, "error starting plugin %s", c.command)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	c.conn, err = grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}))
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to plugin %s", c.command)
+	}
+
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/Init", c.init, new(InitResponse)); err != nil {
+		return errors.Wrapf(err, "error initializing plugin %s", c.command)
+	}
+	return nil
+}
+
+func (c *Client) stop() error {
+	var err error
+	if c.conn != nil {
+		err = c.conn.Close()
+		c.conn = nil
+	}
+	if c.cmd != nil {
+		// Give the plugin the chance to exit cleanly.
+		if c.running() && c.cmd.Process.Signal(syscall.SIGTERM) == nil {
+			select {
+			case <-c.exited:
+			case <-time.After(c.timeout):
+			}
+		}
+		if c.running() {
+			c.cmd.Process.Kill()
+		}
+		<-c.exited
+		c.cmd = nil
+	}
+	return err
+}
+
+// parseHandshake parses the handshake line printed by a plugin and returns the
+// network and address where the plugin is listening.
+func parseHandshake(line string) (string, string, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 {
+		return "", "", errors.Errorf("invalid handshake '%s'", strings.TrimSpace(line))
+	}
+	if v, err := strconv.Atoi(parts[0]); err != nil || v != ProtocolVersion {
+		return "", "", errors.Errorf("unsupported protocol version '%s', want %d", parts[0], ProtocolVersion)
+	}
+	switch parts[1] {
+	case "unix", "tcp":
+	default:
+		return "", "", errors.Errorf("unsupported network '%s'", parts[1])
+	}
+	if parts[3] != "grpc" {
+		return "", "", errors.Errorf("unsupported protocol '%s'", parts[3])
+	}
+	return parts[1], parts[2], nil
+}
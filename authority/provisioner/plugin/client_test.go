@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+type testProvisioner struct {
+	name   string
+	config string
+}
+
+func (p *testProvisioner) Init(ctx context.Context, req *InitRequest) (*InitResponse, error) {
+	p.name = req.Name
+	p.config = string(req.Config)
+	return &InitResponse{}, nil
+}
+
+func (p *testProvisioner) Authorize(ctx context.Context, req *AuthorizeRequest) (*AuthorizeResponse, error) {
+	if req.Token != "ok" {
+		return nil, Unauthorized("invalid token %s", req.Token)
+	}
+	return &AuthorizeResponse{
+		Subject: "foo",
+		SANs:    []string{"foo", "bar"},
+		Data: map[string]interface{}{
+			"name":   p.name,
+			"config": p.config,
+			"method": req.Method,
+		},
+	}, nil
+}
+
+// TestHelperProcess is not a real test, it is used as the plugin started by
+// the other tests.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	Serve(&testProvisioner{})
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Cleanup(func() {
+		os.Unsetenv("GO_WANT_HELPER_PROCESS")
+	})
+	return NewClient(os.Args[0], []string{"-test.run=TestHelperProcess"}, &InitRequest{
+		Name:   "test",
+		Config: []byte(`{"foo":"bar"}`),
+	}, 0)
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	defer c.Close()
+	assert.FatalError(t, c.Start())
+
+	resp, err := c.Authorize(context.Background(), &AuthorizeRequest{Method: MethodSign, Token: "ok"})
+	assert.FatalError(t, err)
+	assert.Equals(t, &AuthorizeResponse{
+		Subject: "foo",
+		SANs:    []string{"foo", "bar"},
+		Data: map[string]interface{}{
+			"name":   "test",
+			"config": `{"foo":"bar"}`,
+			"method": MethodSign,
+		},
+	}, resp)
+
+	_, err = c.Authorize(context.Background(), &AuthorizeRequest{Method: MethodSign, Token: "foo"})
+	assert.Fatal(t, IsUnauthorized(err), "expected unauthorized error")
+
+	// The plugin is started again after it is stopped.
+	assert.FatalError(t, c.Close())
+	resp, err = c.Authorize(context.Background(), &AuthorizeRequest{Method: MethodRevoke, Token: "ok"})
+	assert.FatalError(t, err)
+	assert.Equals(t, MethodRevoke, resp.Data["method"])
+}
+
+func TestClient_Start(t *testing.T) {
+	c := NewClient("/does/not/exist", nil, &InitRequest{Name: "test"}, 0)
+	assert.NotNil(t, c.Start())
+
+	// Commands that are not plugins fail the handshake.
+	c = NewClient(os.Args[0], []string{"-test.run=TestParseHandshake"}, &InitRequest{Name: "test"}, 0)
+	assert.NotNil(t, c.Start())
+}
+
+func TestParseHandshake(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantNetwork string
+		wantAddr    string
+		wantErr     bool
+	}{
+		{"ok unix", "1|unix|/tmp/plugin.sock|grpc\n", "unix", "/tmp/plugin.sock", false},
+		{"ok tcp", "1|tcp|127.0.0.1:1234|grpc", "tcp", "127.0.0.1:1234", false},
+		{"fail empty", "", "", "", true},
+		{"fail parts", "1|unix|/tmp/plugin.sock", "", "", true},
+		{"fail version", "2|unix|/tmp/plugin.sock|grpc", "", "", true},
+		{"fail network", "1|udp|127.0.0.1:1234|grpc", "", "", true},
+		{"fail protocol", "1|unix|/tmp/plugin.sock|netrpc", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, addr, err := parseHandshake(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseHandshake() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.wantNetwork, network)
+			assert.Equals(t, tt.wantAddr, addr)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Package plugin implements the protocol used by the plugin provisioners. A
+// plugin is an executable started by the CA that authorizes the requests using
+// custom authentication methods, e.g. a proprietary SSO or a badge system.
+//
+// The plugin and the CA talk gRPC over a unix socket. On start, the plugin
+// prints a handshake line with the format "version|network|address|protocol"
+// in the standard output, and then serves the requests until it is killed. A
+// plugin written in Go only needs to implement the Provisioner interface and
+// call Serve:
+//
+//	func main() {
+//		plugin.Serve(&myProvisioner{})
+//	}
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolVersion is the version of the plugin protocol.
+const ProtocolVersion = 1
+
+// MagicCookieKey and MagicCookieValue are the environment variable set by the
+// CA when a plugin is started. It is not a security measure, it only prevents
+// a plugin from being executed directly.
+const (
+	MagicCookieKey   = "STEP_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "c1d4e6a0b7f94b1e9f0a3c2d8e5b7a64"
+)
+
+// Methods sent in an AuthorizeRequest.
+const (
+	MethodSign      = "sign"
+	MethodRevoke    = "revoke"
+	MethodSSHSign   = "sshSign"
+	MethodSSHRevoke = "sshRevoke"
+)
+
+const (
+	serviceName = "step.provisioner.v1.Plugin"
+	codecName   = "json"
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec is the gRPC codec used by the plugins. Using JSON instead of
+// protocol buffers allows to write plugins without generated code.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+// InitRequest is sent to the plugin after it is started. Config is the
+// configuration of the provisioner as is written in the CA configuration.
+type InitRequest struct {
+	Name   string          `json:"name"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// InitResponse is the response of the Init method.
+type InitResponse struct{}
+
+// AuthorizeRequest asks the plugin to authorize a token. The audiences are the
+// ones accepted by the CA for the given method. The CA has already validated
+// the audience and the validity of the token, but the plugin must verify the
+// rest of the token, including the signature.
+type AuthorizeRequest struct {
+	Method    string   `json:"method"`
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences"`
+}
+
+// AuthorizeResponse contains the identity of an authorized token. The subject
+// and SANs are used in X.509 certificates, and the key id, principals and
+// certificate type in SSH certificates. Data is exposed to the templates.
+type AuthorizeResponse struct {
+	Subject    string                 `json:"subject,omitempty"`
+	SANs       []string               `json:"sans,omitempty"`
+	KeyID      string                 `json:"keyID,omitempty"`
+	Principals []string               `json:"principals,omitempty"`
+	CertType   string                 `json:"certType,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// Provisioner is the interface implemented by the plugins.
+type Provisioner interface {
+	Init(ctx context.Context, req *InitRequest) (*InitResponse, error)
+	Authorize(ctx context.Context, req *AuthorizeRequest) (*AuthorizeResponse, error)
+}
+
+// Unauthorized returns the error a plugin must return if a token is not
+// authorized.
+func Unauthorized(format string, args ...interface{}) error {
+	return status.Errorf(codes.PermissionDenied, format, args...)
+}
+
+// IsUnauthorized returns true if the given error was returned by a plugin
+// rejecting a token.
+func IsUnauthorized(err error) bool {
+	switch status.Code(err) {
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return true
+	default:
+		return false
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Provisioner)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Init", Handler: initHandler},
+		{MethodName: "Authorize", Handler: authorizeHandler},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func initHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Provisioner).Init(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/Init"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Provisioner).Init(ctx, req.(*InitRequest))
+	})
+}
+
+func authorizeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthorizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Provisioner).Authorize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/Authorize"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Provisioner).Authorize(ctx, req.(*AuthorizeRequest))
+	})
+}
+
+// Serve serves the given provisioner until the process receives a SIGINT or
+// SIGTERM. It must be called from the main function of a plugin, and it exits
+// the process if the plugin was not started by the CA.
+func Serve(p Provisioner) {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		fmt.Fprintln(os.Stderr, "This binary is a step-ca plugin and it is not meant to be executed directly.")
+		os.Exit(1)
+	}
+	if err := serve(p, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error serving plugin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func serve(p Provisioner, w *os.File) error {
+	dir, err := ioutil.TempDir("", "step-plugin")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "plugin.sock")
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&serviceDesc, p)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		srv.GracefulStop()
+	}()
+
+	if _, err := fmt.Fprintf(w, "%d|unix|%s|grpc\n", ProtocolVersion, addr); err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
@@ -0,0 +1,193 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner/plugin"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
+)
+
+type testPluginProvisioner struct{}
+
+func (p *testPluginProvisioner) Init(ctx context.Context, req *plugin.InitRequest) (*plugin.InitResponse, error) {
+	return &plugin.InitResponse{}, nil
+}
+
+func (p *testPluginProvisioner) Authorize(ctx context.Context, req *plugin.AuthorizeRequest) (*plugin.AuthorizeResponse, error) {
+	token, err := jose.ParseSigned(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	var claims jose.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject != "foo" {
+		return nil, plugin.Unauthorized("subject %s is not allowed", claims.Subject)
+	}
+	return &plugin.AuthorizeResponse{
+		Subject:    "foo",
+		SANs:       []string{"foo.smallstep.com"},
+		Principals: []string{"foo"},
+	}, nil
+}
+
+// TestPluginHelperProcess is not a real test, it is used as the plugin started
+// by the other tests.
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_PLUGIN_HELPER_PROCESS") != "1" {
+		return
+	}
+	plugin.Serve(&testPluginProvisioner{})
+}
+
+func generatePlugin(t *testing.T) *Plugin {
+	t.Helper()
+	os.Setenv("GO_WANT_PLUGIN_HELPER_PROCESS", "1")
+	t.Cleanup(func() {
+		os.Unsetenv("GO_WANT_PLUGIN_HELPER_PROCESS")
+	})
+	p := &Plugin{
+		Type:    "Plugin",
+		Name:    "test",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestPluginHelperProcess"},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	t.Cleanup(func() {
+		p.Close()
+	})
+	return p
+}
+
+func TestPlugin_Init(t *testing.T) {
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *Plugin
+		wantErr bool
+	}{
+		{"fail type", &Plugin{Name: "test", Command: os.Args[0]}, true},
+		{"fail name", &Plugin{Type: "Plugin", Command: os.Args[0]}, true},
+		{"fail command", &Plugin{Type: "Plugin", Name: "test"}, true},
+		{"fail start", &Plugin{Type: "Plugin", Name: "test", Command: "/does/not/exist"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("Plugin.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlugin_Getters(t *testing.T) {
+	p := &Plugin{Type: "Plugin", Name: "test"}
+	assert.Equals(t, "plugin/test", p.GetID())
+	assert.Equals(t, "plugin/test", p.GetIDForToken())
+	assert.Equals(t, "test", p.GetName())
+	assert.Equals(t, TypePlugin, p.GetType())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Equals(t, "", kid)
+	assert.Equals(t, "", key)
+	assert.False(t, ok)
+}
+
+func TestPlugin_AuthorizeSign(t *testing.T) {
+	p := generatePlugin(t)
+	jwk, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	aud := testAudiences.WithFragment("plugin/test").Sign[0]
+	t1, err := generateToken("foo", "issuer", aud, "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	t2, err := generateToken("bar", "issuer", aud, "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	t3, err := generateToken("foo", "issuer", testAudiences.Sign[0], "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	t4, err := generateToken("foo", "issuer", aud, "", nil, time.Now().Add(-time.Hour), jwk)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantLen    int
+		wantStatus int
+		wantErr    bool
+	}{
+		{"ok", t1, 8, http.StatusOK, false},
+		{"fail rejected", t2, 0, http.StatusUnauthorized, true},
+		{"fail audience", t3, 0, http.StatusUnauthorized, true},
+		{"fail expired", t4, 0, http.StatusUnauthorized, true},
+		{"fail token", "foo", 0, http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.AuthorizeSign(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Plugin.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				sc, ok := err.(errs.StatusCoder)
+				assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+				assert.Equals(t, tt.wantStatus, sc.StatusCode())
+				return
+			}
+			assert.Equals(t, tt.wantLen, len(got))
+			for _, o := range got {
+				switch v := o.(type) {
+				case commonNameValidator:
+					assert.Equals(t, "foo", string(v))
+				case defaultSANsValidator:
+					assert.Equals(t, []string{"foo.smallstep.com"}, []string(v))
+				}
+			}
+		})
+	}
+}
+
+func TestPlugin_AuthorizeRevoke(t *testing.T) {
+	p := generatePlugin(t)
+	jwk, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	aud := testAudiences.WithFragment("plugin/test").Revoke[0]
+	t1, err := generateToken("foo", "issuer", aud, "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	t2, err := generateToken("bar", "issuer", aud, "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+
+	assert.FatalError(t, p.AuthorizeRevoke(context.Background(), t1))
+	assert.NotNil(t, p.AuthorizeRevoke(context.Background(), t2))
+}
+
+func TestPlugin_AuthorizeSSHSign(t *testing.T) {
+	p := generatePlugin(t)
+	jwk, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	aud := testAudiences.WithFragment("plugin/test").SSHSign[0]
+	t1, err := generateToken("foo", "issuer", aud, "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	t2, err := generateToken("bar", "issuer", aud, "", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+
+	got, err := p.AuthorizeSSHSign(context.Background(), t1)
+	assert.FatalError(t, err)
+	assert.Equals(t, 7, len(got))
+	for _, o := range got {
+		if v, ok := o.(sshCertOptionsValidator); ok {
+			assert.Equals(t, SignSSHOptions{CertType: SSHUserCert, KeyID: "foo", Principals: []string{"foo"}}, SignSSHOptions(v))
+		}
+	}
+
+	_, err = p.AuthorizeSSHSign(context.Background(), t2)
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/breaker"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"golang.org/x/crypto/ssh"
@@ -48,6 +50,7 @@ var ErrAllowTokenReuse = stderrors.New("allow token reuse")
 type Audiences struct {
 	Sign      []string
 	Revoke    []string
+	Renew     []string
 	SSHSign   []string
 	SSHRevoke []string
 	SSHRenew  []string
@@ -58,6 +61,7 @@ type Audiences struct {
 func (a Audiences) All() (auds []string) {
 	auds = a.Sign
 	auds = append(auds, a.Revoke...)
+	auds = append(auds, a.Renew...)
 	auds = append(auds, a.SSHSign...)
 	auds = append(auds, a.SSHRevoke...)
 	auds = append(auds, a.SSHRenew...)
@@ -71,6 +75,7 @@ func (a Audiences) WithFragment(fragment string) Audiences {
 	ret := Audiences{
 		Sign:      make([]string, len(a.Sign)),
 		Revoke:    make([]string, len(a.Revoke)),
+		Renew:     make([]string, len(a.Renew)),
 		SSHSign:   make([]string, len(a.SSHSign)),
 		SSHRevoke: make([]string, len(a.SSHRevoke)),
 		SSHRenew:  make([]string, len(a.SSHRenew)),
@@ -90,6 +95,13 @@ func (a Audiences) WithFragment(fragment string) Audiences {
 			ret.Revoke[i] = s
 		}
 	}
+	for i, s := range a.Renew {
+		if u, err := url.Parse(s); err == nil {
+			ret.Renew[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
+		} else {
+			ret.Renew[i] = s
+		}
+	}
 	for i, s := range a.SSHSign {
 		if u, err := url.Parse(s); err == nil {
 			ret.SSHSign[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
@@ -156,6 +168,8 @@ const (
 	TypeSSHPOP Type = 9
 	// TypeSCEP is used to indicate the SCEP provisioners
 	TypeSCEP Type = 10
+	// TypePlugin is used to indicate the plugin provisioners.
+	TypePlugin Type = 11
 )
 
 // String returns the string representation of the type.
@@ -181,6 +195,8 @@ func (t Type) String() string {
 		return "SSHPOP"
 	case TypeSCEP:
 		return "SCEP"
+	case TypePlugin:
+		return "Plugin"
 	default:
 		return ""
 	}
@@ -206,6 +222,19 @@ type Config struct {
 	// GetIdentityFunc is a function that returns an identity that will be
 	// used by the provisioner to populate certificate attributes.
 	GetIdentityFunc GetIdentityFunc
+	// IsRevokedFunc is a function that returns if a certificate has been
+	// revoked. It is used by the provisioners that accept client
+	// certificates.
+	IsRevokedFunc IsRevokedFunc
+	// IdentityResolver converts the identity documents created by the
+	// provisioners before they are used in templates and policy hooks.
+	IdentityResolver IdentityResolver
+	// Clock is the source of the current time used to validate the tokens
+	// and the certificates. If nil the system clock is used.
+	Clock Clock
+	// CircuitBreaker are the settings of the circuit breakers used in the
+	// calls to the identity providers. If nil the breakers are disabled.
+	CircuitBreaker *breaker.Settings
 }
 
 type provisioner struct {
@@ -218,6 +247,20 @@ type List []Interface
 // UnmarshalJSON implements json.Unmarshaler and allows to unmarshal a list of a
 // interfaces into the right type.
 func (l *List) UnmarshalJSON(data []byte) error {
+	return l.unmarshal(data, false)
+}
+
+// UnmarshalListStrict unmarshals a list of provisioners like List does, but it
+// returns an error if a provisioner has an unknown type or an unknown field.
+func UnmarshalListStrict(data []byte) (List, error) {
+	var l List
+	if err := l.unmarshal(data, true); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *List) unmarshal(data []byte, strict bool) error {
 	ps := []json.RawMessage{}
 	if err := json.Unmarshal(data, &ps); err != nil {
 		return errors.Wrap(err, "error unmarshaling provisioner list")
@@ -251,7 +294,12 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			p = &SSHPOP{}
 		case "scep":
 			p = &SCEP{}
+		case "plugin":
+			p = &Plugin{}
 		default:
+			if strict {
+				return errors.Errorf("error unmarshaling provisioner: type '%s' is not supported", typ.Type)
+			}
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
 			// support a specific provisioner type. If we don't skip unknown
@@ -263,7 +311,11 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			// step/certificates and recompile.
 			continue
 		}
-		if err := json.Unmarshal(data, p); err != nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(p); err != nil {
 			return errors.Wrap(err, "error unmarshaling provisioner")
 		}
 		*l = append(*l, p)
@@ -358,6 +410,10 @@ type Permissions struct {
 // GetIdentityFunc is a function that returns an identity.
 type GetIdentityFunc func(ctx context.Context, p Interface, email string) (*Identity, error)
 
+// IsRevokedFunc is a function that returns if the certificate with the given
+// serial number has been revoked.
+type IsRevokedFunc func(sn string) (bool, error)
+
 // DefaultIdentityFunc return a default identity depending on the provisioner
 // type. For OIDC email is always present and the usernames might
 // contain empty strings.
@@ -34,6 +34,37 @@ func TestType_String(t *testing.T) {
 	}
 }
 
+func TestUnmarshalListStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{"ok", `[{"type":"ACME","name":"acme"},{"type":"SSHPOP","name":"sshpop"}]`, 2, false},
+		{"ok empty", `[]`, 0, false},
+		{"fail type", `[{"type":"ACME","name":"acme"},{"type":"foo","name":"foo"}]`, 0, true},
+		{"fail field", `[{"type":"ACME","name":"acme","foo":"bar"}]`, 0, true},
+		{"fail json", `{"type":"ACME","name":"acme"}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalListStrict([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalListStrict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("UnmarshalListStrict() = %v, want %d provisioners", got, tt.want)
+			}
+		})
+	}
+
+	// List skips unknown types and fields.
+	var l List
+	assert.FatalError(t, l.UnmarshalJSON([]byte(`[{"type":"ACME","name":"acme","foo":"bar"},{"type":"foo","name":"foo"}]`)))
+	assert.Len(t, 1, l)
+}
+
 func TestSanitizeSSHUserPrincipal(t *testing.T) {
 	type args struct {
 		email string
@@ -2,11 +2,41 @@ package provisioner
 
 import (
 	"context"
+	"crypto/x509"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
 )
 
+// redactedSecret is the value used to mask secrets in the provisioner
+// configuration.
+const redactedSecret = "*** redacted ***"
+
+// SCEPChallengeRequest contains the information of a SCEP request that is
+// sent to an external challenge validator.
+type SCEPChallengeRequest struct {
+	TransactionID string
+	Challenge     string
+	CSR           *x509.CertificateRequest
+}
+
+// SCEPChallengeValidator is the interface implemented by the integrations that
+// validate SCEP challenges using an external service. On success, it returns
+// the data that will be available in the certificate template.
+type SCEPChallengeValidator interface {
+	ValidateChallenge(ctx context.Context, req *SCEPChallengeRequest) (map[string]interface{}, error)
+}
+
+// SCEPChallengeNotifier is the interface implemented by the challenge
+// validators that must be notified of the result of the requests they
+// validated.
+type SCEPChallengeNotifier interface {
+	NotifySuccess(ctx context.Context, req *SCEPChallengeRequest, cert *x509.Certificate) error
+	NotifyFailure(ctx context.Context, req *SCEPChallengeRequest, err error) error
+}
+
 // SCEP is the SCEP provisioner type, an entity that can authorize the
 // SCEP provisioning flow
 type SCEP struct {
@@ -19,10 +49,29 @@ type SCEP struct {
 	ChallengePassword string   `json:"challenge,omitempty"`
 	Capabilities      []string `json:"capabilities,omitempty"`
 	// MinimumPublicKeyLength is the minimum length for public keys in CSRs
-	MinimumPublicKeyLength int      `json:"minimumPublicKeyLength,omitempty"`
-	Options                *Options `json:"options,omitempty"`
-	Claims                 *Claims  `json:"claims,omitempty"`
-	claimer                *Claimer
+	MinimumPublicKeyLength int `json:"minimumPublicKeyLength,omitempty"`
+	// RequireChallengeOnRenewal requires the challenge password on requests
+	// signed with a certificate previously issued by the CA. By default those
+	// requests are authenticated only by the existing certificate.
+	RequireChallengeOnRenewal bool `json:"requireChallengeOnRenewal,omitempty"`
+	// RequireApproval holds new enrollments for manual approval by an admin,
+	// clients will receive a PENDING response and poll for the certificate.
+	RequireApproval bool `json:"requireApproval,omitempty"`
+	// ApprovedSerialNumbers is the list of device serial numbers, in the CSR
+	// subject, that do not require manual approval.
+	ApprovedSerialNumbers []string `json:"approvedSerialNumbers,omitempty"`
+	// ApprovalExpiry is the time a held enrollment waits for a decision, and
+	// the time the decision is kept for the client to poll for it. It
+	// defaults to 24h.
+	ApprovalExpiry *Duration `json:"approvalExpiry,omitempty"`
+	// Intune validates the challenges using Microsoft Intune.
+	Intune *SCEPIntune `json:"intune,omitempty"`
+	// Jamf validates the challenges sent by Jamf Pro.
+	Jamf    *SCEPJamf `json:"jamf,omitempty"`
+	Options *Options  `json:"options,omitempty"`
+	Claims  *Claims   `json:"claims,omitempty"`
+	claimer *Claimer
+	clock   Clock
 
 	secretChallengePassword string
 }
@@ -82,6 +131,12 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.New("provisioner name cannot be empty")
 	}
 
+	// Validate the provisioner options
+	if err := s.Options.Validate(); err != nil {
+		return err
+	}
+
+	s.clock = config.Clock
 	// Update claims with global ones
 	if s.claimer, err = NewClaimer(s.Claims, config.Claims); err != nil {
 		return err
@@ -89,7 +144,7 @@ func (s *SCEP) Init(config Config) (err error) {
 
 	// Mask the actual challenge value, so it won't be marshaled
 	s.secretChallengePassword = s.ChallengePassword
-	s.ChallengePassword = "*** redacted ***"
+	s.ChallengePassword = redactedSecret
 
 	// Default to 2048 bits minimum public key length (for CSRs) if not set
 	if s.MinimumPublicKeyLength == 0 {
@@ -100,6 +155,26 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.Errorf("only minimum public keys exactly divisible by 8 are supported; %d is not exactly divisible by 8", s.MinimumPublicKeyLength)
 	}
 
+	if s.ApprovalExpiry != nil && s.ApprovalExpiry.Value() <= 0 {
+		return errors.New("approvalExpiry must be greater than 0")
+	}
+
+	// Initialize the challenge validation integrations.
+	switch {
+	case s.Intune != nil && s.Jamf != nil:
+		return errors.New("only one of intune or jamf can be configured")
+	case s.Intune != nil:
+		if err := s.Intune.Init(); err != nil {
+			return err
+		}
+	case s.Jamf != nil:
+		db, _ := config.DB.(nosql.DB)
+		s.Jamf.clock = s.clock
+		if err := s.Jamf.Init(s.Name, db); err != nil {
+			return err
+		}
+	}
+
 	// TODO: add other, SCEP specific, options?
 
 	return err
@@ -120,6 +195,64 @@ func (s *SCEP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 	}, nil
 }
 
+// AuthorizeRenew returns an error if the renewal is disabled.
+// NOTE: This method does not actually validate the certificate or check it's
+// revocation status. Just confirms that the provisioner was configured to allow
+// renewals.
+func (s *SCEP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	if s.claimer.IsDisableRenewal() {
+		return errs.Unauthorized("scep.AuthorizeRenew; renew is disabled for scep provisioner '%s'", s.GetName())
+	}
+	return s.claimer.authorizeRenewalWindow(cert, clockNow(s.clock).UTC())
+}
+
+// ShouldRequireChallengeOnRenewal returns whether the challenge password must
+// be included in renewal requests.
+func (s *SCEP) ShouldRequireChallengeOnRenewal() bool {
+	return s.RequireChallengeOnRenewal
+}
+
+// ShouldRequireApproval returns whether the enrollment with the given CSR
+// must be held for manual approval.
+func (s *SCEP) ShouldRequireApproval(csr *x509.CertificateRequest) bool {
+	if !s.RequireApproval {
+		return false
+	}
+	sn := csr.Subject.SerialNumber
+	for _, approved := range s.ApprovedSerialNumbers {
+		if sn != "" && sn == approved {
+			return false
+		}
+	}
+	return true
+}
+
+// GetApprovalExpiry returns the time a held enrollment waits for a decision.
+func (s *SCEP) GetApprovalExpiry() time.Duration {
+	if d := s.ApprovalExpiry.Value(); d > 0 {
+		return d
+	}
+	return DefaultApprovalExpiry
+}
+
+// GetChallengeValidator returns the external challenge validator, or nil if
+// the static challenge password should be used.
+func (s *SCEP) GetChallengeValidator() SCEPChallengeValidator {
+	switch {
+	case s.Intune != nil:
+		return s.Intune
+	case s.Jamf != nil:
+		return s.Jamf
+	default:
+		return nil
+	}
+}
+
+// GetJamf returns the Jamf Pro integration, or nil if it's not configured.
+func (s *SCEP) GetJamf() *SCEPJamf {
+	return s.Jamf
+}
+
 // GetChallengePassword returns the challenge password
 func (s *SCEP) GetChallengePassword() string {
 	return s.secretChallengePassword
@@ -0,0 +1,306 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/randutil"
+)
+
+const (
+	// intuneAppID is the application id of Microsoft Intune.
+	intuneAppID = "0000000a-0000-0000-c000-000000000000"
+	// intuneValidationService is the name of the Intune service that validates
+	// SCEP requests.
+	intuneValidationService = "ScepRequestValidationFEService"
+	// intuneResource is the resource of the tokens used with Intune.
+	intuneResource = "https://api.manage.microsoft.com/"
+	// intuneGraphURL is the url of the Microsoft Graph API.
+	intuneGraphURL = "https://graph.microsoft.com"
+	// intuneAPIVersion is the version of the SCEP validation API.
+	intuneAPIVersion = "2018-02-20"
+	// intuneCallerInfo identifies the CA in the requests to Intune.
+	intuneCallerInfo = "step-ca"
+	// intuneFailureHResult is the error code sent in the failure
+	// notifications, E_FAIL.
+	intuneFailureHResult = 0x80004005
+)
+
+// SCEPIntune validates SCEP challenges generated by Microsoft Intune using the
+// Intune SCEP validation API. The CA authenticates to Azure AD with the
+// credentials of an application with the scep_challenge_provider permission.
+//
+// Intune docs are available at
+// https://docs.microsoft.com/en-us/mem/intune/protect/scep-libraries-apis
+type SCEPIntune struct {
+	TenantID     string `json:"tenantID"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	// LoginURL and GraphURL allow to use national clouds, they default to
+	// the global Azure endpoints.
+	LoginURL     string `json:"loginURL,omitempty"`
+	GraphURL     string `json:"graphURL,omitempty"`
+	client       *http.Client
+	mu           sync.Mutex
+	tokens       map[string]*intuneToken
+	serviceURL   string
+	clientSecret string
+}
+
+type intuneToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	expiresAt   time.Time
+}
+
+type intuneValidationRequest struct {
+	Request struct {
+		TransactionID      string `json:"transactionId"`
+		CertificateRequest string `json:"certificateRequest"`
+		CallerInfo         string `json:"callerInfo"`
+	} `json:"request"`
+}
+
+type intuneSuccessNotification struct {
+	Notification struct {
+		TransactionID                string `json:"transactionId"`
+		CertificateRequest           string `json:"certificateRequest"`
+		CertificateThumbprint        string `json:"certificateThumbprint"`
+		CertificateSerialNumber      string `json:"certificateSerialNumber"`
+		CertificateExpirationDateUtc string `json:"certificateExpirationDateUtc"`
+		IssuingCertificateAuthority  string `json:"issuingCertificateAuthority"`
+		CAConfiguration              string `json:"caConfiguration"`
+		CertificateAuthority         string `json:"certificateAuthority"`
+		CallerInfo                   string `json:"callerInfo"`
+	} `json:"notification"`
+}
+
+type intuneFailureNotification struct {
+	Notification struct {
+		TransactionID      string `json:"transactionId"`
+		CertificateRequest string `json:"certificateRequest"`
+		HResult            int64  `json:"hResult"`
+		ErrorDescription   string `json:"errorDescription"`
+		CallerInfo         string `json:"callerInfo"`
+	} `json:"notification"`
+}
+
+// intuneValidationResponse is the response of the validation and the
+// notification requests.
+type intuneValidationResponse struct {
+	Code             string `json:"code"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+// Init validates and initializes the Intune integration.
+func (i *SCEPIntune) Init() error {
+	switch {
+	case i.TenantID == "":
+		return errors.New("intune tenantID cannot be empty")
+	case i.ClientID == "":
+		return errors.New("intune clientID cannot be empty")
+	case i.ClientSecret == "":
+		return errors.New("intune clientSecret cannot be empty")
+	}
+
+	// Mask the actual secret, so it won't be marshaled
+	if i.ClientSecret != redactedSecret {
+		i.clientSecret = i.ClientSecret
+		i.ClientSecret = redactedSecret
+	}
+
+	if i.LoginURL == "" {
+		i.LoginURL = azureOIDCBaseURL
+	}
+	if i.GraphURL == "" {
+		i.GraphURL = intuneGraphURL
+	}
+	if i.client == nil {
+		i.client = &http.Client{Timeout: 30 * time.Second}
+	}
+	i.tokens = make(map[string]*intuneToken)
+	return nil
+}
+
+// ValidateChallenge validates the SCEP request with Intune. The template data
+// returned contains the transaction id of the request.
+func (i *SCEPIntune) ValidateChallenge(ctx context.Context, req *SCEPChallengeRequest) (map[string]interface{}, error) {
+	var body intuneValidationRequest
+	body.Request.TransactionID = req.TransactionID
+	body.Request.CertificateRequest = base64.StdEncoding.EncodeToString(req.CSR.Raw)
+	body.Request.CallerInfo = intuneCallerInfo
+	if err := i.sendScepAction(ctx, "validateRequest", body); err != nil {
+		return nil, errors.Wrap(err, "error validating request with intune")
+	}
+
+	return map[string]interface{}{
+		"Provider":      "intune",
+		"TransactionID": req.TransactionID,
+	}, nil
+}
+
+// NotifySuccess notifies Intune that the certificate of a request it
+// validated has been issued.
+func (i *SCEPIntune) NotifySuccess(ctx context.Context, req *SCEPChallengeRequest, cert *x509.Certificate) error {
+	sum := sha1.Sum(cert.Raw)
+	var body intuneSuccessNotification
+	body.Notification.TransactionID = req.TransactionID
+	body.Notification.CertificateRequest = base64.StdEncoding.EncodeToString(req.CSR.Raw)
+	body.Notification.CertificateThumbprint = strings.ToUpper(hex.EncodeToString(sum[:]))
+	body.Notification.CertificateSerialNumber = fmt.Sprintf("%X", cert.SerialNumber)
+	body.Notification.CertificateExpirationDateUtc = cert.NotAfter.UTC().Format(time.RFC3339)
+	body.Notification.IssuingCertificateAuthority = cert.Issuer.String()
+	body.Notification.CAConfiguration = intuneCallerInfo
+	body.Notification.CertificateAuthority = intuneCallerInfo
+	body.Notification.CallerInfo = intuneCallerInfo
+	return errors.Wrap(i.sendScepAction(ctx, "successNotification", body), "error sending intune success notification")
+}
+
+// NotifyFailure notifies Intune that the certificate of a request it
+// validated could not be issued.
+func (i *SCEPIntune) NotifyFailure(ctx context.Context, req *SCEPChallengeRequest, err error) error {
+	var body intuneFailureNotification
+	body.Notification.TransactionID = req.TransactionID
+	body.Notification.CertificateRequest = base64.StdEncoding.EncodeToString(req.CSR.Raw)
+	body.Notification.HResult = intuneFailureHResult
+	body.Notification.ErrorDescription = err.Error()
+	body.Notification.CallerInfo = intuneCallerInfo
+	return errors.Wrap(i.sendScepAction(ctx, "failureNotification", body), "error sending intune failure notification")
+}
+
+// sendScepAction sends a request to the given action of the SCEP validation
+// service, and returns an error if the response code is not Success.
+func (i *SCEPIntune) sendScepAction(ctx context.Context, action string, body interface{}) error {
+	serviceURL, err := i.getServiceURL(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := i.getToken(ctx, intuneResource)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling intune request")
+	}
+	requestID, err := randutil.UUIDv4()
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(serviceURL, "/")+"/ScepActions/"+action, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "error creating intune request")
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("client-request-id", requestID)
+	r.Header.Set("api-version", intuneAPIVersion)
+
+	var resp intuneValidationResponse
+	if err := i.do(r, &resp); err != nil {
+		return err
+	}
+	if resp.Code != "Success" {
+		return errors.Errorf("intune rejected the request: %s %s", resp.Code, resp.ErrorDescription)
+	}
+	return nil
+}
+
+// getServiceURL returns the url of the validation service. It is discovered
+// using the Graph API the first time.
+func (i *SCEPIntune) getServiceURL(ctx context.Context) (string, error) {
+	i.mu.Lock()
+	u := i.serviceURL
+	i.mu.Unlock()
+	if u != "" {
+		return u, nil
+	}
+
+	token, err := i.getToken(ctx, i.GraphURL+"/")
+	if err != nil {
+		return "", err
+	}
+	r, err := http.NewRequestWithContext(ctx, "GET", i.GraphURL+"/v1.0/servicePrincipals/appId="+intuneAppID+"/endpoints", http.NoBody)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating graph request")
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	var endpoints struct {
+		Value []struct {
+			ProviderName string `json:"providerName"`
+			URI          string `json:"uri"`
+		} `json:"value"`
+	}
+	if err := i.do(r, &endpoints); err != nil {
+		return "", err
+	}
+	for _, e := range endpoints.Value {
+		if e.ProviderName == intuneValidationService {
+			i.mu.Lock()
+			i.serviceURL = e.URI
+			i.mu.Unlock()
+			return e.URI, nil
+		}
+	}
+	return "", errors.Errorf("intune service %s not found", intuneValidationService)
+}
+
+// getToken returns an access token for the given resource using the client
+// credentials flow.
+func (i *SCEPIntune) getToken(ctx context.Context, resource string) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if t, ok := i.tokens[resource]; ok && time.Now().Before(t.expiresAt) {
+		return t.AccessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type":    []string{"client_credentials"},
+		"client_id":     []string{i.ClientID},
+		"client_secret": []string{i.clientSecret},
+		"scope":         []string{resource + ".default"},
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", i.LoginURL+"/"+i.TenantID+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating token request")
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	t := new(intuneToken)
+	if err := i.do(r, t); err != nil {
+		return "", err
+	}
+	// Refresh the token one minute before it expires.
+	t.expiresAt = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+	i.tokens[resource] = t
+	return t.AccessToken, nil
+}
+
+func (i *SCEPIntune) do(r *http.Request, v interface{}) error {
+	resp, err := i.client.Do(r)
+	if err != nil {
+		return errors.Wrapf(err, "error doing request to %s", r.URL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("error doing request to %s: status code %d", r.URL.Host, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "error decoding response from %s", r.URL.Host)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestSCEPIntune_ValidateChallenge(t *testing.T) {
+	var srv *httptest.Server
+	var code string
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			if r.FormValue("client_secret") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		case "/v1.0/servicePrincipals/appId=" + intuneAppID + "/endpoints":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []map[string]string{
+					{"providerName": "Other", "uri": "https://example.com"},
+					{"providerName": intuneValidationService, "uri": srv.URL + "/scep"},
+				},
+			})
+		case "/scep/ScepActions/validateRequest":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"code": code})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	i := &SCEPIntune{
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		LoginURL:     srv.URL,
+		GraphURL:     srv.URL,
+	}
+	if err := i.Init(); err != nil {
+		t.Fatal(err)
+	}
+	req := &SCEPChallengeRequest{
+		TransactionID: "1234",
+		Challenge:     "challenge",
+		CSR:           &x509.CertificateRequest{Raw: []byte("csr")},
+	}
+
+	code = "Success"
+	data, err := i.ValidateChallenge(context.Background(), req)
+	if err != nil {
+		t.Fatalf("SCEPIntune.ValidateChallenge() error = %v", err)
+	}
+	if data["TransactionID"] != "1234" {
+		t.Errorf("SCEPIntune.ValidateChallenge() TransactionID = %v, want 1234", data["TransactionID"])
+	}
+
+	code = "ChallengeDecryptionError"
+	if _, err := i.ValidateChallenge(context.Background(), req); err == nil {
+		t.Error("SCEPIntune.ValidateChallenge() error = nil, want error")
+	}
+}
+
+func TestSCEPIntune_Notify(t *testing.T) {
+	var srv *httptest.Server
+	bodies := make(map[string]map[string]map[string]interface{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		case "/v1.0/servicePrincipals/appId=" + intuneAppID + "/endpoints":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []map[string]string{
+					{"providerName": intuneValidationService, "uri": srv.URL + "/scep"},
+				},
+			})
+		case "/scep/ScepActions/successNotification", "/scep/ScepActions/failureNotification":
+			var body map[string]map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			bodies[r.URL.Path] = body
+			json.NewEncoder(w).Encode(map[string]string{"code": "Success"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	i := &SCEPIntune{
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		LoginURL:     srv.URL,
+		GraphURL:     srv.URL,
+	}
+	if err := i.Init(); err != nil {
+		t.Fatal(err)
+	}
+	req := &SCEPChallengeRequest{
+		TransactionID: "1234",
+		CSR:           &x509.CertificateRequest{Raw: []byte("csr")},
+	}
+	cert := &x509.Certificate{
+		Raw:          []byte("certificate"),
+		SerialNumber: big.NewInt(0xabcdef),
+		Issuer:       pkix.Name{CommonName: "Intermediate CA"},
+		NotAfter:     time.Date(2021, 6, 4, 18, 30, 0, 0, time.UTC),
+	}
+
+	if err := i.NotifySuccess(context.Background(), req, cert); err != nil {
+		t.Fatalf("SCEPIntune.NotifySuccess() error = %v", err)
+	}
+	success := bodies["/scep/ScepActions/successNotification"]["notification"]
+	for k, want := range map[string]interface{}{
+		"transactionId":                "1234",
+		"certificateRequest":           "Y3Ny",
+		"certificateThumbprint":        "735AD571C189D7BA84464BF4A9F1D2280175B128",
+		"certificateSerialNumber":      "ABCDEF",
+		"certificateExpirationDateUtc": "2021-06-04T18:30:00Z",
+		"issuingCertificateAuthority":  "CN=Intermediate CA",
+	} {
+		if success[k] != want {
+			t.Errorf("SCEPIntune.NotifySuccess() %s = %v, want %v", k, success[k], want)
+		}
+	}
+
+	if err := i.NotifyFailure(context.Background(), req, errors.New("policy denied")); err != nil {
+		t.Fatalf("SCEPIntune.NotifyFailure() error = %v", err)
+	}
+	failure := bodies["/scep/ScepActions/failureNotification"]["notification"]
+	for k, want := range map[string]interface{}{
+		"transactionId":      "1234",
+		"hResult":            float64(intuneFailureHResult),
+		"errorDescription":   "policy denied",
+		"certificateRequest": "Y3Ny",
+	} {
+		if failure[k] != want {
+			t.Errorf("SCEPIntune.NotifyFailure() %s = %v, want %v", k, failure[k], want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+// jamfChallengesTable is the table where the challenges received from Jamf
+// Pro are stored.
+var jamfChallengesTable = []byte("scep_jamf_challenges")
+
+// DefaultJamfChallengeDuration is the default time a challenge received from
+// Jamf Pro can be used.
+var DefaultJamfChallengeDuration = time.Hour
+
+// SCEPJamf validates SCEP challenges generated by Jamf Pro. Jamf Pro sends
+// every dynamic challenge, with the attributes of the target device, to the
+// provisioner using a SCEPChallenge webhook. The challenges are stored in the
+// database, or in memory if the CA does not have one, so they can be used in
+// any replica, and they can only be used once.
+//
+// Jamf Pro webhook docs are available at
+// https://developer.jamf.com/developer-guide/docs/webhooks
+type SCEPJamf struct {
+	// WebhookUsername and WebhookPassword are the basic authentication
+	// credentials configured in the Jamf Pro webhook.
+	WebhookUsername string `json:"webhookUsername"`
+	WebhookPassword string `json:"webhookPassword"`
+	// ChallengeDuration is the time a challenge can be used after it's
+	// received, it defaults to one hour.
+	ChallengeDuration *Duration `json:"challengeDuration,omitempty"`
+	webhookPassword   string
+	name              string
+	db                nosql.DB
+	clock             Clock
+	mu                sync.Mutex
+	challenges        map[string]*jamfChallenge
+}
+
+type jamfChallenge struct {
+	Data      map[string]interface{} `json:"data"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+}
+
+// jamfWebhook is the body of a SCEPChallenge webhook.
+type jamfWebhook struct {
+	Webhook struct {
+		ID           int    `json:"id"`
+		Name         string `json:"name"`
+		WebhookEvent string `json:"webhookEvent"`
+	} `json:"webhook"`
+	Event struct {
+		Challenge     string                 `json:"challenge"`
+		ProfileUUID   string                 `json:"profileUuid"`
+		ScepServerURL string                 `json:"scepServerUrl"`
+		TargetDevice  map[string]interface{} `json:"targetDevice"`
+		TargetUser    map[string]interface{} `json:"targetUser"`
+	} `json:"event"`
+}
+
+// Init validates and initializes the Jamf integration of the provisioner with
+// the given name. The challenges are stored in the given database, if any.
+func (j *SCEPJamf) Init(name string, db nosql.DB) error {
+	switch {
+	case j.WebhookUsername == "":
+		return errors.New("jamf webhookUsername cannot be empty")
+	case j.WebhookPassword == "":
+		return errors.New("jamf webhookPassword cannot be empty")
+	case j.ChallengeDuration != nil && j.ChallengeDuration.Duration <= 0:
+		return errors.New("jamf challengeDuration must be greater than 0")
+	}
+
+	// Mask the actual password, so it won't be marshaled
+	if j.WebhookPassword != redactedSecret {
+		j.webhookPassword = j.WebhookPassword
+		j.WebhookPassword = redactedSecret
+	}
+
+	if db != nil {
+		if err := db.CreateTable(jamfChallengesTable); err != nil {
+			return errors.Wrap(err, "error creating jamf challenges table")
+		}
+	}
+	j.name = name
+	j.db = db
+	j.challenges = make(map[string]*jamfChallenge)
+	return nil
+}
+
+// challengeKey returns the key of a challenge in the database, the challenges
+// are secrets, so only their hash is stored.
+func (j *SCEPJamf) challengeKey(challenge string) []byte {
+	sum := sha256.Sum256([]byte(challenge))
+	return []byte(j.name + "/" + hex.EncodeToString(sum[:]))
+}
+
+// AuthorizeWebhook checks the basic authentication credentials of a webhook.
+func (j *SCEPJamf) AuthorizeWebhook(username, password string) bool {
+	u := subtle.ConstantTimeCompare([]byte(username), []byte(j.WebhookUsername))
+	p := subtle.ConstantTimeCompare([]byte(password), []byte(j.webhookPassword))
+	return u&p == 1
+}
+
+// AddChallenge parses the body of a SCEPChallenge webhook and stores the
+// challenge with the device and user attributes.
+func (j *SCEPJamf) AddChallenge(body []byte) error {
+	var w jamfWebhook
+	if err := json.Unmarshal(body, &w); err != nil {
+		return errors.Wrap(err, "error parsing jamf webhook")
+	}
+	if w.Webhook.WebhookEvent != "SCEPChallenge" {
+		return errors.Errorf("unsupported jamf webhook event %s", w.Webhook.WebhookEvent)
+	}
+	if w.Event.Challenge == "" {
+		return errors.New("jamf webhook does not contain a challenge")
+	}
+
+	d := DefaultJamfChallengeDuration
+	if j.ChallengeDuration != nil {
+		d = j.ChallengeDuration.Duration
+	}
+
+	now := clockNow(j.clock).UTC()
+	c := &jamfChallenge{
+		Data: map[string]interface{}{
+			"Provider":    "jamf",
+			"ProfileUUID": w.Event.ProfileUUID,
+			"Device":      w.Event.TargetDevice,
+			"User":        w.Event.TargetUser,
+		},
+		ExpiresAt: now.Add(d),
+	}
+
+	if j.db != nil {
+		// Remove expired challenges before adding the new one.
+		if err := j.pruneChallenges(now); err != nil {
+			return err
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling jamf challenge")
+		}
+		return errors.Wrap(j.db.Set(jamfChallengesTable, j.challengeKey(w.Event.Challenge), b),
+			"error storing jamf challenge")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for k, c := range j.challenges {
+		if now.After(c.ExpiresAt) {
+			delete(j.challenges, k)
+		}
+	}
+	j.challenges[w.Event.Challenge] = c
+	return nil
+}
+
+// pruneChallenges removes the expired challenges of the provisioner from the
+// database.
+func (j *SCEPJamf) pruneChallenges(now time.Time) error {
+	entries, err := j.db.List(jamfChallengesTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return errors.Wrap(err, "error listing jamf challenges")
+	}
+	prefix := j.name + "/"
+	for _, e := range entries {
+		if !strings.HasPrefix(string(e.Key), prefix) {
+			continue
+		}
+		var c jamfChallenge
+		if err := json.Unmarshal(e.Value, &c); err == nil && !now.After(c.ExpiresAt) {
+			continue
+		}
+		if err := j.db.Del(jamfChallengesTable, e.Key); err != nil {
+			return errors.Wrap(err, "error deleting jamf challenge")
+		}
+	}
+	return nil
+}
+
+// ValidateChallenge validates a challenge previously received from Jamf Pro.
+// The template data returned contains the device and user attributes sent in
+// the webhook.
+func (j *SCEPJamf) ValidateChallenge(ctx context.Context, req *SCEPChallengeRequest) (map[string]interface{}, error) {
+	if j.db != nil {
+		return j.popChallenge(req.Challenge)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	c, ok := j.challenges[req.Challenge]
+	if !ok || clockNow(j.clock).UTC().After(c.ExpiresAt) {
+		return nil, errors.New("jamf challenge not found or expired")
+	}
+	delete(j.challenges, req.Challenge)
+	return c.Data, nil
+}
+
+// popChallenge loads and deletes a challenge from the database. The challenge
+// is replaced by an expired one before deleting it, so if the same challenge
+// is used concurrently in several replicas, only one of them succeeds.
+func (j *SCEPJamf) popChallenge(challenge string) (map[string]interface{}, error) {
+	key := j.challengeKey(challenge)
+	b, err := j.db.Get(jamfChallengesTable, key)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, errors.New("jamf challenge not found or expired")
+	case err != nil:
+		return nil, errors.Wrap(err, "error loading jamf challenge")
+	}
+
+	var c jamfChallenge
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling jamf challenge")
+	}
+	if clockNow(j.clock).UTC().After(c.ExpiresAt) {
+		return nil, errors.New("jamf challenge not found or expired")
+	}
+	used, err := json.Marshal(&jamfChallenge{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling jamf challenge")
+	}
+	_, swapped, err := j.db.CmpAndSwap(jamfChallengesTable, key, b, used)
+	switch {
+	case err != nil:
+		return nil, errors.Wrap(err, "error updating jamf challenge")
+	case !swapped:
+		return nil, errors.New("jamf challenge not found or expired")
+	}
+	if err := j.db.Del(jamfChallengesTable, key); err != nil {
+		return nil, errors.Wrap(err, "error deleting jamf challenge")
+	}
+	return c.Data, nil
+}
@@ -0,0 +1,129 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+)
+
+func TestSCEPJamf(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testSCEPJamf(t, nil)
+	})
+	t.Run("db", func(t *testing.T) {
+		testSCEPJamf(t, db.NewMemoryDB())
+	})
+}
+
+func testSCEPJamf(t *testing.T, db nosql.DB) {
+	j := &SCEPJamf{
+		WebhookUsername: "jamf",
+		WebhookPassword: "password",
+	}
+	if err := j.Init("scep", db); err != nil {
+		t.Fatal(err)
+	}
+	if j.WebhookPassword != redactedSecret {
+		t.Errorf("SCEPJamf.WebhookPassword = %s, want %s", j.WebhookPassword, redactedSecret)
+	}
+	if !j.AuthorizeWebhook("jamf", "password") {
+		t.Error("SCEPJamf.AuthorizeWebhook() = false, want true")
+	}
+	if j.AuthorizeWebhook("jamf", redactedSecret) {
+		t.Error("SCEPJamf.AuthorizeWebhook() = true, want false")
+	}
+
+	body := []byte(`{
+		"webhook": {"id": 1, "name": "step-ca", "webhookEvent": "SCEPChallenge"},
+		"event": {
+			"challenge": "the-challenge",
+			"profileUuid": "C2A4E1D1",
+			"targetDevice": {"serialNumber": "C02XK0", "udid": "0000-1111"},
+			"targetUser": {"username": "jane"}
+		}
+	}`)
+	if err := j.AddChallenge(body); err != nil {
+		t.Fatalf("SCEPJamf.AddChallenge() error = %v", err)
+	}
+	if err := j.AddChallenge([]byte(`{"webhook": {"webhookEvent": "ComputerAdded"}}`)); err == nil {
+		t.Error("SCEPJamf.AddChallenge() error = nil, want error")
+	}
+
+	ctx := context.Background()
+	if _, err := j.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "foo"}); err == nil {
+		t.Error("SCEPJamf.ValidateChallenge() error = nil, want error")
+	}
+	data, err := j.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "the-challenge"})
+	if err != nil {
+		t.Fatalf("SCEPJamf.ValidateChallenge() error = %v", err)
+	}
+	device := data["Device"].(map[string]interface{})
+	if device["serialNumber"] != "C02XK0" {
+		t.Errorf("SCEPJamf.ValidateChallenge() serialNumber = %v, want C02XK0", device["serialNumber"])
+	}
+	// Challenges can only be used once.
+	if _, err := j.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "the-challenge"}); err == nil {
+		t.Error("SCEPJamf.ValidateChallenge() error = nil, want error")
+	}
+
+	// Expired challenges.
+	j.ChallengeDuration = &Duration{Duration: time.Nanosecond}
+	if err := j.AddChallenge(body); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := j.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "the-challenge"}); err == nil {
+		t.Error("SCEPJamf.ValidateChallenge() error = nil, want error")
+	}
+	if db == nil {
+		return
+	}
+
+	// Challenges are shared by the instances of the provisioner using the
+	// same database, e.g. in other replicas, and only their hash is stored.
+	j.ChallengeDuration = nil
+	if err := j.AddChallenge(body); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := db.List(jamfChallengesTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("jamf challenges table has %d entries, want 1", len(entries))
+	}
+	if string(entries[0].Key) != string(j.challengeKey("the-challenge")) {
+		t.Errorf("jamf challenge key = %s, want %s", entries[0].Key, j.challengeKey("the-challenge"))
+	}
+	replica := &SCEPJamf{
+		WebhookUsername: "jamf",
+		WebhookPassword: "password",
+	}
+	if err := replica.Init("scep", db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "the-challenge"}); err != nil {
+		t.Errorf("SCEPJamf.ValidateChallenge() error = %v", err)
+	}
+	if _, err := j.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "the-challenge"}); err == nil {
+		t.Error("SCEPJamf.ValidateChallenge() error = nil, want error")
+	}
+
+	// Challenges of other provisioners are not valid.
+	other := &SCEPJamf{
+		WebhookUsername: "jamf",
+		WebhookPassword: "password",
+	}
+	if err := other.Init("other", db); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.AddChallenge(body); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.ValidateChallenge(ctx, &SCEPChallengeRequest{Challenge: "the-challenge"}); err == nil {
+		t.Error("SCEPJamf.ValidateChallenge() error = nil, want error")
+	}
+}
@@ -0,0 +1,214 @@
+package provisioner
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxScheduleSearch is how far ahead NextWindow looks for the start of a
+// window.
+const maxScheduleSearch = 366 * 24 * time.Hour
+
+// ScheduleOptions restricts the issuance of new certificates to the change
+// windows of a provisioner, e.g. to business hours. Renewals are not
+// restricted.
+type ScheduleOptions struct {
+	// Windows is the list of allowed windows in a cron-like format with five
+	// fields: minute, hour, day of month, month and day of week. A time is in
+	// a window if it matches all the fields, e.g. "* 9-16 * * 1-5" allows the
+	// issuance from 9:00 to 16:59 on weekdays. The fields can be "*", a
+	// number, a range like "1-5", a list like "1,3,5" and a step like "*/15"
+	// or "0-30/10". The days of the week go from 0, Sunday, to 6, and 7 is
+	// also Sunday.
+	Windows []string `json:"windows"`
+	// Timezone is the IANA time zone of the windows, UTC by default.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// GetSchedule returns the schedule options.
+func (o *Options) GetSchedule() *ScheduleOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Schedule
+}
+
+// Validate validates the schedule options. Nil options are valid.
+func (o *ScheduleOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.Windows) == 0 {
+		return errors.New("schedule.windows cannot be empty")
+	}
+	for i, s := range o.Windows {
+		if _, err := parseScheduleWindow(s); err != nil {
+			return errors.Wrapf(err, "schedule.windows[%d] is not valid", i)
+		}
+	}
+	if _, err := o.location(); err != nil {
+		return errors.Wrapf(err, "schedule.timezone is not valid")
+	}
+	return nil
+}
+
+// IsAllowed returns true if new certificates can be issued at the given time.
+func (o *ScheduleOptions) IsAllowed(now time.Time) bool {
+	if o == nil {
+		return true
+	}
+	windows, loc, err := o.parse()
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+	for _, w := range windows {
+		if w.matches(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindow returns the start of the next window after the given time, or
+// false if there is none in the next year.
+func (o *ScheduleOptions) NextWindow(now time.Time) (time.Time, bool) {
+	if o == nil {
+		return now, true
+	}
+	windows, loc, err := o.parse()
+	if err != nil {
+		return time.Time{}, false
+	}
+	t := now.In(loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxScheduleSearch)
+	for t.Before(end) {
+		var dayMatch bool
+		for _, w := range windows {
+			if w.matches(t) {
+				return t, true
+			}
+			dayMatch = dayMatch || w.matchesDay(t)
+		}
+		// Skip to the next day if no window matches this one.
+		if !dayMatch {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+func (o *ScheduleOptions) location() (*time.Location, error) {
+	if o.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(o.Timezone)
+}
+
+func (o *ScheduleOptions) parse() ([]scheduleWindow, *time.Location, error) {
+	loc, err := o.location()
+	if err != nil {
+		return nil, nil, err
+	}
+	windows := make([]scheduleWindow, len(o.Windows))
+	for i, s := range o.Windows {
+		if windows[i], err = parseScheduleWindow(s); err != nil {
+			return nil, nil, err
+		}
+	}
+	return windows, loc, nil
+}
+
+// scheduleWindow contains the values allowed in the minute, hour, day of
+// month, month and day of week fields of a window as bit sets.
+type scheduleWindow [5]uint64
+
+var scheduleFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseScheduleWindow(s string) (scheduleWindow, error) {
+	var w scheduleWindow
+	fields := strings.Fields(s)
+	if len(fields) != len(scheduleFields) {
+		return w, errors.Errorf("window %q must have %d fields", s, len(scheduleFields))
+	}
+	for i, f := range fields {
+		bits, err := parseScheduleField(f, scheduleFields[i].min, scheduleFields[i].max)
+		if err != nil {
+			return w, errors.Wrapf(err, "error parsing %s of window %q", scheduleFields[i].name, s)
+		}
+		w[i] = bits
+	}
+	// Sunday is both 0 and 7.
+	if w[4]&(1<<7) != 0 {
+		w[4] |= 1
+	}
+	return w, nil
+}
+
+func parseScheduleField(s string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("invalid step %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(rng[:i])
+			hi, err2 = strconv.Atoi(rng[i+1:])
+			if err1 != nil || err2 != nil {
+				return 0, errors.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, errors.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+	return bits, nil
+}
+
+func (w scheduleWindow) matches(t time.Time) bool {
+	return w.matchesDay(t) &&
+		w[0]&(1<<uint(t.Minute())) != 0 &&
+		w[1]&(1<<uint(t.Hour())) != 0
+}
+
+func (w scheduleWindow) matchesDay(t time.Time) bool {
+	return w[2]&(1<<uint(t.Day())) != 0 &&
+		w[3]&(1<<uint(t.Month())) != 0 &&
+		w[4]&(1<<uint(t.Weekday())) != 0
+}
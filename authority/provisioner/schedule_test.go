@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestScheduleOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *ScheduleOptions
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok business hours", &ScheduleOptions{Windows: []string{"* 9-16 * * 1-5"}}, false},
+		{"ok lists and steps", &ScheduleOptions{Windows: []string{"*/15 8,12,18 1-15 1-12/2 0,7", "0-30/10 * * * *"}, Timezone: "Europe/Madrid"}, false},
+		{"fail empty", &ScheduleOptions{}, true},
+		{"fail fields", &ScheduleOptions{Windows: []string{"* * * *"}}, true},
+		{"fail value", &ScheduleOptions{Windows: []string{"* foo * * *"}}, true},
+		{"fail range", &ScheduleOptions{Windows: []string{"* 9-24 * * *"}}, true},
+		{"fail reversed range", &ScheduleOptions{Windows: []string{"* 17-9 * * *"}}, true},
+		{"fail day of month", &ScheduleOptions{Windows: []string{"* * 0 * *"}}, true},
+		{"fail day of week", &ScheduleOptions{Windows: []string{"* * * * 8"}}, true},
+		{"fail step", &ScheduleOptions{Windows: []string{"*/0 * * * *"}}, true},
+		{"fail timezone", &ScheduleOptions{Windows: []string{"* * * * *"}, Timezone: "Mars/Olympus_Mons"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ScheduleOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleOptions_IsAllowed(t *testing.T) {
+	// Wednesday
+	wed := func(hour, min int) time.Time {
+		return time.Date(2021, 6, 2, hour, min, 0, 0, time.UTC)
+	}
+	businessHours := &ScheduleOptions{Windows: []string{"* 9-16 * * 1-5"}}
+	madrid := &ScheduleOptions{Windows: []string{"* 9-16 * * 1-5"}, Timezone: "Europe/Madrid"}
+	sunday := &ScheduleOptions{Windows: []string{"0-29 10 * * 7", "30 10 * 6 *"}}
+
+	tests := []struct {
+		name    string
+		options *ScheduleOptions
+		now     time.Time
+		want    bool
+	}{
+		{"nil", nil, wed(3, 0), true},
+		{"start", businessHours, wed(9, 0), true},
+		{"end", businessHours, wed(16, 59), true},
+		{"before", businessHours, wed(8, 59), false},
+		{"after", businessHours, wed(17, 0), false},
+		{"weekend", businessHours, wed(12, 0).AddDate(0, 0, 3), false},
+		{"timezone", madrid, wed(7, 0), true},
+		{"timezone after", madrid, wed(15, 0), false},
+		{"sunday", sunday, time.Date(2021, 6, 6, 10, 15, 0, 0, time.UTC), true},
+		{"sunday after", sunday, time.Date(2021, 6, 6, 10, 31, 0, 0, time.UTC), false},
+		{"second window", sunday, wed(10, 30), true},
+		{"invalid", &ScheduleOptions{Windows: []string{"foo"}}, wed(12, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.options.IsAllowed(tt.now))
+		})
+	}
+}
+
+func TestScheduleOptions_NextWindow(t *testing.T) {
+	businessHours := &ScheduleOptions{Windows: []string{"* 9-16 * * 1-5"}}
+
+	// Friday evening
+	next, ok := businessHours.NextWindow(time.Date(2021, 6, 4, 18, 30, 15, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equals(t, time.Date(2021, 6, 7, 9, 0, 0, 0, time.UTC), next.UTC())
+
+	// Early morning
+	next, ok = businessHours.NextWindow(time.Date(2021, 6, 2, 8, 59, 59, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equals(t, time.Date(2021, 6, 2, 9, 0, 0, 0, time.UTC), next.UTC())
+
+	// Timezone
+	madrid := &ScheduleOptions{Windows: []string{"* 9-16 * * 1-5"}, Timezone: "Europe/Madrid"}
+	next, ok = madrid.NextWindow(time.Date(2021, 6, 2, 5, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equals(t, time.Date(2021, 6, 2, 7, 0, 0, 0, time.UTC), next.UTC())
+
+	// Leap day
+	leap := &ScheduleOptions{Windows: []string{"0 0 29 2 *"}}
+	next, ok = leap.NextWindow(time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equals(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), next.UTC())
+
+	// No window in the next year
+	_, ok = leap.NextWindow(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.False(t, ok)
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/keyattest"
 	"go.step.sm/crypto/x509util"
 )
 
@@ -23,10 +24,22 @@ const DefaultCertValidity = 24 * time.Hour
 // SignOptions contains the options that can be passed to the Sign method. Backdate
 // is automatically filled and can only be configured in the CA.
 type SignOptions struct {
-	NotAfter     TimeDuration    `json:"notAfter"`
-	NotBefore    TimeDuration    `json:"notBefore"`
-	TemplateData json.RawMessage `json:"templateData"`
-	Backdate     time.Duration   `json:"-"`
+	NotAfter     TimeDuration         `json:"notAfter"`
+	NotBefore    TimeDuration         `json:"notBefore"`
+	TemplateData json.RawMessage      `json:"templateData"`
+	Attestation  *keyattest.Statement `json:"attestation,omitempty"`
+	Labels       map[string]string    `json:"labels,omitempty"`
+	Backdate     time.Duration        `json:"-"`
+	Clock        Clock                `json:"-"`
+}
+
+// now returns the current time of the clock set by the authority in the
+// options, used to set and validate the validity of the certificates.
+func (o SignOptions) now() time.Time {
+	if o.Clock == nil {
+		return now()
+	}
+	return o.Clock.Now().UTC()
 }
 
 // SignOption is the interface used to collect all extra options used in the
@@ -101,7 +114,10 @@ func (e emailOnlyIdentity) Valid(req *x509.CertificateRequest) error {
 }
 
 // defaultPublicKeyValidator validates the public key of a certificate request.
-type defaultPublicKeyValidator struct{}
+// If the provisioner defines a key policy, the key must also satisfy it.
+type defaultPublicKeyValidator struct {
+	keyPolicy *KeyPolicy
+}
 
 // Valid checks that certificate request common name matches the one configured.
 func (v defaultPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
@@ -114,7 +130,7 @@ func (v defaultPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
 	default:
 		return errors.Errorf("unrecognized public key of type '%T' in CSR", k)
 	}
-	return nil
+	return v.keyPolicy.ValidateKey(req.PublicKey)
 }
 
 // publicKeyMinimumLengthValidator validates the length (in bits) of the public key
@@ -298,7 +314,7 @@ func (v profileDefaultDuration) Modify(cert *x509.Certificate, so SignOptions) e
 	var backdate time.Duration
 	notBefore := so.NotBefore.Time()
 	if notBefore.IsZero() {
-		notBefore = now()
+		notBefore = so.now()
 		backdate = -1 * so.Backdate
 
 	}
@@ -329,7 +345,7 @@ func (v profileLimitDuration) Modify(cert *x509.Certificate, so SignOptions) err
 	var backdate time.Duration
 	notBefore := so.NotBefore.Time()
 	if notBefore.IsZero() {
-		notBefore = now()
+		notBefore = so.now()
 		backdate = -1 * so.Backdate
 	}
 	if notBefore.Before(v.notBefore) {
@@ -375,7 +391,7 @@ func (v *validityValidator) Valid(cert *x509.Certificate, o SignOptions) error {
 	var (
 		na  = cert.NotAfter.Truncate(time.Second)
 		nb  = cert.NotBefore.Truncate(time.Second)
-		now = time.Now().Truncate(time.Second)
+		now = o.now().Truncate(time.Second)
 	)
 
 	d := na.Sub(nb)
@@ -486,3 +502,28 @@ func createProvisionerExtension(typ int, name, credentialID string, keyValuePair
 		Value:    b,
 	}, nil
 }
+
+// GetProvisionerName returns the name of the provisioner in the first step
+// provisioner extension in the given list.
+func GetProvisionerName(extensions []pkix.Extension) (string, bool) {
+	for _, e := range extensions {
+		if e.Id.Equal(stepOIDProvisioner) {
+			var p stepProvisionerASN1
+			if _, err := asn1.Unmarshal(e.Value, &p); err != nil {
+				return "", false
+			}
+			return string(p.Name), true
+		}
+	}
+	return "", false
+}
+
+// AccountOption is a SignOption with the id of the account requesting the
+// certificate, e.g. the ACME account. It is used to enforce the per-account
+// issuance quotas.
+type AccountOption string
+
+// ReplacesOption is a SignOption with the serial number of the certificate
+// replaced by the new one, e.g. with the replaces field of an ACME order. The
+// replacement is exempt from the issuance quotas.
+type ReplacesOption string
@@ -407,7 +407,10 @@ func (v *sshCertDefaultValidator) Valid(cert *ssh.Certificate, o SignSSHOptions)
 }
 
 // sshDefaultPublicKeyValidator implements a validator for the certificate key.
-type sshDefaultPublicKeyValidator struct{}
+// If the provisioner defines a key policy, the key must also satisfy it.
+type sshDefaultPublicKeyValidator struct {
+	keyPolicy *KeyPolicy
+}
 
 // Valid checks that certificate request common name matches the one configured.
 func (v sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, o SignSSHOptions) error {
@@ -428,12 +431,10 @@ func (v sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, o SignSSHOpti
 			return errors.Errorf("ssh certificate key must be at least %d bits (%d bytes)",
 				8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes)
 		}
-		return nil
 	case ssh.KeyAlgoDSA:
 		return errors.New("ssh certificate key algorithm (DSA) is not supported")
-	default:
-		return nil
 	}
+	return v.keyPolicy.ValidateSSHKey(cert.Key)
 }
 
 // sshCertTypeUInt32
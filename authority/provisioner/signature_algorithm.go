@@ -0,0 +1,117 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// leafSignatureAlgorithms are the signature algorithms that can be selected
+// to sign leaf certificates, using the names of the templates.
+var leafSignatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA,
+	x509.SHA384WithRSA,
+	x509.SHA512WithRSA,
+	x509.SHA256WithRSAPSS,
+	x509.SHA384WithRSAPSS,
+	x509.SHA512WithRSAPSS,
+	x509.ECDSAWithSHA256,
+	x509.ECDSAWithSHA384,
+	x509.ECDSAWithSHA512,
+	x509.PureEd25519,
+}
+
+// ParseSignatureAlgorithm returns the signature algorithm with the given name,
+// e.g. ECDSA-SHA384 or SHA256-RSAPSS. Names are case-insensitive.
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	for _, alg := range leafSignatureAlgorithms {
+		if strings.EqualFold(name, alg.String()) {
+			return alg, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, errors.Errorf("signature algorithm %s is not supported", name)
+}
+
+// ValidateSignatureAlgorithm checks that the given signature algorithm can be
+// used to sign leaf certificates with the given issuer key. If the issuer key
+// is nil, only the algorithm is checked.
+func ValidateSignatureAlgorithm(alg x509.SignatureAlgorithm, issuerKey crypto.PublicKey) error {
+	supported := false
+	for _, a := range leafSignatureAlgorithms {
+		if a == alg {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return errors.Errorf("signature algorithm %s is not supported", alg)
+	}
+
+	var ok bool
+	switch issuerKey.(type) {
+	case nil:
+		return nil
+	case *rsa.PublicKey:
+		ok = alg == x509.SHA256WithRSA || alg == x509.SHA384WithRSA || alg == x509.SHA512WithRSA ||
+			alg == x509.SHA256WithRSAPSS || alg == x509.SHA384WithRSAPSS || alg == x509.SHA512WithRSAPSS
+	case *ecdsa.PublicKey:
+		ok = alg == x509.ECDSAWithSHA256 || alg == x509.ECDSAWithSHA384 || alg == x509.ECDSAWithSHA512
+	case ed25519.PublicKey:
+		ok = alg == x509.PureEd25519
+	}
+	if !ok {
+		return errors.Errorf("signature algorithm %s cannot be used with an issuer key of type %T", alg, issuerKey)
+	}
+	return nil
+}
+
+// withSignatureAlgorithm sets the given signature algorithm in the rendered
+// templates that do not define one.
+func withSignatureAlgorithm(name string, fns []x509util.Option) []x509util.Option {
+	if name == "" {
+		return fns
+	}
+	wrapped := make([]x509util.Option, len(fns))
+	for i, fn := range fns {
+		fn := fn
+		wrapped[i] = func(cr *x509.CertificateRequest, o *x509util.Options) error {
+			if err := fn(cr, o); err != nil {
+				return err
+			}
+			return setSignatureAlgorithm(o, name)
+		}
+	}
+	return wrapped
+}
+
+func setSignatureAlgorithm(o *x509util.Options, name string) error {
+	if o.CertBuffer == nil {
+		return nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(o.CertBuffer.Bytes(), &m); err != nil {
+		return errors.Wrap(err, "error unmarshaling certificate template")
+	}
+	if v, ok := m["signatureAlgorithm"]; ok && string(v) != `""` && string(v) != "null" {
+		return nil
+	}
+	b, err := json.Marshal(name)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling signature algorithm")
+	}
+	m["signatureAlgorithm"] = b
+	b, err = json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling certificate template")
+	}
+	o.CertBuffer = bytes.NewBuffer(b)
+	return nil
+}
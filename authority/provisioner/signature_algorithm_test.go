@@ -0,0 +1,133 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestParseSignatureAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"ECDSA-SHA384", x509.ECDSAWithSHA384, false},
+		{"ecdsa-sha512", x509.ECDSAWithSHA512, false},
+		{"SHA384-RSAPSS", x509.SHA384WithRSAPSS, false},
+		{"Ed25519", x509.PureEd25519, false},
+		{"SHA1-RSA", x509.UnknownSignatureAlgorithm, true},
+		{"foo", x509.UnknownSignatureAlgorithm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSignatureAlgorithm(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseSignatureAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSignatureAlgorithm(t *testing.T) {
+	mustKey := func(kty, crv string, size int) crypto.PublicKey {
+		pub, _, err := keyutil.GenerateKeyPair(kty, crv, size)
+		assert.FatalError(t, err)
+		return pub
+	}
+	ecKey := mustKey("EC", "P-256", 0)
+	rsaKey := mustKey("RSA", "", 2048)
+	edKey := mustKey("OKP", "Ed25519", 0)
+	tests := []struct {
+		name      string
+		alg       x509.SignatureAlgorithm
+		issuerKey crypto.PublicKey
+		wantErr   bool
+	}{
+		{"ok ec", x509.ECDSAWithSHA384, ecKey, false},
+		{"ok rsa", x509.SHA512WithRSA, rsaKey, false},
+		{"ok rsapss", x509.SHA256WithRSAPSS, rsaKey, false},
+		{"ok ed25519", x509.PureEd25519, edKey, false},
+		{"ok no issuer", x509.ECDSAWithSHA512, nil, false},
+		{"fail ec", x509.SHA384WithRSA, ecKey, true},
+		{"fail rsa", x509.ECDSAWithSHA384, rsaKey, true},
+		{"fail ed25519", x509.ECDSAWithSHA256, edKey, true},
+		{"fail sha1", x509.ECDSAWithSHA1, ecKey, true},
+		{"fail sha1 no issuer", x509.SHA1WithRSA, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSignatureAlgorithm(tt.alg, tt.issuerKey); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_setSignatureAlgorithm(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{"ok", `{"subject": {"commonName": "foo"}}`, "ECDSA-SHA384", false},
+		{"ok empty", `{"signatureAlgorithm": ""}`, "ECDSA-SHA384", false},
+		{"ok null", `{"signatureAlgorithm": null}`, "ECDSA-SHA384", false},
+		{"ok template", `{"signatureAlgorithm": "ECDSA-SHA512"}`, "ECDSA-SHA512", false},
+		{"fail template", `{"subject": `, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &x509util.Options{CertBuffer: bytes.NewBufferString(tt.template)}
+			if err := setSignatureAlgorithm(o, "ECDSA-SHA384"); (err != nil) != tt.wantErr {
+				t.Errorf("setSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			var got struct {
+				SignatureAlgorithm string `json:"signatureAlgorithm"`
+			}
+			assert.FatalError(t, json.Unmarshal(o.CertBuffer.Bytes(), &got))
+			assert.Equals(t, tt.want, got.SignatureAlgorithm)
+		})
+	}
+}
+
+func TestTemplateOptions_signatureAlgorithm(t *testing.T) {
+	data := x509util.NewTemplateData()
+	data.SetCommonName("foo")
+	cof, err := TemplateOptions(&Options{
+		X509: &X509Options{
+			SignatureAlgorithm: "ECDSA-SHA384",
+		},
+	}, data)
+	assert.FatalError(t, err)
+
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	csr, err := x509util.CreateCertificateRequest("foo", []string{"foo"}, priv.(crypto.Signer))
+	assert.FatalError(t, err)
+
+	var opts x509util.Options
+	for _, fn := range cof.Options(SignOptions{}) {
+		assert.FatalError(t, fn(csr, &opts))
+	}
+	var got struct {
+		SignatureAlgorithm string `json:"signatureAlgorithm"`
+	}
+	assert.FatalError(t, json.Unmarshal(opts.CertBuffer.Bytes(), &got))
+	assert.Equals(t, "ECDSA-SHA384", got.SignatureAlgorithm)
+}
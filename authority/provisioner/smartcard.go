@@ -0,0 +1,268 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OIDs used in Windows smart card logon certificates.
+var (
+	OIDSmartCardLogon    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 2}
+	OIDUserPrincipalName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+	OIDNTDSCASecurityExt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 25, 2}
+	OIDNTDSObjectSID     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 25, 2, 1}
+)
+
+// DefaultUPNClaim is the default token claim with the user principal name.
+const DefaultUPNClaim = "upn"
+
+// SmartCardLogonTemplate is the default template used by provisioners with
+// the smart card logon profile enabled. The user principal name and the smart
+// card logon extended key usage are added after rendering the template.
+const SmartCardLogonTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["clientAuth"]
+}`
+
+// SmartCardLogonOptions enables the Windows smart card logon profile in an
+// OIDC provisioner. With the profile enabled, the provisioner issues PIV
+// authentication certificates with the user principal name (UPN) of the user
+// in the token. Active Directory only accepts these certificates if the
+// intermediate is published in the NTAuth store of the forest, e.g. with
+// "certutil -dspublish -f intermediate_ca.crt NTAuthCA", and the CRL in the
+// distribution points is reachable by the domain controllers.
+type SmartCardLogonOptions struct {
+	// UPNClaim is the token claim with the user principal name, it defaults
+	// to DefaultUPNClaim.
+	UPNClaim string `json:"upnClaim,omitempty"`
+	// UPNDomains is the list of domains allowed in the user principal name.
+	// If empty, any domain is allowed.
+	UPNDomains []string `json:"upnDomains,omitempty"`
+	// SIDClaim is the token claim with the security identifier of the user,
+	// e.g. "onprem_sid". If set, the certificate contains the SID extension
+	// required by the strong certificate mapping of the domain controllers.
+	SIDClaim string `json:"sidClaim,omitempty"`
+	// CRLDistributionPoints is the list of URLs where the CRL of the
+	// intermediate is published.
+	CRLDistributionPoints []string `json:"crlDistributionPoints,omitempty"`
+}
+
+// GetSmartCardLogon returns the smart card logon options.
+func (o *Options) GetSmartCardLogon() *SmartCardLogonOptions {
+	if o == nil {
+		return nil
+	}
+	return o.SmartCardLogon
+}
+
+// Validate validates the smart card logon options. Nil options are valid.
+func (o *SmartCardLogonOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, domain := range o.UPNDomains {
+		if domain == "" || strings.Contains(domain, "@") {
+			return errors.Errorf("smartCardLogon upnDomains %q is not valid", domain)
+		}
+	}
+	for _, s := range o.CRLDistributionPoints {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "ldap") {
+			return errors.Errorf("smartCardLogon crlDistributionPoints %q must be an http or ldap url", s)
+		}
+	}
+	return nil
+}
+
+// GetUPN returns the user principal name in the given token claims, and
+// validates it with the allowed domains.
+func (o *SmartCardLogonOptions) GetUPN(claims map[string]interface{}) (string, error) {
+	name := o.UPNClaim
+	if name == "" {
+		name = DefaultUPNClaim
+	}
+	upn, _ := claims[name].(string)
+	if upn == "" {
+		return "", errors.Errorf("token does not contain the %s claim", name)
+	}
+	i := strings.LastIndex(upn, "@")
+	if i <= 0 || i == len(upn)-1 {
+		return "", errors.Errorf("user principal name %s is not valid", upn)
+	}
+	if len(o.UPNDomains) == 0 {
+		return upn, nil
+	}
+	for _, domain := range o.UPNDomains {
+		if strings.EqualFold(upn[i+1:], domain) {
+			return upn, nil
+		}
+	}
+	return "", errors.Errorf("user principal name %s is not allowed", upn)
+}
+
+// getSID returns the security identifier in the given token claims, or an
+// empty string if it's not configured.
+func (o *SmartCardLogonOptions) getSID(claims map[string]interface{}) (string, error) {
+	if o.SIDClaim == "" {
+		return "", nil
+	}
+	sid, _ := claims[o.SIDClaim].(string)
+	if !strings.HasPrefix(sid, "S-1-") {
+		return "", errors.Errorf("token does not contain a valid %s claim", o.SIDClaim)
+	}
+	return sid, nil
+}
+
+// newSmartCardLogonEnforcer returns the enforcer that adds the smart card
+// logon extensions with the user in the given token claims.
+func newSmartCardLogonEnforcer(o *SmartCardLogonOptions, claims map[string]interface{}) (*smartCardLogonEnforcer, error) {
+	upn, err := o.GetUPN(claims)
+	if err != nil {
+		return nil, err
+	}
+	sid, err := o.getSID(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &smartCardLogonEnforcer{
+		upn:                   upn,
+		sid:                   sid,
+		crlDistributionPoints: o.CRLDistributionPoints,
+	}, nil
+}
+
+// smartCardLogonEnforcer adds the extensions required by Windows smart card
+// logon to a certificate.
+type smartCardLogonEnforcer struct {
+	upn                   string
+	sid                   string
+	crlDistributionPoints []string
+}
+
+// Enforce implements the CertificateEnforcer interface.
+func (e *smartCardLogonEnforcer) Enforce(cert *x509.Certificate) error {
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth) {
+		cert.ExtKeyUsage = append(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	hasSmartCardLogon := false
+	for _, oid := range cert.UnknownExtKeyUsage {
+		if oid.Equal(OIDSmartCardLogon) {
+			hasSmartCardLogon = true
+		}
+	}
+	if !hasSmartCardLogon {
+		cert.UnknownExtKeyUsage = append(cert.UnknownExtKeyUsage, OIDSmartCardLogon)
+	}
+	if len(e.crlDistributionPoints) > 0 {
+		cert.CRLDistributionPoints = e.crlDistributionPoints
+	}
+
+	// The user principal name is an otherName, so the SAN extension is built
+	// here with the rest of the names in the certificate.
+	sans, err := marshalSmartCardSANs(cert, e.upn)
+	if err != nil {
+		return err
+	}
+	extensions := []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: sans}}
+	if e.sid != "" {
+		value, err := marshalOtherNames(OIDNTDSObjectSID, asn1.RawValue{
+			Tag:   asn1.TagOctetString,
+			Bytes: []byte(e.sid),
+		})
+		if err != nil {
+			return err
+		}
+		extensions = append(extensions, pkix.Extension{Id: OIDNTDSCASecurityExt, Value: value})
+	}
+	for _, ext := range cert.ExtraExtensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) && !ext.Id.Equal(OIDNTDSCASecurityExt) {
+			extensions = append(extensions, ext)
+		}
+	}
+	cert.ExtraExtensions = extensions
+	return nil
+}
+
+// hasExtKeyUsage returns if the certificate contains the given extended key
+// usage.
+func hasExtKeyUsage(cert *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	for _, v := range cert.ExtKeyUsage {
+		if v == eku {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalOtherName returns the otherName general name with the given type and
+// value.
+func marshalOtherName(oid asn1.ObjectIdentifier, value asn1.RawValue) (asn1.RawValue, error) {
+	typeID, err := asn1.Marshal(oid)
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling otherName type")
+	}
+	b, err := asn1.Marshal(value)
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling otherName value")
+	}
+	// The value is an EXPLICIT [0] and the otherName an IMPLICIT [0].
+	b, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+	if err != nil {
+		return asn1.RawValue{}, errors.Wrap(err, "error marshaling otherName value")
+	}
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append(typeID, b...),
+	}, nil
+}
+
+// marshalOtherNames returns the GeneralNames sequence with a single otherName.
+func marshalOtherNames(oid asn1.ObjectIdentifier, value asn1.RawValue) ([]byte, error) {
+	name, err := marshalOtherName(oid, value)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal([]asn1.RawValue{name})
+}
+
+// marshalSmartCardSANs returns the value of the SAN extension with the user
+// principal name and the names in the certificate.
+func marshalSmartCardSANs(cert *x509.Certificate, upn string) ([]byte, error) {
+	name, err := marshalOtherName(OIDUserPrincipalName, asn1.RawValue{
+		Tag:   asn1.TagUTF8String,
+		Bytes: []byte(upn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := []asn1.RawValue{name}
+	for _, email := range cert.EmailAddresses {
+		names = append(names, asn1.RawValue{Tag: 1, Class: asn1.ClassContextSpecific, Bytes: []byte(email)})
+	}
+	for _, dns := range cert.DNSNames {
+		names = append(names, asn1.RawValue{Tag: 2, Class: asn1.ClassContextSpecific, Bytes: []byte(dns)})
+	}
+	for _, u := range cert.URIs {
+		names = append(names, asn1.RawValue{Tag: 6, Class: asn1.ClassContextSpecific, Bytes: []byte(u.String())})
+	}
+	for _, ip := range cert.IPAddresses {
+		b := ip.To4()
+		if b == nil {
+			b = ip
+		}
+		names = append(names, asn1.RawValue{Tag: 7, Class: asn1.ClassContextSpecific, Bytes: b})
+	}
+	b, err := asn1.Marshal(names)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling subject alternative names")
+	}
+	return b, nil
+}
@@ -0,0 +1,203 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSmartCardLogonOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SmartCardLogonOptions
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"empty", &SmartCardLogonOptions{}, false},
+		{"ok", &SmartCardLogonOptions{
+			UPNClaim:              "preferred_username",
+			UPNDomains:            []string{"corp.example.com"},
+			SIDClaim:              "onprem_sid",
+			CRLDistributionPoints: []string{"http://pki.example.com/intermediate_ca.crl", "ldap:///CN=Intermediate,CN=CDP,DC=example,DC=com"},
+		}, false},
+		{"fail domain", &SmartCardLogonOptions{UPNDomains: []string{""}}, true},
+		{"fail domain at", &SmartCardLogonOptions{UPNDomains: []string{"jane@corp.example.com"}}, true},
+		{"fail crl", &SmartCardLogonOptions{CRLDistributionPoints: []string{"https://pki.example.com/intermediate_ca.crl"}}, true},
+		{"fail crl url", &SmartCardLogonOptions{CRLDistributionPoints: []string{"%"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SmartCardLogonOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSmartCardLogonOptions_GetUPN(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SmartCardLogonOptions
+		claims  map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{"ok", &SmartCardLogonOptions{}, map[string]interface{}{"upn": "jane@corp.example.com"}, "jane@corp.example.com", false},
+		{"ok claim", &SmartCardLogonOptions{UPNClaim: "preferred_username"}, map[string]interface{}{"preferred_username": "jane@corp.example.com"}, "jane@corp.example.com", false},
+		{"ok domain", &SmartCardLogonOptions{UPNDomains: []string{"example.com", "CORP.example.com"}}, map[string]interface{}{"upn": "jane@corp.example.com"}, "jane@corp.example.com", false},
+		{"fail missing", &SmartCardLogonOptions{}, map[string]interface{}{"email": "jane@corp.example.com"}, "", true},
+		{"fail type", &SmartCardLogonOptions{}, map[string]interface{}{"upn": 1}, "", true},
+		{"fail no domain", &SmartCardLogonOptions{}, map[string]interface{}{"upn": "jane@"}, "", true},
+		{"fail no user", &SmartCardLogonOptions{}, map[string]interface{}{"upn": "@corp.example.com"}, "", true},
+		{"fail domain", &SmartCardLogonOptions{UPNDomains: []string{"example.com"}}, map[string]interface{}{"upn": "jane@corp.example.com"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.GetUPN(tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SmartCardLogonOptions.GetUPN() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("SmartCardLogonOptions.GetUPN() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// parseOtherNames returns the otherNames in a GeneralNames sequence.
+func parseOtherNames(t *testing.T, b []byte) map[string]asn1.RawValue {
+	t.Helper()
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &names); err != nil {
+		t.Fatal(err)
+	}
+	otherNames := make(map[string]asn1.RawValue)
+	for _, name := range names {
+		if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+			continue
+		}
+		var oid asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(name.Bytes, &oid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var explicit, value asn1.RawValue
+		if _, err := asn1.Unmarshal(rest, &explicit); err != nil {
+			t.Fatal(err)
+		}
+		if explicit.Class != asn1.ClassContextSpecific || explicit.Tag != 0 {
+			t.Fatalf("otherName %s value is not an explicit [0]", oid)
+		}
+		if _, err := asn1.Unmarshal(explicit.Bytes, &value); err != nil {
+			t.Fatal(err)
+		}
+		otherNames[oid.String()] = value
+	}
+	return otherNames
+}
+
+func TestSmartCardLogonEnforcer_Enforce(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := &SmartCardLogonOptions{
+		SIDClaim:              "onprem_sid",
+		CRLDistributionPoints: []string{"http://pki.example.com/intermediate_ca.crl"},
+	}
+	if _, err := newSmartCardLogonEnforcer(options, map[string]interface{}{"upn": "jane@corp.example.com"}); err == nil {
+		t.Fatal("newSmartCardLogonEnforcer() error = nil, want missing sid error")
+	}
+	e, err := newSmartCardLogonEnforcer(options, map[string]interface{}{
+		"upn":        "jane@corp.example.com",
+		"onprem_sid": "S-1-5-21-1004336348-1177238915-682003330-512",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Jane Doe"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     []string{"jane.corp.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionSubjectAltName, Value: []byte("replaced")},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}},
+		},
+	}
+	if err := e.Enforce(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	// Enforce is idempotent
+	if err := e.Enforce(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}) {
+		t.Errorf("ExtKeyUsage = %v, want [clientAuth]", cert.ExtKeyUsage)
+	}
+	if len(cert.UnknownExtKeyUsage) != 1 || !cert.UnknownExtKeyUsage[0].Equal(OIDSmartCardLogon) {
+		t.Errorf("UnknownExtKeyUsage = %v, want [%s]", cert.UnknownExtKeyUsage, OIDSmartCardLogon)
+	}
+	if !reflect.DeepEqual(cert.CRLDistributionPoints, options.CRLDistributionPoints) {
+		t.Errorf("CRLDistributionPoints = %v, want %v", cert.CRLDistributionPoints, options.CRLDistributionPoints)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"jane.corp.example.com"}) {
+		t.Errorf("DNSNames = %v, want [jane.corp.example.com]", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("IPAddresses = %v, want [10.0.0.1]", cert.IPAddresses)
+	}
+
+	var sans, sid []byte
+	custom := 0
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionSubjectAltName):
+			if sans != nil {
+				t.Error("certificate contains multiple SAN extensions")
+			}
+			sans = ext.Value
+		case ext.Id.Equal(OIDNTDSCASecurityExt):
+			if sid != nil {
+				t.Error("certificate contains multiple SID extensions")
+			}
+			sid = ext.Value
+		case ext.Id.Equal(asn1.ObjectIdentifier{1, 2, 3, 4}):
+			custom++
+		}
+	}
+	if custom != 1 {
+		t.Errorf("certificate contains %d custom extensions, want 1", custom)
+	}
+	upn, ok := parseOtherNames(t, sans)[OIDUserPrincipalName.String()]
+	if !ok || upn.Tag != asn1.TagUTF8String || string(upn.Bytes) != "jane@corp.example.com" {
+		t.Errorf("UPN = %v, want UTF8String jane@corp.example.com", upn)
+	}
+	objectSID, ok := parseOtherNames(t, sid)[OIDNTDSObjectSID.String()]
+	if !ok || objectSID.Tag != asn1.TagOctetString || string(objectSID.Bytes) != "S-1-5-21-1004336348-1177238915-682003330-512" {
+		t.Errorf("SID = %v, want OCTET STRING S-1-5-21-1004336348-1177238915-682003330-512", objectSID)
+	}
+}
@@ -67,6 +67,8 @@ func signSSHCertificate(key crypto.PublicKey, opts SignSSHOptions, signOpts []Si
 			if err := o.Valid(opts); err != nil {
 				return nil, err
 			}
+		// identity document sent to the policy hooks
+		case *IdentityDocument:
 		default:
 			return nil, fmt.Errorf("signSSH: invalid extra option type %T", o)
 		}
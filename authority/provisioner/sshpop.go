@@ -30,6 +30,7 @@ type SSHPOP struct {
 	Name       string  `json:"name"`
 	Claims     *Claims `json:"claims,omitempty"`
 	claimer    *Claimer
+	clock      Clock
 	audiences  Audiences
 	sshPubKeys *SSHKeys
 }
@@ -95,6 +96,7 @@ func (p *SSHPOP) Init(config Config) error {
 
 	// Update claims with global ones
 	var err error
+	p.clock = config.Clock
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
@@ -117,7 +119,7 @@ func (p *SSHPOP) authorizeToken(token string, audiences []string) (*sshPOPPayloa
 	}
 
 	// Check validity period of the certificate.
-	n := time.Now()
+	n := clockNow(p.clock).UTC()
 	if sshCert.ValidAfter != 0 && time.Unix(int64(sshCert.ValidAfter), 0).After(n) {
 		return nil, errs.Unauthorized("sshpop.authorizeToken; sshpop certificate validAfter is in the future")
 	}
@@ -164,7 +166,7 @@ func (p *SSHPOP) authorizeToken(token string, audiences []string) (*sshPOPPayloa
 	// more than a few minutes.
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: p.Name,
-		Time:   time.Now().UTC(),
+		Time:   clockNow(p.clock).UTC(),
 	}, time.Minute); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "sshpop.authorizeToken; invalid sshpop token")
 	}
@@ -0,0 +1,171 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// MaxTemplateCacheEntries is the maximum number of parsed X.509 templates kept
+// in memory. Templates are cached by their text, or by their path if they are
+// read from a file.
+var MaxTemplateCacheEntries = 256
+
+// templateCache keeps the parsed X.509 templates, so the templates are not
+// parsed again on every sign request.
+var templateCache = &x509TemplateCache{
+	entries: make(map[string]*cachedTemplate),
+}
+
+type x509TemplateCache struct {
+	mu      sync.RWMutex
+	entries map[string]*cachedTemplate
+}
+
+type cachedTemplate struct {
+	tmpl    *template.Template
+	modTime time.Time
+	size    int64
+}
+
+// parse returns the parsed template with the given text.
+func (c *x509TemplateCache) parse(text string) (*template.Template, error) {
+	key := "text:" + text
+	if e := c.get(key); e != nil {
+		return e.tmpl, nil
+	}
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, &cachedTemplate{tmpl: tmpl})
+	return tmpl, nil
+}
+
+// parseFile returns the parsed template in the given file. The file is parsed
+// again if its modification time or its size change.
+func (c *x509TemplateCache) parseFile(path string) (*template.Template, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	key := "file:" + path
+	if e := c.get(key); e != nil && e.modTime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		return e.tmpl, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	tmpl, err := parseTemplate(string(b))
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, &cachedTemplate{tmpl: tmpl, modTime: fi.ModTime(), size: fi.Size()})
+	return tmpl, nil
+}
+
+func (c *x509TemplateCache) get(key string) *cachedTemplate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.entries[key]
+}
+
+func (c *x509TemplateCache) set(key string, e *cachedTemplate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok || len(c.entries) < MaxTemplateCacheEntries {
+		c.entries[key] = e
+	}
+}
+
+// templateFuncMap returns the functions available in the X.509 templates, the
+// same ones used by x509util: the sprig functions without "env" and
+// "expandenv", and a "fail" function that sets the given message.
+func templateFuncMap(failMessage *string) template.FuncMap {
+	m := sprig.TxtFuncMap()
+	delete(m, "env")
+	delete(m, "expandenv")
+	m["fail"] = failFunc(failMessage)
+	return m
+}
+
+func failFunc(failMessage *string) func(msg string) (string, error) {
+	return func(msg string) (string, error) {
+		*failMessage = msg
+		return "", errors.New(msg)
+	}
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("template").Funcs(templateFuncMap(new(string))).Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing template")
+	}
+	return tmpl, nil
+}
+
+// executeTemplate executes a cached template and sets the result in the
+// x509util options. The template is cloned to bind the "fail" function to
+// this execution.
+func executeTemplate(tmpl *template.Template, cr *x509.CertificateRequest, data x509util.TemplateData, o *x509util.Options) error {
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return errors.Wrapf(err, "error parsing template")
+	}
+	terr := new(x509util.TemplateError)
+	tmpl.Funcs(template.FuncMap{"fail": failFunc(&terr.Message)})
+
+	buf := new(bytes.Buffer)
+	data.SetCertificateRequest(cr)
+	if err := tmpl.Execute(buf, data); err != nil {
+		if terr.Message != "" {
+			return terr
+		}
+		return errors.Wrapf(err, "error executing template")
+	}
+	o.CertBuffer = buf
+	return nil
+}
+
+// withTemplate is the cached version of x509util.WithTemplate.
+func withTemplate(text string, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		tmpl, err := templateCache.parse(text)
+		if err != nil {
+			return err
+		}
+		return executeTemplate(tmpl, cr, data, o)
+	}
+}
+
+// withTemplateBase64 is the cached version of x509util.WithTemplateBase64.
+func withTemplateBase64(s string, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return errors.Wrap(err, "error decoding template")
+		}
+		return withTemplate(string(b), data)(cr, o)
+	}
+}
+
+// withTemplateFile is the cached version of x509util.WithTemplateFile.
+func withTemplateFile(path string, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		tmpl, err := templateCache.parseFile(path)
+		if err != nil {
+			return err
+		}
+		return executeTemplate(tmpl, cr, data, o)
+	}
+}
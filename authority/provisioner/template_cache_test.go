@@ -0,0 +1,105 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/x509util"
+)
+
+func Test_x509TemplateCache_parse(t *testing.T) {
+	c := &x509TemplateCache{entries: make(map[string]*cachedTemplate)}
+	t1, err := c.parse(`{"subject": {{ toJson .Subject }}}`)
+	if err != nil {
+		t.Fatalf("x509TemplateCache.parse() error = %v", err)
+	}
+	t2, err := c.parse(`{"subject": {{ toJson .Subject }}}`)
+	if err != nil {
+		t.Fatalf("x509TemplateCache.parse() error = %v", err)
+	}
+	if t1 != t2 {
+		t.Error("x509TemplateCache.parse() did not return the cached template")
+	}
+	if _, err := c.parse(`{{ fail }`); err == nil {
+		t.Error("x509TemplateCache.parse() error = nil, wants error")
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("x509TemplateCache entries = %d, wants 1", len(c.entries))
+	}
+}
+
+func Test_x509TemplateCache_parseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "leaf.tpl")
+	if err := ioutil.WriteFile(path, []byte(`{"subject": {{ toJson .Subject }}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &x509TemplateCache{entries: make(map[string]*cachedTemplate)}
+	t1, err := c.parseFile(path)
+	if err != nil {
+		t.Fatalf("x509TemplateCache.parseFile() error = %v", err)
+	}
+	t2, err := c.parseFile(path)
+	if err != nil {
+		t.Fatalf("x509TemplateCache.parseFile() error = %v", err)
+	}
+	if t1 != t2 {
+		t.Error("x509TemplateCache.parseFile() did not return the cached template")
+	}
+
+	// A modified file is parsed again.
+	if err := ioutil.WriteFile(path, []byte(`{"subject": {"commonName": "foo"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	t3, err := c.parseFile(path)
+	if err != nil {
+		t.Fatalf("x509TemplateCache.parseFile() error = %v", err)
+	}
+	if t3 == t1 {
+		t.Error("x509TemplateCache.parseFile() returned a stale template")
+	}
+
+	if _, err := c.parseFile(filepath.Join(dir, "missing.tpl")); err == nil {
+		t.Error("x509TemplateCache.parseFile() error = nil, wants error")
+	}
+}
+
+func Test_withTemplate(t *testing.T) {
+	cr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo"}}
+	data := x509util.CreateTemplateData("foo", nil)
+
+	for i := 0; i < 2; i++ {
+		o := new(x509util.Options)
+		if err := withTemplate(`{"subject": {"commonName": {{ toJson .Insecure.CR.Subject.CommonName }}}}`, data)(cr, o); err != nil {
+			t.Fatalf("withTemplate() error = %v", err)
+		}
+		if got, want := o.CertBuffer.String(), `{"subject": {"commonName": "foo"}}`; got != want {
+			t.Errorf("withTemplate() = %s, want %s", got, want)
+		}
+	}
+
+	o := new(x509util.Options)
+	err := withTemplate(`{{ fail "not allowed" }}`, data)(cr, o)
+	terr, ok := err.(*x509util.TemplateError)
+	if !ok {
+		t.Fatalf("withTemplate() error = %v, wants *x509util.TemplateError", err)
+	}
+	if terr.Message != "not allowed" {
+		t.Errorf("withTemplate() message = %q, want %q", terr.Message, "not allowed")
+	}
+}
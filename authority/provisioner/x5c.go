@@ -26,15 +26,17 @@ type x5cPayload struct {
 // signature requests.
 type X5C struct {
 	*base
-	ID        string   `json:"-"`
-	Type      string   `json:"type"`
-	Name      string   `json:"name"`
-	Roots     []byte   `json:"roots"`
-	Claims    *Claims  `json:"claims,omitempty"`
-	Options   *Options `json:"options,omitempty"`
-	claimer   *Claimer
-	audiences Audiences
-	rootPool  *x509.CertPool
+	ID               string   `json:"-"`
+	Type             string   `json:"type"`
+	Name             string   `json:"name"`
+	Roots            []byte   `json:"roots"`
+	Claims           *Claims  `json:"claims,omitempty"`
+	Options          *Options `json:"options,omitempty"`
+	claimer          *Claimer
+	clock            Clock
+	identityResolver IdentityResolver
+	audiences        Audiences
+	rootPool         *x509.CertPool
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -85,6 +87,11 @@ func (p *X5C) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *X5C) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a X5C type.
 func (p *X5C) Init(config Config) error {
 	switch {
@@ -119,11 +126,18 @@ func (p *X5C) Init(config Config) error {
 		return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
 	}
 
+	// Validate the provisioner options
+	if err := p.Options.Validate(); err != nil {
+		return err
+	}
+
 	// Update claims with global ones
 	var err error
+	p.clock = config.Clock
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
 		return err
 	}
+	p.identityResolver = config.IdentityResolver
 
 	p.audiences = config.Audiences.WithFragment(p.GetIDForToken())
 	return nil
@@ -166,7 +180,7 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 	// more than a few minutes.
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: p.Name,
-		Time:   time.Now().UTC(),
+		Time:   clockNow(p.clock).UTC(),
 	}, time.Minute); err != nil {
 		return nil, errs.Wrapf(http.StatusUnauthorized, err, "x5c.authorizeToken; invalid x5c claims")
 	}
@@ -212,6 +226,13 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, &IdentityDocument{
+		Subject: claims.Subject,
+		Names:   claims.SANs,
+	}, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
+	}
 
 	templateOptions, err := TemplateOptions(p.Options, data)
 	if err != nil {
@@ -220,6 +241,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 
 	return []SignOption{
 		templateOptions,
+		identity,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeX5C, p.Name, ""),
 		profileLimitDuration{p.claimer.DefaultTLSCertDuration(),
@@ -227,7 +249,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		// validators
 		commonNameValidator(claims.Subject),
 		defaultSANsValidator(claims.SANs),
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
 	}, nil
 }
@@ -237,7 +259,7 @@ func (p *X5C) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 	if p.claimer.IsDisableRenewal() {
 		return errs.Unauthorized("x5c.AuthorizeRenew; renew is disabled for x5c provisioner '%s'", p.GetName())
 	}
-	return nil
+	return p.claimer.authorizeRenewalWindow(cert, clockNow(p.clock).UTC())
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
@@ -286,12 +308,19 @@ func (p *X5C) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	identity, err := resolveIdentity(ctx, p.identityResolver, p, &IdentityDocument{
+		Subject: claims.Subject,
+		Names:   principals,
+	}, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSSHSign")
+	}
 
 	templateOptions, err := TemplateSSHOptions(p.Options, data)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSSHSign")
 	}
-	signOptions = append(signOptions, templateOptions)
+	signOptions = append(signOptions, templateOptions, identity)
 
 	// Add modifiers from custom claims
 	t := now()
@@ -306,7 +335,7 @@ func (p *X5C) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		// Checks the validity bounds, and set the validity if has not been set.
 		&sshLimitDuration{p.claimer, claims.chains[0][0].NotAfter},
 		// Validate public key.
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keyPolicy: p.Options.GetKeyPolicy()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
@@ -7,12 +7,16 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/secrets"
 	step "go.step.sm/cli-utils/config"
 	"go.step.sm/cli-utils/ui"
 	"go.step.sm/crypto/jose"
@@ -40,6 +44,15 @@ func (a *Authority) GetProvisioners(cursor string, limit int) (provisioner.List,
 	return provisioners, nextCursor, nil
 }
 
+// FindProvisioners returns a page of the provisioners that match the given
+// filter and the cursor of the next page.
+func (a *Authority) FindProvisioners(cursor string, limit int, filter *provisioner.Filter) (provisioner.List, string, error) {
+	a.adminMutex.RLock()
+	defer a.adminMutex.RUnlock()
+	provisioners, nextCursor := a.provisioners.FindWithFilter(cursor, limit, filter)
+	return provisioners, nextCursor, nil
+}
+
 // LoadProvisionerByCertificate returns an interface to the provisioner that
 // provisioned the certificate.
 func (a *Authority) LoadProvisionerByCertificate(crt *x509.Certificate) (provisioner.Interface, error) {
@@ -86,6 +99,92 @@ func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, e
 	return p, nil
 }
 
+// EvaluateClaims returns the effective claims of the provisioner with the given
+// name and whether they would allow the given hypothetical request. Hidden
+// provisioners cannot be evaluated.
+func (a *Authority) EvaluateClaims(name string, req *provisioner.ClaimsEvaluationRequest) (*provisioner.ClaimsEvaluation, error) {
+	a.adminMutex.RLock()
+	p, ok := a.provisioners.LoadByName(name)
+	a.adminMutex.RUnlock()
+	if !ok || getProvisionerOptions(p).IsHidden() {
+		return nil, errs.NotFound("provisioner %s was not found", name)
+	}
+	global, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.EvaluateClaims")
+	}
+	e, err := provisioner.EvaluateClaims(p, global.Claims(), req, a.now())
+	if err != nil {
+		return nil, errs.BadRequestErr(err, errs.WithMessage("%s.", err.Error()))
+	}
+	return e, nil
+}
+
+// getProvisionerOptions returns the options of the given provisioner, or nil
+// if the provisioner does not support them.
+func getProvisionerOptions(p provisioner.Interface) *provisioner.Options {
+	if op, ok := p.(interface {
+		GetOptions() *provisioner.Options
+	}); ok {
+		return op.GetOptions()
+	}
+	return nil
+}
+
+// resolveProvisionerSecrets replaces the references to secrets stored in
+// external secret managers with the value of the secrets. The provisioners
+// loaded from the configuration or the database are resolved every time the
+// authority loads them.
+func resolveProvisionerSecrets(ctx context.Context, p provisioner.Interface) error {
+	var fields []*string
+	switch p := p.(type) {
+	case *provisioner.JWK:
+		fields = []*string{&p.EncryptedKey}
+	case *provisioner.OIDC:
+		fields = []*string{&p.ClientSecret}
+	case *provisioner.SCEP:
+		fields = []*string{&p.ChallengePassword}
+	}
+	for _, f := range fields {
+		v, err := secrets.Resolve(ctx, *f)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving secret of provisioner %s", p.GetName())
+		}
+		*f = v
+	}
+	return nil
+}
+
+// checkProvisionerActive returns an error if the provisioner cannot authorize
+// new certificates at the given time because it is not yet valid or it has
+// expired.
+func checkProvisionerActive(p provisioner.Interface, now time.Time) error {
+	if !getProvisionerOptions(p).IsActive(now) {
+		return errs.Unauthorized("provisioner %s is not active", p.GetName())
+	}
+	return nil
+}
+
+// checkProvisionerSchedule returns an error if the provisioner cannot issue new
+// certificates at the given time because it's outside its change windows. The
+// error tells the client when the next window starts.
+func checkProvisionerSchedule(p provisioner.Interface, now time.Time) error {
+	o := getProvisionerOptions(p).GetSchedule()
+	if o.IsAllowed(now) {
+		return nil
+	}
+	err := errors.Errorf("provisioner %s cannot issue new certificates outside its change windows", p.GetName())
+	if next, ok := o.NextWindow(now); ok {
+		return errs.NewErr(http.StatusForbidden, err,
+			errs.WithMessage("New certificates can only be issued during the change windows of the provisioner, the next one starts at %s.", next.UTC().Format(time.RFC3339)),
+			errs.WithCode(errs.CodeOutsideChangeWindow),
+			errs.WithRetryAfter(next.Sub(now)))
+	}
+	return errs.NewErr(http.StatusForbidden, err,
+		errs.WithMessage("New certificates can only be issued during the change windows of the provisioner."),
+		errs.WithCode(errs.CodeOutsideChangeWindow))
+}
+
 func (a *Authority) generateProvisionerConfig(ctx context.Context) (*provisioner.Config, error) {
 	// Merge global and configuration claims
 	claimer, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
@@ -107,7 +206,11 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (*provisioner
 			UserKeys: sshKeys.UserKeys,
 			HostKeys: sshKeys.HostKeys,
 		},
-		GetIdentityFunc: a.getIdentityFunc,
+		GetIdentityFunc:  a.getIdentityFunc,
+		IsRevokedFunc:    a.IsRevoked,
+		IdentityResolver: a.identityResolver,
+		CircuitBreaker:   a.config.CircuitBreaker.GetSettings(),
+		Clock:            a.clock,
 	}, nil
 
 }
@@ -149,6 +252,9 @@ func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisi
 		return admin.WrapErrorISE(err, "error generating provisioner config")
 	}
 
+	if err := resolveProvisionerSecrets(ctx, certProv); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error resolving secrets of provisioner %s", prov.Name)
+	}
 	if err := certProv.Init(*provisionerConfig); err != nil {
 		return admin.WrapErrorISE(err, "error initializing provisioner %s", prov.Name)
 	}
@@ -159,6 +265,14 @@ func (a *Authority) StoreProvisioner(ctx context.Context, prov *linkedca.Provisi
 		}
 		return admin.WrapErrorISE(err, "error storing provisioner in authority cache")
 	}
+
+	a.events.Publish(&events.ProvisionerUpdated{
+		Time:   a.now(),
+		ID:     prov.Id,
+		Name:   prov.Name,
+		Type:   prov.Type.String(),
+		Action: events.ProvisionerActionCreated,
+	})
 	return nil
 }
 
@@ -178,6 +292,9 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 		return admin.WrapErrorISE(err, "error generating provisioner config")
 	}
 
+	if err := resolveProvisionerSecrets(ctx, certProv); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error resolving secrets of provisioner %s", nu.Name)
+	}
 	if err := certProv.Init(*provisionerConfig); err != nil {
 		return admin.WrapErrorISE(err, "error initializing provisioner %s", nu.Name)
 	}
@@ -191,6 +308,14 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 		}
 		return admin.WrapErrorISE(err, "error updating provisioner '%s'", nu.Name)
 	}
+
+	a.events.Publish(&events.ProvisionerUpdated{
+		Time:   a.now(),
+		ID:     nu.Id,
+		Name:   nu.Name,
+		Type:   nu.Type.String(),
+		Action: events.ProvisionerActionUpdated,
+	})
 	return nil
 }
 
@@ -235,6 +360,14 @@ func (a *Authority) RemoveProvisioner(ctx context.Context, id string) error {
 		}
 		return admin.WrapErrorISE(err, "error deleting provisioner %s", provName)
 	}
+
+	a.events.Publish(&events.ProvisionerUpdated{
+		Time:   a.now(),
+		ID:     provID,
+		Name:   provName,
+		Type:   p.GetType().String(),
+		Action: events.ProvisionerActionRemoved,
+	})
 	return nil
 }
 
@@ -1,13 +1,17 @@
 package authority
 
 import (
+	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/kms/uri"
+	"github.com/smallstep/certificates/secrets"
 )
 
 func TestGetEncryptedKey(t *testing.T) {
@@ -104,3 +108,136 @@ func TestGetProvisioners(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_EvaluateClaims(t *testing.T) {
+	a := testAuthority(t)
+
+	e, err := a.EvaluateClaims("Max", &provisioner.ClaimsEvaluationRequest{})
+	assert.FatalError(t, err)
+	assert.True(t, e.Allowed)
+	assert.Equals(t, "Max", e.Provisioner)
+
+	e, err = a.EvaluateClaims("renew_disabled", &provisioner.ClaimsEvaluationRequest{Renewal: true})
+	assert.FatalError(t, err)
+	assert.False(t, e.Allowed)
+	assert.Equals(t, []string{"renew is disabled for provisioner renew_disabled"}, e.Reasons)
+
+	_, err = a.EvaluateClaims("Max", &provisioner.ClaimsEvaluationRequest{CertType: "foo"})
+	if sc, ok := err.(errs.StatusCoder); assert.True(t, ok) {
+		assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+	}
+
+	_, err = a.EvaluateClaims("missing", &provisioner.ClaimsEvaluationRequest{})
+	if sc, ok := err.(errs.StatusCoder); assert.True(t, ok) {
+		assert.Equals(t, http.StatusNotFound, sc.StatusCode())
+	}
+}
+
+func Test_checkProvisionerActive(t *testing.T) {
+	before := time.Now().Add(-time.Hour)
+	after := time.Now().Add(time.Hour)
+	tests := map[string]struct {
+		p   provisioner.Interface
+		err error
+	}{
+		"ok/no-options": {p: &provisioner.JWK{Name: "foo"}},
+		"ok/no-support": {p: &provisioner.SSHPOP{Name: "foo"}},
+		"ok/active":     {p: &provisioner.JWK{Name: "foo", Options: &provisioner.Options{NotBefore: &before, NotAfter: &after}}},
+		"fail/not-yet":  {p: &provisioner.JWK{Name: "foo", Options: &provisioner.Options{NotBefore: &after}}, err: errors.New("provisioner foo is not active")},
+		"fail/expired":  {p: &provisioner.JWK{Name: "foo", Options: &provisioner.Options{NotAfter: &before}}, err: errors.New("provisioner foo is not active")},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkProvisionerActive(tc.p, time.Now())
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					sc, ok := err.(errs.StatusCoder)
+					assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+					assert.Equals(t, tc.err.Error(), err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
+func Test_checkProvisionerSchedule(t *testing.T) {
+	// Friday evening
+	now := time.Date(2021, 6, 4, 18, 30, 0, 0, time.UTC)
+
+	businessHours := &provisioner.Options{Schedule: &provisioner.ScheduleOptions{Windows: []string{"* 9-16 * * 1-5"}}}
+	assert.FatalError(t, checkProvisionerSchedule(&provisioner.JWK{Name: "foo"}, now))
+	assert.FatalError(t, checkProvisionerSchedule(&provisioner.SSHPOP{Name: "foo"}, now))
+	assert.FatalError(t, checkProvisionerSchedule(&provisioner.JWK{Name: "foo", Options: &provisioner.Options{
+		Schedule: &provisioner.ScheduleOptions{Windows: []string{"* 18 * * 5"}},
+	}}, now))
+
+	err := checkProvisionerSchedule(&provisioner.JWK{Name: "foo", Options: businessHours}, now)
+	sc, ok := err.(*errs.Error)
+	assert.Fatal(t, ok, "error is not an *errs.Error")
+	assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+	assert.Equals(t, errs.CodeOutsideChangeWindow, sc.ErrorCode())
+	assert.Equals(t, "provisioner foo cannot issue new certificates outside its change windows", sc.Error())
+	assert.Equals(t, "New certificates can only be issued during the change windows of the provisioner, the next one starts at 2021-06-07T09:00:00Z.", sc.Message())
+	assert.Equals(t, 62*time.Hour+30*time.Minute, sc.RetryAfter)
+
+	// Without a next window
+	err = checkProvisionerSchedule(&provisioner.JWK{Name: "foo", Options: &provisioner.Options{
+		Schedule: &provisioner.ScheduleOptions{Windows: []string{"0 0 29 2 *"}},
+	}}, now)
+	sc, ok = err.(*errs.Error)
+	assert.Fatal(t, ok, "error is not an *errs.Error")
+	assert.Equals(t, errs.CodeOutsideChangeWindow, sc.ErrorCode())
+	assert.Equals(t, time.Duration(0), sc.RetryAfter)
+}
+
+func Test_resolveProvisionerSecrets(t *testing.T) {
+	secrets.Register(secrets.Vault, func(ctx context.Context, u *uri.URI) ([]byte, error) {
+		return []byte(`{"encryptedKey":"the-key","clientSecret":"the-secret","challenge":"the-challenge"}`), nil
+	})
+
+	tests := map[string]struct {
+		p    provisioner.Interface
+		want provisioner.Interface
+		err  error
+	}{
+		"ok/literal": {
+			p:    &provisioner.JWK{Name: "foo", EncryptedKey: "eyJhbGciOiJQQkVTMi1IUzI1NitBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIn0.a.b.c.d"},
+			want: &provisioner.JWK{Name: "foo", EncryptedKey: "eyJhbGciOiJQQkVTMi1IUzI1NitBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIn0.a.b.c.d"},
+		},
+		"ok/jwk": {
+			p:    &provisioner.JWK{Name: "foo", EncryptedKey: "vault:path=secret/data/step-ca;field=encryptedKey"},
+			want: &provisioner.JWK{Name: "foo", EncryptedKey: "the-key"},
+		},
+		"ok/oidc": {
+			p:    &provisioner.OIDC{Name: "foo", ClientSecret: "vault:path=secret/data/step-ca;field=clientSecret"},
+			want: &provisioner.OIDC{Name: "foo", ClientSecret: "the-secret"},
+		},
+		"ok/scep": {
+			p:    &provisioner.SCEP{Name: "foo", ChallengePassword: "vault:path=secret/data/step-ca;field=challenge"},
+			want: &provisioner.SCEP{Name: "foo", ChallengePassword: "the-challenge"},
+		},
+		"ok/no-secrets": {
+			p:    &provisioner.X5C{Name: "foo"},
+			want: &provisioner.X5C{Name: "foo"},
+		},
+		"fail/unsupported": {
+			p:   &provisioner.JWK{Name: "foo", EncryptedKey: "awssm:name=step-ca/jwk"},
+			err: errors.New("error resolving secret of provisioner foo: unsupported secret manager 'awssm'"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := resolveProvisionerSecrets(context.Background(), tc.p)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.Equals(t, tc.err.Error(), err.Error())
+				}
+			} else if assert.Nil(t, tc.err) {
+				assert.Equals(t, tc.want, tc.p)
+			}
+		})
+	}
+}
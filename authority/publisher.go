@@ -0,0 +1,248 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/publisher"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Names of the objects uploaded by the publisher. The OCSP responses are
+// uploaded as ocsp/<serial>.der, with the serial number in hexadecimal.
+const (
+	publisherCRLObject          = "intermediate_ca.crl"
+	publisherIntermediateObject = "intermediate_ca.crt"
+	publisherRootObject         = "root_ca.crt"
+	publisherOCSPPrefix         = "ocsp/"
+)
+
+// publisherCertificateMaxAge is the max-age of the CA certificates uploaded.
+const publisherCertificateMaxAge = 24 * time.Hour
+
+// publisherTimeout is the maximum time used to upload the objects.
+const publisherTimeout = 5 * time.Minute
+
+// revocationPublisher uploads the CRL of the intermediate, the CA
+// certificates and the OCSP responses to cloud object storage.
+type revocationPublisher struct {
+	publisher        publisher.Publisher
+	validity         time.Duration
+	ocsp             bool
+	roots            []*x509.Certificate
+	chain            []*x509.Certificate
+	signer           crypto.Signer
+	listRevoked      func() ([]*db.RevokedCertificateInfo, error)
+	listCertificates func() ([]*x509.Certificate, error)
+	now              func() time.Time
+	lease            *leaderLease
+	refresh          chan struct{}
+	done             chan struct{}
+	stopped          chan struct{}
+	unsubscribe      func()
+}
+
+// initRevocationPublisher starts the goroutine that uploads the revocation
+// data if the publisher is configured. The objects are uploaded on start, when
+// a certificate is revoked or issued, and before the CRL expires.
+func (a *Authority) initRevocationPublisher() error {
+	c := a.config.Publisher
+	if c == nil || a.revocationPublisher != nil {
+		return nil
+	}
+
+	pub, err := publisher.New(context.Background(), c.Options)
+	if err != nil {
+		return errors.Wrap(err, "error creating publisher")
+	}
+	chain, signer, err := a.intermediateSigner("publisher crl signer")
+	if err != nil {
+		return err
+	}
+
+	p := &revocationPublisher{
+		publisher: pub,
+		validity:  c.GetCRLValidity(),
+		ocsp:      c.OCSP,
+		roots:     a.rootX509Certs,
+		chain:     chain,
+		signer:    signer,
+		now:       a.now,
+	}
+	if l, ok := a.db.(revokedCertificatesLister); ok {
+		p.listRevoked = l.GetRevokedCertificates
+	}
+	if l, ok := a.db.(certificatesLister); ok && c.OCSP {
+		p.listCertificates = l.GetCertificates
+	}
+	// With multiple replicas, only the one holding the lease uploads the
+	// objects.
+	p.lease = a.leaderElector.newLease("publisher")
+	p.start(a.events)
+	a.revocationPublisher = p
+	return nil
+}
+
+// start starts the goroutine that uploads the objects. The first upload is
+// done in the goroutine, so an unavailable object storage does not prevent
+// the CA from starting.
+func (p *revocationPublisher) start(bus *events.Bus) {
+	p.refresh = make(chan struct{}, 1)
+	p.done = make(chan struct{})
+	p.stopped = make(chan struct{})
+	types := []events.Type{events.CertificateRevokedType}
+	if p.ocsp {
+		types = append(types, events.CertificateIssuedType)
+	}
+	p.unsubscribe = bus.Subscribe(func(events.Event) {
+		p.signal()
+	}, types...)
+	p.signal()
+	go p.run()
+}
+
+func (p *revocationPublisher) signal() {
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (p *revocationPublisher) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(p.validity / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.refresh:
+		case <-p.lease.Elected():
+		}
+		if !p.lease.IsLeader() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publisherTimeout)
+		err := p.publish(ctx, p.now())
+		cancel()
+		if err != nil {
+			log.Printf("error publishing revocation data: %v", err)
+		}
+	}
+}
+
+// Stop stops the uploads.
+func (p *revocationPublisher) Stop() {
+	p.unsubscribe()
+	close(p.done)
+	<-p.stopped
+	p.lease.Stop()
+}
+
+// publish uploads the CA certificates, a new CRL and, if enabled, new OCSP
+// responses valid from the given time.
+func (p *revocationPublisher) publish(ctx context.Context, now time.Time) error {
+	objects, err := p.objects(now)
+	if err != nil {
+		return err
+	}
+	return p.publisher.Publish(ctx, objects)
+}
+
+// objects returns the objects to upload.
+func (p *revocationPublisher) objects(now time.Time) ([]*publisher.Object, error) {
+	var rcis []*db.RevokedCertificateInfo
+	if p.listRevoked != nil {
+		var err error
+		if rcis, err = p.listRevoked(); err != nil {
+			return nil, err
+		}
+	}
+	crl, err := createCRL(p.chain[0], p.signer, func() ([]*db.RevokedCertificateInfo, error) {
+		return rcis, nil
+	}, now, p.validity, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The CRL and OCSP responses can be cached until the next update.
+	revocationCache := cacheControl(p.validity / 2)
+	certificateCache := cacheControl(publisherCertificateMaxAge)
+	objects := []*publisher.Object{
+		{Name: publisherCRLObject, Data: crl, ContentType: publisher.ContentTypeCRL, CacheControl: revocationCache},
+		{Name: publisherIntermediateObject, Data: p.chain[0].Raw, ContentType: publisher.ContentTypeCertificate, CacheControl: certificateCache},
+	}
+	for i, root := range p.roots {
+		name := publisherRootObject
+		if i > 0 {
+			name = fmt.Sprintf("root_ca_%d.crt", i)
+		}
+		objects = append(objects, &publisher.Object{
+			Name: name, Data: root.Raw, ContentType: publisher.ContentTypeCertificate, CacheControl: certificateCache,
+		})
+	}
+
+	if p.ocsp && p.listCertificates != nil {
+		responses, err := p.ocspResponses(rcis, now)
+		if err != nil {
+			return nil, err
+		}
+		for serial, resp := range responses {
+			objects = append(objects, &publisher.Object{
+				Name: publisherOCSPPrefix + serial + ".der", Data: resp, ContentType: publisher.ContentTypeOCSPResponse, CacheControl: revocationCache,
+			})
+		}
+	}
+	return objects, nil
+}
+
+// ocspResponses returns the OCSP responses, by serial number in hexadecimal,
+// of the certificates issued by the intermediate that have not expired.
+func (p *revocationPublisher) ocspResponses(rcis []*db.RevokedCertificateInfo, now time.Time) (map[string][]byte, error) {
+	certs, err := p.listCertificates()
+	if err != nil {
+		return nil, err
+	}
+	revoked := make(map[string]*db.RevokedCertificateInfo, len(rcis))
+	for _, rci := range rcis {
+		revoked[rci.Serial] = rci
+	}
+
+	issuer := p.chain[0]
+	responses := make(map[string][]byte)
+	for _, crt := range certs {
+		if !now.Before(crt.NotAfter) || !bytes.Equal(crt.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		tmpl := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: crt.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(p.validity),
+		}
+		if rci, ok := revoked[crt.SerialNumber.String()]; ok {
+			tmpl.Status = ocsp.Revoked
+			tmpl.RevokedAt = rci.RevokedAt
+			tmpl.RevocationReason = rci.ReasonCode
+		}
+		resp, err := ocsp.CreateResponse(issuer, issuer, tmpl, p.signer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating ocsp response for certificate %s", crt.SerialNumber)
+		}
+		responses[fmt.Sprintf("%X", crt.SerialNumber)] = resp
+	}
+	return responses, nil
+}
+
+func cacheControl(maxAge time.Duration) string {
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second))
+}
@@ -0,0 +1,130 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/publisher"
+	"golang.org/x/crypto/ocsp"
+)
+
+type mockPublisher struct {
+	objects []*publisher.Object
+	err     error
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, objects []*publisher.Object) error {
+	m.objects = objects
+	return m.err
+}
+
+func newRevocationPublisher(t *testing.T, rcis []*db.RevokedCertificateInfo, certs []*x509.Certificate) (*revocationPublisher, *mockPublisher) {
+	e := newRADIUSExporter(t, "", rcis)
+	m := &mockPublisher{}
+	return &revocationPublisher{
+		publisher:   m,
+		validity:    time.Hour,
+		ocsp:        certs != nil,
+		roots:       e.roots,
+		chain:       e.chain,
+		signer:      e.signer,
+		listRevoked: e.list,
+		listCertificates: func() ([]*x509.Certificate, error) {
+			return certs, nil
+		},
+		now: time.Now,
+	}, m
+}
+
+func TestRevocationPublisher_publish(t *testing.T) {
+	now := time.Now()
+	rcis := []*db.RevokedCertificateInfo{
+		{Serial: "10", ReasonCode: ocsp.KeyCompromise, RevokedAt: now.Add(-time.Minute)},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		p, m := newRevocationPublisher(t, rcis, nil)
+		assert.FatalError(t, p.publish(context.Background(), now))
+		assert.Len(t, 3, m.objects)
+		assert.Equals(t, "intermediate_ca.crl", m.objects[0].Name)
+		assert.Equals(t, publisher.ContentTypeCRL, m.objects[0].ContentType)
+		assert.Equals(t, "public, max-age=1800", m.objects[0].CacheControl)
+		crl, err := x509.ParseCRL(m.objects[0].Data)
+		assert.FatalError(t, err)
+		assert.Len(t, 1, crl.TBSCertList.RevokedCertificates)
+		assert.Equals(t, "intermediate_ca.crt", m.objects[1].Name)
+		assert.Equals(t, p.chain[0].Raw, m.objects[1].Data)
+		assert.Equals(t, "public, max-age=86400", m.objects[1].CacheControl)
+		assert.Equals(t, "root_ca.crt", m.objects[2].Name)
+		assert.Equals(t, p.roots[0].Raw, m.objects[2].Data)
+	})
+
+	t.Run("ok/ocsp", func(t *testing.T) {
+		p, m := newRevocationPublisher(t, rcis, []*x509.Certificate{})
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		newCert := func(serial int64, notAfter time.Time) *x509.Certificate {
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(serial),
+				Subject:      pkix.Name{CommonName: "leaf"},
+				NotBefore:    now.Add(-time.Hour),
+				NotAfter:     notAfter,
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, p.chain[0], key.Public(), p.signer)
+			assert.FatalError(t, err)
+			crt, err := x509.ParseCertificate(der)
+			assert.FatalError(t, err)
+			return crt
+		}
+		certs := []*x509.Certificate{
+			newCert(10, now.Add(time.Hour)),
+			newCert(11, now.Add(time.Hour)),
+			newCert(12, now.Add(-time.Minute)),
+			// Issued by another CA
+			p.roots[0],
+		}
+		p.listCertificates = func() ([]*x509.Certificate, error) {
+			return certs, nil
+		}
+
+		assert.FatalError(t, p.publish(context.Background(), now))
+		assert.Len(t, 5, m.objects)
+		got := map[string]*ocsp.Response{}
+		for _, o := range m.objects[3:] {
+			assert.Equals(t, publisher.ContentTypeOCSPResponse, o.ContentType)
+			resp, err := ocsp.ParseResponseForCert(o.Data, nil, p.chain[0])
+			assert.FatalError(t, err)
+			got[o.Name] = resp
+		}
+		assert.NotNil(t, got["ocsp/A.der"])
+		assert.Equals(t, ocsp.Revoked, got["ocsp/A.der"].Status)
+		assert.Equals(t, ocsp.KeyCompromise, got["ocsp/A.der"].RevocationReason)
+		assert.NotNil(t, got["ocsp/B.der"])
+		assert.Equals(t, ocsp.Good, got["ocsp/B.der"].Status)
+	})
+
+	t.Run("fail/list", func(t *testing.T) {
+		p, m := newRevocationPublisher(t, rcis, nil)
+		p.listRevoked = func() ([]*db.RevokedCertificateInfo, error) {
+			return nil, errors.New("force")
+		}
+		assert.Error(t, p.publish(context.Background(), now))
+		assert.Len(t, 0, m.objects)
+	})
+
+	t.Run("fail/publish", func(t *testing.T) {
+		p, m := newRevocationPublisher(t, rcis, nil)
+		m.err = errors.New("force")
+		assert.Error(t, p.publish(context.Background(), now))
+	})
+}
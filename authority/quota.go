@@ -0,0 +1,393 @@
+package authority
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+var (
+	quotaUsageTable     = []byte("quota_usage")
+	quotaOverridesTable = []byte("quota_overrides")
+)
+
+// Quota subject prefixes.
+const (
+	quotaSANPrefix         = "san:"
+	quotaAccountPrefix     = "account:"
+	quotaProvisionerPrefix = "provisioner:"
+)
+
+// quotaReservationTTL is the time a slot reserved by a sign request is counted
+// if the request is never completed, e.g. if the CA crashes while signing.
+const quotaReservationTTL = 5 * time.Minute
+
+// maxQuotaUpdateAttempts is the number of times the usage of a subject is
+// read and compared-and-swapped before giving up.
+const maxQuotaUpdateAttempts = 100
+
+// QuotaOverride is the limit of active certificates set by an administrator
+// for a quota subject. The subject is the identity prefixed by its type, e.g.
+// "san:foo.example.com", "account:<id>" or "provisioner:<name>". A limit of 0
+// disables the quota for the subject.
+type QuotaOverride struct {
+	Subject string `json:"subject"`
+	Limit   int    `json:"limit"`
+}
+
+// Validate validates the quota override.
+func (o *QuotaOverride) Validate() error {
+	switch {
+	case !strings.HasPrefix(o.Subject, quotaSANPrefix) &&
+		!strings.HasPrefix(o.Subject, quotaAccountPrefix) &&
+		!strings.HasPrefix(o.Subject, quotaProvisionerPrefix):
+		return admin.NewError(admin.ErrorBadRequestType, "subject must start with %s, %s or %s",
+			quotaSANPrefix, quotaAccountPrefix, quotaProvisionerPrefix)
+	case o.Limit < 0:
+		return admin.NewError(admin.ErrorBadRequestType, "limit cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// quotaCertificate is a certificate counted in a quota. Sign requests in
+// progress reserve a slot with an entry without serial number.
+type quotaCertificate struct {
+	SerialNumber string    `json:"serialNumber,omitempty"`
+	Reservation  string    `json:"reservation,omitempty"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// quotaReservation are the slots reserved by a sign request.
+type quotaReservation struct {
+	id       string
+	subjects []string
+}
+
+// quotaStore keeps the quota usage and overrides in the database.
+type quotaStore struct {
+	db nosql.DB
+}
+
+func newQuotaStore(db nosql.DB) (*quotaStore, error) {
+	for _, table := range [][]byte{quotaUsageTable, quotaOverridesTable} {
+		if err := db.CreateTable(table); err != nil {
+			return nil, errors.Wrapf(err, "error creating table %s", string(table))
+		}
+	}
+	return &quotaStore{db: db}, nil
+}
+
+// updateUsage atomically replaces the usage of a subject with the one
+// returned by fn. The usage is compared-and-swapped, so replicas sharing the
+// database never exceed the quotas, and fn might be called more than once.
+func (s *quotaStore) updateUsage(subject string, fn func([]quotaCertificate) ([]quotaCertificate, error)) error {
+	for i := 0; i < maxQuotaUpdateAttempts; i++ {
+		old, err := s.db.Get(quotaUsageTable, []byte(subject))
+		switch {
+		case nosql.IsErrNotFound(err):
+			old = nil
+		case err != nil:
+			return errors.Wrapf(err, "error loading quota usage for %s", subject)
+		}
+		var certs []quotaCertificate
+		if old != nil {
+			if err := json.Unmarshal(old, &certs); err != nil {
+				return errors.Wrapf(err, "error unmarshaling quota usage for %s", subject)
+			}
+		}
+		if certs, err = fn(certs); err != nil {
+			return err
+		}
+		b, err := json.Marshal(certs)
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling quota usage for %s", subject)
+		}
+		_, swapped, err := s.db.CmpAndSwap(quotaUsageTable, []byte(subject), old, b)
+		if err != nil {
+			return errors.Wrapf(err, "error storing quota usage for %s", subject)
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return errors.Errorf("error storing quota usage for %s: too many concurrent updates", subject)
+}
+
+func (s *quotaStore) getOverride(subject string) (int, bool, error) {
+	b, err := s.db.Get(quotaOverridesTable, []byte(subject))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, errors.Wrapf(err, "error loading quota override for %s", subject)
+	}
+	o := new(QuotaOverride)
+	if err := json.Unmarshal(b, o); err != nil {
+		return 0, false, errors.Wrapf(err, "error unmarshaling quota override for %s", subject)
+	}
+	return o.Limit, true, nil
+}
+
+func (s *quotaStore) getOverrides() ([]*QuotaOverride, error) {
+	entries, err := s.db.List(quotaOverridesTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading quota overrides")
+	}
+	overrides := []*QuotaOverride{}
+	for _, e := range entries {
+		o := new(QuotaOverride)
+		if err := json.Unmarshal(e.Value, o); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling quota override for %s", string(e.Key))
+		}
+		overrides = append(overrides, o)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Subject < overrides[j].Subject
+	})
+	return overrides, nil
+}
+
+func (s *quotaStore) setOverride(o *QuotaOverride) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling quota override for %s", o.Subject)
+	}
+	return errors.Wrapf(s.db.Set(quotaOverridesTable, []byte(o.Subject), b), "error storing quota override for %s", o.Subject)
+}
+
+func (s *quotaStore) deleteOverride(subject string) error {
+	return errors.Wrapf(s.db.Del(quotaOverridesTable, []byte(subject)), "error deleting quota override for %s", subject)
+}
+
+// initQuotas initializes the store used to enforce the issuance quotas.
+func (a *Authority) initQuotas() error {
+	if a.config.AuthorityConfig.Quotas == nil {
+		return nil
+	}
+	store, err := newQuotaStore(a.getStateDB())
+	if err != nil {
+		return err
+	}
+	a.quotas = store
+	return nil
+}
+
+// quotaSubjects returns the subjects and default limits of the quotas that
+// apply to the given certificate.
+func (a *Authority) quotaSubjects(crt *x509.Certificate, accountID string) map[string]int {
+	c := a.config.AuthorityConfig.Quotas
+	subjects := make(map[string]int)
+	for _, name := range crt.DNSNames {
+		subjects[quotaSANPrefix+strings.ToLower(name)] = c.MaxActivePerSAN
+	}
+	for _, ip := range crt.IPAddresses {
+		subjects[quotaSANPrefix+ip.String()] = c.MaxActivePerSAN
+	}
+	for _, email := range crt.EmailAddresses {
+		subjects[quotaSANPrefix+strings.ToLower(email)] = c.MaxActivePerSAN
+	}
+	for _, u := range crt.URIs {
+		subjects[quotaSANPrefix+u.String()] = c.MaxActivePerSAN
+	}
+	if accountID != "" {
+		subjects[quotaAccountPrefix+accountID] = c.MaxActivePerAccount
+	}
+	if name, ok := provisioner.GetProvisionerName(crt.ExtraExtensions); ok {
+		subjects[quotaProvisionerPrefix+name] = c.MaxActivePerProvisioner
+	}
+	return subjects
+}
+
+// checkQuotas verifies that the given certificate template does not exceed any
+// issuance quota, and reserves a slot in each of them until the certificate
+// is recorded with recordQuotas or the reservation is released with
+// releaseQuotas. The reservation contains the subjects that the certificate
+// will count against. Exempt certificates, like the renewal of a replaced
+// certificate, are counted but never rejected.
+func (a *Authority) checkQuotas(crt *x509.Certificate, accountID string, exempt bool) (*quotaReservation, error) {
+	if a.quotas == nil {
+		return nil, nil
+	}
+
+	subjects := a.quotaSubjects(crt, accountID)
+	limits := make(map[string]int, len(subjects))
+	a.quotaMutex.Lock()
+	for subject, limit := range subjects {
+		override, ok, err := a.quotas.getOverride(subject)
+		if err != nil {
+			a.quotaMutex.Unlock()
+			return nil, err
+		}
+		if ok {
+			limit = override
+		}
+		if limit != 0 {
+			limits[subject] = limit
+		}
+	}
+	a.quotaMutex.Unlock()
+
+	r := &quotaReservation{id: uuid.New().String()}
+	for subject := range limits {
+		r.subjects = append(r.subjects, subject)
+	}
+	sort.Strings(r.subjects)
+	if exempt {
+		return r, nil
+	}
+
+	for i, subject := range r.subjects {
+		if err := a.reserveQuota(r.id, subject, limits[subject]); err != nil {
+			// Release the slots already reserved.
+			a.releaseQuotas(&quotaReservation{id: r.id, subjects: r.subjects[:i]})
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// reserveQuota adds a reservation to the usage of the subject if it is below
+// the limit.
+func (a *Authority) reserveQuota(id, subject string, limit int) error {
+	return a.quotas.updateUsage(subject, func(certs []quotaCertificate) ([]quotaCertificate, error) {
+		now := a.now()
+		active := make([]quotaCertificate, 0, len(certs)+1)
+		for _, c := range certs {
+			if now.Before(c.NotAfter) {
+				active = append(active, c)
+			}
+		}
+		// Revoked certificates are only checked if the quota is reached.
+		if len(active) >= limit {
+			notRevoked := active[:0]
+			for _, c := range active {
+				if c.SerialNumber != "" {
+					isRevoked, err := a.IsRevoked(c.SerialNumber)
+					if err != nil {
+						return nil, err
+					}
+					if isRevoked {
+						continue
+					}
+				}
+				notRevoked = append(notRevoked, c)
+			}
+			active = notRevoked
+		}
+		if len(active) >= limit {
+			return nil, errs.NewErr(http.StatusTooManyRequests,
+				errors.Errorf("quota exceeded for %s: %d active certificates, limit is %d", subject, len(active), limit),
+				errs.WithMessage("The certificate quota for %s has been exceeded, %d active certificates are allowed.", subject, limit),
+				errs.WithCode(errs.CodeQuotaExceeded))
+		}
+		return append(active, quotaCertificate{
+			Reservation: id,
+			NotAfter:    now.Add(quotaReservationTTL),
+		}), nil
+	})
+}
+
+// recordQuotas replaces the slots reserved with the given certificate,
+// removing the expired certificates.
+func (a *Authority) recordQuotas(r *quotaReservation, crt *x509.Certificate) error {
+	if a.quotas == nil || r == nil {
+		return nil
+	}
+	for _, subject := range r.subjects {
+		if err := a.quotas.updateUsage(subject, func(certs []quotaCertificate) ([]quotaCertificate, error) {
+			return append(removeQuotaReservation(certs, r.id, a.now()), quotaCertificate{
+				SerialNumber: crt.SerialNumber.String(),
+				NotAfter:     crt.NotAfter,
+			}), nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseQuotas removes the slots reserved by a sign request that failed.
+// Errors are ignored, the reservations expire after quotaReservationTTL.
+func (a *Authority) releaseQuotas(r *quotaReservation) {
+	if a.quotas == nil || r == nil {
+		return
+	}
+	for _, subject := range r.subjects {
+		_ = a.quotas.updateUsage(subject, func(certs []quotaCertificate) ([]quotaCertificate, error) {
+			return removeQuotaReservation(certs, r.id, a.now()), nil
+		})
+	}
+}
+
+// removeQuotaReservation returns the active certificates and reservations
+// at the given time, except the reservation with the given id.
+func removeQuotaReservation(certs []quotaCertificate, id string, now time.Time) []quotaCertificate {
+	active := make([]quotaCertificate, 0, len(certs)+1)
+	for _, c := range certs {
+		if c.Reservation != id && now.Before(c.NotAfter) {
+			active = append(active, c)
+		}
+	}
+	return active
+}
+
+// GetQuotaOverrides returns the quota limits set by the administrators.
+func (a *Authority) GetQuotaOverrides() ([]*QuotaOverride, error) {
+	if a.quotas == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "quotas are not enabled")
+	}
+	a.quotaMutex.Lock()
+	defer a.quotaMutex.Unlock()
+	overrides, err := a.quotas.getOverrides()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading quota overrides")
+	}
+	return overrides, nil
+}
+
+// SetQuotaOverride sets the limit of active certificates for a quota subject,
+// overriding the configured default.
+func (a *Authority) SetQuotaOverride(o *QuotaOverride) error {
+	if a.quotas == nil {
+		return admin.NewError(admin.ErrorNotImplementedType, "quotas are not enabled")
+	}
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	a.quotaMutex.Lock()
+	defer a.quotaMutex.Unlock()
+	if err := a.quotas.setOverride(o); err != nil {
+		return admin.WrapErrorISE(err, "error storing quota override")
+	}
+	return nil
+}
+
+// DeleteQuotaOverride removes the override of a quota subject, the configured
+// default will be used again.
+func (a *Authority) DeleteQuotaOverride(subject string) error {
+	if a.quotas == nil {
+		return admin.NewError(admin.ErrorNotImplementedType, "quotas are not enabled")
+	}
+	a.quotaMutex.Lock()
+	defer a.quotaMutex.Unlock()
+	if _, ok, err := a.quotas.getOverride(subject); err != nil {
+		return admin.WrapErrorISE(err, "error loading quota override")
+	} else if !ok {
+		return admin.NewError(admin.ErrorNotFoundType, "quota override for %s not found", subject)
+	}
+	if err := a.quotas.deleteOverride(subject); err != nil {
+		return admin.WrapErrorISE(err, "error deleting quota override")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package authority
+
+import (
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+func TestAuthority_checkQuotas(t *testing.T) {
+	a := testAuthority(t)
+
+	// Quotas are not enabled
+	r, err := a.checkQuotas(&x509.Certificate{DNSNames: []string{"foo.example.com"}}, "", false)
+	assert.FatalError(t, err)
+	assert.Nil(t, r)
+	assert.NotNil(t, a.SetQuotaOverride(&QuotaOverride{Subject: "san:foo.example.com", Limit: 1}))
+
+	a.config.AuthorityConfig.Quotas = &config.QuotaConfig{
+		MaxActivePerSAN:     2,
+		MaxActivePerAccount: 1,
+	}
+	assert.FatalError(t, a.initQuotas())
+
+	newCert := func(serial int64, notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{SerialNumber: big.NewInt(serial), NotAfter: notAfter}
+	}
+	template := &x509.Certificate{DNSNames: []string{"Foo.example.com"}}
+
+	r, err = a.checkQuotas(template, "", false)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"san:foo.example.com"}, r.subjects)
+
+	// Expired certificates are not counted
+	assert.FatalError(t, a.recordQuotas(r, newCert(1, time.Now().Add(-time.Minute))))
+	r, err = a.checkQuotas(template, "", false)
+	assert.FatalError(t, err)
+	assert.FatalError(t, a.recordQuotas(r, newCert(2, time.Now().Add(time.Hour))))
+
+	// Requests in progress are counted until released
+	r, err = a.checkQuotas(template, "", false)
+	assert.FatalError(t, err)
+	_, err = a.checkQuotas(template, "", false)
+	assert.NotNil(t, err)
+	a.releaseQuotas(r)
+	r, err = a.checkQuotas(template, "", false)
+	assert.FatalError(t, err)
+
+	// Quota exceeded
+	assert.FatalError(t, a.recordQuotas(r, newCert(3, time.Now().Add(time.Hour))))
+	_, err = a.checkQuotas(template, "", false)
+	if assert.NotNil(t, err) {
+		sc, ok := err.(errs.StatusCoder)
+		assert.Fatal(t, ok)
+		assert.Equals(t, http.StatusTooManyRequests, sc.StatusCode())
+	}
+
+	// Admin override
+	assert.NotNil(t, a.SetQuotaOverride(&QuotaOverride{Subject: "foo.example.com", Limit: 3}))
+	assert.NotNil(t, a.SetQuotaOverride(&QuotaOverride{Subject: "san:foo.example.com", Limit: -1}))
+	assert.FatalError(t, a.SetQuotaOverride(&QuotaOverride{Subject: "san:foo.example.com", Limit: 3}))
+	r, err = a.checkQuotas(template, "", false)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"san:foo.example.com"}, r.subjects)
+	a.releaseQuotas(r)
+
+	overrides, err := a.GetQuotaOverrides()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*QuotaOverride{{Subject: "san:foo.example.com", Limit: 3}}, overrides)
+
+	assert.FatalError(t, a.DeleteQuotaOverride("san:foo.example.com"))
+	assert.NotNil(t, a.DeleteQuotaOverride("san:foo.example.com"))
+	_, err = a.checkQuotas(template, "", false)
+	assert.NotNil(t, err)
+
+	// Replacements are exempt, but counted
+	r, err = a.checkQuotas(template, "", true)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"san:foo.example.com"}, r.subjects)
+
+	// Account quota
+	template = &x509.Certificate{DNSNames: []string{"bar.example.com"}}
+	r, err = a.checkQuotas(template, "account-id", false)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"account:account-id", "san:bar.example.com"}, r.subjects)
+	assert.FatalError(t, a.recordQuotas(r, newCert(4, time.Now().Add(time.Hour))))
+	_, err = a.checkQuotas(&x509.Certificate{DNSNames: []string{"zar.example.com"}}, "account-id", false)
+	assert.NotNil(t, err)
+	_, err = a.checkQuotas(&x509.Certificate{DNSNames: []string{"zar.example.com"}}, "other-id", false)
+	assert.FatalError(t, err)
+}
+
+func TestAuthority_checkQuotas_concurrent(t *testing.T) {
+	tests := []struct {
+		name string
+		db   nosql.DB
+	}{
+		{"memory", db.NewMemoryDB()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.config.AuthorityConfig.Quotas = &config.QuotaConfig{MaxActivePerSAN: 3}
+			store, err := newQuotaStore(tt.db)
+			assert.FatalError(t, err)
+			a.quotas = store
+
+			// Half of the requests fail to sign and release the reservation.
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			var issued, released int
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					r, err := a.checkQuotas(&x509.Certificate{DNSNames: []string{"foo.example.com"}}, "", false)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					if released < 2 {
+						released++
+						a.releaseQuotas(r)
+						return
+					}
+					if err := a.recordQuotas(r, &x509.Certificate{
+						SerialNumber: big.NewInt(int64(i)),
+						NotAfter:     time.Now().Add(time.Hour),
+					}); err != nil {
+						t.Error(err)
+					}
+					issued++
+				}(i)
+			}
+			wg.Wait()
+
+			assert.True(t, issued <= 3)
+			for issued < 3 {
+				r, err := a.checkQuotas(&x509.Certificate{DNSNames: []string{"foo.example.com"}}, "", false)
+				assert.FatalError(t, err)
+				assert.FatalError(t, a.recordQuotas(r, &x509.Certificate{
+					SerialNumber: big.NewInt(int64(100 + issued)),
+					NotAfter:     time.Now().Add(time.Hour),
+				}))
+				issued++
+			}
+			_, err = a.checkQuotas(&x509.Certificate{DNSNames: []string{"foo.example.com"}}, "", false)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/db"
+)
+
+// Names of the files exported for RADIUS servers. The PEM files are used by
+// FreeRADIUS, ca-crl.pem can be used as the ca_file with check_crl enabled,
+// and the DER files can be imported in Microsoft NPS.
+const (
+	radiusCAFile           = "ca.pem"
+	radiusCRLFile          = "crl.pem"
+	radiusCACRLFile        = "ca-crl.pem"
+	radiusRootFile         = "root_ca.cer"
+	radiusIntermediateFile = "intermediate_ca.cer"
+	radiusDERCRLFile       = "intermediate_ca.crl"
+)
+
+// oidExtensionReasonCode is the OID of the CRL reason code extension.
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// revokedCertificatesLister is implemented by the databases that can list the
+// revoked certificates.
+type revokedCertificatesLister interface {
+	GetRevokedCertificates() ([]*db.RevokedCertificateInfo, error)
+}
+
+// radiusExporter writes the CA certificates and the CRL of the intermediate to
+// a directory used by RADIUS servers.
+type radiusExporter struct {
+	dir         string
+	validity    time.Duration
+	roots       []*x509.Certificate
+	chain       []*x509.Certificate
+	signer      crypto.Signer
+	list        func() ([]*db.RevokedCertificateInfo, error)
+	now         func() time.Time
+	lease       *leaderLease
+	refresh     chan struct{}
+	done        chan struct{}
+	stopped     chan struct{}
+	unsubscribe func()
+}
+
+// initRADIUSExport writes the files for RADIUS servers if the export is
+// configured, and starts a goroutine that updates them when a certificate is
+// revoked or the CRL is about to expire.
+func (a *Authority) initRADIUSExport() error {
+	c := a.config.RADIUS
+	if c == nil || a.radiusExporter != nil {
+		return nil
+	}
+
+	chain, signer, err := a.intermediateSigner("radius crl signer")
+	if err != nil {
+		return err
+	}
+
+	e := &radiusExporter{
+		dir:      c.Directory,
+		validity: c.GetCRLValidity(),
+		roots:    a.rootX509Certs,
+		chain:    chain,
+		signer:   signer,
+		now:      a.now,
+	}
+	// Without a database the certificates cannot be revoked, and the CRL is
+	// always empty.
+	if l, ok := a.db.(revokedCertificatesLister); ok {
+		e.list = l.GetRevokedCertificates
+	}
+	// With multiple replicas, only the one holding the lease updates the
+	// files. With lazy keys, the files are written in the background.
+	e.lease = a.leaderElector.newLease("radius")
+	lazy := a.config.Startup.IsLazyKeys()
+	if e.lease.IsLeader() && !lazy {
+		if err := e.export(a.now()); err != nil {
+			e.lease.Stop()
+			return err
+		}
+	}
+
+	e.start(a.events)
+	if lazy {
+		e.refresh <- struct{}{}
+	}
+	a.radiusExporter = e
+	return nil
+}
+
+// start starts the goroutine that updates the files.
+func (e *radiusExporter) start(bus *events.Bus) {
+	e.refresh = make(chan struct{}, 1)
+	e.done = make(chan struct{})
+	e.stopped = make(chan struct{})
+	e.unsubscribe = bus.Subscribe(func(events.Event) {
+		select {
+		case e.refresh <- struct{}{}:
+		default:
+		}
+	}, events.CertificateRevokedType)
+	go e.run()
+}
+
+func (e *radiusExporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.validity / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.refresh:
+		case <-e.lease.Elected():
+		}
+		if !e.lease.IsLeader() {
+			continue
+		}
+		if err := e.export(e.now()); err != nil {
+			log.Printf("error exporting RADIUS files: %v", err)
+		}
+	}
+}
+
+// Stop stops the updates of the files.
+func (e *radiusExporter) Stop() {
+	e.unsubscribe()
+	close(e.done)
+	<-e.stopped
+	e.lease.Stop()
+}
+
+// export writes the CA certificates and a new CRL valid from the given time.
+func (e *radiusExporter) export(now time.Time) error {
+	crl, err := e.createCRL(now)
+	if err != nil {
+		return err
+	}
+
+	var ca bytes.Buffer
+	for _, certs := range [][]*x509.Certificate{e.chain, e.roots} {
+		for _, crt := range certs {
+			if err := pem.Encode(&ca, &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}); err != nil {
+				return errors.Wrap(err, "error encoding certificate")
+			}
+		}
+	}
+	caPEM := ca.Bytes()
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+
+	files := map[string][]byte{
+		radiusCAFile:           caPEM,
+		radiusCRLFile:          crlPEM,
+		radiusCACRLFile:        append(append([]byte{}, caPEM...), crlPEM...),
+		radiusIntermediateFile: e.chain[0].Raw,
+		radiusDERCRLFile:       crl,
+	}
+	for i, root := range e.roots {
+		if i == 0 {
+			files[radiusRootFile] = root.Raw
+		} else {
+			files[fmt.Sprintf("root_ca_%d.cer", i)] = root.Raw
+		}
+	}
+
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return errors.Wrapf(err, "error creating %s", e.dir)
+	}
+	for name, data := range files {
+		if err := writeFileAtomic(filepath.Join(e.dir, name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createCRL returns a DER encoded CRL with the revoked certificates signed by
+// the intermediate.
+func (e *radiusExporter) createCRL(now time.Time) ([]byte, error) {
+	return createCRL(e.chain[0], e.signer, e.list, now, e.validity, nil)
+}
+
+// createCRL returns a DER encoded CRL signed by the given issuer with the
+// revoked certificates returned by list. A nil list creates an empty CRL. If
+// number is not nil, the CRL includes the CRL number extension.
+func createCRL(issuer *x509.Certificate, signer crypto.Signer, list func() ([]*db.RevokedCertificateInfo, error), now time.Time, validity time.Duration, number *big.Int) ([]byte, error) {
+	var rcis []*db.RevokedCertificateInfo
+	if list != nil {
+		var err error
+		if rcis, err = list(); err != nil {
+			return nil, err
+		}
+	}
+
+	revoked := make([]pkix.RevokedCertificate, 0, len(rcis))
+	for _, rci := range rcis {
+		sn, ok := new(big.Int).SetString(rci.Serial, 10)
+		if !ok {
+			log.Printf("error adding revoked certificate %s to the CRL: invalid serial number", rci.Serial)
+			continue
+		}
+		rc := pkix.RevokedCertificate{
+			SerialNumber:   sn,
+			RevocationTime: rci.RevokedAt,
+		}
+		// The unspecified reason code should not be used.
+		if rci.ReasonCode > 0 {
+			b, err := asn1.Marshal(asn1.Enumerated(rci.ReasonCode))
+			if err != nil {
+				return nil, errors.Wrap(err, "error marshaling reason code")
+			}
+			rc.Extensions = []pkix.Extension{{Id: oidExtensionReasonCode, Value: b}}
+		}
+		revoked = append(revoked, rc)
+	}
+
+	if number != nil {
+		return signCRL(issuer, signer, revoked, now, now.Add(validity), number)
+	}
+	crl, err := issuer.CreateCRL(rand.Reader, signer, revoked, now, now.Add(validity))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating crl")
+	}
+	return crl, nil
+}
+
+// writeFileAtomic writes a file using a temporary file in the same directory,
+// so RADIUS servers never read a partially written file.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	return nil
+}
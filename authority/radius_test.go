@@ -0,0 +1,171 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/db"
+)
+
+func newRADIUSExporter(t *testing.T, dir string, rcis []*db.RevokedCertificateInfo) *radiusExporter {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	intKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte("root"),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, rootKey.Public(), rootKey)
+	assert.FatalError(t, err)
+	root, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(2)
+	tmpl.Subject = pkix.Name{CommonName: "Intermediate CA"}
+	tmpl.SubjectKeyId = []byte("intermediate")
+	der, err = x509.CreateCertificate(rand.Reader, tmpl, root, intKey.Public(), rootKey)
+	assert.FatalError(t, err)
+	intermediate, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	return &radiusExporter{
+		dir:      dir,
+		validity: time.Hour,
+		roots:    []*x509.Certificate{root},
+		chain:    []*x509.Certificate{intermediate},
+		signer:   intKey,
+		list: func() ([]*db.RevokedCertificateInfo, error) {
+			return rcis, nil
+		},
+		now: time.Now,
+	}
+}
+
+func readRADIUSCRL(t *testing.T, e *radiusExporter) *pkix.CertificateList {
+	b, err := ioutil.ReadFile(filepath.Join(e.dir, radiusCRLFile))
+	assert.FatalError(t, err)
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatal("crl.pem does not contain a PEM CRL")
+	}
+	crl, err := x509.ParseCRL(block.Bytes)
+	assert.FatalError(t, err)
+	assert.FatalError(t, e.chain[0].CheckCRLSignature(crl))
+	return crl
+}
+
+func TestRADIUSExporter_export(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radius")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	revokedAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	e := newRADIUSExporter(t, filepath.Join(dir, "certs"), []*db.RevokedCertificateInfo{
+		{Serial: "1234", ReasonCode: 1, RevokedAt: revokedAt},
+		{Serial: "5678", RevokedAt: revokedAt},
+		{Serial: "not-a-number", RevokedAt: revokedAt},
+	})
+	now := time.Now().Truncate(time.Second)
+	assert.FatalError(t, e.export(now))
+
+	crl := readRADIUSCRL(t, e)
+	assert.Equals(t, now.UTC(), crl.TBSCertList.ThisUpdate.UTC())
+	assert.Equals(t, now.Add(time.Hour).UTC(), crl.TBSCertList.NextUpdate.UTC())
+	revoked := crl.TBSCertList.RevokedCertificates
+	assert.Equals(t, 2, len(revoked))
+	assert.Equals(t, big.NewInt(1234), revoked[0].SerialNumber)
+	assert.Equals(t, revokedAt, revoked[0].RevocationTime.UTC())
+	assert.Equals(t, 1, len(revoked[0].Extensions))
+	assert.Equals(t, oidExtensionReasonCode, revoked[0].Extensions[0].Id)
+	var reason asn1.Enumerated
+	_, err = asn1.Unmarshal(revoked[0].Extensions[0].Value, &reason)
+	assert.FatalError(t, err)
+	assert.Equals(t, asn1.Enumerated(1), reason)
+	assert.Equals(t, big.NewInt(5678), revoked[1].SerialNumber)
+	assert.Equals(t, 0, len(revoked[1].Extensions))
+
+	// DER files for NPS
+	b, err := ioutil.ReadFile(filepath.Join(e.dir, radiusDERCRLFile))
+	assert.FatalError(t, err)
+	_, err = x509.ParseDERCRL(b)
+	assert.FatalError(t, err)
+	b, err = ioutil.ReadFile(filepath.Join(e.dir, radiusIntermediateFile))
+	assert.FatalError(t, err)
+	assert.Equals(t, e.chain[0].Raw, b)
+	b, err = ioutil.ReadFile(filepath.Join(e.dir, radiusRootFile))
+	assert.FatalError(t, err)
+	assert.Equals(t, e.roots[0].Raw, b)
+
+	// PEM files for FreeRADIUS
+	b, err = ioutil.ReadFile(filepath.Join(e.dir, radiusCACRLFile))
+	assert.FatalError(t, err)
+	var types []string
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		types = append(types, block.Type)
+	}
+	assert.Equals(t, []string{"CERTIFICATE", "CERTIFICATE", "X509 CRL"}, types)
+	ca, err := ioutil.ReadFile(filepath.Join(e.dir, radiusCAFile))
+	assert.FatalError(t, err)
+	crlPEM, err := ioutil.ReadFile(filepath.Join(e.dir, radiusCRLFile))
+	assert.FatalError(t, err)
+	assert.Equals(t, append(ca, crlPEM...), b)
+}
+
+func TestRADIUSExporter_export_noDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radius")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	e := newRADIUSExporter(t, dir, nil)
+	e.list = nil
+	assert.FatalError(t, e.export(time.Now()))
+	assert.Equals(t, 0, len(readRADIUSCRL(t, e).TBSCertList.RevokedCertificates))
+}
+
+func TestRADIUSExporter_revoked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radius")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	e := newRADIUSExporter(t, dir, nil)
+	assert.FatalError(t, e.export(time.Now()))
+	assert.Equals(t, 0, len(readRADIUSCRL(t, e).TBSCertList.RevokedCertificates))
+
+	bus := events.NewBus()
+	e.start(bus)
+	defer e.Stop()
+
+	e.list = func() ([]*db.RevokedCertificateInfo, error) {
+		return []*db.RevokedCertificateInfo{{Serial: "1234", RevokedAt: time.Now()}}, nil
+	}
+	bus.Publish(&events.CertificateRevoked{Time: time.Now(), SerialNumber: "1234"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readRADIUSCRL(t, e).TBSCertList.RevokedCertificates) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("crl has not been updated after a revocation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,168 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// RenewWithCSR renews the given certificate with the subject alternative
+// names requested in the CSR. The CSR must be signed by the key of the
+// certificate, and the renewal policy must allow the requested names if they
+// are a subset or a superset of the names of the certificate. New names are
+// subject to the same policies as the names of a new certificate.
+func (a *Authority) RenewWithCSR(ctx context.Context, oldCert *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	return a.rekey(ctx, oldCert, nil, csr)
+}
+
+// sanSet returns the subject alternative names of a certificate or a CSR as
+// a set of normalized strings.
+func sanSet(dnsNames, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) map[string]bool {
+	set := make(map[string]bool)
+	for _, s := range dnsNames {
+		set["dns:"+strings.ToLower(s)] = true
+	}
+	for _, s := range emailAddresses {
+		set["email:"+strings.ToLower(s)] = true
+	}
+	for _, ip := range ipAddresses {
+		set["ip:"+ip.String()] = true
+	}
+	for _, u := range uris {
+		set["uri:"+u.String()] = true
+	}
+	return set
+}
+
+// addedSANs returns a certificate with the subject alternative names of cert
+// that are not in the given set.
+func addedSANs(cert *x509.Certificate, current map[string]bool) *x509.Certificate {
+	added := &x509.Certificate{}
+	for _, s := range cert.DNSNames {
+		if !current["dns:"+strings.ToLower(s)] {
+			added.DNSNames = append(added.DNSNames, s)
+		}
+	}
+	for _, s := range cert.EmailAddresses {
+		if !current["email:"+strings.ToLower(s)] {
+			added.EmailAddresses = append(added.EmailAddresses, s)
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if !current["ip:"+ip.String()] {
+			added.IPAddresses = append(added.IPAddresses, ip)
+		}
+	}
+	for _, u := range cert.URIs {
+		if !current["uri:"+u.String()] {
+			added.URIs = append(added.URIs, u)
+		}
+	}
+	return added
+}
+
+// isSubset returns true if all the elements of a are in b.
+func isSubset(a, b map[string]bool) bool {
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRenewalSANs validates the CSR of a renewal. The CSR must be signed by
+// the key of the certificate, it must request at least one name, and it can
+// only drop or add names if the renewal policy allows it. The common name of
+// the certificate cannot be dropped.
+func (a *Authority) checkRenewalSANs(oldCert *x509.Certificate, csr *x509.CertificateRequest) error {
+	if err := csr.CheckSignature(); err != nil {
+		return errs.BadRequestErr(err, errs.WithMessage("The renewal CSR signature is not valid."))
+	}
+	oldKey, err := x509.MarshalPKIXPublicKey(oldCert.PublicKey)
+	if err != nil {
+		return errs.BadRequestErr(err, errs.WithMessage("The certificate public key is not supported."))
+	}
+	newKey, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil || !bytes.Equal(oldKey, newKey) {
+		return errs.BadRequest("authority.checkRenewalSANs; csr public key does not match the certificate",
+			errs.WithMessage("The renewal CSR must be signed by the key of the certificate."))
+	}
+
+	current := sanSet(oldCert.DNSNames, oldCert.EmailAddresses, oldCert.IPAddresses, oldCert.URIs)
+	requested := sanSet(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs)
+	if len(requested) == 0 {
+		return errs.BadRequest("authority.checkRenewalSANs; csr does not have subject alternative names",
+			errs.WithMessage("The renewal CSR must request at least one subject alternative name."))
+	}
+
+	policy := a.config.AuthorityConfig.Renewal
+	if !isSubset(current, requested) && !policy.IsSANSubsetAllowed() {
+		return errs.Forbidden("authority.checkRenewalSANs; renewal cannot remove subject alternative names",
+			errs.WithMessage("The renewal policy does not allow removing subject alternative names."))
+	}
+	if !isSubset(requested, current) && !policy.IsSANSupersetAllowed() {
+		return errs.Forbidden("authority.checkRenewalSANs; renewal cannot add subject alternative names",
+			errs.WithMessage("The renewal policy does not allow adding subject alternative names."))
+	}
+
+	// The common name must still be one of the names of the certificate.
+	if cn := oldCert.Subject.CommonName; cn != "" && current["dns:"+strings.ToLower(cn)] {
+		if !requested["dns:"+strings.ToLower(cn)] {
+			return errs.Forbidden("authority.checkRenewalSANs; renewal cannot remove the common name %s", cn,
+				errs.WithMessage("The renewal CSR must include the common name of the certificate."))
+		}
+	}
+	return nil
+}
+
+// checkRenewalAddedSANs applies the issuance policies to the subject
+// alternative names that a renewal adds to the certificate, as they are issued
+// for the first time: the allowlist of the renewal policy, the schedule and
+// approval policy of the provisioner, the policy hooks and the issuance quotas
+// of the new names. Renewals that keep or drop names are not checked.
+//
+// It returns the id of the approval used, and the quota reservation of the new
+// names that must be recorded or released after signing the certificate.
+func (a *Authority) checkRenewalAddedSANs(ctx context.Context, oldCert, newCert *x509.Certificate, csr *x509.CertificateRequest) (string, *quotaReservation, error) {
+	current := sanSet(oldCert.DNSNames, oldCert.EmailAddresses, oldCert.IPAddresses, oldCert.URIs)
+	added := addedSANs(newCert, current)
+	if len(sanSet(added.DNSNames, added.EmailAddresses, added.IPAddresses, added.URIs)) == 0 {
+		return "", nil, nil
+	}
+
+	// The new names are not authorized by a token, the provisioner of the
+	// certificate is required to apply its policies.
+	prov, err := a.LoadProvisionerByCertificate(oldCert)
+	if err != nil {
+		return "", nil, errs.ForbiddenErr(err, errs.WithMessage("The provisioner of the certificate was not found."))
+	}
+	if err := checkProvisionerSchedule(prov, a.now()); err != nil {
+		return "", nil, errs.Wrap(http.StatusForbidden, err, "authority.checkRenewalAddedSANs")
+	}
+
+	// The policy hooks can modify the names of the certificate.
+	if err := a.evaluateX509PolicyHooks(&policyHookOption{ctx: ctx, provisioner: prov}, newCert); err != nil {
+		return "", nil, err
+	}
+	added = addedSANs(newCert, current)
+	if err := a.config.AuthorityConfig.Renewal.CheckAddedSANs(added); err != nil {
+		return "", nil, errs.ForbiddenErr(err, errs.WithMessage("The renewal policy does not allow adding the requested subject alternative names."))
+	}
+
+	approvalID, err := a.checkSignApproval(prov, csr, newCert)
+	if err != nil {
+		return "", nil, err
+	}
+	quotas, err := a.checkQuotas(added, "", false)
+	if err != nil {
+		return "", nil, err
+	}
+	return approvalID, quotas, nil
+}
@@ -0,0 +1,158 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/hooks"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestAuthority_RenewWithCSR(t *testing.T) {
+	a := testAuthority(t)
+	now := time.Now().UTC()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	cr, err := x509util.CreateCertificateRequest("a.smallstep.com", []string{"a.smallstep.com", "b.smallstep.com"}, priv)
+	assert.FatalError(t, err)
+	template, err := x509util.NewCertificate(cr)
+	assert.FatalError(t, err)
+	cert := template.GetCertificate()
+	for _, m := range []provisioner.CertificateModifierFunc{
+		withNotBeforeNotAfter(now.Add(-7*time.Minute), now),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+	} {
+		assert.FatalError(t, m.Modify(cert, provisioner.SignOptions{}))
+	}
+	cert, err = withSigner(getDefaultIssuer(a), getDefaultSigner(a))(cert, priv.Public())
+	assert.FatalError(t, err)
+
+	newCSR := func(signer crypto.Signer, sans ...string) *x509.CertificateRequest {
+		csr, err := x509util.CreateCertificateRequest("a.smallstep.com", sans, signer)
+		assert.FatalError(t, err)
+		return csr
+	}
+
+	tests := []struct {
+		name    string
+		renewal *config.RenewalConfig
+		csr     *x509.CertificateRequest
+		want    []string
+		code    int
+	}{
+		{"ok", nil, newCSR(priv, "b.smallstep.com", "a.smallstep.com"), []string{"b.smallstep.com", "a.smallstep.com"}, 0},
+		{"ok subset", &config.RenewalConfig{AllowSANSubset: true}, newCSR(priv, "a.smallstep.com"), []string{"a.smallstep.com"}, 0},
+		{"ok superset", &config.RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{"c.smallstep.com"}}, newCSR(priv, "a.smallstep.com", "b.smallstep.com", "c.smallstep.com"), []string{"a.smallstep.com", "b.smallstep.com", "c.smallstep.com"}, 0},
+		{"fail subset", nil, newCSR(priv, "a.smallstep.com"), nil, http.StatusForbidden},
+		{"fail superset", &config.RenewalConfig{AllowSANSubset: true}, newCSR(priv, "a.smallstep.com", "c.smallstep.com"), nil, http.StatusForbidden},
+		{"fail superset no allowlist", &config.RenewalConfig{AllowSANSuperset: true}, newCSR(priv, "a.smallstep.com", "b.smallstep.com", "c.smallstep.com"), nil, http.StatusForbidden},
+		{"fail superset not allowed", &config.RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{"c.smallstep.com"}}, newCSR(priv, "a.smallstep.com", "b.smallstep.com", "other.example.com"), nil, http.StatusForbidden},
+		{"fail common name", &config.RenewalConfig{AllowSANSubset: true}, newCSR(priv, "b.smallstep.com"), nil, http.StatusForbidden},
+		{"fail empty", &config.RenewalConfig{AllowSANSubset: true}, newCSR(priv), nil, http.StatusBadRequest},
+		{"fail key", nil, newCSR(other, "a.smallstep.com", "b.smallstep.com"), nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.config.AuthorityConfig.Renewal = tt.renewal
+			certChain, err := a.RenewWithCSR(context.Background(), cert, tt.csr)
+			if tt.code != 0 {
+				assert.Nil(t, certChain)
+				sc, ok := err.(errs.StatusCoder)
+				assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+				assert.Equals(t, tt.code, sc.StatusCode())
+				return
+			}
+			assert.FatalError(t, err)
+			leaf := certChain[0]
+			assert.Equals(t, tt.want, leaf.DNSNames)
+			assert.Equals(t, cert.Subject.CommonName, leaf.Subject.CommonName)
+			assert.Equals(t, cert.PublicKey, leaf.PublicKey)
+		})
+	}
+}
+
+func TestAuthority_RenewWithCSR_addedSANs(t *testing.T) {
+	a := testAuthority(t)
+	a.config.AuthorityConfig.Renewal = &config.RenewalConfig{AllowSANSuperset: true, AllowedAddedSANs: []string{"*.smallstep.com"}}
+	now := time.Now().UTC()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	cr, err := x509util.CreateCertificateRequest("a.smallstep.com", []string{"a.smallstep.com"}, priv)
+	assert.FatalError(t, err)
+	template, err := x509util.NewCertificate(cr)
+	assert.FatalError(t, err)
+	cert := template.GetCertificate()
+	for _, m := range []provisioner.CertificateModifierFunc{
+		withNotBeforeNotAfter(now.Add(-7*time.Minute), now),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+	} {
+		assert.FatalError(t, m.Modify(cert, provisioner.SignOptions{}))
+	}
+	cert, err = withSigner(getDefaultIssuer(a), getDefaultSigner(a))(cert, priv.Public())
+	assert.FatalError(t, err)
+
+	newCSR := func(sans ...string) *x509.CertificateRequest {
+		csr, err := x509util.CreateCertificateRequest("a.smallstep.com", sans, priv)
+		assert.FatalError(t, err)
+		return csr
+	}
+
+	// The policy hooks only receive the renewals that add names.
+	var requests []*hooks.Request
+	a.policyHooks = []hooks.Hook{&mockHook{
+		evaluate: func(ctx context.Context, req *hooks.Request) (*hooks.Decision, error) {
+			requests = append(requests, req)
+			for _, name := range req.X509.DNSNames {
+				if name == "denied.smallstep.com" {
+					return &hooks.Decision{Action: hooks.ActionDeny, Reason: "name not allowed"}, nil
+				}
+			}
+			return &hooks.Decision{Action: hooks.ActionAllow}, nil
+		},
+	}}
+	_, err = a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com"))
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, len(requests))
+
+	_, err = a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com", "denied.smallstep.com"))
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodePolicyDenied)
+	if assert.Equals(t, 1, len(requests)) {
+		assert.Equals(t, []string{"a.smallstep.com", "denied.smallstep.com"}, requests[0].X509.DNSNames)
+		assert.Equals(t, "Max", requests[0].Provisioner.Name)
+	}
+
+	certChain, err := a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com", "b.smallstep.com"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"a.smallstep.com", "b.smallstep.com"}, certChain[0].DNSNames)
+
+	// Only the names in the allowlist of the renewal policy can be added.
+	_, err = a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com", "other.example.com"))
+	assertCodeSigningError(t, err, http.StatusForbidden, errs.CodeForbidden)
+
+	// The added names count against the quotas, the renewed names do not.
+	a.policyHooks = nil
+	a.config.AuthorityConfig.Quotas = &config.QuotaConfig{MaxActivePerSAN: 1}
+	assert.FatalError(t, a.initQuotas())
+	_, err = a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com", "c.smallstep.com"))
+	assert.FatalError(t, err)
+	_, err = a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com"))
+	assert.FatalError(t, err)
+	_, err = a.RenewWithCSR(context.Background(), cert, newCSR("a.smallstep.com", "c.smallstep.com"))
+	assertCodeSigningError(t, err, http.StatusTooManyRequests, errs.CodeQuotaExceeded)
+}
@@ -0,0 +1,599 @@
+package authority
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/randutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	revocationJobsTable       = []byte("revocation_jobs")
+	provisionerCertsTable     = []byte("provisioner_x509_certs_index")
+	provisionerCertsHeadTable = []byte("provisioner_x509_certs_heads")
+)
+
+// revocationJobBatchSize is the number of certificates revoked before the
+// progress of a job is stored.
+const revocationJobBatchSize = 100
+
+// provisionerCertsChunkSize is the number of serial numbers stored in each
+// entry of the index of the certificates issued by a provisioner.
+const provisionerCertsChunkSize = 1000
+
+// provisionerCertsBackfillKey is the key of the index that records that the
+// certificates issued before the index existed have been added to it. It
+// cannot collide with the keys of the chunks, that end with "/<number>".
+var provisionerCertsBackfillKey = []byte("backfill")
+
+// RevocationJobStatus is the status of a revocation job.
+type RevocationJobStatus string
+
+// Revocation job statuses.
+const (
+	RevocationJobRunning   RevocationJobStatus = "running"
+	RevocationJobCompleted RevocationJobStatus = "completed"
+	RevocationJobFailed    RevocationJobStatus = "failed"
+)
+
+// RevokeProvisionerOptions are the options used to revoke all the active
+// certificates issued by a provisioner. With PassiveOnly the certificates are
+// only marked as revoked in the database, this blocks their renewal but they
+// are not revoked in the CAS.
+type RevokeProvisionerOptions struct {
+	Provisioner string `json:"provisioner"`
+	Reason      string `json:"reason,omitempty"`
+	ReasonCode  int    `json:"reasonCode,omitempty"`
+	PassiveOnly bool   `json:"passiveOnly,omitempty"`
+}
+
+// Validate validates the revocation options.
+func (o *RevokeProvisionerOptions) Validate() error {
+	switch {
+	case o.Provisioner == "":
+		return admin.NewError(admin.ErrorBadRequestType, "provisioner cannot be empty")
+	case o.ReasonCode < ocsp.Unspecified || o.ReasonCode > ocsp.AACompromise:
+		return admin.NewError(admin.ErrorBadRequestType, "reasonCode out of bounds")
+	default:
+		return nil
+	}
+}
+
+// RevocationJob is a background job that revokes all the active certificates
+// issued by a provisioner. The certificates are walked in the order they were
+// issued, and Cursor is the number of certificates already walked. The
+// progress is stored after every batch, and the job is resumed from the cursor
+// if the CA restarts. Expired certificates count as skipped. A job that fails
+// to revoke some certificates ends with the status failed, and it can be run
+// again with a new job.
+type RevocationJob struct {
+	ID string `json:"id"`
+	RevokeProvisionerOptions
+	ProvisionerID string              `json:"provisionerID,omitempty"`
+	Status        RevocationJobStatus `json:"status"`
+	Total         int                 `json:"total"`
+	Processed     int                 `json:"processed"`
+	Revoked       int                 `json:"revoked"`
+	Skipped       int                 `json:"skipped"`
+	Failed        int                 `json:"failed"`
+	Cursor        int                 `json:"cursor,omitempty"`
+	Error         string              `json:"error,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt"`
+}
+
+// certificatesLister is implemented by the databases that can list the
+// issued certificates.
+type certificatesLister interface {
+	GetCertificates() ([]*x509.Certificate, error)
+}
+
+// revocationJobStore keeps the revocation jobs in the database.
+type revocationJobStore struct {
+	db nosql.DB
+}
+
+func newRevocationJobStore(db nosql.DB) (*revocationJobStore, error) {
+	if err := db.CreateTable(revocationJobsTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(revocationJobsTable))
+	}
+	return &revocationJobStore{db: db}, nil
+}
+
+func (s *revocationJobStore) get(id string) (*RevocationJob, bool, error) {
+	b, err := s.db.Get(revocationJobsTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, errors.Wrapf(err, "error loading revocation job %s", id)
+	}
+	job := new(RevocationJob)
+	if err := json.Unmarshal(b, job); err != nil {
+		return nil, false, errors.Wrapf(err, "error unmarshaling revocation job %s", id)
+	}
+	return job, true, nil
+}
+
+func (s *revocationJobStore) list() ([]*RevocationJob, error) {
+	entries, err := s.db.List(revocationJobsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading revocation jobs")
+	}
+	jobs := []*RevocationJob{}
+	for _, e := range entries {
+		job := new(RevocationJob)
+		if err := json.Unmarshal(e.Value, job); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revocation job %s", string(e.Key))
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+func (s *revocationJobStore) save(job *RevocationJob) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling revocation job %s", job.ID)
+	}
+	return errors.Wrapf(s.db.Set(revocationJobsTable, []byte(job.ID), b), "error storing revocation job %s", job.ID)
+}
+
+// provisionerCertsIndex keeps the serial numbers of the certificates issued
+// by each provisioner, in the order they were issued, so the revocation jobs
+// don't need to load all the certificates. The serial numbers are stored in
+// chunks of provisionerCertsChunkSize, with the keys "<provisioner>/<chunk>",
+// and the number of the last chunk of a provisioner is stored in a separate
+// table.
+type provisionerCertsIndex struct {
+	db nosql.DB
+}
+
+func newProvisionerCertsIndex(db nosql.DB) (*provisionerCertsIndex, error) {
+	for _, t := range [][]byte{provisionerCertsTable, provisionerCertsHeadTable} {
+		if err := db.CreateTable(t); err != nil {
+			return nil, errors.Wrapf(err, "error creating table %s", string(t))
+		}
+	}
+	return &provisionerCertsIndex{db: db}, nil
+}
+
+func provisionerCertsKey(name string, chunk int) []byte {
+	return []byte(name + "/" + strconv.Itoa(chunk))
+}
+
+// get returns the serial numbers of the given chunk, and its stored value.
+func (x *provisionerCertsIndex) get(name string, chunk int) ([]string, []byte, error) {
+	b, err := x.db.Get(provisionerCertsTable, provisionerCertsKey(name, chunk))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrapf(err, "error loading certificates of provisioner %s", name)
+	}
+	var serials []string
+	if err := json.Unmarshal(b, &serials); err != nil {
+		return nil, nil, errors.Wrapf(err, "error unmarshaling certificates of provisioner %s", name)
+	}
+	return serials, b, nil
+}
+
+// head returns the number of the last chunk of a provisioner, and its stored
+// value.
+func (x *provisionerCertsIndex) head(name string) (int, []byte, error) {
+	b, err := x.db.Get(provisionerCertsHeadTable, []byte(name))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return 0, nil, nil
+	case err != nil:
+		return 0, nil, errors.Wrapf(err, "error loading certificates of provisioner %s", name)
+	}
+	chunk, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "error parsing certificates of provisioner %s", name)
+	}
+	return chunk, b, nil
+}
+
+// add appends the given serial numbers to the index of a provisioner. The
+// chunks are updated with compare-and-swap, so all the replicas can add
+// certificates at the same time.
+func (x *provisionerCertsIndex) add(name string, serials ...string) error {
+	for len(serials) > 0 {
+		chunk, oldHead, err := x.head(name)
+		if err != nil {
+			return err
+		}
+		current, old, err := x.get(name, chunk)
+		if err != nil {
+			return err
+		}
+		if len(current) >= provisionerCertsChunkSize {
+			newHead := []byte(strconv.Itoa(chunk + 1))
+			if _, _, err := x.db.CmpAndSwap(provisionerCertsHeadTable, []byte(name), oldHead, newHead); err != nil {
+				return errors.Wrapf(err, "error storing certificates of provisioner %s", name)
+			}
+			continue
+		}
+		n := provisionerCertsChunkSize - len(current)
+		if n > len(serials) {
+			n = len(serials)
+		}
+		b, err := json.Marshal(append(current, serials[:n]...))
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling certificates of provisioner %s", name)
+		}
+		_, swapped, err := x.db.CmpAndSwap(provisionerCertsTable, provisionerCertsKey(name, chunk), old, b)
+		if err != nil {
+			return errors.Wrapf(err, "error storing certificates of provisioner %s", name)
+		}
+		if swapped {
+			serials = serials[n:]
+		}
+	}
+	return nil
+}
+
+// backfill adds the certificates issued before the index existed. It loads
+// all the certificates only once.
+func (x *provisionerCertsIndex) backfill(list func() ([]*x509.Certificate, error)) error {
+	if _, err := x.db.Get(provisionerCertsTable, provisionerCertsBackfillKey); err == nil {
+		return nil
+	} else if !nosql.IsErrNotFound(err) {
+		return errors.Wrap(err, "error loading certificates index")
+	}
+	certs, err := list()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		return certs[i].NotBefore.Before(certs[j].NotBefore)
+	})
+	var names []string
+	serials := make(map[string][]string)
+	for _, crt := range certs {
+		if name, ok := provisioner.GetProvisionerName(crt.Extensions); ok {
+			if _, ok := serials[name]; !ok {
+				names = append(names, name)
+			}
+			serials[name] = append(serials[name], crt.SerialNumber.String())
+		}
+	}
+	for _, name := range names {
+		if err := x.add(name, serials[name]...); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(x.db.Set(provisionerCertsTable, provisionerCertsBackfillKey, []byte("1")), "error storing certificates index")
+}
+
+// revocationJobRunner runs the pending revocation jobs in the background.
+type revocationJobRunner struct {
+	store   *revocationJobStore
+	index   *provisionerCertsIndex
+	list    func() ([]*x509.Certificate, error)
+	get     func(serial string) (*x509.Certificate, error)
+	revoke  func(crt *x509.Certificate, job *RevocationJob) error
+	now     func() time.Time
+	lease   *leaderLease
+	refresh chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// initRevocationJobs initializes the store of the revocation jobs and starts
+// the goroutine that runs them. The jobs are not available if the database
+// cannot list the issued certificates.
+func (a *Authority) initRevocationJobs() error {
+	if a.revocationJobs != nil {
+		return nil
+	}
+	l, ok := a.db.(certificatesLister)
+	if !ok {
+		return nil
+	}
+	store, err := newRevocationJobStore(a.getStateDB())
+	if err != nil {
+		return err
+	}
+	index, err := newProvisionerCertsIndex(a.getStateDB())
+	if err != nil {
+		return err
+	}
+
+	r := &revocationJobRunner{
+		store:   store,
+		index:   index,
+		list:    l.GetCertificates,
+		get:     a.db.GetCertificate,
+		revoke:  a.revokeForJob,
+		now:     a.now,
+		refresh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	// With multiple replicas, only the one holding the lease runs the jobs.
+	r.lease = a.leaderElector.newLease("revocation-jobs")
+	go r.run()
+	a.revocationJobs = r
+	return nil
+}
+
+func (r *revocationJobRunner) run() {
+	defer close(r.stopped)
+	// Resume the jobs interrupted by a restart.
+	r.runPending()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.refresh:
+		case <-r.lease.Elected():
+		}
+		r.runPending()
+	}
+}
+
+// Stop stops the revocation jobs, the job running is resumed the next time
+// the authority starts.
+func (r *revocationJobRunner) Stop() {
+	close(r.done)
+	<-r.stopped
+	r.lease.Stop()
+}
+
+// signal wakes up the goroutine running the jobs.
+func (r *revocationJobRunner) signal() {
+	select {
+	case r.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// stopping returns true if the jobs must be stopped.
+func (r *revocationJobRunner) stopping() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return !r.lease.IsLeader()
+	}
+}
+
+func (r *revocationJobRunner) runPending() {
+	if !r.lease.IsLeader() {
+		return
+	}
+	// The certificates issued before the index existed are added once.
+	if err := r.index.backfill(r.list); err != nil {
+		log.Printf("error indexing the certificates of the provisioners: %v", err)
+		return
+	}
+	jobs, err := r.store.list()
+	if err != nil {
+		log.Printf("error loading revocation jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if r.stopping() {
+			return
+		}
+		if job.Status != RevocationJobRunning {
+			continue
+		}
+		if err := r.runJob(job); err != nil {
+			log.Printf("error running revocation job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// runJob revokes the active certificates of the job provisioner, walking the
+// index of the provisioner from the cursor of the job.
+func (r *revocationJobRunner) runJob(job *RevocationJob) error {
+	fail := func(err error) error {
+		job.Status = RevocationJobFailed
+		job.Error = err.Error()
+		job.UpdatedAt = r.now().UTC()
+		return r.store.save(job)
+	}
+
+	head, _, err := r.index.head(job.Provisioner)
+	if err != nil {
+		return fail(err)
+	}
+	last, _, err := r.index.get(job.Provisioner, head)
+	if err != nil {
+		return fail(err)
+	}
+	job.Total = head*provisionerCertsChunkSize + len(last)
+
+	for {
+		serials, _, err := r.index.get(job.Provisioner, job.Cursor/provisionerCertsChunkSize)
+		if err != nil {
+			return fail(err)
+		}
+		offset := job.Cursor % provisionerCertsChunkSize
+		if offset >= len(serials) {
+			break
+		}
+		for _, sn := range serials[offset:] {
+			if r.stopping() {
+				job.UpdatedAt = r.now().UTC()
+				return r.store.save(job)
+			}
+			r.revokeSerial(job, sn)
+			job.Processed++
+			job.Cursor++
+			if job.Processed%revocationJobBatchSize == 0 {
+				job.UpdatedAt = r.now().UTC()
+				if err := r.store.save(job); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if job.Total < job.Processed {
+		job.Total = job.Processed
+	}
+
+	job.Status = RevocationJobCompleted
+	if job.Failed > 0 {
+		job.Status = RevocationJobFailed
+		job.Error = fmt.Sprintf("%d certificates could not be revoked", job.Failed)
+	}
+	job.UpdatedAt = r.now().UTC()
+	return r.store.save(job)
+}
+
+// revokeSerial revokes the certificate with the given serial number if it is
+// still active, and updates the counters of the job.
+func (r *revocationJobRunner) revokeSerial(job *RevocationJob, sn string) {
+	crt, err := r.get(sn)
+	if err != nil {
+		log.Printf("error loading certificate %s in job %s: %v", sn, job.ID, err)
+		job.Failed++
+		return
+	}
+	if r.now().After(crt.NotAfter) {
+		job.Skipped++
+		return
+	}
+	switch err := r.revoke(crt, job); err {
+	case nil:
+		job.Revoked++
+	case db.ErrAlreadyExists:
+		job.Skipped++
+	default:
+		log.Printf("error revoking certificate %s in job %s: %v", sn, job.ID, err)
+		job.Failed++
+	}
+}
+
+// indexCertificate adds a certificate stored in the database to the index of
+// the certificates of its provisioner. It does nothing if the revocation jobs
+// are not enabled.
+func (a *Authority) indexCertificate(crt *x509.Certificate) error {
+	if a.revocationJobs == nil {
+		return nil
+	}
+	name, ok := provisioner.GetProvisionerName(crt.Extensions)
+	if !ok {
+		return nil
+	}
+	return a.revocationJobs.index.add(name, crt.SerialNumber.String())
+}
+
+// revokeForJob revokes a certificate of a revocation job. It returns
+// db.ErrAlreadyExists if the certificate was already revoked.
+func (a *Authority) revokeForJob(crt *x509.Certificate, job *RevocationJob) error {
+	serial := crt.SerialNumber.String()
+	if isRevoked, err := a.IsRevoked(serial); err != nil {
+		return err
+	} else if isRevoked {
+		return db.ErrAlreadyExists
+	}
+
+	rci := &db.RevokedCertificateInfo{
+		Serial:        serial,
+		ProvisionerID: job.ProvisionerID,
+		ReasonCode:    job.ReasonCode,
+		Reason:        job.Reason,
+		RevokedAt:     a.now().UTC(),
+	}
+	if _, err := a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+		Certificate:  crt,
+		SerialNumber: serial,
+		Reason:       job.Reason,
+		ReasonCode:   job.ReasonCode,
+		PassiveOnly:  job.PassiveOnly,
+	}); err != nil {
+		return err
+	}
+	if err := a.revoke(crt, rci); err != nil {
+		return err
+	}
+	a.events.Publish(&events.CertificateRevoked{
+		Time:          rci.RevokedAt,
+		SerialNumber:  rci.Serial,
+		ReasonCode:    rci.ReasonCode,
+		Reason:        rci.Reason,
+		ProvisionerID: rci.ProvisionerID,
+		Certificate:   crt,
+	})
+	return nil
+}
+
+// RevokeProvisioner starts a background job that revokes all the active
+// certificates issued by a provisioner. The provisioner does not need to
+// exist, so the certificates of a deleted provisioner can be revoked too.
+func (a *Authority) RevokeProvisioner(opts *RevokeProvisionerOptions) (*RevocationJob, error) {
+	if a.revocationJobs == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "revocation jobs are not supported by the database")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	id, err := randutil.Hex(16)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating revocation job id")
+	}
+	now := a.now().UTC()
+	job := &RevocationJob{
+		ID:                       id,
+		RevokeProvisionerOptions: *opts,
+		Status:                   RevocationJobRunning,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+	}
+	if p, err := a.LoadProvisionerByName(opts.Provisioner); err == nil {
+		job.ProvisionerID = p.GetID()
+	}
+	if err := a.revocationJobs.store.save(job); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing revocation job")
+	}
+	a.revocationJobs.signal()
+	return job, nil
+}
+
+// GetRevocationJob returns the revocation job with the given id.
+func (a *Authority) GetRevocationJob(id string) (*RevocationJob, error) {
+	if a.revocationJobs == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "revocation jobs are not supported by the database")
+	}
+	job, ok, err := a.revocationJobs.store.get(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading revocation job")
+	}
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "revocation job %s not found", id)
+	}
+	return job, nil
+}
+
+// GetRevocationJobs returns all the revocation jobs.
+func (a *Authority) GetRevocationJobs() ([]*RevocationJob, error) {
+	if a.revocationJobs == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "revocation jobs are not supported by the database")
+	}
+	jobs, err := a.revocationJobs.store.list()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading revocation jobs")
+	}
+	return jobs, nil
+}
@@ -0,0 +1,196 @@
+package authority
+
+import (
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func withValidity(serial int64, notAfter time.Time) provisioner.CertificateModifierFunc {
+	return func(crt *x509.Certificate, _ provisioner.SignOptions) error {
+		crt.SerialNumber = big.NewInt(serial)
+		crt.NotBefore = notAfter.Add(-48 * time.Hour)
+		crt.NotAfter = notAfter
+		return nil
+	}
+}
+
+func TestRevocationJobRunner_runJob(t *testing.T) {
+	root, signer := generateRootCertificate(t)
+	now := time.Now()
+	newCert := func(serial int64, name string, notAfter time.Time) *x509.Certificate {
+		return generateCertificate(t, "test", nil,
+			withValidity(serial, notAfter),
+			withProvisionerOID(name, "kid"),
+			withSigner(root, signer))
+	}
+	certs := []*x509.Certificate{
+		newCert(1, "foo", now.Add(time.Hour)),
+		newCert(2, "foo", now.Add(-time.Hour)),
+		newCert(3, "bar", now.Add(time.Hour)),
+		newCert(4, "foo", now.Add(time.Hour)),
+		newCert(5, "foo", now.Add(time.Hour)),
+		newCert(6, "foo", now.Add(time.Hour)),
+	}
+
+	d := db.NewMemoryDB()
+	store, err := newRevocationJobStore(d)
+	assert.FatalError(t, err)
+	index, err := newProvisionerCertsIndex(d)
+	assert.FatalError(t, err)
+	var revoked []string
+	r := &revocationJobRunner{
+		store: store,
+		index: index,
+		list: func() ([]*x509.Certificate, error) {
+			return certs, nil
+		},
+		get: func(serial string) (*x509.Certificate, error) {
+			for _, crt := range certs {
+				if crt.SerialNumber.String() == serial {
+					return crt, nil
+				}
+			}
+			return nil, errors.New("not found")
+		},
+		revoke: func(crt *x509.Certificate, job *RevocationJob) error {
+			switch sn := crt.SerialNumber.String(); sn {
+			case "4":
+				return db.ErrAlreadyExists
+			case "5":
+				return errors.New("force")
+			default:
+				revoked = append(revoked, sn)
+				return nil
+			}
+		},
+		now:  time.Now,
+		done: make(chan struct{}),
+	}
+
+	// Run a new job, after indexing the existing certificates
+	job := &RevocationJob{ID: "1", RevokeProvisionerOptions: RevokeProvisionerOptions{Provisioner: "foo"}, Status: RevocationJobRunning}
+	assert.FatalError(t, r.store.save(job))
+	r.runPending()
+	got, ok, err := r.store.get("1")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	assert.Equals(t, RevocationJobFailed, got.Status)
+	assert.Equals(t, "1 certificates could not be revoked", got.Error)
+	assert.Equals(t, []string{"1", "6"}, revoked)
+	assert.Equals(t, 5, got.Total)
+	assert.Equals(t, 5, got.Processed)
+	assert.Equals(t, 2, got.Revoked)
+	assert.Equals(t, 2, got.Skipped)
+	assert.Equals(t, 1, got.Failed)
+	assert.Equals(t, 5, got.Cursor)
+
+	// Resume a job after the last certificate processed
+	revoked = nil
+	job = &RevocationJob{ID: "2", RevokeProvisionerOptions: RevokeProvisionerOptions{Provisioner: "foo"}, Status: RevocationJobRunning, Processed: 4, Revoked: 1, Skipped: 2, Cursor: 4}
+	assert.FatalError(t, r.store.save(job))
+	r.runPending()
+	got, _, err = r.store.get("2")
+	assert.FatalError(t, err)
+	assert.Equals(t, RevocationJobCompleted, got.Status)
+	assert.Equals(t, []string{"6"}, revoked)
+	assert.Equals(t, 5, got.Total)
+	assert.Equals(t, 2, got.Revoked)
+
+	// Finished jobs are not run again, and the certificates are indexed once
+	revoked = nil
+	r.list = func() ([]*x509.Certificate, error) {
+		return nil, errors.New("force")
+	}
+	r.runPending()
+	assert.Len(t, 0, revoked)
+
+	// Index error
+	assert.FatalError(t, d.Set(provisionerCertsHeadTable, []byte("foo"), []byte("bad")))
+	job = &RevocationJob{ID: "3", RevokeProvisionerOptions: RevokeProvisionerOptions{Provisioner: "foo"}, Status: RevocationJobRunning}
+	assert.FatalError(t, r.store.save(job))
+	r.runPending()
+	got, _, err = r.store.get("3")
+	assert.FatalError(t, err)
+	assert.Equals(t, RevocationJobFailed, got.Status)
+	assert.HasPrefix(t, got.Error, "error parsing certificates of provisioner foo")
+}
+
+func TestProvisionerCertsIndex_add(t *testing.T) {
+	index, err := newProvisionerCertsIndex(db.NewMemoryDB())
+	assert.FatalError(t, err)
+
+	var serials []string
+	for i := 0; i < provisionerCertsChunkSize+2; i++ {
+		serials = append(serials, strconv.Itoa(i))
+	}
+	assert.FatalError(t, index.add("foo", serials[:provisionerCertsChunkSize-1]...))
+	assert.FatalError(t, index.add("foo", serials[provisionerCertsChunkSize-1:]...))
+	assert.FatalError(t, index.add("bar", "x"))
+
+	head, _, err := index.head("foo")
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, head)
+	first, _, err := index.get("foo", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, serials[:provisionerCertsChunkSize], first)
+	last, _, err := index.get("foo", 1)
+	assert.FatalError(t, err)
+	assert.Equals(t, serials[provisionerCertsChunkSize:], last)
+
+	head, _, err = index.head("bar")
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, head)
+	other, _, err := index.get("bar", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"x"}, other)
+}
+
+func TestAuthority_RevokeProvisioner(t *testing.T) {
+	a := testAuthority(t)
+	_, err := a.RevokeProvisioner(&RevokeProvisionerOptions{Provisioner: "Max"})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotImplemented, err.(*admin.Error).StatusCode())
+	}
+
+	store, err := newRevocationJobStore(db.NewMemoryDB())
+	assert.FatalError(t, err)
+	a.revocationJobs = &revocationJobRunner{store: store, refresh: make(chan struct{}, 1)}
+
+	_, err = a.RevokeProvisioner(&RevokeProvisionerOptions{})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusBadRequest, err.(*admin.Error).StatusCode())
+	}
+	_, err = a.RevokeProvisioner(&RevokeProvisionerOptions{Provisioner: "Max", ReasonCode: 11})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusBadRequest, err.(*admin.Error).StatusCode())
+	}
+
+	job, err := a.RevokeProvisioner(&RevokeProvisionerOptions{Provisioner: "Max", Reason: "key compromise", ReasonCode: 1})
+	assert.FatalError(t, err)
+	assert.Equals(t, RevocationJobRunning, job.Status)
+	assert.NotEquals(t, "", job.ProvisionerID)
+	assert.Len(t, 1, a.revocationJobs.refresh)
+
+	got, err := a.GetRevocationJob(job.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, job, got)
+
+	jobs, err := a.GetRevocationJobs()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*RevocationJob{job}, jobs)
+
+	_, err = a.GetRevocationJob("missing")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotFound, err.(*admin.Error).StatusCode())
+	}
+}
@@ -0,0 +1,179 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+	kmsapi "github.com/smallstep/certificates/kms/apiv1"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+)
+
+// RootsManifest is the list of the current and next roots of the authority.
+// The manifest is a JWT signed by a current root, so a client that trusts it
+// can trust the next roots before the authority starts using them.
+type RootsManifest struct {
+	jose.Claims
+	Current []RootVersion `json:"current"`
+	Next    []RootVersion `json:"next"`
+}
+
+// RootVersion is a root certificate in the roots manifest and the time the
+// authority starts using it.
+type RootVersion struct {
+	Certificate []byte    `json:"crt"`
+	Fingerprint string    `json:"fingerprint"`
+	ActivatesAt time.Time `json:"activatesAt"`
+}
+
+// X509Certificate parses the certificate of the root version and checks its
+// fingerprint.
+func (v *RootVersion) X509Certificate() (*x509.Certificate, error) {
+	crt, err := x509.ParseCertificate(v.Certificate)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing root certificate")
+	}
+	if fingerprint(crt) != v.Fingerprint {
+		return nil, errors.Errorf("root certificate does not match the fingerprint %s", v.Fingerprint)
+	}
+	return crt, nil
+}
+
+// newRootVersion returns the root version of the given root certificate.
+func newRootVersion(crt *x509.Certificate, activatesAt time.Time) RootVersion {
+	return RootVersion{
+		Certificate: crt.Raw,
+		Fingerprint: fingerprint(crt),
+		ActivatesAt: activatesAt.UTC(),
+	}
+}
+
+// VerifyRootsManifest verifies that the given roots manifest has been signed
+// by one of the given roots, and returns it.
+func VerifyRootsManifest(token string, roots []*x509.Certificate) (*RootsManifest, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing roots manifest")
+	}
+	for _, root := range roots {
+		var m RootsManifest
+		if err := jwt.Claims(root.PublicKey, &m); err != nil {
+			continue
+		}
+		for _, versions := range [][]RootVersion{m.Current, m.Next} {
+			for _, v := range versions {
+				if _, err := v.X509Certificate(); err != nil {
+					return nil, errors.Wrap(err, "error validating roots manifest")
+				}
+			}
+		}
+		return &m, nil
+	}
+	return nil, errors.New("roots manifest is not signed by a trusted root")
+}
+
+// GetRootsManifest returns the signed manifest with the current and next
+// roots of the authority.
+func (a *Authority) GetRootsManifest() (string, error) {
+	if a.rootsManifest == "" {
+		return "", errs.NotFound("root rollover is not configured")
+	}
+	return a.rootsManifest, nil
+}
+
+// initRootRollover signs the roots manifest with the key of the current root.
+// The key is only used here, the authority keeps the signed manifest.
+func (a *Authority) initRootRollover() error {
+	c := a.config.RootRollover
+	if c == nil {
+		return nil
+	}
+
+	m := &RootsManifest{
+		Claims: jose.Claims{
+			IssuedAt: jose.NewNumericDate(time.Now()),
+		},
+	}
+	for _, crt := range a.rootX509Certs {
+		m.Current = append(m.Current, newRootVersion(crt, crt.NotBefore))
+	}
+	for _, r := range c.NextRoots {
+		crt, err := pemutil.ReadCertificate(r.Root)
+		if err != nil {
+			return err
+		}
+		m.Next = append(m.Next, newRootVersion(crt, r.ActivatesAt))
+	}
+
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: c.RootKey,
+		Password:   []byte(a.config.Password),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating roots manifest signer")
+	}
+	if !isRootKey(signer.Public(), a.rootX509Certs) {
+		return errors.New("rootRollover.rootKey is not the key of a current root")
+	}
+	token, err := signRootsManifest(signer, m)
+	if err != nil {
+		return err
+	}
+	a.rootsManifest = token
+	return nil
+}
+
+// isRootKey returns if the public key is the key of one of the given roots.
+func isRootKey(pub crypto.PublicKey, roots []*x509.Certificate) bool {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return false
+	}
+	for _, crt := range roots {
+		if bytes.Equal(b, crt.RawSubjectPublicKeyInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// signRootsManifest returns the roots manifest signed with the given key.
+func signRootsManifest(key crypto.Signer, m *RootsManifest) (string, error) {
+	var alg jose.SignatureAlgorithm
+	switch k := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().Name {
+		case "P-256":
+			alg = jose.ES256
+		case "P-384":
+			alg = jose.ES384
+		case "P-521":
+			alg = jose.ES512
+		default:
+			return "", errors.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		alg = jose.EdDSA
+	case *rsa.PublicKey:
+		alg = jose.DefaultRSASigAlgorithm
+	default:
+		return "", errors.Errorf("unsupported key type %T", k)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, new(jose.SignerOptions).WithType("JWT"))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating jose.Signer")
+	}
+	token, err := jose.Signed(signer).Claims(m).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "error signing roots manifest")
+	}
+	return token, nil
+}
@@ -0,0 +1,91 @@
+package authority
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"go.step.sm/crypto/pemutil"
+)
+
+func TestAuthority_initRootRollover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollover")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	root, rootKey := newAttestationCert(t, "Root CA", true, nil, nil)
+	next, _ := newAttestationCert(t, "Root CA 2", true, nil, nil)
+	other, otherKey := newAttestationCert(t, "Other Root CA", true, nil, nil)
+
+	writeFile := func(name string, block *pem.Block) string {
+		fn := filepath.Join(dir, name)
+		assert.FatalError(t, ioutil.WriteFile(fn, pem.EncodeToMemory(block), 0600))
+		return fn
+	}
+	block, err := pemutil.Serialize(rootKey)
+	assert.FatalError(t, err)
+	rootKeyFile := writeFile("root_ca_key", block)
+	block, err = pemutil.Serialize(otherKey)
+	assert.FatalError(t, err)
+	otherKeyFile := writeFile("other_ca_key", block)
+	nextFile := writeFile("root_ca_2.crt", &pem.Block{Type: "CERTIFICATE", Bytes: next.Raw})
+
+	a := testAuthority(t)
+	_, err = a.GetRootsManifest()
+	assert.NotNil(t, err)
+
+	activatesAt := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	a.rootX509Certs = []*x509.Certificate{root}
+	a.config.RootRollover = &config.RootRolloverConfig{
+		RootKey:   otherKeyFile,
+		NextRoots: []config.NextRoot{{Root: nextFile, ActivatesAt: activatesAt}},
+	}
+	assert.NotNil(t, a.initRootRollover())
+
+	a.config.RootRollover.NextRoots[0].Root = filepath.Join(dir, "missing.crt")
+	a.config.RootRollover.RootKey = rootKeyFile
+	assert.NotNil(t, a.initRootRollover())
+
+	a.config.RootRollover.NextRoots[0].Root = nextFile
+	assert.FatalError(t, a.initRootRollover())
+	token, err := a.GetRootsManifest()
+	assert.FatalError(t, err)
+
+	m, err := VerifyRootsManifest(token, []*x509.Certificate{other, root})
+	assert.FatalError(t, err)
+	assert.Len(t, 1, m.Current)
+	assert.Equals(t, fingerprint(root), m.Current[0].Fingerprint)
+	assert.True(t, root.NotBefore.Equal(m.Current[0].ActivatesAt))
+	assert.Len(t, 1, m.Next)
+	crt, err := m.Next[0].X509Certificate()
+	assert.FatalError(t, err)
+	assert.Equals(t, next.Raw, crt.Raw)
+	assert.True(t, activatesAt.Equal(m.Next[0].ActivatesAt))
+
+	_, err = VerifyRootsManifest(token, []*x509.Certificate{other})
+	assert.NotNil(t, err)
+	_, err = VerifyRootsManifest("foo", []*x509.Certificate{root})
+	assert.NotNil(t, err)
+}
+
+func TestRootVersion_X509Certificate(t *testing.T) {
+	root, _ := newAttestationCert(t, "Root CA", true, nil, nil)
+	v := newRootVersion(root, root.NotBefore)
+	crt, err := v.X509Certificate()
+	assert.FatalError(t, err)
+	assert.Equals(t, root.Raw, crt.Raw)
+
+	v.Fingerprint = "foo"
+	_, err = v.X509Certificate()
+	assert.NotNil(t, err)
+
+	v.Certificate = []byte("foo")
+	_, err = v.X509Certificate()
+	assert.NotNil(t, err)
+}
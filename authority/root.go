@@ -42,6 +42,14 @@ func (a *Authority) GetRoots() ([]*x509.Certificate, error) {
 	return a.rootX509Certs, nil
 }
 
+// GetIntermediates returns the intermediate certificates used to sign X.509
+// certificates. It's empty if the intermediates are managed by an external
+// certificate authority service.
+// This method implements the Authority interface.
+func (a *Authority) GetIntermediates() ([]*x509.Certificate, error) {
+	return a.intermediateX509Certs, nil
+}
+
 // GetFederation returns all the root certificates in the federation.
 // This method implements the Authority interface.
 func (a *Authority) GetFederation() (federation []*x509.Certificate, err error) {
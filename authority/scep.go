@@ -0,0 +1,48 @@
+package authority
+
+import (
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/scep"
+)
+
+// GetSCEPPendingRequests returns the SCEP enrollments waiting for manual
+// approval.
+func (a *Authority) GetSCEPPendingRequests() ([]*scep.PendingRequest, error) {
+	if a.scepService == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "scep is not enabled")
+	}
+	prs, err := a.scepService.GetPendingRequests()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading scep pending requests")
+	}
+	return prs, nil
+}
+
+// ApproveSCEPPendingRequest approves the SCEP enrollment with the given
+// transaction id.
+func (a *Authority) ApproveSCEPPendingRequest(id string) (*scep.PendingRequest, error) {
+	if a.scepService == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "scep is not enabled")
+	}
+	return wrapSCEPPendingError(a.scepService.ApprovePendingRequest(id))
+}
+
+// RejectSCEPPendingRequest rejects the SCEP enrollment with the given
+// transaction id.
+func (a *Authority) RejectSCEPPendingRequest(id string) (*scep.PendingRequest, error) {
+	if a.scepService == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "scep is not enabled")
+	}
+	return wrapSCEPPendingError(a.scepService.RejectPendingRequest(id))
+}
+
+func wrapSCEPPendingError(pr *scep.PendingRequest, err error) (*scep.PendingRequest, error) {
+	switch {
+	case err == nil:
+		return pr, nil
+	case err == scep.ErrPendingRequestNotFound:
+		return nil, admin.WrapError(admin.ErrorNotFoundType, err, "scep pending request not found")
+	default:
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error updating scep pending request")
+	}
+}
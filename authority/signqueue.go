@@ -0,0 +1,80 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+)
+
+// signQueue limits the number of sign operations running at the same time.
+// Operations that cannot run right away wait in a bounded queue.
+type signQueue struct {
+	workers    chan struct{}
+	waiting    int32
+	queueSize  int32
+	maxWait    time.Duration
+	retryAfter time.Duration
+}
+
+// newSignQueue creates the sign queue with the given configuration, or returns
+// nil if the queue is not configured.
+func newSignQueue(c *config.SignQueueConfig) *signQueue {
+	if c == nil {
+		return nil
+	}
+	return &signQueue{
+		workers:    make(chan struct{}, c.GetWorkers()),
+		queueSize:  int32(c.GetQueueSize()),
+		maxWait:    c.GetMaxWait(),
+		retryAfter: c.GetRetryAfter(),
+	}
+}
+
+// acquire waits for a worker and returns the function that releases it. It
+// fails with a 503 Service Unavailable error with a Retry-After if the queue
+// is full or the maximum wait time expires. A nil queue always succeeds.
+func (q *signQueue) acquire(ctx context.Context) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+	release := func() { <-q.workers }
+
+	select {
+	case q.workers <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if atomic.AddInt32(&q.waiting, 1) > q.queueSize {
+		atomic.AddInt32(&q.waiting, -1)
+		return nil, q.unavailable("sign queue is full")
+	}
+	defer atomic.AddInt32(&q.waiting, -1)
+
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+
+	select {
+	case q.workers <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, q.unavailable("timeout waiting in the sign queue")
+	case <-ctx.Done():
+		return nil, contextError(ctx.Err())
+	}
+}
+
+// waitingRequests returns the number of requests waiting for a worker.
+func (q *signQueue) waitingRequests() int32 {
+	return atomic.LoadInt32(&q.waiting)
+}
+
+func (q *signQueue) unavailable(msg string) error {
+	return errs.NewErr(http.StatusServiceUnavailable, errors.New(msg),
+		errs.WithRetryAfter(q.retryAfter))
+}
@@ -0,0 +1,79 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestSignQueue_acquire(t *testing.T) {
+	// A nil queue does not limit the operations.
+	var nilQueue *signQueue
+	release, err := nilQueue.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("signQueue.acquire() error = %v", err)
+	}
+	release()
+
+	q := newSignQueue(&config.SignQueueConfig{
+		Workers:    1,
+		QueueSize:  1,
+		MaxWait:    &provisioner.Duration{Duration: 50 * time.Millisecond},
+		RetryAfter: &provisioner.Duration{Duration: 2 * time.Second},
+	})
+	release, err = q.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("signQueue.acquire() error = %v", err)
+	}
+
+	// The second request waits in the queue, the third one is rejected.
+	done := make(chan error, 1)
+	go func() {
+		r, err := q.acquire(context.Background())
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+	for i := 0; i < 100 && q.waitingRequests() == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	_, err = q.acquire(context.Background())
+	if !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("signQueue.acquire() error = %v, want 503", err)
+	}
+	if e := err.(*errs.Error); e.RetryAfter != 2*time.Second {
+		t.Errorf("signQueue.acquire() RetryAfter = %v, want %v", e.RetryAfter, 2*time.Second)
+	}
+
+	// The waiting request gets the worker once it is released.
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("signQueue.acquire() error = %v", err)
+	}
+
+	// Requests waiting longer than the maximum time are rejected.
+	release, err = q.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("signQueue.acquire() error = %v", err)
+	}
+	defer release()
+	if _, err := q.acquire(context.Background()); !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("signQueue.acquire() error = %v, want 503", err)
+	}
+
+	// And so are the requests with a canceled context.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := q.acquire(ctx); !hasStatus(err, http.StatusGatewayTimeout) {
+		t.Errorf("signQueue.acquire() error = %v, want 504", err)
+	}
+	if n := q.waitingRequests(); n != 0 {
+		t.Errorf("signQueue waiting = %d, want 0", n)
+	}
+}
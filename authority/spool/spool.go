@@ -0,0 +1,180 @@
+// Package spool implements a durable queue of records stored as files in a
+// local directory. Each record is written to a temporary file, synced and
+// renamed, so a record is either fully in the spool or not at all, and the
+// records survive a restart or a crash of the process until they are
+// removed.
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	entryExt = ".json"
+	tmpExt   = ".tmp"
+)
+
+// Entry is a record in the spool.
+type Entry struct {
+	Seq  uint64          `json:"seq"`
+	Kind string          `json:"kind"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Spool is a durable queue of records. The records are kept in the order they
+// are pushed.
+type Spool struct {
+	dir  string
+	mu   sync.Mutex
+	seqs []uint64
+	next uint64
+}
+
+// Open opens the spool in the given directory, creating the directory if
+// necessary. The records left by a previous process are loaded, and the
+// temporary files of interrupted writes are removed.
+func Open(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "error creating spool directory %s", dir)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading spool directory %s", dir)
+	}
+	s := &Spool{dir: dir, next: 1}
+	for _, fi := range files {
+		name := fi.Name()
+		switch {
+		case fi.IsDir():
+			continue
+		case strings.HasSuffix(name, tmpExt):
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, errors.Wrapf(err, "error removing %s", name)
+			}
+		case strings.HasSuffix(name, entryExt):
+			seq, err := strconv.ParseUint(strings.TrimSuffix(name, entryExt), 10, 64)
+			if err != nil {
+				continue
+			}
+			s.seqs = append(s.seqs, seq)
+			if seq >= s.next {
+				s.next = seq + 1
+			}
+		}
+	}
+	sort.Slice(s.seqs, func(i, j int) bool {
+		return s.seqs[i] < s.seqs[j]
+	})
+	return s, nil
+}
+
+func (s *Spool) filename(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, entryExt))
+}
+
+// Push adds a record of the given kind with the JSON encoding of v. The record
+// is synced to disk before Push returns.
+func (s *Spool) Push(kind string, v interface{}) (*Entry, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling spool record")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &Entry{
+		Seq:  s.next,
+		Kind: kind,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling spool record")
+	}
+
+	name := s.filename(e.Seq)
+	f, err := os.OpenFile(name+tmpExt, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating spool record")
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(name + tmpExt)
+		return nil, errors.Wrap(err, "error writing spool record")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(name + tmpExt)
+		return nil, errors.Wrap(err, "error syncing spool record")
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(name + tmpExt)
+		return nil, errors.Wrap(err, "error closing spool record")
+	}
+	if err := os.Rename(name+tmpExt, name); err != nil {
+		os.Remove(name + tmpExt)
+		return nil, errors.Wrap(err, "error renaming spool record")
+	}
+
+	s.next++
+	s.seqs = append(s.seqs, e.Seq)
+	return e, nil
+}
+
+// Seqs returns the sequence numbers of the records in the spool, in order.
+func (s *Spool) Seqs() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seqs := make([]uint64, len(s.seqs))
+	copy(seqs, s.seqs)
+	return seqs
+}
+
+// Get returns the record with the given sequence number.
+func (s *Spool) Get(seq uint64) (*Entry, error) {
+	b, err := ioutil.ReadFile(s.filename(seq))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading spool record %d", seq)
+	}
+	e := new(Entry)
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling spool record %d", seq)
+	}
+	return e, nil
+}
+
+// Remove removes the record with the given sequence number.
+func (s *Spool) Remove(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.filename(seq)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "error removing spool record %d", seq)
+	}
+	for i, v := range s.seqs {
+		if v == seq {
+			s.seqs = append(s.seqs[:i], s.seqs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Len returns the number of records in the spool.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.seqs)
+}
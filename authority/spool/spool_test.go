@@ -0,0 +1,73 @@
+package spool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "spool"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, v := range []string{"one", "two", "three"} {
+		if _, err := s.Push("test", v); err != nil {
+			t.Fatalf("Spool.Push() error = %v", err)
+		}
+	}
+	if got := s.Seqs(); !reflect.DeepEqual(got, []uint64{1, 2, 3}) {
+		t.Errorf("Spool.Seqs() = %v, want [1 2 3]", got)
+	}
+	if err := s.Remove(1); err != nil {
+		t.Fatalf("Spool.Remove() error = %v", err)
+	}
+
+	// Interrupted writes are discarded on open
+	if err := ioutil.WriteFile(filepath.Join(dir, "spool", "00000000000000000004.json.tmp"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(filepath.Join(dir, "spool"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if got := s.Seqs(); !reflect.DeepEqual(got, []uint64{2, 3}) {
+		t.Errorf("Spool.Seqs() = %v, want [2 3]", got)
+	}
+	e, err := s.Get(2)
+	if err != nil {
+		t.Fatalf("Spool.Get() error = %v", err)
+	}
+	var v string
+	if err := json.Unmarshal(e.Data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 2 || e.Kind != "test" || v != "two" {
+		t.Errorf("Spool.Get() = %v, want record 2", e)
+	}
+
+	// Sequence numbers are not reused
+	e, err = s.Push("test", "four")
+	if err != nil {
+		t.Fatalf("Spool.Push() error = %v", err)
+	}
+	if e.Seq != 4 || s.Len() != 3 {
+		t.Errorf("Spool.Push() seq = %d, len = %d, want 4 and 3", e.Seq, s.Len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "spool", "00000000000000000004.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file was not removed: %v", err)
+	}
+	if _, err := s.Get(1); err == nil {
+		t.Error("Spool.Get() error = nil, want an error")
+	}
+}
@@ -10,11 +10,14 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/templates"
+	"github.com/smallstep/nosql"
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/sshutil"
 	"golang.org/x/crypto/ssh"
@@ -135,9 +138,11 @@ func (a *Authority) GetSSHBastion(ctx context.Context, user string, hostname str
 // SignSSH creates a signed SSH certificate with the given public key and options.
 func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	var (
-		certOptions []sshutil.Option
-		mods        []provisioner.SSHCertModifier
-		validators  []provisioner.SSHCertValidator
+		certOptions   []sshutil.Option
+		mods          []provisioner.SSHCertModifier
+		validators    []provisioner.SSHCertValidator
+		policyHookOpt *policyHookOption
+		identity      *provisioner.IdentityDocument
 	)
 
 	// Validate given options.
@@ -168,6 +173,14 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 				return nil, errs.Wrap(http.StatusForbidden, err, "authority.SignSSH")
 			}
 
+		// provisioner and token sent to the policy hooks
+		case *policyHookOption:
+			policyHookOpt = o
+
+		// identity document sent to the policy hooks
+		case *provisioner.IdentityDocument:
+			identity = o
+
 		default:
 			return nil, errs.InternalServer("authority.SignSSH: invalid extra option type %T", o)
 		}
@@ -187,6 +200,7 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		if _, ok := err.(*sshutil.TemplateError); ok {
 			return nil, errs.NewErr(http.StatusBadRequest, err,
 				errs.WithMessage(err.Error()),
+				errs.WithCode(errs.CodeTemplateError),
 				errs.WithKeyVal("signOptions", signOpts),
 			)
 		}
@@ -209,6 +223,11 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		}
 	}
 
+	// Evaluate the policy hooks.
+	if err := a.evaluateSSHPolicyHooks(policyHookOpt.withIdentity(identity), certTpl); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH")
+	}
+
 	// Get signer from authority keys
 	var signer ssh.Signer
 	switch certTpl.CertType {
@@ -235,6 +254,12 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	// User provisioners validators.
 	for _, v := range validators {
 		if err := v.Valid(cert, opts); err != nil {
+			if kpe, ok := err.(*provisioner.KeyPolicyError); ok {
+				return nil, errs.NewErr(http.StatusForbidden, kpe,
+					errs.WithMessage(kpe.Error()),
+					errs.WithCode(errs.CodeKeyPolicyViolation),
+				)
+			}
 			return nil, errs.Wrap(http.StatusForbidden, err, "authority.SignSSH")
 		}
 	}
@@ -243,6 +268,11 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error storing certificate in db")
 	}
 
+	a.events.Publish(&events.SSHCertificateIssued{
+		Time:        a.now(),
+		Certificate: cert,
+	})
+
 	return cert, nil
 }
 
@@ -258,7 +288,7 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 
 	backdate := a.config.AuthorityConfig.Backdate.Duration
 	duration := time.Duration(oldCert.ValidBefore-oldCert.ValidAfter) * time.Second
-	now := time.Now()
+	now := a.now()
 	va := now.Add(-1 * backdate)
 	vb := now.Add(duration - backdate)
 
@@ -302,6 +332,12 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error storing certificate in db")
 	}
 
+	a.events.Publish(&events.SSHCertificateIssued{
+		Time:        a.now(),
+		Certificate: cert,
+		Renewal:     true,
+	})
+
 	return cert, nil
 }
 
@@ -329,7 +365,7 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 
 	backdate := a.config.AuthorityConfig.Backdate.Duration
 	duration := time.Duration(oldCert.ValidBefore-oldCert.ValidAfter) * time.Second
-	now := time.Now()
+	now := a.now()
 	va := now.Add(-1 * backdate)
 	vb := now.Add(duration - backdate)
 
@@ -381,6 +417,12 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "rekeySSH; error storing certificate in db")
 	}
 
+	a.events.Publish(&events.SSHCertificateIssued{
+		Time:        a.now(),
+		Certificate: cert,
+		Renewal:     true,
+	})
+
 	return cert, nil
 }
 
@@ -473,6 +515,11 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error storing certificate in db")
 	}
 
+	a.events.Publish(&events.SSHCertificateIssued{
+		Time:        a.now(),
+		Certificate: cert,
+	})
+
 	return cert, nil
 }
 
@@ -533,3 +580,27 @@ func (a *Authority) getAddUserCommand(principal string) string {
 	}
 	return strings.Replace(cmd, "<principal>", principal, -1)
 }
+
+// sshCertificateInfoGetter is implemented by the databases that index the SSH
+// certificates by fingerprint.
+type sshCertificateInfoGetter interface {
+	GetSSHCertificateInfo(fingerprint string) (*db.SSHCertificateInfo, error)
+}
+
+// GetSSHCertificateInfo returns the record of the SSH certificate with the
+// given certificate fingerprint, or of the last certificate signed for the key
+// with the given fingerprint.
+func (a *Authority) GetSSHCertificateInfo(fingerprint string) (*db.SSHCertificateInfo, error) {
+	g, ok := a.db.(sshCertificateInfoGetter)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "ssh certificate lookup requires a database")
+	}
+	info, err := g.GetSSHCertificateInfo(fingerprint)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ssh certificate with fingerprint %s not found", fingerprint)
+	case err != nil:
+		return nil, admin.WrapErrorISE(err, "error loading ssh certificate")
+	}
+	return info, nil
+}
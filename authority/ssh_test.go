@@ -985,3 +985,38 @@ func TestIsValidForAddUser(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GetSSHCertificateInfo(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.FatalError(t, err)
+	crt := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		Serial:          1234,
+		CertType:        ssh.HostCert,
+		KeyId:           "smallstep.com",
+		ValidPrincipals: []string{"smallstep.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	assert.FatalError(t, crt.SignCert(rand.Reader, signer))
+
+	authDB, err := db.New(&db.Config{Type: db.MemoryType})
+	assert.FatalError(t, err)
+	assert.FatalError(t, authDB.StoreSSHCertificate(crt))
+
+	a := testAuthority(t, WithDatabase(authDB))
+	info, err := a.GetSSHCertificateInfo(ssh.FingerprintSHA256(signer.PublicKey()))
+	assert.FatalError(t, err)
+	assert.Equals(t, "1234", info.Serial)
+	assert.Equals(t, "smallstep.com", info.KeyID)
+	assert.Equals(t, "host", info.Type)
+	assert.Equals(t, ssh.FingerprintSHA256(crt), info.CertificateFingerprint)
+
+	_, err = a.GetSSHCertificateInfo("SHA256:missing")
+	assert.NotNil(t, err)
+
+	a = testAuthority(t, WithDatabase(&db.MockAuthDB{}))
+	_, err = a.GetSSHCertificateInfo(ssh.FingerprintSHA256(crt))
+	assert.NotNil(t, err)
+}
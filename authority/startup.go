@@ -0,0 +1,180 @@
+package authority
+
+import (
+	"crypto"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+	kmsapi "github.com/smallstep/certificates/kms/apiv1"
+)
+
+// startupRetryAfter is the time clients are asked to wait before retrying a
+// request rejected because the authority is still starting.
+const startupRetryAfter = time.Second
+
+// startupTimes keeps the time spent initializing each component of the
+// authority.
+type startupTimes struct {
+	mu    sync.Mutex
+	start time.Time
+	names []string
+	times []time.Duration
+}
+
+func newStartupTimes() *startupTimes {
+	return &startupTimes{start: time.Now()}
+}
+
+// add records the time spent initializing the given component.
+func (t *startupTimes) add(name string, d time.Duration) {
+	t.mu.Lock()
+	t.names = append(t.names, name)
+	t.times = append(t.times, d)
+	t.mu.Unlock()
+}
+
+// run runs fn and records the time spent in it.
+func (t *startupTimes) run(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	t.add(name, time.Since(start))
+	return err
+}
+
+// parallel runs the given functions at the same time, recording the time
+// spent in each of them, and returns the first error.
+func (t *startupTimes) parallel(fns map[string]func() error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for name, fn := range fns {
+		wg.Add(1)
+		go func(name string, fn func() error) {
+			defer wg.Done()
+			if err := t.run(name, fn); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(name, fn)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// String returns the total time and the time of each component.
+func (t *startupTimes) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, len(t.names))
+	for i, name := range t.names {
+		parts[i] = name + ": " + t.times[i].Round(time.Millisecond).String()
+	}
+	total := time.Since(t.start).Round(time.Millisecond)
+	if len(parts) == 0 {
+		return total.String()
+	}
+	return total.String() + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// asyncSigner is a crypto.Signer created by the key manager in the
+// background. The methods of the signer block until it is created, so keys in
+// slow key managers, like cloud KMSs, can be loaded at the same time, or after
+// the authority starts.
+type asyncSigner struct {
+	name    string
+	done    chan struct{}
+	signer  crypto.Signer
+	err     error
+	elapsed time.Duration
+}
+
+// newAsyncSigner starts the creation of the signer with the given request.
+func newAsyncSigner(km kmsapi.KeyManager, name string, req *kmsapi.CreateSignerRequest, times *startupTimes) *asyncSigner {
+	s := &asyncSigner{name: name, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		start := time.Now()
+		s.signer, s.err = km.CreateSigner(req)
+		s.elapsed = time.Since(start)
+		if times != nil {
+			times.add(name, s.elapsed)
+		}
+	}()
+	return s
+}
+
+// get waits for the signer and returns it.
+func (s *asyncSigner) get() (crypto.Signer, error) {
+	<-s.done
+	return s.signer, s.err
+}
+
+// ready returns true if the signer has been created or it has failed.
+func (s *asyncSigner) ready() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// logWhenReady logs the time spent loading the key, or the error, once the
+// signer is created. It is used with the keys loaded after the authority
+// starts.
+func (s *asyncSigner) logWhenReady() {
+	go func() {
+		if _, err := s.get(); err != nil {
+			log.Printf("error loading %s: %v", s.name, err)
+			return
+		}
+		log.Printf("Loaded %s in %s", s.name, s.elapsed.Round(time.Millisecond))
+	}()
+}
+
+// Public implements crypto.Signer. It returns nil if the signer cannot be
+// created.
+func (s *asyncSigner) Public() crypto.PublicKey {
+	signer, err := s.get()
+	if err != nil {
+		return nil
+	}
+	return signer.Public()
+}
+
+// Sign implements crypto.Signer.
+func (s *asyncSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signer, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand, digest, opts)
+}
+
+// Ready returns nil if the authority has finished loading its keys. If a key
+// is loaded lazily and it is not available yet, it returns a 503 Service
+// Unavailable error, and if a key cannot be loaded, it returns the error.
+func (a *Authority) Ready() error {
+	for _, s := range a.lazySigners {
+		if !s.ready() {
+			return errs.NewErr(http.StatusServiceUnavailable, errors.New("authority is starting"),
+				errs.WithMessage("The certificate authority is starting."),
+				errs.WithRetryAfter(startupRetryAfter))
+		}
+		if _, err := s.get(); err != nil {
+			return errs.InternalServerErr(errors.Wrap(err, "error loading the authority keys"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	kmsapi "github.com/smallstep/certificates/kms/apiv1"
+)
+
+type startupKeyManager struct {
+	kmsapi.KeyManager
+	wait   chan struct{}
+	signer crypto.Signer
+	err    error
+}
+
+func (m *startupKeyManager) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	<-m.wait
+	return m.signer, m.err
+}
+
+func TestStartupTimes_parallel(t *testing.T) {
+	errFn := errors.New("an error")
+	times := newStartupTimes()
+	err := times.parallel(map[string]func() error{
+		"db":  func() error { return nil },
+		"kms": func() error { return errFn },
+	})
+	if err != errFn {
+		t.Errorf("startupTimes.parallel() error = %v, want %v", err, errFn)
+	}
+	s := times.String()
+	if !strings.Contains(s, "db: ") || !strings.Contains(s, "kms: ") {
+		t.Errorf("startupTimes.String() = %s, want db and kms times", s)
+	}
+}
+
+func TestAuthority_Ready(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	km := &startupKeyManager{wait: make(chan struct{}), signer: key}
+	signer := newAsyncSigner(km, "x509 intermediate key", &kmsapi.CreateSignerRequest{}, newStartupTimes())
+	a := &Authority{lazySigners: []*asyncSigner{signer}}
+	if err := a.Ready(); !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("Authority.Ready() error = %v, want 503", err)
+	}
+
+	close(km.wait)
+	if pub := signer.Public(); pub != key.Public() {
+		t.Errorf("asyncSigner.Public() = %v, want %v", pub, key.Public())
+	}
+	sum := sha256.Sum256([]byte("data"))
+	if _, err := signer.Sign(rand.Reader, sum[:], crypto.SHA256); err != nil {
+		t.Errorf("asyncSigner.Sign() error = %v", err)
+	}
+	if err := a.Ready(); err != nil {
+		t.Errorf("Authority.Ready() error = %v", err)
+	}
+
+	// The key cannot be loaded.
+	km = &startupKeyManager{wait: make(chan struct{}), err: errors.New("an error")}
+	close(km.wait)
+	signer = newAsyncSigner(km, "x509 intermediate key", &kmsapi.CreateSignerRequest{}, newStartupTimes())
+	a = &Authority{lazySigners: []*asyncSigner{signer}}
+	if _, err := signer.get(); err == nil {
+		t.Fatal("asyncSigner.get() error = nil, want error")
+	}
+	if err := a.Ready(); !hasStatus(err, http.StatusInternalServerError) {
+		t.Errorf("Authority.Ready() error = %v, want 500", err)
+	}
+	if pub := signer.Public(); pub != nil {
+		t.Errorf("asyncSigner.Public() = %v, want nil", pub)
+	}
+	if _, err := signer.Sign(rand.Reader, sum[:], crypto.SHA256); err == nil {
+		t.Error("asyncSigner.Sign() error = nil, want error")
+	}
+}
@@ -0,0 +1,66 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/errs"
+)
+
+// initTimeouts initializes the limit of database and key manager calls running
+// at the same time.
+func (a *Authority) initTimeouts() {
+	a.pendingCalls = make(chan struct{}, a.config.Timeouts.GetMaxPendingCalls())
+}
+
+// withTimeout returns a copy of the context with the given timeout. If the
+// timeout is 0, the context is returned as it is.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// call runs fn, a call to the database or the key manager, until it returns or
+// the context is done. If the context is done first, the call keeps running in
+// the background, but it still counts towards the maximum number of pending
+// calls, so hung calls cannot pile up. Contexts that are never done run fn
+// directly.
+func (a *Authority) call(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil || a.pendingCalls == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+
+	select {
+	case a.pendingCalls <- struct{}{}:
+	default:
+		return errs.NewErr(http.StatusServiceUnavailable, errors.New("too many pending calls"))
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-a.pendingCalls }()
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+// contextError returns the error of a call interrupted by the given context
+// error.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errs.NewErr(http.StatusGatewayTimeout, errors.Wrap(err, "call timed out"))
+	}
+	return errs.NewErr(http.StatusServiceUnavailable, errors.Wrap(err, "call canceled"))
+}
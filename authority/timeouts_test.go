@@ -0,0 +1,60 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_call(t *testing.T) {
+	errFn := errors.New("an error")
+	a := &Authority{pendingCalls: make(chan struct{}, 1)}
+
+	// Contexts that are never done run the call directly.
+	if err := a.call(context.Background(), func() error { return errFn }); err != errFn {
+		t.Errorf("Authority.call() error = %v, want %v", err, errFn)
+	}
+	if err := (&Authority{}).call(context.TODO(), func() error { return nil }); err != nil {
+		t.Errorf("Authority.call() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := a.call(ctx, func() error { return errFn }); err != errFn {
+		t.Errorf("Authority.call() error = %v, want %v", err, errFn)
+	}
+	cancel()
+	if err := a.call(ctx, func() error { return nil }); !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("Authority.call() error = %v, want 503", err)
+	}
+
+	// A hung call times out and keeps its pending slot.
+	hung := make(chan struct{})
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.call(ctx, func() error { <-hung; return nil }); !hasStatus(err, http.StatusGatewayTimeout) {
+		t.Errorf("Authority.call() error = %v, want 504", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := a.call(ctx, func() error { return nil }); !hasStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("Authority.call() error = %v, want 503", err)
+	}
+
+	// The slot is released when the hung call returns.
+	close(hung)
+	for i := 0; i < 100 && len(a.pendingCalls) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if err := a.call(ctx, func() error { return nil }); err != nil {
+		t.Errorf("Authority.call() error = %v", err)
+	}
+}
+
+func hasStatus(err error, status int) bool {
+	e, ok := err.(*errs.Error)
+	return ok && e.StatusCode() == status
+}
@@ -0,0 +1,48 @@
+package authority
+
+import (
+	"github.com/pkg/errors"
+	kmsapi "github.com/smallstep/certificates/kms/apiv1"
+	"github.com/smallstep/certificates/tsa"
+	"go.step.sm/crypto/pemutil"
+)
+
+// initTSA initializes the RFC 3161 time-stamp authority if it is configured.
+// The time-stamping key is loaded using the key manager, so it can be kept in
+// a KMS.
+func (a *Authority) initTSA() error {
+	c := a.config.TSA
+	if c == nil || a.tsaService != nil {
+		return nil
+	}
+
+	chain, err := pemutil.ReadCertificateBundle(c.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading tsa certificate")
+	}
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: c.Key,
+		Password:   []byte(a.config.Password),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating tsa signer")
+	}
+	policy, err := c.GetPolicy()
+	if err != nil {
+		return err
+	}
+
+	a.tsaService, err = tsa.NewService(tsa.Options{
+		CertificateChain: chain,
+		Signer:           signer,
+		Policy:           policy,
+		Accuracy:         c.Accuracy.Value(),
+	})
+	return err
+}
+
+// GetTSAService returns the time-stamp authority service, it returns nil if
+// the time-stamp authority is not configured.
+func (a *Authority) GetTSAService() *tsa.Service {
+	return a.tsaService
+}
@@ -0,0 +1,175 @@
+// Package timing records how long each stage of a sign request takes, so the
+// breakdown can be added to the response logs and the metrics of the request.
+package timing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stage is a stage of a sign request.
+type Stage string
+
+// Sign request stages.
+const (
+	// Authorization is the validation of the token and the provisioner.
+	Authorization Stage = "authorization"
+	// Queue is the time waiting for a free slot in the sign queue.
+	Queue Stage = "queue"
+	// Template is the rendering of the template and the validation of the
+	// certificate by the provisioner.
+	Template Stage = "template"
+	// Policy is the evaluation of the policy hooks, approvals, duplicates
+	// and quotas.
+	Policy Stage = "policy"
+	// KMSSign is the signature of the certificate by the key manager or the
+	// registration authority.
+	KMSSign Stage = "kms-sign"
+	// Persist is the storage of the certificate and its records.
+	Persist Stage = "persist"
+)
+
+type contextKey struct{}
+
+// NewContext returns a new context with a new breakdown.
+func NewContext(ctx context.Context) (context.Context, *Breakdown) {
+	b := New()
+	return context.WithValue(ctx, contextKey{}, b), b
+}
+
+// FromContext returns the breakdown in the context, or nil if there is none.
+// All the methods of a nil breakdown are no-ops.
+func FromContext(ctx context.Context) *Breakdown {
+	b, _ := ctx.Value(contextKey{}).(*Breakdown)
+	return b
+}
+
+type stageTiming struct {
+	stage    Stage
+	duration time.Duration
+}
+
+// Breakdown is a stopwatch with a lap for every stage of a request. Stages
+// are sequential, starting a stage ends the previous one. A stage that is
+// not stopped when the breakdown is reported, because the request failed or
+// timed out on it, is reported as incomplete with the time spent so far.
+type Breakdown struct {
+	mu      sync.Mutex
+	start   time.Time
+	budget  time.Duration
+	stages  []stageTiming
+	current Stage
+	since   time.Time
+}
+
+// New returns a new breakdown that starts now.
+func New() *Breakdown {
+	now := time.Now()
+	return &Breakdown{start: now, since: now}
+}
+
+// Start ends the current stage, if any, and starts the given one. A stage
+// started more than once accumulates its durations.
+func (b *Breakdown) Start(s Stage) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lap(time.Now())
+	b.current = s
+}
+
+// Stop ends the current stage.
+func (b *Breakdown) Stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lap(time.Now())
+}
+
+// SetBudget sets the time the request is allowed to take, e.g. the sign
+// timeout.
+func (b *Breakdown) SetBudget(d time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.budget = d
+	b.mu.Unlock()
+}
+
+// lap adds the time since the last lap to the current stage. It must be
+// called with the lock held.
+func (b *Breakdown) lap(now time.Time) {
+	if b.current != "" {
+		b.add(b.current, now.Sub(b.since))
+		b.current = ""
+	}
+	b.since = now
+}
+
+func (b *Breakdown) add(s Stage, d time.Duration) {
+	for i := range b.stages {
+		if b.stages[i].stage == s {
+			b.stages[i].duration += d
+			return
+		}
+	}
+	b.stages = append(b.stages, stageTiming{stage: s, duration: d})
+}
+
+// Durations returns the duration of the stopped stages.
+func (b *Breakdown) Durations() map[Stage]time.Duration {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := make(map[Stage]time.Duration, len(b.stages))
+	for _, st := range b.stages {
+		m[st.stage] = st.duration
+	}
+	return m
+}
+
+// Fields returns the breakdown as log fields. The duration of each stage is
+// in "timing.<stage>-ns", the time since the breakdown started in
+// "timing.total-ns", the budget, if set, in "timing.budget-ns", and the stage
+// that did not finish, if any, in "timing.incomplete". Requests that took
+// longer than the budget have "timing.over-budget" set.
+func (b *Breakdown) Fields() map[string]interface{} {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	fields := make(map[string]interface{}, len(b.stages)+4)
+	for _, st := range b.stages {
+		fields["timing."+string(st.stage)+"-ns"] = st.duration.Nanoseconds()
+	}
+	if b.current != "" {
+		d := now.Sub(b.since)
+		for _, st := range b.stages {
+			if st.stage == b.current {
+				d += st.duration
+				break
+			}
+		}
+		fields["timing."+string(b.current)+"-ns"] = d.Nanoseconds()
+		fields["timing.incomplete"] = string(b.current)
+	}
+	total := now.Sub(b.start)
+	fields["timing.total-ns"] = total.Nanoseconds()
+	if b.budget > 0 {
+		fields["timing.budget-ns"] = b.budget.Nanoseconds()
+		if total > b.budget {
+			fields["timing.over-budget"] = true
+		}
+	}
+	return fields
+}
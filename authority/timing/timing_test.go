@@ -0,0 +1,76 @@
+package timing
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBreakdown(t *testing.T) {
+	ctx, b := NewContext(context.Background())
+	if got := FromContext(ctx); got != b {
+		t.Fatalf("FromContext() = %p, want %p", got, b)
+	}
+
+	b.SetBudget(time.Hour)
+	b.Start(Template)
+	time.Sleep(time.Millisecond)
+	b.Start(KMSSign)
+	b.Start(Template)
+	b.Stop()
+
+	durations := b.Durations()
+	if len(durations) != 2 {
+		t.Fatalf("Durations() = %v, want 2 stages", durations)
+	}
+	if durations[Template] < time.Millisecond {
+		t.Errorf("Durations()[template] = %s, want at least 1ms", durations[Template])
+	}
+
+	fields := b.Fields()
+	for _, k := range []string{"timing.template-ns", "timing.kms-sign-ns", "timing.total-ns", "timing.budget-ns"} {
+		if _, ok := fields[k].(int64); !ok {
+			t.Errorf("Fields()[%s] = %v, want int64", k, fields[k])
+		}
+	}
+	for _, k := range []string{"timing.incomplete", "timing.over-budget"} {
+		if v, ok := fields[k]; ok {
+			t.Errorf("Fields()[%s] = %v, want none", k, v)
+		}
+	}
+}
+
+func TestBreakdown_incomplete(t *testing.T) {
+	b := New()
+	b.SetBudget(time.Nanosecond)
+	b.Start(Authorization)
+	b.Start(Persist)
+	time.Sleep(time.Millisecond)
+
+	fields := b.Fields()
+	if v := fields["timing.incomplete"]; v != "persist" {
+		t.Errorf("Fields()[timing.incomplete] = %v, want persist", v)
+	}
+	if v, _ := fields["timing.persist-ns"].(int64); v < int64(time.Millisecond) {
+		t.Errorf("Fields()[timing.persist-ns] = %d, want at least 1ms", v)
+	}
+	if v := fields["timing.over-budget"]; v != true {
+		t.Errorf("Fields()[timing.over-budget] = %v, want true", v)
+	}
+	if _, ok := b.Durations()[Persist]; ok {
+		t.Error("Durations() contains the incomplete stage")
+	}
+}
+
+func TestBreakdown_nil(t *testing.T) {
+	b := FromContext(context.Background())
+	if b != nil {
+		t.Fatalf("FromContext() = %v, want nil", b)
+	}
+	b.Start(Template)
+	b.SetBudget(time.Second)
+	b.Stop()
+	if b.Durations() != nil || b.Fields() != nil {
+		t.Error("nil breakdown returned values")
+	}
+}
@@ -9,11 +9,14 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/authority/timing"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
@@ -21,6 +24,7 @@ import (
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ocsp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -31,6 +35,7 @@ func (a *Authority) GetTLSOptions() *config.TLSOptions {
 
 var oidAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
 var oidSubjectKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 14}
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
 
 func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
 	return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
@@ -67,20 +72,72 @@ func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
 
 // Sign creates a signed certificate from a certificate signing request.
 func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return a.SignWithContext(context.Background(), csr, signOpts, extraOpts...)
+}
+
+// SignWithContext creates a signed certificate from a certificate signing
+// request. The calls to the key manager and the database are interrupted when
+// the context is done or the configured sign timeout expires.
+func (a *Authority) SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if err := a.Ready(); err != nil {
+		return nil, err
+	}
+
+	// New certificates are not issued while the database is unavailable
+	if err := a.checkDegradedMode(); err != nil {
+		return nil, err
+	}
+	if err := a.checkWriteBehind(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, a.config.Timeouts.GetSign())
+	defer cancel()
+
+	// Timing breakdown of the request, the sign timeout is its budget
+	tb := timing.FromContext(ctx)
+	tb.SetBudget(a.config.Timeouts.GetSign())
+	tb.Start(timing.Queue)
+
+	release, err := a.signQueue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	tb.Start(timing.Template)
+
 	var (
 		certOptions    []x509util.Option
 		certValidators []provisioner.CertificateValidator
 		certModifiers  []provisioner.CertificateModifier
 		certEnforcers  []provisioner.CertificateEnforcer
+		accountID      string
+		replaces       string
+		policyHookOpt  *policyHookOption
+		identity       *provisioner.IdentityDocument
+		codeSigningOpt *codeSigningOption
+		matterOpt      *matterOption
 	)
 
 	opts := []interface{}{errs.WithKeyVal("csr", csr), errs.WithKeyVal("signOptions", signOpts)}
 	if err := csr.CheckSignature(); err != nil {
-		return nil, errs.Wrap(http.StatusBadRequest, err, "authority.Sign; invalid certificate request", opts...)
+		return nil, errs.Wrap(http.StatusBadRequest, err, "authority.Sign; invalid certificate request",
+			append(opts, errs.WithCode(errs.CodeBadCertificateRequest))...)
+	}
+
+	// Reject known compromised keys
+	if err := a.checkBlockedKey(csr.PublicKey); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
 	}
 
-	// Set backdate with the configured value
+	// Set backdate with the configured value, and the clock of the authority
 	signOpts.Backdate = a.config.AuthorityConfig.Backdate.Duration
+	signOpts.Clock = a.clock
+
+	// Validate the certificate labels
+	if err := a.checkLabels(signOpts.Labels); err != nil {
+		return nil, err
+	}
 
 	for _, op := range extraOpts {
 		switch k := op.(type) {
@@ -91,6 +148,14 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		// Validate the given certificate request.
 		case provisioner.CertificateRequestValidator:
 			if err := k.Valid(csr); err != nil {
+				if kpe, ok := err.(*provisioner.KeyPolicyError); ok {
+					return nil, errs.NewErr(http.StatusForbidden, kpe,
+						errs.WithMessage(kpe.Error()),
+						errs.WithCode(errs.CodeKeyPolicyViolation),
+						errs.WithKeyVal("csr", csr),
+						errs.WithKeyVal("signOptions", signOpts),
+					)
+				}
 				return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.Sign", opts...)
 			}
 
@@ -106,6 +171,30 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		case provisioner.CertificateEnforcer:
 			certEnforcers = append(certEnforcers, k)
 
+		// Identifies the account used in the issuance quotas.
+		case provisioner.AccountOption:
+			accountID = string(k)
+
+		// Serial number of the certificate replaced, exempt from quotas.
+		case provisioner.ReplacesOption:
+			replaces = string(k)
+
+		// Provisioner and token sent to the policy hooks.
+		case *policyHookOption:
+			policyHookOpt = k
+
+		// Identity document sent to the policy hooks.
+		case *provisioner.IdentityDocument:
+			identity = k
+
+		// Code signing profile of the provisioner.
+		case *codeSigningOption:
+			codeSigningOpt = k
+
+		// Matter profile of the provisioner.
+		case *matterOption:
+			matterOpt = k
+
 		default:
 			return nil, errs.InternalServer("authority.Sign; invalid extra option type %T", append([]interface{}{k}, opts...)...)
 		}
@@ -116,6 +205,7 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		if _, ok := err.(*x509util.TemplateError); ok {
 			return nil, errs.NewErr(http.StatusBadRequest, err,
 				errs.WithMessage(err.Error()),
+				errs.WithCode(errs.CodeTemplateError),
 				errs.WithKeyVal("csr", csr),
 				errs.WithKeyVal("signOptions", signOpts),
 			)
@@ -137,6 +227,24 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		}
 	}
 
+	// Reject the certificates of provisioners out of their validity period,
+	// this covers the ACME and SCEP flows that do not use tokens.
+	var prov provisioner.Interface
+	if name, ok := provisioner.GetProvisionerName(leaf.ExtraExtensions); ok {
+		if p, err := a.LoadProvisionerByName(name); err == nil {
+			if err := checkProvisionerActive(p, a.now()); err != nil {
+				return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.Sign", opts...)
+			}
+			// Replacements of existing certificates are renewals.
+			if replaces == "" {
+				if err := checkProvisionerSchedule(p, a.now()); err != nil {
+					return nil, errs.Wrap(http.StatusForbidden, err, "authority.Sign", opts...)
+				}
+			}
+			prov = p
+		}
+	}
+
 	// Certificate validation.
 	for _, v := range certValidators {
 		if err := v.Valid(leaf, signOpts); err != nil {
@@ -151,24 +259,118 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		}
 	}
 
+	// Add the certificate labels extension if enabled
+	if err := a.addLabelsExtension(leaf, signOpts.Labels); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+
+	// Add the CRL distribution point if configured, the Matter device
+	// attestation certificate profile does not allow it
+	if matterOpt == nil {
+		a.addCRLDistributionPoint(leaf)
+	}
+
+	// Enforce the Matter device attestation certificate profile
+	if err := a.enforceMatterDAC(matterOpt, leaf, signOpts); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+
+	// Enforce the code signing profile
+	if err := a.checkCodeSigning(codeSigningOpt, csr, leaf, signOpts.Attestation); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+
+	// Validate the signature algorithm selected by the template or provisioner
+	if err := a.checkSignatureAlgorithm(leaf); err != nil {
+		return nil, errs.Wrap(http.StatusBadRequest, err, "authority.Sign", opts...)
+	}
+
+	// Evaluate the policy hooks with the final template
+	tb.Start(timing.Policy)
+	if err := a.evaluateX509PolicyHooks(policyHookOpt.withIdentity(identity), leaf); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+
+	// Hold the request if the provisioner requires an approval
+	approvalID, err := a.checkSignApproval(prov, csr, leaf)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+
+	// Detect duplicate certificates, in block mode the previous certificate
+	// is returned instead of issuing a new one
+	dupKey, dupChain, err := a.checkDuplicates(leaf, csr)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+	if dupChain != nil {
+		tb.Stop()
+		return dupChain, nil
+	}
+
+	// Check issuance quotas and reserve a slot in them, the reservation must
+	// be released if the certificate is not issued
+	quotas, err := a.checkQuotas(leaf, accountID, replaces != "")
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+	}
+
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
-		Template: leaf,
-		CSR:      csr,
-		Lifetime: lifetime,
-		Backdate: signOpts.Backdate,
+	var resp *casapi.CreateCertificateResponse
+	tb.Start(timing.KMSSign)
+	err = a.call(ctx, func() (err error) {
+		resp, err = a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+			Template: leaf,
+			CSR:      csr,
+			Lifetime: lifetime,
+			Backdate: signOpts.Backdate,
+		})
+		return
 	})
 	if err != nil {
+		a.releaseQuotas(quotas)
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error creating certificate", opts...)
 	}
+	tb.Start(timing.Persist)
 
 	fullchain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
-	if err = a.storeCertificate(fullchain); err != nil {
+	if err = a.call(ctx, func() error { return a.storeIssuedCertificate(fullchain) }); err != nil {
 		if err != db.ErrNotImplemented {
+			a.releaseQuotas(quotas)
 			return nil, errs.Wrap(http.StatusInternalServerError, err,
 				"authority.Sign; error storing certificate in db", opts...)
 		}
 	}
+	if err = a.recordQuotas(quotas, resp.Certificate); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error storing quota usage", opts...)
+	}
+	if err = a.recordDuplicates(dupKey, fullchain); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error storing issued certificate", opts...)
+	}
+	if err = a.recordLabels(resp.Certificate, signOpts.Labels); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error storing certificate labels", opts...)
+	}
+	if err = a.consumeCodeSigningApproval(codeSigningOpt, csr); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error updating code signing request", opts...)
+	}
+	if err = a.consumeSignApproval(approvalID); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error updating sign request", opts...)
+	}
+	tb.Stop()
+
+	provName, _ := provisioner.GetProvisionerName(resp.Certificate.Extensions)
+	a.events.Publish(&events.CertificateIssued{
+		Time:        a.now(),
+		Certificate: resp.Certificate,
+		Chain:       resp.CertificateChain,
+		Provisioner: provName,
+		AccountID:   accountID,
+	})
 
 	return fullchain, nil
 }
@@ -176,7 +378,14 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 // Renew creates a new Certificate identical to the old certificate, except
 // with a validity window that begins 'now'.
 func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error) {
-	return a.Rekey(oldCert, nil)
+	return a.RekeyWithContext(context.Background(), oldCert, nil)
+}
+
+// RenewWithContext is the version of Renew that interrupts the calls to the
+// key manager and the database when the context is done or the configured
+// renew timeout expires.
+func (a *Authority) RenewWithContext(ctx context.Context, oldCert *x509.Certificate) ([]*x509.Certificate, error) {
+	return a.RekeyWithContext(ctx, oldCert, nil)
 }
 
 // Rekey is used for rekeying and renewing based on the public key.
@@ -189,6 +398,38 @@ func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error
 // 'NotBefore/NotAfter' (the validity duration of the new certificate should be
 // equal to the old one, but starting 'now').
 func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	return a.RekeyWithContext(context.Background(), oldCert, pk)
+}
+
+// RekeyWithContext is the version of Rekey that interrupts the calls to the
+// key manager and the database when the context is done or the configured
+// renew timeout expires.
+func (a *Authority) RekeyWithContext(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	return a.rekey(ctx, oldCert, pk, nil)
+}
+
+// rekey renews or rekeys the given certificate. If the CSR is not nil, the
+// new certificate has the subject alternative names of the CSR instead of the
+// ones of the old certificate.
+func (a *Authority) rekey(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	if err := a.Ready(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, a.config.Timeouts.GetRenew())
+	defer cancel()
+
+	release, err := a.signQueue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Renewed certificates are not signed if they cannot be recorded
+	if err := a.checkWriteBehind(); err != nil {
+		return nil, err
+	}
+
 	isRekey := (pk != nil)
 	opts := []interface{}{errs.WithKeyVal("serialNumber", oldCert.SerialNumber.String())}
 
@@ -197,6 +438,13 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
 	}
 
+	// Check the subject alternative names requested in the CSR
+	if csr != nil {
+		if err := a.checkRenewalSANs(oldCert, csr); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
+		}
+	}
+
 	// Durations
 	backdate := a.config.AuthorityConfig.Backdate.Duration
 	duration := oldCert.NotAfter.Sub(oldCert.NotBefore)
@@ -233,12 +481,29 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 		PolicyIdentifiers:           oldCert.PolicyIdentifiers,
 	}
 
+	// Keep the signature algorithm if the current intermediate supports it.
+	if a.checkSignatureAlgorithm(oldCert) == nil {
+		newCert.SignatureAlgorithm = oldCert.SignatureAlgorithm
+	}
+
 	if isRekey {
 		newCert.PublicKey = pk
 	} else {
 		newCert.PublicKey = oldCert.PublicKey
 	}
 
+	if csr != nil {
+		newCert.DNSNames = csr.DNSNames
+		newCert.EmailAddresses = csr.EmailAddresses
+		newCert.IPAddresses = csr.IPAddresses
+		newCert.URIs = csr.URIs
+	}
+
+	// Reject known compromised keys
+	if err := a.checkBlockedKey(newCert.PublicKey); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
+	}
+
 	// Copy all extensions except:
 	//
 	//  1. Authority Key Identifier - This one might be different if we rotate
@@ -248,10 +513,16 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 	//  2. Subject Key Identifier, if rekey - For rekey, SubjectKeyIdentifier
 	//  extension will be calculated for the new public key by
 	//  x509util.CreateCertificate()
+	//
+	//  3. Subject Alternative Name, if the CSR requests other names - The
+	//  extension will be created from the new names.
 	for _, ext := range oldCert.Extensions {
 		if ext.Id.Equal(oidAuthorityKeyIdentifier) {
 			continue
 		}
+		if ext.Id.Equal(oidSubjectAltName) && csr != nil {
+			continue
+		}
 		if ext.Id.Equal(oidSubjectKeyIdentifier) && isRekey {
 			newCert.SubjectKeyId = nil
 			continue
@@ -259,25 +530,110 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
 	}
 
-	resp, err := a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
-		Template: newCert,
-		Lifetime: lifetime,
-		Backdate: backdate,
+	// Apply the issuance policies to the names added by the CSR, the quota
+	// reservation must be released if the certificate is not issued
+	var (
+		approvalID string
+		quotas     *quotaReservation
+	)
+	if csr != nil {
+		if approvalID, quotas, err = a.checkRenewalAddedSANs(ctx, oldCert, newCert, csr); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
+		}
+	}
+
+	var resp *casapi.RenewCertificateResponse
+	err = a.call(ctx, func() (err error) {
+		resp, err = a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
+			Template: newCert,
+			Lifetime: lifetime,
+			Backdate: backdate,
+		})
+		return
 	})
 	if err != nil {
+		a.releaseQuotas(quotas)
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey", opts...)
 	}
 
+	// Reject the certificate if the CAS has modified the SANs
+	if c := a.config.AuthorityConfig.Renewal; c != nil && c.RequireSANMatch && !equalSANs(newCert, resp.Certificate) {
+		a.releaseQuotas(quotas)
+		return nil, errs.InternalServer("authority.Rekey: renewed certificate SANs do not match the requested ones", opts...)
+	}
+
 	fullchain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
-	if err = a.storeRenewedCertificate(oldCert, fullchain); err != nil {
+	if err = a.call(ctx, func() error { return a.storeRenewedCertificateOrQueue(oldCert, fullchain) }); err != nil {
 		if err != db.ErrNotImplemented {
+			a.releaseQuotas(quotas)
 			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey; error storing certificate in db", opts...)
 		}
 	}
+	if err = a.recordQuotas(quotas, resp.Certificate); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey; error storing quota usage", opts...)
+	}
+	if err = a.consumeSignApproval(approvalID); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey; error updating sign request", opts...)
+	}
+	if err = a.recordRenewedLabels(oldCert, resp.Certificate); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.Rekey; error storing certificate labels", opts...)
+	}
+
+	a.events.Publish(&events.CertificateRenewed{
+		Time:        a.now(),
+		Certificate: resp.Certificate,
+		Chain:       resp.CertificateChain,
+		Previous:    oldCert,
+		Rekey:       isRekey,
+	})
 
 	return fullchain, nil
 }
 
+// equalSANs returns true if both certificates have the same subject
+// alternative names in the same order.
+func equalSANs(a, b *x509.Certificate) bool {
+	if len(a.DNSNames) != len(b.DNSNames) || len(a.EmailAddresses) != len(b.EmailAddresses) ||
+		len(a.IPAddresses) != len(b.IPAddresses) || len(a.URIs) != len(b.URIs) {
+		return false
+	}
+	for i := range a.DNSNames {
+		if a.DNSNames[i] != b.DNSNames[i] {
+			return false
+		}
+	}
+	for i := range a.EmailAddresses {
+		if a.EmailAddresses[i] != b.EmailAddresses[i] {
+			return false
+		}
+	}
+	for i := range a.IPAddresses {
+		if !a.IPAddresses[i].Equal(b.IPAddresses[i]) {
+			return false
+		}
+	}
+	for i := range a.URIs {
+		if a.URIs[i].String() != b.URIs[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSignatureAlgorithm validates the signature algorithm of the given
+// template against the key of the intermediate certificate. If the
+// intermediate is managed by an external CAS, only the algorithm is checked.
+func (a *Authority) checkSignatureAlgorithm(leaf *x509.Certificate) error {
+	if leaf.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		return nil
+	}
+	var issuerKey crypto.PublicKey
+	if len(a.intermediateX509Certs) > 0 {
+		issuerKey = a.intermediateX509Certs[0].PublicKey
+	}
+	return provisioner.ValidateSignatureAlgorithm(leaf.SignatureAlgorithm, issuerKey)
+}
+
 // storeCertificate allows to use an extension of the db.AuthDB interface that
 // can log the full chain of certificates.
 //
@@ -294,9 +650,15 @@ func (a *Authority) storeCertificate(fullchain []*x509.Certificate) error {
 	}
 	// Store certificate in local db
 	if s, ok := a.db.(certificateChainStorer); ok {
-		return s.StoreCertificateChain(fullchain...)
+		if err := s.StoreCertificateChain(fullchain...); err != nil {
+			return err
+		}
+		return a.indexCertificate(fullchain[0])
 	}
-	return a.db.StoreCertificate(fullchain[0])
+	if err := a.db.StoreCertificate(fullchain[0]); err != nil {
+		return err
+	}
+	return a.indexCertificate(fullchain[0])
 }
 
 // storeRenewedCertificate allows to use an extension of the db.AuthDB interface
@@ -313,9 +675,15 @@ func (a *Authority) storeRenewedCertificate(oldCert *x509.Certificate, fullchain
 	}
 	// Store certificate in local db
 	if s, ok := a.db.(renewedCertificateChainStorer); ok {
-		return s.StoreRenewedCertificate(oldCert, fullchain...)
+		if err := s.StoreRenewedCertificate(oldCert, fullchain...); err != nil {
+			return err
+		}
+		return a.indexCertificate(fullchain[0])
+	}
+	if err := a.db.StoreCertificate(fullchain[0]); err != nil {
+		return err
 	}
-	return a.db.StoreCertificate(fullchain[0])
+	return a.indexCertificate(fullchain[0])
 }
 
 // RevokeOptions are the options for the Revoke API.
@@ -336,6 +704,9 @@ type RevokeOptions struct {
 //
 // TODO: Add OCSP and CRL support.
 func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error {
+	ctx, cancel := withTimeout(ctx, a.config.Timeouts.GetRevoke())
+	defer cancel()
+
 	opts := []interface{}{
 		errs.WithKeyVal("serialNumber", revokeOpts.Serial),
 		errs.WithKeyVal("reasonCode", revokeOpts.ReasonCode),
@@ -355,12 +726,13 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		ReasonCode: revokeOpts.ReasonCode,
 		Reason:     revokeOpts.Reason,
 		MTLS:       revokeOpts.MTLS,
-		RevokedAt:  time.Now().UTC(),
+		RevokedAt:  a.now().UTC(),
 	}
 
 	var (
-		p   provisioner.Interface
-		err error
+		p           provisioner.Interface
+		revokedCert *x509.Certificate
+		err         error
 	)
 	// If not mTLS then get the TokenID of the token.
 	if !revokeOpts.MTLS {
@@ -398,37 +770,55 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 	}
 
 	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
-		err = a.revokeSSH(nil, rci)
+		err = a.call(ctx, func() error { return a.revokeSSH(nil, rci) })
 	} else {
 		// Revoke an X.509 certificate using CAS. If the certificate is not
 		// provided we will try to read it from the db. If the read fails we
 		// won't throw an error as it will be responsibility of the CAS
 		// implementation to require a certificate.
-		var revokedCert *x509.Certificate
 		if revokeOpts.Crt != nil {
 			revokedCert = revokeOpts.Crt
 		} else if rci.Serial != "" {
-			revokedCert, _ = a.db.GetCertificate(rci.Serial)
+			var crt *x509.Certificate
+			if err := a.call(ctx, func() (err error) {
+				crt, err = a.db.GetCertificate(rci.Serial)
+				return
+			}); err == nil {
+				revokedCert = crt
+			}
 		}
 
 		// CAS operation, note that SoftCAS (default) is a noop.
 		// The revoke happens when this is stored in the db.
-		_, err = a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
-			Certificate:  revokedCert,
-			SerialNumber: rci.Serial,
-			Reason:       rci.Reason,
-			ReasonCode:   rci.ReasonCode,
-			PassiveOnly:  revokeOpts.PassiveOnly,
+		err = a.call(ctx, func() error {
+			_, err := a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+				Certificate:  revokedCert,
+				SerialNumber: rci.Serial,
+				Reason:       rci.Reason,
+				ReasonCode:   rci.ReasonCode,
+				PassiveOnly:  revokeOpts.PassiveOnly,
+			})
+			return err
 		})
 		if err != nil {
 			return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
 		}
 
 		// Save as revoked in the Db.
-		err = a.revoke(revokedCert, rci)
+		err = a.call(ctx, func() error { return a.revoke(revokedCert, rci) })
 	}
 	switch err {
 	case nil:
+		a.events.Publish(&events.CertificateRevoked{
+			Time:          rci.RevokedAt,
+			SerialNumber:  rci.Serial,
+			ReasonCode:    rci.ReasonCode,
+			Reason:        rci.Reason,
+			ProvisionerID: rci.ProvisionerID,
+			MTLS:          rci.MTLS,
+			SSH:           provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod,
+			Certificate:   revokedCert,
+		})
 		return nil
 	case db.ErrNotImplemented:
 		return errs.NotImplemented("authority.Revoke; no persistence layer configured", opts...)
@@ -440,6 +830,49 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 	}
 }
 
+// RevokeSuperseded revokes a certificate replaced by a new one, e.g. the
+// certificate in the replaces field of an ACME order. It returns an error if
+// the certificate was already revoked.
+func (a *Authority) RevokeSuperseded(ctx context.Context, crt *x509.Certificate) error {
+	ctx, cancel := withTimeout(ctx, a.config.Timeouts.GetRevoke())
+	defer cancel()
+
+	rci := &db.RevokedCertificateInfo{
+		Serial:     crt.SerialNumber.String(),
+		ReasonCode: ocsp.Superseded,
+		Reason:     "superseded",
+		RevokedAt:  a.now().UTC(),
+	}
+	if p, err := a.LoadProvisionerByCertificate(crt); err == nil {
+		rci.ProvisionerID = p.GetID()
+	}
+
+	err := a.call(ctx, func() error {
+		_, err := a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+			Certificate:  crt,
+			SerialNumber: rci.Serial,
+			Reason:       rci.Reason,
+			ReasonCode:   rci.ReasonCode,
+		})
+		return err
+	})
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.RevokeSuperseded")
+	}
+	if err := a.call(ctx, func() error { return a.revoke(crt, rci) }); err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.RevokeSuperseded")
+	}
+	a.events.Publish(&events.CertificateRevoked{
+		Time:          rci.RevokedAt,
+		SerialNumber:  rci.Serial,
+		ReasonCode:    rci.ReasonCode,
+		Reason:        rci.Reason,
+		ProvisionerID: rci.ProvisionerID,
+		Certificate:   crt,
+	})
+	return nil
+}
+
 func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
 	if lca, ok := a.adminDB.(interface {
 		Revoke(*x509.Certificate, *db.RevokedCertificateInfo) error
@@ -460,12 +893,28 @@ func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateIn
 
 // GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS server.
 func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
+	return a.GetServerCertificate(a.config.DNSNames, "")
+}
+
+// GetServerCertificate creates a new leaf certificate with the given SANs to
+// be used by the CA HTTPS server. The key type can be "EC", the default, or
+// "RSA".
+func (a *Authority) GetServerCertificate(sans []string, keyType string) (*tls.Certificate, error) {
 	fatal := func(err error) (*tls.Certificate, error) {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetTLSCertificate")
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetServerCertificate")
 	}
 
-	// Generate default key.
-	priv, err := keyutil.GenerateDefaultKey()
+	// Generate the key.
+	var priv interface{}
+	var err error
+	switch strings.ToUpper(keyType) {
+	case "", "EC":
+		priv, err = keyutil.GenerateDefaultKey()
+	case "RSA":
+		priv, err = keyutil.GenerateKey("RSA", "", 2048)
+	default:
+		err = errors.Errorf("key type %s is not supported", keyType)
+	}
 	if err != nil {
 		return fatal(err)
 	}
@@ -475,7 +924,7 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 	}
 
 	// Create initial certificate request.
-	cr, err := x509util.CreateCertificateRequest("Step Online CA", a.config.DNSNames, signer)
+	cr, err := x509util.CreateCertificateRequest("Step Online CA", sans, signer)
 	if err != nil {
 		return fatal(err)
 	}
@@ -487,7 +936,7 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 	}
 
 	// Get x509 certificate template, set validity and sign it.
-	now := time.Now()
+	now := a.now()
 	certTpl := template.GetCertificate()
 	certTpl.NotBefore = now.Add(-1 * time.Minute)
 	certTpl.NotAfter = now.Add(24 * time.Hour)
@@ -12,7 +12,9 @@ import (
 	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"reflect"
 	"testing"
 	"time"
@@ -105,6 +107,8 @@ func generateRootCertificate(t *testing.T) (*x509.Certificate, crypto.Signer) {
 	assert.FatalError(t, err)
 
 	cert := template.GetCertificate()
+	cert.NotBefore = time.Now().Add(-time.Hour)
+	cert.NotAfter = time.Now().Add(24 * time.Hour)
 	cert, err = x509util.CreateCertificate(cert, cert, priv.Public(), priv)
 	assert.FatalError(t, err)
 	return cert, priv
@@ -1296,3 +1300,54 @@ func TestAuthority_Revoke(t *testing.T) {
 		})
 	}
 }
+
+func Test_equalSANs(t *testing.T) {
+	crt := &x509.Certificate{
+		DNSNames:       []string{"foo.example.com", "bar.example.com"},
+		EmailAddresses: []string{"jane@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}},
+	}
+	tests := []struct {
+		name string
+		crt  *x509.Certificate
+		want bool
+	}{
+		{"ok", &x509.Certificate{
+			DNSNames:       []string{"foo.example.com", "bar.example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.IPv4(10, 0, 0, 1)},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}},
+		}, true},
+		{"fail dns", &x509.Certificate{
+			DNSNames:       []string{"bar.example.com", "foo.example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}},
+		}, false},
+		{"fail email", &x509.Certificate{
+			DNSNames:    []string{"foo.example.com", "bar.example.com"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:        []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}},
+		}, false},
+		{"fail ip", &x509.Certificate{
+			DNSNames:       []string{"foo.example.com", "bar.example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.2")},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}},
+		}, false},
+		{"fail uri", &x509.Certificate{
+			DNSNames:       []string{"foo.example.com", "bar.example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/bar"}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := equalSANs(crt, tt.crt); got != tt.want {
+				t.Errorf("equalSANs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package authority
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/randutil"
+	"go.step.sm/crypto/x509util"
+)
+
+var tofuIdentitiesTable = []byte("tofu_identities")
+
+// tofuClaimTimeout is the time after which an identifier claimed by a request
+// that never stored its certificate, because the CA failed while signing it,
+// can be claimed again.
+const tofuClaimTimeout = 5 * time.Minute
+
+// TOFUIdentity is the record of an identifier enrolled using trust on first
+// use. It contains the serial number of the last certificate issued, that
+// must be used to authenticate the next request. Claim is set while a request
+// signs a new certificate for the identifier.
+type TOFUIdentity struct {
+	Identifier   string    `json:"identifier"`
+	SerialNumber string    `json:"serialNumber"`
+	Claim        string    `json:"claim,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// SignTOFU signs a certificate for the common name in the given CSR using
+// trust on first use. If the identifier has not been seen before, the
+// certificate is issued without any other authentication and the identifier is
+// recorded. Otherwise, the request must be authenticated by the client
+// certificate, already verified by the TLS handshake, and it must be the last
+// certificate issued for the identifier.
+//
+// Like on-demand certificates, these certificates do not contain a provisioner
+// extension, clients are expected to request a new one before the expiration.
+func (a *Authority) SignTOFU(client *x509.Certificate, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	id := strings.ToLower(csr.Subject.CommonName)
+	opts := []interface{}{errs.WithKeyVal("identifier", id)}
+
+	c := a.config.AuthorityConfig.TOFU
+	if c == nil {
+		return nil, errs.NotImplemented("authority.SignTOFU; trust on first use is not enabled", opts...)
+	}
+	db, ok := a.getNoSQLDB()
+	if !ok {
+		return nil, errs.NotImplemented("authority.SignTOFU; trust on first use requires a database", opts...)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errs.Wrap(http.StatusBadRequest, err, "authority.SignTOFU; invalid certificate request",
+			append(opts, errs.WithCode(errs.CodeBadCertificateRequest))...)
+	}
+	if !c.IsAllowedIdentifier(id) {
+		return nil, errs.Forbidden("authority.SignTOFU; identifier %s is not allowed", append([]interface{}{id}, opts...)...)
+	}
+
+	identity, old, err := getTOFUIdentity(db, id)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+	}
+
+	now := a.now().UTC().Truncate(time.Second)
+	if identity != nil && identity.Claim != "" && now.Before(identity.UpdatedAt.Add(tofuClaimTimeout)) {
+		return nil, errs.Unauthorized("authority.SignTOFU; identifier %s is being enrolled by another request", append([]interface{}{id}, opts...)...)
+	}
+
+	// Subsequent requests must be authenticated by the last certificate.
+	if identity != nil && identity.SerialNumber != "" {
+		if client == nil {
+			return nil, errs.Unauthorized("authority.SignTOFU; identifier %s is already enrolled, missing client certificate", append([]interface{}{id}, opts...)...)
+		}
+		if !strings.EqualFold(client.Subject.CommonName, id) || client.SerialNumber.String() != identity.SerialNumber {
+			return nil, errs.Unauthorized("authority.SignTOFU; client certificate is not the last certificate issued for %s", append([]interface{}{id}, opts...)...)
+		}
+		if isRevoked, err := a.IsRevoked(identity.SerialNumber); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+		} else if isRevoked {
+			return nil, errs.Unauthorized("authority.SignTOFU; client certificate has been revoked", opts...)
+		}
+	}
+
+	// Claim the identifier before signing, so only one of the concurrent
+	// requests, on any replica, gets a certificate for it.
+	claim := &TOFUIdentity{
+		Identifier: id,
+		CreatedAt:  now,
+	}
+	if identity != nil {
+		claim.SerialNumber = identity.SerialNumber
+		claim.CreatedAt = identity.CreatedAt
+	}
+	if claim.Claim, err = randutil.Hex(16); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+	}
+	claim.UpdatedAt = now
+	claimed, swapped, err := swapTOFUIdentity(db, old, claim)
+	switch {
+	case err != nil:
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+	case !swapped:
+		return nil, errs.Unauthorized("authority.SignTOFU; identifier %s has been enrolled by another request", append([]interface{}{id}, opts...)...)
+	}
+
+	certChain, err := a.signTOFU(c, id, csr)
+	if err != nil {
+		// Release the claim, the client can try again.
+		releaseTOFUIdentity(db, id, claimed, old)
+		return nil, err
+	}
+
+	// Record the certificate that will authenticate the next request.
+	claim.SerialNumber = certChain[0].SerialNumber.String()
+	claim.Claim = ""
+	if _, swapped, err := swapTOFUIdentity(db, claimed, claim); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+	} else if !swapped {
+		return nil, errs.InternalServer("authority.SignTOFU; identity %s changed while it was being enrolled", append([]interface{}{id}, opts...)...)
+	}
+
+	return certChain, nil
+}
+
+// signTOFU signs the certificate of a trust on first use request.
+func (a *Authority) signTOFU(c *config.TOFUConfig, id string, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	opts := []interface{}{errs.WithKeyVal("identifier", id)}
+	duration, err := a.tofuDuration(c)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+	}
+	templateOptions, err := provisioner.TemplateOptions(nil, x509util.CreateTemplateData(id, []string{id}))
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignTOFU", opts...)
+	}
+
+	return a.Sign(csr, provisioner.SignOptions{}, templateOptions,
+		provisioner.CertificateModifierFunc(func(crt *x509.Certificate, so provisioner.SignOptions) error {
+			now := a.now()
+			crt.NotBefore = now.Add(-1 * so.Backdate)
+			crt.NotAfter = now.Add(duration)
+			return nil
+		}),
+	)
+}
+
+// DeleteTOFUIdentity removes the record of an identifier enrolled using trust
+// on first use, the next request for it will be treated as the first one.
+func (a *Authority) DeleteTOFUIdentity(id string) error {
+	db, ok := a.getNoSQLDB()
+	if a.config.AuthorityConfig.TOFU == nil || !ok {
+		return admin.NewError(admin.ErrorNotImplementedType, "trust on first use is not enabled")
+	}
+
+	id = strings.ToLower(id)
+	identity, _, err := getTOFUIdentity(db, id)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading identity %s", id)
+	}
+	if identity == nil {
+		return admin.NewError(admin.ErrorNotFoundType, "identity %s not found", id)
+	}
+	if err := db.Del(tofuIdentitiesTable, []byte(id)); err != nil {
+		return admin.WrapErrorISE(err, "error deleting identity %s", id)
+	}
+	return nil
+}
+
+// tofuDuration returns the validity of the trust on first use certificates.
+func (a *Authority) tofuDuration(c *config.TOFUConfig) (time.Duration, error) {
+	if c.Duration != nil {
+		return c.Duration.Duration, nil
+	}
+	claimer, err := provisioner.NewClaimer(a.config.AuthorityConfig.Claims, config.GlobalProvisionerClaims)
+	if err != nil {
+		return 0, err
+	}
+	return claimer.DefaultTLSCertDuration(), nil
+}
+
+// getTOFUIdentity returns the record of the given identifier and its stored
+// value, or nil if it has not been enrolled.
+func getTOFUIdentity(db nosql.DB, id string) (*TOFUIdentity, []byte, error) {
+	if err := db.CreateTable(tofuIdentitiesTable); err != nil {
+		return nil, nil, err
+	}
+	b, err := db.Get(tofuIdentitiesTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	identity := new(TOFUIdentity)
+	if err := json.Unmarshal(b, identity); err != nil {
+		return nil, nil, err
+	}
+	return identity, b, nil
+}
+
+// swapTOFUIdentity stores the given identity if the stored value is still
+// old, nil if the identifier has not been enrolled. It returns the new stored
+// value and false if the value has changed.
+func swapTOFUIdentity(db nosql.DB, old []byte, identity *TOFUIdentity) ([]byte, bool, error) {
+	b, err := json.Marshal(identity)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, swapped, err := db.CmpAndSwap(tofuIdentitiesTable, []byte(identity.Identifier), old, b); err != nil || !swapped {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// releaseTOFUIdentity restores the value of an identifier claimed by a request
+// that failed. Errors are ignored, the claim expires after tofuClaimTimeout.
+func releaseTOFUIdentity(db nosql.DB, id string, claimed, old []byte) {
+	if old == nil {
+		if b, err := db.Get(tofuIdentitiesTable, []byte(id)); err == nil && bytes.Equal(b, claimed) {
+			_ = db.Del(tofuIdentitiesTable, []byte(id))
+		}
+		return
+	}
+	_, _, _ = db.CmpAndSwap(tofuIdentitiesTable, []byte(id), claimed, old)
+}
@@ -0,0 +1,123 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+func newTOFUCSR(t *testing.T, cn string) *x509.CertificateRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func assertTOFUError(t *testing.T, err error, statusCode int) {
+	t.Helper()
+	sc, ok := err.(errs.StatusCoder)
+	if assert.True(t, ok, "error does not implement StatusCoder interface") {
+		assert.Equals(t, statusCode, sc.StatusCode())
+	}
+}
+
+func TestAuthority_SignTOFU(t *testing.T) {
+	authDB, err := db.NewInMemory()
+	assert.FatalError(t, err)
+	clock := provisioner.NewFakeClock(time.Now().UTC().Truncate(time.Second))
+	a := testAuthority(t, WithDatabase(authDB), WithClock(clock))
+	a.config.AuthorityConfig.TOFU = &config.TOFUConfig{AllowedIdentifiers: []string{"*.internal"}}
+	d := authDB.(nosql.DB)
+
+	// First use
+	chain, err := a.SignTOFU(nil, newTOFUCSR(t, "foo.internal"))
+	assert.FatalError(t, err)
+	identity, _, err := getTOFUIdentity(d, "foo.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, chain[0].SerialNumber.String(), identity.SerialNumber)
+	assert.Equals(t, "", identity.Claim)
+
+	// Subsequent requests require the last certificate
+	_, err = a.SignTOFU(nil, newTOFUCSR(t, "foo.internal"))
+	assertTOFUError(t, err, http.StatusUnauthorized)
+	next, err := a.SignTOFU(chain[0], newTOFUCSR(t, "foo.internal"))
+	assert.FatalError(t, err)
+	_, err = a.SignTOFU(chain[0], newTOFUCSR(t, "foo.internal"))
+	assertTOFUError(t, err, http.StatusUnauthorized)
+
+	// A claimed identifier is rejected until the claim expires, and then the
+	// request must still be authenticated by the last certificate.
+	identity, old, err := getTOFUIdentity(d, "foo.internal")
+	assert.FatalError(t, err)
+	identity.Claim = "other-request"
+	_, swapped, err := swapTOFUIdentity(d, old, identity)
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	_, err = a.SignTOFU(next[0], newTOFUCSR(t, "foo.internal"))
+	assertTOFUError(t, err, http.StatusUnauthorized)
+	clock.Add(tofuClaimTimeout)
+	_, err = a.SignTOFU(nil, newTOFUCSR(t, "foo.internal"))
+	assertTOFUError(t, err, http.StatusUnauthorized)
+	_, err = a.SignTOFU(next[0], newTOFUCSR(t, "foo.internal"))
+	assert.FatalError(t, err)
+
+	// Not allowed
+	_, err = a.SignTOFU(nil, newTOFUCSR(t, "foo.example.com"))
+	assertTOFUError(t, err, http.StatusForbidden)
+
+	// Without a database
+	a.db = &db.SimpleDB{}
+	_, err = a.SignTOFU(nil, newTOFUCSR(t, "bar.internal"))
+	assertTOFUError(t, err, http.StatusNotImplemented)
+	assert.NotNil(t, a.DeleteTOFUIdentity("foo.internal"))
+}
+
+func Test_swapTOFUIdentity(t *testing.T) {
+	d := db.NewMemoryDB()
+	assert.FatalError(t, d.CreateTable(tofuIdentitiesTable))
+
+	// Only one of the requests claims a new identifier
+	first := &TOFUIdentity{Identifier: "foo.internal", Claim: "first"}
+	claimed, swapped, err := swapTOFUIdentity(d, nil, first)
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	_, swapped, err = swapTOFUIdentity(d, nil, &TOFUIdentity{Identifier: "foo.internal", Claim: "second"})
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+
+	// A failed request releases its claim
+	releaseTOFUIdentity(d, "foo.internal", claimed, nil)
+	identity, _, err := getTOFUIdentity(d, "foo.internal")
+	assert.FatalError(t, err)
+	assert.Nil(t, identity)
+
+	// The claim of an enrolled identifier is released to the previous value
+	enrolled := &TOFUIdentity{Identifier: "foo.internal", SerialNumber: "1"}
+	old, swapped, err := swapTOFUIdentity(d, nil, enrolled)
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	claimed, swapped, err = swapTOFUIdentity(d, old, &TOFUIdentity{Identifier: "foo.internal", SerialNumber: "1", Claim: "first"})
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	releaseTOFUIdentity(d, "foo.internal", claimed, old)
+	identity, _, err = getTOFUIdentity(d, "foo.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, enrolled, identity)
+}
@@ -0,0 +1,365 @@
+package authority
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/events"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/nosql"
+)
+
+var provisionerUsageTable = []byte("provisioner_usage")
+
+// Keys of the provisioner usage table.
+const (
+	usageStartedKey        = "started"
+	usageProvisionerPrefix = "provisioner:"
+)
+
+// usageFlushInterval is the interval between the writes of the usage
+// recorded in memory.
+const usageFlushInterval = time.Minute
+
+// usageDayFormat is the format of the days of the issuance counts.
+const usageDayFormat = "2006-01-02"
+
+// ProvisionerUsage is the use of a provisioner. LastUsed is nil if the
+// provisioner has not been used since the authority started tracking it.
+// Issued is the number of certificates issued per day in the last WindowDays
+// days, and IssuedInWindow their sum. A provisioner is stale if it has not
+// been used in the last StaleAfterDays days.
+type ProvisionerUsage struct {
+	Provisioner    string         `json:"provisioner"`
+	Type           string         `json:"type"`
+	TrackedSince   time.Time      `json:"trackedSince"`
+	LastUsed       *time.Time     `json:"lastUsed,omitempty"`
+	WindowDays     int            `json:"windowDays"`
+	Issued         map[string]int `json:"issued"`
+	IssuedInWindow int            `json:"issuedInWindow"`
+	StaleAfterDays int            `json:"staleAfterDays"`
+	Stale          bool           `json:"stale"`
+}
+
+// usageRecord is the usage of a provisioner stored in the database.
+type usageRecord struct {
+	TrackedSince time.Time      `json:"trackedSince,omitempty"`
+	LastUsed     time.Time      `json:"lastUsed,omitempty"`
+	Issued       map[string]int `json:"issued,omitempty"`
+}
+
+// merge adds the usage in o to the record.
+func (r *usageRecord) merge(o *usageRecord) {
+	if r.TrackedSince.IsZero() || (!o.TrackedSince.IsZero() && o.TrackedSince.Before(r.TrackedSince)) {
+		r.TrackedSince = o.TrackedSince
+	}
+	if o.LastUsed.After(r.LastUsed) {
+		r.LastUsed = o.LastUsed
+	}
+	for day, n := range o.Issued {
+		if r.Issued == nil {
+			r.Issued = make(map[string]int)
+		}
+		r.Issued[day] += n
+	}
+}
+
+// prune removes the issuance counts older than the given number of days.
+func (r *usageRecord) prune(now time.Time, days int) {
+	oldest := now.UTC().AddDate(0, 0, 1-days).Format(usageDayFormat)
+	for day := range r.Issued {
+		if day < oldest {
+			delete(r.Issued, day)
+		}
+	}
+}
+
+// usageStore keeps the provisioner usage in the database.
+type usageStore struct {
+	db nosql.DB
+}
+
+func newUsageStore(db nosql.DB) (*usageStore, error) {
+	if err := db.CreateTable(provisionerUsageTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(provisionerUsageTable))
+	}
+	return &usageStore{db: db}, nil
+}
+
+func (s *usageStore) get(key string, v interface{}) (bool, error) {
+	b, err := s.db.Get(provisionerUsageTable, []byte(key))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, errors.Wrapf(err, "error loading provisioner usage %s", key)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, errors.Wrapf(err, "error unmarshaling provisioner usage %s", key)
+	}
+	return true, nil
+}
+
+func (s *usageStore) set(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling provisioner usage %s", key)
+	}
+	return errors.Wrapf(s.db.Set(provisionerUsageTable, []byte(key), b), "error storing provisioner usage %s", key)
+}
+
+func (s *usageStore) del(key string) error {
+	return errors.Wrapf(s.db.Del(provisionerUsageTable, []byte(key)), "error deleting provisioner usage %s", key)
+}
+
+// usageTracker records the use of the provisioners in memory and writes it
+// periodically to the store, so using a provisioner does not add a database
+// write to every request.
+type usageTracker struct {
+	store       *usageStore
+	windowDays  int
+	staleAfter  int
+	started     time.Time
+	mu          sync.Mutex
+	pending     map[string]*usageRecord
+	now         func() time.Time
+	unsubscribe func()
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+// initProvisionerUsage starts tracking the use of the provisioners if
+// configured.
+func (a *Authority) initProvisionerUsage() error {
+	c := a.config.AuthorityConfig.ProvisionerUsage
+	if c == nil {
+		return nil
+	}
+	store, err := newUsageStore(a.getStateDB())
+	if err != nil {
+		return err
+	}
+	t := &usageTracker{
+		store:      store,
+		windowDays: c.GetWindowDays(),
+		staleAfter: c.GetStaleAfterDays(),
+		pending:    make(map[string]*usageRecord),
+		now:        a.now,
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+
+	// Provisioners without usage are tracked since the first start.
+	ok, err := store.get(usageStartedKey, &t.started)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		t.started = a.now().UTC().Truncate(time.Second)
+		if err := store.set(usageStartedKey, t.started); err != nil {
+			return err
+		}
+	}
+
+	t.unsubscribe = a.events.Subscribe(func(ev events.Event) {
+		switch e := ev.(type) {
+		case *events.CertificateIssued:
+			t.record(e.Provisioner, 1, e.Time)
+		case *events.CertificateRenewed:
+			if name, ok := provisioner.GetProvisionerName(e.Certificate.Extensions); ok {
+				t.record(name, 1, e.Time)
+			}
+		case *events.ProvisionerUpdated:
+			if err := t.provisionerUpdated(e); err != nil {
+				log.Printf("error updating usage of provisioner %s: %v", e.Name, err)
+			}
+		}
+	}, events.CertificateIssuedType, events.CertificateRenewedType, events.ProvisionerUpdatedType)
+	go t.run()
+	a.provisionerUsage = t
+	return nil
+}
+
+// recordProvisionerUse records the use of a provisioner and the number of
+// certificates issued with it.
+func (a *Authority) recordProvisionerUse(p provisioner.Interface, issued int) {
+	if a.provisionerUsage != nil && p != nil {
+		a.provisionerUsage.record(p.GetName(), issued, a.now())
+	}
+}
+
+// record adds a use of the given provisioner to the pending usage.
+func (t *usageTracker) record(name string, issued int, now time.Time) {
+	if name == "" {
+		return
+	}
+	now = now.UTC()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.pending[name]
+	if !ok {
+		r = new(usageRecord)
+		t.pending[name] = r
+	}
+	u := &usageRecord{LastUsed: now}
+	if issued > 0 {
+		u.Issued = map[string]int{now.Format(usageDayFormat): issued}
+	}
+	r.merge(u)
+}
+
+// provisionerUpdated starts tracking new provisioners and removes the usage
+// of the deleted ones.
+func (t *usageTracker) provisionerUpdated(e *events.ProvisionerUpdated) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := usageProvisionerPrefix + e.Name
+	switch e.Action {
+	case events.ProvisionerActionCreated:
+		return t.store.set(key, &usageRecord{TrackedSince: e.Time.UTC()})
+	case events.ProvisionerActionRemoved:
+		delete(t.pending, e.Name)
+		return t.store.del(key)
+	default:
+		return nil
+	}
+}
+
+func (t *usageTracker) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if err := t.flush(t.now()); err != nil {
+				log.Printf("error storing provisioner usage: %v", err)
+			}
+		}
+	}
+}
+
+// Stop stops recording the usage and writes the pending usage.
+func (t *usageTracker) Stop() {
+	t.unsubscribe()
+	close(t.done)
+	<-t.stopped
+	if err := t.flush(t.now()); err != nil {
+		log.Printf("error storing provisioner usage: %v", err)
+	}
+}
+
+// flush merges the pending usage into the stored one. The usage that cannot
+// be stored is kept for the next flush.
+func (t *usageTracker) flush(now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, r := range t.pending {
+		stored, err := t.load(name)
+		if err != nil {
+			return err
+		}
+		stored.merge(r)
+		stored.prune(now, t.windowDays)
+		if err := t.store.set(usageProvisionerPrefix+name, stored); err != nil {
+			return err
+		}
+		delete(t.pending, name)
+	}
+	return nil
+}
+
+// load returns the stored usage of a provisioner. It must be called with the
+// lock held.
+func (t *usageTracker) load(name string) (*usageRecord, error) {
+	r := new(usageRecord)
+	if _, err := t.store.get(usageProvisionerPrefix+name, r); err != nil {
+		return nil, err
+	}
+	if r.TrackedSince.IsZero() {
+		r.TrackedSince = t.started
+	}
+	return r, nil
+}
+
+// usage returns the stored and the pending usage of a provisioner.
+func (t *usageTracker) usage(p provisioner.Interface, now time.Time) (*ProvisionerUsage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, err := t.load(p.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if pending, ok := t.pending[p.GetName()]; ok {
+		r.merge(pending)
+	}
+	r.prune(now, t.windowDays)
+
+	u := &ProvisionerUsage{
+		Provisioner:    p.GetName(),
+		Type:           p.GetType().String(),
+		TrackedSince:   r.TrackedSince,
+		WindowDays:     t.windowDays,
+		Issued:         make(map[string]int),
+		StaleAfterDays: t.staleAfter,
+	}
+	for day, n := range r.Issued {
+		u.Issued[day] = n
+		u.IssuedInWindow += n
+	}
+	lastUsed := r.TrackedSince
+	if !r.LastUsed.IsZero() {
+		u.LastUsed = &r.LastUsed
+		lastUsed = r.LastUsed
+	}
+	u.Stale = now.Sub(lastUsed) > time.Duration(t.staleAfter)*24*time.Hour
+	return u, nil
+}
+
+// GetProvisionerUsage returns the usage of the provisioner with the given
+// name.
+func (a *Authority) GetProvisionerUsage(name string) (*ProvisionerUsage, error) {
+	if a.provisionerUsage == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "provisioner usage is not enabled")
+	}
+	p, err := a.LoadProvisionerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	u, err := a.provisionerUsage.usage(p, a.now())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading usage of provisioner %s", name)
+	}
+	return u, nil
+}
+
+// GetProvisionersUsage returns the usage of the given page of provisioners
+// and the cursor of the next page. If staleOnly is true, only the stale
+// provisioners in the page are returned.
+func (a *Authority) GetProvisionersUsage(cursor string, limit int, staleOnly bool) ([]*ProvisionerUsage, string, error) {
+	if a.provisionerUsage == nil {
+		return nil, "", admin.NewError(admin.ErrorNotImplementedType, "provisioner usage is not enabled")
+	}
+	provs, next, err := a.GetProvisioners(cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	now := a.now()
+	list := []*ProvisionerUsage{}
+	for _, p := range provs {
+		u, err := a.provisionerUsage.usage(p, now)
+		if err != nil {
+			return nil, "", admin.WrapErrorISE(err, "error loading usage of provisioner %s", p.GetName())
+		}
+		if !staleOnly || u.Stale {
+			list = append(list, u)
+		}
+	}
+	return list, next, nil
+}
@@ -0,0 +1,81 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/events"
+)
+
+func TestAuthority_ProvisionerUsage(t *testing.T) {
+	a := testAuthority(t)
+
+	// Usage is not enabled
+	_, err := a.GetProvisionerUsage("Max")
+	assert.NotNil(t, err)
+	_, _, err = a.GetProvisionersUsage("", 0, false)
+	assert.NotNil(t, err)
+
+	a.config.AuthorityConfig.ProvisionerUsage = &config.ProvisionerUsageConfig{WindowDays: 30, StaleAfterDays: 90}
+	assert.FatalError(t, a.initProvisionerUsage())
+	defer a.provisionerUsage.Stop()
+	tracker := a.provisionerUsage
+
+	now := time.Now().UTC()
+	today := now.Format(usageDayFormat)
+	tracker.record("Max", 1, now.AddDate(0, 0, -100))
+	tracker.record("step-cli", 2, now.AddDate(0, 0, -40))
+	assert.FatalError(t, tracker.flush(now))
+
+	// Pending usage is merged with the stored one
+	tracker.record("step-cli", 1, now)
+	tracker.record("step-cli", 0, now)
+
+	u, err := a.GetProvisionerUsage("step-cli")
+	assert.FatalError(t, err)
+	assert.Equals(t, "step-cli", u.Provisioner)
+	assert.Equals(t, now, *u.LastUsed)
+	assert.Equals(t, map[string]int{today: 1}, u.Issued)
+	assert.Equals(t, 1, u.IssuedInWindow)
+	assert.False(t, u.Stale)
+
+	u, err = a.GetProvisionerUsage("Max")
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, u.IssuedInWindow)
+	assert.True(t, u.Stale)
+
+	// Provisioners never used are tracked since the first start
+	u, err = a.GetProvisionerUsage("dev")
+	assert.FatalError(t, err)
+	assert.Nil(t, u.LastUsed)
+	assert.Equals(t, tracker.started, u.TrackedSince)
+	assert.False(t, u.Stale)
+
+	_, err = a.GetProvisionerUsage("missing")
+	assert.NotNil(t, err)
+
+	list, _, err := a.GetProvisionersUsage("", 100, true)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, list)
+	assert.Equals(t, "Max", list[0].Provisioner)
+
+	// New provisioners are tracked since their creation
+	created := now.AddDate(0, 0, -91)
+	assert.FatalError(t, tracker.provisionerUpdated(&events.ProvisionerUpdated{
+		Time: created, Name: "dev", Action: events.ProvisionerActionCreated,
+	}))
+	u, err = a.GetProvisionerUsage("dev")
+	assert.FatalError(t, err)
+	assert.Equals(t, created, u.TrackedSince)
+	assert.True(t, u.Stale)
+
+	// The usage of removed provisioners is deleted
+	assert.FatalError(t, tracker.provisionerUpdated(&events.ProvisionerUpdated{
+		Time: now, Name: "Max", Action: events.ProvisionerActionRemoved,
+	}))
+	r, err := tracker.load("Max")
+	assert.FatalError(t, err)
+	assert.True(t, r.LastUsed.IsZero())
+}
@@ -0,0 +1,727 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/webauthn"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/randutil"
+	"go.step.sm/linkedca"
+)
+
+var (
+	webAuthnCredentialsTable = []byte("webauthn_credentials")
+	webAuthnChallengesTable  = []byte("webauthn_challenges")
+)
+
+// webAuthnChallengeSize is the size in bytes of the challenges of the
+// ceremonies.
+const webAuthnChallengeSize = 32
+
+// Types of the short-lived records in the challenges table.
+const (
+	webAuthnRegistration = "registration"
+	webAuthnAssertion    = "assertion"
+	webAuthnSession      = "session"
+	webAuthnEnrollment   = "enrollment"
+)
+
+// webAuthnBootstrapAdmin is the admin id of the enrollment code created when
+// there are no security keys. It can be used by any super administrator.
+const webAuthnBootstrapAdmin = "bootstrap"
+
+// WebAuthnCredential is a security key registered by an administrator.
+type WebAuthnCredential struct {
+	ID         string    `json:"id"`
+	AdminID    string    `json:"adminID"`
+	Subject    string    `json:"subject"`
+	Name       string    `json:"name"`
+	PublicKey  []byte    `json:"publicKey"`
+	Algorithm  int64     `json:"algorithm"`
+	SignCount  uint32    `json:"signCount"`
+	Format     string    `json:"format"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+// WebAuthnSession is a step-up session created after an authentication with
+// a security key. The token must be sent in the X-WebAuthn-Session header of
+// the mutating admin API requests.
+type WebAuthnSession struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WebAuthnEnrollment is a one-time code that allows an administrator to
+// register its first security key. The code must be sent in the
+// X-WebAuthn-Enrollment header of the registration requests.
+type WebAuthnEnrollment struct {
+	AdminID   string    `json:"adminID"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// webAuthnChallenge is a pending ceremony, a step-up session or an enrollment
+// code of an administrator. Ceremonies and enrollment codes are keyed by type
+// and admin, so an administrator has at most one of each type, sessions are
+// keyed by their token. The challenge of an enrollment is the hash of the
+// code.
+type webAuthnChallenge struct {
+	Key       string    `json:"key"`
+	Type      string    `json:"type"`
+	AdminID   string    `json:"adminID"`
+	Challenge []byte    `json:"challenge,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (c *webAuthnChallenge) isExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+func webAuthnCeremonyKey(typ, adminID string) string {
+	return typ + "/" + adminID
+}
+
+func webAuthnSessionKey(token string) string {
+	return webAuthnSession + "/" + token
+}
+
+// webAuthnStore keeps the registered credentials and the pending challenges
+// in the database.
+type webAuthnStore struct {
+	db nosql.DB
+}
+
+func newWebAuthnStore(db nosql.DB) (*webAuthnStore, error) {
+	for _, table := range [][]byte{webAuthnCredentialsTable, webAuthnChallengesTable} {
+		if err := db.CreateTable(table); err != nil {
+			return nil, errors.Wrapf(err, "error creating table %s", string(table))
+		}
+	}
+	return &webAuthnStore{db: db}, nil
+}
+
+func (s *webAuthnStore) getCredential(id string) (*WebAuthnCredential, error) {
+	b, err := s.db.Get(webAuthnCredentialsTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading credential %s", id)
+	}
+	c := new(WebAuthnCredential)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling credential %s", id)
+	}
+	return c, nil
+}
+
+// hasCredentials returns true if any administrator has registered a
+// security key.
+func (s *webAuthnStore) hasCredentials() (bool, error) {
+	entries, err := s.db.List(webAuthnCredentialsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return false, errors.Wrap(err, "error loading credentials")
+	}
+	return len(entries) > 0, nil
+}
+
+// listCredentials returns the credentials of the given administrator.
+func (s *webAuthnStore) listCredentials(adminID string) ([]*WebAuthnCredential, error) {
+	entries, err := s.db.List(webAuthnCredentialsTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading credentials")
+	}
+	credentials := []*WebAuthnCredential{}
+	for _, e := range entries {
+		c := new(WebAuthnCredential)
+		if err := json.Unmarshal(e.Value, c); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling credential %s", string(e.Key))
+		}
+		if c.AdminID == adminID {
+			credentials = append(credentials, c)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (s *webAuthnStore) setCredential(c *WebAuthnCredential) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling credential %s", c.ID)
+	}
+	return errors.Wrapf(s.db.Set(webAuthnCredentialsTable, []byte(c.ID), b), "error storing credential %s", c.ID)
+}
+
+func (s *webAuthnStore) deleteCredential(id string) error {
+	return errors.Wrapf(s.db.Del(webAuthnCredentialsTable, []byte(id)), "error deleting credential %s", id)
+}
+
+func (s *webAuthnStore) getChallenge(key string) (*webAuthnChallenge, error) {
+	b, err := s.db.Get(webAuthnChallengesTable, []byte(key))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "error loading challenge")
+	}
+	c := new(webAuthnChallenge)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling challenge")
+	}
+	return c, nil
+}
+
+func (s *webAuthnStore) listChallenges() ([]*webAuthnChallenge, error) {
+	entries, err := s.db.List(webAuthnChallengesTable)
+	if err != nil && !nosql.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error loading challenges")
+	}
+	challenges := []*webAuthnChallenge{}
+	for _, e := range entries {
+		c := new(webAuthnChallenge)
+		if err := json.Unmarshal(e.Value, c); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling challenge")
+		}
+		challenges = append(challenges, c)
+	}
+	return challenges, nil
+}
+
+func (s *webAuthnStore) setChallenge(c *webAuthnChallenge) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling challenge")
+	}
+	return errors.Wrap(s.db.Set(webAuthnChallengesTable, []byte(c.Key), b), "error storing challenge")
+}
+
+func (s *webAuthnStore) deleteChallenge(key string) error {
+	return errors.Wrap(s.db.Del(webAuthnChallengesTable, []byte(key)), "error deleting challenge")
+}
+
+// popChallenge returns and deletes the pending ceremony of the given type
+// and administrator. Challenges can only be used once.
+func (s *webAuthnStore) popChallenge(typ, adminID string, now time.Time) (*webAuthnChallenge, error) {
+	key := webAuthnCeremonyKey(typ, adminID)
+	c, err := s.getChallenge(key)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	if err := s.deleteChallenge(key); err != nil {
+		return nil, err
+	}
+	if c.isExpired(now) {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// pruneChallenges removes the expired ceremonies and sessions.
+func (s *webAuthnStore) pruneChallenges(now time.Time) error {
+	challenges, err := s.listChallenges()
+	if err != nil {
+		return err
+	}
+	for _, c := range challenges {
+		if c.isExpired(now) {
+			if err := s.deleteChallenge(c.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getWebAuthnStore returns the store of the security keys and step-up
+// sessions, it's created the first time it's used. It must be called with the
+// webAuthnMutex held.
+func (a *Authority) getWebAuthnStore() (*webAuthnStore, error) {
+	if a.webAuthn == nil {
+		store, err := newWebAuthnStore(a.getStateDB())
+		if err != nil {
+			return nil, err
+		}
+		a.webAuthn = store
+	}
+	return a.webAuthn, nil
+}
+
+// initWebAuthn creates the enrollment code of the first security key if
+// WebAuthn is configured and no administrator has registered one. The code
+// is only written to the log, so it must be read by the operator of the CA
+// and given to a super administrator.
+func (a *Authority) initWebAuthn() error {
+	if !a.IsWebAuthnRequired() {
+		return nil
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return err
+	}
+	if ok, err := store.hasCredentials(); err != nil || ok {
+		return err
+	}
+	e, err := a.newWebAuthnEnrollment(store, webAuthnBootstrapAdmin)
+	if err != nil {
+		return err
+	}
+	log.Printf("WebAuthn enrollment code for the first security key of a super administrator: %s (expires at %s)",
+		e.Code, e.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// IsWebAuthnRequired returns true if the mutating admin API requests require
+// a step-up session created with a security key.
+func (a *Authority) IsWebAuthnRequired() bool {
+	return a.config.AuthorityConfig.WebAuthn != nil
+}
+
+// webAuthnRelyingParty returns the relying party used to verify the
+// ceremonies.
+func (a *Authority) webAuthnRelyingParty() *webauthn.RelyingParty {
+	c := a.config.AuthorityConfig.WebAuthn
+	return &webauthn.RelyingParty{
+		ID:                      c.RPID,
+		Origins:                 c.GetOrigins(),
+		RequireUserVerification: c.UserVerification,
+	}
+}
+
+// checkWebAuthnRequest validates the common preconditions of the WebAuthn
+// methods.
+func (a *Authority) checkWebAuthnRequest(adm *linkedca.Admin) error {
+	if !a.IsWebAuthnRequired() {
+		return admin.NewError(admin.ErrorNotImplementedType, "webauthn is not configured")
+	}
+	if adm == nil {
+		return admin.NewError(admin.ErrorUnauthorizedType, "webauthn requires an administrator")
+	}
+	return nil
+}
+
+// newWebAuthnChallenge creates and stores a new ceremony of the given type.
+func (a *Authority) newWebAuthnChallenge(store *webAuthnStore, typ string, adm *linkedca.Admin) (*webAuthnChallenge, error) {
+	challenge, err := randutil.Salt(webAuthnChallengeSize)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating challenge")
+	}
+	c := &webAuthnChallenge{
+		Key:       webAuthnCeremonyKey(typ, adm.Id),
+		Type:      typ,
+		AdminID:   adm.Id,
+		Challenge: challenge,
+		ExpiresAt: a.now().Add(config.WebAuthnCeremonyTimeout),
+	}
+	if err := store.setChallenge(c); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing challenge")
+	}
+	return c, nil
+}
+
+// checkWebAuthnSession returns an error if the token is not a valid step-up
+// session of the given administrator. It must be called with the
+// webAuthnMutex held.
+func (a *Authority) checkWebAuthnSession(store *webAuthnStore, adm *linkedca.Admin, token string) error {
+	if token == "" {
+		return admin.NewError(admin.ErrorUnauthorizedType, "request requires a webauthn session")
+	}
+	s, err := store.getChallenge(webAuthnSessionKey(token))
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading webauthn session")
+	}
+	if s == nil || s.Type != webAuthnSession || s.AdminID != adm.Id || s.isExpired(a.now()) {
+		return admin.NewError(admin.ErrorUnauthorizedType, "webauthn session is not valid or has expired")
+	}
+	return nil
+}
+
+// newWebAuthnEnrollment creates and stores a new enrollment code for the
+// given administrator. It must be called with the webAuthnMutex held.
+func (a *Authority) newWebAuthnEnrollment(store *webAuthnStore, adminID string) (*WebAuthnEnrollment, error) {
+	code, err := randutil.Hex(32)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating enrollment code")
+	}
+	sum := sha256.Sum256([]byte(code))
+	c := &webAuthnChallenge{
+		Key:       webAuthnCeremonyKey(webAuthnEnrollment, adminID),
+		Type:      webAuthnEnrollment,
+		AdminID:   adminID,
+		Challenge: sum[:],
+		ExpiresAt: a.now().UTC().Truncate(time.Second).Add(config.WebAuthnEnrollmentTimeout),
+	}
+	if err := store.setChallenge(c); err != nil {
+		return nil, err
+	}
+	return &WebAuthnEnrollment{
+		AdminID:   adminID,
+		Code:      code,
+		ExpiresAt: c.ExpiresAt,
+	}, nil
+}
+
+// checkWebAuthnEnrollment returns the key of the enrollment code that allows
+// the given administrator to register its first security key. The code can
+// be created for the administrator by a super administrator, or it can be the
+// bootstrap code if the administrator is a super administrator. It must be
+// called with the webAuthnMutex held.
+func (a *Authority) checkWebAuthnEnrollment(store *webAuthnStore, adm *linkedca.Admin, code string) (string, error) {
+	if code == "" {
+		return "", admin.NewError(admin.ErrorUnauthorizedType, "the first security key requires an enrollment code")
+	}
+	adminIDs := []string{adm.Id}
+	if adm.Type == linkedca.Admin_SUPER_ADMIN {
+		adminIDs = append(adminIDs, webAuthnBootstrapAdmin)
+	}
+	sum := sha256.Sum256([]byte(code))
+	now := a.now()
+	for _, id := range adminIDs {
+		key := webAuthnCeremonyKey(webAuthnEnrollment, id)
+		c, err := store.getChallenge(key)
+		if err != nil {
+			return "", admin.WrapErrorISE(err, "error loading webauthn enrollment")
+		}
+		if c != nil && c.Type == webAuthnEnrollment && !c.isExpired(now) &&
+			subtle.ConstantTimeCompare(c.Challenge, sum[:]) == 1 {
+			return key, nil
+		}
+	}
+	return "", admin.NewError(admin.ErrorUnauthorizedType, "webauthn enrollment code is not valid or has expired")
+}
+
+// credentialIDs returns the raw ids of the given credentials.
+func credentialIDs(credentials []*WebAuthnCredential) [][]byte {
+	ids := make([][]byte, 0, len(credentials))
+	for _, c := range credentials {
+		if id, err := base64.RawURLEncoding.DecodeString(c.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// BeginWebAuthnRegistration starts the registration of a security key and
+// returns the options for navigator.credentials.create(). The first security
+// key of an administrator requires an enrollment code, the next ones require
+// a step-up session.
+func (a *Authority) BeginWebAuthnRegistration(adm *linkedca.Admin, session, code string) (*webauthn.CreationOptions, error) {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return nil, err
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	credentials, err := store.listCredentials(adm.Id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	if len(credentials) > 0 {
+		if err := a.checkWebAuthnSession(store, adm, session); err != nil {
+			return nil, err
+		}
+	} else if _, err := a.checkWebAuthnEnrollment(store, adm, code); err != nil {
+		return nil, err
+	}
+	c, err := a.newWebAuthnChallenge(store, webAuthnRegistration, adm)
+	if err != nil {
+		return nil, err
+	}
+
+	user := webauthn.UserEntity{
+		ID:          webauthn.Bytes(adm.Id),
+		Name:        adm.Subject,
+		DisplayName: adm.Subject,
+	}
+	rp := a.webAuthnRelyingParty()
+	timeout := config.WebAuthnCeremonyTimeout.Milliseconds()
+	return rp.NewCreationOptions(a.config.AuthorityConfig.WebAuthn.GetRPName(), user, c.Challenge, timeout, credentialIDs(credentials)), nil
+}
+
+// FinishWebAuthnRegistration verifies the new credential of the pending
+// registration and stores it with the given name. The enrollment code of the
+// first security key is consumed.
+func (a *Authority) FinishWebAuthnRegistration(adm *linkedca.Admin, session, code, name string, resp *webauthn.CredentialCreationResponse) (*WebAuthnCredential, error) {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return nil, err
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	credentials, err := store.listCredentials(adm.Id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	var enrollmentKey string
+	if len(credentials) > 0 {
+		if err := a.checkWebAuthnSession(store, adm, session); err != nil {
+			return nil, err
+		}
+	} else if enrollmentKey, err = a.checkWebAuthnEnrollment(store, adm, code); err != nil {
+		return nil, err
+	}
+	now := a.now().UTC().Truncate(time.Second)
+	c, err := store.popChallenge(webAuthnRegistration, adm.Id, now)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn registration")
+	}
+	if c == nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "webauthn registration not found or expired")
+	}
+
+	cred, err := a.webAuthnRelyingParty().VerifyRegistration(c.Challenge, resp)
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error verifying webauthn registration")
+	}
+	id := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if old, err := store.getCredential(id); err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credential")
+	} else if old != nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "webauthn credential is already registered")
+	}
+	if name == "" {
+		name = id
+	}
+	if enrollmentKey != "" {
+		if err := store.deleteChallenge(enrollmentKey); err != nil {
+			return nil, admin.WrapErrorISE(err, "error deleting webauthn enrollment")
+		}
+	}
+
+	wc := &WebAuthnCredential{
+		ID:        id,
+		AdminID:   adm.Id,
+		Subject:   adm.Subject,
+		Name:      name,
+		PublicKey: cred.PublicKey,
+		Algorithm: cred.Algorithm,
+		SignCount: cred.SignCount,
+		Format:    cred.Format,
+		CreatedAt: now,
+	}
+	if err := store.setCredential(wc); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing webauthn credential")
+	}
+	return wc, nil
+}
+
+// BeginWebAuthnAssertion starts the authentication of an administrator with
+// one of its security keys and returns the options for
+// navigator.credentials.get().
+func (a *Authority) BeginWebAuthnAssertion(adm *linkedca.Admin) (*webauthn.RequestOptions, error) {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return nil, err
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	credentials, err := store.listCredentials(adm.Id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	if len(credentials) == 0 {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "admin %s does not have webauthn credentials", adm.Subject)
+	}
+	c, err := a.newWebAuthnChallenge(store, webAuthnAssertion, adm)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := a.webAuthnRelyingParty()
+	timeout := config.WebAuthnCeremonyTimeout.Milliseconds()
+	return rp.NewRequestOptions(c.Challenge, timeout, credentialIDs(credentials)), nil
+}
+
+// FinishWebAuthnAssertion verifies the assertion of the pending
+// authentication and returns a new step-up session.
+func (a *Authority) FinishWebAuthnAssertion(adm *linkedca.Admin, resp *webauthn.CredentialAssertionResponse) (*WebAuthnSession, error) {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "webauthn assertion cannot be empty")
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	now := a.now().UTC().Truncate(time.Second)
+	c, err := store.popChallenge(webAuthnAssertion, adm.Id, now)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn assertion")
+	}
+	if c == nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "webauthn assertion not found or expired")
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(resp.RawID)
+	wc, err := store.getCredential(id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credential")
+	}
+	if wc == nil || wc.AdminID != adm.Id {
+		return nil, admin.NewError(admin.ErrorUnauthorizedType, "webauthn credential not found")
+	}
+	signCount, err := a.webAuthnRelyingParty().VerifyAssertion(c.Challenge, &webauthn.Credential{
+		ID:        resp.RawID,
+		PublicKey: wc.PublicKey,
+		Algorithm: wc.Algorithm,
+		SignCount: wc.SignCount,
+		Format:    wc.Format,
+	}, resp)
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorUnauthorizedType, err, "error verifying webauthn assertion")
+	}
+
+	wc.SignCount = signCount
+	wc.LastUsedAt = now
+	if err := store.setCredential(wc); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing webauthn credential")
+	}
+
+	token, err := randutil.Hex(32)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating webauthn session")
+	}
+	s := &webAuthnChallenge{
+		Key:       webAuthnSessionKey(token),
+		Type:      webAuthnSession,
+		AdminID:   adm.Id,
+		ExpiresAt: now.Add(a.config.AuthorityConfig.WebAuthn.GetSessionExpiry()),
+	}
+	if err := store.pruneChallenges(now); err != nil {
+		return nil, admin.WrapErrorISE(err, "error removing expired webauthn sessions")
+	}
+	if err := store.setChallenge(s); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing webauthn session")
+	}
+	return &WebAuthnSession{
+		Token:     token,
+		ExpiresAt: s.ExpiresAt,
+	}, nil
+}
+
+// AuthorizeWebAuthnSession returns an error if WebAuthn is configured and the
+// token is not a valid step-up session of the given administrator.
+// Administrators without security keys cannot send mutating requests.
+func (a *Authority) AuthorizeWebAuthnSession(adm *linkedca.Admin, token string) error {
+	if !a.IsWebAuthnRequired() {
+		return nil
+	}
+	if adm == nil {
+		return admin.NewError(admin.ErrorUnauthorizedType, "webauthn requires an administrator")
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading webauthn sessions")
+	}
+	return a.checkWebAuthnSession(store, adm, token)
+}
+
+// CreateWebAuthnEnrollment creates a one-time code that allows the given
+// administrator to register its first security key. Only super
+// administrators can create them, replacing the previous code of the
+// administrator.
+func (a *Authority) CreateWebAuthnEnrollment(adm *linkedca.Admin, adminID string) (*WebAuthnEnrollment, error) {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return nil, err
+	}
+	if adm.Type != linkedca.Admin_SUPER_ADMIN {
+		return nil, admin.NewError(admin.ErrorUnauthorizedType, "only super administrators can create webauthn enrollments")
+	}
+	if _, ok := a.LoadAdminByID(adminID); !ok {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "admin %s not found", adminID)
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	e, err := a.newWebAuthnEnrollment(store, adminID)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating webauthn enrollment")
+	}
+	return e, nil
+}
+
+// GetWebAuthnCredentials returns the security keys of the given
+// administrator.
+func (a *Authority) GetWebAuthnCredentials(adm *linkedca.Admin) ([]*WebAuthnCredential, error) {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return nil, err
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	credentials, err := store.listCredentials(adm.Id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	return credentials, nil
+}
+
+// DeleteWebAuthnCredential removes a security key. Administrators can remove
+// their own keys, super administrators can remove the keys of any
+// administrator, for example, after losing them.
+func (a *Authority) DeleteWebAuthnCredential(adm *linkedca.Admin, id string) error {
+	if err := a.checkWebAuthnRequest(adm); err != nil {
+		return err
+	}
+
+	a.webAuthnMutex.Lock()
+	defer a.webAuthnMutex.Unlock()
+	store, err := a.getWebAuthnStore()
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	wc, err := store.getCredential(id)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading webauthn credential")
+	}
+	if wc == nil || (wc.AdminID != adm.Id && adm.Type != linkedca.Admin_SUPER_ADMIN) {
+		return admin.NewError(admin.ErrorNotFoundType, "webauthn credential %s not found", id)
+	}
+	if err := store.deleteCredential(id); err != nil {
+		return admin.WrapErrorISE(err, "error deleting webauthn credential")
+	}
+	return nil
+}
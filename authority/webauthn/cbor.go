@@ -0,0 +1,177 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// maxCBORDepth limits the nesting of the decoded CBOR items.
+const maxCBORDepth = 16
+
+// CBOR major types.
+const (
+	cborUnsigned = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborDecoder decodes the subset of CBOR used by WebAuthn: the attestation
+// objects and the COSE keys. Authenticators must use the CTAP2 canonical
+// encoding, so indefinite lengths, tags and floats are not supported.
+//
+// Integers are decoded as int64, byte strings as []byte, text strings as
+// string, arrays as []interface{} and maps as map[interface{}]interface{}.
+type cborDecoder struct {
+	b []byte
+}
+
+// decodeCBOR decodes the first CBOR item in b and returns it with the
+// remaining bytes.
+func decodeCBOR(b []byte) (interface{}, []byte, error) {
+	d := &cborDecoder{b: b}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, d.b, nil
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)) {
+		return nil, errors.New("unexpected end of CBOR data")
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v, nil
+}
+
+// header reads the major type and the argument of the next item.
+func (d *cborDecoder) header() (byte, uint64, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		b, err = d.read(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(b[0]), nil
+	case info == 25:
+		b, err = d.read(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err = d.read(4)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err = d.read(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, binary.BigEndian.Uint64(b), nil
+	default:
+		return 0, 0, errors.Errorf("unsupported CBOR additional information %d", info)
+	}
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("CBOR data is too deeply nested")
+	}
+	major, arg, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("CBOR integer overflows int64")
+		}
+		return int64(arg), nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("CBOR integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case cborBytes:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case cborText:
+		b, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case cborArray:
+		if arg > uint64(len(d.b)) {
+			return nil, errors.New("unexpected end of CBOR data")
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case cborMap:
+		if arg > uint64(len(d.b)) {
+			return nil, errors.New("unexpected end of CBOR data")
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("unsupported CBOR map key")
+			}
+			if _, ok := m[k]; ok {
+				return nil, errors.Errorf("duplicated CBOR map key %v", k)
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case cborSimple:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		default:
+			return nil, errors.Errorf("unsupported CBOR simple value %d", arg)
+		}
+	default:
+		return nil, errors.Errorf("unsupported CBOR major type %d", major)
+	}
+}
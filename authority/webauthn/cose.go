@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// COSE algorithms supported for the credential keys.
+const (
+	// AlgES256 is ECDSA with P-256 and SHA-256.
+	AlgES256 int64 = -7
+	// AlgEdDSA is EdDSA with Ed25519.
+	AlgEdDSA int64 = -8
+	// AlgRS256 is RSASSA-PKCS1-v1_5 with SHA-256.
+	AlgRS256 int64 = -257
+)
+
+// COSE key types and parameters.
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseKeyCurve = -1 // also RSA modulus n
+	coseKeyX     = -2 // also RSA exponent e
+	coseKeyY     = -3
+)
+
+// parseCOSEKey parses the COSE_Key at the beginning of b. It returns the
+// public key, its algorithm and the remaining bytes.
+func parseCOSEKey(b []byte) (crypto.PublicKey, int64, []byte, error) {
+	v, rest, err := decodeCBOR(b)
+	if err != nil {
+		return nil, 0, nil, errors.Wrap(err, "error decoding credential public key")
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, nil, errors.New("credential public key is not a COSE key")
+	}
+	kty, _ := m[int64(coseKeyType)].(int64)
+	alg, _ := m[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		y, _ := m[int64(coseKeyY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, nil, errors.New("invalid ES256 credential public key")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, nil, errors.New("invalid ES256 credential public key")
+		}
+		return pub, alg, rest, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseKeyCurve)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, nil, errors.New("invalid EdDSA credential public key")
+		}
+		return ed25519.PublicKey(x), alg, rest, nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := m[int64(coseKeyCurve)].([]byte)
+		e, _ := m[int64(coseKeyX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, nil, errors.New("invalid RS256 credential public key")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, alg, rest, nil
+	default:
+		return nil, 0, nil, errors.Errorf("unsupported credential key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verifySignature verifies a WebAuthn signature made with the given key and
+// COSE algorithm.
+func verifySignature(pub crypto.PublicKey, alg int64, message, sig []byte) error {
+	switch alg {
+	case AlgES256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("ES256 signature requires an ECDSA key")
+		}
+		var esig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sig, &esig); err != nil || len(rest) > 0 {
+			return errors.New("invalid ES256 signature")
+		}
+		sum := sha256.Sum256(message)
+		if !ecdsa.Verify(key, sum[:], esig.R, esig.S) {
+			return errors.New("invalid ES256 signature")
+		}
+		return nil
+	case AlgEdDSA:
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("EdDSA signature requires an Ed25519 key")
+		}
+		if !ed25519.Verify(key, message, sig) {
+			return errors.New("invalid EdDSA signature")
+		}
+		return nil
+	case AlgRS256:
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 signature requires an RSA key")
+		}
+		sum := sha256.Sum256(message)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+			return errors.New("invalid RS256 signature")
+		}
+		return nil
+	default:
+		return errors.Errorf("unsupported signature algorithm %d", alg)
+	}
+}
+
+// parsePublicKey parses a stored public key.
+func parsePublicKey(der []byte) (crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing credential public key")
+	}
+	return pub, nil
+}
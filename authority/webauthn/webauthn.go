@@ -0,0 +1,453 @@
+// Package webauthn implements the relying party side of the WebAuthn
+// registration and authentication ceremonies. It supports the "none" and
+// "packed" attestation formats and the ES256, EdDSA and RS256 credential
+// keys, the attestation certificates are not validated against a metadata
+// service.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Ceremony types in the client data.
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// Attestation formats.
+const (
+	// FormatNone is the format used when the authenticator does not provide
+	// an attestation.
+	FormatNone = "none"
+	// FormatPacked is the WebAuthn optimized attestation format.
+	FormatPacked = "packed"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// Bytes is a byte slice encoded in JSON as base64url without padding, the
+// encoding used by the browsers for the WebAuthn binary values.
+type Bytes []byte
+
+// MarshalJSON implements the json.Marshaler interface.
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Padded values are
+// also accepted.
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "error decoding base64url value")
+	}
+	v, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return errors.Wrap(err, "error decoding base64url value")
+	}
+	*b = v
+	return nil
+}
+
+// RelyingParty is the configuration of the relying party that verifies the
+// ceremonies.
+type RelyingParty struct {
+	// ID is the relying party id, the domain of the origins.
+	ID string
+	// Origins are the allowed origins of the client data.
+	Origins []string
+	// RequireUserVerification requires the authenticator to verify the user,
+	// with a PIN or a biometric, in addition to the user presence.
+	RequireUserVerification bool
+}
+
+// Credential is a registered credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	Algorithm int64
+	SignCount uint32
+	Format    string
+}
+
+// AttestationResponse is the AuthenticatorAttestationResponse of a new
+// credential.
+type AttestationResponse struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AttestationObject Bytes `json:"attestationObject"`
+}
+
+// CredentialCreationResponse is the PublicKeyCredential returned by
+// navigator.credentials.create().
+type CredentialCreationResponse struct {
+	ID       string              `json:"id"`
+	RawID    Bytes               `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse is the AuthenticatorAssertionResponse of an
+// authentication.
+type AssertionResponse struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle,omitempty"`
+}
+
+// CredentialAssertionResponse is the PublicKeyCredential returned by
+// navigator.credentials.get().
+type CredentialAssertionResponse struct {
+	ID       string            `json:"id"`
+	RawID    Bytes             `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// collectedClientData is the client data signed by the authenticator.
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is the parsed authenticator data.
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    interface{}
+	Algorithm    int64
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+	ad := &authenticatorData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+	if ad.Flags&flagAttestedCredData != 0 {
+		// aaguid(16) || credentialIdLength(2) || credentialId || publicKey
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < n {
+			return nil, errors.New("attested credential data is too short")
+		}
+		ad.CredentialID, rest = rest[:n], rest[n:]
+		var err error
+		if ad.PublicKey, ad.Algorithm, rest, err = parseCOSEKey(rest); err != nil {
+			return nil, err
+		}
+	}
+	if ad.Flags&flagExtensionData != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return nil, errors.Wrap(err, "error decoding authenticator extensions")
+		}
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("authenticator data has trailing bytes")
+	}
+	return ad, nil
+}
+
+// verifyClientData checks the type, challenge and origin of the client data.
+func (rp *RelyingParty) verifyClientData(b []byte, typ string, challenge []byte) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(b, &cd); err != nil {
+		return errors.Wrap(err, "error decoding client data")
+	}
+	if cd.Type != typ {
+		return errors.Errorf("client data type %s is not %s", cd.Type, typ)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return errors.New("client data challenge does not match")
+	}
+	if cd.CrossOrigin {
+		return errors.New("cross-origin ceremonies are not allowed")
+	}
+	for _, o := range rp.Origins {
+		if cd.Origin == o {
+			return nil
+		}
+	}
+	return errors.Errorf("origin %s is not allowed", cd.Origin)
+}
+
+// verifyAuthenticatorData checks the relying party id hash and the user
+// presence and verification flags.
+func (rp *RelyingParty) verifyAuthenticatorData(ad *authenticatorData) error {
+	sum := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.RPIDHash, sum[:]) {
+		return errors.New("authenticator data relying party id does not match")
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return errors.New("user presence is required")
+	}
+	if rp.RequireUserVerification && ad.Flags&flagUserVerified == 0 {
+		return errors.New("user verification is required")
+	}
+	return nil
+}
+
+// VerifyRegistration verifies the response of a registration ceremony for
+// the given challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *CredentialCreationResponse) (*Credential, error) {
+	if resp == nil || resp.Type != "public-key" {
+		return nil, errors.New("credential type must be public-key")
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding attestation object")
+	}
+	obj, ok := v.(map[interface{}]interface{})
+	if !ok || len(rest) > 0 {
+		return nil, errors.New("invalid attestation object")
+	}
+	format, _ := obj["fmt"].(string)
+	stmt, _ := obj["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := obj["authData"].([]byte)
+	if stmt == nil || rawAuthData == nil {
+		return nil, errors.New("invalid attestation object")
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.Flags&flagAttestedCredData == 0 {
+		return nil, errors.New("authenticator data does not include the credential")
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, ad.CredentialID) {
+		return nil, errors.New("credential id does not match the authenticator data")
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	switch format {
+	case FormatNone:
+		if len(stmt) != 0 {
+			return nil, errors.New("none attestation statement must be empty")
+		}
+	case FormatPacked:
+		if err := verifyPacked(stmt, ad, append(append([]byte{}, rawAuthData...), clientDataHash[:]...)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unsupported attestation format %s", format)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(ad.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling credential public key")
+	}
+	return &Credential{
+		ID:        ad.CredentialID,
+		PublicKey: der,
+		Algorithm: ad.Algorithm,
+		SignCount: ad.SignCount,
+		Format:    format,
+	}, nil
+}
+
+// verifyPacked verifies a packed attestation statement. With an attestation
+// certificate the statement is signed by its key, otherwise it is a self
+// attestation signed by the credential key.
+func verifyPacked(stmt map[interface{}]interface{}, ad *authenticatorData, message []byte) error {
+	alg, _ := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+	if sig == nil {
+		return errors.New("packed attestation statement does not have a signature")
+	}
+	x5c, ok := stmt["x5c"].([]interface{})
+	if !ok {
+		if alg != ad.Algorithm {
+			return errors.New("packed self attestation algorithm does not match the credential")
+		}
+		return errors.Wrap(verifySignature(ad.PublicKey, alg, message, sig), "error verifying packed attestation")
+	}
+	if len(x5c) == 0 {
+		return errors.New("packed attestation statement has an empty x5c")
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return errors.Wrap(err, "error parsing attestation certificate")
+	}
+	return errors.Wrap(verifySignature(cert.PublicKey, alg, message, sig), "error verifying packed attestation")
+}
+
+// VerifyAssertion verifies the response of an authentication ceremony for
+// the given challenge and registered credential, and returns the new
+// signature counter of the credential.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred *Credential, resp *CredentialAssertionResponse) (uint32, error) {
+	if resp == nil || resp.Type != "public-key" {
+		return 0, errors.New("credential type must be public-key")
+	}
+	if !bytes.Equal(resp.RawID, cred.ID) {
+		return 0, errors.New("credential id does not match")
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, typeGet, challenge); err != nil {
+		return 0, err
+	}
+	ad, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	pub, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	message := append(append([]byte{}, resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(pub, cred.Algorithm, message, resp.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// A counter that does not increase is a sign of a cloned authenticator.
+	// Authenticators without a counter always return 0.
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return 0, errors.New("signature counter did not increase, the authenticator might be cloned")
+	}
+	return ad.SignCount, nil
+}
+
+// RelyingPartyEntity is the relying party in the creation options.
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is the user in the creation options.
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is a credential type and algorithm supported by the
+// relying party.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies a registered credential.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// AuthenticatorSelection are the requirements of the authenticator.
+type AuthenticatorSelection struct {
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions are the PublicKeyCredentialCreationOptions passed to
+// navigator.credentials.create().
+type CreationOptions struct {
+	RP                     RelyingPartyEntity      `json:"rp"`
+	User                   UserEntity              `json:"user"`
+	Challenge              Bytes                   `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter   `json:"pubKeyCredParams"`
+	Timeout                int64                   `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor  `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection *AuthenticatorSelection `json:"authenticatorSelection,omitempty"`
+	Attestation            string                  `json:"attestation,omitempty"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions passed to
+// navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// userVerification returns the user verification requirement of the
+// options.
+func (rp *RelyingParty) userVerification() string {
+	if rp.RequireUserVerification {
+		return "required"
+	}
+	return "discouraged"
+}
+
+// NewCreationOptions returns the options of a registration ceremony. The
+// registered credentials are excluded to prevent registering the same
+// authenticator twice.
+func (rp *RelyingParty) NewCreationOptions(name string, user UserEntity, challenge []byte, timeoutMillis int64, registered [][]byte) *CreationOptions {
+	opts := &CreationOptions{
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: name},
+		User:      user,
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout: timeoutMillis,
+		AuthenticatorSelection: &AuthenticatorSelection{
+			UserVerification: rp.userVerification(),
+		},
+		Attestation: "direct",
+	}
+	for _, id := range registered {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return opts
+}
+
+// NewRequestOptions returns the options of an authentication ceremony with
+// one of the given credentials.
+func (rp *RelyingParty) NewRequestOptions(challenge []byte, timeoutMillis int64, allowed [][]byte) *RequestOptions {
+	opts := &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeoutMillis,
+		RPID:             rp.ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: rp.userVerification(),
+	}
+	for _, id := range allowed {
+		opts.AllowCredentials = append(opts.AllowCredentials, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return opts
+}
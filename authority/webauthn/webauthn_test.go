@@ -0,0 +1,302 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+// cborPair is a key-value pair of an encoded CBOR map, the pairs keep the
+// order used by the authenticators.
+type cborPair struct {
+	k, v interface{}
+}
+
+type cborMapItems []cborPair
+
+func cborHeader(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		b := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	default:
+		b := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+}
+
+func encodeCBOR(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHeader(cborNegative, uint64(-1-v))
+		}
+		return cborHeader(cborUnsigned, uint64(v))
+	case int64:
+		return encodeCBOR(int(v))
+	case []byte:
+		return append(cborHeader(cborBytes, uint64(len(v))), v...)
+	case string:
+		return append(cborHeader(cborText, uint64(len(v))), v...)
+	case []interface{}:
+		b := cborHeader(cborArray, uint64(len(v)))
+		for _, item := range v {
+			b = append(b, encodeCBOR(item)...)
+		}
+		return b
+	case cborMapItems:
+		b := cborHeader(cborMap, uint64(len(v)))
+		for _, p := range v {
+			b = append(b, encodeCBOR(p.k)...)
+			b = append(b, encodeCBOR(p.v)...)
+		}
+		return b
+	default:
+		panic("unsupported type")
+	}
+}
+
+// testAuthenticator is a software authenticator with a P-256 credential.
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	return &testAuthenticator{key: key, id: []byte("credential-id")}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	x := a.key.X.Bytes()
+	y := a.key.Y.Bytes()
+	pad := func(b []byte) []byte {
+		return append(make([]byte, 32-len(b)), b...)
+	}
+	return encodeCBOR(cborMapItems{
+		{coseKeyType, coseKeyTypeEC2},
+		{coseKeyAlg, int(AlgES256)},
+		{coseKeyCurve, coseCurveP256},
+		{coseKeyX, pad(x)},
+		{coseKeyY, pad(y)},
+	})
+}
+
+func (a *testAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	sum := sha256.Sum256([]byte(rpID))
+	b := append([]byte{}, sum[:]...)
+	b = append(b, flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:], a.signCount)
+	if attested {
+		b = append(b, make([]byte, 16)...)
+		b = append(b, byte(len(a.id)>>8), byte(len(a.id)))
+		b = append(b, a.id...)
+		b = append(b, a.coseKey()...)
+	}
+	return b
+}
+
+func (a *testAuthenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	t.Helper()
+	sum := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), sum[:]...))
+	sig, err := a.key.Sign(rand.Reader, digest[:], nil)
+	assert.FatalError(t, err)
+	return sig
+}
+
+func clientData(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	t.Helper()
+	b, err := json.Marshal(collectedClientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+	assert.FatalError(t, err)
+	return b
+}
+
+func (a *testAuthenticator) create(t *testing.T, rpID, format string, flags byte, challenge []byte, origin string) *CredentialCreationResponse {
+	t.Helper()
+	cd := clientData(t, typeCreate, challenge, origin)
+	authData := a.authData(rpID, flags|flagAttestedCredData, true)
+	stmt := cborMapItems{}
+	if format == FormatPacked {
+		stmt = cborMapItems{
+			{"alg", int(AlgES256)},
+			{"sig", a.sign(t, authData, cd)},
+		}
+	}
+	return &CredentialCreationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.id),
+		RawID: a.id,
+		Type:  "public-key",
+		Response: AttestationResponse{
+			ClientDataJSON: cd,
+			AttestationObject: encodeCBOR(cborMapItems{
+				{"fmt", format},
+				{"attStmt", stmt},
+				{"authData", authData},
+			}),
+		},
+	}
+}
+
+func (a *testAuthenticator) get(t *testing.T, rpID string, flags byte, challenge []byte, origin string) *CredentialAssertionResponse {
+	t.Helper()
+	cd := clientData(t, typeGet, challenge, origin)
+	authData := a.authData(rpID, flags, false)
+	return &CredentialAssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.id),
+		RawID: a.id,
+		Type:  "public-key",
+		Response: AssertionResponse{
+			ClientDataJSON:    cd,
+			AuthenticatorData: authData,
+			Signature:         a.sign(t, authData, cd),
+		},
+	}
+}
+
+func TestBytes_JSON(t *testing.T) {
+	b, err := json.Marshal(Bytes{0xfb, 0xff})
+	assert.FatalError(t, err)
+	assert.Equals(t, `"-_8"`, string(b))
+
+	var v Bytes
+	assert.FatalError(t, json.Unmarshal([]byte(`"-_8="`), &v))
+	assert.Equals(t, Bytes{0xfb, 0xff}, v)
+	assert.Error(t, json.Unmarshal([]byte(`"+/8"`), &v))
+}
+
+func Test_decodeCBOR(t *testing.T) {
+	v, rest, err := decodeCBOR(append(encodeCBOR(cborMapItems{
+		{"a", []interface{}{1, -2, []byte("b")}},
+		{3, "c"},
+	}), 0xff))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte{0xff}, rest)
+	assert.Equals(t, map[interface{}]interface{}{
+		"a":      []interface{}{int64(1), int64(-2), []byte("b")},
+		int64(3): "c",
+	}, v)
+
+	for name, b := range map[string][]byte{
+		"truncated":  {0x43, 0x01},
+		"indefinite": {0x5f},
+		"tag":        {0xc0, 0x01},
+		"duplicated": encodeCBOR(cborMapItems{{1, 1}, {1, 2}}),
+		"length":     {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := decodeCBOR(b)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRelyingParty_VerifyRegistration(t *testing.T) {
+	rp := &RelyingParty{ID: "ca.example.com", Origins: []string{"https://ca.example.com"}}
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+	auth := newTestAuthenticator(t)
+
+	tests := []struct {
+		name    string
+		rp      *RelyingParty
+		resp    *CredentialCreationResponse
+		wantErr bool
+	}{
+		{"ok none", rp, auth.create(t, rp.ID, FormatNone, flagUserPresent, challenge, "https://ca.example.com"), false},
+		{"ok packed", rp, auth.create(t, rp.ID, FormatPacked, flagUserPresent, challenge, "https://ca.example.com"), false},
+		{"fail format", rp, auth.create(t, rp.ID, "fido-u2f", flagUserPresent, challenge, "https://ca.example.com"), true},
+		{"fail challenge", rp, auth.create(t, rp.ID, FormatNone, flagUserPresent, []byte("foo"), "https://ca.example.com"), true},
+		{"fail origin", rp, auth.create(t, rp.ID, FormatNone, flagUserPresent, challenge, "https://evil.example.com"), true},
+		{"fail rpID", rp, auth.create(t, "evil.example.com", FormatNone, flagUserPresent, challenge, "https://ca.example.com"), true},
+		{"fail user presence", rp, auth.create(t, rp.ID, FormatNone, 0, challenge, "https://ca.example.com"), true},
+		{"fail user verification", &RelyingParty{ID: rp.ID, Origins: rp.Origins, RequireUserVerification: true},
+			auth.create(t, rp.ID, FormatNone, flagUserPresent, challenge, "https://ca.example.com"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := tt.rp.VerifyRegistration(challenge, tt.resp)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RelyingParty.VerifyRegistration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				assert.Equals(t, auth.id, cred.ID)
+				assert.Equals(t, AlgES256, cred.Algorithm)
+				pub, err := parsePublicKey(cred.PublicKey)
+				assert.FatalError(t, err)
+				assert.Equals(t, &auth.key.PublicKey, pub)
+			}
+		})
+	}
+}
+
+func TestRelyingParty_VerifyAssertion(t *testing.T) {
+	rp := &RelyingParty{ID: "ca.example.com", Origins: []string{"https://ca.example.com"}}
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+	auth := newTestAuthenticator(t)
+	cred, err := rp.VerifyRegistration(challenge, auth.create(t, rp.ID, FormatNone, flagUserPresent, challenge, "https://ca.example.com"))
+	assert.FatalError(t, err)
+
+	// Valid assertion
+	auth.signCount = 1
+	n, err := rp.VerifyAssertion(challenge, cred, auth.get(t, rp.ID, flagUserPresent, challenge, "https://ca.example.com"))
+	assert.FatalError(t, err)
+	assert.Equals(t, uint32(1), n)
+	cred.SignCount = n
+
+	// Replayed counter
+	_, err = rp.VerifyAssertion(challenge, cred, auth.get(t, rp.ID, flagUserPresent, challenge, "https://ca.example.com"))
+	assert.Error(t, err)
+
+	auth.signCount = 2
+	tests := []struct {
+		name string
+		resp *CredentialAssertionResponse
+	}{
+		{"challenge", auth.get(t, rp.ID, flagUserPresent, []byte("foo"), "https://ca.example.com")},
+		{"origin", auth.get(t, rp.ID, flagUserPresent, challenge, "https://evil.example.com")},
+		{"user presence", auth.get(t, rp.ID, 0, challenge, "https://ca.example.com")},
+		{"signature", func() *CredentialAssertionResponse {
+			resp := auth.get(t, rp.ID, flagUserPresent, challenge, "https://ca.example.com")
+			resp.Response.Signature = newTestAuthenticator(t).sign(t, resp.Response.AuthenticatorData, resp.Response.ClientDataJSON)
+			return resp
+		}()},
+		{"credential", func() *CredentialAssertionResponse {
+			resp := auth.get(t, rp.ID, flagUserPresent, challenge, "https://ca.example.com")
+			resp.RawID = []byte("other")
+			return resp
+		}()},
+		{"type", func() *CredentialAssertionResponse {
+			resp := auth.get(t, rp.ID, flagUserPresent, challenge, "https://ca.example.com")
+			resp.Response.ClientDataJSON = clientData(t, typeCreate, challenge, "https://ca.example.com")
+			return resp
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rp.VerifyAssertion(challenge, cred, tt.resp); err == nil {
+				t.Error("RelyingParty.VerifyAssertion() error = nil, want error")
+			}
+		})
+	}
+}
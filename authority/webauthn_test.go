@@ -0,0 +1,135 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/authority/webauthn"
+	"go.step.sm/linkedca"
+)
+
+func TestAuthority_WebAuthn(t *testing.T) {
+	alice := &linkedca.Admin{Id: "alice-id", Subject: "alice@example.com", ProvisionerId: "prov-id", Type: linkedca.Admin_ADMIN}
+	bob := &linkedca.Admin{Id: "bob-id", Subject: "bob@example.com", Type: linkedca.Admin_SUPER_ADMIN}
+
+	a := testAuthority(t)
+
+	// WebAuthn disabled
+	assert.False(t, a.IsWebAuthnRequired())
+	assert.FatalError(t, a.AuthorizeWebAuthnSession(alice, ""))
+	_, err := a.BeginWebAuthnRegistration(alice, "", "")
+	assert.NotNil(t, err)
+
+	a.config.AuthorityConfig.WebAuthn = &config.WebAuthnConfig{RPID: "ca.example.com"}
+	assert.True(t, a.IsWebAuthnRequired())
+	assert.FatalError(t, a.initWebAuthn())
+
+	// Mutating requests require a session
+	assert.NotNil(t, a.AuthorizeWebAuthnSession(nil, "token"))
+	assert.NotNil(t, a.AuthorizeWebAuthnSession(alice, ""))
+	assert.NotNil(t, a.AuthorizeWebAuthnSession(alice, "missing"))
+
+	// The first security key requires an enrollment code created by a super
+	// administrator, the bootstrap code is only valid for super
+	// administrators
+	a.webAuthnMutex.Lock()
+	store, err := a.getWebAuthnStore()
+	assert.FatalError(t, err)
+	bootstrap, err := a.newWebAuthnEnrollment(store, webAuthnBootstrapAdmin)
+	assert.FatalError(t, err)
+	a.webAuthnMutex.Unlock()
+	_, err = a.BeginWebAuthnRegistration(alice, "", "")
+	assert.NotNil(t, err)
+	_, err = a.BeginWebAuthnRegistration(alice, "", bootstrap.Code)
+	assert.NotNil(t, err)
+	_, err = a.BeginWebAuthnRegistration(bob, "", bootstrap.Code)
+	assert.FatalError(t, err)
+	_, err = a.CreateWebAuthnEnrollment(alice, alice.Id)
+	assert.NotNil(t, err)
+	_, err = a.CreateWebAuthnEnrollment(bob, "missing")
+	assert.NotNil(t, err)
+	assert.FatalError(t, a.admins.Store(alice, &provisioner.JWK{ID: "prov-id", Name: "prov"}))
+	enrollment, err := a.CreateWebAuthnEnrollment(bob, alice.Id)
+	assert.FatalError(t, err)
+	assert.Equals(t, alice.Id, enrollment.AdminID)
+	_, err = a.BeginWebAuthnRegistration(alice, "", "wrong")
+	assert.NotNil(t, err)
+
+	opts, err := a.BeginWebAuthnRegistration(alice, "", enrollment.Code)
+	assert.FatalError(t, err)
+	assert.Equals(t, "ca.example.com", opts.RP.ID)
+	assert.Equals(t, webauthn.Bytes("alice-id"), opts.User.ID)
+	assert.Len(t, 32, opts.Challenge)
+	assert.Len(t, 0, opts.ExcludeCredentials)
+
+	// Challenges are single use
+	_, err = a.FinishWebAuthnRegistration(alice, "", enrollment.Code, "yubikey", &webauthn.CredentialCreationResponse{Type: "public-key"})
+	assert.NotNil(t, err)
+	_, err = a.FinishWebAuthnRegistration(alice, "", enrollment.Code, "yubikey", &webauthn.CredentialCreationResponse{Type: "public-key"})
+	assert.NotNil(t, err)
+
+	// Enrollment codes expire
+	a.webAuthnMutex.Lock()
+	c, err := store.getChallenge(webAuthnCeremonyKey(webAuthnEnrollment, alice.Id))
+	assert.FatalError(t, err)
+	c.ExpiresAt = time.Now().Add(-time.Minute)
+	assert.FatalError(t, store.setChallenge(c))
+	a.webAuthnMutex.Unlock()
+	_, err = a.BeginWebAuthnRegistration(alice, "", enrollment.Code)
+	assert.NotNil(t, err)
+
+	// Assertions require a registered security key
+	_, err = a.BeginWebAuthnAssertion(alice)
+	assert.NotNil(t, err)
+
+	a.webAuthnMutex.Lock()
+	assert.FatalError(t, store.setCredential(&WebAuthnCredential{
+		ID: "Y3JlZGVudGlhbC1pZA", AdminID: alice.Id, Subject: alice.Subject, Name: "yubikey", CreatedAt: time.Now(),
+	}))
+	now := time.Now()
+	for _, s := range []*webAuthnChallenge{
+		{Key: webAuthnSessionKey("alice-session"), Type: webAuthnSession, AdminID: alice.Id, ExpiresAt: now.Add(time.Minute)},
+		{Key: webAuthnSessionKey("alice-expired"), Type: webAuthnSession, AdminID: alice.Id, ExpiresAt: now.Add(-time.Minute)},
+		{Key: webAuthnSessionKey("bob-session"), Type: webAuthnSession, AdminID: bob.Id, ExpiresAt: now.Add(time.Minute)},
+	} {
+		assert.FatalError(t, store.setChallenge(s))
+	}
+	a.webAuthnMutex.Unlock()
+
+	// Sessions are bound to the administrator and expire
+	assert.FatalError(t, a.AuthorizeWebAuthnSession(alice, "alice-session"))
+	assert.NotNil(t, a.AuthorizeWebAuthnSession(alice, "alice-expired"))
+	assert.NotNil(t, a.AuthorizeWebAuthnSession(alice, "bob-session"))
+	assert.FatalError(t, a.AuthorizeWebAuthnSession(bob, "bob-session"))
+
+	// Additional security keys require a session
+	_, err = a.BeginWebAuthnRegistration(alice, "", "")
+	assert.NotNil(t, err)
+	opts, err = a.BeginWebAuthnRegistration(alice, "alice-session", "")
+	assert.FatalError(t, err)
+	assert.Equals(t, []webauthn.CredentialDescriptor{{Type: "public-key", ID: webauthn.Bytes("credential-id")}}, opts.ExcludeCredentials)
+
+	ropts, err := a.BeginWebAuthnAssertion(alice)
+	assert.FatalError(t, err)
+	assert.Equals(t, "ca.example.com", ropts.RPID)
+	assert.Len(t, 1, ropts.AllowCredentials)
+	_, err = a.FinishWebAuthnAssertion(alice, &webauthn.CredentialAssertionResponse{Type: "public-key", RawID: []byte("credential-id")})
+	assert.NotNil(t, err)
+
+	credentials, err := a.GetWebAuthnCredentials(alice)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, credentials)
+	credentials, err = a.GetWebAuthnCredentials(bob)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, credentials)
+
+	// Super administrators can remove the keys of other administrators
+	assert.NotNil(t, a.DeleteWebAuthnCredential(alice, "missing"))
+	assert.FatalError(t, a.DeleteWebAuthnCredential(bob, "Y3JlZGVudGlhbC1pZA"))
+	credentials, err = a.GetWebAuthnCredentials(alice)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, credentials)
+}
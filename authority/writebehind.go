@@ -0,0 +1,269 @@
+package authority
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/spool"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// Kinds of the records in the write-behind spool.
+const (
+	spoolCertificate        = "certificate"
+	spoolRenewedCertificate = "renewedCertificate"
+	spoolConfigChange       = "configChange"
+)
+
+var errWriteBehindFull = errors.New("write-behind spool is full")
+
+// spooledCertificate is the spool record of an issued or renewed certificate.
+type spooledCertificate struct {
+	OldCertificate []byte   `json:"oldCertificate,omitempty"`
+	Chain          [][]byte `json:"chain"`
+}
+
+func newSpooledCertificate(oldCert *x509.Certificate, fullchain []*x509.Certificate) *spooledCertificate {
+	s := new(spooledCertificate)
+	if oldCert != nil {
+		s.OldCertificate = oldCert.Raw
+	}
+	for _, crt := range fullchain {
+		s.Chain = append(s.Chain, crt.Raw)
+	}
+	return s
+}
+
+// parse returns the old certificate, if any, and the chain of the record.
+func (s *spooledCertificate) parse() (*x509.Certificate, []*x509.Certificate, error) {
+	var oldCert *x509.Certificate
+	if len(s.OldCertificate) > 0 {
+		crt, err := x509.ParseCertificate(s.OldCertificate)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error parsing certificate")
+		}
+		oldCert = crt
+	}
+	if len(s.Chain) == 0 {
+		return nil, nil, errors.New("spooled certificate chain is empty")
+	}
+	fullchain := make([]*x509.Certificate, len(s.Chain))
+	for i, b := range s.Chain {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error parsing certificate")
+		}
+		fullchain[i] = crt
+	}
+	return oldCert, fullchain, nil
+}
+
+// writeBehind writes records to a durable local spool and, in the background,
+// to the database, so a slow database does not add latency to the requests.
+// Once the spool reaches the sync threshold, the requests wait until the
+// spool is flushed, and once it reaches the maximum, they fail.
+type writeBehind struct {
+	spool         *spool.Spool
+	interval      time.Duration
+	syncThreshold int
+	maxPending    int
+	do            func(func() error) error
+	handlers      map[string]func(json.RawMessage) error
+	mu            sync.Mutex
+	signal        chan struct{}
+	done          chan struct{}
+	stopped       chan struct{}
+}
+
+// initWriteBehind opens the write-behind spool if it's configured. The records
+// are written to the database once the authority has been initialized.
+func (a *Authority) initWriteBehind() error {
+	c := a.config.WriteBehind
+	if c == nil || a.writeBehind != nil {
+		return nil
+	}
+	s, err := spool.Open(c.Directory)
+	if err != nil {
+		return err
+	}
+	w := &writeBehind{
+		spool:         s,
+		interval:      c.GetFlushInterval(),
+		syncThreshold: c.GetSyncThreshold(),
+		maxPending:    c.GetMaxPending(),
+		do:            a.degraded.do,
+		handlers:      make(map[string]func(json.RawMessage) error),
+	}
+	w.handle(spoolCertificate, func(data json.RawMessage) error {
+		var s spooledCertificate
+		if err := json.Unmarshal(data, &s); err != nil {
+			return errors.Wrap(err, "error unmarshaling spooled certificate")
+		}
+		_, fullchain, err := s.parse()
+		if err != nil {
+			return err
+		}
+		return a.storeCertificate(fullchain)
+	})
+	w.handle(spoolRenewedCertificate, func(data json.RawMessage) error {
+		var s spooledCertificate
+		if err := json.Unmarshal(data, &s); err != nil {
+			return errors.Wrap(err, "error unmarshaling spooled certificate")
+		}
+		oldCert, fullchain, err := s.parse()
+		if err != nil {
+			return err
+		}
+		return a.storeRenewedCertificate(oldCert, fullchain)
+	})
+	a.writeBehind = w
+	return nil
+}
+
+// handle registers the function that writes the records of the given kind. It
+// must be called before the writes start. The records without a function are
+// kept in the spool.
+func (w *writeBehind) handle(kind string, fn func(json.RawMessage) error) {
+	w.handlers[kind] = fn
+}
+
+// start starts the goroutine that writes the spooled records, including the
+// ones left by a previous run.
+func (w *writeBehind) start() {
+	w.signal = make(chan struct{}, 1)
+	w.done = make(chan struct{})
+	w.stopped = make(chan struct{})
+	w.wake()
+	go w.run()
+}
+
+// wake wakes up the goroutine writing the records.
+func (w *writeBehind) wake() {
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *writeBehind) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		case <-w.signal:
+		}
+		if err := w.flush(); err != nil {
+			log.Printf("write-behind: %v", err)
+		}
+	}
+}
+
+// Stop stops the background writes, and makes a last attempt to write the
+// spooled records. The records that cannot be written are kept in the spool
+// for the next run.
+func (w *writeBehind) Stop() {
+	if w.done != nil {
+		close(w.done)
+		<-w.stopped
+	}
+	if err := w.flush(); err != nil {
+		log.Printf("write-behind: %d records left in the spool: %v", w.spool.Len(), err)
+	}
+}
+
+// flush writes the spooled records in order. It stops at the first failure,
+// so an unavailable database is not called once per record.
+func (w *writeBehind) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, seq := range w.spool.Seqs() {
+		e, err := w.spool.Get(seq)
+		if err != nil {
+			log.Printf("write-behind: %v", err)
+			continue
+		}
+		fn, ok := w.handlers[e.Kind]
+		if !ok {
+			continue
+		}
+		if err := w.do(func() error { return fn(e.Data) }); err != nil && err != db.ErrNotImplemented {
+			return errors.Wrapf(err, "error writing spool record %d", seq)
+		}
+		if err := w.spool.Remove(seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// push adds a record to the spool. Once the spool reaches the sync threshold
+// push waits until the spool is flushed, and once it reaches the maximum push
+// fails.
+func (w *writeBehind) push(kind string, v interface{}) error {
+	n := w.spool.Len()
+	if n >= w.maxPending {
+		return errWriteBehindFull
+	}
+	if _, err := w.spool.Push(kind, v); err != nil {
+		return err
+	}
+	if n+1 < w.syncThreshold {
+		w.wake()
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		log.Printf("write-behind: %v", err)
+	}
+	return nil
+}
+
+// fullError returns the error of the requests rejected by a full spool.
+func (w *writeBehind) fullError() error {
+	return errs.NewErr(http.StatusServiceUnavailable, errWriteBehindFull,
+		errs.WithMessage("The certificate authority is overloaded. Please try again later."),
+		errs.WithRetryAfter(w.interval))
+}
+
+// checkWriteBehind returns a 503 Service Unavailable error if the spool is
+// full, so a certificate is not signed if it cannot be recorded.
+func (a *Authority) checkWriteBehind() error {
+	if a.writeBehind == nil || a.writeBehind.spool.Len() < a.writeBehind.maxPending {
+		return nil
+	}
+	return a.writeBehind.fullError()
+}
+
+// writeOrSpool adds a record to the write-behind spool if it's enabled, or
+// calls write otherwise. If the spool cannot be written, write is called.
+func (a *Authority) writeOrSpool(kind string, v interface{}, write func() error) error {
+	if a.writeBehind == nil {
+		return write()
+	}
+	switch err := a.writeBehind.push(kind, v); {
+	case err == nil:
+		return nil
+	case err == errWriteBehindFull:
+		return a.writeBehind.fullError()
+	default:
+		log.Printf("write-behind: %v", err)
+		return write()
+	}
+}
+
+// storeIssuedCertificate stores a new certificate, through the write-behind
+// spool if it's enabled.
+func (a *Authority) storeIssuedCertificate(fullchain []*x509.Certificate) error {
+	return a.writeOrSpool(spoolCertificate, newSpooledCertificate(nil, fullchain), func() error {
+		return a.degraded.do(func() error { return a.storeCertificate(fullchain) })
+	})
+}
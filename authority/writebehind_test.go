@@ -0,0 +1,83 @@
+package authority
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+func TestAuthority_writeBehind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := testAuthority(t)
+	var down bool
+	var stored []string
+	a.db = &db.MockAuthDB{
+		MIsRevoked: func(string) (bool, error) {
+			return false, nil
+		},
+		MStoreCertificate: func(crt *x509.Certificate) error {
+			if down {
+				return errors.New("connection refused")
+			}
+			stored = append(stored, crt.SerialNumber.String())
+			return nil
+		},
+	}
+	a.config.WriteBehind = &config.WriteBehindConfig{Directory: dir}
+	assert.FatalError(t, a.initWriteBehind())
+	w := a.writeBehind
+
+	now := time.Now().UTC()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-7*time.Minute), now),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	// The renewed certificate is written in the background
+	certChain, err := a.Renew(cert)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, stored)
+	assert.Equals(t, 1, w.spool.Len())
+	assert.FatalError(t, w.flush())
+	assert.Equals(t, []string{certChain[0].SerialNumber.String()}, stored)
+	assert.Equals(t, 0, w.spool.Len())
+
+	// The records survive a restart while the database is unavailable
+	down = true
+	assert.FatalError(t, a.storeIssuedCertificate([]*x509.Certificate{cert}))
+	assert.NotNil(t, w.flush())
+	a.writeBehind = nil
+	assert.FatalError(t, a.initWriteBehind())
+	w = a.writeBehind
+	assert.Equals(t, 1, w.spool.Len())
+
+	// The requests fail once the spool is full
+	w.maxPending = 1
+	err = a.checkWriteBehind()
+	sc, ok := err.(errs.StatusCoder)
+	assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+	assert.Equals(t, http.StatusServiceUnavailable, sc.StatusCode())
+	_, err = a.Renew(cert)
+	assert.NotNil(t, err)
+
+	// The requests wait for the spool once the sync threshold is reached
+	down = false
+	w.maxPending = 10
+	w.syncThreshold = 1
+	assert.FatalError(t, a.storeIssuedCertificate([]*x509.Certificate{cert}))
+	assert.Equals(t, 0, w.spool.Len())
+	assert.Equals(t, []string{certChain[0].SerialNumber.String(), cert.SerialNumber.String(), cert.SerialNumber.String()}, stored)
+}
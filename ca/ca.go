@@ -5,9 +5,11 @@ import (
 	"crypto/x509"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/go-chi/chi"
@@ -18,22 +20,27 @@ import (
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
+	"github.com/smallstep/certificates/authority/breaker"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/monitoring"
 	"github.com/smallstep/certificates/scep"
 	scepAPI "github.com/smallstep/certificates/scep/api"
+	"github.com/smallstep/certificates/sds"
 	"github.com/smallstep/certificates/server"
+	tsaAPI "github.com/smallstep/certificates/tsa/api"
 	"github.com/smallstep/nosql"
 )
 
 type options struct {
-	configFile     string
-	linkedCAToken  string
-	password       []byte
-	issuerPassword []byte
-	database       db.AuthDB
+	configFile      string
+	configOverrides []*config.Override
+	linkedCAToken   string
+	password        []byte
+	issuerPassword  []byte
+	database        db.AuthDB
+	authOptions     []authority.Option
 }
 
 func (o *options) apply(opts []Option) {
@@ -53,6 +60,14 @@ func WithConfigFile(name string) Option {
 	}
 }
 
+// WithConfigOverrides sets the overrides applied to the configuration file
+// when the CA is reloaded.
+func WithConfigOverrides(overrides []*config.Override) Option {
+	return func(o *options) {
+		o.configOverrides = overrides
+	}
+}
+
 // WithPassword sets the given password as the configured password in the CA
 // options.
 func WithPassword(password []byte) Option {
@@ -83,15 +98,31 @@ func WithLinkedCAToken(token string) Option {
 	}
 }
 
+// WithAuthorityOptions adds options used to initialize the authority. They
+// allow applications embedding the CA to set, for example, the key manager,
+// the signers or the event bus programmatically.
+func WithAuthorityOptions(opts ...authority.Option) Option {
+	return func(o *options) {
+		o.authOptions = append(o.authOptions, opts...)
+	}
+}
+
 // CA is the type used to build the complete certificate authority. It builds
 // the HTTP server, set ups the middlewares and the HTTP handlers.
 type CA struct {
-	auth        *authority.Authority
-	config      *config.Config
-	srv         *server.Server
-	insecureSrv *server.Server
-	opts        *options
-	renewer     *TLSRenewer
+	auth            *authority.Authority
+	config          *config.Config
+	srv             *server.Server
+	insecureSrv     *server.Server
+	listenerSrvs    []*server.Server
+	grpcSrv         *grpcServer
+	opts            *options
+	renewer         *TLSRenewer
+	sni             *sniSelector
+	handler         *switchHandler
+	insecure        *switchHandler
+	tlsConfig       *tls.Config
+	acmeValidations *acme.ValidationManager
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -127,6 +158,8 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 		opts = append(opts, authority.WithDatabase(ca.opts.database))
 	}
 
+	opts = append(opts, ca.opts.authOptions...)
+
 	auth, err := authority.New(config, opts...)
 	if err != nil {
 		return nil, err
@@ -145,10 +178,13 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 	insecureMux := chi.NewRouter()
 	insecureHandler := http.Handler(insecureMux)
 
+	// The api, acme and admin endpoints can be served by dedicated listeners
+	routers := newRouters(mux, config.Listeners)
+
 	// Add regular CA api endpoints in / and /1.0
 	routerHandler := api.New(auth)
-	routerHandler.Route(mux)
-	mux.Route("/1.0", func(r chi.Router) {
+	routerHandler.Route(routers.API())
+	routers.API().Route("/1.0", func(r chi.Router) {
 		routerHandler.Route(r)
 	})
 
@@ -169,24 +205,67 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 	if config.DB == nil {
 		acmeDB = nil
 	} else {
-		acmeDB, err = acmeNoSQL.New(auth.GetDatabase().(nosql.DB))
+		acmeOpts := []acmeNoSQL.Option{acmeNoSQL.WithClock(auth.GetClock())}
+		if c := config.AuthorityConfig.ACME.GetNonces(); c != nil {
+			key, err := c.GetKey()
+			if err != nil {
+				return nil, err
+			}
+			acmeOpts = append(acmeOpts, acmeNoSQL.WithNonceKey(key, c.GetMaxAge()))
+		}
+		acmeDB, err = acmeNoSQL.New(auth.GetDatabase().(nosql.DB), acmeOpts...)
 		if err != nil {
 			return nil, errors.Wrap(err, "error configuring ACME DB interface")
 		}
 	}
+	var acmeEgress []*acmeAPI.ValidationEgress
+	for _, e := range config.AuthorityConfig.ACME.GetEgress() {
+		acmeEgress = append(acmeEgress, &acmeAPI.ValidationEgress{
+			Domains:  e.Domains,
+			SourceIP: e.GetSourceIP(),
+			Proxy:    e.GetProxy(),
+			Resolver: e.Resolver,
+		})
+	}
+	acmeChains, err := config.AuthorityConfig.ACME.GetAlternateChains()
+	if err != nil {
+		return nil, err
+	}
+	var acmeWebhook *acme.AccountWebhook
+	if c := config.AuthorityConfig.ACME.GetAccountWebhook(); c != nil {
+		acmeWebhook = &acme.AccountWebhook{
+			URL:      c.URL,
+			Token:    c.Token,
+			Timeout:  c.Timeout.Value(),
+			FailOpen: c.FailOpen,
+			Breaker:  breaker.New("acme-account-webhook", config.CircuitBreaker.GetSettings()),
+		}
+	}
+	ca.acmeValidations = acme.NewValidationManager(
+		config.AuthorityConfig.ACME.GetValidationTimeout(),
+		config.AuthorityConfig.ACME.GetMaxValidationAttempts(),
+	)
 	acmeHandler := acmeAPI.NewHandler(acmeAPI.HandlerOptions{
-		Backdate: *config.AuthorityConfig.Backdate,
-		DB:       acmeDB,
-		DNS:      dns,
-		Prefix:   prefix,
-		CA:       auth,
+		Backdate:          *config.AuthorityConfig.Backdate,
+		DB:                acmeDB,
+		DNS:               dns,
+		Prefix:            prefix,
+		CA:                auth,
+		Egress:            acmeEgress,
+		Resolver:          auth.GetResolver(),
+		MaxJWSPayloadSize: config.RequestLimits.GetMaxJWSPayloadSize(),
+		AlternateChains:   acmeChains,
+		Validations:       ca.acmeValidations,
+		AccountWebhook:    acmeWebhook,
+		ValidationReuse:   config.AuthorityConfig.ACME.GetValidationReuse(),
+		Clock:             auth.GetClock(),
 	})
-	mux.Route("/"+prefix, func(r chi.Router) {
+	routers.ACME().Route("/"+prefix, func(r chi.Router) {
 		acmeHandler.Route(r)
 	})
 	// Use 2.0 because, at the moment, our ACME api is only compatible with v2.0
 	// of the ACME spec.
-	mux.Route("/2.0/"+prefix, func(r chi.Router) {
+	routers.ACME().Route("/2.0/"+prefix, func(r chi.Router) {
 		acmeHandler.Route(r)
 	})
 
@@ -194,13 +273,20 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 	if config.AuthorityConfig.EnableAdmin {
 		adminDB := auth.GetAdminDatabase()
 		if adminDB != nil {
-			adminHandler := adminAPI.NewHandler(auth)
-			mux.Route("/admin", func(r chi.Router) {
+			adminHandler := adminAPI.NewHandler(auth, acmeDB)
+			routers.Admin().Route("/admin", func(r chi.Router) {
 				adminHandler.Route(r)
 			})
 		}
 	}
 
+	// SDS Router, it uses the path expected by Envoy in the REST-JSON
+	// transport.
+	if config.SDS != nil {
+		sdsHandler := sds.NewHandler(auth, config.SDS)
+		sdsHandler.Route(mux)
+	}
+
 	if ca.shouldServeSCEPEndpoints() {
 		scepPrefix := "scep"
 		scepAuthority, err := scep.New(auth, scep.AuthorityOptions{
@@ -231,17 +317,53 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 		})
 	}
 
+	// Time-stamp authority Router, RFC 3161 clients commonly use HTTP, so the
+	// API is also mounted in the insecure mux.
+	if ca.shouldServeTSAEndpoints() {
+		tsaRouterHandler := tsaAPI.New(auth.GetTSAService())
+		insecureMux.Route("/tsa", func(r chi.Router) {
+			tsaRouterHandler.Route(r)
+		})
+		mux.Route("/tsa", func(r chi.Router) {
+			tsaRouterHandler.Route(r)
+		})
+	}
+
 	// helpful routine for logging all routes
 	//dumpRoutes(mux)
 
+	// Middlewares added to the handlers of all the servers
+	var middlewares []func(http.Handler) http.Handler
+
+	// Limit the size of the request bodies
+	middlewares = append(middlewares, api.MaxBodySize(config.RequestLimits.GetMaxBodySize()))
+
+	// Add the client IP used to validate the token confirmation claims
+	middlewares = append(middlewares, api.ClientIP)
+
+	// Add the cache of the roots, federation and ACME directory if configured
+	if config.ResponseCache != nil {
+		cache := api.NewResponseCache(config.ResponseCache.GetMaxAge(), isCacheablePath)
+		middlewares = append(middlewares, cache.Middleware)
+	}
+
+	// Add the error message catalog if configured
+	if catalog := config.Messages.Catalog(); catalog != nil {
+		middlewares = append(middlewares, catalog.Middleware)
+	}
+
+	// Add the CORS, HSTS and custom response headers if configured
+	if config.Headers != nil {
+		middlewares = append(middlewares, config.Headers.Middleware)
+	}
+
 	// Add monitoring if configured
 	if len(config.Monitoring) > 0 {
 		m, err := monitoring.New(config.Monitoring)
 		if err != nil {
 			return nil, err
 		}
-		handler = m.Middleware(handler)
-		insecureHandler = m.Middleware(insecureHandler)
+		middlewares = append(middlewares, m.Middleware)
 	}
 
 	// Add logger if configured
@@ -250,15 +372,36 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 		if err != nil {
 			return nil, err
 		}
-		handler = logger.Middleware(handler)
-		insecureHandler = logger.Middleware(insecureHandler)
+		middlewares = append(middlewares, logger.Middleware)
+	}
+
+	wrap := func(h http.Handler) http.Handler {
+		for _, m := range middlewares {
+			h = m(h)
+		}
+		return h
 	}
+	handler = wrap(handler)
+	insecureHandler = wrap(insecureHandler)
+
+	// Keep the handlers so they can be mounted by applications embedding the
+	// CA, they are swapped on reloads.
+	ca.handler = newSwitchHandler(handler)
+	ca.insecure = newSwitchHandler(insecureHandler)
+	ca.tlsConfig = tlsConfig
 
 	ca.srv = server.New(config.Address, handler, tlsConfig)
+	ca.listenerSrvs = routers.servers(wrap, tlsConfig)
+
+	// Serve the gRPC service if configured, along with the SDS gRPC service
+	// if SDS is enabled.
+	if config.GRPC != nil {
+		ca.grpcSrv = newGRPCServer(config.GRPC.Address, auth, config.SDS, tlsConfig)
+	}
 
 	// only start the insecure server if the insecure address is configured
-	// and, currently, also only when it should serve SCEP endpoints.
-	if ca.shouldServeSCEPEndpoints() && config.InsecureAddress != "" {
+	// and, currently, also only when it should serve SCEP or TSA endpoints.
+	if (ca.shouldServeSCEPEndpoints() || ca.shouldServeTSAEndpoints()) && config.InsecureAddress != "" {
 		// TODO: instead opt for having a single server.Server but two
 		// http.Servers handling the HTTP and HTTPS handler? The latter
 		// will probably introduce more complexity in terms of graceful
@@ -269,36 +412,82 @@ func (ca *CA) Init(config *config.Config) (*CA, error) {
 	return ca, nil
 }
 
-// Run starts the CA calling to the server ListenAndServe method.
+// Run starts the CA calling to the server ListenAndServe method. It listens on
+// all the addresses before serving the requests, and notifies systemd once it
+// is ready.
 func (ca *CA) Run() error {
-	var wg sync.WaitGroup
-	errors := make(chan error, 1)
+	var lns []net.Listener
+	var serves []func() error
+	listen := func(addr string, serve func(net.Listener) error) error {
+		ln, err := server.Listen(addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return errors.Wrapf(err, "error listening on %s", addr)
+		}
+		lns = append(lns, ln)
+		serves = append(serves, func() error {
+			return serve(ln)
+		})
+		return nil
+	}
 
 	if ca.insecureSrv != nil {
+		if err := listen(ca.insecureSrv.Addr, ca.insecureSrv.Serve); err != nil {
+			return err
+		}
+	}
+
+	for _, srv := range ca.listenerSrvs {
+		if err := listen(srv.Addr, srv.Serve); err != nil {
+			return err
+		}
+	}
+
+	if ca.grpcSrv != nil {
+		if err := listen(ca.grpcSrv.addr, ca.grpcSrv.Serve); err != nil {
+			return err
+		}
+	}
+
+	if err := listen(ca.srv.Addr, ca.srv.Serve); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
 		wg.Add(1)
-		go func() {
+		go func(serve func() error) {
 			defer wg.Done()
-			errors <- ca.insecureSrv.ListenAndServe()
-		}()
+			errs <- serve()
+		}(serve)
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		errors <- ca.srv.ListenAndServe()
-	}()
+	if err := server.Notify("READY=1"); err != nil {
+		log.Println(err)
+	}
+	stopWatchdog := server.Watchdog()
 
 	// wait till error occurs; ensures the servers keep listening
-	err := <-errors
+	err := <-errs
+	stopWatchdog()
 
 	wg.Wait()
 
 	return err
 }
 
-// Stop stops the CA calling to the server Shutdown method.
+// Stop stops the CA calling to the server Shutdown method. It also releases
+// the resources of a CA embedded using Handler that was never run.
 func (ca *CA) Stop() error {
+	if err := server.Notify("STOPPING=1"); err != nil {
+		log.Println(err)
+	}
 	ca.renewer.Stop()
+	ca.sni.Stop()
+	ca.acmeValidations.Close()
 	if err := ca.auth.Shutdown(); err != nil {
 		log.Printf("error stopping ca.Authority: %+v\n", err)
 	}
@@ -307,22 +496,69 @@ func (ca *CA) Stop() error {
 		insecureShutdownErr = ca.insecureSrv.Shutdown()
 	}
 
+	var listenerShutdownErr error
+	for _, srv := range ca.listenerSrvs {
+		if err := srv.Shutdown(); err != nil && listenerShutdownErr == nil {
+			listenerShutdownErr = err
+		}
+	}
+
+	var grpcShutdownErr error
+	if ca.grpcSrv != nil {
+		grpcShutdownErr = ca.grpcSrv.Shutdown()
+	}
+
 	secureErr := ca.srv.Shutdown()
 
 	if insecureShutdownErr != nil {
 		return insecureShutdownErr
 	}
+	if listenerShutdownErr != nil {
+		return listenerShutdownErr
+	}
+	if grpcShutdownErr != nil {
+		return grpcShutdownErr
+	}
 	return secureErr
 }
 
 // Reload reloads the configuration of the CA and calls to the server Reload
 // method.
 func (ca *CA) Reload() error {
-	config, err := config.LoadConfiguration(ca.opts.configFile)
+	if err := server.NotifyReloading(); err != nil {
+		log.Println(err)
+	}
+	defer func() {
+		if err := server.Notify("READY=1"); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	config, err := config.LoadConfiguration(ca.opts.configFile, ca.opts.configOverrides...)
 	if err != nil {
 		return errors.Wrap(err, "error reloading ca configuration")
 	}
 
+	return ca.reload(config)
+}
+
+// ReloadWithConfig reloads the CA using the given configuration instead of
+// the configuration file. The same restrictions as in Reload apply, the
+// database, listeners and gRPC configuration cannot change.
+func (ca *CA) ReloadWithConfig(cfg *config.Config) error {
+	if err := server.NotifyReloading(); err != nil {
+		log.Println(err)
+	}
+	defer func() {
+		if err := server.Notify("READY=1"); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return ca.reload(cfg)
+}
+
+func (ca *CA) reload(config *config.Config) error {
 	logContinue := func(reason string) {
 		log.Println(reason)
 		log.Println("Continuing to run with the original configuration.")
@@ -335,12 +571,25 @@ func (ca *CA) Reload() error {
 		return errors.New("error reloading ca: database configuration cannot change")
 	}
 
+	// Do not allow reload if listeners have been added or removed.
+	if len(ca.config.Listeners) != len(config.Listeners) {
+		logContinue("Reload failed because the number of listeners has changed.")
+		return errors.New("error reloading ca: listeners cannot be added or removed")
+	}
+
+	// Do not allow reload if the gRPC server has been added, removed or moved.
+	if !reflect.DeepEqual(ca.config.GRPC, config.GRPC) {
+		logContinue("Reload failed because the gRPC configuration has changed.")
+		return errors.New("error reloading ca: grpc configuration cannot change")
+	}
+
 	newCA, err := New(config,
 		WithPassword(ca.opts.password),
 		WithIssuerPassword(ca.opts.issuerPassword),
 		WithLinkedCAToken(ca.opts.linkedCAToken),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
+		WithAuthorityOptions(ca.opts.authOptions...),
 	)
 	if err != nil {
 		logContinue("Reload failed because the CA with new configuration could not be initialized.")
@@ -354,21 +603,44 @@ func (ca *CA) Reload() error {
 		}
 	}
 
+	for i, srv := range ca.listenerSrvs {
+		if err = srv.Reload(newCA.listenerSrvs[i]); err != nil {
+			logContinue("Reload failed because listener server could not be replaced.")
+			return errors.Wrapf(err, "error reloading listener server %s", newCA.listenerSrvs[i].Addr)
+		}
+	}
+
+	if ca.grpcSrv != nil {
+		if err = ca.grpcSrv.Reload(newCA.grpcSrv); err != nil {
+			logContinue("Reload failed because gRPC server could not be replaced.")
+			return errors.Wrap(err, "error reloading gRPC server")
+		}
+	}
+
 	if err = ca.srv.Reload(newCA.srv); err != nil {
 		logContinue("Reload failed because server could not be replaced.")
 		return errors.Wrap(err, "error reloading server")
 	}
 
+	// Swap the handlers mounted by applications embedding the CA.
+	ca.handler.swap(newCA.handler)
+	ca.insecure.swap(newCA.insecure)
+
 	// 1. Stop previous renewer
 	// 2. Safely shutdown any internal resources (e.g. key manager)
 	// 3. Replace ca properties
 	// Do not replace ca.srv
 	ca.renewer.Stop()
+	ca.sni.Stop()
+	ca.acmeValidations.Close()
 	ca.auth.CloseForReload()
 	ca.auth = newCA.auth
+	ca.acmeValidations = newCA.acmeValidations
 	ca.config = newCA.config
 	ca.opts = newCA.opts
 	ca.renewer = newCA.renewer
+	ca.sni = newCA.sni
+	ca.tlsConfig = newCA.tlsConfig
 	return nil
 }
 
@@ -393,6 +665,14 @@ func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, error) {
 	}
 	ca.renewer.Run()
 
+	// Start the renewers of the certificates selected by server name.
+	ca.sni.Stop()
+	ca.sni, err = newSNISelector(auth, ca.config.ServerCertificates, ca.renewer.GetCertificateForCA)
+	if err != nil {
+		ca.renewer.Stop()
+		return nil, err
+	}
+
 	var tlsConfig *tls.Config
 	if ca.config.TLS != nil {
 		tlsConfig = ca.config.TLS.TLSConfig()
@@ -415,7 +695,7 @@ func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, error) {
 	// empty we are implicitly forcing GetCertificate to be the only mechanism
 	// by which the server can find it's own leaf Certificate.
 	tlsConfig.Certificates = []tls.Certificate{}
-	tlsConfig.GetCertificate = ca.renewer.GetCertificateForCA
+	tlsConfig.GetCertificate = ca.sni.GetCertificate
 
 	// Add support for mutual tls to renew certificates
 	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
@@ -435,6 +715,24 @@ func (ca *CA) shouldServeSCEPEndpoints() bool {
 	return ca.auth.GetSCEPService() != nil
 }
 
+// isCacheablePath returns true if the responses of the given path can be
+// cached: the roots, the federated roots and the ACME directories.
+func isCacheablePath(path string) bool {
+	switch path {
+	case "/roots", "/1.0/roots", "/federation", "/1.0/federation":
+		return true
+	}
+	path = strings.TrimPrefix(path, "/2.0")
+	return strings.HasPrefix(path, "/acme/") && strings.HasSuffix(path, "/directory") &&
+		strings.Count(path, "/") == 3
+}
+
+// shouldServeTSAEndpoints returns if the CA should be configured with the
+// endpoint of the RFC 3161 time-stamp authority.
+func (ca *CA) shouldServeTSAEndpoints() bool {
+	return ca.auth.GetTSAService() != nil
+}
+
 //nolint // ignore linters to allow keeping this function around for debugging
 func dumpRoutes(mux chi.Routes) {
 	// helpful routine for logging all routes //
@@ -115,7 +115,7 @@ func TestCASign(t *testing.T) {
 				ca:     ca,
 				body:   "invalid json",
 				status: http.StatusBadRequest,
-				errMsg: errs.BadRequestDefaultMsg,
+				errMsg: "The request body is not valid JSON.",
 			}
 		},
 		"fail invalid-csr-sig": func(t *testing.T) *signTest {
@@ -674,3 +674,27 @@ func TestCARenew(t *testing.T) {
 		})
 	}
 }
+
+func Test_isCacheablePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/roots", true},
+		{"/1.0/roots", true},
+		{"/federation", true},
+		{"/1.0/federation", true},
+		{"/acme/acme/directory", true},
+		{"/2.0/acme/acme/directory", true},
+		{"/root/abc", false},
+		{"/roots/manifest", false},
+		{"/acme/acme/new-order", false},
+		{"/acme/acme/foo/directory", false},
+		{"/provisioners", false},
+	}
+	for _, tt := range tests {
+		if got := isCacheablePath(tt.path); got != tt.want {
+			t.Errorf("isCacheablePath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package ca
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -438,10 +440,13 @@ func parseEndpoint(endpoint string) (*url.URL, error) {
 type ProvisionerOption func(o *provisionerOptions) error
 
 type provisionerOptions struct {
-	cursor string
-	limit  int
-	id     string
-	name   string
+	cursor  string
+	limit   int
+	id      string
+	name    string
+	types   []string
+	fields  []string
+	exclude []string
 }
 
 func (o *provisionerOptions) apply(opts []ProvisionerOption) (err error) {
@@ -467,6 +472,15 @@ func (o *provisionerOptions) rawQuery() string {
 	if len(o.name) > 0 {
 		v.Set("name", o.name)
 	}
+	if len(o.types) > 0 {
+		v.Set("type", strings.Join(o.types, ","))
+	}
+	if len(o.fields) > 0 {
+		v.Set("fields", strings.Join(o.fields, ","))
+	}
+	if len(o.exclude) > 0 {
+		v.Set("exclude", strings.Join(o.exclude, ","))
+	}
 	return v.Encode()
 }
 
@@ -502,6 +516,32 @@ func WithProvisionerName(name string) ProvisionerOption {
 	}
 }
 
+// WithProvisionerType will request only the provisioners of the given types.
+func WithProvisionerType(types ...string) ProvisionerOption {
+	return func(o *provisionerOptions) error {
+		o.types = append(o.types, types...)
+		return nil
+	}
+}
+
+// WithProvisionerFields will request only the given fields of the
+// provisioners. The type of the provisioners is always returned.
+func WithProvisionerFields(fields ...string) ProvisionerOption {
+	return func(o *provisionerOptions) error {
+		o.fields = append(o.fields, fields...)
+		return nil
+	}
+}
+
+// WithProvisionerExcludeFields will request the provisioners without the
+// given fields, e.g. "encryptedKey".
+func WithProvisionerExcludeFields(fields ...string) ProvisionerOption {
+	return func(o *provisionerOptions) error {
+		o.exclude = append(o.exclude, fields...)
+		return nil
+	}
+}
+
 // Client implements an HTTP client for the CA server.
 type Client struct {
 	client    *uaClient
@@ -688,6 +728,161 @@ retry:
 	return &sign, nil
 }
 
+// SignBatch performs the batched sign request to the CA and returns the
+// api.BatchSignResponse struct. The result of each sign request must be
+// checked, a failed sign request does not fail the batch.
+func (c *Client) SignBatch(req *api.BatchSignRequest) (*api.BatchSignResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.SignBatch; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign/batch"})
+retry:
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.SignBatch; client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var batch api.BatchSignResponse
+	if err := readJSON(resp.Body, &batch); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.SignBatch; error reading %s", u)
+	}
+	for i := range batch.Results {
+		if r := batch.Results[i].Response; r != nil {
+			r.TLS = resp.TLS
+		}
+	}
+	return &batch, nil
+}
+
+// NewSignSession performs the request to the CA to create a sign session and
+// returns the api.SignSessionResponse struct with the id of the session. Once
+// the session is authorized with AuthorizeSignSession, the certificate is
+// returned by WaitSignSession.
+func (c *Client) NewSignSession(req *api.SignSessionRequest) (*api.SignSessionResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.NewSignSession; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign/sessions"})
+retry:
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.NewSignSession; client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var session api.SignSessionResponse
+	if err := readJSON(resp.Body, &session); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.NewSignSession; error reading %s", u)
+	}
+	return &session, nil
+}
+
+// AuthorizeSignSession performs the request to the CA to authorize the sign
+// session with the given id using the given one-time-token.
+func (c *Client) AuthorizeSignSession(id, ott string) error {
+	var retried bool
+	body, err := json.Marshal(&api.SignSessionAuthorizeRequest{OTT: ott})
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "client.AuthorizeSignSession; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign/sessions/" + id + "/authorize"})
+retry:
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errs.Wrapf(http.StatusInternalServerError, err, "client.AuthorizeSignSession; client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return readError(resp.Body)
+	}
+	var authorize api.SignSessionAuthorizeResponse
+	if err := readJSON(resp.Body, &authorize); err != nil {
+		return errs.Wrapf(http.StatusInternalServerError, err, "client.AuthorizeSignSession; error reading %s", u)
+	}
+	return nil
+}
+
+// WaitSignSession waits for the certificate of the sign session with the given
+// id reading the event stream of the session. The CA closes the stream
+// periodically, and the client reconnects to it until the session is
+// authorized, the session expires or the context is done.
+func (c *Client) WaitSignSession(ctx context.Context, id string) (*api.SignResponse, error) {
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign/sessions/" + id + "/events"})
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "new request GET %s failed", u)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.WaitSignSession; client GET %s failed", u)
+		}
+		if resp.StatusCode >= 400 {
+			return nil, readError(resp.Body)
+		}
+		event, data, err := readEvent(resp.Body)
+		if err != nil {
+			return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.WaitSignSession; error reading %s", u)
+		}
+		switch event {
+		case "certificate":
+			var sign api.SignResponse
+			if err := json.Unmarshal(data, &sign); err != nil {
+				return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.WaitSignSession; error reading %s", u)
+			}
+			sign.TLS = resp.TLS
+			return &sign, nil
+		case "error":
+			apiErr := new(errs.Error)
+			if err := json.Unmarshal(data, apiErr); err != nil {
+				return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.WaitSignSession; error reading %s", u)
+			}
+			return nil, apiErr
+		}
+	}
+}
+
+// readEvent reads the first server-sent event of the given stream. It returns
+// an empty event if the stream ends before an event is received.
+func readEvent(r io.ReadCloser) (string, []byte, error) {
+	defer r.Close()
+	var event string
+	var data []byte
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" && event != "":
+			return event, data, nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:"))...)
+		}
+	}
+	return "", nil, scanner.Err()
+}
+
 // Renew performs the renew request to the CA and returns the api.SignResponse
 // struct.
 func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
@@ -713,6 +908,36 @@ retry:
 	return &sign, nil
 }
 
+// RenewWithToken performs the renew request to the CA using a renewal token
+// instead of mTLS and returns the api.SignResponse struct. The token is a JWT
+// signed with the key of the certificate to renew, with the certificate chain
+// in the x5c header.
+func (c *Client) RenewWithToken(token string) (*api.SignResponse, error) {
+	var retried bool
+	body, err := json.Marshal(&api.RenewRequest{Token: token})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.RenewWithToken; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/renew"})
+retry:
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.RenewWithToken; client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var sign api.SignResponse
+	if err := readJSON(resp.Body, &sign); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.RenewWithToken; error reading %s", u)
+	}
+	return &sign, nil
+}
+
 // Rekey performs the rekey request to the CA and returns the api.SignResponse
 // struct.
 func (c *Client) Rekey(req *api.RekeyRequest, tr http.RoundTripper) (*api.SignResponse, error) {
@@ -782,7 +1007,9 @@ retry:
 // api.ProvisionersResponse struct with a map of provisioners.
 //
 // ProvisionerOption WithProvisionerCursor and WithProvisionLimit can be used to
-// paginate the provisioners.
+// paginate the provisioners, WithProvisionerType and WithProvisionerName to
+// filter them, and WithProvisionerFields and WithProvisionerExcludeFields to
+// select the fields returned.
 func (c *Client) Provisioners(opts ...ProvisionerOption) (*api.ProvisionersResponse, error) {
 	var retried bool
 	o := new(provisionerOptions)
@@ -885,6 +1112,63 @@ retry:
 	return &federation, nil
 }
 
+// RootsManifest performs the get roots manifest request to the CA and returns
+// the api.RootsManifestResponse struct.
+func (c *Client) RootsManifest() (*api.RootsManifestResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/roots/manifest"})
+retry:
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "client GET %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var manifest api.RootsManifestResponse
+	if err := readJSON(resp.Body, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &manifest, nil
+}
+
+// NextRoots returns the roots that will replace the current roots of the CA.
+// The roots manifest is verified with the current roots, and an empty list is
+// returned if the CA does not have a root rollover configured.
+func (c *Client) NextRoots() ([]*x509.Certificate, error) {
+	roots, err := c.Roots()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.RootsManifest()
+	if err != nil {
+		if sc, ok := err.(errs.StatusCoder); ok && sc.StatusCode() == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	current := make([]*x509.Certificate, len(roots.Certificates))
+	for i, crt := range roots.Certificates {
+		current[i] = crt.Certificate
+	}
+	manifest, err := authority.VerifyRootsManifest(resp.Manifest, current)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]*x509.Certificate, len(manifest.Next))
+	for i, v := range manifest.Next {
+		if next[i], err = v.X509Certificate(); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
 // SSHSign performs the POST /ssh/sign request to the CA and returns the
 // api.SSHSignResponse struct.
 func (c *Client) SSHSign(req *api.SSHSignRequest) (*api.SSHSignResponse, error) {
@@ -2,6 +2,7 @@ package ca
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -393,6 +394,170 @@ func TestClient_Sign(t *testing.T) {
 	}
 }
 
+func TestClient_SignBatch(t *testing.T) {
+	ok := &api.BatchSignResponse{
+		Results: []api.BatchSignResult{{
+			Status: http.StatusCreated,
+			Response: &api.SignResponse{
+				ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
+				CaPEM:     api.Certificate{Certificate: parseCertificate(rootPEM)},
+				CertChainPEM: []api.Certificate{
+					{Certificate: parseCertificate(certPEM)},
+					{Certificate: parseCertificate(rootPEM)},
+				},
+			},
+		}},
+	}
+	request := &api.BatchSignRequest{
+		Requests: []api.SignRequest{{
+			CsrPEM: api.CertificateRequest{CertificateRequest: parseCertificateRequest(csrPEM)},
+			OTT:    "the-ott",
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		request      *api.BatchSignRequest
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		expectedErr  error
+	}{
+		{"ok", request, ok, 200, false, nil},
+		{"empty request", &api.BatchSignRequest{}, errs.BadRequest("force"), 400, true, errors.New(errs.BadRequestDefaultMsg)},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.RequestURI != "/sign/batch" {
+					t.Errorf("RequestURI = %s, want /sign/batch", req.RequestURI)
+				}
+				body := new(api.BatchSignRequest)
+				if err := api.ReadJSON(req.Body, body); err != nil {
+					t.Errorf("error reading request: %v", err)
+				} else if !equalJSON(t, body, tt.request) {
+					t.Errorf("Client.SignBatch() request = %v, wants %v", body, tt.request)
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.SignBatch(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.SignBatch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.SignBatch() = %v, want nil", got)
+				}
+				assert.HasPrefix(t, tt.expectedErr.Error(), err.Error())
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.SignBatch() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_SignSession(t *testing.T) {
+	ok := &api.SignResponse{
+		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
+		CaPEM:     api.Certificate{Certificate: parseCertificate(rootPEM)},
+		CertChainPEM: []api.Certificate{
+			{Certificate: parseCertificate(certPEM)},
+			{Certificate: parseCertificate(rootPEM)},
+		},
+	}
+	okJSON, err := json.Marshal(ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streams int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.RequestURI {
+		case "/sign/sessions":
+			api.JSONStatus(w, &api.SignSessionResponse{ID: "the-id", ExpiresAt: time.Now().Add(time.Minute)}, http.StatusCreated)
+		case "/sign/sessions/the-id/authorize":
+			body := new(api.SignSessionAuthorizeRequest)
+			if err := api.ReadJSON(req.Body, body); err != nil || body.OTT != "the-ott" {
+				api.WriteError(w, errs.Unauthorized("force"))
+				return
+			}
+			api.JSON(w, &api.SignSessionAuthorizeResponse{Status: "ok"})
+		case "/sign/sessions/the-id/events":
+			streams++
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "retry: 10\n\n: keep-alive\n\n")
+			// The first stream is closed before the session is authorized.
+			if streams > 1 {
+				fmt.Fprintf(w, "event: certificate\ndata: %s\n\n", okJSON)
+			}
+		case "/sign/sessions/expired/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			b, _ := json.Marshal(errs.NotFound("force"))
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", b)
+		default:
+			api.WriteError(w, errs.NotFound("force"))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	session, err := c.NewSignSession(&api.SignSessionRequest{
+		CsrPEM: api.CertificateRequest{CertificateRequest: parseCertificateRequest(csrPEM)},
+	})
+	if err != nil {
+		t.Fatalf("Client.NewSignSession() error = %v", err)
+	}
+	if session.ID != "the-id" {
+		t.Errorf("Client.NewSignSession() id = %s, want the-id", session.ID)
+	}
+	if err := c.AuthorizeSignSession(session.ID, "bad-ott"); err == nil {
+		t.Error("Client.AuthorizeSignSession() error = nil, wantErr true")
+	}
+	if err := c.AuthorizeSignSession(session.ID, "the-ott"); err != nil {
+		t.Errorf("Client.AuthorizeSignSession() error = %v", err)
+	}
+
+	got, err := c.WaitSignSession(context.Background(), session.ID)
+	if err != nil {
+		t.Fatalf("Client.WaitSignSession() error = %v", err)
+	}
+	if streams != 2 {
+		t.Errorf("Client.WaitSignSession() streams = %d, want 2", streams)
+	}
+	if !reflect.DeepEqual(got.ServerPEM, ok.ServerPEM) {
+		t.Errorf("Client.WaitSignSession() = %v, want %v", got.ServerPEM, ok.ServerPEM)
+	}
+
+	if _, err := c.WaitSignSession(context.Background(), "expired"); err == nil {
+		t.Error("Client.WaitSignSession() error = nil, wantErr true")
+	} else if sc, ok := err.(errs.StatusCoder); !ok || sc.StatusCode() != http.StatusNotFound {
+		t.Errorf("Client.WaitSignSession() error = %v, want 404", err)
+	}
+	if _, err := c.WaitSignSession(context.Background(), "missing"); err == nil {
+		t.Error("Client.WaitSignSession() error = nil, wantErr true")
+	}
+}
+
 func TestClient_Revoke(t *testing.T) {
 	ok := &api.RevokeResponse{Status: "ok"}
 	request := &api.RevokeRequest{
@@ -529,6 +694,73 @@ func TestClient_Renew(t *testing.T) {
 	}
 }
 
+func TestClient_RenewWithToken(t *testing.T) {
+	ok := &api.SignResponse{
+		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
+		CaPEM:     api.Certificate{Certificate: parseCertificate(rootPEM)},
+		CertChainPEM: []api.Certificate{
+			{Certificate: parseCertificate(certPEM)},
+			{Certificate: parseCertificate(rootPEM)},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		err          error
+	}{
+		{"ok", ok, 200, false, nil},
+		{"unauthorized", errs.Unauthorized("force"), 401, true, errors.New(errs.UnauthorizedDefaultMsg)},
+		{"bad request", errs.BadRequest("force"), 400, true, errors.New(errs.BadRequestDefaultMsg)},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				var body api.RenewRequest
+				if err := api.ReadJSON(req.Body, &body); err != nil || body.Token != "the-token" {
+					api.WriteError(w, errs.BadRequest("unexpected body"))
+					return
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.RenewWithToken("the-token")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.RenewWithToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.RenewWithToken() = %v, want nil", got)
+				}
+
+				sc, ok := err.(errs.StatusCoder)
+				assert.Fatal(t, ok, "error does not implement StatusCoder interface")
+				assert.Equals(t, sc.StatusCode(), tt.responseCode)
+				assert.HasPrefix(t, tt.err.Error(), err.Error())
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.RenewWithToken() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
 func TestClient_Rekey(t *testing.T) {
 	ok := &api.SignResponse{
 		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
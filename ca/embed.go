@@ -0,0 +1,83 @@
+package ca
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/events"
+)
+
+// switchHandler is an http.Handler that delegates to a handler that can be
+// replaced at runtime. It allows applications embedding the CA to keep the
+// same handler mounted across reloads.
+type switchHandler struct {
+	v atomic.Value
+}
+
+// handlerValue wraps the handler so the atomic.Value always stores the same
+// concrete type.
+type handlerValue struct {
+	http.Handler
+}
+
+func newSwitchHandler(h http.Handler) *switchHandler {
+	s := new(switchHandler)
+	s.v.Store(handlerValue{h})
+	return s
+}
+
+func (s *switchHandler) load() http.Handler {
+	return s.v.Load().(handlerValue).Handler
+}
+
+// swap replaces the current handler with the current handler of the given
+// one.
+func (s *switchHandler) swap(h *switchHandler) {
+	s.v.Store(handlerValue{h.load()})
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *switchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.load().ServeHTTP(w, r)
+}
+
+// Handler returns the http.Handler with the CA, ACME, admin and the rest of
+// the configured endpoints, including all the middlewares. It allows a host
+// application to serve the CA in its own server instead of calling Run. The
+// handler is kept up to date on reloads.
+//
+// Endpoints like renew and revoke use the client certificate, so the handler
+// should be served using the TLS configuration returned by TLSConfig.
+// Endpoints served by dedicated listeners are not included.
+func (ca *CA) Handler() http.Handler {
+	return ca.handler
+}
+
+// InsecureHandler returns the http.Handler with the endpoints that can be
+// served over plain HTTP, like SCEP and the time-stamp authority.
+func (ca *CA) InsecureHandler() http.Handler {
+	return ca.insecure
+}
+
+// TLSConfig returns the TLS configuration used by the CA server. It uses a
+// self-renewing server certificate and verifies the client certificates, if
+// given, with the roots of the CA.
+func (ca *CA) TLSConfig() *tls.Config {
+	return ca.tlsConfig
+}
+
+// Authority returns the authority used by the CA.
+func (ca *CA) Authority() *authority.Authority {
+	return ca.auth
+}
+
+// Subscribe registers a handler for the lifecycle events of the authority,
+// like issued, renewed or revoked certificates, for the given types or for
+// all of them if none is given. The subscription is kept across reloads if
+// the event bus is set with WithAuthorityOptions and authority.WithEventBus.
+// It returns a function that removes the subscription.
+func (ca *CA) Subscribe(h events.Handler, types ...events.Type) (unsubscribe func()) {
+	return ca.auth.Events().Subscribe(h, types...)
+}
@@ -0,0 +1,76 @@
+package ca
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/events"
+)
+
+func TestCA_Handler(t *testing.T) {
+	cfg, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	bus := events.NewBus()
+	ca, err := New(cfg, WithAuthorityOptions(authority.WithEventBus(bus)))
+	assert.FatalError(t, err)
+	t.Cleanup(func() {
+		ca.renewer.Stop()
+	})
+
+	assert.NotNil(t, ca.TLSConfig())
+	assert.NotNil(t, ca.InsecureHandler())
+	assert.Equals(t, bus, ca.Authority().Events())
+
+	srv := httptest.NewServer(ca.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/health")
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, http.StatusOK, resp.StatusCode)
+
+	// The handler is kept after a reload.
+	cfg, err = authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	assert.FatalError(t, ca.ReloadWithConfig(cfg))
+
+	resp, err = http.Get(srv.URL + "/health")
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/not-found")
+	assert.FatalError(t, err)
+	resp.Body.Close()
+	assert.Equals(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCA_Subscribe(t *testing.T) {
+	cfg, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	ca, err := New(cfg)
+	assert.FatalError(t, err)
+	t.Cleanup(func() {
+		ca.renewer.Stop()
+	})
+
+	ch := make(chan events.Event, 1)
+	unsubscribe := ca.Subscribe(func(e events.Event) {
+		ch <- e
+	}, events.CertificateRevokedType)
+	defer unsubscribe()
+
+	ca.Authority().Events().Publish(&events.CertificateIssued{Time: time.Now()})
+	ca.Authority().Events().Publish(&events.CertificateRevoked{Time: time.Now()})
+
+	select {
+	case e := <-ch:
+		assert.Equals(t, events.CertificateRevokedType, e.EventType())
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
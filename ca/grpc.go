@@ -0,0 +1,162 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/pb"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/sds"
+	sdspb "github.com/smallstep/certificates/sds/pb"
+	"github.com/smallstep/certificates/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// grpcServer serves the gRPC service of the CA and the Envoy SDS gRPC
+// service. The services and the TLS configuration can be replaced on reload
+// without closing the listener.
+type grpcServer struct {
+	addr      string
+	srv       *grpc.Server
+	mu        sync.RWMutex
+	service   api.CAServer
+	sds       sds.SecretDiscoveryServer
+	tlsConfig *tls.Config
+}
+
+func newGRPCServer(addr string, auth api.Authority, sdsConfig *config.SDSConfig, tlsConfig *tls.Config) *grpcServer {
+	s := &grpcServer{
+		addr:      addr,
+		service:   api.NewCAServer(auth),
+		tlsConfig: grpcTLSConfig(tlsConfig),
+	}
+	if sdsConfig != nil {
+		s.sds = sds.NewSecretDiscoveryServer(auth, sdsConfig)
+	}
+	s.srv = grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		MinVersion:         tlsConfig.MinVersion,
+		GetConfigForClient: s.getConfigForClient,
+	})))
+	api.RegisterCAServer(s.srv, s)
+	// SDS can be enabled on reload, so the service is always registered.
+	sds.RegisterSecretDiscoveryServer(s.srv, s)
+	return s
+}
+
+// grpcTLSConfig returns the TLS configuration of the main address with the
+// HTTP/2 protocol required by gRPC.
+func grpcTLSConfig(tlsConfig *tls.Config) *tls.Config {
+	c := tlsConfig.Clone()
+	c.NextProtos = []string{"h2"}
+	return c
+}
+
+func (s *grpcServer) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tlsConfig, nil
+}
+
+func (s *grpcServer) getService() api.CAServer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.service
+}
+
+// getSDS returns the SDS service, or an error if SDS is not enabled.
+func (s *grpcServer) getSDS() (sds.SecretDiscoveryServer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.sds == nil {
+		return nil, api.GRPCStatusError(errs.NotImplemented("sds is not enabled"))
+	}
+	return s.sds, nil
+}
+
+// ListenAndServe listens on the address of the server and serves the gRPC
+// requests.
+func (s *grpcServer) ListenAndServe() error {
+	ln, err := server.Listen(s.addr)
+	if err != nil {
+		return errors.Wrapf(err, "error listening on %s", s.addr)
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves the gRPC requests on the given listener.
+func (s *grpcServer) Serve(ln net.Listener) error {
+	return s.srv.Serve(ln)
+}
+
+// Shutdown stops the server. Renewal subscriptions do not finish by
+// themselves, so the connections are closed without waiting for them.
+func (s *grpcServer) Shutdown() error {
+	s.srv.Stop()
+	return nil
+}
+
+// Reload replaces the service and the TLS configuration with the ones of the
+// given server.
+func (s *grpcServer) Reload(ns *grpcServer) error {
+	if s.addr != ns.addr {
+		return errors.New("cannot change the gRPC address")
+	}
+	ns.mu.RLock()
+	service, sdsService, tlsConfig := ns.service, ns.sds, ns.tlsConfig
+	ns.mu.RUnlock()
+
+	s.mu.Lock()
+	s.service, s.sds, s.tlsConfig = service, sdsService, tlsConfig
+	s.mu.Unlock()
+	return nil
+}
+
+// Sign implements the api.CAServer interface.
+func (s *grpcServer) Sign(ctx context.Context, req *pb.SignRequest) (*pb.SignResponse, error) {
+	return s.getService().Sign(ctx, req)
+}
+
+// Renew implements the api.CAServer interface.
+func (s *grpcServer) Renew(ctx context.Context, req *pb.RenewRequest) (*pb.SignResponse, error) {
+	return s.getService().Renew(ctx, req)
+}
+
+// Revoke implements the api.CAServer interface.
+func (s *grpcServer) Revoke(ctx context.Context, req *pb.RevokeRequest) (*pb.RevokeResponse, error) {
+	return s.getService().Revoke(ctx, req)
+}
+
+// SSHSign implements the api.CAServer interface.
+func (s *grpcServer) SSHSign(ctx context.Context, req *pb.SSHSignRequest) (*pb.SSHSignResponse, error) {
+	return s.getService().SSHSign(ctx, req)
+}
+
+// SubscribeRenewal implements the api.CAServer interface.
+func (s *grpcServer) SubscribeRenewal(req *pb.RenewRequest, stream api.RenewalStream) error {
+	return s.getService().SubscribeRenewal(req, stream)
+}
+
+// FetchSecrets implements the sds.SecretDiscoveryServer interface.
+func (s *grpcServer) FetchSecrets(ctx context.Context, req *sdspb.DiscoveryRequest) (*sdspb.DiscoveryResponse, error) {
+	srv, err := s.getSDS()
+	if err != nil {
+		return nil, err
+	}
+	return srv.FetchSecrets(ctx, req)
+}
+
+// StreamSecrets implements the sds.SecretDiscoveryServer interface. Open
+// streams keep using the SDS service of the configuration they started with.
+func (s *grpcServer) StreamSecrets(stream sds.SecretDiscoveryStream) error {
+	srv, err := s.getSDS()
+	if err != nil {
+		return err
+	}
+	return srv.StreamSecrets(stream)
+}
@@ -0,0 +1,117 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GRPCClient implements a client for the gRPC service of the CA. The requests
+// and responses are the protobuf messages defined in api/pb/ca.proto.
+type GRPCClient struct {
+	conn *grpc.ClientConn
+}
+
+// NewGRPCClient creates a new gRPC client for the CA listening in the given
+// address. The TLS configuration must trust the roots of the CA, and it must
+// have a client certificate to renew or revoke it without a token.
+func NewGRPCClient(ctx context.Context, addr string, tlsConfig *tls.Config) (*GRPCClient, error) {
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to %s", addr)
+	}
+	return &GRPCClient{conn: conn}, nil
+}
+
+// Close closes the connection with the CA.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// Sign signs a certificate request.
+func (c *GRPCClient) Sign(ctx context.Context, req *pb.SignRequest) (*pb.SignResponse, error) {
+	resp := new(pb.SignResponse)
+	if err := c.conn.Invoke(ctx, grpcMethod("Sign"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Renew renews the client certificate of the connection or, if the request has
+// a renewal token, the certificate in the token.
+func (c *GRPCClient) Renew(ctx context.Context, req *pb.RenewRequest) (*pb.SignResponse, error) {
+	if req == nil {
+		req = new(pb.RenewRequest)
+	}
+	resp := new(pb.SignResponse)
+	if err := c.conn.Invoke(ctx, grpcMethod("Renew"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Revoke revokes a certificate.
+func (c *GRPCClient) Revoke(ctx context.Context, req *pb.RevokeRequest) (*pb.RevokeResponse, error) {
+	resp := new(pb.RevokeResponse)
+	if err := c.conn.Invoke(ctx, grpcMethod("Revoke"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SSHSign signs an SSH certificate.
+func (c *GRPCClient) SSHSign(ctx context.Context, req *pb.SSHSignRequest) (*pb.SSHSignResponse, error) {
+	resp := new(pb.SSHSignResponse)
+	if err := c.conn.Invoke(ctx, grpcMethod("SSHSign"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SubscribeRenewal subscribes to the renewals of the client certificate of the
+// connection or, if the request has a renewal token, of the certificate in the
+// token. The CA sends a renewed certificate each time two thirds of the
+// lifetime of the previous one have elapsed. Cancel the context to end the
+// subscription.
+func (c *GRPCClient) SubscribeRenewal(ctx context.Context, req *pb.RenewRequest) (*RenewalSubscription, error) {
+	if req == nil {
+		req = new(pb.RenewRequest)
+	}
+	desc := &grpc.StreamDesc{StreamName: "SubscribeRenewal", ServerStreams: true}
+	stream, err := c.conn.NewStream(ctx, desc, grpcMethod("SubscribeRenewal"))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &RenewalSubscription{stream: stream}, nil
+}
+
+// RenewalSubscription is the client side of a renewal subscription.
+type RenewalSubscription struct {
+	stream grpc.ClientStream
+}
+
+// Recv waits for the next renewed certificate.
+func (s *RenewalSubscription) Recv() (*pb.SignResponse, error) {
+	resp := new(pb.SignResponse)
+	if err := s.stream.RecvMsg(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func grpcMethod(name string) string {
+	return "/" + api.GRPCServiceName + "/" + name
+}
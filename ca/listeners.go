@@ -0,0 +1,68 @@
+package ca
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/server"
+)
+
+// routers selects the router of each endpoint of the CA, the router of the
+// main address or the router of the listener that serves the endpoint.
+type routers struct {
+	mux       *chi.Mux
+	listeners []*config.ListenerConfig
+	muxes     []*chi.Mux
+}
+
+func newRouters(mux *chi.Mux, listeners []*config.ListenerConfig) *routers {
+	muxes := make([]*chi.Mux, len(listeners))
+	for i := range listeners {
+		muxes[i] = chi.NewRouter()
+	}
+	return &routers{
+		mux:       mux,
+		listeners: listeners,
+		muxes:     muxes,
+	}
+}
+
+// router returns the router for the given endpoint.
+func (r *routers) router(endpoint string) chi.Router {
+	for i, l := range r.listeners {
+		if l.Serves(endpoint) {
+			return r.muxes[i]
+		}
+	}
+	return r.mux
+}
+
+// API returns the router of the core API.
+func (r *routers) API() chi.Router {
+	return r.router(config.ListenerEndpointAPI)
+}
+
+// ACME returns the router of the ACME API.
+func (r *routers) ACME() chi.Router {
+	return r.router(config.ListenerEndpointACME)
+}
+
+// Admin returns the router of the admin API.
+func (r *routers) Admin() chi.Router {
+	return r.router(config.ListenerEndpointAdmin)
+}
+
+// servers returns a server for each listener. The TLS configuration of each
+// server is the one of the main address with the client authentication policy
+// of the listener.
+func (r *routers) servers(wrap func(http.Handler) http.Handler, tlsConfig *tls.Config) []*server.Server {
+	srvs := make([]*server.Server, len(r.listeners))
+	for i, l := range r.listeners {
+		c := tlsConfig.Clone()
+		c.ClientAuth = l.ClientAuthType()
+		srvs[i] = server.New(l.Address, wrap(r.muxes[i]), c)
+	}
+	return srvs
+}
@@ -0,0 +1,271 @@
+// Package registry maintains the mTLS client certificates used by container
+// runtimes, like Docker or containerd, to pull images from registries that
+// require client authentication.
+//
+// The certificates are written using the certs.d layout understood by both
+// runtimes:
+//
+//	<certs.d>/<registry host>/ca.crt
+//	<certs.d>/<registry host>/client.cert
+//	<certs.d>/<registry host>/client.key
+//
+// Every update is written into a new hidden directory that is atomically
+// swapped using a symbolic link, so a runtime reading the directory will never
+// see a certificate paired with the wrong key.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/ca"
+	"go.step.sm/crypto/pemutil"
+)
+
+const (
+	// RootsFile is the name of the file with the trusted roots.
+	RootsFile = "ca.crt"
+	// CertificateFile is the name of the file with the client certificate.
+	CertificateFile = "client.cert"
+	// KeyFile is the name of the file with the client private key.
+	KeyFile = "client.key"
+)
+
+// dataDir is the name of the symbolic link pointing to the current version of
+// the files.
+const dataDir = "..data"
+
+// Client is the interface used to renew the client certificate and get the
+// trusted roots, *ca.Client implements it.
+type Client interface {
+	GetRootCAs() *x509.CertPool
+	Renew(tr http.RoundTripper) (*api.SignResponse, error)
+	Roots() (*api.RootsResponse, error)
+}
+
+// WriteCertsDir atomically writes the roots, certificate chain and private key
+// in the given registry directory, e.g. /etc/docker/certs.d/registry:5000.
+func WriteCertsDir(dir string, roots, chain []*x509.Certificate, key crypto.PrivateKey) error {
+	if len(chain) == 0 {
+		return errors.New("certificate chain cannot be empty")
+	}
+	keyBlock, err := pemutil.Serialize(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "error creating %s", dir)
+	}
+
+	// Write the new version of the files.
+	tsDir, err := ioutil.TempDir(dir, "..")
+	if err != nil {
+		return errors.Wrapf(err, "error creating directory in %s", dir)
+	}
+	if err := os.Chmod(tsDir, 0755); err != nil {
+		os.RemoveAll(tsDir)
+		return errors.Wrapf(err, "error changing mode of %s", tsDir)
+	}
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{RootsFile, encodeCertificates(roots), 0644},
+		{CertificateFile, encodeCertificates(chain), 0644},
+		{KeyFile, pem.EncodeToMemory(keyBlock), 0600},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(tsDir, f.name), f.data, f.perm); err != nil {
+			os.RemoveAll(tsDir)
+			return errors.Wrapf(err, "error writing %s", f.name)
+		}
+	}
+
+	// Swap the data link and remove the previous version.
+	oldDir, _ := os.Readlink(filepath.Join(dir, dataDir))
+	if err := replaceSymlink(dir, dataDir, filepath.Base(tsDir)); err != nil {
+		os.RemoveAll(tsDir)
+		return err
+	}
+	if oldDir != "" && oldDir != filepath.Base(tsDir) && strings.HasPrefix(oldDir, "..") {
+		os.RemoveAll(filepath.Join(dir, oldDir))
+	}
+
+	// Make sure that the visible files point to the data link.
+	for _, f := range files {
+		target := filepath.Join(dataDir, f.name)
+		if link, err := os.Readlink(filepath.Join(dir, f.name)); err == nil && link == target {
+			continue
+		}
+		if err := replaceSymlink(dir, f.name, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceSymlink atomically creates or replaces the symbolic link name in dir
+// with one pointing to target.
+func replaceSymlink(dir, name, target string) error {
+	tmp := filepath.Join(dir, name+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return errors.Wrapf(err, "error creating link %s", tmp)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "error renaming link %s", tmp)
+	}
+	return nil
+}
+
+// ReadCertsDir reads the client certificate and key from the given registry
+// directory.
+func ReadCertsDir(dir string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, CertificateFile), filepath.Join(dir, KeyFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading certificates in %s", dir)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate in %s", dir)
+	}
+	return &cert, nil
+}
+
+// Maintainer keeps the client certificate of a registry directory renewed.
+type Maintainer struct {
+	client  Client
+	dir     string
+	renewer *ca.TLSRenewer
+	mu      sync.Mutex
+	cert    *tls.Certificate
+}
+
+// NewMaintainer creates a new Maintainer for the given registry directory
+// using cert as the initial client certificate. The certificate, its key and
+// the current roots are written to the directory before returning.
+func NewMaintainer(client Client, dir string, cert *tls.Certificate) (*Maintainer, error) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, errors.New("certificate cannot be empty")
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate")
+		}
+		cert.Leaf = leaf
+	}
+
+	m := &Maintainer{
+		client: client,
+		dir:    dir,
+		cert:   cert,
+	}
+	if err := m.write(cert); err != nil {
+		return nil, err
+	}
+
+	renewer, err := ca.NewTLSRenewer(cert, m.renew)
+	if err != nil {
+		return nil, err
+	}
+	m.renewer = renewer
+	return m, nil
+}
+
+// Run starts the certificate renewer.
+func (m *Maintainer) Run() {
+	m.renewer.Run()
+}
+
+// RunContext starts the certificate renewer for the given context.
+func (m *Maintainer) RunContext(ctx context.Context) {
+	m.renewer.RunContext(ctx)
+}
+
+// Stop stops the certificate renewer.
+func (m *Maintainer) Stop() error {
+	m.renewer.Stop()
+	return nil
+}
+
+// renew renews the current certificate using mTLS and writes the new one in
+// the registry directory.
+func (m *Maintainer) renew() (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{
+		Certificates:             []tls.Certificate{*m.cert},
+		RootCAs:                  m.client.GetRootCAs(),
+		PreferServerCipherSuites: true,
+	}
+	sign, err := m.client.Renew(tr)
+	if err != nil {
+		return nil, err
+	}
+	if len(sign.CertChainPEM) == 0 {
+		sign.CertChainPEM = []api.Certificate{sign.ServerPEM, sign.CaPEM}
+	}
+
+	cert := &tls.Certificate{
+		PrivateKey: m.cert.PrivateKey,
+		Leaf:       sign.CertChainPEM[0].Certificate,
+	}
+	for _, crt := range sign.CertChainPEM {
+		cert.Certificate = append(cert.Certificate, crt.Raw)
+	}
+	if err := m.write(cert); err != nil {
+		return nil, err
+	}
+	m.cert = cert
+	return cert, nil
+}
+
+// write writes the given certificate and the current roots in the registry
+// directory.
+func (m *Maintainer) write(cert *tls.Certificate) error {
+	resp, err := m.client.Roots()
+	if err != nil {
+		return err
+	}
+	roots := make([]*x509.Certificate, len(resp.Certificates))
+	for i, crt := range resp.Certificates {
+		roots[i] = crt.Certificate
+	}
+	chain := make([]*x509.Certificate, len(cert.Certificate))
+	for i, b := range cert.Certificate {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return errors.Wrap(err, "error parsing certificate")
+		}
+		chain[i] = crt
+	}
+	return WriteCertsDir(m.dir, roots, chain, cert.PrivateKey)
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	buf := new(bytes.Buffer)
+	for _, crt := range certs {
+		pem.Encode(buf, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/api"
+)
+
+type mockClient struct {
+	renew func(tr http.RoundTripper) (*api.SignResponse, error)
+	roots func() (*api.RootsResponse, error)
+}
+
+func (m *mockClient) GetRootCAs() *x509.CertPool {
+	return nil
+}
+
+func (m *mockClient) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
+	return m.renew(tr)
+}
+
+func (m *mockClient) Roots() (*api.RootsResponse, error) {
+	return m.roots()
+}
+
+func mustCertificate(t *testing.T, serial int64) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt, key
+}
+
+func countDataDirs(t *testing.T, dir string) int {
+	t.Helper()
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, fi := range fis {
+		if fi.IsDir() && strings.HasPrefix(fi.Name(), "..") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWriteCertsDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "go-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "registry.internal:5000")
+
+	root, _ := mustCertificate(t, 1)
+	for i := int64(2); i < 4; i++ {
+		crt, key := mustCertificate(t, i)
+		if err := WriteCertsDir(dir, []*x509.Certificate{root}, []*x509.Certificate{crt}, key); err != nil {
+			t.Fatalf("WriteCertsDir() error = %v", err)
+		}
+		cert, err := ReadCertsDir(dir)
+		if err != nil {
+			t.Fatalf("ReadCertsDir() error = %v", err)
+		}
+		if cert.Leaf.SerialNumber.Int64() != i {
+			t.Errorf("ReadCertsDir() serial = %d, want %d", cert.Leaf.SerialNumber.Int64(), i)
+		}
+		if n := countDataDirs(t, dir); n != 1 {
+			t.Errorf("WriteCertsDir() data directories = %d, want 1", n)
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, KeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("WriteCertsDir() key mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0600))
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, RootsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(encodeCertificates([]*x509.Certificate{root})) {
+		t.Error("WriteCertsDir() roots do not match")
+	}
+
+	if err := WriteCertsDir(dir, nil, nil, nil); err == nil {
+		t.Error("WriteCertsDir() error = nil, want error")
+	}
+}
+
+func TestMaintainer_renew(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "go-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "registry.internal")
+
+	root, _ := mustCertificate(t, 1)
+	crt, key := mustCertificate(t, 2)
+	renewed, _ := mustCertificate(t, 3)
+	client := &mockClient{
+		renew: func(tr http.RoundTripper) (*api.SignResponse, error) {
+			return &api.SignResponse{
+				CertChainPEM: []api.Certificate{{Certificate: renewed}},
+			}, nil
+		},
+		roots: func() (*api.RootsResponse, error) {
+			return &api.RootsResponse{
+				Certificates: []api.Certificate{{Certificate: root}},
+			}, nil
+		},
+	}
+
+	m, err := NewMaintainer(client, dir, &tls.Certificate{
+		Certificate: [][]byte{crt.Raw},
+		PrivateKey:  key,
+	})
+	if err != nil {
+		t.Fatalf("NewMaintainer() error = %v", err)
+	}
+	if cert, err := ReadCertsDir(dir); err != nil {
+		t.Fatalf("ReadCertsDir() error = %v", err)
+	} else if !cert.Leaf.Equal(crt) {
+		t.Error("NewMaintainer() did not write the initial certificate")
+	}
+
+	cert, err := m.renew()
+	if err != nil {
+		t.Fatalf("Maintainer.renew() error = %v", err)
+	}
+	if !cert.Leaf.Equal(renewed) {
+		t.Error("Maintainer.renew() did not return the renewed certificate")
+	}
+	// The renewed certificate is not signed by the key, so only the
+	// certificate file is checked.
+	b, err := ioutil.ReadFile(filepath.Join(dir, CertificateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(encodeCertificates([]*x509.Certificate{renewed})) {
+		t.Error("Maintainer.renew() did not write the renewed certificate")
+	}
+}
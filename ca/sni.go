@@ -0,0 +1,130 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+// sniCertificate is a server certificate presented to the clients that
+// request one of the configured server names.
+type sniCertificate struct {
+	config  *config.ServerCertificateConfig
+	renewer *TLSRenewer
+	cert    *tls.Certificate
+}
+
+// getCertificate returns the current certificate, renewing it if it has
+// expired.
+func (c *sniCertificate) getCertificate() *tls.Certificate {
+	if c.renewer != nil {
+		return c.renewer.getCertificateForCA()
+	}
+	return c.cert
+}
+
+// sniSelector selects the server certificate of the CA using the server name
+// sent by the client. The certificates issued by the authority are renewed in
+// the background and replaced without affecting the established connections.
+type sniSelector struct {
+	certificates []*sniCertificate
+	fallback     func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// newSNISelector creates the certificates in the given configuration and
+// starts their renewers. The fallback is used if the client does not send a
+// server name, e.g. if it connects using an IP address, or if the server name
+// does not match any of the configured certificates.
+func newSNISelector(auth *authority.Authority, configs []*config.ServerCertificateConfig, fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*sniSelector, error) {
+	s := &sniSelector{
+		fallback: fallback,
+	}
+	for _, cfg := range configs {
+		c, err := newSNICertificate(auth, cfg)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.certificates = append(s.certificates, c)
+	}
+	return s, nil
+}
+
+func newSNICertificate(auth *authority.Authority, cfg *config.ServerCertificateConfig) (*sniCertificate, error) {
+	// Certificates not issued by the authority are read again on reload.
+	if cfg.Certificate != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Certificate, cfg.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading server certificate %s", cfg.Certificate)
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, errors.Wrapf(err, "error parsing server certificate %s", cfg.Certificate)
+		}
+		return &sniCertificate{
+			config: cfg,
+			cert:   &cert,
+		}, nil
+	}
+
+	dnsNames, keyType := cfg.GetDNSNames(), cfg.KeyType
+	renew := func() (*tls.Certificate, error) {
+		return auth.GetServerCertificate(dnsNames, keyType)
+	}
+	cert, err := renew()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating server certificate for %s", strings.Join(cfg.ServerNames, ", "))
+	}
+	renewer, err := NewTLSRenewer(cert, renew)
+	if err != nil {
+		return nil, err
+	}
+	renewer.Run()
+	return &sniCertificate{
+		config:  cfg,
+		renewer: renewer,
+	}, nil
+}
+
+// GetCertificate returns the server certificate for the given client hello.
+// If more than one certificate matches the server name, the first one
+// supported by the client is returned, this allows to serve ECDSA and RSA
+// certificates for the same names.
+//
+// This method is set in the tls.Config GetCertificate property.
+func (s *sniSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName != "" {
+		var first *tls.Certificate
+		for _, c := range s.certificates {
+			if !c.config.MatchServerName(hello.ServerName) {
+				continue
+			}
+			cert := c.getCertificate()
+			if hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+			if first == nil {
+				first = cert
+			}
+		}
+		if first != nil {
+			return first, nil
+		}
+	}
+	return s.fallback(hello)
+}
+
+// Stop stops the renewers of the certificates issued by the authority.
+func (s *sniSelector) Stop() {
+	if s == nil {
+		return
+	}
+	for _, c := range s.certificates {
+		if c.renewer != nil {
+			c.renewer.Stop()
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+func TestCA_serverCertificates(t *testing.T) {
+	cfg, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	cfg.ServerCertificates = []*config.ServerCertificateConfig{
+		{ServerNames: []string{"ca.example.com"}, KeyType: "RSA"},
+		{ServerNames: []string{"ca.example.com"}},
+		{ServerNames: []string{"*.ca.internal"}, DNSNames: []string{"*.ca.internal", "10.0.0.1"}},
+	}
+	ca, err := New(cfg)
+	assert.FatalError(t, err)
+	defer ca.Stop()
+
+	ecHello := func(serverName string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{
+			ServerName:        serverName,
+			SupportedVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+			CipherSuites:      []uint16{tls.TLS_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			SupportedCurves:   []tls.CurveID{tls.CurveP256},
+			SupportedPoints:   []uint8{0},
+		}
+	}
+	rsaHello := &tls.ClientHelloInfo{
+		ServerName:        "ca.example.com",
+		SupportedVersions: []uint16{tls.VersionTLS12},
+		CipherSuites:      []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		SignatureSchemes:  []tls.SignatureScheme{tls.PKCS1WithSHA256},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+	}
+
+	getCertificate := ca.tlsConfig.GetCertificate
+
+	// ECDSA is selected if the client does not support RSA.
+	cert, err := getCertificate(ecHello("CA.example.com"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"ca.example.com"}, cert.Leaf.DNSNames)
+	_, ok := cert.Leaf.PublicKey.(*ecdsa.PublicKey)
+	assert.True(t, ok)
+
+	// RSA is the first certificate for the server name.
+	cert, err = getCertificate(rsaHello)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"ca.example.com"}, cert.Leaf.DNSNames)
+	_, ok = cert.Leaf.PublicKey.(*rsa.PublicKey)
+	assert.True(t, ok)
+
+	// Wildcard server names.
+	cert, err = getCertificate(ecHello("foo.ca.internal"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"*.ca.internal"}, cert.Leaf.DNSNames)
+	assert.True(t, cert.Leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")))
+
+	// The default certificate is used without SNI or with other names.
+	for _, serverName := range []string{"", "ca.internal", "foo.bar.ca.internal"} {
+		cert, err = getCertificate(ecHello(serverName))
+		assert.FatalError(t, err)
+		assert.Len(t, 0, cert.Leaf.DNSNames)
+		assert.True(t, cert.Leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	}
+}
@@ -217,6 +217,30 @@ func AddFederationToClientCAs() TLSOption {
 	}
 }
 
+// AddNextRootsToCAs does a roots manifest request and adds the next roots of
+// the CA to the tls.Config RootCAs and ClientCAs. The manifest must be signed
+// by one of the current roots. With this option the new roots are trusted
+// before a root rollover, without bootstrapping the client again.
+func AddNextRootsToCAs() TLSOption {
+	fn := func(ctx *TLSOptionCtx) error {
+		roots, err := ctx.Client.NextRoots()
+		if err != nil {
+			return err
+		}
+		certs := make([]api.Certificate, len(roots))
+		for i, crt := range roots {
+			certs[i] = api.Certificate{Certificate: crt}
+		}
+		ctx.mutableConfig.AddRootCAs(certs)
+		ctx.mutableConfig.AddClientCAs(certs)
+		return nil
+	}
+	return func(ctx *TLSOptionCtx) error {
+		ctx.OnRenewFunc = append(ctx.OnRenewFunc, fn)
+		return fn(ctx)
+	}
+}
+
 // AddRootsToCAs does a roots request and adds the resulting certs to the
 // tls.Config RootCAs and ClientCAs. Combines the functionality of
 // AddRootsToRootCAs and AddRootsToClientCAs.
@@ -38,6 +38,24 @@ import (
 	_ "github.com/smallstep/certificates/cas/cloudcas"
 	_ "github.com/smallstep/certificates/cas/softcas"
 	_ "github.com/smallstep/certificates/cas/stepcas"
+
+	// Enabled secret managers.
+	_ "github.com/smallstep/certificates/secrets/awssm"
+	_ "github.com/smallstep/certificates/secrets/gcpsm"
+	_ "github.com/smallstep/certificates/secrets/vault"
+
+	// Enabled password sources.
+	_ "github.com/smallstep/certificates/secrets/kmsdecrypt"
+
+	// Enabled revocation publishers.
+	_ "github.com/smallstep/certificates/publisher/awss3"
+	_ "github.com/smallstep/certificates/publisher/azblob"
+	_ "github.com/smallstep/certificates/publisher/gcs"
+
+	// Enabled dns updaters.
+	_ "github.com/smallstep/certificates/dnsupdate/coredns"
+	_ "github.com/smallstep/certificates/dnsupdate/rfc2136"
+	_ "github.com/smallstep/certificates/dnsupdate/route53"
 )
 
 // commit and buildTime are filled in during build by the Makefile
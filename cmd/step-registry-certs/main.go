@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/smallstep/certificates/ca"
+	"github.com/smallstep/certificates/ca/registry"
+)
+
+func main() {
+	var caURL, root, crtFile, keyFile string
+	var certsDir, host string
+	flag.StringVar(&caURL, "ca-url", "", "The `URI` of the targeted Step Certificate Authority.")
+	flag.StringVar(&root, "root", "", "The path to the PEM `file` used as the root certificate authority.")
+	flag.StringVar(&crtFile, "crt", "", "The path to the initial client certificate `file`, defaults to the one in the registry directory.")
+	flag.StringVar(&keyFile, "key", "", "The path to the initial client private key `file`, defaults to the one in the registry directory.")
+	flag.StringVar(&certsDir, "certs-dir", "/etc/docker/certs.d", "The certs.d `directory` used by the container runtime.")
+	flag.StringVar(&host, "registry", "", "The `host` and optional port of the registry, e.g. registry.internal:5000.")
+	flag.Usage = usage
+	flag.Parse()
+
+	switch {
+	case caURL == "" || host == "":
+		usage()
+	case root == "":
+		fmt.Fprintln(os.Stderr, "flag `--root` is required")
+		os.Exit(1)
+	case (crtFile == "") != (keyFile == ""):
+		fmt.Fprintln(os.Stderr, "flags `--crt` and `--key` must be used together")
+		os.Exit(1)
+	}
+
+	dir := filepath.Join(certsDir, host)
+
+	var cert *tls.Certificate
+	if crtFile != "" {
+		c, err := tls.LoadX509KeyPair(crtFile, keyFile)
+		if err != nil {
+			fatal(err)
+		}
+		cert = &c
+	} else {
+		c, err := registry.ReadCertsDir(dir)
+		if err != nil {
+			fatal(err)
+		}
+		cert = c
+	}
+
+	client, err := ca.NewClient(caURL, ca.WithRootFile(root))
+	if err != nil {
+		fatal(err)
+	}
+
+	m, err := registry.NewMaintainer(client, dir, cert)
+	if err != nil {
+		fatal(err)
+	}
+	m.Run()
+
+	log.Printf("maintaining client certificate in %s", dir)
+	ca.StopHandler(m)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: step-registry-certs --ca-url <uri> --root <file> --registry <host>")
+	fmt.Fprintln(os.Stderr, `
+The step-registry-certs command keeps renewed the client certificate used by
+Docker or containerd to authenticate against a registry. The certificate, its
+key and the root certificates are written atomically in the certs.d directory
+of the registry.
+
+OPTIONS`)
+	fmt.Fprintln(os.Stderr)
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, `
+COPYRIGHT
+
+  (c) 2018-2021 Smallstep Labs, Inc.`)
+	os.Exit(1)
+}
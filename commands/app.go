@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/certificates/pki"
+	"github.com/smallstep/certificates/secrets"
 	"github.com/urfave/cli"
 	"go.step.sm/cli-utils/errs"
 )
@@ -24,7 +26,9 @@ var AppCommand = cli.Command{
 	Name:   "start",
 	Action: appAction,
 	UsageText: `**step-ca** <config>
-[**--password-file**=<file>] [**--issuer-password-file**=<file>] [**--resolver**=<addr>]`,
+[**--password-file**=<file>] [**--issuer-password-file**=<file>]
+[**--password-source**=<source>] [**--issuer-password-source**=<source>]
+[**--resolver**=<addr>] [**--set**=<path=value>]`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name: "password-file",
@@ -36,6 +40,37 @@ intermediate private key.`,
 			Usage: `path to the <file> containing the password to decrypt the
 certificate issuer private key used in the RA mode.`,
 		},
+		cli.StringFlag{
+			Name: "password-source",
+			Usage: `the <source> of the password to decrypt the intermediate and SSH private
+keys, instead of --password-file. A source is the path of a file or an uri with
+one of the schemes:
+
+**file**
+:  a file, e.g. 'file:/run/secrets/password'.
+
+**env**
+:  an environment variable, e.g. 'env:name=STEP_CA_PASSWORD'.
+
+**systemd-creds**
+:  a systemd credential, e.g. 'systemd-creds:name=step-ca-password'. Encrypted
+credentials, including the ones sealed with a TPM, are decrypted by systemd.
+
+**kms-decrypt**
+:  a file decrypted with a KMS key using RSA-OAEP and SHA-256, e.g.
+'kms-decrypt:kms=awskms;key=awskms:key-id=1234;ciphertext=/etc/step-ca/password.enc'.
+
+**vault**, **awssm**, **gcpsm**
+:  a secret in a secret manager, e.g. 'vault:path=secret/data/step-ca;field=password'.`,
+			EnvVar: "STEP_CA_PASSWORD_SOURCE",
+		},
+		cli.StringFlag{
+			Name: "issuer-password-source",
+			Usage: `the <source> of the password to decrypt the certificate issuer private
+key used in the RA mode, instead of --issuer-password-file. It supports the same
+sources as --password-source.`,
+			EnvVar: "STEP_CA_ISSUER_PASSWORD_SOURCE",
+		},
 		cli.StringFlag{
 			Name:  "resolver",
 			Usage: "address of a DNS resolver to be used instead of the default.",
@@ -45,15 +80,25 @@ certificate issuer private key used in the RA mode.`,
 			Usage:  "token used to enable the linked ca.",
 			EnvVar: "STEP_CA_TOKEN",
 		},
+		cli.StringSliceFlag{
+			Name: "set",
+			Usage: `override a value of the configuration file using the format <path=value>,
+where <path> is the list of keys separated by dots, e.g.
+'authority.claims.maxTLSCertDuration=48h'. Values that are valid JSON are used
+as JSON, and as strings otherwise. Use the flag multiple times to override
+multiple values. Flags take precedence over the environment variables with the
+prefix STEP_CA_CONFIG_, e.g. STEP_CA_CONFIG_AUTHORITY__CLAIMS__MAXTLSCERTDURATION,
+and both take precedence over the configuration file.`,
+		},
 	},
 }
 
 // AppAction is the action used when the top command runs.
 func appAction(ctx *cli.Context) error {
-	passFile := ctx.String("password-file")
-	issuerPassFile := ctx.String("issuer-password-file")
-	resolver := ctx.String("resolver")
-	token := ctx.String("token")
+	// Run under the Windows service control manager.
+	if isWindowsService() {
+		return runWindowsService(ctx)
+	}
 
 	// If zero cmd line args show help, if >1 cmd line args show error.
 	if ctx.NArg() == 0 {
@@ -63,8 +108,25 @@ func appAction(ctx *cli.Context) error {
 		return err
 	}
 
-	configFile := ctx.Args().Get(0)
-	config, err := config.LoadConfiguration(configFile)
+	return runCA(ctx, ctx.Args().Get(0), ctx.String("password-file"), func(srv *ca.CA) {
+		ca.StopReloaderHandler(srv)
+	})
+}
+
+// runCA starts the CA with the given configuration and password files. The
+// handle function runs in its own goroutine once the CA is created, and it
+// must stop or reload the CA when requested.
+func runCA(ctx *cli.Context, configFile, passFile string, handle func(srv *ca.CA)) error {
+	issuerPassFile := ctx.String("issuer-password-file")
+	resolver := ctx.String("resolver")
+	token := ctx.String("token")
+
+	overrides, err := configOverrides(ctx)
+	if err != nil {
+		fatal(err)
+	}
+
+	config, err := config.LoadConfiguration(configFile, overrides...)
 	if err != nil {
 		fatal(err)
 	}
@@ -81,20 +143,14 @@ To get a linked authority token:
 		}
 	}
 
-	var password []byte
-	if passFile != "" {
-		if password, err = ioutil.ReadFile(passFile); err != nil {
-			fatal(errors.Wrapf(err, "error reading %s", passFile))
-		}
-		password = bytes.TrimRightFunc(password, unicode.IsSpace)
+	password, err := readPassword(passFile, ctx.String("password-source"))
+	if err != nil {
+		fatal(err)
 	}
 
-	var issuerPassword []byte
-	if issuerPassFile != "" {
-		if issuerPassword, err = ioutil.ReadFile(issuerPassFile); err != nil {
-			fatal(errors.Wrapf(err, "error reading %s", issuerPassFile))
-		}
-		issuerPassword = bytes.TrimRightFunc(issuerPassword, unicode.IsSpace)
+	issuerPassword, err := readPassword(issuerPassFile, ctx.String("issuer-password-source"))
+	if err != nil {
+		fatal(err)
 	}
 
 	// replace resolver if requested
@@ -107,6 +163,7 @@ To get a linked authority token:
 
 	srv, err := ca.New(config,
 		ca.WithConfigFile(configFile),
+		ca.WithConfigOverrides(overrides),
 		ca.WithPassword(password),
 		ca.WithIssuerPassword(issuerPassword),
 		ca.WithLinkedCAToken(token))
@@ -114,21 +171,61 @@ To get a linked authority token:
 		fatal(err)
 	}
 
-	go ca.StopReloaderHandler(srv)
+	go handle(srv)
 	if err = srv.Run(); err != nil && err != http.ErrServerClosed {
 		fatal(err)
 	}
 	return nil
 }
 
+// readPassword returns the password in the given file or source. It returns
+// nil if none of them is set.
+func readPassword(passFile, source string) ([]byte, error) {
+	switch {
+	case passFile != "" && source != "":
+		return nil, errors.New("a password file and a password source cannot be used at the same time")
+	case source != "":
+		return secrets.ReadPassword(context.Background(), source)
+	case passFile != "":
+		b, err := ioutil.ReadFile(passFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", passFile)
+		}
+		return bytes.TrimRightFunc(b, unicode.IsSpace), nil
+	default:
+		return nil, nil
+	}
+}
+
+// configOverrides returns the overrides of the configuration defined in the
+// environment and in the --set flag, in order of precedence.
+func configOverrides(ctx *cli.Context) ([]*config.Override, error) {
+	overrides, err := config.EnvOverrides(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ctx.StringSlice("set") {
+		o, err := config.ParseOverride(s)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// fatalWriter is the writer used by fatal, the Windows service writes the
+// errors in the event log.
+var fatalWriter io.Writer = os.Stderr
+
 // fatal writes the passed error on the standard error and exits with the exit
 // code 1. If the environment variable STEPDEBUG is set to 1 it shows the
 // stack trace of the error.
 func fatal(err error) {
 	if os.Getenv("STEPDEBUG") == "1" {
-		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		fmt.Fprintf(fatalWriter, "%+v\n", err)
 	} else {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(fatalWriter, err)
 	}
 	os.Exit(2)
 }
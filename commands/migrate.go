@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/urfave/cli"
+
+	"go.step.sm/cli-utils/command"
+	"go.step.sm/cli-utils/errs"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "migrate-config",
+		Usage:     "migrate the step-ca configuration to the latest version",
+		UsageText: "**step-ca migrate-config** <config> [**--output-file**=<file>]",
+		Action:    migrateConfigAction,
+		Description: `**step-ca migrate-config** converts the step-ca configuration to the latest
+version of the format. The deprecated fields are replaced, and the fields that
+are ignored by the current format are removed. The changes made are printed to
+the standard error.
+
+Starting with version 2, unknown fields, unknown provisioner types and
+deprecated fields are rejected when step-ca starts.
+
+## POSITIONAL ARGUMENTS
+
+<config>
+:  The ca.json that contains the step-ca configuration.
+
+## EXAMPLES
+
+Print the migrated configuration:
+'''
+$ step-ca migrate-config $(step path)/config/ca.json
+'''
+
+Write the migrated configuration to a new file:
+'''
+$ step-ca migrate-config $(step path)/config/ca.json --output-file ca.v2.json
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "output-file",
+				Usage: `The <file> to write the migrated configuration to.`,
+			},
+		},
+	})
+}
+
+func migrateConfigAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	configFile := ctx.Args().Get(0)
+	outputFile := ctx.String("output-file")
+
+	cfg, changes, err := config.MigrateConfiguration(configFile)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", configFile, c)
+	}
+
+	if outputFile != "" {
+		return cfg.Save(outputFile)
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "error marshaling configuration")
+	}
+	fmt.Println(string(b))
+	return nil
+}
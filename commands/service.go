@@ -0,0 +1,18 @@
+// +build !windows
+
+package commands
+
+import (
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// isWindowsService returns false, the process only runs as a service on
+// Windows.
+func isWindowsService() bool {
+	return false
+}
+
+func runWindowsService(ctx *cli.Context) error {
+	return errors.New("windows services are not supported on this platform")
+}
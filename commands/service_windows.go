@@ -0,0 +1,195 @@
+// +build windows
+
+package commands
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/ca"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// serviceName is the name of the Windows service and the source of its
+// events in the Application event log.
+const serviceName = "step-ca"
+
+// isWindowsService returns true if the process is running as a Windows
+// service.
+func isWindowsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runWindowsService runs the CA under the Windows service control manager.
+//
+// The logs are written in the Application event log. The configuration file
+// defaults to config\ca.json in the STEPPATH, and the password file to
+// password.txt in the STEPPATH if it exists. The STEPPATH defaults to
+// %ProgramData%\step-ca, and it is the working directory of the service.
+func runWindowsService(ctx *cli.Context) error {
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return errors.Wrap(err, "error opening the event log")
+	}
+	defer elog.Close()
+
+	w := &eventLogWriter{elog: elog}
+	log.SetFlags(0)
+	log.SetOutput(w)
+	fatalWriter = w
+	if err := redirectStderr(w); err != nil {
+		elog.Warning(1, err.Error())
+	}
+
+	stepPath := os.Getenv("STEPPATH")
+	if stepPath == "" {
+		stepPath = filepath.Join(os.Getenv("ProgramData"), serviceName)
+		os.Setenv("STEPPATH", stepPath)
+	}
+	if err := os.Chdir(stepPath); err != nil {
+		elog.Error(1, errors.Wrapf(err, "error changing to directory %s", stepPath).Error())
+		return err
+	}
+
+	configFile := ctx.Args().Get(0)
+	if configFile == "" {
+		configFile = filepath.Join(stepPath, "config", "ca.json")
+	}
+	passFile := ctx.String("password-file")
+	if passFile == "" && ctx.String("password-source") == "" {
+		if fn := filepath.Join(stepPath, "password.txt"); fileExists(fn) {
+			passFile = fn
+		}
+	}
+
+	h := &windowsService{
+		run: func(handle func(*ca.CA)) error {
+			return runCA(ctx, configFile, passFile, handle)
+		},
+	}
+	if err := svc.Run(serviceName, h); err != nil {
+		elog.Error(1, errors.Wrap(err, "error running the service").Error())
+		return err
+	}
+	return nil
+}
+
+// windowsService implements the svc.Handler interface.
+type windowsService struct {
+	run func(handle func(*ca.CA)) error
+}
+
+// Execute starts the CA and handles the requests of the service control
+// manager. Stop and shutdown requests stop the CA, and parameter change
+// requests reload its configuration.
+func (s *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+
+	status <- svc.Status{State: svc.StartPending}
+
+	started := make(chan *ca.CA, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(func(srv *ca.CA) {
+			started <- srv
+		})
+	}()
+
+	var srv *ca.CA
+	for {
+		select {
+		case srv = <-started:
+			log.Println("step-ca service started")
+			status <- svc.Status{State: svc.Running, Accepts: accepts}
+		case err := <-done:
+			if err != nil {
+				log.Printf("error running step-ca: %v", err)
+				return false, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				if srv == nil {
+					// The CA is still starting.
+					return false, 0
+				}
+				log.Println("shutting down ...")
+				if err := srv.Stop(); err != nil {
+					log.Printf("error stopping server: %v", err)
+				}
+			case svc.ParamChange:
+				if srv != nil {
+					log.Println("reloading ...")
+					if err := srv.Reload(); err != nil {
+						log.Printf("error reloading server: %+v", err)
+					}
+				}
+				status <- svc.Status{State: svc.Running, Accepts: accepts}
+			}
+		}
+	}
+}
+
+// eventLogWriter is an io.Writer that writes each line in the event log. Lines
+// with an error level, or starting with "error", are written as errors, and
+// lines with a warning level as warnings.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w *eventLogWriter) Write(b []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\r\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.writeLine(line)
+		}
+	}
+	return len(b), nil
+}
+
+func (w *eventLogWriter) writeLine(line string) {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(lower, "error"), strings.Contains(lower, "level=error"),
+		strings.Contains(lower, `"level":"error"`), strings.Contains(lower, "level=fatal"):
+		w.elog.Error(1, line)
+	case strings.Contains(lower, "level=warn"), strings.Contains(lower, `"level":"warning"`):
+		w.elog.Warning(1, line)
+	default:
+		w.elog.Info(1, line)
+	}
+}
+
+// redirectStderr replaces the standard error with a pipe that writes in the
+// given writer, so the request logs are written in the event log.
+func redirectStderr(w io.Writer) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "error redirecting the standard error")
+	}
+	os.Stderr = pw
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			w.Write(scanner.Bytes())
+		}
+	}()
+	return nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -67,6 +67,9 @@ func New(c *Config) (AuthDB, error) {
 	if c == nil {
 		return newSimpleDB(c)
 	}
+	if c.Type == MemoryType {
+		return newDB(NewMemoryDB())
+	}
 
 	opts := []nosql.Option{nosql.WithDatabase(c.Database),
 		nosql.WithValueDir(c.ValueDir)}
@@ -78,11 +81,16 @@ func New(c *Config) (AuthDB, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error opening database of Type %s with source %s", c.Type, c.DataSource)
 	}
+	return newDB(db)
+}
 
+// newDB creates the tables used by the authority in the given database.
+func newDB(db nosql.DB) (*DB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable,
+		revokedSSHCertsTable, leasesTable,
+		sshCertsInfoTable, sshCertsFingerprintsTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -170,6 +178,24 @@ func (db *DB) Revoke(rci *RevokedCertificateInfo) error {
 	}
 }
 
+// GetRevokedCertificates returns the information of all the revoked X.509
+// certificates.
+func (db *DB) GetRevokedCertificates() ([]*RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedCertsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing revoked certificates")
+	}
+	rcis := make([]*RevokedCertificateInfo, 0, len(entries))
+	for _, entry := range entries {
+		rci := new(RevokedCertificateInfo)
+		if err := json.Unmarshal(entry.Value, rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revoked certificate %s", entry.Key)
+		}
+		rcis = append(rcis, rci)
+	}
+	return rcis, nil
+}
+
 // RevokeSSH adds a SSH certificate to the revocation table.
 func (db *DB) RevokeSSH(rci *RevokedCertificateInfo) error {
 	rcib, err := json.Marshal(rci)
@@ -201,6 +227,23 @@ func (db *DB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
 	return cert, nil
 }
 
+// GetCertificates returns all the X.509 certificates stored in the database.
+func (db *DB) GetCertificates() ([]*x509.Certificate, error) {
+	entries, err := db.List(certsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing certificates")
+	}
+	certs := make([]*x509.Certificate, 0, len(entries))
+	for _, entry := range entries {
+		cert, err := x509.ParseCertificate(entry.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing certificate with serial number %s", entry.Key)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
 // StoreCertificate stores a certificate PEM.
 func (db *DB) StoreCertificate(crt *x509.Certificate) error {
 	if err := db.Set(certsTable, []byte(crt.SerialNumber.String()), crt.Raw); err != nil {
@@ -239,8 +282,16 @@ type sshHostPrincipalData struct {
 // StoreSSHCertificate stores an SSH certificate.
 func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
 	serial := strconv.FormatUint(crt.Serial, 10)
+	info := NewSSHCertificateInfo(crt)
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh certificate info")
+	}
 	tx := new(database.Tx)
 	tx.Set(sshCertsTable, []byte(serial), crt.Marshal())
+	tx.Set(sshCertsInfoTable, []byte(serial), infoData)
+	tx.Set(sshCertsFingerprintsTable, []byte(info.KeyFingerprint), []byte(serial))
+	tx.Set(sshCertsFingerprintsTable, []byte(info.CertificateFingerprint), []byte(serial))
 	if crt.CertType == ssh.HostCert {
 		for _, p := range crt.ValidPrincipals {
 			hostPrincipalData, err := json.Marshal(sshHostPrincipalData{
@@ -1,7 +1,12 @@
 package db
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"errors"
+	"math/big"
 	"testing"
 
 	"github.com/smallstep/assert"
@@ -94,6 +99,110 @@ func TestRevoke(t *testing.T) {
 	}
 }
 
+func TestGetRevokedCertificates(t *testing.T) {
+	tests := map[string]struct {
+		db   *DB
+		want []*RevokedCertificateInfo
+		err  error
+	}{
+		"error/list": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error listing revoked certificates: force"),
+		},
+		"error/unmarshal": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return []*database.Entry{{Key: []byte("sn"), Value: []byte("foo")}}, nil
+				},
+			}, true},
+			err: errors.New("error unmarshaling revoked certificate sn"),
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					assert.Equals(t, revokedCertsTable, bucket)
+					return []*database.Entry{
+						{Key: []byte("1"), Value: []byte(`{"Serial":"1","ReasonCode":1}`)},
+						{Key: []byte("2"), Value: []byte(`{"Serial":"2"}`)},
+					}, nil
+				},
+			}, true},
+			want: []*RevokedCertificateInfo{{Serial: "1", ReasonCode: 1}, {Serial: "2"}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rcis, err := tc.db.GetRevokedCertificates()
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, tc.want, rcis)
+			}
+		})
+	}
+}
+
+func TestGetCertificates(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{SerialNumber: big.NewInt(1)}, &x509.Certificate{}, key.Public(), key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		db   *DB
+		want []*x509.Certificate
+		err  error
+	}{
+		"error/list": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error listing certificates: force"),
+		},
+		"error/parse": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return []*database.Entry{{Key: []byte("1"), Value: []byte("foo")}}, nil
+				},
+			}, true},
+			err: errors.New("error parsing certificate with serial number 1"),
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					assert.Equals(t, certsTable, bucket)
+					return []*database.Entry{{Key: []byte("1"), Value: der}}, nil
+				},
+			}, true},
+			want: []*x509.Certificate{crt},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			certs, err := tc.db.GetCertificates()
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, tc.want, certs)
+			}
+		})
+	}
+}
+
 func TestUseToken(t *testing.T) {
 	type result struct {
 		err error
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var leasesTable = []byte("leases")
+
+// Lease is the lease of a background job. The replica of the CA holding a
+// lease that has not expired is the only one running the job.
+type Lease struct {
+	Name      string    `json:"name"`
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AcquireLease acquires or renews the lease with the given name for the holder
+// until now plus the given duration. It returns false if the lease is held by
+// another replica and it has not expired. The replicas must have their clocks
+// synchronized.
+func (db *DB) AcquireLease(name, holder string, now time.Time, d time.Duration) (bool, error) {
+	old, err := db.Get(leasesTable, []byte(name))
+	switch {
+	case nosql.IsErrNotFound(err):
+		old = nil
+	case err != nil:
+		return false, errors.Wrapf(err, "error loading lease %s", name)
+	default:
+		var l Lease
+		if err := json.Unmarshal(old, &l); err != nil {
+			return false, errors.Wrapf(err, "error unmarshaling lease %s", name)
+		}
+		if l.Holder != holder && now.Before(l.ExpiresAt) {
+			return false, nil
+		}
+	}
+
+	b, err := json.Marshal(Lease{
+		Name:      name,
+		Holder:    holder,
+		ExpiresAt: now.Add(d),
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling lease %s", name)
+	}
+	// Another replica took the lease if the swap fails.
+	_, swapped, err := db.CmpAndSwap(leasesTable, []byte(name), old, b)
+	if err != nil {
+		return false, errors.Wrapf(err, "error storing lease %s", name)
+	}
+	return swapped, nil
+}
+
+// ReleaseLease expires the lease with the given name if it is held by the
+// holder, so another replica can take it without waiting.
+func (db *DB) ReleaseLease(name, holder string) error {
+	old, err := db.Get(leasesTable, []byte(name))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return errors.Wrapf(err, "error loading lease %s", name)
+	}
+
+	var l Lease
+	if err := json.Unmarshal(old, &l); err != nil {
+		return errors.Wrapf(err, "error unmarshaling lease %s", name)
+	}
+	if l.Holder != holder {
+		return nil
+	}
+	l.ExpiresAt = time.Time{}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling lease %s", name)
+	}
+	if bytes.Equal(old, b) {
+		return nil
+	}
+	if _, _, err := db.CmpAndSwap(leasesTable, []byte(name), old, b); err != nil {
+		return errors.Wrapf(err, "error storing lease %s", name)
+	}
+	return nil
+}
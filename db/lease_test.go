@@ -0,0 +1,102 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+)
+
+// newLeaseTestDB returns a DB that keeps the values of the leases table in
+// memory.
+func newLeaseTestDB() *DB {
+	values := make(map[string][]byte)
+	return &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if v, ok := values[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			if v := values[string(key)]; !bytes.Equal(v, old) {
+				return v, false, nil
+			}
+			values[string(key)] = newval
+			return newval, true, nil
+		},
+	}, true}
+}
+
+func TestDB_AcquireLease(t *testing.T) {
+	db := newLeaseTestDB()
+	now := time.Now()
+	acquire := func(holder string, now time.Time, want bool) {
+		t.Helper()
+		got, err := db.AcquireLease("radius", holder, now, time.Minute)
+		if err != nil {
+			t.Fatalf("DB.AcquireLease() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("DB.AcquireLease(%s) = %v, want %v", holder, got, want)
+		}
+	}
+
+	acquire("ca-0", now, true)
+	acquire("ca-1", now.Add(time.Second), false)
+	// The holder renews the lease.
+	acquire("ca-0", now.Add(30*time.Second), true)
+	acquire("ca-1", now.Add(time.Minute), false)
+	// The lease expires.
+	acquire("ca-1", now.Add(91*time.Second), true)
+	acquire("ca-0", now.Add(92*time.Second), false)
+
+	// The released lease can be acquired right away.
+	if err := db.ReleaseLease("radius", "ca-0"); err != nil {
+		t.Fatalf("DB.ReleaseLease() error = %v", err)
+	}
+	acquire("ca-0", now.Add(93*time.Second), false)
+	if err := db.ReleaseLease("radius", "ca-1"); err != nil {
+		t.Fatalf("DB.ReleaseLease() error = %v", err)
+	}
+	acquire("ca-0", now.Add(94*time.Second), true)
+
+	// Releasing a missing lease is a no-op.
+	if err := db.ReleaseLease("missing", "ca-0"); err != nil {
+		t.Fatalf("DB.ReleaseLease() error = %v", err)
+	}
+}
+
+func TestDB_AcquireLease_errors(t *testing.T) {
+	tests := map[string]struct {
+		db *DB
+	}{
+		"fail/get": {&DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("force")
+			},
+		}, true}},
+		"fail/unmarshal": {&DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte("{"), nil
+			},
+		}, true}},
+		"fail/cmpAndSwap": {&DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("force")
+			},
+		}, true}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tc.db.AcquireLease("radius", "ca-0", time.Now(), time.Minute); err == nil {
+				t.Error("DB.AcquireLease() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+)
+
+// MemoryType is the type of the in-memory database, e.g. {"type": "memory"}.
+const MemoryType = "memory"
+
+// MemoryDB is an implementation of the nosql.DB interface that keeps the data
+// in memory. It supports all the features of the authority, the ACME server
+// and the admin API, and it's meant for integration tests and development,
+// the data is lost when the process exits.
+type MemoryDB struct {
+	mu     sync.RWMutex
+	tables map[string]map[string][]byte
+}
+
+// NewMemoryDB returns a new empty in-memory database.
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		tables: make(map[string]map[string][]byte),
+	}
+}
+
+// NewInMemory returns an AuthDB backed by a new in-memory database, with all
+// the tables used by the authority.
+func NewInMemory() (AuthDB, error) {
+	return newDB(NewMemoryDB())
+}
+
+// Open is a noop, the in-memory database does not have a data source.
+func (m *MemoryDB) Open(dataSourceName string, opt ...database.Option) error {
+	return nil
+}
+
+// Close is a noop, the data is kept until the database is garbage collected.
+func (m *MemoryDB) Close() error {
+	return nil
+}
+
+// CreateTable creates a table if it does not exist.
+func (m *MemoryDB) CreateTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createTable(bucket)
+	return nil
+}
+
+// DeleteTable deletes a table and all its data.
+func (m *MemoryDB) DeleteTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deleteTable(bucket)
+}
+
+// Get returns a copy of the value stored in the given bucket and key.
+func (m *MemoryDB) Get(bucket, key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.get(bucket, key)
+}
+
+// Set stores a copy of the given value in the bucket and key.
+func (m *MemoryDB) Set(bucket, key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.set(bucket, key, value)
+}
+
+// Del deletes the value stored in the given bucket and key.
+func (m *MemoryDB) Del(bucket, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.del(bucket, key)
+}
+
+// CmpAndSwap stores the new value if the current value is the old one, a nil
+// old value means that the key must not exist. It returns the value after the
+// operation and whether the value was swapped.
+func (m *MemoryDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cmpAndSwap(bucket, key, oldValue, newValue)
+}
+
+// List returns all the entries of a bucket sorted by key.
+func (m *MemoryDB) List(bucket []byte) ([]*database.Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tables[string(bucket)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	entries := make([]*database.Entry, 0, len(t))
+	for k, v := range t {
+		entries = append(entries, &database.Entry{
+			Bucket: copyBytes(bucket),
+			Key:    []byte(k),
+			Value:  copyBytes(v),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	return entries, nil
+}
+
+// Update runs the operations of the transaction atomically. If an operation
+// fails, none of the changes are applied.
+func (m *MemoryDB) Update(tx *database.Tx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Run the transaction in a copy of the tables.
+	backup := m.tables
+	m.tables = make(map[string]map[string][]byte, len(backup))
+	for name, t := range backup {
+		cp := make(map[string][]byte, len(t))
+		for k, v := range t {
+			cp[k] = v
+		}
+		m.tables[name] = cp
+	}
+
+	var err error
+	for _, op := range tx.Operations {
+		switch op.Cmd {
+		case database.CreateTable:
+			m.createTable(op.Bucket)
+		case database.DeleteTable:
+			err = m.deleteTable(op.Bucket)
+		case database.Get:
+			op.Result, err = m.get(op.Bucket, op.Key)
+		case database.Set:
+			err = m.set(op.Bucket, op.Key, op.Value)
+		case database.Delete:
+			err = m.del(op.Bucket, op.Key)
+		case database.CmpAndSwap:
+			op.Result, op.Swapped, err = m.cmpAndSwap(op.Bucket, op.Key, op.CmpValue, op.Value)
+		case database.CmpOrRollback:
+			var swapped bool
+			op.Result, swapped, err = m.cmpAndSwap(op.Bucket, op.Key, op.CmpValue, op.Value)
+			if err == nil && !swapped {
+				err = errors.Errorf("value of %s/%s has changed", op.Bucket, op.Key)
+			}
+		default:
+			err = database.ErrOpNotSupported
+		}
+		if err != nil {
+			m.tables = backup
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) createTable(bucket []byte) {
+	if _, ok := m.tables[string(bucket)]; !ok {
+		m.tables[string(bucket)] = make(map[string][]byte)
+	}
+}
+
+func (m *MemoryDB) deleteTable(bucket []byte) error {
+	if _, ok := m.tables[string(bucket)]; !ok {
+		return errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	delete(m.tables, string(bucket))
+	return nil
+}
+
+func (m *MemoryDB) get(bucket, key []byte) ([]byte, error) {
+	t, ok := m.tables[string(bucket)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	v, ok := t[string(key)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "%s/%s not found", bucket, key)
+	}
+	return copyBytes(v), nil
+}
+
+func (m *MemoryDB) set(bucket, key, value []byte) error {
+	t, ok := m.tables[string(bucket)]
+	if !ok {
+		return errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	t[string(key)] = copyBytes(value)
+	return nil
+}
+
+func (m *MemoryDB) del(bucket, key []byte) error {
+	t, ok := m.tables[string(bucket)]
+	if !ok {
+		return errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	delete(t, string(key))
+	return nil
+}
+
+func (m *MemoryDB) cmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	t, ok := m.tables[string(bucket)]
+	if !ok {
+		return nil, false, errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	current, exists := t[string(key)]
+	if oldValue == nil {
+		if exists {
+			return copyBytes(current), false, nil
+		}
+	} else if !exists || !bytes.Equal(current, oldValue) {
+		return copyBytes(current), false, nil
+	}
+	t[string(key)] = copyBytes(newValue)
+	return copyBytes(newValue), true, nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
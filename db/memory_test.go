@@ -0,0 +1,128 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestMemoryDB(t *testing.T) {
+	bucket := []byte("bucket")
+	m := NewMemoryDB()
+	assert.FatalError(t, m.Open("ignored"))
+
+	// Missing tables
+	_, err := m.Get(bucket, []byte("foo"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	assert.NotNil(t, m.Set(bucket, []byte("foo"), []byte("bar")))
+	_, err = m.List(bucket)
+	assert.True(t, nosql.IsErrNotFound(err))
+
+	assert.FatalError(t, m.CreateTable(bucket))
+	assert.FatalError(t, m.CreateTable(bucket))
+
+	// Get, Set and Del
+	_, err = m.Get(bucket, []byte("foo"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	value := []byte("bar")
+	assert.FatalError(t, m.Set(bucket, []byte("foo"), value))
+	value[0] = 'c'
+	b, err := m.Get(bucket, []byte("foo"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("bar"), b)
+	assert.FatalError(t, m.Set(bucket, []byte("abc"), []byte("zap")))
+	entries, err := m.List(bucket)
+	assert.FatalError(t, err)
+	assert.Equals(t, []*database.Entry{
+		{Bucket: bucket, Key: []byte("abc"), Value: []byte("zap")},
+		{Bucket: bucket, Key: []byte("foo"), Value: []byte("bar")},
+	}, entries)
+	assert.FatalError(t, m.Del(bucket, []byte("abc")))
+	_, err = m.Get(bucket, []byte("abc"))
+	assert.True(t, nosql.IsErrNotFound(err))
+
+	// CmpAndSwap
+	b, swapped, err := m.CmpAndSwap(bucket, []byte("foo"), nil, []byte("new"))
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+	assert.Equals(t, []byte("bar"), b)
+	b, swapped, err = m.CmpAndSwap(bucket, []byte("foo"), []byte("baz"), []byte("new"))
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+	assert.Equals(t, []byte("bar"), b)
+	b, swapped, err = m.CmpAndSwap(bucket, []byte("foo"), []byte("bar"), []byte("new"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	assert.Equals(t, []byte("new"), b)
+	b, swapped, err = m.CmpAndSwap(bucket, []byte("zap"), nil, []byte("zip"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	assert.Equals(t, []byte("zip"), b)
+
+	// Transactions
+	tx := &database.Tx{
+		Operations: []*database.TxEntry{
+			{Bucket: bucket, Key: []byte("foo"), Cmd: database.Get},
+			{Bucket: bucket, Key: []byte("foo"), Cmd: database.Delete},
+		},
+	}
+	assert.FatalError(t, m.Update(tx))
+	assert.Equals(t, []byte("new"), tx.Operations[0].Result)
+	_, err = m.Get(bucket, []byte("foo"))
+	assert.True(t, nosql.IsErrNotFound(err))
+
+	tx = &database.Tx{
+		Operations: []*database.TxEntry{
+			{Bucket: bucket, Key: []byte("zap"), Cmd: database.Delete},
+			{Bucket: bucket, Key: []byte("foo"), Cmd: database.Get},
+		},
+	}
+	assert.True(t, nosql.IsErrNotFound(m.Update(tx)))
+	b, err = m.Get(bucket, []byte("zap"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("zip"), b)
+
+	tx = &database.Tx{
+		Operations: []*database.TxEntry{
+			{Bucket: bucket, Key: []byte("zap"), Value: []byte("zop"), Cmd: database.Set},
+			{Bucket: bucket, Key: []byte("zap"), CmpValue: []byte("zip"), Value: []byte("zup"), Cmd: database.CmpOrRollback},
+		},
+	}
+	assert.NotNil(t, m.Update(tx))
+	b, err = m.Get(bucket, []byte("zap"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("zip"), b)
+
+	assert.FatalError(t, m.DeleteTable(bucket))
+	assert.NotNil(t, m.DeleteTable(bucket))
+	assert.FatalError(t, m.Close())
+}
+
+func TestNew_memory(t *testing.T) {
+	db, err := New(&Config{Type: MemoryType})
+	assert.FatalError(t, err)
+
+	ok, err := db.UseToken("foo", "bar")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = db.UseToken("foo", "bar")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+
+	isRevoked, err := db.IsRevoked("1234")
+	assert.FatalError(t, err)
+	assert.False(t, isRevoked)
+	assert.FatalError(t, db.Revoke(&RevokedCertificateInfo{Serial: "1234"}))
+	isRevoked, err = db.IsRevoked("1234")
+	assert.FatalError(t, err)
+	assert.True(t, isRevoked)
+	assert.Equals(t, ErrAlreadyExists, db.Revoke(&RevokedCertificateInfo{Serial: "1234"}))
+
+	db, err = NewInMemory()
+	assert.FatalError(t, err)
+	isRevoked, err = db.IsRevoked("1234")
+	assert.FatalError(t, err)
+	assert.False(t, isRevoked)
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	sshCertsInfoTable         = []byte("ssh_certs_info")
+	sshCertsFingerprintsTable = []byte("ssh_certs_fingerprints")
+)
+
+// SSHCertificateInfo is the record of a signed SSH certificate. The SHA256
+// fingerprints use the format of ssh-keygen and the OpenSSH logs, e.g.
+// "SHA256:base64", so the logs of a bastion can be joined with the issuance
+// of the certificates.
+type SSHCertificateInfo struct {
+	Serial                 string    `json:"serial"`
+	KeyID                  string    `json:"keyID"`
+	Type                   string    `json:"type"`
+	Principals             []string  `json:"principals"`
+	KeyFingerprint         string    `json:"keyFingerprint"`
+	CertificateFingerprint string    `json:"certificateFingerprint"`
+	ValidAfter             time.Time `json:"validAfter"`
+	ValidBefore            time.Time `json:"validBefore"`
+}
+
+// NewSSHCertificateInfo returns the record of the given certificate.
+func NewSSHCertificateInfo(crt *ssh.Certificate) *SSHCertificateInfo {
+	typ := "user"
+	if crt.CertType == ssh.HostCert {
+		typ = "host"
+	}
+	return &SSHCertificateInfo{
+		Serial:                 strconv.FormatUint(crt.Serial, 10),
+		KeyID:                  crt.KeyId,
+		Type:                   typ,
+		Principals:             crt.ValidPrincipals,
+		KeyFingerprint:         ssh.FingerprintSHA256(crt.Key),
+		CertificateFingerprint: ssh.FingerprintSHA256(crt),
+		ValidAfter:             time.Unix(int64(crt.ValidAfter), 0).UTC(),
+		ValidBefore:            time.Unix(int64(crt.ValidBefore), 0).UTC(),
+	}
+}
+
+// NormalizeSSHFingerprint returns the fingerprint in the format used to index
+// the certificates, adding the "SHA256:" prefix and removing the padding if
+// necessary.
+func NormalizeSSHFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimRight(strings.TrimSpace(fingerprint), "=")
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = "SHA256:" + fingerprint
+	}
+	return fingerprint
+}
+
+// GetSSHCertificateInfo returns the record of the certificate with the given
+// certificate fingerprint, or the record of the last certificate signed for
+// the key with the given fingerprint.
+func (db *DB) GetSSHCertificateInfo(fingerprint string) (*SSHCertificateInfo, error) {
+	fingerprint = NormalizeSSHFingerprint(fingerprint)
+	serial, err := db.Get(sshCertsFingerprintsTable, []byte(fingerprint))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "error loading fingerprint %s", fingerprint)
+	}
+	b, err := db.Get(sshCertsInfoTable, serial)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "error loading ssh certificate %s", serial)
+	}
+	info := new(SSHCertificateInfo)
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh certificate %s", serial)
+	}
+	return info, nil
+}
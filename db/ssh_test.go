@@ -0,0 +1,73 @@
+package db
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSSHCertificate(t *testing.T, serial uint64, key ssh.PublicKey) *ssh.Certificate {
+	t.Helper()
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(caKey)
+	assert.FatalError(t, err)
+	crt := &ssh.Certificate{
+		Key:             key,
+		Serial:          serial,
+		CertType:        ssh.UserCert,
+		KeyId:           "jane@example.com",
+		ValidPrincipals: []string{"jane"},
+		ValidAfter:      1600000000,
+		ValidBefore:     1600003600,
+	}
+	assert.FatalError(t, crt.SignCert(rand.Reader, signer))
+	return crt
+}
+
+func TestNormalizeSSHFingerprint(t *testing.T) {
+	assert.Equals(t, "SHA256:abc", NormalizeSSHFingerprint("SHA256:abc"))
+	assert.Equals(t, "SHA256:abc", NormalizeSSHFingerprint(" abc= "))
+}
+
+func TestDB_GetSSHCertificateInfo(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	assert.FatalError(t, err)
+
+	db, err := newDB(NewMemoryDB())
+	assert.FatalError(t, err)
+
+	crt1 := newTestSSHCertificate(t, 1, key)
+	crt2 := newTestSSHCertificate(t, 2, key)
+	assert.FatalError(t, db.StoreSSHCertificate(crt1))
+	assert.FatalError(t, db.StoreSSHCertificate(crt2))
+
+	info, err := db.GetSSHCertificateInfo(ssh.FingerprintSHA256(crt1))
+	assert.FatalError(t, err)
+	assert.Equals(t, &SSHCertificateInfo{
+		Serial:                 "1",
+		KeyID:                  "jane@example.com",
+		Type:                   "user",
+		Principals:             []string{"jane"},
+		KeyFingerprint:         ssh.FingerprintSHA256(key),
+		CertificateFingerprint: ssh.FingerprintSHA256(crt1),
+		ValidAfter:             info.ValidAfter,
+		ValidBefore:            info.ValidBefore,
+	}, info)
+	assert.Equals(t, int64(1600000000), info.ValidAfter.Unix())
+	assert.Equals(t, int64(1600003600), info.ValidBefore.Unix())
+
+	// The key fingerprint returns the last certificate
+	info, err = db.GetSSHCertificateInfo(ssh.FingerprintSHA256(key)[len("SHA256:"):])
+	assert.FatalError(t, err)
+	assert.Equals(t, "2", info.Serial)
+
+	_, err = db.GetSSHCertificateInfo("SHA256:missing")
+	assert.True(t, database.IsErrNotFound(err))
+}
@@ -0,0 +1,120 @@
+package coredns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/dnsupdate"
+)
+
+// DefaultPath is the default etcd path of the CoreDNS etcd plugin.
+const DefaultPath = "/skydns"
+
+// httpClient is the client used to connect to etcd.
+var httpClient = &http.Client{
+	Timeout: 15 * time.Second,
+}
+
+func init() {
+	dnsupdate.Register(dnsupdate.CoreDNS, func(ctx context.Context, opts dnsupdate.Options) (dnsupdate.Updater, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Updater writes the TXT records in the etcd cluster used by the CoreDNS etcd
+// plugin. It uses the JSON gateway of the etcd v3 API, the endpoints are
+// tried in order until one of them succeeds.
+type Updater struct {
+	endpoints []string
+	path      string
+	ttl       int
+}
+
+// record is the value of the etcd keys read by CoreDNS.
+type record struct {
+	Text string `json:"text"`
+	TTL  int    `json:"ttl"`
+}
+
+// New creates a new CoreDNS updater.
+func New(ctx context.Context, opts dnsupdate.Options) (*Updater, error) {
+	path := opts.Path
+	if path == "" {
+		path = DefaultPath
+	}
+	endpoints := make([]string, len(opts.Endpoints))
+	for i, e := range opts.Endpoints {
+		endpoints[i] = strings.TrimSuffix(e, "/")
+	}
+	return &Updater{
+		endpoints: endpoints,
+		path:      "/" + strings.Trim(path, "/"),
+		ttl:       opts.GetTTL(),
+	}, nil
+}
+
+// AddTXT adds a TXT record with the given value.
+func (u *Updater) AddTXT(ctx context.Context, name, value string) error {
+	b, err := json.Marshal(record{Text: value, TTL: u.ttl})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling record")
+	}
+	return u.do(ctx, "/v3/kv/put", map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(u.key(name, value))),
+		"value": base64.StdEncoding.EncodeToString(b),
+	})
+}
+
+// RemoveTXT removes the TXT record with the given value.
+func (u *Updater) RemoveTXT(ctx context.Context, name, value string) error {
+	return u.do(ctx, "/v3/kv/deleterange", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(u.key(name, value))),
+	})
+}
+
+// key returns the etcd key of a record, the path followed by the labels of
+// the name in reverse order. Every value uses a different key, so multiple
+// values of the same name can coexist.
+func (u *Updater) key(name, value string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	sum := sha256.Sum256([]byte(value))
+	return u.path + "/" + strings.Join(labels, "/") + "/" + hex.EncodeToString(sum[:8])
+}
+
+func (u *Updater) do(ctx context.Context, path string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling request")
+	}
+	var lastErr error
+	for _, endpoint := range u.endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(b))
+		if err != nil {
+			return errors.Wrap(err, "error creating etcd request")
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "error connecting to %s", endpoint)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = errors.Errorf("error updating etcd %s: status code %d", endpoint, resp.StatusCode)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
@@ -0,0 +1,84 @@
+package coredns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/certificates/dnsupdate"
+)
+
+func TestUpdater(t *testing.T) {
+	kv := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key, _ := base64.StdEncoding.DecodeString(body.Key)
+		value, _ := base64.StdEncoding.DecodeString(body.Value)
+		switch r.URL.Path {
+		case "/v3/kv/put":
+			kv[string(key)] = string(value)
+		case "/v3/kv/deleterange":
+			delete(kv, string(key))
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	// The first endpoint is not available.
+	u, err := New(ctx, dnsupdate.Options{
+		Type:      dnsupdate.CoreDNS,
+		Endpoints: []string{"http://127.0.0.1:1", srv.URL + "/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.AddTXT(ctx, "_acme-challenge.Foo.example.internal.", "one"); err != nil {
+		t.Fatalf("Updater.AddTXT() error = %v", err)
+	}
+	if err := u.AddTXT(ctx, "_acme-challenge.foo.example.internal", "two"); err != nil {
+		t.Fatalf("Updater.AddTXT() error = %v", err)
+	}
+	if len(kv) != 2 {
+		t.Fatalf("keys = %v, want 2 keys", kv)
+	}
+	for k, v := range kv {
+		if !strings.HasPrefix(k, "/skydns/internal/example/foo/_acme-challenge/") {
+			t.Errorf("key = %s, want prefix /skydns/internal/example/foo/_acme-challenge/", k)
+		}
+		var rec record
+		if err := json.Unmarshal([]byte(v), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if (rec.Text != "one" && rec.Text != "two") || rec.TTL != dnsupdate.DefaultTTL {
+			t.Errorf("record = %+v", rec)
+		}
+	}
+
+	if err := u.RemoveTXT(ctx, "_acme-challenge.foo.example.internal", "one"); err != nil {
+		t.Fatalf("Updater.RemoveTXT() error = %v", err)
+	}
+	if len(kv) != 1 {
+		t.Errorf("keys = %v, want 1 key", kv)
+	}
+
+	u.endpoints = []string{"http://127.0.0.1:1"}
+	if err := u.AddTXT(ctx, "_acme-challenge.foo.example.internal", "one"); err == nil {
+		t.Error("Updater.AddTXT() error = nil, want error")
+	}
+}
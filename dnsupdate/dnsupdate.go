@@ -0,0 +1,163 @@
+// Package dnsupdate creates and removes the TXT records of the ACME dns-01
+// challenges in internal DNS servers. It is used by the assisted dns-01 mode,
+// where the CA provisions the records on behalf of trusted ACME accounts whose
+// clients cannot update the DNS, e.g. appliances in split-horizon zones.
+package dnsupdate
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Type is the type of DNS backend used by an updater.
+type Type string
+
+const (
+	// RFC2136 is the type of the updaters that use dynamic DNS updates, RFC
+	// 2136, authenticated with TSIG.
+	RFC2136 Type = "rfc2136"
+	// Route53 is the type of the updaters that use Amazon Route 53 hosted
+	// zones.
+	Route53 Type = "route53"
+	// CoreDNS is the type of the updaters that write the records in the etcd
+	// cluster used by the CoreDNS etcd plugin.
+	CoreDNS Type = "coredns"
+)
+
+// DefaultTTL is the TTL of the TXT records if one is not configured.
+const DefaultTTL = 60
+
+// Options are the options used to create an updater.
+type Options struct {
+	// Type is the type of DNS backend.
+	Type Type `json:"type"`
+	// Server is the address of the DNS server that accepts the RFC 2136
+	// updates, e.g. "ns1.internal:53".
+	Server string `json:"server,omitempty"`
+	// Zone is the zone updated with RFC 2136, e.g. "example.internal".
+	Zone string `json:"zone,omitempty"`
+	// TSIGKeyName is the name of the TSIG key used to sign the updates.
+	TSIGKeyName string `json:"tsigKeyName,omitempty"`
+	// TSIGSecret is the base64-encoded secret of the TSIG key.
+	TSIGSecret string `json:"tsigSecret,omitempty"`
+	// TSIGAlgorithm is the algorithm of the TSIG key, hmac-sha256 by default.
+	TSIGAlgorithm string `json:"tsigAlgorithm,omitempty"`
+	// HostedZoneID is the id of the Route 53 hosted zone.
+	HostedZoneID string `json:"hostedZoneID,omitempty"`
+	// Region is the AWS region used to connect to Route 53.
+	Region string `json:"region,omitempty"`
+	// Profile is the AWS profile used to get the credentials.
+	Profile string `json:"profile,omitempty"`
+	// CredentialsFile is the AWS credentials file, by default the default
+	// credentials are used.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// Endpoints are the URLs of the etcd cluster used by CoreDNS, e.g.
+	// "https://etcd.internal:2379".
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Path is the etcd path configured in the CoreDNS etcd plugin, "/skydns"
+	// by default.
+	Path string `json:"path,omitempty"`
+	// TTL is the TTL of the TXT records in seconds.
+	TTL int `json:"ttl,omitempty"`
+}
+
+// Validate validates the updater options.
+func (o *Options) Validate() error {
+	switch Type(strings.ToLower(string(o.Type))) {
+	case RFC2136:
+		if o.Server == "" || o.Zone == "" {
+			return errors.Errorf("dns updater %s requires a server and a zone", o.Type)
+		}
+		if (o.TSIGKeyName == "") != (o.TSIGSecret == "") {
+			return errors.Errorf("dns updater %s requires both tsigKeyName and tsigSecret", o.Type)
+		}
+	case Route53:
+		if o.HostedZoneID == "" {
+			return errors.Errorf("dns updater %s requires a hostedZoneID", o.Type)
+		}
+	case CoreDNS:
+		if len(o.Endpoints) == 0 {
+			return errors.Errorf("dns updater %s requires at least one endpoint", o.Type)
+		}
+	case "":
+		return errors.New("dns updater type cannot be empty")
+	default:
+		return errors.Errorf("unsupported dns updater type '%s'", o.Type)
+	}
+	if o.TTL < 0 {
+		return errors.New("dns updater ttl cannot be negative")
+	}
+	return nil
+}
+
+// GetTTL returns the TTL of the TXT records in seconds.
+func (o *Options) GetTTL() int {
+	if o == nil || o.TTL == 0 {
+		return DefaultTTL
+	}
+	return o.TTL
+}
+
+// Updater is the interface implemented by the DNS backends. The names are
+// fully qualified, with or without the trailing dot, e.g.
+// "_acme-challenge.www.example.internal".
+type Updater interface {
+	// AddTXT adds a TXT record with the given value. Other values of the
+	// same name are kept.
+	AddTXT(ctx context.Context, name, value string) error
+	// RemoveTXT removes the TXT record with the given value.
+	RemoveTXT(ctx context.Context, name, value string) error
+}
+
+// NewUpdaterFunc is the function that creates an updater.
+type NewUpdaterFunc func(ctx context.Context, opts Options) (Updater, error)
+
+var registry = new(sync.Map)
+
+// Register adds to the registry the function used to create the updaters of
+// type t.
+func Register(t Type, fn NewUpdaterFunc) {
+	registry.Store(t, fn)
+}
+
+// LoadNewUpdaterFunc returns the function used to create the updaters of type
+// t.
+func LoadNewUpdaterFunc(t Type) (NewUpdaterFunc, bool) {
+	v, ok := registry.Load(t)
+	if !ok {
+		return nil, false
+	}
+	fn, ok := v.(NewUpdaterFunc)
+	return fn, ok
+}
+
+// New creates an updater with the given options.
+func New(ctx context.Context, opts Options) (Updater, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	t := Type(strings.ToLower(string(opts.Type)))
+	fn, ok := LoadNewUpdaterFunc(t)
+	if !ok {
+		return nil, errors.Errorf("unsupported dns updater type '%s'", t)
+	}
+	return fn(ctx, opts)
+}
+
+// Fqdn returns the given name with a trailing dot.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// InZone returns true if the given name is the zone or a subdomain of it.
+func InZone(name, zone string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(strings.Trim(zone, "."))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
@@ -0,0 +1,81 @@
+package dnsupdate
+
+import (
+	"context"
+	"testing"
+)
+
+type mockUpdater struct{}
+
+func (m *mockUpdater) AddTXT(ctx context.Context, name, value string) error {
+	return nil
+}
+
+func (m *mockUpdater) RemoveTXT(ctx context.Context, name, value string) error {
+	return nil
+}
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"ok rfc2136", Options{Type: "rfc2136", Server: "ns1.internal:53", Zone: "example.internal", TSIGKeyName: "acme", TSIGSecret: "c2VjcmV0"}, false},
+		{"ok rfc2136 no tsig", Options{Type: "RFC2136", Server: "ns1.internal:53", Zone: "example.internal"}, false},
+		{"ok route53", Options{Type: "route53", HostedZoneID: "Z123"}, false},
+		{"ok coredns", Options{Type: "coredns", Endpoints: []string{"http://etcd:2379"}, TTL: 30}, false},
+		{"fail empty", Options{}, true},
+		{"fail type", Options{Type: "bind"}, true},
+		{"fail server", Options{Type: "rfc2136", Zone: "example.internal"}, true},
+		{"fail zone", Options{Type: "rfc2136", Server: "ns1.internal:53"}, true},
+		{"fail tsig", Options{Type: "rfc2136", Server: "ns1.internal:53", Zone: "example.internal", TSIGKeyName: "acme"}, true},
+		{"fail hostedZoneID", Options{Type: "route53"}, true},
+		{"fail endpoints", Options{Type: "coredns"}, true},
+		{"fail ttl", Options{Type: "route53", HostedZoneID: "Z123", TTL: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	Register(Route53, func(ctx context.Context, opts Options) (Updater, error) {
+		return &mockUpdater{}, nil
+	})
+	t.Cleanup(func() {
+		registry.Delete(Route53)
+	})
+
+	if _, err := New(context.Background(), Options{Type: "Route53", HostedZoneID: "Z123"}); err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+	if _, err := New(context.Background(), Options{Type: "rfc2136", Server: "ns1.internal:53", Zone: "example.internal"}); err == nil {
+		t.Error("New() error = nil, want unsupported updater")
+	}
+	if _, err := New(context.Background(), Options{Type: "route53"}); err == nil {
+		t.Error("New() error = nil, want validation error")
+	}
+}
+
+func TestInZone(t *testing.T) {
+	tests := []struct {
+		name, zone string
+		want       bool
+	}{
+		{"_acme-challenge.foo.example.internal", "example.internal", true},
+		{"_acme-challenge.foo.example.internal.", "Example.Internal.", true},
+		{"example.internal", "example.internal", true},
+		{"_acme-challenge.fooexample.internal", "example.internal", false},
+		{"_acme-challenge.foo.example.com", "example.internal", false},
+	}
+	for _, tt := range tests {
+		if got := InZone(tt.name, tt.zone); got != tt.want {
+			t.Errorf("InZone(%q, %q) = %v, want %v", tt.name, tt.zone, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package rfc2136
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/dnsupdate"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultTimeout is the maximum time to wait for the response of an update if
+// the context does not have a deadline.
+const DefaultTimeout = 10 * time.Second
+
+// tsigFudge is the time difference, in seconds, allowed by the server when it
+// verifies the TSIG signature.
+const tsigFudge = 300
+
+const (
+	opcodeUpdate = dnsmessage.OpCode(5)
+	typeTSIG     = dnsmessage.Type(250)
+	classNone    = dnsmessage.Class(254)
+	classAny     = dnsmessage.Class(255)
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha224": sha256.New224,
+	"hmac-sha256": sha256.New,
+	"hmac-sha384": sha512.New384,
+	"hmac-sha512": sha512.New,
+}
+
+func init() {
+	dnsupdate.Register(dnsupdate.RFC2136, func(ctx context.Context, opts dnsupdate.Options) (dnsupdate.Updater, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Updater sends dynamic DNS updates, RFC 2136, to a DNS server over UDP. The
+// updates are signed with TSIG if a key is configured.
+type Updater struct {
+	server    string
+	zone      string
+	ttl       uint32
+	keyName   string
+	secret    []byte
+	algorithm string
+	hash      func() hash.Hash
+	now       func() time.Time
+}
+
+// New creates a new RFC 2136 updater.
+func New(ctx context.Context, opts dnsupdate.Options) (*Updater, error) {
+	u := &Updater{
+		server: opts.Server,
+		zone:   dnsupdate.Fqdn(opts.Zone),
+		ttl:    uint32(opts.GetTTL()),
+		now:    time.Now,
+	}
+	if _, _, err := net.SplitHostPort(u.server); err != nil {
+		u.server = net.JoinHostPort(u.server, "53")
+	}
+	if opts.TSIGKeyName != "" {
+		secret, err := base64.StdEncoding.DecodeString(opts.TSIGSecret)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding tsigSecret")
+		}
+		algorithm := strings.ToLower(strings.TrimSuffix(opts.TSIGAlgorithm, "."))
+		if algorithm == "" {
+			algorithm = "hmac-sha256"
+		}
+		fn, ok := tsigAlgorithms[algorithm]
+		if !ok {
+			return nil, errors.Errorf("unsupported tsigAlgorithm '%s'", opts.TSIGAlgorithm)
+		}
+		u.keyName = dnsupdate.Fqdn(strings.ToLower(opts.TSIGKeyName))
+		u.secret = secret
+		u.algorithm = algorithm + "."
+		u.hash = fn
+	}
+	return u, nil
+}
+
+// AddTXT adds a TXT record with the given value.
+func (u *Updater) AddTXT(ctx context.Context, name, value string) error {
+	return u.update(ctx, name, value, dnsmessage.ClassINET, u.ttl)
+}
+
+// RemoveTXT removes the TXT record with the given value.
+func (u *Updater) RemoveTXT(ctx context.Context, name, value string) error {
+	return u.update(ctx, name, value, classNone, 0)
+}
+
+func (u *Updater) update(ctx context.Context, name, value string, class dnsmessage.Class, ttl uint32) error {
+	if !dnsupdate.InZone(name, u.zone) {
+		return errors.Errorf("%s is not in the zone %s", name, u.zone)
+	}
+	msg, id, err := u.message(dnsupdate.Fqdn(name), value, class, ttl)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", u.server)
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to %s", u.server)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return errors.Wrapf(err, "error sending update to %s", u.server)
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return errors.Wrapf(err, "error reading response from %s", u.server)
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil || h.ID != id || !h.Response {
+			// Ignore unrelated or malformed packets.
+			continue
+		}
+		if h.RCode != dnsmessage.RCodeSuccess {
+			return errors.Errorf("error updating %s: server %s responded with %s", name, u.server, h.RCode)
+		}
+		return nil
+	}
+}
+
+// message returns an update message that adds, or removes, the TXT record
+// with the given value, signed with TSIG if a key is configured.
+func (u *Updater) message(name, value string, class dnsmessage.Class, ttl uint32) ([]byte, uint16, error) {
+	zone, err := dnsmessage.NewName(u.zone)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "invalid zone %s", u.zone)
+	}
+	rrName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "invalid name %s", name)
+	}
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, 0, errors.Wrap(err, "error generating message id")
+	}
+	id := binary.BigEndian.Uint16(b[:])
+
+	// The zone is sent in the question section, and the records to update in
+	// the authority section.
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: opcodeUpdate})
+	if err := builder.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, errors.Wrap(err, "error building update")
+	}
+	if err := builder.StartAuthorities(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.TXTResource(dnsmessage.ResourceHeader{
+		Name:  rrName,
+		Class: class,
+		TTL:   ttl,
+	}, dnsmessage.TXTResource{TXT: []string{value}}); err != nil {
+		return nil, 0, errors.Wrap(err, "error building update")
+	}
+	msg, err := builder.Finish()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error building update")
+	}
+	if u.hash == nil {
+		return msg, id, nil
+	}
+	return u.sign(msg, id), id, nil
+}
+
+// sign appends a TSIG record, RFC 8945, to the given message.
+func (u *Updater) sign(msg []byte, id uint16) []byte {
+	keyName := packName(u.keyName)
+	algorithm := packName(u.algorithm)
+	timeSigned := uint64(u.now().Unix())
+
+	// The MAC is computed over the message and the TSIG variables.
+	mac := hmac.New(u.hash, u.secret)
+	mac.Write(msg)
+	mac.Write(keyName)
+	mac.Write(uint16Bytes(uint16(classAny)))
+	mac.Write([]byte{0, 0, 0, 0})
+	mac.Write(algorithm)
+	mac.Write(uint48Bytes(timeSigned))
+	mac.Write(uint16Bytes(tsigFudge))
+	mac.Write([]byte{0, 0, 0, 0}) // error and other len
+	sum := mac.Sum(nil)
+
+	var rdata []byte
+	rdata = append(rdata, algorithm...)
+	rdata = append(rdata, uint48Bytes(timeSigned)...)
+	rdata = append(rdata, uint16Bytes(tsigFudge)...)
+	rdata = append(rdata, uint16Bytes(uint16(len(sum)))...)
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, uint16Bytes(id)...)
+	rdata = append(rdata, 0, 0, 0, 0) // error and other len
+
+	signed := append([]byte{}, msg...)
+	signed = append(signed, keyName...)
+	signed = append(signed, uint16Bytes(uint16(typeTSIG))...)
+	signed = append(signed, uint16Bytes(uint16(classAny))...)
+	signed = append(signed, 0, 0, 0, 0)
+	signed = append(signed, uint16Bytes(uint16(len(rdata)))...)
+	signed = append(signed, rdata...)
+
+	// Increment the number of additional records.
+	arcount := binary.BigEndian.Uint16(signed[10:12])
+	binary.BigEndian.PutUint16(signed[10:12], arcount+1)
+	return signed
+}
+
+// packName returns the uncompressed wire format of a fully qualified name.
+func packName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func uint16Bytes(v uint16) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func uint48Bytes(v uint64) []byte {
+	return []byte{byte(v >> 40), byte(v >> 32), byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
@@ -0,0 +1,170 @@
+package rfc2136
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/dnsupdate"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type update struct {
+	zone  string
+	name  string
+	class dnsmessage.Class
+	ttl   uint32
+	txt   []string
+}
+
+// startServer starts a DNS server that verifies the TSIG signature of the
+// updates, and responds with the given rcode.
+func startServer(t *testing.T, secret []byte, rcode dnsmessage.RCode) (string, <-chan update) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ch := make(chan update, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msg := buf[:n]
+			var p dnsmessage.Parser
+			h, err := p.Start(msg)
+			if err != nil || h.OpCode != opcodeUpdate {
+				continue
+			}
+			q, _ := p.Question()
+			p.SkipAllQuestions()
+			p.SkipAllAnswers()
+			rh, _ := p.AuthorityHeader()
+			txt, _ := p.TXTResource()
+			ch <- update{zone: q.Name.String(), name: rh.Name.String(), class: rh.Class, ttl: rh.TTL, txt: txt.TXT}
+
+			res := dnsmessage.Header{ID: h.ID, Response: true, OpCode: opcodeUpdate, RCode: rcode}
+			if secret != nil && !verify(msg, secret) {
+				res.RCode = dnsmessage.RCode(9) // NOTAUTH
+			}
+			b := dnsmessage.NewBuilder(nil, res)
+			out, _ := b.Finish()
+			conn.WriteTo(out, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), ch
+}
+
+// verify verifies the TSIG record of a message signed with hmac-sha256 by the
+// "acme." key.
+func verify(msg, secret []byte) bool {
+	keyName := packName("acme.")
+	i := bytes.LastIndex(msg, append(keyName, 0, 250))
+	if i < 0 {
+		return false
+	}
+	unsigned := append([]byte{}, msg[:i]...)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(unsigned[10:12])-1)
+
+	rdata := msg[i+len(keyName)+10:]
+	algorithm := packName("hmac-sha256.")
+	if !bytes.HasPrefix(rdata, algorithm) {
+		return false
+	}
+	rdata = rdata[len(algorithm):]
+	timeSigned, fudge := rdata[:6], rdata[6:8]
+	size := binary.BigEndian.Uint16(rdata[8:10])
+	sum := rdata[10 : 10+size]
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(unsigned)
+	mac.Write(keyName)
+	mac.Write([]byte{0, 255, 0, 0, 0, 0})
+	mac.Write(algorithm)
+	mac.Write(timeSigned)
+	mac.Write(fudge)
+	mac.Write([]byte{0, 0, 0, 0})
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+func TestUpdater(t *testing.T) {
+	secret := []byte("the-secret")
+	addr, ch := startServer(t, secret, dnsmessage.RCodeSuccess)
+
+	u, err := New(context.Background(), dnsupdate.Options{
+		Type:        dnsupdate.RFC2136,
+		Server:      addr,
+		Zone:        "example.internal",
+		TSIGKeyName: "acme",
+		TSIGSecret:  "dGhlLXNlY3JldA==",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := u.AddTXT(ctx, "_acme-challenge.foo.example.internal", "the-value"); err != nil {
+		t.Fatalf("Updater.AddTXT() error = %v", err)
+	}
+	got := <-ch
+	if got.zone != "example.internal." || got.name != "_acme-challenge.foo.example.internal." ||
+		got.class != dnsmessage.ClassINET || got.ttl != dnsupdate.DefaultTTL || len(got.txt) != 1 || got.txt[0] != "the-value" {
+		t.Errorf("Updater.AddTXT() sent %+v", got)
+	}
+
+	if err := u.RemoveTXT(ctx, "_acme-challenge.foo.example.internal.", "the-value"); err != nil {
+		t.Fatalf("Updater.RemoveTXT() error = %v", err)
+	}
+	got = <-ch
+	if got.class != classNone || got.ttl != 0 || got.txt[0] != "the-value" {
+		t.Errorf("Updater.RemoveTXT() sent %+v", got)
+	}
+
+	if err := u.AddTXT(ctx, "_acme-challenge.foo.example.com", "the-value"); err == nil {
+		t.Error("Updater.AddTXT() error = nil, want name not in zone")
+	}
+}
+
+func TestUpdater_fail(t *testing.T) {
+	// Wrong TSIG secret
+	addr, ch := startServer(t, []byte("other-secret"), dnsmessage.RCodeSuccess)
+	u, err := New(context.Background(), dnsupdate.Options{
+		Type:        dnsupdate.RFC2136,
+		Server:      addr,
+		Zone:        "example.internal",
+		TSIGKeyName: "acme",
+		TSIGSecret:  "dGhlLXNlY3JldA==",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := u.AddTXT(ctx, "_acme-challenge.foo.example.internal", "the-value"); err == nil {
+		t.Error("Updater.AddTXT() error = nil, want NOTAUTH")
+	}
+	<-ch
+
+	// Unsupported algorithm
+	if _, err := New(context.Background(), dnsupdate.Options{
+		Type:          dnsupdate.RFC2136,
+		Server:        addr,
+		Zone:          "example.internal",
+		TSIGKeyName:   "acme",
+		TSIGSecret:    "dGhlLXNlY3JldA==",
+		TSIGAlgorithm: "hmac-md5",
+	}); err == nil {
+		t.Error("New() error = nil, want unsupported algorithm")
+	}
+}
@@ -0,0 +1,163 @@
+package route53
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/dnsupdate"
+)
+
+// Route53Client defines the methods on the Route 53 client that this package
+// will use. This interface will be used for unit testing.
+type Route53Client interface {
+	ListResourceRecordSetsWithContext(ctx aws.Context, input *route53.ListResourceRecordSetsInput, opts ...request.Option) (*route53.ListResourceRecordSetsOutput, error)
+	ChangeResourceRecordSetsWithContext(ctx aws.Context, input *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error)
+	WaitUntilResourceRecordSetsChangedWithContext(ctx aws.Context, input *route53.GetChangeInput, opts ...request.WaiterOption) error
+}
+
+var newRoute53Client = func(o session.Options) (Route53Client, error) {
+	sess, err := session.NewSessionWithOptions(o)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating AWS session")
+	}
+	return route53.New(sess), nil
+}
+
+func init() {
+	dnsupdate.Register(dnsupdate.Route53, func(ctx context.Context, opts dnsupdate.Options) (dnsupdate.Updater, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Updater updates the TXT records of a Route 53 hosted zone. The changes are
+// only returned once they have been propagated to all the Route 53 servers.
+type Updater struct {
+	hostedZoneID string
+	ttl          int64
+	client       Route53Client
+}
+
+// New creates a new Route 53 updater. By default, sessions will be created
+// using the credentials in `~/.aws/credentials`, but this can be overridden
+// using the CredentialsFile option, the Region and Profile can also be
+// configured.
+func New(ctx context.Context, opts dnsupdate.Options) (*Updater, error) {
+	var o session.Options
+	o.Profile = opts.Profile
+	if opts.Region != "" {
+		o.Config.Region = aws.String(opts.Region)
+	}
+	if opts.CredentialsFile != "" {
+		o.SharedConfigFiles = []string{opts.CredentialsFile}
+	}
+	client, err := newRoute53Client(o)
+	if err != nil {
+		return nil, err
+	}
+	return &Updater{
+		hostedZoneID: opts.HostedZoneID,
+		ttl:          int64(opts.GetTTL()),
+		client:       client,
+	}, nil
+}
+
+// AddTXT adds the given value to the TXT record set of the name.
+func (u *Updater) AddTXT(ctx context.Context, name, value string) error {
+	name = dnsupdate.Fqdn(strings.ToLower(name))
+	values, err := u.values(ctx, name)
+	if err != nil {
+		return err
+	}
+	quoted := strconv.Quote(value)
+	for _, v := range values {
+		if v == quoted {
+			return nil
+		}
+	}
+	return u.change(ctx, route53.ChangeActionUpsert, name, append(values, quoted))
+}
+
+// RemoveTXT removes the given value from the TXT record set of the name, the
+// record set is deleted if it does not have more values.
+func (u *Updater) RemoveTXT(ctx context.Context, name, value string) error {
+	name = dnsupdate.Fqdn(strings.ToLower(name))
+	values, err := u.values(ctx, name)
+	if err != nil {
+		return err
+	}
+	quoted := strconv.Quote(value)
+	remaining := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != quoted {
+			remaining = append(remaining, v)
+		}
+	}
+	switch {
+	case len(remaining) == len(values):
+		return nil
+	case len(remaining) == 0:
+		return u.change(ctx, route53.ChangeActionDelete, name, values)
+	default:
+		return u.change(ctx, route53.ChangeActionUpsert, name, remaining)
+	}
+}
+
+// values returns the current values of the TXT record set of the name.
+func (u *Updater) values(ctx context.Context, name string) ([]string, error) {
+	resp, err := u.client.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(u.hostedZoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: aws.String(route53.RRTypeTxt),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing TXT records of %s", name)
+	}
+	var values []string
+	for _, rrs := range resp.ResourceRecordSets {
+		if !strings.EqualFold(aws.StringValue(rrs.Name), name) || aws.StringValue(rrs.Type) != route53.RRTypeTxt {
+			continue
+		}
+		for _, rr := range rrs.ResourceRecords {
+			values = append(values, aws.StringValue(rr.Value))
+		}
+	}
+	return values, nil
+}
+
+func (u *Updater) change(ctx context.Context, action, name string, values []string) error {
+	records := make([]*route53.ResourceRecord, len(values))
+	for i, v := range values {
+		records[i] = &route53.ResourceRecord{Value: aws.String(v)}
+	}
+	resp, err := u.client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(u.hostedZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String("ACME dns-01 challenge"),
+			Changes: []*route53.Change{{
+				Action: aws.String(action),
+				ResourceRecordSet: &route53.ResourceRecordSet{
+					Name:            aws.String(name),
+					Type:            aws.String(route53.RRTypeTxt),
+					TTL:             aws.Int64(u.ttl),
+					ResourceRecords: records,
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error updating TXT records of %s", name)
+	}
+	if err := u.client.WaitUntilResourceRecordSetsChangedWithContext(ctx, &route53.GetChangeInput{
+		Id: resp.ChangeInfo.Id,
+	}); err != nil {
+		return errors.Wrapf(err, "error waiting for the update of the TXT records of %s", name)
+	}
+	return nil
+}
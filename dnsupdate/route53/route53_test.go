@@ -0,0 +1,113 @@
+package route53
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/smallstep/certificates/dnsupdate"
+)
+
+type mockRoute53 struct {
+	records map[string][]string
+	actions []string
+	err     error
+}
+
+func (m *mockRoute53) ListResourceRecordSetsWithContext(ctx aws.Context, input *route53.ListResourceRecordSetsInput, opts ...request.Option) (*route53.ListResourceRecordSetsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	out := &route53.ListResourceRecordSetsOutput{}
+	if values, ok := m.records[*input.StartRecordName]; ok {
+		rrs := &route53.ResourceRecordSet{Name: input.StartRecordName, Type: aws.String(route53.RRTypeTxt)}
+		for _, v := range values {
+			rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(v)})
+		}
+		out.ResourceRecordSets = []*route53.ResourceRecordSet{rrs}
+	}
+	return out, nil
+}
+
+func (m *mockRoute53) ChangeResourceRecordSetsWithContext(ctx aws.Context, input *route53.ChangeResourceRecordSetsInput, opts ...request.Option) (*route53.ChangeResourceRecordSetsOutput, error) {
+	c := input.ChangeBatch.Changes[0]
+	name := *c.ResourceRecordSet.Name
+	m.actions = append(m.actions, *c.Action)
+	switch *c.Action {
+	case route53.ChangeActionDelete:
+		delete(m.records, name)
+	default:
+		var values []string
+		for _, rr := range c.ResourceRecordSet.ResourceRecords {
+			values = append(values, *rr.Value)
+		}
+		m.records[name] = values
+	}
+	return &route53.ChangeResourceRecordSetsOutput{
+		ChangeInfo: &route53.ChangeInfo{Id: aws.String("change-id")},
+	}, nil
+}
+
+func (m *mockRoute53) WaitUntilResourceRecordSetsChangedWithContext(ctx aws.Context, input *route53.GetChangeInput, opts ...request.WaiterOption) error {
+	if *input.Id != "change-id" {
+		return errors.New("unexpected change id")
+	}
+	return nil
+}
+
+func TestUpdater(t *testing.T) {
+	m := &mockRoute53{records: map[string][]string{}}
+	tmp := newRoute53Client
+	t.Cleanup(func() {
+		newRoute53Client = tmp
+	})
+	newRoute53Client = func(o session.Options) (Route53Client, error) {
+		return m, nil
+	}
+
+	ctx := context.Background()
+	u, err := New(ctx, dnsupdate.Options{Type: dnsupdate.Route53, HostedZoneID: "Z123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "_acme-challenge.foo.example.internal."
+	if err := u.AddTXT(ctx, "_acme-challenge.foo.example.internal", "one"); err != nil {
+		t.Fatalf("Updater.AddTXT() error = %v", err)
+	}
+	if err := u.AddTXT(ctx, name, "two"); err != nil {
+		t.Fatalf("Updater.AddTXT() error = %v", err)
+	}
+	if err := u.AddTXT(ctx, name, "two"); err != nil {
+		t.Fatalf("Updater.AddTXT() error = %v", err)
+	}
+	if want := []string{`"one"`, `"two"`}; !reflect.DeepEqual(m.records[name], want) {
+		t.Errorf("records = %v, want %v", m.records[name], want)
+	}
+
+	if err := u.RemoveTXT(ctx, name, "one"); err != nil {
+		t.Fatalf("Updater.RemoveTXT() error = %v", err)
+	}
+	if err := u.RemoveTXT(ctx, name, "two"); err != nil {
+		t.Fatalf("Updater.RemoveTXT() error = %v", err)
+	}
+	if err := u.RemoveTXT(ctx, name, "two"); err != nil {
+		t.Fatalf("Updater.RemoveTXT() error = %v", err)
+	}
+	if _, ok := m.records[name]; ok {
+		t.Errorf("records = %v, want none", m.records[name])
+	}
+	if want := []string{"UPSERT", "UPSERT", "UPSERT", "DELETE"}; !reflect.DeepEqual(m.actions, want) {
+		t.Errorf("actions = %v, want %v", m.actions, want)
+	}
+
+	m.err = errors.New("force")
+	if err := u.AddTXT(ctx, name, "one"); err == nil {
+		t.Error("Updater.AddTXT() error = nil, want error")
+	}
+}
@@ -0,0 +1,87 @@
+package errs
+
+import "net/http"
+
+// Error codes included in the JSON representation of the errors. The codes
+// are stable, clients can use them to identify the cause of an error instead
+// of parsing the message.
+const (
+	// CodeBadRequest is the default code of 400 errors.
+	CodeBadRequest = "badRequest"
+	// CodeUnauthorized is the default code of 401 errors.
+	CodeUnauthorized = "unauthorized"
+	// CodeForbidden is the default code of 403 errors.
+	CodeForbidden = "forbidden"
+	// CodeNotFound is the default code of 404 errors.
+	CodeNotFound = "notFound"
+	// CodeTooManyRequests is the default code of 429 errors.
+	CodeTooManyRequests = "tooManyRequests"
+	// CodeInternalServerError is the default code of 500 errors.
+	CodeInternalServerError = "internalServerError"
+	// CodeNotImplemented is the default code of 501 errors.
+	CodeNotImplemented = "notImplemented"
+	// CodeUnexpected is the default code of errors with any other status.
+	CodeUnexpected = "unexpected"
+
+	// CodeBadCertificateRequest is used when the certificate request cannot be
+	// parsed or its signature is not valid.
+	CodeBadCertificateRequest = "badCertificateRequest"
+	// CodeMalformedRequest is used when the request body is not valid JSON,
+	// or it has unknown fields or fields with values of the wrong type.
+	CodeMalformedRequest = "malformedRequest"
+	// CodeTemplateError is used when the certificate template cannot be
+	// rendered.
+	CodeTemplateError = "templateError"
+	// CodeBlockedKey is used when the public key is known to be compromised.
+	CodeBlockedKey = "blockedKey"
+	// CodeKeyPolicyViolation is used when the public key does not satisfy the
+	// key policy of the provisioner.
+	CodeKeyPolicyViolation = "keyPolicyViolation"
+	// CodeQuotaExceeded is used when an issuance quota has been reached.
+	CodeQuotaExceeded = "quotaExceeded"
+	// CodePolicyDenied is used when a policy hook denies a request.
+	CodePolicyDenied = "policyDenied"
+	// CodeKeyAttestationRequired is used when the public key does not have a
+	// valid hardware key attestation.
+	CodeKeyAttestationRequired = "keyAttestationRequired"
+	// CodeApprovalRequired is used when a request is held until an
+	// administrator approves it.
+	CodeApprovalRequired = "approvalRequired"
+	// CodeRenewalTooEarly is used when a certificate is renewed before the
+	// renewal window of its provisioner.
+	CodeRenewalTooEarly = "renewalTooEarly"
+	// CodeOutsideChangeWindow is used when a new certificate is requested
+	// outside the change windows of the provisioner.
+	CodeOutsideChangeWindow = "outsideChangeWindow"
+)
+
+// DocumentationBaseURL is the prefix of the urls that document the error
+// codes.
+var DocumentationBaseURL = "https://smallstep.com/docs/step-ca/errors#"
+
+// DocumentationURL returns the url that documents the given error code.
+func DocumentationURL(code string) string {
+	return DocumentationBaseURL + code
+}
+
+// StatusCodeToCode returns the default error code for an HTTP status code.
+func StatusCodeToCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusInternalServerError:
+		return CodeInternalServerError
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	default:
+		return CodeUnexpected
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -54,18 +55,39 @@ func WithKeyVal(key string, val interface{}) Option {
 	}
 }
 
+// WithCode returns an Option that sets the machine-readable code of the error.
+func WithCode(code string) Option {
+	return func(e *Error) error {
+		e.Code = code
+		return e
+	}
+}
+
+// WithRetryAfter returns an Option that sets the time the client should wait
+// before retrying the request. It's sent in the Retry-After header.
+func WithRetryAfter(d time.Duration) Option {
+	return func(e *Error) error {
+		e.RetryAfter = d
+		return e
+	}
+}
+
 // Error represents the CA API errors.
 type Error struct {
-	Status  int
-	Err     error
-	Msg     string
-	Details map[string]interface{}
+	Status     int
+	Code       string
+	Err        error
+	Msg        string
+	Details    map[string]interface{}
+	RetryAfter time.Duration
 }
 
 // ErrorResponse represents an error in JSON format.
 type ErrorResponse struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Status           int    `json:"status"`
+	Code             string `json:"code"`
+	Message          string `json:"message"`
+	DocumentationURL string `json:"documentationURL"`
 }
 
 // Cause implements the errors.Causer interface and returns the original error.
@@ -84,6 +106,15 @@ func (e *Error) StatusCode() int {
 	return e.Status
 }
 
+// ErrorCode returns the machine-readable code of the error. If a code is not
+// set, the default one for the status code is returned.
+func (e *Error) ErrorCode() string {
+	if len(e.Code) > 0 {
+		return e.Code
+	}
+	return StatusCodeToCode(e.Status)
+}
+
 // Message returns a user friendly error, if one is set.
 func (e *Error) Message() string {
 	if len(e.Msg) > 0 {
@@ -132,7 +163,13 @@ func (e *Error) MarshalJSON() ([]byte, error) {
 	} else {
 		msg = http.StatusText(e.Status)
 	}
-	return json.Marshal(&ErrorResponse{Status: e.Status, Message: msg})
+	code := e.ErrorCode()
+	return json.Marshal(&ErrorResponse{
+		Status:           e.Status,
+		Code:             code,
+		Message:          msg,
+		DocumentationURL: DocumentationURL(code),
+	})
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface for the Error struct.
@@ -142,6 +179,7 @@ func (e *Error) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	e.Status = er.Status
+	e.Code = er.Code
 	e.Err = fmt.Errorf(er.Message)
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 func TestError_MarshalJSON(t *testing.T) {
 	type fields struct {
 		Status int
+		Code   string
 		Err    error
 	}
 	tests := []struct {
@@ -17,13 +18,16 @@ func TestError_MarshalJSON(t *testing.T) {
 		want    []byte
 		wantErr bool
 	}{
-		{"ok", fields{400, fmt.Errorf("bad request")}, []byte(`{"status":400,"message":"Bad Request"}`), false},
-		{"ok no error", fields{500, nil}, []byte(`{"status":500,"message":"Internal Server Error"}`), false},
+		{"ok", fields{400, "", fmt.Errorf("bad request")}, []byte(`{"status":400,"code":"badRequest","message":"Bad Request","documentationURL":"https://smallstep.com/docs/step-ca/errors#badRequest"}`), false},
+		{"ok no error", fields{500, "", nil}, []byte(`{"status":500,"code":"internalServerError","message":"Internal Server Error","documentationURL":"https://smallstep.com/docs/step-ca/errors#internalServerError"}`), false},
+		{"ok code", fields{403, CodeBlockedKey, fmt.Errorf("blocked key")}, []byte(`{"status":403,"code":"blockedKey","message":"Forbidden","documentationURL":"https://smallstep.com/docs/step-ca/errors#blockedKey"}`), false},
+		{"ok unexpected", fields{418, "", fmt.Errorf("teapot")}, []byte(`{"status":418,"code":"unexpected","message":"I'm a teapot","documentationURL":"https://smallstep.com/docs/step-ca/errors#unexpected"}`), false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := &Error{
 				Status: tt.fields.Status,
+				Code:   tt.fields.Code,
 				Err:    tt.fields.Err,
 			}
 			got, err := e.MarshalJSON()
@@ -49,6 +53,7 @@ func TestError_UnmarshalJSON(t *testing.T) {
 		wantErr  bool
 	}{
 		{"ok", args{[]byte(`{"status":400,"message":"bad request"}`)}, &Error{Status: 400, Err: fmt.Errorf("bad request")}, false},
+		{"ok code", args{[]byte(`{"status":403,"code":"blockedKey","message":"blocked key"}`)}, &Error{Status: 403, Code: "blockedKey", Err: fmt.Errorf("blocked key")}, false},
 		{"fail", args{[]byte(`{"status":"400","message":"bad request"}`)}, &Error{}, true},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,155 @@
+package errs
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/smallstep/certificates/logging"
+)
+
+// MessageCatalog contains the user-facing messages that replace the default
+// details of the errors. The messages are indexed by error code and language
+// tag.
+type MessageCatalog struct {
+	defaultLanguage string
+	messages        map[string]map[string]string
+}
+
+// NewMessageCatalog creates a new catalog with the given messages, indexed by
+// error code and language tag. The default language is used if none of the
+// languages requested by the client is available.
+func NewMessageCatalog(defaultLanguage string, messages map[string]map[string]string) *MessageCatalog {
+	c := &MessageCatalog{
+		defaultLanguage: strings.ToLower(defaultLanguage),
+		messages:        make(map[string]map[string]string, len(messages)),
+	}
+	for code, m := range messages {
+		c.messages[code] = make(map[string]string, len(m))
+		for lang, msg := range m {
+			c.messages[code][strings.ToLower(lang)] = msg
+		}
+	}
+	return c
+}
+
+// Lookup returns the message for the given code in the first available
+// language. A language tag with a region, e.g. "es-MX", will also match the
+// base language, "es".
+func (c *MessageCatalog) Lookup(code string, languages []string) (string, bool) {
+	m, ok := c.messages[code]
+	if !ok {
+		return "", false
+	}
+	for _, lang := range languages {
+		lang = strings.ToLower(lang)
+		if msg, ok := m[lang]; ok {
+			return msg, true
+		}
+		if i := strings.Index(lang, "-"); i > 0 {
+			if msg, ok := m[lang[:i]]; ok {
+				return msg, true
+			}
+		}
+	}
+	if c.defaultLanguage != "" {
+		if msg, ok := m[c.defaultLanguage]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// Middleware returns a handler that makes the catalog available to the error
+// writers, using the languages in the Accept-Language header of the request.
+func (c *MessageCatalog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&localizedResponseLogger{
+			ResponseLogger: logging.NewResponseLogger(w),
+			catalog:        c,
+			languages:      ParseAcceptLanguage(r.Header.Get("Accept-Language")),
+		}, r)
+	})
+}
+
+// Localizer is the interface implemented by the response writers that can
+// replace the error details with the messages of a catalog.
+type Localizer interface {
+	Localize(code string) (string, bool)
+}
+
+// Localize returns the message in the catalog for the given code if the
+// response writer implements the Localizer interface.
+func Localize(w http.ResponseWriter, code string) (string, bool) {
+	if l, ok := w.(Localizer); ok && code != "" {
+		return l.Localize(code)
+	}
+	return "", false
+}
+
+type localizedResponseLogger struct {
+	logging.ResponseLogger
+	catalog   *MessageCatalog
+	languages []string
+}
+
+func (l *localizedResponseLogger) Localize(code string) (string, bool) {
+	return l.catalog.Lookup(code, l.languages)
+}
+
+// Flush flushes the response if the underlying writer supports it, required
+// by the streaming endpoints.
+func (l *localizedResponseLogger) Flush() {
+	if f, ok := l.ResponseLogger.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection if the underlying writer supports it.
+func (l *localizedResponseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := l.ResponseLogger.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// ParseAcceptLanguage returns the language tags in the given Accept-Language
+// header value sorted by preference. Wildcards and languages with a quality
+// of 0 are ignored.
+func ParseAcceptLanguage(s string) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var langs []language
+	for _, part := range strings.Split(s, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.TrimSpace(params[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			langs = append(langs, language{tag, quality})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].quality > langs[j].quality
+	})
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
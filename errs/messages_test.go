@@ -0,0 +1,88 @@
+package errs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMessageCatalog_Lookup(t *testing.T) {
+	c := NewMessageCatalog("en", map[string]map[string]string{
+		"badCSR": {
+			"en":    "Contact the help desk.",
+			"es":    "Contacte con soporte.",
+			"pt-BR": "Entre em contato com o suporte.",
+		},
+		"forbidden": {
+			"es": "Prohibido.",
+		},
+	})
+	tests := []struct {
+		name      string
+		code      string
+		languages []string
+		want      string
+		wantOK    bool
+	}{
+		{"ok", "badCSR", []string{"es"}, "Contacte con soporte.", true},
+		{"ok order", "badCSR", []string{"fr", "es", "en"}, "Contacte con soporte.", true},
+		{"ok region", "badCSR", []string{"pt-BR"}, "Entre em contato com o suporte.", true},
+		{"ok base language", "badCSR", []string{"es-MX"}, "Contacte con soporte.", true},
+		{"ok case", "badCSR", []string{"PT-br"}, "Entre em contato com o suporte.", true},
+		{"ok default", "badCSR", []string{"fr"}, "Contact the help desk.", true},
+		{"ok no languages", "badCSR", nil, "Contact the help desk.", true},
+		{"fail no default", "forbidden", []string{"fr"}, "", false},
+		{"fail code", "unauthorized", []string{"en"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.Lookup(tt.code, tt.languages)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("MessageCatalog.Lookup() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMessageCatalog_Middleware(t *testing.T) {
+	c := NewMessageCatalog("", map[string]map[string]string{
+		CodeForbidden: {"es": "Prohibido."},
+	})
+	var got string
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = Localize(w, CodeForbidden)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "fr;q=0.5, es-ES")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "Prohibido." {
+		t.Errorf("Localize() = %v, want %v", got, "Prohibido.")
+	}
+
+	if msg, ok := Localize(httptest.NewRecorder(), CodeForbidden); ok {
+		t.Errorf("Localize() = %v, want no message", msg)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{"empty", "", []string{}},
+		{"one", "en-US", []string{"en-US"}},
+		{"many", "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", []string{"fr-CH", "fr", "en", "de"}},
+		{"sort", "en;q=0.1, es, pt;q=0.5", []string{"es", "pt", "en"}},
+		{"zero", "en;q=0, es", []string{"es"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseAcceptLanguage(tt.s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAcceptLanguage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -33,6 +33,7 @@ type KeyManagementClient interface {
 	CreateKeyWithContext(ctx aws.Context, input *kms.CreateKeyInput, opts ...request.Option) (*kms.CreateKeyOutput, error)
 	CreateAliasWithContext(ctx aws.Context, input *kms.CreateAliasInput, opts ...request.Option) (*kms.CreateAliasOutput, error)
 	SignWithContext(ctx aws.Context, input *kms.SignInput, opts ...request.Option) (*kms.SignOutput, error)
+	DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error)
 }
 
 // customerMasterKeySpecMapping is a mapping between the step signature algorithm,
@@ -221,6 +222,15 @@ func (k *KMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, error
 	return NewSigner(k.service, req.SigningKey)
 }
 
+// CreateDecrypter creates a new crypto.Decrypter with a previously configured
+// key.
+func (k *KMS) CreateDecrypter(req *apiv1.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	if req.DecryptionKey == "" {
+		return nil, errors.New("createDecrypter 'decryptionKey' cannot be empty")
+	}
+	return NewDecrypter(k.service, req.DecryptionKey)
+}
+
 // Close closes the connection of the KMS client.
 func (k *KMS) Close() error {
 	return nil
@@ -0,0 +1,93 @@
+package awskms
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"io"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/pemutil"
+)
+
+// Decrypter implements a crypto.Decrypter using the AWS KMS.
+type Decrypter struct {
+	service   KeyManagementClient
+	keyID     string
+	publicKey crypto.PublicKey
+}
+
+// NewDecrypter creates a new decrypter using a key in the AWS KMS.
+func NewDecrypter(svc KeyManagementClient, decryptionKey string) (*Decrypter, error) {
+	keyID, err := parseKeyID(decryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure that the key exists.
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := svc.GetPublicKeyWithContext(ctx, &kms.GetPublicKeyInput{
+		KeyId: &keyID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "awskms GetPublicKeyWithContext failed")
+	}
+	publicKey, err := pemutil.ParseDER(resp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decrypter{
+		service:   svc,
+		keyID:     keyID,
+		publicKey: publicKey,
+	}, nil
+}
+
+// Public returns the public key of this decrypter.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.publicKey
+}
+
+// Decrypt decrypts the ciphertext with the private key stored in the AWS KMS.
+// Only RSA-OAEP with SHA-1 or SHA-256 is supported.
+func (d *Decrypter) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	alg, err := getEncryptionAlgorithm(d.Public(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := d.service.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:               &d.keyID,
+		EncryptionAlgorithm: &alg,
+		CiphertextBlob:      ciphertext,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "awskms DecryptWithContext failed")
+	}
+
+	return resp.Plaintext, nil
+}
+
+func getEncryptionAlgorithm(key crypto.PublicKey, opts crypto.DecrypterOpts) (string, error) {
+	if _, ok := key.(*rsa.PublicKey); !ok {
+		return "", errors.Errorf("unsupported key type %T", key)
+	}
+	o, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return "", errors.Errorf("unsupported decrypter options %T", opts)
+	}
+	switch o.Hash {
+	case crypto.SHA1:
+		return kms.EncryptionAlgorithmSpecRsaesOaepSha1, nil
+	case crypto.SHA256:
+		return kms.EncryptionAlgorithmSpecRsaesOaepSha256, nil
+	default:
+		return "", errors.Errorf("unsupported hash function %v", o.Hash)
+	}
+}
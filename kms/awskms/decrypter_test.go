@@ -0,0 +1,91 @@
+package awskms
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	okClient := getOKClient()
+	okClient.getPublicKeyWithContext = func(ctx aws.Context, input *kms.GetPublicKeyInput, opts ...request.Option) (*kms.GetPublicKeyOutput, error) {
+		return &kms.GetPublicKeyOutput{
+			KeyId:     input.KeyId,
+			PublicKey: der,
+		}, nil
+	}
+	var gotAlgorithm string
+	okClient.decryptWithContext = func(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+		gotAlgorithm = *input.EncryptionAlgorithm
+		return &kms.DecryptOutput{
+			KeyId:     input.KeyId,
+			Plaintext: []byte("the-plaintext"),
+		}, nil
+	}
+	failClient := getOKClient()
+	failClient.getPublicKeyWithContext = okClient.getPublicKeyWithContext
+	failClient.decryptWithContext = func(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+		return nil, fmt.Errorf("an error")
+	}
+
+	tests := []struct {
+		name          string
+		svc           KeyManagementClient
+		opts          crypto.DecrypterOpts
+		want          []byte
+		wantAlgorithm string
+		wantErr       bool
+	}{
+		{"ok sha256", okClient, &rsa.OAEPOptions{Hash: crypto.SHA256}, []byte("the-plaintext"), "RSAES_OAEP_SHA_256", false},
+		{"ok sha1", okClient, &rsa.OAEPOptions{Hash: crypto.SHA1}, []byte("the-plaintext"), "RSAES_OAEP_SHA_1", false},
+		{"fail hash", okClient, &rsa.OAEPOptions{Hash: crypto.SHA512}, nil, "", true},
+		{"fail options", okClient, &rsa.PKCS1v15DecryptOptions{}, nil, "", true},
+		{"fail decrypt", failClient, &rsa.OAEPOptions{Hash: crypto.SHA256}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAlgorithm = ""
+			d, err := NewDecrypter(tt.svc, "awskms:key-id=be468355-ca7a-40d9-a28b-8ae1c4c7f936")
+			if err != nil {
+				t.Fatalf("NewDecrypter() error = %v", err)
+			}
+			got, err := d.Decrypt(rand.Reader, []byte("the-ciphertext"), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypter.Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decrypter.Decrypt() = %s, want %s", got, tt.want)
+			}
+			if gotAlgorithm != tt.wantAlgorithm {
+				t.Errorf("Decrypter.Decrypt() algorithm = %s, want %s", gotAlgorithm, tt.wantAlgorithm)
+			}
+		})
+	}
+
+	// EC keys cannot be used to decrypt.
+	d, err := NewDecrypter(getOKClient(), "awskms:key-id=be468355-ca7a-40d9-a28b-8ae1c4c7f936")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Decrypt(rand.Reader, []byte("the-ciphertext"), &rsa.OAEPOptions{Hash: crypto.SHA256}); err == nil {
+		t.Error("Decrypter.Decrypt() error = nil, want error")
+	}
+}
@@ -13,6 +13,7 @@ type MockClient struct {
 	createKeyWithContext    func(ctx aws.Context, input *kms.CreateKeyInput, opts ...request.Option) (*kms.CreateKeyOutput, error)
 	createAliasWithContext  func(ctx aws.Context, input *kms.CreateAliasInput, opts ...request.Option) (*kms.CreateAliasOutput, error)
 	signWithContext         func(ctx aws.Context, input *kms.SignInput, opts ...request.Option) (*kms.SignOutput, error)
+	decryptWithContext      func(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error)
 }
 
 func (m *MockClient) GetPublicKeyWithContext(ctx aws.Context, input *kms.GetPublicKeyInput, opts ...request.Option) (*kms.GetPublicKeyOutput, error) {
@@ -31,6 +32,10 @@ func (m *MockClient) SignWithContext(ctx aws.Context, input *kms.SignInput, opts
 	return m.signWithContext(ctx, input, opts...)
 }
 
+func (m *MockClient) DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+	return m.decryptWithContext(ctx, input, opts...)
+}
+
 const (
 	publicKey = `-----BEGIN PUBLIC KEY-----
 MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE8XWlIWkOThxNjGbZLYUgRHmsvCrW
@@ -68,5 +73,11 @@ func getOKClient() *MockClient {
 				Signature: signature,
 			}, nil
 		},
+		decryptWithContext: func(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+			return &kms.DecryptOutput{
+				KeyId:     input.KeyId,
+				Plaintext: []byte("the-plaintext"),
+			}, nil
+		},
 	}
 }
@@ -0,0 +1,132 @@
+package mockkms
+
+import (
+	"context"
+	"crypto"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms/apiv1"
+	"go.step.sm/crypto/keyutil"
+)
+
+// MockKMS is a KeyManager that keeps the keys in memory, meant for
+// integration tests. It's not registered as a KMS type, so it cannot be
+// configured in the ca.json, and it must be passed to the authority with
+// authority.WithKeyManager. By default, the keys are generated with CreateKey or
+// added with AddKey, and referenced by name in GetPublicKey and CreateSigner.
+// The Mock functions, if set, replace the default behavior of each method.
+type MockKMS struct {
+	MockGetPublicKey func(req *apiv1.GetPublicKeyRequest) (crypto.PublicKey, error)
+	MockCreateKey    func(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error)
+	MockCreateSigner func(req *apiv1.CreateSignerRequest) (crypto.Signer, error)
+	MockClose        func() error
+
+	mu   sync.RWMutex
+	keys map[string]crypto.Signer
+}
+
+// New returns a new MockKMS without keys.
+func New(ctx context.Context, opts apiv1.Options) (*MockKMS, error) {
+	return &MockKMS{
+		keys: make(map[string]crypto.Signer),
+	}, nil
+}
+
+// AddKey adds a key with the given name, it can be used to run the tests
+// with known keys.
+func (k *MockKMS) AddKey(name string, signer crypto.Signer) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		k.keys = make(map[string]crypto.Signer)
+	}
+	k.keys[name] = signer
+}
+
+func (k *MockKMS) getKey(name string) (crypto.Signer, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if signer, ok := k.keys[name]; ok {
+		return signer, nil
+	}
+	return nil, errors.Errorf("mockKMS key %s not found", name)
+}
+
+// GetPublicKey returns the public key of the key with the given name.
+func (k *MockKMS) GetPublicKey(req *apiv1.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	if k.MockGetPublicKey != nil {
+		return k.MockGetPublicKey(req)
+	}
+	signer, err := k.getKey(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// CreateKey generates a new key and stores it with the given name.
+func (k *MockKMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+	if k.MockCreateKey != nil {
+		return k.MockCreateKey(req)
+	}
+	if req.Name == "" {
+		return nil, errors.New("createKeyRequest 'name' cannot be empty")
+	}
+
+	var kty, crv string
+	switch req.SignatureAlgorithm {
+	case apiv1.UnspecifiedSignAlgorithm, apiv1.ECDSAWithSHA256:
+		kty, crv = "EC", "P-256"
+	case apiv1.ECDSAWithSHA384:
+		kty, crv = "EC", "P-384"
+	case apiv1.ECDSAWithSHA512:
+		kty, crv = "EC", "P-521"
+	case apiv1.SHA256WithRSA, apiv1.SHA384WithRSA, apiv1.SHA512WithRSA,
+		apiv1.SHA256WithRSAPSS, apiv1.SHA384WithRSAPSS, apiv1.SHA512WithRSAPSS:
+		kty = "RSA"
+	case apiv1.PureEd25519:
+		kty, crv = "OKP", "Ed25519"
+	default:
+		return nil, errors.Errorf("mockKMS does not support signature algorithm '%s'", req.SignatureAlgorithm)
+	}
+	bits := req.Bits
+	if kty == "RSA" && bits == 0 {
+		bits = 2048
+	}
+
+	signer, err := keyutil.GenerateSigner(kty, crv, bits)
+	if err != nil {
+		return nil, err
+	}
+	k.AddKey(req.Name, signer)
+
+	return &apiv1.CreateKeyResponse{
+		Name:       req.Name,
+		PublicKey:  signer.Public(),
+		PrivateKey: signer,
+		CreateSignerRequest: apiv1.CreateSignerRequest{
+			SigningKey: req.Name,
+		},
+	}, nil
+}
+
+// CreateSigner returns the signer in the request, or the key with the name in
+// the signing key.
+func (k *MockKMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, error) {
+	if k.MockCreateSigner != nil {
+		return k.MockCreateSigner(req)
+	}
+	if req.Signer != nil {
+		return req.Signer, nil
+	}
+	return k.getKey(req.SigningKey)
+}
+
+// Close closes the KMS, by default it's a noop.
+func (k *MockKMS) Close() error {
+	if k.MockClose != nil {
+		return k.MockClose()
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package mockkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/certificates/kms/apiv1"
+)
+
+func TestMockKMS(t *testing.T) {
+	k, err := New(context.Background(), apiv1.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Known keys
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.AddKey("known", key)
+	pub, err := k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "known"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pub, key.Public()) {
+		t.Errorf("MockKMS.GetPublicKey() = %v, want %v", pub, key.Public())
+	}
+	if _, err := k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "missing"}); err == nil {
+		t.Error("MockKMS.GetPublicKey() error = nil, wantErr true")
+	}
+
+	// Generated keys
+	resp, err := k.CreateKey(&apiv1.CreateKeyRequest{Name: "ed25519", SignatureAlgorithm: apiv1.PureEd25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.PublicKey.(ed25519.PublicKey); !ok {
+		t.Errorf("MockKMS.CreateKey() public key type = %T, want ed25519.PublicKey", resp.PublicKey)
+	}
+	signer, err := k.CreateSigner(&resp.CreateSignerRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(signer.Public(), resp.PublicKey) {
+		t.Errorf("MockKMS.CreateSigner() = %v, want %v", signer.Public(), resp.PublicKey)
+	}
+	if _, err := k.CreateKey(&apiv1.CreateKeyRequest{}); err == nil {
+		t.Error("MockKMS.CreateKey() error = nil, wantErr true")
+	}
+	if _, err := k.CreateKey(&apiv1.CreateKeyRequest{Name: "foo", SignatureAlgorithm: apiv1.SignatureAlgorithm(100)}); err == nil {
+		t.Error("MockKMS.CreateKey() error = nil, wantErr true")
+	}
+
+	signer, err = k.CreateSigner(&apiv1.CreateSignerRequest{Signer: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("data"))
+	if _, err := signer.Sign(rand.Reader, sum[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mocked methods
+	k.MockClose = func() error { return errors.New("force") }
+	if err := k.Close(); err == nil {
+		t.Error("MockKMS.Close() error = nil, wantErr true")
+	}
+}
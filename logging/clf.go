@@ -1,7 +1,6 @@
 package logging
 
 import (
-	"bytes"
 	"fmt"
 	"strconv"
 	"time"
@@ -22,56 +21,58 @@ type CommonLogFormat struct{}
 // 	<request-id> <remote-address> <name> <user-id> <time> <duration> "<method> <path> <protocol>" <status> <size>
 // If a field is not known, the hyphen symbol (-) will be used.
 func (f *CommonLogFormat) Format(entry *logrus.Entry) ([]byte, error) {
-	data := make([]string, len(clfFields))
+	var b []byte
 	for i, name := range clfFields {
+		b = appendCLFSeparator(b, i)
 		if v, ok := entry.Data[name]; ok {
-			switch v := v.(type) {
-			case error:
-				data[i] = v.Error()
-			case string:
-				if v == "" {
-					data[i] = "-"
-				} else {
-					data[i] = v
-				}
-			case time.Time:
-				data[i] = v.Format(time.RFC3339)
-			case time.Duration:
-				data[i] = strconv.FormatInt(int64(v/time.Millisecond), 10)
-			case int:
-				data[i] = strconv.FormatInt(int64(v), 10)
-			case int64:
-				data[i] = strconv.FormatInt(v, 10)
-			default:
-				data[i] = fmt.Sprintf("%v", v)
-			}
+			b = appendCLFValue(b, v)
 		} else {
-			data[i] = "-"
+			b = append(b, '-')
 		}
 	}
+	b = append(b, '\n')
+	return b, nil
+}
+
+// appendCLFSeparator appends the characters written before the i-th CLF
+// field.
+func appendCLFSeparator(b []byte, i int) []byte {
+	switch i {
+	case 0:
+		return b
+	case 6:
+		return append(b, ' ', '"')
+	case 9:
+		return append(b, '"', ' ')
+	default:
+		return append(b, ' ')
+	}
+}
 
-	var buf bytes.Buffer
-	buf.WriteString(data[0])
-	buf.WriteByte(' ')
-	buf.WriteString(data[1])
-	buf.WriteByte(' ')
-	buf.WriteString(data[2])
-	buf.WriteByte(' ')
-	buf.WriteString(data[3])
-	buf.WriteByte(' ')
-	buf.WriteString(data[4])
-	buf.WriteByte(' ')
-	buf.WriteString(data[5])
-	buf.WriteString(" \"")
-	buf.WriteString(data[6])
-	buf.WriteByte(' ')
-	buf.WriteString(data[7])
-	buf.WriteByte(' ')
-	buf.WriteString(data[8])
-	buf.WriteString("\" ")
-	buf.WriteString(data[9])
-	buf.WriteByte(' ')
-	buf.WriteString(data[10])
-	buf.WriteByte('\n')
-	return buf.Bytes(), nil
+// appendCLFValue appends the CLF representation of a field.
+func appendCLFValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case error:
+		return append(b, v.Error()...)
+	case string:
+		return appendCLFString(b, v)
+	case time.Time:
+		return v.AppendFormat(b, time.RFC3339)
+	case time.Duration:
+		return strconv.AppendInt(b, int64(v/time.Millisecond), 10)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	default:
+		return append(b, fmt.Sprintf("%v", v)...)
+	}
+}
+
+// appendCLFString appends s, or the hyphen symbol if s is empty.
+func appendCLFString(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	return append(b, s...)
 }
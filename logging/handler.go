@@ -1,10 +1,12 @@
 package logging
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -14,6 +16,8 @@ import (
 type LoggerHandler struct {
 	name    string
 	logger  *logrus.Logger
+	format  recordFormat
+	mu      *sync.Mutex
 	options options
 	next    http.Handler
 }
@@ -30,9 +34,16 @@ type options struct {
 func NewLoggerHandler(name string, logger *Logger, next http.Handler) http.Handler {
 	h := RequestID(logger.GetTraceHeader())
 	onlyTraceHealthEndpoint, _ := strconv.ParseBool(os.Getenv("STEP_LOGGER_ONLY_TRACE_HEALTH_ENDPOINT"))
+	// Records are written directly only if there are no hooks to run.
+	format := logger.format
+	if len(logger.Hooks) > 0 {
+		format = logrusFormat
+	}
 	return h(&LoggerHandler{
 		name:   name,
 		logger: logger.GetImpl(),
+		format: format,
+		mu:     &logger.mu,
 		options: options{
 			onlyTraceHealthEndpoint: onlyTraceHealthEndpoint,
 		},
@@ -53,14 +64,15 @@ func (l *LoggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // writeEntry writes to the Logger writer the request information in the logger.
 func (l *LoggerHandler) writeEntry(w ResponseLogger, r *http.Request, t time.Time, d time.Duration) {
-	var reqID, user string
+	rec := newRecord()
+	defer rec.release()
 
 	ctx := r.Context()
 	if v, ok := ctx.Value(RequestIDKey).(string); ok && v != "" {
-		reqID = v
+		rec.requestID = v
 	}
 	if v, ok := ctx.Value(UserIDKey).(string); ok && v != "" {
-		user = v
+		rec.userID = v
 	}
 
 	// Remote hostname
@@ -83,37 +95,52 @@ func (l *LoggerHandler) writeEntry(w ResponseLogger, r *http.Request, t time.Tim
 
 	status := w.StatusCode()
 
-	fields := logrus.Fields{
-		"request-id":     reqID,
-		"remote-address": addr,
-		"name":           l.name,
-		"user-id":        user,
-		"time":           t.Format(time.RFC3339),
-		"duration-ns":    d.Nanoseconds(),
-		"duration":       d.String(),
-		"method":         r.Method,
-		"path":           uri,
-		"protocol":       r.Proto,
-		"status":         status,
-		"size":           w.Size(),
-		"referer":        r.Referer(),
-		"user-agent":     r.UserAgent(),
-	}
-
-	for k, v := range w.Fields() {
-		fields[k] = v
-	}
+	rec.remoteAddress = addr
+	rec.name = l.name
+	rec.time = t
+	rec.duration = d
+	rec.method = r.Method
+	rec.path = uri
+	rec.protocol = r.Proto
+	rec.status = status
+	rec.size = w.Size()
+	rec.referer = r.Referer()
+	rec.userAgent = r.UserAgent()
+	rec.extra = w.Fields()
 
+	var level logrus.Level
 	switch {
 	case status < http.StatusBadRequest:
 		if l.options.onlyTraceHealthEndpoint && uri == "/health" {
-			l.logger.WithFields(fields).Trace()
+			level = logrus.TraceLevel
 		} else {
-			l.logger.WithFields(fields).Info()
+			level = logrus.InfoLevel
 		}
 	case status < http.StatusInternalServerError:
-		l.logger.WithFields(fields).Warn()
+		level = logrus.WarnLevel
+	default:
+		level = logrus.ErrorLevel
+	}
+
+	if !l.logger.IsLevelEnabled(level) {
+		return
+	}
+
+	switch l.format {
+	case jsonFormat:
+		l.write(rec.appendJSON(level, time.Now()))
+	case commonFormat:
+		l.write(rec.appendCommon())
 	default:
-		l.logger.WithFields(fields).Error()
+		l.logger.WithFields(rec.fields()).Log(level)
+	}
+}
+
+// write writes a record to the output of the logger.
+func (l *LoggerHandler) write(b []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.logger.Out.Write(b); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write to log, %v\n", err)
 	}
 }
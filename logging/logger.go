@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -20,6 +21,8 @@ type Logger struct {
 	*logrus.Logger
 	name        string
 	traceHeader string
+	format      recordFormat
+	mu          sync.Mutex
 }
 
 // loggerConfig represents the configuration options for the logger.
@@ -36,12 +39,15 @@ func New(name string, raw json.RawMessage) (*Logger, error) {
 	}
 
 	var formatter logrus.Formatter
+	var format recordFormat
 	switch strings.ToLower(config.Format) {
 	case "", "text":
 	case "json":
 		formatter = new(logrus.JSONFormatter)
+		format = jsonFormat
 	case "common":
 		formatter = new(CommonLogFormat)
+		format = commonFormat
 	default:
 		return nil, errors.Errorf("unsupported logger.format '%s'", config.Format)
 	}
@@ -50,6 +56,7 @@ func New(name string, raw json.RawMessage) (*Logger, error) {
 		Logger:      logrus.New(),
 		name:        name,
 		traceHeader: config.TraceHeader,
+		format:      format,
 	}
 	if formatter != nil {
 		logger.Formatter = formatter
@@ -0,0 +1,446 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recordFormat is the format used to write the request records.
+type recordFormat int
+
+const (
+	// logrusFormat writes the records using the logrus entries and formatter.
+	logrusFormat recordFormat = iota
+	// jsonFormat writes the records directly with the same output of the
+	// logrus.JSONFormatter.
+	jsonFormat
+	// commonFormat writes the records directly with the same output of the
+	// CommonLogFormat.
+	commonFormat
+)
+
+// maxPooledBuffer is the maximum size of the buffers kept in the pool.
+const maxPooledBuffer = 64 << 10
+
+// record is the log entry of a request. Records are pooled, and in the json
+// and common formats, they are written without creating the map of fields and
+// the logrus entry.
+type record struct {
+	requestID     string
+	remoteAddress string
+	name          string
+	userID        string
+	time          time.Time
+	duration      time.Duration
+	method        string
+	path          string
+	protocol      string
+	status        int
+	size          int
+	referer       string
+	userAgent     string
+	extra         map[string]interface{}
+	buf           []byte
+	keys          []string
+}
+
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return &record{buf: make([]byte, 0, 1024)}
+	},
+}
+
+func newRecord() *record {
+	return recordPool.Get().(*record)
+}
+
+// release returns the record to the pool.
+func (r *record) release() {
+	if cap(r.buf) > maxPooledBuffer {
+		return
+	}
+	buf, keys := r.buf[:0], r.keys[:0]
+	*r = record{buf: buf, keys: keys}
+	recordPool.Put(r)
+}
+
+// fields returns the record as logrus fields.
+func (r *record) fields() logrus.Fields {
+	fields := logrus.Fields{
+		"request-id":     r.requestID,
+		"remote-address": r.remoteAddress,
+		"name":           r.name,
+		"user-id":        r.userID,
+		"time":           r.time.Format(time.RFC3339),
+		"duration-ns":    r.duration.Nanoseconds(),
+		"duration":       r.duration.String(),
+		"method":         r.method,
+		"path":           r.path,
+		"protocol":       r.protocol,
+		"status":         r.status,
+		"size":           r.size,
+		"referer":        r.referer,
+		"user-agent":     r.userAgent,
+	}
+	for k, v := range r.extra {
+		fields[k] = v
+	}
+	return fields
+}
+
+// jsonKeys are the keys written in the json format, sorted like
+// encoding/json sorts the keys of a map. The logrus.JSONFormatter renames the
+// time field because it clashes with the time of the entry.
+var jsonKeys = [...]string{
+	"duration", "duration-ns", "fields.time", "level", "method", "msg", "name",
+	"path", "protocol", "referer", "remote-address", "request-id", "size",
+	"status", "time", "user-agent", "user-id",
+}
+
+// appendJSON appends the record to the buffer of the record as a JSON line
+// with the given level and entry time, and returns the buffer.
+func (r *record) appendJSON(level logrus.Level, now time.Time) []byte {
+	// Sort the extra fields, renamed like the logrus.JSONFormatter does.
+	keys := r.keys[:0]
+	for k := range r.extra {
+		keys = append(keys, k)
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && jsonKey(keys[j]) < jsonKey(keys[j-1]); j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	r.keys = keys
+
+	b := append(r.buf[:0], '{')
+	i, j := 0, 0
+	for i < len(jsonKeys) || j < len(keys) {
+		if len(b) > 1 {
+			b = append(b, ',')
+		}
+		// Extra fields replace the fields with the same name.
+		if j < len(keys) && (i == len(jsonKeys) || jsonKey(keys[j]) <= jsonKeys[i]) {
+			key := jsonKey(keys[j])
+			if i < len(jsonKeys) && key == jsonKeys[i] {
+				i++
+			}
+			b = appendJSONString(b, key)
+			b = append(b, ':')
+			b = appendJSONValue(b, r.extra[keys[j]])
+			j++
+			continue
+		}
+
+		b = appendJSONString(b, jsonKeys[i])
+		b = append(b, ':')
+		switch jsonKeys[i] {
+		case "duration":
+			b = append(b, '"')
+			b = appendDuration(b, r.duration)
+			b = append(b, '"')
+		case "duration-ns":
+			b = strconv.AppendInt(b, r.duration.Nanoseconds(), 10)
+		case "fields.time":
+			b = append(b, '"')
+			b = r.time.AppendFormat(b, time.RFC3339)
+			b = append(b, '"')
+		case "level":
+			b = appendJSONString(b, levelName(level))
+		case "method":
+			b = appendJSONString(b, r.method)
+		case "msg":
+			b = append(b, '"', '"')
+		case "name":
+			b = appendJSONString(b, r.name)
+		case "path":
+			b = appendJSONString(b, r.path)
+		case "protocol":
+			b = appendJSONString(b, r.protocol)
+		case "referer":
+			b = appendJSONString(b, r.referer)
+		case "remote-address":
+			b = appendJSONString(b, r.remoteAddress)
+		case "request-id":
+			b = appendJSONString(b, r.requestID)
+		case "size":
+			b = strconv.AppendInt(b, int64(r.size), 10)
+		case "status":
+			b = strconv.AppendInt(b, int64(r.status), 10)
+		case "time":
+			b = append(b, '"')
+			b = now.AppendFormat(b, time.RFC3339)
+			b = append(b, '"')
+		case "user-agent":
+			b = appendJSONString(b, r.userAgent)
+		case "user-id":
+			b = appendJSONString(b, r.userID)
+		}
+		i++
+	}
+	b = append(b, '}', '\n')
+	r.buf = b
+	return b
+}
+
+// appendCommon appends the record to the buffer of the record as a CLF line,
+// and returns the buffer.
+func (r *record) appendCommon() []byte {
+	b := r.buf[:0]
+	for i, name := range clfFields {
+		b = appendCLFSeparator(b, i)
+		if v, ok := r.extra[name]; ok {
+			b = appendCLFValue(b, v)
+			continue
+		}
+		switch name {
+		case "request-id":
+			b = appendCLFString(b, r.requestID)
+		case "remote-address":
+			b = appendCLFString(b, r.remoteAddress)
+		case "name":
+			b = appendCLFString(b, r.name)
+		case "user-id":
+			b = appendCLFString(b, r.userID)
+		case "time":
+			b = r.time.AppendFormat(b, time.RFC3339)
+		case "duration":
+			b = appendDuration(b, r.duration)
+		case "method":
+			b = appendCLFString(b, r.method)
+		case "path":
+			b = appendCLFString(b, r.path)
+		case "protocol":
+			b = appendCLFString(b, r.protocol)
+		case "status":
+			b = strconv.AppendInt(b, int64(r.status), 10)
+		case "size":
+			b = strconv.AppendInt(b, int64(r.size), 10)
+		}
+	}
+	b = append(b, '\n')
+	r.buf = b
+	return b
+}
+
+// levelNames are the names of the logrus levels, logrus.Level.String
+// allocates them in every call.
+var levelNames = func() map[logrus.Level]string {
+	m := make(map[logrus.Level]string, len(logrus.AllLevels))
+	for _, l := range logrus.AllLevels {
+		m[l] = l.String()
+	}
+	return m
+}()
+
+// levelName returns the name of the given level.
+func levelName(l logrus.Level) string {
+	if s, ok := levelNames[l]; ok {
+		return s
+	}
+	return l.String()
+}
+
+// jsonKey returns the name used by the logrus.JSONFormatter for a field.
+func jsonKey(k string) string {
+	switch k {
+	case "time", "msg", "level":
+		return "fields." + k
+	default:
+		return k
+	}
+}
+
+// appendJSONValue appends the JSON encoding of v. Errors are written as
+// strings like the logrus.JSONFormatter does.
+func appendJSONValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...)
+	case string:
+		return appendJSONString(b, v)
+	case error:
+		return appendJSONString(b, v.Error())
+	case bool:
+		return strconv.AppendBool(b, v)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendJSONString(b, fmt.Sprint(v))
+	}
+	return append(b, data...)
+}
+
+// appendDuration appends d with the same format of time.Duration.String.
+func appendDuration(b []byte, d time.Duration) []byte {
+	// Largest time is 2540400h10m10.000000000s
+	var buf [32]byte
+	w := len(buf)
+
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = -u
+	}
+
+	if u < uint64(time.Second) {
+		// Special case: if duration is smaller than a second, use smaller
+		// units, like 1.2ms
+		var prec int
+		w--
+		buf[w] = 's'
+		w--
+		switch {
+		case u == 0:
+			return append(b, '0', 's')
+		case u < uint64(time.Microsecond):
+			prec = 0
+			buf[w] = 'n'
+		case u < uint64(time.Millisecond):
+			prec = 3
+			// U+00B5 'µ' micro sign == 0xC2 0xB5
+			w--
+			copy(buf[w:], "µ")
+		default:
+			prec = 6
+			buf[w] = 'm'
+		}
+		w, u = fmtFrac(buf[:w], u, prec)
+		w = fmtInt(buf[:w], u)
+	} else {
+		w--
+		buf[w] = 's'
+		w, u = fmtFrac(buf[:w], u, 9)
+		// u is now integer seconds
+		w = fmtInt(buf[:w], u%60)
+		u /= 60
+		// u is now integer minutes
+		if u > 0 {
+			w--
+			buf[w] = 'm'
+			w = fmtInt(buf[:w], u%60)
+			u /= 60
+			// u is now integer hours
+			if u > 0 {
+				w--
+				buf[w] = 'h'
+				w = fmtInt(buf[:w], u)
+			}
+		}
+	}
+
+	if neg {
+		w--
+		buf[w] = '-'
+	}
+	return append(b, buf[w:]...)
+}
+
+// fmtFrac formats the fraction of v/10**prec (e.g., ".12345") into the tail
+// of buf, omitting trailing zeros. It omits the decimal point too when the
+// fraction is 0. It returns the index where the output bytes begin and the
+// value v/10**prec.
+func fmtFrac(buf []byte, v uint64, prec int) (nw int, nv uint64) {
+	w := len(buf)
+	print := false
+	for i := 0; i < prec; i++ {
+		digit := v % 10
+		print = print || digit != 0
+		if print {
+			w--
+			buf[w] = byte(digit) + '0'
+		}
+		v /= 10
+	}
+	if print {
+		w--
+		buf[w] = '.'
+	}
+	return w, v
+}
+
+// fmtInt formats v into the tail of buf. It returns the index where the
+// output begins.
+func fmtInt(buf []byte, v uint64) int {
+	w := len(buf)
+	if v == 0 {
+		w--
+		buf[w] = '0'
+	} else {
+		for v > 0 {
+			w--
+			buf[w] = byte(v%10) + '0'
+			v /= 10
+		}
+	}
+	return w
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends s as a JSON string, escaped like encoding/json
+// does, including the HTML characters.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are escaped for JSONP.
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,209 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestRecord(extra map[string]interface{}) *record {
+	return &record{
+		requestID:     "c0jdbkdgvl6d7tuqbnag",
+		remoteAddress: "127.0.0.1",
+		name:          "ca",
+		time:          time.Date(2021, 6, 2, 10, 20, 30, 0, time.UTC),
+		duration:      1234567 * time.Nanosecond,
+		method:        "POST",
+		path:          "/1.0/sign",
+		protocol:      "HTTP/1.1",
+		status:        201,
+		size:          3456,
+		userAgent:     "Smallstep CLI/0.16.1 (linux/amd64)",
+		extra:         extra,
+	}
+}
+
+func TestRecord_appendJSON(t *testing.T) {
+	now := time.Date(2021, 6, 2, 10, 20, 31, 0, time.UTC)
+	tests := []struct {
+		name  string
+		level logrus.Level
+		extra map[string]interface{}
+	}{
+		{"ok", logrus.InfoLevel, nil},
+		{"ok/extra", logrus.WarnLevel, map[string]interface{}{
+			"error":       errors.New(`bad "request" <script>`),
+			"provisioner": "jane@smallstep.com",
+			"serial":      "123456789",
+			"count":       3,
+			"valid":       true,
+			"nil":         nil,
+			"sans":        []string{"foo", "bar"},
+		}},
+		{"ok/override", logrus.ErrorLevel, map[string]interface{}{
+			"user-id": "mariano",
+			"status":  "500",
+			"zzz":     "last",
+			"aaa":     "first",
+		}},
+		{"ok/clashes", logrus.InfoLevel, map[string]interface{}{
+			"time":  "a time",
+			"msg":   "a message",
+			"level": "a level",
+		}},
+		{"ok/escape", logrus.InfoLevel, map[string]interface{}{
+			"escape": "tab\t newline\n null\x00 line\u2028\u2029 µ&",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRecord(tt.extra)
+			want, err := new(logrus.JSONFormatter).Format(&logrus.Entry{
+				Data:  r.fields(),
+				Time:  now,
+				Level: tt.level,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.appendJSON(tt.level, now); !bytes.Equal(got, want) {
+				t.Errorf("record.appendJSON() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRecord_appendCommon(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra map[string]interface{}
+	}{
+		{"ok", nil},
+		{"ok/extra", map[string]interface{}{
+			"provisioner": "jane@smallstep.com",
+		}},
+		{"ok/override", map[string]interface{}{
+			"user-id": "mariano",
+			"size":    int64(10),
+			"name":    errors.New("an error"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRecord(tt.extra)
+			want, err := new(CommonLogFormat).Format(&logrus.Entry{
+				Data: r.fields(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.appendCommon(); !bytes.Equal(got, want) {
+				t.Errorf("record.appendCommon() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestAppendDuration(t *testing.T) {
+	durations := []time.Duration{
+		0, 1, 999, time.Microsecond, 1100 * time.Nanosecond, time.Millisecond,
+		2200 * time.Microsecond, time.Second, 3300 * time.Millisecond,
+		4*time.Minute + 5*time.Second, 5*time.Hour + 6*time.Minute + 7001*time.Millisecond,
+		-time.Second, -1, 1<<63 - 1, -1 << 63,
+	}
+	for _, d := range durations {
+		if got := string(appendDuration(nil, d)); got != d.String() {
+			t.Errorf("appendDuration(%d) = %s, want %s", int64(d), got, d.String())
+		}
+	}
+}
+
+func TestRecord_allocs(t *testing.T) {
+	now := time.Now()
+	r := newTestRecord(nil)
+	r.buf = make([]byte, 0, 1024)
+	if n := testing.AllocsPerRun(100, func() { r.appendJSON(logrus.InfoLevel, now) }); n != 0 {
+		t.Errorf("record.appendJSON() allocs = %v, want 0", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { r.appendCommon() }); n != 0 {
+		t.Errorf("record.appendCommon() allocs = %v, want 0", n)
+	}
+}
+
+func TestLoggerHandler_format(t *testing.T) {
+	tests := []struct {
+		name   string
+		format recordFormat
+		want   func(t *testing.T, b []byte)
+	}{
+		{"json", jsonFormat, func(t *testing.T, b []byte) {
+			var m map[string]interface{}
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if m["level"] != "warning" || m["path"] != "/sign" || m["status"] != float64(400) || m["provisioner"] != "foo" {
+				t.Errorf("LoggerHandler.ServeHTTP() = %s", b)
+			}
+		}},
+		{"common", commonFormat, func(t *testing.T, b []byte) {
+			if !bytes.Contains(b, []byte(`"POST /sign HTTP/1.1" 400 2`)) {
+				t.Errorf("LoggerHandler.ServeHTTP() = %s", b)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &buf
+			l := &LoggerHandler{
+				name:   "ca",
+				logger: logger,
+				format: tt.format,
+				mu:     new(sync.Mutex),
+				next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.(ResponseLogger).WithFields(map[string]interface{}{"provisioner": "foo"})
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, "{}")
+				}),
+			}
+			l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/sign", nil))
+			tt.want(t, buf.Bytes())
+		})
+	}
+}
+
+func BenchmarkLoggerHandler(b *testing.B) {
+	for _, format := range []recordFormat{logrusFormat, jsonFormat, commonFormat} {
+		b.Run(fmt.Sprintf("format=%d", format), func(b *testing.B) {
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			logger.Formatter = new(logrus.JSONFormatter)
+			l := &LoggerHandler{
+				name:   "ca",
+				logger: logger,
+				format: format,
+				mu:     new(sync.Mutex),
+				next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusCreated)
+				}),
+			}
+			r := httptest.NewRequest("POST", "/1.0/sign", nil)
+			w := httptest.NewRecorder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.ServeHTTP(w, r)
+			}
+		})
+	}
+}
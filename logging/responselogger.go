@@ -28,15 +28,24 @@ func NewResponseLogger(w http.ResponseWriter) ResponseLogger {
 	return wrapLogger(w)
 }
 
+// wrapLogger wraps the response writer keeping the optional interfaces it
+// implements. HTTP/1.x response writers are flushers and hijackers, and
+// HTTP/2 ones flushers and pushers.
 func wrapLogger(w http.ResponseWriter) (rw ResponseLogger) {
 	rw = &rwDefault{w, 200, 0, nil}
-	if f, ok := w.(http.Flusher); ok {
+	f, isFlusher := w.(http.Flusher)
+	h, isHijacker := w.(http.Hijacker)
+	p, isPusher := w.(http.Pusher)
+	switch {
+	case isFlusher && isHijacker:
+		rw = &rwFlushHijacker{rwFlusher{rw, f}, h}
+	case isFlusher && isPusher:
+		rw = &rwFlushPusher{rwFlusher{rw, f}, p}
+	case isFlusher:
 		rw = &rwFlusher{rw, f}
-	}
-	if h, ok := w.(http.Hijacker); ok {
+	case isHijacker:
 		rw = &rwHijacker{rw, h}
-	}
-	if p, ok := w.(http.Pusher); ok {
+	case isPusher:
 		rw = &rwPusher{rw, p}
 	}
 	return
@@ -111,3 +120,21 @@ type rwPusher struct {
 func (rw *rwPusher) Push(target string, opts *http.PushOptions) error {
 	return rw.p.Push(target, opts)
 }
+
+type rwFlushHijacker struct {
+	rwFlusher
+	h http.Hijacker
+}
+
+func (r *rwFlushHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.h.Hijack()
+}
+
+type rwFlushPusher struct {
+	rwFlusher
+	p http.Pusher
+}
+
+func (rw *rwFlushPusher) Push(target string, opts *http.PushOptions) error {
+	return rw.p.Push(target, opts)
+}
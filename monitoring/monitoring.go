@@ -80,6 +80,13 @@ func newRelicMiddleware(app newrelic.Application) Middleware {
 				txn.AddAttribute("request.id", v)
 			}
 
+			// Add the timing breakdown of the sign requests
+			for k, v := range rw.Fields() {
+				if strings.HasPrefix(k, "timing.") {
+					txn.AddAttribute(k, v)
+				}
+			}
+
 			// Report errors if necessary
 			if status >= http.StatusBadRequest {
 				var errorNoticed bool
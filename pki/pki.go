@@ -176,6 +176,8 @@ type options struct {
 	noDB           bool
 	isHelm         bool
 	deploymentType DeploymentType
+	matterVendorID string
+	dualControl    DualController
 }
 
 // Option is the type of a configuration option on the pki constructor.
@@ -258,6 +260,30 @@ func WithDeploymentType(dt DeploymentType) Option {
 	}
 }
 
+// WithMatterVendorID configures the intermediate as a Matter Product
+// Attestation Intermediate (PAI) with the given vendor id, e.g. "FFF1". The
+// root will act as the Product Attestation Authority (PAA).
+func WithMatterVendorID(vid string) Option {
+	return func(p *PKI) {
+		p.options.matterVendorID = vid
+	}
+}
+
+// DualController authorizes the operations that require the confirmation of
+// two administrators. It's implemented by *authority.Authority.
+type DualController interface {
+	ExecuteDualControlOperation(op string, params map[string]string) error
+}
+
+// WithDualControl requires the regeneration of the root and the signing of a
+// new intermediate to be confirmed by two administrators of the given
+// authority, see the dualControl options of the authority.
+func WithDualControl(dc DualController) Option {
+	return func(p *PKI) {
+		p.options.dualControl = dc
+	}
+}
+
 // PKI represents the Public Key Infrastructure used by a certificate authority.
 type PKI struct {
 	linkedca.Configuration
@@ -446,6 +472,14 @@ func (p *PKI) GenerateKeyPairs(pass []byte) error {
 // GenerateRootCertificate generates a root certificate with the given name
 // and using the default key type.
 func (p *PKI) GenerateRootCertificate(name, org, resource string, pass []byte) (*apiv1.CreateCertificateAuthorityResponse, error) {
+	if err := p.checkDualControl(authconfig.DualControlRootRegeneration, map[string]string{
+		"name":     name,
+		"org":      org,
+		"resource": resource,
+	}); err != nil {
+		return nil, err
+	}
+
 	resp, err := p.caCreator.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
 		Name:      resource + "-Root-CA",
 		Type:      apiv1.RootCA,
@@ -493,23 +527,43 @@ func (p *PKI) WriteRootCertificate(rootCrt *x509.Certificate, rootKey interface{
 // GenerateIntermediateCertificate generates an intermediate certificate with
 // the given name and using the default key type.
 func (p *PKI) GenerateIntermediateCertificate(name, org, resource string, parent *apiv1.CreateCertificateAuthorityResponse, pass []byte) error {
+	params := map[string]string{
+		"name":     name,
+		"org":      org,
+		"resource": resource,
+	}
+	if parent != nil && parent.Certificate != nil {
+		sum := sha256.Sum256(parent.Certificate.Raw)
+		params["root"] = strings.ToLower(hex.EncodeToString(sum[:]))
+	}
+	if err := p.checkDualControl(authconfig.DualControlIntermediateResign, params); err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   name + " Intermediate CA",
+			Organization: []string{org},
+		},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}
+	// A Matter PAI must include the vendor id in the subject.
+	if vid := p.options.matterVendorID; vid != "" {
+		template.Subject.ExtraNames = []pkix.AttributeTypeAndValue{
+			provisioner.MatterAttribute(provisioner.OIDMatterVendorID, vid),
+		}
+	}
 	resp, err := p.caCreator.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
 		Name:      resource + "-Intermediate-CA",
 		Type:      apiv1.IntermediateCA,
 		Lifetime:  10 * 365 * 24 * time.Hour,
 		CreateKey: nil, // use default
-		Template: &x509.Certificate{
-			Subject: pkix.Name{
-				CommonName:   name + " Intermediate CA",
-				Organization: []string{org},
-			},
-			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-			BasicConstraintsValid: true,
-			IsCA:                  true,
-			MaxPathLen:            0,
-			MaxPathLenZero:        true,
-		},
-		Parent: parent,
+		Template:  template,
+		Parent:    parent,
 	})
 	if err != nil {
 		return err
@@ -521,6 +575,16 @@ func (p *PKI) GenerateIntermediateCertificate(name, org, resource string, parent
 	return err
 }
 
+// checkDualControl checks that the given operation has been confirmed by two
+// administrators if the pki has been created with dual control.
+func (p *PKI) checkDualControl(op string, params map[string]string) error {
+	if p.options.dualControl == nil {
+		return nil
+	}
+	return errors.Wrapf(p.options.dualControl.ExecuteDualControlOperation(op, params),
+		"error authorizing %s", op)
+}
+
 // CreateCertificateAuthorityResponse returns a
 // CreateCertificateAuthorityResponse that can be used as a parent of a
 // CreateCertificateAuthority request.
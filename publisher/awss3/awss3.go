@@ -0,0 +1,112 @@
+package awss3
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/publisher"
+)
+
+// S3Client defines the methods on the S3 client that this package will use.
+// This interface will be used for unit testing.
+type S3Client interface {
+	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
+}
+
+// CloudFrontClient defines the methods on the CloudFront client that this
+// package will use. This interface will be used for unit testing.
+type CloudFrontClient interface {
+	CreateInvalidationWithContext(ctx aws.Context, input *cloudfront.CreateInvalidationInput, opts ...request.Option) (*cloudfront.CreateInvalidationOutput, error)
+}
+
+var newClients = func(o session.Options) (S3Client, CloudFrontClient, error) {
+	sess, err := session.NewSessionWithOptions(o)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating AWS session")
+	}
+	return s3.New(sess), cloudfront.New(sess), nil
+}
+
+func init() {
+	publisher.Register(publisher.AmazonS3, func(ctx context.Context, opts publisher.Options) (publisher.Publisher, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Publisher uploads the objects to an S3 bucket, and optionally invalidates
+// them in the CloudFront distribution that serves the bucket.
+type Publisher struct {
+	bucket         string
+	prefix         string
+	distributionID string
+	s3             S3Client
+	cloudfront     CloudFrontClient
+}
+
+// New creates a new S3 publisher. By default, sessions will be created using
+// the credentials in `~/.aws/credentials`, but this can be overridden using
+// the CredentialsFile option, the Region and Profile can also be configured.
+func New(ctx context.Context, opts publisher.Options) (*Publisher, error) {
+	var o session.Options
+	o.Profile = opts.Profile
+	if opts.Region != "" {
+		o.Config.Region = aws.String(opts.Region)
+	}
+	if opts.CredentialsFile != "" {
+		o.SharedConfigFiles = []string{opts.CredentialsFile}
+	}
+	s3Client, cfClient, err := newClients(o)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{
+		bucket:         opts.Bucket,
+		prefix:         opts.Prefix,
+		distributionID: opts.CloudFrontDistributionID,
+		s3:             s3Client,
+		cloudfront:     cfClient,
+	}, nil
+}
+
+// Publish uploads the given objects to the bucket.
+func (p *Publisher) Publish(ctx context.Context, objects []*publisher.Object) error {
+	paths := make([]*string, 0, len(objects))
+	for _, obj := range objects {
+		key := publisher.ObjectName(p.prefix, obj.Name)
+		if _, err := p.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:       aws.String(p.bucket),
+			Key:          aws.String(key),
+			Body:         bytes.NewReader(obj.Data),
+			ContentType:  aws.String(obj.ContentType),
+			CacheControl: aws.String(obj.CacheControl),
+		}); err != nil {
+			return errors.Wrapf(err, "error uploading s3://%s/%s", p.bucket, key)
+		}
+		paths = append(paths, aws.String("/"+key))
+	}
+
+	if p.distributionID == "" || len(paths) == 0 {
+		return nil
+	}
+	if _, err := p.cloudfront.CreateInvalidationWithContext(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(p.distributionID),
+		InvalidationBatch: &cloudfront.InvalidationBatch{
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &cloudfront.Paths{
+				Quantity: aws.Int64(int64(len(paths))),
+				Items:    paths,
+			},
+		},
+	}); err != nil {
+		return errors.Wrapf(err, "error invalidating cloudfront distribution %s", p.distributionID)
+	}
+	return nil
+}
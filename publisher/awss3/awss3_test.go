@@ -0,0 +1,108 @@
+package awss3
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudfront"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/smallstep/certificates/publisher"
+)
+
+type mockS3 struct {
+	objects map[string]*s3.PutObjectInput
+	data    map[string]string
+	err     error
+}
+
+func (m *mockS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	b, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[*input.Key] = input
+	m.data[*input.Key] = string(b)
+	return &s3.PutObjectOutput{}, nil
+}
+
+type mockCloudFront struct {
+	paths []string
+	err   error
+}
+
+func (m *mockCloudFront) CreateInvalidationWithContext(ctx aws.Context, input *cloudfront.CreateInvalidationInput, opts ...request.Option) (*cloudfront.CreateInvalidationOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, p := range input.InvalidationBatch.Paths.Items {
+		m.paths = append(m.paths, *p)
+	}
+	return &cloudfront.CreateInvalidationOutput{}, nil
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	objects := []*publisher.Object{
+		{Name: "intermediate_ca.crl", Data: []byte("crl"), ContentType: publisher.ContentTypeCRL, CacheControl: "public, max-age=3600"},
+		{Name: "intermediate_ca.crt", Data: []byte("crt"), ContentType: publisher.ContentTypeCertificate, CacheControl: "public, max-age=86400"},
+	}
+
+	tmp := newClients
+	t.Cleanup(func() {
+		newClients = tmp
+	})
+
+	tests := []struct {
+		name      string
+		opts      publisher.Options
+		s3        *mockS3
+		cf        *mockCloudFront
+		wantPaths []string
+		wantErr   bool
+	}{
+		{"ok", publisher.Options{Bucket: "crl", Prefix: "pki/", Region: "us-east-1"}, &mockS3{}, &mockCloudFront{}, nil, false},
+		{"ok cloudfront", publisher.Options{Bucket: "crl", Prefix: "pki", CloudFrontDistributionID: "E123"}, &mockS3{}, &mockCloudFront{}, []string{"/pki/intermediate_ca.crl", "/pki/intermediate_ca.crt"}, false},
+		{"fail put", publisher.Options{Bucket: "crl"}, &mockS3{err: errors.New("force")}, &mockCloudFront{}, nil, true},
+		{"fail invalidation", publisher.Options{Bucket: "crl", CloudFrontDistributionID: "E123"}, &mockS3{}, &mockCloudFront{err: errors.New("force")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.s3.objects = make(map[string]*s3.PutObjectInput)
+			tt.s3.data = make(map[string]string)
+			newClients = func(o session.Options) (S3Client, CloudFrontClient, error) {
+				return tt.s3, tt.cf, nil
+			}
+			p, err := New(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Publish(context.Background(), objects); (err != nil) != tt.wantErr {
+				t.Errorf("Publisher.Publish() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			input, ok := tt.s3.objects["pki/intermediate_ca.crl"]
+			if !ok {
+				t.Fatalf("object pki/intermediate_ca.crl was not uploaded: %v", tt.s3.data)
+			}
+			if *input.Bucket != "crl" || *input.ContentType != publisher.ContentTypeCRL || *input.CacheControl != "public, max-age=3600" {
+				t.Errorf("unexpected object %v", input)
+			}
+			if tt.s3.data["pki/intermediate_ca.crt"] != "crt" {
+				t.Errorf("object pki/intermediate_ca.crt = %s, want crt", tt.s3.data["pki/intermediate_ca.crt"])
+			}
+			if len(tt.cf.paths) != len(tt.wantPaths) {
+				t.Errorf("invalidated paths = %v, want %v", tt.cf.paths, tt.wantPaths)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/publisher"
+)
+
+// apiVersion is the version of the Blob service REST API used.
+const apiVersion = "2020-04-08"
+
+// httpClient is the client used to connect to Azure Blob Storage.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+func init() {
+	publisher.Register(publisher.AzureBlobStorage, func(ctx context.Context, opts publisher.Options) (publisher.Publisher, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Publisher uploads the objects as block blobs to an Azure Blob Storage
+// container. The container URL must include a shared access signature (SAS)
+// with write permissions.
+type Publisher struct {
+	container *url.URL
+	prefix    string
+}
+
+// New creates a new Azure Blob Storage publisher.
+func New(ctx context.Context, opts publisher.Options) (*Publisher, error) {
+	u, err := url.Parse(opts.ContainerURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing containerURL")
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, errors.New("containerURL must be an http or https url")
+	}
+	return &Publisher{
+		container: u,
+		prefix:    opts.Prefix,
+	}, nil
+}
+
+// Publish uploads the given objects to the container.
+func (p *Publisher) Publish(ctx context.Context, objects []*publisher.Object) error {
+	for _, obj := range objects {
+		name := publisher.ObjectName(p.prefix, obj.Name)
+		if err := p.put(ctx, name, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) put(ctx context.Context, name string, obj *publisher.Object) error {
+	u := *p.container
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	u.RawPath = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(obj.Data))
+	if err != nil {
+		return errors.Wrapf(err, "error creating request for blob %s", name)
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-blob-content-type", obj.ContentType)
+	req.Header.Set("x-ms-blob-cache-control", obj.CacheControl)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// Do not log the url with the shared access signature.
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return errors.Wrapf(err, "error uploading blob %s", name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return errors.Errorf("error uploading blob %s: status code %d", name, resp.StatusCode)
+	}
+	return nil
+}
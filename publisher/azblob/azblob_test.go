@@ -0,0 +1,65 @@
+package azblob
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/certificates/publisher"
+)
+
+func TestPublisher_Publish(t *testing.T) {
+	blobs := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method != http.MethodPut, r.URL.Query().Get("sig") != "the-signature":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case r.Header.Get("x-ms-blob-type") != "BlockBlob",
+			r.Header.Get("x-ms-blob-content-type") != publisher.ContentTypeCRL,
+			r.Header.Get("x-ms-blob-cache-control") != "public, max-age=3600":
+			http.Error(w, "bad request", http.StatusBadRequest)
+		default:
+			b, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Path] = string(b)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	objects := []*publisher.Object{
+		{Name: "intermediate_ca.crl", Data: []byte("crl"), ContentType: publisher.ContentTypeCRL, CacheControl: "public, max-age=3600"},
+	}
+
+	tests := []struct {
+		name       string
+		opts       publisher.Options
+		want       string
+		wantNewErr bool
+		wantErr    bool
+	}{
+		{"ok", publisher.Options{ContainerURL: srv.URL + "/crl?sv=2020-04-08&sig=the-signature"}, "/crl/intermediate_ca.crl", false, false},
+		{"ok prefix", publisher.Options{ContainerURL: srv.URL + "/crl/?sig=the-signature", Prefix: "pki"}, "/crl/pki/intermediate_ca.crl", false, false},
+		{"fail signature", publisher.Options{ContainerURL: srv.URL + "/crl?sig=bad"}, "", false, true},
+		{"fail url", publisher.Options{ContainerURL: "crl"}, "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(context.Background(), tt.opts)
+			if (err != nil) != tt.wantNewErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantNewErr)
+			}
+			if tt.wantNewErr {
+				return
+			}
+			if err := p.Publish(context.Background(), objects); (err != nil) != tt.wantErr {
+				t.Errorf("Publisher.Publish() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && blobs[tt.want] != "crl" {
+				t.Errorf("blob %s = %q, want crl", tt.want, blobs[tt.want])
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/publisher"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// ObjectsClient defines the methods on the Cloud Storage objects service that
+// this package will use. This interface will be used for unit testing.
+type ObjectsClient interface {
+	Insert(ctx context.Context, bucket string, obj *storage.Object, media io.Reader) error
+}
+
+type objectsService struct {
+	service *storage.ObjectsService
+}
+
+func (s *objectsService) Insert(ctx context.Context, bucket string, obj *storage.Object, media io.Reader) error {
+	_, err := s.service.Insert(bucket, obj).Media(media).Context(ctx).Do()
+	return err
+}
+
+var newObjectsClient = func(ctx context.Context, opts ...option.ClientOption) (ObjectsClient, error) {
+	svc, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &objectsService{service: svc.Objects}, nil
+}
+
+func init() {
+	publisher.Register(publisher.GoogleCloudStorage, func(ctx context.Context, opts publisher.Options) (publisher.Publisher, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Publisher uploads the objects to a Google Cloud Storage bucket.
+type Publisher struct {
+	bucket string
+	prefix string
+	client ObjectsClient
+}
+
+// New creates a new Cloud Storage publisher. The CredentialsFile option can
+// be used to set the credentials, by default the application default
+// credentials are used.
+func New(ctx context.Context, opts publisher.Options) (*Publisher, error) {
+	clientOpts := []option.ClientOption{
+		option.WithScopes(storage.DevstorageReadWriteScope),
+	}
+	if opts.CredentialsFile != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(opts.CredentialsFile))
+	}
+	client, err := newObjectsClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cloud storage client")
+	}
+	return &Publisher{
+		bucket: opts.Bucket,
+		prefix: opts.Prefix,
+		client: client,
+	}, nil
+}
+
+// Publish uploads the given objects to the bucket.
+func (p *Publisher) Publish(ctx context.Context, objects []*publisher.Object) error {
+	for _, obj := range objects {
+		name := publisher.ObjectName(p.prefix, obj.Name)
+		if err := p.client.Insert(ctx, p.bucket, &storage.Object{
+			Name:         name,
+			ContentType:  obj.ContentType,
+			CacheControl: obj.CacheControl,
+		}, bytes.NewReader(obj.Data)); err != nil {
+			return errors.Wrapf(err, "error uploading gs://%s/%s", p.bucket, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/smallstep/certificates/publisher"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+type mockObjectsClient struct {
+	objects map[string]*storage.Object
+	data    map[string]string
+	err     error
+}
+
+func (m *mockObjectsClient) Insert(ctx context.Context, bucket string, obj *storage.Object, media io.Reader) error {
+	if m.err != nil {
+		return m.err
+	}
+	b, err := ioutil.ReadAll(media)
+	if err != nil {
+		return err
+	}
+	m.objects[bucket+"/"+obj.Name] = obj
+	m.data[bucket+"/"+obj.Name] = string(b)
+	return nil
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	objects := []*publisher.Object{
+		{Name: "intermediate_ca.crl", Data: []byte("crl"), ContentType: publisher.ContentTypeCRL, CacheControl: "public, max-age=3600"},
+	}
+
+	tmp := newObjectsClient
+	t.Cleanup(func() {
+		newObjectsClient = tmp
+	})
+
+	tests := []struct {
+		name    string
+		opts    publisher.Options
+		client  *mockObjectsClient
+		want    string
+		wantErr bool
+	}{
+		{"ok", publisher.Options{Bucket: "crl"}, &mockObjectsClient{}, "crl/intermediate_ca.crl", false},
+		{"ok prefix", publisher.Options{Bucket: "crl", Prefix: "pki/"}, &mockObjectsClient{}, "crl/pki/intermediate_ca.crl", false},
+		{"fail insert", publisher.Options{Bucket: "crl"}, &mockObjectsClient{err: errors.New("force")}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.client.objects = make(map[string]*storage.Object)
+			tt.client.data = make(map[string]string)
+			newObjectsClient = func(ctx context.Context, opts ...option.ClientOption) (ObjectsClient, error) {
+				return tt.client, nil
+			}
+			p, err := New(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Publish(context.Background(), objects); (err != nil) != tt.wantErr {
+				t.Errorf("Publisher.Publish() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			obj, ok := tt.client.objects[tt.want]
+			if !ok {
+				t.Fatalf("object %s was not uploaded", tt.want)
+			}
+			if obj.ContentType != publisher.ContentTypeCRL || obj.CacheControl != "public, max-age=3600" || tt.client.data[tt.want] != "crl" {
+				t.Errorf("unexpected object %v", obj)
+			}
+		})
+	}
+}
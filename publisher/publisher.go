@@ -0,0 +1,139 @@
+// Package publisher uploads the revocation data of the CA, the CRLs, the
+// issuer certificates and the pre-signed OCSP responses, to cloud object
+// storage, so it can be served at scale, e.g. from a CDN, without exposing the
+// CA.
+package publisher
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Type is the type of object storage used by a publisher.
+type Type string
+
+const (
+	// AmazonS3 is the type of the publishers that upload to Amazon S3.
+	AmazonS3 Type = "s3"
+	// GoogleCloudStorage is the type of the publishers that upload to Google
+	// Cloud Storage.
+	GoogleCloudStorage Type = "gcs"
+	// AzureBlobStorage is the type of the publishers that upload to Azure Blob
+	// Storage.
+	AzureBlobStorage Type = "azblob"
+)
+
+// Content types of the objects published.
+const (
+	ContentTypeCRL          = "application/pkix-crl"
+	ContentTypeCertificate  = "application/pkix-cert"
+	ContentTypeOCSPResponse = "application/ocsp-response"
+)
+
+// Object is a file uploaded by a publisher.
+type Object struct {
+	// Name is the name of the object, relative to the prefix of the
+	// publisher.
+	Name         string
+	Data         []byte
+	ContentType  string
+	CacheControl string
+}
+
+// Options are the options used to create a publisher.
+type Options struct {
+	// Type is the type of object storage.
+	Type Type `json:"type"`
+	// Bucket is the S3 or GCS bucket where the objects are uploaded.
+	Bucket string `json:"bucket,omitempty"`
+	// ContainerURL is the URL of the Azure Blob Storage container, including
+	// a SAS token with write permissions, e.g.
+	// "https://account.blob.core.windows.net/crl?sv=...&sig=...".
+	ContainerURL string `json:"containerURL,omitempty"`
+	// Prefix is prepended to the name of the objects, e.g. "pki/".
+	Prefix string `json:"prefix,omitempty"`
+	// Region is the AWS region of the S3 bucket.
+	Region string `json:"region,omitempty"`
+	// Profile is the AWS profile used to get the credentials.
+	Profile string `json:"profile,omitempty"`
+	// CredentialsFile is the AWS or Google Cloud credentials file, by default
+	// the default credentials of each provider are used.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// CloudFrontDistributionID is the id of the CloudFront distribution that
+	// serves an S3 bucket. If set, the objects published are invalidated.
+	CloudFrontDistributionID string `json:"cloudFrontDistributionID,omitempty"`
+}
+
+// Validate validates the publisher options.
+func (o *Options) Validate() error {
+	switch Type(strings.ToLower(string(o.Type))) {
+	case AmazonS3, GoogleCloudStorage:
+		if o.Bucket == "" {
+			return errors.Errorf("publisher %s requires a bucket", o.Type)
+		}
+	case AzureBlobStorage:
+		if o.ContainerURL == "" {
+			return errors.Errorf("publisher %s requires a containerURL", o.Type)
+		}
+	case "":
+		return errors.New("publisher type cannot be empty")
+	default:
+		return errors.Errorf("unsupported publisher type '%s'", o.Type)
+	}
+	if o.CloudFrontDistributionID != "" && Type(strings.ToLower(string(o.Type))) != AmazonS3 {
+		return errors.New("publisher cloudFrontDistributionID can only be used with s3")
+	}
+	return nil
+}
+
+// Publisher is the interface implemented by the object storage backends.
+type Publisher interface {
+	// Publish uploads the given objects, replacing the existing ones.
+	Publish(ctx context.Context, objects []*Object) error
+}
+
+// NewPublisherFunc is the function that creates a publisher.
+type NewPublisherFunc func(ctx context.Context, opts Options) (Publisher, error)
+
+var registry = new(sync.Map)
+
+// Register adds to the registry the function used to create the publishers of
+// type t.
+func Register(t Type, fn NewPublisherFunc) {
+	registry.Store(t, fn)
+}
+
+// LoadNewPublisherFunc returns the function used to create the publishers of
+// type t.
+func LoadNewPublisherFunc(t Type) (NewPublisherFunc, bool) {
+	v, ok := registry.Load(t)
+	if !ok {
+		return nil, false
+	}
+	fn, ok := v.(NewPublisherFunc)
+	return fn, ok
+}
+
+// New creates a publisher with the given options.
+func New(ctx context.Context, opts Options) (Publisher, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	t := Type(strings.ToLower(string(opts.Type)))
+	fn, ok := LoadNewPublisherFunc(t)
+	if !ok {
+		return nil, errors.Errorf("unsupported publisher type '%s'", t)
+	}
+	return fn(ctx, opts)
+}
+
+// ObjectName returns the name of the object with the given prefix.
+func ObjectName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
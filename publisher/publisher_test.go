@@ -0,0 +1,70 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+)
+
+type mockPublisher struct{}
+
+func (m *mockPublisher) Publish(ctx context.Context, objects []*Object) error {
+	return nil
+}
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"ok s3", Options{Type: "s3", Bucket: "crl", CloudFrontDistributionID: "E123"}, false},
+		{"ok gcs", Options{Type: "GCS", Bucket: "crl"}, false},
+		{"ok azblob", Options{Type: "azblob", ContainerURL: "https://account.blob.core.windows.net/crl?sig=sig"}, false},
+		{"fail empty", Options{}, true},
+		{"fail type", Options{Type: "ftp", Bucket: "crl"}, true},
+		{"fail bucket", Options{Type: "s3"}, true},
+		{"fail containerURL", Options{Type: "azblob"}, true},
+		{"fail cloudfront", Options{Type: "gcs", Bucket: "crl", CloudFrontDistributionID: "E123"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	Register(AmazonS3, func(ctx context.Context, opts Options) (Publisher, error) {
+		return &mockPublisher{}, nil
+	})
+	t.Cleanup(func() {
+		registry.Delete(AmazonS3)
+	})
+
+	if _, err := New(context.Background(), Options{Type: "S3", Bucket: "crl"}); err != nil {
+		t.Errorf("New() error = %v", err)
+	}
+	if _, err := New(context.Background(), Options{Type: "gcs", Bucket: "crl"}); err == nil {
+		t.Error("New() error = nil, want unsupported publisher")
+	}
+	if _, err := New(context.Background(), Options{Type: "s3"}); err == nil {
+		t.Error("New() error = nil, want validation error")
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	tests := []struct {
+		prefix, name, want string
+	}{
+		{"", "crl.der", "crl.der"},
+		{"pki", "crl.der", "pki/crl.der"},
+		{"pki/", "ocsp/01.der", "pki/ocsp/01.der"},
+	}
+	for _, tt := range tests {
+		if got := ObjectName(tt.prefix, tt.name); got != tt.want {
+			t.Errorf("ObjectName() = %v, want %v", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package resolver implements the caching DNS resolver shared by the ACME
+// validations and the policy hooks. Each lookup has a timeout, and the callers
+// stop waiting at the deadline of their context. Concurrent lookups of the
+// same name are done once, and the addresses are cached for a short time,
+// including the names that do not exist. If a lookup fails, the last known
+// addresses are used for a while, so a slow or failing upstream DNS server
+// does not delay every request.
+//
+// TXT records are not cached, as the dns-01 validations must see the records
+// updated by the ACME clients.
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default values of the options.
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultTTL         = 30 * time.Second
+	DefaultNegativeTTL = 5 * time.Second
+	DefaultMaxStale    = 5 * time.Minute
+	DefaultMaxEntries  = 10000
+)
+
+// Options are the options of a caching resolver.
+type Options struct {
+	// Timeout is the timeout of a lookup. It defaults to 5s.
+	Timeout time.Duration
+	// TTL is the time the results are cached. It defaults to 30s.
+	TTL time.Duration
+	// NegativeTTL is the time a name that does not exist is cached. It
+	// defaults to 5s.
+	NegativeTTL time.Duration
+	// MaxStale is the maximum time an expired result is used if it cannot be
+	// refreshed. It defaults to 5m.
+	MaxStale time.Duration
+	// MaxEntries is the maximum number of cached names. It defaults to 10000.
+	MaxEntries int
+}
+
+// Resolver is a caching DNS resolver. A nil resolver, or one without options,
+// uses the upstream resolver directly.
+type Resolver struct {
+	upstream *net.Resolver
+	options  *Options
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+// entry is a cached lookup. The done channel is closed when the lookup
+// finishes.
+type entry struct {
+	done       chan struct{}
+	values     []string
+	err        error
+	expires    time.Time
+	staleUntil time.Time
+}
+
+// New creates a resolver that caches the lookups of the upstream resolver
+// with the given options. If upstream is nil, net.DefaultResolver is used. If
+// the options are nil the lookups are not cached.
+func New(upstream *net.Resolver, o *Options) *Resolver {
+	if upstream == nil {
+		upstream = net.DefaultResolver
+	}
+	r := &Resolver{
+		upstream: upstream,
+		now:      time.Now,
+	}
+	if o != nil {
+		opts := *o
+		if opts.Timeout <= 0 {
+			opts.Timeout = DefaultTimeout
+		}
+		if opts.TTL <= 0 {
+			opts.TTL = DefaultTTL
+		}
+		if opts.NegativeTTL <= 0 {
+			opts.NegativeTTL = DefaultNegativeTTL
+		}
+		if opts.MaxStale < 0 {
+			opts.MaxStale = 0
+		} else if opts.MaxStale == 0 {
+			opts.MaxStale = DefaultMaxStale
+		}
+		if opts.MaxEntries <= 0 {
+			opts.MaxEntries = DefaultMaxEntries
+		}
+		r.options = &opts
+		r.cache = make(map[string]*entry)
+	}
+	return r
+}
+
+// WithUpstream returns a resolver with the same options and its own cache that
+// uses the given upstream resolver.
+func (r *Resolver) WithUpstream(upstream *net.Resolver) *Resolver {
+	if r == nil {
+		return New(upstream, nil)
+	}
+	return New(upstream, r.options)
+}
+
+// LookupTXT returns the TXT records of the given name. The records are not
+// cached, only the concurrent lookups of the same name are done once.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r == nil {
+		return net.DefaultResolver.LookupTXT(ctx, name)
+	}
+	return r.lookup(ctx, "txt:"+normalize(name), false, func(ctx context.Context) ([]string, error) {
+		return r.upstream.LookupTXT(ctx, name)
+	})
+}
+
+// LookupHost returns the addresses of the given host.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if r == nil {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+	return r.lookup(ctx, "host:"+normalize(host), true, func(ctx context.Context) ([]string, error) {
+		return r.upstream.LookupHost(ctx, host)
+	})
+}
+
+// DialContext returns a dial function that resolves the host of the address
+// with the resolver, and dials its addresses in order until one of them
+// succeeds. The timeout of the dialer is the timeout of the whole dial.
+func (r *Resolver) DialContext(d *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if r == nil || r.options == nil {
+		return d.DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return d.DialContext(ctx, network, address)
+		}
+		if d.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+			defer cancel()
+		}
+		addrs, err := r.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var firstErr error
+		for _, addr := range addrs {
+			if !matchNetwork(network, addr) {
+				continue
+			}
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if firstErr == nil {
+			firstErr = &net.DNSError{Err: "no suitable address found", Name: host}
+		}
+		return nil, firstErr
+	}
+}
+
+// lookup returns the cached values of the key, or calls fn to get them. If
+// cache is false, the values are only shared with the concurrent lookups.
+func (r *Resolver) lookup(ctx context.Context, key string, cache bool, fn func(context.Context) ([]string, error)) ([]string, error) {
+	if r.options == nil {
+		return fn(ctx)
+	}
+
+	r.mu.Lock()
+	now := r.now()
+	e, ok := r.cache[key]
+	if !ok || (isDone(e) && !now.Before(e.expires)) {
+		old := e
+		e = &entry{done: make(chan struct{})}
+		if old != nil && old.err == nil && now.Before(old.staleUntil) {
+			e.values, e.staleUntil = old.values, old.staleUntil
+		}
+		r.evict(now)
+		r.cache[key] = e
+		go r.run(key, e, cache, fn)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-e.done:
+		if e.err != nil {
+			return nil, e.err
+		}
+		return append([]string(nil), e.values...), nil
+	case <-ctx.Done():
+		return nil, &net.DNSError{
+			Err:       ctx.Err().Error(),
+			Name:      key[strings.IndexByte(key, ':')+1:],
+			IsTimeout: ctx.Err() == context.DeadlineExceeded,
+		}
+	}
+}
+
+// run runs the lookup of the given entry with the timeout of the resolver.
+// Names that do not exist are cached with the negative TTL, and other errors
+// are not cached, unless an expired result can be used instead.
+func (r *Resolver) run(key string, e *entry, cache bool, fn func(context.Context) ([]string, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.Timeout)
+	values, err := fn(ctx)
+	cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	switch {
+	case !cache:
+		e.values, e.err = values, err
+		if r.cache[key] == e {
+			delete(r.cache, key)
+		}
+	case err == nil:
+		e.values = values
+		e.expires = now.Add(r.options.TTL)
+		e.staleUntil = e.expires.Add(r.options.MaxStale)
+	case isNotFound(err):
+		e.values, e.err = nil, err
+		e.expires = now.Add(r.options.NegativeTTL)
+	case e.values != nil:
+		// Use the expired result, and try again after the negative TTL.
+		e.expires = now.Add(r.options.NegativeTTL)
+	default:
+		e.err = err
+		if r.cache[key] == e {
+			delete(r.cache, key)
+		}
+	}
+	close(e.done)
+}
+
+// evict removes the expired entries if the cache is full, and a random one if
+// it is still full. It must be called with the lock held.
+func (r *Resolver) evict(now time.Time) {
+	if len(r.cache) < r.options.MaxEntries {
+		return
+	}
+	for k, e := range r.cache {
+		if isDone(e) && !now.Before(e.expires) && !now.Before(e.staleUntil) {
+			delete(r.cache, k)
+		}
+	}
+	for k, e := range r.cache {
+		if len(r.cache) < r.options.MaxEntries {
+			break
+		}
+		if isDone(e) {
+			delete(r.cache, k)
+		}
+	}
+}
+
+func isDone(e *entry) bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNotFound(err error) bool {
+	if e, ok := err.(*net.DNSError); ok {
+		return e.IsNotFound
+	}
+	return false
+}
+
+// matchNetwork returns true if the address can be used in the network, tcp4
+// and udp4 only use IPv4 addresses, and tcp6 and udp6 IPv6 addresses.
+func matchNetwork(network, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	switch network {
+	case "tcp4", "udp4":
+		return ip.To4() != nil
+	case "tcp6", "udp6":
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
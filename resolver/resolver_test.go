@@ -0,0 +1,227 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	r := New(nil, nil)
+	if r.upstream != net.DefaultResolver || r.options != nil {
+		t.Errorf("New() = %+v, want no cache", r)
+	}
+	r = New(nil, &Options{})
+	want := &Options{
+		Timeout:     DefaultTimeout,
+		TTL:         DefaultTTL,
+		NegativeTTL: DefaultNegativeTTL,
+		MaxStale:    DefaultMaxStale,
+		MaxEntries:  DefaultMaxEntries,
+	}
+	if !reflect.DeepEqual(r.options, want) {
+		t.Errorf("New() options = %+v, want %+v", r.options, want)
+	}
+	upstream := &net.Resolver{PreferGo: true}
+	r = r.WithUpstream(upstream)
+	if r.upstream != upstream || !reflect.DeepEqual(r.options, want) {
+		t.Errorf("Resolver.WithUpstream() = %+v", r)
+	}
+	r = New(nil, &Options{MaxStale: -1})
+	if r.options.MaxStale != 0 {
+		t.Errorf("New() MaxStale = %s, want 0", r.options.MaxStale)
+	}
+}
+
+func TestResolver_lookup(t *testing.T) {
+	now := time.Now()
+	r := New(nil, &Options{
+		TTL:         time.Minute,
+		NegativeTTL: time.Second,
+		MaxStale:    10 * time.Minute,
+	})
+	r.now = func() time.Time { return now }
+
+	var calls int
+	var values []string
+	var err error
+	lookup := func(want []string, wantErr error, wantCalls int) {
+		t.Helper()
+		got, gotErr := r.lookup(context.Background(), "host:example.com", true, func(ctx context.Context) ([]string, error) {
+			calls++
+			return values, err
+		})
+		if !reflect.DeepEqual(got, want) || gotErr != wantErr {
+			t.Fatalf("Resolver.lookup() = %v, %v, want %v, %v", got, gotErr, want, wantErr)
+		}
+		if calls != wantCalls {
+			t.Fatalf("Resolver.lookup() calls = %d, want %d", calls, wantCalls)
+		}
+	}
+
+	// Names that do not exist are cached with the negative TTL.
+	notFound := &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}
+	err = notFound
+	lookup(nil, notFound, 1)
+	lookup(nil, notFound, 1)
+	now = now.Add(time.Second)
+
+	// The results are cached with the TTL.
+	values, err = []string{"foo"}, nil
+	lookup([]string{"foo"}, nil, 2)
+	values = []string{"bar"}
+	lookup([]string{"foo"}, nil, 2)
+	now = now.Add(time.Minute)
+	lookup([]string{"bar"}, nil, 3)
+
+	// Expired results are used if the lookup fails, and the lookup is retried
+	// after the negative TTL.
+	now = now.Add(time.Minute)
+	err = errors.New("server misbehaving")
+	lookup([]string{"bar"}, nil, 4)
+	lookup([]string{"bar"}, nil, 4)
+	now = now.Add(time.Second)
+	lookup([]string{"bar"}, nil, 5)
+
+	// Other errors are not cached once the results are too old.
+	now = now.Add(10 * time.Minute)
+	lookup(nil, err, 6)
+	lookup(nil, err, 7)
+}
+
+func TestResolver_lookup_noCache(t *testing.T) {
+	r := New(nil, &Options{})
+	var calls int
+	for i := 1; i <= 3; i++ {
+		got, err := r.lookup(context.Background(), "txt:_acme-challenge.example.com", false, func(ctx context.Context) ([]string, error) {
+			calls++
+			return []string{"token"}, nil
+		})
+		if err != nil || !reflect.DeepEqual(got, []string{"token"}) || calls != i {
+			t.Fatalf("Resolver.lookup() = %v, %v, calls = %d", got, err, calls)
+		}
+	}
+	if len(r.cache) != 0 {
+		t.Errorf("Resolver cache has %d entries, want 0", len(r.cache))
+	}
+}
+
+func TestResolver_lookup_concurrent(t *testing.T) {
+	r := New(nil, &Options{})
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) ([]string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []string{"127.0.0.1"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := r.lookup(context.Background(), "host:example.com", true, fn)
+			if err != nil || !reflect.DeepEqual(got, []string{"127.0.0.1"}) {
+				t.Errorf("Resolver.lookup() = %v, %v", got, err)
+			}
+		}()
+	}
+
+	// Callers stop waiting at the deadline of their context.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := r.lookup(ctx, "host:example.com", true, fn)
+	if e, ok := err.(*net.DNSError); !ok || !e.IsTimeout || e.Name != "example.com" {
+		t.Errorf("Resolver.lookup() error = %#v, want timeout", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Resolver.lookup() calls = %d, want 1", n)
+	}
+}
+
+func TestResolver_lookup_timeout(t *testing.T) {
+	r := New(nil, &Options{Timeout: 10 * time.Millisecond})
+	_, err := r.lookup(context.Background(), "host:example.com", true, func(ctx context.Context) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Resolver.lookup() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestResolver_evict(t *testing.T) {
+	r := New(nil, &Options{MaxEntries: 2, MaxStale: -1})
+	fn := func(ctx context.Context) ([]string, error) {
+		return []string{"127.0.0.1"}, nil
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if _, err := r.lookup(context.Background(), "host:"+name, true, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(r.cache) > 2 {
+		t.Errorf("Resolver cache has %d entries, want 2", len(r.cache))
+	}
+}
+
+func TestResolver_DialContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(nil, &Options{})
+	r.cache["host:ca.example.com"] = &entry{
+		done:    closedChannel(),
+		values:  []string{"::1", "127.0.0.1"},
+		expires: time.Now().Add(time.Minute),
+	}
+	dial := r.DialContext(&net.Dialer{Timeout: time.Second})
+
+	conn, err := dial(context.Background(), "tcp4", net.JoinHostPort("ca.example.com", port))
+	if err != nil {
+		t.Fatalf("Resolver.DialContext() error = %v", err)
+	}
+	conn.Close()
+
+	conn, err = dial(context.Background(), "tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatalf("Resolver.DialContext() error = %v", err)
+	}
+	conn.Close()
+
+	if _, err := dial(context.Background(), "tcp6", net.JoinHostPort("ca.example.com", port)); err == nil {
+		t.Error("Resolver.DialContext() error = nil, want error")
+	}
+}
+
+func closedChannel() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/scep"
 	"go.mozilla.org/pkcs7"
 
@@ -69,6 +70,42 @@ func (h *Handler) Route(r api.Router) {
 	getLink := h.Auth.GetLinkExplicit
 	r.MethodFunc(http.MethodGet, getLink("{provisionerID}", false, nil), h.lookupProvisioner(h.Get))
 	r.MethodFunc(http.MethodPost, getLink("{provisionerID}", false, nil), h.lookupProvisioner(h.Post))
+	r.MethodFunc(http.MethodPost, getLink("{provisionerID}", false, nil)+"/jamf", h.lookupProvisioner(h.JamfWebhook))
+}
+
+// JamfWebhook handles the SCEPChallenge webhooks sent by Jamf Pro. The
+// challenges received are later used to validate the SCEP requests.
+func (h *Handler) JamfWebhook(w http.ResponseWriter, r *http.Request) {
+
+	p, err := scep.ProvisionerFromContext(r.Context())
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	jamf := p.GetJamf()
+	if jamf == nil {
+		api.WriteError(w, errs.NotFound("jamf integration is not enabled"))
+		return
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || !jamf.AuthorizeWebhook(username, password) {
+		api.WriteError(w, errs.Unauthorized("invalid jamf webhook credentials"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		api.WriteError(w, errs.BadRequestErr(err, errs.WithMessage("error reading request body")))
+		return
+	}
+	if err := jamf.AddChallenge(body); err != nil {
+		api.WriteError(w, errs.BadRequestErr(err, errs.WithMessage("error adding jamf challenge")))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // Get handles all SCEP GET requests
@@ -288,22 +325,79 @@ func (h *Handler) PKIOperation(ctx context.Context, request SCEPRequest) (SCEPRe
 	}
 
 	// NOTE: at this point we have sufficient information for returning nicely signed CertReps
+
+	// Clients poll for held enrollments using the transaction id of the
+	// original request.
+	if msg.MessageType == microscep.CertPoll {
+		return h.pollPendingRequest(ctx, msg)
+	}
+
 	csr := msg.CSRReqMessage.CSR
 
-	if msg.MessageType == microscep.PKCSReq {
+	var isRenewal bool
+	switch msg.MessageType {
+	case microscep.PKCSReq, microscep.UpdateReq, microscep.RenewalReq:
 
-		challengeMatches, err := h.Auth.MatchChallengePassword(ctx, msg.CSRReqMessage.ChallengePassword)
+		// Requests signed with a valid certificate issued by the CA are
+		// renewals and, by default, do not require the challenge password.
+		isRenewal, err = h.Auth.AuthorizeRenewal(ctx, msg)
 		if err != nil {
-			return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("error when checking password"))
+			return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.Wrap(err, "error authorizing renewal"))
+		}
+
+		if !isRenewal && msg.MessageType != microscep.PKCSReq {
+			return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("renewal request must be signed with a valid certificate"))
+		}
+
+		if !isRenewal || requireChallengeOnRenewal(ctx) {
+			challengeMatches, err := h.Auth.ValidateChallenge(ctx, msg)
+			if err != nil {
+				return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.Wrap(err, "error when checking password"))
+			}
+
+			if !challengeMatches {
+				// TODO: can this be returned safely to the client? In the end, if the password was correct, that gains a bit of info too.
+				return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("wrong password provided"))
+			}
 		}
+	}
 
-		if !challengeMatches {
-			// TODO: can this be returned safely to the client? In the end, if the password was correct, that gains a bit of info too.
-			return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("wrong password provided"))
+	// TODO: check if CN already exists and if existing should be revoked; fail if not
+
+	// New enrollments might need to wait for manual approval.
+	if !isRenewal {
+		hold, err := h.Auth.HoldForApproval(ctx, csr, msg)
+		if err != nil {
+			return h.createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.Wrap(err, "error checking approval"))
+		}
+		if hold {
+			return h.createPendingResponse(ctx, msg)
 		}
 	}
 
-	// TODO: check if CN already exists, if renewal is allowed and if existing should be revoked; fail if not
+	return h.signCSR(ctx, csr, msg)
+}
+
+// pollPendingRequest handles the CertPoll (GetCertInitial) messages sent by
+// clients waiting for the approval of an enrollment.
+func (h *Handler) pollPendingRequest(ctx context.Context, msg *scep.PKIMessage) (SCEPResponse, error) {
+
+	csr, status, err := h.Auth.PollPendingRequest(ctx, msg)
+	if err != nil {
+		return h.createFailureResponse(ctx, nil, msg, microscep.BadCertID, errors.Wrap(err, "error polling request"))
+	}
+
+	if status == scep.StatusPending {
+		return h.createPendingResponse(ctx, msg)
+	}
+
+	msg.CSRReqMessage = &microscep.CSRReqMessage{
+		CSR: csr,
+	}
+	return h.signCSR(ctx, csr, msg)
+}
+
+func (h *Handler) signCSR(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage) (SCEPResponse, error) {
 
 	certRep, err := h.Auth.SignCSR(ctx, csr, msg)
 	if err != nil {
@@ -319,6 +413,16 @@ func (h *Handler) PKIOperation(ctx context.Context, request SCEPRequest) (SCEPRe
 	return response, nil
 }
 
+// requireChallengeOnRenewal returns whether the provisioner in the context
+// requires the challenge password on renewals.
+func requireChallengeOnRenewal(ctx context.Context) bool {
+	p, err := scep.ProvisionerFromContext(ctx)
+	if err != nil {
+		return true
+	}
+	return p.ShouldRequireChallengeOnRenewal()
+}
+
 func formatCapabilities(caps []string) []byte {
 	return []byte(strings.Join(caps, "\r\n"))
 }
@@ -361,6 +465,17 @@ func (h *Handler) createFailureResponse(ctx context.Context, csr *x509.Certifica
 	}, nil
 }
 
+func (h *Handler) createPendingResponse(ctx context.Context, msg *scep.PKIMessage) (SCEPResponse, error) {
+	certRepMsg, err := h.Auth.CreatePendingResponse(ctx, msg)
+	if err != nil {
+		return SCEPResponse{}, err
+	}
+	return SCEPResponse{
+		Operation: opnPKIOperation,
+		Data:      certRepMsg.Raw,
+	}, nil
+}
+
 func contentHeader(r SCEPResponse) string {
 	switch r.Operation {
 	case opnGetCACert:
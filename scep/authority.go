@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/subtle"
 	"crypto/x509"
+	"log"
 	"net/url"
 
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -28,6 +29,11 @@ type Interface interface {
 	SignCSR(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) (*PKIMessage, error)
 	CreateFailureResponse(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage, info FailInfoName, infoText string) (*PKIMessage, error)
 	MatchChallengePassword(ctx context.Context, password string) (bool, error)
+	ValidateChallenge(ctx context.Context, msg *PKIMessage) (bool, error)
+	AuthorizeRenewal(ctx context.Context, msg *PKIMessage) (bool, error)
+	HoldForApproval(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) (bool, error)
+	PollPendingRequest(ctx context.Context, msg *PKIMessage) (*x509.CertificateRequest, PendingStatus, error)
+	CreatePendingResponse(ctx context.Context, msg *PKIMessage) (*PKIMessage, error)
 	GetCACaps(ctx context.Context) []string
 }
 
@@ -57,6 +63,8 @@ type AuthorityOptions struct {
 type SignAuthority interface {
 	Sign(cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	LoadProvisionerByID(string) (provisioner.Interface, error)
+	GetRoots() ([]*x509.Certificate, error)
+	IsRevoked(sn string) (bool, error)
 }
 
 // New returns a new Authority that implements the SCEP interface.
@@ -136,31 +144,17 @@ func (a *Authority) getLinkExplicit(provisionerName string, abs bool, baseURL *u
 	return link
 }
 
-// GetCACertificates returns the certificate (chain) for the CA
+// GetCACertificates returns the certificate (chain) for the CA. If a
+// registration authority (RA) is enabled, the RA certificate is returned
+// first, followed by the CA chain, so clients encrypt the messages for the RA
+// and the CA key is not used for SCEP operations.
 func (a *Authority) GetCACertificates() ([]*x509.Certificate, error) {
 
-	// TODO: this should return: the "SCEP Server (RA)" certificate, the issuing CA up to and excl. the root
-	// Some clients do need the root certificate however; also see: https://github.com/openxpki/openxpki/issues/73
-	//
-	// This means we might need to think about if we should use the current intermediate CA
-	// certificate as the "SCEP Server (RA)" certificate. It might be better to have a distinct
-	// RA certificate, with a corresponding rsa.PrivateKey, just for SCEP usage, which is signed by
-	// the intermediate CA. Will need to look how we can provide this nicely within step-ca.
-	//
-	// This might also mean that we might want to use a distinct instance of KMS for doing the key operations,
-	// so that we can use RSA just for SCEP.
-	//
-	// Using an RA does not seem to exist in https://tools.ietf.org/html/rfc8894, but is mentioned in
-	// https://tools.ietf.org/id/draft-nourse-scep-21.html. Will continue using the CA directly for now.
-	//
-	// The certificate to use should probably depend on the (configured) Provisioner and may
-	// use a distinct certificate, apart from the intermediate.
-
 	if a.intermediateCertificate == nil {
 		return nil, errors.New("no intermediate certificate available in SCEP authority")
 	}
 
-	return []*x509.Certificate{a.intermediateCertificate}, nil
+	return a.service.caCertificates()
 }
 
 // DecryptPKIEnvelope decrypts an enveloped message
@@ -171,7 +165,7 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 		return errors.Wrap(err, "error parsing pkcs7 content")
 	}
 
-	envelope, err := p7c.Decrypt(a.intermediateCertificate, a.service.decrypter)
+	envelope, err := a.service.decrypt(p7c)
 	if err != nil {
 		return errors.Wrap(err, "error decrypting encrypted pkcs7 content")
 	}
@@ -202,7 +196,11 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 			ChallengePassword: cp,
 		}
 		return nil
-	case microscep.GetCRL, microscep.GetCert, microscep.CertPoll:
+	case microscep.CertPoll:
+		// The request is identified by the transaction id, the issuer and
+		// subject in the envelope are not required.
+		return nil
+	case microscep.GetCRL, microscep.GetCert:
 		return errors.Errorf("not implemented")
 	}
 
@@ -248,6 +246,9 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	}
 	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
 	data.SetCertificateRequest(csr)
+	if msg.templateData != nil {
+		data.Set("MDM", msg.templateData)
+	}
 	data.SetSubject(x509util.Subject{
 		Country:            csr.Subject.Country,
 		Organization:       csr.Subject.Organization,
@@ -278,10 +279,17 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	}
 	signOps = append(signOps, templateOptions)
 
+	// Restrict the SANs to the device attributes sent by the MDM.
+	if v := p.GetOptions().GetEAPTLS().DeviceSANsValidator(msg.templateData); v != nil {
+		signOps = append(signOps, v)
+	}
+
 	certChain, err := a.signAuth.Sign(csr, opts, signOps...)
 	if err != nil {
+		notifyChallengeValidator(ctx, p, csr, msg, nil, err)
 		return nil, errors.Wrap(err, "error generating certificate for order")
 	}
+	notifyChallengeValidator(ctx, p, csr, msg, certChain[0], nil)
 
 	// take the issued certificate (only); https://tools.ietf.org/html/rfc8894#section-3.3.2
 	cert := certChain[0]
@@ -333,10 +341,13 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	// as the first certificate in the array
 	signedData.AddCertificate(cert)
 
-	authCert := a.intermediateCertificate
+	authCert, authSigner, err := a.service.signerCertificate()
+	if err != nil {
+		return nil, err
+	}
 
 	// sign the attributes
-	if err := signedData.AddSigner(authCert, a.service.signer, config); err != nil {
+	if err := signedData.AddSigner(authCert, authSigner, config); err != nil {
 		return nil, err
 	}
 
@@ -404,8 +415,13 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, csr *x509.Certifi
 		return nil, err
 	}
 
+	authCert, authSigner, err := a.service.signerCertificate()
+	if err != nil {
+		return nil, err
+	}
+
 	// sign the attributes
-	if err := signedData.AddSigner(a.intermediateCertificate, a.service.signer, config); err != nil {
+	if err := signedData.AddSigner(authCert, authSigner, config); err != nil {
 		return nil, err
 	}
 
@@ -431,6 +447,206 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, csr *x509.Certifi
 	return crepMsg, nil
 }
 
+// CreatePendingResponse creates an appropriately signed reply telling the
+// client that the request is waiting for manual approval.
+func (a *Authority) CreatePendingResponse(ctx context.Context, msg *PKIMessage) (*PKIMessage, error) {
+
+	config := pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{
+				Type:  oidSCEPtransactionID,
+				Value: msg.TransactionID,
+			},
+			{
+				Type:  oidSCEPpkiStatus,
+				Value: microscep.PENDING,
+			},
+			{
+				Type:  oidSCEPmessageType,
+				Value: microscep.CertRep,
+			},
+			{
+				Type:  oidSCEPsenderNonce,
+				Value: msg.SenderNonce,
+			},
+			{
+				Type:  oidSCEPrecipientNonce,
+				Value: msg.SenderNonce,
+			},
+		},
+	}
+
+	signedData, err := pkcs7.NewSignedData(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	authCert, authSigner, err := a.service.signerCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	// sign the attributes
+	if err := signedData.AddSigner(authCert, authSigner, config); err != nil {
+		return nil, err
+	}
+
+	certRepBytes, err := signedData.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &CertRepMessage{
+		PKIStatus:      microscep.PENDING,
+		RecipientNonce: microscep.RecipientNonce(msg.SenderNonce),
+	}
+
+	// create a CertRep message from the original
+	crepMsg := &PKIMessage{
+		Raw:            certRepBytes,
+		TransactionID:  msg.TransactionID,
+		MessageType:    microscep.CertRep,
+		CertRepMessage: cr,
+	}
+
+	return crepMsg, nil
+}
+
+// HoldForApproval returns true if the enrollment must wait for manual
+// approval. The first time a request is held, or once the previous one has
+// expired, it is added to the approval queue, and once approved the request
+// can be issued.
+func (a *Authority) HoldForApproval(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) (bool, error) {
+
+	p, err := ProvisionerFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !p.ShouldRequireApproval(csr) {
+		return false, nil
+	}
+
+	id := string(msg.TransactionID)
+	pr, err := a.service.getPendingRequest(id)
+	switch {
+	case err == ErrPendingRequestNotFound:
+		return true, a.service.pending.StorePendingRequest(newPendingRequest(id, p.GetName(), csr, msg.templateData, a.service.clock.Now(), p.GetApprovalExpiry()))
+	case err != nil:
+		return false, err
+	case pr.Provisioner != p.GetName():
+		return false, errors.Errorf("transaction %s belongs to a different provisioner", id)
+	}
+
+	return a.resolvePendingRequest(pr)
+}
+
+// PollPendingRequest returns the status of a held enrollment, and its CSR if
+// it has been approved.
+func (a *Authority) PollPendingRequest(ctx context.Context, msg *PKIMessage) (*x509.CertificateRequest, PendingStatus, error) {
+
+	p, err := ProvisionerFromContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := string(msg.TransactionID)
+	pr, err := a.service.getPendingRequest(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if pr.Provisioner != p.GetName() {
+		return nil, "", errors.Errorf("transaction %s belongs to a different provisioner", id)
+	}
+
+	hold, err := a.resolvePendingRequest(pr)
+	switch {
+	case err != nil:
+		return nil, StatusRejected, err
+	case hold:
+		return nil, StatusPending, nil
+	}
+
+	csr, err := pr.GetCertificateRequest()
+	if err != nil {
+		return nil, "", err
+	}
+	msg.templateData = pr.Data
+	return csr, StatusApproved, nil
+}
+
+// resolvePendingRequest returns true if the request is still waiting for a
+// decision. Approved and rejected requests are removed from the queue once the
+// decision is sent to the client.
+func (a *Authority) resolvePendingRequest(pr *PendingRequest) (bool, error) {
+	if pr.Status == StatusPending {
+		return true, nil
+	}
+	if err := a.service.pending.DeletePendingRequest(pr.ID); err != nil {
+		return false, err
+	}
+	if pr.Status == StatusRejected {
+		return false, errors.Errorf("request %s has been rejected", pr.ID)
+	}
+	return false, nil
+}
+
+// ValidateChallenge validates the challenge password in the message. If the
+// provisioner has an external challenge validator, like Intune or Jamf, the
+// validator is used and the data returned will be available in the certificate
+// template as .MDM, otherwise the static challenge password is used.
+func (a *Authority) ValidateChallenge(ctx context.Context, msg *PKIMessage) (bool, error) {
+
+	p, err := ProvisionerFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	validator := p.GetChallengeValidator()
+	if validator == nil {
+		return a.MatchChallengePassword(ctx, msg.CSRReqMessage.ChallengePassword)
+	}
+
+	data, err := validator.ValidateChallenge(ctx, &provisioner.SCEPChallengeRequest{
+		TransactionID: string(msg.TransactionID),
+		Challenge:     msg.CSRReqMessage.ChallengePassword,
+		CSR:           msg.CSRReqMessage.CSR,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "error validating challenge")
+	}
+	msg.templateData = data
+
+	return true, nil
+}
+
+// notifyChallengeValidator notifies the external challenge validator of the
+// provisioner, if it requires it, of the result of a request it validated.
+// Errors are logged, the notifications do not change the response.
+func notifyChallengeValidator(ctx context.Context, p Provisioner, csr *x509.CertificateRequest, msg *PKIMessage, cert *x509.Certificate, signErr error) {
+	if msg.templateData == nil {
+		return
+	}
+	n, ok := p.GetChallengeValidator().(provisioner.SCEPChallengeNotifier)
+	if !ok {
+		return
+	}
+
+	req := &provisioner.SCEPChallengeRequest{
+		TransactionID: string(msg.TransactionID),
+		CSR:           csr,
+	}
+	var err error
+	if signErr != nil {
+		err = n.NotifyFailure(ctx, req, signErr)
+	} else {
+		err = n.NotifySuccess(ctx, req, cert)
+	}
+	if err != nil {
+		log.Printf("error notifying the challenge validator of scep transaction %s: %v", msg.TransactionID, err)
+	}
+}
+
 // MatchChallengePassword verifies a SCEP challenge password
 func (a *Authority) MatchChallengePassword(ctx context.Context, password string) (bool, error) {
 
@@ -450,6 +666,131 @@ func (a *Authority) MatchChallengePassword(ctx context.Context, password string)
 	return false, nil
 }
 
+// AuthorizeRenewal checks if the message is a renewal, a request signed with a
+// valid certificate previously issued by the CA. It returns false if the
+// message is signed with any other certificate, like the self-signed ones used
+// in the initial enrollment, and an error if it's a renewal that should not be
+// allowed.
+func (a *Authority) AuthorizeRenewal(ctx context.Context, msg *PKIMessage) (bool, error) {
+
+	p, err := ProvisionerFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	signer := msg.P7.GetOnlySigner()
+	if signer == nil || a.intermediateCertificate == nil {
+		return false, nil
+	}
+
+	roots, err := a.signAuth.GetRoots()
+	if err != nil {
+		return false, errors.Wrap(err, "error retrieving roots")
+	}
+	rootPool := x509.NewCertPool()
+	for _, crt := range roots {
+		rootPool.AddCert(crt)
+	}
+	intermediatePool := x509.NewCertPool()
+	intermediatePool.AddCert(a.intermediateCertificate)
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediatePool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return false, nil
+	}
+
+	// Make sure the message is signed by the key of the certificate.
+	if err := msg.P7.Verify(); err != nil {
+		return false, errors.Wrap(err, "error verifying renewal request signature")
+	}
+
+	isRevoked, err := a.signAuth.IsRevoked(signer.SerialNumber.String())
+	if err != nil {
+		return false, errors.Wrap(err, "error checking revocation status")
+	}
+	if isRevoked {
+		return false, errors.New("certificate has been revoked")
+	}
+
+	if msg.CSRReqMessage == nil || msg.CSRReqMessage.CSR == nil {
+		return false, errors.New("renewal request does not contain a CSR")
+	}
+	if err := authorizeRenewalRequest(ctx, p, signer, msg.CSRReqMessage.CSR); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// authorizeRenewalRequest checks that the certificate signing a renewal
+// request was issued by the given provisioner, and that the CSR does not
+// request a different subject or any name not in the certificate.
+func authorizeRenewalRequest(ctx context.Context, p Provisioner, signer *x509.Certificate, csr *x509.CertificateRequest) error {
+	// A certificate issued by any other provisioner, even another SCEP one,
+	// cannot be used to skip the challenge of this one.
+	if name, ok := provisioner.GetProvisionerName(signer.Extensions); !ok || name != p.GetName() {
+		return errors.Errorf("certificate was not issued by the provisioner %s", p.GetName())
+	}
+
+	if err := p.AuthorizeRenew(ctx, signer); err != nil {
+		return err
+	}
+
+	// The renewed certificate must have the same subject.
+	if csr.Subject.CommonName != signer.Subject.CommonName {
+		return errors.Errorf("renewal request common name %s does not match %s", csr.Subject.CommonName, signer.Subject.CommonName)
+	}
+
+	// And the names must be a subset of the ones in the certificate.
+	for _, name := range csr.DNSNames {
+		if !containsString(signer.DNSNames, name) {
+			return errors.Errorf("renewal request dns name %s is not in the certificate", name)
+		}
+	}
+	for _, name := range csr.EmailAddresses {
+		if !containsString(signer.EmailAddresses, name) {
+			return errors.Errorf("renewal request email address %s is not in the certificate", name)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		var found bool
+		for _, v := range signer.IPAddresses {
+			if ip.Equal(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("renewal request ip address %s is not in the certificate", ip)
+		}
+	}
+	for _, u := range csr.URIs {
+		var found bool
+		for _, v := range signer.URIs {
+			if u.String() == v.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("renewal request uri %s is not in the certificate", u)
+		}
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCACaps returns the CA capabilities
 func (a *Authority) GetCACaps(ctx context.Context) []string {
 
@@ -460,6 +801,9 @@ func (a *Authority) GetCACaps(ctx context.Context) []string {
 
 	caps := p.GetCapabilities()
 	if len(caps) == 0 {
+		if err := p.AuthorizeRenew(ctx, nil); err != nil {
+			return withoutCapability(defaultCapabilities, "Renewal")
+		}
 		return defaultCapabilities
 	}
 
@@ -471,3 +815,14 @@ func (a *Authority) GetCACaps(ctx context.Context) []string {
 
 	return caps
 }
+
+// withoutCapability returns a copy of the capabilities without the given one.
+func withoutCapability(caps []string, name string) []string {
+	res := make([]string, 0, len(caps))
+	for _, c := range caps {
+		if c != name {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -0,0 +1,183 @@
+package scep
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type renewalProvisioner struct {
+	Provisioner
+	name     string
+	renewErr error
+}
+
+func (p *renewalProvisioner) GetName() string {
+	return p.name
+}
+
+func (p *renewalProvisioner) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.renewErr
+}
+
+type challengeNotifier struct {
+	success []*x509.Certificate
+	failure []error
+}
+
+func (n *challengeNotifier) ValidateChallenge(ctx context.Context, req *provisioner.SCEPChallengeRequest) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (n *challengeNotifier) NotifySuccess(ctx context.Context, req *provisioner.SCEPChallengeRequest, cert *x509.Certificate) error {
+	n.success = append(n.success, cert)
+	return nil
+}
+
+func (n *challengeNotifier) NotifyFailure(ctx context.Context, req *provisioner.SCEPChallengeRequest, err error) error {
+	n.failure = append(n.failure, err)
+	return errors.New("notification failed")
+}
+
+type notifierProvisioner struct {
+	Provisioner
+	validator provisioner.SCEPChallengeValidator
+}
+
+func (p *notifierProvisioner) GetChallengeValidator() provisioner.SCEPChallengeValidator {
+	return p.validator
+}
+
+func newProvisionerExtension(t *testing.T, name string) pkix.Extension {
+	t.Helper()
+	b, err := asn1.Marshal(struct {
+		Type         int
+		Name         []byte
+		CredentialID []byte
+	}{10, []byte(name), nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1},
+		Value: b,
+	}
+}
+
+func Test_authorizeRenewalRequest(t *testing.T) {
+	u, err := url.Parse("urn:device:C02XK0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := url.Parse("urn:device:other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSigner := func(ext ...pkix.Extension) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "device"},
+			DNSNames:       []string{"device.local", "device.example.com"},
+			EmailAddresses: []string{"device@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{u},
+			Extensions:     ext,
+		}
+	}
+	scepExt := newProvisionerExtension(t, "scep")
+
+	tests := []struct {
+		name      string
+		p         Provisioner
+		signer    *x509.Certificate
+		csr       *x509.CertificateRequest
+		wantError string
+	}{
+		{"ok", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "device"},
+			DNSNames:       []string{"device.example.com", "device.local"},
+			EmailAddresses: []string{"device@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{u},
+		}, ""},
+		{"ok subset", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "device"},
+			DNSNames: []string{"device.local"},
+		}, ""},
+		{"fail no provisioner extension", &renewalProvisioner{name: "scep"}, newSigner(), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device"},
+		}, "was not issued by the provisioner scep"},
+		{"fail foreign provisioner", &renewalProvisioner{name: "scep"}, newSigner(newProvisionerExtension(t, "other-scep")), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device"},
+		}, "was not issued by the provisioner scep"},
+		{"fail renew disabled", &renewalProvisioner{name: "scep", renewErr: errors.New("renew is disabled")}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device"},
+		}, "renew is disabled"},
+		{"fail common name", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "other"},
+		}, "common name other does not match device"},
+		{"fail extra dns name", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "device"},
+			DNSNames: []string{"device.local", "admin.example.com"},
+		}, "dns name admin.example.com is not in the certificate"},
+		{"fail extra email", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "device"},
+			EmailAddresses: []string{"admin@example.com"},
+		}, "email address admin@example.com is not in the certificate"},
+		{"fail extra ip", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: "device"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.2")},
+		}, "ip address 10.0.0.2 is not in the certificate"},
+		{"fail extra uri", &renewalProvisioner{name: "scep"}, newSigner(scepExt), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device"},
+			URIs:    []*url.URL{other},
+		}, "uri urn:device:other is not in the certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeRenewalRequest(context.Background(), tt.p, tt.signer, tt.csr)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("authorizeRenewalRequest() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("authorizeRenewalRequest() error = %v, want %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func Test_notifyChallengeValidator(t *testing.T) {
+	ctx := context.Background()
+	csr := &x509.CertificateRequest{}
+	cert := &x509.Certificate{}
+	signErr := errors.New("sign failed")
+	validated := &PKIMessage{TransactionID: "1234", templateData: map[string]interface{}{"Provider": "intune"}}
+
+	// Requests not validated by the challenge validator.
+	n := &challengeNotifier{}
+	notifyChallengeValidator(ctx, &notifierProvisioner{validator: n}, csr, &PKIMessage{TransactionID: "1234"}, cert, nil)
+	if len(n.success) != 0 || len(n.failure) != 0 {
+		t.Errorf("notifyChallengeValidator() notified a request not validated")
+	}
+	notifyChallengeValidator(ctx, &notifierProvisioner{}, csr, validated, cert, nil)
+
+	notifyChallengeValidator(ctx, &notifierProvisioner{validator: n}, csr, validated, cert, nil)
+	if len(n.success) != 1 || n.success[0] != cert {
+		t.Errorf("notifyChallengeValidator() success = %v, want [%v]", n.success, cert)
+	}
+	// Notification errors are ignored.
+	notifyChallengeValidator(ctx, &notifierProvisioner{validator: n}, csr, validated, nil, signErr)
+	if len(n.failure) != 1 || n.failure[0] != signErr {
+		t.Errorf("notifyChallengeValidator() failure = %v, want [%v]", n.failure, signErr)
+	}
+}
@@ -4,10 +4,68 @@ import (
 	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
+// IssueFunc is the function used to issue a registration authority
+// certificate. It returns the certificate followed by its chain.
+type IssueFunc func(template *x509.Certificate, lifetime time.Duration) ([]*x509.Certificate, error)
+
+// RAOptions are the options of the SCEP registration authority (RA). If
+// enabled, SCEP messages are signed and decrypted with the RA key instead of
+// the intermediate key. The RA can use a configured certificate and key, or
+// a key generated by the service with a certificate issued by the CA.
+type RAOptions struct {
+	// CommonName is the common name of the RA certificate.
+	CommonName string
+	// Duration is the validity of the RA certificate. The certificate will be
+	// rotated after two thirds of it.
+	Duration time.Duration
+	// Issue is used to issue new RA certificates.
+	Issue IssueFunc
+	// Store persists the generated RA keys and certificates. If not set, they
+	// will be kept in memory and a new key will be generated on restart.
+	Store RAStore
+	// Certificate is the configured RA certificate. If set, the RA key is not
+	// generated nor rotated.
+	Certificate *x509.Certificate
+	// Signer signs the SCEP responses with the configured RA key.
+	Signer crypto.Signer
+	// Decrypter decrypts the SCEP messages with the configured RA key.
+	Decrypter crypto.Decrypter
+}
+
+// Validate checks the fields in RAOptions.
+func (o *RAOptions) Validate() error {
+	if o.Certificate == nil {
+		switch {
+		case o.Issue == nil:
+			return errors.New("registration authority issuer not configured")
+		case o.Duration <= 0:
+			return errors.New("registration authority duration must be greater than 0")
+		default:
+			return nil
+		}
+	}
+
+	if o.Certificate.PublicKeyAlgorithm != x509.RSA {
+		return errors.New("only the RSA algorithm is (currently) supported in the registration authority certificate")
+	}
+	if o.Signer == nil || o.Decrypter == nil {
+		return errors.New("registration authority key not configured")
+	}
+	if pub, ok := o.Signer.Public().(*rsa.PublicKey); !ok || !pub.Equal(o.Certificate.PublicKey) {
+		return errors.New("mismatch between registration authority certificate and signer public keys")
+	}
+	if pub, ok := o.Decrypter.Public().(*rsa.PublicKey); !ok || !pub.Equal(o.Certificate.PublicKey) {
+		return errors.New("mismatch between registration authority certificate and decrypter public keys")
+	}
+	return nil
+}
+
 type Options struct {
 	// CertificateChain is the issuer certificate, along with any other bundled certificates
 	// to be returned in the chain for consumers. Configured in the ca.json crt property.
@@ -16,6 +74,15 @@ type Options struct {
 	Signer crypto.Signer `json:"-"`
 	// Decrypter decrypts encrypted SCEP messages. Configured in the ca.json key property.
 	Decrypter crypto.Decrypter `json:"-"`
+	// RA enables a registration authority certificate distinct from the
+	// intermediate. Configured in the ca.json authority.scep.ra property.
+	RA *RAOptions `json:"-"`
+	// PendingStore stores the enrollments waiting for manual approval. If not
+	// set, the requests will be kept in memory.
+	PendingStore PendingStore `json:"-"`
+	// Clock is the source of the times of the pending requests. If not set,
+	// the system clock is used.
+	Clock provisioner.Clock `json:"-"`
 }
 
 // Validate checks the fields in Options.
@@ -29,6 +96,11 @@ func (o *Options) Validate() error {
 		return errors.New("certificate chain should at least have one certificate")
 	}
 
+	// The intermediate key is not used for SCEP messages if the RA is enabled.
+	if o.RA != nil {
+		return o.RA.Validate()
+	}
+
 	// According to the RFC: https://tools.ietf.org/html/rfc8894#section-3.1, SCEP
 	// can be used with something different than RSA, but requires the encryption
 	// to be performed using the challenge password. An older version of specification
@@ -0,0 +1,204 @@
+package scep
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var pendingRequestsTable = []byte("scep_pending_requests")
+
+// ErrPendingRequestNotFound is returned when a pending request does not exist.
+var ErrPendingRequestNotFound = errors.New("pending request not found")
+
+// PendingStatus is the status of an enrollment waiting for approval.
+type PendingStatus string
+
+const (
+	// StatusPending is the status of requests waiting for a decision.
+	StatusPending PendingStatus = "pending"
+	// StatusApproved is the status of requests that can be issued.
+	StatusApproved PendingStatus = "approved"
+	// StatusRejected is the status of requests that will not be issued.
+	StatusRejected PendingStatus = "rejected"
+)
+
+// PendingRequest is an enrollment request held for manual approval. The
+// request is identified by the SCEP transaction id, used by the client to
+// poll for the certificate. Requests expire after the approval expiry
+// configured in the provisioner, both while waiting for a decision and while
+// the decision waits for the client.
+type PendingRequest struct {
+	ID           string                 `json:"id"`
+	Provisioner  string                 `json:"provisioner"`
+	Subject      string                 `json:"subject"`
+	SerialNumber string                 `json:"serialNumber,omitempty"`
+	CSR          []byte                 `json:"csr"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	Status       PendingStatus          `json:"status"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	UpdatedAt    time.Time              `json:"updatedAt"`
+	ExpiresAt    time.Time              `json:"expiresAt"`
+}
+
+// newPendingRequest creates a new pending request for the given CSR, created
+// at now, that expires after the given duration.
+func newPendingRequest(id, provisionerName string, csr *x509.CertificateRequest, data map[string]interface{}, now time.Time, expiry time.Duration) *PendingRequest {
+	return &PendingRequest{
+		ID:           id,
+		Provisioner:  provisionerName,
+		Subject:      csr.Subject.CommonName,
+		SerialNumber: csr.Subject.SerialNumber,
+		CSR:          csr.Raw,
+		Data:         data,
+		Status:       StatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ExpiresAt:    now.Add(expiry),
+	}
+}
+
+// isExpired returns true if the request has expired.
+func (pr *PendingRequest) isExpired(now time.Time) bool {
+	return !now.Before(pr.ExpiresAt)
+}
+
+// GetCertificateRequest returns the parsed CSR of the pending request.
+func (pr *PendingRequest) GetCertificateRequest() (*x509.CertificateRequest, error) {
+	csr, err := x509.ParseCertificateRequest(pr.CSR)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing pending certificate request")
+	}
+	return csr, nil
+}
+
+// PendingStore is the interface used to store the requests waiting for
+// approval.
+type PendingStore interface {
+	GetPendingRequest(id string) (*PendingRequest, error)
+	GetPendingRequests() ([]*PendingRequest, error)
+	StorePendingRequest(pr *PendingRequest) error
+	DeletePendingRequest(id string) error
+}
+
+// NewPendingStore returns a PendingStore backed by the given database.
+func NewPendingStore(db nosql.DB) (PendingStore, error) {
+	if err := db.CreateTable(pendingRequestsTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(pendingRequestsTable))
+	}
+	return &pendingDB{db: db}, nil
+}
+
+type pendingDB struct {
+	db nosql.DB
+}
+
+func (p *pendingDB) GetPendingRequest(id string) (*PendingRequest, error) {
+	b, err := p.db.Get(pendingRequestsTable, []byte(id))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, ErrPendingRequestNotFound
+		}
+		return nil, errors.Wrapf(err, "error loading pending request %s", id)
+	}
+	pr := new(PendingRequest)
+	if err := json.Unmarshal(b, pr); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling pending request %s", id)
+	}
+	return pr, nil
+}
+
+func (p *pendingDB) GetPendingRequests() ([]*PendingRequest, error) {
+	entries, err := p.db.List(pendingRequestsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading pending requests")
+	}
+	prs := make([]*PendingRequest, 0, len(entries))
+	for _, entry := range entries {
+		pr := new(PendingRequest)
+		if err := json.Unmarshal(entry.Value, pr); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling pending request %s", string(entry.Key))
+		}
+		prs = append(prs, pr)
+	}
+	sortPendingRequests(prs)
+	return prs, nil
+}
+
+func (p *pendingDB) StorePendingRequest(pr *PendingRequest) error {
+	b, err := json.Marshal(pr)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling pending request %s", pr.ID)
+	}
+	if err := p.db.Set(pendingRequestsTable, []byte(pr.ID), b); err != nil {
+		return errors.Wrapf(err, "error storing pending request %s", pr.ID)
+	}
+	return nil
+}
+
+func (p *pendingDB) DeletePendingRequest(id string) error {
+	if err := p.db.Del(pendingRequestsTable, []byte(id)); err != nil {
+		return errors.Wrapf(err, "error deleting pending request %s", id)
+	}
+	return nil
+}
+
+// NewMemoryPendingStore returns a PendingStore that keeps the requests in
+// memory. It is used when the CA does not have a database.
+func NewMemoryPendingStore() PendingStore {
+	return &pendingMemory{
+		requests: make(map[string]PendingRequest),
+	}
+}
+
+type pendingMemory struct {
+	mu       sync.RWMutex
+	requests map[string]PendingRequest
+}
+
+func (p *pendingMemory) GetPendingRequest(id string) (*PendingRequest, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pr, ok := p.requests[id]
+	if !ok {
+		return nil, ErrPendingRequestNotFound
+	}
+	return &pr, nil
+}
+
+func (p *pendingMemory) GetPendingRequests() ([]*PendingRequest, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	prs := make([]*PendingRequest, 0, len(p.requests))
+	for _, pr := range p.requests {
+		pr := pr
+		prs = append(prs, &pr)
+	}
+	sortPendingRequests(prs)
+	return prs, nil
+}
+
+func (p *pendingMemory) StorePendingRequest(pr *PendingRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests[pr.ID] = *pr
+	return nil
+}
+
+func (p *pendingMemory) DeletePendingRequest(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.requests, id)
+	return nil
+}
+
+func sortPendingRequests(prs []*PendingRequest) {
+	sort.Slice(prs, func(i, j int) bool {
+		return prs[i].CreatedAt.Before(prs[j].CreatedAt)
+	})
+}
@@ -0,0 +1,282 @@
+package scep
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	microscep "github.com/micromdm/scep/v2/scep"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// errAny is used in the test cases that expect an error, but not a specific
+// one.
+var errAny = errors.New("any error")
+
+type approvalProvisioner struct {
+	Provisioner
+	name    string
+	require bool
+}
+
+func (p *approvalProvisioner) GetName() string {
+	return p.name
+}
+
+func (p *approvalProvisioner) ShouldRequireApproval(csr *x509.CertificateRequest) bool {
+	return p.require
+}
+
+func (p *approvalProvisioner) GetApprovalExpiry() time.Duration {
+	return time.Hour
+}
+
+func mustPendingCSR(t *testing.T) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "device", SerialNumber: "C02XK0"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+// storePendingRequest stores a request created at the current time of the
+// clock minus age, with the given status.
+func storePendingRequest(t *testing.T, s *Service, id, provisionerName string, status PendingStatus, age time.Duration, csr *x509.CertificateRequest) {
+	t.Helper()
+	pr := newPendingRequest(id, provisionerName, csr, map[string]interface{}{"deviceId": "1234"}, s.clock.Now(), time.Hour)
+	pr.Status = status
+	pr.CreatedAt = pr.CreatedAt.Add(-age)
+	pr.UpdatedAt = pr.CreatedAt
+	pr.ExpiresAt = pr.ExpiresAt.Add(-age)
+	if err := s.pending.StorePendingRequest(pr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthority_HoldForApproval(t *testing.T) {
+	clock := provisioner.NewFakeClock(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	csr := mustPendingCSR(t)
+
+	tests := []struct {
+		name       string
+		require    bool
+		stored     PendingStatus
+		storedFor  string
+		age        time.Duration
+		want       bool
+		wantErr    bool
+		wantStored PendingStatus
+	}{
+		{"ok not required", false, "", "", 0, false, false, ""},
+		{"ok new", true, "", "", 0, true, false, StatusPending},
+		{"ok pending", true, StatusPending, "scep", 30 * time.Minute, true, false, StatusPending},
+		{"ok approved", true, StatusApproved, "scep", 30 * time.Minute, false, false, ""},
+		{"ok expired", true, StatusPending, "scep", time.Hour, true, false, StatusPending},
+		{"ok expired approval", true, StatusApproved, "scep", 2 * time.Hour, true, false, StatusPending},
+		{"fail rejected", true, StatusRejected, "scep", 30 * time.Minute, false, true, ""},
+		{"fail provisioner", true, StatusPending, "other", 30 * time.Minute, false, true, StatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{pending: NewMemoryPendingStore(), clock: provisioner.UTCClock{Clock: clock}}
+			if tt.stored != "" {
+				storePendingRequest(t, s, "tid", tt.storedFor, tt.stored, tt.age, csr)
+			}
+			a := &Authority{service: s}
+			ctx := context.WithValue(context.Background(), ProvisionerContextKey, &approvalProvisioner{name: "scep", require: tt.require})
+			msg := &PKIMessage{TransactionID: microscep.TransactionID("tid")}
+
+			got, err := a.HoldForApproval(ctx, csr, msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.HoldForApproval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Authority.HoldForApproval() = %v, want %v", got, tt.want)
+			}
+
+			pr, err := s.pending.GetPendingRequest("tid")
+			switch {
+			case tt.wantStored == "":
+				if err != ErrPendingRequestNotFound {
+					t.Errorf("PendingStore.GetPendingRequest() error = %v, want %v", err, ErrPendingRequestNotFound)
+				}
+			case err != nil:
+				t.Errorf("PendingStore.GetPendingRequest() error = %v", err)
+			case pr.Status != tt.wantStored:
+				t.Errorf("PendingRequest.Status = %s, want %s", pr.Status, tt.wantStored)
+			case tt.stored == "" || tt.age >= time.Hour:
+				if !pr.CreatedAt.Equal(clock.Now()) || !pr.ExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+					t.Errorf("PendingRequest created at %s, expires at %s, want a new request", pr.CreatedAt, pr.ExpiresAt)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_PollPendingRequest(t *testing.T) {
+	clock := provisioner.NewFakeClock(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	csr := mustPendingCSR(t)
+
+	tests := []struct {
+		name       string
+		stored     PendingStatus
+		storedFor  string
+		age        time.Duration
+		wantCSR    bool
+		wantStatus PendingStatus
+		wantErr    error
+		wantStored bool
+	}{
+		{"ok pending", StatusPending, "scep", 30 * time.Minute, false, StatusPending, nil, true},
+		{"ok approved", StatusApproved, "scep", 30 * time.Minute, true, StatusApproved, nil, false},
+		{"fail rejected", StatusRejected, "scep", 30 * time.Minute, false, StatusRejected, errAny, false},
+		{"fail expired", StatusPending, "scep", time.Hour, false, "", ErrPendingRequestNotFound, false},
+		{"fail expired approval", StatusApproved, "scep", 2 * time.Hour, false, "", ErrPendingRequestNotFound, false},
+		{"fail not found", "", "", 0, false, "", ErrPendingRequestNotFound, false},
+		{"fail provisioner", StatusApproved, "other", 30 * time.Minute, false, "", errAny, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{pending: NewMemoryPendingStore(), clock: provisioner.UTCClock{Clock: clock}}
+			if tt.stored != "" {
+				storePendingRequest(t, s, "tid", tt.storedFor, tt.stored, tt.age, csr)
+			}
+			a := &Authority{service: s}
+			ctx := context.WithValue(context.Background(), ProvisionerContextKey, &approvalProvisioner{name: "scep", require: true})
+			msg := &PKIMessage{TransactionID: microscep.TransactionID("tid")}
+
+			got, status, err := a.PollPendingRequest(ctx, msg)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Authority.PollPendingRequest() error = %v", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("Authority.PollPendingRequest() error = nil, want error")
+			case tt.wantErr != nil && tt.wantErr != errAny && err != tt.wantErr:
+				t.Fatalf("Authority.PollPendingRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Authority.PollPendingRequest() status = %s, want %s", status, tt.wantStatus)
+			}
+			if tt.wantCSR {
+				if got == nil || !reflect.DeepEqual(got.Raw, csr.Raw) {
+					t.Error("Authority.PollPendingRequest() did not return the stored CSR")
+				}
+				if !reflect.DeepEqual(msg.templateData, map[string]interface{}{"deviceId": "1234"}) {
+					t.Errorf("PKIMessage.templateData = %v, want the stored data", msg.templateData)
+				}
+			} else if got != nil {
+				t.Errorf("Authority.PollPendingRequest() = %v, want nil", got)
+			}
+
+			_, err = s.pending.GetPendingRequest("tid")
+			if stored := err == nil; stored != tt.wantStored {
+				t.Errorf("PendingStore.GetPendingRequest() error = %v, want stored %v", err, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestService_updatePendingRequest(t *testing.T) {
+	clock := provisioner.NewFakeClock(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	csr := mustPendingCSR(t)
+
+	tests := []struct {
+		name       string
+		stored     PendingStatus
+		age        time.Duration
+		reject     bool
+		wantStatus PendingStatus
+		wantErr    error
+	}{
+		{"ok approve", StatusPending, 30 * time.Minute, false, StatusApproved, nil},
+		{"ok reject", StatusPending, 30 * time.Minute, true, StatusRejected, nil},
+		{"fail approved", StatusApproved, 30 * time.Minute, true, "", errAny},
+		{"fail rejected", StatusRejected, 30 * time.Minute, false, "", errAny},
+		{"fail expired", StatusPending, time.Hour, false, "", ErrPendingRequestNotFound},
+		{"fail not found", "", 0, false, "", ErrPendingRequestNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{pending: NewMemoryPendingStore(), clock: provisioner.UTCClock{Clock: clock}}
+			if tt.stored != "" {
+				storePendingRequest(t, s, "tid", "scep", tt.stored, tt.age, csr)
+			}
+
+			update := s.ApprovePendingRequest
+			if tt.reject {
+				update = s.RejectPendingRequest
+			}
+			pr, err := update("tid")
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Service.updatePendingRequest() error = %v", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Fatal("Service.updatePendingRequest() error = nil, want error")
+			case tt.wantErr != nil && tt.wantErr != errAny && err != tt.wantErr:
+				t.Fatalf("Service.updatePendingRequest() error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr != nil:
+				return
+			}
+
+			// The decision is kept for the time the request waited.
+			if pr.Status != tt.wantStatus {
+				t.Errorf("PendingRequest.Status = %s, want %s", pr.Status, tt.wantStatus)
+			}
+			if !pr.UpdatedAt.Equal(clock.Now()) || !pr.ExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+				t.Errorf("PendingRequest updated at %s, expires at %s, want %s, %s", pr.UpdatedAt, pr.ExpiresAt, clock.Now(), clock.Now().Add(time.Hour))
+			}
+			stored, err := s.pending.GetPendingRequest("tid")
+			if err != nil || !reflect.DeepEqual(stored, pr) {
+				t.Errorf("PendingStore.GetPendingRequest() = %v, %v, want %v", stored, err, pr)
+			}
+		})
+	}
+}
+
+func TestService_GetPendingRequests(t *testing.T) {
+	clock := provisioner.NewFakeClock(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	csr := mustPendingCSR(t)
+
+	s := &Service{pending: NewMemoryPendingStore(), clock: provisioner.UTCClock{Clock: clock}}
+	storePendingRequest(t, s, "expired", "scep", StatusPending, 2*time.Hour, csr)
+	storePendingRequest(t, s, "rejected", "scep", StatusRejected, time.Hour, csr)
+	storePendingRequest(t, s, "approved", "scep", StatusApproved, 45*time.Minute, csr)
+	storePendingRequest(t, s, "pending", "scep", StatusPending, 30*time.Minute, csr)
+
+	prs, err := s.GetPendingRequests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, pr := range prs {
+		ids = append(ids, pr.ID)
+	}
+	if want := []string{"approved", "pending"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Service.GetPendingRequests() = %v, want %v", ids, want)
+	}
+
+	// Expired requests are removed.
+	for _, id := range []string{"expired", "rejected"} {
+		if _, err := s.pending.GetPendingRequest(id); err != ErrPendingRequestNotFound {
+			t.Errorf("PendingStore.GetPendingRequest(%q) error = %v, want %v", id, err, ErrPendingRequestNotFound)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package scep
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/pemutil"
+)
+
+var (
+	raTable = []byte("scep_ra")
+	raKey   = []byte("credentials")
+)
+
+// RACredentials are the certificate and key of a registration authority
+// generated by the service.
+type RACredentials struct {
+	Certificate *x509.Certificate
+	Key         *rsa.PrivateKey
+}
+
+// RAStore is the interface used to persist the registration authority
+// credentials generated by the service, so the same key is used after a
+// restart and by all the instances of the CA.
+type RAStore interface {
+	// LoadRA returns the current and the previous credentials, or nil if
+	// they are not stored.
+	LoadRA() (current, previous *RACredentials, err error)
+	// RotateRA stores the given credentials if the current ones stored are
+	// still old. It returns false if another instance has already replaced
+	// them.
+	RotateRA(old, current, previous *RACredentials) (bool, error)
+}
+
+// NewRAStore returns a RAStore backed by the given database. The keys are
+// encrypted with the given password, if any.
+func NewRAStore(db nosql.DB, password []byte) (RAStore, error) {
+	if err := db.CreateTable(raTable); err != nil {
+		return nil, errors.Wrapf(err, "error creating table %s", string(raTable))
+	}
+	return &raDB{db: db, password: password}, nil
+}
+
+type raDB struct {
+	db       nosql.DB
+	password []byte
+}
+
+type raRecord struct {
+	Current  *raStoredCredentials `json:"current"`
+	Previous *raStoredCredentials `json:"previous,omitempty"`
+}
+
+type raStoredCredentials struct {
+	Certificate []byte `json:"certificate"`
+	Key         []byte `json:"key"`
+}
+
+func (r *raDB) LoadRA() (*RACredentials, *RACredentials, error) {
+	_, rec, err := r.load()
+	if err != nil || rec == nil {
+		return nil, nil, err
+	}
+	current, err := r.decode(rec.Current)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous, err := r.decode(rec.Previous)
+	if err != nil {
+		return nil, nil, err
+	}
+	return current, previous, nil
+}
+
+func (r *raDB) RotateRA(old, current, previous *RACredentials) (bool, error) {
+	b, rec, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	var stored []byte
+	if rec != nil && rec.Current != nil {
+		stored = rec.Current.Certificate
+	}
+	switch {
+	case old == nil && stored != nil:
+		return false, nil
+	case old != nil && !bytes.Equal(old.Certificate.Raw, stored):
+		return false, nil
+	}
+
+	newRec := new(raRecord)
+	if newRec.Current, err = r.encode(current); err != nil {
+		return false, err
+	}
+	if newRec.Previous, err = r.encode(previous); err != nil {
+		return false, err
+	}
+	nb, err := json.Marshal(newRec)
+	if err != nil {
+		return false, errors.Wrap(err, "error marshaling RA credentials")
+	}
+	_, swapped, err := r.db.CmpAndSwap(raTable, raKey, b, nb)
+	if err != nil {
+		return false, errors.Wrap(err, "error storing RA credentials")
+	}
+	return swapped, nil
+}
+
+// load returns the stored record and its raw value, or nil if there is none.
+func (r *raDB) load() ([]byte, *raRecord, error) {
+	b, err := r.db.Get(raTable, raKey)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrap(err, "error loading RA credentials")
+	}
+	rec := new(raRecord)
+	if err := json.Unmarshal(b, rec); err != nil {
+		return nil, nil, errors.Wrap(err, "error unmarshaling RA credentials")
+	}
+	return b, rec, nil
+}
+
+func (r *raDB) encode(c *RACredentials) (*raStoredCredentials, error) {
+	if c == nil {
+		return nil, nil
+	}
+	opts := []pemutil.Options{pemutil.WithPKCS8(true)}
+	if len(r.password) > 0 {
+		opts = append(opts, pemutil.WithPassword(r.password))
+	}
+	block, err := pemutil.Serialize(c.Key, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing RA key")
+	}
+	return &raStoredCredentials{
+		Certificate: c.Certificate.Raw,
+		Key:         pem.EncodeToMemory(block),
+	}, nil
+}
+
+func (r *raDB) decode(s *raStoredCredentials) (*RACredentials, error) {
+	if s == nil {
+		return nil, nil
+	}
+	crt, err := x509.ParseCertificate(s.Certificate)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing RA certificate")
+	}
+	var opts []pemutil.Options
+	if len(r.password) > 0 {
+		opts = append(opts, pemutil.WithPassword(r.password))
+	}
+	k, err := pemutil.ParseKey(s.Key, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing RA key")
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("RA key type %T is not supported", k)
+	}
+	return &RACredentials{Certificate: crt, Key: key}, nil
+}
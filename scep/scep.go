@@ -55,6 +55,9 @@ type PKIMessage struct {
 
 	// Used to sign message
 	Recipients []*x509.Certificate
+
+	// data returned by the challenge validation, available in templates
+	templateData map[string]interface{}
 }
 
 // CertRepMessage is a type of PKIMessage
@@ -3,14 +3,39 @@ package scep
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"go.mozilla.org/pkcs7"
 )
 
+// raKeySize is the size of the RSA keys used in the RA certificates.
+const raKeySize = 2048
+
 // Service is a wrapper for crypto.Signer and crypto.Decrypter
 type Service struct {
 	certificateChain []*x509.Certificate
 	signer           crypto.Signer
 	decrypter        crypto.Decrypter
+	ra               *RAOptions
+	pending          PendingStore
+	mu               sync.Mutex
+	currentRA        *RACredentials
+	previousRA       *RACredentials
+	clock            provisioner.UTCClock
+}
+
+// renewAt returns the time when the RA credentials should be rotated, two
+// thirds of the certificate lifetime.
+func (c *RACredentials) renewAt() time.Time {
+	lifetime := c.Certificate.NotAfter.Sub(c.Certificate.NotBefore)
+	return c.Certificate.NotBefore.Add(lifetime * 2 / 3)
 }
 
 func NewService(ctx context.Context, opts Options) (*Service, error) {
@@ -20,9 +45,230 @@ func NewService(ctx context.Context, opts Options) (*Service, error) {
 	}
 
 	// TODO: should this become similar to the New CertificateAuthorityService as in x509CAService?
-	return &Service{
+	s := &Service{
 		certificateChain: opts.CertificateChain,
 		signer:           opts.Signer,
 		decrypter:        opts.Decrypter,
-	}, nil
+		ra:               opts.RA,
+		pending:          opts.PendingStore,
+		clock:            provisioner.UTCClock{Clock: opts.Clock},
+	}
+	if s.pending == nil {
+		s.pending = NewMemoryPendingStore()
+	}
+
+	// Load or issue the first RA certificate on startup.
+	if s.ra != nil && s.ra.Certificate == nil {
+		if _, err := s.getRA(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// getRA returns the current generated RA credentials, rotating them if
+// necessary. The previous credentials are kept until their certificate
+// expires to decrypt messages from clients with a cached RA certificate. If
+// the RA has a store, the credentials are loaded from it, so the same keys
+// are used after a restart and by other instances.
+func (s *Service) getRA() (*RACredentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.currentRA != nil && now.Before(s.currentRA.renewAt()) {
+		return s.currentRA, nil
+	}
+
+	if s.ra.Store != nil {
+		current, previous, err := s.ra.Store.LoadRA()
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			s.setRA(current, previous)
+			if now.Before(current.renewAt()) {
+				return s.currentRA, nil
+			}
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, raKeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating RA key")
+	}
+	chain, err := s.ra.Issue(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: s.ra.CommonName},
+		PublicKey: key.Public(),
+		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}, s.ra.Duration)
+	if err != nil {
+		return nil, errors.Wrap(err, "error issuing RA certificate")
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("error issuing RA certificate: empty certificate chain")
+	}
+
+	old := s.currentRA
+	current := &RACredentials{
+		Certificate: chain[0],
+		Key:         key,
+	}
+	if s.ra.Store != nil {
+		ok, err := s.ra.Store.RotateRA(old, current, old)
+		if err != nil {
+			return nil, err
+		}
+		// Another instance has rotated the credentials first.
+		if !ok {
+			current, previous, err := s.ra.Store.LoadRA()
+			if err != nil {
+				return nil, err
+			}
+			if current == nil {
+				return nil, errors.New("error loading RA credentials: credentials not found")
+			}
+			s.setRA(current, previous)
+			return s.currentRA, nil
+		}
+	}
+	s.setRA(current, old)
+	return s.currentRA, nil
+}
+
+// setRA sets the RA credentials in use, dropping the previous ones if their
+// certificate has already expired.
+func (s *Service) setRA(current, previous *RACredentials) {
+	if previous != nil && !time.Now().Before(previous.Certificate.NotAfter) {
+		previous = nil
+	}
+	s.currentRA = current
+	s.previousRA = previous
+}
+
+// caCertificates returns the certificates returned in the GetCACert
+// operation: the RA certificate, if enabled, followed by the certificate
+// chain of the CA.
+func (s *Service) caCertificates() ([]*x509.Certificate, error) {
+	switch {
+	case s.ra == nil:
+		return s.certificateChain, nil
+	case s.ra.Certificate != nil:
+		return append([]*x509.Certificate{s.ra.Certificate}, s.certificateChain...), nil
+	}
+	ra, err := s.getRA()
+	if err != nil {
+		return nil, err
+	}
+	return append([]*x509.Certificate{ra.Certificate}, s.certificateChain...), nil
+}
+
+// signerCertificate returns the certificate and the signer used to sign SCEP
+// responses.
+func (s *Service) signerCertificate() (*x509.Certificate, crypto.Signer, error) {
+	switch {
+	case s.ra == nil:
+		return s.certificateChain[0], s.signer, nil
+	case s.ra.Certificate != nil:
+		return s.ra.Certificate, s.ra.Signer, nil
+	}
+	ra, err := s.getRA()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ra.Certificate, ra.Key, nil
+}
+
+// decrypt decrypts the enveloped content of a SCEP message. If the RA is
+// enabled, the message can be encrypted for the current or, until it
+// expires, the previous RA certificate.
+func (s *Service) decrypt(p7 *pkcs7.PKCS7) ([]byte, error) {
+	switch {
+	case s.ra == nil:
+		return p7.Decrypt(s.certificateChain[0], s.decrypter)
+	case s.ra.Certificate != nil:
+		return p7.Decrypt(s.ra.Certificate, s.ra.Decrypter)
+	}
+	current, err := s.getRA()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	previous := s.previousRA
+	s.mu.Unlock()
+
+	b, err := p7.Decrypt(current.Certificate, current.Key)
+	if err != nil && previous != nil && time.Now().Before(previous.Certificate.NotAfter) {
+		return p7.Decrypt(previous.Certificate, previous.Key)
+	}
+	return b, err
+}
+
+// GetPendingRequests returns the enrollments held for manual approval. The
+// expired requests are removed.
+func (s *Service) GetPendingRequests() ([]*PendingRequest, error) {
+	prs, err := s.pending.GetPendingRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	active := prs[:0]
+	for _, pr := range prs {
+		if pr.isExpired(now) {
+			if err := s.pending.DeletePendingRequest(pr.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		active = append(active, pr)
+	}
+	return active, nil
+}
+
+// getPendingRequest returns the pending request with the given id. Expired
+// requests are removed and ErrPendingRequestNotFound is returned.
+func (s *Service) getPendingRequest(id string) (*PendingRequest, error) {
+	pr, err := s.pending.GetPendingRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if pr.isExpired(s.clock.Now()) {
+		if err := s.pending.DeletePendingRequest(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrPendingRequestNotFound
+	}
+	return pr, nil
+}
+
+// ApprovePendingRequest approves the pending request with the given id. The
+// certificate will be issued the next time the client polls for it.
+func (s *Service) ApprovePendingRequest(id string) (*PendingRequest, error) {
+	return s.updatePendingRequest(id, StatusApproved)
+}
+
+// RejectPendingRequest rejects the pending request with the given id.
+func (s *Service) RejectPendingRequest(id string) (*PendingRequest, error) {
+	return s.updatePendingRequest(id, StatusRejected)
+}
+
+func (s *Service) updatePendingRequest(id string, status PendingStatus) (*PendingRequest, error) {
+	pr, err := s.getPendingRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if pr.Status != StatusPending {
+		return nil, errors.Errorf("pending request %s has already been %s", id, pr.Status)
+	}
+	// The decision is kept for the same time the request waited for it.
+	now := s.clock.Now()
+	pr.ExpiresAt = now.Add(pr.ExpiresAt.Sub(pr.CreatedAt))
+	pr.Status = status
+	pr.UpdatedAt = now
+	if err := s.pending.StorePendingRequest(pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
 }
@@ -0,0 +1,248 @@
+package scep
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/db"
+	"go.mozilla.org/pkcs7"
+)
+
+type raIssuer struct {
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	issued   int
+	backdate time.Duration
+}
+
+func newRAIssuer(t *testing.T) *raIssuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &raIssuer{ca: ca, caKey: key}
+}
+
+// Issue issues a RA certificate backdated by i.backdate.
+func (i *raIssuer) Issue(template *x509.Certificate, lifetime time.Duration) ([]*x509.Certificate, error) {
+	i.issued++
+	template.SerialNumber = big.NewInt(int64(i.issued + 1))
+	template.NotBefore = time.Now().Add(-i.backdate)
+	template.NotAfter = template.NotBefore.Add(lifetime)
+	der, err := x509.CreateCertificate(rand.Reader, template, i.ca, template.PublicKey, i.caKey)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{crt, i.ca}, nil
+}
+
+func newRAService(t *testing.T, ra *RAOptions) *Service {
+	t.Helper()
+	s, err := NewService(context.Background(), Options{
+		CertificateChain: []*x509.Certificate{{Raw: []byte("intermediate")}},
+		RA:               ra,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func mustEncrypt(t *testing.T, crt *x509.Certificate) *pkcs7.PKCS7 {
+	t.Helper()
+	b, err := pkcs7.Encrypt([]byte("message"), []*x509.Certificate{crt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p7
+}
+
+func TestService_getRA_store(t *testing.T) {
+	store, err := NewRAStore(db.NewMemoryDB(), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := newRAIssuer(t)
+	newOptions := func() *RAOptions {
+		return &RAOptions{CommonName: "SCEP RA", Duration: time.Hour, Issue: iss.Issue, Store: store}
+	}
+
+	// A restart loads the stored credentials and does not issue a new key.
+	s1 := newRAService(t, newOptions())
+	s2 := newRAService(t, newOptions())
+	if iss.issued != 1 {
+		t.Fatalf("NewService() issued %d certificates, want 1", iss.issued)
+	}
+	if !bytes.Equal(s2.currentRA.Certificate.Raw, s1.currentRA.Certificate.Raw) || !s2.currentRA.Key.Equal(s1.currentRA.Key) {
+		t.Fatal("NewService() did not load the stored RA credentials")
+	}
+
+	// Credentials due for renewal but not expired.
+	store, err = NewRAStore(db.NewMemoryDB(), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.issued = 0
+	iss.backdate = 50 * time.Minute
+	s1 = newRAService(t, newOptions())
+	first := s1.currentRA
+	iss.backdate = 0
+
+	// Rotation keeps the old key to decrypt messages from clients with a
+	// cached RA certificate.
+	current, err := s1.getRA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iss.issued != 2 || bytes.Equal(current.Certificate.Raw, first.Certificate.Raw) {
+		t.Fatal("getRA() did not rotate the RA credentials")
+	}
+
+	// After a restart, the new credentials and the previous ones are used.
+	s3 := newRAService(t, newOptions())
+	if !bytes.Equal(s3.currentRA.Certificate.Raw, current.Certificate.Raw) {
+		t.Error("NewService() did not load the rotated RA credentials")
+	}
+	if s3.previousRA == nil || !bytes.Equal(s3.previousRA.Certificate.Raw, first.Certificate.Raw) {
+		t.Fatal("NewService() did not load the previous RA credentials")
+	}
+	for _, crt := range []*x509.Certificate{current.Certificate, first.Certificate} {
+		if b, err := s3.decrypt(mustEncrypt(t, crt)); err != nil || string(b) != "message" {
+			t.Errorf("Service.decrypt() = %s, %v, want message", b, err)
+		}
+	}
+
+	// An instance with the old credentials loads the rotated ones.
+	stale := &Service{ra: newOptions(), currentRA: first}
+	got, err := stale.getRA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iss.issued != 2 || !bytes.Equal(got.Certificate.Raw, current.Certificate.Raw) {
+		t.Error("getRA() did not load the credentials rotated by another instance")
+	}
+
+	// Rotations from a stale instance are rejected.
+	if ok, err := store.RotateRA(first, first, nil); err != nil || ok {
+		t.Errorf("RAStore.RotateRA() = %v, %v, want false", ok, err)
+	}
+
+	// The previous credentials are dropped once their certificate expires.
+	iss.backdate = 2 * time.Hour
+	expired := &RACredentials{Key: first.Key}
+	chain, err := iss.Issue(&x509.Certificate{PublicKey: first.Key.Public()}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Certificate = chain[0]
+	if ok, err := store.RotateRA(current, current, expired); err != nil || !ok {
+		t.Fatalf("RAStore.RotateRA() = %v, %v, want true", ok, err)
+	}
+	s4 := newRAService(t, newOptions())
+	if s4.previousRA != nil {
+		t.Error("NewService() loaded expired RA credentials")
+	}
+	if _, err := s4.decrypt(mustEncrypt(t, expired.Certificate)); err == nil {
+		t.Error("Service.decrypt() error = nil, want decryption error")
+	}
+
+	// The keys are encrypted with the password.
+	other, err := NewRAStore(store.(*raDB).db, []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.LoadRA(); err == nil {
+		t.Error("RAStore.LoadRA() error = nil, want decryption error")
+	}
+}
+
+func TestService_configuredRA(t *testing.T) {
+	iss := newRAIssuer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := iss.Issue(&x509.Certificate{PublicKey: key.Public()}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ra      *RAOptions
+		wantErr bool
+	}{
+		{"ok", &RAOptions{Certificate: chain[0], Signer: key, Decrypter: key}, false},
+		{"fail no key", &RAOptions{Certificate: chain[0]}, true},
+		{"fail signer", &RAOptions{Certificate: chain[0], Signer: otherKey, Decrypter: key}, true},
+		{"fail decrypter", &RAOptions{Certificate: chain[0], Signer: key, Decrypter: otherKey}, true},
+		{"fail algorithm", &RAOptions{Certificate: iss.ca, Signer: key, Decrypter: key}, true},
+		{"fail no issuer", &RAOptions{Duration: time.Hour}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ra.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RAOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	issued := iss.issued
+	s := newRAService(t, &RAOptions{Certificate: chain[0], Signer: key, Decrypter: key, Issue: iss.Issue})
+	certs, err := s.caCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs[0] != chain[0] {
+		t.Error("Service.caCertificates() does not start with the configured RA certificate")
+	}
+	crt, signer, err := s.signerCertificate()
+	if err != nil || crt != chain[0] || signer != key {
+		t.Errorf("Service.signerCertificate() = %v, %v, %v, want the configured RA", crt, signer, err)
+	}
+	if b, err := s.decrypt(mustEncrypt(t, chain[0])); err != nil || string(b) != "message" {
+		t.Errorf("Service.decrypt() = %s, %v, want message", b, err)
+	}
+	if iss.issued != issued {
+		t.Error("NewService() issued a certificate for a configured RA")
+	}
+}
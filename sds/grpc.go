@@ -0,0 +1,287 @@
+package sds
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/sds/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// SecretDiscoveryServiceName is the name of the Envoy v3 SDS gRPC service.
+const SecretDiscoveryServiceName = "envoy.service.secret.v3.SecretDiscoveryService"
+
+// SecretDiscoveryServer is the interface implemented by the Envoy SDS gRPC
+// service. The incremental DeltaSecrets method is not supported.
+type SecretDiscoveryServer interface {
+	StreamSecrets(stream SecretDiscoveryStream) error
+	FetchSecrets(ctx context.Context, req *pb.DiscoveryRequest) (*pb.DiscoveryResponse, error)
+}
+
+// SecretDiscoveryStream is the server side of a StreamSecrets stream.
+type SecretDiscoveryStream interface {
+	Send(*pb.DiscoveryResponse) error
+	Recv() (*pb.DiscoveryRequest, error)
+	Context() context.Context
+}
+
+// RegisterSecretDiscoveryServer registers the SDS gRPC service in the given
+// server.
+func RegisterSecretDiscoveryServer(s *grpc.Server, srv SecretDiscoveryServer) {
+	s.RegisterService(&secretDiscoveryServiceDesc, srv)
+}
+
+// NewSecretDiscoveryServer returns the implementation of the SDS gRPC service.
+// As in the REST-JSON transport, clients are authenticated using the client
+// certificate in the TLS connection.
+func NewSecretDiscoveryServer(auth Authority, c *config.SDSConfig) SecretDiscoveryServer {
+	return &secretDiscoveryServer{
+		h: NewHandler(auth, c).(*Handler),
+	}
+}
+
+type secretDiscoveryServer struct {
+	h *Handler
+}
+
+// FetchSecrets returns the requested secrets.
+func (s *secretDiscoveryServer) FetchSecrets(ctx context.Context, req *pb.DiscoveryRequest) (*pb.DiscoveryResponse, error) {
+	cert := peerCertificate(ctx)
+	if cert == nil {
+		return nil, api.GRPCStatusError(errs.Unauthorized("missing peer certificate"))
+	}
+	if err := checkDiscoveryRequest(req); err != nil {
+		return nil, api.GRPCStatusError(err)
+	}
+	resources, _, err := s.h.getSecrets(cert, req.GetResourceNames())
+	if err != nil {
+		return nil, api.GRPCStatusError(err)
+	}
+	v := version(resources)
+	resp, err := newDiscoveryResponse(v, v[:16], resources)
+	if err != nil {
+		return nil, api.GRPCStatusError(err)
+	}
+	return resp, nil
+}
+
+// StreamSecrets implements the state of the world variant of the xDS
+// protocol. The secrets are sent when they are first requested, when the
+// requested names change, and when the workload certificate is rotated. The
+// requests that acknowledge, or reject, the last response do not get a new
+// response, and the requests with the nonce of an older response are
+// ignored.
+func (s *secretDiscoveryServer) StreamSecrets(stream SecretDiscoveryStream) error {
+	ctx := stream.Context()
+	cert := peerCertificate(ctx)
+	if cert == nil {
+		return api.GRPCStatusError(errs.Unauthorized("missing peer certificate"))
+	}
+
+	reqs := make(chan *pb.DiscoveryRequest)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		names       []string
+		nonce       string
+		lastVersion string
+		sent        int
+		rotate      <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case req := <-reqs:
+			if err := checkDiscoveryRequest(req); err != nil {
+				return api.GRPCStatusError(err)
+			}
+			if nonce != "" {
+				if req.GetResponseNonce() != nonce {
+					continue
+				}
+				if req.GetErrorDetail() != nil {
+					log.Printf("sds response %s rejected by %s: %s", nonce, cert.Subject, req.GetErrorDetail().GetMessage())
+				}
+				if equalNames(names, req.GetResourceNames()) {
+					continue
+				}
+			}
+			names = req.GetResourceNames()
+			lastVersion = ""
+		case <-rotate:
+		}
+
+		resources, renewAt, err := s.h.getSecrets(cert, names)
+		if err != nil {
+			return api.GRPCStatusError(err)
+		}
+		rotate = nil
+		if !renewAt.IsZero() {
+			rotate = time.After(time.Until(renewAt))
+		}
+		v := version(resources)
+		if v == lastVersion {
+			continue
+		}
+		sent++
+		resp, err := newDiscoveryResponse(v, strconv.Itoa(sent), resources)
+		if err != nil {
+			return api.GRPCStatusError(err)
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+		nonce, lastVersion = resp.Nonce, v
+	}
+}
+
+// checkDiscoveryRequest fails if the request is not for secrets.
+func checkDiscoveryRequest(req *pb.DiscoveryRequest) error {
+	if t := req.GetTypeUrl(); t != "" && t != SecretTypeURL {
+		return errs.BadRequest("unsupported type url %s", t)
+	}
+	return nil
+}
+
+// newDiscoveryResponse returns the gRPC discovery response with the given
+// secrets.
+func newDiscoveryResponse(v, nonce string, resources []*Secret) (*pb.DiscoveryResponse, error) {
+	resp := &pb.DiscoveryResponse{
+		VersionInfo: v,
+		TypeUrl:     SecretTypeURL,
+		Nonce:       nonce,
+	}
+	for _, r := range resources {
+		b, err := proto.Marshal(secretToProto(r))
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "sds.newDiscoveryResponse")
+		}
+		resp.Resources = append(resp.Resources, &anypb.Any{
+			TypeUrl: SecretTypeURL,
+			Value:   b,
+		})
+	}
+	return resp, nil
+}
+
+// secretToProto converts a secret to the protobuf message.
+func secretToProto(s *Secret) *pb.Secret {
+	secret := &pb.Secret{
+		Name: s.Name,
+	}
+	if s.TLSCertificate != nil {
+		secret.TlsCertificate = &pb.TlsCertificate{
+			CertificateChain: &pb.DataSource{InlineString: s.TLSCertificate.CertificateChain.InlineString},
+			PrivateKey:       &pb.DataSource{InlineString: s.TLSCertificate.PrivateKey.InlineString},
+		}
+	}
+	if s.ValidationContext != nil {
+		secret.ValidationContext = &pb.CertificateValidationContext{
+			TrustedCa: &pb.DataSource{InlineString: s.ValidationContext.TrustedCA.InlineString},
+		}
+	}
+	return secret
+}
+
+// equalNames returns true if both lists have the same names in the same
+// order.
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// peerCertificate returns the verified client certificate of the connection.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			return info.State.PeerCertificates[0]
+		}
+	}
+	return nil
+}
+
+var secretDiscoveryServiceDesc = grpc.ServiceDesc{
+	ServiceName: SecretDiscoveryServiceName,
+	HandlerType: (*SecretDiscoveryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "FetchSecrets", Handler: fetchSecretsHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamSecrets", Handler: streamSecretsHandler, ServerStreams: true, ClientStreams: true},
+	},
+	Metadata: "envoy/service/secret/v3/sds.proto",
+}
+
+func fetchSecretsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.DiscoveryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SecretDiscoveryServer).FetchSecrets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + SecretDiscoveryServiceName + "/FetchSecrets"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SecretDiscoveryServer).FetchSecrets(ctx, req.(*pb.DiscoveryRequest))
+	})
+}
+
+func streamSecretsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SecretDiscoveryServer).StreamSecrets(&secretDiscoveryStream{stream})
+}
+
+// secretDiscoveryStream implements the SecretDiscoveryStream interface.
+type secretDiscoveryStream struct {
+	grpc.ServerStream
+}
+
+func (s *secretDiscoveryStream) Send(resp *pb.DiscoveryResponse) error {
+	return s.ServerStream.SendMsg(resp)
+}
+
+func (s *secretDiscoveryStream) Recv() (*pb.DiscoveryRequest, error) {
+	req := new(pb.DiscoveryRequest)
+	if err := s.ServerStream.RecvMsg(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
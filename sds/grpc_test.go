@@ -0,0 +1,229 @@
+package sds
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/sds/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeSecretStream struct {
+	ctx   context.Context
+	reqs  chan *pb.DiscoveryRequest
+	resps chan *pb.DiscoveryResponse
+}
+
+func (s *fakeSecretStream) Send(resp *pb.DiscoveryResponse) error {
+	s.resps <- resp
+	return nil
+}
+
+func (s *fakeSecretStream) Recv() (*pb.DiscoveryRequest, error) {
+	req, ok := <-s.reqs
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s *fakeSecretStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeSecretStream) recv(t *testing.T) *pb.DiscoveryResponse {
+	t.Helper()
+	select {
+	case resp := <-s.resps:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a discovery response")
+		return nil
+	}
+}
+
+func withPeerCertificate(ctx context.Context, crt *x509.Certificate) context.Context {
+	return peer.NewContext(ctx, &peer.Peer{
+		Addr: &net.TCPAddr{},
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{crt}},
+		},
+	})
+}
+
+func secretNames(t *testing.T, resp *pb.DiscoveryResponse) []string {
+	t.Helper()
+	var names []string
+	for _, r := range resp.Resources {
+		if r.TypeUrl != SecretTypeURL {
+			t.Errorf("Any.TypeUrl = %s, want %s", r.TypeUrl, SecretTypeURL)
+		}
+		secret := new(pb.Secret)
+		if err := proto.Unmarshal(r.Value, secret); err != nil {
+			t.Fatal(err)
+		}
+		if secret.TlsCertificate != nil && secret.TlsCertificate.PrivateKey.GetInlineString() == "" {
+			t.Error("TlsCertificate.PrivateKey is empty")
+		}
+		names = append(names, secret.Name)
+	}
+	return names
+}
+
+func newSDSTestAuthority(t *testing.T, root *x509.Certificate, rotateIn time.Duration) *mockAuthority {
+	var rekeyCalls int
+	return &mockAuthority{
+		rekey: func(p *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+			rekeyCalls++
+			// The first certificate must be rotated after rotateIn.
+			notBefore := time.Now().Add(-time.Minute)
+			notAfter := notBefore.Add(time.Hour)
+			if rekeyCalls == 1 {
+				notBefore = time.Now().Add(rotateIn - 2*time.Second)
+				notAfter = notBefore.Add(3 * time.Second)
+			}
+			return []*x509.Certificate{mustCertificate(t, int64(10+rekeyCalls), notBefore, notAfter, pk), root}, nil
+		},
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+	}
+}
+
+func TestSecretDiscoveryServer_StreamSecrets(t *testing.T) {
+	now := time.Now()
+	root := mustCertificate(t, 1, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	crt := mustCertificate(t, 2, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	srv := NewSecretDiscoveryServer(newSDSTestAuthority(t, root, 200*time.Millisecond), nil)
+
+	ctx, cancel := context.WithCancel(withPeerCertificate(context.Background(), crt))
+	stream := &fakeSecretStream{
+		ctx:   ctx,
+		reqs:  make(chan *pb.DiscoveryRequest),
+		resps: make(chan *pb.DiscoveryResponse),
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.StreamSecrets(stream)
+	}()
+
+	// Initial request.
+	stream.reqs <- &pb.DiscoveryRequest{ResourceNames: []string{"default", "ROOTCA"}, TypeUrl: SecretTypeURL}
+	r1 := stream.recv(t)
+	if r1.Nonce != "1" || r1.TypeUrl != SecretTypeURL {
+		t.Errorf("DiscoveryResponse nonce = %s, type = %s, want 1, %s", r1.Nonce, r1.TypeUrl, SecretTypeURL)
+	}
+	if names := secretNames(t, r1); len(names) != 2 || names[0] != "default" || names[1] != "ROOTCA" {
+		t.Errorf("DiscoveryResponse secrets = %v, want [default ROOTCA]", names)
+	}
+
+	// The acknowledgement does not get a response, the next one is sent when
+	// the workload certificate is rotated.
+	stream.reqs <- &pb.DiscoveryRequest{VersionInfo: r1.VersionInfo, ResponseNonce: r1.Nonce, ResourceNames: []string{"default", "ROOTCA"}}
+	r2 := stream.recv(t)
+	if r2.Nonce != "2" || r2.VersionInfo == r1.VersionInfo {
+		t.Errorf("DiscoveryResponse nonce = %s, version = %s, want a rotated secret", r2.Nonce, r2.VersionInfo)
+	}
+
+	// Requests with an old nonce are ignored.
+	stream.reqs <- &pb.DiscoveryRequest{ResponseNonce: r1.Nonce, ResourceNames: []string{"default"}}
+	stream.reqs <- &pb.DiscoveryRequest{VersionInfo: r2.VersionInfo, ResponseNonce: r2.Nonce, ResourceNames: []string{"ROOTCA"}}
+	r3 := stream.recv(t)
+	if names := secretNames(t, r3); r3.Nonce != "3" || len(names) != 1 || names[0] != "ROOTCA" {
+		t.Errorf("DiscoveryResponse nonce = %s, secrets = %v, want 3, [ROOTCA]", r3.Nonce, names)
+	}
+
+	// Rejections of the last response are not retried.
+	stream.reqs <- &pb.DiscoveryRequest{ResponseNonce: r3.Nonce, ResourceNames: []string{"ROOTCA"}, ErrorDetail: &pb.Status{Code: 3, Message: "bad secret"}}
+	select {
+	case resp := <-stream.resps:
+		t.Errorf("unexpected DiscoveryResponse %v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("SecretDiscoveryServer.StreamSecrets() error = %v", err)
+	}
+}
+
+func TestSecretDiscoveryServer_StreamSecrets_errors(t *testing.T) {
+	now := time.Now()
+	root := mustCertificate(t, 1, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	crt := mustCertificate(t, 2, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	srv := NewSecretDiscoveryServer(newSDSTestAuthority(t, root, time.Hour), nil)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		req      *pb.DiscoveryRequest
+		wantCode codes.Code
+	}{
+		{"fail no peer", context.Background(), &pb.DiscoveryRequest{}, codes.Unauthenticated},
+		{"fail type url", withPeerCertificate(context.Background(), crt), &pb.DiscoveryRequest{TypeUrl: "type.googleapis.com/envoy.config.cluster.v3.Cluster"}, codes.InvalidArgument},
+		{"fail not found", withPeerCertificate(context.Background(), crt), &pb.DiscoveryRequest{ResourceNames: []string{"foo"}}, codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &fakeSecretStream{
+				ctx:   tt.ctx,
+				reqs:  make(chan *pb.DiscoveryRequest, 1),
+				resps: make(chan *pb.DiscoveryResponse, 1),
+			}
+			stream.reqs <- tt.req
+			close(stream.reqs)
+			err := srv.StreamSecrets(stream)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("SecretDiscoveryServer.StreamSecrets() code = %v, want %v", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSecretDiscoveryServer_FetchSecrets(t *testing.T) {
+	now := time.Now()
+	root := mustCertificate(t, 1, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	crt := mustCertificate(t, 2, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	srv := NewSecretDiscoveryServer(newSDSTestAuthority(t, root, time.Hour), nil)
+
+	resp, err := srv.FetchSecrets(withPeerCertificate(context.Background(), crt), &pb.DiscoveryRequest{})
+	if err != nil {
+		t.Fatalf("SecretDiscoveryServer.FetchSecrets() error = %v", err)
+	}
+	if names := secretNames(t, resp); len(names) != 2 || names[0] != "default" || names[1] != "ROOTCA" {
+		t.Errorf("DiscoveryResponse secrets = %v, want [default ROOTCA]", names)
+	}
+
+	// Through a gRPC connection without client certificate.
+	ln := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	RegisterSecretDiscoveryServer(s, srv)
+	go s.Serve(ln)
+	defer s.Stop()
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.Dial()
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = conn.Invoke(context.Background(), "/"+SecretDiscoveryServiceName+"/FetchSecrets", &pb.DiscoveryRequest{}, new(pb.DiscoveryResponse))
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Errorf("SecretDiscoveryServer.FetchSecrets() code = %v, want %v", code, codes.Unauthenticated)
+	}
+}
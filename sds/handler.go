@@ -0,0 +1,226 @@
+package sds
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+)
+
+// Authority is the interface implemented by a CA authority used by the SDS
+// handler.
+type Authority interface {
+	Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	GetRoots() ([]*x509.Certificate, error)
+	GetFederation() ([]*x509.Certificate, error)
+}
+
+// ClockAuthority is the interface implemented by the authorities with a clock.
+// If the authority implements it, the handler uses its clock to decide when
+// the workload secrets are rotated.
+type ClockAuthority interface {
+	GetClock() provisioner.Clock
+}
+
+// Handler implements the Envoy secret discovery service (SDS) using the
+// REST-JSON transport. Clients are authenticated using the client certificate
+// in the TLS connection, and every workload certificate is created rekeying
+// that certificate. The gRPC transport is implemented by the
+// SecretDiscoveryServer.
+type Handler struct {
+	auth   Authority
+	config *config.SDSConfig
+	clock  provisioner.Clock
+	mu     sync.Mutex
+	cache  map[string]*workloadSecret
+}
+
+type workloadSecret struct {
+	chain  []*x509.Certificate
+	keyPEM []byte
+}
+
+// renewAt returns the time when the workload secret should be replaced, two
+// thirds of the certificate lifetime.
+func (s *workloadSecret) renewAt() time.Time {
+	leaf := s.chain[0]
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return leaf.NotBefore.Add(lifetime * 2 / 3)
+}
+
+// NewHandler returns a new SDS handler.
+func NewHandler(auth Authority, c *config.SDSConfig) api.RouterHandler {
+	if c == nil {
+		c = new(config.SDSConfig)
+	}
+	c.Init()
+	var clock provisioner.Clock = provisioner.SystemClock{}
+	if ca, ok := auth.(ClockAuthority); ok {
+		clock = ca.GetClock()
+	}
+	return &Handler{
+		auth:   auth,
+		config: c,
+		clock:  clock,
+		cache:  make(map[string]*workloadSecret),
+	}
+}
+
+// Route adds the SDS endpoints to the given router. The path is the one used
+// by Envoy in the REST-JSON transport.
+func (h *Handler) Route(r api.Router) {
+	r.MethodFunc("POST", "/v3/discovery:secrets", h.FetchSecrets)
+}
+
+// FetchSecrets is the HTTP handler that returns the requested secrets.
+func (h *Handler) FetchSecrets(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		api.WriteError(w, errs.Unauthorized("missing peer certificate"))
+		return
+	}
+	peer := r.TLS.PeerCertificates[0]
+
+	var body DiscoveryRequest
+	if err := api.ReadLenientJSON(r.Body, &body); err != nil {
+		api.WriteError(w, err)
+		return
+	}
+	if body.TypeURL != "" && body.TypeURL != SecretTypeURL {
+		api.WriteError(w, errs.BadRequest("unsupported type url %s", body.TypeURL))
+		return
+	}
+	if body.ErrorDetail != nil {
+		api.LogError(w, errors.Errorf("sds response %s rejected: %s", body.ResponseNonce, body.ErrorDetail.Message))
+	}
+
+	resources, _, err := h.getSecrets(peer, body.ResourceNames)
+	if err != nil {
+		api.WriteError(w, err)
+		return
+	}
+
+	v := version(resources)
+	api.JSON(w, &DiscoveryResponse{
+		VersionInfo: v,
+		Resources:   resources,
+		TypeURL:     SecretTypeURL,
+		Nonce:       v[:16],
+	})
+}
+
+// getSecrets returns the secrets with the given names for the given peer
+// certificate, or all of them if no names are given. It also returns the time
+// when the secrets should be requested again, or the zero time if they do
+// not need to be rotated.
+func (h *Handler) getSecrets(peer *x509.Certificate, names []string) ([]*Secret, time.Time, error) {
+	if len(names) == 0 {
+		names = []string{h.config.WorkloadSecretName, h.config.RootsSecretName}
+	}
+
+	var renewAt time.Time
+	resources := make([]*Secret, 0, len(names))
+	for _, name := range names {
+		var (
+			secret *Secret
+			err    error
+		)
+		switch name {
+		case h.config.WorkloadSecretName:
+			secret, renewAt, err = h.getWorkloadSecret(peer)
+		case h.config.RootsSecretName:
+			secret, err = h.getRootsSecret()
+		default:
+			err = errs.NotFound("secret %s was not found", name)
+		}
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		resources = append(resources, secret)
+	}
+	return resources, renewAt, nil
+}
+
+// getWorkloadSecret returns the workload secret for the given peer
+// certificate and the time when it should be rotated. The same secret will be
+// returned until it needs to be rotated.
+func (h *Handler) getWorkloadSecret(peer *x509.Certificate) (*Secret, time.Time, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.clock.Now()
+	key := peer.SerialNumber.String()
+	if s, ok := h.cache[key]; ok && now.Before(s.renewAt()) {
+		return newTLSCertificateSecret(h.config.WorkloadSecretName, s.chain, s.keyPEM), s.renewAt(), nil
+	}
+
+	priv, err := keyutil.GenerateDefaultKey()
+	if err != nil {
+		return nil, time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "sds.getWorkloadSecret")
+	}
+	block, err := pemutil.Serialize(priv)
+	if err != nil {
+		return nil, time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "sds.getWorkloadSecret")
+	}
+	chain, err := h.auth.Rekey(peer, priv.(crypto.Signer).Public())
+	if err != nil {
+		return nil, time.Time{}, errs.Wrap(http.StatusInternalServerError, err, "sds.getWorkloadSecret")
+	}
+
+	// Remove expired entries before adding the new one.
+	for k, s := range h.cache {
+		if now.After(s.chain[0].NotAfter) {
+			delete(h.cache, k)
+		}
+	}
+	s := &workloadSecret{
+		chain:  chain,
+		keyPEM: pem.EncodeToMemory(block),
+	}
+	h.cache[key] = s
+
+	return newTLSCertificateSecret(h.config.WorkloadSecretName, s.chain, s.keyPEM), s.renewAt(), nil
+}
+
+// getRootsSecret returns the secret with the trust bundle.
+func (h *Handler) getRootsSecret() (*Secret, error) {
+	roots, err := h.auth.GetRoots()
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "sds.getRootsSecret")
+	}
+	if h.config.IncludeFederatedRoots {
+		federated, err := h.auth.GetFederation()
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "sds.getRootsSecret")
+		}
+		roots = mergeCertificates(roots, federated)
+	}
+	return newValidationContextSecret(h.config.RootsSecretName, roots), nil
+}
+
+// mergeCertificates returns the union of the two lists of certificates.
+func mergeCertificates(a, b []*x509.Certificate) []*x509.Certificate {
+	certs := append([]*x509.Certificate{}, a...)
+	for _, crt := range b {
+		found := false
+		for _, c := range a {
+			if crt.Equal(c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			certs = append(certs, crt)
+		}
+	}
+	return certs
+}
@@ -0,0 +1,250 @@
+package sds
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type mockAuthority struct {
+	rekey         func(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	getRoots      func() ([]*x509.Certificate, error)
+	getFederation func() ([]*x509.Certificate, error)
+}
+
+func (m *mockAuthority) Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	return m.rekey(peer, pk)
+}
+
+func (m *mockAuthority) GetRoots() ([]*x509.Certificate, error) {
+	return m.getRoots()
+}
+
+func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
+	return m.getFederation()
+}
+
+type mockClockAuthority struct {
+	*mockAuthority
+	clock provisioner.Clock
+}
+
+func (m *mockClockAuthority) GetClock() provisioner.Clock {
+	return m.clock
+}
+
+func mustCertificate(t *testing.T, serial int64, notBefore, notAfter time.Time, pub crypto.PublicKey) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub == nil {
+		pub = key.Public()
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+func TestHandler_FetchSecrets(t *testing.T) {
+	now := time.Now()
+	root := mustCertificate(t, 1, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	federated := mustCertificate(t, 2, now.Add(-time.Hour), now.Add(time.Hour), nil)
+	peer := mustCertificate(t, 3, now.Add(-time.Hour), now.Add(time.Hour), nil)
+
+	auth := &mockAuthority{
+		rekey: func(p *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{mustCertificate(t, 4, now.Add(-time.Minute), now.Add(time.Hour), pk), root}, nil
+		},
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+		getFederation: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root, federated}, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		tls        *tls.ConnectionState
+		req        *DiscoveryRequest
+		config     *config.SDSConfig
+		wantNames  []string
+		wantRoots  int
+		statusCode int
+	}{
+		{"ok", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}, &DiscoveryRequest{
+			ResourceNames: []string{"default", "ROOTCA"}, TypeURL: SecretTypeURL,
+		}, nil, []string{"default", "ROOTCA"}, 1, http.StatusOK},
+		{"ok all", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}, &DiscoveryRequest{},
+			nil, []string{"default", "ROOTCA"}, 1, http.StatusOK},
+		{"ok federated", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}, &DiscoveryRequest{
+			ResourceNames: []string{"bundle"},
+		}, &config.SDSConfig{RootsSecretName: "bundle", IncludeFederatedRoots: true}, []string{"bundle"}, 2, http.StatusOK},
+		{"fail no tls", nil, &DiscoveryRequest{}, nil, nil, 0, http.StatusUnauthorized},
+		{"fail type url", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}, &DiscoveryRequest{
+			TypeURL: "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+		}, nil, nil, 0, http.StatusBadRequest},
+		{"fail not found", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}, &DiscoveryRequest{
+			ResourceNames: []string{"foo"},
+		}, nil, nil, 0, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(auth, tt.config).(*Handler)
+			b, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/v3/discovery:secrets", bytes.NewReader(b))
+			req.TLS = tt.tls
+			w := httptest.NewRecorder()
+			h.FetchSecrets(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.statusCode {
+				t.Fatalf("Handler.FetchSecrets StatusCode = %d, want %d", res.StatusCode, tt.statusCode)
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp DiscoveryResponse
+			if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.TypeURL != SecretTypeURL {
+				t.Errorf("DiscoveryResponse.TypeURL = %s, want %s", resp.TypeURL, SecretTypeURL)
+			}
+			if len(resp.Resources) != len(tt.wantNames) {
+				t.Fatalf("DiscoveryResponse.Resources = %d, want %d", len(resp.Resources), len(tt.wantNames))
+			}
+			for i, r := range resp.Resources {
+				if r.Name != tt.wantNames[i] {
+					t.Errorf("Secret.Name = %s, want %s", r.Name, tt.wantNames[i])
+				}
+				if r.ValidationContext != nil {
+					n := bytes.Count([]byte(r.ValidationContext.TrustedCA.InlineString), []byte("BEGIN CERTIFICATE"))
+					if n != tt.wantRoots {
+						t.Errorf("ValidationContext.TrustedCA = %d certificates, want %d", n, tt.wantRoots)
+					}
+				}
+				if r.TLSCertificate != nil && r.TLSCertificate.PrivateKey.InlineString == "" {
+					t.Error("TLSCertificate.PrivateKey is empty")
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_getWorkloadSecret_cache(t *testing.T) {
+	now := time.Now()
+	peer := mustCertificate(t, 1, now.Add(-time.Hour), now.Add(time.Hour), nil)
+
+	var (
+		rekeyCalls int
+		notBefore  time.Time
+	)
+	h := NewHandler(&mockAuthority{
+		rekey: func(p *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+			rekeyCalls++
+			return []*x509.Certificate{mustCertificate(t, 2, notBefore, notBefore.Add(time.Hour), pk)}, nil
+		},
+	}, nil).(*Handler)
+
+	// New certificate.
+	notBefore = now.Add(-time.Minute)
+	s1, _, err := h.getWorkloadSecret(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cached certificate.
+	s2, _, err := h.getWorkloadSecret(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rekeyCalls != 1 {
+		t.Errorf("Authority.Rekey calls = %d, want 1", rekeyCalls)
+	}
+	if s1.TLSCertificate.PrivateKey.InlineString != s2.TLSCertificate.PrivateKey.InlineString {
+		t.Error("cached secret has a different private key")
+	}
+
+	// Force rotation.
+	notBefore = now.Add(-50 * time.Minute)
+	h.cache[peer.SerialNumber.String()].chain[0] = mustCertificate(t, 2, notBefore, notBefore.Add(time.Hour), nil)
+	s3, _, err := h.getWorkloadSecret(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rekeyCalls != 2 {
+		t.Errorf("Authority.Rekey calls = %d, want 2", rekeyCalls)
+	}
+	if s1.TLSCertificate.PrivateKey.InlineString == s3.TLSCertificate.PrivateKey.InlineString {
+		t.Error("rotated secret has the same private key")
+	}
+}
+
+func TestHandler_getWorkloadSecret_clock(t *testing.T) {
+	now := time.Now()
+	clock := provisioner.NewFakeClock(now)
+	peer := mustCertificate(t, 1, now.Add(-time.Hour), now.Add(time.Hour), nil)
+
+	var rekeyCalls int
+	h := NewHandler(&mockClockAuthority{
+		mockAuthority: &mockAuthority{
+			rekey: func(p *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+				rekeyCalls++
+				return []*x509.Certificate{mustCertificate(t, 2, now, now.Add(time.Hour), pk)}, nil
+			},
+		},
+		clock: clock,
+	}, nil).(*Handler)
+
+	if _, _, err := h.getWorkloadSecret(peer); err != nil {
+		t.Fatal(err)
+	}
+	// The secret is rotated at two thirds of its lifetime of the clock.
+	clock.Add(30 * time.Minute)
+	if _, _, err := h.getWorkloadSecret(peer); err != nil {
+		t.Fatal(err)
+	}
+	if rekeyCalls != 1 {
+		t.Errorf("Authority.Rekey calls = %d, want 1", rekeyCalls)
+	}
+	clock.Add(15 * time.Minute)
+	if _, _, err := h.getWorkloadSecret(peer); err != nil {
+		t.Fatal(err)
+	}
+	if rekeyCalls != 2 {
+		t.Errorf("Authority.Rekey calls = %d, want 2", rekeyCalls)
+	}
+}
@@ -0,0 +1,5 @@
+// Package pb contains the protocol buffer messages of the Envoy secret
+// discovery service, defined in sds.proto.
+package pb
+
+//go:generate protoc --proto_path=../.. --go_out=../.. --go_opt=paths=source_relative sds/pb/sds.proto
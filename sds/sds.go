@@ -0,0 +1,116 @@
+package sds
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+)
+
+// SecretTypeURL is the type url of the Envoy v3 secret resources.
+const SecretTypeURL = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret"
+
+// DiscoveryRequest is the JSON representation of the Envoy v3
+// DiscoveryRequest used in the REST-JSON xDS transport.
+type DiscoveryRequest struct {
+	VersionInfo   string          `json:"versionInfo,omitempty"`
+	Node          json.RawMessage `json:"node,omitempty"`
+	ResourceNames []string        `json:"resourceNames,omitempty"`
+	TypeURL       string          `json:"typeUrl,omitempty"`
+	ResponseNonce string          `json:"responseNonce,omitempty"`
+	ErrorDetail   *Status         `json:"errorDetail,omitempty"`
+}
+
+// Status is the JSON representation of a google.rpc.Status used by Envoy to
+// report that a previous response was rejected.
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// DiscoveryResponse is the JSON representation of the Envoy v3
+// DiscoveryResponse used in the REST-JSON xDS transport.
+type DiscoveryResponse struct {
+	VersionInfo string    `json:"versionInfo"`
+	Resources   []*Secret `json:"resources"`
+	TypeURL     string    `json:"typeUrl"`
+	Nonce       string    `json:"nonce,omitempty"`
+}
+
+// Secret is the JSON representation of an Envoy v3 Secret resource.
+type Secret struct {
+	Type              string             `json:"@type"`
+	Name              string             `json:"name"`
+	TLSCertificate    *TLSCertificate    `json:"tlsCertificate,omitempty"`
+	ValidationContext *ValidationContext `json:"validationContext,omitempty"`
+}
+
+// TLSCertificate contains the certificate chain and private key of a
+// workload.
+type TLSCertificate struct {
+	CertificateChain *DataSource `json:"certificateChain"`
+	PrivateKey       *DataSource `json:"privateKey"`
+}
+
+// ValidationContext contains the trusted certificates used to validate peers.
+type ValidationContext struct {
+	TrustedCA *DataSource `json:"trustedCa"`
+}
+
+// DataSource is the Envoy data source with inlined contents.
+type DataSource struct {
+	InlineString string `json:"inlineString"`
+}
+
+// newTLSCertificateSecret returns the secret with the given certificate chain
+// and PEM encoded private key.
+func newTLSCertificateSecret(name string, chain []*x509.Certificate, keyPEM []byte) *Secret {
+	return &Secret{
+		Type: SecretTypeURL,
+		Name: name,
+		TLSCertificate: &TLSCertificate{
+			CertificateChain: &DataSource{InlineString: string(encodeCertificates(chain))},
+			PrivateKey:       &DataSource{InlineString: string(keyPEM)},
+		},
+	}
+}
+
+// newValidationContextSecret returns the secret with the given trusted
+// certificates.
+func newValidationContextSecret(name string, roots []*x509.Certificate) *Secret {
+	return &Secret{
+		Type: SecretTypeURL,
+		Name: name,
+		ValidationContext: &ValidationContext{
+			TrustedCA: &DataSource{InlineString: string(encodeCertificates(roots))},
+		},
+	}
+}
+
+// version returns a version string that will change if any of the resources
+// changes.
+func version(resources []*Secret) string {
+	h := sha256.New()
+	for _, r := range resources {
+		h.Write([]byte(r.Name))
+		if r.TLSCertificate != nil {
+			h.Write([]byte(r.TLSCertificate.CertificateChain.InlineString))
+		}
+		if r.ValidationContext != nil {
+			h.Write([]byte(r.ValidationContext.TrustedCA.InlineString))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package awssm
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms/uri"
+	"github.com/smallstep/certificates/secrets"
+)
+
+// SecretsManagerClient defines the methods on the Secrets Manager client that
+// this package will use. This interface will be used for unit testing.
+type SecretsManagerClient interface {
+	GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+var newSecretsManagerClient = func(o session.Options) (SecretsManagerClient, error) {
+	sess, err := session.NewSessionWithOptions(o)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating AWS session")
+	}
+	return secretsmanager.New(sess), nil
+}
+
+func init() {
+	secrets.Register(secrets.AWSSecretsManager, GetSecret)
+}
+
+// GetSecret returns the AWS Secrets Manager secret in the given uri, e.g.
+// "awssm:name=step-ca/jwk;region=us-east-1". The name can be the name or the
+// ARN of the secret, and the version stage can be set with the "stage"
+// attribute.
+//
+// By default, sessions will be created using the credentials in
+// `~/.aws/credentials`, but this can be overridden using the
+// "credentials-file" attribute, the "region" and "profile" can also be set in
+// the uri.
+func GetSecret(ctx context.Context, u *uri.URI) ([]byte, error) {
+	name := u.Get("name")
+	if name == "" {
+		return nil, errors.New("awssm uri does not have a name")
+	}
+
+	var o session.Options
+	o.Profile = u.Get("profile")
+	if v := u.Get("region"); v != "" {
+		o.Config.Region = aws.String(v)
+	}
+	if f := u.Get("credentials-file"); f != "" {
+		o.SharedConfigFiles = []string{f}
+	}
+	client, err := newSecretsManagerClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	}
+	if v := u.Get("stage"); v != "" {
+		input.VersionStage = aws.String(v)
+	}
+	resp, err := client.GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading secret %s", name)
+	}
+	if resp.SecretString != nil {
+		return []byte(*resp.SecretString), nil
+	}
+	return resp.SecretBinary, nil
+}
@@ -0,0 +1,85 @@
+package awssm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+type mockClient struct {
+	getSecretValue func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+func (m *mockClient) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	return m.getSecretValue(input)
+}
+
+func TestGetSecret(t *testing.T) {
+	tmp := newSecretsManagerClient
+	t.Cleanup(func() {
+		newSecretsManagerClient = tmp
+	})
+
+	var options session.Options
+	newSecretsManagerClient = func(o session.Options) (SecretsManagerClient, error) {
+		options = o
+		if o.Profile == "fail" {
+			return nil, errors.New("force")
+		}
+		return &mockClient{
+			getSecretValue: func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+				switch aws.StringValue(input.SecretId) {
+				case "string":
+					return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("the-secret")}, nil
+				case "binary":
+					return &secretsmanager.GetSecretValueOutput{SecretBinary: []byte("the-binary")}, nil
+				case "stage":
+					return &secretsmanager.GetSecretValueOutput{SecretString: input.VersionStage}, nil
+				default:
+					return nil, errors.New("not found")
+				}
+			},
+		}, nil
+	}
+
+	tests := []struct {
+		name       string
+		uri        string
+		want       string
+		wantRegion string
+		wantErr    bool
+	}{
+		{"ok string", "awssm:name=string;region=us-east-1", "the-secret", "us-east-1", false},
+		{"ok binary", "awssm:name=binary", "the-binary", "", false},
+		{"ok stage", "awssm:name=stage;stage=AWSPREVIOUS", "AWSPREVIOUS", "", false},
+		{"fail name", "awssm:region=us-east-1", "", "", true},
+		{"fail client", "awssm:name=string;profile=fail", "", "", true},
+		{"fail get", "awssm:name=missing", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options = session.Options{}
+			u, err := uri.Parse(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := GetSecret(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetSecret() = %s, want %s", got, tt.want)
+			}
+			if region := aws.StringValue(options.Config.Region); region != tt.wantRegion {
+				t.Errorf("GetSecret() region = %s, want %s", region, tt.wantRegion)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package gcpsm
+
+import (
+	"context"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms/uri"
+	"github.com/smallstep/certificates/secrets"
+	"google.golang.org/api/option"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// SecretManagerClient defines the methods on the Secret Manager client that
+// this package will use. This interface will be used for unit testing.
+type SecretManagerClient interface {
+	Close() error
+	AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error)
+}
+
+var newSecretManagerClient = func(ctx context.Context, opts ...option.ClientOption) (SecretManagerClient, error) {
+	return secretmanager.NewClient(ctx, opts...)
+}
+
+func init() {
+	secrets.Register(secrets.GCPSecretManager, GetSecret)
+}
+
+// GetSecret returns the Google Cloud Secret Manager secret in the given uri,
+// e.g. "gcpsm:name=projects/my-project/secrets/jwk". The latest version is
+// used if the name does not include a version. The "credentials-file"
+// attribute can be used to set the credentials, by default the application
+// default credentials are used.
+func GetSecret(ctx context.Context, u *uri.URI) ([]byte, error) {
+	name := u.Get("name")
+	if name == "" {
+		return nil, errors.New("gcpsm uri does not have a name")
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	var opts []option.ClientOption
+	if f := u.Get("credentials-file"); f != "" {
+		opts = append(opts, option.WithCredentialsFile(f))
+	}
+	client, err := newSecretManagerClient(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating secret manager client")
+	}
+	defer client.Close()
+
+	resp, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: name,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error accessing secret %s", name)
+	}
+	return resp.GetPayload().GetData(), nil
+}
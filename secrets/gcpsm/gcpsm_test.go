@@ -0,0 +1,84 @@
+package gcpsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/smallstep/certificates/kms/uri"
+	"google.golang.org/api/option"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+type mockClient struct {
+	accessSecretVersion func(req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error)
+}
+
+func (m *mockClient) Close() error {
+	return nil
+}
+
+func (m *mockClient) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	return m.accessSecretVersion(req)
+}
+
+func TestGetSecret(t *testing.T) {
+	tmp := newSecretManagerClient
+	t.Cleanup(func() {
+		newSecretManagerClient = tmp
+	})
+
+	newSecretManagerClient = func(ctx context.Context, opts ...option.ClientOption) (SecretManagerClient, error) {
+		if len(opts) > 0 {
+			return nil, errors.New("force")
+		}
+		return &mockClient{
+			accessSecretVersion: func(req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+				switch req.Name {
+				case "projects/p/secrets/jwk/versions/latest":
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("the-latest")},
+					}, nil
+				case "projects/p/secrets/jwk/versions/1":
+					return &secretmanagerpb.AccessSecretVersionResponse{
+						Name:    req.Name,
+						Payload: &secretmanagerpb.SecretPayload{Data: []byte("the-first")},
+					}, nil
+				default:
+					return nil, errors.New("not found")
+				}
+			},
+		}, nil
+	}
+
+	tests := []struct {
+		name    string
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{"ok latest", "gcpsm:name=projects/p/secrets/jwk", "the-latest", false},
+		{"ok version", "gcpsm:name=projects/p/secrets/jwk/versions/1", "the-first", false},
+		{"fail name", "gcpsm:field=foo", "", true},
+		{"fail client", "gcpsm:name=projects/p/secrets/jwk;credentials-file=testdata/missing.json", "", true},
+		{"fail access", "gcpsm:name=projects/p/secrets/missing", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := uri.Parse(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := GetSecret(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetSecret() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
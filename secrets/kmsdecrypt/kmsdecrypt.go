@@ -0,0 +1,69 @@
+// Package kmsdecrypt implements a password source that decrypts a file with a
+// key stored in a KMS.
+package kmsdecrypt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms"
+	"github.com/smallstep/certificates/kms/apiv1"
+	"github.com/smallstep/certificates/kms/uri"
+	"github.com/smallstep/certificates/secrets"
+)
+
+func init() {
+	secrets.Register(secrets.KMSDecrypt, GetSecret)
+}
+
+// GetSecret decrypts the file in the "ciphertext" attribute of the given uri
+// using the key in the "key" attribute, e.g.
+// "kms-decrypt:kms=awskms;key=awskms:key-id=1234;ciphertext=/etc/step-ca/password.enc".
+// The ciphertext must be encrypted with RSA-OAEP and SHA-256.
+//
+// The "kms" attribute is the type of the KMS, softkms by default, and the
+// "kms-uri" attribute the uri used to configure it. The KMS must support
+// decryption.
+func GetSecret(ctx context.Context, u *uri.URI) ([]byte, error) {
+	key := u.Get("key")
+	if key == "" {
+		return nil, errors.New("kms-decrypt uri does not have a key")
+	}
+	filename := u.Get("ciphertext")
+	if filename == "" {
+		return nil, errors.New("kms-decrypt uri does not have a ciphertext")
+	}
+	ciphertext, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+
+	km, err := kms.New(ctx, apiv1.Options{
+		Type: u.Get("kms"),
+		URI:  u.Get("kms-uri"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer km.Close()
+
+	dm, ok := km.(apiv1.Decrypter)
+	if !ok {
+		return nil, errors.Errorf("kms %s does not support decryption", u.Get("kms"))
+	}
+	decrypter, err := dm.CreateDecrypter(&apiv1.CreateDecrypterRequest{
+		DecryptionKey: key,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating decrypter")
+	}
+	b, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting %s", filename)
+	}
+	return b, nil
+}
@@ -0,0 +1,72 @@
+package kmsdecrypt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/certificates/kms/uri"
+	"go.step.sm/crypto/pemutil"
+)
+
+func TestGetSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kmsdecrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "password.key")
+	if _, err := pemutil.Serialize(key, pemutil.ToFile(keyFile, 0600)); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, &key.PublicKey, []byte("the-password"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertextFile := filepath.Join(dir, "password.enc")
+	if err := ioutil.WriteFile(ciphertextFile, ciphertext, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		rawuri  string
+		want    string
+		wantErr bool
+	}{
+		{"ok", "kms-decrypt:key=" + keyFile + ";ciphertext=" + ciphertextFile, "the-password", false},
+		{"ok softkms", "kms-decrypt:kms=softkms;key=" + keyFile + ";ciphertext=" + ciphertextFile, "the-password", false},
+		{"fail key", "kms-decrypt:ciphertext=" + ciphertextFile, "", true},
+		{"fail ciphertext", "kms-decrypt:key=" + keyFile, "", true},
+		{"fail missing ciphertext", "kms-decrypt:key=" + keyFile + ";ciphertext=" + filepath.Join(dir, "missing"), "", true},
+		{"fail kms", "kms-decrypt:kms=foo;key=" + keyFile + ";ciphertext=" + ciphertextFile, "", true},
+		{"fail missing key", "kms-decrypt:key=" + filepath.Join(dir, "missing") + ";ciphertext=" + ciphertextFile, "", true},
+		{"fail decrypt", "kms-decrypt:key=" + keyFile + ";ciphertext=" + keyFile, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := uri.Parse(tt.rawuri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := GetSecret(context.Background(), u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetSecret() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
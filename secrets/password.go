@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+const (
+	// File is the type of the password sources that read a file, e.g.
+	// "file:/run/secrets/password".
+	File Type = "file"
+	// Env is the type of the password sources that read an environment
+	// variable, e.g. "env:name=STEP_CA_PASSWORD".
+	Env Type = "env"
+	// SystemdCreds is the type of the password sources that read a systemd
+	// credential, e.g. "systemd-creds:name=step-ca-password". Credentials
+	// encrypted with systemd-creds, including the ones sealed with a TPM, are
+	// decrypted by systemd before starting the service.
+	SystemdCreds Type = "systemd-creds"
+	// KMSDecrypt is the type of the password sources that decrypt a file with
+	// a key in a KMS, e.g.
+	// "kms-decrypt:key=/etc/step-ca/password.key;ciphertext=/etc/step-ca/password.enc".
+	KMSDecrypt Type = "kms-decrypt"
+)
+
+// ReadPassword returns the password in the given source. A source is the
+// path of a file, an uri with the type of a password source, or a reference
+// to a secret manager. The password sources that are not built-in, like
+// kms-decrypt, must be registered using Register. Trailing whitespace is
+// removed from the password.
+func ReadPassword(ctx context.Context, source string) ([]byte, error) {
+	// Paths of files, including Windows paths with a volume name.
+	if u, err := url.Parse(source); err != nil || len(u.Scheme) <= 1 {
+		return readPasswordFile(source)
+	}
+
+	u, err := uri.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	switch t := Type(strings.ToLower(u.Scheme)); t {
+	case File:
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		return readPasswordFile(path)
+	case Env:
+		name := u.Get("name")
+		if name == "" {
+			return nil, errors.Errorf("password source %s does not have a name", source)
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, errors.Errorf("environment variable %s is not set", name)
+		}
+		b = []byte(v)
+	case SystemdCreds:
+		name := u.Get("name")
+		if name == "" {
+			return nil, errors.Errorf("password source %s does not have a name", source)
+		}
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return nil, errors.New("systemd credentials are not available, CREDENTIALS_DIRECTORY is not set")
+		}
+		return readPasswordFile(filepath.Join(dir, name))
+	default:
+		s, err := getSecret(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		b = []byte(s)
+	}
+	return bytes.TrimRightFunc(b, unicode.IsSpace), nil
+}
+
+func readPasswordFile(filename string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	return bytes.TrimRightFunc(b, unicode.IsSpace), nil
+}
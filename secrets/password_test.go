@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+func TestReadPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(filename, []byte("file-password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := filepath.Join(dir, "credentials")
+	if err := os.Mkdir(credentials, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(credentials, "step-ca-password"), []byte("systemd-password"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Register(Vault, func(ctx context.Context, u *uri.URI) ([]byte, error) {
+		return []byte(`{"password":"vault-password"}`), nil
+	})
+	t.Cleanup(func() {
+		registry.Delete(Vault)
+		os.Unsetenv("STEP_CA_TEST_PASSWORD")
+		os.Unsetenv("CREDENTIALS_DIRECTORY")
+	})
+	os.Setenv("STEP_CA_TEST_PASSWORD", "env-password\n")
+
+	tests := []struct {
+		name           string
+		source         string
+		credentialsDir string
+		want           string
+		wantErr        bool
+	}{
+		{"ok path", filename, "", "file-password", false},
+		{"ok file", "file:" + filename, "", "file-password", false},
+		{"ok file url", "file://" + filename, "", "file-password", false},
+		{"ok env", "env:name=STEP_CA_TEST_PASSWORD", "", "env-password", false},
+		{"ok systemd-creds", "systemd-creds:name=step-ca-password", credentials, "systemd-password", false},
+		{"ok vault", "vault:path=secret/data/step-ca;field=password", "", "vault-password", false},
+		{"fail path", filepath.Join(dir, "missing"), "", "", true},
+		{"fail env name", "env:", "", "", true},
+		{"fail env missing", "env:name=STEP_CA_TEST_MISSING", "", "", true},
+		{"fail systemd-creds name", "systemd-creds:", credentials, "", true},
+		{"fail systemd-creds directory", "systemd-creds:name=step-ca-password", "", "", true},
+		{"fail systemd-creds missing", "systemd-creds:name=missing", credentials, "", true},
+		{"fail unsupported", "foo:name=bar", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("CREDENTIALS_DIRECTORY", tt.credentialsDir)
+			got, err := ReadPassword(context.Background(), tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadPassword() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadPassword() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
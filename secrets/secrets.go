@@ -0,0 +1,110 @@
+// Package secrets resolves references to secrets stored in external secret
+// managers, so the configuration files do not need to contain them.
+//
+// A reference is an uri with the scheme of a secret manager, e.g.
+// "vault:path=secret/data/step-ca;field=encryptedKey". If the uri contains a
+// field, the secret must be a JSON object and the value of the field is used.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+// Type is the uri scheme of the references handled by a secret manager.
+type Type string
+
+const (
+	// Vault is the type of the references to HashiCorp Vault secrets.
+	Vault Type = "vault"
+	// AWSSecretsManager is the type of the references to AWS Secrets Manager
+	// secrets.
+	AWSSecretsManager Type = "awssm"
+	// GCPSecretManager is the type of the references to Google Cloud Secret
+	// Manager secrets.
+	GCPSecretManager Type = "gcpsm"
+)
+
+// GetSecretFunc is the function that returns the secret referenced by the
+// given uri.
+type GetSecretFunc func(ctx context.Context, u *uri.URI) ([]byte, error)
+
+var registry = new(sync.Map)
+
+// Register adds to the registry the function used to get the secrets of type t.
+func Register(t Type, fn GetSecretFunc) {
+	registry.Store(t, fn)
+}
+
+// LoadGetSecretFunc returns the function used to get the secrets of type t.
+func LoadGetSecretFunc(t Type) (GetSecretFunc, bool) {
+	v, ok := registry.Load(t)
+	if !ok {
+		return nil, false
+	}
+	fn, ok := v.(GetSecretFunc)
+	return fn, ok
+}
+
+// IsReference returns true if the given value is a reference to a secret
+// manager.
+func IsReference(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	switch Type(strings.ToLower(u.Scheme)) {
+	case Vault, AWSSecretsManager, GCPSecretManager:
+		return true
+	default:
+		return false
+	}
+}
+
+// Resolve returns the secret referenced by the given value. If the value is
+// not a reference it is returned as is.
+func Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	u, err := uri.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return getSecret(ctx, u)
+}
+
+// getSecret returns the secret referenced by the given uri using the function
+// registered for its type.
+func getSecret(ctx context.Context, u *uri.URI) (string, error) {
+	t := Type(strings.ToLower(u.Scheme))
+	fn, ok := LoadGetSecretFunc(t)
+	if !ok {
+		return "", errors.Errorf("unsupported secret manager '%s'", t)
+	}
+	b, err := fn(ctx, u)
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting secret from %s", t)
+	}
+
+	field := u.Get("field")
+	if field == "" {
+		return string(b), nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", errors.Wrapf(err, "error parsing %s secret", t)
+	}
+	s, ok := m[field].(string)
+	if !ok {
+		return "", errors.Errorf("%s secret does not have a string field '%s'", t, field)
+	}
+	return s, nil
+}
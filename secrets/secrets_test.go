@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+func TestIsReference(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"vault", "vault:path=secret/data/step-ca;field=encryptedKey", true},
+		{"awssm", "awssm:name=step-ca/jwk;region=us-east-1", true},
+		{"gcpsm", "GCPSM:name=projects/my-project/secrets/jwk", true},
+		{"jwe", "eyJhbGciOiJQQkVTMi1IUzI1NitBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIn0.abc.def.ghi.jkl", false},
+		{"secret", "my:secret", false},
+		{"empty", "", false},
+		{"invalid", "%%", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsReference(tt.value); got != tt.want {
+				t.Errorf("IsReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	Register(Vault, func(ctx context.Context, u *uri.URI) ([]byte, error) {
+		switch u.Get("path") {
+		case "fail":
+			return nil, errors.New("force")
+		case "json":
+			return []byte(`{"encryptedKey":"the-key","number":1}`), nil
+		default:
+			return []byte("the-secret"), nil
+		}
+	})
+	t.Cleanup(func() {
+		registry.Delete(Vault)
+	})
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"ok not reference", "the-value", "the-value", false},
+		{"ok", "vault:path=raw", "the-secret", false},
+		{"ok field", "vault:path=json;field=encryptedKey", "the-key", false},
+		{"fail unsupported", "awssm:name=foo", "", true},
+		{"fail get", "vault:path=fail", "", true},
+		{"fail not json", "vault:path=raw;field=encryptedKey", "", true},
+		{"fail missing field", "vault:path=json;field=missing", "", true},
+		{"fail not string", "vault:path=json;field=number", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(context.Background(), tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
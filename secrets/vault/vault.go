@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/kms/uri"
+	"github.com/smallstep/certificates/secrets"
+)
+
+// httpClient is the client used to connect to Vault.
+var httpClient = &http.Client{
+	Timeout: 15 * time.Second,
+}
+
+func init() {
+	secrets.Register(secrets.Vault, GetSecret)
+}
+
+// GetSecret returns the data of the Vault secret in the given uri as a JSON
+// object, e.g. "vault:path=secret/data/step-ca;field=encryptedKey". Both KV
+// version 1 and version 2 secrets are supported.
+//
+// The address, token and namespace are read from the VAULT_ADDR, VAULT_TOKEN
+// and VAULT_NAMESPACE environment variables, the address can also be set with
+// the "addr" attribute.
+func GetSecret(ctx context.Context, u *uri.URI) ([]byte, error) {
+	path := strings.Trim(u.Get("path"), "/")
+	if path == "" {
+		return nil, errors.New("vault uri does not have a path")
+	}
+	addr := u.Get("addr")
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, errors.New("vault address is not set, use VAULT_ADDR or the addr attribute")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, errors.New("vault token is not set, use VAULT_TOKEN")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating vault request")
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading vault secret %s", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error reading vault secret %s: status code %d", path, resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, errors.Wrapf(err, "error decoding vault secret %s", path)
+	}
+	// KV version 2 secrets contain the data and the metadata of the version.
+	data := body.Data
+	if v, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = v
+		}
+	}
+	return json.Marshal(data)
+}
@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/smallstep/certificates/kms/uri"
+)
+
+func mustParse(t *testing.T, rawuri string) *uri.URI {
+	t.Helper()
+	u, err := uri.Parse(rawuri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestGetSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "the-token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/step-ca":
+			w.Write([]byte(`{"data":{"data":{"encryptedKey":"the-key"},"metadata":{"version":1}}}`))
+		case "/v1/kv/step-ca":
+			w.Write([]byte(`{"data":{"encryptedKey":"the-key"}}`))
+		case "/v1/kv/invalid":
+			w.Write([]byte(`{`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "the-token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	tests := []struct {
+		name    string
+		uri     string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{"ok kv2", "vault:path=secret/data/step-ca", "the-token", `{"encryptedKey":"the-key"}`, false},
+		{"ok kv1", "vault:path=/kv/step-ca", "the-token", `{"encryptedKey":"the-key"}`, false},
+		{"ok addr", "vault:path=kv/step-ca;addr=" + srv.URL, "the-token", `{"encryptedKey":"the-key"}`, false},
+		{"fail path", "vault:field=encryptedKey", "the-token", "", true},
+		{"fail token", "vault:path=kv/step-ca", "", "", true},
+		{"fail forbidden", "vault:path=kv/step-ca", "bad-token", "", true},
+		{"fail not found", "vault:path=kv/missing", "the-token", "", true},
+		{"fail decode", "vault:path=kv/invalid", "the-token", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("VAULT_TOKEN", tt.token)
+			got, err := GetSecret(context.Background(), mustParse(t, tt.uri))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetSecret() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -49,10 +49,11 @@ func newHTTPServer(addr string, handler http.Handler, tlsConfig *tls.Config) *ht
 	}
 }
 
-// ListenAndServe listens on the TCP network address srv.Addr and then calls
-// Serve to handle requests on incoming connections.
+// ListenAndServe listens on the TCP network address srv.Addr, or uses the
+// socket passed by systemd for it, and then calls Serve to handle requests on
+// incoming connections.
 func (srv *Server) ListenAndServe() error {
-	ln, err := net.Listen("tcp", srv.Addr)
+	ln, err := Listen(srv.Addr)
 	if err != nil {
 		return err
 	}
@@ -113,9 +114,16 @@ func (srv *Server) Reload(ns *Server) error {
 	var err error
 	var ln net.Listener
 
+	// A server that is not serving, like the one of a CA embedded in another
+	// application, only needs the new configuration.
+	if srv.listener == nil {
+		srv.Server = ns.Server
+		return nil
+	}
+
 	if srv.Addr != ns.Addr {
 		// Open new address
-		ln, err = net.Listen("tcp", ns.Addr)
+		ln, err = Listen(ns.Addr)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+var listenFdsStart = 3
+
+// Sockets passed by systemd using socket activation.
+var (
+	activationOnce      sync.Once
+	activationMutex     sync.Mutex
+	activationListeners []*net.TCPListener
+)
+
+// Listen returns the TCP listener passed by systemd for the given address, or
+// a new one if there is none. A socket passed by systemd matches the address
+// if it listens on the same port, and on the same IP if the address contains
+// one. Each socket is only returned once.
+func Listen(addr string) (net.Listener, error) {
+	activationOnce.Do(loadActivationListeners)
+
+	activationMutex.Lock()
+	for i, ln := range activationListeners {
+		if matchAddr(ln.Addr(), addr) {
+			activationListeners = append(activationListeners[:i], activationListeners[i+1:]...)
+			activationMutex.Unlock()
+			log.Printf("Using socket %s passed by systemd for %s", ln.Addr(), addr)
+			return ln, nil
+		}
+	}
+	activationMutex.Unlock()
+
+	return net.Listen("tcp", addr)
+}
+
+// loadActivationListeners loads the sockets passed by systemd in the
+// LISTEN_PID and LISTEN_FDS environment variables. The variables are removed,
+// so they are not inherited by child processes.
+func loadActivationListeners() {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid == "" || fds == "" || pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n <= 0 {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Printf("error using socket %d passed by systemd: %v", fd, err)
+			continue
+		}
+		tcpLn, ok := ln.(*net.TCPListener)
+		if !ok {
+			log.Printf("error using socket %d passed by systemd: %s is not a TCP socket", fd, ln.Addr())
+			ln.Close()
+			continue
+		}
+		activationListeners = append(activationListeners, tcpLn)
+	}
+}
+
+// matchAddr returns true if the listener address is the given host:port
+// address. An empty or unspecified host matches any IP.
+func matchAddr(lnAddr net.Addr, addr string) bool {
+	tcpAddr, ok := lnAddr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port != strconv.Itoa(tcpAddr.Port) {
+		return false
+	}
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return false
+	case ip.IsUnspecified():
+		return true
+	default:
+		return ip.Equal(tcpAddr.IP)
+	}
+}
+
+// Notify sends the given state to systemd using the socket in the
+// NOTIFY_SOCKET environment variable, e.g. "READY=1". It does nothing if the
+// variable is not set.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if strings.HasPrefix(socket, "@") {
+		// Abstract socket
+		addr.Name = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to systemd notify socket")
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return errors.Wrap(err, "error notifying systemd")
+	}
+	return nil
+}
+
+// NotifyReloading notifies systemd that the service is reloading its
+// configuration. The service must notify "READY=1" once the reload finishes.
+func NotifyReloading() error {
+	return Notify("RELOADING=1")
+}
+
+// WatchdogInterval returns the watchdog timeout configured with WatchdogSec in
+// the service unit, or 0 if the watchdog is not enabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog sends the keep-alive pings to the systemd watchdog at half of its
+// timeout, until the returned function is called. It does nothing if the
+// watchdog is not enabled.
+func Watchdog() (stop func()) {
+	interval := WatchdogInterval() / 2
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := Notify("WATCHDOG=1"); err != nil {
+					log.Println(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	defer func(start int) {
+		listenFdsStart = start
+		activationOnce = sync.Once{}
+	}(listenFdsStart)
+	listenFdsStart = int(f.Fd())
+	activationOnce = sync.Once{}
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+
+	got, err := Listen(":" + port)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer got.Close()
+	if got.Addr().String() != ln.Addr().String() {
+		t.Errorf("Listen() addr = %s, want %s", got.Addr(), ln.Addr())
+	}
+	if os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDS") != "" {
+		t.Error("Listen() did not remove the environment variables")
+	}
+
+	// The socket is only used once.
+	if _, err := Listen(":" + port); err == nil {
+		t.Error("Listen() error = nil, want address in use")
+	}
+
+	// Other addresses use a new listener.
+	other, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	other.Close()
+}
+
+func Test_matchAddr(t *testing.T) {
+	v4 := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443}
+	v6 := &net.TCPAddr{IP: net.ParseIP("::"), Port: 443}
+	tests := []struct {
+		name   string
+		lnAddr net.Addr
+		addr   string
+		want   bool
+	}{
+		{"ok port", v4, ":443", true},
+		{"ok ip", v4, "127.0.0.1:443", true},
+		{"ok unspecified", v4, "0.0.0.0:443", true},
+		{"ok ipv6", v6, "[::]:443", true},
+		{"fail port", v4, ":8443", false},
+		{"fail ip", v4, "10.0.0.1:443", false},
+		{"fail hostname", v4, "localhost:443", false},
+		{"fail addr", v4, "127.0.0.1", false},
+		{"fail unix", &net.UnixAddr{Name: "/tmp/sock", Net: "unix"}, ":443", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchAddr(tt.lnAddr, tt.addr); got != tt.want {
+				t.Errorf("matchAddr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("Notify() error = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	read := func() string {
+		t.Helper()
+		b := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b[:n])
+	}
+
+	if err := Notify("READY=1"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got := read(); got != "READY=1" {
+		t.Errorf("Notify() sent %q, want %q", got, "READY=1")
+	}
+	if err := NotifyReloading(); err != nil {
+		t.Fatalf("NotifyReloading() error = %v", err)
+	}
+	if got := read(); got != "RELOADING=1" {
+		t.Errorf("NotifyReloading() sent %q, want %q", got, "RELOADING=1")
+	}
+
+	// The watchdog pings at half of its timeout.
+	os.Setenv("WATCHDOG_USEC", "20000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+	stop := Watchdog()
+	if got := read(); got != "WATCHDOG=1" {
+		t.Errorf("Watchdog() sent %q, want %q", got, "WATCHDOG=1")
+	}
+	stop()
+	stop()
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Unsetenv("WATCHDOG_USEC")
+	if got := WatchdogInterval(); got != 0 {
+		t.Errorf("WatchdogInterval() = %s, want 0", got)
+	}
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if got := WatchdogInterval(); got != 30*time.Second {
+		t.Errorf("WatchdogInterval() = %s, want 30s", got)
+	}
+
+	os.Setenv("WATCHDOG_PID", "1")
+	if got := WatchdogInterval(); got != 0 {
+		t.Errorf("WatchdogInterval() = %s, want 0", got)
+	}
+}
@@ -0,0 +1,87 @@
+package truststore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jksMagic          = 0xFEEDFEED
+	jksVersion        = 2
+	jksTrustedCertTag = 2
+	jksWhitener       = "Mighty Aphrodite"
+)
+
+// EncodeJKS returns a Java KeyStore with the given trusted certificates. The
+// creation date of each entry is the start of the validity of the certificate,
+// so the same entries always produce the same truststore.
+func EncodeJKS(entries []Entry, password string) ([]byte, error) {
+	var buf bytes.Buffer
+	writeUint32(&buf, jksMagic)
+	writeUint32(&buf, jksVersion)
+	writeUint32(&buf, uint32(len(entries)))
+	for _, e := range entries {
+		if e.Certificate == nil {
+			return nil, errors.Errorf("truststore entry %s does not have a certificate", e.Alias)
+		}
+		writeUint32(&buf, jksTrustedCertTag)
+		if err := writeUTF(&buf, e.Alias); err != nil {
+			return nil, err
+		}
+		writeUint64(&buf, uint64(e.Certificate.NotBefore.UnixNano()/1e6))
+		if err := writeUTF(&buf, "X.509"); err != nil {
+			return nil, err
+		}
+		writeUint32(&buf, uint32(len(e.Certificate.Raw)))
+		buf.Write(e.Certificate.Raw)
+	}
+
+	// The integrity check is the SHA-1 of the password as UTF-16, a fixed
+	// string, and the contents.
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte(jksWhitener))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+// writeUTF writes a string using the modified UTF-8 encoding of Java's
+// DataOutput.writeUTF.
+func writeUTF(buf *bytes.Buffer, s string) error {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		switch {
+		case c != 0 && c < 0x80:
+			b = append(b, byte(c))
+		case c < 0x800:
+			b = append(b, byte(0xC0|(c>>6)), byte(0x80|(c&0x3F)))
+		default:
+			b = append(b, byte(0xE0|(c>>12)), byte(0x80|((c>>6)&0x3F)), byte(0x80|(c&0x3F)))
+		}
+	}
+	if len(b) > 0xFFFF {
+		return errors.Errorf("truststore alias %s is too long", s)
+	}
+	buf.Write([]byte{byte(len(b) >> 8), byte(len(b))})
+	buf.Write(b)
+	return nil
+}
@@ -0,0 +1,233 @@
+package truststore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// PKCS12MACIterations is the number of iterations used to derive the key of
+// the integrity check of PKCS #12 truststores.
+const PKCS12MACIterations = 2048
+
+var (
+	oidDataContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidSHA1                = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidJavaTrustStore      = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // EXPLICIT [0]
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     // EXPLICIT [0]
+	Attributes []pkcs12Attribute `asn1:"set"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+// EncodePKCS12 returns a PKCS #12 file with the given trusted certificates.
+// The certificate bags are not encrypted, and the entries are marked as
+// trusted for any purpose so Java loads them as trusted certificate entries.
+func EncodePKCS12(entries []Entry, password string) ([]byte, error) {
+	bags := make([]safeBag, len(entries))
+	for i, e := range entries {
+		if e.Certificate == nil {
+			return nil, errors.Errorf("truststore entry %s does not have a certificate", e.Alias)
+		}
+		bag, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: e.Certificate.Raw})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling certificate bag")
+		}
+		friendlyName, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(e.Alias)})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling friendly name")
+		}
+		trusted, err := asn1.Marshal(oidAnyExtendedKeyUsage)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling trusted usage")
+		}
+		bags[i] = safeBag{
+			ID:    oidCertBag,
+			Value: explicitValue(bag),
+			Attributes: []pkcs12Attribute{
+				{ID: oidFriendlyName, Value: asn1.RawValue{Tag: asn1.TagSet, Class: asn1.ClassUniversal, IsCompound: true, Bytes: friendlyName}},
+				{ID: oidJavaTrustStore, Value: asn1.RawValue{Tag: asn1.TagSet, Class: asn1.ClassUniversal, IsCompound: true, Bytes: trusted}},
+			},
+		}
+	}
+
+	safeContents, err := asn1.Marshal(bags)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling safe contents")
+	}
+	data, err := dataContentInfo(safeContents)
+	if err != nil {
+		return nil, err
+	}
+	authenticatedSafe, err := asn1.Marshal([]contentInfo{data})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling authenticated safe")
+	}
+	authSafe, err := dataContentInfo(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	// Integrity check with an HMAC-SHA1 of the authenticated safe.
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "error generating salt")
+	}
+	key := pbkdf(sha1.New, bmpPassword(password), salt, 3, PKCS12MACIterations, sha1.Size)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(authenticatedSafe)
+
+	b, err := asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: authSafe,
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    salt,
+			Iterations: PKCS12MACIterations,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pkcs12")
+	}
+	return b, nil
+}
+
+// dataContentInfo returns a ContentInfo of type data with the given content.
+func dataContentInfo(content []byte) (contentInfo, error) {
+	b, err := asn1.Marshal(content)
+	if err != nil {
+		return contentInfo{}, errors.Wrap(err, "error marshaling content info")
+	}
+	return contentInfo{
+		ContentType: oidDataContentType,
+		Content:     explicitValue(b),
+	}, nil
+}
+
+// explicitValue returns the EXPLICIT [0] with the given DER value. The asn1
+// package ignores the field tags of a RawValue, so the tag is added here.
+func explicitValue(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+// bmpString returns the BMPString encoding of s.
+func bmpString(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(u))
+	for _, c := range u {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
+
+// bmpPassword returns the password encoding used by the PKCS #12 key
+// derivation, a null terminated BMPString.
+func bmpPassword(password string) []byte {
+	return append(bmpString(password), 0, 0)
+}
+
+// pbkdf implements the PKCS #12 key derivation function defined in RFC 7292,
+// appendix B.2.
+func pbkdf(h func() hash.Hash, password, salt []byte, id byte, iterations, size int) []byte {
+	hh := h()
+	v := hh.BlockSize()
+
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		n := v * ((len(b) + v - 1) / v)
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	i := append(fill(salt), fill(password)...)
+
+	one := big.NewInt(1)
+	var out []byte
+	for len(out) < size {
+		hh.Reset()
+		hh.Write(d)
+		hh.Write(i)
+		a := hh.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			hh.Reset()
+			hh.Write(a)
+			a = hh.Sum(a[:0])
+		}
+		out = append(out, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v), where B is A repeated.
+		b := new(big.Int).SetBytes(fill(a)[:v])
+		b.Add(b, one)
+		for j := 0; j < len(i); j += v {
+			ij := new(big.Int).SetBytes(i[j : j+v])
+			ij.Add(ij, b)
+			bs := ij.Bytes()
+			if len(bs) > v {
+				bs = bs[len(bs)-v:]
+			}
+			block := i[j : j+v]
+			for k := range block {
+				block[k] = 0
+			}
+			copy(block[v-len(bs):], bs)
+		}
+	}
+	return out[:size]
+}
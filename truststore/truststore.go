@@ -0,0 +1,17 @@
+// Package truststore encodes certificates as the truststores used by Java and
+// other ecosystems: Java KeyStore (JKS) and PKCS #12 files with only trusted
+// certificate entries.
+package truststore
+
+import (
+	"crypto/x509"
+)
+
+// DefaultPassword is the password used by default in the Java truststores.
+const DefaultPassword = "changeit"
+
+// Entry is a trusted certificate entry in a truststore.
+type Entry struct {
+	Alias       string
+	Certificate *x509.Certificate
+}
@@ -0,0 +1,255 @@
+package truststore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func mustCertificate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Unix(1600000000, 0),
+		NotAfter:              time.Unix(1600000000, 0).Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+type jksReader struct {
+	t *testing.T
+	b []byte
+}
+
+func (r *jksReader) next(n int) []byte {
+	r.t.Helper()
+	if len(r.b) < n {
+		r.t.Fatalf("truncated keystore")
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *jksReader) uint64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+func (r *jksReader) utf() string {
+	n := binary.BigEndian.Uint16(r.next(2))
+	return string(r.next(int(n)))
+}
+
+func TestEncodeJKS(t *testing.T) {
+	root := mustCertificate(t, "Root CA")
+	intermediate := mustCertificate(t, "Intermediate CA")
+	entries := []Entry{{"root-ca", root}, {"intermediate-ca", intermediate}}
+
+	b, err := EncodeJKS(entries, DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := EncodeJKS(entries, DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, b2) {
+		t.Error("EncodeJKS() is not deterministic")
+	}
+
+	r := &jksReader{t: t, b: b}
+	if v := r.uint32(); v != jksMagic {
+		t.Errorf("magic = %x, want %x", v, jksMagic)
+	}
+	if v := r.uint32(); v != jksVersion {
+		t.Errorf("version = %d, want %d", v, jksVersion)
+	}
+	if v := r.uint32(); v != 2 {
+		t.Fatalf("entries = %d, want 2", v)
+	}
+	for _, e := range entries {
+		if v := r.uint32(); v != jksTrustedCertTag {
+			t.Errorf("tag = %d, want %d", v, jksTrustedCertTag)
+		}
+		if v := r.utf(); v != e.Alias {
+			t.Errorf("alias = %s, want %s", v, e.Alias)
+		}
+		if v := r.uint64(); v != 1600000000000 {
+			t.Errorf("date = %d, want 1600000000000", v)
+		}
+		if v := r.utf(); v != "X.509" {
+			t.Errorf("type = %s, want X.509", v)
+		}
+		n := r.uint32()
+		if v := r.next(int(n)); !bytes.Equal(v, e.Certificate.Raw) {
+			t.Errorf("certificate %s does not match", e.Alias)
+		}
+	}
+
+	// Digest with "changeit" as UTF-16
+	h := sha1.New()
+	h.Write([]byte{0, 'c', 0, 'h', 0, 'a', 0, 'n', 0, 'g', 0, 'e', 0, 'i', 0, 't'})
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(b[:len(b)-sha1.Size])
+	if v := r.next(sha1.Size); !bytes.Equal(v, h.Sum(nil)) {
+		t.Error("digest does not match")
+	}
+	if len(r.b) != 0 {
+		t.Errorf("keystore has %d extra bytes", len(r.b))
+	}
+
+	if _, err := EncodeJKS([]Entry{{Alias: "foo"}}, DefaultPassword); err == nil {
+		t.Error("EncodeJKS() error = nil, want missing certificate error")
+	}
+}
+
+func TestWriteUTF(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []byte
+	}{
+		{"ascii", "root", []byte{0, 4, 'r', 'o', 'o', 't'}},
+		{"null", "\x00", []byte{0, 2, 0xC0, 0x80}},
+		{"two bytes", "é", []byte{0, 2, 0xC3, 0xA9}},
+		{"three bytes", "€", []byte{0, 3, 0xE2, 0x82, 0xAC}},
+		{"surrogates", "😀", []byte{0, 6, 0xED, 0xA0, 0xBD, 0xED, 0xB8, 0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeUTF(&buf, tt.s); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("writeUTF() = %x, want %x", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPBKDF(t *testing.T) {
+	// Test vector from golang.org/x/crypto/pkcs12.
+	salt := []byte("\xff\xff\xff\xff\xff\xff\xff\xff")
+	key := pbkdf(sha1.New, bmpPassword("sesame"), salt, 1, 2048, 24)
+	want := []byte("\x7c\xd9\xfd\x3e\x2b\x3b\xe7\x69\x1a\x44\xe3\xbe\xf0\xf9\xea\x0f\xb9\xb8\x97\xd4\xe3\x25\xd9\xd1")
+	if !bytes.Equal(key, want) {
+		t.Errorf("pbkdf() = %x, want %x", key, want)
+	}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	root := mustCertificate(t, "Root CA")
+	intermediate := mustCertificate(t, "Intermediate CA")
+	entries := []Entry{{"root-ca", root}, {"intermediate-ca", intermediate}}
+
+	b, err := EncodePKCS12(entries, DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(b, &pfx); err != nil || len(rest) > 0 {
+		t.Fatalf("error parsing pfx: %v", err)
+	}
+	if pfx.Version != 3 || !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		t.Fatalf("unexpected pfx %v", pfx)
+	}
+	var authenticatedSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafe); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the MAC
+	key := pbkdf(sha1.New, bmpPassword(DefaultPassword), pfx.MacData.MacSalt, 3, pfx.MacData.Iterations, sha1.Size)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(authenticatedSafe)
+	if !pfx.MacData.Mac.Algorithm.Algorithm.Equal(oidSHA1) || !hmac.Equal(mac.Sum(nil), pfx.MacData.Mac.Digest) {
+		t.Error("mac does not match")
+	}
+
+	var safe []contentInfo
+	if _, err := asn1.Unmarshal(authenticatedSafe, &safe); err != nil {
+		t.Fatal(err)
+	}
+	if len(safe) != 1 || !safe[0].ContentType.Equal(oidDataContentType) {
+		t.Fatalf("unexpected authenticated safe %v", safe)
+	}
+	var safeContents []byte
+	if _, err := asn1.Unmarshal(safe[0].Content.Bytes, &safeContents); err != nil {
+		t.Fatal(err)
+	}
+	var bags []struct {
+		ID         asn1.ObjectIdentifier
+		Value      asn1.RawValue
+		Attributes []struct {
+			ID    asn1.ObjectIdentifier
+			Value asn1.RawValue
+		} `asn1:"set"`
+	}
+	if _, err := asn1.Unmarshal(safeContents, &bags); err != nil {
+		t.Fatal(err)
+	}
+	if len(bags) != 2 {
+		t.Fatalf("bags = %d, want 2", len(bags))
+	}
+	for i, bag := range bags {
+		var cb certBag
+		if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+			t.Fatal(err)
+		}
+		if !bag.ID.Equal(oidCertBag) || !cb.ID.Equal(oidCertTypeX509) || !bytes.Equal(cb.Data, entries[i].Certificate.Raw) {
+			t.Errorf("bag %d does not match the certificate %s", i, entries[i].Alias)
+		}
+		if len(bag.Attributes) != 2 {
+			t.Fatalf("bag %d has %d attributes, want 2", i, len(bag.Attributes))
+		}
+		// The attributes are a DER SET OF, sorted by encoding.
+		attributes := make(map[string][]byte)
+		for _, attr := range bag.Attributes {
+			attributes[attr.ID.String()] = attr.Value.Bytes
+		}
+		var name asn1.RawValue
+		if _, err := asn1.Unmarshal(attributes[oidFriendlyName.String()], &name); err != nil {
+			t.Fatal(err)
+		}
+		if name.Tag != asn1.TagBMPString || !bytes.Equal(name.Bytes, bmpString(entries[i].Alias)) {
+			t.Errorf("bag %d friendly name does not match %s", i, entries[i].Alias)
+		}
+		var usage asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attributes[oidJavaTrustStore.String()], &usage); err != nil {
+			t.Fatal(err)
+		}
+		if !usage.Equal(oidAnyExtendedKeyUsage) {
+			t.Errorf("bag %d is not trusted", i)
+		}
+	}
+
+	if _, err := EncodePKCS12([]Entry{{Alias: "foo"}}, DefaultPassword); err == nil {
+		t.Error("EncodePKCS12() error = nil, want missing certificate error")
+	}
+}
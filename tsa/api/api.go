@@ -0,0 +1,86 @@
+// Package api implements the HTTP transport of the RFC 3161 time-stamp
+// authority.
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/tsa"
+)
+
+// maxRequestSize is the maximum size of a time-stamp request.
+const maxRequestSize = 64 * 1024
+
+// Service is the interface implemented by the time-stamp authority.
+type Service interface {
+	Timestamp(req *tsa.Request) ([]byte, error)
+}
+
+// Handler is the time-stamp authority HTTP handler.
+type Handler struct {
+	service Service
+}
+
+// New returns a new time-stamp authority router.
+func New(service Service) api.RouterHandler {
+	return &Handler{service: service}
+}
+
+// Route adds the time-stamp authority endpoint to the given router.
+func (h *Handler) Route(r api.Router) {
+	r.MethodFunc(http.MethodPost, "/", h.Timestamp)
+}
+
+// Timestamp is the HTTP handler that receives a DER encoded time-stamp
+// request and returns the time-stamp response. Rejected requests are returned
+// as a time-stamp response with the rejection status.
+func (h *Handler) Timestamp(w http.ResponseWriter, r *http.Request) {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != tsa.QueryContentType {
+		api.WriteError(w, errs.Errorf(http.StatusUnsupportedMediaType, "content type must be %s", tsa.QueryContentType,
+			errs.WithMessage("The request content type must be %s.", tsa.QueryContentType)))
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		api.WriteError(w, errs.BadRequestErr(err, errs.WithMessage("error reading request body")))
+		return
+	}
+
+	var resp []byte
+	token, err := h.timestamp(body)
+	if err != nil {
+		if _, ok := err.(*tsa.Error); !ok {
+			api.LogError(w, err)
+		}
+		resp, err = tsa.NewRejection(err)
+	} else {
+		resp, err = tsa.NewResponse(token)
+	}
+	if err != nil {
+		api.WriteError(w, errs.Wrap(http.StatusInternalServerError, err, "error marshaling time-stamp response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", tsa.ReplyContentType)
+	if _, err := w.Write(resp); err != nil {
+		api.LogError(w, errors.Wrap(err, "error writing time-stamp response"))
+	}
+}
+
+func (h *Handler) timestamp(body []byte) ([]byte, error) {
+	req, err := tsa.ParseRequest(body)
+	if err != nil {
+		return nil, &tsa.Error{
+			FailureInfo: tsa.FailureBadDataFormat,
+			Message:     "error parsing time-stamp request",
+		}
+	}
+	return h.service.Timestamp(req)
+}
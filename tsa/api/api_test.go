@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/tsa"
+)
+
+type mockService struct {
+	timestamp func(req *tsa.Request) ([]byte, error)
+}
+
+func (m *mockService) Timestamp(req *tsa.Request) ([]byte, error) {
+	return m.timestamp(req)
+}
+
+// statusInfo is used to parse the status of a TimeStampResp.
+type statusInfo struct {
+	Status struct {
+		Status       int
+		StatusString []asn1.RawValue `asn1:"optional"`
+		FailInfo     asn1.BitString  `asn1:"optional"`
+	}
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+func TestHandler_Timestamp(t *testing.T) {
+	req, err := asn1.Marshal(tsa.Request{
+		Version: 1,
+		MessageImprint: tsa.MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}},
+			HashedMessage: make([]byte, 32),
+		},
+	})
+	assert.FatalError(t, err)
+	token, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2})
+	assert.FatalError(t, err)
+
+	type test struct {
+		service     Service
+		contentType string
+		body        []byte
+		statusCode  int
+		status      int
+		failInfo    int
+	}
+	tests := map[string]test{
+		"ok": {
+			service: &mockService{timestamp: func(r *tsa.Request) ([]byte, error) {
+				assert.Equals(t, 1, r.Version)
+				return token, nil
+			}},
+			contentType: tsa.QueryContentType,
+			body:        req,
+			statusCode:  http.StatusOK,
+			status:      tsa.StatusGranted,
+		},
+		"ok rejected": {
+			service: &mockService{timestamp: func(r *tsa.Request) ([]byte, error) {
+				return nil, &tsa.Error{FailureInfo: tsa.FailureUnacceptedPolicy, Message: "unaccepted policy"}
+			}},
+			contentType: tsa.QueryContentType,
+			body:        req,
+			statusCode:  http.StatusOK,
+			status:      tsa.StatusRejection,
+			failInfo:    int(tsa.FailureUnacceptedPolicy),
+		},
+		"ok system failure": {
+			service: &mockService{timestamp: func(r *tsa.Request) ([]byte, error) {
+				return nil, errors.New("force")
+			}},
+			contentType: tsa.QueryContentType,
+			body:        req,
+			statusCode:  http.StatusOK,
+			status:      tsa.StatusRejection,
+			failInfo:    int(tsa.FailureSystemFailure),
+		},
+		"ok bad data format": {
+			service:     &mockService{},
+			contentType: tsa.QueryContentType,
+			body:        []byte("foo"),
+			statusCode:  http.StatusOK,
+			status:      tsa.StatusRejection,
+			failInfo:    int(tsa.FailureBadDataFormat),
+		},
+		"fail content type": {
+			service:     &mockService{},
+			contentType: "application/json",
+			body:        req,
+			statusCode:  http.StatusUnsupportedMediaType,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/tsa", bytes.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			h := New(tc.service).(*Handler)
+			h.Timestamp(w, r)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			assert.Equals(t, tsa.ReplyContentType, res.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			var resp statusInfo
+			_, err = asn1.Unmarshal(body, &resp)
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.status, resp.Status.Status)
+			if tc.status == tsa.StatusGranted {
+				assert.Equals(t, token, resp.TimeStampToken.FullBytes)
+			} else {
+				assert.Equals(t, 1, resp.Status.FailInfo.At(tc.failInfo))
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Error is the error returned when a time-stamp request is rejected.
+type Error struct {
+	FailureInfo FailureInfo
+	Message     string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func reject(info FailureInfo, format string, args ...interface{}) error {
+	return &Error{FailureInfo: info, Message: errors.Errorf(format, args...).Error()}
+}
+
+// Options are the options used to create a time-stamp authority Service.
+type Options struct {
+	// CertificateChain is the time-stamping certificate followed by its
+	// intermediates.
+	CertificateChain []*x509.Certificate
+	// Signer is the key of the time-stamping certificate.
+	Signer crypto.Signer
+	// Policy is the TSA policy included in the time-stamp tokens.
+	Policy asn1.ObjectIdentifier
+	// Accuracy is the accuracy of the time included in the tokens, zero
+	// omits it.
+	Accuracy time.Duration
+}
+
+// Validate checks the time-stamp authority options. The certificate must
+// contain only the critical time-stamping extended key usage.
+func (o *Options) Validate() error {
+	switch {
+	case len(o.CertificateChain) == 0:
+		return errors.New("tsa certificate chain cannot be empty")
+	case o.Signer == nil:
+		return errors.New("tsa signer cannot be nil")
+	case len(o.Policy) == 0:
+		return errors.New("tsa policy cannot be empty")
+	case o.Accuracy < 0:
+		return errors.New("tsa accuracy cannot be negative")
+	}
+
+	cert := o.CertificateChain[0]
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping || len(cert.UnknownExtKeyUsage) > 0 {
+		return errors.New("tsa certificate must have only the timeStamping extended key usage")
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) && !ext.Critical {
+			return errors.New("tsa certificate extended key usage must be critical")
+		}
+	}
+	pub, err := x509.MarshalPKIXPublicKey(o.Signer.Public())
+	if err != nil {
+		return errors.Wrap(err, "error marshaling tsa public key")
+	}
+	if !bytes.Equal(pub, cert.RawSubjectPublicKeyInfo) {
+		return errors.New("tsa signer does not match the tsa certificate")
+	}
+	return nil
+}
+
+// Service signs time-stamp tokens.
+type Service struct {
+	certificateChain []*x509.Certificate
+	signer           crypto.Signer
+	policy           asn1.ObjectIdentifier
+	accuracy         accuracy
+	hash             crypto.Hash
+	hashAlgorithm    pkix.AlgorithmIdentifier
+	sigAlgorithm     pkix.AlgorithmIdentifier
+	now              func() time.Time
+}
+
+// NewService creates a new time-stamp authority service.
+func NewService(opts Options) (*Service, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Service{
+		certificateChain: opts.CertificateChain,
+		signer:           opts.Signer,
+		policy:           opts.Policy,
+		accuracy: accuracy{
+			Seconds: int(opts.Accuracy / time.Second),
+			Millis:  int(opts.Accuracy % time.Second / time.Millisecond),
+			Micros:  int(opts.Accuracy % time.Millisecond / time.Microsecond),
+		},
+		now: time.Now,
+	}
+
+	switch pub := opts.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		s.hash = crypto.SHA256
+		s.sigAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSA, Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			s.hash = crypto.SHA256
+			s.sigAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA256}
+		case elliptic.P384():
+			s.hash = crypto.SHA384
+			s.sigAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA384}
+		case elliptic.P521():
+			s.hash = crypto.SHA512
+			s.sigAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA512}
+		default:
+			return nil, errors.Errorf("unsupported tsa elliptic curve %s", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		s.hash = crypto.SHA512
+		s.sigAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}
+	default:
+		return nil, errors.Errorf("unsupported tsa key type %T", pub)
+	}
+	s.hashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: hashOID(s.hash)}
+
+	return s, nil
+}
+
+// GetCertificateChain returns the time-stamping certificate and its
+// intermediates.
+func (s *Service) GetCertificateChain() []*x509.Certificate {
+	return s.certificateChain
+}
+
+// Timestamp validates the request and returns the DER encoded time-stamp
+// token. Requests that cannot be granted return an *Error.
+func (s *Service) Timestamp(req *Request) ([]byte, error) {
+	if req.Version != 1 {
+		return nil, reject(FailureBadRequest, "unsupported time-stamp request version %d", req.Version)
+	}
+	h, ok := imprintHash(req.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return nil, reject(FailureBadAlg, "unsupported message imprint algorithm %s", req.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	if len(req.MessageImprint.HashedMessage) != h.Size() {
+		return nil, reject(FailureBadDataFormat, "message imprint has an invalid length")
+	}
+	if len(req.ReqPolicy) > 0 && !req.ReqPolicy.Equal(s.policy) {
+		return nil, reject(FailureUnacceptedPolicy, "unaccepted policy %s", req.ReqPolicy)
+	}
+	if len(req.Extensions) > 0 {
+		return nil, reject(FailureUnacceptedExtension, "time-stamp request extensions are not supported")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 159))
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating serial number")
+	}
+	genTime := s.now().UTC().Truncate(time.Second)
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         s.policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   serial,
+		GenTime:        genTime,
+		Accuracy:       s.accuracy,
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling tstInfo")
+	}
+
+	si, err := s.signContent(content, genTime)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{s.hashAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     content,
+		},
+		SignerInfos: []signerInfo{*si},
+	}
+	if req.CertReq {
+		var certs []byte
+		for _, crt := range s.certificateChain {
+			certs = append(certs, crt.Raw...)
+		}
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs}
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling signedData")
+	}
+	token, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling contentInfo")
+	}
+	return token, nil
+}
+
+// signContent creates the signer info of the given TSTInfo.
+func (s *Service) signContent(content []byte, signingTime time.Time) (*signerInfo, error) {
+	cert := s.certificateChain[0]
+
+	h := s.hash.New()
+	h.Write(content)
+	messageDigest := h.Sum(nil)
+	certHash := sha256.Sum256(cert.Raw)
+
+	attrs, err := marshalAttributes([]attributeValue{
+		{oidAttrContentType, oidTSTInfo},
+		{oidAttrSigningTime, signingTime},
+		{oidAttrMessageDigest, messageDigest},
+		{oidAttrSigningCertV2, signingCertificateV2{
+			Certs: []essCertIDv2{{CertHash: certHash[:]}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is calculated over the DER encoding of the SET OF
+	// attributes, but the attributes are stored with an implicit tag.
+	signed, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling signed attributes")
+	}
+	digest, opts := signed, crypto.SignerOpts(crypto.Hash(0))
+	if _, ok := s.signer.Public().(ed25519.PublicKey); !ok {
+		h := s.hash.New()
+		h.Write(signed)
+		digest, opts = h.Sum(nil), s.hash
+	}
+	signature, err := s.signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing time-stamp token")
+	}
+
+	return &signerInfo{
+		Version: 1,
+		SID: issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		},
+		DigestAlgorithm:    s.hashAlgorithm,
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		SignatureAlgorithm: s.sigAlgorithm,
+		Signature:          signature,
+	}, nil
+}
+
+type attributeValue struct {
+	typ   asn1.ObjectIdentifier
+	value interface{}
+}
+
+// marshalAttributes returns the DER encoding of the contents of a SET OF
+// attributes, sorted as required by DER.
+func marshalAttributes(values []attributeValue) ([]byte, error) {
+	encoded := make([][]byte, len(values))
+	for i, v := range values {
+		b, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling attribute %s", v.typ)
+		}
+		encoded[i], err = asn1.Marshal(attribute{
+			Type:   v.typ,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: b},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling attribute %s", v.typ)
+		}
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+	return bytes.Join(encoded, nil), nil
+}
+
+// NewResponse returns the DER encoded time-stamp response with the given
+// token.
+func NewResponse(token []byte) ([]byte, error) {
+	return asn1.Marshal(response{
+		Status:         pkiStatusInfo{Status: StatusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+// NewRejection returns the DER encoded time-stamp response that rejects a
+// request with the given error. Errors that are not an *Error are reported as
+// a system failure without details.
+func NewRejection(err error) ([]byte, error) {
+	info, msg := FailureSystemFailure, "system failure"
+	if e, ok := err.(*Error); ok {
+		info, msg = e.FailureInfo, e.Message
+	}
+	return asn1.Marshal(response{
+		Status: pkiStatusInfo{
+			Status:       StatusRejection,
+			StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(msg)}},
+			FailInfo:     failureBitString(info),
+		},
+	})
+}
+
+// failureBitString encodes the failure info as a named bit string.
+func failureBitString(info FailureInfo) asn1.BitString {
+	n := int(info)
+	b := make([]byte, n/8+1)
+	b[n/8] = 0x80 >> uint(n%8)
+	return asn1.BitString{Bytes: b, BitLength: n + 1}
+}
+
+func imprintHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidHashSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidHashSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidHashSHA512):
+		return crypto.SHA512, true
+	default:
+		return 0, false
+	}
+}
+
+func hashOID(h crypto.Hash) asn1.ObjectIdentifier {
+	switch h {
+	case crypto.SHA384:
+		return oidHashSHA384
+	case crypto.SHA512:
+		return oidHashSHA512
+	default:
+		return oidHashSHA256
+	}
+}
@@ -0,0 +1,283 @@
+package tsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+func mustCertificate(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func mustEKU(t *testing.T, critical bool, usages ...asn1.ObjectIdentifier) pkix.Extension {
+	t.Helper()
+	b, err := asn1.Marshal(usages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oidExtKeyUsage, Critical: critical, Value: b}
+}
+
+// mustTSA returns a root certificate and the chain of a time-stamping
+// certificate signed by it.
+func mustTSA(t *testing.T, key crypto.Signer, eku pkix.Extension) (*x509.Certificate, []*x509.Certificate) {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root := mustCertificate(t, rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+	leaf := mustCertificate(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "Test TSA"},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{eku},
+	}, root, key.Public(), rootKey)
+	return root, []*x509.Certificate{leaf}
+}
+
+var oidTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+
+func TestOptions_Validate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, chain := mustTSA(t, key, mustEKU(t, true, oidTimeStamping))
+	_, nonCritical := mustTSA(t, key, mustEKU(t, false, oidTimeStamping))
+	_, serverAuth := mustTSA(t, key, mustEKU(t, true, oidTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}))
+
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{"ok", &Options{CertificateChain: chain, Signer: key, Policy: testPolicy}, false},
+		{"ok accuracy", &Options{CertificateChain: chain, Signer: key, Policy: testPolicy, Accuracy: time.Second}, false},
+		{"fail chain", &Options{Signer: key, Policy: testPolicy}, true},
+		{"fail signer", &Options{CertificateChain: chain, Policy: testPolicy}, true},
+		{"fail policy", &Options{CertificateChain: chain, Signer: key}, true},
+		{"fail accuracy", &Options{CertificateChain: chain, Signer: key, Policy: testPolicy, Accuracy: -time.Second}, true},
+		{"fail non critical", &Options{CertificateChain: nonCritical, Signer: key, Policy: testPolicy}, true},
+		{"fail serverAuth", &Options{CertificateChain: serverAuth, Signer: key, Policy: testPolicy}, true},
+		{"fail key", &Options{CertificateChain: chain, Signer: otherKey, Policy: testPolicy}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// verifyToken parses and verifies the given time-stamp token and returns the
+// TSTInfo.
+func verifyToken(t *testing.T, token []byte, cert *x509.Certificate, sigAlg x509.SignatureAlgorithm) (*tstInfo, *signedData) {
+	t.Helper()
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		t.Fatal(err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("unexpected content type %s", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	if sd.Version != 3 || !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) != 1 {
+		t.Fatalf("unexpected signed data %+v", sd)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		t.Fatal(err)
+	}
+
+	si := sd.SignerInfos[0]
+	signed, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignature(sigAlg, signed, si.Signature); err != nil {
+		t.Fatalf("error verifying signature: %v", err)
+	}
+	return &info, &sd
+}
+
+func TestService_Timestamp(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 9, 1, 12, 30, 15, 500, time.UTC)
+	sum := sha256.Sum256([]byte("the data"))
+	imprint := MessageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHashSHA256},
+		HashedMessage: sum[:],
+	}
+
+	type args struct {
+		key    crypto.Signer
+		sigAlg x509.SignatureAlgorithm
+		req    *Request
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantInfo FailureInfo
+		wantErr  bool
+	}{
+		{"ok P256", args{p256, x509.ECDSAWithSHA256, &Request{Version: 1, MessageImprint: imprint}}, 0, false},
+		{"ok P384", args{p384, x509.ECDSAWithSHA384, &Request{Version: 1, MessageImprint: imprint, Nonce: big.NewInt(1234), CertReq: true}}, 0, false},
+		{"ok RSA", args{rsaKey, x509.SHA256WithRSA, &Request{Version: 1, MessageImprint: imprint, ReqPolicy: testPolicy}}, 0, false},
+		{"ok Ed25519", args{edKey, x509.PureEd25519, &Request{Version: 1, MessageImprint: imprint, CertReq: true}}, 0, false},
+		{"fail version", args{p256, x509.ECDSAWithSHA256, &Request{Version: 2, MessageImprint: imprint}}, FailureBadRequest, true},
+		{"fail algorithm", args{p256, x509.ECDSAWithSHA256, &Request{Version: 1, MessageImprint: MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}},
+			HashedMessage: sum[:20],
+		}}}, FailureBadAlg, true},
+		{"fail length", args{p256, x509.ECDSAWithSHA256, &Request{Version: 1, MessageImprint: MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidHashSHA384},
+			HashedMessage: sum[:],
+		}}}, FailureBadDataFormat, true},
+		{"fail policy", args{p256, x509.ECDSAWithSHA256, &Request{Version: 1, MessageImprint: imprint, ReqPolicy: asn1.ObjectIdentifier{1, 2, 3}}}, FailureUnacceptedPolicy, true},
+		{"fail extensions", args{p256, x509.ECDSAWithSHA256, &Request{Version: 1, MessageImprint: imprint, Extensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3}}}}}, FailureUnacceptedExtension, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, chain := mustTSA(t, tt.args.key, mustEKU(t, true, oidTimeStamping))
+			s, err := NewService(Options{
+				CertificateChain: chain,
+				Signer:           tt.args.key,
+				Policy:           testPolicy,
+				Accuracy:         1500 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.now = func() time.Time { return now }
+
+			token, err := s.Timestamp(tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.Timestamp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				e, ok := err.(*Error)
+				if !ok {
+					t.Fatalf("Service.Timestamp() error type = %T, want *Error", err)
+				}
+				if e.FailureInfo != tt.wantInfo {
+					t.Errorf("Service.Timestamp() failure info = %v, want %v", e.FailureInfo, tt.wantInfo)
+				}
+				return
+			}
+
+			info, sd := verifyToken(t, token, chain[0], tt.args.sigAlg)
+			if !info.Policy.Equal(testPolicy) {
+				t.Errorf("tstInfo.Policy = %v, want %v", info.Policy, testPolicy)
+			}
+			if !reflect.DeepEqual(info.MessageImprint.HashedMessage, sum[:]) {
+				t.Errorf("tstInfo.MessageImprint = %x, want %x", info.MessageImprint.HashedMessage, sum[:])
+			}
+			if !info.GenTime.Equal(now.Truncate(time.Second)) {
+				t.Errorf("tstInfo.GenTime = %v, want %v", info.GenTime, now.Truncate(time.Second))
+			}
+			if info.Accuracy != (accuracy{Seconds: 1, Millis: 500}) {
+				t.Errorf("tstInfo.Accuracy = %v, want %v", info.Accuracy, accuracy{Seconds: 1, Millis: 500})
+			}
+			if !reflect.DeepEqual(info.Nonce, tt.args.req.Nonce) {
+				t.Errorf("tstInfo.Nonce = %v, want %v", info.Nonce, tt.args.req.Nonce)
+			}
+			if tt.args.req.CertReq != (len(sd.Certificates.Bytes) > 0) {
+				t.Errorf("signedData.Certificates = %x, certReq %v", sd.Certificates.Bytes, tt.args.req.CertReq)
+			}
+		})
+	}
+}
+
+func TestNewRejection(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantString string
+		wantBit    int
+	}{
+		{"ok", reject(FailureBadAlg, "bad algorithm"), "bad algorithm", 0},
+		{"ok policy", reject(FailureUnacceptedPolicy, "bad policy"), "bad policy", 15},
+		{"ok system failure", asn1.SyntaxError{Msg: "internal"}, "system failure", 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewRejection(tt.err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp response
+			if _, err := asn1.Unmarshal(b, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status.Status != StatusRejection {
+				t.Errorf("status = %d, want %d", resp.Status.Status, StatusRejection)
+			}
+			if len(resp.Status.StatusString) != 1 || string(resp.Status.StatusString[0].Bytes) != tt.wantString {
+				t.Errorf("statusString = %v, want %v", resp.Status.StatusString, tt.wantString)
+			}
+			if resp.Status.FailInfo.BitLength != tt.wantBit+1 || resp.Status.FailInfo.At(tt.wantBit) != 1 {
+				t.Errorf("failInfo = %v, want bit %d", resp.Status.FailInfo, tt.wantBit)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Package tsa implements a time-stamp authority (TSA) as defined in RFC 3161.
+// Time-stamp tokens are signed by a dedicated time-stamping certificate and
+// encoded as CMS SignedData structures.
+package tsa
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+)
+
+const (
+	// QueryContentType is the media type of a time-stamp request.
+	QueryContentType = "application/timestamp-query"
+	// ReplyContentType is the media type of a time-stamp response.
+	ReplyContentType = "application/timestamp-reply"
+)
+
+// PKIStatus values defined in RFC 3161, section 2.4.2.
+const (
+	StatusGranted                = 0
+	StatusGrantedWithMods        = 1
+	StatusRejection              = 2
+	StatusWaiting                = 3
+	StatusRevocationWarning      = 4
+	StatusRevocationNotification = 5
+)
+
+// FailureInfo is a PKIFailureInfo value defined in RFC 3161, section 2.4.2.
+type FailureInfo int
+
+// PKIFailureInfo values.
+const (
+	FailureBadAlg              FailureInfo = 0
+	FailureBadRequest          FailureInfo = 2
+	FailureBadDataFormat       FailureInfo = 5
+	FailureTimeNotAvailable    FailureInfo = 14
+	FailureUnacceptedPolicy    FailureInfo = 15
+	FailureUnacceptedExtension FailureInfo = 16
+	FailureAddInfoNotAvailable FailureInfo = 17
+	FailureSystemFailure       FailureInfo = 25
+)
+
+var (
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidAttrSigningCertV2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidExtKeyUsage          = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidHashSHA256           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidHashSHA384           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidHashSHA512           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignatureRSA         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureECDSASHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSASHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSASHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519     = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// MessageImprint contains the hash of the data to be time-stamped.
+type MessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// Request is the TimeStampReq defined in RFC 3161, section 2.4.1.
+type Request struct {
+	Version        int
+	MessageImprint MessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"tag:0,optional"`
+}
+
+// ParseRequest parses a DER encoded time-stamp request.
+func ParseRequest(der []byte) (*Request, error) {
+	var req Request
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data after time-stamp request"}
+	}
+	return &req, nil
+}
+
+// pkiStatusInfo is the PKIStatusInfo defined in RFC 3161, section 2.4.2.
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+// response is the TimeStampResp defined in RFC 3161, section 2.4.2.
+type response struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// accuracy is the Accuracy defined in RFC 3161, section 2.4.2.
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// tstInfo is the TSTInfo defined in RFC 3161, section 2.4.2.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint MessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// contentInfo is the CMS ContentInfo defined in RFC 5652, section 3. The
+// content must be explicitly tagged with [0].
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// encapsulatedContentInfo is defined in RFC 5652, section 5.2.
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+// signedData is the CMS SignedData defined in RFC 5652, section 5.1.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// issuerAndSerialNumber is defined in RFC 5652, section 10.2.4.
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo is the CMS SignerInfo defined in RFC 5652, section 5.3.
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+// attribute is the CMS Attribute defined in RFC 5652, section 5.3.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// essCertIDv2 is defined in RFC 5035, the hash algorithm is omitted as it
+// defaults to SHA-256.
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+// signingCertificateV2 is defined in RFC 5035.
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}